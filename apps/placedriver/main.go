@@ -33,6 +33,27 @@ var (
 	clusterLeadershipAddresses = flagSet.String("cluster-leadership-addresses", "", " the cluster leadership server list")
 	clusterID                  = flagSet.String("cluster-id", "test-cluster", "the cluster id used for separating different cluster.")
 	autoBalance                = flagSet.Bool("auto-balance-and-migrate", false, "auto balance and migrate the data while unstable")
+	balanceByLoad              = flagSet.Bool("balance-by-load", false, "balance the replicas by the data size and write qps instead of the partition count")
+
+	nodeDownThresholdSecs   = flagSet.Int64("node-down-threshold-secs", 0, "the lost node is not regarded as down before this seconds")
+	migrateGraceSecs        = flagSet.Int64("migrate-grace-secs", 0, "the seconds waiting the failed replica back before re-creating it, 0 means the default")
+	emergencyGraceSecs      = flagSet.Int64("emergency-grace-secs", 0, "the seconds waiting the failed replicas back if the quorum failed, 0 means the default")
+	maxRecoveries           = flagSet.Int("max-recoveries", 0, "the max partitions recovering from the failed nodes at the same time, 0 means no limit")
+	failoverConfirmMaxNodes = flagSet.Int("failover-confirm-max-nodes", 0, "the failover need the confirmation if the data nodes is not more than this, 0 means never")
+
+	namespaceExpireGraceSecs = flagSet.Int64("namespace-expire-grace-secs", 0, "the expired namespace is deleted after this seconds, 0 means the default 3600")
+	namespaceExpireHook      = flagSet.String("namespace-expire-hook", "", "the url notified by POST while the namespace is expired and deleted")
+
+	etcdCertFile   = flagSet.String("etcd-cert-file", "", "the client cert file to access the etcd cluster with tls")
+	etcdKeyFile    = flagSet.String("etcd-key-file", "", "the client key file to access the etcd cluster with tls")
+	etcdCACertFile = flagSet.String("etcd-ca-cert-file", "", "the ca cert file to verify the etcd cluster with tls")
+
+	embedEtcd               = flagSet.Bool("embed-etcd", false, "run the embedded etcd as the metadata store instead of the external etcd")
+	embedEtcdName           = flagSet.String("embed-etcd-name", "", "the member name of the embedded etcd, default to the broadcast ip")
+	embedEtcdClientURLs     = flagSet.String("embed-etcd-client-urls", "", "the client urls of the embedded etcd, default to http://<broadcast ip>:2379")
+	embedEtcdPeerURLs       = flagSet.String("embed-etcd-peer-urls", "", "the peer urls of the embedded etcd, default to http://<broadcast ip>:2380")
+	embedEtcdInitialCluster = flagSet.String("embed-etcd-initial-cluster", "", "the initial members (name=peer_url) of the embedded etcd, default to this node only")
+	embedEtcdJoinExisting   = flagSet.Bool("embed-etcd-join-existing", false, "join the existing embedded etcd cluster as the new member")
 
 	logLevel        = flagSet.Int("log-level", 1, "log verbose level")
 	logDir          = flagSet.String("log-dir", "", "directory for log file")
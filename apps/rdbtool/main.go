@@ -0,0 +1,269 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	sdk "github.com/absolute8511/go-zanredisdb"
+	"github.com/absolute8511/redigo/redis"
+)
+
+var (
+	flagSet  = flag.NewFlagSet("rdbtool", flag.ExitOnError)
+	mode     = flagSet.String("mode", "", "export or import")
+	file     = flagSet.String("file", "dump.rdb", "the rdb file to export to or import from")
+	lookup   = flagSet.String("lookup", "", "lookup list, split by ','")
+	ns       = flagSet.String("ns", "", "namespace of the table")
+	table    = flagSet.String("table", "", "table name to export")
+	db       = flagSet.Int("db", 0, "the redis db for the exported table")
+	withTTL  = flagSet.Bool("with_ttl", false, "export the ttl of the keys (one more request for each key)")
+	dbTables = flagSet.String("db_tables", "", "the tables for the redis dbs while importing, such as 0:table1,1:table2")
+	qps      = flagSet.Int("qps", 1000, "qps")
+	pass     = flagSet.String("pass", "", "password of zankv")
+)
+
+var (
+	tm          time.Duration
+	exportTypes = []string{"kv", "hash", "list", "set", "zset"}
+	ttlCmds     = map[string]string{"kv": "ttl", "hash": "httl", "list": "lttl", "set": "sttl", "zset": "zttl"}
+)
+
+func help() {
+	log.Println("Usage:")
+	log.Println("\t", os.Args[0], "-mode export -lookup lookuplist -ns namespace -table table_name [-db 0] [-with_ttl] [-file dump.rdb] [-qps 1000]")
+	log.Println("\t", os.Args[0], "-mode import -lookup lookuplist -ns namespace -db_tables 0:table1,1:table2 [-file dump.rdb] [-qps 1000]")
+	os.Exit(0)
+}
+
+func checkParameter() {
+	if len(*lookup) <= 0 {
+		log.Println("Error:must specify the lookup list")
+		help()
+	}
+	if len(*ns) <= 0 {
+		log.Println("Error:must specify the namespace")
+		help()
+	}
+	switch *mode {
+	case "export":
+		if len(*table) <= 0 {
+			log.Println("Error:must specify the table name")
+			help()
+		}
+	case "import":
+		if len(*dbTables) <= 0 {
+			log.Println("Error:must specify the tables for the redis dbs")
+			help()
+		}
+	default:
+		log.Println("Error:unsupport mode")
+		help()
+	}
+}
+
+func newClient() *sdk.ZanRedisClient {
+	conf := &sdk.Conf{
+		LookupList:   strings.Split(*lookup, ","),
+		DialTimeout:  10 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		TendInterval: 100,
+		Namespace:    *ns,
+		Password:     *pass,
+	}
+	client := sdk.NewZanRedisClient(conf)
+	client.Start()
+	return client
+}
+
+func throttle(total int64) {
+	if total%100 == 0 {
+		time.Sleep(tm * 100)
+	}
+	if total%10000 == 0 {
+		log.Printf("current processed %v\n", total)
+	}
+}
+
+// convert the full scan item (key with the values) to the rdb entry
+func buildEntry(t string, item []interface{}) (*common.RDBEntry, error) {
+	e := &common.RDBEntry{DB: *db, Key: item[0].([]byte)}
+	switch t {
+	case "kv":
+		e.Type = common.KV
+		e.Value = item[1].([]byte)
+	case "hash":
+		e.Type = common.HASH
+		for _, v := range item[1:] {
+			fv := v.([]interface{})
+			e.Fields = append(e.Fields, common.KVRecord{Key: fv[0].([]byte), Value: fv[1].([]byte)})
+		}
+	case "list", "set":
+		e.Type = common.LIST
+		if t == "set" {
+			e.Type = common.SET
+		}
+		for _, v := range item[1:] {
+			e.Values = append(e.Values, v.([]byte))
+		}
+	case "zset":
+		e.Type = common.ZSET
+		for _, v := range item[1:] {
+			ms := v.([]interface{})
+			score, err := strconv.ParseFloat(string(ms[1].([]byte)), 64)
+			if err != nil {
+				return nil, err
+			}
+			e.Members = append(e.Members, common.ScorePair{Score: score, Member: ms[0].([]byte)})
+		}
+	}
+	return e, nil
+}
+
+func exportType(t string, client *sdk.ZanRedisClient, w *common.RDBWriter, total *int64) error {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	ch := client.DoFullScanChannel(t, *table, stopCh)
+	for c := range ch {
+		v := c.([]interface{})
+		for i := 0; i < len(v); i++ {
+			e, err := buildEntry(t, v[i].([]interface{}))
+			if err != nil {
+				return err
+			}
+			if *withTTL {
+				pk := sdk.NewPKey(*ns, *table, e.Key)
+				ttl, err := redis.Int64(client.DoRedis(ttlCmds[t], pk.ShardingKey(), true, pk.RawKey))
+				if err != nil {
+					return fmt.Errorf("get ttl of key %s failed: %v", e.Key, err)
+				}
+				if ttl == 0 || ttl == -2 {
+					// expired or deleted while exporting
+					continue
+				}
+				if ttl > 0 {
+					e.ExpireAt = time.Now().Add(time.Duration(ttl)*time.Second).UnixNano() / int64(time.Millisecond)
+				}
+			}
+			if err := w.WriteEntry(e); err != nil {
+				return err
+			}
+			*total++
+			throttle(*total)
+		}
+	}
+	return nil
+}
+
+func export() error {
+	f, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := common.NewRDBWriter(f)
+	if err != nil {
+		return err
+	}
+	client := newClient()
+	defer client.Stop()
+
+	start := time.Now()
+	var total int64
+	for _, t := range exportTypes {
+		if err := exportType(t, client, w, &total); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	log.Printf("export finished. [total=%d, cost=%v]\n", total, time.Since(start))
+	return nil
+}
+
+func importRDB() error {
+	mapping, err := common.ParseRDBTableMapping(*dbTables)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := common.NewRDBReader(f)
+	if err != nil {
+		return err
+	}
+	client := newClient()
+	defer client.Stop()
+
+	start := time.Now()
+	var total, skipped, expired int64
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		tb, ok := mapping[e.DB]
+		if !ok {
+			skipped++
+			continue
+		}
+		ttl := e.GetRemainingTTL(time.Now())
+		if ttl < 0 {
+			expired++
+			continue
+		}
+		pk := sdk.NewPKey(*ns, tb, e.Key)
+		cmds, err := common.BuildRDBEntryCommands(pk.RawKey, e, ttl, 100)
+		if err != nil {
+			return fmt.Errorf("import key %s failed: %v", e.Key, err)
+		}
+		for _, args := range cmds {
+			cmdArgs := make([]interface{}, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				cmdArgs = append(cmdArgs, arg)
+			}
+			if _, err := client.DoRedis(string(args[0]), pk.ShardingKey(), true, cmdArgs...); err != nil {
+				return fmt.Errorf("import key %s failed: %v", e.Key, err)
+			}
+		}
+		total++
+		throttle(total)
+	}
+	log.Printf("import finished. [total=%d, skipped=%d, expired=%d, cost=%v]\n", total, skipped, expired, time.Since(start))
+	return nil
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+
+	checkParameter()
+
+	tm = time.Duration(1000000 / *qps) * time.Microsecond
+
+	var err error
+	if *mode == "export" {
+		err = export()
+	} else {
+		err = importRDB()
+	}
+	if err != nil {
+		log.Fatalf("%v failed: %v", *mode, err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	sdk "github.com/absolute8511/go-zanredisdb"
+)
+
+var (
+	flagSet      = flag.NewFlagSet("redismigrate", flag.ExitOnError)
+	mode         = flagSet.String("mode", "sync", "sync (full resync and tail as the redis replica) or scan (scan and tail the keyspace notifications)")
+	source       = flagSet.String("source", "", "address of the source redis, such as 127.0.0.1:6379")
+	sourcePass   = flagSet.String("source_pass", "", "password of the source redis")
+	listenPort   = flagSet.Int("listen_port", 0, "the port reported to the source redis as the replica")
+	rdbFile      = flagSet.String("rdb_file", "migrate.rdb", "the local file to save the full resync rdb from the source")
+	notifyConfig = flagSet.Bool("notify_config", false, "enable the keyspace notifications on the source redis in scan mode")
+	lookup       = flagSet.String("lookup", "", "lookup list, split by ','")
+	ns           = flagSet.String("ns", "", "namespace of the tables")
+	pass         = flagSet.String("pass", "", "password of zankv")
+	dbTables     = flagSet.String("db_tables", "", "the tables for the redis dbs, such as 0:table1,1:table2")
+	concurrency  = flagSet.Int("concurrency", 16, "the number of the concurrent keys to write")
+	qps          = flagSet.Int("qps", 10000, "the max write commands per second to zankv")
+	syncInterval = flagSet.Duration("sync_interval", 100*time.Millisecond, "the interval to copy the changed keys while tailing the source")
+	exitIdle     = flagSet.Duration("exit_idle", 0, "exit after catching up if no write on the source for the duration, 0 means keep tailing")
+)
+
+type migrateStats struct {
+	loaded      int64
+	skipped     int64
+	expired     int64
+	synced      int64
+	deleted     int64
+	failed      int64
+	unsupported int64
+	offset      int64
+	// the unix nano time of the last write on the source
+	lastWrite int64
+}
+
+var stats migrateStats
+
+func help() {
+	log.Println("Usage:")
+	log.Println("\t", os.Args[0], "-mode sync -source 127.0.0.1:6379 -lookup lookuplist -ns namespace -db_tables 0:table1,1:table2 [-rdb_file migrate.rdb] [-exit_idle 30s]")
+	log.Println("\t", os.Args[0], "-mode scan -source 127.0.0.1:6379 -lookup lookuplist -ns namespace -db_tables 0:table1,1:table2 [-notify_config] [-exit_idle 30s]")
+	os.Exit(0)
+}
+
+func checkParameter() {
+	if len(*source) <= 0 {
+		log.Println("Error:must specify the source redis")
+		help()
+	}
+	if len(*lookup) <= 0 {
+		log.Println("Error:must specify the lookup list")
+		help()
+	}
+	if len(*ns) <= 0 {
+		log.Println("Error:must specify the namespace")
+		help()
+	}
+	if len(*dbTables) <= 0 {
+		log.Println("Error:must specify the tables for the redis dbs")
+		help()
+	}
+	if *mode != "sync" && *mode != "scan" {
+		log.Println("Error:unsupport mode")
+		help()
+	}
+	if *concurrency <= 0 || *qps <= 0 {
+		log.Println("Error:concurrency and qps should be positive")
+		help()
+	}
+}
+
+type dirtyKey struct {
+	db  int
+	key string
+}
+
+// the keys changed on the source after the full copy started, the latest data of
+// these keys will be copied again while tailing.
+type dirtySet struct {
+	sync.Mutex
+	tables map[int]string
+	keys   map[dirtyKey]struct{}
+}
+
+func newDirtySet(tables map[int]string) *dirtySet {
+	return &dirtySet{
+		tables: tables,
+		keys:   make(map[dirtyKey]struct{}),
+	}
+}
+
+func (ds *dirtySet) add(db int, key []byte) {
+	if _, ok := ds.tables[db]; !ok {
+		return
+	}
+	ds.Lock()
+	ds.keys[dirtyKey{db: db, key: string(key)}] = struct{}{}
+	ds.Unlock()
+}
+
+func (ds *dirtySet) swap() map[dirtyKey]struct{} {
+	ds.Lock()
+	keys := ds.keys
+	ds.keys = make(map[dirtyKey]struct{})
+	ds.Unlock()
+	return keys
+}
+
+func (ds *dirtySet) len() int {
+	ds.Lock()
+	defer ds.Unlock()
+	return len(ds.keys)
+}
+
+func touchSource() {
+	atomic.StoreInt64(&stats.lastWrite, time.Now().UnixNano())
+}
+
+// run the jobs concurrently and wait all of them done
+func runJobs(jobs <-chan func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// copy the latest data of the changed keys from the source until the source
+// has no write for a while (if exit_idle is set) or the tailing failed.
+func catchUp(src *redisSource, tgt *zankvTarget, ds *dirtySet, errCh <-chan error) error {
+	log.Printf("full copy done, start catching up. [loaded=%d, skipped=%d, expired=%d, failed=%d]\n",
+		atomic.LoadInt64(&stats.loaded), atomic.LoadInt64(&stats.skipped),
+		atomic.LoadInt64(&stats.expired), atomic.LoadInt64(&stats.failed))
+	ticker := time.NewTicker(*syncInterval)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ticker.C:
+		}
+		keys := ds.swap()
+		if len(keys) > 0 {
+			jobs := make(chan func(), *concurrency)
+			go func() {
+				for k := range keys {
+					k := k
+					jobs <- func() { syncKey(src, tgt, ds, k) }
+				}
+				close(jobs)
+			}()
+			runJobs(jobs)
+		}
+		pending := ds.len()
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&stats.lastWrite)))
+		if time.Since(lastReport) > 10*time.Second {
+			lastReport = time.Now()
+			log.Printf("catching up. [synced=%d, deleted=%d, pending=%d, failed=%d, unsupported=%d, offset=%d, idle=%v]\n",
+				atomic.LoadInt64(&stats.synced), atomic.LoadInt64(&stats.deleted), pending,
+				atomic.LoadInt64(&stats.failed), atomic.LoadInt64(&stats.unsupported),
+				atomic.LoadInt64(&stats.offset), idle)
+		}
+		if *exitIdle > 0 && pending == 0 && idle >= *exitIdle {
+			log.Printf("caught up with the source, ready to cutover. [synced=%d, deleted=%d, failed=%d, unsupported=%d, offset=%d]\n",
+				atomic.LoadInt64(&stats.synced), atomic.LoadInt64(&stats.deleted),
+				atomic.LoadInt64(&stats.failed), atomic.LoadInt64(&stats.unsupported),
+				atomic.LoadInt64(&stats.offset))
+			return nil
+		}
+	}
+}
+
+// copy the latest data of the key from the source, the key will be retried later if failed
+func syncKey(src *redisSource, tgt *zankvTarget, ds *dirtySet, k dirtyKey) {
+	e, err := src.dump(k.db, []byte(k.key))
+	if err == nil {
+		err = tgt.replace(k.db, []byte(k.key), e)
+	}
+	if err != nil {
+		if err == errUnsupportedValue {
+			atomic.AddInt64(&stats.unsupported, 1)
+			return
+		}
+		log.Printf("sync key %v in db %v failed: %v\n", k.key, k.db, err)
+		atomic.AddInt64(&stats.failed, 1)
+		ds.add(k.db, []byte(k.key))
+		return
+	}
+	if e == nil {
+		atomic.AddInt64(&stats.deleted, 1)
+	} else {
+		atomic.AddInt64(&stats.synced, 1)
+	}
+}
+
+func newClient() *sdk.ZanRedisClient {
+	conf := &sdk.Conf{
+		LookupList:   strings.Split(*lookup, ","),
+		DialTimeout:  10 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		TendInterval: 100,
+		Namespace:    *ns,
+		Password:     *pass,
+	}
+	client := sdk.NewZanRedisClient(conf)
+	client.Start()
+	return client
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+
+	checkParameter()
+
+	tables, err := common.ParseRDBTableMapping(*dbTables)
+	if err != nil {
+		log.Fatalf("invalid db tables: %v", err)
+	}
+	client := newClient()
+	defer client.Stop()
+	src := newRedisSource(*source, *sourcePass)
+	defer src.close()
+	tgt := newZankvTarget(client, *ns, tables, *qps)
+	ds := newDirtySet(tables)
+	touchSource()
+
+	start := time.Now()
+	if *mode == "sync" {
+		err = migrateBySync(src, tgt, ds)
+	} else {
+		err = migrateByScan(src, tgt, ds)
+	}
+	if err != nil {
+		log.Fatalf("migrate failed: %v", err)
+	}
+	log.Printf("migrate finished. [cost=%v]\n", time.Since(start))
+}
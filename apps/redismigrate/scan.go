@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/absolute8511/redigo/redis"
+)
+
+const keyspacePrefix = "__keyspace@"
+
+// parse the db and the key from the keyspace notification channel, such as __keyspace@0__:key
+func parseKeyspaceChannel(channel string) (int, []byte, bool) {
+	if !strings.HasPrefix(channel, keyspacePrefix) {
+		return 0, nil, false
+	}
+	s := channel[len(keyspacePrefix):]
+	pos := strings.Index(s, "__:")
+	if pos <= 0 {
+		return 0, nil, false
+	}
+	db, err := strconv.Atoi(s[:pos])
+	if err != nil {
+		return 0, nil, false
+	}
+	return db, []byte(s[pos+3:]), true
+}
+
+// tail the keyspace notifications of the source and mark the changed keys as dirty
+func tailNotifications(src *redisSource, ds *dirtySet, subscribed chan<- struct{}) error {
+	conn, err := src.dial(0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.PSubscribe(keyspacePrefix + "*__:*"); err != nil {
+		return err
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.PMessage:
+			if db, key, ok := parseKeyspaceChannel(v.Channel); ok {
+				ds.add(db, key)
+				touchSource()
+			}
+		case redis.Subscription:
+			if v.Kind == "psubscribe" && subscribed != nil {
+				close(subscribed)
+				subscribed = nil
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+func scanDB(src *redisSource, tgt *zankvTarget, ds *dirtySet, db int) error {
+	conn, err := src.dial(db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	jobs := make(chan func(), *concurrency)
+	done := make(chan struct{})
+	go func() {
+		runJobs(jobs)
+		close(done)
+	}()
+	defer func() {
+		close(jobs)
+		<-done
+	}()
+	cursor := "0"
+	for {
+		rsp, err := redis.Values(conn.Do("SCAN", cursor, "COUNT", 1000))
+		if err != nil {
+			return err
+		}
+		if len(rsp) != 2 {
+			return fmt.Errorf("unexpected scan response: %v", rsp)
+		}
+		cursor, err = redis.String(rsp[0], nil)
+		if err != nil {
+			return err
+		}
+		keys, err := redis.ByteSlices(rsp[1], nil)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			key := key
+			jobs <- func() {
+				e, err := src.dump(db, key)
+				if err == nil && e != nil {
+					err = tgt.load(e)
+				}
+				if err == errUnsupportedValue {
+					atomic.AddInt64(&stats.unsupported, 1)
+				} else if err != nil {
+					log.Printf("load key %s in db %v failed: %v\n", key, db, err)
+					atomic.AddInt64(&stats.failed, 1)
+					ds.add(db, key)
+				}
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// migrate by scanning the keys of the source, the keys changed while scanning
+// are received from the keyspace notifications and copied again after that.
+func migrateByScan(src *redisSource, tgt *zankvTarget, ds *dirtySet) error {
+	if *notifyConfig {
+		conn := src.getConn(0)
+		_, err := conn.Do("CONFIG", "SET", "notify-keyspace-events", "KA")
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("enable the keyspace notifications failed: %v", err)
+		}
+	}
+	errCh := make(chan error, 1)
+	subscribed := make(chan struct{})
+	go func() {
+		errCh <- fmt.Errorf("tail the source failed: %v", tailNotifications(src, ds, subscribed))
+	}()
+	// subscribe before scanning to make sure no change is missed
+	select {
+	case <-subscribed:
+	case err := <-errCh:
+		return err
+	}
+	dbs := make([]int, 0, len(tgt.tables))
+	for db := range tgt.tables {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	for _, db := range dbs {
+		log.Printf("start scanning the db %v\n", db)
+		if err := scanDB(src, tgt, ds, db); err != nil {
+			return err
+		}
+	}
+	return catchUp(src, tgt, ds, errCh)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redigo/redis"
+)
+
+var errUnsupportedValue = errors.New("unsupported value type")
+
+// the key positions of the command, the same as the COMMAND INFO of redis
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+// read the keys from the source redis
+type redisSource struct {
+	addr  string
+	pass  string
+	mu    sync.Mutex
+	pools map[int]*redis.Pool
+	specs map[string]keySpec
+}
+
+func newRedisSource(addr string, pass string) *redisSource {
+	return &redisSource{
+		addr:  addr,
+		pass:  pass,
+		pools: make(map[int]*redis.Pool),
+		specs: make(map[string]keySpec),
+	}
+}
+
+func (s *redisSource) dial(db int) (redis.Conn, error) {
+	return redis.Dial("tcp", s.addr,
+		redis.DialConnectTimeout(10*time.Second),
+		redis.DialReadTimeout(30*time.Second),
+		redis.DialWriteTimeout(30*time.Second),
+		redis.DialPassword(s.pass),
+		redis.DialDatabase(db))
+}
+
+func (s *redisSource) getConn(db int) redis.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pools[db]
+	if !ok {
+		p = &redis.Pool{
+			MaxIdle:     *concurrency,
+			IdleTimeout: time.Minute,
+			Dial: func() (redis.Conn, error) {
+				return s.dial(db)
+			},
+		}
+		s.pools[db] = p
+	}
+	return p.Get()
+}
+
+func (s *redisSource) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.pools {
+		p.Close()
+	}
+}
+
+// dump the key with the ttl in the same transaction, nil will be returned if
+// the key is not exist.
+func (s *redisSource) dump(db int, key []byte) (*common.RDBEntry, error) {
+	conn := s.getConn(db)
+	defer conn.Close()
+	conn.Send("MULTI")
+	conn.Send("DUMP", key)
+	conn.Send("PTTL", key)
+	rsp, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp) != 2 {
+		return nil, errors.New("unexpected dump response")
+	}
+	if rsp[0] == nil {
+		return nil, nil
+	}
+	payload, err := redis.Bytes(rsp[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	pttl, err := redis.Int64(rsp[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	e, err := common.ParseRDBDump(key, payload)
+	if err != nil {
+		if err == common.ErrRDBChecksumInvalid {
+			return nil, err
+		}
+		// such as the stream or the module types which can not be stored in zankv
+		return nil, errUnsupportedValue
+	}
+	e.DB = db
+	if pttl > 0 {
+		e.ExpireAt = time.Now().UnixNano()/int64(time.Millisecond) + pttl
+	}
+	return e, nil
+}
+
+// get the key positions of the write command from the source
+func (s *redisSource) getKeySpec(cmd string) (keySpec, error) {
+	s.mu.Lock()
+	spec, ok := s.specs[cmd]
+	s.mu.Unlock()
+	if ok {
+		return spec, nil
+	}
+	conn := s.getConn(0)
+	defer conn.Close()
+	rsp, err := redis.Values(conn.Do("COMMAND", "INFO", cmd))
+	if err != nil {
+		return spec, err
+	}
+	if len(rsp) == 1 && rsp[0] != nil {
+		info, err := redis.Values(rsp[0], nil)
+		if err != nil {
+			return spec, err
+		}
+		if len(info) >= 6 {
+			first, _ := redis.Int(info[3], nil)
+			last, _ := redis.Int(info[4], nil)
+			step, _ := redis.Int(info[5], nil)
+			spec = keySpec{first: first, last: last, step: step}
+		}
+	}
+	s.mu.Lock()
+	s.specs[cmd] = spec
+	s.mu.Unlock()
+	return spec, nil
+}
+
+// get the keys changed by the write command
+func (s *redisSource) commandKeys(args [][]byte) ([][]byte, error) {
+	cmd := strings.ToLower(string(args[0]))
+	switch cmd {
+	case "eval", "evalsha":
+		// the script replicated verbatim by the old redis
+		if len(args) < 3 {
+			return nil, nil
+		}
+		n, err := redis.Int(args[2], nil)
+		if err != nil || n < 0 || 3+n > len(args) {
+			return nil, nil
+		}
+		return args[3 : 3+n], nil
+	}
+	spec, err := s.getKeySpec(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if spec.first <= 0 || spec.step <= 0 {
+		return nil, nil
+	}
+	last := spec.last
+	if last < 0 {
+		last = len(args) + last
+	}
+	var keys [][]byte
+	for i := spec.first; i <= last && i < len(args); i += spec.step {
+		keys = append(keys, args[i])
+	}
+	return keys, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const rdbEOFMarkLen = 40
+
+func writeCommand(w io.Writer, args ...string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readStatus(br *bufio.Reader) (string, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(line, "-") {
+		return "", errors.New(line[1:])
+	}
+	return line, nil
+}
+
+// read the next command in the replication stream, return the command with
+// the bytes read.
+func readCommand(br *bufio.Reader) ([][]byte, int64, error) {
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, 0, err
+	}
+	n := int64(len(line))
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, n, nil
+	}
+	if line[0] != '*' {
+		// the inline command
+		return bytes.Fields(line), n, nil
+	}
+	argc, err := strconv.Atoi(string(line[1:]))
+	if err != nil {
+		return nil, n, fmt.Errorf("invalid command: %q", line)
+	}
+	args := make([][]byte, 0, argc)
+	for i := 0; i < argc; i++ {
+		line, err = br.ReadBytes('\n')
+		if err != nil {
+			return nil, n, err
+		}
+		n += int64(len(line))
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 || line[0] != '$' {
+			return nil, n, fmt.Errorf("invalid command argument: %q", line)
+		}
+		l, err := strconv.Atoi(string(line[1:]))
+		if err != nil || l < 0 {
+			return nil, n, fmt.Errorf("invalid command argument: %q", line)
+		}
+		arg := make([]byte, l+2)
+		if _, err := io.ReadFull(br, arg); err != nil {
+			return nil, n, err
+		}
+		n += int64(len(arg))
+		args = append(args, arg[:l])
+	}
+	return args, n, nil
+}
+
+// copy the diskless rdb which is ended with the mark, the data after the mark
+// will be returned within the reader.
+func copyUntilMark(w io.Writer, r io.Reader, mark []byte) (io.Reader, error) {
+	var pending []byte
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(chunk)
+		pending = append(pending, chunk[:n]...)
+		if idx := bytes.Index(pending, mark); idx >= 0 {
+			if _, err := w.Write(pending[:idx]); err != nil {
+				return nil, err
+			}
+			return io.MultiReader(bytes.NewReader(pending[idx+len(mark):]), r), nil
+		}
+		if keep := len(pending) - len(mark) + 1; keep > 0 {
+			if _, err := w.Write(pending[:keep]); err != nil {
+				return nil, err
+			}
+			pending = append(pending[:0], pending[keep:]...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// handshake with the source as the replica and save the rdb of the full resync to
+// the local file, return the replication offset and the reader of the command stream.
+func fullResync(conn net.Conn, f *os.File) (int64, *bufio.Reader, error) {
+	br := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if *sourcePass != "" {
+		writeCommand(conn, "AUTH", *sourcePass)
+		if _, err := readStatus(br); err != nil {
+			return 0, nil, fmt.Errorf("auth failed: %v", err)
+		}
+	}
+	writeCommand(conn, "REPLCONF", "listening-port", strconv.Itoa(*listenPort))
+	if _, err := readStatus(br); err != nil {
+		return 0, nil, fmt.Errorf("replconf failed: %v", err)
+	}
+	// capa is not supported by the old redis, just ignore the error
+	writeCommand(conn, "REPLCONF", "capa", "eof", "capa", "psync2")
+	readLine(br)
+
+	var offset int64
+	writeCommand(conn, "PSYNC", "?", "-1")
+	line, err := readStatus(br)
+	if err != nil {
+		log.Printf("psync failed: %v, try sync\n", err)
+		writeCommand(conn, "SYNC")
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "+FULLRESYNC" {
+			return 0, nil, fmt.Errorf("unexpected psync response: %v", line)
+		}
+		offset, err = strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unexpected psync response: %v", line)
+		}
+	}
+	// the source may send the newlines as the keepalive while generating the rdb
+	conn.SetDeadline(time.Time{})
+	for {
+		line, err = readLine(br)
+		if err != nil {
+			return 0, nil, err
+		}
+		if line != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "$") {
+		return 0, nil, fmt.Errorf("unexpected rdb response: %v", line)
+	}
+	log.Printf("start receiving the rdb from the source. [offset=%d, size=%v]\n", offset, line[1:])
+	if strings.HasPrefix(line, "$EOF:") {
+		mark := []byte(line[len("$EOF:"):])
+		if len(mark) != rdbEOFMarkLen {
+			return 0, nil, fmt.Errorf("unexpected rdb response: %v", line)
+		}
+		rest, err := copyUntilMark(f, br, mark)
+		if err != nil {
+			return 0, nil, err
+		}
+		return offset, bufio.NewReader(rest), nil
+	}
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected rdb response: %v", line)
+	}
+	if _, err := io.CopyN(f, br, size); err != nil {
+		return 0, nil, err
+	}
+	return offset, br, nil
+}
+
+// tail the command stream of the source and mark the changed keys as dirty
+func tailReplication(src *redisSource, ds *dirtySet, br *bufio.Reader) error {
+	db := 0
+	for {
+		args, n, err := readCommand(br)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			atomic.AddInt64(&stats.offset, n)
+			continue
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "select":
+			if len(args) > 1 {
+				db, err = strconv.Atoi(string(args[1]))
+				if err != nil {
+					return fmt.Errorf("invalid select: %q", args)
+				}
+			}
+		case "ping", "replconf", "multi", "exec", "publish":
+		case "flushdb", "flushall", "swapdb":
+			log.Printf("the command %q can not be migrated, the keys may be inconsistent\n", args)
+			atomic.AddInt64(&stats.unsupported, 1)
+			touchSource()
+		case "move":
+			// the key is moved to the other db
+			if len(args) > 2 {
+				ds.add(db, args[1])
+				if dst, err := strconv.Atoi(string(args[2])); err == nil {
+					ds.add(dst, args[1])
+				}
+			}
+			touchSource()
+		default:
+			keys, err := src.commandKeys(args)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				ds.add(db, key)
+			}
+			touchSource()
+		}
+		atomic.AddInt64(&stats.offset, n)
+	}
+}
+
+func loadRDBFile(tgt *zankvTarget, ds *dirtySet, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := common.NewRDBReader(f)
+	if err != nil {
+		return err
+	}
+	jobs := make(chan func(), *concurrency)
+	done := make(chan struct{})
+	go func() {
+		runJobs(jobs)
+		close(done)
+	}()
+	defer func() {
+		close(jobs)
+		<-done
+	}()
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		jobs <- func() {
+			if err := tgt.load(e); err != nil {
+				log.Printf("load key %s in db %v failed: %v\n", e.Key, e.DB, err)
+				atomic.AddInt64(&stats.failed, 1)
+				ds.add(e.DB, e.Key)
+			}
+		}
+	}
+}
+
+// migrate as the replica of the source, the rdb of the full resync is loaded first and
+// the keys changed by the command stream are copied again after that.
+func migrateBySync(src *redisSource, tgt *zankvTarget, ds *dirtySet) error {
+	conn, err := net.DialTimeout("tcp", *source, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	f, err := os.Create(*rdbFile)
+	if err != nil {
+		return err
+	}
+	offset, br, err := fullResync(conn, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&stats.offset, offset)
+	log.Printf("the rdb is received from the source, start loading\n")
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- fmt.Errorf("tail the source failed: %v", tailReplication(src, ds, br))
+	}()
+	go func() {
+		// the source will disconnect the replica without the ack
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := writeCommand(conn, "REPLCONF", "ACK", strconv.FormatInt(atomic.LoadInt64(&stats.offset), 10))
+			if err != nil {
+				errCh <- fmt.Errorf("ack the source failed: %v", err)
+				return
+			}
+		}
+	}()
+	if err := loadRDBFile(tgt, ds, *rdbFile); err != nil {
+		return err
+	}
+	return catchUp(src, tgt, ds, errCh)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	sdk "github.com/absolute8511/go-zanredisdb"
+	"golang.org/x/time/rate"
+)
+
+const writeBatch = 100
+
+var (
+	clearCmds   = []string{"del", "hclear", "lclear", "sclear", "zclear"}
+	persistCmds = map[common.DataType]string{
+		common.KV:   "persist",
+		common.HASH: "hpersist",
+		common.LIST: "lpersist",
+		common.SET:  "spersist",
+		common.ZSET: "zpersist",
+	}
+)
+
+// write the keys from the redis db to the mapped table through the raft path
+type zankvTarget struct {
+	client  *sdk.ZanRedisClient
+	ns      string
+	tables  map[int]string
+	limiter *rate.Limiter
+}
+
+func newZankvTarget(client *sdk.ZanRedisClient, ns string, tables map[int]string, qps int) *zankvTarget {
+	return &zankvTarget{
+		client:  client,
+		ns:      ns,
+		tables:  tables,
+		limiter: rate.NewLimiter(rate.Limit(qps), qps),
+	}
+}
+
+func (t *zankvTarget) doCommands(pk *sdk.PKey, cmds [][][]byte) error {
+	for _, args := range cmds {
+		t.limiter.Wait(context.Background())
+		cmdArgs := make([]interface{}, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			cmdArgs = append(cmdArgs, arg)
+		}
+		if _, err := t.client.DoRedis(string(args[0]), pk.ShardingKey(), true, cmdArgs...); err != nil {
+			return fmt.Errorf("%s failed: %v", args[0], err)
+		}
+	}
+	return nil
+}
+
+// load write the key from the full copy, the keys without the table mapping or
+// expired will be skipped.
+func (t *zankvTarget) load(e *common.RDBEntry) error {
+	tb, ok := t.tables[e.DB]
+	if !ok {
+		atomic.AddInt64(&stats.skipped, 1)
+		return nil
+	}
+	ttl := e.GetRemainingTTL(time.Now())
+	if ttl < 0 {
+		atomic.AddInt64(&stats.expired, 1)
+		return nil
+	}
+	pk := sdk.NewPKey(t.ns, tb, e.Key)
+	cmds, err := common.BuildRDBEntryCommands(pk.RawKey, e, ttl, writeBatch)
+	if err != nil {
+		return err
+	}
+	if err := t.doCommands(pk, cmds); err != nil {
+		return err
+	}
+	atomic.AddInt64(&stats.loaded, 1)
+	return nil
+}
+
+// replace the key with the latest data on the source, nil entry means the
+// key is deleted (or expired) on the source.
+func (t *zankvTarget) replace(db int, key []byte, e *common.RDBEntry) error {
+	tb, ok := t.tables[db]
+	if !ok {
+		return nil
+	}
+	pk := sdk.NewPKey(t.ns, tb, key)
+	var ttl int64
+	if e != nil {
+		ttl = e.GetRemainingTTL(time.Now())
+	}
+	if e == nil || ttl < 0 {
+		// the type of the deleted key is unknown, so clear all the types
+		cmds := make([][][]byte, 0, len(clearCmds))
+		for _, cmd := range clearCmds {
+			cmds = append(cmds, [][]byte{[]byte(cmd), pk.RawKey})
+		}
+		return t.doCommands(pk, cmds)
+	}
+	cmds, err := common.BuildRDBEntryCommands(pk.RawKey, e, ttl, writeBatch)
+	if err != nil {
+		return err
+	}
+	if ttl == 0 {
+		// the ttl may be removed on the source after copied
+		cmds = append(cmds, [][]byte{[]byte(persistCmds[e.Type]), pk.RawKey})
+	}
+	return t.doCommands(pk, cmds)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var (
+	flagSet   = flag.NewFlagSet("syncverify", flag.ExitOnError)
+	srcPD     = flagSet.String("src_pd", "", "placedriver http address of the source cluster")
+	dstPD     = flagSet.String("dst_pd", "", "placedriver http address of the destination cluster")
+	ns        = flagSet.String("ns", "", "namespace to verify")
+	dstNS     = flagSet.String("dst_ns", "", "namespace in destination cluster, same as source if empty")
+	tables    = flagSet.String("tables", "", "tables to verify, split by ','")
+	bucketNum = flagSet.Int("buckets", 256, "the number of checksum buckets for each partition")
+	maxDiff   = flagSet.Int("max_diff", 1000, "stop reporting the different keys after reached")
+)
+
+const apiTimeout = time.Minute * 10
+
+type nodeInfo struct {
+	BroadcastAddress string `json:"broadcast_address"`
+	HTTPPort         string `json:"http_port"`
+}
+
+type partitionNodeInfo struct {
+	Leader nodeInfo `json:"leader"`
+}
+
+type nsQueryInfo struct {
+	PartitionNum int                       `json:"partition_num"`
+	Partitions   map[int]partitionNodeInfo `json:"partitions"`
+}
+
+func help() {
+	fmt.Println("Usage:")
+	fmt.Println("\t", os.Args[0], "-src_pd pd_address -dst_pd pd_address -ns namespace [-dst_ns namespace] -tables table1,table2 [-buckets 256]")
+	os.Exit(0)
+}
+
+func checkParameter() {
+	if *srcPD == "" || *dstPD == "" {
+		fmt.Println("Error:must specify the placedriver address of both clusters")
+		help()
+	}
+	if *ns == "" {
+		fmt.Println("Error:must specify the namespace")
+		help()
+	}
+	if *tables == "" {
+		fmt.Println("Error:must specify the tables")
+		help()
+	}
+	if *bucketNum <= 0 {
+		fmt.Println("Error:buckets should be positive")
+		help()
+	}
+	if *dstNS == "" {
+		*dstNS = *ns
+	}
+}
+
+func queryNamespace(pd string, namespace string) (*nsQueryInfo, error) {
+	var info nsQueryInfo
+	_, err := common.APIRequest("GET", "http://"+pd+"/query/"+namespace, nil, time.Second*10, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func getLeaderAddr(info *nsQueryInfo, pid int) (string, error) {
+	pn, ok := info.Partitions[pid]
+	if !ok || pn.Leader.BroadcastAddress == "" {
+		return "", fmt.Errorf("no leader for partition %v", pid)
+	}
+	return net.JoinHostPort(pn.Leader.BroadcastAddress, pn.Leader.HTTPPort), nil
+}
+
+func getChecksum(addr string, fullName string, table string) (*common.TableChecksum, error) {
+	var tc common.TableChecksum
+	uri := fmt.Sprintf("http://%s%s/%s/%s?buckets=%d", addr, common.APITableChecksum,
+		fullName, table, *bucketNum)
+	_, err := common.APIRequest("GET", uri, nil, apiTimeout, &tc)
+	if err != nil {
+		return nil, err
+	}
+	if len(tc.Buckets) != *bucketNum {
+		return nil, fmt.Errorf("checksum buckets mismatch from %v: %v", addr, len(tc.Buckets))
+	}
+	return &tc, nil
+}
+
+func getBucketKeys(addr string, fullName string, table string, bucket int) (map[string]uint64, error) {
+	keys := make(map[string]uint64)
+	uri := fmt.Sprintf("http://%s%s/%s/%s?buckets=%d&bucket=%d", addr, common.APITableChecksum,
+		fullName, table, *bucketNum, bucket)
+	_, err := common.APIRequest("GET", uri, nil, apiTimeout, &keys)
+	return keys, err
+}
+
+// verify the table in the partition and return the number of different keys
+func verifyPartition(src *nsQueryInfo, dst *nsQueryInfo, pid int, table string, reported int) (int, error) {
+	srcAddr, err := getLeaderAddr(src, pid)
+	if err != nil {
+		return 0, err
+	}
+	dstAddr, err := getLeaderAddr(dst, pid)
+	if err != nil {
+		return 0, err
+	}
+	srcName := common.GetNsDesp(*ns, pid)
+	dstName := common.GetNsDesp(*dstNS, pid)
+	srcSum, err := getChecksum(srcAddr, srcName, table)
+	if err != nil {
+		return 0, err
+	}
+	dstSum, err := getChecksum(dstAddr, dstName, table)
+	if err != nil {
+		return 0, err
+	}
+	if srcSum.RecordNum != dstSum.RecordNum {
+		fmt.Printf("partition %v table %v record number mismatch: %v, %v\n", pid, table,
+			srcSum.RecordNum, dstSum.RecordNum)
+	}
+	diff := 0
+	for i := range srcSum.Buckets {
+		if srcSum.Buckets[i] == dstSum.Buckets[i] {
+			continue
+		}
+		srcKeys, err := getBucketKeys(srcAddr, srcName, table, i)
+		if err != nil {
+			return diff, err
+		}
+		dstKeys, err := getBucketKeys(dstAddr, dstName, table, i)
+		if err != nil {
+			return diff, err
+		}
+		for k, sum := range srcKeys {
+			dsum, ok := dstKeys[k]
+			if ok && dsum == sum {
+				continue
+			}
+			diff++
+			if reported+diff <= *maxDiff {
+				if !ok {
+					fmt.Printf("partition %v table %v key %q missing in destination\n", pid, table, k)
+				} else {
+					fmt.Printf("partition %v table %v key %q data mismatch\n", pid, table, k)
+				}
+			}
+		}
+		for k := range dstKeys {
+			if _, ok := srcKeys[k]; ok {
+				continue
+			}
+			diff++
+			if reported+diff <= *maxDiff {
+				fmt.Printf("partition %v table %v key %q not exist in source\n", pid, table, k)
+			}
+		}
+	}
+	return diff, nil
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+	checkParameter()
+
+	src, err := queryNamespace(*srcPD, *ns)
+	if err != nil {
+		fmt.Printf("query source namespace %v failed: %v\n", *ns, err)
+		os.Exit(1)
+	}
+	dst, err := queryNamespace(*dstPD, *dstNS)
+	if err != nil {
+		fmt.Printf("query destination namespace %v failed: %v\n", *dstNS, err)
+		os.Exit(1)
+	}
+	if src.PartitionNum != dst.PartitionNum {
+		fmt.Printf("partition number mismatch: %v, %v\n", src.PartitionNum, dst.PartitionNum)
+		os.Exit(1)
+	}
+	start := time.Now()
+	totalDiff := 0
+	failed := false
+	for _, table := range strings.Split(*tables, ",") {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		tableDiff := 0
+		for pid := 0; pid < src.PartitionNum; pid++ {
+			diff, err := verifyPartition(src, dst, pid, table, totalDiff)
+			totalDiff += diff
+			tableDiff += diff
+			if err != nil {
+				fmt.Printf("verify partition %v table %v failed: %v\n", pid, table, err)
+				failed = true
+			}
+		}
+		fmt.Printf("table %v verified, different keys: %v, cost: %v\n", table,
+			tableDiff, time.Since(start))
+	}
+	if failed || totalDiff > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	sdk "github.com/absolute8511/go-zanredisdb"
+)
+
+var (
+	flagSet     = flag.NewFlagSet("tabledump", flag.ExitOnError)
+	mode        = flagSet.String("mode", "", "export or import")
+	file        = flagSet.String("file", "", "the dump file to export to or import from")
+	pd          = flagSet.String("pd", "", "the http address of the placedriver for export, such as 127.0.0.1:18001")
+	lookup      = flagSet.String("lookup", "", "lookup list for import, split by ','")
+	ns          = flagSet.String("ns", "", "namespace of the table")
+	table       = flagSet.String("table", "", "the table to export, or the table to import to (default the table in the dump)")
+	count       = flagSet.Int("count", 1000, "the keys exported in each request")
+	qps         = flagSet.Int("qps", 1000, "qps for import")
+	pass        = flagSet.String("pass", "", "password of zankv")
+	restart     = flagSet.Bool("restart", false, "ignore the progress and restart from the beginning")
+	retryNum    = flagSet.Int("retry", 10, "the retry number for the failed request")
+	httpTimeout = 5 * time.Minute
+)
+
+var tm time.Duration
+
+type nodeInfo struct {
+	BroadcastAddress string `json:"broadcast_address"`
+	HTTPPort         string `json:"http_port"`
+}
+
+type partitionNodeInfo struct {
+	Leader nodeInfo `json:"leader"`
+}
+
+type namespaceInfo struct {
+	PartitionNum int                          `json:"partition_num"`
+	Partitions   map[string]partitionNodeInfo `json:"partitions"`
+}
+
+// the import progress saved to resume
+type importProgress struct {
+	Offset   int64 `json:"offset"`
+	Imported int64 `json:"imported"`
+	Expired  int64 `json:"expired"`
+}
+
+func help() {
+	log.Println("Usage:")
+	log.Println("\t", os.Args[0], "-mode export -pd 127.0.0.1:18001 -ns namespace -table table_name -file table.dump [-count 1000] [-restart]")
+	log.Println("\t", os.Args[0], "-mode import -lookup lookuplist -ns namespace [-table table_name] -file table.dump [-qps 1000] [-restart]")
+	os.Exit(0)
+}
+
+func checkParameter() {
+	if len(*ns) <= 0 {
+		log.Println("Error:must specify the namespace")
+		help()
+	}
+	if len(*file) <= 0 {
+		log.Println("Error:must specify the dump file")
+		help()
+	}
+	switch *mode {
+	case "export":
+		if len(*pd) <= 0 {
+			log.Println("Error:must specify the placedriver address")
+			help()
+		}
+		if len(*table) <= 0 {
+			log.Println("Error:must specify the table name")
+			help()
+		}
+	case "import":
+		if len(*lookup) <= 0 {
+			log.Println("Error:must specify the lookup list")
+			help()
+		}
+	default:
+		log.Println("Error:unsupport mode")
+		help()
+	}
+}
+
+// the export cursor is the partition with the cursor in the partition
+func encodeCursor(pid int, cursor []byte) []byte {
+	return []byte(strconv.Itoa(pid) + ":" + hex.EncodeToString(cursor))
+}
+
+func decodeCursor(cp []byte) (int, []byte, error) {
+	s := string(cp)
+	pos := strings.Index(s, ":")
+	if pos <= 0 {
+		return 0, nil, fmt.Errorf("invalid checkpoint: %s", cp)
+	}
+	pid, err := strconv.Atoi(s[:pos])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint: %s", cp)
+	}
+	cursor, err := hex.DecodeString(s[pos+1:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint: %s", cp)
+	}
+	return pid, cursor, nil
+}
+
+func queryNamespace() (*namespaceInfo, error) {
+	var info namespaceInfo
+	_, err := common.APIRequest("GET", "http://"+*pd+"/query/"+*ns, nil, time.Second*10, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.PartitionNum <= 0 {
+		return nil, errors.New("namespace has no partition")
+	}
+	return &info, nil
+}
+
+// check the exist dump and return the checkpoint to resume from, the dump will be
+// truncated to the checkpoint.
+func prepareExportFile() (*os.File, int, []byte, int64, error) {
+	if !*restart {
+		if f, err := os.OpenFile(*file, os.O_RDWR, 0644); err == nil {
+			r, err := common.NewTableDumpReader(f)
+			if err != nil {
+				f.Close()
+				return nil, 0, nil, 0, fmt.Errorf("invalid exist dump: %v", err)
+			}
+			if r.Table() != *table {
+				f.Close()
+				return nil, 0, nil, 0, fmt.Errorf("the exist dump is for table %v", r.Table())
+			}
+			// the keys before the last checkpoint
+			var total, cpTotal int64
+			_, lastOffset := r.Checkpoint()
+			for err == nil {
+				_, err = r.Next()
+				if _, off := r.Checkpoint(); off != lastOffset {
+					lastOffset = off
+					cpTotal = total
+				}
+				if err == nil {
+					total++
+				}
+			}
+			if err == io.EOF {
+				f.Close()
+				return nil, 0, nil, total, io.EOF
+			}
+			cp, offset := r.Checkpoint()
+			pid := 0
+			var cursor []byte
+			if cp != nil {
+				pid, cursor, err = decodeCursor(cp)
+				if err != nil {
+					f.Close()
+					return nil, 0, nil, 0, err
+				}
+			}
+			if err := f.Truncate(offset); err != nil {
+				f.Close()
+				return nil, 0, nil, 0, err
+			}
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				f.Close()
+				return nil, 0, nil, 0, err
+			}
+			log.Printf("resume the export from partition %v with %v keys exported\n", pid, cpTotal)
+			return f, pid, cursor, cpTotal, nil
+		} else if !os.IsNotExist(err) {
+			return nil, 0, nil, 0, err
+		}
+	}
+	f, err := os.Create(*file)
+	return f, 0, nil, 0, err
+}
+
+// export one page of the partition from the leader, return the next cursor
+func exportPage(info *namespaceInfo, pid int, cursor []byte, w *common.TableDumpWriter) ([]byte, int64, error) {
+	pn, ok := info.Partitions[strconv.Itoa(pid)]
+	if !ok || pn.Leader.BroadcastAddress == "" {
+		return nil, 0, fmt.Errorf("no leader for partition %v", pid)
+	}
+	addr := net.JoinHostPort(pn.Leader.BroadcastAddress, pn.Leader.HTTPPort)
+	q := url.Values{}
+	q.Set("partition", strconv.Itoa(pid))
+	q.Set("cursor", hex.EncodeToString(cursor))
+	q.Set("count", strconv.Itoa(*count))
+	endpoint := fmt.Sprintf("http://%s%s/%s/%s?%s", addr, common.APITableExport,
+		url.PathEscape(*ns), url.PathEscape(*table), q.Encode())
+	client := &http.Client{Transport: common.NewDeadlineTransport(httpTimeout)}
+	rsp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return nil, 0, fmt.Errorf("export from %v failed: %v %s", addr, rsp.Status, body)
+	}
+	r, err := common.NewTableDumpReader(rsp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	// the page is written to the file only if all received
+	var entries []*common.RDBEntry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		if err := w.WriteEntry(e); err != nil {
+			return nil, 0, err
+		}
+	}
+	next, _ := r.Checkpoint()
+	return next, int64(len(entries)), nil
+}
+
+func export() error {
+	f, pid, cursor, total, err := prepareExportFile()
+	if err == io.EOF {
+		log.Printf("the dump is already complete with %v keys, use -restart to export again\n", total)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := *table
+	if stat.Size() > 0 {
+		// append to the exist dump
+		header = ""
+	}
+	w, err := common.NewTableDumpWriter(f, header)
+	if err != nil {
+		return err
+	}
+	info, err := queryNamespace()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	for pid < info.PartitionNum {
+		var next []byte
+		var cnt int64
+		for retry := 0; ; retry++ {
+			next, cnt, err = exportPage(info, pid, cursor, w)
+			if err == nil {
+				break
+			}
+			if retry >= *retryNum {
+				return err
+			}
+			log.Printf("export partition %v failed: %v, retrying\n", pid, err)
+			time.Sleep(time.Second)
+			if newInfo, err := queryNamespace(); err == nil {
+				info = newInfo
+			}
+		}
+		total += cnt
+		if next == nil {
+			pid++
+			cursor = nil
+			log.Printf("partition %v exported, total %v keys\n", pid-1, total)
+		} else {
+			cursor = next
+		}
+		if err := w.WriteCheckpoint(encodeCursor(pid, cursor)); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(total); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	log.Printf("export finished. [total=%d, cost=%v]\n", total, time.Since(start))
+	return nil
+}
+
+func progressFile() string {
+	return *file + ".progress"
+}
+
+func loadProgress() (importProgress, error) {
+	var p importProgress
+	if *restart {
+		return p, nil
+	}
+	data, err := ioutil.ReadFile(progressFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return p, err
+	}
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+func saveProgress(p importProgress) error {
+	data, _ := json.Marshal(p)
+	tmp := progressFile() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, progressFile())
+}
+
+func newClient() *sdk.ZanRedisClient {
+	conf := &sdk.Conf{
+		LookupList:   strings.Split(*lookup, ","),
+		DialTimeout:  10 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		TendInterval: 100,
+		Namespace:    *ns,
+		Password:     *pass,
+	}
+	client := sdk.NewZanRedisClient(conf)
+	client.Start()
+	return client
+}
+
+func importDump() error {
+	progress, err := loadProgress()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := common.NewTableDumpReader(f)
+	if err != nil {
+		return err
+	}
+	tb := *table
+	if tb == "" {
+		tb = r.Table()
+	}
+	client := newClient()
+	defer client.Stop()
+
+	if progress.Offset > 0 {
+		log.Printf("resume the import from offset %v with %v keys imported\n", progress.Offset, progress.Imported)
+	}
+	start := time.Now()
+	var processed int64
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if r.Offset() <= progress.Offset {
+			continue
+		}
+		ttl := e.GetRemainingTTL(time.Now())
+		if ttl < 0 {
+			progress.Expired++
+		} else {
+			pk := sdk.NewPKey(*ns, tb, e.Key)
+			cmds, err := common.BuildRDBEntryCommands(pk.RawKey, e, ttl, 100)
+			if err != nil {
+				return fmt.Errorf("import key %s failed: %v", e.Key, err)
+			}
+			for _, args := range cmds {
+				cmdArgs := make([]interface{}, 0, len(args)-1)
+				for _, arg := range args[1:] {
+					cmdArgs = append(cmdArgs, arg)
+				}
+				if _, err := client.DoRedis(string(args[0]), pk.ShardingKey(), true, cmdArgs...); err != nil {
+					return fmt.Errorf("import key %s failed: %v", e.Key, err)
+				}
+				time.Sleep(tm)
+			}
+			progress.Imported++
+		}
+		progress.Offset = r.Offset()
+		processed++
+		if processed%1000 == 0 {
+			if err := saveProgress(progress); err != nil {
+				return err
+			}
+		}
+		if processed%10000 == 0 {
+			log.Printf("current imported %v, progress %.2f%%\n", progress.Imported,
+				float64(progress.Offset)*100/float64(stat.Size()))
+		}
+	}
+	os.Remove(progressFile())
+	log.Printf("import finished. [total=%d, imported=%d, expired=%d, cost=%v]\n", r.Total(),
+		progress.Imported, progress.Expired, time.Since(start))
+	return nil
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+
+	checkParameter()
+
+	tm = time.Duration(1000000 / *qps) * time.Microsecond
+
+	var err error
+	if *mode == "export" {
+		err = export()
+	} else {
+		err = importDump()
+	}
+	if err != nil {
+		log.Fatalf("%v failed: %v", *mode, err)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
+)
+
+var (
+	flagSet    = flag.NewFlagSet("tableinspect", flag.ExitOnError)
+	mode       = flagSet.String("mode", "online", "online to inspect the namespace in the cluster, or offline to inspect the local data")
+	pd         = flagSet.String("pd", "", "the http address of the placedriver for online mode, such as 127.0.0.1:18001")
+	ns         = flagSet.String("ns", "", "the namespace to inspect for online mode")
+	table      = flagSet.String("table", "", "the table to inspect (default all the tables)")
+	dataDir    = flagSet.String("data_dir", "", "the data dir of the partition for offline mode, the node should be stopped")
+	checkpoint = flagSet.String("checkpoint", "", "the rocksdb checkpoint (or the backup copy) dir for offline mode")
+	expPolicy  = flagSet.String("expiration_policy", "local_deletion", "the expiration policy of the namespace for offline mode")
+	output     = flagSet.String("o", "table", "the output format: table or json")
+	interval   = flagSet.Duration("interval", time.Second*5, "the interval to check the inspection status for online mode")
+	timeout    = flagSet.Duration("timeout", time.Hour*2, "the timeout waiting the inspection done for online mode")
+
+	httpTimeout = time.Second * 30
+)
+
+type nodeInfo struct {
+	BroadcastAddress string `json:"broadcast_address"`
+	HTTPPort         string `json:"http_port"`
+}
+
+type partitionNodeInfo struct {
+	Leader nodeInfo `json:"leader"`
+}
+
+type namespaceInfo struct {
+	PartitionNum int                          `json:"partition_num"`
+	Partitions   map[string]partitionNodeInfo `json:"partitions"`
+}
+
+func help() {
+	log.Println("Usage:")
+	log.Println("\t", os.Args[0], "-mode online -pd 127.0.0.1:18001 -ns namespace [-table table_name]")
+	log.Println("\t", os.Args[0], "-mode offline -data_dir partition_data_dir [-table table_name -expiration_policy local_deletion]")
+	log.Println("\t", os.Args[0], "-mode offline -checkpoint checkpoint_dir [-table table_name -expiration_policy local_deletion]")
+	os.Exit(0)
+}
+
+func queryNamespace() (*namespaceInfo, error) {
+	var info namespaceInfo
+	_, err := common.APIRequest("GET", "http://"+*pd+"/query/"+*ns, nil, httpTimeout, &info)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Partitions) == 0 {
+		return nil, errors.New("no partition found for namespace: " + *ns)
+	}
+	return &info, nil
+}
+
+// inspect the leader of each partition, since the replicas have the same data
+func inspectOnline() (map[string]*common.TableInspectStats, error) {
+	info, err := queryNamespace()
+	if err != nil {
+		return nil, err
+	}
+	leaders := make(map[string][]string)
+	for pid, p := range info.Partitions {
+		if p.Leader.BroadcastAddress == "" {
+			return nil, fmt.Errorf("no leader for partition %v", pid)
+		}
+		addr := p.Leader.BroadcastAddress + ":" + p.Leader.HTTPPort
+		leaders[addr] = append(leaders[addr], common.GetNsDesp(*ns, mustAtoi(pid)))
+	}
+	for addr := range leaders {
+		params := url.Values{}
+		params.Set("table", *table)
+		endpoint := "http://" + addr + "/kv/inspect/" + *ns + "?" + params.Encode()
+		if _, err := common.APIRequest("POST", endpoint, nil, httpTimeout, nil); err != nil {
+			return nil, fmt.Errorf("start inspection on %v failed: %v", addr, err)
+		}
+		log.Printf("inspection started on %v for partitions: %v", addr, leaders[addr])
+	}
+
+	start := time.Now()
+	pending := make(map[string][]string, len(leaders))
+	for addr, parts := range leaders {
+		pending[addr] = parts
+	}
+	merged := make(map[string]*common.TableInspectStats)
+	for len(pending) > 0 {
+		if time.Since(start) > *timeout {
+			return nil, fmt.Errorf("waiting inspection timeout on: %v", pending)
+		}
+		time.Sleep(*interval)
+		for addr, parts := range pending {
+			var status map[string]rockredis.TableInspectStatus
+			_, err := common.APIRequest("GET", "http://"+addr+"/kv/inspect/"+*ns, nil, httpTimeout, &status)
+			if err != nil {
+				log.Printf("get inspection status from %v failed: %v", addr, err)
+				continue
+			}
+			if !partitionsDone(status, parts, start) {
+				continue
+			}
+			for _, p := range parts {
+				st := status[p]
+				if st.Err != "" {
+					return nil, fmt.Errorf("inspect partition %v on %v failed: %v", p, addr, st.Err)
+				}
+				mergeTables(merged, st.Tables)
+			}
+			log.Printf("inspection done on %v", addr)
+			delete(pending, addr)
+		}
+	}
+	return merged, nil
+}
+
+// the inspection of the partition may start a little later after the request, so we
+// check the start time to avoid using the last result.
+func partitionsDone(status map[string]rockredis.TableInspectStatus, parts []string, start time.Time) bool {
+	for _, p := range parts {
+		st, ok := status[p]
+		if !ok || st.Running || st.StartTime < start.Unix()-1 {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeTables(merged map[string]*common.TableInspectStats, tables map[string]*common.TableInspectStats) {
+	for name, st := range tables {
+		m, ok := merged[name]
+		if !ok {
+			m = common.NewTableInspectStats(name)
+			merged[name] = m
+		}
+		m.Merge(st)
+	}
+}
+
+func mustAtoi(s string) int {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("invalid partition id %v: %v", s, err)
+	}
+	return v
+}
+
+// link (or copy if failed) the checkpoint files to the temp data dir, so the opened
+// db will not change the checkpoint
+func prepareCheckpoint(src string) (string, error) {
+	base, err := ioutil.TempDir("", "tableinspect")
+	if err != nil {
+		return "", err
+	}
+	dst := rockredis.GetDataDirFromBase(base)
+	if err := os.MkdirAll(dst, common.DIR_PERM); err != nil {
+		return base, err
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return base, err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		from := path.Join(src, f.Name())
+		to := path.Join(dst, f.Name())
+		// the manifest and the options files may be changed after opened
+		if !strings.HasSuffix(f.Name(), ".sst") || os.Link(from, to) != nil {
+			if err := copyFile(from, to); err != nil {
+				return base, err
+			}
+		}
+	}
+	return base, nil
+}
+
+func copyFile(from string, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func inspectOffline() (map[string]*common.TableInspectStats, error) {
+	policy, err := common.StringToExpirationPolicy(*expPolicy)
+	if err != nil {
+		return nil, err
+	}
+	base := *dataDir
+	if *checkpoint != "" {
+		base, err = prepareCheckpoint(*checkpoint)
+		if base != "" {
+			defer os.RemoveAll(base)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg := rockredis.NewRockConfig()
+	cfg.DataDir = base
+	cfg.ExpirationPolicy = policy
+	db, err := rockredis.OpenRockDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if err := db.InspectTables(*table); err != nil {
+		return nil, err
+	}
+	return db.GetTableInspectStatus().Tables, nil
+}
+
+func printTables(tables map[string]*common.TableInspectStats) error {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if *output == "json" {
+		list := make([]*common.TableInspectStats, 0, len(names))
+		for _, name := range names {
+			list = append(list, tables[name])
+		}
+		d, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(d))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		st := tables[name]
+		fmt.Fprintf(w, "table: %v\ttotal keys: %v\n", name, st.TotalKeys)
+		types := make([]string, 0, len(st.Keys))
+		for t, n := range st.Keys {
+			types = append(types, t+"="+strconv.FormatInt(n, 10))
+		}
+		sort.Strings(types)
+		fmt.Fprintf(w, "  keys:\t%v\n", strings.Join(types, " "))
+		printHistogram(w, "key size", st.KeySize)
+		printHistogram(w, "elements", st.Elements)
+		printHistogram(w, "ttl(s)", st.TTL)
+		indexes := make([]string, 0, len(st.IndexSize))
+		for idx := range st.IndexSize {
+			indexes = append(indexes, idx)
+		}
+		sort.Strings(indexes)
+		for _, idx := range indexes {
+			fmt.Fprintf(w, "  %v:\tsize=%v entries=%v\n", idx, st.IndexSize[idx], st.IndexKeys[idx])
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func printHistogram(w io.Writer, name string, h *common.InspectHistogram) {
+	if h == nil || h.Total == 0 {
+		return
+	}
+	var buckets []string
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		buckets = append(buckets, h.BucketName(i)+":"+strconv.FormatInt(c, 10))
+	}
+	fmt.Fprintf(w, "  %v:\tcount=%v avg=%v max=%v\t%v\n", name, h.Total, h.Avg(), h.Max, strings.Join(buckets, " "))
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+	if *output != "table" && *output != "json" {
+		log.Printf("unknown output format: %v", *output)
+		help()
+	}
+	var tables map[string]*common.TableInspectStats
+	var err error
+	switch *mode {
+	case "online":
+		if *pd == "" || *ns == "" {
+			help()
+		}
+		tables, err = inspectOnline()
+	case "offline":
+		if (*dataDir == "") == (*checkpoint == "") {
+			log.Printf("one of the data_dir and the checkpoint should be given")
+			help()
+		}
+		tables, err = inspectOffline()
+	default:
+		help()
+	}
+	if err != nil {
+		log.Fatalf("inspect %v failed: %v", *mode, err)
+	}
+	if err := printTables(tables); err != nil {
+		log.Fatalf("print result failed: %v", err)
+	}
+}
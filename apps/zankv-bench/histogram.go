@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// the latency is recorded in microseconds with 64 sub buckets for each power of 2,
+// so the error of the percentiles is less than 1/64.
+const (
+	histSubBucketBits = 6
+	histSubBuckets    = 1 << histSubBucketBits
+	histBuckets       = (64 - histSubBucketBits + 1) * histSubBuckets
+)
+
+type histogram struct {
+	counts [histBuckets]int64
+	total  int64
+	sum    int64
+	max    int64
+}
+
+func histBucketIndex(v int64) int {
+	if v < histSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBucketBits - 1
+	return shift*histSubBuckets + int(v>>uint(shift))
+}
+
+// the upper bound of the values in the bucket
+func histBucketValue(index int) int64 {
+	if index < histSubBuckets {
+		return int64(index)
+	}
+	shift := index/histSubBuckets - 1
+	sub := int64(index%histSubBuckets + histSubBuckets)
+	return ((sub + 1) << uint(shift)) - 1
+}
+
+func (h *histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	h.counts[histBucketIndex(v)]++
+	h.total++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *histogram) Merge(other *histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *histogram) Count() int64 {
+	return h.total
+}
+
+func (h *histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.total) * time.Microsecond
+}
+
+func (h *histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Percentile return the latency which the given percent (0-100) of the requests are below
+func (h *histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(float64(h.total)*p/100 + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	cnt := int64(0)
+	for i, c := range h.counts {
+		cnt += c
+		if cnt >= target {
+			v := histBucketValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
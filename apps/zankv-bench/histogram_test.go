@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	for _, v := range []int64{0, 1, 63, 64, 65, 127, 128, 1000, 123456, 1 << 40} {
+		index := histBucketIndex(v)
+		assert.True(t, index < histBuckets)
+		upper := histBucketValue(index)
+		assert.True(t, upper >= v, "value %v, upper %v", v, upper)
+		// the error should be less than 1/64
+		assert.True(t, upper-v <= v/histSubBuckets, "value %v, upper %v", v, upper)
+		if index > 0 {
+			assert.True(t, histBucketValue(index-1) < v)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var h histogram
+	assert.Equal(t, time.Duration(0), h.Percentile(99))
+	assert.Equal(t, time.Duration(0), h.Mean())
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	assert.Equal(t, int64(1000), h.Count())
+	assert.Equal(t, time.Millisecond, h.Max())
+	assert.Equal(t, 500*time.Microsecond, h.Mean())
+	checkPercentile := func(p float64, expect int64) {
+		v := int64(h.Percentile(p) / time.Microsecond)
+		assert.True(t, v >= expect && v <= expect+expect/histSubBuckets,
+			"percentile %v, expect %v, got %v", p, expect, v)
+	}
+	checkPercentile(50, 500)
+	checkPercentile(90, 900)
+	checkPercentile(99, 990)
+	checkPercentile(0, 1)
+	// should not be larger than the max value
+	assert.Equal(t, time.Millisecond, h.Percentile(100))
+
+	h.Record(-time.Microsecond)
+	assert.Equal(t, int64(1001), h.Count())
+	assert.Equal(t, time.Duration(0), h.Percentile(0))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var h1, h2 histogram
+	for i := 0; i < 100; i++ {
+		h1.Record(time.Millisecond)
+		h2.Record(time.Millisecond * 3)
+	}
+	h1.Merge(&h2)
+	assert.Equal(t, int64(200), h1.Count())
+	assert.Equal(t, time.Millisecond*2, h1.Mean())
+	assert.Equal(t, time.Millisecond*3, h1.Max())
+	assert.Equal(t, time.Millisecond*3, h1.Percentile(99))
+	p := h1.Percentile(50)
+	assert.True(t, p >= time.Millisecond && p < time.Millisecond*3/2, "p50 %v", p)
+
+	ws := newWorkerStats()
+	ws.record(opGet, time.Millisecond, nil)
+	ws.record(opGet, time.Millisecond, errInvalidMix)
+	other := newWorkerStats()
+	other.record(opGet, time.Millisecond, nil)
+	other.record(opSet, time.Millisecond, errInvalidMix)
+	ws.merge(other)
+	assert.Equal(t, int64(2), ws.hists[opGet].Count())
+	assert.Nil(t, ws.hists[opSet])
+	assert.Equal(t, int64(1), ws.errs[opGet])
+	assert.Equal(t, int64(1), ws.errs[opSet])
+}
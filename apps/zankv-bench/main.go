@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/client"
+	"github.com/siddontang/goredis"
+)
+
+var (
+	flagSet = flag.NewFlagSet("zankv-bench", flag.ExitOnError)
+
+	addr        = flagSet.String("addr", "127.0.0.1:6380", "the redis address of the data node to benchmark directly")
+	pdAddrs     = flagSet.String("pd", "", "the comma separated placedriver http addresses, the commands will be routed by the partitions if set")
+	password    = flagSet.String("password", "", "the redis password")
+	namespace   = flagSet.String("namespace", "default", "the namespace to benchmark")
+	table       = flagSet.String("table", "bench", "the table to benchmark")
+	clients     = flagSet.Int("c", 50, "number of the concurrent clients")
+	number      = flagSet.Int64("n", 100000, "the total number of the commands, ignored if the duration is set")
+	duration    = flagSet.Duration("duration", 0, "run the benchmark for the duration")
+	mixStr      = flagSet.String("mix", "get:50,set:30,hset:10,zadd:5,scan:5", "the weights of the commands in the workload (get,set,hset,zadd,scan)")
+	keyNum      = flagSet.Uint64("keys", 100000, "the number of the keys in the key space")
+	dist        = flagSet.String("dist", "zipfian", "the distribution of the keys: uniform or zipfian")
+	zipfS       = flagSet.Float64("zipf-s", 1.1, "the skew of the zipfian distribution, should be greater than 1")
+	fields      = flagSet.Uint64("fields", 10, "the number of the fields in each hash or zset")
+	valueSize   = flagSet.String("vsize", "100", "the value size, or the range of the random value size such as 64-1024")
+	pipeline    = flagSet.Int("pipeline", 1, "the number of the pipelined commands in each request, only for the direct benchmark")
+	consistency = flagSet.String("consistency", "leader", "the consistency of the read commands: leader or stale, only for the benchmark with placedriver")
+	scanCount   = flagSet.Int("scan-count", 10, "the count of each scan")
+	seed        = flagSet.Int64("seed", 1, "the random seed, the same seed will generate the same workload")
+	preload     = flagSet.Bool("preload", false, "set all the string keys before the benchmark")
+	reportIntv  = flagSet.Duration("report-interval", time.Second*10, "the interval to report the progress, 0 to disable")
+)
+
+var errPipelineWithPD = errors.New("the pipeline is not supported while routing by placedriver")
+var errConsistencyWithoutPD = errors.New("the consistency level should be used with placedriver")
+
+// executor send the commands of a worker and return the error of each command
+type executor interface {
+	do(cmds []benchCmd) []error
+	close()
+}
+
+type directExecutor struct {
+	pool   *goredis.Client
+	conn   *goredis.PoolConn
+	prefix string
+}
+
+func (e *directExecutor) fullKey(key string) string {
+	return e.prefix + key
+}
+
+func (e *directExecutor) cmdArgs(c benchCmd) []interface{} {
+	args := make([]interface{}, 0, len(c.args)+1)
+	args = append(args, e.fullKey(c.key))
+	return append(args, c.args...)
+}
+
+func (e *directExecutor) do(cmds []benchCmd) []error {
+	errs := make([]error, len(cmds))
+	if e.conn == nil {
+		conn, err := e.pool.Get()
+		if err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+			return errs
+		}
+		e.conn = conn
+	}
+	var connErr error
+	if len(cmds) == 1 {
+		_, errs[0] = e.conn.Do(cmds[0].cmd, e.cmdArgs(cmds[0])...)
+		if _, ok := errs[0].(goredis.Error); errs[0] != nil && !ok {
+			connErr = errs[0]
+		}
+	} else {
+		sent := 0
+		for _, c := range cmds {
+			if connErr = e.conn.Send(c.cmd, e.cmdArgs(c)...); connErr != nil {
+				break
+			}
+			sent++
+		}
+		for i := 0; i < sent && connErr == nil; i++ {
+			_, errs[i] = e.conn.Receive()
+			if _, ok := errs[i].(goredis.Error); errs[i] != nil && !ok {
+				connErr = errs[i]
+			}
+		}
+		if connErr != nil {
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = connErr
+				}
+			}
+		}
+	}
+	// reconnect while the connection is broken
+	if connErr != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+	return errs
+}
+
+func (e *directExecutor) close() {
+	if e.conn != nil {
+		e.conn.Close()
+	}
+}
+
+type pdExecutor struct {
+	c     *client.Client
+	level client.Consistency
+}
+
+func (e *pdExecutor) do(cmds []benchCmd) []error {
+	errs := make([]error, len(cmds))
+	for i, c := range cmds {
+		level := client.ConsistencyLeader
+		if readOps[c.op] {
+			level = e.level
+		}
+		_, errs[i] = e.c.DoWithConsistency(level, c.cmd, *table, c.key, c.args...)
+	}
+	return errs
+}
+
+func (e *pdExecutor) close() {
+}
+
+type workerStats struct {
+	hists map[string]*histogram
+	errs  map[string]int64
+}
+
+func newWorkerStats() *workerStats {
+	return &workerStats{
+		hists: make(map[string]*histogram),
+		errs:  make(map[string]int64),
+	}
+}
+
+func (ws *workerStats) record(op string, cost time.Duration, err error) {
+	if err != nil {
+		ws.errs[op]++
+		return
+	}
+	h, ok := ws.hists[op]
+	if !ok {
+		h = &histogram{}
+		ws.hists[op] = h
+	}
+	h.Record(cost)
+}
+
+func (ws *workerStats) merge(other *workerStats) {
+	for op, h := range other.hists {
+		if _, ok := ws.hists[op]; !ok {
+			ws.hists[op] = &histogram{}
+		}
+		ws.hists[op].Merge(h)
+	}
+	for op, n := range other.errs {
+		ws.errs[op] += n
+	}
+}
+
+type bench struct {
+	newExecutor func() executor
+	mix         *workloadMix
+	minSize     int
+	maxSize     int
+	// the number of commands issued by all the workers
+	issued int64
+	done   int64
+	errCnt int64
+}
+
+// claim the commands for the next batch, zero means the benchmark is over
+func (b *bench) claim(batch int, deadline time.Time) int {
+	if !deadline.IsZero() {
+		if time.Now().After(deadline) {
+			return 0
+		}
+		return batch
+	}
+	end := atomic.AddInt64(&b.issued, int64(batch))
+	if end <= *number {
+		return batch
+	}
+	left := *number - (end - int64(batch))
+	if left <= 0 {
+		return 0
+	}
+	return int(left)
+}
+
+func (b *bench) runWorker(index int, deadline time.Time) (*workerStats, error) {
+	stats := newWorkerStats()
+	w, err := newWorkload(*seed+int64(index), b.mix, *dist, *zipfS, *keyNum, b.minSize, b.maxSize,
+		*fields, *scanCount)
+	if err != nil {
+		return nil, err
+	}
+	e := b.newExecutor()
+	defer e.close()
+	cmds := make([]benchCmd, 0, *pipeline)
+	for {
+		n := b.claim(*pipeline, deadline)
+		if n <= 0 {
+			return stats, nil
+		}
+		cmds = cmds[:0]
+		for i := 0; i < n; i++ {
+			cmds = append(cmds, w.next())
+		}
+		start := time.Now()
+		errs := e.do(cmds)
+		cost := time.Since(start)
+		for i, c := range cmds {
+			stats.record(c.op, cost, errs[i])
+			if errs[i] != nil {
+				atomic.AddInt64(&b.errCnt, 1)
+			}
+		}
+		atomic.AddInt64(&b.done, int64(n))
+	}
+}
+
+func (b *bench) preload() {
+	log.Printf("preloading %v keys", *keyNum)
+	var wg sync.WaitGroup
+	var loaded int64
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			w, err := newWorkload(*seed+int64(index), b.mix, "uniform", 0, *keyNum, b.minSize, b.maxSize,
+				*fields, *scanCount)
+			if err != nil {
+				return
+			}
+			e := b.newExecutor()
+			defer e.close()
+			cmds := make([]benchCmd, 0, *pipeline)
+			for k := uint64(index); k < *keyNum; k += uint64(*clients) {
+				cmds = append(cmds, benchCmd{op: opSet, cmd: "SET", key: benchKey("k", k),
+					args: []interface{}{w.nextValue()}})
+				if len(cmds) >= *pipeline || k+uint64(*clients) >= *keyNum {
+					for _, err := range e.do(cmds) {
+						if err != nil {
+							log.Printf("preload failed: %v", err)
+						}
+					}
+					atomic.AddInt64(&loaded, int64(len(cmds)))
+					cmds = cmds[:0]
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	log.Printf("preloaded %v keys", atomic.LoadInt64(&loaded))
+}
+
+func (b *bench) report(stopC chan struct{}) {
+	if *reportIntv <= 0 {
+		return
+	}
+	ticker := time.NewTicker(*reportIntv)
+	defer ticker.Stop()
+	last := int64(0)
+	lastTime := time.Now()
+	for {
+		select {
+		case <-stopC:
+			return
+		case now := <-ticker.C:
+			done := atomic.LoadInt64(&b.done)
+			log.Printf("done: %v, errors: %v, %0.2f op/s", done, atomic.LoadInt64(&b.errCnt),
+				float64(done-last)/now.Sub(lastTime).Seconds())
+			last = done
+			lastTime = now
+		}
+	}
+}
+
+func (b *bench) run() (*workerStats, time.Duration) {
+	var deadline time.Time
+	if *duration > 0 {
+		deadline = time.Now().Add(*duration)
+	}
+	stopC := make(chan struct{})
+	go b.report(stopC)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	all := newWorkerStats()
+	start := time.Now()
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			stats, err := b.runWorker(index, deadline)
+			if err != nil {
+				log.Printf("worker %v failed: %v", index, err)
+				return
+			}
+			mutex.Lock()
+			all.merge(stats)
+			mutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	cost := time.Since(start)
+	close(stopC)
+	return all, cost
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printReport(stats *workerStats, ops []string, cost time.Duration) {
+	fmt.Printf("mix: %v, dist: %v, keys: %v, vsize: %v, pipeline: %v, consistency: %v, clients: %v, seed: %v\n",
+		*mixStr, *dist, *keyNum, *valueSize, *pipeline, *consistency, *clients, *seed)
+	fmt.Printf("total time: %v\n\n", cost)
+	fmt.Printf("%-6s %10s %8s %12s %10s %10s %10s %10s %10s %10s\n", "cmd", "count", "errors",
+		"op/s", "avg(ms)", "p50(ms)", "p90(ms)", "p99(ms)", "p999(ms)", "max(ms)")
+	total := &histogram{}
+	totalErr := int64(0)
+	printLine := func(name string, h *histogram, errCnt int64) {
+		fmt.Printf("%-6s %10d %8d %12.2f %10.3f %10.3f %10.3f %10.3f %10.3f %10.3f\n", name, h.Count(), errCnt,
+			float64(h.Count())/cost.Seconds(), toMs(h.Mean()), toMs(h.Percentile(50)), toMs(h.Percentile(90)),
+			toMs(h.Percentile(99)), toMs(h.Percentile(99.9)), toMs(h.Max()))
+	}
+	for _, op := range ops {
+		h, ok := stats.hists[op]
+		if !ok {
+			h = &histogram{}
+		}
+		printLine(op, h, stats.errs[op])
+		total.Merge(h)
+		totalErr += stats.errs[op]
+	}
+	printLine("total", total, totalErr)
+}
+
+func parseConsistency(s string) (client.Consistency, error) {
+	switch strings.ToLower(s) {
+	case "leader", "":
+		return client.ConsistencyLeader, nil
+	case "stale":
+		return client.ConsistencyStale, nil
+	default:
+		return client.ConsistencyLeader, fmt.Errorf("unknown consistency: %v", s)
+	}
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+
+	mix, err := parseWorkloadMix(*mixStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	minSize, maxSize, err := parseValueSize(*valueSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, err := parseConsistency(*consistency)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *clients <= 0 || *pipeline <= 0 || *keyNum == 0 || *fields == 0 {
+		log.Fatal("the clients, pipeline, keys and fields should be positive")
+	}
+	if *duration <= 0 && *number <= 0 {
+		log.Fatal("either the number or the duration should be set")
+	}
+	// check the distribution before starting the workers
+	if _, err := newWorkload(*seed, mix, *dist, *zipfS, *keyNum, minSize, maxSize, *fields, *scanCount); err != nil {
+		log.Fatal(err)
+	}
+
+	b := &bench{
+		mix:     mix,
+		minSize: minSize,
+		maxSize: maxSize,
+	}
+	if *pdAddrs != "" {
+		if *pipeline > 1 {
+			log.Fatal(errPipelineWithPD)
+		}
+		c, err := client.NewClient(client.Config{
+			PDAddrs:            strings.Split(*pdAddrs, ","),
+			Namespace:          *namespace,
+			Password:           *password,
+			MaxIdleConns:       *clients,
+			DefaultConsistency: level,
+		})
+		if err != nil {
+			log.Fatalf("init client failed: %v", err)
+		}
+		defer c.Close()
+		b.newExecutor = func() executor {
+			return &pdExecutor{c: c, level: level}
+		}
+	} else {
+		if level != client.ConsistencyLeader {
+			log.Fatal(errConsistencyWithoutPD)
+		}
+		pool := goredis.NewClient(*addr, *password)
+		pool.SetMaxIdleConns(*clients)
+		defer pool.Close()
+		prefix := *namespace + ":" + *table + ":"
+		b.newExecutor = func() executor {
+			return &directExecutor{pool: pool, prefix: prefix}
+		}
+	}
+
+	if *preload {
+		b.preload()
+	}
+	stats, cost := b.run()
+	printReport(stats, mix.opNames(), cost)
+}
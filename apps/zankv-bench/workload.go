@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	opGet  = "get"
+	opSet  = "set"
+	opHSet = "hset"
+	opZAdd = "zadd"
+	opScan = "scan"
+)
+
+var allOps = []string{opGet, opSet, opHSet, opZAdd, opScan}
+
+// the read ops can be sent to the replicas with the stale consistency
+var readOps = map[string]bool{
+	opGet:  true,
+	opScan: true,
+}
+
+var errInvalidMix = errors.New("invalid workload mix, should be like get:80,set:20")
+var errInvalidValueSize = errors.New("invalid value size, should be like 100 or 64-1024")
+var errInvalidDist = errors.New("invalid key distribution, should be uniform or zipfian")
+
+type opWeight struct {
+	op     string
+	weight int
+}
+
+type workloadMix struct {
+	ops   []opWeight
+	total int
+}
+
+// parseWorkloadMix parse the mix such as "get:80,set:15,scan:5", the weight of the op
+// without the number is 1.
+func parseWorkloadMix(s string) (*workloadMix, error) {
+	mix := &workloadMix{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		op := strings.ToLower(item)
+		weight := 1
+		if i := strings.Index(item, ":"); i >= 0 {
+			op = strings.ToLower(item[:i])
+			w, err := strconv.Atoi(item[i+1:])
+			if err != nil || w < 0 {
+				return nil, errInvalidMix
+			}
+			weight = w
+		}
+		known := false
+		for _, o := range allOps {
+			if o == op {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errInvalidMix
+		}
+		if weight == 0 {
+			continue
+		}
+		mix.ops = append(mix.ops, opWeight{op: op, weight: weight})
+		mix.total += weight
+	}
+	if mix.total == 0 {
+		return nil, errInvalidMix
+	}
+	return mix, nil
+}
+
+func (m *workloadMix) next(r *rand.Rand) string {
+	n := r.Intn(m.total)
+	for _, ow := range m.ops {
+		if n < ow.weight {
+			return ow.op
+		}
+		n -= ow.weight
+	}
+	return m.ops[len(m.ops)-1].op
+}
+
+func (m *workloadMix) opNames() []string {
+	names := make([]string, 0, len(m.ops))
+	for _, ow := range m.ops {
+		names = append(names, ow.op)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseValueSize(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	minSize, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || minSize <= 0 {
+		return 0, 0, errInvalidValueSize
+	}
+	maxSize := minSize
+	if len(parts) == 2 {
+		maxSize, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || maxSize < minSize {
+			return 0, 0, errInvalidValueSize
+		}
+	}
+	return minSize, maxSize, nil
+}
+
+// keyChooser choose the key index in [0, keyNum)
+type keyChooser interface {
+	next() uint64
+}
+
+type uniformChooser struct {
+	r      *rand.Rand
+	keyNum uint64
+}
+
+func (c *uniformChooser) next() uint64 {
+	return uint64(c.r.Int63n(int64(c.keyNum)))
+}
+
+// the hot keys are scattered in the key space by the hash, so the hot keys will
+// not be in the same partition.
+type zipfianChooser struct {
+	zipf   *rand.Zipf
+	keyNum uint64
+}
+
+func (c *zipfianChooser) next() uint64 {
+	rank := c.zipf.Uint64()
+	return scatterKey(rank) % c.keyNum
+}
+
+// the fnv hash of the rank
+func scatterKey(rank uint64) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < 8; i++ {
+		h ^= rank & 0xff
+		h *= 1099511628211
+		rank >>= 8
+	}
+	return h
+}
+
+func newKeyChooser(dist string, r *rand.Rand, keyNum uint64, zipfS float64) (keyChooser, error) {
+	switch strings.ToLower(dist) {
+	case "uniform":
+		return &uniformChooser{r: r, keyNum: keyNum}, nil
+	case "zipfian", "zipf":
+		if zipfS <= 1 {
+			return nil, errInvalidDist
+		}
+		return &zipfianChooser{zipf: rand.NewZipf(r, zipfS, 1, keyNum-1), keyNum: keyNum}, nil
+	default:
+		return nil, errInvalidDist
+	}
+}
+
+type benchCmd struct {
+	op   string
+	cmd  string
+	key  string
+	args []interface{}
+}
+
+// workload generate the commands for a worker, the workers with the same seed
+// will generate the same commands.
+type workload struct {
+	r       *rand.Rand
+	mix     *workloadMix
+	keys    keyChooser
+	minSize int
+	maxSize int
+	fields  uint64
+	scanCnt int
+	value   []byte
+}
+
+func newWorkload(seed int64, mix *workloadMix, dist string, zipfS float64, keyNum uint64,
+	minSize int, maxSize int, fields uint64, scanCnt int) (*workload, error) {
+	r := rand.New(rand.NewSource(seed))
+	keys, err := newKeyChooser(dist, r, keyNum, zipfS)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, maxSize)
+	for i := range value {
+		value[i] = byte('a' + r.Intn(26))
+	}
+	return &workload{
+		r:       r,
+		mix:     mix,
+		keys:    keys,
+		minSize: minSize,
+		maxSize: maxSize,
+		fields:  fields,
+		scanCnt: scanCnt,
+		value:   value,
+	}, nil
+}
+
+func (w *workload) nextValue() []byte {
+	size := w.minSize
+	if w.maxSize > w.minSize {
+		size += w.r.Intn(w.maxSize - w.minSize + 1)
+	}
+	return w.value[:size]
+}
+
+func benchKey(prefix string, idx uint64) string {
+	return prefix + strconv.FormatUint(idx, 10)
+}
+
+func (w *workload) next() benchCmd {
+	op := w.mix.next(w.r)
+	idx := w.keys.next()
+	switch op {
+	case opSet:
+		return benchCmd{op: op, cmd: "SET", key: benchKey("k", idx), args: []interface{}{w.nextValue()}}
+	case opHSet:
+		// the hash key has some fields, so the key index is split to the key and the field
+		return benchCmd{op: op, cmd: "HSET", key: benchKey("h", idx/w.fields),
+			args: []interface{}{idx % w.fields, w.nextValue()}}
+	case opZAdd:
+		return benchCmd{op: op, cmd: "ZADD", key: benchKey("z", idx/w.fields),
+			args: []interface{}{w.r.Int63n(1 << 32), idx % w.fields}}
+	case opScan:
+		return benchCmd{op: op, cmd: "SCAN", key: "", args: []interface{}{"COUNT", w.scanCnt}}
+	default:
+		return benchCmd{op: opGet, cmd: "GET", key: benchKey("k", idx)}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkloadMix(t *testing.T) {
+	mix, err := parseWorkloadMix("get:80, SET:15,scan:5")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, mix.total)
+	assert.Equal(t, []string{opGet, opScan, opSet}, mix.opNames())
+
+	mix, err = parseWorkloadMix("get,hset:0,zadd")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mix.total)
+	assert.Equal(t, []string{opGet, opZAdd}, mix.opNames())
+
+	for _, s := range []string{"", "get:0", "del:10", "get:-1", "get:abc", "get:80,set:"} {
+		_, err = parseWorkloadMix(s)
+		assert.Equal(t, errInvalidMix, err, "mix: %v", s)
+	}
+}
+
+func TestWorkloadMixNext(t *testing.T) {
+	mix, err := parseWorkloadMix("get:80,set:20")
+	assert.Nil(t, err)
+	r := rand.New(rand.NewSource(1))
+	cnts := make(map[string]int)
+	total := 100000
+	for i := 0; i < total; i++ {
+		cnts[mix.next(r)]++
+	}
+	assert.Equal(t, 2, len(cnts))
+	assert.InDelta(t, 0.8, float64(cnts[opGet])/float64(total), 0.01)
+	assert.InDelta(t, 0.2, float64(cnts[opSet])/float64(total), 0.01)
+}
+
+func TestParseValueSize(t *testing.T) {
+	minSize, maxSize, err := parseValueSize("100")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, minSize)
+	assert.Equal(t, 100, maxSize)
+	minSize, maxSize, err = parseValueSize("64 - 1024")
+	assert.Nil(t, err)
+	assert.Equal(t, 64, minSize)
+	assert.Equal(t, 1024, maxSize)
+	for _, s := range []string{"", "0", "-1", "abc", "100-10", "10-abc"} {
+		_, _, err = parseValueSize(s)
+		assert.Equal(t, errInvalidValueSize, err, "size: %v", s)
+	}
+}
+
+func TestKeyChooser(t *testing.T) {
+	keyNum := uint64(1000)
+	_, err := newKeyChooser("hash", rand.New(rand.NewSource(1)), keyNum, 1.1)
+	assert.Equal(t, errInvalidDist, err)
+	_, err = newKeyChooser("zipfian", rand.New(rand.NewSource(1)), keyNum, 1)
+	assert.Equal(t, errInvalidDist, err)
+
+	total := 100000
+	countKeys := func(c keyChooser) map[uint64]int {
+		cnts := make(map[uint64]int)
+		for i := 0; i < total; i++ {
+			k := c.next()
+			assert.True(t, k < keyNum)
+			cnts[k]++
+		}
+		return cnts
+	}
+	maxCnt := func(cnts map[uint64]int) (uint64, int) {
+		var key uint64
+		m := 0
+		for k, n := range cnts {
+			if n > m {
+				key, m = k, n
+			}
+		}
+		return key, m
+	}
+
+	uniform, err := newKeyChooser("Uniform", rand.New(rand.NewSource(1)), keyNum, 0)
+	assert.Nil(t, err)
+	cnts := countKeys(uniform)
+	assert.Equal(t, int(keyNum), len(cnts))
+	_, m := maxCnt(cnts)
+	assert.True(t, m < total/int(keyNum)*2, "max count %v", m)
+
+	zipf, err := newKeyChooser("zipf", rand.New(rand.NewSource(1)), keyNum, 1.1)
+	assert.Nil(t, err)
+	cnts = countKeys(zipf)
+	hot, m := maxCnt(cnts)
+	assert.True(t, m > total/10, "max count %v", m)
+	// the hottest key is scattered instead of the first key
+	assert.Equal(t, scatterKey(0)%keyNum, hot)
+	assert.NotEqual(t, uint64(0), hot)
+}
+
+func TestWorkloadSameSeed(t *testing.T) {
+	mix, err := parseWorkloadMix("get,set,hset,zadd,scan")
+	assert.Nil(t, err)
+	w1, err := newWorkload(1, mix, "zipfian", 1.1, 1000, 10, 20, 10, 5)
+	assert.Nil(t, err)
+	w2, err := newWorkload(1, mix, "zipfian", 1.1, 1000, 10, 20, 10, 5)
+	assert.Nil(t, err)
+	ops := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		c1 := w1.next()
+		c2 := w2.next()
+		assert.Equal(t, c1, c2)
+		ops[c1.op] = true
+		switch c1.op {
+		case opSet:
+			v := c1.args[0].([]byte)
+			assert.True(t, len(v) >= 10 && len(v) <= 20)
+		case opHSet:
+			assert.True(t, c1.args[0].(uint64) < 10)
+		case opZAdd:
+			assert.True(t, c1.args[1].(uint64) < 10)
+		case opScan:
+			assert.Equal(t, "", c1.key)
+			assert.Equal(t, []interface{}{"COUNT", 5}, c1.args)
+		}
+	}
+	assert.Equal(t, len(allOps), len(ops))
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/siddontang/goredis"
+)
+
+var errNodeNotFound = errors.New("the data node is not found")
+
+type dataNode struct {
+	ID               string `json:"id"`
+	BroadcastAddress string `json:"broadcast_address"`
+	Hostname         string `json:"hostname"`
+	RedisPort        string `json:"redis_port"`
+	HTTPPort         string `json:"http_port"`
+	Version          string `json:"version"`
+	DCInfo           string `json:"dc_info"`
+	Zone             string `json:"zone,omitempty"`
+	Rack             string `json:"rack,omitempty"`
+}
+
+func (n dataNode) redisAddr() string {
+	return net.JoinHostPort(n.BroadcastAddress, n.RedisPort)
+}
+
+func (n dataNode) httpAddr() string {
+	return net.JoinHostPort(n.BroadcastAddress, n.HTTPPort)
+}
+
+type partitionNodes struct {
+	Leader   dataNode   `json:"leader"`
+	Replicas []dataNode `json:"replicas"`
+}
+
+type namespaceTopology struct {
+	Epoch        int64                     `json:"epoch"`
+	PartitionNum int                       `json:"partition_num"`
+	EngType      string                    `json:"eng_type"`
+	Partitions   map[string]partitionNodes `json:"partitions"`
+}
+
+func getDataNodes() ([]dataNode, error) {
+	var rsp struct {
+		Nodes []dataNode `json:"nodes"`
+	}
+	if err := pdRequest("GET", "/datanodes", nil, &rsp); err != nil {
+		return nil, err
+	}
+	sort.Slice(rsp.Nodes, func(i, j int) bool { return rsp.Nodes[i].redisAddr() < rsp.Nodes[j].redisAddr() })
+	return rsp.Nodes, nil
+}
+
+func runNamespaceList(args []string) error {
+	var rsp struct {
+		Namespaces []string `json:"namespaces"`
+	}
+	if err := pdRequest("GET", "/namespaces", nil, &rsp); err != nil {
+		return err
+	}
+	sort.Strings(rsp.Namespaces)
+	return printResult(rsp, []string{"NAMESPACE"}, func() [][]string {
+		rows := make([][]string, 0, len(rsp.Namespaces))
+		for _, ns := range rsp.Namespaces {
+			rows = append(rows, []string{ns})
+		}
+		return rows
+	})
+}
+
+func runNamespaceCreate(args []string) error {
+	fs := newCommandFlags("namespace create")
+	ns := fs.String("ns", "", "the namespace name")
+	partitions := fs.Int("partitions", -1, "the partition number")
+	replicas := fs.Int("replicas", -1, "the replica number of each partition")
+	engType := fs.String("engtype", "", "the storage engine, rockredis by default")
+	expPolicy := fs.String("expiration_policy", "", "the expiration policy of the keys")
+	ttlSecs := fs.Int64("ttl_secs", 0, "the namespace will be deleted after the ttl, 0 means never")
+	fs.Parse(args)
+	if err := checkRequired(fs, "ns", "partitions", "replicas"); err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("namespace", *ns)
+	params.Set("partition_num", strconv.Itoa(*partitions))
+	params.Set("replicator", strconv.Itoa(*replicas))
+	if *engType != "" {
+		params.Set("engtype", *engType)
+	}
+	if *expPolicy != "" {
+		params.Set("expiration_policy", *expPolicy)
+	}
+	if *ttlSecs > 0 {
+		params.Set("ttl_secs", strconv.FormatInt(*ttlSecs, 10))
+	}
+	if err := pdLeaderRequest("POST", "/cluster/namespace/create", params, nil); err != nil {
+		return err
+	}
+	return printOK()
+}
+
+func runNamespaceDelete(args []string) error {
+	fs := newCommandFlags("namespace delete")
+	ns := fs.String("ns", "", "the namespace name")
+	yes := fs.Bool("yes", false, "confirm to delete all the data of the namespace")
+	fs.Parse(args)
+	if err := checkRequired(fs, "ns"); err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("all the data of the namespace %v will be deleted, add -yes to confirm", *ns)
+	}
+	params := url.Values{}
+	params.Set("namespace", *ns)
+	params.Set("partition", "**")
+	if err := pdLeaderRequest("DELETE", "/cluster/namespace/delete", params, nil); err != nil {
+		return err
+	}
+	return printOK()
+}
+
+func runPartitions(args []string) error {
+	fs := newCommandFlags("partitions")
+	ns := fs.String("ns", "", "the namespace name")
+	fs.Parse(args)
+	if err := checkRequired(fs, "ns"); err != nil {
+		return err
+	}
+	var topo namespaceTopology
+	if err := pdRequest("GET", "/query/"+url.PathEscape(*ns), nil, &topo); err != nil {
+		return err
+	}
+	return printResult(topo, []string{"PARTITION", "LEADER", "REPLICAS"}, func() [][]string {
+		pids := make([]int, 0, len(topo.Partitions))
+		for pidStr := range topo.Partitions {
+			if pid, err := strconv.Atoi(pidStr); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		sort.Ints(pids)
+		rows := make([][]string, 0, len(pids))
+		for _, pid := range pids {
+			pn := topo.Partitions[strconv.Itoa(pid)]
+			leader := "-"
+			if pn.Leader.BroadcastAddress != "" {
+				leader = pn.Leader.redisAddr()
+			}
+			replicas := make([]string, 0, len(pn.Replicas))
+			for _, r := range pn.Replicas {
+				replicas = append(replicas, r.redisAddr())
+			}
+			rows = append(rows, []string{strconv.Itoa(pid), leader, strings.Join(replicas, ",")})
+		}
+		return rows
+	})
+}
+
+func runNodes(args []string) error {
+	nodes, err := getDataNodes()
+	if err != nil {
+		return err
+	}
+	return printResult(nodes, []string{"ID", "REDIS", "HTTP", "HOSTNAME", "VERSION", "DC", "ZONE", "RACK"}, func() [][]string {
+		rows := make([][]string, 0, len(nodes))
+		for _, n := range nodes {
+			rows = append(rows, []string{n.ID, n.redisAddr(), n.httpAddr(), n.Hostname, n.Version,
+				n.DCInfo, n.Zone, n.Rack})
+		}
+		return rows
+	})
+}
+
+// the node can be given by the node id or the redis address
+func findNode(nodes []dataNode, node string) (dataNode, error) {
+	for _, n := range nodes {
+		if n.ID == node || n.redisAddr() == node {
+			return n, nil
+		}
+	}
+	return dataNode{}, errNodeNotFound
+}
+
+func runLeaderTransfer(args []string) error {
+	fs := newCommandFlags("leader transfer")
+	ns := fs.String("ns", "", "the namespace name")
+	pid := fs.Int("partition", -1, "the partition id")
+	node := fs.String("node", "", "the new leader node, the redis address or the node id")
+	fs.Parse(args)
+	if err := checkRequired(fs, "ns", "partition", "node"); err != nil {
+		return err
+	}
+	nodes, err := getDataNodes()
+	if err != nil {
+		return err
+	}
+	n, err := findNode(nodes, *node)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("namespace", *ns)
+	params.Set("partition", strconv.Itoa(*pid))
+	params.Set("node", n.ID)
+	if err := pdLeaderRequest("POST", "/cluster/partition/leader/transfer", params, nil); err != nil {
+		return err
+	}
+	return printOK()
+}
+
+func printBackupManifest(manifest *common.ClusterBackupManifest) error {
+	return printResult(manifest, []string{"NAMESPACE", "PARTITION", "NODE", "TERM", "INDEX", "ERROR"}, func() [][]string {
+		names := make([]string, 0, len(manifest.Namespaces))
+		for ns := range manifest.Namespaces {
+			names = append(names, ns)
+		}
+		sort.Strings(names)
+		var rows [][]string
+		for _, ns := range names {
+			for _, p := range manifest.Namespaces[ns].Partitions {
+				rows = append(rows, []string{ns, strconv.Itoa(p.Partition), p.Node,
+					strconv.FormatUint(p.Term, 10), strconv.FormatUint(p.Index, 10), p.Error})
+			}
+		}
+		return rows
+	})
+}
+
+func runBackup(args []string) error {
+	fs := newCommandFlags("backup")
+	ns := fs.String("ns", "", "the comma separated namespaces to backup, all the namespaces if empty")
+	timeoutSec := fs.Int("timeout_sec", 0, "the timeout of the backup on the data nodes")
+	fs.Parse(args)
+	params := url.Values{}
+	if *ns != "" {
+		params.Set("namespace", *ns)
+	}
+	if *timeoutSec > 0 {
+		params.Set("timeout_sec", strconv.Itoa(*timeoutSec))
+		// wait the backup done on the data nodes
+		if d := time.Duration(*timeoutSec)*time.Second + time.Second*10; d > *timeout {
+			*timeout = d
+		}
+	}
+	var manifest common.ClusterBackupManifest
+	if err := pdLeaderRequest("POST", "/cluster/backup", params, &manifest); err != nil {
+		return err
+	}
+	return printBackupManifest(&manifest)
+}
+
+func runBackupLast(args []string) error {
+	var manifest common.ClusterBackupManifest
+	if err := pdLeaderRequest("GET", "/cluster/backup/last", nil, &manifest); err != nil {
+		return err
+	}
+	return printBackupManifest(&manifest)
+}
+
+func runStats(args []string) error {
+	fs := newCommandFlags("stats")
+	node := fs.String("node", "", "the http address of the data node")
+	fs.Parse(args)
+	if *node == "" {
+		var rsp struct {
+			Stable          bool `json:"stable"`
+			UnderReplicated int  `json:"under_replicated"`
+			OverReplicated  int  `json:"over_replicated"`
+		}
+		if err := pdLeaderRequest("GET", "/cluster/stats", nil, &rsp); err != nil {
+			return err
+		}
+		return printResult(rsp, []string{"STABLE", "UNDER_REPLICATED", "OVER_REPLICATED"}, func() [][]string {
+			return [][]string{{strconv.FormatBool(rsp.Stable), strconv.Itoa(rsp.UnderReplicated),
+				strconv.Itoa(rsp.OverReplicated)}}
+		})
+	}
+	var rsp struct {
+		Version string             `json:"version"`
+		UpTime  int64              `json:"up_time"`
+		Stats   common.ServerStats `json:"stats"`
+	}
+	params := url.Values{}
+	params.Set("leader_only", "false")
+	if err := apiRequest("GET", *node, "/stats", params, &rsp); err != nil {
+		return err
+	}
+	return printResult(rsp, []string{"PARTITION", "LEADER", "KEYS", "DATA_BYTES", "WRITE_QPS", "FROZEN"}, func() [][]string {
+		sort.Slice(rsp.Stats.NSStats, func(i, j int) bool { return rsp.Stats.NSStats[i].Name < rsp.Stats.NSStats[j].Name })
+		rows := make([][]string, 0, len(rsp.Stats.NSStats))
+		for _, st := range rsp.Stats.NSStats {
+			keys, dataBytes, writeQPS := "-", "-", "-"
+			if st.Load != nil {
+				keys = strconv.FormatInt(st.Load.Keys, 10)
+				dataBytes = strconv.FormatInt(st.Load.DataBytes, 10)
+				writeQPS = strconv.FormatInt(st.Load.WriteQPS, 10)
+			}
+			rows = append(rows, []string{st.Name, strconv.FormatBool(st.IsLeader), keys, dataBytes, writeQPS,
+				strconv.FormatBool(st.Frozen)})
+		}
+		return rows
+	})
+}
+
+type slowLogEntry struct {
+	Node        string   `json:"node"`
+	Namespace   string   `json:"namespace"`
+	ID          int64    `json:"id"`
+	Timestamp   int64    `json:"timestamp"`
+	Cost        int64    `json:"cost"`
+	ProposeCost int64    `json:"propose_cost"`
+	ApplyCost   int64    `json:"apply_cost"`
+	Args        []string `json:"args"`
+}
+
+// the reply of SLOWLOG GET: id, timestamp, cost, args, namespace, propose cost, apply cost
+func parseSlowLogReply(node string, reply interface{}) ([]slowLogEntry, error) {
+	items, err := goredis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]slowLogEntry, 0, len(items))
+	for _, item := range items {
+		fields, err := goredis.Values(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 7 {
+			return nil, errors.New("invalid slowlog reply")
+		}
+		e := slowLogEntry{Node: node}
+		e.ID, _ = goredis.Int64(fields[0], nil)
+		e.Timestamp, _ = goredis.Int64(fields[1], nil)
+		e.Cost, _ = goredis.Int64(fields[2], nil)
+		e.Args, _ = goredis.Strings(fields[3], nil)
+		e.Namespace, _ = goredis.String(fields[4], nil)
+		e.ProposeCost, _ = goredis.Int64(fields[5], nil)
+		e.ApplyCost, _ = goredis.Int64(fields[6], nil)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func getSlowLogs(c *goredis.Client, node string, ns string, cnt int) ([]slowLogEntry, error) {
+	conn, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	args := []interface{}{"GET"}
+	if ns != "" {
+		args = append(args, ns)
+	}
+	args = append(args, cnt)
+	reply, err := conn.Do("SLOWLOG", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseSlowLogReply(node, reply)
+}
+
+func printSlowLogs(entries []slowLogEntry, withHeader bool) error {
+	if *output == "json" {
+		for _, e := range entries {
+			if err := printJSON(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rows := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, []string{time.Unix(e.Timestamp, 0).Format("2006-01-02 15:04:05"), e.Node, e.Namespace,
+			strconv.FormatInt(e.Cost, 10), strconv.FormatInt(e.ProposeCost, 10), strconv.FormatInt(e.ApplyCost, 10),
+			strings.Join(e.Args, " ")})
+	}
+	header := []string{"TIME", "NODE", "PARTITION", "COST(us)", "PROPOSE(us)", "APPLY(us)", "COMMAND"}
+	if !withHeader {
+		header = nil
+	}
+	return printRows(header, rows)
+}
+
+func runSlowLog(args []string) error {
+	fs := newCommandFlags("slowlog")
+	node := fs.String("node", "", "the redis address of the data node, all the data nodes if empty")
+	ns := fs.String("ns", "", "the namespace (or the namespace partition) of the slow logs")
+	cnt := fs.Int("n", 10, "the number of the slow logs from each node")
+	follow := fs.Bool("follow", false, "keep polling the new slow logs")
+	interval := fs.Duration("interval", time.Second*2, "the interval to poll the slow logs while following")
+	password := fs.String("password", "", "the redis password of the data nodes")
+	fs.Parse(args)
+
+	var addrs []string
+	if *node != "" {
+		addrs = append(addrs, *node)
+	} else {
+		nodes, err := getDataNodes()
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			addrs = append(addrs, n.redisAddr())
+		}
+	}
+	clients := make(map[string]*goredis.Client, len(addrs))
+	for _, addr := range addrs {
+		c := goredis.NewClient(addr, *password)
+		defer c.Close()
+		clients[addr] = c
+	}
+	// the id of the slow log is increased in each namespace partition
+	lastIDs := make(map[string]int64)
+	first := true
+	for {
+		var entries []slowLogEntry
+		for _, addr := range addrs {
+			nodeEntries, err := getSlowLogs(clients[addr], addr, *ns, *cnt)
+			if err != nil {
+				if !*follow {
+					return fmt.Errorf("get slow logs from %v failed: %v", addr, err)
+				}
+				continue
+			}
+			for _, e := range nodeEntries {
+				key := e.Node + "/" + e.Namespace
+				if last, ok := lastIDs[key]; ok && e.ID <= last {
+					continue
+				}
+				entries = append(entries, e)
+			}
+		}
+		for _, e := range entries {
+			key := e.Node + "/" + e.Namespace
+			if e.ID > lastIDs[key] {
+				lastIDs[key] = e.ID
+			}
+		}
+		// the oldest first while following
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Timestamp == entries[j].Timestamp {
+				return entries[i].Cost > entries[j].Cost
+			}
+			if *follow {
+				return entries[i].Timestamp < entries[j].Timestamp
+			}
+			return entries[i].Timestamp > entries[j].Timestamp
+		})
+		if err := printSlowLogs(entries, first); err != nil {
+			return err
+		}
+		if !*follow {
+			return nil
+		}
+		if len(entries) > 0 {
+			first = false
+		}
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDataNodes = []dataNode{
+	{ID: "127.0.0.2:6379:2", BroadcastAddress: "127.0.0.2", RedisPort: "6379", HTTPPort: "8080", Hostname: "n2", Version: "v1"},
+	{ID: "127.0.0.1:6379:1", BroadcastAddress: "127.0.0.1", RedisPort: "6379", HTTPPort: "8080", Hostname: "n1", Version: "v1"},
+}
+
+func newTestClusterServer(t *testing.T) (*http.ServeMux, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/datanodes", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, map[string]interface{}{"nodes": testDataNodes})
+	})
+	ts := newTestPDServer(t, mux)
+	restore := setTestPDAddrs(ts.Listener.Addr().String())
+	return mux, func() {
+		restore()
+		ts.Close()
+	}
+}
+
+func TestNamespaceCommands(t *testing.T) {
+	mux, stop := newTestClusterServer(t)
+	defer stop()
+	defer setTestOutput("table")()
+	mux.HandleFunc("/namespaces", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, map[string]interface{}{"namespaces": []string{"ns2", "ns1"}})
+	})
+	var created url.Values
+	mux.HandleFunc("/cluster/namespace/create", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		created = req.URL.Query()
+	})
+	var deleted url.Values
+	mux.HandleFunc("/cluster/namespace/delete", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "DELETE", req.Method)
+		deleted = req.URL.Query()
+	})
+
+	out, err := captureOutput(t, func() error { return runNamespaceList(nil) })
+	assert.Nil(t, err)
+	assert.Equal(t, "NAMESPACE\nns1\nns2\n", out)
+
+	_, err = captureOutput(t, func() error { return runNamespaceCreate([]string{"-ns", "test", "-partitions", "8"}) })
+	assert.NotNil(t, err)
+	assert.Nil(t, created)
+	out, err = captureOutput(t, func() error {
+		return runNamespaceCreate([]string{"-ns", "test", "-partitions", "8", "-replicas", "3", "-ttl_secs", "3600"})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "OK\n", out)
+	assert.Equal(t, "test", created.Get("namespace"))
+	assert.Equal(t, "8", created.Get("partition_num"))
+	assert.Equal(t, "3", created.Get("replicator"))
+	assert.Equal(t, "3600", created.Get("ttl_secs"))
+	assert.Equal(t, "", created.Get("engtype"))
+
+	// the delete should be confirmed
+	_, err = captureOutput(t, func() error { return runNamespaceDelete([]string{"-ns", "test"}) })
+	assert.NotNil(t, err)
+	assert.Nil(t, deleted)
+	_, err = captureOutput(t, func() error { return runNamespaceDelete([]string{"-ns", "test", "-yes"}) })
+	assert.Nil(t, err)
+	assert.Equal(t, "test", deleted.Get("namespace"))
+	assert.Equal(t, "**", deleted.Get("partition"))
+}
+
+func TestPartitionsAndNodes(t *testing.T) {
+	mux, stop := newTestClusterServer(t)
+	defer stop()
+	defer setTestOutput("table")()
+	mux.HandleFunc("/query/test", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, namespaceTopology{
+			PartitionNum: 11,
+			Partitions: map[string]partitionNodes{
+				"10": {Leader: testDataNodes[0], Replicas: testDataNodes},
+				"2":  {Replicas: testDataNodes[1:]},
+			},
+		})
+	})
+
+	out, err := captureOutput(t, func() error { return runPartitions([]string{"-ns", "test"}) })
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"PARTITION", "LEADER", "REPLICAS"}, strings.Fields(lines[0]))
+	// sorted by the partition id
+	assert.Equal(t, []string{"2", "-", "127.0.0.1:6379"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"10", "127.0.0.2:6379", "127.0.0.2:6379,127.0.0.1:6379"}, strings.Fields(lines[2]))
+
+	out, err = captureOutput(t, func() error { return runNodes(nil) })
+	assert.Nil(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 3, len(lines))
+	// sorted by the redis address
+	assert.True(t, strings.HasPrefix(lines[1], testDataNodes[1].ID))
+	assert.True(t, strings.HasPrefix(lines[2], testDataNodes[0].ID))
+
+	*output = "json"
+	out, err = captureOutput(t, func() error { return runNodes(nil) })
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(out, "\"broadcast_address\": \"127.0.0.1\""))
+}
+
+func TestLeaderTransfer(t *testing.T) {
+	mux, stop := newTestClusterServer(t)
+	defer stop()
+	defer setTestOutput("table")()
+	var params url.Values
+	mux.HandleFunc("/cluster/partition/leader/transfer", func(w http.ResponseWriter, req *http.Request) {
+		params = req.URL.Query()
+	})
+
+	_, err := captureOutput(t, func() error {
+		return runLeaderTransfer([]string{"-ns", "test", "-partition", "1", "-node", "127.0.0.3:6379"})
+	})
+	assert.Equal(t, errNodeNotFound, err)
+	assert.Nil(t, params)
+	// the node can be given by the redis address
+	_, err = captureOutput(t, func() error {
+		return runLeaderTransfer([]string{"-ns", "test", "-partition", "0", "-node", "127.0.0.1:6379"})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "test", params.Get("namespace"))
+	assert.Equal(t, "0", params.Get("partition"))
+	assert.Equal(t, testDataNodes[1].ID, params.Get("node"))
+	_, err = captureOutput(t, func() error {
+		return runLeaderTransfer([]string{"-ns", "test", "-partition", "1", "-node", testDataNodes[0].ID})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, testDataNodes[0].ID, params.Get("node"))
+}
+
+func TestBackupCommands(t *testing.T) {
+	mux, stop := newTestClusterServer(t)
+	defer stop()
+	defer setTestOutput("table")()
+	manifest := common.ClusterBackupManifest{
+		ClusterID: "test",
+		Namespaces: map[string]*common.NamespaceBackupManifest{
+			"ns2": {Partitions: []common.PartitionBackupInfo{{Partition: 0, Node: "n1", Term: 2, Index: 100}}},
+			"ns1": {Partitions: []common.PartitionBackupInfo{{Partition: 0, Error: "failed"}}},
+		},
+	}
+	var params url.Values
+	mux.HandleFunc("/cluster/backup", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		params = req.URL.Query()
+		writeTestJSON(w, manifest)
+	})
+	mux.HandleFunc("/cluster/backup/last", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, manifest)
+	})
+
+	out, err := captureOutput(t, func() error { return runBackup([]string{"-ns", "ns1,ns2", "-timeout_sec", "10"}) })
+	assert.Nil(t, err)
+	assert.Equal(t, "ns1,ns2", params.Get("namespace"))
+	assert.Equal(t, "10", params.Get("timeout_sec"))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"ns1", "0", "0", "0", "failed"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"ns2", "0", "n1", "2", "100"}, strings.Fields(lines[2]))
+
+	out2, err := captureOutput(t, func() error { return runBackupLast(nil) })
+	assert.Nil(t, err)
+	assert.Equal(t, out, out2)
+}
+
+func TestStatsCommand(t *testing.T) {
+	mux, stop := newTestClusterServer(t)
+	defer stop()
+	defer setTestOutput("table")()
+	mux.HandleFunc("/cluster/stats", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, map[string]interface{}{"stable": false, "under_replicated": 2})
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "false", req.URL.Query().Get("leader_only"))
+		var ss common.ServerStats
+		ss.NSStats = append(ss.NSStats, common.NamespaceStats{Name: "test-1"},
+			common.NamespaceStats{Name: "test-0", IsLeader: true})
+		writeTestJSON(w, map[string]interface{}{"stats": ss})
+	})
+
+	out, err := captureOutput(t, func() error { return runStats(nil) })
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, []string{"false", "2", "0"}, strings.Fields(lines[1]))
+
+	out, err = captureOutput(t, func() error { return runStats([]string{"-node", *pdAddrs}) })
+	assert.Nil(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"test-0", "true", "-", "-", "-", "false"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"test-1", "false", "-", "-", "-", "false"}, strings.Fields(lines[2]))
+}
+
+func TestParseSlowLogReply(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{int64(3), int64(1500000000), int64(12000),
+			[]interface{}{[]byte("set"), []byte("test:k"), []byte("v")},
+			[]byte("test-0"), int64(100), int64(200)},
+	}
+	entries, err := parseSlowLogReply("127.0.0.1:6379", reply)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	e := entries[0]
+	assert.Equal(t, "127.0.0.1:6379", e.Node)
+	assert.Equal(t, "test-0", e.Namespace)
+	assert.Equal(t, int64(3), e.ID)
+	assert.Equal(t, int64(1500000000), e.Timestamp)
+	assert.Equal(t, int64(12000), e.Cost)
+	assert.Equal(t, int64(100), e.ProposeCost)
+	assert.Equal(t, int64(200), e.ApplyCost)
+	assert.Equal(t, []string{"set", "test:k", "v"}, e.Args)
+
+	_, err = parseSlowLogReply("n1", []interface{}{[]interface{}{int64(1)}})
+	assert.NotNil(t, err)
+	_, err = parseSlowLogReply("n1", "invalid")
+	assert.NotNil(t, err)
+
+	defer setTestOutput("table")()
+	out, err := captureOutput(t, func() error { return printSlowLogs(entries, false) })
+	assert.Nil(t, err)
+	fields := strings.Fields(out)
+	assert.Equal(t, []string{"127.0.0.1:6379", "test-0", "12000", "100", "200", "set", "test:k", "v"}, fields[2:])
+	*output = "json"
+	out, err = captureOutput(t, func() error { return printSlowLogs(entries, true) })
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(out, "\"cost\": 12000"))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var (
+	flagSet = flag.NewFlagSet("zankv-ctl", flag.ExitOnError)
+
+	pdAddrs = flagSet.String("pd", "127.0.0.1:18001", "the comma separated placedriver http addresses")
+	output  = flagSet.String("o", "table", "the output format: table or json")
+	timeout = flagSet.Duration("timeout", time.Second*30, "the timeout of each http request")
+)
+
+var errNoPDLeader = errors.New("no placedriver leader found")
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"namespace list", "list all the namespaces", runNamespaceList},
+	{"namespace create", "create the namespace: -ns -partitions -replicas [-engtype -expiration_policy -ttl_secs]", runNamespaceCreate},
+	{"namespace delete", "delete all the partitions of the namespace: -ns -yes", runNamespaceDelete},
+	{"partitions", "list the partitions and the leaders of the namespace: -ns", runPartitions},
+	{"nodes", "list all the data nodes", runNodes},
+	{"leader transfer", "transfer the partition leader to the replica node: -ns -partition -node (ip:redis_port or node id)", runLeaderTransfer},
+	{"backup", "backup the namespaces (or all the namespaces) of the cluster: [-ns -timeout_sec]", runBackup},
+	{"backup last", "show the last cluster backup", runBackupLast},
+	{"stats", "show the cluster stats, or the stats of the data node with -node (ip:http_port)", runStats},
+	{"slowlog", "show the slow logs of the data nodes: [-node ip:redis_port -ns -n -follow -interval -password]", runSlowLog},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: zankv-ctl [flags] <command> [command flags]\n\nFlags:\n")
+	flagSet.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.usage)
+	}
+	w.Flush()
+}
+
+// find the command matched the longest prefix of the args
+func findCommand(args []string) (*command, []string) {
+	var found *command
+	var foundArgs []string
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") != commands[i].name {
+			continue
+		}
+		if found == nil || len(words) > len(strings.Fields(found.name)) {
+			found = &commands[i]
+			foundArgs = args[len(words):]
+		}
+	}
+	return found, foundArgs
+}
+
+func main() {
+	flagSet.Usage = usage
+	flagSet.Parse(os.Args[1:])
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %v\n", *output)
+		os.Exit(2)
+	}
+	cmd, args := findCommand(flagSet.Args())
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v failed: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func getPDAddrs() []string {
+	var addrs []string
+	for _, addr := range strings.Split(*pdAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func apiRequest(method string, addr string, path string, params url.Values, ret interface{}) error {
+	endpoint := "http://" + addr + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	_, err := common.APIRequest(method, endpoint, nil, *timeout, ret)
+	return err
+}
+
+// request any of the placedriver for the query api
+func pdRequest(method string, path string, params url.Values, ret interface{}) error {
+	addrs := getPDAddrs()
+	if len(addrs) == 0 {
+		return errNoPDLeader
+	}
+	var err error
+	start := rand.Intn(len(addrs))
+	for i := range addrs {
+		addr := addrs[(start+i)%len(addrs)]
+		err = apiRequest(method, addr, path, params, ret)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type pdNode struct {
+	NodeIP   string
+	HttpPort string
+}
+
+// request the placedriver leader for the cluster admin api
+func pdLeaderRequest(method string, path string, params url.Values, ret interface{}) error {
+	var rsp struct {
+		PDLeader pdNode `json:"pdleader"`
+	}
+	if err := pdRequest("GET", "/listpd", nil, &rsp); err != nil {
+		return err
+	}
+	if rsp.PDLeader.NodeIP == "" {
+		return errNoPDLeader
+	}
+	leader := rsp.PDLeader.NodeIP + ":" + rsp.PDLeader.HttpPort
+	return apiRequest(method, leader, path, params, ret)
+}
+
+func printJSON(v interface{}) error {
+	d, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(d))
+	return nil
+}
+
+// printResult print the json of the result, or the table rows built from the result
+func printResult(v interface{}, header []string, rows func() [][]string) error {
+	if *output == "json" {
+		return printJSON(v)
+	}
+	return printRows(header, rows())
+}
+
+// printRows print the table, the header will be ignored if nil
+func printRows(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func printOK() error {
+	if *output == "json" {
+		return printJSON(map[string]string{"result": "OK"})
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func newCommandFlags(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+// the required string flag is empty and the required int flag is -1 by default
+func checkRequired(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || f.Value.String() == "" || f.Value.String() == "-1" {
+			return fmt.Errorf("missing the argument -%v", name)
+		}
+	}
+	return nil
+}
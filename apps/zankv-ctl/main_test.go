@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureOutput return the stdout of the function and the error returned
+func captureOutput(t *testing.T, f func() error) (string, error) {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	old := os.Stdout
+	os.Stdout = w
+	outC := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		outC <- buf.String()
+	}()
+	err = f()
+	os.Stdout = old
+	w.Close()
+	return <-outC, err
+}
+
+func setTestOutput(format string) func() {
+	old := *output
+	*output = format
+	return func() {
+		*output = old
+	}
+}
+
+func setTestPDAddrs(addrs string) func() {
+	old := *pdAddrs
+	*pdAddrs = addrs
+	return func() {
+		*pdAddrs = old
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, v interface{}) {
+	d, _ := json.Marshal(v)
+	w.Write(d)
+}
+
+// newTestPDServer start the placedriver which is also the leader
+func newTestPDServer(t *testing.T, mux *http.ServeMux) *httptest.Server {
+	ts := httptest.NewServer(mux)
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	mux.HandleFunc("/listpd", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, map[string]interface{}{
+			"pdleader": pdNode{NodeIP: host, HttpPort: port},
+		})
+	})
+	return ts
+}
+
+func TestFindCommand(t *testing.T) {
+	cmd, args := findCommand([]string{"backup", "-ns", "test"})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "backup", cmd.name)
+	assert.Equal(t, []string{"-ns", "test"}, args)
+
+	// the longest prefix should be matched
+	cmd, args = findCommand([]string{"backup", "last"})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "backup last", cmd.name)
+	assert.Equal(t, 0, len(args))
+
+	cmd, _ = findCommand([]string{"namespace"})
+	assert.Nil(t, cmd)
+	cmd, _ = findCommand([]string{"namespace", "unknown"})
+	assert.Nil(t, cmd)
+	cmd, _ = findCommand(nil)
+	assert.Nil(t, cmd)
+}
+
+func TestCheckRequired(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("ns", "", "")
+	fs.Int("partition", -1, "")
+	assert.NotNil(t, checkRequired(fs, "ns"))
+	assert.NotNil(t, checkRequired(fs, "unknown"))
+	assert.Nil(t, fs.Parse([]string{"-ns", "test", "-partition", "0"}))
+	assert.Nil(t, checkRequired(fs, "ns", "partition"))
+}
+
+func TestPDLeaderRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cluster/stats", func(w http.ResponseWriter, req *http.Request) {
+		writeTestJSON(w, map[string]bool{"stable": true})
+	})
+	ts := newTestPDServer(t, mux)
+	defer ts.Close()
+	// the unavailable placedriver should be skipped
+	down := httptest.NewServer(http.NotFoundHandler())
+	downAddr := down.Listener.Addr().String()
+	down.Close()
+	defer setTestPDAddrs(downAddr + ", " + ts.Listener.Addr().String() + ",")()
+	assert.Equal(t, 2, len(getPDAddrs()))
+
+	for i := 0; i < 5; i++ {
+		var rsp struct {
+			Stable bool `json:"stable"`
+		}
+		assert.Nil(t, pdLeaderRequest("GET", "/cluster/stats", nil, &rsp))
+		assert.True(t, rsp.Stable)
+	}
+
+	noLeader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer noLeader.Close()
+	defer setTestPDAddrs(noLeader.Listener.Addr().String())()
+	assert.Equal(t, errNoPDLeader, pdLeaderRequest("GET", "/cluster/stats", nil, nil))
+	defer setTestPDAddrs("")()
+	assert.Equal(t, errNoPDLeader, pdRequest("GET", "/namespaces", nil, nil))
+}
+
+func TestPrintResult(t *testing.T) {
+	v := map[string]string{"name": "test"}
+	rows := func() [][]string {
+		return [][]string{{"test", "1"}, {"test2", "10"}}
+	}
+	defer setTestOutput("table")()
+	out, err := captureOutput(t, func() error {
+		return printResult(v, []string{"NAME", "NUM"}, rows)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "NAME   NUM\ntest   1\ntest2  10\n", out)
+	out, err = captureOutput(t, printOK)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK\n", out)
+
+	*output = "json"
+	out, err = captureOutput(t, func() error {
+		return printResult(v, []string{"NAME", "NUM"}, rows)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"name\": \"test\"\n}\n", out)
+	out, err = captureOutput(t, printOK)
+	assert.Nil(t, err)
+	var ret map[string]string
+	assert.Nil(t, json.Unmarshal([]byte(out), &ret))
+	assert.Equal(t, "OK", ret["result"])
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,6 +23,8 @@ var (
 	flagSet        = flag.NewFlagSet("zanredisdb", flag.ExitOnError)
 	configFilePath = flagSet.String("config", "", "the config file path to read")
 	showVersion    = flagSet.Bool("version", false, "print version string and exit")
+	raftRepair     = flagSet.Bool("raft_repair", false, "replay the raft logs in repair mode and report the bad entries")
+	raftRepairSkip = flagSet.String("raft_repair_skip", "", "the acknowledged bad entries to skip in repair mode, separated by comma")
 )
 
 type program struct {
@@ -72,6 +75,13 @@ func (p *program) Start() error {
 	}
 
 	serverConf := configFile.ServerConf
+	if *raftRepair {
+		serverConf.RaftRepairMode = true
+	}
+	if *raftRepairSkip != "" {
+		serverConf.RaftRepairSkipEntries = append(serverConf.RaftRepairSkipEntries,
+			strings.Split(*raftRepairSkip, ",")...)
+	}
 
 	loadConf, _ := json.MarshalIndent(configFile, "", " ")
 	fmt.Printf("loading with conf:%v\n", string(loadConf))
@@ -0,0 +1,319 @@
+// Package client is the smart client for ZanRedisDB. The partition topology of the namespace
+// is discovered from the placedriver and watched for changes, so the command on the key can be
+// sent to the right node directly.
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/siddontang/goredis"
+)
+
+var cLog = common.NewLevelLogger(common.LOG_INFO, common.NewDefaultLogger("client"))
+
+func SetLogger(level int32, logger common.Logger) {
+	cLog.SetLevel(level)
+	cLog.Logger = logger
+}
+
+const (
+	defaultWatchTimeout   = time.Second * 30
+	defaultMaxRetry       = 3
+	defaultMaxIdleConns   = 8
+	queryTimeout          = time.Second * 5
+	minRefreshInterval    = time.Millisecond * 200
+	retryBackoffBase      = time.Millisecond * 50
+	watchFailedRetryDelay = time.Second
+)
+
+// the prefix of the errors returned by the data node while the partition leader changed
+const errClusterChangedPrefix = "ERR_CLUSTER_CHANGED"
+
+var ErrClientClosed = errors.New("client is closed")
+
+// Consistency is the consistency level of the command
+type Consistency int
+
+const (
+	// ConsistencyLeader send the command to the leader of the partition
+	ConsistencyLeader Consistency = iota
+	// ConsistencyStale send the read command to any replica of the partition, the replica in
+	// the same dc is preferred. The command is sent to the leader if the replica refused
+	// the stale read.
+	ConsistencyStale
+)
+
+type Config struct {
+	// the placedriver http addresses
+	PDAddrs   []string
+	Namespace string
+	Password  string
+	// the max time waiting the topology change in a watch request to placedriver
+	WatchTimeout time.Duration
+	// the max retry times while the partition leader changed or the node failed
+	MaxRetry           int
+	MaxIdleConns       int
+	DefaultConsistency Consistency
+	// the dc of the client, the replica in the same dc is preferred for the stale read
+	DC string
+
+	// send the command only once even if the leader changed or the node failed, the failed
+	// write may or may not be applied. It is used to record the exact history for the check.
+	DisableRetry bool
+}
+
+type Client struct {
+	conf Config
+
+	topoMutex   sync.RWMutex
+	topo        *topology
+	lastRefresh time.Time
+	// the index of the placedriver queried last time
+	pdIndex int
+
+	poolMutex sync.Mutex
+	pools     map[string]*goredis.Client
+
+	stopC    chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewClient query the topology of the namespace from the placedriver and watch the changes
+// in background.
+func NewClient(conf Config) (*Client, error) {
+	if len(conf.PDAddrs) == 0 {
+		return nil, ErrNoPDAvailable
+	}
+	if conf.Namespace == "" {
+		return nil, common.ErrInvalidArgs
+	}
+	if conf.WatchTimeout <= 0 {
+		conf.WatchTimeout = defaultWatchTimeout
+	}
+	if conf.MaxRetry <= 0 {
+		conf.MaxRetry = defaultMaxRetry
+	}
+	if conf.MaxIdleConns <= 0 {
+		conf.MaxIdleConns = defaultMaxIdleConns
+	}
+	c := &Client{
+		conf:    conf,
+		pdIndex: rand.Intn(len(conf.PDAddrs)),
+		pools:   make(map[string]*goredis.Client),
+		stopC:   make(chan struct{}),
+	}
+	if err := c.refreshTopology(); err != nil {
+		return nil, err
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchTopology()
+	}()
+	return c, nil
+}
+
+// Close stop watching the topology and close all the connections
+func (c *Client) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stopC)
+	})
+	c.wg.Wait()
+	c.poolMutex.Lock()
+	for addr, p := range c.pools {
+		p.Close()
+		delete(c.pools, addr)
+	}
+	c.poolMutex.Unlock()
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.stopC:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) getTopology() *topology {
+	c.topoMutex.RLock()
+	defer c.topoMutex.RUnlock()
+	return c.topo
+}
+
+func (c *Client) setTopology(t *topology) {
+	c.topoMutex.Lock()
+	defer c.topoMutex.Unlock()
+	if c.topo != nil && c.topo.epoch != t.epoch {
+		cLog.Infof("namespace %v topology changed from epoch %v to %v", c.conf.Namespace, c.topo.epoch, t.epoch)
+	}
+	c.topo = t
+	c.lastRefresh = time.Now()
+}
+
+// query the topology from the placedriver one by one until success
+func (c *Client) queryTopology(epoch int64, wait time.Duration) (*topology, error) {
+	var lastErr error
+	for i := 0; i < len(c.conf.PDAddrs); i++ {
+		c.topoMutex.Lock()
+		pd := c.conf.PDAddrs[c.pdIndex%len(c.conf.PDAddrs)]
+		c.topoMutex.Unlock()
+		t, err := queryTopology(pd, c.conf.Namespace, epoch, wait, c.conf.DC)
+		if err == nil {
+			return t, nil
+		}
+		cLog.Infof("query namespace %v topology from %v failed: %v", c.conf.Namespace, pd, err)
+		lastErr = err
+		c.topoMutex.Lock()
+		c.pdIndex++
+		c.topoMutex.Unlock()
+	}
+	return nil, lastErr
+}
+
+func (c *Client) refreshTopology() error {
+	t, err := c.queryTopology(-1, 0)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.partitionNum <= 0 {
+		return ErrTopologyNotReady
+	}
+	c.setTopology(t)
+	return nil
+}
+
+// refresh the topology after the leader changed, the refresh is limited to avoid
+// too much queries to the placedriver while many commands failed at the same time.
+func (c *Client) tryRefreshTopology() {
+	c.topoMutex.RLock()
+	last := c.lastRefresh
+	c.topoMutex.RUnlock()
+	if time.Since(last) < minRefreshInterval {
+		return
+	}
+	if err := c.refreshTopology(); err != nil {
+		cLog.Infof("refresh namespace %v topology failed: %v", c.conf.Namespace, err)
+	}
+}
+
+func (c *Client) watchTopology() {
+	for {
+		if c.isClosed() {
+			return
+		}
+		epoch := int64(-1)
+		if t := c.getTopology(); t != nil {
+			epoch = t.epoch
+		}
+		t, err := c.queryTopology(epoch, c.conf.WatchTimeout)
+		if err != nil {
+			select {
+			case <-c.stopC:
+				return
+			case <-time.After(watchFailedRetryDelay):
+			}
+			continue
+		}
+		if t != nil && t.partitionNum > 0 {
+			c.setTopology(t)
+		}
+	}
+}
+
+func (c *Client) getConn(addr string) (*goredis.PoolConn, error) {
+	c.poolMutex.Lock()
+	p, ok := c.pools[addr]
+	if !ok {
+		p = goredis.NewClient(addr, c.conf.Password)
+		p.SetMaxIdleConns(c.conf.MaxIdleConns)
+		c.pools[addr] = p
+	}
+	c.poolMutex.Unlock()
+	return p.Get()
+}
+
+// the command should be retried on other node or after the topology refreshed
+func isRetryError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if rerr, ok := err.(goredis.Error); ok {
+		return strings.HasPrefix(string(rerr), errClusterChangedPrefix)
+	}
+	// the network error
+	return true
+}
+
+// Do send the command on the key in the table with the default consistency, the key will be
+// prefixed with the namespace and table.
+func (c *Client) Do(cmd string, table string, key string, args ...interface{}) (interface{}, error) {
+	return c.DoWithConsistency(c.conf.DefaultConsistency, cmd, table, key, args...)
+}
+
+// DoWithConsistency send the command with the consistency level. The command will be retried
+// after the topology refreshed if the partition leader changed.
+func (c *Client) DoWithConsistency(level Consistency, cmd string, table string, key string,
+	args ...interface{}) (interface{}, error) {
+	fullKey := c.conf.Namespace + ":" + table + ":" + key
+	cmdArgs := make([]interface{}, 0, len(args)+1)
+	cmdArgs = append(cmdArgs, fullKey)
+	cmdArgs = append(cmdArgs, args...)
+
+	maxRetry := c.conf.MaxRetry
+	if c.conf.DisableRetry {
+		maxRetry = 0
+	}
+	var lastErr error
+	for retry := 0; retry <= maxRetry; retry++ {
+		if c.isClosed() {
+			return nil, ErrClientClosed
+		}
+		if retry > 0 {
+			time.Sleep(retryBackoffBase * time.Duration(retry))
+			c.tryRefreshTopology()
+		}
+		t := c.getTopology()
+		if t == nil {
+			lastErr = ErrTopologyNotReady
+			continue
+		}
+		pid := GetPartitionID(table, []byte(key), t.partitionNum)
+		addr, err := t.pickNode(pid, level)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rsp, err := c.doOnNode(addr, cmd, cmdArgs)
+		if !isRetryError(err) {
+			return rsp, err
+		}
+		cLog.Debugf("command %v on %v failed: %v, retry: %v", cmd, addr, err, retry)
+		lastErr = err
+		if c.conf.DisableRetry {
+			// refresh for the next command since no retry for this one
+			c.tryRefreshTopology()
+		}
+		// the replica refused the stale read, read from leader instead
+		if level == ConsistencyStale {
+			level = ConsistencyLeader
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) doOnNode(addr string, cmd string, args []interface{}) (interface{}, error) {
+	conn, err := c.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siddontang/goredis"
+	"github.com/spaolacci/murmur3"
+)
+
+func newFakePD(epoch int64, rsp *pdQueryResponse) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/query/test_ns" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.URL.Query().Get("epoch") == strconv.FormatInt(epoch, 10) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		d, _ := json.Marshal(rsp)
+		w.Write(d)
+	}))
+}
+
+func TestQueryTopology(t *testing.T) {
+	rsp := &pdQueryResponse{
+		Epoch:        10,
+		PartitionNum: 2,
+		Partitions: map[string]pdPartitionNodes{
+			"0": {
+				Leader: pdNodeInfo{BroadcastAddress: "127.0.0.1", RedisPort: "1234", DCInfo: "dc1"},
+				Replicas: []pdNodeInfo{
+					{BroadcastAddress: "127.0.0.1", RedisPort: "1234", DCInfo: "dc1"},
+					{BroadcastAddress: "127.0.0.2", RedisPort: "1234", DCInfo: "dc2"},
+				},
+			},
+			"1": {
+				Replicas: []pdNodeInfo{
+					{BroadcastAddress: "127.0.0.3", RedisPort: "1234", DCInfo: "dc1"},
+				},
+			},
+		},
+	}
+	s := newFakePD(rsp.Epoch, rsp)
+	defer s.Close()
+	pdAddr := strings.TrimPrefix(s.URL, "http://")
+
+	topo, err := queryTopology(pdAddr, "test_ns", -1, 0, "dc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topo.epoch != 10 || topo.partitionNum != 2 || len(topo.partitions) != 2 {
+		t.Fatalf("unexpected topology: %v", topo)
+	}
+	addr, err := topo.pickNode(0, ConsistencyLeader)
+	if err != nil || addr != "127.0.0.1:1234" {
+		t.Fatalf("unexpected leader: %v, %v", addr, err)
+	}
+	addr, err = topo.pickNode(0, ConsistencyStale)
+	if err != nil || addr != "127.0.0.2:1234" {
+		t.Fatalf("the replica in the same dc should be preferred: %v, %v", addr, err)
+	}
+	if _, err = topo.pickNode(1, ConsistencyLeader); err != ErrPartitionNoLeader {
+		t.Fatalf("should fail without leader: %v", err)
+	}
+	addr, err = topo.pickNode(1, ConsistencyStale)
+	if err != nil || addr != "127.0.0.3:1234" {
+		t.Fatalf("unexpected replica: %v, %v", addr, err)
+	}
+	if _, err = topo.pickNode(2, ConsistencyLeader); err != ErrTopologyNotReady {
+		t.Fatalf("should fail on unknown partition: %v", err)
+	}
+
+	// the unchanged topology should return nil after the wait
+	topo, err = queryTopology(pdAddr, "test_ns", rsp.Epoch, time.Millisecond*10, "")
+	if err != nil || topo != nil {
+		t.Fatalf("should be unchanged: %v, %v", topo, err)
+	}
+	if _, err = queryTopology(pdAddr, "not_exist", -1, 0, ""); err == nil {
+		t.Fatal("should fail on the unknown namespace")
+	}
+}
+
+func TestGetPartitionID(t *testing.T) {
+	pnum := 8
+	for _, key := range []string{"a", "key1", "key2", "somelongkeyname"} {
+		pid := GetPartitionID("table", []byte(key), pnum)
+		// should be the same as the hash of the data node
+		expected := int(murmur3.Sum32([]byte("table:"+key))) % pnum
+		if pid != expected {
+			t.Errorf("key %v partition mismatch: %v, %v", key, pid, expected)
+		}
+		if pid < 0 || pid >= pnum {
+			t.Errorf("key %v partition out of range: %v", key, pid)
+		}
+	}
+}
+
+func TestIsRetryError(t *testing.T) {
+	if isRetryError(nil) {
+		t.Error("nil should not retry")
+	}
+	if !isRetryError(goredis.Error("ERR_CLUSTER_CHANGED: partition of the namespace is not leader on the node")) {
+		t.Error("cluster changed should retry")
+	}
+	if isRetryError(goredis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")) {
+		t.Error("the command error should not retry")
+	}
+	if !isRetryError(io.EOF) {
+		t.Error("the network error should retry")
+	}
+}
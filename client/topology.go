@@ -0,0 +1,143 @@
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/spaolacci/murmur3"
+)
+
+var (
+	ErrNoPDAvailable      = errors.New("no placedriver available")
+	ErrTopologyNotReady   = errors.New("the partition topology of the namespace is not ready")
+	ErrPartitionNoLeader  = errors.New("the partition has no leader")
+	ErrPartitionNoReplica = errors.New("the partition has no replica")
+)
+
+type pdNodeInfo struct {
+	BroadcastAddress string `json:"broadcast_address"`
+	RedisPort        string `json:"redis_port"`
+	DCInfo           string `json:"dc_info"`
+}
+
+type pdPartitionNodes struct {
+	Leader   pdNodeInfo   `json:"leader"`
+	Replicas []pdNodeInfo `json:"replicas"`
+}
+
+type pdQueryResponse struct {
+	Epoch        int64                       `json:"epoch"`
+	PartitionNum int                         `json:"partition_num"`
+	Partitions   map[string]pdPartitionNodes `json:"partitions"`
+}
+
+func (n pdNodeInfo) redisAddr() string {
+	if n.BroadcastAddress == "" {
+		return ""
+	}
+	return net.JoinHostPort(n.BroadcastAddress, n.RedisPort)
+}
+
+type partitionNodes struct {
+	leader   string
+	replicas []string
+	// the replicas in the same dc with the client
+	localReplicas []string
+}
+
+// the partitions of the namespace and the redis address of the replicas
+type topology struct {
+	epoch        int64
+	partitionNum int
+	partitions   map[int]partitionNodes
+}
+
+func newTopology(rsp *pdQueryResponse, dc string) *topology {
+	t := &topology{
+		epoch:        rsp.Epoch,
+		partitionNum: rsp.PartitionNum,
+		partitions:   make(map[int]partitionNodes, len(rsp.Partitions)),
+	}
+	for pidStr, pn := range rsp.Partitions {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+		nodes := partitionNodes{leader: pn.Leader.redisAddr()}
+		for _, r := range pn.Replicas {
+			addr := r.redisAddr()
+			if addr == "" {
+				continue
+			}
+			nodes.replicas = append(nodes.replicas, addr)
+			if dc != "" && r.DCInfo == dc {
+				nodes.localReplicas = append(nodes.localReplicas, addr)
+			}
+		}
+		t.partitions[pid] = nodes
+	}
+	return t
+}
+
+// GetPartitionID return the partition of the key in the table, it should be the same
+// as the data node (node.GetHashedPartitionID).
+func GetPartitionID(table string, key []byte, partitionNum int) int {
+	pk := make([]byte, 0, len(table)+1+len(key))
+	pk = append(pk, table...)
+	pk = append(pk, common.NamespaceTableSeperator)
+	pk = append(pk, key...)
+	return int(murmur3.Sum32(pk)) % partitionNum
+}
+
+// pickNode return the redis address to handle the command on the partition, the leader
+// is returned for the strong consistency, and the replica in the same dc is preferred
+// for the stale read.
+func (t *topology) pickNode(pid int, level Consistency) (string, error) {
+	nodes, ok := t.partitions[pid]
+	if !ok {
+		return "", ErrTopologyNotReady
+	}
+	if level != ConsistencyStale {
+		if nodes.leader == "" {
+			return "", ErrPartitionNoLeader
+		}
+		return nodes.leader, nil
+	}
+	if len(nodes.localReplicas) > 0 {
+		return nodes.localReplicas[rand.Intn(len(nodes.localReplicas))], nil
+	}
+	if len(nodes.replicas) > 0 {
+		return nodes.replicas[rand.Intn(len(nodes.replicas))], nil
+	}
+	if nodes.leader != "" {
+		return nodes.leader, nil
+	}
+	return "", ErrPartitionNoReplica
+}
+
+// queryTopology query the topology of the namespace from the placedriver, nil is returned if
+// the topology is not changed since the epoch. The query will wait the change for at most
+// the wait time (long polling) if the epoch is not negative.
+func queryTopology(pdAddr string, ns string, epoch int64, wait time.Duration, dc string) (*topology, error) {
+	params := url.Values{}
+	if epoch >= 0 {
+		params.Set("epoch", strconv.FormatInt(epoch, 10))
+		params.Set("wait_ms", strconv.FormatInt(int64(wait/time.Millisecond), 10))
+	}
+	endpoint := "http://" + pdAddr + "/query/" + url.PathEscape(ns) + "?" + params.Encode()
+	var rsp pdQueryResponse
+	code, err := common.APIRequest("GET", endpoint, nil, wait+queryTimeout, &rsp)
+	if code == http.StatusNotModified {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTopology(&rsp, dc), nil
+}
@@ -252,4 +252,17 @@ type Options struct {
 	BalanceStart          int
 	BalanceEnd            int
 	DataDir               string
+	// balance by the data size and write qps of the partitions instead of the partition count
+	BalanceByLoad bool
+
+	// the failover policy, see the pd coordinator for the detail, 0 means the default
+	NodeDownThresholdSecs   int64
+	MigrateGraceSecs        int64
+	EmergencyGraceSecs      int64
+	MaxRecoveries           int
+	FailoverConfirmMaxNodes int
+	// the expired namespace will be deleted after the grace period (0 means the default),
+	// and the hook url will be notified while expired and deleted
+	NamespaceExpireGraceSecs int64
+	NamespaceExpireHook      string
 }
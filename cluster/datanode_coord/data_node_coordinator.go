@@ -157,6 +157,8 @@ func (dc *DataCoordinator) Start() error {
 	}
 	dc.wg.Add(1)
 	go dc.watchPD()
+	dc.wg.Add(1)
+	go dc.watchDynamicConf()
 
 	if dc.learnerRole == "" {
 		err := dc.loadLocalNamespaceData()
@@ -168,7 +170,9 @@ func (dc *DataCoordinator) Start() error {
 
 		dc.wg.Add(1)
 		go dc.checkForUnsyncedNamespaces()
-	} else if dc.learnerRole == common.LearnerRoleLogSyncer {
+	} else if dc.learnerRole == common.LearnerRoleLogSyncer ||
+		dc.learnerRole == common.LearnerRoleKafkaSink ||
+		dc.learnerRole == common.LearnerRoleReadReplica {
 		dc.loadLocalNamespaceForLearners()
 		dc.wg.Add(1)
 		go dc.checkForUnsyncedLogSyncers()
@@ -215,6 +219,27 @@ func (dc *DataCoordinator) watchPD() {
 	}
 }
 
+// apply the cluster dynamic config changed by pd to this node
+func (dc *DataCoordinator) watchDynamicConf() {
+	defer dc.wg.Done()
+	if dc.register == nil {
+		return
+	}
+	confChan := make(chan map[string]string, 1)
+	go dc.register.WatchClusterDynamicConf(confChan, dc.stopChan)
+	for {
+		select {
+		case conf := <-confChan:
+			cluster.CoordLog().Infof("cluster dynamic config: %v", conf)
+			for key, err := range common.ApplyDynamicConf(conf) {
+				cluster.CoordLog().Warningf("failed to apply the dynamic config %v: %v", key, err)
+			}
+		case <-dc.stopChan:
+			return
+		}
+	}
+}
+
 func (dc *DataCoordinator) checkLocalNamespaceMagicCode(nsInfo *cluster.PartitionMetaInfo, tryFix bool) error {
 	if nsInfo.MagicCode <= 0 {
 		return nil
@@ -505,6 +530,11 @@ func (dc *DataCoordinator) transferMyNamespaceLeader(nsInfo *cluster.PartitionMe
 		if !dc.isReplicaReadyForRaft(nsNode, toRaftID, nid, checkAll) {
 			return false
 		}
+		// the replica is draining, we should not transfer the leader to it
+		// since it will hand off the leader immediately.
+		if !dc.isReplicaElectable(nsInfo.GetDesp(), nid) {
+			return false
+		}
 	}
 	cluster.CoordLog().Infof("begin transfer namespace %v leader to %v", nsInfo.GetDesp(), nid)
 	err := nsNode.TransferMyLeader(cluster.ExtractRegIDFromGenID(nid), toRaftID)
@@ -539,6 +569,33 @@ func (dc *DataCoordinator) isReplicaReadyForRaft(nsNode *node.NamespaceNode, toR
 	return false
 }
 
+func (dc *DataCoordinator) isReplicaElectable(fullName string, nodeID string) bool {
+	if nodeID == dc.GetMyID() {
+		nsNode := dc.localNSMgr.GetNamespaceNode(fullName)
+		return nsNode != nil && nsNode.Node.GetElectionPriority() != node.ElectionPriorityNever
+	}
+	nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nodeID)
+	var rsp struct {
+		Priority int32 `json:"priority"`
+	}
+	code, err := common.APIRequest("GET",
+		"http://"+net.JoinHostPort(nip, httpPort)+common.APIElectionPriority+"/"+fullName,
+		nil, time.Second, &rsp)
+	if err != nil {
+		// the old version node without the election priority is always electable
+		if code == http.StatusNotFound {
+			return true
+		}
+		cluster.CoordLog().Infof("failed to get election priority from %v: %v, %v", nip, code, err.Error())
+		return false
+	}
+	if rsp.Priority == node.ElectionPriorityNever {
+		cluster.CoordLog().Infof("namespace %v replica %v is not allowed to be leader", fullName, nodeID)
+		return false
+	}
+	return true
+}
+
 type pendingRemoveInfo struct {
 	ts time.Time
 	m  common.MemberInfo
@@ -634,7 +691,7 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 				}
 				continue
 			}
-			if len(parts) == 0 || len(parts) != parts[0].PartitionNum {
+			if len(parts) == 0 || len(parts) != parts[0].AllPartitionNum() {
 				continue
 			}
 			for table, schemaData := range schemas {
@@ -648,6 +705,13 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 			}
 			allIndexSchemas[ns] = tableSchemas
 		}
+		for ns, parts := range allNamespaces {
+			for _, p := range parts {
+				dc.localNSMgr.SetNamespaceExpansion(ns, p.PartitionNum, p.ExpandPartitionNum, p.ExpandState)
+				dc.localNSMgr.SetNamespaceAlias(ns, p.AliasName)
+				break
+			}
+		}
 		for name, localNamespace := range tmpChecks {
 			namespace, pid := common.GetNamespaceAndPartition(name)
 			if namespace == "" {
@@ -659,9 +723,12 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 				cluster.CoordLog().Infof("got namespace %v meta failed: %v", name, err)
 				if err == cluster.ErrKeyNotFound {
 					cluster.CoordLog().Infof("the namespace should be clean since not found in register: %v", name)
-					_, err = dc.register.GetNamespaceMetaInfo(namespace)
+					meta, err := dc.register.GetNamespaceMetaInfo(namespace)
 					if err == cluster.ErrKeyNotFound {
 						dc.forceRemoveLocalNamespace(localNamespace)
+					} else if err == nil && pid >= meta.AllPartitionNum() {
+						// the partition is removed after merged into the other partition
+						dc.forceRemoveLocalNamespace(localNamespace)
 					}
 				} else {
 					dc.tryCheckNamespacesIn(time.Second * 5)
@@ -672,6 +739,9 @@ func (dc *DataCoordinator) checkForUnsyncedNamespaces() {
 			}
 
 			localRID := localNamespace.GetRaftID()
+			localNamespace.SetQuota(namespaceMeta.QuotaMaxKeys, namespaceMeta.QuotaMaxBytes)
+			localNamespace.SetLogRetention(namespaceMeta.LogRetentionBytes, namespaceMeta.LogRetentionSecs)
+			localNamespace.SetFrozen(namespaceMeta.Frozen)
 			if dc.isNamespaceShouldStop(*namespaceMeta, localNamespace) {
 				dc.forceRemoveLocalNamespace(localNamespace)
 				continue
@@ -897,6 +967,12 @@ func (dc *DataCoordinator) prepareNamespaceConf(nsInfo *cluster.PartitionMetaInf
 	if nsInfo.ExpirationPolicy != "" {
 		nsConf.ExpirationPolicy = nsInfo.ExpirationPolicy
 	}
+	nsConf.RocksDBOpts = nsInfo.RocksDBOpts
+	nsConf.QuotaMaxKeys = nsInfo.QuotaMaxKeys
+	nsConf.QuotaMaxBytes = nsInfo.QuotaMaxBytes
+	nsConf.LogRetentionBytes = nsInfo.LogRetentionBytes
+	nsConf.LogRetentionSecs = nsInfo.LogRetentionSecs
+	nsConf.Frozen = nsInfo.Frozen
 	if nsInfo.SnapCount > 100 {
 		nsConf.SnapCount = nsInfo.SnapCount
 		nsConf.SnapCatchup = nsInfo.SnapCount / 4
@@ -1215,6 +1291,42 @@ func (dc *DataCoordinator) GetSnapshotSyncInfo(fullNamespace string) ([]common.S
 	return ssiList, nil
 }
 
+// GetNamespaceLeaderRedisAddrs return the redis address of the leader for each partition
+// of the namespace, the address will be empty if the leader is this node.
+// The nil map will be returned if no register which means all partitions are local.
+func (dc *DataCoordinator) GetNamespaceLeaderRedisAddrs(namespace string) (map[int]string, error) {
+	if namespace == "" {
+		return nil, ErrNamespaceInvalid
+	}
+	if dc.register == nil {
+		return nil, nil
+	}
+	parts, err := dc.register.GetNamespaceInfo(namespace)
+	if err != nil {
+		if err == cluster.ErrKeyNotFound {
+			return nil, ErrNamespaceNotFound
+		}
+		return nil, err
+	}
+	addrs := make(map[int]string, len(parts))
+	for _, p := range parts {
+		leader := p.GetRealLeader()
+		if leader == "" {
+			return nil, node.ErrNodeNoLeader
+		}
+		if leader == dc.GetMyID() {
+			addrs[p.Partition] = ""
+			continue
+		}
+		node, err := dc.register.GetNodeInfo(leader)
+		if err != nil {
+			return nil, err
+		}
+		addrs[p.Partition] = net.JoinHostPort(node.NodeIP, node.RedisPort)
+	}
+	return addrs, nil
+}
+
 func (dc *DataCoordinator) IsRemovingMember(m common.MemberInfo) (bool, error) {
 	namespace, pid := common.GetNamespaceAndPartition(m.GroupName)
 	if namespace == "" {
@@ -1304,6 +1416,28 @@ func (dc *DataCoordinator) prepareLeavingCluster() {
 	dc.localNSMgr.Stop()
 }
 
+// LeaveCluster unregister the node from the cluster without stopping the local namespaces,
+// it is used by the decommission after all the replicas are moved out. The node will not be
+// registered again until restarted.
+func (dc *DataCoordinator) LeaveCluster() error {
+	if dc.register == nil {
+		return nil
+	}
+	allNamespaces, _, err := dc.register.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, nsParts := range allNamespaces {
+		for _, nsInfo := range nsParts {
+			if cluster.FindSlice(nsInfo.RaftNodes, dc.myNode.GetID()) != -1 {
+				return errors.New("the node still has the replica of namespace " + nsInfo.GetDesp())
+			}
+		}
+	}
+	cluster.CoordLog().Infof("node %v is leaving the cluster", dc.GetMyID())
+	return dc.register.Unregister(&dc.myNode)
+}
+
 func (dc *DataCoordinator) Stats(namespace string, part int) *cluster.CoordStats {
 	s := &cluster.CoordStats{}
 	s.NsCoordStats = make([]cluster.NamespaceCoordStat, 0)
@@ -1326,7 +1460,7 @@ func (dc *DataCoordinator) Stats(namespace string, part int) *cluster.CoordStats
 				s.NsCoordStats = append(s.NsCoordStats, stat)
 			}
 		} else {
-			for i := 0; i < meta.PartitionNum; i++ {
+			for i := 0; i < meta.AllPartitionNum(); i++ {
 				nsInfo, err := dc.register.GetNamespacePartInfo(namespace, part)
 				if err != nil {
 					continue
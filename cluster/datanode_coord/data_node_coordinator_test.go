@@ -0,0 +1,49 @@
+package datanode_coord
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPriorityNode(t *testing.T, handler http.HandlerFunc) (*httptest.Server, string) {
+	ts := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	n := &cluster.NodeInfo{RegID: 2, NodeIP: host, RedisPort: "6379", HttpPort: port}
+	return ts, cluster.GenNodeID(n, "")
+}
+
+func TestIsReplicaElectable(t *testing.T) {
+	dc := NewDataCoordinator("test", &cluster.NodeInfo{RegID: 1, NodeIP: "127.0.0.1"}, nil)
+	draining, nid1 := newTestPriorityNode(t, func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, common.APIElectionPriority+"/test-0", req.URL.Path)
+		w.Write([]byte(`{"priority":0}`))
+	})
+	defer draining.Close()
+	assert.False(t, dc.isReplicaElectable("test-0", nid1))
+
+	normal, nid2 := newTestPriorityNode(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"priority":1}`))
+	})
+	defer normal.Close()
+	assert.True(t, dc.isReplicaElectable("test-0", nid2))
+
+	// the old version node without the priority api
+	oldNode, nid3 := newTestPriorityNode(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer oldNode.Close()
+	assert.True(t, dc.isReplicaElectable("test-0", nid3))
+
+	failed, nid4 := newTestPriorityNode(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer failed.Close()
+	assert.False(t, dc.isReplicaElectable("test-0", nid4))
+}
@@ -48,6 +48,26 @@ func (pdCoord *PDCoordinator) SwitchAutoBalance(enable bool) {
 	}
 }
 
+// SwitchBalanceByLoad change the balance to be decided by the node load or the partition count
+func (pdCoord *PDCoordinator) SwitchBalanceByLoad(enable bool) {
+	pdCoord.dpm.SetBalanceByLoad(enable)
+	cluster.CoordLog().Infof("balance by load changed to: %v", enable)
+}
+
+// SetNodeLeaderExcluded exclude the data node from the leadership of all the partitions
+func (pdCoord *PDCoordinator) SetNodeLeaderExcluded(nid string, excluded bool) {
+	pdCoord.dpm.SetLeaderExcluded(nid, excluded)
+	cluster.CoordLog().Infof("node %v leader excluded changed to: %v", nid, excluded)
+}
+
+func (pdCoord *PDCoordinator) GetLeaderExcludedNodes() []string {
+	return pdCoord.dpm.GetLeaderExcludedNodes()
+}
+
+func (pdCoord *PDCoordinator) IsBalanceByLoad() bool {
+	return pdCoord.dpm.IsBalanceByLoad()
+}
+
 func (pdCoord *PDCoordinator) SetClusterStableNodeNum(num int) error {
 	if int32(num) > atomic.LoadInt32(&pdCoord.stableNodeNum) {
 		return errors.New("cluster stable node number can not be increased by manunal, only decrease allowed")
@@ -127,7 +147,7 @@ func (pdCoord *PDCoordinator) DeleteNamespace(ns string, partition string) error
 		if err != nil {
 			cluster.CoordLog().Infof("failed to get meta for namespace: %v", err)
 		}
-		for pid := 0; pid < meta.PartitionNum; pid++ {
+		for pid := 0; pid < meta.AllPartitionNum(); pid++ {
 			err := pdCoord.deleteNamespacePartition(ns, pid)
 			if err != nil {
 				cluster.CoordLog().Infof("failed to delete namespace partition %v for namespace: %v, err:%v", pid, ns, err)
@@ -179,6 +199,9 @@ func (pdCoord *PDCoordinator) ChangeNamespaceMetaParam(namespace string, newRepl
 		meta = oldMeta
 		if newReplicator > 0 {
 			meta.Replica = newReplicator
+			if err := validatePlacementRules(&meta, meta.PlacementRules); err != nil {
+				return err
+			}
 		}
 		if snapCount > 0 {
 			meta.SnapCount = snapCount
@@ -197,6 +220,132 @@ func (pdCoord *PDCoordinator) ChangeNamespaceMetaParam(namespace string, newRepl
 	return nil
 }
 
+// ChangeNamespaceQuota change the max keys and bytes of the namespace, the negative value
+// will keep the old quota unchanged and 0 means no limit.
+func (pdCoord *PDCoordinator) ChangeNamespaceQuota(namespace string, maxKeys int64, maxBytes int64) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while change namespace quota")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(namespace) {
+		return errors.New("invalid namespace name")
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(namespace)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", namespace, err)
+		return err
+	}
+	if maxKeys >= 0 {
+		meta.QuotaMaxKeys = maxKeys
+	}
+	if maxBytes >= 0 {
+		meta.QuotaMaxBytes = maxBytes
+	}
+	cluster.CoordLog().Infof("change namespace %v quota to %v keys, %v bytes", namespace, meta.QuotaMaxKeys, meta.QuotaMaxBytes)
+	return pdCoord.register.UpdateNamespaceMetaInfo(namespace, &meta, meta.MetaEpoch())
+}
+
+func (pdCoord *PDCoordinator) ChangeNamespaceLogRetention(namespace string, maxBytes int64, maxSecs int64) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while change namespace log retention")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(namespace) {
+		return errors.New("invalid namespace name")
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(namespace)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", namespace, err)
+		return err
+	}
+	if maxBytes >= 0 {
+		meta.LogRetentionBytes = maxBytes
+	}
+	if maxSecs >= 0 {
+		meta.LogRetentionSecs = maxSecs
+	}
+	cluster.CoordLog().Infof("change namespace %v raft log retention to %v bytes, %v seconds", namespace,
+		meta.LogRetentionBytes, meta.LogRetentionSecs)
+	return pdCoord.register.UpdateNamespaceMetaInfo(namespace, &meta, meta.MetaEpoch())
+}
+
+// FreezeNamespace freeze or unfreeze the namespace, the frozen namespace reject all the writes
+// and still serve the reads.
+func (pdCoord *PDCoordinator) FreezeNamespace(namespace string, frozen bool) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while freeze namespace")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(namespace) {
+		return errors.New("invalid namespace name")
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(namespace)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", namespace, err)
+		return err
+	}
+	if meta.Frozen == frozen {
+		return nil
+	}
+	meta.Frozen = frozen
+	cluster.CoordLog().Infof("change namespace %v frozen to %v", namespace, frozen)
+	return pdCoord.register.UpdateNamespaceMetaInfo(namespace, &meta, meta.MetaEpoch())
+}
+
+// TransferPartitionLeader move the node to the head of the raft replicas, so the data node
+// leader will transfer the leadership to the node after it is synced.
+func (pdCoord *PDCoordinator) TransferPartitionLeader(namespace string, pid int, nid string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while transfer partition leader")
+		return ErrNotLeader
+	}
+	origNSInfo, err := pdCoord.register.GetNamespacePartInfo(namespace, pid)
+	if err != nil {
+		return err
+	}
+	nsInfo := origNSInfo.GetCopy()
+	if _, ok := nsInfo.Removings[nid]; ok {
+		return errors.New("the node is marked as removing")
+	}
+	found := false
+	for _, n := range nsInfo.GetISR() {
+		if n == nid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("the node is not in the isr of the partition")
+	}
+	if nsInfo.RaftNodes[0] == nid {
+		return nil
+	}
+	newNodes := make([]string, 0, len(nsInfo.RaftNodes))
+	newNodes = append(newNodes, nid)
+	for _, n := range nsInfo.RaftNodes {
+		if n != nid {
+			newNodes = append(newNodes, n)
+		}
+	}
+	cluster.CoordLog().Infof("namespace %v: transfer leader from %v to %v", nsInfo.GetDesp(), nsInfo.RaftNodes, newNodes)
+	nsInfo.RaftNodes = newNodes
+	err = pdCoord.register.UpdateNamespacePartReplicaInfo(nsInfo.Name, nsInfo.Partition,
+		&nsInfo.PartitionReplicaInfo, nsInfo.PartitionReplicaInfo.Epoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v replica info failed: %v", nsInfo.GetDesp(), err.Error())
+		return err
+	}
+	*origNSInfo = *nsInfo
+	pdCoord.dpm.auditOperator(OperatorAuditRecord{
+		Type:      OperatorTransferLeader,
+		Namespace: nsInfo.Name,
+		Partition: nsInfo.Partition,
+		Node:      nid,
+		Result:    "done",
+	})
+	return nil
+}
+
 func (pdCoord *PDCoordinator) updateNamespaceMeta(currentNodes map[string]cluster.NodeInfo, namespace string, meta *cluster.NamespaceMetaInfo) error {
 	cluster.CoordLog().Infof("update namespace: %v, with meta: %v", namespace, meta)
 
@@ -226,6 +375,10 @@ func (pdCoord *PDCoordinator) CreateNamespace(namespace string, meta cluster.Nam
 		cluster.CoordLog().Infof("nodes %v is less than replica %v", len(currentNodes), meta)
 		return ErrNodeUnavailable.ToErrorType()
 	}
+	if allNamespaces, _, err := pdCoord.register.GetAllNamespaces(); err == nil &&
+		FindNamespaceByAlias(allNamespaces, namespace) != "" {
+		return ErrNamespaceNameUsed
+	}
 	if ok, _ := pdCoord.register.IsExistNamespace(namespace); !ok {
 		meta.MagicCode = time.Now().UnixNano()
 		var err error
@@ -311,7 +464,7 @@ func (pdCoord *PDCoordinator) RemoveLearnerFromNs(ns string, pidStr string, nid
 			cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
 			return err
 		}
-		for i := 0; i < oldMeta.PartitionNum; i++ {
+		for i := 0; i < oldMeta.AllPartitionNum(); i++ {
 			err = pdCoord.removeNsLearnerFromNode(ns, i, nid)
 			if err != nil {
 				cluster.CoordLog().Infof("namespace %v-%v remove learner %v failed :%v", ns, i, nid, err)
@@ -329,3 +482,36 @@ func (pdCoord *PDCoordinator) RemoveLearnerFromNs(ns string, pidStr string, nid
 	}
 	return pdCoord.removeNsLearnerFromNode(ns, pid, nid)
 }
+
+// SetClusterDynamicConf change the cluster wide config watched by all the data nodes,
+// the empty value remove the config and the nodes will use the default.
+func (pdCoord *PDCoordinator) SetClusterDynamicConf(key string, value string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while set dynamic config")
+		return ErrNotLeader
+	}
+	if err := common.ValidateDynamicConf(key, value); err != nil {
+		return err
+	}
+	conf, epoch, err := pdCoord.register.GetClusterDynamicConf()
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		delete(conf, key)
+	} else {
+		conf[key] = value
+	}
+	err = pdCoord.register.UpdateClusterDynamicConf(conf, epoch)
+	if err != nil {
+		cluster.CoordLog().Infof("update dynamic config %v=%v failed: %v", key, value, err)
+		return err
+	}
+	cluster.CoordLog().Infof("dynamic config changed: %v=%v", key, value)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) GetClusterDynamicConf() (map[string]string, error) {
+	conf, _, err := pdCoord.register.GetClusterDynamicConf()
+	return conf, err
+}
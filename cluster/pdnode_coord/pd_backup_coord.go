@@ -0,0 +1,162 @@
+package pdnode_coord
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	maxConcurrentPartitionBackup = 16
+	defaultClusterBackupTimeout  = time.Minute * 10
+)
+
+var errNoNamespaceToBackup = errors.New("no namespace to backup")
+
+// backup the partition on the leader and return the backup point, the other replicas
+// will be tried if the leader changed.
+func backupPartition(pinfo *cluster.PartitionMetaInfo, timeout time.Duration) common.PartitionBackupInfo {
+	return requestPartitionBackup(pinfo, common.APIDoBackup, nil, timeout)
+}
+
+func requestPartitionBackup(pinfo *cluster.PartitionMetaInfo, api string, body []byte,
+	timeout time.Duration) common.PartitionBackupInfo {
+	info := common.PartitionBackupInfo{Partition: pinfo.Partition}
+	candidates := make([]string, 0, len(pinfo.RaftNodes)+1)
+	if leader := pinfo.GetRealLeader(); leader != "" {
+		candidates = append(candidates, leader)
+	}
+	for _, nid := range pinfo.GetISR() {
+		if nid != pinfo.GetRealLeader() {
+			candidates = append(candidates, nid)
+		}
+	}
+	var lastErr error
+	for _, nid := range candidates {
+		nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nid)
+		var rsp common.PartitionBackupPoint
+		// the data node will write nothing until backup done, so the io timeout should be longer
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		_, err := common.APIRequest("POST",
+			fmt.Sprintf("http://%s%s/%s?timeout_sec=%d", net.JoinHostPort(nip, httpPort), api,
+				pinfo.GetDesp(), int(timeout.Seconds())),
+			reqBody, timeout+time.Second*10, &rsp)
+		if err != nil {
+			cluster.CoordLog().Infof("backup namespace %v on node %v failed: %v", pinfo.GetDesp(), nid, err)
+			lastErr = err
+			continue
+		}
+		info.Node = nid
+		info.Term = rsp.Term
+		info.Index = rsp.Index
+		return info
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no replica for backup")
+	}
+	info.Error = lastErr.Error()
+	return info
+}
+
+// BackupCluster backup all the partitions of the namespaces (all the namespaces if empty) at the
+// same time, and return the manifest with the backup term and index of each partition.
+// Each partition is backed up at its own raft point while the writes are not paused, so the
+// backup is not a consistent snapshot of the whole cluster, the writes across the partitions
+// between the start and end time of the manifest may be partially contained.
+func (pdCoord *PDCoordinator) BackupCluster(namespaces []string, timeout time.Duration) (*common.ClusterBackupManifest, error) {
+	if !pdCoord.IsMineLeader() {
+		cluster.CoordLog().Infof("not leader while backup cluster")
+		return nil, ErrNotLeader
+	}
+	if timeout <= 0 {
+		timeout = defaultClusterBackupTimeout
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		for ns := range allNamespaces {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	manifest := &common.ClusterBackupManifest{
+		ClusterID:  pdCoord.clusterKey,
+		StartTime:  time.Now(),
+		Complete:   true,
+		Namespaces: make(map[string]*common.NamespaceBackupManifest),
+	}
+	var pinfos []cluster.PartitionMetaInfo
+	for _, ns := range namespaces {
+		parts, ok := allNamespaces[ns]
+		if !ok || len(parts) == 0 {
+			return nil, fmt.Errorf("namespace %v not found", ns)
+		}
+		var meta *common.NamespaceBackupManifest
+		for _, p := range parts {
+			if meta == nil {
+				meta = &common.NamespaceBackupManifest{
+					PartitionNum: p.PartitionNum,
+					Replica:      p.Replica,
+					EngType:      p.EngType,
+				}
+			}
+			pinfos = append(pinfos, *p.GetCopy())
+		}
+		manifest.Namespaces[ns] = meta
+	}
+	if len(pinfos) == 0 {
+		return nil, errNoNamespaceToBackup
+	}
+	cluster.CoordLog().Infof("begin backup cluster namespaces: %v", namespaces)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	limitC := make(chan struct{}, maxConcurrentPartitionBackup)
+	for i := range pinfos {
+		wg.Add(1)
+		limitC <- struct{}{}
+		go func(pinfo *cluster.PartitionMetaInfo) {
+			defer wg.Done()
+			defer func() { <-limitC }()
+			info := backupPartition(pinfo, timeout)
+			mutex.Lock()
+			defer mutex.Unlock()
+			meta := manifest.Namespaces[pinfo.Name]
+			meta.Partitions = append(meta.Partitions, info)
+			if info.Error != "" {
+				manifest.Complete = false
+			}
+		}(&pinfos[i])
+	}
+	wg.Wait()
+	for _, meta := range manifest.Namespaces {
+		parts := meta.Partitions
+		sort.Slice(parts, func(i, j int) bool { return parts[i].Partition < parts[j].Partition })
+		if len(parts) != meta.PartitionNum {
+			manifest.Complete = false
+		}
+	}
+	manifest.EndTime = time.Now()
+	cluster.CoordLog().Infof("backup cluster done, complete: %v, cost: %v", manifest.Complete,
+		manifest.EndTime.Sub(manifest.StartTime))
+	pdCoord.lastBackupManifest.Store(manifest)
+	return manifest, nil
+}
+
+// GetLastBackupManifest return the manifest of the last cluster backup on this pd
+func (pdCoord *PDCoordinator) GetLastBackupManifest() *common.ClusterBackupManifest {
+	m, _ := pdCoord.lastBackupManifest.Load().(*common.ClusterBackupManifest)
+	return m
+}
@@ -0,0 +1,76 @@
+package pdnode_coord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBackupNode(t *testing.T, handler http.HandlerFunc) (*httptest.Server, string) {
+	ts := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	n := &cluster.NodeInfo{RegID: 1, NodeIP: host, RedisPort: "6379", HttpPort: port}
+	return ts, cluster.GenNodeID(n, "")
+}
+
+func TestRequestPartitionBackup(t *testing.T) {
+	notLeader, nid1 := newTestBackupNode(t, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("not leader"))
+	})
+	defer notLeader.Close()
+	var gotBody string
+	var gotTimeout string
+	leader, nid2 := newTestBackupNode(t, func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, common.APIBackupToTarget+"/test-1") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		d, _ := ioutil.ReadAll(req.Body)
+		gotBody = string(d)
+		gotTimeout = req.URL.Query().Get("timeout_sec")
+		d, _ = json.Marshal(common.PartitionBackupPoint{Name: "test-1", Term: 3, Index: 100})
+		w.Write(d)
+	})
+	defer leader.Close()
+
+	var pinfo cluster.PartitionMetaInfo
+	pinfo.Name = "test"
+	pinfo.Partition = 1
+	pinfo.RaftNodes = []string{nid1, nid2}
+	info := requestPartitionBackup(&pinfo, common.APIBackupToTarget, []byte("target"), time.Second*5)
+	assert.Equal(t, "", info.Error)
+	assert.Equal(t, 1, info.Partition)
+	assert.Equal(t, nid2, info.Node)
+	assert.Equal(t, uint64(3), info.Term)
+	assert.Equal(t, uint64(100), info.Index)
+	assert.Equal(t, "target", gotBody)
+	assert.Equal(t, "5", gotTimeout)
+
+	// the removing replica should not be used
+	pinfo.Removings = map[string]cluster.RemovingInfo{nid2: {}}
+	info = backupPartition(&pinfo, time.Second)
+	assert.NotEqual(t, "", info.Error)
+	assert.Equal(t, "", info.Node)
+
+	pinfo.RaftNodes = nil
+	info = backupPartition(&pinfo, time.Second)
+	assert.Equal(t, "no replica for backup", info.Error)
+}
+
+func TestBackupClusterNotLeader(t *testing.T) {
+	pd := NewPDCoordinator("test", &cluster.NodeInfo{NodeIP: "127.0.0.1"}, nil)
+	_, err := pd.BackupCluster(nil, time.Second)
+	assert.Equal(t, ErrNotLeader, err)
+	assert.Nil(t, pd.GetLastBackupManifest())
+}
@@ -0,0 +1,261 @@
+package pdnode_coord
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	// the timeout for backup and upload of each partition
+	defaultScheduledBackupTimeout = time.Hour
+	maxBackupHistoryRecords       = 32
+)
+
+var backupScheduleCheckInterval = time.Second * 30
+
+var ErrBackupScheduleInvalid = errors.New("the backup schedule is invalid")
+
+// BackupRunRecord is the result of the scheduled backup of the namespace
+type BackupRunRecord struct {
+	StartTime  time.Time                    `json:"start_time"`
+	EndTime    time.Time                    `json:"end_time"`
+	Success    bool                         `json:"success"`
+	Error      string                       `json:"error,omitempty"`
+	Partitions []common.PartitionBackupInfo `json:"partitions"`
+}
+
+type BackupScheduleStatus struct {
+	Namespace string                 `json:"namespace"`
+	Schedule  cluster.BackupSchedule `json:"schedule"`
+	NextTime  time.Time              `json:"next_time"`
+	Running   bool                   `json:"running"`
+	// the recent runs, the newest first
+	History []BackupRunRecord `json:"history"`
+}
+
+type namespaceBackupState struct {
+	cron      string
+	lastCheck time.Time
+	running   bool
+	history   []BackupRunRecord
+}
+
+func validateBackupSchedule(schedule *cluster.BackupSchedule) error {
+	if _, err := common.ParseCronSchedule(schedule.Cron); err != nil {
+		return err
+	}
+	if _, err := common.NewBackupDriver(schedule.Target); err != nil {
+		return err
+	}
+	if schedule.TimeoutSec < 0 {
+		return ErrBackupScheduleInvalid
+	}
+	return nil
+}
+
+// SetBackupSchedule attach the periodic backup to the namespace, the schedule will be
+// removed if nil.
+func (pdCoord *PDCoordinator) SetBackupSchedule(ns string, schedule *cluster.BackupSchedule) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while set backup schedule")
+		return ErrNotLeader
+	}
+	if schedule != nil {
+		if err := validateBackupSchedule(schedule); err != nil {
+			return err
+		}
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	meta.BackupSchedule = schedule
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+	if err != nil {
+		return err
+	}
+	if schedule != nil {
+		cluster.CoordLog().Infof("namespace %v backup schedule changed to %v, target: %v",
+			ns, schedule.Cron, schedule.Target.Type)
+	} else {
+		cluster.CoordLog().Infof("namespace %v backup schedule removed", ns)
+	}
+	return nil
+}
+
+// GetBackupSchedules return the schedules and the history of the namespace, or all the
+// namespaces with the schedule if the namespace is empty. The secret key of the target is hidden.
+func (pdCoord *PDCoordinator) GetBackupSchedules(ns string) ([]BackupScheduleStatus, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	stList := make([]BackupScheduleStatus, 0)
+	pdCoord.backupScheduleMutex.Lock()
+	defer pdCoord.backupScheduleMutex.Unlock()
+	for name, parts := range allNamespaces {
+		if ns != "" && name != ns {
+			continue
+		}
+		schedule := getNamespaceBackupSchedule(parts)
+		if schedule == nil {
+			continue
+		}
+		st := BackupScheduleStatus{
+			Namespace: name,
+			Schedule:  *schedule,
+		}
+		if st.Schedule.Target.SecretKey != "" {
+			st.Schedule.Target.SecretKey = "******"
+		}
+		if bs, ok := pdCoord.backupStates[name]; ok {
+			st.Running = bs.running
+			for i := len(bs.history) - 1; i >= 0; i-- {
+				st.History = append(st.History, bs.history[i])
+			}
+			if cs, err := common.ParseCronSchedule(schedule.Cron); err == nil {
+				st.NextTime = cs.Next(bs.lastCheck)
+			}
+		}
+		stList = append(stList, st)
+	}
+	sort.Slice(stList, func(i, j int) bool { return stList[i].Namespace < stList[j].Namespace })
+	return stList, nil
+}
+
+func getNamespaceBackupSchedule(parts map[int]cluster.PartitionMetaInfo) *cluster.BackupSchedule {
+	for _, p := range parts {
+		return p.BackupSchedule
+	}
+	return nil
+}
+
+func (pdCoord *PDCoordinator) handleBackupSchedules(monitorChan chan struct{}) {
+	ticker := time.NewTicker(backupScheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			pdCoord.checkBackupSchedules(time.Now())
+		}
+	}
+}
+
+func (pdCoord *PDCoordinator) checkBackupSchedules(now time.Time) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return
+	}
+	pdCoord.backupScheduleMutex.Lock()
+	defer pdCoord.backupScheduleMutex.Unlock()
+	if pdCoord.backupStates == nil {
+		pdCoord.backupStates = make(map[string]*namespaceBackupState)
+	}
+	for ns, bs := range pdCoord.backupStates {
+		if getNamespaceBackupSchedule(allNamespaces[ns]) == nil && !bs.running {
+			delete(pdCoord.backupStates, ns)
+		}
+	}
+	for ns, parts := range allNamespaces {
+		schedule := getNamespaceBackupSchedule(parts)
+		if schedule == nil {
+			continue
+		}
+		cs, err := common.ParseCronSchedule(schedule.Cron)
+		if err != nil {
+			continue
+		}
+		bs, ok := pdCoord.backupStates[ns]
+		// wait the next time for the new schedule
+		if !ok || bs.cron != schedule.Cron {
+			if !ok {
+				bs = &namespaceBackupState{}
+				pdCoord.backupStates[ns] = bs
+			}
+			bs.cron = schedule.Cron
+			bs.lastCheck = now
+			continue
+		}
+		next := cs.Next(bs.lastCheck)
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+		bs.lastCheck = now
+		if bs.running {
+			cluster.CoordLog().Infof("namespace %v scheduled backup skipped since the last is running", ns)
+			continue
+		}
+		bs.running = true
+		pinfos := make([]cluster.PartitionMetaInfo, 0, len(parts))
+		for _, p := range parts {
+			pinfos = append(pinfos, *p.GetCopy())
+		}
+		go pdCoord.runScheduledBackup(ns, pinfos, *schedule)
+	}
+}
+
+func (pdCoord *PDCoordinator) runScheduledBackup(ns string, pinfos []cluster.PartitionMetaInfo,
+	schedule cluster.BackupSchedule) {
+	record := BackupRunRecord{StartTime: time.Now(), Success: true}
+	cluster.CoordLog().Infof("begin scheduled backup of namespace %v to %v", ns, schedule.Target.Type)
+	timeout := defaultScheduledBackupTimeout
+	if schedule.TimeoutSec > 0 {
+		timeout = time.Duration(schedule.TimeoutSec) * time.Second
+	}
+	body, err := json.Marshal(schedule.Target)
+	if err != nil {
+		record.Success = false
+		record.Error = err.Error()
+	} else {
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		limitC := make(chan struct{}, maxConcurrentPartitionBackup)
+		for i := range pinfos {
+			wg.Add(1)
+			limitC <- struct{}{}
+			go func(pinfo *cluster.PartitionMetaInfo) {
+				defer wg.Done()
+				defer func() { <-limitC }()
+				info := requestPartitionBackup(pinfo, common.APIBackupToTarget, body, timeout)
+				mutex.Lock()
+				defer mutex.Unlock()
+				record.Partitions = append(record.Partitions, info)
+				if info.Error != "" {
+					record.Success = false
+					record.Error = info.Error
+				}
+			}(&pinfos[i])
+		}
+		wg.Wait()
+		sort.Slice(record.Partitions, func(i, j int) bool {
+			return record.Partitions[i].Partition < record.Partitions[j].Partition
+		})
+	}
+	record.EndTime = time.Now()
+	cluster.CoordLog().Infof("scheduled backup of namespace %v done, success: %v, cost: %v", ns,
+		record.Success, record.EndTime.Sub(record.StartTime))
+	pdCoord.finishScheduledBackup(ns, record)
+}
+
+func (pdCoord *PDCoordinator) finishScheduledBackup(ns string, record BackupRunRecord) {
+	pdCoord.backupScheduleMutex.Lock()
+	defer pdCoord.backupScheduleMutex.Unlock()
+	bs, ok := pdCoord.backupStates[ns]
+	if !ok {
+		return
+	}
+	bs.running = false
+	bs.history = append(bs.history, record)
+	if len(bs.history) > maxBackupHistoryRecords {
+		bs.history = bs.history[len(bs.history)-maxBackupHistoryRecords:]
+	}
+}
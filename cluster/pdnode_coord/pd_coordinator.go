@@ -71,6 +71,28 @@ type PDCoordinator struct {
 	stableNodeNum          int32
 	dataDir                string
 	learnerRole            string
+	// the manifest of the last cluster backup
+	lastBackupManifest atomic.Value
+
+	decommissionMutex sync.Mutex
+	decommissions     map[string]*NodeDecommissionStatus
+
+	cloneMutex sync.Mutex
+	clones     map[string]*NamespaceCloneStatus
+
+	failoverMutex    sync.Mutex
+	failoverPolicy   FailoverPolicy
+	lostNodes        map[string]time.Time
+	recoverings      map[string]time.Time
+	pendingFailovers map[string]*PendingFailover
+
+	backupScheduleMutex sync.Mutex
+	backupStates        map[string]*namespaceBackupState
+
+	// the grace period before deleting the expired namespace and the hook url notified
+	expireGrace time.Duration
+	expireHook  string
+	expireMutex sync.Mutex
 }
 
 func NewPDCoordinator(clusterID string, n *cluster.NodeInfo, opts *cluster.Options) *PDCoordinator {
@@ -90,14 +112,26 @@ func NewPDCoordinator(clusterID string, n *cluster.NodeInfo, opts *cluster.Optio
 		stopChan:               make(chan struct{}),
 		monitorChan:            make(chan struct{}),
 		learnerRole:            n.LearnerRole,
+		decommissions:          make(map[string]*NodeDecommissionStatus),
+		clones:                 make(map[string]*NamespaceCloneStatus),
 	}
 	coord.dpm = NewDataPlacement(coord)
 	if opts != nil {
 		coord.dpm.SetBalanceInterval(opts.BalanceStart, opts.BalanceEnd)
+		coord.dpm.SetBalanceByLoad(opts.BalanceByLoad)
 		if opts.AutoBalanceAndMigrate {
 			coord.autoBalance = 1
 		}
 		coord.dataDir = opts.DataDir
+		coord.failoverPolicy = FailoverPolicy{
+			NodeDownThresholdSecs: opts.NodeDownThresholdSecs,
+			MigrateGraceSecs:      opts.MigrateGraceSecs,
+			EmergencyGraceSecs:    opts.EmergencyGraceSecs,
+			MaxRecoveries:         opts.MaxRecoveries,
+			ConfirmMaxNodes:       opts.FailoverConfirmMaxNodes,
+		}
+		coord.expireGrace = time.Duration(opts.NamespaceExpireGraceSecs) * time.Second
+		coord.expireHook = opts.NamespaceExpireHook
 	}
 	return coord
 }
@@ -244,6 +278,16 @@ func (pdCoord *PDCoordinator) notifyLeaderChanged(monitorChan chan struct{}) {
 		pdCoord.nodesMutex.Lock()
 		pdCoord.removingNodes = make(map[string]string)
 		pdCoord.nodesMutex.Unlock()
+		pdCoord.decommissionMutex.Lock()
+		pdCoord.decommissions = make(map[string]*NodeDecommissionStatus)
+		pdCoord.decommissionMutex.Unlock()
+		pdCoord.cloneMutex.Lock()
+		pdCoord.clones = make(map[string]*NamespaceCloneStatus)
+		pdCoord.cloneMutex.Unlock()
+		pdCoord.resetFailoverState()
+		pdCoord.backupScheduleMutex.Lock()
+		pdCoord.backupStates = nil
+		pdCoord.backupScheduleMutex.Unlock()
 
 		pdCoord.wg.Add(1)
 		go func() {
@@ -286,6 +330,36 @@ func (pdCoord *PDCoordinator) notifyLeaderChanged(monitorChan chan struct{}) {
 		defer pdCoord.wg.Done()
 		pdCoord.handleRemovingNodes(monitorChan)
 	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handleNamespaceExpansion(monitorChan)
+	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handleDecommission(monitorChan)
+	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handleNamespaceClones(monitorChan)
+	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handleBackupSchedules(monitorChan)
+	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handleNamespaceExpiry(monitorChan)
+	}()
+	pdCoord.wg.Add(1)
+	go func() {
+		defer pdCoord.wg.Done()
+		pdCoord.handlePlacementRules(monitorChan)
+	}()
 }
 
 func (pdCoord *PDCoordinator) getCurrentNodes(tags map[string]interface{}) map[string]cluster.NodeInfo {
@@ -419,11 +493,13 @@ func (pdCoord *PDCoordinator) handleDataNodes(monitorChan chan struct{}, isMaste
 			pdCoord.dataNodes = newNodes
 			pdCoord.learnerNodes = newLearnerNodes
 			check := false
+			var lostNodes []string
 			for oldID, oldNode := range oldNodes {
 				if _, ok := newNodes[oldID]; !ok {
 					cluster.CoordLog().Warningf("node failed: %v, %v", oldID, oldNode)
 					// if node is missing we need check election immediately.
 					check = true
+					lostNodes = append(lostNodes, oldID)
 				}
 			}
 			// failed need be protected by lock so we can avoid contention.
@@ -440,12 +516,15 @@ func (pdCoord *PDCoordinator) handleDataNodes(monitorChan chan struct{}, isMaste
 			if pdCoord.register == nil {
 				continue
 			}
+			var joinedNodes []string
 			for newID, newNode := range newNodes {
 				if _, ok := oldNodes[newID]; !ok {
 					cluster.CoordLog().Infof("new node joined: %v, %v", newID, newNode)
 					check = true
+					joinedNodes = append(joinedNodes, newID)
 				}
 			}
+			pdCoord.markNodesLost(lostNodes, joinedNodes)
 			if check && isMaster {
 				atomic.AddInt64(&pdCoord.nodesEpoch, 1)
 				atomic.StoreInt32(&pdCoord.isClusterUnstable, 1)
@@ -478,9 +557,6 @@ func (pdCoord *PDCoordinator) handleRemovingNodes(monitorChan chan struct{}) {
 			if len(removingNodes) == 0 {
 				continue
 			}
-			currentNodes := pdCoord.getCurrentNodes(nil)
-			nodeNameList := getNodeNameList(currentNodes)
-
 			allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
 			if err != nil {
 				continue
@@ -512,6 +588,8 @@ func (pdCoord *PDCoordinator) handleRemovingNodes(monitorChan chan struct{}) {
 							anyPending = true
 							// find new catchup and wait isr ready
 							removingNodes[nid] = "pending"
+							// the new replica should satisfy the placement tags of the namespace
+							nodeNameList := getNodeNameList(pdCoord.getCurrentNodes(namespaceInfo.Tags))
 							newInfo, err := pdCoord.dpm.addNodeToNamespaceAndWaitReady(monitorChan, &namespaceInfo,
 								nodeNameList)
 							if err != nil {
@@ -661,6 +739,8 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 
 	currentNodes, currentNodesEpoch := pdCoord.getCurrentNodesWithRemoving()
 	cluster.CoordLog().Infof("do check namespaces (%v), current nodes: %v, ...", len(namespaces), len(currentNodes))
+	fp := pdCoord.GetFailoverPolicy()
+	checkedParts := make(map[string]bool, len(namespaces))
 	checkOK := true
 	fullReady := true
 	defer func() {
@@ -685,6 +765,7 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 			return
 		default:
 		}
+		checkedParts[nsInfo.GetDesp()] = true
 
 		needMigrate := false
 		if len(nsInfo.GetISR()) < nsInfo.Replica {
@@ -694,11 +775,18 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 		}
 
 		aliveCount := 0
+		var lostNodes []string
+		waitingNodeDown := false
 		for _, replica := range nsInfo.GetISR() {
 			if _, ok := currentNodes[replica]; !ok {
 				cluster.CoordLog().Warningf("namespace %v isr node %v is lost.", nsInfo.GetDesp(), replica)
-				needMigrate = true
 				checkOK = false
+				lostNodes = append(lostNodes, replica)
+				if pdCoord.isNodeDown(replica, &fp) {
+					needMigrate = true
+				} else {
+					waitingNodeDown = true
+				}
 			} else {
 				aliveCount++
 			}
@@ -733,12 +821,21 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 		if atomic.LoadInt32(&pdCoord.balanceWaiting) == 0 && len(nsInfo.Removings) > 0 {
 			pdCoord.removeNamespaceFromRemovings(&nsInfo)
 		}
+		if waitingNodeDown {
+			cluster.CoordLog().Infof("namespace %v waiting the lost nodes %v down", nsInfo.GetDesp(), lostNodes)
+			continue
+		}
 
-		if needMigrate && pdCoord.AutoBalanceEnabled() {
+		// the replica number is increased while all the replicas are alive, no need to wait
+		// the failed node back before adding the new replica
+		replicaIncreasing := needMigrate && aliveCount == len(nsInfo.GetISR())
+		if needMigrate && (pdCoord.AutoBalanceEnabled() || replicaIncreasing) {
 			if _, ok := partitions[nsInfo.Partition]; !ok {
 				partitions[nsInfo.Partition] = time.Now()
 				// migrate next time
-				continue
+				if !replicaIncreasing {
+					continue
+				}
 			}
 
 			if atomic.LoadInt32(&pdCoord.isUpgrading) == 1 {
@@ -746,14 +843,25 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 				continue
 			}
 			failedTime := partitions[nsInfo.Partition]
-			emergency := (aliveCount <= nsInfo.Replica/2) && failedTime.Before(time.Now().Add(-1*waitEmergencyMigrateInterval))
-			if emergency ||
-				failedTime.Before(time.Now().Add(-1*waitMigrateInterval)) {
+			emergency := (aliveCount <= nsInfo.Replica/2) && failedTime.Before(time.Now().Add(-1*fp.emergencyGrace()))
+			if emergency || replicaIncreasing ||
+				failedTime.Before(time.Now().Add(-1*fp.migrateGrace())) {
 				aliveNodes, aliveEpoch := pdCoord.getCurrentNodesWithEpoch(nsInfo.Tags)
 				if aliveEpoch != currentNodesEpoch {
 					go pdCoord.triggerCheckNamespaces(nsInfo.Name, nsInfo.Partition, time.Second)
 					continue
 				}
+				if !replicaIncreasing {
+					if fp.needConfirm(len(currentNodes)) && !pdCoord.checkFailoverConfirmed(&nsInfo, lostNodes, failedTime) {
+						cluster.CoordLog().Infof("waiting confirm the failover of the namespace :%v", nsInfo.GetDesp())
+						continue
+					}
+					if !pdCoord.canStartRecovery(&nsInfo, &fp) {
+						cluster.CoordLog().Infof("waiting other recoveries done for the namespace :%v", nsInfo.GetDesp())
+						continue
+					}
+					pdCoord.startRecovery(&nsInfo)
+				}
 				cluster.CoordLog().Infof("begin migrate the namespace :%v", nsInfo.GetDesp())
 				if coordErr := pdCoord.handleNamespaceMigrate(&nsInfo, aliveNodes, aliveEpoch); coordErr != nil {
 					atomic.StoreInt32(&pdCoord.isClusterUnstable, 1)
@@ -781,6 +889,9 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 				cluster.CoordLog().Infof("namespace %v isr is not full ready", nsInfo.GetDesp())
 				continue
 			}
+			if !needMigrate {
+				pdCoord.finishFailover(nsInfo.Name, nsInfo.Partition)
+			}
 		}
 
 		if atomic.LoadInt32(&pdCoord.balanceWaiting) == 0 {
@@ -813,7 +924,9 @@ func (pdCoord *PDCoordinator) doCheckNamespaces(monitorChan chan struct{}, faile
 			}
 		}
 	}
-
+	if failedInfo == nil || failedInfo.NamespaceName == "" {
+		pdCoord.cleanFailoverState(checkedParts)
+	}
 }
 
 func (pdCoord *PDCoordinator) handleNamespaceMigrate(origNSInfo *cluster.PartitionMetaInfo,
@@ -962,6 +1075,13 @@ func (pdCoord *PDCoordinator) removeNamespaceFromNode(origNSInfo *cluster.Partit
 		cluster.CoordLog().Infof("namespace %v: mark replica removing from node:%v, current isr: %v", nsInfo.GetDesp(),
 			nsInfo.Removings[nid], nsInfo.GetISR())
 		*origNSInfo = *nsInfo
+		pdCoord.dpm.auditOperator(OperatorAuditRecord{
+			Type:      OperatorRemoveReplica,
+			Namespace: nsInfo.Name,
+			Partition: nsInfo.Partition,
+			Node:      nid,
+			Result:    "marked",
+		})
 	}
 	return nil
 }
@@ -0,0 +1,247 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	// moving the replicas and leaders out of the node
+	DecommissionStateMoving = "moving"
+	// all the data moved out, waiting the node unregistered from the cluster
+	DecommissionStateLeaving = "leaving"
+	DecommissionStateDone    = "done"
+)
+
+var decommissionCheckInterval = time.Second * 10
+
+var ErrNodeDecommissioning = errors.New("the node is already decommissioning")
+
+// NodeDecommissionStatus is the progress of the node decommission. The node is excluded from
+// the leadership and marked as removing, and it will be unregistered from the cluster after all
+// the replicas are moved to the other nodes.
+type NodeDecommissionStatus struct {
+	Node              string    `json:"node"`
+	State             string    `json:"state"`
+	StartTime         time.Time `json:"start_time"`
+	TotalReplicas     int       `json:"total_replicas"`
+	RemainingReplicas int       `json:"remaining_replicas"`
+	RemainingLeaders  int       `json:"remaining_leaders"`
+}
+
+func countNodeReplicas(allNamespaces map[string]map[int]cluster.PartitionMetaInfo, nid string) (int, int) {
+	replicas := 0
+	leaders := 0
+	for _, parts := range allNamespaces {
+		for _, p := range parts {
+			if cluster.FindSlice(p.RaftNodes, nid) == -1 {
+				continue
+			}
+			replicas++
+			if p.RaftNodes[0] == nid {
+				leaders++
+			}
+		}
+	}
+	return replicas, leaders
+}
+
+// DecommissionNode start moving all the replicas and leaders out of the node, the node will
+// leave the cluster after all done.
+func (pdCoord *PDCoordinator) DecommissionNode(nid string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while decommission node")
+		return ErrNotLeader
+	}
+	pdCoord.nodesMutex.RLock()
+	_, ok := pdCoord.dataNodes[nid]
+	pdCoord.nodesMutex.RUnlock()
+	if !ok {
+		return ErrNodeNotFound.ToErrorType()
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	replicas, leaders := countNodeReplicas(allNamespaces, nid)
+
+	pdCoord.decommissionMutex.Lock()
+	if st, ok := pdCoord.decommissions[nid]; ok && st.State != DecommissionStateDone {
+		pdCoord.decommissionMutex.Unlock()
+		return ErrNodeDecommissioning
+	}
+	pdCoord.decommissions[nid] = &NodeDecommissionStatus{
+		Node:              nid,
+		State:             DecommissionStateMoving,
+		StartTime:         time.Now(),
+		TotalReplicas:     replicas,
+		RemainingReplicas: replicas,
+		RemainingLeaders:  leaders,
+	}
+	pdCoord.decommissionMutex.Unlock()
+
+	// the node should not be chosen as leader or new replica any more
+	pdCoord.dpm.SetLeaderExcluded(nid, true)
+	err = pdCoord.MarkNodeAsRemoving(nid)
+	if err != nil {
+		return err
+	}
+	cluster.CoordLog().Infof("node %v begin decommission, replicas: %v, leaders: %v", nid, replicas, leaders)
+	return nil
+}
+
+// GetNodeDecommissionStatus return the decommission progress of the node, or all the
+// decommissions if the node is empty.
+func (pdCoord *PDCoordinator) GetNodeDecommissionStatus(nid string) []NodeDecommissionStatus {
+	pdCoord.decommissionMutex.Lock()
+	defer pdCoord.decommissionMutex.Unlock()
+	statusList := make([]NodeDecommissionStatus, 0, len(pdCoord.decommissions))
+	for id, st := range pdCoord.decommissions {
+		if nid != "" && id != nid {
+			continue
+		}
+		statusList = append(statusList, *st)
+	}
+	sort.Slice(statusList, func(i, j int) bool {
+		return statusList[i].StartTime.Before(statusList[j].StartTime)
+	})
+	return statusList
+}
+
+func (pdCoord *PDCoordinator) handleDecommission(monitorChan chan struct{}) {
+	cluster.CoordLog().Debugf("start handle the node decommission.")
+	defer func() {
+		cluster.CoordLog().Infof("stop handle the node decommission.")
+	}()
+	ticker := time.NewTicker(decommissionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			pdCoord.decommissionMutex.Lock()
+			nodes := make([]string, 0, len(pdCoord.decommissions))
+			for nid, st := range pdCoord.decommissions {
+				if st.State != DecommissionStateDone {
+					nodes = append(nodes, nid)
+				}
+			}
+			pdCoord.decommissionMutex.Unlock()
+			for _, nid := range nodes {
+				pdCoord.checkDecommission(monitorChan, nid)
+			}
+		}
+	}
+}
+
+func (pdCoord *PDCoordinator) checkDecommission(monitorChan chan struct{}, nid string) {
+	if pdCoord.register == nil {
+		return
+	}
+	pdCoord.nodesMutex.RLock()
+	_, alive := pdCoord.dataNodes[nid]
+	_, removing := pdCoord.removingNodes[nid]
+	pdCoord.nodesMutex.RUnlock()
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		cluster.CoordLog().Infof("scan namespaces error: %v", err)
+		return
+	}
+	replicas, leaders := countNodeReplicas(allNamespaces, nid)
+	state := DecommissionStateMoving
+	if replicas == 0 {
+		state = DecommissionStateLeaving
+		if !alive {
+			state = DecommissionStateDone
+		}
+	} else if !removing && alive {
+		// the removing state is reset while the pd leader changed
+		pdCoord.MarkNodeAsRemoving(nid)
+	}
+
+	pdCoord.decommissionMutex.Lock()
+	st, ok := pdCoord.decommissions[nid]
+	if ok {
+		st.RemainingReplicas = replicas
+		st.RemainingLeaders = leaders
+		st.State = state
+	}
+	pdCoord.decommissionMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	switch state {
+	case DecommissionStateMoving:
+		if leaders > 0 {
+			pdCoord.transferLeadersOutOfNode(monitorChan, allNamespaces, nid)
+		}
+	case DecommissionStateLeaving:
+		ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nid)
+		_, err := common.APIRequest("POST",
+			"http://"+net.JoinHostPort(ip, httpPort)+common.APILeaveCluster,
+			nil, time.Second*5, nil)
+		if err != nil {
+			cluster.CoordLog().Infof("node %v failed to leave the cluster: %v", nid, err)
+		}
+	case DecommissionStateDone:
+		pdCoord.dpm.SetLeaderExcluded(nid, false)
+		cluster.CoordLog().Infof("node %v decommission done", nid)
+	}
+}
+
+// transferLeadersOutOfNode move the leaders on the node to the other full ready replicas,
+// the replica can only be removed from the node after the leader moved.
+func (pdCoord *PDCoordinator) transferLeadersOutOfNode(monitorChan chan struct{},
+	allNamespaces map[string]map[int]cluster.PartitionMetaInfo, nid string) {
+	if !atomic.CompareAndSwapInt32(&pdCoord.balanceWaiting, 0, 1) {
+		cluster.CoordLog().Infof("another balance is running, should wait")
+		return
+	}
+	defer atomic.StoreInt32(&pdCoord.balanceWaiting, 0)
+
+	currentNodes := pdCoord.getCurrentNodes(nil)
+	transferred := 0
+	for _, parts := range allNamespaces {
+		for _, p := range parts {
+			if transferred >= maxLeaderTransferPerRound {
+				return
+			}
+			if len(p.RaftNodes) == 0 || p.RaftNodes[0] != nid {
+				continue
+			}
+			for _, target := range p.GetISR() {
+				if target == nid || pdCoord.dpm.isLeaderExcluded(target, currentNodes) {
+					continue
+				}
+				if _, ok := currentNodes[target]; !ok {
+					continue
+				}
+				if ok, err := IsRaftNodeFullReady(&p, target); err != nil || !ok {
+					continue
+				}
+				err := pdCoord.TransferPartitionLeader(p.Name, p.Partition, target)
+				if err != nil {
+					cluster.CoordLog().Infof("transfer leader of namespace %v failed: %v", p.GetDesp(), err)
+					continue
+				}
+				cluster.CoordLog().Infof("decommission node %v transfer leader of namespace %v to %v",
+					nid, p.GetDesp(), target)
+				transferred++
+				break
+			}
+			select {
+			case <-monitorChan:
+				return
+			default:
+			}
+		}
+	}
+}
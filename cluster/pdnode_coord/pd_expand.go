@@ -0,0 +1,347 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const expandCheckInterval = time.Second * 10
+
+var (
+	ErrNamespaceExpanding        = errors.New("the namespace partitions are expanding")
+	ErrInvalidExpandPartitionNum = errors.New("the new partition number should be a multiple of the current partition number")
+	ErrInvalidMergePartitionNum  = errors.New("the new partition number should be a divisor of the current partition number")
+)
+
+// NamespaceExpandStatus is the expanding state of the namespace with the migration status of
+// the partitions reported by the leaders.
+type NamespaceExpandStatus struct {
+	PartitionNum       int                             `json:"partition_num"`
+	ExpandPartitionNum int                             `json:"expand_partition_num"`
+	ExpandState        string                          `json:"expand_state"`
+	Partitions         []common.PartitionReshardStatus `json:"partitions"`
+}
+
+// ExpandNamespacePartitions expand the partition number of the namespace online instead of
+// dumping and reloading all the data. The new partition number should be a multiple of the
+// current, so the keys of each new partition come from only one old partition, and the new
+// partition is placed on the same nodes as the old partition, so the keys can be migrated
+// locally by the leader of the old partition.
+func (pdCoord *PDCoordinator) ExpandNamespacePartitions(ns string, newNum int) error {
+	if !pdCoord.IsMineLeader() {
+		cluster.CoordLog().Infof("not leader while expand namespace")
+		return ErrNotLeader
+	}
+	if newNum >= common.MAX_PARTITION_NUM {
+		return errors.New("max partition allowed exceed")
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if meta.ExpandState != "" {
+		return ErrNamespaceExpanding
+	}
+	if meta.PartitionNum <= 0 || newNum <= meta.PartitionNum || newNum%meta.PartitionNum != 0 {
+		return ErrInvalidExpandPartitionNum
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	parts := allNamespaces[ns]
+	for pid := meta.PartitionNum; pid < newNum; pid++ {
+		// the partitions may be created by the last failed expanding
+		if _, err := pdCoord.register.GetRemoteNamespaceReplicaInfo(ns, pid); err == nil {
+			continue
+		}
+		src, ok := parts[pid%meta.PartitionNum]
+		if !ok || len(src.GetISR()) == 0 {
+			cluster.CoordLog().Infof("namespace %v partition %v not found while expanding", ns, pid%meta.PartitionNum)
+			return ErrClusterUnstable
+		}
+		err := pdCoord.register.CreateNamespacePartition(ns, pid)
+		if err != nil {
+			cluster.CoordLog().Warningf("failed to create namespace %v-%v: %v", ns, pid, err)
+		}
+		var replicaInfo cluster.PartitionReplicaInfo
+		replicaInfo.RaftNodes = make([]string, 0, len(src.RaftNodes))
+		replicaInfo.RaftIDs = make(map[string]uint64)
+		replicaInfo.Removings = make(map[string]cluster.RemovingInfo)
+		for _, nid := range src.GetISR() {
+			replicaInfo.RaftNodes = append(replicaInfo.RaftNodes, nid)
+			replicaInfo.MaxRaftID++
+			replicaInfo.RaftIDs[nid] = uint64(replicaInfo.MaxRaftID)
+		}
+		err = pdCoord.register.UpdateNamespacePartReplicaInfo(ns, pid, &replicaInfo, replicaInfo.Epoch())
+		if err != nil {
+			cluster.CoordLog().Infof("failed update info for namespace : %v-%v, %v", ns, pid, err)
+			return err
+		}
+	}
+	meta.ExpandPartitionNum = newNum
+	meta.ExpandState = common.ExpandStateCopying
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v meta failed: %v", ns, err)
+		return err
+	}
+	cluster.CoordLog().Infof("begin expand namespace %v partitions from %v to %v", ns, meta.PartitionNum, newNum)
+	pdCoord.triggerCheckNamespaces("", 0, time.Millisecond*500)
+	return nil
+}
+
+// MergeNamespacePartitions merge the partitions of the namespace into less partitions online.
+// The new partition number should be a divisor of the current, and all the keys of the
+// partition pid are moved to the partition pid%newNum. The replicas of the merged partition
+// are moved to the nodes of the partition merged into first, so the keys can be migrated
+// locally, and the merged partitions are removed after the routing switched.
+func (pdCoord *PDCoordinator) MergeNamespacePartitions(ns string, newNum int) error {
+	if !pdCoord.IsMineLeader() {
+		cluster.CoordLog().Infof("not leader while merge namespace")
+		return ErrNotLeader
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if meta.ExpandState != "" {
+		return ErrNamespaceExpanding
+	}
+	if newNum <= 0 || newNum >= meta.PartitionNum || meta.PartitionNum%newNum != 0 {
+		return ErrInvalidMergePartitionNum
+	}
+	meta.ExpandPartitionNum = newNum
+	meta.ExpandState = common.ExpandStateCopying
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v meta failed: %v", ns, err)
+		return err
+	}
+	cluster.CoordLog().Infof("begin merge namespace %v partitions from %v to %v", ns, meta.PartitionNum, newNum)
+	return nil
+}
+
+// colocateMergingPartitions move the replicas of the merged partitions to the nodes of the
+// partitions merged into, only one replica is moved each time. Return true if all the merged
+// partitions are placed on the same nodes as the partitions merged into.
+func (pdCoord *PDCoordinator) colocateMergingPartitions(monitorChan chan struct{}, meta *cluster.NamespaceMetaInfo,
+	parts map[int]cluster.PartitionMetaInfo) bool {
+	for pid := meta.ExpandPartitionNum; pid < meta.PartitionNum; pid++ {
+		src, ok := parts[pid]
+		if !ok {
+			return false
+		}
+		dst, ok := parts[pid%meta.ExpandPartitionNum]
+		if !ok {
+			return false
+		}
+		var adding, removing string
+		for _, nid := range dst.GetISR() {
+			if cluster.FindSlice(src.RaftNodes, nid) == -1 {
+				adding = nid
+				break
+			}
+		}
+		for _, nid := range src.GetISR() {
+			if cluster.FindSlice(dst.RaftNodes, nid) == -1 {
+				removing = nid
+				break
+			}
+		}
+		if adding == "" && removing == "" {
+			continue
+		}
+		if len(src.Removings) > 0 || !atomic.CompareAndSwapInt32(&pdCoord.balanceWaiting, 0, 1) {
+			return false
+		}
+		defer atomic.StoreInt32(&pdCoord.balanceWaiting, 0)
+		if ok, err := IsAllISRFullReady(&src); err != nil || !ok {
+			cluster.CoordLog().Infof("namespace %v isr is not full ready while merging", src.GetDesp())
+			return false
+		}
+		cluster.CoordLog().Infof("move the replica of namespace %v to the nodes %v of partition %v for merging",
+			src.GetDesp(), dst.RaftNodes, dst.Partition)
+		if adding != "" {
+			_, err := pdCoord.dpm.addCatchupAndWaitReady(monitorChan, &src, []string{adding})
+			if err != nil {
+				cluster.CoordLog().Infof("add node %v to namespace %v failed: %v", adding, src.GetDesp(), err)
+			}
+			return false
+		}
+		if coordErr := pdCoord.removeNamespaceFromNode(&src, removing); coordErr != nil {
+			cluster.CoordLog().Infof("remove node %v from namespace %v failed: %v", removing, src.GetDesp(), coordErr)
+		}
+		return false
+	}
+	return true
+}
+
+// get the migration status of the partitions from the leaders, the partition is missing if
+// the leader is unknown or no migration running on the leader
+func getPartitionReshardStatus(ns string, parts map[int]cluster.PartitionMetaInfo, pidList []int) map[int]common.PartitionReshardStatus {
+	nodeStatus := make(map[string]map[string]common.PartitionReshardStatus)
+	status := make(map[int]common.PartitionReshardStatus, len(pidList))
+	for _, pid := range pidList {
+		p, ok := parts[pid]
+		if !ok || p.GetRealLeader() == "" {
+			continue
+		}
+		leader := p.GetRealLeader()
+		rsp, ok := nodeStatus[leader]
+		if !ok {
+			ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(leader)
+			_, err := common.APIRequest("GET",
+				"http://"+net.JoinHostPort(ip, httpPort)+common.APIReshardStatus+"/"+ns,
+				nil, time.Second*5, &rsp)
+			if err != nil {
+				cluster.CoordLog().Infof("failed to get reshard status of %v from node %v: %v", ns, leader, err)
+			}
+			nodeStatus[leader] = rsp
+		}
+		if s, ok := rsp[p.GetDesp()]; ok {
+			status[pid] = s
+		}
+	}
+	return status
+}
+
+// the partitions migrating the data in the expanding state
+func getExpandingPartitions(meta *cluster.NamespaceMetaInfo) []int {
+	pidList := make([]int, 0, meta.PartitionNum)
+	for pid := 0; pid < meta.PartitionNum; pid++ {
+		pidList = append(pidList, pid)
+	}
+	return pidList
+}
+
+// GetNamespaceExpandStatus return the expanding state and the migration status of the namespace
+func (pdCoord *PDCoordinator) GetNamespaceExpandStatus(ns string) (*NamespaceExpandStatus, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	parts, ok := allNamespaces[ns]
+	if !ok || len(parts) == 0 {
+		return nil, cluster.ErrKeyNotFound
+	}
+	var meta cluster.NamespaceMetaInfo
+	for _, p := range parts {
+		meta = p.NamespaceMetaInfo
+		break
+	}
+	st := &NamespaceExpandStatus{
+		PartitionNum:       meta.PartitionNum,
+		ExpandPartitionNum: meta.ExpandPartitionNum,
+		ExpandState:        meta.ExpandState,
+		Partitions:         make([]common.PartitionReshardStatus, 0),
+	}
+	if meta.ExpandState == "" {
+		return st, nil
+	}
+	pidList := getExpandingPartitions(&meta)
+	status := getPartitionReshardStatus(ns, parts, pidList)
+	for _, pid := range pidList {
+		if s, ok := status[pid]; ok {
+			st.Partitions = append(st.Partitions, s)
+		}
+	}
+	return st, nil
+}
+
+// nextExpandState return the next state if all the partitions finished the migration for the state
+func nextExpandState(meta cluster.NamespaceMetaInfo, status map[int]common.PartitionReshardStatus) (cluster.NamespaceMetaInfo, bool) {
+	for _, pid := range getExpandingPartitions(&meta) {
+		s, ok := status[pid]
+		if !ok || s.State != meta.ExpandState || !s.Done {
+			return meta, false
+		}
+	}
+	switch meta.ExpandState {
+	case common.ExpandStateCopying:
+		meta.ExpandState = common.ExpandStateSwitching
+	case common.ExpandStateSwitching:
+		merging := meta.ExpandPartitionNum < meta.PartitionNum
+		meta.PartitionNum = meta.ExpandPartitionNum
+		meta.ExpandPartitionNum = 0
+		meta.ExpandState = common.ExpandStateCleaning
+		// the merged partitions will be removed, no key to clean
+		if merging {
+			meta.ExpandState = ""
+		}
+	case common.ExpandStateCleaning:
+		meta.ExpandState = ""
+	default:
+		return meta, false
+	}
+	return meta, true
+}
+
+func (pdCoord *PDCoordinator) checkNamespaceExpansion(monitorChan chan struct{}, ns string,
+	parts map[int]cluster.PartitionMetaInfo) {
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil || meta.ExpandState == "" {
+		return
+	}
+	merging := meta.ExpandPartitionNum < meta.PartitionNum
+	if merging && meta.ExpandState == common.ExpandStateCopying &&
+		!pdCoord.colocateMergingPartitions(monitorChan, &meta, parts) {
+		return
+	}
+	status := getPartitionReshardStatus(ns, parts, getExpandingPartitions(&meta))
+	newMeta, changed := nextExpandState(meta, status)
+	if !changed {
+		cluster.CoordLog().Debugf("namespace %v expanding in state %v: %v", ns, meta.ExpandState, status)
+		return
+	}
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &newMeta, meta.MetaEpoch())
+	if err != nil {
+		cluster.CoordLog().Infof("update namespace %v meta failed: %v", ns, err)
+		return
+	}
+	cluster.CoordLog().Infof("namespace %v expanding state changed from %v to %v, partition num: %v", ns,
+		meta.ExpandState, newMeta.ExpandState, newMeta.PartitionNum)
+	if merging && newMeta.PartitionNum < meta.PartitionNum {
+		for pid := newMeta.PartitionNum; pid < meta.PartitionNum; pid++ {
+			err := pdCoord.deleteNamespacePartition(ns, pid)
+			if err != nil {
+				cluster.CoordLog().Infof("failed to delete merged partition %v for namespace: %v, err:%v", pid, ns, err)
+			}
+		}
+	}
+}
+
+// handleNamespaceExpansion drive the expanding state of the namespaces by the migration status
+func (pdCoord *PDCoordinator) handleNamespaceExpansion(monitorChan chan struct{}) {
+	ticker := time.NewTicker(expandCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			if !pdCoord.IsMineLeader() {
+				continue
+			}
+			allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+			if err != nil {
+				continue
+			}
+			for ns, parts := range allNamespaces {
+				for _, p := range parts {
+					if p.ExpandState != "" {
+						pdCoord.checkNamespaceExpansion(monitorChan, ns, parts)
+					}
+					break
+				}
+			}
+		}
+	}
+}
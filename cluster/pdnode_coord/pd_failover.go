@@ -0,0 +1,247 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var (
+	ErrFailoverPolicyInvalid = errors.New("the failover policy is invalid")
+	ErrFailoverNotPending    = errors.New("the failover is not waiting for confirmation")
+)
+
+// FailoverPolicy decide when and how many replicas on the failed nodes will be re-created
+// on the other nodes.
+type FailoverPolicy struct {
+	// the node lost less than this is not regarded as down to avoid the
+	// failover while the node is restarting, 0 means the node is down once lost
+	NodeDownThresholdSecs int64 `json:"node_down_threshold_secs"`
+	// wait the failed replica back before re-creating it on other nodes,
+	// 0 means the default
+	MigrateGraceSecs int64 `json:"migrate_grace_secs"`
+	// the grace period while the quorum of the replicas are failed,
+	// 0 means the default
+	EmergencyGraceSecs int64 `json:"emergency_grace_secs"`
+	// the max number of the partitions recovering from the failed nodes at the
+	// same time, 0 means no limit
+	MaxRecoveries int `json:"max_recoveries"`
+	// if the data nodes in cluster is not more than this, the failover moving
+	// data need the confirmation from the operator, 0 means never
+	ConfirmMaxNodes int `json:"confirm_max_nodes"`
+}
+
+func (fp *FailoverPolicy) validate() error {
+	if fp.NodeDownThresholdSecs < 0 || fp.MigrateGraceSecs < 0 || fp.EmergencyGraceSecs < 0 ||
+		fp.MaxRecoveries < 0 || fp.ConfirmMaxNodes < 0 {
+		return ErrFailoverPolicyInvalid
+	}
+	return nil
+}
+
+func (fp *FailoverPolicy) nodeDownThreshold() time.Duration {
+	return time.Duration(fp.NodeDownThresholdSecs) * time.Second
+}
+
+func (fp *FailoverPolicy) migrateGrace() time.Duration {
+	if fp.MigrateGraceSecs == 0 {
+		return waitMigrateInterval
+	}
+	return time.Duration(fp.MigrateGraceSecs) * time.Second
+}
+
+func (fp *FailoverPolicy) emergencyGrace() time.Duration {
+	if fp.EmergencyGraceSecs == 0 {
+		return waitEmergencyMigrateInterval
+	}
+	return time.Duration(fp.EmergencyGraceSecs) * time.Second
+}
+
+func (fp *FailoverPolicy) needConfirm(nodeNum int) bool {
+	return fp.ConfirmMaxNodes > 0 && nodeNum <= fp.ConfirmMaxNodes
+}
+
+// PendingFailover is the failover waiting for the confirmation from the operator
+type PendingFailover struct {
+	Namespace   string    `json:"namespace"`
+	Partition   int       `json:"partition"`
+	LostNodes   []string  `json:"lost_nodes"`
+	FailedTime  time.Time `json:"failed_time"`
+	Confirmed   bool      `json:"confirmed"`
+	ConfirmTime time.Time `json:"confirm_time,omitempty"`
+}
+
+// SetFailoverPolicy change the failover policy of the cluster
+func (pdCoord *PDCoordinator) SetFailoverPolicy(fp FailoverPolicy) error {
+	if err := fp.validate(); err != nil {
+		return err
+	}
+	pdCoord.failoverMutex.Lock()
+	pdCoord.failoverPolicy = fp
+	pdCoord.failoverMutex.Unlock()
+	cluster.CoordLog().Infof("failover policy changed to: %v", fp)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) GetFailoverPolicy() FailoverPolicy {
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	return pdCoord.failoverPolicy
+}
+
+// GetPendingFailovers return the failovers waiting for the confirmation and the confirmed
+// failovers not finished.
+func (pdCoord *PDCoordinator) GetPendingFailovers() []PendingFailover {
+	pdCoord.failoverMutex.Lock()
+	pendings := make([]PendingFailover, 0, len(pdCoord.pendingFailovers))
+	for _, pf := range pdCoord.pendingFailovers {
+		pendings = append(pendings, *pf)
+	}
+	pdCoord.failoverMutex.Unlock()
+	sort.Slice(pendings, func(i, j int) bool {
+		if pendings[i].Namespace == pendings[j].Namespace {
+			return pendings[i].Partition < pendings[j].Partition
+		}
+		return pendings[i].Namespace < pendings[j].Namespace
+	})
+	return pendings
+}
+
+// ConfirmFailover allow the pending failover of the namespace partition to move the data,
+// all the pending failovers of the namespace will be confirmed if the partition is negative.
+func (pdCoord *PDCoordinator) ConfirmFailover(ns string, pid int) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while confirm failover")
+		return ErrNotLeader
+	}
+	pdCoord.failoverMutex.Lock()
+	confirmed := 0
+	for _, pf := range pdCoord.pendingFailovers {
+		if pf.Namespace != ns || (pid >= 0 && pf.Partition != pid) || pf.Confirmed {
+			continue
+		}
+		pf.Confirmed = true
+		pf.ConfirmTime = time.Now()
+		confirmed++
+	}
+	pdCoord.failoverMutex.Unlock()
+	if confirmed == 0 {
+		return ErrFailoverNotPending
+	}
+	cluster.CoordLog().Infof("failover of namespace %v-%v confirmed: %v", ns, pid, confirmed)
+	go pdCoord.triggerCheckNamespaces("", 0, 0)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) markNodesLost(lost []string, joined []string) {
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	if pdCoord.lostNodes == nil {
+		pdCoord.lostNodes = make(map[string]time.Time)
+	}
+	for _, nid := range lost {
+		pdCoord.lostNodes[nid] = time.Now()
+	}
+	for _, nid := range joined {
+		delete(pdCoord.lostNodes, nid)
+	}
+}
+
+// isNodeDown check if the lost node is lost long enough to be regarded as down,
+// the node lost before we watched is always down.
+func (pdCoord *PDCoordinator) isNodeDown(nid string, fp *FailoverPolicy) bool {
+	if fp.NodeDownThresholdSecs == 0 {
+		return true
+	}
+	pdCoord.failoverMutex.Lock()
+	lostTime, ok := pdCoord.lostNodes[nid]
+	pdCoord.failoverMutex.Unlock()
+	return !ok || time.Since(lostTime) >= fp.nodeDownThreshold()
+}
+
+// checkFailoverConfirmed return true if the failover of the partition can move data,
+// or the failover will be waiting for the confirmation.
+func (pdCoord *PDCoordinator) checkFailoverConfirmed(nsInfo *cluster.PartitionMetaInfo,
+	lostNodes []string, failedTime time.Time) bool {
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	if pdCoord.pendingFailovers == nil {
+		pdCoord.pendingFailovers = make(map[string]*PendingFailover)
+	}
+	pf, ok := pdCoord.pendingFailovers[nsInfo.GetDesp()]
+	if ok {
+		pf.LostNodes = lostNodes
+		return pf.Confirmed
+	}
+	cluster.CoordLog().Warningf("failover of namespace %v for lost nodes %v need be confirmed", nsInfo.GetDesp(), lostNodes)
+	pdCoord.pendingFailovers[nsInfo.GetDesp()] = &PendingFailover{
+		Namespace:  nsInfo.Name,
+		Partition:  nsInfo.Partition,
+		LostNodes:  lostNodes,
+		FailedTime: failedTime,
+	}
+	return false
+}
+
+// canStartRecovery check if the recovering partitions reach the max limit
+func (pdCoord *PDCoordinator) canStartRecovery(nsInfo *cluster.PartitionMetaInfo, fp *FailoverPolicy) bool {
+	if fp.MaxRecoveries == 0 {
+		return true
+	}
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	if _, ok := pdCoord.recoverings[nsInfo.GetDesp()]; ok {
+		return true
+	}
+	return len(pdCoord.recoverings) < fp.MaxRecoveries
+}
+
+func (pdCoord *PDCoordinator) startRecovery(nsInfo *cluster.PartitionMetaInfo) {
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	if pdCoord.recoverings == nil {
+		pdCoord.recoverings = make(map[string]time.Time)
+	}
+	if _, ok := pdCoord.recoverings[nsInfo.GetDesp()]; !ok {
+		pdCoord.recoverings[nsInfo.GetDesp()] = time.Now()
+	}
+}
+
+// finishFailover clean the recovering and the pending state after the partition
+// has all the replicas ready.
+func (pdCoord *PDCoordinator) finishFailover(ns string, pid int) {
+	desp := common.GetNsDesp(ns, pid)
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	if start, ok := pdCoord.recoverings[desp]; ok {
+		cluster.CoordLog().Infof("namespace %v recovered from failover, cost: %v", desp, time.Since(start))
+		delete(pdCoord.recoverings, desp)
+	}
+	delete(pdCoord.pendingFailovers, desp)
+}
+
+// clean the failover state of the partitions not exist anymore
+func (pdCoord *PDCoordinator) cleanFailoverState(checked map[string]bool) {
+	pdCoord.failoverMutex.Lock()
+	defer pdCoord.failoverMutex.Unlock()
+	for desp := range pdCoord.recoverings {
+		if !checked[desp] {
+			delete(pdCoord.recoverings, desp)
+		}
+	}
+	for desp := range pdCoord.pendingFailovers {
+		if !checked[desp] {
+			delete(pdCoord.pendingFailovers, desp)
+		}
+	}
+}
+
+func (pdCoord *PDCoordinator) resetFailoverState() {
+	pdCoord.failoverMutex.Lock()
+	pdCoord.recoverings = nil
+	pdCoord.pendingFailovers = nil
+	pdCoord.failoverMutex.Unlock()
+}
@@ -84,18 +84,10 @@ func (pdCoord *PDCoordinator) doCheckNamespacesForLearner(monitorChan chan struc
 			pdCoord.updateNsLearnerLeader(&nsInfo, newMaster)
 		}
 
-		// add new learner for new learner node
-		for _, node := range learnerNodes {
-			found := false
-			for _, nid := range learnerIDs {
-				if nid == node.GetID() {
-					found = true
-					break
-				}
-			}
-			if !found {
-				pdCoord.addNsLearnerToNode(&nsInfo, node.GetID())
-			}
+		// add new learner for new learner node, the learner nodes are filtered by the placement rules
+		adding, _ := decideRuleLearners(nsInfo.PlacementRules, pdCoord.learnerRole, learnerIDs, learnerNodes)
+		for _, nid := range adding {
+			pdCoord.addNsLearnerToNode(&nsInfo, nid)
 		}
 	}
 }
@@ -0,0 +1,182 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var (
+	ErrMigrationNotFound = errors.New("no migration running for the namespace partition")
+	ErrMigrationCanceled = errors.New("the migration is canceled")
+)
+
+// PartitionMigration is the replica moving of the partition, the new replica is added and
+// the old replica is removed after the new replica catch up the snapshot and the logs.
+type PartitionMigration struct {
+	ID        int64     `json:"id"`
+	Namespace string    `json:"namespace"`
+	Partition int       `json:"partition"`
+	Target    string    `json:"target"`
+	StartTime time.Time `json:"start_time"`
+	Paused    bool      `json:"paused"`
+	Canceled  bool      `json:"canceled"`
+	// the snapshot transferring progress on the target node, nil if not transferring
+	Transfer *common.SnapTransferStats `json:"transfer,omitempty"`
+}
+
+// return true if the migration is new added
+func (dp *DataPlacement) startMigration(nsInfo *cluster.PartitionMetaInfo, target string) bool {
+	dp.migrationMutex.Lock()
+	defer dp.migrationMutex.Unlock()
+	if _, ok := dp.migrations[nsInfo.GetDesp()]; ok {
+		return false
+	}
+	dp.migrations[nsInfo.GetDesp()] = &PartitionMigration{
+		ID:        atomic.AddInt64(&dp.operatorID, 1),
+		Namespace: nsInfo.Name,
+		Partition: nsInfo.Partition,
+		Target:    target,
+		StartTime: time.Now(),
+	}
+	return true
+}
+
+func (dp *DataPlacement) endMigration(nsInfo *cluster.PartitionMetaInfo, err error) {
+	dp.migrationMutex.Lock()
+	m, ok := dp.migrations[nsInfo.GetDesp()]
+	delete(dp.migrations, nsInfo.GetDesp())
+	dp.migrationMutex.Unlock()
+	if !ok {
+		return
+	}
+	dp.auditOperator(OperatorAuditRecord{
+		ID:        m.ID,
+		Type:      OperatorAddReplica,
+		Namespace: m.Namespace,
+		Partition: m.Partition,
+		Node:      m.Target,
+		StartTime: m.StartTime,
+		Result:    operatorResult(err),
+	})
+	if m.Paused {
+		// the pause on the target node should not affect the later migration
+		sendSnapTransferCtrl(m.Target, "resume", nsInfo.GetDesp())
+	}
+}
+
+func (dp *DataPlacement) isMigrationCanceled(nsInfo *cluster.PartitionMetaInfo) bool {
+	dp.migrationMutex.Lock()
+	defer dp.migrationMutex.Unlock()
+	m, ok := dp.migrations[nsInfo.GetDesp()]
+	return ok && m.Canceled
+}
+
+func (dp *DataPlacement) getMigration(ns string, pid int) (PartitionMigration, bool) {
+	dp.migrationMutex.Lock()
+	defer dp.migrationMutex.Unlock()
+	m, ok := dp.migrations[common.GetNsDesp(ns, pid)]
+	if !ok {
+		return PartitionMigration{}, false
+	}
+	return *m, true
+}
+
+func sendSnapTransferCtrl(nid string, action string, fullName string) error {
+	ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nid)
+	_, err := common.APIRequest("POST",
+		"http://"+net.JoinHostPort(ip, httpPort)+common.APISnapTransfer+"/"+action+"/"+fullName,
+		nil, time.Second*5, nil)
+	if err != nil {
+		cluster.CoordLog().Infof("failed to %v snapshot transfer %v on node %v: %v", action, fullName, nid, err)
+	}
+	return err
+}
+
+// GetPartitionMigrations return the running migrations with the snapshot transferring progress
+func (pdCoord *PDCoordinator) GetPartitionMigrations() []PartitionMigration {
+	dp := pdCoord.dpm
+	dp.migrationMutex.Lock()
+	migrations := make([]PartitionMigration, 0, len(dp.migrations))
+	for _, m := range dp.migrations {
+		migrations = append(migrations, *m)
+	}
+	dp.migrationMutex.Unlock()
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].StartTime.Before(migrations[j].StartTime)
+	})
+
+	nodeStats := make(map[string][]common.SnapTransferStats)
+	for i, m := range migrations {
+		stats, ok := nodeStats[m.Target]
+		if !ok {
+			var rsp struct {
+				Incoming []common.SnapTransferStats `json:"incoming"`
+			}
+			ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(m.Target)
+			_, err := common.APIRequest("GET",
+				"http://"+net.JoinHostPort(ip, httpPort)+common.APISnapTransfer+"/stats",
+				nil, time.Second*5, &rsp)
+			if err != nil {
+				cluster.CoordLog().Infof("failed to get snapshot transfer stats from node %v: %v", m.Target, err)
+			}
+			stats = rsp.Incoming
+			nodeStats[m.Target] = stats
+		}
+		fullName := common.GetNsDesp(m.Namespace, m.Partition)
+		for idx := range stats {
+			if stats[idx].Name == fullName {
+				migrations[i].Transfer = &stats[idx]
+				break
+			}
+		}
+	}
+	return migrations
+}
+
+// PausePartitionMigration pause or resume the snapshot transferring of the migration, the
+// migration will keep waiting while paused.
+func (pdCoord *PDCoordinator) PausePartitionMigration(ns string, pid int, paused bool) error {
+	m, ok := pdCoord.dpm.getMigration(ns, pid)
+	if !ok {
+		return ErrMigrationNotFound
+	}
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	err := sendSnapTransferCtrl(m.Target, action, common.GetNsDesp(ns, pid))
+	if err != nil {
+		return err
+	}
+	pdCoord.dpm.migrationMutex.Lock()
+	if cur, ok := pdCoord.dpm.migrations[common.GetNsDesp(ns, pid)]; ok {
+		cur.Paused = paused
+	}
+	pdCoord.dpm.migrationMutex.Unlock()
+	cluster.CoordLog().Infof("migration of namespace %v-%v to node %v paused: %v", ns, pid, m.Target, paused)
+	return nil
+}
+
+// CancelPartitionMigration cancel the migration, the new added replica will be removed
+// and the old replica is kept.
+func (pdCoord *PDCoordinator) CancelPartitionMigration(ns string, pid int) error {
+	pdCoord.dpm.migrationMutex.Lock()
+	m, ok := pdCoord.dpm.migrations[common.GetNsDesp(ns, pid)]
+	if ok {
+		m.Canceled = true
+	}
+	pdCoord.dpm.migrationMutex.Unlock()
+	if !ok {
+		return ErrMigrationNotFound
+	}
+	// stop the transferring early, the transfer may be not started or already done
+	sendSnapTransferCtrl(m.Target, "cancel", common.GetNsDesp(ns, pid))
+	cluster.CoordLog().Infof("migration of namespace %v-%v to node %v is canceling", ns, pid, m.Target)
+	return nil
+}
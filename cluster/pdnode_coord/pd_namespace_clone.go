@@ -0,0 +1,348 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	// the target partitions are waiting ready and restoring the source checkpoints
+	NamespaceCloneStateCloning = "cloning"
+	NamespaceCloneStateDone    = "done"
+	NamespaceCloneStateFailed  = "failed"
+)
+
+// the clone status of the target partition returned by the data node while restored
+const partitionCloneDone = "done"
+
+var (
+	namespaceCloneCheckInterval = time.Second * 5
+	namespaceCloneTimeout       = time.Hour * 2
+)
+
+var (
+	ErrNamespaceNameUsed = errors.New("the namespace name is already used")
+	ErrNamespaceCloning  = errors.New("the namespace is cloning")
+)
+
+// PartitionCloneStatus is the clone progress of the target partition, the data is restored
+// from the checkpoint (term-index) of the source partition on the source node.
+type PartitionCloneStatus struct {
+	Partition  int    `json:"partition"`
+	SourceNode string `json:"source_node"`
+	Term       uint64 `json:"term"`
+	Index      uint64 `json:"index"`
+	Status     string `json:"status"`
+}
+
+type NamespaceCloneStatus struct {
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	State      string                 `json:"state"`
+	StartTime  time.Time              `json:"start_time"`
+	EndTime    time.Time              `json:"end_time,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Partitions []PartitionCloneStatus `json:"partitions"`
+}
+
+// FindNamespaceByAlias return the namespace renamed to the alias name, empty if not found.
+func FindNamespaceByAlias(allNamespaces map[string]map[int]cluster.PartitionMetaInfo, alias string) string {
+	if alias == "" {
+		return ""
+	}
+	for ns, parts := range allNamespaces {
+		for _, p := range parts {
+			if p.AliasName == alias {
+				return ns
+			}
+			break
+		}
+	}
+	return ""
+}
+
+func isNamespaceNameUsed(allNamespaces map[string]map[int]cluster.PartitionMetaInfo, name string) bool {
+	if _, ok := allNamespaces[name]; ok {
+		return true
+	}
+	return FindNamespaceByAlias(allNamespaces, name) != ""
+}
+
+// RenameNamespace rename the namespace without moving any data. The new name is saved as the
+// alias of the namespace, and the clients can access the namespace by both the names. The
+// empty name (or the origin name) remove the alias.
+func (pdCoord *PDCoordinator) RenameNamespace(ns string, newName string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while rename namespace")
+		return ErrNotLeader
+	}
+	if newName == ns {
+		newName = ""
+	}
+	if newName != "" && !common.IsValidNamespaceName(newName) {
+		return errors.New("invalid namespace name")
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	if _, ok := allNamespaces[ns]; !ok {
+		return fmt.Errorf("namespace %v not found", ns)
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if meta.AliasName == newName {
+		return nil
+	}
+	if newName != "" && isNamespaceNameUsed(allNamespaces, newName) {
+		return ErrNamespaceNameUsed
+	}
+	cluster.CoordLog().Infof("rename namespace %v from %v to %v", ns, meta.AliasName, newName)
+	meta.AliasName = newName
+	return pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+}
+
+// CloneNamespace copy all the data of the source namespace to the target namespace. The
+// source partitions are backed up at the same time and the target partitions restore the
+// data from the backup checkpoints. The target namespace is created with the same meta if
+// not exist, and the tags can be given to place the target on the different nodes. The
+// data of the existing target namespace will be replaced, so the target can be refreshed.
+func (pdCoord *PDCoordinator) CloneNamespace(src string, target string, tags map[string]interface{}) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while clone namespace")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(target) || src == target {
+		return errors.New("invalid namespace name")
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	srcMeta, err := pdCoord.register.GetNamespaceMetaInfo(src)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", src, err)
+		return err
+	}
+	if srcMeta.ExpandState != "" {
+		return errors.New("the source namespace is expanding")
+	}
+	_, exist := allNamespaces[target]
+	if exist {
+		targetMeta, err := pdCoord.register.GetNamespaceMetaInfo(target)
+		if err != nil {
+			return err
+		}
+		if targetMeta.PartitionNum != srcMeta.PartitionNum || targetMeta.ExpandState != "" {
+			return errors.New("the partition number of the target namespace mismatch")
+		}
+	} else if FindNamespaceByAlias(allNamespaces, target) != "" {
+		return ErrNamespaceNameUsed
+	}
+
+	pdCoord.cloneMutex.Lock()
+	if st, ok := pdCoord.clones[target]; ok && st.State == NamespaceCloneStateCloning {
+		pdCoord.cloneMutex.Unlock()
+		return ErrNamespaceCloning
+	}
+	st := &NamespaceCloneStatus{
+		Source:    src,
+		Target:    target,
+		State:     NamespaceCloneStateCloning,
+		StartTime: time.Now(),
+	}
+	pdCoord.clones[target] = st
+	pdCoord.cloneMutex.Unlock()
+
+	partitions, err := pdCoord.prepareNamespaceClone(src, target, exist, srcMeta, tags)
+	pdCoord.cloneMutex.Lock()
+	defer pdCoord.cloneMutex.Unlock()
+	if err != nil {
+		st.State = NamespaceCloneStateFailed
+		st.EndTime = time.Now()
+		st.Error = err.Error()
+		return err
+	}
+	st.Partitions = partitions
+	cluster.CoordLog().Infof("begin clone namespace %v to %v", src, target)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) prepareNamespaceClone(src string, target string, exist bool,
+	srcMeta cluster.NamespaceMetaInfo, tags map[string]interface{}) ([]PartitionCloneStatus, error) {
+	manifest, err := pdCoord.BackupCluster([]string{src}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !manifest.Complete {
+		return nil, errors.New("backup the source namespace failed")
+	}
+	partitions := make([]PartitionCloneStatus, 0, srcMeta.PartitionNum)
+	for _, info := range manifest.Namespaces[src].Partitions {
+		partitions = append(partitions, PartitionCloneStatus{
+			Partition:  info.Partition,
+			SourceNode: info.Node,
+			Term:       info.Term,
+			Index:      info.Index,
+		})
+	}
+	if exist {
+		return partitions, nil
+	}
+	meta := srcMeta
+	meta.AliasName = ""
+	meta.ExpandPartitionNum = 0
+	if tags != nil {
+		meta.Tags = tags
+		// the rules of the source may not match the nodes with the new tags
+		meta.PlacementRules = nil
+	}
+	err = pdCoord.CreateNamespace(target, meta)
+	if err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// GetNamespaceCloneStatus return the clone progress of the target namespace, or all the
+// clones if the target is empty.
+func (pdCoord *PDCoordinator) GetNamespaceCloneStatus(target string) []NamespaceCloneStatus {
+	pdCoord.cloneMutex.Lock()
+	defer pdCoord.cloneMutex.Unlock()
+	statusList := make([]NamespaceCloneStatus, 0, len(pdCoord.clones))
+	for ns, st := range pdCoord.clones {
+		if target != "" && ns != target {
+			continue
+		}
+		cp := *st
+		cp.Partitions = append([]PartitionCloneStatus(nil), st.Partitions...)
+		statusList = append(statusList, cp)
+	}
+	sort.Slice(statusList, func(i, j int) bool {
+		return statusList[i].StartTime.Before(statusList[j].StartTime)
+	})
+	return statusList
+}
+
+func (pdCoord *PDCoordinator) handleNamespaceClones(monitorChan chan struct{}) {
+	cluster.CoordLog().Debugf("start handle the namespace clones.")
+	defer func() {
+		cluster.CoordLog().Infof("stop handle the namespace clones.")
+	}()
+	ticker := time.NewTicker(namespaceCloneCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			pdCoord.cloneMutex.Lock()
+			clones := make([]NamespaceCloneStatus, 0, len(pdCoord.clones))
+			for _, st := range pdCoord.clones {
+				// the partitions are not ready until the source backup done
+				if st.State == NamespaceCloneStateCloning && len(st.Partitions) > 0 {
+					cp := *st
+					cp.Partitions = append([]PartitionCloneStatus(nil), st.Partitions...)
+					clones = append(clones, cp)
+				}
+			}
+			pdCoord.cloneMutex.Unlock()
+			for i := range clones {
+				pdCoord.checkNamespaceClone(&clones[i])
+			}
+		}
+	}
+}
+
+// checkNamespaceClone restore the target partitions which are ready from the source checkpoints
+func (pdCoord *PDCoordinator) checkNamespaceClone(st *NamespaceCloneStatus) {
+	if pdCoord.register == nil {
+		return
+	}
+	state := NamespaceCloneStateCloning
+	errMsg := ""
+	parts, err := pdCoord.register.GetNamespaceInfo(st.Target)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace %v info failed: %v", st.Target, err)
+		if err == cluster.ErrKeyNotFound {
+			state = NamespaceCloneStateFailed
+			errMsg = "the target namespace is deleted"
+		}
+	}
+	partInfos := make(map[int]*cluster.PartitionMetaInfo, len(parts))
+	for i := range parts {
+		partInfos[parts[i].Partition] = &parts[i]
+	}
+	done := 0
+	for i := range st.Partitions {
+		ps := &st.Partitions[i]
+		if ps.Status == partitionCloneDone {
+			done++
+			continue
+		}
+		pinfo, ok := partInfos[ps.Partition]
+		if !ok || pinfo.GetRealLeader() == "" {
+			continue
+		}
+		if ready, _ := IsAllISRFullReady(pinfo); !ready || len(pinfo.GetISR()) < pinfo.Replica {
+			continue
+		}
+		status, err := sendNamespaceClone(pinfo.GetRealLeader(), pinfo.GetDesp(), st.Source, ps)
+		if err != nil {
+			cluster.CoordLog().Infof("clone namespace %v from %v failed: %v", pinfo.GetDesp(), st.Source, err)
+			continue
+		}
+		ps.Status = status
+		if status == partitionCloneDone {
+			done++
+		}
+	}
+	if state == NamespaceCloneStateCloning {
+		if done == len(st.Partitions) {
+			state = NamespaceCloneStateDone
+		} else if time.Since(st.StartTime) > namespaceCloneTimeout {
+			state = NamespaceCloneStateFailed
+			errMsg = "clone timeout"
+		}
+	}
+
+	pdCoord.cloneMutex.Lock()
+	defer pdCoord.cloneMutex.Unlock()
+	cur, ok := pdCoord.clones[st.Target]
+	if !ok || cur.StartTime != st.StartTime {
+		return
+	}
+	cur.Partitions = st.Partitions
+	cur.State = state
+	if state != NamespaceCloneStateCloning {
+		cur.EndTime = time.Now()
+		cur.Error = errMsg
+		cluster.CoordLog().Infof("clone namespace %v to %v finished: %v %v", st.Source, st.Target, state, errMsg)
+	}
+}
+
+func sendNamespaceClone(nid string, fullName string, src string, ps *PartitionCloneStatus) (string, error) {
+	ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(nid)
+	var rsp struct {
+		Status string `json:"status"`
+	}
+	_, err := common.APIRequest("POST",
+		fmt.Sprintf("http://%s%s/%s?source=%s&node=%s&term=%d&index=%d", net.JoinHostPort(ip, httpPort),
+			common.APICloneNamespace, fullName, common.GetNsDesp(src, ps.Partition), url.QueryEscape(ps.SourceNode),
+			ps.Term, ps.Index),
+		nil, time.Second*10, &rsp)
+	if err != nil {
+		return "", err
+	}
+	return rsp.Status, nil
+}
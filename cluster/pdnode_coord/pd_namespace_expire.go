@@ -0,0 +1,167 @@
+package pdnode_coord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	// the expired namespace will be deleted after the grace period
+	defaultNamespaceExpireGrace = time.Hour
+	namespaceExpireHookTimeout  = time.Second * 10
+)
+
+var namespaceExpireCheckInterval = time.Second * 30
+
+var errNamespaceExpireTimePassed = errors.New("the namespace expire time should be in the future")
+
+const (
+	NamespaceExpireEventExpired = "expired"
+	NamespaceExpireEventDeleted = "deleted"
+)
+
+// NamespaceExpireEvent is posted as json to the expire hook while the namespace
+// is expired and deleted
+type NamespaceExpireEvent struct {
+	Event      string    `json:"event"`
+	Namespace  string    `json:"namespace"`
+	ExpireTime time.Time `json:"expire_time"`
+	DeleteTime time.Time `json:"delete_time"`
+}
+
+// SetNamespaceExpireTime change the expire time of the namespace, the namespace will never be
+// expired if the time is zero. The expired namespace can be extended before deleted.
+func (pdCoord *PDCoordinator) SetNamespaceExpireTime(ns string, expireTime time.Time) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while set namespace expire time")
+		return ErrNotLeader
+	}
+	if !expireTime.IsZero() && !expireTime.After(time.Now()) {
+		return errNamespaceExpireTimePassed
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if expireTime.IsZero() {
+		meta.ExpireTime = 0
+	} else {
+		meta.ExpireTime = expireTime.Unix()
+	}
+	// the new expire time should be notified again
+	meta.ExpireNotifiedTime = 0
+	err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+	if err != nil {
+		return err
+	}
+	cluster.CoordLog().Infof("namespace %v expire time changed to %v", ns, expireTime)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) namespaceExpireGrace() time.Duration {
+	if pdCoord.expireGrace > 0 {
+		return pdCoord.expireGrace
+	}
+	return defaultNamespaceExpireGrace
+}
+
+// decide the action for the namespace with the expire time, the expired namespace
+// should be notified first and then deleted after the grace period since notified, so
+// the owner always has the grace period to extend the namespace even if pd was down.
+func getNamespaceExpireAction(expireTime int64, notifiedTime int64, grace time.Duration, now time.Time) string {
+	if expireTime <= 0 || now.Before(time.Unix(expireTime, 0)) {
+		return ""
+	}
+	if notifiedTime <= 0 {
+		return NamespaceExpireEventExpired
+	}
+	if now.Before(time.Unix(notifiedTime, 0).Add(grace)) {
+		return ""
+	}
+	return NamespaceExpireEventDeleted
+}
+
+func (pdCoord *PDCoordinator) handleNamespaceExpiry(monitorChan chan struct{}) {
+	ticker := time.NewTicker(namespaceExpireCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			pdCoord.checkExpiredNamespaces(time.Now())
+		}
+	}
+}
+
+func (pdCoord *PDCoordinator) checkExpiredNamespaces(now time.Time) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return
+	}
+	grace := pdCoord.namespaceExpireGrace()
+	pdCoord.expireMutex.Lock()
+	defer pdCoord.expireMutex.Unlock()
+	for ns, parts := range allNamespaces {
+		var expireTime, notifiedTime int64
+		for _, p := range parts {
+			expireTime = p.ExpireTime
+			notifiedTime = p.ExpireNotifiedTime
+			break
+		}
+		ev := NamespaceExpireEvent{
+			Namespace:  ns,
+			ExpireTime: time.Unix(expireTime, 0),
+			DeleteTime: time.Unix(notifiedTime, 0).Add(grace),
+		}
+		switch getNamespaceExpireAction(expireTime, notifiedTime, grace, now) {
+		case NamespaceExpireEventExpired:
+			meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+			if err != nil {
+				continue
+			}
+			if meta.ExpireTime != expireTime || meta.ExpireNotifiedTime > 0 {
+				continue
+			}
+			// save the notified time first, so the namespace will not be deleted before
+			// the grace period even if the pd leader changed.
+			meta.ExpireNotifiedTime = now.Unix()
+			err = pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+			if err != nil {
+				cluster.CoordLog().Infof("save the namespace %v expire notified time failed: %v", ns, err)
+				continue
+			}
+			ev.DeleteTime = now.Add(grace)
+			cluster.CoordLog().Infof("namespace %v expired, will be deleted at %v", ns, ev.DeleteTime)
+			ev.Event = NamespaceExpireEventExpired
+			go pdCoord.notifyNamespaceExpire(ev)
+		case NamespaceExpireEventDeleted:
+			cluster.CoordLog().Infof("deleting the expired namespace %v, expired at %v, notified at %v",
+				ns, ev.ExpireTime, time.Unix(notifiedTime, 0))
+			err := pdCoord.DeleteNamespace(ns, "**")
+			if err != nil {
+				cluster.CoordLog().Infof("delete the expired namespace %v failed: %v", ns, err)
+				continue
+			}
+			ev.Event = NamespaceExpireEventDeleted
+			go pdCoord.notifyNamespaceExpire(ev)
+		}
+	}
+}
+
+func (pdCoord *PDCoordinator) notifyNamespaceExpire(ev NamespaceExpireEvent) {
+	if pdCoord.expireHook == "" {
+		return
+	}
+	body, _ := json.Marshal(ev)
+	_, err := common.APIRequest("POST", pdCoord.expireHook, bytes.NewReader(body), namespaceExpireHookTimeout, nil)
+	if err != nil {
+		cluster.CoordLog().Infof("notify the namespace %v %v failed: %v", ev.Namespace, ev.Event, err)
+	}
+}
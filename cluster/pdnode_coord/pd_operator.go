@@ -0,0 +1,202 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	OperatorAddReplica     = "add_replica"
+	OperatorRemoveReplica  = "remove_replica"
+	OperatorTransferLeader = "transfer_leader"
+)
+
+// keep the recent finished operators for audit
+const maxOperatorAuditRecords = 256
+
+var (
+	ErrOperatorNotFound      = errors.New("the operator is not found")
+	ErrOperatorNotCancelable = errors.New("the operator can not be canceled")
+)
+
+// ScheduleOperator is the replica change running by the scheduler
+type ScheduleOperator struct {
+	// only the add replica operator has the id and can be canceled
+	ID        int64     `json:"id,omitempty"`
+	Type      string    `json:"type"`
+	Namespace string    `json:"namespace"`
+	Partition int       `json:"partition"`
+	Node      string    `json:"node"`
+	StartTime time.Time `json:"start_time"`
+	Paused    bool      `json:"paused,omitempty"`
+	Canceled  bool      `json:"canceled,omitempty"`
+	// the snapshot transferring progress on the new replica
+	Transfer *common.SnapTransferStats `json:"transfer,omitempty"`
+}
+
+type OperatorAuditRecord struct {
+	ID        int64     `json:"id,omitempty"`
+	Type      string    `json:"type"`
+	Namespace string    `json:"namespace"`
+	Partition int       `json:"partition"`
+	Node      string    `json:"node"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Result    string    `json:"result"`
+}
+
+func (dp *DataPlacement) auditOperator(record OperatorAuditRecord) {
+	if record.EndTime.IsZero() {
+		record.EndTime = time.Now()
+	}
+	if record.StartTime.IsZero() {
+		record.StartTime = record.EndTime
+	}
+	dp.auditMutex.Lock()
+	dp.auditRecords = append(dp.auditRecords, record)
+	if len(dp.auditRecords) > maxOperatorAuditRecords {
+		dp.auditRecords = dp.auditRecords[len(dp.auditRecords)-maxOperatorAuditRecords:]
+	}
+	dp.auditMutex.Unlock()
+}
+
+func operatorResult(err error) string {
+	if err == nil {
+		return "done"
+	}
+	if err == ErrMigrationCanceled {
+		return "canceled"
+	}
+	return err.Error()
+}
+
+// GetOperatorAuditRecords return the recent finished operators, the newest first
+func (pdCoord *PDCoordinator) GetOperatorAuditRecords() []OperatorAuditRecord {
+	dp := pdCoord.dpm
+	dp.auditMutex.Lock()
+	records := make([]OperatorAuditRecord, 0, len(dp.auditRecords))
+	for i := len(dp.auditRecords) - 1; i >= 0; i-- {
+		records = append(records, dp.auditRecords[i])
+	}
+	dp.auditMutex.Unlock()
+	return records
+}
+
+// GetScheduleOperators return the running operators, the adding replicas with the snapshot
+// transferring progress and the removing replicas waiting to be removed.
+func (pdCoord *PDCoordinator) GetScheduleOperators() ([]ScheduleOperator, error) {
+	ops := make([]ScheduleOperator, 0)
+	for _, m := range pdCoord.GetPartitionMigrations() {
+		ops = append(ops, ScheduleOperator{
+			ID:        m.ID,
+			Type:      OperatorAddReplica,
+			Namespace: m.Namespace,
+			Partition: m.Partition,
+			Node:      m.Target,
+			StartTime: m.StartTime,
+			Paused:    m.Paused,
+			Canceled:  m.Canceled,
+			Transfer:  m.Transfer,
+		})
+	}
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, parts := range allNamespaces {
+		for _, p := range parts {
+			for nid, rinfo := range p.Removings {
+				ops = append(ops, ScheduleOperator{
+					Type:      OperatorRemoveReplica,
+					Namespace: p.Name,
+					Partition: p.Partition,
+					Node:      nid,
+					StartTime: time.Unix(0, rinfo.RemoveTime),
+				})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].StartTime.Before(ops[j].StartTime)
+	})
+	return ops, nil
+}
+
+// CancelScheduleOperator cancel the running add replica operator by the id
+func (pdCoord *PDCoordinator) CancelScheduleOperator(id int64) error {
+	if id <= 0 {
+		return ErrOperatorNotCancelable
+	}
+	dp := pdCoord.dpm
+	dp.migrationMutex.Lock()
+	var found *PartitionMigration
+	for _, m := range dp.migrations {
+		if m.ID == id {
+			found = m
+			break
+		}
+	}
+	dp.migrationMutex.Unlock()
+	if found == nil {
+		return ErrOperatorNotFound
+	}
+	return pdCoord.CancelPartitionMigration(found.Namespace, found.Partition)
+}
+
+// PauseSchedule pause or resume the automatic balancing of the namespace, or all the
+// namespaces if the namespace is empty. The migration for the failed nodes is not paused.
+func (pdCoord *PDCoordinator) PauseSchedule(ns string, paused bool) {
+	dp := pdCoord.dpm
+	if ns == "" {
+		if paused {
+			atomic.StoreInt32(&dp.schedulePaused, 1)
+		} else {
+			atomic.StoreInt32(&dp.schedulePaused, 0)
+		}
+	} else {
+		dp.pausedMutex.Lock()
+		if paused {
+			if dp.pausedNamespaces == nil {
+				dp.pausedNamespaces = make(map[string]bool)
+			}
+			dp.pausedNamespaces[ns] = true
+		} else {
+			delete(dp.pausedNamespaces, ns)
+		}
+		dp.pausedMutex.Unlock()
+	}
+	cluster.CoordLog().Infof("schedule of namespace %v paused: %v", ns, paused)
+}
+
+// GetSchedulePaused return whether all the schedule paused and the paused namespaces
+func (pdCoord *PDCoordinator) GetSchedulePaused() (bool, []string) {
+	dp := pdCoord.dpm
+	dp.pausedMutex.RLock()
+	nsList := make([]string, 0, len(dp.pausedNamespaces))
+	for ns := range dp.pausedNamespaces {
+		nsList = append(nsList, ns)
+	}
+	dp.pausedMutex.RUnlock()
+	sort.Strings(nsList)
+	return atomic.LoadInt32(&dp.schedulePaused) == 1, nsList
+}
+
+// isSchedulePaused check if the balance of the namespace is paused, the empty namespace
+// only check the global pause.
+func (dp *DataPlacement) isSchedulePaused(ns string) bool {
+	if atomic.LoadInt32(&dp.schedulePaused) == 1 {
+		return true
+	}
+	if ns == "" {
+		return false
+	}
+	dp.pausedMutex.RLock()
+	paused := dp.pausedNamespaces[ns]
+	dp.pausedMutex.RUnlock()
+	return paused
+}
@@ -0,0 +1,81 @@
+package pdnode_coord
+
+import (
+	"sort"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// PartitionReplicaStatus is the partition with the replicas not matching the replica number
+// of the namespace, while the replica number is changing or any replica is lost.
+type PartitionReplicaStatus struct {
+	Namespace string   `json:"namespace"`
+	Partition int      `json:"partition"`
+	Replica   int      `json:"replica"`
+	ISR       []string `json:"isr"`
+	// the replicas on the alive nodes
+	Alive int `json:"alive"`
+	// all the replicas are synced, only checked if required
+	FullReady bool `json:"full_ready"`
+}
+
+func (st *PartitionReplicaStatus) isUnderReplicated() bool {
+	return st.Alive < st.Replica || !st.FullReady
+}
+
+func getPartitionReplicaStatus(nsInfo *cluster.PartitionMetaInfo, currentNodes map[string]cluster.NodeInfo) PartitionReplicaStatus {
+	st := PartitionReplicaStatus{
+		Namespace: nsInfo.Name,
+		Partition: nsInfo.Partition,
+		Replica:   nsInfo.Replica,
+		ISR:       nsInfo.GetISR(),
+		FullReady: true,
+	}
+	for _, nid := range st.ISR {
+		if _, ok := currentNodes[nid]; ok {
+			st.Alive++
+		}
+	}
+	return st
+}
+
+// GetReplicaStatus return the under replicated and over replicated partitions of the namespace,
+// or all the namespaces if empty. The new replicas not synced yet are also under replicated if
+// checkReady is true, it will query all the replicas so it is slow for the whole cluster.
+func (pdCoord *PDCoordinator) GetReplicaStatus(ns string, checkReady bool) ([]PartitionReplicaStatus, []PartitionReplicaStatus, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	currentNodes, _ := pdCoord.getCurrentNodesWithRemoving()
+	under := make([]PartitionReplicaStatus, 0)
+	over := make([]PartitionReplicaStatus, 0)
+	for name, parts := range allNamespaces {
+		if ns != "" && name != ns {
+			continue
+		}
+		for _, p := range parts {
+			st := getPartitionReplicaStatus(&p, currentNodes)
+			if checkReady && st.Alive >= st.Replica {
+				ok, err := IsAllISRFullReady(&p)
+				st.FullReady = err == nil && ok
+			}
+			if st.isUnderReplicated() {
+				under = append(under, st)
+			} else if len(st.ISR) > st.Replica {
+				over = append(over, st)
+			}
+		}
+	}
+	sortStatus := func(l []PartitionReplicaStatus) {
+		sort.Slice(l, func(i, j int) bool {
+			if l[i].Namespace == l[j].Namespace {
+				return l[i].Partition < l[j].Partition
+			}
+			return l[i].Namespace < l[j].Namespace
+		})
+	}
+	sortStatus(under)
+	sortStatus(over)
+	return under, over, nil
+}
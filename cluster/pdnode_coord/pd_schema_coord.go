@@ -67,7 +67,7 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 			}
 			continue
 		}
-		if len(parts) == 0 || len(parts) != parts[0].PartitionNum {
+		if len(parts) == 0 || len(parts) != parts[0].AllPartitionNum() {
 			continue
 		}
 		allPartsSchema := make(map[int]map[string]*common.IndexSchema)
@@ -87,7 +87,7 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 				len(schemas))
 			allPartsSchema[pid] = schemas
 		}
-		if !isReady || len(allPartsSchema) != parts[0].PartitionNum {
+		if !isReady || len(allPartsSchema) != parts[0].AllPartitionNum() {
 			continue
 		}
 		for table, schemaInfo := range schemas {
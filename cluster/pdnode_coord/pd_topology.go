@@ -0,0 +1,292 @@
+package pdnode_coord
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	PartitionHealthy         = "healthy"
+	PartitionNoLeader        = "no_leader"
+	PartitionUnderReplicated = "under_replicated"
+	PartitionOverReplicated  = "over_replicated"
+)
+
+// TopologyNode is the data node with the labels and the capacity reported by the node
+type TopologyNode struct {
+	ID        string                 `json:"id"`
+	IP        string                 `json:"ip"`
+	Hostname  string                 `json:"hostname"`
+	Version   string                 `json:"version"`
+	RedisPort string                 `json:"redis_port"`
+	HttpPort  string                 `json:"http_port"`
+	RpcPort   string                 `json:"rpc_port"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+	// the node is a learner node with the role
+	LearnerRole string `json:"learner_role,omitempty"`
+	Removing    bool   `json:"removing,omitempty"`
+	// the stats can not be got from the node if not reachable
+	Reachable  bool              `json:"reachable"`
+	Disk       *common.DiskStats `json:"disk,omitempty"`
+	DataBytes  int64             `json:"data_bytes"`
+	Keys       int64             `json:"keys"`
+	Partitions int               `json:"partitions"`
+	Leaders    int               `json:"leaders"`
+}
+
+// TopologyReplica is the replica of the partition on the node
+type TopologyReplica struct {
+	Node     string `json:"node"`
+	IsLeader bool   `json:"is_leader"`
+	Learner  bool   `json:"learner,omitempty"`
+	Removing bool   `json:"removing,omitempty"`
+	// the replica stats reported by the node, empty if the node is not reachable
+	Reported     bool   `json:"reported"`
+	CommitIndex  uint64 `json:"commit_index"`
+	AppliedIndex uint64 `json:"applied_index"`
+	DataBytes    int64  `json:"data_bytes"`
+	Keys         int64  `json:"keys"`
+}
+
+type TopologyPartition struct {
+	Partition int               `json:"partition"`
+	Leader    string            `json:"leader"`
+	Health    string            `json:"health"`
+	Replicas  []TopologyReplica `json:"replicas"`
+}
+
+type TopologyNamespace struct {
+	Name         string                 `json:"name"`
+	AliasName    string                 `json:"alias_name,omitempty"`
+	PartitionNum int                    `json:"partition_num"`
+	Replica      int                    `json:"replica"`
+	EngType      string                 `json:"eng_type"`
+	Frozen       bool                   `json:"frozen,omitempty"`
+	ExpandState  string                 `json:"expand_state,omitempty"`
+	Tags         map[string]interface{} `json:"tags,omitempty"`
+	// the partitions not healthy
+	Unhealthy  int                 `json:"unhealthy"`
+	DataBytes  int64               `json:"data_bytes"`
+	Keys       int64               `json:"keys"`
+	Partitions []TopologyPartition `json:"partitions"`
+}
+
+// ClusterTopology is the full view of the cluster for the dashboard
+type ClusterTopology struct {
+	ClusterID  string              `json:"cluster_id"`
+	PDLeader   string              `json:"pd_leader"`
+	Stable     bool                `json:"stable"`
+	Epoch      int64               `json:"epoch"`
+	Time       time.Time           `json:"time"`
+	Nodes      []TopologyNode      `json:"nodes"`
+	Namespaces []TopologyNamespace `json:"namespaces"`
+}
+
+// get the stats of all the replicas on the nodes at the same time
+func getNodesServerStats(nodes map[string]cluster.NodeInfo) map[string]*common.ServerStats {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	statsList := make(map[string]*common.ServerStats, len(nodes))
+	for nid, n := range nodes {
+		wg.Add(1)
+		go func(nid string, n cluster.NodeInfo) {
+			defer wg.Done()
+			var rsp struct {
+				Stats common.ServerStats `json:"stats"`
+			}
+			_, err := common.APIRequest("GET",
+				"http://"+net.JoinHostPort(n.NodeIP, n.HttpPort)+"/stats?leader_only=false",
+				nil, time.Second*5, &rsp)
+			if err != nil {
+				cluster.CoordLog().Infof("failed to get stats from node %v: %v", nid, err)
+				return
+			}
+			mutex.Lock()
+			statsList[nid] = &rsp.Stats
+			mutex.Unlock()
+		}(nid, n)
+	}
+	wg.Wait()
+	return statsList
+}
+
+func newTopologyNode(n cluster.NodeInfo) TopologyNode {
+	return TopologyNode{
+		ID:          n.ID,
+		IP:          n.NodeIP,
+		Hostname:    n.Hostname,
+		Version:     n.Version,
+		RedisPort:   n.RedisPort,
+		HttpPort:    n.HttpPort,
+		RpcPort:     n.RpcPort,
+		Tags:        n.Tags,
+		LearnerRole: n.LearnerRole,
+	}
+}
+
+func getPartitionHealth(p *cluster.PartitionMetaInfo, replicas []TopologyReplica, currentNodes map[string]cluster.NodeInfo) string {
+	anyReported := false
+	hasLeader := false
+	for _, r := range replicas {
+		if r.Reported {
+			anyReported = true
+		}
+		if r.IsLeader {
+			hasLeader = true
+		}
+	}
+	if anyReported && !hasLeader {
+		return PartitionNoLeader
+	}
+	st := getPartitionReplicaStatus(p, currentNodes)
+	if st.isUnderReplicated() {
+		return PartitionUnderReplicated
+	}
+	if len(st.ISR) > st.Replica {
+		return PartitionOverReplicated
+	}
+	return PartitionHealthy
+}
+
+func buildTopologyNamespace(parts map[int]cluster.PartitionMetaInfo, nodeStats map[string]map[string]*common.NamespaceStats,
+	currentNodes map[string]cluster.NodeInfo, nodes map[string]*TopologyNode) TopologyNamespace {
+	var tns TopologyNamespace
+	for pid := range parts {
+		p := parts[pid]
+		if tns.Name == "" {
+			tns.Name = p.Name
+			tns.AliasName = p.AliasName
+			tns.PartitionNum = p.PartitionNum
+			tns.Replica = p.Replica
+			tns.EngType = p.EngType
+			tns.Frozen = p.Frozen
+			tns.ExpandState = p.ExpandState
+			tns.Tags = p.Tags
+		}
+		tp := TopologyPartition{
+			Partition: p.Partition,
+			Leader:    p.GetRealLeader(),
+		}
+		replicaNodes := append([]string(nil), p.RaftNodes...)
+		learners := make(map[string]bool)
+		for _, lrns := range p.LearnerNodes {
+			for _, nid := range lrns {
+				learners[nid] = true
+				replicaNodes = append(replicaNodes, nid)
+			}
+		}
+		var partBytes, partKeys int64
+		for _, nid := range replicaNodes {
+			r := TopologyReplica{Node: nid, Learner: learners[nid]}
+			_, r.Removing = p.Removings[nid]
+			if ns, ok := nodeStats[nid][p.GetDesp()]; ok {
+				r.Reported = true
+				r.IsLeader = ns.IsLeader
+				if ns.ReplicationStats != nil {
+					r.CommitIndex = ns.ReplicationStats.CommitIndex
+					r.AppliedIndex = ns.ReplicationStats.AppliedIndex
+				}
+				if ns.Load != nil {
+					r.DataBytes = ns.Load.DataBytes
+					r.Keys = ns.Load.Keys
+				}
+			}
+			if r.DataBytes > partBytes {
+				partBytes = r.DataBytes
+			}
+			if r.Keys > partKeys {
+				partKeys = r.Keys
+			}
+			if n, ok := nodes[nid]; ok {
+				n.Partitions++
+				n.DataBytes += r.DataBytes
+				n.Keys += r.Keys
+				if r.IsLeader {
+					n.Leaders++
+				}
+			}
+			tp.Replicas = append(tp.Replicas, r)
+		}
+		tp.Health = getPartitionHealth(&p, tp.Replicas, currentNodes)
+		if tp.Health != PartitionHealthy {
+			tns.Unhealthy++
+		}
+		// the replicas have the same data, the max is used since the follower may lag
+		tns.DataBytes += partBytes
+		tns.Keys += partKeys
+		tns.Partitions = append(tns.Partitions, tp)
+	}
+	sort.Slice(tns.Partitions, func(i, j int) bool {
+		return tns.Partitions[i].Partition < tns.Partitions[j].Partition
+	})
+	return tns
+}
+
+// GetClusterTopology return the nodes, the namespaces and the placement of all the partitions
+// with the health, the apply index and the data size reported by the nodes.
+func (pdCoord *PDCoordinator) GetClusterTopology() (*ClusterTopology, error) {
+	allNamespaces, epoch, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	currentNodes, _ := pdCoord.getCurrentNodesWithRemoving()
+	learnerNodes, _ := pdCoord.getCurrentLearnerNodes()
+	pdCoord.nodesMutex.RLock()
+	removings := make(map[string]bool, len(pdCoord.removingNodes))
+	for nid := range pdCoord.removingNodes {
+		removings[nid] = true
+	}
+	pdCoord.nodesMutex.RUnlock()
+
+	allNodes := make(map[string]cluster.NodeInfo, len(currentNodes)+len(learnerNodes))
+	for nid, n := range currentNodes {
+		allNodes[nid] = n
+	}
+	for nid, n := range learnerNodes {
+		allNodes[nid] = n
+	}
+	serverStats := getNodesServerStats(allNodes)
+	nodes := make(map[string]*TopologyNode, len(allNodes))
+	nodeStats := make(map[string]map[string]*common.NamespaceStats, len(serverStats))
+	for nid, n := range allNodes {
+		tn := newTopologyNode(n)
+		tn.Removing = removings[nid]
+		if ss, ok := serverStats[nid]; ok {
+			tn.Reachable = true
+			tn.Disk = ss.Disk
+			nsStats := make(map[string]*common.NamespaceStats, len(ss.NSStats))
+			for i := range ss.NSStats {
+				nsStats[ss.NSStats[i].Name] = &ss.NSStats[i]
+			}
+			nodeStats[nid] = nsStats
+		}
+		nodes[nid] = &tn
+	}
+
+	topo := &ClusterTopology{
+		ClusterID:  pdCoord.clusterKey,
+		PDLeader:   pdCoord.leaderNode.GetID(),
+		Stable:     pdCoord.IsClusterStable(),
+		Epoch:      int64(epoch),
+		Time:       time.Now(),
+		Nodes:      make([]TopologyNode, 0, len(nodes)),
+		Namespaces: make([]TopologyNamespace, 0, len(allNamespaces)),
+	}
+	for _, parts := range allNamespaces {
+		if len(parts) == 0 {
+			continue
+		}
+		topo.Namespaces = append(topo.Namespaces, buildTopologyNamespace(parts, nodeStats, currentNodes, nodes))
+	}
+	for _, n := range nodes {
+		topo.Nodes = append(topo.Nodes, *n)
+	}
+	sort.Slice(topo.Nodes, func(i, j int) bool { return topo.Nodes[i].ID < topo.Nodes[j].ID })
+	sort.Slice(topo.Namespaces, func(i, j int) bool { return topo.Namespaces[i].Name < topo.Namespaces[j].Name })
+	return topo, nil
+}
@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -159,12 +160,30 @@ func IsRaftNodeFullReady(nsInfo *cluster.PartitionMetaInfo, nid string) (bool, e
 type DataPlacement struct {
 	balanceInterval [2]int32
 	pdCoord         *PDCoordinator
+	// balance by the load of the nodes instead of the partition count
+	balanceByLoad int32
+	// the nodes excluded from the leadership
+	excludedMutex  sync.RWMutex
+	leaderExcluded map[string]bool
+	// the replicas being added by the balance and waiting catch up
+	migrationMutex sync.Mutex
+	migrations     map[string]*PartitionMigration
+	// the id of the last operator
+	operatorID   int64
+	auditMutex   sync.Mutex
+	auditRecords []OperatorAuditRecord
+	// pause the automatic balance for all or some namespaces
+	schedulePaused   int32
+	pausedMutex      sync.RWMutex
+	pausedNamespaces map[string]bool
 }
 
 func NewDataPlacement(coord *PDCoordinator) *DataPlacement {
 	return &DataPlacement{
 		pdCoord:         coord,
 		balanceInterval: [2]int32{2, 4},
+		leaderExcluded:  make(map[string]bool),
+		migrations:      make(map[string]*PartitionMigration),
 	}
 }
 
@@ -201,7 +220,7 @@ func (dp *DataPlacement) DoBalance(monitorChan chan struct{}) {
 				cluster.CoordLog().Infof("no balance since cluster is not stable while checking balance")
 				continue
 			}
-			if !dp.pdCoord.AutoBalanceEnabled() {
+			if !dp.pdCoord.AutoBalanceEnabled() || dp.isSchedulePaused("") {
 				continue
 			}
 			cluster.CoordLog().Infof("begin checking balance of namespace data...")
@@ -210,26 +229,28 @@ func (dp *DataPlacement) DoBalance(monitorChan chan struct{}) {
 			if validNum < 2 {
 				continue
 			}
-			dp.rebalanceNamespace(monitorChan)
+			if dp.IsBalanceByLoad() {
+				// the leaders are not decided by the replica placement while balancing by load
+				if _, balanced := dp.rebalanceByLoad(monitorChan); balanced {
+					dp.rebalanceLeaders(monitorChan)
+				}
+			} else {
+				dp.rebalanceNamespace(monitorChan)
+			}
 		}
 	}
 }
 
 func (dp *DataPlacement) addNodeToNamespaceAndWaitReady(monitorChan chan struct{}, namespaceInfo *cluster.PartitionMetaInfo,
 	nodeNameList []SortableStrings) (*cluster.PartitionMetaInfo, error) {
-	retry := 0
-	currentSelect := 0
-	namespaceName := namespaceInfo.Name
-	partitionID := namespaceInfo.Partition
 	// since we need add new catchup, we make the replica as replica+1
 	partitionNodes, coordErr := getRebalancedPartitionsFromNameList(
 		namespaceInfo.Name,
-		namespaceInfo.PartitionNum,
+		namespaceInfo.AllPartitionNum(),
 		namespaceInfo.Replica+1, nodeNameList)
 	if coordErr != nil {
 		return namespaceInfo, coordErr.ToErrorType()
 	}
-	fullName := namespaceInfo.GetDesp()
 	selectedCatchup := make([]string, 0)
 	for _, nid := range partitionNodes[namespaceInfo.Partition] {
 		if cluster.FindSlice(namespaceInfo.RaftNodes, nid) != -1 {
@@ -238,12 +259,24 @@ func (dp *DataPlacement) addNodeToNamespaceAndWaitReady(monitorChan chan struct{
 		}
 		selectedCatchup = append(selectedCatchup, nid)
 	}
+	return dp.addCatchupAndWaitReady(monitorChan, namespaceInfo, selectedCatchup)
+}
+
+// add the first available node in the catchup list to the namespace and wait it full ready
+func (dp *DataPlacement) addCatchupAndWaitReady(monitorChan chan struct{}, namespaceInfo *cluster.PartitionMetaInfo,
+	selectedCatchup []string) (_ *cluster.PartitionMetaInfo, retErr error) {
+	retry := 0
+	currentSelect := 0
+	namespaceName := namespaceInfo.Name
+	partitionID := namespaceInfo.Partition
+	fullName := namespaceInfo.GetDesp()
+	var coordErr *cluster.CoordErr
 	var nInfo *cluster.PartitionMetaInfo
 	var err error
 	for {
 		if currentSelect >= len(selectedCatchup) {
-			cluster.CoordLog().Infof("currently no any node %v can be balanced for namespace: %v, expect isr: %v, nodes:%v",
-				selectedCatchup, fullName, partitionNodes[partitionID], nodeNameList)
+			cluster.CoordLog().Infof("currently no any node %v can be balanced for namespace: %v, isr: %v",
+				selectedCatchup, fullName, namespaceInfo.RaftNodes)
 			return nInfo, ErrBalanceNodeUnavailable
 		}
 		nid := selectedCatchup[currentSelect]
@@ -254,6 +287,26 @@ func (dp *DataPlacement) addNodeToNamespaceAndWaitReady(monitorChan chan struct{
 			if inRaft, _ := IsRaftNodeFullReady(nInfo, nid); inRaft {
 				break
 			} else if cluster.FindSlice(nInfo.RaftNodes, nid) != -1 {
+				if dp.startMigration(nInfo, nid) {
+					migrating := nInfo
+					defer func() {
+						dp.endMigration(migrating, retErr)
+					}()
+				}
+				if dp.isMigrationCanceled(nInfo) {
+					cluster.CoordLog().Infof("migration of namespace %v to node %v is canceled", nInfo.GetDesp(), nid)
+					if coordErr := dp.pdCoord.removeNamespaceFromNode(nInfo, nid); coordErr != nil {
+						cluster.CoordLog().Infof("remove the canceled node %v from namespace %v failed: %v",
+							nid, nInfo.GetDesp(), coordErr)
+						select {
+						case <-monitorChan:
+							return nInfo, errors.New("quiting")
+						case <-time.After(time.Second * 5):
+						}
+						continue
+					}
+					return nInfo, ErrMigrationCanceled
+				}
 				// wait ready
 				select {
 				case <-monitorChan:
@@ -308,7 +361,7 @@ func (dp *DataPlacement) allocNodeForNamespace(namespaceInfo *cluster.PartitionM
 
 	partitionNodes, err := getRebalancedNamespacePartitions(
 		namespaceInfo.Name,
-		namespaceInfo.PartitionNum,
+		namespaceInfo.AllPartitionNum(),
 		namespaceInfo.Replica, currentNodes)
 	if err != nil {
 		return nil, err
@@ -415,6 +468,14 @@ func (dp *DataPlacement) rebalanceNamespace(monitorChan chan struct{}) (bool, bo
 		if len(namespaceInfo.Removings) > 0 {
 			continue
 		}
+		// the new partitions should stay with the old partitions until the data migrated
+		if namespaceInfo.ExpandState != "" {
+			continue
+		}
+		// the replicas are placed by the placement rules
+		if len(namespaceInfo.PlacementRules) > 0 || dp.isSchedulePaused(namespaceInfo.Name) {
+			continue
+		}
 		if ok, err := IsAllISRFullReady(&namespaceInfo); err != nil || !ok {
 			cluster.CoordLog().Infof("namespace %v isr is not full ready while balancing", namespaceInfo.GetDesp())
 			continue
@@ -425,7 +486,7 @@ func (dp *DataPlacement) rebalanceNamespace(monitorChan chan struct{}) (bool, bo
 
 		partitionNodes, err := getRebalancedNamespacePartitions(
 			namespaceInfo.Name,
-			namespaceInfo.PartitionNum,
+			namespaceInfo.AllPartitionNum(),
 			namespaceInfo.Replica, currentNodes)
 		if err != nil {
 			isAllBalanced = false
@@ -467,7 +528,7 @@ func (dp *DataPlacement) rebalanceNamespace(monitorChan chan struct{}) (bool, bo
 				return moved, false
 			}
 		}
-		expectLeader := partitionNodes[namespaceInfo.Partition][0]
+		expectLeader := dp.getExpectedLeader(partitionNodes[namespaceInfo.Partition], currentNodes)
 		if _, ok := namespaceInfo.Removings[expectLeader]; ok {
 			cluster.CoordLog().Infof("namespace %v expected leader: %v is marked as removing", namespaceInfo.GetDesp(),
 				expectLeader)
@@ -563,15 +624,19 @@ func getRebalancedNamespacePartitions(ns string,
 	// if there are several data centers, we sort them one by one as below
 	// nodeA1@dc1 nodeA2@dc2 nodeA3@dc3 nodeB1@dc1 nodeB2@dc2 nodeB3@dc3
 
-	nodeNameList := getNodeNameList(currentNodes)
-	return getRebalancedPartitionsFromNameList(ns, partitionNum, replica, nodeNameList)
+	// and the zones and racks in each dc are combined in the same way, so the adjacent
+	// nodes are in the different failure domains as much as possible.
+	if len(currentNodes) < replica {
+		return nil, ErrNodeUnavailable
+	}
+	combined := getFailureDomainNodeList(currentNodes)
+	return getPartitionsFromCombinedList(ns, partitionNum, replica, combined), nil
 }
 
 func getRebalancedPartitionsFromNameList(ns string,
 	partitionNum int, replica int,
 	nodeNameList []SortableStrings) ([][]string, *cluster.CoordErr) {
 
-	var combined SortableStrings
 	sortedNodeNameList := make([]SortableStrings, 0, len(nodeNameList))
 	for _, nList := range nodeNameList {
 		sortedNodeNameList = append(sortedNodeNameList, nList)
@@ -585,17 +650,34 @@ func getRebalancedPartitionsFromNameList(ns string,
 	if totalCnt < replica {
 		return nil, ErrNodeUnavailable
 	}
+	combined := combineNodeNameList(sortedNodeNameList)
+	return getPartitionsFromCombinedList(ns, partitionNum, replica, combined), nil
+}
+
+// combine the node lists by choosing one node from each list in turn
+func combineNodeNameList(nodeNameList []SortableStrings) SortableStrings {
+	totalCnt := 0
+	lists := make([]SortableStrings, 0, len(nodeNameList))
+	for _, nList := range nodeNameList {
+		lists = append(lists, nList)
+		totalCnt += len(nList)
+	}
+	combined := make(SortableStrings, 0, totalCnt)
 	idx := 0
 	for len(combined) < totalCnt {
-		nList := sortedNodeNameList[idx%len(sortedNodeNameList)]
+		nList := lists[idx%len(lists)]
 		if len(nList) == 0 {
 			idx++
 			continue
 		}
 		combined = append(combined, nList[0])
-		sortedNodeNameList[idx%len(sortedNodeNameList)] = nList[1:]
+		lists[idx%len(lists)] = nList[1:]
 		idx++
 	}
+	return combined
+}
+
+func getPartitionsFromCombinedList(ns string, partitionNum int, replica int, combined SortableStrings) [][]string {
 	partitionNodes := make([][]string, partitionNum)
 	selectIndex := int(murmur3.Sum32([]byte(ns)))
 	for i := 0; i < partitionNum; i++ {
@@ -606,16 +688,27 @@ func getRebalancedPartitionsFromNameList(ns string,
 		}
 		selectIndex++
 	}
-
-	return partitionNodes, nil
+	return partitionNodes
 }
 
 func (dp *DataPlacement) decideUnwantedRaftNode(namespaceInfo *cluster.PartitionMetaInfo, currentNodes map[string]cluster.NodeInfo) string {
 	unwantedNode := ""
+	if len(namespaceInfo.PlacementRules) > 0 {
+		expected, err := getRuleExpectedReplicas(namespaceInfo, namespaceInfo.PlacementRules, currentNodes)
+		if err != nil {
+			return unwantedNode
+		}
+		for _, nid := range namespaceInfo.GetISR() {
+			if cluster.FindSlice(expected, nid) == -1 {
+				unwantedNode = nid
+			}
+		}
+		return unwantedNode
+	}
 	//remove the unwanted node in isr
 	partitionNodes, err := getRebalancedNamespacePartitions(
 		namespaceInfo.Name,
-		namespaceInfo.PartitionNum,
+		namespaceInfo.AllPartitionNum(),
 		namespaceInfo.Replica, currentNodes)
 	if err != nil {
 		return unwantedNode
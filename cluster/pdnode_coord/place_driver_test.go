@@ -2,8 +2,10 @@ package pdnode_coord
 
 import (
 	"testing"
+	"time"
 
 	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -155,3 +157,470 @@ func TestClusterNodesPlacementAcrossDC(t *testing.T) {
 	}
 	assert.Equal(t, placementNodes, placementNodes2)
 }
+
+func TestClusterNodesPlacementAcrossZoneRack(t *testing.T) {
+	nodes := make(map[string]cluster.NodeInfo)
+	addNode := func(nid string, zone string, rack string) {
+		var n cluster.NodeInfo
+		n.ID = nid
+		n.Tags = make(map[string]interface{})
+		n.Tags[cluster.ZoneTag] = zone
+		n.Tags[cluster.RackTag] = rack
+		nodes[nid] = n
+	}
+	addNode("1", "z1", "r1")
+	addNode("2", "z1", "r1")
+	addNode("3", "z1", "r2")
+	addNode("4", "z1", "r2")
+	addNode("5", "z2", "r1")
+	addNode("6", "z2", "r1")
+	addNode("7", "z3", "r1")
+	addNode("8", "z3", "r2")
+
+	combined := getFailureDomainNodeList(nodes)
+	assert.Equal(t, SortableStrings{"1", "5", "7", "3", "6", "8", "2", "4"}, combined)
+
+	placementNodes, err := getRebalancedNamespacePartitions("test", 16, 3, nodes)
+	assert.Nil(t, err)
+	for pid, v := range placementNodes {
+		assert.Equal(t, 3, len(v))
+		zones := make(map[interface{}]bool)
+		for _, nid := range v {
+			zones[nodes[nid].Tags[cluster.ZoneTag]] = true
+		}
+		nsInfo := &cluster.PartitionMetaInfo{Name: "test", Partition: pid}
+		nsInfo.RaftNodes = v
+		vs := checkPartitionPlacement(nsInfo, nodes)
+		// the tail of the combined list may be in the same zone
+		if len(zones) == 3 {
+			assert.Equal(t, 0, len(vs), "%v", vs)
+		} else {
+			assert.NotEqual(t, 0, len(vs))
+			assert.Equal(t, cluster.ZoneTag, vs[0].Domain)
+		}
+	}
+
+	nsInfo := &cluster.PartitionMetaInfo{Name: "test"}
+	nsInfo.RaftNodes = []string{"1", "2", "3"}
+	vs := checkPartitionPlacement(nsInfo, nodes)
+	assert.Equal(t, 2, len(vs))
+	assert.Equal(t, cluster.ZoneTag, vs[0].Domain)
+	assert.Equal(t, 3, vs[0].Expected)
+	assert.Equal(t, 1, vs[0].Actual)
+
+	nsInfo.RaftNodes = []string{"1", "5", "7"}
+	vs = checkPartitionPlacement(nsInfo, nodes)
+	assert.Equal(t, 0, len(vs))
+	nsInfo.RaftNodes = []string{"1", "5", "6"}
+	vs = checkPartitionPlacement(nsInfo, nodes)
+	assert.Equal(t, 2, len(vs))
+	assert.Equal(t, cluster.ZoneTag, vs[0].Domain)
+	assert.Equal(t, cluster.RackTag, vs[1].Domain)
+}
+
+func TestDecideLoadMove(t *testing.T) {
+	nodes := make(map[string]cluster.NodeInfo)
+	for _, nid := range []string{"1", "2", "3", "4"} {
+		nodes[nid] = cluster.NodeInfo{ID: nid}
+	}
+	newPart := func(pid int, raftNodes ...string) cluster.PartitionMetaInfo {
+		p := cluster.PartitionMetaInfo{Name: "test", Partition: pid}
+		p.RaftNodes = raftNodes
+		return p
+	}
+	// each node has the same number of partitions, but the partition 0 is much larger
+	namespaceList := []cluster.PartitionMetaInfo{
+		newPart(0, "1", "2"),
+		newPart(1, "3", "4"),
+		newPart(2, "1", "3"),
+		newPart(3, "2", "4"),
+	}
+	partLoads := map[string]*partitionLoad{
+		"test-0": {dataBytes: 1000, score: 0.7},
+		"test-1": {dataBytes: 100, score: 0.1},
+		"test-2": {dataBytes: 100, score: 0.1},
+		"test-3": {dataBytes: 100, score: 0.1},
+	}
+	nodeLoads := computeNodeLoads(namespaceList, partLoads, nodes)
+	assert.Equal(t, 2, nodeLoads["1"].Partitions)
+	assert.Equal(t, int64(1100), nodeLoads["1"].DataBytes)
+	sorted := sortNodeLoads(nodeLoads)
+	assert.Equal(t, "1", sorted[0].NodeID)
+	assert.Equal(t, "4", sorted[len(sorted)-1].NodeID)
+
+	nsNodes := func(*cluster.PartitionMetaInfo) map[string]cluster.NodeInfo { return nodes }
+	nsInfo, from, to := decideLoadMove(namespaceList, partLoads, nodeLoads, nsNodes)
+	assert.NotNil(t, nsInfo)
+	// the large partition can not reduce the difference, so the small one is moved
+	assert.Equal(t, 2, nsInfo.Partition)
+	assert.Equal(t, "1", from)
+	assert.Equal(t, "4", to)
+
+	// balanced
+	for _, p := range partLoads {
+		p.score = 0.25
+	}
+	nodeLoads = computeNodeLoads(namespaceList, partLoads, nodes)
+	nsInfo, _, _ = decideLoadMove(namespaceList, partLoads, nodeLoads, nsNodes)
+	assert.Nil(t, nsInfo)
+}
+
+func TestDecideLeaderTransfer(t *testing.T) {
+	nodes := make(map[string]cluster.NodeInfo)
+	for _, nid := range []string{"1", "2", "3"} {
+		nodes[nid] = cluster.NodeInfo{ID: nid}
+	}
+	newPart := func(pid int, raftNodes ...string) cluster.PartitionMetaInfo {
+		p := cluster.PartitionMetaInfo{Name: "test", Partition: pid}
+		p.RaftNodes = raftNodes
+		return p
+	}
+	namespaceList := []cluster.PartitionMetaInfo{
+		newPart(0, "1", "2", "3"),
+		newPart(1, "1", "2", "3"),
+		newPart(2, "1", "3", "2"),
+		newPart(3, "2", "1", "3"),
+	}
+	noExclude := func(string) bool { return false }
+	nsInfo, target := decideLeaderTransfer(namespaceList, nodes, noExclude)
+	assert.NotNil(t, nsInfo)
+	assert.Equal(t, "1", nsInfo.RaftNodes[0])
+	assert.Equal(t, "3", target)
+
+	namespaceList[0].RaftNodes = []string{"3", "1", "2"}
+	nsInfo, _ = decideLeaderTransfer(namespaceList, nodes, noExclude)
+	assert.Nil(t, nsInfo)
+
+	// the leaders on the excluded node should be moved
+	exclude2 := func(nid string) bool { return nid == "2" }
+	nsInfo, target = decideLeaderTransfer(namespaceList, nodes, exclude2)
+	assert.NotNil(t, nsInfo)
+	assert.Equal(t, 3, nsInfo.Partition)
+	assert.Equal(t, "3", target)
+
+	dp := NewDataPlacement(nil)
+	n := nodes["3"]
+	n.Tags = map[string]interface{}{cluster.NoLeaderTag: "true"}
+	nodes["3"] = n
+	assert.True(t, dp.isLeaderExcluded("3", nodes))
+	assert.False(t, dp.isLeaderExcluded("1", nodes))
+	dp.SetLeaderExcluded("1", true)
+	assert.True(t, dp.isLeaderExcluded("1", nodes))
+	assert.Equal(t, []string{"1"}, dp.GetLeaderExcludedNodes())
+	assert.Equal(t, "2", dp.getExpectedLeader([]string{"1", "2", "3"}, nodes))
+	dp.SetLeaderExcluded("1", false)
+	assert.Equal(t, "1", dp.getExpectedLeader([]string{"1", "2", "3"}, nodes))
+}
+
+func TestNextExpandState(t *testing.T) {
+	var meta cluster.NamespaceMetaInfo
+	meta.PartitionNum = 2
+	meta.ExpandPartitionNum = 4
+	meta.ExpandState = common.ExpandStateCopying
+	status := map[int]common.PartitionReshardStatus{
+		0: {Partition: 0, State: common.ExpandStateCopying, Done: true},
+		1: {Partition: 1, State: common.ExpandStateCopying},
+	}
+	_, changed := nextExpandState(meta, status)
+	assert.False(t, changed)
+
+	status[1] = common.PartitionReshardStatus{Partition: 1, State: common.ExpandStateCopying, Done: true}
+	newMeta, changed := nextExpandState(meta, status)
+	assert.True(t, changed)
+	assert.Equal(t, common.ExpandStateSwitching, newMeta.ExpandState)
+	assert.Equal(t, 2, newMeta.PartitionNum)
+
+	// the status reported for the old state should be ignored
+	_, changed = nextExpandState(newMeta, status)
+	assert.False(t, changed)
+	for pid := range status {
+		status[pid] = common.PartitionReshardStatus{Partition: pid, State: common.ExpandStateSwitching, Done: true}
+	}
+	newMeta, changed = nextExpandState(newMeta, status)
+	assert.True(t, changed)
+	assert.Equal(t, common.ExpandStateCleaning, newMeta.ExpandState)
+	assert.Equal(t, 4, newMeta.PartitionNum)
+	assert.Equal(t, 0, newMeta.ExpandPartitionNum)
+	assert.Equal(t, 4, newMeta.AllPartitionNum())
+
+	// the merged partitions are removed without cleaning
+	meta.PartitionNum = 4
+	meta.ExpandPartitionNum = 2
+	meta.ExpandState = common.ExpandStateSwitching
+	status = make(map[int]common.PartitionReshardStatus)
+	for pid := 0; pid < 4; pid++ {
+		status[pid] = common.PartitionReshardStatus{Partition: pid, State: common.ExpandStateSwitching, Done: true}
+	}
+	assert.Equal(t, 4, meta.AllPartitionNum())
+	newMeta, changed = nextExpandState(meta, status)
+	assert.True(t, changed)
+	assert.Equal(t, "", newMeta.ExpandState)
+	assert.Equal(t, 2, newMeta.PartitionNum)
+}
+
+func TestCountNodeReplicas(t *testing.T) {
+	allNamespaces := make(map[string]map[int]cluster.PartitionMetaInfo)
+	allNamespaces["ns1"] = make(map[int]cluster.PartitionMetaInfo)
+	allNamespaces["ns2"] = make(map[int]cluster.PartitionMetaInfo)
+	var p cluster.PartitionMetaInfo
+	p.RaftNodes = []string{"n1", "n2"}
+	allNamespaces["ns1"][0] = p
+	p.RaftNodes = []string{"n2", "n1"}
+	allNamespaces["ns1"][1] = p
+	p.RaftNodes = []string{"n2", "n3"}
+	allNamespaces["ns2"][0] = p
+
+	replicas, leaders := countNodeReplicas(allNamespaces, "n1")
+	assert.Equal(t, 2, replicas)
+	assert.Equal(t, 1, leaders)
+	replicas, leaders = countNodeReplicas(allNamespaces, "n4")
+	assert.Equal(t, 0, replicas)
+	assert.Equal(t, 0, leaders)
+}
+
+func TestRuleExpectedReplicas(t *testing.T) {
+	nodes := make(map[string]cluster.NodeInfo)
+	for _, nid := range []string{"a1", "a2", "b1", "b2", "c1", "d1"} {
+		var n cluster.NodeInfo
+		n.ID = nid
+		n.Tags = map[string]interface{}{cluster.ZoneTag: nid[:1]}
+		nodes[nid] = n
+	}
+	rules := []cluster.PlacementRule{
+		{Role: cluster.PlacementRoleVoter, Count: 3, Tag: cluster.ZoneTag, Values: []string{"a", "b", "c"}},
+		{Role: cluster.PlacementRoleLearner, LearnerRole: common.LearnerRoleLogSyncer, Count: 1,
+			Tag: cluster.ZoneTag, Values: []string{"d"}},
+	}
+	var meta cluster.NamespaceMetaInfo
+	meta.Replica = 3
+	assert.Nil(t, validatePlacementRules(&meta, rules))
+	meta.Replica = 2
+	assert.NotNil(t, validatePlacementRules(&meta, rules))
+
+	var nsInfo cluster.PartitionMetaInfo
+	nsInfo.Name = "test"
+	nsInfo.Replica = 3
+	nsInfo.RaftNodes = []string{"a1", "a2", "d1"}
+	expected, err := getRuleExpectedReplicas(&nsInfo, rules, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(expected))
+	// the current replica matching the rule is kept
+	assert.Equal(t, "a1", expected[0])
+	zones := make(map[string]bool)
+	for _, nid := range expected {
+		zones[nid[:1]] = true
+	}
+	assert.Equal(t, 3, len(zones))
+	assert.False(t, zones["d"])
+
+	// place more replicas in the other values if no node left in the value
+	delete(nodes, "c1")
+	expected, err = getRuleExpectedReplicas(&nsInfo, rules, nodes)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(expected))
+	assert.Equal(t, -1, cluster.FindSlice(expected, "d1"))
+	delete(nodes, "a2")
+	_, err = getRuleExpectedReplicas(&nsInfo, rules, nodes)
+	assert.Nil(t, err)
+	delete(nodes, "b2")
+	_, err = getRuleExpectedReplicas(&nsInfo, rules, nodes)
+	assert.NotNil(t, err)
+
+	learnerNodes := []cluster.NodeInfo{
+		{ID: "l1", LearnerRole: common.LearnerRoleLogSyncer, Tags: map[string]interface{}{cluster.ZoneTag: "a"}},
+		{ID: "l2", LearnerRole: common.LearnerRoleLogSyncer, Tags: map[string]interface{}{cluster.ZoneTag: "d"}},
+		{ID: "l3", LearnerRole: common.LearnerRoleLogSyncer, Tags: map[string]interface{}{cluster.ZoneTag: "d"}},
+	}
+	adding, unmatched := decideRuleLearners(rules, common.LearnerRoleLogSyncer, []string{"l1"}, learnerNodes)
+	assert.Equal(t, []string{"l2"}, adding)
+	assert.Equal(t, []string{"l1"}, unmatched)
+	adding, unmatched = decideRuleLearners(nil, common.LearnerRoleLogSyncer, []string{"l1"}, learnerNodes)
+	assert.Equal(t, []string{"l2", "l3"}, adding)
+	assert.Equal(t, 0, len(unmatched))
+}
+
+func TestSchedulePauseAndAudit(t *testing.T) {
+	coord := NewPDCoordinator("test", &cluster.NodeInfo{NodeIP: "127.0.0.1"}, nil)
+	dp := coord.dpm
+	assert.False(t, dp.isSchedulePaused("ns1"))
+	coord.PauseSchedule("ns1", true)
+	assert.True(t, dp.isSchedulePaused("ns1"))
+	assert.False(t, dp.isSchedulePaused("ns2"))
+	assert.False(t, dp.isSchedulePaused(""))
+	coord.PauseSchedule("", true)
+	assert.True(t, dp.isSchedulePaused("ns2"))
+	paused, nsList := coord.GetSchedulePaused()
+	assert.True(t, paused)
+	assert.Equal(t, []string{"ns1"}, nsList)
+	coord.PauseSchedule("", false)
+	coord.PauseSchedule("ns1", false)
+	assert.False(t, dp.isSchedulePaused("ns1"))
+
+	for i := 0; i < maxOperatorAuditRecords+10; i++ {
+		dp.auditOperator(OperatorAuditRecord{ID: int64(i), Type: OperatorAddReplica, Result: operatorResult(nil)})
+	}
+	records := coord.GetOperatorAuditRecords()
+	assert.Equal(t, maxOperatorAuditRecords, len(records))
+	assert.Equal(t, int64(maxOperatorAuditRecords+9), records[0].ID)
+	assert.Equal(t, "done", records[0].Result)
+	assert.Equal(t, "canceled", operatorResult(ErrMigrationCanceled))
+}
+
+func TestPartitionReplicaStatus(t *testing.T) {
+	nodes := map[string]cluster.NodeInfo{"n1": {ID: "n1"}, "n2": {ID: "n2"}, "n3": {ID: "n3"}}
+	var nsInfo cluster.PartitionMetaInfo
+	nsInfo.Name = "test"
+	nsInfo.Replica = 3
+	nsInfo.RaftNodes = []string{"n1", "n2", "n3"}
+	st := getPartitionReplicaStatus(&nsInfo, nodes)
+	assert.Equal(t, 3, st.Alive)
+	assert.False(t, st.isUnderReplicated())
+	st.FullReady = false
+	assert.True(t, st.isUnderReplicated())
+
+	// increased replica
+	nsInfo.Replica = 5
+	st = getPartitionReplicaStatus(&nsInfo, nodes)
+	assert.True(t, st.isUnderReplicated())
+	// lost replica
+	nsInfo.Replica = 3
+	delete(nodes, "n3")
+	st = getPartitionReplicaStatus(&nsInfo, nodes)
+	assert.Equal(t, 2, st.Alive)
+	assert.True(t, st.isUnderReplicated())
+}
+
+func TestFindNamespaceByAlias(t *testing.T) {
+	var p cluster.PartitionMetaInfo
+	p.Name = "prod"
+	p.AliasName = "prod_new"
+	allNamespaces := map[string]map[int]cluster.PartitionMetaInfo{
+		"prod":    {0: p},
+		"staging": {0: {}},
+	}
+	assert.Equal(t, "prod", FindNamespaceByAlias(allNamespaces, "prod_new"))
+	assert.Equal(t, "", FindNamespaceByAlias(allNamespaces, "staging"))
+	assert.True(t, isNamespaceNameUsed(allNamespaces, "prod_new"))
+	assert.True(t, isNamespaceNameUsed(allNamespaces, "staging"))
+	assert.False(t, isNamespaceNameUsed(allNamespaces, "test"))
+}
+
+func TestBuildTopologyNamespace(t *testing.T) {
+	currentNodes := map[string]cluster.NodeInfo{"n1": {ID: "n1"}, "n2": {ID: "n2"}}
+	var p cluster.PartitionMetaInfo
+	p.Name = "test"
+	p.PartitionNum = 1
+	p.Replica = 2
+	p.RaftNodes = []string{"n1", "n2"}
+	nodeStats := map[string]map[string]*common.NamespaceStats{
+		"n1": {"test-0": {Name: "test-0", IsLeader: true, Load: &common.LoadStats{DataBytes: 100, Keys: 10}}},
+		"n2": {"test-0": {Name: "test-0", Load: &common.LoadStats{DataBytes: 90, Keys: 9}}},
+	}
+	nodes := map[string]*TopologyNode{"n1": {ID: "n1"}, "n2": {ID: "n2"}}
+	tns := buildTopologyNamespace(map[int]cluster.PartitionMetaInfo{0: p}, nodeStats, currentNodes, nodes)
+	assert.Equal(t, 1, len(tns.Partitions))
+	assert.Equal(t, PartitionHealthy, tns.Partitions[0].Health)
+	assert.Equal(t, int64(100), tns.DataBytes)
+	assert.Equal(t, 1, nodes["n1"].Leaders)
+	assert.Equal(t, 1, nodes["n2"].Partitions)
+
+	// no leader reported by the replicas
+	nodeStats["n1"]["test-0"].IsLeader = false
+	tns = buildTopologyNamespace(map[int]cluster.PartitionMetaInfo{0: p}, nodeStats, currentNodes, nodes)
+	assert.Equal(t, PartitionNoLeader, tns.Partitions[0].Health)
+	assert.Equal(t, 1, tns.Unhealthy)
+
+	nodeStats["n1"]["test-0"].IsLeader = true
+	delete(currentNodes, "n2")
+	tns = buildTopologyNamespace(map[int]cluster.PartitionMetaInfo{0: p}, nodeStats, currentNodes, nodes)
+	assert.Equal(t, PartitionUnderReplicated, tns.Partitions[0].Health)
+}
+
+func TestFailoverPolicy(t *testing.T) {
+	coord := NewPDCoordinator("test", &cluster.NodeInfo{NodeIP: "127.0.0.1"}, &cluster.Options{
+		NodeDownThresholdSecs: 60,
+		MaxRecoveries:         1,
+	})
+	coord.leaderNode = coord.myNode
+	fp := coord.GetFailoverPolicy()
+	assert.Equal(t, waitMigrateInterval, fp.migrateGrace())
+	assert.Equal(t, waitEmergencyMigrateInterval, fp.emergencyGrace())
+	assert.False(t, fp.needConfirm(3))
+	assert.Equal(t, ErrFailoverPolicyInvalid, coord.SetFailoverPolicy(FailoverPolicy{MaxRecoveries: -1}))
+
+	// the node lost before watched is down, the node just lost is waiting
+	assert.True(t, coord.isNodeDown("n1", &fp))
+	coord.markNodesLost([]string{"n1"}, nil)
+	assert.False(t, coord.isNodeDown("n1", &fp))
+	coord.markNodesLost(nil, []string{"n1"})
+	assert.True(t, coord.isNodeDown("n1", &fp))
+
+	var p1, p2 cluster.PartitionMetaInfo
+	p1.Name = "ns1"
+	p1.Partition = 0
+	p2.Name = "ns1"
+	p2.Partition = 1
+	assert.True(t, coord.canStartRecovery(&p1, &fp))
+	coord.startRecovery(&p1)
+	assert.True(t, coord.canStartRecovery(&p1, &fp))
+	assert.False(t, coord.canStartRecovery(&p2, &fp))
+	coord.finishFailover(p1.Name, p1.Partition)
+	assert.True(t, coord.canStartRecovery(&p2, &fp))
+
+	fp.ConfirmMaxNodes = 3
+	assert.Nil(t, coord.SetFailoverPolicy(fp))
+	assert.True(t, fp.needConfirm(3))
+	assert.False(t, fp.needConfirm(4))
+	assert.False(t, coord.checkFailoverConfirmed(&p1, []string{"n1"}, time.Now()))
+	assert.False(t, coord.checkFailoverConfirmed(&p2, []string{"n1"}, time.Now()))
+	assert.Equal(t, 2, len(coord.GetPendingFailovers()))
+	assert.Equal(t, ErrFailoverNotPending, coord.ConfirmFailover("ns2", -1))
+	assert.Nil(t, coord.ConfirmFailover("ns1", 1))
+	assert.False(t, coord.checkFailoverConfirmed(&p1, []string{"n1"}, time.Now()))
+	assert.True(t, coord.checkFailoverConfirmed(&p2, []string{"n1"}, time.Now()))
+	coord.cleanFailoverState(map[string]bool{p2.GetDesp(): true})
+	pendings := coord.GetPendingFailovers()
+	assert.Equal(t, 1, len(pendings))
+	assert.Equal(t, 1, pendings[0].Partition)
+	assert.True(t, pendings[0].Confirmed)
+}
+
+func TestBackupScheduleHistory(t *testing.T) {
+	assert.NotNil(t, validateBackupSchedule(&cluster.BackupSchedule{Cron: "* * *"}))
+	assert.NotNil(t, validateBackupSchedule(&cluster.BackupSchedule{Cron: "0 2 * * *",
+		Target: common.BackupTargetConfig{Type: "unknown"}}))
+
+	coord := NewPDCoordinator("test", &cluster.NodeInfo{NodeIP: "127.0.0.1"}, &cluster.Options{})
+	// the finished backup of the removed schedule is ignored
+	coord.finishScheduledBackup("ns1", BackupRunRecord{Success: true})
+	coord.backupStates = map[string]*namespaceBackupState{
+		"ns1": {cron: "0 2 * * *", running: true},
+	}
+	for i := 0; i < maxBackupHistoryRecords+2; i++ {
+		coord.finishScheduledBackup("ns1", BackupRunRecord{Success: i%2 == 0, StartTime: time.Unix(int64(i), 0)})
+	}
+	bs := coord.backupStates["ns1"]
+	assert.False(t, bs.running)
+	assert.Equal(t, maxBackupHistoryRecords, len(bs.history))
+	assert.Equal(t, time.Unix(int64(maxBackupHistoryRecords+1), 0), bs.history[len(bs.history)-1].StartTime)
+}
+
+func TestNamespaceExpireAction(t *testing.T) {
+	now := time.Now()
+	grace := time.Minute
+	assert.Equal(t, "", getNamespaceExpireAction(0, 0, grace, now))
+	assert.Equal(t, "", getNamespaceExpireAction(now.Add(time.Second).Unix(), 0, grace, now))
+	assert.Equal(t, NamespaceExpireEventExpired, getNamespaceExpireAction(now.Unix(), 0, grace, now))
+	// not deleted until notified even if expired long ago
+	assert.Equal(t, NamespaceExpireEventExpired, getNamespaceExpireAction(now.Add(-grace*2).Unix(), 0, grace, now))
+	notified := now.Add(-grace / 2).Unix()
+	assert.Equal(t, "", getNamespaceExpireAction(now.Add(-grace*2).Unix(), notified, grace, now))
+	notified = now.Add(-grace).Unix() - 1
+	assert.Equal(t, NamespaceExpireEventDeleted, getNamespaceExpireAction(now.Add(-grace*2).Unix(), notified, grace, now))
+}
+
+func TestSetNamespaceExpireTimePassed(t *testing.T) {
+	pd := NewPDCoordinator("test", &cluster.NodeInfo{NodeIP: "127.0.0.1"}, nil)
+	pd.leaderNode = pd.myNode
+	assert.Equal(t, errNamespaceExpireTimePassed, pd.SetNamespaceExpireTime("test", time.Now().Add(-time.Second)))
+}
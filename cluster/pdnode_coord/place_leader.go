@@ -0,0 +1,195 @@
+package pdnode_coord
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// limit the leader transfers in each balance round to avoid too much elections at once
+const maxLeaderTransferPerRound = 8
+
+// SetLeaderExcluded exclude the node from the leadership or not, the leaders on the
+// excluded node will be transferred to the other replicas. It is only kept in memory,
+// the no_leader tag of the data node should be used to keep it across the restart.
+func (dp *DataPlacement) SetLeaderExcluded(nid string, excluded bool) {
+	dp.excludedMutex.Lock()
+	if excluded {
+		dp.leaderExcluded[nid] = true
+	} else {
+		delete(dp.leaderExcluded, nid)
+	}
+	dp.excludedMutex.Unlock()
+}
+
+func (dp *DataPlacement) GetLeaderExcludedNodes() []string {
+	dp.excludedMutex.RLock()
+	nodes := make([]string, 0, len(dp.leaderExcluded))
+	for nid := range dp.leaderExcluded {
+		nodes = append(nodes, nid)
+	}
+	dp.excludedMutex.RUnlock()
+	sort.Strings(nodes)
+	return nodes
+}
+
+// the node is excluded from leadership by the api or the tag registered by the node itself
+func (dp *DataPlacement) isLeaderExcluded(nid string, currentNodes map[string]cluster.NodeInfo) bool {
+	dp.excludedMutex.RLock()
+	excluded := dp.leaderExcluded[nid]
+	dp.excludedMutex.RUnlock()
+	if excluded {
+		return true
+	}
+	n, ok := currentNodes[nid]
+	if !ok {
+		return false
+	}
+	v, ok := n.Tags[cluster.NoLeaderTag]
+	if !ok {
+		return false
+	}
+	s, _ := v.(string)
+	return s != "false"
+}
+
+// getExpectedLeader return the first node not excluded from leadership in the expected replicas
+func (dp *DataPlacement) getExpectedLeader(expected []string, currentNodes map[string]cluster.NodeInfo) string {
+	for _, nid := range expected {
+		if !dp.isLeaderExcluded(nid, currentNodes) {
+			return nid
+		}
+	}
+	return expected[0]
+}
+
+// decideLeaderTransfer choose a partition to transfer the leader, the leaders on the excluded
+// or unavailable nodes are moved first, and then the leader on the node with the most leaders is
+// moved to the replica with the least leaders if the difference is more than one.
+func decideLeaderTransfer(namespaceList []cluster.PartitionMetaInfo, currentNodes map[string]cluster.NodeInfo,
+	excluded func(string) bool) (*cluster.PartitionMetaInfo, string) {
+	leaderCnt := make(map[string]int)
+	for nid := range currentNodes {
+		if !excluded(nid) {
+			leaderCnt[nid] = 0
+		}
+	}
+	for _, nsInfo := range namespaceList {
+		if len(nsInfo.RaftNodes) == 0 {
+			continue
+		}
+		if _, ok := leaderCnt[nsInfo.RaftNodes[0]]; ok {
+			leaderCnt[nsInfo.RaftNodes[0]]++
+		}
+	}
+	// choose the replica with the least leaders for the partition
+	chooseTarget := func(nsInfo *cluster.PartitionMetaInfo, maxCnt int) string {
+		target := ""
+		for _, nid := range nsInfo.GetISR() {
+			cnt, ok := leaderCnt[nid]
+			if !ok || nid == nsInfo.RaftNodes[0] {
+				continue
+			}
+			if cnt < maxCnt || (cnt == maxCnt && target != "" && nid < target) {
+				target = nid
+				maxCnt = cnt
+			}
+		}
+		return target
+	}
+	for idx := range namespaceList {
+		nsInfo := &namespaceList[idx]
+		if len(nsInfo.RaftNodes) == 0 || len(nsInfo.Removings) > 0 {
+			continue
+		}
+		if _, ok := leaderCnt[nsInfo.RaftNodes[0]]; ok {
+			continue
+		}
+		if target := chooseTarget(nsInfo, int(^uint(0)>>1)); target != "" {
+			return nsInfo, target
+		}
+	}
+
+	var chosen *cluster.PartitionMetaInfo
+	chosenTarget := ""
+	maxDiff := 1
+	for idx := range namespaceList {
+		nsInfo := &namespaceList[idx]
+		if len(nsInfo.RaftNodes) == 0 || len(nsInfo.Removings) > 0 {
+			continue
+		}
+		cnt, ok := leaderCnt[nsInfo.RaftNodes[0]]
+		if !ok {
+			continue
+		}
+		target := chooseTarget(nsInfo, cnt)
+		if target == "" {
+			continue
+		}
+		if diff := cnt - leaderCnt[target]; diff > maxDiff {
+			chosen = nsInfo
+			chosenTarget = target
+			maxDiff = diff
+		}
+	}
+	return chosen, chosenTarget
+}
+
+// rebalanceLeaders balance the raft leaders across the nodes by the leader transfer, since
+// the leader carries the write and snapshot load.
+func (dp *DataPlacement) rebalanceLeaders(monitorChan chan struct{}) bool {
+	if !atomic.CompareAndSwapInt32(&dp.pdCoord.balanceWaiting, 0, 1) {
+		cluster.CoordLog().Infof("another balance is running, should wait")
+		return false
+	}
+	defer atomic.StoreInt32(&dp.pdCoord.balanceWaiting, 0)
+
+	moved := false
+	for i := 0; i < maxLeaderTransferPerRound; i++ {
+		if !dp.pdCoord.IsMineLeader() || !dp.pdCoord.IsClusterStable() {
+			return moved
+		}
+		allNamespaces, _, err := dp.pdCoord.register.GetAllNamespaces()
+		if err != nil {
+			cluster.CoordLog().Infof("scan namespaces error: %v", err)
+			return moved
+		}
+		namespaceList := make([]cluster.PartitionMetaInfo, 0)
+		for ns, parts := range allNamespaces {
+			if dp.isSchedulePaused(ns) {
+				continue
+			}
+			for _, p := range parts {
+				namespaceList = append(namespaceList, *(p.GetCopy()))
+			}
+		}
+		currentNodes := dp.pdCoord.getCurrentNodes(nil)
+		nsInfo, target := decideLeaderTransfer(namespaceList, currentNodes, func(nid string) bool {
+			return dp.isLeaderExcluded(nid, currentNodes)
+		})
+		if nsInfo == nil {
+			return moved
+		}
+		if ok, err := IsRaftNodeFullReady(nsInfo, target); err != nil || !ok {
+			cluster.CoordLog().Infof("namespace %v replica %v is not full ready for leader", nsInfo.GetDesp(), target)
+			return moved
+		}
+		cluster.CoordLog().Infof("balance leader of namespace %v from %v to %v", nsInfo.GetDesp(),
+			nsInfo.RaftNodes[0], target)
+		err = dp.pdCoord.TransferPartitionLeader(nsInfo.Name, nsInfo.Partition, target)
+		if err != nil {
+			cluster.CoordLog().Infof("transfer leader of namespace %v failed: %v", nsInfo.GetDesp(), err)
+			return moved
+		}
+		moved = true
+		// wait raft leader election
+		select {
+		case <-monitorChan:
+			return moved
+		case <-time.After(time.Second * 5):
+		}
+	}
+	return moved
+}
@@ -0,0 +1,269 @@
+package pdnode_coord
+
+import (
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+// the node is balanced if the load difference between the most loaded node and the
+// least loaded node is less than the ratio of the average load
+const loadBalanceThreshold = 0.2
+
+func (dp *DataPlacement) SetBalanceByLoad(enable bool) {
+	if enable {
+		atomic.StoreInt32(&dp.balanceByLoad, 1)
+	} else {
+		atomic.StoreInt32(&dp.balanceByLoad, 0)
+	}
+}
+
+func (dp *DataPlacement) IsBalanceByLoad() bool {
+	return atomic.LoadInt32(&dp.balanceByLoad) == 1
+}
+
+// NodeLoad is the load of the node computed from the partitions hosted on it, the load of
+// each partition is the ratio of its data size and write qps to the whole cluster.
+type NodeLoad struct {
+	NodeID     string  `json:"node_id"`
+	Load       float64 `json:"load"`
+	DataBytes  int64   `json:"data_bytes"`
+	WriteQPS   int64   `json:"write_qps"`
+	Partitions int     `json:"partitions"`
+}
+
+type partitionLoad struct {
+	dataBytes int64
+	writeQPS  int64
+	score     float64
+}
+
+// get the load stats of all the partitions on the nodes, the max value reported by
+// the replicas is used since the follower may lag.
+func getPartitionLoads(currentNodes map[string]cluster.NodeInfo) map[string]*partitionLoad {
+	loads := make(map[string]*partitionLoad)
+	for nid, n := range currentNodes {
+		var rsp struct {
+			Stats common.ServerStats `json:"stats"`
+		}
+		_, err := common.APIRequest("GET",
+			"http://"+net.JoinHostPort(n.NodeIP, n.HttpPort)+"/stats?leader_only=false",
+			nil, time.Second*5, &rsp)
+		if err != nil {
+			cluster.CoordLog().Infof("failed to get stats from node %v: %v", nid, err)
+			continue
+		}
+		for _, ns := range rsp.Stats.NSStats {
+			if ns.Load == nil {
+				continue
+			}
+			pl, ok := loads[ns.Name]
+			if !ok {
+				pl = &partitionLoad{}
+				loads[ns.Name] = pl
+			}
+			if ns.Load.DataBytes > pl.dataBytes {
+				pl.dataBytes = ns.Load.DataBytes
+			}
+			if ns.Load.WriteQPS > pl.writeQPS {
+				pl.writeQPS = ns.Load.WriteQPS
+			}
+		}
+	}
+	var totalBytes, totalQPS int64
+	for _, pl := range loads {
+		totalBytes += pl.dataBytes
+		totalQPS += pl.writeQPS
+	}
+	for _, pl := range loads {
+		if totalBytes > 0 {
+			pl.score += float64(pl.dataBytes) / float64(totalBytes)
+		}
+		if totalQPS > 0 {
+			pl.score += float64(pl.writeQPS) / float64(totalQPS)
+		}
+	}
+	return loads
+}
+
+func computeNodeLoads(namespaceList []cluster.PartitionMetaInfo, partLoads map[string]*partitionLoad,
+	currentNodes map[string]cluster.NodeInfo) map[string]*NodeLoad {
+	nodeLoads := make(map[string]*NodeLoad, len(currentNodes))
+	for nid := range currentNodes {
+		nodeLoads[nid] = &NodeLoad{NodeID: nid}
+	}
+	for _, nsInfo := range namespaceList {
+		pl, ok := partLoads[nsInfo.GetDesp()]
+		if !ok {
+			pl = &partitionLoad{}
+		}
+		for _, nid := range nsInfo.RaftNodes {
+			nl, ok := nodeLoads[nid]
+			if !ok {
+				continue
+			}
+			nl.Load += pl.score
+			nl.DataBytes += pl.dataBytes
+			nl.WriteQPS += pl.writeQPS
+			nl.Partitions++
+		}
+	}
+	return nodeLoads
+}
+
+func sortNodeLoads(nodeLoads map[string]*NodeLoad) []*NodeLoad {
+	sorted := make([]*NodeLoad, 0, len(nodeLoads))
+	for _, nl := range nodeLoads {
+		sorted = append(sorted, nl)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Load == sorted[j].Load {
+			return sorted[i].NodeID < sorted[j].NodeID
+		}
+		return sorted[i].Load > sorted[j].Load
+	})
+	return sorted
+}
+
+// decideLoadMove choose a partition to be moved from the most loaded node to the least
+// loaded node, the partition with the largest load which can reduce the difference is chosen.
+func decideLoadMove(namespaceList []cluster.PartitionMetaInfo, partLoads map[string]*partitionLoad,
+	nodeLoads map[string]*NodeLoad, nsNodes func(*cluster.PartitionMetaInfo) map[string]cluster.NodeInfo) (*cluster.PartitionMetaInfo, string, string) {
+	sorted := sortNodeLoads(nodeLoads)
+	if len(sorted) < 2 {
+		return nil, "", ""
+	}
+	var total float64
+	for _, nl := range sorted {
+		total += nl.Load
+	}
+	avg := total / float64(len(sorted))
+	from := sorted[0]
+	var chosen *cluster.PartitionMetaInfo
+	var chosenScore float64
+	to := ""
+	// try the least loaded node first
+	for i := len(sorted) - 1; i > 0 && chosen == nil; i-- {
+		diff := from.Load - sorted[i].Load
+		if diff <= avg*loadBalanceThreshold {
+			break
+		}
+		for idx := range namespaceList {
+			nsInfo := &namespaceList[idx]
+			if len(nsInfo.Removings) > 0 || nsInfo.ExpandState != "" || len(nsInfo.PlacementRules) > 0 ||
+				cluster.FindSlice(nsInfo.RaftNodes, from.NodeID) == -1 {
+				continue
+			}
+			if cluster.FindSlice(nsInfo.RaftNodes, sorted[i].NodeID) != -1 {
+				continue
+			}
+			pl, ok := partLoads[nsInfo.GetDesp()]
+			if !ok || pl.score <= 0 || pl.score >= diff || pl.score <= chosenScore {
+				continue
+			}
+			candidates := nsNodes(nsInfo)
+			if _, ok := candidates[sorted[i].NodeID]; !ok {
+				continue
+			}
+			// the move should not break the spread across the failure domains
+			moved := *nsInfo
+			moved.RaftNodes = make([]string, 0, len(nsInfo.RaftNodes))
+			for _, nid := range nsInfo.RaftNodes {
+				if nid != from.NodeID {
+					moved.RaftNodes = append(moved.RaftNodes, nid)
+				}
+			}
+			moved.RaftNodes = append(moved.RaftNodes, sorted[i].NodeID)
+			if len(checkPartitionPlacement(&moved, candidates)) > len(checkPartitionPlacement(nsInfo, candidates)) {
+				continue
+			}
+			chosen = nsInfo
+			chosenScore = pl.score
+			to = sorted[i].NodeID
+		}
+	}
+	if chosen == nil {
+		return nil, "", ""
+	}
+	return chosen, from.NodeID, to
+}
+
+// GetNodeLoads return the load of all the nodes ordered from the most loaded
+func (pdCoord *PDCoordinator) GetNodeLoads() ([]*NodeLoad, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	namespaceList := make([]cluster.PartitionMetaInfo, 0)
+	for _, parts := range allNamespaces {
+		for _, p := range parts {
+			namespaceList = append(namespaceList, p)
+		}
+	}
+	currentNodes := pdCoord.getCurrentNodes(nil)
+	partLoads := getPartitionLoads(currentNodes)
+	return sortNodeLoads(computeNodeLoads(namespaceList, partLoads, currentNodes)), nil
+}
+
+// rebalanceByLoad move one replica from the most loaded node to the least loaded node each
+// time, so the nodes hosting the large or busy partitions are not regarded as balanced
+// with the nodes hosting the same number of small partitions.
+func (dp *DataPlacement) rebalanceByLoad(monitorChan chan struct{}) (bool, bool) {
+	moved := false
+	if !atomic.CompareAndSwapInt32(&dp.pdCoord.balanceWaiting, 0, 1) {
+		cluster.CoordLog().Infof("another balance is running, should wait")
+		return moved, false
+	}
+	defer atomic.StoreInt32(&dp.pdCoord.balanceWaiting, 0)
+
+	allNamespaces, _, err := dp.pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		cluster.CoordLog().Infof("scan namespaces error: %v", err)
+		return moved, false
+	}
+	namespaceList := make([]cluster.PartitionMetaInfo, 0)
+	for _, parts := range allNamespaces {
+		for _, p := range parts {
+			namespaceList = append(namespaceList, *(p.GetCopy()))
+		}
+	}
+	if dp.pdCoord.hasRemovingNode() {
+		return moved, false
+	}
+	currentNodes := dp.pdCoord.getCurrentNodes(nil)
+	partLoads := getPartitionLoads(currentNodes)
+	nodeLoads := computeNodeLoads(namespaceList, partLoads, currentNodes)
+	nsInfo, from, to := decideLoadMove(namespaceList, partLoads, nodeLoads,
+		func(ns *cluster.PartitionMetaInfo) map[string]cluster.NodeInfo {
+			if dp.isSchedulePaused(ns.Name) {
+				return nil
+			}
+			return dp.pdCoord.getCurrentNodes(ns.Tags)
+		})
+	if nsInfo == nil {
+		cluster.CoordLog().Debugf("node loads are balanced: %v", sortNodeLoads(nodeLoads))
+		return moved, true
+	}
+	cluster.CoordLog().Infof("move namespace %v from node %v (load %v) to node %v (load %v)", nsInfo.GetDesp(),
+		from, nodeLoads[from].Load, to, nodeLoads[to].Load)
+	if ok, err := IsAllISRFullReady(nsInfo); err != nil || !ok {
+		cluster.CoordLog().Infof("namespace %v isr is not full ready while balancing", nsInfo.GetDesp())
+		return moved, false
+	}
+	newInfo, err := dp.addCatchupAndWaitReady(monitorChan, nsInfo, []string{to})
+	if err != nil {
+		return moved, false
+	}
+	if newInfo != nil {
+		nsInfo = newInfo
+	}
+	moved = true
+	if coordErr := dp.pdCoord.removeNamespaceFromNode(nsInfo, from); coordErr != nil {
+		cluster.CoordLog().Infof("remove namespace %v from node %v failed: %v", nsInfo.GetDesp(), from, coordErr)
+	}
+	return moved, false
+}
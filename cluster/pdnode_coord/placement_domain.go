@@ -0,0 +1,140 @@
+package pdnode_coord
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// the failure domains from the top level to the bottom level, the nodes register the
+// domain labels by the tags
+var failureDomainTags = []string{cluster.DCInfoTag, cluster.ZoneTag, cluster.RackTag}
+
+type PlacementViolation struct {
+	Namespace string   `json:"namespace"`
+	Partition int      `json:"partition"`
+	Domain    string   `json:"domain"`
+	Replicas  []string `json:"replicas"`
+	// the number of the different domains the replicas should be placed in
+	Expected int `json:"expected"`
+	Actual   int `json:"actual"`
+}
+
+func getNodeTagValue(n cluster.NodeInfo, tag string) string {
+	v, ok := n.Tags[tag]
+	if !ok {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// the domain of the node at the level, including all the upper domains
+func getNodeDomain(n cluster.NodeInfo, level int) string {
+	vals := make([]string, 0, level+1)
+	for i := 0; i <= level; i++ {
+		vals = append(vals, getNodeTagValue(n, failureDomainTags[i]))
+	}
+	return strings.Join(vals, "/")
+}
+
+// getFailureDomainNodeList return all the nodes ordered by combining the nodes in
+// different domains one by one at each level, the nodes in the same rack are sorted.
+func getFailureDomainNodeList(currentNodes map[string]cluster.NodeInfo) SortableStrings {
+	nodes := make([]cluster.NodeInfo, 0, len(currentNodes))
+	for nid, n := range currentNodes {
+		n.ID = nid
+		nodes = append(nodes, n)
+	}
+	return combineNodesByDomain(nodes, 0)
+}
+
+func combineNodesByDomain(nodes []cluster.NodeInfo, level int) SortableStrings {
+	if level >= len(failureDomainTags) {
+		nList := make(SortableStrings, 0, len(nodes))
+		for _, n := range nodes {
+			nList = append(nList, n.ID)
+		}
+		sort.Sort(nList)
+		return nList
+	}
+	domainNodes := make(map[string][]cluster.NodeInfo)
+	domains := make(SortableStrings, 0)
+	for _, n := range nodes {
+		d := getNodeTagValue(n, failureDomainTags[level])
+		if _, ok := domainNodes[d]; !ok {
+			domains = append(domains, d)
+		}
+		domainNodes[d] = append(domainNodes[d], n)
+	}
+	sort.Sort(domains)
+	nodeNameList := make([]SortableStrings, 0, len(domains))
+	for _, d := range domains {
+		nodeNameList = append(nodeNameList, combineNodesByDomain(domainNodes[d], level+1))
+	}
+	return combineNodeNameList(nodeNameList)
+}
+
+// checkPartitionPlacement report the violation if the replicas of the partition are
+// placed in less domains than expected at any level. The replica on the node not
+// in the current nodes is ignored.
+func checkPartitionPlacement(nsInfo *cluster.PartitionMetaInfo,
+	currentNodes map[string]cluster.NodeInfo) []PlacementViolation {
+	var violations []PlacementViolation
+	for level, tag := range failureDomainTags {
+		allDomains := make(map[string]struct{})
+		for _, n := range currentNodes {
+			allDomains[getNodeDomain(n, level)] = struct{}{}
+		}
+		if len(allDomains) <= 1 {
+			continue
+		}
+		usedDomains := make(map[string]struct{})
+		replicas := 0
+		for _, nid := range nsInfo.RaftNodes {
+			n, ok := currentNodes[nid]
+			if !ok {
+				continue
+			}
+			replicas++
+			usedDomains[getNodeDomain(n, level)] = struct{}{}
+		}
+		expected := replicas
+		if len(allDomains) < expected {
+			expected = len(allDomains)
+		}
+		if len(usedDomains) < expected {
+			violations = append(violations, PlacementViolation{
+				Namespace: nsInfo.Name,
+				Partition: nsInfo.Partition,
+				Domain:    tag,
+				Replicas:  nsInfo.RaftNodes,
+				Expected:  expected,
+				Actual:    len(usedDomains),
+			})
+		}
+	}
+	return violations
+}
+
+// CheckPlacementConstraints return all the partitions not spread across the failure domains.
+func (pdCoord *PDCoordinator) CheckPlacementConstraints() ([]PlacementViolation, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	violations := make([]PlacementViolation, 0)
+	for _, parts := range allNamespaces {
+		for _, nsInfo := range parts {
+			currentNodes := pdCoord.getCurrentNodes(nsInfo.Tags)
+			vs := checkPartitionPlacement(&nsInfo, currentNodes)
+			if len(vs) > 0 {
+				cluster.CoordLog().Infof("namespace %v replicas %v violate the placement constraints: %v",
+					nsInfo.GetDesp(), nsInfo.RaftNodes, vs)
+			}
+			violations = append(violations, vs...)
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,393 @@
+package pdnode_coord
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/spaolacci/murmur3"
+)
+
+var placementRuleCheckInterval = time.Second * 30
+
+var ErrInvalidPlacementRule = errors.New("invalid placement rule")
+
+// RulePlacementPlan is the replica changes of the partition to match the placement rules
+type RulePlacementPlan struct {
+	Namespace string   `json:"namespace"`
+	Partition int      `json:"partition"`
+	Current   []string `json:"current"`
+	Expected  []string `json:"expected"`
+	Adding    []string `json:"adding,omitempty"`
+	Removing  []string `json:"removing,omitempty"`
+	// the learner nodes should be added for each learner role
+	AddingLearners map[string][]string `json:"adding_learners,omitempty"`
+	// the learners not matching the rules, the learner should be removed manually
+	UnmatchedLearners map[string][]string `json:"unmatched_learners,omitempty"`
+	Error             string              `json:"error,omitempty"`
+}
+
+func (plan *RulePlacementPlan) isEmpty() bool {
+	return len(plan.Adding) == 0 && len(plan.Removing) == 0 &&
+		len(plan.AddingLearners) == 0 && len(plan.UnmatchedLearners) == 0 && plan.Error == ""
+}
+
+func validatePlacementRules(meta *cluster.NamespaceMetaInfo, rules []cluster.PlacementRule) error {
+	voters := 0
+	for _, rule := range rules {
+		if rule.Count <= 0 || rule.Tag == "" || len(rule.Values) == 0 {
+			return fmt.Errorf("%v: %v", ErrInvalidPlacementRule, rule)
+		}
+		switch rule.Role {
+		case cluster.PlacementRoleVoter:
+			voters += rule.Count
+		case cluster.PlacementRoleLearner:
+			if rule.LearnerRole == "" {
+				return fmt.Errorf("%v: missing the learner role: %v", ErrInvalidPlacementRule, rule)
+			}
+		default:
+			return fmt.Errorf("%v: unknown role: %v", ErrInvalidPlacementRule, rule)
+		}
+	}
+	if voters > 0 && voters != meta.Replica {
+		return fmt.Errorf("%v: the voters %v in rules should be the same as replica %v",
+			ErrInvalidPlacementRule, voters, meta.Replica)
+	}
+	return nil
+}
+
+func isNodeMatchRule(n cluster.NodeInfo, rule cluster.PlacementRule) bool {
+	v := getNodeTagValue(n, rule.Tag)
+	for _, rv := range rule.Values {
+		if v == rv {
+			return true
+		}
+	}
+	return false
+}
+
+// getRuleExpectedReplicas return the voters of the partition matching the placement rules,
+// the current replicas are kept as much as possible to avoid the data migration.
+func getRuleExpectedReplicas(nsInfo *cluster.PartitionMetaInfo, rules []cluster.PlacementRule,
+	currentNodes map[string]cluster.NodeInfo) ([]string, error) {
+	expected := make([]string, 0, nsInfo.Replica)
+	used := make(map[string]bool)
+	offset := int(murmur3.Sum32([]byte(nsInfo.Name))) + nsInfo.Partition
+	if offset < 0 {
+		offset = -offset
+	}
+	for _, rule := range rules {
+		if rule.Role != cluster.PlacementRoleVoter {
+			continue
+		}
+		maxPerValue := (rule.Count + len(rule.Values) - 1) / len(rule.Values)
+		valueCnt := make(map[string]int)
+		chosen := 0
+		for _, nid := range nsInfo.RaftNodes {
+			n, ok := currentNodes[nid]
+			if chosen >= rule.Count || !ok || used[nid] || !isNodeMatchRule(n, rule) {
+				continue
+			}
+			v := getNodeTagValue(n, rule.Tag)
+			if valueCnt[v] >= maxPerValue {
+				continue
+			}
+			valueCnt[v]++
+			used[nid] = true
+			expected = append(expected, nid)
+			chosen++
+		}
+		valueNodes := make(map[string]SortableStrings)
+		for nid, n := range currentNodes {
+			if isNodeMatchRule(n, rule) {
+				v := getNodeTagValue(n, rule.Tag)
+				valueNodes[v] = append(valueNodes[v], nid)
+			}
+		}
+		for chosen < rule.Count {
+			// choose the value with the least replicas which has any node left
+			best := ""
+			for _, v := range rule.Values {
+				left := false
+				for _, nid := range valueNodes[v] {
+					if !used[nid] {
+						left = true
+						break
+					}
+				}
+				if left && (best == "" || valueCnt[v] < valueCnt[best]) {
+					best = v
+				}
+			}
+			if best == "" {
+				return nil, fmt.Errorf("no enough nodes for the placement rule: %v", rule)
+			}
+			nodes := valueNodes[best]
+			sort.Sort(nodes)
+			for i := 0; i < len(nodes); i++ {
+				nid := nodes[(offset+i)%len(nodes)]
+				if !used[nid] {
+					valueCnt[best]++
+					used[nid] = true
+					expected = append(expected, nid)
+					chosen++
+					break
+				}
+			}
+		}
+	}
+	return expected, nil
+}
+
+// decideRuleLearners return the learner nodes should be added for the learner rules of the role,
+// and the current learners not matching any rule. All the learner nodes of the role are
+// added if no rule for the role.
+func decideRuleLearners(rules []cluster.PlacementRule, role string, learnerIDs []string,
+	learnerNodes []cluster.NodeInfo) ([]string, []string) {
+	roleRules := make([]cluster.PlacementRule, 0)
+	for _, rule := range rules {
+		if rule.Role == cluster.PlacementRoleLearner && rule.LearnerRole == role {
+			roleRules = append(roleRules, rule)
+		}
+	}
+	nodes := make(map[string]cluster.NodeInfo)
+	for _, n := range learnerNodes {
+		if n.LearnerRole == role {
+			nodes[n.GetID()] = n
+		}
+	}
+	nodeIDs := make(SortableStrings, 0, len(nodes))
+	for nid := range nodes {
+		nodeIDs = append(nodeIDs, nid)
+	}
+	sort.Sort(nodeIDs)
+	adding := make([]string, 0)
+	if len(roleRules) == 0 {
+		for _, nid := range nodeIDs {
+			if cluster.FindSlice(learnerIDs, nid) == -1 {
+				adding = append(adding, nid)
+			}
+		}
+		return adding, nil
+	}
+	matched := make(map[string]bool)
+	for _, rule := range roleRules {
+		cnt := 0
+		for _, nid := range learnerIDs {
+			n, ok := nodes[nid]
+			if ok && !matched[nid] && isNodeMatchRule(n, rule) && cnt < rule.Count {
+				matched[nid] = true
+				cnt++
+			}
+		}
+		for _, nid := range nodeIDs {
+			if cnt >= rule.Count {
+				break
+			}
+			if matched[nid] || cluster.FindSlice(learnerIDs, nid) != -1 || !isNodeMatchRule(nodes[nid], rule) {
+				continue
+			}
+			matched[nid] = true
+			adding = append(adding, nid)
+			cnt++
+		}
+	}
+	unmatched := make([]string, 0)
+	for _, nid := range learnerIDs {
+		if !matched[nid] {
+			unmatched = append(unmatched, nid)
+		}
+	}
+	return adding, unmatched
+}
+
+func (pdCoord *PDCoordinator) getRulePlacementPlan(nsInfo *cluster.PartitionMetaInfo,
+	rules []cluster.PlacementRule) RulePlacementPlan {
+	plan := RulePlacementPlan{
+		Namespace: nsInfo.Name,
+		Partition: nsInfo.Partition,
+		Current:   nsInfo.RaftNodes,
+	}
+	expected, err := getRuleExpectedReplicas(nsInfo, rules, pdCoord.getCurrentNodes(nsInfo.Tags))
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	hasVoterRule := len(expected) > 0
+	if hasVoterRule {
+		plan.Expected = expected
+		for _, nid := range expected {
+			if cluster.FindSlice(nsInfo.RaftNodes, nid) == -1 {
+				plan.Adding = append(plan.Adding, nid)
+			}
+		}
+		for _, nid := range nsInfo.RaftNodes {
+			if cluster.FindSlice(expected, nid) == -1 {
+				plan.Removing = append(plan.Removing, nid)
+			}
+		}
+	}
+	learnerNodes, _ := pdCoord.getCurrentLearnerNodes()
+	nodeList := make([]cluster.NodeInfo, 0, len(learnerNodes))
+	roles := make(map[string]bool)
+	for _, n := range learnerNodes {
+		nodeList = append(nodeList, n)
+		roles[n.LearnerRole] = true
+	}
+	for _, rule := range rules {
+		if rule.Role == cluster.PlacementRoleLearner {
+			roles[rule.LearnerRole] = true
+		}
+	}
+	for role := range roles {
+		adding, unmatched := decideRuleLearners(rules, role, nsInfo.LearnerNodes[role], nodeList)
+		if len(adding) > 0 {
+			if plan.AddingLearners == nil {
+				plan.AddingLearners = make(map[string][]string)
+			}
+			plan.AddingLearners[role] = adding
+		}
+		if len(unmatched) > 0 {
+			if plan.UnmatchedLearners == nil {
+				plan.UnmatchedLearners = make(map[string][]string)
+			}
+			plan.UnmatchedLearners[role] = unmatched
+		}
+	}
+	return plan
+}
+
+// SetPlacementRules save the placement rules of the namespace, the replicas will be moved
+// to match the rules by the scheduler. The empty rules will reset to the default balance.
+func (pdCoord *PDCoordinator) SetPlacementRules(ns string, rules []cluster.PlacementRule) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while set placement rules")
+		return ErrNotLeader
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return errors.New("invalid namespace name")
+	}
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		cluster.CoordLog().Infof("get namespace key %v failed :%v", ns, err)
+		return err
+	}
+	if err := validatePlacementRules(&meta, rules); err != nil {
+		return err
+	}
+	meta.PlacementRules = rules
+	cluster.CoordLog().Infof("change namespace %v placement rules to %v", ns, rules)
+	return pdCoord.register.UpdateNamespaceMetaInfo(ns, &meta, meta.MetaEpoch())
+}
+
+func (pdCoord *PDCoordinator) GetPlacementRules(ns string) ([]cluster.PlacementRule, error) {
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		return nil, err
+	}
+	return meta.PlacementRules, nil
+}
+
+// DryRunPlacementRules return the replica changes of the partitions if the rules are applied,
+// nothing is changed.
+func (pdCoord *PDCoordinator) DryRunPlacementRules(ns string, rules []cluster.PlacementRule) ([]RulePlacementPlan, error) {
+	meta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePlacementRules(&meta, rules); err != nil {
+		return nil, err
+	}
+	parts, err := pdCoord.register.GetNamespaceInfo(ns)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]RulePlacementPlan, 0)
+	for idx := range parts {
+		plan := pdCoord.getRulePlacementPlan(&parts[idx], rules)
+		if !plan.isEmpty() {
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].Partition < plans[j].Partition
+	})
+	return plans, nil
+}
+
+// handlePlacementRules move the replicas to match the placement rules, only one replica is
+// added or removed in each round to reduce the migration traffic.
+func (pdCoord *PDCoordinator) handlePlacementRules(monitorChan chan struct{}) {
+	ticker := time.NewTicker(placementRuleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-monitorChan:
+			return
+		case <-ticker.C:
+			if !pdCoord.IsMineLeader() || !pdCoord.IsClusterStable() || pdCoord.hasRemovingNode() ||
+				pdCoord.dpm.isSchedulePaused("") {
+				continue
+			}
+			allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+			if err != nil {
+				cluster.CoordLog().Infof("scan namespaces error: %v", err)
+				continue
+			}
+			for _, parts := range allNamespaces {
+				if pdCoord.reconcilePlacementRules(monitorChan, parts) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// return true if any replica changed
+func (pdCoord *PDCoordinator) reconcilePlacementRules(monitorChan chan struct{},
+	parts map[int]cluster.PartitionMetaInfo) bool {
+	for _, p := range parts {
+		nsInfo := *(p.GetCopy())
+		if len(nsInfo.PlacementRules) == 0 || nsInfo.ExpandState != "" || len(nsInfo.Removings) > 0 ||
+			pdCoord.dpm.isSchedulePaused(nsInfo.Name) {
+			continue
+		}
+		plan := pdCoord.getRulePlacementPlan(&nsInfo, nsInfo.PlacementRules)
+		if plan.Error != "" {
+			cluster.CoordLog().Infof("namespace %v can not match the placement rules: %v", nsInfo.GetDesp(), plan.Error)
+			continue
+		}
+		if len(plan.Adding) == 0 && len(plan.Removing) == 0 {
+			continue
+		}
+		if !atomic.CompareAndSwapInt32(&pdCoord.balanceWaiting, 0, 1) {
+			return false
+		}
+		defer atomic.StoreInt32(&pdCoord.balanceWaiting, 0)
+		if ok, err := IsAllISRFullReady(&nsInfo); err != nil || !ok {
+			cluster.CoordLog().Infof("namespace %v isr is not full ready while placing by rules", nsInfo.GetDesp())
+			return false
+		}
+		cluster.CoordLog().Infof("move the replicas of namespace %v from %v to %v by the placement rules",
+			nsInfo.GetDesp(), nsInfo.RaftNodes, plan.Expected)
+		if len(plan.Adding) > 0 {
+			_, err := pdCoord.dpm.addCatchupAndWaitReady(monitorChan, &nsInfo, plan.Adding[:1])
+			if err != nil {
+				cluster.CoordLog().Infof("add node %v to namespace %v failed: %v", plan.Adding[0], nsInfo.GetDesp(), err)
+			}
+			return true
+		}
+		if len(nsInfo.GetISR()) <= nsInfo.Replica {
+			return false
+		}
+		if coordErr := pdCoord.removeNamespaceFromNode(&nsInfo, plan.Removing[0]); coordErr != nil {
+			cluster.CoordLog().Infof("remove node %v from namespace %v failed: %v", plan.Removing[0], nsInfo.GetDesp(), coordErr)
+		}
+		return true
+	}
+	return false
+}
@@ -9,9 +9,15 @@ import (
 var (
 	ErrKeyAlreadyExist           = errors.New("Key already exist")
 	ErrKeyNotFound               = errors.New("Key not found")
+	ErrKeyEpochMismatch          = errors.New("Key epoch mismatch")
 	ErrLearnerRoleInvalidChanged = errors.New("node learner role should never be changed")
 	ErrLearnerRoleUnsupported    = errors.New("node learner role is not supported")
 	DCInfoTag                    = "dc_info"
+	// the failure domains under the dc, the replicas will be spread across them
+	ZoneTag = "zone"
+	RackTag = "rack"
+	// the node with this tag (not "false") will never be chosen as the leader by the balance
+	NoLeaderTag = "no_leader"
 )
 
 type EpochType int64
@@ -62,12 +68,77 @@ type NamespaceMetaInfo struct {
 	SnapCount        int
 	Tags             map[string]interface{}
 	ExpirationPolicy string
+	// the rocksdb options for the namespace to override the node options
+	RocksDBOpts common.RockOptionsOverride
+	// the max keys and bytes of the namespace, 0 means no limit
+	QuotaMaxKeys  int64
+	QuotaMaxBytes int64
+	// the max size and age (in seconds) of the raft logs since the last snapshot, 0 means no limit
+	LogRetentionBytes int64
+	LogRetentionSecs  int64
+	// the new partition number while expanding the partitions online, the new partitions
+	// are created but the keys are routed by the PartitionNum until the data migrated.
+	ExpandPartitionNum int
+	// the expanding state, see common.ExpandState*
+	ExpandState string
+	// the placement rules of the replicas, the replicas are placed by the default
+	// balance if empty
+	PlacementRules []PlacementRule
+	// the new name of the renamed namespace, the namespace can be accessed
+	// by both the names.
+	AliasName string
+	// reject all the writes to the namespace while frozen, the reads are still allowed
+	Frozen bool
+	// the periodic backup triggered by pd, no scheduled backup if nil
+	BackupSchedule *BackupSchedule
+	// the unix time in seconds after which the namespace is expired and will be deleted
+	// by pd after the grace period, 0 means never expired
+	ExpireTime int64
+	// the unix time in seconds while the expiration is notified, the namespace will be
+	// deleted after the grace period since notified. It is reset if the expire time changed.
+	ExpireNotifiedTime int64
+}
+
+// BackupSchedule upload the backups of all the partitions of the namespace to the target
+// at the time matched the cron spec.
+type BackupSchedule struct {
+	// the 5 fields cron spec (minute hour day month weekday) in the local time of pd
+	Cron   string                    `json:"cron"`
+	Target common.BackupTargetConfig `json:"target"`
+	// the timeout for each partition backup in seconds, 0 means the default
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+const (
+	PlacementRoleVoter   = "voter"
+	PlacementRoleLearner = "learner"
+)
+
+// PlacementRule place the count of replicas on the nodes with the tag values, the
+// replicas are spread across the values as even as possible. For example, the rule
+// {voter, 3, zone, [A, B, C]} place one voter in each zone.
+type PlacementRule struct {
+	Role string `json:"role"`
+	// the role of the learner nodes, only used for the learner rule
+	LearnerRole string   `json:"learner_role,omitempty"`
+	Count       int      `json:"count"`
+	Tag         string   `json:"tag"`
+	Values      []string `json:"values"`
 }
 
 func (self *NamespaceMetaInfo) MetaEpoch() EpochType {
 	return self.metaEpoch
 }
 
+// AllPartitionNum return the number of all the partitions including the new partitions
+// while expanding.
+func (self *NamespaceMetaInfo) AllPartitionNum() int {
+	if self.ExpandPartitionNum > self.PartitionNum {
+		return self.ExpandPartitionNum
+	}
+	return self.PartitionNum
+}
+
 type RemovingInfo struct {
 	RemoveTime      int64
 	RemoveReplicaID uint64
@@ -209,6 +280,8 @@ type Register interface {
 	GetNamespacesNotifyChan() chan struct{}
 	GetNamespaceSchemas(ns string) (map[string]SchemaInfo, error)
 	GetNamespaceTableSchema(ns string, table string) (*SchemaInfo, error)
+	// the cluster wide config which can be changed while running
+	GetClusterDynamicConf() (map[string]string, EpochType, error)
 	Stop()
 }
 
@@ -243,6 +316,7 @@ type PDRegister interface {
 	UpdateNamespacePartReplicaInfo(ns string, partition int, replicaInfo *PartitionReplicaInfo, oldGen EpochType) error
 	PrepareNamespaceMinGID() (int64, error)
 	UpdateNamespaceSchema(ns string, table string, schema *SchemaInfo) error
+	UpdateClusterDynamicConf(conf map[string]string, oldGen EpochType) error
 }
 
 type DataNodeRegister interface {
@@ -258,4 +332,6 @@ type DataNodeRegister interface {
 	UpdateNamespaceLeader(ns string, partition int, rl RealLeader, oldGen EpochType) (EpochType, error)
 	GetNamespaceLeader(ns string, partition int) (string, EpochType, error)
 	NewRegisterNodeID() (uint64, error)
+	// get the newest cluster dynamic config and watch the change of it.
+	WatchClusterDynamicConf(confC chan map[string]string, stop chan struct{})
 }
@@ -11,18 +11,20 @@ import (
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	etcdlock "github.com/absolute8511/xlock2"
 	"github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/coreos/etcd/pkg/transport"
 	"golang.org/x/net/context"
 )
 
 const (
-	EVENT_WATCH_L_CREATE = iota
-	EVENT_WATCH_L_DELETE
-)
-
-const (
+	// the ttl in seconds of the lease for the registered nodes and the pd leader session
 	ETCD_TTL = 60
+	// the timeout for each request to etcd
+	etcdRequestTimeout = time.Second * 10
+	etcdDialTimeout    = time.Second * 5
 )
 
 const (
@@ -37,79 +39,75 @@ const (
 	PD_ROOT_DIR            = "PDInfo"
 	PD_NODE_DIR            = "PDNodes"
 	PD_LEADER_SESSION      = "PDLeaderSession"
+	CLUSTER_DYNAMIC_CONF   = "DynamicConf"
 )
 
-const (
-	ETCD_LOCK_NAMESPACE = "zanredisdb"
-)
-
-type MasterChanInfo struct {
-	processStopCh chan bool
-	stoppedCh     chan bool
-}
+// ErrMetaNotMigrated means the meta data of the cluster is only found by the old etcd v2 API,
+// and the new version will regard the cluster as a new one if started.
+var ErrMetaNotMigrated = errors.New("the cluster meta data is stored by the etcd v2 API, migrate it to v3 before starting")
 
-func IsEtcdNotFile(err error) bool {
-	return isEtcdErrorNum(err, client.ErrorCodeNotFile)
+// EtcdTLSConfig is the tls files used to access the etcd cluster, the tls is
+// disabled if all the files are empty.
+type EtcdTLSConfig struct {
+	CertFile   string
+	KeyFile    string
+	CACertFile string
 }
 
-func IsEtcdNodeExist(err error) bool {
-	return isEtcdErrorNum(err, client.ErrorCodeNodeExist)
+func (tc *EtcdTLSConfig) isEmpty() bool {
+	return tc == nil || (tc.CertFile == "" && tc.KeyFile == "" && tc.CACertFile == "")
 }
 
-func isEtcdErrorNum(err error, errorCode int) bool {
-	if err != nil {
-		if etcdError, ok := err.(client.Error); ok {
-			return etcdError.Code == errorCode
+func newEtcdClient(host string, tlsConf *EtcdTLSConfig) (*clientv3.Client, error) {
+	cfg := clientv3.Config{
+		Endpoints:   strings.Split(host, ","),
+		DialTimeout: etcdDialTimeout,
+	}
+	if !tlsConf.isEmpty() {
+		tlsInfo := transport.TLSInfo{
+			CertFile:      tlsConf.CertFile,
+			KeyFile:       tlsConf.KeyFile,
+			TrustedCAFile: tlsConf.CACertFile,
 		}
-		// NOTE: There are other error types returned
+		tc, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tc
 	}
-	return false
+	return clientv3.New(cfg)
 }
 
-func exchangeNodeValue(c *etcdlock.EtcdClient, nodePath string, initValue string,
-	valueChangeFn func(bool, string) (string, error)) error {
-	rsp, err := c.Get(nodePath, false, false)
-	isNew := false
-	if err != nil {
-		if client.IsKeyNotFound(err) {
-			isNew = true
-			rsp, err = c.Create(nodePath, initValue, 0)
-			if err != nil {
-				if !IsEtcdNotFile(err) {
-					return err
-				}
-			}
-		} else {
-			return err
+func newEtcdV2Client(endpoints []string, tlsConf *EtcdTLSConfig) (client.Client, error) {
+	var tlsInfo transport.TLSInfo
+	if !tlsConf.isEmpty() {
+		tlsInfo = transport.TLSInfo{
+			CertFile:      tlsConf.CertFile,
+			KeyFile:       tlsConf.KeyFile,
+			TrustedCAFile: tlsConf.CACertFile,
 		}
 	}
-	var newValue string
-	retry := 5
-	for retry > 0 {
-		retry--
-		newValue, err = valueChangeFn(isNew, rsp.Node.Value)
-		if err != nil {
-			return err
-		}
-		isNew = false
-		rsp, err = c.CompareAndSwap(nodePath, newValue, 0, "", rsp.Node.ModifiedIndex)
-		if err != nil {
-			time.Sleep(time.Millisecond * 10)
-			rsp, err = c.Get(nodePath, false, false)
-			if err != nil {
-				return err
-			}
-		} else {
-			return nil
-		}
+	tr, err := transport.NewTransport(tlsInfo, etcdDialTimeout)
+	if err != nil {
+		return nil, err
 	}
-	return err
+	return client.New(client.Config{
+		Endpoints:               endpoints,
+		Transport:               tr,
+		HeaderTimeoutPerRequest: etcdRequestTimeout,
+	})
+}
+
+// the prefix for all the keys under the dir
+func dirPrefix(dir string) string {
+	return dir + "/"
 }
 
 type EtcdRegister struct {
 	nsMutex sync.Mutex
 
-	client               *etcdlock.EtcdClient
+	client               *clientv3.Client
+	tlsConf              *EtcdTLSConfig
 	clusterID            string
 	namespaceRoot        string
 	clusterPath          string
@@ -121,19 +119,26 @@ type EtcdRegister struct {
 	nsChangedChan        chan struct{}
 	triggerScanCh        chan struct{}
 	wg                   sync.WaitGroup
+	// the revision of the last namespace change watched, used as the namespace epoch
+	// since the deletion can not be found from the modify revision of the keys.
+	nsChangedRev int64
 }
 
-func NewEtcdRegister(host string) *EtcdRegister {
-	client := etcdlock.NewEClient(host)
+func NewEtcdRegister(host string, tlsConf *EtcdTLSConfig) (*EtcdRegister, error) {
+	client, err := newEtcdClient(host, tlsConf)
+	if err != nil {
+		return nil, err
+	}
 	r := &EtcdRegister{
 		allNamespaceInfos:    make(map[string]map[int]PartitionMetaInfo),
 		watchNamespaceStopCh: make(chan struct{}),
 		client:               client,
+		tlsConf:              tlsConf,
 		ifNamespaceChanged:   1,
 		nsChangedChan:        make(chan struct{}, 3),
 		triggerScanCh:        make(chan struct{}, 3),
 	}
-	return r
+	return r, nil
 }
 
 func (etcdReg *EtcdRegister) InitClusterID(id string) {
@@ -143,6 +148,36 @@ func (etcdReg *EtcdRegister) InitClusterID(id string) {
 	etcdReg.pdNodeRootPath = etcdReg.getPDNodeRootPath()
 }
 
+// CheckMetaMigrated return ErrMetaNotMigrated if the meta data of the cluster is not found by
+// the v3 API but found by the v2 API, which means the cluster is upgraded from the old version
+// and the meta data should be migrated (such as `ETCDCTL_API=3 etcdctl migrate`) first.
+func (etcdReg *EtcdRegister) CheckMetaMigrated(clusterID string) error {
+	clusterPath := path.Join("/", ROOT_DIR, clusterID)
+	exist, err := etcdReg.isDirExist(clusterPath)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return nil
+	}
+	c, err := newEtcdV2Client(etcdReg.client.Endpoints(), etcdReg.tlsConf)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err = client.NewKeysAPI(c).Get(ctx, clusterPath, nil)
+	if err == nil {
+		coordLog.Errorf("the meta data of cluster %v is only found by the etcd v2 API", clusterID)
+		return ErrMetaNotMigrated
+	}
+	if !client.IsKeyNotFound(err) {
+		// the v2 API may be disabled on the etcd server, so no old meta data
+		coordLog.Infof("check the etcd v2 meta data of cluster %v failed: %v", clusterID, err)
+	}
+	return nil
+}
+
 func (etcdReg *EtcdRegister) Start() {
 	etcdReg.watchNamespaceStopCh = make(chan struct{})
 	etcdReg.wg.Add(2)
@@ -169,18 +204,283 @@ func (etcdReg *EtcdRegister) Stop() {
 	etcdReg.wg.Wait()
 }
 
-func (etcdReg *EtcdRegister) GetAllPDNodes() ([]NodeInfo, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.pdNodeRootPath, false, false)
+func (etcdReg *EtcdRegister) get(key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	return etcdReg.client.Get(ctx, key, opts...)
+}
+
+// getValue return the key value, ErrKeyNotFound if the key is not exist
+func (etcdReg *EtcdRegister) getValue(key string) (*mvccpb.KeyValue, error) {
+	rsp, err := etcdReg.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return rsp.Kvs[0], nil
+}
+
+// getDir return all the keys under the dir, ErrKeyNotFound if no key in the dir
+func (etcdReg *EtcdRegister) getDir(dir string) (*clientv3.GetResponse, error) {
+	rsp, err := etcdReg.get(dirPrefix(dir), clientv3.WithPrefix())
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return nil, ErrKeyNotFound
+		return nil, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return rsp, nil
+}
+
+// the dir is exist if the key of the dir itself or any key under the dir is exist
+func (etcdReg *EtcdRegister) isDirExist(dir string) (bool, error) {
+	rsp, err := etcdReg.get(dir, clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	if rsp.Count > 0 {
+		return true, nil
+	}
+	rsp, err = etcdReg.get(dirPrefix(dir), clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	return rsp.Count > 0, nil
+}
+
+func (etcdReg *EtcdRegister) deleteDir(dir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := etcdReg.client.Txn(ctx).Then(
+		clientv3.OpDelete(dir),
+		clientv3.OpDelete(dirPrefix(dir), clientv3.WithPrefix()),
+	).Commit()
+	return err
+}
+
+// createKey put the value only if the key is not exist, and return the revision as the epoch
+func (etcdReg *EtcdRegister) createKey(key string, value string) (EpochType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	rsp, err := etcdReg.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value)).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !rsp.Succeeded {
+		return 0, ErrKeyAlreadyExist
+	}
+	return EpochType(rsp.Header.Revision), nil
+}
+
+// compareAndSwap put the value only if the key is not modified since the old epoch, and
+// return the new epoch
+func (etcdReg *EtcdRegister) compareAndSwap(key string, value string, oldGen EpochType) (EpochType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	rsp, err := etcdReg.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", int64(oldGen))).
+		Then(clientv3.OpPut(key, value)).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !rsp.Succeeded {
+		return 0, ErrKeyEpochMismatch
+	}
+	return EpochType(rsp.Header.Revision), nil
+}
+
+func (etcdReg *EtcdRegister) exchangeNodeValue(nodePath string, initValue string,
+	valueChangeFn func(bool, string) (string, error)) error {
+	kv, err := etcdReg.getValue(nodePath)
+	isNew := false
+	if err != nil {
+		if err != ErrKeyNotFound {
+			return err
+		}
+		isNew = true
+		_, err = etcdReg.createKey(nodePath, initValue)
+		if err != nil && err != ErrKeyAlreadyExist {
+			return err
+		}
+		kv, err = etcdReg.getValue(nodePath)
+		if err != nil {
+			return err
+		}
+	}
+	var newValue string
+	retry := 5
+	for retry > 0 {
+		retry--
+		newValue, err = valueChangeFn(isNew, string(kv.Value))
+		if err != nil {
+			return err
+		}
+		isNew = false
+		_, err = etcdReg.compareAndSwap(nodePath, newValue, EpochType(kv.ModRevision))
+		if err != nil {
+			time.Sleep(time.Millisecond * 10)
+			kv, err = etcdReg.getValue(nodePath)
+			if err != nil {
+				return err
+			}
+		} else {
+			return nil
+		}
+	}
+	return ErrKeyEpochMismatch
+}
+
+// putWithLease put the value attached to a new lease with the ETCD_TTL, the key will be
+// deleted by etcd if the lease is not kept alive.
+func (etcdReg *EtcdRegister) putWithLease(key string, value string) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	lrsp, err := etcdReg.client.Grant(ctx, ETCD_TTL)
+	if err != nil {
+		return 0, err
+	}
+	_, err = etcdReg.client.Put(ctx, key, value, clientv3.WithLease(lrsp.ID))
+	if err != nil {
+		return 0, err
+	}
+	return lrsp.ID, nil
+}
+
+// keepAlive keep the lease of the registered node alive until stopped, the node will be
+// registered again with a new lease if the lease is lost (such as expired while the etcd
+// is not reachable for a long time).
+func (etcdReg *EtcdRegister) keepAlive(key string, value string, leaseID clientv3.LeaseID, stopC chan bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		kaC, err := etcdReg.client.KeepAlive(ctx, leaseID)
+		if err != nil {
+			coordLog.Errorf("keep alive key[%s] error: %s", key, err.Error())
+		} else {
+			for range kaC {
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		coordLog.Warningf("the lease of key[%s] is lost, register again", key)
+		newID, err := etcdReg.putWithLease(key, value)
+		if err != nil {
+			coordLog.Errorf("set key error: %s", err.Error())
+			continue
+		}
+		leaseID = newID
+	}
+}
+
+// watchChanges watch the key (or the keys under the prefix) after the revision and call the
+// onChange for the changes, the onChange should read the newest data and return the revision
+// of the read. It is also called after the watch is broken (such as the revision compacted)
+// since the changes may be lost while re-watching. It returns after the ctx is done.
+func (etcdReg *EtcdRegister) watchChanges(ctx context.Context, key string, isPrefix bool, rev int64,
+	onChange func() (int64, error)) {
+	for {
+		var opts []clientv3.OpOption
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev+1))
+		}
+		if isPrefix {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+		wctx, wcancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		for wrsp := range etcdReg.client.Watch(wctx, key, opts...) {
+			if err := wrsp.Err(); err != nil {
+				coordLog.Errorf("watcher key[%s] error: %s", key, err.Error())
+				break
+			}
+			if len(wrsp.Events) == 0 {
+				continue
+			}
+			rev = wrsp.Header.Revision
+			if _, err := onChange(); err != nil {
+				coordLog.Errorf("key[%s] changed while read error: %s", key, err.Error())
+				break
+			}
 		}
+		wcancel()
+		for {
+			select {
+			case <-ctx.Done():
+				coordLog.Infof("watch key[%s] canceled.", key)
+				return
+			case <-time.After(time.Second):
+			}
+			// should read the newest data since the changes may be lost while the watch is broken
+			newRev, err := onChange()
+			if err == nil {
+				rev = newRev
+				break
+			}
+			coordLog.Errorf("rewatch and get key[%s] error: %s", key, err.Error())
+		}
+	}
+}
+
+// watchLeaderNode watch the leader of the election and notify the leader node while changed,
+// the empty node will be notified while the leader is lost.
+func (etcdReg *EtcdRegister) watchLeaderNode(ctx context.Context, electionPath string, leader chan *NodeInfo) {
+	lastValue := ""
+	notify := func() (int64, error) {
+		rsp, err := etcdReg.get(dirPrefix(electionPath), clientv3.WithFirstCreate()...)
+		if err != nil {
+			return 0, err
+		}
+		var node NodeInfo
+		value := ""
+		if len(rsp.Kvs) > 0 {
+			value = string(rsp.Kvs[0].Value)
+			if err := json.Unmarshal(rsp.Kvs[0].Value, &node); err != nil {
+				coordLog.Infof("unmarshal leader %v failed: %v", value, err)
+			}
+		}
+		if value == lastValue {
+			return rsp.Header.Revision, nil
+		}
+		coordLog.Infof("key[%s] leader changed to: %s", electionPath, value)
+		select {
+		case leader <- &node:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		lastValue = value
+		return rsp.Header.Revision, nil
+	}
+	rev, err := notify()
+	if err != nil {
+		coordLog.Errorf("get key[%s] error: %s", electionPath, err.Error())
+	}
+	etcdReg.watchChanges(ctx, dirPrefix(electionPath), true, rev, notify)
+}
+
+func (etcdReg *EtcdRegister) GetAllPDNodes() ([]NodeInfo, error) {
+	rsp, err := etcdReg.getDir(etcdReg.pdNodeRootPath)
+	if err != nil {
 		return nil, err
 	}
 	nodeList := make([]NodeInfo, 0)
-	for _, node := range rsp.Node.Nodes {
+	for _, kv := range rsp.Kvs {
 		var nodeInfo NodeInfo
-		if err = json.Unmarshal([]byte(node.Value), &nodeInfo); err != nil {
+		if err = json.Unmarshal(kv.Value, &nodeInfo); err != nil {
 			continue
 		}
 		nodeList = append(nodeList, nodeInfo)
@@ -201,22 +501,20 @@ func (etcdReg *EtcdRegister) GetAllNamespaces() (map[string]map[int]PartitionMet
 }
 
 func (etcdReg *EtcdRegister) GetNamespaceSchemas(ns string) (map[string]SchemaInfo, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.getNamespaceSchemaPath(ns), false, true)
+	schemaPath := etcdReg.getNamespaceSchemaPath(ns)
+	rsp, err := etcdReg.getDir(schemaPath)
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return nil, ErrKeyNotFound
-		}
 		return nil, err
 	}
 	schemas := make(map[string]SchemaInfo)
-	for _, node := range rsp.Node.Nodes {
-		if node.Dir {
+	for _, kv := range rsp.Kvs {
+		table := strings.TrimPrefix(string(kv.Key), dirPrefix(schemaPath))
+		if table == "" || strings.Contains(table, "/") {
 			continue
 		}
-		_, table := path.Split(node.Key)
 		var sInfo SchemaInfo
-		sInfo.Schema = []byte(node.Value)
-		sInfo.Epoch = EpochType(node.ModifiedIndex)
+		sInfo.Schema = kv.Value
+		sInfo.Epoch = EpochType(kv.ModRevision)
 		schemas[table] = sInfo
 	}
 
@@ -247,38 +545,25 @@ func (etcdReg *EtcdRegister) refreshNamespaces(stopC <-chan struct{}) {
 }
 
 func (etcdReg *EtcdRegister) watchNamespaces(stopC <-chan struct{}) {
-	watcher := etcdReg.client.Watch(etcdReg.namespaceRoot, 0, true)
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
 		select {
 		case <-stopC:
 			cancel()
+		case <-ctx.Done():
 		}
 	}()
-	for {
-		_, err := watcher.Next(ctx)
+	key := dirPrefix(etcdReg.namespaceRoot)
+	etcdReg.watchChanges(ctx, key, true, 0, func() (int64, error) {
+		// the namespaces will be scanned later, just get the revision here
+		rsp, err := etcdReg.get(key, clientv3.WithPrefix(), clientv3.WithCountOnly())
 		if err != nil {
-			if err == context.Canceled {
-				coordLog.Infof("watch key[%s] canceled.", etcdReg.namespaceRoot)
-				return
-			}
 			atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
-			coordLog.Errorf("watcher key[%s] error: %s", etcdReg.namespaceRoot, err.Error())
-			if etcdlock.IsEtcdWatchExpired(err) {
-				rsp, err := etcdReg.client.Get(etcdReg.namespaceRoot, false, true)
-				if err != nil {
-					coordLog.Errorf("rewatch and get key[%s] error: %s", etcdReg.namespaceRoot, err.Error())
-					time.Sleep(time.Second)
-					continue
-				}
-				watcher = etcdReg.client.Watch(etcdReg.namespaceRoot, rsp.Index+1, true)
-				// watch expired should be treated as changed of node
-			} else {
-				time.Sleep(5 * time.Second)
-				continue
-			}
+			return 0, err
 		}
 		coordLog.Debugf("namespace changed.")
+		atomic.StoreInt64(&etcdReg.nsChangedRev, rsp.Header.Revision)
 		atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
 		select {
 		case etcdReg.triggerScanCh <- struct{}{}:
@@ -288,17 +573,22 @@ func (etcdReg *EtcdRegister) watchNamespaces(stopC <-chan struct{}) {
 		case etcdReg.nsChangedChan <- struct{}{}:
 		default:
 		}
-	}
+		return rsp.Header.Revision, nil
+	})
 }
 
 func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaInfo, EpochType, error) {
 	coordLog.Infof("refreshing namespaces")
 	atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 0)
 
-	rsp, err := etcdReg.client.Get(etcdReg.namespaceRoot, true, true)
+	rsp, err := etcdReg.getDir(etcdReg.namespaceRoot)
 	if err != nil {
 		atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
-		if client.IsKeyNotFound(err) {
+		if err == ErrKeyNotFound {
+			// all the namespaces are deleted
+			etcdReg.nsMutex.Lock()
+			etcdReg.allNamespaceInfos = make(map[string]map[int]PartitionMetaInfo)
+			etcdReg.nsMutex.Unlock()
 			return nil, 0, ErrKeyNotFound
 		}
 		etcdReg.nsMutex.Lock()
@@ -312,11 +602,11 @@ func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaI
 	metaMap := make(map[string]NamespaceMetaInfo)
 	replicasMap := make(map[string]map[string]PartitionReplicaInfo)
 	leaderMap := make(map[string]map[string]RealLeader)
-	maxEpoch := etcdReg.processNamespaceNode(rsp.Node.Nodes, metaMap, replicasMap, leaderMap)
+	maxEpoch := etcdReg.processNamespaceKeys(rsp.Kvs, metaMap, replicasMap, leaderMap)
 
 	nsInfos := make(map[string]map[int]PartitionMetaInfo)
-	if EpochType(rsp.Node.ModifiedIndex) > maxEpoch {
-		maxEpoch = EpochType(rsp.Node.ModifiedIndex)
+	if changedRev := EpochType(atomic.LoadInt64(&etcdReg.nsChangedRev)); changedRev > maxEpoch {
+		maxEpoch = changedRev
 	}
 	for k, v := range replicasMap {
 		meta, ok := metaMap[k]
@@ -325,7 +615,7 @@ func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaI
 		}
 		partInfos, ok := nsInfos[k]
 		if !ok {
-			partInfos = make(map[int]PartitionMetaInfo, meta.PartitionNum)
+			partInfos = make(map[int]PartitionMetaInfo, meta.AllPartitionNum())
 			nsInfos[k] = partInfos
 		}
 		for k2, v2 := range v {
@@ -333,7 +623,7 @@ func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaI
 			if err != nil {
 				continue
 			}
-			if partition >= meta.PartitionNum {
+			if partition >= meta.AllPartitionNum() {
 				coordLog.Infof("invalid partition id : %v ", k2)
 				continue
 			}
@@ -360,34 +650,26 @@ func (etcdReg *EtcdRegister) scanNamespaces() (map[string]map[int]PartitionMetaI
 	return nsInfos, maxEpoch, nil
 }
 
-func (etcdReg *EtcdRegister) processNamespaceNode(nodes client.Nodes,
+func (etcdReg *EtcdRegister) processNamespaceKeys(kvs []*mvccpb.KeyValue,
 	metaMap map[string]NamespaceMetaInfo,
 	replicasMap map[string]map[string]PartitionReplicaInfo,
 	leaderMap map[string]map[string]RealLeader) EpochType {
 	maxEpoch := EpochType(0)
-	for _, node := range nodes {
-		if node.Nodes != nil {
-			newEpoch := etcdReg.processNamespaceNode(node.Nodes, metaMap, replicasMap, leaderMap)
-			if newEpoch > maxEpoch {
-				maxEpoch = newEpoch
-			}
-		}
-		if EpochType(node.ModifiedIndex) > maxEpoch {
-			maxEpoch = EpochType(node.ModifiedIndex)
+	for _, kv := range kvs {
+		if EpochType(kv.ModRevision) > maxEpoch {
+			maxEpoch = EpochType(kv.ModRevision)
 		}
 
-		if node.Dir {
-			continue
-		}
-		_, key := path.Split(node.Key)
+		nodeKey := string(kv.Key)
+		_, key := path.Split(nodeKey)
 		if key == NAMESPACE_REPLICA_INFO {
 			var rInfo PartitionReplicaInfo
-			if err := json.Unmarshal([]byte(node.Value), &rInfo); err != nil {
-				coordLog.Infof("unmarshal replica info %v failed: %v", node.Value, err)
+			if err := json.Unmarshal(kv.Value, &rInfo); err != nil {
+				coordLog.Infof("unmarshal replica info %v failed: %v", string(kv.Value), err)
 				continue
 			}
-			rInfo.epoch = EpochType(node.ModifiedIndex)
-			keys := strings.Split(node.Key, "/")
+			rInfo.epoch = EpochType(kv.ModRevision)
+			keys := strings.Split(nodeKey, "/")
 			keyLen := len(keys)
 			if keyLen < 3 {
 				continue
@@ -404,24 +686,24 @@ func (etcdReg *EtcdRegister) processNamespaceNode(nodes client.Nodes,
 			}
 		} else if key == NAMESPACE_META {
 			var mInfo NamespaceMetaInfo
-			if err := json.Unmarshal([]byte(node.Value), &mInfo); err != nil {
+			if err := json.Unmarshal(kv.Value, &mInfo); err != nil {
 				continue
 			}
-			keys := strings.Split(node.Key, "/")
+			keys := strings.Split(nodeKey, "/")
 			keyLen := len(keys)
 			if keyLen < 2 {
 				continue
 			}
-			mInfo.metaEpoch = EpochType(node.ModifiedIndex)
+			mInfo.metaEpoch = EpochType(kv.ModRevision)
 			nsName := keys[keyLen-2]
 			metaMap[nsName] = mInfo
 		} else if key == NAMESPACE_REAL_LEADER {
 			var rInfo RealLeader
-			if err := json.Unmarshal([]byte(node.Value), &rInfo); err != nil {
+			if err := json.Unmarshal(kv.Value, &rInfo); err != nil {
 				continue
 			}
-			rInfo.epoch = EpochType(node.ModifiedIndex)
-			keys := strings.Split(node.Key, "/")
+			rInfo.epoch = EpochType(kv.ModRevision)
+			keys := strings.Split(nodeKey, "/")
 			keyLen := len(keys)
 			if keyLen < 3 {
 				continue
@@ -459,33 +741,29 @@ func (etcdReg *EtcdRegister) GetNamespacePartInfo(ns string, partition int) (*Pa
 }
 
 func (etcdReg *EtcdRegister) GetRemoteNamespaceReplicaInfo(ns string, partition int) (*PartitionReplicaInfo, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.getNamespaceReplicaInfoPath(ns, partition), false, false)
+	kv, err := etcdReg.getValue(etcdReg.getNamespaceReplicaInfoPath(ns, partition))
 	if err != nil {
-		if client.IsKeyNotFound(err) {
+		if err == ErrKeyNotFound {
 			atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
-			return nil, ErrKeyNotFound
 		}
 		return nil, err
 	}
 	var rInfo PartitionReplicaInfo
-	if err = json.Unmarshal([]byte(rsp.Node.Value), &rInfo); err != nil {
+	if err = json.Unmarshal(kv.Value, &rInfo); err != nil {
 		return nil, err
 	}
-	rInfo.epoch = EpochType(rsp.Node.ModifiedIndex)
+	rInfo.epoch = EpochType(kv.ModRevision)
 	return &rInfo, nil
 }
 
 func (etcdReg *EtcdRegister) GetNamespaceTableSchema(ns string, table string) (*SchemaInfo, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.getNamespaceTableSchemaPath(ns, table), false, false)
+	kv, err := etcdReg.getValue(etcdReg.getNamespaceTableSchemaPath(ns, table))
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return nil, ErrKeyNotFound
-		}
 		return nil, err
 	}
 	var info SchemaInfo
-	info.Schema = []byte(rsp.Node.Value)
-	info.Epoch = EpochType(rsp.Node.ModifiedIndex)
+	info.Schema = kv.Value
+	info.Epoch = EpochType(kv.ModRevision)
 	return &info, nil
 }
 
@@ -509,23 +787,46 @@ func (etcdReg *EtcdRegister) GetNamespaceMetaInfo(ns string) (NamespaceMetaInfo,
 	etcdReg.nsMutex.Unlock()
 	var meta NamespaceMetaInfo
 	if !ok || len(parts) == 0 {
-		rsp, err := etcdReg.client.Get(etcdReg.getNamespaceMetaPath(ns), false, false)
+		kv, err := etcdReg.getValue(etcdReg.getNamespaceMetaPath(ns))
 		if err != nil {
-			if client.IsKeyNotFound(err) {
-				return meta, ErrKeyNotFound
-			}
 			return meta, err
 		}
-		err = json.Unmarshal([]byte(rsp.Node.Value), &meta)
+		err = json.Unmarshal(kv.Value, &meta)
 		if err != nil {
 			return meta, err
 		}
-		meta.metaEpoch = EpochType(rsp.Node.ModifiedIndex)
+		meta.metaEpoch = EpochType(kv.ModRevision)
 		return meta, nil
 	}
 	return parts[0].NamespaceMetaInfo, nil
 }
 
+func (etcdReg *EtcdRegister) GetClusterDynamicConf() (map[string]string, EpochType, error) {
+	conf, epoch, _, err := etcdReg.getClusterDynamicConf()
+	return conf, epoch, err
+}
+
+// return the config with the epoch of it, and the revision of the read
+func (etcdReg *EtcdRegister) getClusterDynamicConf() (map[string]string, EpochType, int64, error) {
+	conf := make(map[string]string)
+	rsp, err := etcdReg.get(etcdReg.getClusterDynamicConfPath())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return conf, 0, rsp.Header.Revision, nil
+	}
+	err = json.Unmarshal(rsp.Kvs[0].Value, &conf)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return conf, EpochType(rsp.Kvs[0].ModRevision), rsp.Header.Revision, nil
+}
+
+func (etcdReg *EtcdRegister) getClusterDynamicConfPath() string {
+	return path.Join(etcdReg.getClusterPath(), CLUSTER_DYNAMIC_CONF)
+}
+
 func (etcdReg *EtcdRegister) getClusterPath() string {
 	return path.Join("/", ROOT_DIR, etcdReg.clusterID)
 }
@@ -591,11 +892,15 @@ type PDEtcdRegister struct {
 	refreshStopCh chan bool
 }
 
-func NewPDEtcdRegister(host string) *PDEtcdRegister {
+func NewPDEtcdRegister(host string, tlsConf *EtcdTLSConfig) (*PDEtcdRegister, error) {
+	r, err := NewEtcdRegister(host, tlsConf)
+	if err != nil {
+		return nil, err
+	}
 	return &PDEtcdRegister{
-		EtcdRegister:  NewEtcdRegister(host),
+		EtcdRegister:  r,
 		refreshStopCh: make(chan bool, 1),
-	}
+	}, nil
 }
 
 func (etcdReg *PDEtcdRegister) Register(value *NodeInfo) error {
@@ -612,35 +917,17 @@ func (etcdReg *PDEtcdRegister) Register(value *NodeInfo) error {
 	etcdReg.leaderStr = string(valueB)
 	etcdReg.nodeKey = etcdReg.getPDNodePath(value)
 	etcdReg.nodeValue = string(valueB)
-	_, err = etcdReg.client.Set(etcdReg.nodeKey, etcdReg.nodeValue, ETCD_TTL)
+	leaseID, err := etcdReg.putWithLease(etcdReg.nodeKey, etcdReg.nodeValue)
 	if err != nil {
 		return err
 	}
 	etcdReg.refreshStopCh = make(chan bool)
 	// start to refresh
-	go etcdReg.refresh(etcdReg.refreshStopCh)
+	go etcdReg.keepAlive(etcdReg.nodeKey, etcdReg.nodeValue, leaseID, etcdReg.refreshStopCh)
 
 	return nil
 }
 
-func (etcdReg *PDEtcdRegister) refresh(stopC <-chan bool) {
-	for {
-		select {
-		case <-stopC:
-			return
-		case <-time.After(time.Second * time.Duration(ETCD_TTL/10)):
-			_, err := etcdReg.client.SetWithTTL(etcdReg.nodeKey, ETCD_TTL)
-			if err != nil {
-				coordLog.Errorf("update error: %s", err.Error())
-				_, err := etcdReg.client.Set(etcdReg.nodeKey, etcdReg.nodeValue, ETCD_TTL)
-				if err != nil {
-					coordLog.Errorf("set key error: %s", err.Error())
-				}
-			}
-		}
-	}
-}
-
 func (etcdReg *PDEtcdRegister) Unregister(value *NodeInfo) error {
 	// stop to refresh
 	if etcdReg.refreshStopCh != nil {
@@ -648,7 +935,9 @@ func (etcdReg *PDEtcdRegister) Unregister(value *NodeInfo) error {
 		etcdReg.refreshStopCh = nil
 	}
 
-	_, err := etcdReg.client.Delete(etcdReg.getPDNodePath(value), false)
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := etcdReg.client.Delete(ctx, etcdReg.getPDNodePath(value))
 	if err != nil {
 		coordLog.Warningf("cluser[%s] node[%s] unregister failed: %v", etcdReg.clusterID, value, err)
 		return err
@@ -660,8 +949,7 @@ func (etcdReg *PDEtcdRegister) Unregister(value *NodeInfo) error {
 func (etcdReg *PDEtcdRegister) PrepareNamespaceMinGID() (int64, error) {
 	var clusterMeta ClusterMetaInfo
 	initValue, _ := json.Marshal(clusterMeta)
-	err := exchangeNodeValue(
-		etcdReg.client,
+	err := etcdReg.exchangeNodeValue(
 		etcdReg.getClusterMetaPath(),
 		string(initValue),
 		func(isNew bool, oldValue string) (string, error) {
@@ -683,171 +971,154 @@ func (etcdReg *PDEtcdRegister) PrepareNamespaceMinGID() (int64, error) {
 
 func (etcdReg *PDEtcdRegister) GetClusterMetaInfo() (ClusterMetaInfo, error) {
 	var clusterMeta ClusterMetaInfo
-	rsp, err := etcdReg.client.Get(etcdReg.getClusterMetaPath(), false, false)
+	kv, err := etcdReg.getValue(etcdReg.getClusterMetaPath())
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return clusterMeta, ErrKeyNotFound
-		}
 		return clusterMeta, err
 	}
-	err = json.Unmarshal([]byte(rsp.Node.Value), &clusterMeta)
+	err = json.Unmarshal(kv.Value, &clusterMeta)
 	return clusterMeta, err
 }
 
+// GetClusterEpoch return the revision while the first key of the cluster is created
 func (etcdReg *PDEtcdRegister) GetClusterEpoch() (EpochType, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.clusterPath, false, false)
+	rsp, err := etcdReg.get(dirPrefix(etcdReg.clusterPath), clientv3.WithFirstCreate()...)
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return 0, ErrKeyNotFound
-		}
 		return 0, err
 	}
-
-	return EpochType(rsp.Node.ModifiedIndex), nil
+	if len(rsp.Kvs) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	return EpochType(rsp.Kvs[0].CreateRevision), nil
 }
 
+// AcquireAndWatchLeader campaign the pd leader by the election with the lease session and
+// notify the leader changes until stopped, the leader chan will be closed after stopped.
 func (etcdReg *PDEtcdRegister) AcquireAndWatchLeader(leader chan *NodeInfo, stop chan struct{}) {
-	master := etcdlock.NewMaster(etcdReg.client, etcdReg.leaderSessionPath, etcdReg.leaderStr, ETCD_TTL)
-	go etcdReg.processMasterEvents(master, leader, stop)
-	master.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		etcdReg.campaignLeader(ctx)
+	}()
+	etcdReg.watchLeaderNode(ctx, etcdReg.leaderSessionPath, leader)
+	cancel()
+	wg.Wait()
+	close(leader)
 }
 
-func (etcdReg *PDEtcdRegister) processMasterEvents(master etcdlock.Master, leader chan *NodeInfo, stop chan struct{}) {
+func (etcdReg *PDEtcdRegister) campaignLeader(ctx context.Context) {
 	for {
-		select {
-		case e := <-master.GetEventsChan():
-			if e.Type == etcdlock.MASTER_ADD || e.Type == etcdlock.MASTER_MODIFY {
-				// Acquired the lock || lock change.
-				var node NodeInfo
-				if err := json.Unmarshal([]byte(e.Master), &node); err != nil {
-					leader <- &node
-					continue
+		session, err := concurrency.NewSession(etcdReg.client, concurrency.WithTTL(ETCD_TTL),
+			concurrency.WithContext(ctx))
+		if err != nil {
+			coordLog.Errorf("create leader session error: %s", err.Error())
+		} else {
+			election := concurrency.NewElection(session, etcdReg.leaderSessionPath)
+			err = election.Campaign(ctx, etcdReg.leaderStr)
+			if err == nil {
+				coordLog.Infof("acquired the leader session: %v", etcdReg.leaderStr)
+				select {
+				case <-ctx.Done():
+				case <-session.Done():
+					coordLog.Warningf("the leader session is lost")
 				}
-				coordLog.Infof("master event type[%d] Node[%v].", e.Type, node)
-				leader <- &node
-			} else if e.Type == etcdlock.MASTER_DELETE {
-				coordLog.Infof("master event delete.")
-				// Lost the lock.
-				var node NodeInfo
-				leader <- &node
-			} else {
-				// TODO: lock error.
-				coordLog.Infof("unexpected event: %v", e)
+				rctx, rcancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+				election.Resign(rctx)
+				rcancel()
+			} else if ctx.Err() == nil {
+				coordLog.Errorf("campaign the leader error: %s", err.Error())
 			}
-		case <-stop:
-			master.Stop()
-			close(leader)
+			session.Close()
+		}
+		select {
+		case <-ctx.Done():
 			return
+		case <-time.After(time.Second):
 		}
 	}
 }
 
 func (etcdReg *PDEtcdRegister) CheckIfLeader() bool {
-	rsp, err := etcdReg.client.Get(etcdReg.leaderSessionPath, false, false)
-	if err != nil {
+	rsp, err := etcdReg.get(dirPrefix(etcdReg.leaderSessionPath), clientv3.WithFirstCreate()...)
+	if err != nil || len(rsp.Kvs) == 0 {
 		return false
 	}
-	if rsp.Node.Value == etcdReg.leaderStr {
+	if string(rsp.Kvs[0].Value) == etcdReg.leaderStr {
 		return true
 	}
 	return false
 }
 
 func (etcdReg *PDEtcdRegister) GetDataNodes() ([]NodeInfo, error) {
-	return etcdReg.getDataNodes()
+	dataNodes, _, err := etcdReg.getDataNodes()
+	return dataNodes, err
 }
 
 func (etcdReg *PDEtcdRegister) WatchDataNodes(dataNodesChan chan []NodeInfo, stop chan struct{}) {
-	dataNodes, err := etcdReg.getDataNodes()
-	if err == nil {
-		select {
-		case dataNodesChan <- dataNodes:
-		case <-stop:
-			close(dataNodesChan)
-			return
-		}
-	}
-
-	key := etcdReg.getDataNodeRootPath()
-	watcher := etcdReg.client.Watch(key, 0, true)
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
 		select {
 		case <-stop:
 			cancel()
+		case <-ctx.Done():
 		}
 	}()
-	for {
-		rsp, err := watcher.Next(ctx)
-		if err != nil {
-			if err == context.Canceled {
-				coordLog.Infof("watch key[%s] canceled.", key)
-				close(dataNodesChan)
-				return
-			} else {
-				coordLog.Errorf("watcher key[%s] error: %s", key, err.Error())
-				//rewatch
-				if etcdlock.IsEtcdWatchExpired(err) {
-					rsp, err = etcdReg.client.Get(key, false, true)
-					if err != nil {
-						coordLog.Errorf("rewatch and get key[%s] error: %s", key, err.Error())
-						time.Sleep(time.Second)
-						continue
-					}
-					watcher = etcdReg.client.Watch(key, rsp.Index+1, true)
-					// should get the nodes to notify watcher since last watch is expired
-				} else {
-					time.Sleep(5 * time.Second)
-					continue
-				}
-			}
-		}
-		dataNodes, err := etcdReg.getDataNodes()
-		if err != nil {
-			coordLog.Errorf("key[%s] getNodes error: %s", key, err.Error())
-			continue
+	notify := func() (int64, error) {
+		dataNodes, rev, err := etcdReg.getDataNodes()
+		if err == ErrKeyNotFound {
+			// all the data nodes are lost
+			dataNodes = make([]NodeInfo, 0)
+		} else if err != nil {
+			return 0, err
 		}
 		select {
 		case dataNodesChan <- dataNodes:
-		case <-stop:
-			close(dataNodesChan)
-			return
+		case <-ctx.Done():
+			return 0, ctx.Err()
 		}
+		return rev, nil
 	}
+	rev, err := notify()
+	if err != nil {
+		coordLog.Errorf("get data nodes error: %s", err.Error())
+	}
+	etcdReg.watchChanges(ctx, dirPrefix(etcdReg.getDataNodeRootPath()), true, rev, notify)
+	close(dataNodesChan)
 }
 
-func (etcdReg *PDEtcdRegister) getDataNodes() ([]NodeInfo, error) {
-	rsp, err := etcdReg.client.Get(etcdReg.getDataNodeRootPath(), false, false)
+// return the data nodes and the revision of the read
+func (etcdReg *PDEtcdRegister) getDataNodes() ([]NodeInfo, int64, error) {
+	rsp, err := etcdReg.get(dirPrefix(etcdReg.getDataNodeRootPath()), clientv3.WithPrefix())
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return nil, ErrKeyNotFound
-		}
-		return nil, err
+		return nil, 0, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, rsp.Header.Revision, ErrKeyNotFound
 	}
 	dataNodes := make([]NodeInfo, 0)
-	for _, node := range rsp.Node.Nodes {
-		if node.Dir {
-			continue
-		}
+	for _, kv := range rsp.Kvs {
 		var nodeInfo NodeInfo
-		err := json.Unmarshal([]byte(node.Value), &nodeInfo)
+		err := json.Unmarshal(kv.Value, &nodeInfo)
 		if err != nil {
 			continue
 		}
 		dataNodes = append(dataNodes, nodeInfo)
 	}
-	return dataNodes, nil
+	return dataNodes, rsp.Header.Revision, nil
 }
 
 func (etcdReg *PDEtcdRegister) CreateNamespacePartition(ns string, partition int) error {
-	_, err := etcdReg.client.CreateDir(etcdReg.getNamespacePartitionPath(ns, partition), 0)
-	if err != nil {
-		if IsEtcdNotFile(err) {
-			return ErrKeyAlreadyExist
-		}
-		return err
-	}
-	return nil
+	_, err := etcdReg.createKey(etcdReg.getNamespacePartitionPath(ns, partition), "")
+	return err
 }
 
 func (etcdReg *PDEtcdRegister) CreateNamespace(ns string, meta *NamespaceMetaInfo) error {
@@ -858,40 +1129,21 @@ func (etcdReg *PDEtcdRegister) CreateNamespace(ns string, meta *NamespaceMetaInf
 	if err != nil {
 		return err
 	}
-	rsp, err := etcdReg.client.Create(etcdReg.getNamespaceMetaPath(ns), string(metaValue), 0)
+	epoch, err := etcdReg.createKey(etcdReg.getNamespaceMetaPath(ns), string(metaValue))
 	if err != nil {
-		if IsEtcdNodeExist(err) {
-			return ErrKeyAlreadyExist
-		}
 		return err
 	}
 
-	meta.metaEpoch = EpochType(rsp.Node.ModifiedIndex)
+	meta.metaEpoch = epoch
 	return nil
 }
 
 func (etcdReg *PDEtcdRegister) IsExistNamespace(ns string) (bool, error) {
-	_, err := etcdReg.client.Get(etcdReg.getNamespacePath(ns), false, false)
-	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return false, nil
-		} else {
-			return false, err
-		}
-	}
-	return true, nil
+	return etcdReg.isDirExist(etcdReg.getNamespacePath(ns))
 }
 
 func (etcdReg *PDEtcdRegister) IsExistNamespacePartition(ns string, partitionNum int) (bool, error) {
-	_, err := etcdReg.client.Get(etcdReg.getNamespacePartitionPath(ns, partitionNum), false, false)
-	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return false, nil
-		} else {
-			return false, err
-		}
-	}
-	return true, nil
+	return etcdReg.isDirExist(etcdReg.getNamespacePartitionPath(ns, partitionNum))
 }
 
 func (etcdReg *PDEtcdRegister) UpdateNamespaceMetaInfo(ns string, meta *NamespaceMetaInfo, oldGen EpochType) error {
@@ -904,16 +1156,11 @@ func (etcdReg *PDEtcdRegister) UpdateNamespaceMetaInfo(ns string, meta *Namespac
 	etcdReg.nsMutex.Lock()
 	defer etcdReg.nsMutex.Unlock()
 	atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
-	rsp, err := etcdReg.client.CompareAndSwap(etcdReg.getNamespaceMetaPath(ns), string(value), 0, "", uint64(oldGen))
-	if err != nil {
-		return err
-	}
-	err = json.Unmarshal([]byte(rsp.Node.Value), &meta)
+	epoch, err := etcdReg.compareAndSwap(etcdReg.getNamespaceMetaPath(ns), string(value), oldGen)
 	if err != nil {
-		coordLog.Errorf("unmarshal meta info failed: %v, %v", err, rsp.Node.Value)
 		return err
 	}
-	meta.metaEpoch = EpochType(rsp.Node.ModifiedIndex)
+	meta.metaEpoch = epoch
 
 	return nil
 }
@@ -921,20 +1168,14 @@ func (etcdReg *PDEtcdRegister) UpdateNamespaceMetaInfo(ns string, meta *Namespac
 func (etcdReg *PDEtcdRegister) DeleteWholeNamespace(ns string) error {
 	etcdReg.nsMutex.Lock()
 	atomic.StoreInt32(&etcdReg.ifNamespaceChanged, 1)
-	rsp, err := etcdReg.client.Delete(etcdReg.getNamespacePath(ns), true)
-	coordLog.Infof("delete whole topic: %v, %v, %v", ns, err, rsp)
+	err := etcdReg.deleteDir(etcdReg.getNamespacePath(ns))
+	coordLog.Infof("delete whole topic: %v, %v", ns, err)
 	etcdReg.nsMutex.Unlock()
 	return err
 }
 
 func (etcdReg *PDEtcdRegister) DeleteNamespacePart(ns string, partition int) error {
-	_, err := etcdReg.client.Delete(etcdReg.getNamespacePartitionPath(ns, partition), true)
-	if err != nil {
-		if !client.IsKeyNotFound(err) {
-			return err
-		}
-	}
-	return nil
+	return etcdReg.deleteDir(etcdReg.getNamespacePartitionPath(ns, partition))
 }
 
 func (etcdReg *PDEtcdRegister) UpdateNamespacePartReplicaInfo(ns string, partition int,
@@ -945,40 +1186,54 @@ func (etcdReg *PDEtcdRegister) UpdateNamespacePartReplicaInfo(ns string, partiti
 	}
 	coordLog.Infof("Update info: %s %d %s %d", ns, partition, string(value), oldGen)
 	if oldGen == 0 {
-		rsp, err := etcdReg.client.Create(etcdReg.getNamespaceReplicaInfoPath(ns, partition), string(value), 0)
+		epoch, err := etcdReg.createKey(etcdReg.getNamespaceReplicaInfoPath(ns, partition), string(value))
 		if err != nil {
 			return err
 		}
-		replicaInfo.epoch = EpochType(rsp.Node.ModifiedIndex)
+		replicaInfo.epoch = epoch
 		return nil
 	}
-	rsp, err := etcdReg.client.CompareAndSwap(etcdReg.getNamespaceReplicaInfoPath(ns, partition), string(value), 0, "", uint64(oldGen))
+	epoch, err := etcdReg.compareAndSwap(etcdReg.getNamespaceReplicaInfoPath(ns, partition), string(value), oldGen)
 	if err != nil {
 		return err
 	}
-	replicaInfo.epoch = EpochType(rsp.Node.ModifiedIndex)
+	replicaInfo.epoch = epoch
 	return nil
 }
 
 func (etcdReg *PDEtcdRegister) UpdateNamespaceSchema(ns string, table string, schema *SchemaInfo) error {
 	if schema.Epoch == 0 {
-		rsp, err := etcdReg.client.Create(etcdReg.getNamespaceTableSchemaPath(ns, table), string(schema.Schema), 0)
+		epoch, err := etcdReg.createKey(etcdReg.getNamespaceTableSchemaPath(ns, table), string(schema.Schema))
 		if err != nil {
 			return err
 		}
-		schema.Epoch = EpochType(rsp.Node.ModifiedIndex)
+		schema.Epoch = epoch
 		return nil
 	}
 
-	rsp, err := etcdReg.client.CompareAndSwap(etcdReg.getNamespaceTableSchemaPath(ns, table), string(schema.Schema),
-		0, "", uint64(schema.Epoch))
+	epoch, err := etcdReg.compareAndSwap(etcdReg.getNamespaceTableSchemaPath(ns, table), string(schema.Schema),
+		schema.Epoch)
 	if err != nil {
 		return err
 	}
-	schema.Epoch = EpochType(rsp.Node.ModifiedIndex)
+	schema.Epoch = epoch
 	return nil
 }
 
+func (etcdReg *PDEtcdRegister) UpdateClusterDynamicConf(conf map[string]string, oldGen EpochType) error {
+	value, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	coordLog.Infof("update cluster dynamic config: %s %d", string(value), oldGen)
+	if oldGen == 0 {
+		_, err = etcdReg.createKey(etcdReg.getClusterDynamicConfPath(), string(value))
+		return err
+	}
+	_, err = etcdReg.compareAndSwap(etcdReg.getClusterDynamicConfPath(), string(value), oldGen)
+	return err
+}
+
 type DNEtcdRegister struct {
 	*EtcdRegister
 	sync.Mutex
@@ -988,20 +1243,22 @@ type DNEtcdRegister struct {
 	refreshStopCh chan bool
 }
 
-func SetEtcdLogger(log etcdlock.Logger, level int32) {
-	etcdlock.SetLogger(log, int(level))
-}
-
-func NewDNEtcdRegister(host string) *DNEtcdRegister {
-	return &DNEtcdRegister{
-		EtcdRegister: NewEtcdRegister(host),
+func NewDNEtcdRegister(host string, tlsConf *EtcdTLSConfig) (*DNEtcdRegister, error) {
+	r, err := NewEtcdRegister(host, tlsConf)
+	if err != nil {
+		return nil, err
 	}
+	return &DNEtcdRegister{
+		EtcdRegister: r,
+	}, nil
 }
 
 func (etcdReg *DNEtcdRegister) Register(nodeData *NodeInfo) error {
 	if nodeData.LearnerRole != "" &&
 		nodeData.LearnerRole != common.LearnerRoleLogSyncer &&
-		nodeData.LearnerRole != common.LearnerRoleSearcher {
+		nodeData.LearnerRole != common.LearnerRoleSearcher &&
+		nodeData.LearnerRole != common.LearnerRoleKafkaSink &&
+		nodeData.LearnerRole != common.LearnerRoleReadReplica {
 		return ErrLearnerRoleUnsupported
 	}
 	value, err := json.Marshal(nodeData)
@@ -1009,14 +1266,14 @@ func (etcdReg *DNEtcdRegister) Register(nodeData *NodeInfo) error {
 		return err
 	}
 	etcdReg.nodeKey = etcdReg.getDataNodePath(nodeData)
-	rsp, err := etcdReg.client.Get(etcdReg.nodeKey, false, false)
+	kv, err := etcdReg.getValue(etcdReg.nodeKey)
 	if err != nil {
-		if !client.IsKeyNotFound(err) {
+		if err != ErrKeyNotFound {
 			return err
 		}
 	} else {
 		var node NodeInfo
-		err = json.Unmarshal([]byte(rsp.Node.Value), &node)
+		err = json.Unmarshal(kv.Value, &node)
 		if err != nil {
 			return err
 		}
@@ -1030,36 +1287,18 @@ func (etcdReg *DNEtcdRegister) Register(nodeData *NodeInfo) error {
 	}
 
 	etcdReg.nodeValue = string(value)
-	_, err = etcdReg.client.Set(etcdReg.nodeKey, etcdReg.nodeValue, ETCD_TTL)
+	leaseID, err := etcdReg.putWithLease(etcdReg.nodeKey, etcdReg.nodeValue)
 	if err != nil {
 		return err
 	}
 	coordLog.Infof("registered new node: %v", nodeData)
 	etcdReg.refreshStopCh = make(chan bool)
 	// start refresh node
-	go etcdReg.refresh(etcdReg.refreshStopCh)
+	go etcdReg.keepAlive(etcdReg.nodeKey, etcdReg.nodeValue, leaseID, etcdReg.refreshStopCh)
 
 	return nil
 }
 
-func (etcdReg *DNEtcdRegister) refresh(stopChan chan bool) {
-	for {
-		select {
-		case <-stopChan:
-			return
-		case <-time.After(time.Second * time.Duration(ETCD_TTL/10)):
-			_, err := etcdReg.client.SetWithTTL(etcdReg.nodeKey, ETCD_TTL)
-			if err != nil {
-				coordLog.Errorf("update error: %s", err.Error())
-				_, err := etcdReg.client.Set(etcdReg.nodeKey, etcdReg.nodeValue, ETCD_TTL)
-				if err != nil {
-					coordLog.Errorf("set key error: %s", err.Error())
-				}
-			}
-		}
-	}
-}
-
 func (etcdReg *DNEtcdRegister) Unregister(nodeData *NodeInfo) error {
 	etcdReg.Lock()
 	defer etcdReg.Unlock()
@@ -1070,7 +1309,9 @@ func (etcdReg *DNEtcdRegister) Unregister(nodeData *NodeInfo) error {
 		etcdReg.refreshStopCh = nil
 	}
 
-	_, err := etcdReg.client.Delete(etcdReg.getDataNodePath(nodeData), false)
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := etcdReg.client.Delete(ctx, etcdReg.getDataNodePath(nodeData))
 	if err != nil {
 		coordLog.Warningf("cluser[%s] node[%s] unregister failed: %v", etcdReg.clusterID, nodeData, err)
 		return err
@@ -1100,31 +1341,28 @@ func (etcdReg *DNEtcdRegister) UpdateNamespaceLeader(ns string, partition int, r
 		return oldGen, err
 	}
 	if oldGen == 0 {
-		rsp, err := etcdReg.client.Create(etcdReg.getNamespaceLeaderPath(ns, partition), string(value), 0)
+		epoch, err := etcdReg.createKey(etcdReg.getNamespaceLeaderPath(ns, partition), string(value))
 		if err != nil {
 			return 0, err
 		}
-		rl.epoch = EpochType(rsp.Node.ModifiedIndex)
+		rl.epoch = epoch
 		return rl.epoch, nil
 	}
-	rsp, err := etcdReg.client.CompareAndSwap(etcdReg.getNamespaceLeaderPath(ns, partition), string(value), 0, "", uint64(oldGen))
+	epoch, err := etcdReg.compareAndSwap(etcdReg.getNamespaceLeaderPath(ns, partition), string(value), oldGen)
 	if err != nil {
 		return 0, err
 	}
-	rl.epoch = EpochType(rsp.Node.ModifiedIndex)
+	rl.epoch = epoch
 	return rl.epoch, nil
 }
 
 func (etcdReg *DNEtcdRegister) GetNodeInfo(nid string) (NodeInfo, error) {
 	var node NodeInfo
-	rsp, err := etcdReg.client.Get(etcdReg.getDataNodePathFromID(nid), false, false)
+	kv, err := etcdReg.getValue(etcdReg.getDataNodePathFromID(nid))
 	if err != nil {
-		if client.IsKeyNotFound(err) {
-			return node, ErrKeyNotFound
-		}
 		return node, err
 	}
-	err = json.Unmarshal([]byte(rsp.Node.Value), &node)
+	err = json.Unmarshal(kv.Value, &node)
 	if err != nil {
 		return node, err
 	}
@@ -1134,7 +1372,7 @@ func (etcdReg *DNEtcdRegister) GetNodeInfo(nid string) (NodeInfo, error) {
 func (etcdReg *DNEtcdRegister) NewRegisterNodeID() (uint64, error) {
 	var clusterMeta ClusterMetaInfo
 	initValue, _ := json.Marshal(clusterMeta)
-	exchangeErr := exchangeNodeValue(etcdReg.client, etcdReg.getClusterMetaPath(), string(initValue), func(isNew bool, oldValue string) (string, error) {
+	exchangeErr := etcdReg.exchangeNodeValue(etcdReg.getClusterMetaPath(), string(initValue), func(isNew bool, oldValue string) (string, error) {
 		if !isNew && oldValue != "" {
 			err := json.Unmarshal([]byte(oldValue), &clusterMeta)
 			if err != nil {
@@ -1149,96 +1387,53 @@ func (etcdReg *DNEtcdRegister) NewRegisterNodeID() (uint64, error) {
 }
 
 func (etcdReg *DNEtcdRegister) WatchPDLeader(leader chan *NodeInfo, stop chan struct{}) error {
-	key := etcdReg.getPDLeaderPath()
-
-	rsp, err := etcdReg.client.Get(key, false, false)
-	if err == nil {
-		coordLog.Infof("key: %s value: %s", rsp.Node.Key, rsp.Node.Value)
-		var node NodeInfo
-		err = json.Unmarshal([]byte(rsp.Node.Value), &node)
-		if err == nil {
-			select {
-			case leader <- &node:
-			case <-stop:
-				close(leader)
-				return nil
-			}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
 		}
-	} else {
-		coordLog.Errorf("get error: %s", err.Error())
-	}
+	}()
+	etcdReg.watchLeaderNode(ctx, etcdReg.getPDLeaderPath(), leader)
+	close(leader)
+	return nil
+}
 
-	watcher := etcdReg.client.Watch(key, 0, true)
+func (etcdReg *DNEtcdRegister) WatchClusterDynamicConf(confC chan map[string]string, stop chan struct{}) {
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
 		select {
 		case <-stop:
 			cancel()
+		case <-ctx.Done():
 		}
 	}()
-	isMissing := true
-	for {
-		rsp, err = watcher.Next(ctx)
+	var lastEpoch EpochType
+	notified := false
+	notify := func() (int64, error) {
+		conf, epoch, rev, err := etcdReg.getClusterDynamicConf()
 		if err != nil {
-			if err == context.Canceled {
-				coordLog.Infof("watch key[%s] canceled.", key)
-				close(leader)
-				return nil
-			} else {
-				coordLog.Errorf("watcher key[%s] error: %s", key, err.Error())
-				//rewatch
-				if etcdlock.IsEtcdWatchExpired(err) {
-					isMissing = true
-					rsp, err = etcdReg.client.Get(key, false, true)
-					if err != nil {
-						coordLog.Errorf("rewatch and get key[%s] error: %s", key, err.Error())
-						time.Sleep(time.Second)
-						continue
-					}
-					coordLog.Errorf("watch expired key[%s] : %s", key, rsp.Node.String())
-					watcher = etcdReg.client.Watch(key, rsp.Index+1, true)
-				} else {
-					time.Sleep(5 * time.Second)
-					continue
-				}
-			}
-		}
-		if rsp == nil {
-			continue
+			return 0, err
 		}
-		var node NodeInfo
-		if rsp.Action == "expire" || rsp.Action == "delete" {
-			coordLog.Infof("key[%s] action[%s]", key, rsp.Action)
-			isMissing = true
-		} else if rsp.Action == "create" || rsp.Action == "update" || rsp.Action == "set" {
-			err := json.Unmarshal([]byte(rsp.Node.Value), &node)
-			if err != nil {
-				continue
-			}
-			if node.ID != "" {
-				isMissing = false
-			}
-		} else {
-			if isMissing {
-				coordLog.Infof("key[%s] new data : %s", key, rsp.Node.String())
-				err := json.Unmarshal([]byte(rsp.Node.Value), &node)
-				if err != nil {
-					continue
-				}
-				if node.ID != "" {
-					isMissing = false
-				}
-			} else {
-				continue
+		if epoch != lastEpoch || !notified {
+			select {
+			case confC <- conf:
+			case <-ctx.Done():
+				return 0, ctx.Err()
 			}
+			lastEpoch = epoch
+			notified = true
 		}
-		select {
-		case leader <- &node:
-		case <-stop:
-			close(leader)
-			return nil
-		}
+		return rev, nil
+	}
+	rev, err := notify()
+	if err != nil {
+		coordLog.Infof("get cluster dynamic config failed: %v", err.Error())
 	}
+	etcdReg.watchChanges(ctx, etcdReg.getClusterDynamicConfPath(), false, rev, notify)
 }
 
 func (etcdReg *DNEtcdRegister) getDataNodePathFromID(nid string) string {
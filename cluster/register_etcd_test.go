@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/embed"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func getTestFreeURL(t *testing.T) url.URL {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return url.URL{Scheme: "http", Host: addr}
+}
+
+// startTestEtcd start an embedded single node etcd and return the client url
+func startTestEtcd(t *testing.T) (string, func()) {
+	tmpDir, err := ioutil.TempDir("", "register-etcd-test")
+	assert.Nil(t, err)
+	cfg := embed.NewConfig()
+	cfg.Dir = tmpDir
+	curl := getTestFreeURL(t)
+	purl := getTestFreeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{curl}, []url.URL{curl}
+	cfg.LPUrls, cfg.APUrls = []url.URL{purl}, []url.URL{purl}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("start etcd failed: %v", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(time.Second * 30):
+		e.Close()
+		os.RemoveAll(tmpDir)
+		t.Fatal("etcd start timeout")
+	}
+	return curl.String(), func() {
+		e.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func newTestPDRegister(t *testing.T, host string, id string) *PDEtcdRegister {
+	r, err := NewPDEtcdRegister(host, nil)
+	assert.Nil(t, err)
+	r.InitClusterID("test-cluster")
+	assert.Nil(t, r.Register(&NodeInfo{ID: id, NodeIP: "127.0.0.1"}))
+	return r
+}
+
+func waitTestLeader(t *testing.T, leaderC chan *NodeInfo, id string) {
+	timeout := time.After(time.Second * 30)
+	for {
+		select {
+		case l := <-leaderC:
+			if l != nil && l.ID == id {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("wait leader %v timeout", id)
+		}
+	}
+}
+
+func TestEtcdRegisterPDLeader(t *testing.T) {
+	host, stop := startTestEtcd(t)
+	defer stop()
+
+	pd1 := newTestPDRegister(t, host, "pd1")
+	pd2 := newTestPDRegister(t, host, "pd2")
+	nodes, err := pd1.GetAllPDNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nodes))
+
+	leader1 := make(chan *NodeInfo, 10)
+	stop1 := make(chan struct{})
+	go pd1.AcquireAndWatchLeader(leader1, stop1)
+	waitTestLeader(t, leader1, "pd1")
+	assert.True(t, pd1.CheckIfLeader())
+	assert.False(t, pd2.CheckIfLeader())
+
+	leader2 := make(chan *NodeInfo, 10)
+	stop2 := make(chan struct{})
+	defer close(stop2)
+	go pd2.AcquireAndWatchLeader(leader2, stop2)
+	waitTestLeader(t, leader2, "pd1")
+
+	// the data node should see the same leader
+	dn, err := NewDNEtcdRegister(host, nil)
+	assert.Nil(t, err)
+	dn.InitClusterID("test-cluster")
+	dnLeader := make(chan *NodeInfo, 10)
+	dnStop := make(chan struct{})
+	defer close(dnStop)
+	go dn.WatchPDLeader(dnLeader, dnStop)
+	waitTestLeader(t, dnLeader, "pd1")
+
+	// the leader should be changed after the old leader stopped
+	close(stop1)
+	assert.Nil(t, pd1.Unregister(pd1.nodeInfo))
+	waitTestLeader(t, leader2, "pd2")
+	waitTestLeader(t, dnLeader, "pd2")
+	assert.True(t, pd2.CheckIfLeader())
+	nodes, err = pd2.GetAllPDNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nodes))
+}
+
+func TestEtcdRegisterWatchDataNodes(t *testing.T) {
+	host, stop := startTestEtcd(t)
+	defer stop()
+
+	pd := newTestPDRegister(t, host, "pd1")
+	nodesC := make(chan []NodeInfo, 10)
+	watchStop := make(chan struct{})
+	defer close(watchStop)
+	go pd.WatchDataNodes(nodesC, watchStop)
+	waitNodes := func(n int) []NodeInfo {
+		timeout := time.After(time.Second * 30)
+		for {
+			select {
+			case nodes := <-nodesC:
+				if len(nodes) == n {
+					return nodes
+				}
+			case <-timeout:
+				t.Fatalf("wait %v data nodes timeout", n)
+			}
+		}
+	}
+	waitNodes(0)
+
+	dn, err := NewDNEtcdRegister(host, nil)
+	assert.Nil(t, err)
+	dn.InitClusterID("test-cluster")
+	nodeInfo := &NodeInfo{NodeIP: "127.0.0.1", RedisPort: "6379", HttpPort: "8080"}
+	nodeInfo.RegID, err = dn.NewRegisterNodeID()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), nodeInfo.RegID)
+	nodeInfo.ID = GenNodeID(nodeInfo, "datanode")
+	assert.Nil(t, dn.Register(nodeInfo))
+	nodes := waitNodes(1)
+	assert.Equal(t, nodeInfo.ID, nodes[0].ID)
+	n, err := dn.GetNodeInfo(nodeInfo.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, nodeInfo.RegID, n.RegID)
+
+	// the learner role can not be changed after registered
+	learner := *nodeInfo
+	learner.LearnerRole = common.LearnerRoleLogSyncer
+	assert.Equal(t, ErrLearnerRoleInvalidChanged, dn.Register(&learner))
+
+	assert.Nil(t, dn.Unregister(nodeInfo))
+	waitNodes(0)
+	_, err = dn.GetNodeInfo(nodeInfo.ID)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestEtcdRegisterCheckMetaMigrated(t *testing.T) {
+	host, stop := startTestEtcd(t)
+	defer stop()
+
+	r, err := NewPDEtcdRegister(host, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, r.CheckMetaMigrated("test-cluster"))
+
+	// the meta data written by the old version with the v2 API
+	c, err := newEtcdV2Client([]string{host}, nil)
+	assert.Nil(t, err)
+	_, err = client.NewKeysAPI(c).Set(context.Background(), "/"+ROOT_DIR+"/test-cluster/"+CLUSTER_META_INFO, "{}", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMetaNotMigrated, r.CheckMetaMigrated("test-cluster"))
+	assert.Nil(t, r.CheckMetaMigrated("other-cluster"))
+
+	// the migrated meta data
+	r.InitClusterID("test-cluster")
+	_, err = r.PrepareNamespaceMinGID()
+	assert.Nil(t, err)
+	assert.Nil(t, r.CheckMetaMigrated("test-cluster"))
+}
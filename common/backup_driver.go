@@ -0,0 +1,384 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BackupTargetLocal = "local"
+	BackupTargetS3    = "s3"
+	backupMetaName    = "backup_meta.json"
+)
+
+var (
+	errBackupTargetInvalid = errors.New("invalid backup target config")
+	ErrBackupNotFound      = errors.New("backup not found")
+)
+
+// BackupTargetConfig is the config for the external storage of the backups
+type BackupTargetConfig struct {
+	// local or s3 (any s3 compatible storage, such as minio or gcs)
+	Type string `json:"type"`
+	// the root dir for the local target
+	Dir string `json:"dir"`
+	// the s3 endpoint with scheme, such as https://s3.us-east-1.amazonaws.com
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	// the key prefix for all the backups in the target
+	Prefix string `json:"prefix"`
+	// the backup will be purged after retention days, 0 means keep forever
+	RetentionDays int `json:"retention_days"`
+	// keep at least the number of latest backups even expired
+	KeepNum int `json:"keep_num"`
+	// the min interval between the uploads of the same namespace partition, the forced
+	// backup will always be uploaded.
+	MinIntervalSec int `json:"min_interval_sec"`
+}
+
+// BackupMeta is the retention metadata for the uploaded backup, it will be uploaded after
+// all the files uploaded so only the completed backups will be listed.
+type BackupMeta struct {
+	Namespace  string         `json:"namespace"`
+	Term       uint64         `json:"term"`
+	Index      uint64         `json:"index"`
+	Files      []SnapFileInfo `json:"files"`
+	Encrypted  bool           `json:"encrypted"`
+	CreateTime time.Time      `json:"create_time"`
+	ExpireTime time.Time      `json:"expire_time,omitempty"`
+}
+
+// PartitionBackupInfo is the backup point of the namespace partition in the cluster backup
+type PartitionBackupInfo struct {
+	Partition int    `json:"partition"`
+	Node      string `json:"node"`
+	Term      uint64 `json:"term"`
+	Index     uint64 `json:"index"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PartitionBackupPoint is returned by the partition leader after the backup is done, the
+// backup contains all the raft logs until the term and index.
+type PartitionBackupPoint struct {
+	Name  string `json:"name"`
+	Term  uint64 `json:"term"`
+	Index uint64 `json:"index"`
+}
+
+type NamespaceBackupManifest struct {
+	PartitionNum int                   `json:"partition_num"`
+	Replica      int                   `json:"replica"`
+	EngType      string                `json:"eng_type"`
+	Partitions   []PartitionBackupInfo `json:"partitions"`
+}
+
+// ClusterBackupManifest is the result of the cluster backup, each partition can be restored
+// from the checkpoint (or the uploaded backup) named by the term and index in the manifest.
+// Note the partitions are backed up independently between the start and end time, so the
+// backup is not at a consistent point across the partitions.
+type ClusterBackupManifest struct {
+	ClusterID  string                              `json:"cluster_id"`
+	StartTime  time.Time                           `json:"start_time"`
+	EndTime    time.Time                           `json:"end_time"`
+	Complete   bool                                `json:"complete"`
+	Namespaces map[string]*NamespaceBackupManifest `json:"namespaces"`
+}
+
+// BackupDriver upload the local checkpoint to the external storage
+type BackupDriver interface {
+	// Upload all the files in the local dir as the backup of the namespace partition
+	Upload(meta *BackupMeta, dir string, stop chan struct{}) error
+	// List the completed backups of the namespace partition, sorted by the index
+	List(ns string) ([]BackupMeta, error)
+	// Download the backup files to the local dir
+	Download(ns string, term uint64, index uint64, dir string, stop chan struct{}) error
+	Delete(ns string, term uint64, index uint64) error
+	// PurgeExpired delete the expired backups of the namespace partition
+	PurgeExpired(ns string) error
+}
+
+// the basic operations of the object storage
+type backupObjectStore interface {
+	put(key string, r io.Reader, size int64) error
+	get(key string, w io.Writer) error
+	list(prefix string) ([]string, error)
+	delete(key string) error
+}
+
+type objectBackupDriver struct {
+	conf  BackupTargetConfig
+	store backupObjectStore
+}
+
+// NewBackupDriver create the driver for the backup target
+func NewBackupDriver(conf BackupTargetConfig) (BackupDriver, error) {
+	var store backupObjectStore
+	switch conf.Type {
+	case BackupTargetLocal:
+		if conf.Dir == "" {
+			return nil, errBackupTargetInvalid
+		}
+		store = &localObjectStore{root: conf.Dir}
+	case BackupTargetS3:
+		s3, err := newS3ObjectStore(conf)
+		if err != nil {
+			return nil, err
+		}
+		store = s3
+	default:
+		return nil, errBackupTargetInvalid
+	}
+	return &objectBackupDriver{conf: conf, store: store}, nil
+}
+
+func (d *objectBackupDriver) backupKey(ns string, term uint64, index uint64) string {
+	return path.Join(d.conf.Prefix, ns, fmt.Sprintf("%016x-%016x", term, index))
+}
+
+func (d *objectBackupDriver) Upload(meta *BackupMeta, dir string, stop chan struct{}) error {
+	files, err := GetSnapFileList(dir)
+	if err != nil {
+		return err
+	}
+	key := d.backupKey(meta.Namespace, meta.Term, meta.Index)
+	for _, f := range files {
+		select {
+		case <-stop:
+			return ErrStopped
+		default:
+		}
+		err := func() error {
+			in, err := os.Open(filepath.Join(dir, filepath.FromSlash(f.Name)))
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			return d.store.put(path.Join(key, f.Name), in, f.Size)
+		}()
+		if err != nil {
+			return fmt.Errorf("upload %v failed: %v", f.Name, err)
+		}
+	}
+	meta.Files = files
+	if meta.CreateTime.IsZero() {
+		meta.CreateTime = time.Now()
+	}
+	if d.conf.RetentionDays > 0 {
+		meta.ExpireTime = meta.CreateTime.Add(time.Hour * 24 * time.Duration(d.conf.RetentionDays))
+	}
+	data, _ := json.Marshal(meta)
+	return d.store.put(path.Join(key, backupMetaName), bytes.NewReader(data), int64(len(data)))
+}
+
+func (d *objectBackupDriver) getMeta(key string) (*BackupMeta, error) {
+	var buf bytes.Buffer
+	err := d.store.get(path.Join(key, backupMetaName), &buf)
+	if err != nil {
+		return nil, err
+	}
+	var meta BackupMeta
+	err = json.Unmarshal(buf.Bytes(), &meta)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (d *objectBackupDriver) List(ns string) ([]BackupMeta, error) {
+	keys, err := d.store.list(path.Join(d.conf.Prefix, ns) + "/")
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]BackupMeta, 0)
+	for _, k := range keys {
+		if path.Base(k) != backupMetaName {
+			continue
+		}
+		meta, err := d.getMeta(path.Dir(k))
+		if err != nil {
+			log.Printf("get backup meta %v failed: %v\n", k, err)
+			continue
+		}
+		metas = append(metas, *meta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Term == metas[j].Term {
+			return metas[i].Index < metas[j].Index
+		}
+		return metas[i].Term < metas[j].Term
+	})
+	return metas, nil
+}
+
+func (d *objectBackupDriver) Download(ns string, term uint64, index uint64, dir string, stop chan struct{}) error {
+	key := d.backupKey(ns, term, index)
+	meta, err := d.getMeta(key)
+	if err != nil {
+		return ErrBackupNotFound
+	}
+	for _, f := range meta.Files {
+		select {
+		case <-stop:
+			return ErrStopped
+		default:
+		}
+		if !isValidSnapFileName(f.Name) {
+			return errInvalidSnapPath
+		}
+		local := filepath.Join(dir, filepath.FromSlash(f.Name))
+		err := os.MkdirAll(filepath.Dir(local), DIR_PERM)
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			out, err := os.Create(local)
+			if err != nil {
+				return err
+			}
+			err = d.store.get(path.Join(key, f.Name), out)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}()
+		if err != nil {
+			return fmt.Errorf("download %v failed: %v", f.Name, err)
+		}
+		sum, err := fileChecksum(local)
+		if err != nil {
+			return err
+		}
+		if sum != f.Checksum {
+			return errSnapChecksumInvalid
+		}
+	}
+	return nil
+}
+
+func (d *objectBackupDriver) Delete(ns string, term uint64, index uint64) error {
+	key := d.backupKey(ns, term, index)
+	// delete the meta at first, so the partial deleted backup will not be listed
+	err := d.store.delete(path.Join(key, backupMetaName))
+	if err != nil {
+		return err
+	}
+	keys, err := d.store.list(key + "/")
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := d.store.delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *objectBackupDriver) PurgeExpired(ns string) error {
+	metas, err := d.List(ns)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := 0; i < len(metas)-d.conf.KeepNum; i++ {
+		m := metas[i]
+		if m.ExpireTime.IsZero() || m.ExpireTime.After(now) {
+			continue
+		}
+		log.Printf("purge expired backup %v-%v-%v, expired at %v\n", ns, m.Term, m.Index, m.ExpireTime)
+		if err := d.Delete(ns, m.Term, m.Index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the object storage on the local file system (or the mounted network file system)
+type localObjectStore struct {
+	root string
+}
+
+func (s *localObjectStore) put(key string, r io.Reader, size int64) error {
+	full := filepath.Join(s.root, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(full), DIR_PERM)
+	if err != nil {
+		return err
+	}
+	tmp := full + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, full)
+}
+
+func (s *localObjectStore) get(key string, w io.Writer) error {
+	in, err := os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(w, in)
+	return err
+}
+
+func (s *localObjectStore) list(prefix string) ([]string, error) {
+	var keys []string
+	dir := filepath.Join(s.root, filepath.FromSlash(prefix))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return keys, nil
+	}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	return keys, err
+}
+
+func (s *localObjectStore) delete(key string) error {
+	full := filepath.Join(s.root, filepath.FromSlash(key))
+	err := os.Remove(full)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// remove the empty parent dirs
+	for dir := filepath.Dir(full); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if names, _ := ioutil.ReadDir(dir); len(names) > 0 {
+			break
+		}
+		os.Remove(dir)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion   = "us-east-1"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3IOTimeout       = time.Minute
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+var s3EmptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// the object storage compatible with the s3 api (aws s3, minio, or gcs with the hmac keys),
+// the request is signed by the aws signature version 4 and the path style url is used.
+type s3ObjectStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+func newS3ObjectStore(conf BackupTargetConfig) (*s3ObjectStore, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errBackupTargetInvalid
+	}
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errBackupTargetInvalid
+	}
+	region := conf.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	return &s3ObjectStore{
+		endpoint:  u,
+		region:    region,
+		bucket:    conf.Bucket,
+		accessKey: conf.AccessKey,
+		secretKey: conf.SecretKey,
+		client:    &http.Client{Transport: NewDeadlineTransport(s3IOTimeout)},
+	}, nil
+}
+
+// escape the string as the aws uri encode, the slash is kept for the object key
+func s3URIEscape(s string, keepSlash bool) string {
+	var buf bytes.Buffer
+	for _, c := range []byte(s) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func s3HmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *s3ObjectStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(s3TimeFormat)
+	date := now.UTC().Format(s3DateFormat)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, s3URIEscape(k, false)+"="+s3URIEscape(query.Get(k), false))
+	}
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	reqHash := sha256.Sum256([]byte(canonicalReq))
+	strToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+
+	key := s3HmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = s3HmacSHA256(key, s.region)
+	key = s3HmacSHA256(key, "s3")
+	key = s3HmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(s3HmacSHA256(key, strToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func (s *s3ObjectStore) newRequest(method string, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		p += "/" + key
+	}
+	u.Path = p
+	u.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + "/" + s3URIEscape(s.bucket, false)
+	if key != "" {
+		u.RawPath += "/" + s3URIEscape(key, true)
+	}
+	u.RawQuery = query.Encode()
+	return http.NewRequest(method, u.String(), body)
+}
+
+func (s *s3ObjectStore) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now())
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 4096))
+		rsp.Body.Close()
+		if rsp.StatusCode == http.StatusNotFound {
+			return nil, ErrBackupNotFound
+		}
+		return nil, fmt.Errorf("s3 %v %v failed: %v %s", req.Method, req.URL.Path, rsp.Status, body)
+	}
+	return rsp, nil
+}
+
+func (s *s3ObjectStore) put(key string, r io.Reader, size int64) error {
+	body := ioutil.NopCloser(r)
+	if size == 0 {
+		// s3 need the content length, so avoid the chunked encoding for the empty body
+		body = http.NoBody
+	}
+	req, err := s.newRequest("PUT", key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	rsp, err := s.do(req, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	return nil
+}
+
+func (s *s3ObjectStore) get(key string, w io.Writer) error {
+	req, err := s.newRequest("GET", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := s.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, err = io.Copy(w, rsp.Body)
+	return err
+}
+
+func (s *s3ObjectStore) list(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.newRequest("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := s.do(req, s3EmptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(rsp.Body).Decode(&result)
+		rsp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3ObjectStore) delete(key string) error {
+	req, err := s.newRequest("DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := s.do(req, s3EmptyPayloadHash)
+	if err == ErrBackupNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	return nil
+}
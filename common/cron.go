@@ -0,0 +1,147 @@
+package common
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCronSpec = errors.New("invalid cron spec")
+
+type cronField struct {
+	// the bit is set for each allowed value
+	bits uint64
+	// all the values allowed by *
+	any bool
+}
+
+func (f cronField) match(v int) bool {
+	return f.bits&(1<<uint(v)) != 0
+}
+
+// CronSchedule is the standard cron schedule with 5 fields: minute, hour, day of month,
+// month and day of week. Each field can be *, a value, a range (a-b), a list (a,b) and
+// with the step (*/n or a-b/n).
+type CronSchedule struct {
+	spec   string
+	minute cronField
+	hour   cronField
+	dom    cronField
+	month  cronField
+	dow    cronField
+}
+
+func parseCronField(field string, minV int, maxV int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return f, errInvalidCronSpec
+			}
+			part = part[:i]
+		}
+		start, end := minV, maxV
+		if part == "*" {
+			if step == 1 {
+				f.any = true
+			}
+		} else if i := strings.Index(part, "-"); i >= 0 {
+			var err1, err2 error
+			start, err1 = strconv.Atoi(part[:i])
+			end, err2 = strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil {
+				return f, errInvalidCronSpec
+			}
+		} else {
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return f, errInvalidCronSpec
+			}
+			start = v
+			end = v
+			if step != 1 {
+				end = maxV
+			}
+		}
+		if start < minV || end > maxV || start > end {
+			return f, errInvalidCronSpec
+		}
+		for v := start; v <= end; v += step {
+			f.bits |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+// ParseCronSchedule parse the 5 fields cron spec, such as "30 2 * * *" for 02:30 every day
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errInvalidCronSpec
+	}
+	cs := &CronSchedule{spec: spec}
+	var err error
+	if cs.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if cs.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if cs.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if cs.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	// both 0 and 7 are sunday
+	if cs.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if cs.dow.match(7) {
+		cs.dow.bits |= 1
+	}
+	return cs, nil
+}
+
+func (cs *CronSchedule) String() string {
+	return cs.spec
+}
+
+func (cs *CronSchedule) matchDay(t time.Time) bool {
+	// the day matches any of the day of month and the day of week if both are restricted
+	if !cs.dom.any && !cs.dow.any {
+		return cs.dom.match(t.Day()) || cs.dow.match(int(t.Weekday()))
+	}
+	return cs.dom.match(t.Day()) && cs.dow.match(int(t.Weekday()))
+}
+
+// Next return the first time matched the schedule after the given time, the zero
+// time is returned if no time matched in 5 years (such as Feb 30).
+func (cs *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !cs.month.match(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cs.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cs.hour.match(t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cs.minute.match(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
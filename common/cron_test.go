@@ -0,0 +1,38 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	base := time.Date(2020, 1, 31, 10, 30, 20, 0, time.Local)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 31, 10, 31, 0, 0, time.Local)},
+		{"30 2 * * *", time.Date(2020, 2, 1, 2, 30, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2020, 1, 31, 10, 45, 0, 0, time.Local)},
+		{"0 9-17/4 * * *", time.Date(2020, 1, 31, 13, 0, 0, 0, time.Local)},
+		{"0 0 1,15 * *", time.Date(2020, 2, 1, 0, 0, 0, 0, time.Local)},
+		// 2020-02-02 is sunday
+		{"0 3 * * 7", time.Date(2020, 2, 2, 3, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cs, err := ParseCronSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("parse %v failed: %v", c.spec, err)
+		}
+		if next := cs.Next(base); !next.Equal(c.next) {
+			t.Errorf("next of %v should be %v, got %v", c.spec, c.next, next)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCronSchedule(spec); err == nil {
+			t.Errorf("spec %v should be invalid", spec)
+		}
+	}
+}
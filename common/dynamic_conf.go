@@ -0,0 +1,149 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// the cluster wide configs which can be changed by pd while running, the
+// empty value means the default value configured on the node.
+const (
+	// the threshold in microseconds for the slow log, negative means disabled
+	DynConfSlowLogThresholdUs = "slowlog_threshold_us"
+	// the json list of the write rate limits, see the write rate limit of the server
+	DynConfWriteRateLimits = "write_rate_limits"
+	// the interval in seconds to check the expired keys for the local deletion policy
+	DynConfLocalExpireCheckSecs = "local_expire_check_secs"
+	// the max number of the commands in a db write batch while applying raft logs
+	DynConfDBBatchMaxCmdNum = "db_batch_max_cmd_num"
+	// the percent (0-100) of the key accesses sampled for the OBJECT IDLETIME and FREQ,
+	// 0 means the access tracking is disabled
+	DynConfAccessSampleRate = "access_sample_rate"
+)
+
+var ErrUnknownDynamicConf = errors.New("unknown dynamic config")
+
+func validateIntConf(minV int64) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		if n < minV {
+			return ErrInvalidArgs
+		}
+		return nil
+	}
+}
+
+var dynamicConfValidators = map[string]func(string) error{
+	DynConfSlowLogThresholdUs: validateIntConf(-1),
+	DynConfWriteRateLimits: func(v string) error {
+		var limits []map[string]interface{}
+		return json.Unmarshal([]byte(v), &limits)
+	},
+	DynConfLocalExpireCheckSecs: validateIntConf(1),
+	DynConfDBBatchMaxCmdNum:     validateIntConf(1),
+	DynConfAccessSampleRate: func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 100 {
+			return ErrInvalidArgs
+		}
+		return nil
+	},
+}
+
+// ValidateDynamicConf check the key is known and the value can be applied, the empty value
+// is always valid to restore the default.
+func ValidateDynamicConf(key string, value string) error {
+	validator, ok := dynamicConfValidators[key]
+	if !ok {
+		return ErrUnknownDynamicConf
+	}
+	if value == "" {
+		return nil
+	}
+	return validator(value)
+}
+
+// DynamicConfApplier apply the changed value to the running node, the empty value
+// should restore the default.
+type DynamicConfApplier func(value string) error
+
+var dynamicConfMutex sync.Mutex
+var dynamicConfAppliers = make(map[string][]DynamicConfApplier)
+var appliedDynamicConf = make(map[string]string)
+
+// RegisterDynamicConfApplier register the applier for the dynamic config key, more than one
+// appliers can be registered for the same key.
+func RegisterDynamicConfApplier(key string, applier DynamicConfApplier) {
+	dynamicConfMutex.Lock()
+	dynamicConfAppliers[key] = append(dynamicConfAppliers[key], applier)
+	dynamicConfMutex.Unlock()
+}
+
+// ApplyDynamicConf apply the changed values of the cluster dynamic config, the key not in
+// the config will be restored to the default. The keys failed to apply are returned.
+func ApplyDynamicConf(conf map[string]string) map[string]error {
+	dynamicConfMutex.Lock()
+	defer dynamicConfMutex.Unlock()
+	var errs map[string]error
+	for key, appliers := range dynamicConfAppliers {
+		v := conf[key]
+		old, ok := appliedDynamicConf[key]
+		if ok && old == v {
+			continue
+		}
+		if !ok && v == "" {
+			continue
+		}
+		var err error
+		if err = ValidateDynamicConf(key, v); err == nil {
+			for _, applier := range appliers {
+				if applyErr := applier(v); applyErr != nil {
+					err = applyErr
+				}
+			}
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[key] = err
+			continue
+		}
+		if v == "" {
+			delete(appliedDynamicConf, key)
+		} else {
+			appliedDynamicConf[key] = v
+		}
+	}
+	return errs
+}
+
+// GetAppliedDynamicConf return the dynamic config applied on this node
+func GetAppliedDynamicConf() map[string]string {
+	dynamicConfMutex.Lock()
+	defer dynamicConfMutex.Unlock()
+	conf := make(map[string]string, len(appliedDynamicConf))
+	for k, v := range appliedDynamicConf {
+		conf[k] = v
+	}
+	return conf
+}
+
+// GetDynamicConfKeys return all the known dynamic config keys
+func GetDynamicConfKeys() []string {
+	keys := make([]string, 0, len(dynamicConfValidators))
+	for k := range dynamicConfValidators {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDynamicConfApply(t *testing.T) {
+	if err := ValidateDynamicConf("unknown_key", "1"); err != ErrUnknownDynamicConf {
+		t.Fatalf("unknown key should be invalid: %v", err)
+	}
+	if err := ValidateDynamicConf(DynConfDBBatchMaxCmdNum, "0"); err == nil {
+		t.Fatal("invalid value should be rejected")
+	}
+	if err := ValidateDynamicConf(DynConfWriteRateLimits, "[]"); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied []string
+	key := DynConfLocalExpireCheckSecs
+	RegisterDynamicConfApplier(key, func(v string) error {
+		if v == "100" {
+			return errors.New("apply failed")
+		}
+		applied = append(applied, v)
+		return nil
+	})
+	errs := ApplyDynamicConf(map[string]string{key: "10"})
+	if len(errs) != 0 || len(applied) != 1 || applied[0] != "10" {
+		t.Fatalf("apply failed: %v, %v", errs, applied)
+	}
+	// the unchanged config should not be applied again
+	ApplyDynamicConf(map[string]string{key: "10"})
+	if len(applied) != 1 || GetAppliedDynamicConf()[key] != "10" {
+		t.Fatalf("unexpected applied: %v, %v", applied, GetAppliedDynamicConf())
+	}
+	errs = ApplyDynamicConf(map[string]string{key: "100"})
+	if errs[key] == nil || GetAppliedDynamicConf()[key] != "10" {
+		t.Fatalf("apply should fail: %v, %v", errs, GetAppliedDynamicConf())
+	}
+	// the removed config should be restored to default
+	ApplyDynamicConf(nil)
+	if len(applied) != 2 || applied[1] != "" {
+		t.Fatalf("removed config should be applied: %v", applied)
+	}
+	if _, ok := GetAppliedDynamicConf()[key]; ok {
+		t.Fatalf("removed config should not be applied: %v", GetAppliedDynamicConf())
+	}
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"errors"
+)
+
+// the fault points for the chaos testing, the faults only work in the binary built
+// with the faultinject tag, and are no-op in the normal build.
+const (
+	// drop the outgoing raft messages of the partition
+	FaultRaftDropMsg = "raft_drop_msg"
+	// delay the apply of the committed raft logs of the partition
+	FaultApplyDelay = "apply_delay"
+	// pause the apply of the committed raft logs of the partition until the fault is removed
+	FaultApplyPause = "apply_pause"
+	// fail the write to the db engine, it is node wide since the engine has no namespace
+	FaultDBWriteFail = "db_write_fail"
+	// crash the node before or after installing the snapshot of the partition
+	FaultCrashBeforeSnapInstall = "crash_before_snap_install"
+	FaultCrashAfterSnapInstall  = "crash_after_snap_install"
+)
+
+var (
+	ErrFaultInjected       = errors.New("fault injected")
+	ErrFaultInjectDisabled = errors.New("fault injection is disabled, build with the faultinject tag to enable")
+	ErrUnknownFaultPoint   = errors.New("unknown fault point")
+	ErrInvalidFaultConf    = errors.New("invalid fault config")
+)
+
+var faultPoints = map[string]struct{}{
+	FaultRaftDropMsg:            {},
+	FaultApplyDelay:             {},
+	FaultApplyPause:             {},
+	FaultDBWriteFail:            {},
+	FaultCrashBeforeSnapInstall: {},
+	FaultCrashAfterSnapInstall:  {},
+}
+
+// FaultConf is the config of the fault point
+type FaultConf struct {
+	// the probability (0, 1] to trigger the fault at each check
+	Probability float64 `json:"probability"`
+	// the delay in milliseconds for the delay fault
+	DelayMs int64 `json:"delay_ms,omitempty"`
+	// only trigger in the partitions of the namespace (or the partition such as ns-0)
+	// if not empty
+	Namespace string `json:"namespace,omitempty"`
+	// the fault will be removed after triggered the times, 0 means no limit
+	Count int64 `json:"count,omitempty"`
+	// the times the fault has been triggered
+	Triggered int64 `json:"triggered"`
+}
+
+func validateFault(name string, conf FaultConf) error {
+	if _, ok := faultPoints[name]; !ok {
+		return ErrUnknownFaultPoint
+	}
+	if conf.Probability <= 0 || conf.Probability > 1 || conf.DelayMs < 0 || conf.Count < 0 {
+		return ErrInvalidFaultConf
+	}
+	if name == FaultApplyDelay && conf.DelayMs == 0 {
+		return ErrInvalidFaultConf
+	}
+	if name == FaultDBWriteFail && conf.Namespace != "" {
+		return ErrInvalidFaultConf
+	}
+	// the pause will be ended by removing the fault
+	if name == FaultApplyPause && conf.Count != 0 {
+		return ErrInvalidFaultConf
+	}
+	return nil
+}
+
+func (fc *FaultConf) matchNamespace(fullName string) bool {
+	if fc.Namespace == "" || fc.Namespace == fullName {
+		return true
+	}
+	baseName, _ := GetNamespaceAndPartition(fullName)
+	return fc.Namespace == baseName
+}
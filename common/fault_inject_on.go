@@ -0,0 +1,143 @@
+// +build faultinject
+
+package common
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const FaultInjectEnabled = true
+
+var (
+	faultMutex  sync.Mutex
+	faults      = make(map[string]*FaultConf)
+	faultActive int32
+	// the offset in nanoseconds added to the clock for the ttl
+	clockOffset int64
+)
+
+// ClockNow return the time of the controllable clock used by the ttl
+func ClockNow() time.Time {
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&clockOffset)))
+}
+
+// SetClockOffset move the clock used by the ttl forward (or backward if negative)
+func SetClockOffset(offset time.Duration) error {
+	atomic.StoreInt64(&clockOffset, int64(offset))
+	return nil
+}
+
+func GetClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockOffset))
+}
+
+// SetFault enable the fault point with the config, the old config will be replaced
+func SetFault(name string, conf FaultConf) error {
+	if err := validateFault(name, conf); err != nil {
+		return err
+	}
+	conf.Triggered = 0
+	faultMutex.Lock()
+	faults[name] = &conf
+	atomic.StoreInt32(&faultActive, int32(len(faults)))
+	faultMutex.Unlock()
+	return nil
+}
+
+// RemoveFault disable the fault point, all the fault points will be disabled if the name is empty
+func RemoveFault(name string) {
+	faultMutex.Lock()
+	if name == "" {
+		faults = make(map[string]*FaultConf)
+	} else {
+		delete(faults, name)
+	}
+	atomic.StoreInt32(&faultActive, int32(len(faults)))
+	faultMutex.Unlock()
+}
+
+// GetFaults return the enabled fault points
+func GetFaults() map[string]FaultConf {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	ret := make(map[string]FaultConf, len(faults))
+	for name, fc := range faults {
+		ret[name] = *fc
+	}
+	return ret
+}
+
+// CheckFault return the fault config if the fault should be triggered for the partition,
+// the fault will be removed if triggered enough times.
+func CheckFault(name string, fullName string) (FaultConf, bool) {
+	if atomic.LoadInt32(&faultActive) == 0 {
+		return FaultConf{}, false
+	}
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	fc, ok := faults[name]
+	if !ok || !fc.matchNamespace(fullName) {
+		return FaultConf{}, false
+	}
+	if fc.Probability < 1 && rand.Float64() >= fc.Probability {
+		return FaultConf{}, false
+	}
+	fc.Triggered++
+	if fc.Count > 0 && fc.Triggered >= fc.Count {
+		delete(faults, name)
+		atomic.StoreInt32(&faultActive, int32(len(faults)))
+	}
+	return *fc, true
+}
+
+// FaultError return the injected error if the fault is triggered
+func FaultError(name string, fullName string) error {
+	if _, ok := CheckFault(name, fullName); ok {
+		return ErrFaultInjected
+	}
+	return nil
+}
+
+// FaultDelay sleep the configured delay if the fault is triggered
+func FaultDelay(name string, fullName string) {
+	if fc, ok := CheckFault(name, fullName); ok {
+		time.Sleep(time.Duration(fc.DelayMs) * time.Millisecond)
+	}
+}
+
+// FaultPause block until the fault is removed or stopped if the fault is triggered, the
+// probability is only checked at the beginning.
+func FaultPause(name string, fullName string, stop chan struct{}) {
+	if _, ok := CheckFault(name, fullName); !ok {
+		return
+	}
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		faultMutex.Lock()
+		fc, ok := faults[name]
+		ok = ok && fc.matchNamespace(fullName)
+		faultMutex.Unlock()
+		if !ok {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// FaultCrash exit the process immediately without any cleanup if the fault is triggered
+func FaultCrash(name string, fullName string) {
+	if _, ok := CheckFault(name, fullName); ok {
+		fmt.Fprintf(os.Stderr, "crash by the injected fault %v at %v\n", name, fullName)
+		os.Exit(2)
+	}
+}
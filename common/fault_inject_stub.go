@@ -0,0 +1,50 @@
+// +build !faultinject
+
+package common
+
+import (
+	"time"
+)
+
+// the fault injection is compiled out in the normal build
+const FaultInjectEnabled = false
+
+func ClockNow() time.Time {
+	return time.Now()
+}
+
+func SetClockOffset(offset time.Duration) error {
+	return ErrFaultInjectDisabled
+}
+
+func GetClockOffset() time.Duration {
+	return 0
+}
+
+func SetFault(name string, conf FaultConf) error {
+	return ErrFaultInjectDisabled
+}
+
+func RemoveFault(name string) {
+}
+
+func GetFaults() map[string]FaultConf {
+	return nil
+}
+
+func CheckFault(name string, fullName string) (FaultConf, bool) {
+	return FaultConf{}, false
+}
+
+func FaultError(name string, fullName string) error {
+	return nil
+}
+
+func FaultDelay(name string, fullName string) {
+}
+
+func FaultPause(name string, fullName string, stop chan struct{}) {
+}
+
+func FaultCrash(name string, fullName string) {
+}
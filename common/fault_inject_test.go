@@ -0,0 +1,52 @@
+// +build faultinject
+
+package common
+
+import (
+	"testing"
+)
+
+func TestFaultInject(t *testing.T) {
+	defer RemoveFault("")
+	if err := SetFault("unknown", FaultConf{Probability: 1}); err != ErrUnknownFaultPoint {
+		t.Errorf("unknown fault should fail: %v", err)
+	}
+	if err := SetFault(FaultApplyDelay, FaultConf{Probability: 1}); err != ErrInvalidFaultConf {
+		t.Errorf("delay fault without delay should fail: %v", err)
+	}
+	if err := SetFault(FaultDBWriteFail, FaultConf{Probability: 1, Namespace: "test"}); err != ErrInvalidFaultConf {
+		t.Errorf("db write fault with namespace should fail: %v", err)
+	}
+	if err := FaultError(FaultDBWriteFail, ""); err != nil {
+		t.Errorf("fault should not be triggered before enabled: %v", err)
+	}
+
+	err := SetFault(FaultRaftDropMsg, FaultConf{Probability: 1, Namespace: "test", Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := CheckFault(FaultRaftDropMsg, "other-0"); ok {
+		t.Errorf("fault should not be triggered for other namespace")
+	}
+	if _, ok := CheckFault(FaultRaftDropMsg, "test-0"); !ok {
+		t.Errorf("fault should be triggered for the namespace")
+	}
+	if fc := GetFaults()[FaultRaftDropMsg]; fc.Triggered != 1 {
+		t.Errorf("fault triggered times should be 1: %v", fc)
+	}
+	if _, ok := CheckFault(FaultRaftDropMsg, "test-1"); !ok {
+		t.Errorf("fault should be triggered for the namespace")
+	}
+	if _, ok := CheckFault(FaultRaftDropMsg, "test-1"); ok {
+		t.Errorf("fault should be removed after triggered the count")
+	}
+
+	SetFault(FaultDBWriteFail, FaultConf{Probability: 1})
+	if err := FaultError(FaultDBWriteFail, ""); err != ErrFaultInjected {
+		t.Errorf("fault should be injected: %v", err)
+	}
+	RemoveFault(FaultDBWriteFail)
+	if len(GetFaults()) != 0 {
+		t.Errorf("all faults should be removed: %v", GetFaults())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 var runningCh chan struct{}
@@ -15,6 +16,18 @@ func init() {
 }
 
 func RunFileSync(remote string, srcPath string, dstPath string, stopCh chan struct{}) error {
+	return RunIncrementalFileSync(remote, srcPath, dstPath, nil, stopCh)
+}
+
+// RunIncrementalFileSync sync the files from remote, the same immutable files in the reference dirs
+// will be reused without transferring from remote (only for native http transfer).
+func RunIncrementalFileSync(remote string, srcPath string, dstPath string, refDirs []string, stopCh chan struct{}) error {
+	return RunNamedFileSync("", remote, srcPath, dstPath, refDirs, stopCh)
+}
+
+// RunNamedFileSync is the same as RunIncrementalFileSync, and the native http transfer can be
+// paused, resumed or canceled by the name.
+func RunNamedFileSync(name string, remote string, srcPath string, dstPath string, refDirs []string, stopCh chan struct{}) error {
 	select {
 	case runningCh <- struct{}{}:
 	case <-stopCh:
@@ -27,6 +40,10 @@ func RunFileSync(remote string, srcPath string, dstPath string, stopCh chan stru
 		}
 	}()
 
+	if strings.HasPrefix(remote, "http://") {
+		// native transfer from the remote http api, no rsync needed
+		return runHTTPFileSync(name, remote, srcPath, dstPath, refDirs, stopCh)
+	}
 	var cmd *exec.Cmd
 	if filepath.Base(srcPath) == filepath.Base(dstPath) {
 		dir := filepath.Dir(dstPath)
@@ -0,0 +1,37 @@
+// +build gofuzz
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// the fuzz targets for go-fuzz, build with:
+// go-fuzz-build -func FuzzExtractNamespace github.com/absolute8511/ZanRedisDB/common
+
+// FuzzExtractNamespace check the namespace and the table extracted from the redis key can
+// be joined to the origin key
+func FuzzExtractNamespace(data []byte) int {
+	ns, realKey, err := ExtractNamesapce(data)
+	if err != nil {
+		return 0
+	}
+	if ns == "" {
+		panic(fmt.Sprintf("empty namespace extracted from %q", data))
+	}
+	joined := append([]byte(ns+string(NamespaceTableSeperator)), realKey...)
+	if !bytes.Equal(joined, data) {
+		panic(fmt.Sprintf("namespace %q and key %q mismatch the origin %q", ns, realKey, data))
+	}
+	table, key, err := ExtractTable(realKey)
+	if err != nil {
+		return 0
+	}
+	joined = append(append(append([]byte{}, table...), KEYSEP), key...)
+	if !bytes.Equal(joined, realKey) {
+		panic(fmt.Sprintf("table %q and key %q mismatch the origin %q", table, key, realKey))
+	}
+	GetNamespaceAndPartition(ns)
+	return 1
+}
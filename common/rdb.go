@@ -0,0 +1,1075 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the redis rdb file format, the writer always write the rdb version 9 (redis 5.0+) using the
+// plain encoding, and the reader can read the rdb from redis 2.x to 7.x (except the stream and module types).
+const (
+	rdbMagic              = "REDIS"
+	rdbWriteVersion       = 9
+	rdbMaxVersion         = 12
+	rdbOpSlotInfo         = 0xF4
+	rdbOpFunction2        = 0xF5
+	rdbOpFunction         = 0xF6
+	rdbOpModuleAux        = 0xF7
+	rdbOpIdle             = 0xF8
+	rdbOpFreq             = 0xF9
+	rdbOpAux              = 0xFA
+	rdbOpResizeDB         = 0xFB
+	rdbOpExpireMs         = 0xFC
+	rdbOpExpire           = 0xFD
+	rdbOpSelectDB         = 0xFE
+	rdbOpEOF              = 0xFF
+	rdbTypeString         = 0
+	rdbTypeList           = 1
+	rdbTypeSet            = 2
+	rdbTypeZSet           = 3
+	rdbTypeHash           = 4
+	rdbTypeZSet2          = 5
+	rdbTypeHashZipmap     = 9
+	rdbTypeListZiplist    = 10
+	rdbTypeSetIntset      = 11
+	rdbTypeZSetZiplist    = 12
+	rdbTypeHashZiplist    = 13
+	rdbTypeListQuicklist  = 14
+	rdbTypeHashListpack   = 16
+	rdbTypeZSetListpack   = 17
+	rdbTypeListQuicklist2 = 18
+	rdbTypeSetListpack    = 20
+
+	rdbLen6Bit  = 0
+	rdbLen14Bit = 1
+	rdbLen32Bit = 0x80
+	rdbLen64Bit = 0x81
+	rdbEncVal   = 3
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+
+	quicklistNodePlain = 1
+)
+
+var (
+	ErrRDBInvalid         = errors.New("invalid rdb file")
+	ErrRDBChecksumInvalid = errors.New("rdb checksum mismatch")
+	errRDBUnsupportedType = errors.New("unsupported rdb data type")
+	// the crc64 jones polynomial used by redis (reversed representation)
+	rdbCrcTable = crc64.MakeTable(0x95AC9329AC4BC9B5)
+)
+
+// the crc64 in redis has no initial and final inversion as the go crc64
+func rdbCrcUpdate(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, rdbCrcTable, p)
+}
+
+// RDBEntry is the key with value in the rdb file, only the field for the data type is used.
+type RDBEntry struct {
+	DB   int
+	Key  []byte
+	Type DataType
+	// the expire time in unix milliseconds, 0 means no expire
+	ExpireAt int64
+	Value    []byte
+	// the elements of the list and the members of the set
+	Values  [][]byte
+	Fields  []KVRecord
+	Members []ScorePair
+}
+
+// RDBWriter write the entries to the rdb file, Close should be called to write the checksum.
+type RDBWriter struct {
+	w     *bufio.Writer
+	crc   uint64
+	curDB int
+	buf   [9]byte
+}
+
+func NewRDBWriter(w io.Writer) (*RDBWriter, error) {
+	rw := &RDBWriter{
+		w:     bufio.NewWriter(w),
+		curDB: -1,
+	}
+	err := rw.write([]byte(fmt.Sprintf("%s%04d", rdbMagic, rdbWriteVersion)))
+	if err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (rw *RDBWriter) write(p []byte) error {
+	rw.crc = rdbCrcUpdate(rw.crc, p)
+	_, err := rw.w.Write(p)
+	return err
+}
+
+func (rw *RDBWriter) writeByte(b byte) error {
+	rw.buf[0] = b
+	return rw.write(rw.buf[:1])
+}
+
+func (rw *RDBWriter) writeLen(l uint64) error {
+	switch {
+	case l < 1<<6:
+		return rw.writeByte(byte(l))
+	case l < 1<<14:
+		rw.buf[0] = byte(rdbLen14Bit<<6) | byte(l>>8)
+		rw.buf[1] = byte(l)
+		return rw.write(rw.buf[:2])
+	case l <= math.MaxUint32:
+		rw.buf[0] = rdbLen32Bit
+		binary.BigEndian.PutUint32(rw.buf[1:], uint32(l))
+		return rw.write(rw.buf[:5])
+	default:
+		rw.buf[0] = rdbLen64Bit
+		binary.BigEndian.PutUint64(rw.buf[1:], l)
+		return rw.write(rw.buf[:9])
+	}
+}
+
+func (rw *RDBWriter) writeString(s []byte) error {
+	if err := rw.writeLen(uint64(len(s))); err != nil {
+		return err
+	}
+	return rw.write(s)
+}
+
+func (rw *RDBWriter) writeDouble(f float64) error {
+	binary.LittleEndian.PutUint64(rw.buf[:8], math.Float64bits(f))
+	return rw.write(rw.buf[:8])
+}
+
+func (rw *RDBWriter) WriteEntry(e *RDBEntry) error {
+	if e.DB != rw.curDB {
+		if err := rw.writeByte(rdbOpSelectDB); err != nil {
+			return err
+		}
+		if err := rw.writeLen(uint64(e.DB)); err != nil {
+			return err
+		}
+		rw.curDB = e.DB
+	}
+	if e.ExpireAt > 0 {
+		rw.buf[0] = rdbOpExpireMs
+		binary.LittleEndian.PutUint64(rw.buf[1:], uint64(e.ExpireAt))
+		if err := rw.write(rw.buf[:9]); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch e.Type {
+	case KV:
+		err = rw.writeByte(rdbTypeString)
+	case LIST:
+		err = rw.writeByte(rdbTypeList)
+	case SET:
+		err = rw.writeByte(rdbTypeSet)
+	case HASH:
+		err = rw.writeByte(rdbTypeHash)
+	case ZSET:
+		err = rw.writeByte(rdbTypeZSet2)
+	default:
+		return errRDBUnsupportedType
+	}
+	if err != nil {
+		return err
+	}
+	if err = rw.writeString(e.Key); err != nil {
+		return err
+	}
+	switch e.Type {
+	case KV:
+		return rw.writeString(e.Value)
+	case LIST, SET:
+		if err = rw.writeLen(uint64(len(e.Values))); err != nil {
+			return err
+		}
+		for _, v := range e.Values {
+			if err = rw.writeString(v); err != nil {
+				return err
+			}
+		}
+	case HASH:
+		if err = rw.writeLen(uint64(len(e.Fields))); err != nil {
+			return err
+		}
+		for _, f := range e.Fields {
+			if err = rw.writeString(f.Key); err != nil {
+				return err
+			}
+			if err = rw.writeString(f.Value); err != nil {
+				return err
+			}
+		}
+	case ZSET:
+		if err = rw.writeLen(uint64(len(e.Members))); err != nil {
+			return err
+		}
+		for _, m := range e.Members {
+			if err = rw.writeString(m.Member); err != nil {
+				return err
+			}
+			if err = rw.writeDouble(m.Score); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close write the eof and the checksum, the underlying writer will not be closed.
+func (rw *RDBWriter) Close() error {
+	if err := rw.writeByte(rdbOpEOF); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(rw.buf[:8], rw.crc)
+	if _, err := rw.w.Write(rw.buf[:8]); err != nil {
+		return err
+	}
+	return rw.w.Flush()
+}
+
+// RDBReader read the entries from the rdb file
+type RDBReader struct {
+	r       *bufio.Reader
+	crc     uint64
+	version int
+	db      int
+	buf     [8]byte
+}
+
+// NewRDBReader create the reader for the rdb, the buffered reader will be used directly so
+// the data after the rdb can be read from it after the rdb is read.
+func NewRDBReader(r io.Reader) (*RDBReader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	rr := &RDBReader{r: br}
+	header := make([]byte, 9)
+	if err := rr.readFull(header); err != nil {
+		return nil, err
+	}
+	if string(header[:5]) != rdbMagic {
+		return nil, ErrRDBInvalid
+	}
+	ver, err := strconv.Atoi(string(header[5:]))
+	if err != nil || ver < 1 || ver > rdbMaxVersion {
+		return nil, fmt.Errorf("unsupported rdb version: %s", header[5:])
+	}
+	rr.version = ver
+	return rr, nil
+}
+
+func (rr *RDBReader) readFull(p []byte) error {
+	_, err := io.ReadFull(rr.r, p)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	rr.crc = rdbCrcUpdate(rr.crc, p)
+	return nil
+}
+
+func (rr *RDBReader) readByte() (byte, error) {
+	if err := rr.readFull(rr.buf[:1]); err != nil {
+		return 0, err
+	}
+	return rr.buf[0], nil
+}
+
+// read the length, the encoded flag will be returned for the special encoded string
+func (rr *RDBReader) readLenEnc() (uint64, bool, error) {
+	b, err := rr.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case rdbLen6Bit:
+		return uint64(b & 0x3f), false, nil
+	case rdbLen14Bit:
+		b2, err := rr.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(b2), false, nil
+	case rdbEncVal:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case rdbLen32Bit:
+		if err := rr.readFull(rr.buf[:4]); err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(rr.buf[:4])), false, nil
+	case rdbLen64Bit:
+		if err := rr.readFull(rr.buf[:8]); err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(rr.buf[:8]), false, nil
+	}
+	return 0, false, ErrRDBInvalid
+}
+
+func (rr *RDBReader) readLen() (uint64, error) {
+	l, enc, err := rr.readLenEnc()
+	if err != nil {
+		return 0, err
+	}
+	if enc {
+		return 0, ErrRDBInvalid
+	}
+	return l, nil
+}
+
+func (rr *RDBReader) readString() ([]byte, error) {
+	l, enc, err := rr.readLenEnc()
+	if err != nil {
+		return nil, err
+	}
+	if !enc {
+		if l > math.MaxInt32 {
+			return nil, ErrRDBInvalid
+		}
+		s := make([]byte, l)
+		err = rr.readFull(s)
+		return s, err
+	}
+	switch l {
+	case rdbEncInt8:
+		b, err := rr.readByte()
+		return []byte(strconv.Itoa(int(int8(b)))), err
+	case rdbEncInt16:
+		if err := rr.readFull(rr.buf[:2]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(rr.buf[:2]))))), nil
+	case rdbEncInt32:
+		if err := rr.readFull(rr.buf[:4]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(rr.buf[:4]))))), nil
+	case rdbEncLZF:
+		clen, err := rr.readLen()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := rr.readLen()
+		if err != nil {
+			return nil, err
+		}
+		if clen > math.MaxInt32 || ulen > math.MaxInt32 {
+			return nil, ErrRDBInvalid
+		}
+		compressed := make([]byte, clen)
+		if err := rr.readFull(compressed); err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(ulen))
+	}
+	return nil, ErrRDBInvalid
+}
+
+func (rr *RDBReader) readDouble() (float64, error) {
+	l, err := rr.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch l {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	s := make([]byte, l)
+	if err := rr.readFull(s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(s), 64)
+}
+
+func (rr *RDBReader) readBinaryDouble() (float64, error) {
+	if err := rr.readFull(rr.buf[:8]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(rr.buf[:8])), nil
+}
+
+func (rr *RDBReader) readStrings(n uint64) ([][]byte, error) {
+	vals := make([][]byte, 0, minLen(n))
+	for i := uint64(0); i < n; i++ {
+		v, err := rr.readString()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// avoid allocating too much memory for the invalid length
+func minLen(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
+
+// Next return the next entry in the rdb file, io.EOF will be returned after all the
+// entries read and the checksum is verified.
+func (rr *RDBReader) Next() (*RDBEntry, error) {
+	var expireAt int64
+	for {
+		op, err := rr.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case rdbOpEOF:
+			if rr.version < 5 {
+				return nil, io.EOF
+			}
+			expected := rr.crc
+			if _, err := io.ReadFull(rr.r, rr.buf[:8]); err != nil {
+				return nil, err
+			}
+			// the checksum is 0 if disabled by rdbchecksum no
+			if sum := binary.LittleEndian.Uint64(rr.buf[:8]); sum != 0 && sum != expected {
+				return nil, ErrRDBChecksumInvalid
+			}
+			return nil, io.EOF
+		case rdbOpSelectDB:
+			db, err := rr.readLen()
+			if err != nil {
+				return nil, err
+			}
+			rr.db = int(db)
+		case rdbOpResizeDB:
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+		case rdbOpSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := rr.readLen(); err != nil {
+					return nil, err
+				}
+			}
+		case rdbOpAux:
+			if _, err := rr.readString(); err != nil {
+				return nil, err
+			}
+			if _, err := rr.readString(); err != nil {
+				return nil, err
+			}
+		case rdbOpFunction2:
+			if _, err := rr.readString(); err != nil {
+				return nil, err
+			}
+		case rdbOpIdle:
+			if _, err := rr.readLen(); err != nil {
+				return nil, err
+			}
+		case rdbOpFreq:
+			if _, err := rr.readByte(); err != nil {
+				return nil, err
+			}
+		case rdbOpExpireMs:
+			if err := rr.readFull(rr.buf[:8]); err != nil {
+				return nil, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(rr.buf[:8]))
+		case rdbOpExpire:
+			if err := rr.readFull(rr.buf[:4]); err != nil {
+				return nil, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(rr.buf[:4])) * 1000
+		case rdbOpFunction, rdbOpModuleAux:
+			return nil, errRDBUnsupportedType
+		default:
+			key, err := rr.readString()
+			if err != nil {
+				return nil, err
+			}
+			e := &RDBEntry{DB: rr.db, Key: key, ExpireAt: expireAt}
+			if err := rr.readValue(op, e); err != nil {
+				return nil, fmt.Errorf("read key %s failed: %v", key, err)
+			}
+			return e, nil
+		}
+	}
+}
+
+func (rr *RDBReader) readValue(tp byte, e *RDBEntry) error {
+	var err error
+	switch tp {
+	case rdbTypeString:
+		e.Type = KV
+		e.Value, err = rr.readString()
+		return err
+	case rdbTypeList, rdbTypeSet:
+		e.Type = LIST
+		if tp == rdbTypeSet {
+			e.Type = SET
+		}
+		n, err := rr.readLen()
+		if err != nil {
+			return err
+		}
+		e.Values, err = rr.readStrings(n)
+		return err
+	case rdbTypeHash:
+		e.Type = HASH
+		n, err := rr.readLen()
+		if err != nil {
+			return err
+		}
+		vals, err := rr.readStrings(n * 2)
+		if err != nil {
+			return err
+		}
+		e.Fields = pairsToKVRecords(vals)
+		return nil
+	case rdbTypeZSet, rdbTypeZSet2:
+		e.Type = ZSET
+		n, err := rr.readLen()
+		if err != nil {
+			return err
+		}
+		e.Members = make([]ScorePair, 0, minLen(n))
+		for i := uint64(0); i < n; i++ {
+			m, err := rr.readString()
+			if err != nil {
+				return err
+			}
+			var score float64
+			if tp == rdbTypeZSet2 {
+				score, err = rr.readBinaryDouble()
+			} else {
+				score, err = rr.readDouble()
+			}
+			if err != nil {
+				return err
+			}
+			e.Members = append(e.Members, ScorePair{Score: score, Member: m})
+		}
+		return nil
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		e.Type = LIST
+		n, err := rr.readLen()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			container := uint64(0)
+			if tp == rdbTypeListQuicklist2 {
+				if container, err = rr.readLen(); err != nil {
+					return err
+				}
+			}
+			data, err := rr.readString()
+			if err != nil {
+				return err
+			}
+			var vals [][]byte
+			switch {
+			case container == quicklistNodePlain:
+				vals = [][]byte{data}
+			case tp == rdbTypeListQuicklist2:
+				vals, err = parseListpack(data)
+			default:
+				vals, err = parseZiplist(data)
+			}
+			if err != nil {
+				return err
+			}
+			e.Values = append(e.Values, vals...)
+		}
+		return nil
+	}
+	// the encoded types stored as a string blob
+	var parse func([]byte) ([][]byte, error)
+	switch tp {
+	case rdbTypeHashZipmap:
+		e.Type, parse = HASH, parseZipmap
+	case rdbTypeListZiplist:
+		e.Type, parse = LIST, parseZiplist
+	case rdbTypeSetIntset:
+		e.Type, parse = SET, parseIntset
+	case rdbTypeZSetZiplist:
+		e.Type, parse = ZSET, parseZiplist
+	case rdbTypeHashZiplist:
+		e.Type, parse = HASH, parseZiplist
+	case rdbTypeHashListpack:
+		e.Type, parse = HASH, parseListpack
+	case rdbTypeZSetListpack:
+		e.Type, parse = ZSET, parseListpack
+	case rdbTypeSetListpack:
+		e.Type, parse = SET, parseListpack
+	default:
+		return errRDBUnsupportedType
+	}
+	blob, err := rr.readString()
+	if err != nil {
+		return err
+	}
+	vals, err := parse(blob)
+	if err != nil {
+		return err
+	}
+	switch e.Type {
+	case LIST, SET:
+		e.Values = vals
+	case HASH:
+		if len(vals)%2 != 0 {
+			return ErrRDBInvalid
+		}
+		e.Fields = pairsToKVRecords(vals)
+	case ZSET:
+		if len(vals)%2 != 0 {
+			return ErrRDBInvalid
+		}
+		e.Members = make([]ScorePair, 0, len(vals)/2)
+		for i := 0; i < len(vals); i += 2 {
+			score, err := strconv.ParseFloat(string(vals[i+1]), 64)
+			if err != nil {
+				return err
+			}
+			e.Members = append(e.Members, ScorePair{Score: score, Member: vals[i]})
+		}
+	}
+	return nil
+}
+
+// ParseRDBDump parse the value serialized by the redis DUMP command, the payload is the
+// value in rdb format followed by the rdb version and the checksum.
+func ParseRDBDump(key []byte, payload []byte) (*RDBEntry, error) {
+	if len(payload) < 11 {
+		return nil, ErrRDBInvalid
+	}
+	body := payload[:len(payload)-8]
+	sum := binary.LittleEndian.Uint64(payload[len(payload)-8:])
+	if sum != 0 && sum != rdbCrcUpdate(0, body) {
+		return nil, ErrRDBChecksumInvalid
+	}
+	ver := int(binary.LittleEndian.Uint16(body[len(body)-2:]))
+	if ver > rdbMaxVersion {
+		return nil, fmt.Errorf("unsupported rdb version: %v", ver)
+	}
+	rr := &RDBReader{r: bufio.NewReader(bytes.NewReader(body[:len(body)-2])), version: ver}
+	tp, err := rr.readByte()
+	if err != nil {
+		return nil, err
+	}
+	e := &RDBEntry{Key: key}
+	if err := rr.readValue(tp, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func pairsToKVRecords(vals [][]byte) []KVRecord {
+	fields := make([]KVRecord, 0, len(vals)/2)
+	for i := 0; i+1 < len(vals); i += 2 {
+		fields = append(fields, KVRecord{Key: vals[i], Value: vals[i+1]})
+	}
+	return fields
+}
+
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	i := 0
+	for i < len(in) {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run
+			ctrl++
+			if i+ctrl > len(in) {
+				return nil, ErrRDBInvalid
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+		// back reference
+		l := ctrl >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, ErrRDBInvalid
+			}
+			l += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrRDBInvalid
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, ErrRDBInvalid
+		}
+		// the reference may overlap the output, so copy byte by byte
+		for j := 0; j < l+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, ErrRDBInvalid
+	}
+	return out, nil
+}
+
+func parseZiplist(data []byte) ([][]byte, error) {
+	if len(data) < 11 {
+		return nil, ErrRDBInvalid
+	}
+	n := int(binary.LittleEndian.Uint16(data[8:10]))
+	vals := make([][]byte, 0, n)
+	pos := 10
+	for pos < len(data) && data[pos] != 0xff {
+		// skip the prev entry length
+		if data[pos] == 0xfe {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, ErrRDBInvalid
+		}
+		enc := data[pos]
+		var v []byte
+		var err error
+		switch enc >> 6 {
+		case 0:
+			v, pos, err = sliceBytes(data, pos+1, int(enc&0x3f))
+		case 1:
+			if pos+1 >= len(data) {
+				return nil, ErrRDBInvalid
+			}
+			v, pos, err = sliceBytes(data, pos+2, int(enc&0x3f)<<8|int(data[pos+1]))
+		case 2:
+			if pos+5 > len(data) {
+				return nil, ErrRDBInvalid
+			}
+			v, pos, err = sliceBytes(data, pos+5, int(binary.BigEndian.Uint32(data[pos+1:pos+5])))
+		default:
+			var iv int64
+			iv, pos, err = parseZiplistInt(data, pos)
+			v = []byte(strconv.FormatInt(iv, 10))
+		}
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+func sliceBytes(data []byte, pos int, l int) ([]byte, int, error) {
+	if l < 0 || pos+l > len(data) {
+		return nil, pos, ErrRDBInvalid
+	}
+	return data[pos : pos+l], pos + l, nil
+}
+
+func parseZiplistInt(data []byte, pos int) (int64, int, error) {
+	enc := data[pos]
+	pos++
+	var size int
+	switch enc {
+	case 0xc0:
+		size = 2
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	case 0xf0:
+		size = 3
+	case 0xfe:
+		size = 1
+	default:
+		if enc >= 0xf1 && enc <= 0xfd {
+			return int64(enc&0x0f) - 1, pos, nil
+		}
+		return 0, pos, ErrRDBInvalid
+	}
+	if pos+size > len(data) {
+		return 0, pos, ErrRDBInvalid
+	}
+	return readLittleEndianInt(data[pos : pos+size]), pos + size, nil
+}
+
+// read the signed little endian integer with any size
+func readLittleEndianInt(b []byte) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	shift := uint(64 - 8*len(b))
+	return int64(v<<shift) >> shift
+}
+
+func parseIntset(data []byte) ([][]byte, error) {
+	if len(data) < 8 {
+		return nil, ErrRDBInvalid
+	}
+	size := int(binary.LittleEndian.Uint32(data[0:4]))
+	n := int(binary.LittleEndian.Uint32(data[4:8]))
+	if (size != 2 && size != 4 && size != 8) || n < 0 || 8+n*size > len(data) {
+		return nil, ErrRDBInvalid
+	}
+	vals := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		pos := 8 + i*size
+		vals = append(vals, []byte(strconv.FormatInt(readLittleEndianInt(data[pos:pos+size]), 10)))
+	}
+	return vals, nil
+}
+
+func parseZipmap(data []byte) ([][]byte, error) {
+	if len(data) < 1 {
+		return nil, ErrRDBInvalid
+	}
+	var vals [][]byte
+	pos := 1
+	readLen := func() (int, error) {
+		if pos >= len(data) {
+			return 0, ErrRDBInvalid
+		}
+		l := int(data[pos])
+		pos++
+		if l < 253 {
+			return l, nil
+		}
+		if l == 253 && pos+4 <= len(data) {
+			l = int(binary.LittleEndian.Uint32(data[pos : pos+4]))
+			pos += 4
+			return l, nil
+		}
+		return 0, ErrRDBInvalid
+	}
+	for pos < len(data) && data[pos] != 0xff {
+		kl, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		k, p, err := sliceBytes(data, pos, kl)
+		if err != nil {
+			return nil, err
+		}
+		pos = p
+		vl, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(data) {
+			return nil, ErrRDBInvalid
+		}
+		free := int(data[pos])
+		v, p, err := sliceBytes(data, pos+1, vl)
+		if err != nil {
+			return nil, err
+		}
+		pos = p + free
+		vals = append(vals, k, v)
+	}
+	return vals, nil
+}
+
+func parseListpack(data []byte) ([][]byte, error) {
+	if len(data) < 7 {
+		return nil, ErrRDBInvalid
+	}
+	var vals [][]byte
+	pos := 6
+	for pos < len(data) && data[pos] != 0xff {
+		start := pos
+		enc := data[pos]
+		var v []byte
+		var err error
+		switch {
+		case enc&0x80 == 0:
+			v = []byte(strconv.Itoa(int(enc & 0x7f)))
+			pos++
+		case enc&0xc0 == 0x80:
+			v, pos, err = sliceBytes(data, pos+1, int(enc&0x3f))
+		case enc&0xe0 == 0xc0:
+			if pos+2 > len(data) {
+				return nil, ErrRDBInvalid
+			}
+			iv := int64(enc&0x1f)<<8 | int64(data[pos+1])
+			if iv >= 1<<12 {
+				iv -= 1 << 13
+			}
+			v = []byte(strconv.FormatInt(iv, 10))
+			pos += 2
+		case enc&0xf0 == 0xe0:
+			if pos+2 > len(data) {
+				return nil, ErrRDBInvalid
+			}
+			v, pos, err = sliceBytes(data, pos+2, int(enc&0x0f)<<8|int(data[pos+1]))
+		case enc == 0xf0:
+			if pos+5 > len(data) {
+				return nil, ErrRDBInvalid
+			}
+			v, pos, err = sliceBytes(data, pos+5, int(binary.LittleEndian.Uint32(data[pos+1:pos+5])))
+		case enc >= 0xf1 && enc <= 0xf4:
+			size := []int{2, 3, 4, 8}[enc-0xf1]
+			if pos+1+size > len(data) {
+				return nil, ErrRDBInvalid
+			}
+			v = []byte(strconv.FormatInt(readLittleEndianInt(data[pos+1:pos+1+size]), 10))
+			pos += 1 + size
+		default:
+			return nil, ErrRDBInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		// skip the back length of the entry
+		pos += listpackBackLenSize(pos - start)
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+func listpackBackLenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// ParseRDBTableMapping parse the mapping from the redis db to the table, such as "0:table1,1:table2"
+func ParseRDBTableMapping(s string) (map[int]string, error) {
+	mapping := make(map[int]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid db table mapping: %v", item)
+		}
+		db, err := strconv.Atoi(kv[0])
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid db in mapping: %v", item)
+		}
+		mapping[db] = kv[1]
+	}
+	if len(mapping) == 0 {
+		return nil, errors.New("empty db table mapping")
+	}
+	return mapping, nil
+}
+
+var (
+	rdbClearCmds = map[DataType]string{
+		HASH: "hclear",
+		LIST: "lclear",
+		SET:  "sclear",
+		ZSET: "zclear",
+	}
+	rdbExpireCmds = map[DataType]string{
+		KV:   "expire",
+		HASH: "hexpire",
+		LIST: "lexpire",
+		SET:  "sexpire",
+		ZSET: "zexpire",
+	}
+)
+
+// GetRemainingTTL return the seconds to expire (rounded up), 0 means no expire and -1 means expired.
+func (e *RDBEntry) GetRemainingTTL(now time.Time) int64 {
+	if e.ExpireAt <= 0 {
+		return 0
+	}
+	ttl := (e.ExpireAt - now.UnixNano()/int64(time.Millisecond) + 999) / 1000
+	if ttl <= 0 {
+		return -1
+	}
+	return ttl
+}
+
+// BuildRDBEntryCommands build the redis write commands (the command name and args) to write
+// the entry to the key, the old data of the key will be cleared at first. The elements in
+// one command will be less than the batch.
+func BuildRDBEntryCommands(key []byte, e *RDBEntry, ttl int64, batch int) ([][][]byte, error) {
+	if batch <= 0 {
+		batch = 100
+	}
+	var cmds [][][]byte
+	if clearCmd, ok := rdbClearCmds[e.Type]; ok {
+		cmds = append(cmds, [][]byte{[]byte(clearCmd), key})
+	}
+	switch e.Type {
+	case KV:
+		cmds = append(cmds, [][]byte{[]byte("set"), key, e.Value})
+	case HASH:
+		for i := 0; i < len(e.Fields); i += batch {
+			args := [][]byte{[]byte("hmset"), key}
+			for _, f := range e.Fields[i:minInt(i+batch, len(e.Fields))] {
+				args = append(args, f.Key, f.Value)
+			}
+			cmds = append(cmds, args)
+		}
+	case LIST, SET:
+		cmd := []byte("rpush")
+		if e.Type == SET {
+			cmd = []byte("sadd")
+		}
+		for i := 0; i < len(e.Values); i += batch {
+			args := append([][]byte{cmd, key}, e.Values[i:minInt(i+batch, len(e.Values))]...)
+			cmds = append(cmds, args)
+		}
+	case ZSET:
+		for i := 0; i < len(e.Members); i += batch {
+			args := [][]byte{[]byte("zadd"), key}
+			for _, m := range e.Members[i:minInt(i+batch, len(e.Members))] {
+				args = append(args, []byte(strconv.FormatFloat(m.Score, 'g', -1, 64)), m.Member)
+			}
+			cmds = append(cmds, args)
+		}
+	default:
+		return nil, errRDBUnsupportedType
+	}
+	if ttl > 0 {
+		cmds = append(cmds, [][]byte{[]byte(rdbExpireCmds[e.Type]), key, []byte(strconv.FormatInt(ttl, 10))})
+	}
+	return cmds, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
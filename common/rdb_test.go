@@ -0,0 +1,239 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRDBCrc64(t *testing.T) {
+	// the check value from the redis crc64 test
+	if crc := rdbCrcUpdate(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("crc64 mismatch: %x", crc)
+	}
+}
+
+func TestRDBWriteRead(t *testing.T) {
+	entries := []*RDBEntry{
+		{DB: 0, Key: []byte("kv"), Type: KV, Value: []byte("value")},
+		{DB: 0, Key: []byte("kv-ttl"), Type: KV, Value: bytes.Repeat([]byte("v"), 20000), ExpireAt: 1600000000000},
+		{DB: 0, Key: []byte("list"), Type: LIST, Values: [][]byte{[]byte("a"), []byte("b"), []byte("")}},
+		{DB: 1, Key: []byte("set"), Type: SET, Values: [][]byte{[]byte("m1"), []byte("m2")}},
+		{DB: 1, Key: []byte("hash"), Type: HASH, Fields: []KVRecord{{Key: []byte("f1"), Value: []byte("v1")}}},
+		{DB: 2, Key: []byte("zset"), Type: ZSET, Members: []ScorePair{{Score: 1.5, Member: []byte("m1")},
+			{Score: math.Inf(-1), Member: []byte("m2")}}},
+	}
+	var buf bytes.Buffer
+	w, err := NewRDBWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := w.WriteEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	r, err := NewRDBReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		re, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, re) {
+			t.Errorf("entry mismatch: %v, %v", e, re)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("should be eof: %v", err)
+	}
+
+	data[20]++
+	r, _ = NewRDBReader(bytes.NewReader(data))
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err != ErrRDBChecksumInvalid {
+		t.Errorf("should be checksum invalid: %v", err)
+	}
+}
+
+func buildTestZiplist(entries [][]byte) []byte {
+	var body []byte
+	for _, e := range entries {
+		body = append(body, 0)
+		body = append(body, e...)
+	}
+	header := make([]byte, 10)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(body)+11))
+	binary.LittleEndian.PutUint16(header[8:10], uint16(len(entries)))
+	return append(append(header, body...), 0xff)
+}
+
+func TestRDBReadEncodedTypes(t *testing.T) {
+	// ziplist with the string, int8, 4bit immediate and int16 entries
+	zl := buildTestZiplist([][]byte{{0x02, 'f', '1'}, {0xfe, 0xff}, {0xf3}, {0xc0, 0x10, 0x27}})
+	vals, err := parseZiplist(zl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, [][]byte{[]byte("f1"), []byte("-1"), []byte("2"), []byte("10000")}) {
+		t.Errorf("ziplist mismatch: %q", vals)
+	}
+
+	intset := []byte{2, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 0x05, 0x00}
+	vals, err = parseIntset(intset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, [][]byte{[]byte("-1"), []byte("5")}) {
+		t.Errorf("intset mismatch: %q", vals)
+	}
+
+	// listpack with the 7bit uint, 6bit string and 13bit negative int entries
+	lp := []byte{0, 0, 0, 0, 3, 0, 0x05, 0x01, 0x82, 'a', 'b', 0x03, 0xdf, 0xff, 0x02, 0xff}
+	vals, err = parseListpack(lp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, [][]byte{[]byte("5"), []byte("ab"), []byte("-1")}) {
+		t.Errorf("listpack mismatch: %q", vals)
+	}
+
+	zm := []byte{1, 2, 'f', '1', 2, 1, 'v', '1', 'x', 0xff}
+	vals, err = parseZipmap(zm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, [][]byte{[]byte("f1"), []byte("v1")}) {
+		t.Errorf("zipmap mismatch: %q", vals)
+	}
+
+	// "aaaaaaaaaa" compressed as the literal 'a' and the back reference
+	out, err := lzfDecompress([]byte{0x00, 'a', 0xe0, 0x00, 0x00}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "aaaaaaaaaa" {
+		t.Errorf("lzf mismatch: %s", out)
+	}
+
+	// the rdb with the ziplist hash and the intset set
+	var rdb bytes.Buffer
+	rdb.WriteString("REDIS0006")
+	rdb.WriteByte(rdbOpSelectDB)
+	rdb.WriteByte(3)
+	rdb.WriteByte(rdbTypeHashZiplist)
+	rdb.WriteByte(1)
+	rdb.WriteByte('h')
+	hzl := buildTestZiplist([][]byte{{0x02, 'f', '1'}, {0xf2}})
+	rdb.WriteByte(byte(len(hzl)))
+	rdb.Write(hzl)
+	rdb.WriteByte(rdbOpExpire)
+	rdb.Write([]byte{100, 0, 0, 0})
+	rdb.WriteByte(rdbTypeSetIntset)
+	rdb.WriteByte(1)
+	rdb.WriteByte('s')
+	rdb.WriteByte(byte(len(intset)))
+	rdb.Write(intset)
+	rdb.WriteByte(rdbOpEOF)
+	// the checksum disabled
+	rdb.Write(make([]byte, 8))
+	r, err := NewRDBReader(&rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &RDBEntry{DB: 3, Key: []byte("h"), Type: HASH, Fields: []KVRecord{{Key: []byte("f1"), Value: []byte("1")}}}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("entry mismatch: %v", e)
+	}
+	e, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = &RDBEntry{DB: 3, Key: []byte("s"), Type: SET, ExpireAt: 100000, Values: [][]byte{[]byte("-1"), []byte("5")}}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("entry mismatch: %v", e)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("should be eof: %v", err)
+	}
+}
+
+func TestBuildRDBEntryCommands(t *testing.T) {
+	now := time.Now()
+	e := &RDBEntry{Key: []byte("z"), Type: ZSET, ExpireAt: now.UnixNano()/int64(time.Millisecond) + 1500,
+		Members: []ScorePair{{Score: 1, Member: []byte("m1")}, {Score: 2.5, Member: []byte("m2")}, {Score: 3, Member: []byte("m3")}}}
+	ttl := e.GetRemainingTTL(now)
+	if ttl != 2 {
+		t.Errorf("ttl should be rounded up: %v", ttl)
+	}
+	cmds, err := BuildRDBEntryCommands([]byte("t:z"), e, ttl, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][][]byte{
+		{[]byte("zclear"), []byte("t:z")},
+		{[]byte("zadd"), []byte("t:z"), []byte("1"), []byte("m1"), []byte("2.5"), []byte("m2")},
+		{[]byte("zadd"), []byte("t:z"), []byte("3"), []byte("m3")},
+		{[]byte("zexpire"), []byte("t:z"), []byte("2")},
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("commands mismatch: %q", cmds)
+	}
+	e = &RDBEntry{Key: []byte("k"), Type: KV, Value: []byte("v"), ExpireAt: 1000}
+	if ttl := e.GetRemainingTTL(now); ttl != -1 {
+		t.Errorf("should be expired: %v", ttl)
+	}
+	cmds, _ = BuildRDBEntryCommands([]byte("t:k"), e, 0, 0)
+	if !reflect.DeepEqual(cmds, [][][]byte{{[]byte("set"), []byte("t:k"), []byte("v")}}) {
+		t.Errorf("commands mismatch: %q", cmds)
+	}
+
+	mapping, err := ParseRDBTableMapping("0:t1, 2:t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mapping, map[int]string{0: "t1", 2: "t2"}) {
+		t.Errorf("mapping mismatch: %v", mapping)
+	}
+	if _, err := ParseRDBTableMapping("a:t1"); err == nil {
+		t.Error("should be invalid mapping")
+	}
+}
+
+func TestParseRDBDump(t *testing.T) {
+	// DUMP of the list [a, b] by redis 7.0 (quicklist2 with the listpack node)
+	lp := []byte{0x0d, 0, 0, 0, 2, 0, 0x81, 'a', 0x02, 0x81, 'b', 0x02, 0xff}
+	body := []byte{rdbTypeListQuicklist2, 1, 2, byte(len(lp))}
+	body = append(body, lp...)
+	body = append(body, 10, 0)
+	sum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sum, rdbCrcUpdate(0, body))
+	e, err := ParseRDBDump([]byte("l"), append(body, sum...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &RDBEntry{Key: []byte("l"), Type: LIST, Values: [][]byte{[]byte("a"), []byte("b")}}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("entry mismatch: %v", e)
+	}
+	sum[0]++
+	if _, err := ParseRDBDump([]byte("l"), append(body, sum...)); err != ErrRDBChecksumInvalid {
+		t.Errorf("should be checksum invalid: %v", err)
+	}
+}
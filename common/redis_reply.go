@@ -0,0 +1,81 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+// the error replies same as the redis, the clients may depend on the exact
+// error string.
+var (
+	ErrRedisSyntax     = errors.New("ERR syntax error")
+	ErrRedisNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrRedisNotFloat   = errors.New("ERR value is not a valid float")
+)
+
+// the redis compatible replies for the internal errors, it should only be
+// registered while init so no lock needed.
+var redisErrReplies = make(map[string]string)
+
+var redisErrEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+// RegisterRedisErrorReply register the redis compatible error reply for the
+// internal error, it should be called in init.
+func RegisterRedisErrorReply(err error, reply string) {
+	redisErrReplies[err.Error()] = reply
+}
+
+// WrongArgsNumError return the redis error reply for the wrong number of
+// the command arguments.
+func WrongArgsNumError(cmd []byte) string {
+	return "ERR wrong number of arguments for '" + strings.ToLower(string(cmd)) + "' command"
+}
+
+// RedisErrorReply convert the error to the redis compatible error reply.
+func RedisErrorReply(err error) string {
+	return RedisErrorString(err.Error())
+}
+
+// RedisErrorString normalize the error reply to be compatible with the redis,
+// the registered errors are replaced with the redis ones and the error without
+// the upper case error code prefix (such as ERR, WRONGTYPE and
+// ERR_CLUSTER_CHANGED) is prefixed with ERR.
+func RedisErrorString(msg string) string {
+	if reply, ok := redisErrReplies[msg]; ok {
+		return reply
+	}
+	msg = redisErrEscaper.Replace(msg)
+	if strings.HasPrefix(msg, "strconv.ParseFloat") {
+		return ErrRedisNotFloat.Error()
+	}
+	if strings.HasPrefix(msg, "strconv.Parse") || strings.HasPrefix(msg, "strconv.Atoi") {
+		return ErrRedisNotInteger.Error()
+	}
+	code := msg
+	if pos := strings.IndexAny(msg, " :"); pos >= 0 {
+		code = msg[:pos]
+	}
+	if isRedisErrorCode(code) {
+		return msg
+	}
+	if strings.EqualFold(code, "err") {
+		msg = strings.TrimLeft(msg[len(code):], " :")
+		if msg == "" {
+			return "ERR"
+		}
+	}
+	return "ERR " + msg
+}
+
+func isRedisErrorCode(code string) bool {
+	if len(code) < 2 || code[0] < 'A' || code[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(code); i++ {
+		c := code[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
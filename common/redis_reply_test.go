@@ -0,0 +1,44 @@
+package common
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestRedisErrorString(t *testing.T) {
+	errTest := errors.New("test registered error")
+	RegisterRedisErrorReply(errTest, "ERR test reply")
+
+	_, parseIntErr := strconv.ParseInt("nan", 10, 64)
+	_, atoiErr := strconv.Atoi("nan")
+	_, parseFloatErr := strconv.ParseFloat("nan1", 64)
+	cases := []struct {
+		msg      string
+		expected string
+	}{
+		{"ERR syntax error", "ERR syntax error"},
+		{"WRONGTYPE Operation against a key holding the wrong kind of value", "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"ERR_CLUSTER_CHANGED: namespace is not found", "ERR_CLUSTER_CHANGED: namespace is not found"},
+		{"NOAUTH Authentication required.", "NOAUTH Authentication required."},
+		{"syntax error", "ERR syntax error"},
+		{"Err: invalid list index", "ERR invalid list index"},
+		{"Err value is not a valid float", "ERR value is not a valid float"},
+		{"Err", "ERR"},
+		{"Invalid response type", "ERR Invalid response type"},
+		{"A lowercase prefix", "ERR A lowercase prefix"},
+		{"invalid\r\nline", "ERR invalid  line"},
+		{errTest.Error(), "ERR test reply"},
+		{parseIntErr.Error(), ErrRedisNotInteger.Error()},
+		{atoiErr.Error(), ErrRedisNotInteger.Error()},
+		{parseFloatErr.Error(), ErrRedisNotFloat.Error()},
+	}
+	for _, c := range cases {
+		if r := RedisErrorString(c.msg); r != c.expected {
+			t.Errorf("error reply for %q should be %q, actual %q", c.msg, c.expected, r)
+		}
+	}
+	if r := WrongArgsNumError([]byte("GETSET")); r != "ERR wrong number of arguments for 'getset' command" {
+		t.Errorf("wrong args reply mismatch: %v", r)
+	}
+}
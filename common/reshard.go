@@ -0,0 +1,24 @@
+package common
+
+// The states of the online partition expansion of the namespace. The keys moving to the
+// new partitions are copied while copying, the writes on the moving keys are rejected
+// while switching until the routing is switched to the new partition number, and the
+// keys moved out are removed from the old partitions while cleaning.
+const (
+	ExpandStateCopying   = "copying"
+	ExpandStateSwitching = "switching"
+	ExpandStateCleaning  = "cleaning"
+)
+
+// PartitionReshardStatus is the status of the data migration running on the leader of the partition
+type PartitionReshardStatus struct {
+	Partition int `json:"partition"`
+	// the expand state the migration is running for
+	State string `json:"state"`
+	// all the keys are copied and the catch-up is done for the state
+	Done        bool   `json:"done"`
+	ScannedKeys int64  `json:"scanned_keys"`
+	MovedKeys   int64  `json:"moved_keys"`
+	PendingKeys int    `json:"pending_keys"`
+	Error       string `json:"error,omitempty"`
+}
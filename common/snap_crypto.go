@@ -0,0 +1,417 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The encrypted snapshot file is split into chunks and each chunk is sealed by AES-GCM:
+//
+//	magic(4) | version(1) | key id len(1) | key id | salt(32) | plain size(8) | chunks...
+//
+// The key for each file is derived from the master key and the salt, and the salt is derived
+// from the file content. So the same file (such as the sst shared by checkpoints) is encrypted
+// to the same data, which allow us to reuse the transferred sst files while syncing snapshot.
+// The header is authenticated as the additional data of each chunk, and the last chunk is marked
+// to detect the truncated file.
+const (
+	snapCryptoVersion   = 1
+	snapCryptoSaltLen   = 32
+	snapCryptoChunkSize = 64 << 10
+	snapCryptoTmpSuffix = ".crypt.tmp"
+)
+
+var snapCryptoMagic = []byte("ZRSE")
+
+var (
+	ErrSnapKeyNotFound    = errors.New("snapshot encryption key not found")
+	ErrSnapKeyMissing     = errors.New("snapshot is encrypted but no key provider configured")
+	errInvalidSnapKey     = errors.New("invalid snapshot encryption key")
+	errSnapCryptoHeader   = errors.New("invalid encrypted snapshot file header")
+	errSnapCryptoTruncate = errors.New("encrypted snapshot file is truncated")
+)
+
+// SnapKeyProvider provide the master keys for the snapshot encryption
+type SnapKeyProvider interface {
+	// CurrentKey return the key id and the key used for encrypting the new snapshot
+	CurrentKey() (string, []byte, error)
+	// GetKey return the key for decrypting, the old keys should be kept after rotated
+	// until all the snapshots encrypted by them are purged.
+	GetKey(id string) ([]byte, error)
+}
+
+type fileSnapKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewFileSnapKeyProvider load the keys from the key file, each line in the file is
+// a key in the format of "id:hex-encoded-key" and the last one is used for encrypting.
+// The key should be 16, 24 or 32 bytes.
+func NewFileSnapKeyProvider(keyFile string) (SnapKeyProvider, error) {
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	kp := &fileSnapKeyProvider{
+		keys: make(map[string][]byte),
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sp := strings.SplitN(line, ":", 2)
+		if len(sp) != 2 || len(sp[0]) == 0 || len(sp[0]) > 255 {
+			return nil, fmt.Errorf("invalid key line in %v: %v", keyFile, sp[0])
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(sp[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %v in %v: %v", sp[0], keyFile, err)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("invalid key %v in %v: %v", sp[0], keyFile, err)
+		}
+		kp.keys[sp[0]] = key
+		kp.currentID = sp[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if kp.currentID == "" {
+		return nil, fmt.Errorf("no key found in %v", keyFile)
+	}
+	return kp, nil
+}
+
+func (kp *fileSnapKeyProvider) CurrentKey() (string, []byte, error) {
+	return kp.currentID, kp.keys[kp.currentID], nil
+}
+
+func (kp *fileSnapKeyProvider) GetKey(id string) ([]byte, error) {
+	key, ok := kp.keys[id]
+	if !ok {
+		return nil, ErrSnapKeyNotFound
+	}
+	return key, nil
+}
+
+type snapCryptoHeader struct {
+	keyID     string
+	salt      []byte
+	plainSize int64
+}
+
+func (h *snapCryptoHeader) marshal() []byte {
+	buf := make([]byte, 0, len(snapCryptoMagic)+2+len(h.keyID)+snapCryptoSaltLen+8)
+	buf = append(buf, snapCryptoMagic...)
+	buf = append(buf, snapCryptoVersion, byte(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = append(buf, h.salt...)
+	var sz [8]byte
+	binary.BigEndian.PutUint64(sz[:], uint64(h.plainSize))
+	return append(buf, sz[:]...)
+}
+
+func readSnapCryptoHeader(r io.Reader) (*snapCryptoHeader, []byte, error) {
+	var prefix [6]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, nil, errSnapCryptoHeader
+	}
+	if !bytes.Equal(prefix[:4], snapCryptoMagic) || prefix[4] != snapCryptoVersion || prefix[5] == 0 {
+		return nil, nil, errSnapCryptoHeader
+	}
+	rest := make([]byte, int(prefix[5])+snapCryptoSaltLen+8)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, errSnapCryptoHeader
+	}
+	h := &snapCryptoHeader{
+		keyID:     string(rest[:prefix[5]]),
+		salt:      rest[prefix[5] : int(prefix[5])+snapCryptoSaltLen],
+		plainSize: int64(binary.BigEndian.Uint64(rest[int(prefix[5])+snapCryptoSaltLen:])),
+	}
+	return h, append(prefix[:], rest...), nil
+}
+
+func newSnapFileCipher(masterKey []byte, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func snapChunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+func snapChunkAD(header []byte, last bool) []byte {
+	ad := make([]byte, len(header)+1)
+	copy(ad, header)
+	if last {
+		ad[len(header)] = 1
+	}
+	return ad
+}
+
+// IsEncryptedSnapFile check whether the file is encrypted by the snapshot encryption
+func IsEncryptedSnapFile(fullPath string) (bool, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(snapCryptoMagic))
+	_, err = io.ReadFull(f, magic)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(magic, snapCryptoMagic), nil
+}
+
+// GetSnapFilePlainSize return the size of the data before encrypted
+func GetSnapFilePlainSize(fullPath string) (int64, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h, _, err := readSnapCryptoHeader(f)
+	if err != nil {
+		return 0, err
+	}
+	return h.plainSize, nil
+}
+
+// write to the tmp file and rename to the destination after all done
+func writeSnapFileAtomic(dst string, fn func(w io.Writer) error) error {
+	tmp := dst + snapCryptoTmpSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(out, snapCryptoChunkSize)
+	err = fn(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// EncryptSnapFile encrypt the src file to dst using the current key, dst can be the same as src.
+func EncryptSnapFile(kp SnapKeyProvider, src string, dst string) error {
+	keyID, key, err := kp.CurrentKey()
+	if err != nil {
+		return err
+	}
+	if len(keyID) == 0 || len(keyID) > 255 {
+		return errInvalidSnapKey
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, in); err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(digest.Sum(nil))
+	h := &snapCryptoHeader{
+		keyID:     keyID,
+		salt:      mac.Sum(nil),
+		plainSize: fi.Size(),
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	aead, err := newSnapFileCipher(key, h.salt)
+	if err != nil {
+		return err
+	}
+	header := h.marshal()
+	return writeSnapFileAtomic(dst, func(w io.Writer) error {
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		buf := make([]byte, snapCryptoChunkSize)
+		var sealed []byte
+		left := h.plainSize
+		for index := uint64(0); ; index++ {
+			n := int64(len(buf))
+			if left < n {
+				n = left
+			}
+			if _, err := io.ReadFull(in, buf[:n]); err != nil {
+				return err
+			}
+			left -= n
+			sealed = aead.Seal(sealed[:0], snapChunkNonce(aead, index), buf[:n], snapChunkAD(header, left == 0))
+			if _, err := w.Write(sealed); err != nil {
+				return err
+			}
+			if left == 0 {
+				return nil
+			}
+		}
+	})
+}
+
+func decryptSnapData(kp SnapKeyProvider, r io.Reader, w io.Writer) error {
+	if kp == nil {
+		return ErrSnapKeyMissing
+	}
+	h, header, err := readSnapCryptoHeader(r)
+	if err != nil {
+		return err
+	}
+	key, err := kp.GetKey(h.keyID)
+	if err != nil {
+		return err
+	}
+	aead, err := newSnapFileCipher(key, h.salt)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, snapCryptoChunkSize+aead.Overhead())
+	var plain []byte
+	left := h.plainSize
+	for index := uint64(0); ; index++ {
+		n := int64(snapCryptoChunkSize)
+		if left < n {
+			n = left
+		}
+		chunk := buf[:int(n)+aead.Overhead()]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return errSnapCryptoTruncate
+		}
+		left -= n
+		plain, err = aead.Open(plain[:0], snapChunkNonce(aead, index), chunk, snapChunkAD(header, left == 0))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if left == 0 {
+			break
+		}
+	}
+	// no more data should be after the last chunk
+	if n, _ := r.Read(buf[:1]); n != 0 {
+		return errSnapCryptoHeader
+	}
+	return nil
+}
+
+// DecryptSnapFile decrypt the src file to dst, the data is authenticated while decrypting.
+func DecryptSnapFile(kp SnapKeyProvider, src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeSnapFileAtomic(dst, func(w io.Writer) error {
+		return decryptSnapData(kp, bufio.NewReaderSize(in, snapCryptoChunkSize), w)
+	})
+}
+
+// VerifySnapFile check the encrypted file can be decrypted without error
+func VerifySnapFile(kp SnapKeyProvider, fullPath string) error {
+	in, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return decryptSnapData(kp, bufio.NewReaderSize(in, snapCryptoChunkSize), ioutil.Discard)
+}
+
+// EncryptSnapDir encrypt all the files in the snapshot dir in place, the files already
+// encrypted will be ignored. The hard linked file will be replaced so the linked
+// source is not changed.
+func EncryptSnapDir(kp SnapKeyProvider, dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if strings.HasSuffix(p, snapCryptoTmpSuffix) {
+			// left by the interrupted encrypting
+			return os.Remove(p)
+		}
+		encrypted, err := IsEncryptedSnapFile(p)
+		if err != nil || encrypted {
+			return err
+		}
+		return EncryptSnapFile(kp, p, p)
+	})
+}
+
+// IsEncryptedSnapDir check whether the snapshot dir has any encrypted file
+func IsEncryptedSnapDir(dir string) (bool, error) {
+	found := false
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || found || !info.Mode().IsRegular() {
+			return err
+		}
+		found, err = IsEncryptedSnapFile(p)
+		return err
+	})
+	return found, err
+}
+
+// VerifySnapDir check all the encrypted files in the snapshot dir
+func VerifySnapDir(kp SnapKeyProvider, dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		encrypted, err := IsEncryptedSnapFile(p)
+		if err != nil || !encrypted {
+			return err
+		}
+		if err := VerifySnapFile(kp, p); err != nil {
+			return fmt.Errorf("verify %v failed: %v", p, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapFileEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snap-crypto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "keys")
+	ioutil.WriteFile(keyFile, []byte("# test keys\nk1:000102030405060708090a0b0c0d0e0f\nk2:"+
+		"000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f\n"), 0600)
+	kp, err := NewFileSnapKeyProvider(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _, _ := kp.CurrentKey(); id != "k2" {
+		t.Fatalf("the last key should be current: %v", id)
+	}
+
+	for _, size := range []int{0, 100, snapCryptoChunkSize, snapCryptoChunkSize*3 + 10} {
+		data := bytes.Repeat([]byte("p"), size)
+		src := filepath.Join(dir, "000001.sst")
+		ioutil.WriteFile(src, data, 0644)
+		enc := filepath.Join(dir, "000001.sst.enc")
+		if err := EncryptSnapFile(kp, src, enc); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := IsEncryptedSnapFile(enc); !ok {
+			t.Fatal("file should be encrypted")
+		}
+		if ok, _ := IsEncryptedSnapFile(src); ok {
+			t.Fatal("file should not be encrypted")
+		}
+		if sz, _ := GetSnapFilePlainSize(enc); sz != int64(size) {
+			t.Errorf("plain size mismatch: %v, %v", sz, size)
+		}
+		encData, _ := ioutil.ReadFile(enc)
+		if size > 0 && bytes.Contains(encData, data) {
+			t.Errorf("the plain data should not be in encrypted file")
+		}
+		// the same data should be encrypted to the same
+		if err := EncryptSnapFile(kp, src, enc+"2"); err != nil {
+			t.Fatal(err)
+		}
+		encData2, _ := ioutil.ReadFile(enc + "2")
+		if !bytes.Equal(encData, encData2) {
+			t.Errorf("the same file should be encrypted to the same data")
+		}
+		dec := filepath.Join(dir, "000001.sst.dec")
+		if err := DecryptSnapFile(kp, enc, dec); err != nil {
+			t.Fatal(err)
+		}
+		d, _ := ioutil.ReadFile(dec)
+		if !bytes.Equal(d, data) {
+			t.Errorf("decrypted data mismatch: %v, %v", len(d), len(data))
+		}
+		if err := VerifySnapFile(kp, enc); err != nil {
+			t.Error(err)
+		}
+		if size > snapCryptoChunkSize {
+			// the truncated or modified file should be detected
+			ioutil.WriteFile(enc+"2", encData[:len(encData)-snapCryptoChunkSize], 0644)
+			if err := VerifySnapFile(kp, enc+"2"); err == nil {
+				t.Error("the truncated file should be invalid")
+			}
+			encData2[len(encData2)-10]++
+			ioutil.WriteFile(enc+"2", encData2, 0644)
+			if err := VerifySnapFile(kp, enc+"2"); err == nil {
+				t.Error("the modified file should be invalid")
+			}
+		}
+	}
+	if err := VerifySnapFile(nil, filepath.Join(dir, "000001.sst.enc")); err != ErrSnapKeyMissing {
+		t.Errorf("should fail without the key: %v", err)
+	}
+}
+
+func TestSnapDirEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snap-crypto-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "keys")
+	ioutil.WriteFile(keyFile, []byte("k1:000102030405060708090a0b0c0d0e0f\n"), 0600)
+	kp, err := NewFileSnapKeyProvider(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "src.sst")
+	ioutil.WriteFile(src, []byte("sst-data"), 0644)
+	ckDir := filepath.Join(dir, "ck")
+	os.MkdirAll(ckDir, DIR_PERM)
+	// the linked source should not be changed
+	os.Link(src, filepath.Join(ckDir, "000001.sst"))
+	ioutil.WriteFile(filepath.Join(ckDir, "MANIFEST"), []byte("manifest"), 0644)
+	if ok, _ := IsEncryptedSnapDir(ckDir); ok {
+		t.Fatal("dir should not be encrypted")
+	}
+	if err := EncryptSnapDir(kp, ckDir); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := IsEncryptedSnapDir(ckDir); !ok {
+		t.Fatal("dir should be encrypted")
+	}
+	d, _ := ioutil.ReadFile(src)
+	if string(d) != "sst-data" {
+		t.Errorf("the linked source changed: %v", string(d))
+	}
+	// encrypt again should be ignored
+	if err := EncryptSnapDir(kp, ckDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySnapDir(kp, ckDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecryptSnapFile(kp, filepath.Join(ckDir, "MANIFEST"), filepath.Join(dir, "MANIFEST")); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = ioutil.ReadFile(filepath.Join(dir, "MANIFEST"))
+	if string(d) != "manifest" {
+		t.Errorf("decrypted data mismatch: %v", string(d))
+	}
+}
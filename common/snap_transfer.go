@@ -0,0 +1,690 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	APISnapFileList = "/snapshot/filelist"
+	APISnapFile     = "/snapshot/file"
+	// the stats and the control (pause, resume, cancel) of the incoming snapshot transfers
+	APISnapTransfer = "/snapshot/transfer"
+	// the same as the rsync bandwidth limit before
+	snapTransferRateLimit = 25 << 20
+	snapTransferBufSize   = 256 << 10
+	snapFileRetry         = 3
+	// the default max concurrent outgoing snapshot files on the source node
+	DefaultSnapMaxOutgoing = 2
+	maxSnapChecksumCache   = 100000
+	snapStagingSuffix      = ".staging"
+)
+
+var (
+	errInvalidSnapPath     = errors.New("invalid snapshot file path")
+	errSnapChecksumInvalid = errors.New("snapshot file checksum mismatch")
+	errSnapSourceBusy      = errors.New("snapshot source is busy")
+	errSnapTransferPaused  = errors.New("snapshot transfer is paused")
+)
+
+var ErrSnapTransferCanceled = errors.New("snapshot transfer is canceled")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapFileInfo is the file info in the snapshot dir, the name is the path relative to the snapshot dir
+type SnapFileInfo struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum uint32 `json:"checksum"`
+}
+
+// SnapTransferStats is the progress of the snapshot transferring from remote
+type SnapTransferStats struct {
+	Remote      string    `json:"remote"`
+	SrcPath     string    `json:"src_path"`
+	DstPath     string    `json:"dst_path"`
+	FileNum     int       `json:"file_num"`
+	TotalSize   int64     `json:"total_size"`
+	Transferred int64     `json:"transferred"`
+	StartTime   time.Time `json:"start_time"`
+	// the size of the files reused from local without transferring
+	Reused int64 `json:"reused"`
+
+	// the name used to pause or cancel the transfer, usually the namespace partition
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+var snapTransferMutex sync.Mutex
+var snapTransfers = make(map[*SnapTransferStats]struct{})
+
+// the paused or canceled transfers by the name, the pause is kept until resumed and the
+// cancel is only for the running transfer.
+var snapTransferPaused = make(map[string]bool)
+var snapTransferCanceled = make(map[string]bool)
+
+// the bandwidth limit shared by all the incoming snapshot transfers
+var snapRecvLimiter = rate.NewLimiter(rate.Limit(snapTransferRateLimit), snapTransferBufSize)
+
+// GetSnapTransferStats return the progress of all the running snapshot transferring
+func GetSnapTransferStats() []SnapTransferStats {
+	snapTransferMutex.Lock()
+	defer snapTransferMutex.Unlock()
+	stats := make([]SnapTransferStats, 0, len(snapTransfers))
+	for s := range snapTransfers {
+		ss := *s
+		ss.Transferred = atomic.LoadInt64(&s.Transferred)
+		ss.Reused = atomic.LoadInt64(&s.Reused)
+		ss.Paused = s.Name != "" && snapTransferPaused[s.Name]
+		stats = append(stats, ss)
+	}
+	return stats
+}
+
+// SetSnapTransferPaused pause or resume the incoming snapshot transfer with the name, the
+// transfer paused before started will wait until resumed. The partial transferred file is
+// kept, so the transfer will continue from where it paused.
+func SetSnapTransferPaused(name string, paused bool) {
+	snapTransferMutex.Lock()
+	if paused {
+		snapTransferPaused[name] = true
+	} else {
+		delete(snapTransferPaused, name)
+	}
+	snapTransferMutex.Unlock()
+}
+
+// CancelSnapTransfer cancel the running incoming snapshot transfer with the name, return
+// false if no such transfer running.
+func CancelSnapTransfer(name string) bool {
+	snapTransferMutex.Lock()
+	defer snapTransferMutex.Unlock()
+	for s := range snapTransfers {
+		if s.Name == name {
+			snapTransferCanceled[name] = true
+			delete(snapTransferPaused, name)
+			return true
+		}
+	}
+	return false
+}
+
+func checkSnapTransferPaused(name string) error {
+	if name == "" {
+		return nil
+	}
+	snapTransferMutex.Lock()
+	defer snapTransferMutex.Unlock()
+	if snapTransferCanceled[name] {
+		return ErrSnapTransferCanceled
+	}
+	if snapTransferPaused[name] {
+		return errSnapTransferPaused
+	}
+	return nil
+}
+
+// wait until the paused transfer resumed
+func waitSnapTransferResumed(ctx context.Context, name string) error {
+	for {
+		err := checkSnapTransferPaused(name)
+		if err != errSnapTransferPaused {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ErrStopped
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// SetSnapRecvBandwidth change the bandwidth limit of all the incoming snapshot transfers,
+// bytesPerSec <= 0 means no limit
+func SetSnapRecvBandwidth(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		snapRecvLimiter.SetLimit(rate.Inf)
+		return
+	}
+	snapRecvLimiter.SetLimit(rate.Limit(bytesPerSec))
+}
+
+// GetSnapRecvBandwidth return the bandwidth limit of the incoming snapshot transfers, 0 for no limit
+func GetSnapRecvBandwidth() int64 {
+	l := snapRecvLimiter.Limit()
+	if l == rate.Inf {
+		return 0
+	}
+	return int64(l)
+}
+
+// SnapSendLimiter limit the concurrent outgoing snapshot files and the total bandwidth
+// on the source node, so the foreground traffic will not be starved by the recovering replica.
+type SnapSendLimiter struct {
+	sem     chan struct{}
+	limiter *rate.Limiter
+	sending int32
+}
+
+// NewSnapSendLimiter create the limiter, bytesPerSec <= 0 means no bandwidth limit
+func NewSnapSendLimiter(maxConcurrent int, bytesPerSec int64) *SnapSendLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultSnapMaxOutgoing
+	}
+	l := &SnapSendLimiter{
+		sem:     make(chan struct{}, maxConcurrent),
+		limiter: rate.NewLimiter(rate.Inf, snapTransferBufSize),
+	}
+	l.SetBandwidth(bytesPerSec)
+	return l
+}
+
+// SetBandwidth change the bandwidth limit of the outgoing snapshot files, bytesPerSec <= 0 means no limit
+func (l *SnapSendLimiter) SetBandwidth(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		l.limiter.SetLimit(rate.Inf)
+		return
+	}
+	l.limiter.SetLimit(rate.Limit(bytesPerSec))
+}
+
+// Bandwidth return the bandwidth limit of the outgoing snapshot files, 0 for no limit
+func (l *SnapSendLimiter) Bandwidth() int64 {
+	lim := l.limiter.Limit()
+	if lim == rate.Inf {
+		return 0
+	}
+	return int64(lim)
+}
+
+// TryAcquire return false if too many outgoing snapshot files, should Release after sent if success
+func (l *SnapSendLimiter) TryAcquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		atomic.AddInt32(&l.sending, 1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *SnapSendLimiter) Release() {
+	atomic.AddInt32(&l.sending, -1)
+	<-l.sem
+}
+
+// Sending return the number of the outgoing snapshot files
+func (l *SnapSendLimiter) Sending() int32 {
+	return atomic.LoadInt32(&l.sending)
+}
+
+// NewWriter wrap the writer with the bandwidth limit
+func (l *SnapSendLimiter) NewWriter(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	if l.limiter.Limit() == rate.Inf {
+		return w
+	}
+	return &throttledWriter{ResponseWriter: w, ctx: ctx, limiter: l.limiter}
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	burst := tw.limiter.Burst()
+	for written < len(p) {
+		n := len(p) - written
+		if n > burst {
+			n = burst
+		}
+		if err := tw.limiter.WaitN(tw.ctx, n); err != nil {
+			return written, err
+		}
+		nw, err := tw.ResponseWriter.Write(p[written : written+n])
+		written += nw
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// GetSnapFilePath return the local full path of the snapshot file requested from remote.
+// The path is the rsync style path which the first element is the module and the module is mapped
+// to the data root.
+func GetSnapFilePath(root string, module string, p string) (string, error) {
+	p = filepath.ToSlash(filepath.Clean("/" + p))
+	p = strings.TrimPrefix(p, "/")
+	if module != "" {
+		if p != module && !strings.HasPrefix(p, module+"/") {
+			return "", errInvalidSnapPath
+		}
+		p = strings.TrimPrefix(p[len(module):], "/")
+	}
+	if p == "" {
+		return "", errInvalidSnapPath
+	}
+	return filepath.Join(root, p), nil
+}
+
+func fileChecksum(fullPath string) (uint32, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.New(crc32cTable)
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// the sst files are immutable and the sst in different checkpoints are hard linked to the same file,
+// so we cache the checksum to avoid reading all the files for each snapshot.
+var snapChecksumMutex sync.Mutex
+var snapChecksumCache = make(map[string]uint32)
+
+func isImmutableSnapFile(name string) bool {
+	return strings.HasSuffix(name, ".sst")
+}
+
+func cachedFileChecksum(p string, info os.FileInfo) (uint32, error) {
+	if !isImmutableSnapFile(info.Name()) {
+		return fileChecksum(p)
+	}
+	key := fmt.Sprintf("%s-%d-%d", info.Name(), info.Size(), info.ModTime().UnixNano())
+	snapChecksumMutex.Lock()
+	sum, ok := snapChecksumCache[key]
+	snapChecksumMutex.Unlock()
+	if ok {
+		return sum, nil
+	}
+	sum, err := fileChecksum(p)
+	if err != nil {
+		return 0, err
+	}
+	snapChecksumMutex.Lock()
+	if len(snapChecksumCache) >= maxSnapChecksumCache {
+		snapChecksumCache = make(map[string]uint32)
+	}
+	snapChecksumCache[key] = sum
+	snapChecksumMutex.Unlock()
+	return sum, nil
+}
+
+// GetSnapFileList list all the files with checksum under the snapshot dir
+func GetSnapFileList(dir string) ([]SnapFileInfo, error) {
+	var files []SnapFileInfo
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sum, err := cachedFileChecksum(p, info)
+		if err != nil {
+			return err
+		}
+		files = append(files, SnapFileInfo{Name: filepath.ToSlash(name), Size: info.Size(), Checksum: sum})
+		return nil
+	})
+	return files, err
+}
+
+func isValidSnapFileName(name string) bool {
+	if name == "" || filepath.IsAbs(name) {
+		return false
+	}
+	for _, e := range strings.Split(name, "/") {
+		if e == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func linkOrCopyFile(src string, dst string) error {
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// reuse the same immutable file in the reference dirs (or the checkpoints under the
+// reference dirs) instead of transferring from remote
+func reuseLocalSnapFile(f SnapFileInfo, local string, refDirs []string) bool {
+	if !isImmutableSnapFile(f.Name) {
+		return false
+	}
+	for _, ref := range refDirs {
+		candidates := []string{filepath.Join(ref, filepath.FromSlash(f.Name))}
+		subs, _ := filepath.Glob(filepath.Join(ref, "*", filepath.FromSlash(f.Name)))
+		candidates = append(candidates, subs...)
+		for _, c := range candidates {
+			if c == local {
+				continue
+			}
+			fi, err := os.Stat(c)
+			if err != nil || fi.IsDir() || fi.Size() != f.Size {
+				continue
+			}
+			sum, err := cachedFileChecksum(c, fi)
+			if err != nil || sum != f.Checksum {
+				continue
+			}
+			if err := linkOrCopyFile(c, local); err != nil {
+				log.Printf("reuse local snapshot file %v failed: %v\n", c, err)
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// runHTTPFileSync transfer the snapshot dir from the remote http api, the partial transferred
+// file will be resumed and the checksum of each file will be verified.
+// The same sst files in the reference dirs will be reused, so only the delta since the
+// previous snapshot need to be transferred.
+func runHTTPFileSync(name string, remote string, srcPath string, dstPath string, refDirs []string, stopCh chan struct{}) error {
+	var files []SnapFileInfo
+	listURI := remote + APISnapFileList + "?path=" + url.QueryEscape(srcPath)
+	// the checksum of the snapshot files may take a while
+	_, err := APIRequest("GET", listURI, nil, time.Minute*5, &files)
+	if err != nil {
+		return err
+	}
+	dstDir := dstPath
+	if filepath.Base(srcPath) != filepath.Base(dstPath) {
+		dstDir = filepath.Join(dstPath, filepath.Base(srcPath))
+	}
+	// transfer into the staging dir and only move it to the destination after all files
+	// verified, so an interrupted transfer never leaves a partial snapshot in the destination.
+	stagingDir := getSnapStagingDir(dstDir)
+	err = os.MkdirAll(filepath.Dir(stagingDir), DIR_PERM)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(stagingDir); os.IsNotExist(err) {
+		// resume from the files already in the destination
+		if _, err := os.Stat(dstDir); err == nil {
+			err = os.Rename(dstDir, stagingDir)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = os.MkdirAll(stagingDir, DIR_PERM)
+	if err != nil {
+		return err
+	}
+	// the other checkpoints beside the destination are also the candidates for reuse
+	refDirs = append([]string{filepath.Dir(dstDir)}, refDirs...)
+	stats := &SnapTransferStats{
+		Remote:    remote,
+		SrcPath:   srcPath,
+		DstPath:   dstDir,
+		FileNum:   len(files),
+		StartTime: time.Now(),
+		Name:      name,
+	}
+	for _, f := range files {
+		stats.TotalSize += f.Size
+	}
+	snapTransferMutex.Lock()
+	snapTransfers[stats] = struct{}{}
+	snapTransferMutex.Unlock()
+	defer func() {
+		snapTransferMutex.Lock()
+		delete(snapTransfers, stats)
+		delete(snapTransferCanceled, name)
+		snapTransferMutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if stopCh != nil {
+		go func() {
+			select {
+			case <-stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	for _, f := range files {
+		if !isValidSnapFileName(f.Name) {
+			return errInvalidSnapPath
+		}
+		local := filepath.Join(stagingDir, filepath.FromSlash(f.Name))
+		err = os.MkdirAll(filepath.Dir(local), DIR_PERM)
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(local); err != nil || fi.Size() != f.Size {
+			if reuseLocalSnapFile(f, local, refDirs) {
+				atomic.AddInt64(&stats.Reused, f.Size)
+			}
+		}
+		for retry := 0; retry < snapFileRetry; {
+			if err = waitSnapTransferResumed(ctx, name); err != nil {
+				break
+			}
+			err = fetchSnapFile(ctx, snapRecvLimiter, remote, srcPath+"/"+f.Name, f, local, stats)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+			if err == errSnapTransferPaused {
+				continue
+			}
+			if err == ErrSnapTransferCanceled {
+				break
+			}
+			if err == errSnapSourceBusy {
+				// wait the source until other transfers done
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			log.Printf("fetch snapshot file %v from %v failed (retried %v): %v\n", f.Name, remote, retry, err)
+			retry++
+		}
+		if ctx.Err() != nil {
+			return ErrStopped
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("snapshot transfer %v from %v progress: %v/%v\n", name, remote,
+			atomic.LoadInt64(&stats.Transferred), stats.TotalSize)
+	}
+	err = removeStaleSnapFiles(stagingDir, files)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dstDir)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(stagingDir, dstDir)
+	if err != nil {
+		return err
+	}
+	// only removed if no other transfer is staging
+	os.Remove(filepath.Dir(stagingDir))
+	log.Printf("snapshot transfer from %v:%v to %v done, reused: %v/%v, cost: %v\n", remote, srcPath, dstDir,
+		atomic.LoadInt64(&stats.Reused), stats.TotalSize, time.Since(stats.StartTime))
+	return nil
+}
+
+// the staging dir is under a separate root beside the destination parent dir, so the
+// partial transfer will never be treated as a checkpoint in the destination parent dir.
+func getSnapStagingDir(dstDir string) string {
+	return filepath.Join(filepath.Dir(dstDir)+snapStagingSuffix, filepath.Base(dstDir))
+}
+
+// remove the files not in the snapshot file list, which may be left by the previous transfer
+func removeStaleSnapFiles(dir string, files []SnapFileInfo) error {
+	valid := make(map[string]bool, len(files))
+	for _, f := range files {
+		valid[filepath.Join(dir, filepath.FromSlash(f.Name))] = true
+	}
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || valid[p] {
+			return nil
+		}
+		log.Printf("remove stale snapshot file: %v\n", p)
+		return os.Remove(p)
+	})
+}
+
+func fetchSnapFile(ctx context.Context, limiter *rate.Limiter, remote string, srcFile string,
+	f SnapFileInfo, local string, stats *SnapTransferStats) (retErr error) {
+	var added int64
+	defer func() {
+		if retErr != nil {
+			// the file will be retried, so we rollback the progress
+			atomic.AddInt64(&stats.Transferred, -added)
+		}
+	}()
+	var offset int64
+	if fi, err := os.Stat(local); err == nil {
+		offset = fi.Size()
+	}
+	if offset > f.Size {
+		offset = 0
+	}
+	if offset == f.Size {
+		sum, err := fileChecksum(local)
+		if err == nil && sum == f.Checksum {
+			atomic.AddInt64(&stats.Transferred, f.Size)
+			added += f.Size
+			return nil
+		}
+		offset = 0
+	}
+	req, err := http.NewRequest("GET", remote+APISnapFile+"?path="+url.QueryEscape(srcFile), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	client := &http.Client{Transport: NewDeadlineTransport(time.Minute)}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the remote ignored the range, transfer from the beginning
+		offset = 0
+	case http.StatusServiceUnavailable:
+		return errSnapSourceBusy
+	default:
+		return fmt.Errorf("fetch snapshot file %v got error response %v", srcFile, rsp.Status)
+	}
+	flag := os.O_WRONLY | os.O_CREATE
+	if offset > 0 {
+		flag |= os.O_APPEND
+	} else {
+		flag |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(local, flag, 0644)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&stats.Transferred, offset)
+	added += offset
+	buf := make([]byte, snapTransferBufSize)
+	for {
+		// the partial file is kept while paused, and continued after resumed
+		if err = checkSnapTransferPaused(stats.Name); err != nil {
+			break
+		}
+		n, rerr := rsp.Body.Read(buf)
+		if n > 0 {
+			if err = limiter.WaitN(ctx, n); err != nil {
+				break
+			}
+			if _, err = file.Write(buf[:n]); err != nil {
+				break
+			}
+			atomic.AddInt64(&stats.Transferred, int64(n))
+			added += int64(n)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		// keep the partial file to resume next time
+		return err
+	}
+	sum, err := fileChecksum(local)
+	if err != nil {
+		return err
+	}
+	if sum != f.Checksum {
+		os.Remove(local)
+		return errSnapChecksumInvalid
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPFileSync(t *testing.T) {
+	root, err := ioutil.TempDir("", "snap-transfer-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dst, err := ioutil.TempDir("", "snap-transfer-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	snapDir := filepath.Join(root, "test-0", "backup", "0000-0001")
+	os.MkdirAll(filepath.Join(snapDir, "sub"), DIR_PERM)
+	data1 := bytes.Repeat([]byte("snapshot-data-1"), 100000)
+	data2 := []byte("snapshot-data-2")
+	ioutil.WriteFile(filepath.Join(snapDir, "000001.sst"), data1, 0644)
+	ioutil.WriteFile(filepath.Join(snapDir, "sub", "MANIFEST"), data2, 0644)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		p, err := GetSnapFilePath(root, "module", req.URL.Query().Get("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files, err := GetSnapFileList(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		p, err := GetSnapFilePath(root, "module", req.URL.Query().Get("path"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, req, p)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	if _, err := GetSnapFilePath(root, "module", "module/../../etc"); err == nil {
+		t.Fatal("path outside the module should be invalid")
+	}
+	// the partial file should be resumed
+	localDir := filepath.Join(dst, "0000-0001")
+	os.MkdirAll(localDir, DIR_PERM)
+	ioutil.WriteFile(filepath.Join(localDir, "000001.sst"), data1[:1000], 0644)
+
+	err = RunFileSync(ts.URL, "module/test-0/backup/0000-0001", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, _ := ioutil.ReadFile(filepath.Join(localDir, "000001.sst"))
+	if !bytes.Equal(d1, data1) {
+		t.Errorf("file data mismatch: %v, %v", len(d1), len(data1))
+	}
+	d2, _ := ioutil.ReadFile(filepath.Join(localDir, "sub", "MANIFEST"))
+	if !bytes.Equal(d2, data2) {
+		t.Errorf("file data mismatch: %v, %v", string(d2), string(data2))
+	}
+	if len(GetSnapTransferStats()) != 0 {
+		t.Errorf("transfer stats should be cleaned after done")
+	}
+
+	// the corrupt file should be transferred again
+	ioutil.WriteFile(filepath.Join(localDir, "sub", "MANIFEST"), []byte("snapshot-data-x"), 0644)
+	err = RunFileSync(ts.URL, "module/test-0/backup/0000-0001", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, _ = ioutil.ReadFile(filepath.Join(localDir, "sub", "MANIFEST"))
+	if !bytes.Equal(d2, data2) {
+		t.Errorf("file data mismatch: %v, %v", string(d2), string(data2))
+	}
+}
+
+func TestSnapSendLimiter(t *testing.T) {
+	l := NewSnapSendLimiter(1, 0)
+	if !l.TryAcquire() {
+		t.Fatal("should acquire")
+	}
+	if l.TryAcquire() {
+		t.Fatal("should not acquire while too many sending")
+	}
+	if l.Sending() != 1 {
+		t.Errorf("sending number not as expected: %v", l.Sending())
+	}
+	l.Release()
+	if !l.TryAcquire() {
+		t.Fatal("should acquire after released")
+	}
+	l.Release()
+
+	root, err := ioutil.TempDir("", "snap-limit-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dst, err := ioutil.TempDir("", "snap-limit-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	data := bytes.Repeat([]byte("d"), 1000)
+	os.MkdirAll(filepath.Join(root, "snap"), DIR_PERM)
+	ioutil.WriteFile(filepath.Join(root, "snap", "000001.sst"), data, 0644)
+
+	l = NewSnapSendLimiter(1, 100000)
+	// hold the only slot at first, the transfer should wait until released
+	l.TryAcquire()
+	busyCnt := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		files, _ := GetSnapFileList(filepath.Join(root, "snap"))
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		if !l.TryAcquire() {
+			busyCnt++
+			if busyCnt > 1 {
+				l.Release()
+			}
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.Release()
+		http.ServeFile(l.NewWriter(req.Context(), w), req, filepath.Join(root, "snap", "000001.sst"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	err = RunFileSync(ts.URL, "snap", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if busyCnt < 2 {
+		t.Errorf("should wait while the source is busy: %v", busyCnt)
+	}
+	d, _ := ioutil.ReadFile(filepath.Join(dst, "snap", "000001.sst"))
+	if !bytes.Equal(d, data) {
+		t.Errorf("file data mismatch: %v, %v", len(d), len(data))
+	}
+}
+
+func TestHTTPFileSyncReuseLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "snap-reuse-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dst, err := ioutil.TempDir("", "snap-reuse-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	sst1 := bytes.Repeat([]byte("sst1"), 1000)
+	sst2 := bytes.Repeat([]byte("sst2"), 1000)
+	os.MkdirAll(filepath.Join(root, "ck1"), DIR_PERM)
+	os.MkdirAll(filepath.Join(root, "ck2"), DIR_PERM)
+	ioutil.WriteFile(filepath.Join(root, "ck1", "000001.sst"), sst1, 0644)
+	ioutil.WriteFile(filepath.Join(root, "ck1", "MANIFEST"), []byte("m1"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "ck2", "000001.sst"), sst1, 0644)
+	ioutil.WriteFile(filepath.Join(root, "ck2", "000002.sst"), sst2, 0644)
+	ioutil.WriteFile(filepath.Join(root, "ck2", "MANIFEST"), []byte("m2"), 0644)
+	// the same name with different data in the reference dir should not be reused
+	refDir := filepath.Join(dst, "ref")
+	os.MkdirAll(refDir, DIR_PERM)
+	ioutil.WriteFile(filepath.Join(refDir, "000002.sst"), sst1, 0644)
+
+	fetched := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		files, _ := GetSnapFileList(filepath.Join(root, req.URL.Query().Get("path")))
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		p := req.URL.Query().Get("path")
+		fetched[p]++
+		http.ServeFile(w, req, filepath.Join(root, p))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	backupDir := filepath.Join(dst, "backup")
+	err = RunIncrementalFileSync(ts.URL, "ck1", backupDir, []string{refDir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RunIncrementalFileSync(ts.URL, "ck2", backupDir, []string{refDir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched["ck2/000001.sst"] != 0 {
+		t.Errorf("the same sst in previous checkpoint should be reused: %v", fetched)
+	}
+	if fetched["ck2/000002.sst"] != 1 || fetched["ck2/MANIFEST"] != 1 {
+		t.Errorf("the changed files should be transferred: %v", fetched)
+	}
+	d, _ := ioutil.ReadFile(filepath.Join(backupDir, "ck2", "000001.sst"))
+	if !bytes.Equal(d, sst1) {
+		t.Errorf("reused file data mismatch")
+	}
+	d, _ = ioutil.ReadFile(filepath.Join(backupDir, "ck2", "000002.sst"))
+	if !bytes.Equal(d, sst2) {
+		t.Errorf("transferred file data mismatch")
+	}
+}
+
+func TestHTTPFileSyncStaging(t *testing.T) {
+	root, err := ioutil.TempDir("", "snap-staging-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dst, err := ioutil.TempDir("", "snap-staging-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	os.MkdirAll(filepath.Join(root, "ck"), DIR_PERM)
+	ioutil.WriteFile(filepath.Join(root, "ck", "000001.sst"), []byte("sst1"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "ck", "MANIFEST"), []byte("m1"), 0644)
+
+	failed := true
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		files, _ := GetSnapFileList(filepath.Join(root, "ck"))
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		p := req.URL.Query().Get("path")
+		if failed && p == "ck/MANIFEST" {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		http.ServeFile(w, req, filepath.Join(root, p))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	localDir := filepath.Join(dst, "ck")
+	err = RunFileSync(ts.URL, "ck", dst, nil)
+	if err == nil {
+		t.Fatal("the transfer should fail")
+	}
+	if _, err := os.Stat(localDir); !os.IsNotExist(err) {
+		t.Fatalf("the failed transfer should not leave the destination: %v", err)
+	}
+	// the stale file in staging should be removed after done
+	ioutil.WriteFile(filepath.Join(getSnapStagingDir(localDir), "000002.sst"), []byte("stale"), 0644)
+	failed = false
+	err = RunFileSync(ts.URL, "ck", dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(getSnapStagingDir(localDir)); !os.IsNotExist(err) {
+		t.Errorf("the staging dir should be moved: %v", err)
+	}
+	// nothing other than the snapshot should be left in the destination
+	names, _ := filepath.Glob(filepath.Join(dst, "*"))
+	if len(names) != 1 || names[0] != localDir {
+		t.Errorf("unexpected files in the destination: %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(localDir, "000002.sst")); !os.IsNotExist(err) {
+		t.Errorf("the stale file should be removed: %v", err)
+	}
+	d, _ := ioutil.ReadFile(filepath.Join(localDir, "MANIFEST"))
+	if string(d) != "m1" {
+		t.Errorf("file data mismatch: %v", string(d))
+	}
+}
+
+func TestHTTPFileSyncPauseCancel(t *testing.T) {
+	root, err := ioutil.TempDir("", "snap-pause-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dst, err := ioutil.TempDir("", "snap-pause-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	data := bytes.Repeat([]byte("d"), 1000)
+	os.MkdirAll(filepath.Join(root, "snap"), DIR_PERM)
+	ioutil.WriteFile(filepath.Join(root, "snap", "000001.sst"), data, 0644)
+
+	fetched := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc(APISnapFileList, func(w http.ResponseWriter, req *http.Request) {
+		files, _ := GetSnapFileList(filepath.Join(root, "snap"))
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc(APISnapFile, func(w http.ResponseWriter, req *http.Request) {
+		fetched++
+		http.ServeFile(w, req, filepath.Join(root, "snap", "000001.sst"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// the transfer paused before started should wait until resumed
+	SetSnapTransferPaused("test-0", true)
+	done := make(chan error, 1)
+	go func() {
+		done <- RunNamedFileSync("test-0", ts.URL, "snap", dst, nil, nil)
+	}()
+	time.Sleep(time.Millisecond * 1500)
+	stats := GetSnapTransferStats()
+	if len(stats) != 1 || !stats[0].Paused || stats[0].Name != "test-0" {
+		t.Fatalf("the transfer should be paused: %v", stats)
+	}
+	if fetched != 0 {
+		t.Errorf("should not fetch while paused: %v", fetched)
+	}
+	SetSnapTransferPaused("test-0", false)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("the transfer should be done after resumed")
+	}
+	d, _ := ioutil.ReadFile(filepath.Join(dst, "snap", "000001.sst"))
+	if !bytes.Equal(d, data) {
+		t.Errorf("file data mismatch: %v, %v", len(d), len(data))
+	}
+
+	if CancelSnapTransfer("test-1") {
+		t.Errorf("should not cancel the transfer not running")
+	}
+	SetSnapTransferPaused("test-1", true)
+	go func() {
+		done <- RunNamedFileSync("test-1", ts.URL, "snap", filepath.Join(dst, "cancel"), nil, nil)
+	}()
+	for i := 0; i < 20 && len(GetSnapTransferStats()) == 0; i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	if !CancelSnapTransfer("test-1") {
+		t.Errorf("should cancel the running transfer")
+	}
+	select {
+	case err := <-done:
+		if err != ErrSnapTransferCanceled {
+			t.Errorf("the transfer should be canceled: %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("the transfer should be done after canceled")
+	}
+	if len(GetSnapTransferStats()) != 0 {
+		t.Errorf("transfer stats should be cleaned after canceled")
+	}
+}
@@ -81,6 +81,103 @@ type NamespaceStats struct {
 	InternalStats     map[string]interface{} `json:"internal_stats"`
 	EngType           string                 `json:"eng_type"`
 	IsLeader          bool                   `json:"is_leader"`
+	// the last applied raft term-index synced from the remote clusters
+	RemoteSyncedStats []LogSyncStats    `json:"remote_synced_stats,omitempty"`
+	ReplicationStats  *ReplicationStats `json:"replication_stats,omitempty"`
+	Quota             *QuotaStats       `json:"quota,omitempty"`
+	RaftLog           *RaftLogStats     `json:"raft_log,omitempty"`
+	Load              *LoadStats        `json:"load,omitempty"`
+	// the namespace is frozen and all the writes are rejected
+	Frozen bool `json:"frozen,omitempty"`
+}
+
+// LoadStats is the approximate data size and write rate of the partition, the
+// placement driver use it to balance the load across the nodes.
+type LoadStats struct {
+	DataBytes int64 `json:"data_bytes"`
+	Keys      int64 `json:"keys"`
+	// the raft logs applied per second in the last check interval
+	WriteQPS int64 `json:"write_qps"`
+}
+
+// RaftLogStats is the retention policy and the size of the raft logs retained by the partition
+type RaftLogStats struct {
+	// 0 means no limit and only the snapshot count is used to truncate the logs
+	RetentionBytes int64 `json:"retention_bytes"`
+	RetentionSecs  int64 `json:"retention_secs"`
+	// the size of the wal files on disk
+	WALBytes int64 `json:"wal_bytes"`
+	// the size of the logs applied since the last snapshot
+	BytesSinceSnapshot int64 `json:"bytes_since_snapshot"`
+	// the unix time in milliseconds of the last snapshot (or the start time if no snapshot since started)
+	LastSnapshotTime int64 `json:"last_snapshot_time"`
+}
+
+// QuotaStats is the quota and the approximate usage of the partition, the
+// quota of the namespace is split evenly to all the partitions.
+type QuotaStats struct {
+	MaxKeys   int64 `json:"max_keys"`
+	MaxBytes  int64 `json:"max_bytes"`
+	UsedKeys  int64 `json:"used_keys"`
+	UsedBytes int64 `json:"used_bytes"`
+	Exceeded  bool  `json:"exceeded"`
+}
+
+// ReplicaProgress is the replication progress of the other replica seen by the leader
+type ReplicaProgress struct {
+	ReplicaID uint64 `json:"replica_id"`
+	NodeID    uint64 `json:"node_id"`
+	IsLearner bool   `json:"is_learner"`
+	// ProgressStateProbe, ProgressStateReplicate or ProgressStateSnapshot
+	State      string `json:"state"`
+	MatchIndex uint64 `json:"match_index"`
+	// the number of committed logs not replicated to the replica yet
+	MatchLag     uint64 `json:"match_lag"`
+	RecentActive bool   `json:"recent_active"`
+	// the index of the snapshot sending to the replica, 0 if no snapshot in flight
+	PendingSnapshot  uint64 `json:"pending_snapshot"`
+	SnapshotInFlight bool   `json:"snapshot_in_flight"`
+	// the unix time in milliseconds of the last message received from the replica
+	LastContact int64 `json:"last_contact"`
+}
+
+// NamespaceHealth is the health status of the namespace partition on the local node
+type NamespaceHealth struct {
+	Name        string `json:"name"`
+	Healthy     bool   `json:"healthy"`
+	Reason      string `json:"reason,omitempty"`
+	HasLeader   bool   `json:"has_leader"`
+	IsLeader    bool   `json:"is_leader"`
+	CommitIndex uint64 `json:"commit_index"`
+	// the gap between the raft committed index and the applied index
+	ApplyGap     uint64 `json:"apply_gap"`
+	AppliedIndex uint64 `json:"applied_index"`
+	// the proposals waiting for the apply result on this node
+	PendingProposals int64 `json:"pending_proposals"`
+	// the unix time in milliseconds of the last applied raft log, 0 if nothing applied since started
+	LastApplyTime int64 `json:"last_apply_time"`
+	// the raft entries skipped and quarantined for the crc mismatch
+	CorruptedEntries int64 `json:"corrupted_entries"`
+	// the partition will be read only if any raft entry failed to apply
+	ApplyError string `json:"apply_error,omitempty"`
+	// the committed logs waiting in the apply queue, and the writes delayed
+	// or rejected by the backpressure since started
+	ApplyBacklog  uint64 `json:"apply_backlog"`
+	WriteDelayed  int64  `json:"write_delayed"`
+	WriteRejected int64  `json:"write_rejected"`
+}
+
+// ReplicationStats is the raft replication status of the local replica, the
+// progress of other replicas is only available on the leader.
+type ReplicationStats struct {
+	ReplicaID    uint64 `json:"replica_id"`
+	LeaderID     uint64 `json:"leader_id"`
+	Term         uint64 `json:"term"`
+	CommitIndex  uint64 `json:"commit_index"`
+	AppliedIndex uint64 `json:"applied_index"`
+	// the number of committed logs not applied to the local state machine yet
+	ApplyLag  uint64            `json:"apply_lag"`
+	Followers []ReplicaProgress `json:"followers,omitempty"`
 }
 
 type LogSyncStats struct {
@@ -89,6 +186,42 @@ type LogSyncStats struct {
 	Index     uint64 `json:"index"`
 	Timestamp int64  `json:"timestamp"`
 	IsLeader  bool   `json:"is_leader"`
+	// the committed index of the raft leader and the lag of synced index in the log syncer
+	CommittedIndex uint64 `json:"committed_index,omitempty"`
+	Lag            uint64 `json:"lag,omitempty"`
+}
+
+// TableChecksum is the checksum of all the data in the table, the data is split into
+// buckets by the key so we can find the different keys by comparing the buckets.
+type TableChecksum struct {
+	Name      string   `json:"name"`
+	Table     string   `json:"table"`
+	RecordNum int64    `json:"record_num"`
+	Buckets   []uint64 `json:"buckets"`
+}
+
+// ReplicaChecksum is the table checksum computed by the replica after applying the raft log
+// at the index, so the checksums from all the replicas at the same index are comparable.
+type ReplicaChecksum struct {
+	ReplicaID uint64         `json:"replica_id"`
+	Table     string         `json:"table"`
+	Index     uint64         `json:"index"`
+	Done      bool           `json:"done"`
+	Error     string         `json:"error,omitempty"`
+	Checksum  *TableChecksum `json:"checksum,omitempty"`
+}
+
+// ConsistencyReport is the result of comparing the table checksums of all the replicas
+type ConsistencyReport struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Index uint64 `json:"index"`
+	// all the replicas finished the checksum at the same index
+	Done       bool              `json:"done"`
+	Consistent bool              `json:"consistent"`
+	Replicas   []ReplicaChecksum `json:"replicas"`
+	// the buckets having the different checksum from the leader
+	DiffBuckets []int `json:"diff_buckets,omitempty"`
 }
 
 type ScanStats struct {
@@ -127,11 +260,19 @@ func (ss *ScanStats) Copy() *ScanStats {
 	return &s
 }
 
+// DiskStats is the capacity and the available space of the disk
+type DiskStats struct {
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
 type ServerStats struct {
 	// database stats
 	NSStats []NamespaceStats `json:"ns_stats"`
 	//scan统计
 	ScanStats *ScanStats `json:"scan_stats"`
+	// the capacity of the disk the data dir is on
+	Disk *DiskStats `json:"disk,omitempty"`
 
 	// other server related stats
 }
@@ -0,0 +1,363 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// The table dump is the portable stream of the labeled records for one table. Each record is
+// the label, the length of the body, the body and the crc32 of the label with the body.
+// The data record is the key of the table (without the table prefix) with all the values,
+// the checkpoint record is the cursor of the exporter to resume from, and the end record
+// means the dump is complete.
+
+const (
+	tableDumpMagic   = "ZANTABLE"
+	tableDumpVersion = 1
+
+	tableDumpData       byte = 1
+	tableDumpCheckpoint byte = 2
+	tableDumpEnd        byte = 3
+
+	maxTableDumpRecordLen = 512 * 1024 * 1024
+)
+
+var (
+	ErrTableDumpInvalid    = errors.New("invalid table dump")
+	ErrTableDumpCorrupted  = errors.New("table dump record corrupted")
+	ErrTableDumpIncomplete = errors.New("table dump is incomplete")
+)
+
+type TableDumpWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewTableDumpWriter create the dump writer for the table, the header will not be written
+// if the table is empty which is used to append to the exist dump.
+func NewTableDumpWriter(w io.Writer, table string) (*TableDumpWriter, error) {
+	tw := &TableDumpWriter{w: bufio.NewWriter(w)}
+	if table == "" {
+		return tw, nil
+	}
+	tw.buf = append(tw.buf, tableDumpMagic...)
+	tw.buf = append(tw.buf, tableDumpVersion)
+	tw.buf = appendDumpBytes(tw.buf, []byte(table))
+	_, err := tw.w.Write(tw.buf)
+	return tw, err
+}
+
+func appendDumpBytes(buf []byte, b []byte) []byte {
+	buf = appendDumpUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendDumpUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func (tw *TableDumpWriter) writeRecord(label byte, body []byte) error {
+	var header [1 + binary.MaxVarintLen64]byte
+	header[0] = label
+	n := binary.PutUvarint(header[1:], uint64(len(body)))
+	crc := crc32.Update(crc32.ChecksumIEEE(header[:1]), crc32.IEEETable, body)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc)
+	if _, err := tw.w.Write(header[:1+n]); err != nil {
+		return err
+	}
+	if _, err := tw.w.Write(body); err != nil {
+		return err
+	}
+	_, err := tw.w.Write(sum[:])
+	return err
+}
+
+// WriteEntry write the key with the values, the db of the entry is ignored.
+func (tw *TableDumpWriter) WriteEntry(e *RDBEntry) error {
+	buf := tw.buf[:0]
+	buf = append(buf, byte(e.Type))
+	buf = appendDumpBytes(buf, e.Key)
+	buf = appendDumpUvarint(buf, uint64(e.ExpireAt))
+	switch e.Type {
+	case KV:
+		buf = appendDumpUvarint(buf, 1)
+		buf = appendDumpBytes(buf, e.Value)
+	case HASH:
+		buf = appendDumpUvarint(buf, uint64(len(e.Fields)))
+		for _, f := range e.Fields {
+			buf = appendDumpBytes(buf, f.Key)
+			buf = appendDumpBytes(buf, f.Value)
+		}
+	case LIST, SET:
+		buf = appendDumpUvarint(buf, uint64(len(e.Values)))
+		for _, v := range e.Values {
+			buf = appendDumpBytes(buf, v)
+		}
+	case ZSET:
+		buf = appendDumpUvarint(buf, uint64(len(e.Members)))
+		var score [8]byte
+		for _, m := range e.Members {
+			buf = appendDumpBytes(buf, m.Member)
+			binary.BigEndian.PutUint64(score[:], math.Float64bits(m.Score))
+			buf = append(buf, score[:]...)
+		}
+	default:
+		return fmt.Errorf("unsupported data type: %v", e.Type)
+	}
+	tw.buf = buf
+	return tw.writeRecord(tableDumpData, buf)
+}
+
+// WriteCheckpoint write the cursor of the exporter and flush all the records before,
+// the dump can be resumed from the last checkpoint.
+func (tw *TableDumpWriter) WriteCheckpoint(cursor []byte) error {
+	if err := tw.writeRecord(tableDumpCheckpoint, cursor); err != nil {
+		return err
+	}
+	return tw.w.Flush()
+}
+
+// Close write the end record with the total number of the keys and flush
+func (tw *TableDumpWriter) Close(total int64) error {
+	if err := tw.writeRecord(tableDumpEnd, appendDumpUvarint(nil, uint64(total))); err != nil {
+		return err
+	}
+	return tw.w.Flush()
+}
+
+type TableDumpReader struct {
+	r          *bufio.Reader
+	table      string
+	offset     int64
+	checkpoint []byte
+	cpOffset   int64
+	total      int64
+	done       bool
+}
+
+// NewTableDumpReader create the reader of the dump with the header
+func NewTableDumpReader(r io.Reader) (*TableDumpReader, error) {
+	tr := &TableDumpReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(tableDumpMagic)+1)
+	if err := tr.readFull(magic); err != nil {
+		return nil, err
+	}
+	if string(magic[:len(tableDumpMagic)]) != tableDumpMagic {
+		return nil, ErrTableDumpInvalid
+	}
+	if magic[len(tableDumpMagic)] != tableDumpVersion {
+		return nil, fmt.Errorf("unsupported table dump version: %v", magic[len(tableDumpMagic)])
+	}
+	l, err := tr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if l > maxTableDumpRecordLen {
+		return nil, ErrTableDumpInvalid
+	}
+	table := make([]byte, l)
+	if err := tr.readFull(table); err != nil {
+		return nil, err
+	}
+	tr.table = string(table)
+	tr.cpOffset = tr.offset
+	return tr, nil
+}
+
+func (tr *TableDumpReader) readFull(p []byte) error {
+	n, err := io.ReadFull(tr.r, p)
+	tr.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTableDumpIncomplete
+	}
+	return err
+}
+
+func (tr *TableDumpReader) readUvarint() (uint64, error) {
+	var v uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := tr.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, ErrTableDumpIncomplete
+			}
+			return 0, err
+		}
+		tr.offset++
+		if b < 0x80 {
+			return v | uint64(b)<<s, nil
+		}
+		v |= uint64(b&0x7f) << s
+		s += 7
+	}
+	return 0, ErrTableDumpInvalid
+}
+
+// Table return the table name of the dump
+func (tr *TableDumpReader) Table() string {
+	return tr.table
+}
+
+// Offset return the bytes read after the last record
+func (tr *TableDumpReader) Offset() int64 {
+	return tr.offset
+}
+
+// Checkpoint return the last cursor with the offset after it, the offset is the end of
+// the header if no checkpoint.
+func (tr *TableDumpReader) Checkpoint() ([]byte, int64) {
+	return tr.checkpoint, tr.cpOffset
+}
+
+// Total return the number of the keys in the end record
+func (tr *TableDumpReader) Total() int64 {
+	return tr.total
+}
+
+// Next return the next data record, io.EOF will be returned after the end record and
+// ErrTableDumpIncomplete will be returned if the dump is ended without the end record.
+func (tr *TableDumpReader) Next() (*RDBEntry, error) {
+	for {
+		if tr.done {
+			return nil, io.EOF
+		}
+		label, err := tr.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrTableDumpIncomplete
+			}
+			return nil, err
+		}
+		tr.offset++
+		l, err := tr.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if l > maxTableDumpRecordLen {
+			return nil, ErrTableDumpCorrupted
+		}
+		body := make([]byte, l+4)
+		if err := tr.readFull(body); err != nil {
+			return nil, err
+		}
+		crc := crc32.Update(crc32.ChecksumIEEE([]byte{label}), crc32.IEEETable, body[:l])
+		if crc != binary.BigEndian.Uint32(body[l:]) {
+			return nil, ErrTableDumpCorrupted
+		}
+		body = body[:l]
+		switch label {
+		case tableDumpData:
+			return decodeTableDumpEntry(body)
+		case tableDumpCheckpoint:
+			tr.checkpoint = body
+			tr.cpOffset = tr.offset
+		case tableDumpEnd:
+			total, n := binary.Uvarint(body)
+			if n <= 0 {
+				return nil, ErrTableDumpCorrupted
+			}
+			tr.total = int64(total)
+			tr.done = true
+		default:
+			return nil, fmt.Errorf("unknown table dump record: %v", label)
+		}
+	}
+}
+
+type dumpDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *dumpDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = ErrTableDumpCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *dumpDecoder) bytes() []byte {
+	l := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < l {
+		d.err = ErrTableDumpCorrupted
+		return nil
+	}
+	b := d.data[:l:l]
+	d.data = d.data[l:]
+	return b
+}
+
+func (d *dumpDecoder) float64() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.err = ErrTableDumpCorrupted
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.data))
+	d.data = d.data[8:]
+	return v
+}
+
+func decodeTableDumpEntry(body []byte) (*RDBEntry, error) {
+	if len(body) == 0 {
+		return nil, ErrTableDumpCorrupted
+	}
+	e := &RDBEntry{Type: DataType(body[0])}
+	d := &dumpDecoder{data: body[1:]}
+	e.Key = d.bytes()
+	e.ExpireAt = int64(d.uvarint())
+	cnt := d.uvarint()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if cnt > uint64(len(d.data)) {
+		return nil, ErrTableDumpCorrupted
+	}
+	switch e.Type {
+	case KV:
+		e.Value = d.bytes()
+	case HASH:
+		e.Fields = make([]KVRecord, 0, cnt)
+		for i := uint64(0); i < cnt && d.err == nil; i++ {
+			f := d.bytes()
+			e.Fields = append(e.Fields, KVRecord{Key: f, Value: d.bytes()})
+		}
+	case LIST, SET:
+		e.Values = make([][]byte, 0, cnt)
+		for i := uint64(0); i < cnt && d.err == nil; i++ {
+			e.Values = append(e.Values, d.bytes())
+		}
+	case ZSET:
+		e.Members = make([]ScorePair, 0, cnt)
+		for i := uint64(0); i < cnt && d.err == nil; i++ {
+			m := d.bytes()
+			e.Members = append(e.Members, ScorePair{Member: m, Score: d.float64()})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data type: %v", e.Type)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return e, nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTableDumpWriteRead(t *testing.T) {
+	entries := []*RDBEntry{
+		{Key: []byte("kv"), Type: KV, Value: []byte("value"), ExpireAt: 1600000000000},
+		{Key: []byte("hash"), Type: HASH, Fields: []KVRecord{{Key: []byte("f1"), Value: []byte("v1")},
+			{Key: []byte("f2"), Value: []byte("")}}},
+		{Key: []byte("list"), Type: LIST, Values: [][]byte{[]byte("a"), []byte("a")}},
+		{Key: []byte("set"), Type: SET, Values: [][]byte{[]byte("m1")}},
+		{Key: []byte("zset"), Type: ZSET, Members: []ScorePair{{Score: -1.5, Member: []byte("m1")},
+			{Score: math.Inf(1), Member: []byte("m2")}}},
+	}
+	var buf bytes.Buffer
+	w, err := NewTableDumpWriter(&buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if err := w.WriteEntry(e); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if err := w.WriteCheckpoint([]byte("cursor")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(int64(len(entries))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	r, err := NewTableDumpReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Table() != "test" {
+		t.Errorf("table mismatch: %v", r.Table())
+	}
+	var cpOffset int64
+	for i, e := range entries {
+		re, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, re) {
+			t.Errorf("entry mismatch: %v, %v", e, re)
+		}
+		if i == 2 {
+			var cp []byte
+			cp, cpOffset = r.Checkpoint()
+			if string(cp) != "cursor" {
+				t.Errorf("checkpoint mismatch: %s", cp)
+			}
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("should be eof: %v", err)
+	}
+	if r.Total() != int64(len(entries)) {
+		t.Errorf("total mismatch: %v", r.Total())
+	}
+
+	// resume from the checkpoint by appending to the truncated dump
+	buf.Truncate(int(cpOffset))
+	w, _ = NewTableDumpWriter(&buf, "")
+	for _, e := range entries[2:] {
+		w.WriteEntry(e)
+	}
+	w.Close(int64(len(entries)))
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("resumed dump mismatch")
+	}
+
+	r, _ = NewTableDumpReader(bytes.NewReader(data[:len(data)-1]))
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err != ErrTableDumpIncomplete {
+		t.Errorf("should be incomplete: %v", err)
+	}
+	corrupted := append([]byte(nil), data...)
+	corrupted[20]++
+	r, _ = NewTableDumpReader(bytes.NewReader(corrupted))
+	err = nil
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err != ErrTableDumpCorrupted {
+		t.Errorf("should be corrupted: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"sort"
+	"strconv"
+)
+
+// the upper bounds of the buckets for the size (in bytes), the elements and the ttl (in
+// seconds) histograms of the table inspection, the last bucket has no upper bound.
+var (
+	InspectSizeBounds     = []int64{64, 256, 1024, 4096, 16384, 65536, 256 * 1024, 1024 * 1024, 16 * 1024 * 1024}
+	InspectElementsBounds = []int64{1, 10, 100, 1000, 10000, 100000, 1000000}
+	InspectTTLBounds      = []int64{60, 3600, 86400, 7 * 86400, 30 * 86400, 365 * 86400}
+)
+
+// InspectHistogram count the values in the buckets split by the bounds
+type InspectHistogram struct {
+	Bounds []int64 `json:"bounds"`
+	// the count of the values not larger than the bound of the bucket, and the last
+	// one is the count of the values larger than all the bounds
+	Counts []int64 `json:"counts"`
+	Total  int64   `json:"total"`
+	Sum    int64   `json:"sum"`
+	Max    int64   `json:"max"`
+}
+
+func NewInspectHistogram(bounds []int64) *InspectHistogram {
+	return &InspectHistogram{
+		Bounds: bounds,
+		Counts: make([]int64, len(bounds)+1),
+	}
+}
+
+func (h *InspectHistogram) Add(v int64) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return v <= h.Bounds[i] })
+	h.Counts[i]++
+	h.Total++
+	h.Sum += v
+	if v > h.Max {
+		h.Max = v
+	}
+}
+
+// Merge add the counts of the other histogram with the same bounds
+func (h *InspectHistogram) Merge(other *InspectHistogram) {
+	if other == nil {
+		return
+	}
+	for i := 0; i < len(h.Counts) && i < len(other.Counts); i++ {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Total += other.Total
+	h.Sum += other.Sum
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+}
+
+func (h *InspectHistogram) Avg() int64 {
+	if h.Total == 0 {
+		return 0
+	}
+	return h.Sum / h.Total
+}
+
+// BucketName return the readable range of the bucket, such as "<=1024" or ">1048576"
+func (h *InspectHistogram) BucketName(i int) string {
+	if i < len(h.Bounds) {
+		return "<=" + strconv.FormatInt(h.Bounds[i], 10)
+	}
+	if len(h.Bounds) == 0 {
+		return "all"
+	}
+	return ">" + strconv.FormatInt(h.Bounds[len(h.Bounds)-1], 10)
+}
+
+// TableInspectStats is the data distribution of the table
+type TableInspectStats struct {
+	Table string `json:"table"`
+	// the number of the keys in each data type
+	Keys      map[string]int64 `json:"keys"`
+	TotalKeys int64            `json:"total_keys"`
+	// the estimated size of the keys, including all the fields and the index entries
+	KeySize *InspectHistogram `json:"key_size"`
+	// the number of the fields or members in the hash, list, set and zset
+	Elements *InspectHistogram `json:"elements"`
+	// the remaining ttl of the keys with the expiration
+	TTL *InspectHistogram `json:"ttl"`
+	// the size and the number of the entries of each kind of the secondary index
+	IndexSize map[string]int64 `json:"index_size"`
+	IndexKeys map[string]int64 `json:"index_keys"`
+}
+
+func NewTableInspectStats(table string) *TableInspectStats {
+	return &TableInspectStats{
+		Table:     table,
+		Keys:      make(map[string]int64),
+		KeySize:   NewInspectHistogram(InspectSizeBounds),
+		Elements:  NewInspectHistogram(InspectElementsBounds),
+		TTL:       NewInspectHistogram(InspectTTLBounds),
+		IndexSize: make(map[string]int64),
+		IndexKeys: make(map[string]int64),
+	}
+}
+
+// Merge add the stats of the same table in other partition
+func (st *TableInspectStats) Merge(other *TableInspectStats) {
+	for t, n := range other.Keys {
+		st.Keys[t] += n
+	}
+	st.TotalKeys += other.TotalKeys
+	st.KeySize.Merge(other.KeySize)
+	st.Elements.Merge(other.Elements)
+	st.TTL.Merge(other.TTL)
+	for name, n := range other.IndexSize {
+		st.IndexSize[name] += n
+	}
+	for name, n := range other.IndexKeys {
+		st.IndexKeys[name] += n
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestInspectHistogram(t *testing.T) {
+	h := NewInspectHistogram([]int64{10, 100})
+	for _, v := range []int64{0, 10, 11, 100, 101, 5000} {
+		h.Add(v)
+	}
+	expected := []int64{2, 2, 2}
+	for i, c := range expected {
+		if h.Counts[i] != c {
+			t.Errorf("bucket %v should be %v, got %v", h.BucketName(i), c, h.Counts[i])
+		}
+	}
+	if h.Total != 6 || h.Max != 5000 || h.Avg() != 5222/6 {
+		t.Errorf("unexpected histogram: %v", h)
+	}
+	if h.BucketName(0) != "<=10" || h.BucketName(2) != ">100" {
+		t.Errorf("unexpected bucket names: %v, %v", h.BucketName(0), h.BucketName(2))
+	}
+
+	st := NewTableInspectStats("test")
+	st.Keys["kv"] = 1
+	st.TotalKeys = 1
+	st.KeySize.Add(100)
+	other := NewTableInspectStats("test")
+	other.Keys["kv"] = 2
+	other.Keys["hash"] = 1
+	other.TotalKeys = 3
+	other.KeySize.Add(2000)
+	other.IndexSize["hash_index"] = 50
+	st.Merge(other)
+	if st.TotalKeys != 4 || st.Keys["kv"] != 3 || st.Keys["hash"] != 1 {
+		t.Errorf("unexpected merged keys: %v", st.Keys)
+	}
+	if st.KeySize.Total != 2 || st.KeySize.Max != 2000 || st.IndexSize["hash_index"] != 50 {
+		t.Errorf("unexpected merged stats: %v", st)
+	}
+}
@@ -2,8 +2,10 @@ package common
 
 import (
 	"container/heap"
+	"encoding/base64"
 	"errors"
 	"math"
+	"sort"
 	"strings"
 
 	"bytes"
@@ -19,6 +21,9 @@ const (
 const (
 	LearnerRoleLogSyncer = "role_log_syncer"
 	LearnerRoleSearcher  = "role_searcher"
+	LearnerRoleKafkaSink = "role_kafka_sink"
+	// the non-voting replica which applies all the data and serves the stale reads
+	LearnerRoleReadReplica = "role_read_replica"
 )
 
 var (
@@ -118,6 +123,88 @@ func StringToExpirationPolicy(s string) (ExpirationPolicy, error) {
 	}
 }
 
+var validCompressions = map[string]bool{
+	"no":     true,
+	"snappy": true,
+	"zlib":   true,
+	"bz2":    true,
+	"lz4":    true,
+	"lz4hc":  true,
+	"zstd":   true,
+}
+
+// RockOptionsOverride is the rocksdb options of the namespace to override the options of the node,
+// the zero value will keep the node options.
+type RockOptionsOverride struct {
+	WriteBufferSize    int    `json:"write_buffer_size,omitempty"`
+	TargetFileSizeBase uint64 `json:"target_file_size_base,omitempty"`
+	// the compression for each level, such as ["no", "no", "snappy", "snappy", "zstd"]
+	CompressionPerLevel []string `json:"compression_per_level,omitempty"`
+	// the total number of the background flushes and compactions
+	MaxBackgroundJobs int `json:"max_background_jobs,omitempty"`
+	// the max concurrently open iterators of the namespace on each node
+	MaxOpenIterators int `json:"max_open_iterators,omitempty"`
+}
+
+func (o *RockOptionsOverride) IsEmpty() bool {
+	return o.WriteBufferSize == 0 && o.TargetFileSizeBase == 0 &&
+		len(o.CompressionPerLevel) == 0 && o.MaxBackgroundJobs == 0 &&
+		o.MaxOpenIterators == 0
+}
+
+func (o *RockOptionsOverride) CheckValid() error {
+	if o.WriteBufferSize < 0 || o.MaxBackgroundJobs < 0 || o.MaxOpenIterators < 0 {
+		return errors.New("invalid rocksdb options")
+	}
+	for _, c := range o.CompressionPerLevel {
+		if !validCompressions[c] {
+			return errors.New("unknown compression type: " + c)
+		}
+	}
+	return nil
+}
+
+// ValueCompressSchema is the value compression config of the table, the value which is
+// not less than the min size will be compressed. Use the compression "no" to disable.
+type ValueCompressSchema struct {
+	Compression  string `json:"compression"`
+	MinValueSize int    `json:"min_value_size"`
+}
+
+func (s *ValueCompressSchema) CheckValid() error {
+	if s.Compression != "no" && s.Compression != "zstd" {
+		return errors.New("unsupported value compression: " + s.Compression)
+	}
+	if s.MinValueSize < 0 {
+		return errors.New("invalid min value size")
+	}
+	return nil
+}
+
+// ZsetScoreIndexSchema is the zset score index config of the table, the index allows
+// searching all the keys having the member with the score in the given range.
+type ZsetScoreIndexSchema struct {
+	Enable bool `json:"enable"`
+}
+
+// FullTextIndexSchema is the full text index on the hash field or the json path of the table,
+// only one of the hash field and json path should be set.
+type FullTextIndexSchema struct {
+	Name      string `json:"name"`
+	HsetField string `json:"hset_field,omitempty"`
+	JSONPath  string `json:"json_path,omitempty"`
+}
+
+func (s *FullTextIndexSchema) CheckValid() error {
+	if s.Name == "" || strings.Contains(s.Name, ":") {
+		return errors.New("invalid full text index name: " + s.Name)
+	}
+	if (s.HsetField == "") == (s.JSONPath == "") {
+		return errors.New("one of the hash field and json path should be set for the full text index")
+	}
+	return nil
+}
+
 type WriteCmd struct {
 	Operation string
 	Args      [][]byte
@@ -266,6 +353,16 @@ func (r *SMCmdRouter) GetInternalCmdHandler(name string) (InternalCommandFunc, b
 	return v, ok
 }
 
+// GetInternalCmdNames return the sorted names of all the registered internal commands
+func (r *SMCmdRouter) GetInternalCmdNames() []string {
+	names := make([]string, 0, len(r.smCmds))
+	for name := range r.smCmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type StringArray []string
 
 func (a *StringArray) Set(s string) error {
@@ -334,6 +431,32 @@ type ScanResult struct {
 	Error      error
 }
 
+// the version byte of the collection scan cursor, so the empty member can be resumed
+// and the format can be changed later.
+const collectionScanCursorV1 = 0x01
+
+// EncodeCollectionScanCursor encode the last examined member of the hash, set or zset
+// as the resume token of the HSCAN, SSCAN and ZSCAN.
+func EncodeCollectionScanCursor(member []byte) []byte {
+	buf := make([]byte, 0, len(member)+1)
+	buf = append(buf, collectionScanCursorV1)
+	buf = append(buf, member...)
+	return []byte(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// DecodeCollectionScanCursor decode the member to resume the scan after, the nil member
+// will be returned for the empty cursor or "0" which means scan from the beginning.
+func DecodeCollectionScanCursor(cursor []byte) ([]byte, error) {
+	if len(cursor) == 0 || (len(cursor) == 1 && cursor[0] == '0') {
+		return nil, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(string(cursor))
+	if err != nil || len(buf) == 0 || buf[0] != collectionScanCursorV1 {
+		return nil, ErrInvalidScanCursor
+	}
+	return buf[1:], nil
+}
+
 type IndexState int32
 
 const (
@@ -348,10 +471,19 @@ const (
 type IndexPropertyDType int32
 
 const (
-	Int64V  IndexPropertyDType = 0
-	Int32V  IndexPropertyDType = 1
-	StringV IndexPropertyDType = 2
-	MaxVT   IndexPropertyDType = 3
+	Int64V   IndexPropertyDType = 0
+	Int32V   IndexPropertyDType = 1
+	StringV  IndexPropertyDType = 2
+	Float64V IndexPropertyDType = 3
+	MaxVT    IndexPropertyDType = 4
+)
+
+const (
+	IndexNotUnique int32 = 0
+	// the write will fail if the value is already indexed by another key
+	IndexUniqueReject int32 = 1
+	// the write will take over the value from the key already indexed
+	IndexUniqueOverwrite int32 = 2
 )
 
 type HsetIndexSchema struct {
@@ -361,10 +493,26 @@ type HsetIndexSchema struct {
 	Unique     int32              `json:"unique"`
 	ValueType  IndexPropertyDType `json:"value_type"`
 	State      IndexState         `json:"state"`
+	// the following fields of the composite index, the index_field is the leading field
+	CompositeFields     []string             `json:"composite_fields,omitempty"`
+	CompositeValueTypes []IndexPropertyDType `json:"composite_value_types,omitempty"`
 }
 
 func (s *HsetIndexSchema) IsValidNewSchema() bool {
-	return s.Name != "" && s.IndexField != "" && s.ValueType < MaxVT && s.State < MaxIndexState
+	if len(s.CompositeFields) > 0 {
+		// the unique check is not supported for the composite index
+		if len(s.CompositeFields) != len(s.CompositeValueTypes) || s.Unique != IndexNotUnique ||
+			strings.Contains(s.IndexField, ",") {
+			return false
+		}
+		for i, f := range s.CompositeFields {
+			if f == "" || f == s.IndexField || strings.Contains(f, ",") || s.CompositeValueTypes[i] >= MaxVT {
+				return false
+			}
+		}
+	}
+	return s.Name != "" && s.IndexField != "" && s.ValueType < MaxVT && s.State < MaxIndexState &&
+		s.Unique >= IndexNotUnique && s.Unique <= IndexUniqueOverwrite
 }
 
 type HIndexRespWithValues struct {
@@ -407,6 +555,12 @@ func (sh SearchResultHeap) Less(i, j int) bool {
 			return bytes.Compare(sh[i].PKey, sh[j].PKey) == -1
 		}
 		return leftV < rightV
+	case float64:
+		rightF := sh[j].IndexV.(float64)
+		if rightF == realV {
+			return bytes.Compare(sh[i].PKey, sh[j].PKey) == -1
+		}
+		return realV < rightF
 	}
 	return false
 }
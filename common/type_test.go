@@ -77,3 +77,38 @@ func TestSortHindexRespForInt(t *testing.T) {
 		lastV = vt
 	}
 }
+
+func TestRockOptionsOverrideCheckValid(t *testing.T) {
+	var o RockOptionsOverride
+	assert.True(t, o.IsEmpty())
+	assert.Nil(t, o.CheckValid())
+	o.WriteBufferSize = 1024 * 1024
+	o.CompressionPerLevel = []string{"no", "snappy", "zstd"}
+	assert.False(t, o.IsEmpty())
+	assert.Nil(t, o.CheckValid())
+	o.CompressionPerLevel = append(o.CompressionPerLevel, "unknown")
+	assert.NotNil(t, o.CheckValid())
+	o.CompressionPerLevel = nil
+	o.MaxBackgroundJobs = -1
+	assert.NotNil(t, o.CheckValid())
+}
+
+func TestCollectionScanCursor(t *testing.T) {
+	for _, c := range [][]byte{[]byte(""), []byte("0")} {
+		m, err := DecodeCollectionScanCursor(c)
+		assert.Nil(t, err)
+		assert.Nil(t, m)
+	}
+	for _, member := range [][]byte{[]byte{}, []byte("0"), []byte("field:1"), []byte{0, 0xff, '\n'}} {
+		cursor := EncodeCollectionScanCursor(member)
+		assert.NotEqual(t, "0", string(cursor))
+		m, err := DecodeCollectionScanCursor(cursor)
+		assert.Nil(t, err)
+		assert.NotNil(t, m)
+		assert.Equal(t, member, m)
+	}
+	_, err := DecodeCollectionScanCursor([]byte("field:1"))
+	assert.Equal(t, ErrInvalidScanCursor, err)
+	_, err = DecodeCollectionScanCursor([]byte("AA"))
+	assert.Equal(t, ErrInvalidScanCursor, err)
+}
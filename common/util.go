@@ -18,10 +18,30 @@ const (
 	APIGetMembers     = "/cluster/members"
 	APIGetLeader      = "/cluster/leader"
 	APICheckBackup    = "/cluster/checkbackup"
+	APILatestBackup   = "/cluster/latestbackup"
+	APIDoBackup       = "/cluster/dobackup"
+	APITableChecksum  = "/kv/checksum"
+	APITableExport    = "/kv/table/export"
 	APIGetIndexes     = "/schema/indexes"
 	APINodeAllReady   = "/node/allready"
+	// the table checksum computed at the raft index by the consistency checker
+	APIReplicaChecksum = "/kv/replica_checksum"
 	// check if the namespace raft node is synced and can be elected as leader immediately
 	APIIsRaftSynced = "/cluster/israftsynced"
+	// get or set the election priority of the namespace raft replica on the node
+	APIElectionPriority = "/raft/election/priority"
+	// get the status of the data migration while expanding the partitions of the namespace
+	APIReshardStatus = "/kv/reshard/status"
+	// unregister the decommissioned node from the cluster after all the data moved out
+	APILeaveCluster = "/cluster/node/leave"
+	// clone the data of the namespace partition from the checkpoint of the source partition
+	APICloneNamespace = "/cluster/namespace/clone"
+	// backup the namespace partition and upload the backup to the target given in the body
+	APIBackupToTarget = "/cluster/backup/target"
+	// upload the local backup of the namespace partition to the remote backup storage
+	APIBackupUpload = "/kv/backup/upload"
+	// list the backups of the namespace partition in the remote backup storage
+	APIRemoteBackups = "/kv/backup/remote"
 
 	// below api for pd
 	APIGetSnapshotSyncInfo = "/pd/snapshot_sync_info"
@@ -174,6 +194,14 @@ func IsMergeIndexSearchCommand(cmd string) bool {
 	return strings.ToLower(cmd) == "hidx.from"
 }
 
+func IsMergeZsetIndexSearchCommand(cmd string) bool {
+	return strings.ToLower(cmd) == "zidx.from"
+}
+
+func IsMergeFullTextSearchCommand(cmd string) bool {
+	return strings.ToLower(cmd) == "ft.search"
+}
+
 func IsMergeKeysCommand(cmd string) bool {
 	lcmd := strings.ToLower(cmd)
 	return lcmd == "plset" || lcmd == "exists" || lcmd == "del"
@@ -188,6 +216,14 @@ func IsMergeCommand(cmd string) bool {
 		return true
 	}
 
+	if IsMergeZsetIndexSearchCommand(cmd) {
+		return true
+	}
+
+	if IsMergeFullTextSearchCommand(cmd) {
+		return true
+	}
+
 	if IsMergeKeysCommand(cmd) {
 		return true
 	}
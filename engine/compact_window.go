@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCompactionWindow = errors.New("invalid compaction window, should be like 01:00-05:30")
+
+// CompactionWindow is the time window in the local time of a day, the window
+// can cross the midnight, such as 22:00-04:00
+type CompactionWindow struct {
+	// minutes from the midnight
+	start int
+	end   int
+}
+
+func parseDayMinute(s string) (int, error) {
+	hm := strings.Split(strings.TrimSpace(s), ":")
+	if len(hm) != 2 {
+		return 0, errInvalidCompactionWindow
+	}
+	h, err := strconv.Atoi(hm[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, errInvalidCompactionWindow
+	}
+	m, err := strconv.Atoi(hm[1])
+	if err != nil || m < 0 || m >= 60 || (h == 24 && m != 0) {
+		return 0, errInvalidCompactionWindow
+	}
+	return h*60 + m, nil
+}
+
+// ParseCompactionWindows parse the windows like ["01:00-05:30", "22:00-23:00"]
+func ParseCompactionWindows(windows []string) ([]CompactionWindow, error) {
+	wl := make([]CompactionWindow, 0, len(windows))
+	for _, w := range windows {
+		se := strings.Split(w, "-")
+		if len(se) != 2 {
+			return nil, errInvalidCompactionWindow
+		}
+		start, err := parseDayMinute(se[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseDayMinute(se[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, errInvalidCompactionWindow
+		}
+		wl = append(wl, CompactionWindow{start: start, end: end})
+	}
+	return wl, nil
+}
+
+func (cw CompactionWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if cw.start < cw.end {
+		return m >= cw.start && m < cw.end
+	}
+	return m >= cw.start || m < cw.end
+}
+
+// IsInCompactionWindows check whether the heavy compaction can be run at the time,
+// always true if no window configured
+func IsInCompactionWindows(windows []CompactionWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,402 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/shirou/gopsutil/mem"
+)
+
+const (
+	RocksDBEngine = "rocksdb"
+	PebbleEngine  = "pebble"
+)
+
+var (
+	errEngineNotOpened       = errors.New("db engine is not opened")
+	errOptionNotMutable      = errors.New("the option can not be changed at runtime")
+	errSetOptionNotSupported = errors.New("set options at runtime is not supported by the engine")
+)
+
+var dbLog = common.NewLevelLogger(common.LOG_INFO, common.NewDefaultLogger("engine"))
+
+func SetLogLevel(level int32) {
+	dbLog.SetLevel(level)
+}
+
+func SetLogger(level int32, logger common.Logger) {
+	dbLog.SetLevel(level)
+	dbLog.Logger = logger
+}
+
+type RockOptions struct {
+	VerifyReadChecksum             bool   `json:"verify_read_checksum"`
+	BlockSize                      int    `json:"block_size"`
+	BlockCache                     int64  `json:"block_cache"`
+	CacheIndexAndFilterBlocks      bool   `json:"cache_index_and_filter_blocks"`
+	WriteBufferSize                int    `json:"write_buffer_size"`
+	MaxWriteBufferNumber           int    `json:"max_write_buffer_number"`
+	MinWriteBufferNumberToMerge    int    `json:"min_write_buffer_number_to_merge"`
+	Level0FileNumCompactionTrigger int    `json:"level0_file_num_compaction_trigger"`
+	MaxBytesForLevelBase           uint64 `json:"max_bytes_for_level_base"`
+	TargetFileSizeBase             uint64 `json:"target_file_size_base"`
+	MaxBackgroundFlushes           int    `json:"max_background_flushes"`
+	MaxBackgroundCompactions       int    `json:"max_background_compactions"`
+	MinLevelToCompress             int    `json:"min_level_to_compress"`
+	MaxMainifestFileSize           uint64 `json:"max_mainifest_file_size"`
+	RateBytesPerSec                int64  `json:"rate_bytes_per_sec"`
+	BackgroundHighThread           int    `json:"background_high_thread,omitempty"`
+	BackgroundLowThread            int    `json:"background_low_thread,omitempty"`
+	AdjustThreadPool               bool   `json:"adjust_thread_pool,omitempty"`
+	UseSharedCache                 bool   `json:"use_shared_cache,omitempty"`
+	UseSharedRateLimiter           bool   `json:"use_shared_rate_limiter,omitempty"`
+	DisableWAL                     bool   `json:"disable_wal,omitempty"`
+	DisableMergeCounter            bool   `json:"disable_merge_counter,omitempty"`
+	// the storage engine for the data, rocksdb (default) or pebble
+	EngineType string `json:"engine_type,omitempty"`
+	// store the different data types in the separate column families for the new created db,
+	// the existing db will keep the column families as it was created
+	UseColumnFamily bool `json:"use_column_family,omitempty"`
+	// the total memory for the block cache and memtables of all the namespaces on the node,
+	// the shared block cache and write buffer will be used if set.
+	MemoryBudget int64 `json:"memory_budget,omitempty"`
+	// the compression for each level, will override the min_level_to_compress if set
+	CompressionPerLevel []string `json:"compression_per_level,omitempty"`
+	// the time windows (such as "01:00-05:30") in the local time allowed to run the heavy
+	// manual compaction, empty means anytime
+	CompactionWindows []string `json:"compaction_windows,omitempty"`
+	// store the large values in the separate blob files, so the values will not be
+	// rewritten while compacting the keys. (only for the default column family of rocksdb)
+	EnableBlobFiles bool `json:"enable_blob_files,omitempty"`
+	// the values not less than the min blob size will be stored in the blob files
+	MinBlobSize  uint64 `json:"min_blob_size,omitempty"`
+	BlobFileSize uint64 `json:"blob_file_size,omitempty"`
+	// relocate the valid values in the old blob files while compacting to reclaim the space
+	EnableBlobGC bool `json:"enable_blob_gc,omitempty"`
+	// the max concurrently open iterators for all the partitions of the namespace, 0 means no limit.
+	// The new iterator will wait at most iterator_wait_ms for the closing of others.
+	MaxOpenIterators int `json:"max_open_iterators,omitempty"`
+	IteratorWaitMs   int `json:"iterator_wait_ms,omitempty"`
+	// the iterator hints for the large scan (such as scan, hgetall and the index search),
+	// the blocks read by the scan will not be filled into the block cache by default.
+	ScanFillCache     bool `json:"scan_fill_cache,omitempty"`
+	ScanReadaheadSize int  `json:"scan_readahead_size,omitempty"`
+}
+
+// ApplyOptionsOverride override the options by the namespace options
+func ApplyOptionsOverride(opts *RockOptions, o common.RockOptionsOverride) {
+	if o.WriteBufferSize > 0 {
+		opts.WriteBufferSize = o.WriteBufferSize
+	}
+	if o.TargetFileSizeBase > 0 {
+		opts.TargetFileSizeBase = o.TargetFileSizeBase
+	}
+	if len(o.CompressionPerLevel) > 0 {
+		opts.CompressionPerLevel = o.CompressionPerLevel
+	}
+	if o.MaxOpenIterators > 0 {
+		opts.MaxOpenIterators = o.MaxOpenIterators
+	}
+	if o.MaxBackgroundJobs > 0 {
+		// the same as the max_background_jobs in rocksdb, 1/4 for the flushes
+		opts.MaxBackgroundFlushes = o.MaxBackgroundJobs / 4
+		if opts.MaxBackgroundFlushes < 1 {
+			opts.MaxBackgroundFlushes = 1
+		}
+		opts.MaxBackgroundCompactions = o.MaxBackgroundJobs - opts.MaxBackgroundFlushes
+		if opts.MaxBackgroundCompactions < 1 {
+			opts.MaxBackgroundCompactions = 1
+		}
+	}
+}
+
+// the memtables of all the namespaces can use 1/4 of the memory budget,
+// and the rest is used by the shared block cache
+func getWriteBufferBudget(opts RockOptions) int64 {
+	return opts.MemoryBudget / 4
+}
+
+func getSharedCacheBudget(opts RockOptions) int64 {
+	return opts.MemoryBudget - getWriteBufferBudget(opts)
+}
+
+func FillDefaultOptions(opts *RockOptions) {
+	// use large block to reduce index block size for hdd
+	// if using ssd, should use the default value
+	if opts.BlockSize <= 0 {
+		// for hdd use 64KB and above
+		// for ssd use 32KB and below
+		opts.BlockSize = 1024 * 32
+	}
+	if opts.MemoryBudget > 0 {
+		opts.UseSharedCache = true
+		opts.BlockCache = getSharedCacheBudget(*opts)
+	}
+	// should about 20% less than host RAM
+	// http://smalldatum.blogspot.com/2016/09/tuning-rocksdb-block-cache.html
+	if opts.BlockCache <= 0 {
+		v, err := mem.VirtualMemory()
+		if err != nil {
+			opts.BlockCache = 1024 * 1024 * 128
+		} else {
+			opts.BlockCache = int64(v.Total / 100)
+			if opts.UseSharedCache {
+				opts.BlockCache *= 10
+			} else {
+				if opts.BlockCache < 1024*1024*64 {
+					opts.BlockCache = 1024 * 1024 * 64
+				} else if opts.BlockCache > 1024*1024*1024*8 {
+					opts.BlockCache = 1024 * 1024 * 1024 * 8
+				}
+			}
+		}
+	}
+	// keep level0_file_num_compaction_trigger * write_buffer_size * min_write_buffer_number_tomerge = max_bytes_for_level_base to minimize write amplification
+	if opts.WriteBufferSize <= 0 {
+		opts.WriteBufferSize = 1024 * 1024 * 64
+	}
+	if opts.MaxWriteBufferNumber <= 0 {
+		opts.MaxWriteBufferNumber = 6
+	}
+	if opts.MinWriteBufferNumberToMerge <= 0 {
+		opts.MinWriteBufferNumberToMerge = 2
+	}
+	if opts.Level0FileNumCompactionTrigger <= 0 {
+		opts.Level0FileNumCompactionTrigger = 2
+	}
+	if opts.MaxBytesForLevelBase <= 0 {
+		opts.MaxBytesForLevelBase = 1024 * 1024 * 256
+	}
+	if opts.TargetFileSizeBase <= 0 {
+		opts.TargetFileSizeBase = 1024 * 1024 * 64
+	}
+	if opts.MaxBackgroundFlushes <= 0 {
+		opts.MaxBackgroundFlushes = 2
+	}
+	if opts.MaxBackgroundCompactions <= 0 {
+		opts.MaxBackgroundCompactions = 4
+	}
+	if opts.MinLevelToCompress <= 0 {
+		opts.MinLevelToCompress = 3
+	}
+	if opts.MaxMainifestFileSize <= 0 {
+		opts.MaxMainifestFileSize = 1024 * 1024 * 32
+	}
+	if opts.AdjustThreadPool {
+		if opts.BackgroundHighThread <= 0 {
+			opts.BackgroundHighThread = 2
+		}
+		if opts.BackgroundLowThread <= 0 {
+			opts.BackgroundLowThread = 4
+		}
+	}
+	if opts.EngineType == "" {
+		opts.EngineType = defaultEngineType
+	}
+	if opts.MaxOpenIterators > 0 && opts.IteratorWaitMs <= 0 {
+		opts.IteratorWaitMs = 1000
+	}
+	if opts.EnableBlobFiles {
+		if opts.MinBlobSize <= 0 {
+			opts.MinBlobSize = 1024 * 4
+		}
+		if opts.BlobFileSize <= 0 {
+			opts.BlobFileSize = 1024 * 1024 * 256
+		}
+	}
+}
+
+// SharedRockConfig is the resources shared by all the engines on the node, such as the block cache.
+type SharedRockConfig interface {
+	Destroy()
+}
+
+// ColumnFamilyOpts describe the column family for the keys prefixed by the key types,
+// the keys of other types will be stored in the default column family.
+type ColumnFamilyOpts struct {
+	Name     string
+	KeyTypes []byte
+	// the fixed prefix length for the prefix seek, 0 to disable
+	PrefixLen int
+	// use the universal compaction instead of the level compaction, it is better for
+	// the data which is written and deleted in order
+	UniversalCompaction bool
+}
+
+type RockEngConfig struct {
+	DataDir string
+	// use the uint64 add merge operator for the counter
+	EnableTableCounter bool
+	SharedConfig       SharedRockConfig
+	// the column families used if the UseColumnFamily is enabled
+	ColumnFamilies []ColumnFamilyOpts
+	// limit the open iterators, shared by all the partitions of the namespace
+	IterLimiter *IteratorLimiter
+	RockOptions
+}
+
+func (cfg *RockEngConfig) getColumnFamily(name string) *ColumnFamilyOpts {
+	for i := range cfg.ColumnFamilies {
+		if cfg.ColumnFamilies[i].Name == name {
+			return &cfg.ColumnFamilies[i]
+		}
+	}
+	return nil
+}
+
+func NewRockConfig() *RockEngConfig {
+	c := &RockEngConfig{
+		EnableTableCounter: true,
+	}
+	FillDefaultOptions(&c.RockOptions)
+	return c
+}
+
+var errColumnFamilyNotFound = errors.New("column family not found")
+
+// CRange is the key range [Start, Limit)
+type CRange struct {
+	Start []byte
+	Limit []byte
+}
+
+// Snapshot is the consistent view of the engine shared by several iterators, the engine
+// can not be closed until the snapshot is released.
+type Snapshot interface {
+	Release()
+}
+
+type IteratorOpts struct {
+	// the lower bound is inclusive and the upper bound is exclusive
+	LowerBound []byte
+	UpperBound []byte
+	WithSnap   bool
+	// iterate on the given snapshot instead of a new one, the WithSnap will be ignored
+	Snapshot Snapshot
+	// the iterator may only see the keys with the same prefix as the seek key
+	PrefixSame bool
+	// may iterate some deleted keys still not compacted
+	IgnoreDel bool
+	// fill the block cache with the blocks read by the iterator, the large scan
+	// should not fill to avoid evicting the hot data from the cache
+	FillCache bool
+	// the readahead size (in bytes) for reading the sst files, it can reduce the io for
+	// the large scan. 0 means the default auto readahead.
+	ReadaheadSize int
+}
+
+type Iterator interface {
+	Next()
+	Prev()
+	Valid() bool
+	Seek([]byte)
+	SeekForPrev([]byte)
+	SeekToFirst()
+	SeekToLast()
+	Close()
+	// the ref key and value are only valid before moving the iterator
+	RefKey() []byte
+	Key() []byte
+	RefValue() []byte
+	Value() []byte
+	Err() error
+}
+
+type WriteBatch interface {
+	Put(key []byte, value []byte)
+	Delete(key []byte)
+	DeleteRange(start []byte, end []byte)
+	// merge the uint64 delta (little endian) to the value
+	Merge(key []byte, delta []byte)
+	Clear()
+	Count() int
+	Destroy()
+}
+
+// KVEngine is the storage engine of the db. The engine can be closed and opened again (such as
+// restoring from the checkpoint), and all the reads should hold the read lock to avoid
+// reading while closing except the NoLock methods.
+type KVEngine interface {
+	OpenEng() error
+	CloseEng()
+	// close the engine and release all the resources, the engine can not be opened again
+	CloseAll()
+	IsOpened() bool
+	RLock()
+	RUnlock()
+	GetDataDir() string
+	NewWriteBatch() WriteBatch
+	Write(wb WriteBatch) error
+	GetBytes(key []byte) ([]byte, error)
+	GetBytesNoLock(key []byte) ([]byte, error)
+	MultiGetBytes(keyList [][]byte, values [][]byte, errs []error)
+	NewIterator(opts IteratorOpts) (Iterator, error)
+	NewSnapshot() (Snapshot, error)
+	GetApproximateSizes(ranges []CRange, includeMem bool) []uint64
+	GetApproximateKeyNum(ranges []CRange) uint64
+	GetProperty(name string) string
+	GetStatistics() string
+	GetInternalStatus() map[string]interface{}
+	CompactRange(rg CRange)
+	// save the consistent checkpoint to the dir, notify will be called after the
+	// checkpoint is started
+	SaveCheckpoint(dir string, notify func()) error
+	// make sure the data in the dir can be opened by the engine
+	CheckDBEngForRead(dir string) error
+	// remove all the data of the key types in the column family
+	DropColumnFamily(name string) error
+	// change the options at runtime, only part of the options can be changed
+	SetOptions(o common.RockOptionsOverride) error
+}
+
+// delete the keys of the types by the range deletion, used if the column families
+// are not separated
+func deleteKeyTypes(eng KVEngine, keyTypes []byte) error {
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	for _, kt := range keyTypes {
+		wb.DeleteRange([]byte{kt}, []byte{kt + 1})
+	}
+	return eng.Write(wb)
+}
+
+type engineCreator func(cfg *RockEngConfig) (KVEngine, error)
+
+var (
+	engineMutex    sync.Mutex
+	engineCreators = make(map[string]engineCreator)
+)
+
+func registerEngine(name string, creator engineCreator) {
+	engineMutex.Lock()
+	engineCreators[name] = creator
+	engineMutex.Unlock()
+}
+
+// IsEngineSupported check if the engine is built in
+func IsEngineSupported(name string) bool {
+	engineMutex.Lock()
+	_, ok := engineCreators[name]
+	engineMutex.Unlock()
+	return ok
+}
+
+// NewKVEng create the engine by the engine type in the config, the engine should
+// be opened before using.
+func NewKVEng(cfg *RockEngConfig) (KVEngine, error) {
+	if cfg.DataDir == "" {
+		return nil, errors.New("config error")
+	}
+	name := cfg.EngineType
+	if name == "" {
+		name = defaultEngineType
+	}
+	engineMutex.Lock()
+	creator, ok := engineCreators[name]
+	engineMutex.Unlock()
+	if !ok {
+		return nil, errors.New("engine not supported: " + name)
+	}
+	return creator(cfg)
+}
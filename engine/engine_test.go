@@ -0,0 +1,588 @@
+package engine
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+func getTestEngines(t *testing.T) []string {
+	engs := make([]string, 0, 2)
+	for _, name := range []string{RocksDBEngine, PebbleEngine} {
+		if IsEngineSupported(name) {
+			engs = append(engs, name)
+		}
+	}
+	return engs
+}
+
+func newTestEng(t *testing.T, name string) KVEngine {
+	dir, err := ioutil.TempDir("", "engine-"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewRockConfig()
+	cfg.DataDir = path.Join(dir, "data")
+	cfg.EngineType = name
+	eng, err := NewKVEng(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eng.OpenEng()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eng
+}
+
+func closeTestEng(eng KVEngine) {
+	eng.CloseAll()
+	os.RemoveAll(path.Dir(eng.GetDataDir()))
+}
+
+func TestNewKVEngUnsupported(t *testing.T) {
+	cfg := NewRockConfig()
+	if _, err := NewKVEng(cfg); err == nil {
+		t.Error("should fail without the data dir")
+	}
+	cfg.DataDir = "/tmp/engine-not-used"
+	cfg.EngineType = "unknown"
+	if _, err := NewKVEng(cfg); err == nil {
+		t.Error("should fail for unknown engine")
+	}
+	if !IsEngineSupported(PebbleEngine) {
+		t.Error("the pebble engine should always be supported")
+	}
+}
+
+func TestEngineWriteBatch(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		eng := newTestEng(t, name)
+		wb := eng.NewWriteBatch()
+		wb.Put([]byte("k1"), []byte("v1"))
+		wb.Put([]byte("k2"), []byte("v2"))
+		wb.Put([]byte("k3"), []byte("v3"))
+		wb.Delete([]byte("k2"))
+		delta := make([]byte, 8)
+		binary.LittleEndian.PutUint64(delta, 2)
+		wb.Merge([]byte("counter"), delta)
+		wb.Merge([]byte("counter"), delta)
+		if wb.Count() != 6 {
+			t.Errorf("%v: batch count mismatch: %v", name, wb.Count())
+		}
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Clear()
+		wb.DeleteRange([]byte("k3"), []byte("k4"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+
+		v, err := eng.GetBytes([]byte("k1"))
+		if err != nil || string(v) != "v1" {
+			t.Errorf("%v: get k1 mismatch: %s, %v", name, v, err)
+		}
+		keys := [][]byte{[]byte("k2"), []byte("k3"), []byte("counter")}
+		values := make([][]byte, len(keys))
+		errs := make([]error, len(keys))
+		eng.MultiGetBytes(keys, values, errs)
+		if values[0] != nil || values[1] != nil || errs[0] != nil || errs[1] != nil {
+			t.Errorf("%v: deleted keys should not exist: %v, %v", name, values, errs)
+		}
+		if errs[2] != nil || binary.LittleEndian.Uint64(values[2]) != 4 {
+			t.Errorf("%v: merged counter mismatch: %v, %v", name, values[2], errs[2])
+		}
+		closeTestEng(eng)
+	}
+}
+
+func TestEngineIterator(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		eng := newTestEng(t, name)
+		wb := eng.NewWriteBatch()
+		for _, k := range []string{"a:1", "a:3", "a:5", "b:1"} {
+			wb.Put([]byte(k), []byte(k))
+		}
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+
+		it, err := eng.NewIterator(IteratorOpts{
+			LowerBound: []byte("a:"),
+			UpperBound: []byte("a;"),
+			WithSnap:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the write after the snapshot should not be seen
+		wb = eng.NewWriteBatch()
+		wb.Put([]byte("a:2"), []byte("a:2"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		var keys []string
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		if len(keys) != 3 || keys[0] != "a:1" || keys[2] != "a:5" {
+			t.Errorf("%v: iterator keys mismatch: %v", name, keys)
+		}
+		it.SeekForPrev([]byte("a:4"))
+		if !it.Valid() || string(it.RefKey()) != "a:3" {
+			t.Errorf("%v: seek for prev mismatch", name)
+		}
+		it.SeekForPrev([]byte("a:5"))
+		if !it.Valid() || string(it.Value()) != "a:5" {
+			t.Errorf("%v: seek for prev mismatch", name)
+		}
+		it.SeekToLast()
+		if !it.Valid() || string(it.Key()) != "a:5" {
+			t.Errorf("%v: seek to last mismatch", name)
+		}
+		it.Seek([]byte("a:4"))
+		it.Prev()
+		if !it.Valid() || string(it.Key()) != "a:3" {
+			t.Errorf("%v: prev mismatch", name)
+		}
+		if it.Err() != nil {
+			t.Error(it.Err())
+		}
+		it.Close()
+
+		// the cache hints should not change the iterated data
+		it, err = eng.NewIterator(IteratorOpts{
+			LowerBound:    []byte("a:"),
+			UpperBound:    []byte("a;"),
+			FillCache:     true,
+			ReadaheadSize: 1024 * 1024 * 2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = keys[:0]
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		if len(keys) != 4 || keys[1] != "a:2" {
+			t.Errorf("%v: iterator keys with readahead mismatch: %v", name, keys)
+		}
+		it.Close()
+		closeTestEng(eng)
+	}
+}
+
+func TestEngineCheckpoint(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		eng := newTestEng(t, name)
+		wb := eng.NewWriteBatch()
+		wb.Put([]byte("k1"), []byte("v1"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		eng.CompactRange(CRange{})
+
+		ckDir := path.Join(path.Dir(eng.GetDataDir()), "checkpoint")
+		notified := make(chan struct{})
+		err := eng.SaveCheckpoint(ckDir, func() {
+			close(notified)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-notified
+		if err := eng.CheckDBEngForRead(ckDir); err != nil {
+			t.Errorf("%v: checkpoint should be opened: %v", name, err)
+		}
+
+		eng.CloseEng()
+		if eng.IsOpened() {
+			t.Errorf("%v: should be closed", name)
+		}
+		if err := eng.SaveCheckpoint(ckDir+".new", nil); err == nil {
+			t.Errorf("%v: checkpoint should fail while closed", name)
+		}
+		if err := eng.OpenEng(); err != nil {
+			t.Fatal(err)
+		}
+		v, err := eng.GetBytes([]byte("k1"))
+		if err != nil || string(v) != "v1" {
+			t.Errorf("%v: get after reopen mismatch: %s, %v", name, v, err)
+		}
+		closeTestEng(eng)
+	}
+}
+
+func TestEngineColumnFamily(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		dir, err := ioutil.TempDir("", "engine-cf-"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := NewRockConfig()
+		cfg.DataDir = path.Join(dir, "data")
+		cfg.EngineType = name
+		cfg.UseColumnFamily = true
+		cfg.ColumnFamilies = []ColumnFamilyOpts{
+			{Name: "cf1", KeyTypes: []byte{1, 2}, PrefixLen: 3},
+			{Name: "cf2", KeyTypes: []byte{3}, UniversalCompaction: true},
+		}
+		eng, err := NewKVEng(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.OpenEng(); err != nil {
+			t.Fatal(err)
+		}
+		keys := [][]byte{[]byte{0, 'a'}, []byte{1, 'a'}, []byte{2, 'a'}, []byte{3, 'a'}, []byte{3, 'b'}}
+		wb := eng.NewWriteBatch()
+		for _, k := range keys {
+			wb.Put(k, k)
+		}
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		for _, k := range keys {
+			v, err := eng.GetBytes(k)
+			if err != nil || string(v) != string(k) {
+				t.Errorf("%v: get %v mismatch: %v, %v", name, k, v, err)
+			}
+		}
+		// the keys in different column families, and the values share the slice with keys
+		mkeys := [][]byte{[]byte{3, 'b'}, []byte{0, 'a'}, []byte{1, 'x'}, []byte{2, 'a'}}
+		expected := [][]byte{[]byte{3, 'b'}, []byte{0, 'a'}, nil, []byte{2, 'a'}}
+		errs := make([]error, len(mkeys))
+		eng.MultiGetBytes(mkeys, mkeys, errs)
+		for i, v := range mkeys {
+			if errs[i] != nil || string(v) != string(expected[i]) {
+				t.Errorf("%v: multi get %v mismatch: %v, %v", name, expected[i], v, errs[i])
+			}
+		}
+		it, err := eng.NewIterator(IteratorOpts{LowerBound: []byte{3}, UpperBound: []byte{4}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cnt := 0
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			cnt++
+		}
+		it.Close()
+		if cnt != 2 {
+			t.Errorf("%v: iterator count mismatch: %v", name, cnt)
+		}
+
+		if err := eng.DropColumnFamily("cf1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.DropColumnFamily("unknown"); err == nil {
+			t.Errorf("%v: drop unknown column family should fail", name)
+		}
+		// reopen to make sure the column families are kept
+		eng.CloseEng()
+		if err := eng.OpenEng(); err != nil {
+			t.Fatal(err)
+		}
+		for i, k := range keys {
+			v, err := eng.GetBytes(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (i == 1 || i == 2) && v != nil {
+				t.Errorf("%v: the dropped key %v should not exist", name, k)
+			} else if i != 1 && i != 2 && string(v) != string(k) {
+				t.Errorf("%v: get %v mismatch after drop: %v", name, k, v)
+			}
+		}
+		eng.CloseAll()
+		os.RemoveAll(dir)
+	}
+}
+
+type testMemTableFlusher struct {
+	size    int64
+	flushed int
+}
+
+func (f *testMemTableFlusher) memTableSize() int64 {
+	return f.size
+}
+
+func (f *testMemTableFlusher) flushMemTable() error {
+	f.flushed++
+	f.size = 0
+	return nil
+}
+
+func TestWriteBufferManager(t *testing.T) {
+	wbm := &writeBufferManager{
+		budget: 100,
+		engs:   make(map[memTableFlusher]struct{}),
+	}
+	f1 := &testMemTableFlusher{size: 30}
+	f2 := &testMemTableFlusher{size: 60}
+	wbm.register(f1)
+	wbm.register(f2)
+	if total := wbm.checkOnce(); total != 90 || f1.flushed != 0 || f2.flushed != 0 {
+		t.Errorf("should not flush under the budget: %v", total)
+	}
+	f1.size = 50
+	if total := wbm.checkOnce(); total != 110 || f1.flushed != 0 || f2.flushed != 1 {
+		t.Errorf("the largest should be flushed: %v, %v, %v", total, f1.flushed, f2.flushed)
+	}
+	wbm.unregister(f1)
+	f1.size = 200
+	if total := wbm.checkOnce(); total != 0 || f1.flushed != 0 {
+		t.Errorf("the unregistered engine should be ignored: %v", total)
+	}
+
+	opts := RockOptions{MemoryBudget: 1024 * 1024 * 1024}
+	FillDefaultOptions(&opts)
+	if !opts.UseSharedCache || opts.BlockCache != 1024*1024*768 {
+		t.Errorf("the shared cache should use the memory budget: %v", opts.BlockCache)
+	}
+}
+
+func TestEngineSetOptions(t *testing.T) {
+	var opts RockOptions
+	ApplyOptionsOverride(&opts, common.RockOptionsOverride{
+		WriteBufferSize:     1024 * 1024,
+		TargetFileSizeBase:  1024 * 1024 * 2,
+		CompressionPerLevel: []string{"no", "snappy"},
+		MaxBackgroundJobs:   8,
+	})
+	FillDefaultOptions(&opts)
+	if opts.WriteBufferSize != 1024*1024 || opts.TargetFileSizeBase != 1024*1024*2 {
+		t.Errorf("the options should be overridden: %v", opts)
+	}
+	if opts.MaxBackgroundFlushes != 2 || opts.MaxBackgroundCompactions != 6 {
+		t.Errorf("the background jobs mismatch: %v, %v", opts.MaxBackgroundFlushes, opts.MaxBackgroundCompactions)
+	}
+
+	for _, name := range getTestEngines(t) {
+		eng := newTestEng(t, name)
+		err := eng.SetOptions(common.RockOptionsOverride{WriteBufferSize: 1024 * 1024 * 2})
+		if name == PebbleEngine {
+			if err == nil {
+				t.Errorf("%v: set options should not be supported", name)
+			}
+		} else if err != nil {
+			t.Errorf("%v: set options failed: %v", name, err)
+		}
+		if err := eng.SetOptions(common.RockOptionsOverride{MaxBackgroundJobs: 4}); err == nil {
+			t.Errorf("%v: the background jobs should not be changed at runtime", name)
+		}
+		closeTestEng(eng)
+	}
+}
+
+func TestEngineIteratorLimiter(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		limiter := NewIteratorLimiter(2, time.Millisecond*100)
+		dir, err := ioutil.TempDir("", "engine-"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := NewRockConfig()
+		cfg.DataDir = path.Join(dir, "data")
+		cfg.EngineType = name
+		cfg.IterLimiter = limiter
+		eng, err := NewKVEng(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.OpenEng(); err != nil {
+			t.Fatal(err)
+		}
+		it1, err := eng.NewIterator(IteratorOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		it2, err := eng.NewIterator(IteratorOpts{WithSnap: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := eng.NewIterator(IteratorOpts{}); err != errTooManyOpenIterators {
+			t.Errorf("%v: should fail while too many iterators: %v", name, err)
+		}
+		// the waiting iterator should be opened after any iterator closed
+		done := make(chan error, 1)
+		go func() {
+			it, err := eng.NewIterator(IteratorOpts{})
+			if err == nil {
+				it.Close()
+			}
+			done <- err
+		}()
+		time.Sleep(time.Millisecond * 10)
+		it1.Close()
+		if err := <-done; err != nil {
+			t.Errorf("%v: the waiting iterator should be opened: %v", name, err)
+		}
+		it2.Close()
+		stats := limiter.Stats()
+		if stats["open-iterators"] != 0 || stats["rejected-iterators"] != int64(1) {
+			t.Errorf("%v: the limiter stats mismatch: %v", name, stats)
+		}
+		closeTestEng(eng)
+	}
+}
+
+func TestCompactionWindows(t *testing.T) {
+	for _, w := range [][]string{{"01:00"}, {"25:00-02:00"}, {"01:60-02:00"}, {"01:00-01:00"}, {"a:00-02:00"}} {
+		if _, err := ParseCompactionWindows(w); err == nil {
+			t.Errorf("the window %v should be invalid", w)
+		}
+	}
+	wl, err := ParseCompactionWindows([]string{"01:00-05:30", "22:00-00:30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local)
+	cases := map[string]bool{
+		"00:00": true,
+		"00:30": false,
+		"01:00": true,
+		"05:29": true,
+		"05:30": false,
+		"12:00": false,
+		"22:00": true,
+		"23:59": true,
+	}
+	for hm, in := range cases {
+		m, _ := parseDayMinute(hm)
+		tm := day.Add(time.Duration(m) * time.Minute)
+		if IsInCompactionWindows(wl, tm) != in {
+			t.Errorf("the time %v in window should be %v", hm, in)
+		}
+	}
+	if !IsInCompactionWindows(nil, day) {
+		t.Error("should always be in window if no window")
+	}
+}
+
+func TestEngineBlobFiles(t *testing.T) {
+	opts := RockOptions{EnableBlobFiles: true}
+	FillDefaultOptions(&opts)
+	if opts.MinBlobSize == 0 || opts.BlobFileSize == 0 {
+		t.Errorf("the blob options should be filled: %v", opts)
+	}
+
+	for _, name := range getTestEngines(t) {
+		dir, err := ioutil.TempDir("", "engine-"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := NewRockConfig()
+		cfg.DataDir = path.Join(dir, "data")
+		cfg.EngineType = name
+		cfg.EnableBlobFiles = true
+		cfg.MinBlobSize = 64
+		eng, err := NewKVEng(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.OpenEng(); err != nil {
+			t.Fatal(err)
+		}
+		bigV := make([]byte, 1024)
+		for i := range bigV {
+			bigV[i] = byte(i)
+		}
+		wb := eng.NewWriteBatch()
+		wb.Put([]byte("big"), bigV)
+		wb.Put([]byte("small"), []byte("v"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		eng.CompactRange(CRange{})
+		if v, err := eng.GetBytes([]byte("big")); err != nil || string(v) != string(bigV) {
+			t.Errorf("%v: the big value mismatch: %v", name, err)
+		}
+		if v, err := eng.GetBytes([]byte("small")); err != nil || string(v) != "v" {
+			t.Errorf("%v: the small value mismatch: %v, %v", name, string(v), err)
+		}
+		closeTestEng(eng)
+	}
+}
+
+func TestParseRockLevelStats(t *testing.T) {
+	levelStats := "Level Files Size(MB)\n--------------------\n  0        1        0\n  1        3       12\n"
+	stats := mergeRockLevelStats(nil, levelStats)
+	stats = mergeRockLevelStats(stats, "Level Files Size(MB)\n--------------------\n  0        2        1\n  2        1        4\n")
+	if len(stats) != 3 {
+		t.Fatalf("the level stats mismatch: %v", stats)
+	}
+	if stats[0].NumFiles != 3 || stats[0].Size != 1024*1024 {
+		t.Errorf("the level 0 stats mismatch: %v", stats[0])
+	}
+	if stats[1].NumFiles != 3 || stats[1].Size != 12*1024*1024 {
+		t.Errorf("the level 1 stats mismatch: %v", stats[1])
+	}
+	if stats[2].Level != 2 || stats[2].NumFiles != 1 {
+		t.Errorf("the level 2 stats mismatch: %v", stats[2])
+	}
+
+	s := "rocksdb.block.cache.miss COUNT : 10\nrocksdb.stall.micros COUNT : 123\n"
+	if n := getRockStatisticsTicker(s, "rocksdb.stall.micros"); n != 123 {
+		t.Errorf("the ticker mismatch: %v", n)
+	}
+	if n := getRockStatisticsTicker(s, "rocksdb.not.exist"); n != 0 {
+		t.Errorf("the ticker should be 0: %v", n)
+	}
+}
+
+func TestEngineSharedSnapshot(t *testing.T) {
+	for _, name := range getTestEngines(t) {
+		eng := newTestEng(t, name)
+		wb := eng.NewWriteBatch()
+		wb.Put([]byte{1, 1}, []byte("v1"))
+		wb.Put([]byte{2, 1}, []byte("v1"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := eng.NewSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wb.Clear()
+		wb.Put([]byte{1, 2}, []byte("v2"))
+		wb.Put([]byte{2, 2}, []byte("v2"))
+		if err := eng.Write(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		// all the iterators on the shared snapshot should not see the new writes
+		for _, prefix := range []byte{1, 2} {
+			it, err := eng.NewIterator(IteratorOpts{
+				LowerBound: []byte{prefix},
+				UpperBound: []byte{prefix + 1},
+				Snapshot:   snap,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cnt := 0
+			for it.SeekToFirst(); it.Valid(); it.Next() {
+				cnt++
+			}
+			it.Close()
+			if cnt != 1 {
+				t.Errorf("%v: the snapshot iterator should only see 1 key, got %v", name, cnt)
+			}
+		}
+		snap.Release()
+		closeTestEng(eng)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var errTooManyOpenIterators = errors.New("too many open iterators, try again later")
+
+// IteratorLimiter is the pool of the iterator slots which limit the concurrently open
+// iterators, since the open iterator will pin the old sst files and hold the file
+// descriptors. The new iterator will wait in the queue until any iterator is closed,
+// and fail if waiting timeout. It can be shared by the engines of the namespace partitions.
+type IteratorLimiter struct {
+	slots       chan struct{}
+	waitTimeout time.Duration
+	waiting     int32
+	rejected    int64
+}
+
+// NewIteratorLimiter create the limiter allowing at most limit iterators opened
+func NewIteratorLimiter(limit int, waitTimeout time.Duration) *IteratorLimiter {
+	return &IteratorLimiter{
+		slots:       make(chan struct{}, limit),
+		waitTimeout: waitTimeout,
+	}
+}
+
+func (l *IteratorLimiter) acquire() error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	atomic.AddInt32(&l.waiting, 1)
+	defer atomic.AddInt32(&l.waiting, -1)
+	t := time.NewTimer(l.waitTimeout)
+	defer t.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		atomic.AddInt64(&l.rejected, 1)
+		return errTooManyOpenIterators
+	}
+}
+
+func (l *IteratorLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+func (l *IteratorLimiter) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"open-iterators":     len(l.slots),
+		"max-open-iterators": cap(l.slots),
+		"waiting-iterators":  atomic.LoadInt32(&l.waiting),
+		"rejected-iterators": atomic.LoadInt64(&l.rejected),
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// LevelStats is the files and size of the level in the lsm tree
+type LevelStats struct {
+	Level    int   `json:"level"`
+	NumFiles int64 `json:"num_files"`
+	Size     int64 `json:"size"`
+}
+
+// parse the rocksdb.levelstats property and merge into the stats, the property is like
+//
+//	Level Files Size(MB)
+//	--------------------
+//	  0        1        0
+//	  1        3       12
+func mergeRockLevelStats(stats []LevelStats, levelStats string) []LevelStats {
+	scanner := bufio.NewScanner(strings.NewReader(levelStats))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		level, err := strconv.Atoi(fields[0])
+		if err != nil || level < 0 {
+			continue
+		}
+		files, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizeMB, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		for len(stats) <= level {
+			stats = append(stats, LevelStats{Level: len(stats)})
+		}
+		stats[level].NumFiles += files
+		stats[level].Size += int64(sizeMB * 1024 * 1024)
+	}
+	return stats
+}
+
+// get the ticker count from the rocksdb statistics string, the ticker is like
+// "rocksdb.stall.micros COUNT : 100"
+func getRockStatisticsTicker(stats string, name string) int64 {
+	scanner := bufio.NewScanner(strings.NewReader(stats))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[1] == "COUNT" {
+			n, _ := strconv.ParseInt(fields[3], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,585 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+)
+
+func init() {
+	registerEngine(PebbleEngine, newPebbleEng)
+}
+
+var (
+	sharedCacheMutex  sync.Mutex
+	sharedPebbleCache *pebble.Cache
+)
+
+// all the pebble engines on the node will share the block cache if the shared cache enabled
+func getSharedPebbleCache(size int64) *pebble.Cache {
+	sharedCacheMutex.Lock()
+	defer sharedCacheMutex.Unlock()
+	if sharedPebbleCache == nil {
+		sharedPebbleCache = pebble.NewCache(size)
+	}
+	sharedPebbleCache.Ref()
+	return sharedPebbleCache
+}
+
+// the same as the uint64add merge operator in rocksdb, the invalid value will be
+// treated as 0
+var uint64AddMerger = &pebble.Merger{
+	Merge: func(key, value []byte) (pebble.ValueMerger, error) {
+		m := &uint64AddValueMerger{}
+		m.add(value)
+		return m, nil
+	},
+	Name: "uint64add",
+}
+
+type uint64AddValueMerger struct {
+	v uint64
+}
+
+func (m *uint64AddValueMerger) add(value []byte) {
+	if len(value) != 8 {
+		return
+	}
+	m.v += binary.LittleEndian.Uint64(value)
+}
+
+func (m *uint64AddValueMerger) MergeNewer(value []byte) error {
+	m.add(value)
+	return nil
+}
+
+func (m *uint64AddValueMerger) MergeOlder(value []byte) error {
+	m.add(value)
+	return nil
+}
+
+func (m *uint64AddValueMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, m.v)
+	return b, nil, nil
+}
+
+type pebbleEng struct {
+	sync.RWMutex
+	cfg    *RockEngConfig
+	eng    *pebble.DB
+	opts   *pebble.Options
+	wo     *pebble.WriteOptions
+	cache  *pebble.Cache
+	opened bool
+	wbm    *writeBufferManager
+}
+
+func newPebbleEng(cfg *RockEngConfig) (KVEngine, error) {
+	var cache *pebble.Cache
+	if cfg.UseSharedCache {
+		cache = getSharedPebbleCache(cfg.BlockCache)
+	} else {
+		cache = pebble.NewCache(cfg.BlockCache)
+	}
+	opts := &pebble.Options{
+		Cache:                       cache,
+		MemTableSize:                cfg.WriteBufferSize,
+		MemTableStopWritesThreshold: cfg.MaxWriteBufferNumber,
+		L0CompactionThreshold:       cfg.Level0FileNumCompactionTrigger,
+		LBaseMaxBytes:               int64(cfg.MaxBytesForLevelBase),
+		MaxConcurrentCompactions:    cfg.MaxBackgroundCompactions,
+		MaxManifestFileSize:         int64(cfg.MaxMainifestFileSize),
+		DisableWAL:                  cfg.DisableWAL,
+		Merger:                      uint64AddMerger,
+	}
+	opts.Levels = make([]pebble.LevelOptions, 7)
+	for i := range opts.Levels {
+		l := &opts.Levels[i]
+		l.BlockSize = cfg.BlockSize
+		l.FilterPolicy = bloom.FilterPolicy(10)
+		l.TargetFileSize = int64(cfg.TargetFileSizeBase)
+		if i > 0 {
+			l.TargetFileSize = opts.Levels[i-1].TargetFileSize * 2
+		}
+		if len(cfg.CompressionPerLevel) > 0 {
+			// only the snappy compression is supported, other compressions will use snappy
+			c := cfg.CompressionPerLevel[len(cfg.CompressionPerLevel)-1]
+			if i < len(cfg.CompressionPerLevel) {
+				c = cfg.CompressionPerLevel[i]
+			}
+			if c == "no" {
+				l.Compression = pebble.NoCompression
+			} else {
+				l.Compression = pebble.SnappyCompression
+			}
+		} else if i < cfg.MinLevelToCompress {
+			l.Compression = pebble.NoCompression
+		} else {
+			l.Compression = pebble.SnappyCompression
+		}
+	}
+	if cfg.EnableBlobFiles {
+		dbLog.Infof("the blob files is not supported by pebble engine: %v", cfg.DataDir)
+	}
+	opts.EnsureDefaults()
+	return &pebbleEng{
+		cfg:   cfg,
+		opts:  opts,
+		wo:    pebble.NoSync,
+		cache: cache,
+		wbm:   getWriteBufferManager(cfg.SharedConfig),
+	}, nil
+}
+
+func (pe *pebbleEng) GetDataDir() string {
+	return pe.cfg.DataDir
+}
+
+func (pe *pebbleEng) OpenEng() error {
+	eng, err := pebble.Open(pe.GetDataDir(), pe.opts)
+	if err != nil {
+		return err
+	}
+	pe.Lock()
+	pe.eng = eng
+	pe.opened = true
+	pe.Unlock()
+	if pe.wbm != nil {
+		pe.wbm.register(pe)
+	}
+	return nil
+}
+
+func (pe *pebbleEng) CloseEng() {
+	if pe.wbm != nil {
+		pe.wbm.unregister(pe)
+	}
+	pe.Lock()
+	defer pe.Unlock()
+	if pe.eng != nil && pe.opened {
+		pe.opened = false
+		pe.eng.Close()
+	}
+}
+
+func (pe *pebbleEng) CloseAll() {
+	pe.CloseEng()
+	if pe.cache != nil {
+		pe.cache.Unref()
+		pe.cache = nil
+	}
+}
+
+func (pe *pebbleEng) IsOpened() bool {
+	pe.RLock()
+	defer pe.RUnlock()
+	return pe.opened
+}
+
+func (pe *pebbleEng) memTableSize() int64 {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		return 0
+	}
+	return int64(pe.eng.Metrics().MemTable.Size)
+}
+
+func (pe *pebbleEng) flushMemTable() error {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		return errEngineNotOpened
+	}
+	return pe.eng.Flush()
+}
+
+func (pe *pebbleEng) NewWriteBatch() WriteBatch {
+	return &pebbleWriteBatch{b: new(pebble.Batch)}
+}
+
+func (pe *pebbleEng) Write(wb WriteBatch) error {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		return errEngineNotOpened
+	}
+	if err := common.FaultError(common.FaultDBWriteFail, ""); err != nil {
+		return err
+	}
+	b := wb.(*pebbleWriteBatch).b
+	if b.Empty() {
+		return nil
+	}
+	// the batch can be reused after applied, so we need copy it to a new batch
+	// owned by the engine.
+	nb := pe.eng.NewBatch()
+	defer nb.Close()
+	if err := nb.Apply(b, nil); err != nil {
+		return err
+	}
+	return pe.eng.Apply(nb, pe.wo)
+}
+
+func (pe *pebbleEng) GetBytes(key []byte) ([]byte, error) {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		return nil, errEngineNotOpened
+	}
+	return pe.GetBytesNoLock(key)
+}
+
+func (pe *pebbleEng) GetBytesNoLock(key []byte) ([]byte, error) {
+	val, closer, err := pe.eng.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v := make([]byte, len(val))
+	copy(v, val)
+	closer.Close()
+	return v, nil
+}
+
+// all the keys will be read from the same snapshot
+func (pe *pebbleEng) MultiGetBytes(keyList [][]byte, values [][]byte, errs []error) {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		for i := range errs {
+			errs[i] = errEngineNotOpened
+		}
+		return
+	}
+	snap := pe.eng.NewSnapshot()
+	defer snap.Close()
+	for i, k := range keyList {
+		val, closer, err := snap.Get(k)
+		if err == pebble.ErrNotFound {
+			values[i], errs[i] = nil, nil
+			continue
+		}
+		if err != nil {
+			values[i], errs[i] = nil, err
+			continue
+		}
+		v := make([]byte, len(val))
+		copy(v, val)
+		closer.Close()
+		values[i], errs[i] = v, nil
+	}
+}
+
+type pebbleSnapshot struct {
+	snap *pebble.Snapshot
+	db   *pebbleEng
+}
+
+func (s *pebbleSnapshot) Release() {
+	s.snap.Close()
+	s.db.RUnlock()
+}
+
+// the read lock is held until the snapshot released
+func (pe *pebbleEng) NewSnapshot() (Snapshot, error) {
+	pe.RLock()
+	if !pe.opened {
+		pe.RUnlock()
+		return nil, errEngineNotOpened
+	}
+	return &pebbleSnapshot{snap: pe.eng.NewSnapshot(), db: pe}, nil
+}
+
+func (pe *pebbleEng) NewIterator(opts IteratorOpts) (Iterator, error) {
+	if err := pe.cfg.IterLimiter.acquire(); err != nil {
+		return nil, err
+	}
+	it := pebbleIterPool.Get().(*pebbleIterator)
+	// the shared snapshot already hold the read lock
+	if opts.Snapshot == nil {
+		pe.RLock()
+		if !pe.opened {
+			pe.RUnlock()
+			pe.cfg.IterLimiter.release()
+			pebbleIterPool.Put(it)
+			return nil, errEngineNotOpened
+		}
+		it.db = pe
+	}
+	it.limiter = pe.cfg.IterLimiter
+	// the prefix same, the range deletion and the cache hints are only the optimization for rocksdb
+	iterOpts := &pebble.IterOptions{
+		LowerBound: opts.LowerBound,
+		UpperBound: opts.UpperBound,
+	}
+	if opts.Snapshot != nil {
+		it.Iterator = opts.Snapshot.(*pebbleSnapshot).snap.NewIter(iterOpts)
+	} else if opts.WithSnap {
+		it.snap = pe.eng.NewSnapshot()
+		it.Iterator = it.snap.NewIter(iterOpts)
+	} else {
+		it.Iterator = pe.eng.NewIter(iterOpts)
+	}
+	return it, nil
+}
+
+func (pe *pebbleEng) GetApproximateSizes(ranges []CRange, includeMem bool) []uint64 {
+	sizeList := make([]uint64, len(ranges))
+	for i, rg := range ranges {
+		s, err := pe.eng.EstimateDiskUsage(rg.Start, rg.Limit)
+		if err != nil {
+			dbLog.Infof("estimate disk usage for range %v failed: %v", rg, err)
+			continue
+		}
+		sizeList[i] = s
+	}
+	return sizeList
+}
+
+// estimate the key number by the entries in the sst files overlapped with the ranges
+func (pe *pebbleEng) getApproximateKeyNum(ranges []CRange) uint64 {
+	levels, err := pe.eng.SSTables()
+	if err != nil {
+		dbLog.Infof("get sst tables failed: %v", err)
+		return 0
+	}
+	num := uint64(0)
+	for _, tables := range levels {
+		for _, t := range tables {
+			if t.Properties == nil {
+				continue
+			}
+			if ranges == nil {
+				num += t.Properties.NumEntries
+				continue
+			}
+			for _, rg := range ranges {
+				if bytes.Compare(t.Smallest.UserKey, rg.Limit) >= 0 ||
+					bytes.Compare(t.Largest.UserKey, rg.Start) < 0 {
+					continue
+				}
+				num += t.Properties.NumEntries
+				break
+			}
+		}
+	}
+	return num
+}
+
+func (pe *pebbleEng) GetApproximateKeyNum(ranges []CRange) uint64 {
+	if len(ranges) == 0 {
+		return 0
+	}
+	return pe.getApproximateKeyNum(ranges)
+}
+
+// only the properties used by the db are supported
+func (pe *pebbleEng) GetProperty(name string) string {
+	switch name {
+	case "rocksdb.estimate-num-keys":
+		return strconv.FormatUint(pe.getApproximateKeyNum(nil), 10)
+	case "rocksdb.cur-size-all-mem-tables":
+		return strconv.FormatUint(pe.eng.Metrics().MemTable.Size, 10)
+	}
+	return ""
+}
+
+func (pe *pebbleEng) GetStatistics() string {
+	return pe.eng.Metrics().String()
+}
+
+func (pe *pebbleEng) GetInternalStatus() map[string]interface{} {
+	status := make(map[string]interface{})
+	m := pe.eng.Metrics()
+	status["block-cache-usage"] = m.BlockCache.Size
+	status["cur-size-all-mem-tables"] = m.MemTable.Size
+	status["table-cache-size"] = m.TableCache.Size
+	levels := make([]LevelStats, 0, len(m.Levels))
+	for i, l := range m.Levels {
+		levels = append(levels, LevelStats{Level: i, NumFiles: l.NumFiles, Size: int64(l.Size)})
+	}
+	status["level-stats"] = levels
+	status["estimate-pending-compaction-bytes"] = m.Compact.EstimatedDebt
+	if pe.cfg.IterLimiter != nil {
+		for k, v := range pe.cfg.IterLimiter.Stats() {
+			status[k] = v
+		}
+	}
+	return status
+}
+
+func (pe *pebbleEng) CompactRange(rg CRange) {
+	start := rg.Start
+	end := rg.Limit
+	if start == nil && end == nil {
+		// compact all the data
+		it := pe.eng.NewIter(nil)
+		if it.First() {
+			start = append([]byte{}, it.Key()...)
+		}
+		if it.Last() {
+			end = append(append([]byte{}, it.Key()...), 0)
+		}
+		it.Close()
+		if start == nil || end == nil {
+			return
+		}
+	}
+	if err := pe.eng.Compact(start, end); err != nil {
+		dbLog.Infof("compact range %v failed: %v", rg, err)
+	}
+}
+
+func (pe *pebbleEng) SaveCheckpoint(dir string, notify func()) error {
+	pe.RLock()
+	defer pe.RUnlock()
+	if !pe.opened {
+		return errEngineNotOpened
+	}
+	if notify != nil {
+		time.AfterFunc(time.Millisecond*10, notify)
+	}
+	return pe.eng.Checkpoint(dir)
+}
+
+func (pe *pebbleEng) CheckDBEngForRead(dir string) error {
+	ro := pe.opts.Clone()
+	ro.ReadOnly = true
+	db, err := pebble.Open(dir, ro)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+type pebbleWriteBatch struct {
+	b *pebble.Batch
+}
+
+func (wb *pebbleWriteBatch) Put(key []byte, value []byte) {
+	wb.b.Set(key, value, nil)
+}
+
+func (wb *pebbleWriteBatch) Delete(key []byte) {
+	wb.b.Delete(key, nil)
+}
+
+func (wb *pebbleWriteBatch) DeleteRange(start []byte, end []byte) {
+	wb.b.DeleteRange(start, end, nil)
+}
+
+func (wb *pebbleWriteBatch) Merge(key []byte, delta []byte) {
+	wb.b.Merge(key, delta, nil)
+}
+
+func (wb *pebbleWriteBatch) Clear() {
+	wb.b.Reset()
+}
+
+func (wb *pebbleWriteBatch) Count() int {
+	return int(wb.b.Count())
+}
+
+func (wb *pebbleWriteBatch) Destroy() {
+	wb.b.Close()
+}
+
+var pebbleIterPool = sync.Pool{
+	New: func() interface{} {
+		return &pebbleIterator{}
+	},
+}
+
+type pebbleIterator struct {
+	*pebble.Iterator
+	db      *pebbleEng
+	snap    *pebble.Snapshot
+	limiter *IteratorLimiter
+}
+
+func (it *pebbleIterator) Seek(key []byte) {
+	it.Iterator.SeekGE(key)
+}
+
+// seek to the last key that less than or equal to the key
+func (it *pebbleIterator) SeekForPrev(key []byte) {
+	if it.Iterator.SeekGE(key) && bytes.Equal(it.Iterator.Key(), key) {
+		return
+	}
+	it.Iterator.SeekLT(key)
+}
+
+func (it *pebbleIterator) SeekToFirst() {
+	it.Iterator.First()
+}
+
+func (it *pebbleIterator) SeekToLast() {
+	it.Iterator.Last()
+}
+
+func (it *pebbleIterator) Next() {
+	it.Iterator.Next()
+}
+
+func (it *pebbleIterator) Prev() {
+	it.Iterator.Prev()
+}
+
+func (it *pebbleIterator) RefKey() []byte {
+	return it.Iterator.Key()
+}
+
+func (it *pebbleIterator) Key() []byte {
+	return append([]byte{}, it.Iterator.Key()...)
+}
+
+func (it *pebbleIterator) RefValue() []byte {
+	return it.Iterator.Value()
+}
+
+func (it *pebbleIterator) Value() []byte {
+	return append([]byte{}, it.Iterator.Value()...)
+}
+
+func (it *pebbleIterator) Err() error {
+	return it.Iterator.Error()
+}
+
+func (it *pebbleIterator) Close() {
+	if it.Iterator != nil {
+		it.Iterator.Close()
+	}
+	if it.snap != nil {
+		it.snap.Close()
+	}
+	if it.db != nil {
+		it.db.RUnlock()
+	}
+	it.limiter.release()
+	*it = pebbleIterator{}
+	pebbleIterPool.Put(it)
+}
+
+// pebble has no column family, so we just delete the data of the key types
+func (pe *pebbleEng) SetOptions(o common.RockOptionsOverride) error {
+	return errSetOptionNotSupported
+}
+
+func (pe *pebbleEng) DropColumnFamily(name string) error {
+	cf := pe.cfg.getColumnFamily(name)
+	if cf == nil {
+		return errColumnFamilyNotFound
+	}
+	return deleteKeyTypes(pe, cf.KeyTypes)
+}
@@ -0,0 +1,1063 @@
+// +build cgo,!norocksdb
+
+package engine
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/gorocksdb"
+	"github.com/shirou/gopsutil/mem"
+)
+
+const defaultEngineType = RocksDBEngine
+
+var rockCompressions = map[string]gorocksdb.CompressionType{
+	"no":     gorocksdb.NoCompression,
+	"snappy": gorocksdb.SnappyCompression,
+	"zlib":   gorocksdb.ZLibCompression,
+	"bz2":    gorocksdb.Bz2Compression,
+	"lz4":    gorocksdb.LZ4Compression,
+	"lz4hc":  gorocksdb.LZ4HCCompression,
+	"zstd":   gorocksdb.ZSTDCompression,
+}
+
+// the compression names used in the rocksdb option string
+var rockCompressionNames = map[string]string{
+	"no":     "kNoCompression",
+	"snappy": "kSnappyCompression",
+	"zlib":   "kZlibCompression",
+	"bz2":    "kBZip2Compression",
+	"lz4":    "kLZ4Compression",
+	"lz4hc":  "kLZ4HCCompression",
+	"zstd":   "kZSTD",
+}
+
+func getRockCompressions(names []string) []gorocksdb.CompressionType {
+	cs := make([]gorocksdb.CompressionType, 0, len(names))
+	for _, n := range names {
+		c, ok := rockCompressions[n]
+		if !ok {
+			c = gorocksdb.SnappyCompression
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+func init() {
+	registerEngine(RocksDBEngine, newRockEng)
+}
+
+type sharedRockConfig struct {
+	SharedCache       *gorocksdb.Cache
+	SharedEnv         *gorocksdb.Env
+	SharedRateLimiter *gorocksdb.RateLimiter
+	wbm               *writeBufferManager
+}
+
+func NewSharedRockConfig(opt RockOptions) SharedRockConfig {
+	rc := &sharedRockConfig{}
+	if opt.MemoryBudget > 0 {
+		opt.UseSharedCache = true
+		opt.BlockCache = getSharedCacheBudget(opt)
+		rc.wbm = newWriteBufferManager(getWriteBufferBudget(opt))
+	}
+	if opt.UseSharedCache {
+		if opt.BlockCache <= 0 {
+			v, err := mem.VirtualMemory()
+			if err != nil {
+				opt.BlockCache = 1024 * 1024 * 128 * 10
+			} else {
+				opt.BlockCache = int64(v.Total / 10)
+			}
+		}
+		rc.SharedCache = gorocksdb.NewLRUCache(opt.BlockCache)
+	}
+	if opt.AdjustThreadPool {
+		rc.SharedEnv = gorocksdb.NewDefaultEnv()
+		if opt.BackgroundHighThread <= 0 {
+			opt.BackgroundHighThread = 3
+		}
+		if opt.BackgroundLowThread <= 0 {
+			opt.BackgroundLowThread = 6
+		}
+		rc.SharedEnv.SetBackgroundThreads(opt.BackgroundLowThread)
+		rc.SharedEnv.SetHighPriorityBackgroundThreads(opt.BackgroundHighThread)
+	}
+	if opt.UseSharedRateLimiter && opt.RateBytesPerSec > 0 {
+		rc.SharedRateLimiter = gorocksdb.NewGenericRateLimiter(opt.RateBytesPerSec, 100*1000, 10)
+	}
+	return rc
+}
+
+func (src *sharedRockConfig) Destroy() {
+	if src.SharedCache != nil {
+		src.SharedCache.Destroy()
+	}
+	if src.SharedEnv != nil {
+		src.SharedEnv.Destroy()
+	}
+	if src.SharedRateLimiter != nil {
+		src.SharedRateLimiter.Destroy()
+	}
+	if src.wbm != nil {
+		src.wbm.stop()
+	}
+}
+
+func (src *sharedRockConfig) getWriteBufferManager() *writeBufferManager {
+	return src.wbm
+}
+
+func SetPerfLevel(level int) {
+	if level <= 0 || level > 4 {
+		DisablePerfLevel()
+		return
+	}
+	gorocksdb.SetPerfLevel(gorocksdb.PerfLevel(level))
+}
+
+func IsPerfEnabledLevel(lv int) bool {
+	if lv <= 0 || lv > 4 {
+		return false
+	}
+	return lv != gorocksdb.PerfDisable
+}
+
+func DisablePerfLevel() {
+	gorocksdb.SetPerfLevel(gorocksdb.PerfDisable)
+}
+
+type rockEng struct {
+	cfg              *RockEngConfig
+	eng              *gorocksdb.DB
+	dbOpts           *gorocksdb.Options
+	cfOpts           map[string]*gorocksdb.Options
+	defaultWriteOpts *gorocksdb.WriteOptions
+	defaultReadOpts  *gorocksdb.ReadOptions
+	lruCache         *gorocksdb.Cache
+	rl               *gorocksdb.RateLimiter
+	opened           int32
+	cfMutex          sync.RWMutex
+	// the column family for each key type, nil for the default column family
+	cfRoutes   [256]*gorocksdb.ColumnFamilyHandle
+	cfHandles  map[string]*gorocksdb.ColumnFamilyHandle
+	droppedCFs []*gorocksdb.ColumnFamilyHandle
+	wbm        *writeBufferManager
+}
+
+func newRockEng(cfg *RockEngConfig) (KVEngine, error) {
+	var sharedConfig *sharedRockConfig
+	if cfg.SharedConfig != nil {
+		sharedConfig, _ = cfg.SharedConfig.(*sharedRockConfig)
+	}
+	// should about 20% less than host RAM
+	// http://smalldatum.blogspot.com/2016/09/tuning-rocksdb-block-cache.html
+	var cache *gorocksdb.Cache
+	var lru *gorocksdb.Cache
+	if cfg.RockOptions.UseSharedCache {
+		if sharedConfig == nil || sharedConfig.SharedCache == nil {
+			return nil, errors.New("missing shared cache instance")
+		}
+		cache = sharedConfig.SharedCache
+		dbLog.Infof("use shared cache: %v", sharedConfig.SharedCache)
+	} else {
+		lru = gorocksdb.NewLRUCache(cfg.BlockCache)
+		cache = lru
+	}
+	var env *gorocksdb.Env
+	if cfg.RockOptions.AdjustThreadPool {
+		if sharedConfig == nil || sharedConfig.SharedEnv == nil {
+			return nil, errors.New("missing shared env instance")
+		}
+		env = sharedConfig.SharedEnv
+		dbLog.Infof("use shared env: %v", sharedConfig.SharedEnv)
+	}
+	var limiter *gorocksdb.RateLimiter
+	var rl *gorocksdb.RateLimiter
+	if cfg.RateBytesPerSec > 0 {
+		if cfg.UseSharedRateLimiter {
+			if sharedConfig == nil {
+				return nil, errors.New("missing shared instance")
+			}
+			limiter = sharedConfig.SharedRateLimiter
+			dbLog.Infof("use shared rate limiter: %v", sharedConfig.SharedRateLimiter)
+		} else {
+			rl = gorocksdb.NewGenericRateLimiter(cfg.RateBytesPerSec, 100*1000, 10)
+			limiter = rl
+		}
+	}
+
+	opts := newRockOptions(cfg, cache, env, limiter)
+	// we use table, so we use prefix seek feature
+	opts.SetPrefixExtractor(gorocksdb.NewFixedPrefixTransform(3))
+	opts.SetCreateIfMissingColumnFamilies(true)
+	cfOpts := make(map[string]*gorocksdb.Options)
+	for _, cf := range cfg.ColumnFamilies {
+		o := newRockOptions(cfg, cache, env, limiter)
+		if cf.PrefixLen > 0 {
+			o.SetPrefixExtractor(gorocksdb.NewFixedPrefixTransform(cf.PrefixLen))
+		}
+		if cf.UniversalCompaction {
+			o.SetCompactionStyle(gorocksdb.UniversalCompactionStyle)
+		}
+		cfOpts[cf.Name] = o
+	}
+
+	ro := gorocksdb.NewDefaultReadOptions()
+	ro.SetVerifyChecksums(false)
+	wo := gorocksdb.NewDefaultWriteOptions()
+	if cfg.DisableWAL {
+		wo.DisableWAL(true)
+	}
+	return &rockEng{
+		cfg:              cfg,
+		dbOpts:           opts,
+		cfOpts:           cfOpts,
+		lruCache:         lru,
+		rl:               rl,
+		defaultReadOpts:  ro,
+		defaultWriteOpts: wo,
+		wbm:              getWriteBufferManager(cfg.SharedConfig),
+	}, nil
+}
+
+// options need be adjust due to using hdd or sdd, please reference
+// https://github.com/facebook/rocksdb/wiki/RocksDB-Tuning-Guide
+func newRockOptions(cfg *RockEngConfig, cache *gorocksdb.Cache, env *gorocksdb.Env,
+	limiter *gorocksdb.RateLimiter) *gorocksdb.Options {
+	bbto := gorocksdb.NewDefaultBlockBasedTableOptions()
+	// use large block to reduce index block size for hdd
+	// if using ssd, should use the default value
+	bbto.SetBlockSize(cfg.BlockSize)
+	bbto.SetBlockCache(cache)
+	// cache index and filter blocks can save some memory,
+	// if not cache, the index and filter will be pre-loaded in memory
+	bbto.SetCacheIndexAndFilterBlocks(cfg.CacheIndexAndFilterBlocks)
+	// /* filter should not block_based, use sst based to reduce cpu */
+	filter := gorocksdb.NewBloomFilter(10, false)
+	bbto.SetFilterPolicy(filter)
+	opts := gorocksdb.NewDefaultOptions()
+	// optimize filter for hit, use less memory since last level will has no bloom filter
+	// opts.OptimizeFilterForHits(true)
+	opts.SetBlockBasedTableFactory(bbto)
+	if env != nil {
+		opts.SetEnv(env)
+	}
+	if limiter != nil {
+		opts.SetRateLimiter(limiter)
+	}
+
+	opts.SetCreateIfMissing(true)
+	opts.SetMaxOpenFiles(-1)
+	// keep level0_file_num_compaction_trigger * write_buffer_size * min_write_buffer_number_tomerge = max_bytes_for_level_base to minimize write amplification
+	opts.SetWriteBufferSize(cfg.WriteBufferSize)
+	opts.SetMaxWriteBufferNumber(cfg.MaxWriteBufferNumber)
+	opts.SetMinWriteBufferNumberToMerge(cfg.MinWriteBufferNumberToMerge)
+	opts.SetLevel0FileNumCompactionTrigger(cfg.Level0FileNumCompactionTrigger)
+	opts.SetMaxBytesForLevelBase(cfg.MaxBytesForLevelBase)
+	opts.SetTargetFileSizeBase(cfg.TargetFileSizeBase)
+	opts.SetMaxBackgroundFlushes(cfg.MaxBackgroundFlushes)
+	opts.SetMaxBackgroundCompactions(cfg.MaxBackgroundCompactions)
+	opts.SetMinLevelToCompress(cfg.MinLevelToCompress)
+	if len(cfg.CompressionPerLevel) > 0 {
+		opts.SetCompressionPerLevel(getRockCompressions(cfg.CompressionPerLevel))
+	}
+	opts.SetMemtablePrefixBloomSizeRatio(0.1)
+	opts.EnableStatistics()
+	opts.SetMaxLogFileSize(1024 * 1024 * 32)
+	opts.SetLogFileTimeToRoll(3600 * 24 * 3)
+	opts.SetMaxManifestFileSize(cfg.MaxMainifestFileSize)
+	opts.SetMaxSuccessiveMerges(1000)
+	// https://github.com/facebook/mysql-5.6/wiki/my.cnf-tuning
+	// rate limiter need to reduce the compaction io
+	if cfg.EnableTableCounter {
+		opts.SetUint64AddMergeOperator()
+	}
+	return opts
+}
+
+func (r *rockEng) GetDataDir() string {
+	return r.cfg.DataDir
+}
+
+// the column families of the db, the existing db will be opened with all its column
+// families, and the new db will use the configured column families.
+func (r *rockEng) getOpenColumnFamilies(dir string) ([]string, []*gorocksdb.Options) {
+	names, err := gorocksdb.ListColumnFamilies(r.dbOpts, dir)
+	if err != nil || len(names) == 0 {
+		// the new db
+		names = []string{"default"}
+		if r.cfg.UseColumnFamily {
+			for _, cf := range r.cfg.ColumnFamilies {
+				names = append(names, cf.Name)
+			}
+		}
+	} else if len(names) == 1 && r.cfg.UseColumnFamily && len(r.cfg.ColumnFamilies) > 0 {
+		dbLog.Infof("the existing db %v has no column family, keep all data in the default", dir)
+	}
+	optsList := make([]*gorocksdb.Options, 0, len(names))
+	for _, name := range names {
+		o, ok := r.cfOpts[name]
+		if !ok {
+			o = r.dbOpts
+		}
+		optsList = append(optsList, o)
+	}
+	return names, optsList
+}
+
+func (r *rockEng) OpenEng() error {
+	names, optsList := r.getOpenColumnFamilies(r.GetDataDir())
+	var eng *gorocksdb.DB
+	var handles []*gorocksdb.ColumnFamilyHandle
+	var err error
+	if len(names) == 1 {
+		eng, err = gorocksdb.OpenDb(r.dbOpts, r.GetDataDir())
+	} else {
+		eng, handles, err = gorocksdb.OpenDbColumnFamilies(r.dbOpts, r.GetDataDir(), names, optsList)
+	}
+	if err != nil {
+		return err
+	}
+	r.cfMutex.Lock()
+	r.cfRoutes = [256]*gorocksdb.ColumnFamilyHandle{}
+	r.cfHandles = make(map[string]*gorocksdb.ColumnFamilyHandle)
+	for i, name := range names {
+		if name == "default" {
+			continue
+		}
+		r.setColumnFamilyHandle(name, handles[i])
+	}
+	r.cfMutex.Unlock()
+	r.eng = eng
+	atomic.StoreInt32(&r.opened, 1)
+	if r.wbm != nil {
+		r.wbm.register(r)
+	}
+	r.applyBlobOptions()
+	return nil
+}
+
+// the blob options can only be set by the dynamic options, the blob files will be
+// ignored if the rocksdb version is too old to support the integrated blob db.
+func (r *rockEng) applyBlobOptions() {
+	if !r.cfg.EnableBlobFiles {
+		return
+	}
+	keys := []string{"enable_blob_files", "min_blob_size", "blob_file_size",
+		"enable_blob_garbage_collection"}
+	values := []string{"true", strconv.FormatUint(r.cfg.MinBlobSize, 10),
+		strconv.FormatUint(r.cfg.BlobFileSize, 10), strconv.FormatBool(r.cfg.EnableBlobGC)}
+	err := r.eng.SetOptions(keys, values)
+	if err != nil {
+		dbLog.Infof("rocksdb %v enable blob files failed: %v", r.GetDataDir(), err)
+		return
+	}
+	dbLog.Infof("rocksdb %v blob files enabled: %v, %v", r.GetDataDir(), keys, values)
+}
+
+// should hold the cf lock
+func (r *rockEng) setColumnFamilyHandle(name string, h *gorocksdb.ColumnFamilyHandle) {
+	r.cfHandles[name] = h
+	cf := r.cfg.getColumnFamily(name)
+	if cf == nil {
+		return
+	}
+	for _, kt := range cf.KeyTypes {
+		r.cfRoutes[kt] = h
+	}
+}
+
+func (r *rockEng) getColumnFamily(key []byte) *gorocksdb.ColumnFamilyHandle {
+	if len(key) == 0 {
+		return nil
+	}
+	r.cfMutex.RLock()
+	h := r.cfRoutes[key[0]]
+	r.cfMutex.RUnlock()
+	return h
+}
+
+func (r *rockEng) hasColumnFamily() bool {
+	r.cfMutex.RLock()
+	n := len(r.cfHandles)
+	r.cfMutex.RUnlock()
+	return n > 0
+}
+
+func (r *rockEng) CloseEng() {
+	if r.wbm != nil {
+		r.wbm.unregister(r)
+	}
+	if r.eng != nil {
+		atomic.StoreInt32(&r.opened, 0)
+		r.cfMutex.Lock()
+		for _, h := range r.cfHandles {
+			h.Destroy()
+		}
+		for _, h := range r.droppedCFs {
+			h.Destroy()
+		}
+		r.cfHandles = nil
+		r.droppedCFs = nil
+		r.cfRoutes = [256]*gorocksdb.ColumnFamilyHandle{}
+		r.cfMutex.Unlock()
+		r.eng.Close()
+	}
+}
+
+func (r *rockEng) CloseAll() {
+	r.CloseEng()
+	if r.defaultReadOpts != nil {
+		r.defaultReadOpts.Destroy()
+		r.defaultReadOpts = nil
+	}
+	if r.defaultWriteOpts != nil {
+		r.defaultWriteOpts.Destroy()
+		r.defaultWriteOpts = nil
+	}
+	if r.dbOpts != nil {
+		r.dbOpts.Destroy()
+		r.dbOpts = nil
+	}
+	for _, o := range r.cfOpts {
+		o.Destroy()
+	}
+	r.cfOpts = nil
+	if r.lruCache != nil {
+		r.lruCache.Destroy()
+		r.lruCache = nil
+	}
+	if r.rl != nil {
+		r.rl.Destroy()
+		r.rl = nil
+	}
+}
+
+func (r *rockEng) IsOpened() bool {
+	if r.eng == nil {
+		return false
+	}
+	return r.eng.IsOpened()
+}
+
+func (r *rockEng) RLock() {
+	r.eng.RLock()
+}
+
+func (r *rockEng) RUnlock() {
+	r.eng.RUnlock()
+}
+
+// only the memtables of the default column family is managed by the write buffer manager
+func (r *rockEng) memTableSize() int64 {
+	r.RLock()
+	defer r.RUnlock()
+	if !r.IsOpened() {
+		return 0
+	}
+	s, _ := strconv.ParseInt(r.eng.GetProperty("rocksdb.cur-size-all-mem-tables"), 10, 64)
+	return s
+}
+
+func (r *rockEng) flushMemTable() error {
+	r.RLock()
+	defer r.RUnlock()
+	if !r.IsOpened() {
+		return errEngineNotOpened
+	}
+	fo := gorocksdb.NewDefaultFlushOptions()
+	defer fo.Destroy()
+	fo.SetWait(true)
+	return r.eng.Flush(fo)
+}
+
+func (r *rockEng) NewWriteBatch() WriteBatch {
+	return &rockWriteBatch{WriteBatch: gorocksdb.NewWriteBatch(), eng: r}
+}
+
+func (r *rockEng) Write(wb WriteBatch) error {
+	if err := common.FaultError(common.FaultDBWriteFail, ""); err != nil {
+		return err
+	}
+	return r.eng.Write(r.defaultWriteOpts, wb.(*rockWriteBatch).WriteBatch)
+}
+
+func (r *rockEng) getBytesCF(h *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
+	v, err := r.eng.GetCF(r.defaultReadOpts, h, key)
+	if err != nil {
+		return nil, err
+	}
+	defer v.Free()
+	if !v.Exists() {
+		return nil, nil
+	}
+	return v.Bytes(), nil
+}
+
+func (r *rockEng) GetBytes(key []byte) ([]byte, error) {
+	if h := r.getColumnFamily(key); h != nil {
+		r.eng.RLock()
+		defer r.eng.RUnlock()
+		if atomic.LoadInt32(&r.opened) == 0 {
+			return nil, errEngineNotOpened
+		}
+		return r.getBytesCF(h, key)
+	}
+	return r.eng.GetBytes(r.defaultReadOpts, key)
+}
+
+func (r *rockEng) GetBytesNoLock(key []byte) ([]byte, error) {
+	if h := r.getColumnFamily(key); h != nil {
+		return r.getBytesCF(h, key)
+	}
+	return r.eng.GetBytesNoLock(r.defaultReadOpts, key)
+}
+
+func (r *rockEng) MultiGetBytes(keyList [][]byte, values [][]byte, errs []error) {
+	if r.hasColumnFamily() {
+		r.multiGetBytesCF(keyList, values, errs)
+		return
+	}
+	r.eng.MultiGetBytes(r.defaultReadOpts, keyList, values, errs)
+}
+
+// the keys will be grouped by the column families and read from the same snapshot
+func (r *rockEng) multiGetBytesCF(keyList [][]byte, values [][]byte, errs []error) {
+	// the values may share the same slice with the keys, so we should group all the keys
+	// before reading
+	groupIdx := make(map[*gorocksdb.ColumnFamilyHandle][]int)
+	groupKeys := make(map[*gorocksdb.ColumnFamilyHandle][][]byte)
+	for i, k := range keyList {
+		h := r.getColumnFamily(k)
+		groupIdx[h] = append(groupIdx[h], i)
+		groupKeys[h] = append(groupKeys[h], k)
+	}
+	r.eng.RLock()
+	defer r.eng.RUnlock()
+	if atomic.LoadInt32(&r.opened) == 0 {
+		for i := range errs {
+			errs[i] = errEngineNotOpened
+		}
+		return
+	}
+	snap, err := r.eng.NewSnapshot()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return
+	}
+	defer snap.Release()
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetVerifyChecksums(false)
+	ro.SetSnapshot(snap)
+	for h, idxList := range groupIdx {
+		var vals gorocksdb.Slices
+		if h == nil {
+			vals, err = r.eng.MultiGet(ro, groupKeys[h]...)
+		} else {
+			vals, err = r.eng.MultiGetCF(ro, h, groupKeys[h]...)
+		}
+		for j, i := range idxList {
+			if err != nil {
+				values[i] = nil
+				errs[i] = err
+				continue
+			}
+			values[i] = nil
+			errs[i] = nil
+			if vals[j].Exists() {
+				values[i] = vals[j].Bytes()
+			}
+		}
+		if err == nil {
+			vals.Destroy()
+		}
+	}
+}
+
+func toRockRanges(ranges []CRange) []gorocksdb.Range {
+	rgs := make([]gorocksdb.Range, 0, len(ranges))
+	for _, rg := range ranges {
+		rgs = append(rgs, gorocksdb.Range{Start: rg.Start, Limit: rg.Limit})
+	}
+	return rgs
+}
+
+func (r *rockEng) GetApproximateSizes(ranges []CRange, includeMem bool) []uint64 {
+	if !r.hasColumnFamily() {
+		return r.eng.GetApproximateSizes(toRockRanges(ranges), includeMem)
+	}
+	sizeList := make([]uint64, len(ranges))
+	for i, rg := range ranges {
+		rgs := toRockRanges([]CRange{rg})
+		if h := r.getColumnFamily(rg.Start); h != nil {
+			sizeList[i] = r.eng.GetApproximateSizesCF(h, rgs)[0]
+		} else {
+			sizeList[i] = r.eng.GetApproximateSizes(rgs, includeMem)[0]
+		}
+	}
+	return sizeList
+}
+
+func (r *rockEng) GetApproximateKeyNum(ranges []CRange) uint64 {
+	if !r.hasColumnFamily() {
+		return r.eng.GetApproximateKeyNum(toRockRanges(ranges))
+	}
+	defRanges := make([]CRange, 0, len(ranges))
+	num := uint64(0)
+	for _, rg := range ranges {
+		h := r.getColumnFamily(rg.Start)
+		if h == nil {
+			defRanges = append(defRanges, rg)
+			continue
+		}
+		// range keys = estimate-num-keys * range size / total size in the column family
+		total, _ := strconv.ParseUint(r.eng.GetPropertyCF("rocksdb.estimate-num-keys", h), 10, 64)
+		totalSize, _ := strconv.ParseUint(r.eng.GetPropertyCF("rocksdb.total-sst-files-size", h), 10, 64)
+		if total == 0 || totalSize == 0 {
+			continue
+		}
+		s := r.eng.GetApproximateSizesCF(h, toRockRanges([]CRange{rg}))[0]
+		num += uint64(float64(total) * float64(s) / float64(totalSize))
+	}
+	if len(defRanges) > 0 {
+		num += r.eng.GetApproximateKeyNum(toRockRanges(defRanges))
+	}
+	return num
+}
+
+// the numeric property will be summed for all the column families
+func (r *rockEng) GetProperty(name string) string {
+	v := r.eng.GetProperty(name)
+	r.cfMutex.RLock()
+	defer r.cfMutex.RUnlock()
+	if len(r.cfHandles) == 0 {
+		return v
+	}
+	total, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return v
+	}
+	for _, h := range r.cfHandles {
+		n, err := strconv.ParseUint(r.eng.GetPropertyCF(name, h), 10, 64)
+		if err != nil {
+			return v
+		}
+		total += n
+	}
+	return strconv.FormatUint(total, 10)
+}
+
+func (r *rockEng) GetStatistics() string {
+	return r.dbOpts.GetStatistics()
+}
+
+func (r *rockEng) GetInternalStatus() map[string]interface{} {
+	status := make(map[string]interface{})
+	bbt := r.dbOpts.GetBlockBasedTableFactory()
+	if bbt != nil {
+		bc := bbt.GetBlockCache()
+		if bc != nil {
+			status["block-cache-usage"] = bc.GetUsage()
+			status["block-cache-pinned-usage"] = bc.GetPinnedUsage()
+		}
+	}
+
+	memStr := r.GetProperty("rocksdb.estimate-table-readers-mem")
+	status["estimate-table-readers-mem"] = memStr
+	memStr = r.GetProperty("rocksdb.cur-size-all-mem-tables")
+	status["cur-size-all-mem-tables"] = memStr
+	memStr = r.GetProperty("rocksdb.cur-size-active-mem-table")
+	status["cur-size-active-mem-tables"] = memStr
+	status["rate-limiter-bytes-per-sec"] = r.cfg.RateBytesPerSec
+	if r.cfg.EnableBlobFiles {
+		status["live-blob-file-size"] = r.GetProperty("rocksdb.live-blob-file-size")
+		status["total-blob-file-size"] = r.GetProperty("rocksdb.total-blob-file-size")
+	}
+	status["level-stats"] = r.getLevelStats()
+	// the properties of the column family will be summed for all the column families
+	for _, p := range []string{"estimate-pending-compaction-bytes", "num-immutable-mem-table",
+		"mem-table-flush-pending", "compaction-pending", "size-all-mem-tables"} {
+		status[p] = r.GetProperty("rocksdb." + p)
+	}
+	for _, p := range []string{"num-running-compactions", "num-running-flushes",
+		"actual-delayed-write-rate", "is-write-stopped"} {
+		status[p] = r.eng.GetProperty("rocksdb." + p)
+	}
+	if r.cfg.IterLimiter != nil {
+		for k, v := range r.cfg.IterLimiter.Stats() {
+			status[k] = v
+		}
+	}
+	stats := r.GetStatistics()
+	status["stall-micros"] = getRockStatisticsTicker(stats, "rocksdb.stall.micros")
+	return status
+}
+
+func (r *rockEng) getLevelStats() []LevelStats {
+	stats := mergeRockLevelStats(nil, r.eng.GetProperty("rocksdb.levelstats"))
+	r.cfMutex.RLock()
+	defer r.cfMutex.RUnlock()
+	for _, h := range r.cfHandles {
+		stats = mergeRockLevelStats(stats, r.eng.GetPropertyCF("rocksdb.levelstats", h))
+	}
+	return stats
+}
+
+func (r *rockEng) CompactRange(rg CRange) {
+	rrg := gorocksdb.Range{Start: rg.Start, Limit: rg.Limit}
+	if rg.Start == nil && rg.Limit == nil {
+		r.eng.CompactRange(rrg)
+		r.cfMutex.RLock()
+		defer r.cfMutex.RUnlock()
+		for _, h := range r.cfHandles {
+			r.eng.CompactRangeCF(h, rrg)
+		}
+		return
+	}
+	if h := r.getColumnFamily(rg.Start); h != nil {
+		r.eng.CompactRangeCF(h, rrg)
+		return
+	}
+	r.eng.CompactRange(rrg)
+}
+
+func (r *rockEng) SaveCheckpoint(dir string, notify func()) error {
+	r.eng.RLock()
+	defer r.eng.RUnlock()
+	if !r.eng.IsOpened() {
+		return errEngineNotOpened
+	}
+	ck, err := gorocksdb.NewCheckpoint(r.eng)
+	if err != nil {
+		return err
+	}
+	if notify != nil {
+		time.AfterFunc(time.Millisecond*10, notify)
+	}
+	return ck.Save(dir, math.MaxUint64)
+}
+
+func (r *rockEng) CheckDBEngForRead(dir string) error {
+	ro := *r.dbOpts
+	ro.SetCreateIfMissing(false)
+	names, err := gorocksdb.ListColumnFamilies(&ro, dir)
+	if err != nil {
+		return err
+	}
+	if len(names) <= 1 {
+		db, err := gorocksdb.OpenDbForReadOnly(&ro, dir, false)
+		if err != nil {
+			return err
+		}
+		db.Close()
+		return nil
+	}
+	_, optsList := r.getOpenColumnFamilies(dir)
+	db, handles, err := gorocksdb.OpenDbForReadOnlyColumnFamilies(&ro, dir, names, optsList, false)
+	if err != nil {
+		return err
+	}
+	for _, h := range handles {
+		h.Destroy()
+	}
+	db.Close()
+	return nil
+}
+
+// the column family will be dropped and created again, the old data will be
+// deleted in background by rocksdb.
+// only the options of the default column family can be changed at runtime, the separated
+// column families will use the new options after reopened.
+func (r *rockEng) SetOptions(o common.RockOptionsOverride) error {
+	if o.MaxBackgroundJobs > 0 || o.MaxOpenIterators > 0 {
+		return errOptionNotMutable
+	}
+	keys := make([]string, 0, 3)
+	values := make([]string, 0, 3)
+	if o.WriteBufferSize > 0 {
+		keys = append(keys, "write_buffer_size")
+		values = append(values, strconv.Itoa(o.WriteBufferSize))
+	}
+	if o.TargetFileSizeBase > 0 {
+		keys = append(keys, "target_file_size_base")
+		values = append(values, strconv.FormatUint(o.TargetFileSizeBase, 10))
+	}
+	if len(o.CompressionPerLevel) > 0 {
+		names := make([]string, 0, len(o.CompressionPerLevel))
+		for _, c := range o.CompressionPerLevel {
+			n, ok := rockCompressionNames[c]
+			if !ok {
+				return errors.New("unknown compression type: " + c)
+			}
+			names = append(names, n)
+		}
+		keys = append(keys, "compression_per_level")
+		values = append(values, strings.Join(names, ":"))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	r.RLock()
+	defer r.RUnlock()
+	if !r.IsOpened() {
+		return errEngineNotOpened
+	}
+	err := r.eng.SetOptions(keys, values)
+	if err != nil {
+		return err
+	}
+	dbLog.Infof("rocksdb %v options changed: %v, %v", r.GetDataDir(), keys, values)
+	// keep the changed options after reopen
+	ApplyOptionsOverride(&r.cfg.RockOptions, o)
+	optsList := []*gorocksdb.Options{r.dbOpts}
+	for _, opts := range r.cfOpts {
+		optsList = append(optsList, opts)
+	}
+	for _, opts := range optsList {
+		opts.SetWriteBufferSize(r.cfg.WriteBufferSize)
+		opts.SetTargetFileSizeBase(r.cfg.TargetFileSizeBase)
+		if len(r.cfg.CompressionPerLevel) > 0 {
+			opts.SetCompressionPerLevel(getRockCompressions(r.cfg.CompressionPerLevel))
+		}
+	}
+	return nil
+}
+
+func (r *rockEng) DropColumnFamily(name string) error {
+	cf := r.cfg.getColumnFamily(name)
+	if cf == nil {
+		return errColumnFamilyNotFound
+	}
+	r.cfMutex.RLock()
+	_, ok := r.cfHandles[name]
+	r.cfMutex.RUnlock()
+	if !ok {
+		// the data types are stored in the default column family for the existing db
+		return deleteKeyTypes(r, cf.KeyTypes)
+	}
+	r.eng.RLock()
+	defer r.eng.RUnlock()
+	if atomic.LoadInt32(&r.opened) == 0 {
+		return errEngineNotOpened
+	}
+	r.cfMutex.Lock()
+	defer r.cfMutex.Unlock()
+	old := r.cfHandles[name]
+	err := r.eng.DropColumnFamily(old)
+	if err != nil {
+		return err
+	}
+	// the iterators may still use the old handle, so we destroy it while closing
+	r.droppedCFs = append(r.droppedCFs, old)
+	delete(r.cfHandles, name)
+	for _, kt := range cf.KeyTypes {
+		r.cfRoutes[kt] = nil
+	}
+	h, err := r.eng.CreateColumnFamily(r.cfOpts[name], name)
+	if err != nil {
+		dbLog.Errorf("create column family %v failed: %v", name, err)
+		return err
+	}
+	r.setColumnFamilyHandle(name, h)
+	dbLog.Infof("column family %v dropped", name)
+	return nil
+}
+
+type rockSnapshot struct {
+	snap *gorocksdb.Snapshot
+	db   *gorocksdb.DB
+}
+
+func (s *rockSnapshot) Release() {
+	s.snap.Release()
+	s.db.RUnlock()
+}
+
+// the read lock is held until the snapshot released
+func (r *rockEng) NewSnapshot() (Snapshot, error) {
+	r.eng.RLock()
+	if atomic.LoadInt32(&r.opened) == 0 {
+		r.eng.RUnlock()
+		return nil, errEngineNotOpened
+	}
+	snap, err := r.eng.NewSnapshot()
+	if err != nil {
+		r.eng.RUnlock()
+		return nil, err
+	}
+	return &rockSnapshot{snap: snap, db: r.eng}, nil
+}
+
+func (r *rockEng) NewIterator(opts IteratorOpts) (Iterator, error) {
+	// wait the slot before locking the db to avoid blocking the close
+	if err := r.cfg.IterLimiter.acquire(); err != nil {
+		return nil, err
+	}
+	it := rockIterPool.Get().(*rockIterator)
+	// the shared snapshot already hold the read lock
+	if opts.Snapshot == nil {
+		r.eng.RLock()
+		it.db = r.eng
+	}
+	it.limiter = r.cfg.IterLimiter
+	readOpts := gorocksdb.NewDefaultReadOptions()
+	readOpts.SetFillCache(opts.FillCache)
+	readOpts.SetVerifyChecksums(false)
+	if opts.ReadaheadSize > 0 {
+		readOpts.SetReadaheadSize(uint64(opts.ReadaheadSize))
+	}
+	if opts.PrefixSame {
+		readOpts.SetPrefixSameAsStart(true)
+	}
+	if opts.LowerBound != nil {
+		it.lowerBound = gorocksdb.NewIterBound(opts.LowerBound)
+		readOpts.SetIterLowerBound(it.lowerBound)
+	}
+	if opts.UpperBound != nil {
+		it.upperBound = gorocksdb.NewIterBound(opts.UpperBound)
+		readOpts.SetIterUpperBound(it.upperBound)
+	}
+	if opts.IgnoreDel {
+		// may iterator some deleted keys still not compacted.
+		readOpts.SetIgnoreRangeDeletions(true)
+	}
+	it.ro = readOpts
+	var err error
+	if opts.Snapshot != nil {
+		readOpts.SetSnapshot(opts.Snapshot.(*rockSnapshot).snap)
+	} else if opts.WithSnap {
+		it.snap, err = r.eng.NewSnapshot()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		readOpts.SetSnapshot(it.snap)
+	}
+	// the iterator should not cross the column families, so we use the
+	// column family of the bound
+	var h *gorocksdb.ColumnFamilyHandle
+	if len(opts.LowerBound) > 0 {
+		h = r.getColumnFamily(opts.LowerBound)
+	} else if len(opts.UpperBound) > 1 {
+		h = r.getColumnFamily(opts.UpperBound)
+	} else if len(opts.UpperBound) == 1 && opts.UpperBound[0] > 0 {
+		h = r.getColumnFamily([]byte{opts.UpperBound[0] - 1})
+	}
+	if h != nil {
+		it.Iterator = r.eng.NewIteratorCF(readOpts, h)
+	} else {
+		it.Iterator, err = r.eng.NewIterator(readOpts)
+	}
+	if err != nil {
+		it.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
+type rockWriteBatch struct {
+	*gorocksdb.WriteBatch
+	eng *rockEng
+}
+
+func (wb *rockWriteBatch) Put(key []byte, value []byte) {
+	if h := wb.eng.getColumnFamily(key); h != nil {
+		wb.WriteBatch.PutCF(h, key, value)
+		return
+	}
+	wb.WriteBatch.Put(key, value)
+}
+
+func (wb *rockWriteBatch) Delete(key []byte) {
+	if h := wb.eng.getColumnFamily(key); h != nil {
+		wb.WriteBatch.DeleteCF(h, key)
+		return
+	}
+	wb.WriteBatch.Delete(key)
+}
+
+// the range should not cross the column families
+func (wb *rockWriteBatch) DeleteRange(start []byte, end []byte) {
+	if h := wb.eng.getColumnFamily(start); h != nil {
+		wb.WriteBatch.DeleteRangeCF(h, start, end)
+		return
+	}
+	wb.WriteBatch.DeleteRange(start, end)
+}
+
+func (wb *rockWriteBatch) Merge(key []byte, delta []byte) {
+	if h := wb.eng.getColumnFamily(key); h != nil {
+		wb.WriteBatch.MergeCF(h, key, delta)
+		return
+	}
+	wb.WriteBatch.Merge(key, delta)
+}
+
+// the closed iterators will be reused to reduce the allocation for the scan heavy load
+var rockIterPool = sync.Pool{
+	New: func() interface{} {
+		return &rockIterator{}
+	},
+}
+
+type rockIterator struct {
+	*gorocksdb.Iterator
+	snap       *gorocksdb.Snapshot
+	ro         *gorocksdb.ReadOptions
+	db         *gorocksdb.DB
+	upperBound *gorocksdb.IterBound
+	lowerBound *gorocksdb.IterBound
+	limiter    *IteratorLimiter
+}
+
+func (it *rockIterator) RefKey() []byte {
+	return it.Iterator.Key().Data()
+}
+
+func (it *rockIterator) Key() []byte {
+	return it.Iterator.Key().Bytes()
+}
+
+func (it *rockIterator) RefValue() []byte {
+	return it.Iterator.Value().Data()
+}
+
+func (it *rockIterator) Value() []byte {
+	return it.Iterator.Value().Bytes()
+}
+
+func (it *rockIterator) Close() {
+	if it.Iterator != nil {
+		it.Iterator.Close()
+	}
+	if it.ro != nil {
+		it.ro.Destroy()
+	}
+	if it.snap != nil {
+		it.snap.Release()
+	}
+	if it.upperBound != nil {
+		it.upperBound.Destroy()
+	}
+	if it.lowerBound != nil {
+		it.lowerBound.Destroy()
+	}
+	if it.db != nil {
+		it.db.RUnlock()
+	}
+	it.limiter.release()
+	*it = rockIterator{}
+	rockIterPool.Put(it)
+}
@@ -0,0 +1,38 @@
+// +build !cgo norocksdb
+
+package engine
+
+// build without the rocksdb, only the pure go engine is available
+const defaultEngineType = PebbleEngine
+
+type sharedRockConfig struct {
+	wbm *writeBufferManager
+}
+
+func NewSharedRockConfig(opt RockOptions) SharedRockConfig {
+	rc := &sharedRockConfig{}
+	if opt.MemoryBudget > 0 {
+		rc.wbm = newWriteBufferManager(getWriteBufferBudget(opt))
+	}
+	return rc
+}
+
+func (src *sharedRockConfig) Destroy() {
+	if src.wbm != nil {
+		src.wbm.stop()
+	}
+}
+
+func (src *sharedRockConfig) getWriteBufferManager() *writeBufferManager {
+	return src.wbm
+}
+
+func SetPerfLevel(level int) {
+}
+
+func IsPerfEnabledLevel(lv int) bool {
+	return false
+}
+
+func DisablePerfLevel() {
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+const writeBufferCheckInterval = time.Millisecond * 500
+
+// memTableFlusher is the engine which can report the memtable usage and flush the memtables
+type memTableFlusher interface {
+	memTableSize() int64
+	flushMemTable() error
+}
+
+// writeBufferManager limit the total memtable memory of all the engines on the node,
+// the engine using the largest memtables will be flushed if the total exceeds the budget.
+type writeBufferManager struct {
+	sync.Mutex
+	budget int64
+	engs   map[memTableFlusher]struct{}
+	stopC  chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newWriteBufferManager(budget int64) *writeBufferManager {
+	wbm := &writeBufferManager{
+		budget: budget,
+		engs:   make(map[memTableFlusher]struct{}),
+		stopC:  make(chan struct{}),
+	}
+	wbm.wg.Add(1)
+	go func() {
+		defer wbm.wg.Done()
+		wbm.checkLoop()
+	}()
+	return wbm
+}
+
+func (wbm *writeBufferManager) register(eng memTableFlusher) {
+	wbm.Lock()
+	wbm.engs[eng] = struct{}{}
+	wbm.Unlock()
+}
+
+func (wbm *writeBufferManager) unregister(eng memTableFlusher) {
+	wbm.Lock()
+	delete(wbm.engs, eng)
+	wbm.Unlock()
+}
+
+// check the total memtable usage and flush the largest one if exceeded,
+// return the total memtable usage before flush
+func (wbm *writeBufferManager) checkOnce() int64 {
+	wbm.Lock()
+	engs := make([]memTableFlusher, 0, len(wbm.engs))
+	for eng := range wbm.engs {
+		engs = append(engs, eng)
+	}
+	wbm.Unlock()
+
+	var total int64
+	var largest memTableFlusher
+	var largestSize int64
+	for _, eng := range engs {
+		s := eng.memTableSize()
+		total += s
+		if s > largestSize {
+			largest = eng
+			largestSize = s
+		}
+	}
+	if total > wbm.budget && largest != nil {
+		dbLog.Infof("memtables usage %v exceed the budget %v, flushing the largest: %v",
+			total, wbm.budget, largestSize)
+		if err := largest.flushMemTable(); err != nil {
+			dbLog.Infof("flush memtable failed: %v", err)
+		}
+	}
+	return total
+}
+
+func (wbm *writeBufferManager) checkLoop() {
+	ticker := time.NewTicker(writeBufferCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			wbm.checkOnce()
+		case <-wbm.stopC:
+			return
+		}
+	}
+}
+
+func (wbm *writeBufferManager) stop() {
+	close(wbm.stopC)
+	wbm.wg.Wait()
+}
+
+type sharedWriteBufferConfig interface {
+	getWriteBufferManager() *writeBufferManager
+}
+
+// get the write buffer manager shared by all the engines on the node, nil if not enabled
+func getWriteBufferManager(sc SharedRockConfig) *writeBufferManager {
+	if sc == nil {
+		return nil
+	}
+	if c, ok := sc.(sharedWriteBufferConfig); ok {
+		return c.getWriteBufferManager()
+	}
+	return nil
+}
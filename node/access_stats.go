@@ -0,0 +1,210 @@
+package node
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+const (
+	// the max keys tracked for each partition, the least recently accessed key will be evicted if full
+	defaultAccessStatsMaxKeys = 10000
+	// same as the default lfu-log-factor, lfu-decay-time and the initial counter of redis
+	lfuLogFactor    = 10
+	lfuDecayMinutes = 1
+	lfuInitVal      = 5
+)
+
+var errAccessTrackDisabled = errors.New("ERR the key access tracking is disabled, set the " +
+	common.DynConfAccessSampleRate + " to enable it")
+
+// the percent of the key accesses sampled, 0 means disabled
+var accessSampleRate int32
+
+// the time in nanoseconds the access tracking enabled, the tracked keys before it are discarded.
+var accessTrackStartTime int64
+
+func init() {
+	common.RegisterDynamicConfApplier(common.DynConfAccessSampleRate, func(v string) error {
+		if v == "" {
+			SetAccessSampleRate(0)
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		SetAccessSampleRate(n)
+		return nil
+	})
+}
+
+// SetAccessSampleRate set the percent of the key accesses sampled for the OBJECT IDLETIME
+// and FREQ, the access tracking is disabled if the rate is not positive.
+func SetAccessSampleRate(percent int) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	old := atomic.SwapInt32(&accessSampleRate, int32(percent))
+	if old <= 0 && percent > 0 {
+		atomic.StoreInt64(&accessTrackStartTime, time.Now().UnixNano())
+	}
+}
+
+func GetAccessSampleRate() int {
+	return int(atomic.LoadInt32(&accessSampleRate))
+}
+
+type keyAccessInfo struct {
+	lastAccess int64
+	freq       uint8
+}
+
+// decayed return the frequency counter decreased by the idle minutes since the last access
+func (ai keyAccessInfo) decayed(now int64) uint8 {
+	periods := (now - ai.lastAccess) / int64(time.Minute) / lfuDecayMinutes
+	if periods >= int64(ai.freq) {
+		return 0
+	}
+	return ai.freq - uint8(periods)
+}
+
+// the logarithmic counter same as the redis LFU, the more the counter is, the less
+// likely it is increased.
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// AccessStats track the last access time and the access frequency of the sampled keys
+// for the OBJECT IDLETIME and FREQ, the stats are kept in memory only.
+type AccessStats struct {
+	sync.Mutex
+	keys    *simplelru.LRU
+	maxKeys int
+	// the tracking start time of the tracked keys
+	startTime int64
+}
+
+func NewAccessStats(maxKeys int) *AccessStats {
+	if maxKeys <= 0 {
+		maxKeys = defaultAccessStatsMaxKeys
+	}
+	return &AccessStats{
+		maxKeys: maxKeys,
+	}
+}
+
+// Record sample the access of the key (with the namespace prefix)
+func (as *AccessStats) Record(rawKey []byte) {
+	rate := atomic.LoadInt32(&accessSampleRate)
+	if as == nil || rate <= 0 || (rate < 100 && rand.Int31n(100) >= rate) {
+		return
+	}
+	_, key, err := common.ExtractNamesapce(rawKey)
+	if err != nil {
+		return
+	}
+	as.touch(string(key), time.Now().UnixNano())
+}
+
+func (as *AccessStats) touch(key string, now int64) {
+	as.Lock()
+	defer as.Unlock()
+	as.checkStartLocked()
+	if as.keys == nil {
+		as.keys, _ = simplelru.NewLRU(as.maxKeys, nil)
+	}
+	var ai keyAccessInfo
+	if v, ok := as.keys.Get(key); ok {
+		ai = v.(keyAccessInfo)
+		ai.freq = ai.decayed(now)
+	} else {
+		ai.freq = lfuInitVal
+	}
+	ai.freq = lfuLogIncr(ai.freq)
+	ai.lastAccess = now
+	// the least recently accessed key is evicted if full
+	as.keys.Add(key, ai)
+}
+
+func (as *AccessStats) getLocked(key []byte) (keyAccessInfo, bool) {
+	if as.keys == nil {
+		return keyAccessInfo{}, false
+	}
+	v, ok := as.keys.Peek(string(key))
+	if !ok {
+		return keyAccessInfo{}, false
+	}
+	return v.(keyAccessInfo), true
+}
+
+// discard the tracked keys if the tracking is restarted, since the accesses while
+// disabled are not tracked.
+func (as *AccessStats) checkStartLocked() {
+	start := atomic.LoadInt64(&accessTrackStartTime)
+	if as.startTime != start {
+		as.keys = nil
+		as.startTime = start
+	}
+}
+
+// IdleTime return the idle time of the key since the last sampled access, false will be
+// returned if the key is not tracked (not sampled or evicted) since the idle time is unknown.
+func (as *AccessStats) IdleTime(key []byte) (time.Duration, bool, error) {
+	if atomic.LoadInt32(&accessSampleRate) <= 0 {
+		return 0, false, errAccessTrackDisabled
+	}
+	now := time.Now().UnixNano()
+	as.Lock()
+	defer as.Unlock()
+	as.checkStartLocked()
+	ai, ok := as.getLocked(key)
+	if !ok {
+		return 0, false, nil
+	}
+	return time.Duration(now - ai.lastAccess), true, nil
+}
+
+// Freq return the logarithmic access frequency counter of the key, since the accesses
+// are sampled, the counter is only comparable between the keys.
+func (as *AccessStats) Freq(key []byte) (int, error) {
+	if atomic.LoadInt32(&accessSampleRate) <= 0 {
+		return 0, errAccessTrackDisabled
+	}
+	now := time.Now().UnixNano()
+	as.Lock()
+	defer as.Unlock()
+	as.checkStartLocked()
+	if ai, ok := as.getLocked(key); ok {
+		return int(ai.decayed(now)), nil
+	}
+	return 0, nil
+}
+
+// Len return the number of the tracked keys
+func (as *AccessStats) Len() int {
+	as.Lock()
+	defer as.Unlock()
+	if as.keys == nil {
+		return 0
+	}
+	return as.keys.Len()
+}
@@ -0,0 +1,75 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessStats(t *testing.T) {
+	defer SetAccessSampleRate(0)
+	as := NewAccessStats(2)
+	key1 := []byte("default:test:access1")
+	_, _, err := as.IdleTime([]byte("test:access1"))
+	assert.Equal(t, errAccessTrackDisabled, err)
+	_, err = as.Freq([]byte("test:access1"))
+	assert.Equal(t, errAccessTrackDisabled, err)
+	as.Record(key1)
+	assert.Equal(t, 0, as.Len())
+
+	SetAccessSampleRate(100)
+	for i := 0; i < 10; i++ {
+		as.Record(key1)
+	}
+	assert.Equal(t, 1, as.Len())
+	freq, err := as.Freq([]byte("test:access1"))
+	assert.Nil(t, err)
+	assert.True(t, freq > lfuInitVal, "freq should be increased: %v", freq)
+	idle, tracked, err := as.IdleTime([]byte("test:access1"))
+	assert.Nil(t, err)
+	assert.True(t, tracked)
+	assert.True(t, idle < time.Second, "idle time should be small: %v", idle)
+	// the idle time of the key not tracked is unknown
+	_, tracked, err = as.IdleTime([]byte("test:access_none"))
+	assert.Nil(t, err)
+	assert.False(t, tracked)
+	freq, err = as.Freq([]byte("test:access_none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, freq)
+
+	// the least recently accessed key will be evicted if full
+	as.Record([]byte("default:test:access2"))
+	as.Record(key1)
+	as.Record([]byte("default:test:access3"))
+	assert.Equal(t, 2, as.Len())
+	_, tracked, err = as.IdleTime([]byte("test:access2"))
+	assert.Nil(t, err)
+	assert.False(t, tracked)
+	freq, err = as.Freq([]byte("test:access1"))
+	assert.Nil(t, err)
+	assert.True(t, freq > lfuInitVal, "freq should be kept: %v", freq)
+	// the query should not change the access order
+	as.IdleTime([]byte("test:access1"))
+	as.Record([]byte("default:test:access4"))
+	_, tracked, _ = as.IdleTime([]byte("test:access1"))
+	assert.False(t, tracked)
+	_, tracked, _ = as.IdleTime([]byte("test:access3"))
+	assert.True(t, tracked)
+
+	// the decayed counter after the idle minutes
+	ai := keyAccessInfo{lastAccess: time.Now().Add(-time.Minute * 3).UnixNano(), freq: 10}
+	assert.Equal(t, uint8(7), ai.decayed(time.Now().UnixNano()))
+	ai.freq = 2
+	assert.Equal(t, uint8(0), ai.decayed(time.Now().UnixNano()))
+
+	// the tracked keys are discarded after the tracking restarted
+	SetAccessSampleRate(0)
+	time.Sleep(time.Millisecond)
+	SetAccessSampleRate(50)
+	assert.Equal(t, 50, GetAccessSampleRate())
+	freq, err = as.Freq([]byte("test:access3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, freq)
+	assert.Equal(t, 0, as.Len())
+}
@@ -0,0 +1,234 @@
+package node
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
+	"github.com/absolute8511/redcon"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// the batch with less requests will be applied serially since
+	// the cost of dispatching is more than the benefit.
+	minParallelApplyNum = 16
+)
+
+type applyTask struct {
+	isReplaying bool
+	reqList     BatchInternalRaftRequest
+	term        uint64
+	index       uint64
+	stop        chan struct{}
+	done        *sync.WaitGroup
+	// the panic from the worker will be re-panicked in the caller
+	panicErr interface{}
+}
+
+type applyWorker struct {
+	// the worker state machine shares everything with the parent
+	// except the store, which will use a write batch view of the parent store
+	// while applying the task.
+	sm    *kvStoreSM
+	taskC chan *applyTask
+}
+
+// applyWorkerPool applies the raft requests for different primary keys concurrently,
+// the requests with the same primary key will always be dispatched to the same worker
+// so the order for the same key is kept.
+type applyWorkerPool struct {
+	parent  *kvStoreSM
+	workers []*applyWorker
+	stopC   chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newApplyWorkerPool(parent *kvStoreSM, workerNum int) *applyWorkerPool {
+	p := &applyWorkerPool{
+		parent:  parent,
+		workers: make([]*applyWorker, 0, workerNum),
+		stopC:   make(chan struct{}),
+	}
+	for i := 0; i < workerNum; i++ {
+		wsm := &kvStoreSM{
+			fullName:      parent.fullName,
+			store:         &KVStore{opts: parent.store.opts},
+			clusterInfo:   parent.clusterInfo,
+			fullNS:        parent.fullNS,
+			machineConfig: parent.machineConfig,
+			ID:            parent.ID,
+			dbWriteStats:  parent.dbWriteStats,
+			slowLog:       parent.slowLog,
+			w:             parent.w,
+			router:        common.NewSMCmdRouter(),
+			cRouter:       NewConflictRouter(),
+		}
+		wsm.registerHandlers()
+		wsm.registerConflictHandlers()
+		p.workers = append(p.workers, &applyWorker{
+			sm:    wsm,
+			taskC: make(chan *applyTask, 1),
+		})
+	}
+	return p
+}
+
+func (p *applyWorkerPool) Start() {
+	for _, w := range p.workers {
+		p.wg.Add(1)
+		go func(w *applyWorker) {
+			defer p.wg.Done()
+			p.workerLoop(w)
+		}(w)
+	}
+}
+
+func (p *applyWorkerPool) Stop() {
+	select {
+	case <-p.stopC:
+		return
+	default:
+	}
+	close(p.stopC)
+	p.wg.Wait()
+}
+
+func (p *applyWorkerPool) workerLoop(w *applyWorker) {
+	for {
+		select {
+		case t := <-w.taskC:
+			p.applyTask(w, t)
+		case <-p.stopC:
+			return
+		}
+	}
+}
+
+func (p *applyWorkerPool) applyTask(w *applyWorker, t *applyTask) {
+	defer t.done.Done()
+	defer func() {
+		if e := recover(); e != nil {
+			if w.sm.store.RockDB != nil {
+				w.sm.store.DestroyWriteBatchView()
+			}
+			w.sm.store.RockDB = nil
+			t.panicErr = e
+		}
+	}()
+	// the store of parent may be reopened while restoring from snapshot,
+	// so we always get a new view before applying.
+	w.sm.store.RockDB = p.parent.store.NewWriteBatchView()
+	w.sm.ApplyRaftRequest(t.isReplaying, t.reqList, t.term, t.index, t.stop)
+	w.sm.store.DestroyWriteBatchView()
+	w.sm.store.RockDB = nil
+}
+
+// partitionRequests split the batch requests by the primary key, return nil
+// if any of the request can not be applied concurrently.
+func (p *applyWorkerPool) partitionRequests(reqList *BatchInternalRaftRequest) [][]*InternalRaftRequest {
+	if len(reqList.Reqs) < minParallelApplyNum {
+		return nil
+	}
+	parts := make([][]*InternalRaftRequest, len(p.workers))
+	for _, req := range reqList.Reqs {
+		// the request with client id need be applied serially to keep the session
+		if req.Header.DataType != int32(RedisReq) || req.Header.ClientId > 0 {
+			return nil
+		}
+		cmd, err := redcon.Parse(req.Data)
+		if err != nil || len(cmd.Args) < 2 {
+			return nil
+		}
+		if !isParallelApplyCmd(cmd) {
+			return nil
+		}
+		_, pk, err := common.ExtractNamesapce(cmd.Args[1])
+		if err != nil {
+			return nil
+		}
+		if p.hasUniqueIndex(cmd) {
+			return nil
+		}
+		idx := murmur3.Sum32(pk) % uint32(len(parts))
+		parts[idx] = append(parts[idx], req)
+	}
+	return parts
+}
+
+// the unique index value is owned by the first key written, so the hash writes to the
+// table with the unique index should be applied in the raft log order on all the replicas.
+func (p *applyWorkerPool) hasUniqueIndex(cmd redcon.Command) bool {
+	if !strings.EqualFold(string(cmd.Args[0]), "hmset") {
+		return false
+	}
+	if p.parent == nil || p.parent.store == nil || p.parent.store.RockDB == nil {
+		return false
+	}
+	table, _, err := common.ExtractTable(cmd.Args[1])
+	if err != nil {
+		return false
+	}
+	return p.parent.store.HasUniqueHsetIndex(string(table))
+}
+
+// only the batchable write with single key can be applied concurrently, since the
+// other writes may depend on the write batch of the origin db.
+func isParallelApplyCmd(cmd redcon.Command) bool {
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	if !rockredis.IsBatchableWrite(cmdName) {
+		return false
+	}
+	if cmdName == "del" && len(cmd.Args) > 2 {
+		return false
+	}
+	return true
+}
+
+// return false if the requests can not be applied concurrently and the caller
+// should apply them serially.
+func (p *applyWorkerPool) tryApply(isReplaying bool, reqList BatchInternalRaftRequest,
+	term uint64, index uint64, stop chan struct{}) bool {
+	parts := p.partitionRequests(&reqList)
+	if parts == nil {
+		return false
+	}
+	var done sync.WaitGroup
+	tasks := make([]*applyTask, 0, len(parts))
+	for i, reqs := range parts {
+		if len(reqs) == 0 {
+			continue
+		}
+		subList := reqList
+		subList.Reqs = reqs
+		subList.ReqNum = int32(len(reqs))
+		// the whole batch will be notified by the caller
+		subList.ReqId = 0
+		done.Add(1)
+		t := &applyTask{
+			isReplaying: isReplaying,
+			reqList:     subList,
+			term:        term,
+			index:       index,
+			stop:        stop,
+			done:        &done,
+		}
+		select {
+		case p.workers[i].taskC <- t:
+			tasks = append(tasks, t)
+		case <-p.stopC:
+			done.Done()
+			for _, req := range reqs {
+				p.parent.w.Trigger(req.Header.ID, common.ErrStopped)
+			}
+		}
+	}
+	done.Wait()
+	for _, t := range tasks {
+		if t.panicErr != nil {
+			panic(t.panicErr)
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestRedisReq(id uint64, args ...string) *InternalRaftRequest {
+	bargs := make([][]byte, 0, len(args))
+	for _, a := range args {
+		bargs = append(bargs, []byte(a))
+	}
+	cmd := buildCommand(bargs)
+	return &InternalRaftRequest{
+		Header: &RequestHeader{ID: id, DataType: int32(RedisReq)},
+		Data:   cmd.Raw,
+	}
+}
+
+func TestApplyPoolPartitionKeepKeyOrder(t *testing.T) {
+	p := &applyWorkerPool{workers: make([]*applyWorker, 4)}
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("default:test:key%d", i%5)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", key, "v"))
+	}
+	parts := p.partitionRequests(&reqList)
+	assert.Equal(t, 4, len(parts))
+	total := 0
+	keyParts := make(map[string]int)
+	for pi, reqs := range parts {
+		lastID := uint64(0)
+		for _, req := range reqs {
+			// the order in the same partition should be kept
+			assert.True(t, req.Header.ID > lastID)
+			lastID = req.Header.ID
+			key := fmt.Sprintf("key%d", (req.Header.ID-1)%5)
+			if old, ok := keyParts[key]; ok {
+				assert.Equal(t, old, pi)
+			}
+			keyParts[key] = pi
+		}
+		total += len(reqs)
+	}
+	assert.Equal(t, len(reqList.Reqs), total)
+}
+
+func TestApplyPoolPartitionNotParallel(t *testing.T) {
+	p := &applyWorkerPool{workers: make([]*applyWorker, 4)}
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum-1; i++ {
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", "default:test:key", "v"))
+	}
+	// too less requests
+	assert.Nil(t, p.partitionRequests(&reqList))
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(100, "incr", "default:test:key"))
+	// not batchable
+	assert.Nil(t, p.partitionRequests(&reqList))
+	reqList.Reqs[len(reqList.Reqs)-1] = buildTestRedisReq(100, "del", "default:test:key", "default:test:key2")
+	// multi keys
+	assert.Nil(t, p.partitionRequests(&reqList))
+	reqList.Reqs[len(reqList.Reqs)-1] = buildTestRedisReq(100, "del", "default:test:key")
+	assert.NotNil(t, p.partitionRequests(&reqList))
+}
+
+func newTestApplyPool(t *testing.T) (*kvStoreSM, *applyWorkerPool, func()) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	kvsm := nd.sm.(*kvStoreSM)
+	p := newApplyWorkerPool(kvsm, 4)
+	p.Start()
+	return kvsm, p, func() {
+		p.Stop()
+		close(stopC)
+		nd.Stop()
+		os.RemoveAll(dataDir)
+	}
+}
+
+func TestApplyPoolValueCompress(t *testing.T) {
+	kvsm, p, cleanup := newTestApplyPool(t)
+	defer cleanup()
+	err := kvsm.store.SetTableValueCompress("test", &common.ValueCompressSchema{Compression: "zstd", MinValueSize: 128})
+	assert.Nil(t, err)
+
+	bigV := strings.Repeat("compress", 1024)
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("test:compress_key%d", i)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", key, bigV))
+	}
+	reqList.Timestamp = time.Now().UnixNano()
+	assert.True(t, p.tryApply(false, reqList, 1, 1, nil))
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := []byte(fmt.Sprintf("test:compress_key%d", i))
+		v, err := kvsm.store.KVGet(key)
+		assert.Nil(t, err)
+		assert.Equal(t, bigV, string(v))
+		usage, err := kvsm.store.KeyMemoryUsage(key)
+		assert.Nil(t, err)
+		assert.True(t, usage < int64(len(bigV)), "value should be compressed: %v", usage)
+	}
+}
+
+func TestApplyPoolFullTextIndex(t *testing.T) {
+	kvsm, p, cleanup := newTestApplyPool(t)
+	defer cleanup()
+	err := kvsm.store.AddFullTextIndex("test", &common.FullTextIndexSchema{Name: "ft_title", HsetField: "title"})
+	assert.Nil(t, err)
+
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("test:ft_key%d", i)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "hmset", key,
+			"title", fmt.Sprintf("hello world%d", i), "other", "value"))
+	}
+	reqList.Timestamp = time.Now().UnixNano()
+	assert.True(t, p.tryApply(false, reqList, 1, 1, nil))
+	// all the documents written by the parallel workers should be indexed
+	rets, err := kvsm.store.FullTextIndexSearch([]byte("test"), "ft_title", "hello", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, minParallelApplyNum*2, len(rets))
+	rets, err = kvsm.store.FullTextIndexSearch([]byte("test"), "ft_title", "world1", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, []byte("test:ft_key1"), rets[0].PKey)
+}
+
+func TestApplyPoolUniqueIndexSerial(t *testing.T) {
+	kvsm, p, cleanup := newTestApplyPool(t)
+	defer cleanup()
+	err := kvsm.store.AddHsetIndex("test", &common.HsetIndexSchema{
+		Name:       "unique_index",
+		IndexField: "uf",
+		Unique:     common.IndexUniqueReject,
+		ValueType:  common.StringV,
+		State:      common.ReadyIndex,
+	})
+	assert.Nil(t, err)
+
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("test:unique_key%d", i)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "hmset", key, "uf", "same"))
+	}
+	reqList.Timestamp = time.Now().UnixNano()
+	// the writes to the table with the unique index should be applied serially
+	assert.Nil(t, p.partitionRequests(&reqList))
+	assert.False(t, p.tryApply(false, reqList, 1, 1, nil))
+	_, err = kvsm.ApplyRaftRequest(false, reqList, 1, 1, nil)
+	assert.Nil(t, err)
+	// the first key in the raft log order owns the unique value
+	v, err := kvsm.store.HGet([]byte("test:unique_key0"), []byte("uf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "same", string(v))
+	for i := 1; i < minParallelApplyNum*2; i++ {
+		v, err = kvsm.store.HGet([]byte(fmt.Sprintf("test:unique_key%d", i)), []byte("uf"))
+		assert.Nil(t, err)
+		assert.Nil(t, v)
+	}
+
+	// the other tables can still be applied concurrently
+	reqList.Reqs = nil
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("test2:unique_key%d", i)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "hmset", key, "uf", "same"))
+	}
+	assert.NotNil(t, p.partitionRequests(&reqList))
+}
+
+func TestApplyPoolSlowLog(t *testing.T) {
+	old := GetSlowLogThreshold()
+	defer SetSlowLogThreshold(old)
+	SetSlowLogThreshold(time.Millisecond)
+
+	kvsm, p, cleanup := newTestApplyPool(t)
+	defer cleanup()
+	kvsm.slowLog.Reset()
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum*2; i++ {
+		key := fmt.Sprintf("test:slow_key%d", i)
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", key, "v"))
+	}
+	// make the writes slow by the propose cost
+	reqList.Timestamp = time.Now().Add(-time.Second).UnixNano()
+	assert.True(t, p.tryApply(false, reqList, 1, 1, nil))
+	// the slow writes applied by the workers should be recorded in the node slow log
+	entries := kvsm.slowLog.Get(-1)
+	assert.True(t, len(entries) > 0)
+	for _, e := range entries {
+		assert.True(t, e.IsWrite)
+		assert.Equal(t, "set", string(e.Args[0]))
+		assert.True(t, e.ProposeCost >= int64(time.Second/time.Microsecond))
+	}
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+var ErrApplyFailed = errors.New("ERR_APPLY_FAILED: the partition failed to apply raft log and is read only now")
+
+// applyFailure is the info of the raft entry which panic while applying
+type applyFailure struct {
+	Term   uint64
+	Index  uint64
+	Reason string
+}
+
+// applyRaftRequestSafe recover the panic from the state machine, the partition will be marked
+// as apply failed and become read only, so the panic will not crash the other partitions on the node.
+func (nd *KVNode) applyRaftRequestSafe(evnt raftpb.Entry, reqList BatchInternalRaftRequest, isReplaying bool) (forceBackup bool, retErr error) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			n := runtime.Stack(buf, false)
+			buf = buf[0:n]
+			reason := fmt.Sprintf("%v", e)
+			forceBackup = false
+			retErr = ErrApplyFailed
+			// the writes batched before the panic should not be committed by the later entries,
+			// which may be applied if the entry is skipped in the repair mode
+			if kvsm, ok := nd.sm.(*kvStoreSM); ok {
+				kvsm.abortBatch()
+			}
+			if nd.repair != nil && nd.repair.isAcked(evnt.Term, evnt.Index) {
+				nd.rn.Errorf("apply raft entry (%v-%v) panic: %s:%v, skipped since acknowledged in repair mode, entry: %v",
+					evnt.Term, evnt.Index, buf, e, reqList.String())
+				nd.reportRepairEntry(evnt.Term, evnt.Index, reason, true)
+				nd.notifyApplyResult(&reqList, ErrApplyFailed)
+				return
+			}
+			nd.rn.Errorf("apply raft entry (%v-%v) panic: %s:%v, the partition will be read only, entry: %v",
+				evnt.Term, evnt.Index, buf, e, reqList.String())
+			nd.reportRepairEntry(evnt.Term, evnt.Index, reason, false)
+			nd.markApplyFailed(evnt, &reqList, reason)
+		}
+	}()
+	return nd.sm.ApplyRaftRequest(isReplaying, reqList, evnt.Term, evnt.Index, nd.stopChan)
+}
+
+// abortBatch discard all the writes in the write batch and reset the batching state
+func (kvsm *kvStoreSM) abortBatch() {
+	if kvsm.store == nil || kvsm.store.RockDB == nil {
+		return
+	}
+	kvsm.store.AbortBatchWrite()
+}
+
+func (nd *KVNode) markApplyFailed(evnt raftpb.Entry, reqList *BatchInternalRaftRequest, reason string) {
+	nd.applyFailure.Store(&applyFailure{
+		Term:   evnt.Term,
+		Index:  evnt.Index,
+		Reason: reason,
+	})
+	atomic.StoreInt32(&nd.applyFailed, 1)
+	nd.notifyApplyResult(reqList, ErrApplyFailed)
+}
+
+func (nd *KVNode) notifyApplyResult(reqList *BatchInternalRaftRequest, err error) {
+	for _, req := range reqList.Reqs {
+		if req != nil && req.Header != nil && req.Header.ID > 0 && nd.w.IsRegistered(req.Header.ID) {
+			nd.w.Trigger(req.Header.ID, err)
+		}
+	}
+	if reqList.ReqId > 0 {
+		nd.w.Trigger(reqList.ReqId, err)
+	}
+}
+
+// IsApplyFailed return true if any raft entry failed to apply, all the later
+// entries will not be applied and the partition can only serve the read.
+func (nd *KVNode) IsApplyFailed() bool {
+	return atomic.LoadInt32(&nd.applyFailed) == 1
+}
+
+func (nd *KVNode) getApplyFailure() *applyFailure {
+	f, _ := nd.applyFailure.Load().(*applyFailure)
+	return f
+}
@@ -0,0 +1,157 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPanicKey = "test:panic_key"
+
+// setTestPanicRouter make the set command panic while writing the test panic key
+func setTestPanicRouter(kvsm *kvStoreSM) {
+	old := kvsm.router
+	r := common.NewSMCmdRouter()
+	for _, name := range old.GetInternalCmdNames() {
+		h, _ := old.GetInternalCmdHandler(name)
+		if name == "set" {
+			origin := h
+			h = func(cmd redcon.Command, ts int64) (interface{}, error) {
+				if string(cmd.Args[1]) == testPanicKey {
+					panic("test apply panic")
+				}
+				return origin(cmd, ts)
+			}
+		}
+		r.RegisterInternal(name, h)
+	}
+	kvsm.router = r
+}
+
+func TestApplyPanicAbortBatch(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	kvsm := nd.sm.(*kvStoreSM)
+	setTestPanicRouter(kvsm)
+
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:batched_key", "v"),
+		buildTestRedisReq(2, "set", testPanicKey, "v"))
+	reqList.Timestamp = time.Now().UnixNano()
+	_, err := nd.applyRaftRequestSafe(raftpb.Entry{Term: 1, Index: 1000}, reqList, false)
+	assert.Equal(t, ErrApplyFailed, err)
+	assert.True(t, nd.IsApplyFailed())
+
+	// the write batched before the panic should be discarded
+	reqList.Reqs = []*InternalRaftRequest{buildTestRedisReq(3, "set", "test:next_key", "v")}
+	_, err = kvsm.ApplyRaftRequest(false, reqList, 1, 1001, nil)
+	assert.Nil(t, err)
+	v, err := kvsm.store.KVGet([]byte("test:next_key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+	v, err = kvsm.store.KVGet([]byte("test:batched_key"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestApplyPoolPanicAbortBatch(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	kvsm := nd.sm.(*kvStoreSM)
+	p := newApplyWorkerPool(kvsm, 4)
+	for _, w := range p.workers {
+		setTestPanicRouter(w.sm)
+	}
+	p.Start()
+	defer p.Stop()
+	kvsm.applyPool = p
+	defer func() {
+		kvsm.applyPool = nil
+	}()
+
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < minParallelApplyNum; i++ {
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", fmt.Sprintf("test:pool_key%d", i), "v"))
+	}
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(100, "set", testPanicKey, "v"))
+	reqList.Timestamp = time.Now().UnixNano()
+	_, err := nd.applyRaftRequestSafe(raftpb.Entry{Term: 1, Index: 1000}, reqList, false)
+	assert.Equal(t, ErrApplyFailed, err)
+	assert.True(t, nd.IsApplyFailed())
+	for _, w := range p.workers {
+		assert.Nil(t, w.sm.store.RockDB)
+	}
+
+	// the workers should still work after the panic
+	reqList.Reqs = nil
+	for i := 0; i < minParallelApplyNum; i++ {
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", fmt.Sprintf("test:pool_next_key%d", i), "v"))
+	}
+	_, err = kvsm.ApplyRaftRequest(false, reqList, 1, 1001, nil)
+	assert.Nil(t, err)
+	for i := 0; i < minParallelApplyNum; i++ {
+		v, err := kvsm.store.KVGet([]byte(fmt.Sprintf("test:pool_next_key%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "v", string(v))
+	}
+	// the serial apply should not commit anything from the failed batch
+	reqList.Reqs = []*InternalRaftRequest{buildTestRedisReq(200, "set", "test:serial_key", "v")}
+	_, err = kvsm.ApplyRaftRequest(false, reqList, 1, 1002, nil)
+	assert.Nil(t, err)
+	v, err := kvsm.store.KVGet([]byte(testPanicKey))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestApplyPanicSkippedInRepairMode(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	kvsm := nd.sm.(*kvStoreSM)
+	setTestPanicRouter(kvsm)
+	nd.repair = newRaftRepairReport(dataDir, nd.ns, []string{RaftRepairAckKey(nd.ns, 1, 1000)})
+
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:repair_batched_key", "v"),
+		buildTestRedisReq(2, "set", testPanicKey, "v"))
+	reqList.Timestamp = time.Now().UnixNano()
+	_, err := nd.applyRaftRequestSafe(raftpb.Entry{Term: 1, Index: 1000}, reqList, false)
+	assert.Equal(t, ErrApplyFailed, err)
+	// the acknowledged entry is skipped and the later entries can be applied
+	assert.False(t, nd.IsApplyFailed())
+	entries := nd.repair.getEntries()
+	assert.Equal(t, 1, len(entries))
+	assert.True(t, entries[0].Skipped)
+
+	reqList.Reqs = []*InternalRaftRequest{buildTestRedisReq(3, "set", "test:repair_next_key", "v"),
+		buildTestRedisReq(4, "set", "test:repair_next_key2", "v")}
+	_, err = nd.applyRaftRequestSafe(raftpb.Entry{Term: 1, Index: 1001}, reqList, false)
+	assert.Nil(t, err)
+	v, err := kvsm.store.KVGet([]byte("test:repair_next_key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+	v, err = kvsm.store.KVGet([]byte("test:repair_next_key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+	// the write batched before the panic should not be committed with the later entries
+	v, err = kvsm.store.KVGet([]byte("test:repair_batched_key"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	// the not acknowledged entry still make the partition read only
+	reqList.Reqs = []*InternalRaftRequest{buildTestRedisReq(5, "set", testPanicKey, "v")}
+	_, err = nd.applyRaftRequestSafe(raftpb.Entry{Term: 1, Index: 1002}, reqList, false)
+	assert.Equal(t, ErrApplyFailed, err)
+	assert.True(t, nd.IsApplyFailed())
+}
@@ -0,0 +1,242 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+)
+
+const (
+	defaultAuditLogMaxSize    = 100 * 1024 * 1024
+	defaultAuditLogMaxBackups = 10
+	defaultAuditLogBufferLen  = 10000
+)
+
+// AuditRecord is the record for each applied write
+type AuditRecord struct {
+	// unix time in nanoseconds while the write is applied
+	Timestamp  int64  `json:"timestamp"`
+	Namespace  string `json:"namespace"`
+	Table      string `json:"table"`
+	Command    string `json:"command"`
+	Key        string `json:"key"`
+	ClientAddr string `json:"client_addr"`
+	Term       uint64 `json:"term"`
+	Index      uint64 `json:"index"`
+}
+
+// AuditSink is the destination for the audit records, it should be safe
+// for concurrent use since all the partitions will write to the same sink.
+type AuditSink interface {
+	Write(r *AuditRecord) error
+	Close() error
+}
+
+func newAuditRecord(fullNS string, cmd redcon.Command, clientAddr string, term uint64, index uint64) *AuditRecord {
+	r := &AuditRecord{
+		Timestamp:  time.Now().UnixNano(),
+		Namespace:  fullNS,
+		Command:    strings.ToLower(string(cmd.Args[0])),
+		ClientAddr: clientAddr,
+		Term:       term,
+		Index:      index,
+	}
+	if len(cmd.Args) > 1 {
+		_, pk, err := common.ExtractNamesapce(cmd.Args[1])
+		if err == nil {
+			table, key, err := common.ExtractTable(pk)
+			if err == nil {
+				r.Table = string(table)
+				r.Key = string(key)
+			} else {
+				r.Key = string(pk)
+			}
+		}
+	}
+	return r
+}
+
+// FileAuditSink write the audit records as json lines into the file, the file will
+// be rotated if the size exceeds the max size and only the recent max backups will be kept.
+// The records are buffered and written in background so the raft apply will never be
+// blocked by the disk, the records will be dropped if the buffer is full.
+type FileAuditSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	dataC      chan []byte
+	stopC      chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+	droppedCnt int64
+	// only accessed in the write loop
+	f        *os.File
+	size     int64
+	closeErr error
+	// used to rename the file while rotating, replaced in test
+	rename func(string, string) error
+}
+
+func NewFileAuditSink(path string, maxSize int64, maxBackups int) (*FileAuditSink, error) {
+	if maxSize <= 0 {
+		maxSize = defaultAuditLogMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultAuditLogMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(path), common.DIR_PERM); err != nil {
+		return nil, err
+	}
+	s := &FileAuditSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		dataC:      make(chan []byte, defaultAuditLogBufferLen),
+		stopC:      make(chan struct{}),
+		rename:     os.Rename,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.writeLoop()
+	}()
+	return s, nil
+}
+
+func (s *FileAuditSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.size = fi.Size()
+	return nil
+}
+
+func (s *FileAuditSink) Write(r *AuditRecord) error {
+	d, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	d = append(d, '\n')
+	select {
+	case <-s.stopC:
+		return common.ErrStopped
+	default:
+	}
+	select {
+	case s.dataC <- d:
+	default:
+		atomic.AddInt64(&s.droppedCnt, 1)
+	}
+	return nil
+}
+
+// DroppedCount return the number of the records dropped since the buffer is full
+func (s *FileAuditSink) DroppedCount() int64 {
+	return atomic.LoadInt64(&s.droppedCnt)
+}
+
+func (s *FileAuditSink) writeLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastDropped int64
+	for {
+		select {
+		case d := <-s.dataC:
+			s.writeData(d)
+		case <-ticker.C:
+			dropped := atomic.LoadInt64(&s.droppedCnt)
+			if dropped != lastDropped {
+				nodeLog.Warningf("audit log buffer full, %v records dropped (total %v)",
+					dropped-lastDropped, dropped)
+				lastDropped = dropped
+			}
+		case <-s.stopC:
+			// write all the buffered records before closing
+			for {
+				select {
+				case d := <-s.dataC:
+					s.writeData(d)
+				default:
+					if s.f != nil {
+						s.closeErr = s.f.Close()
+						s.f = nil
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *FileAuditSink) writeData(d []byte) {
+	if s.f == nil {
+		// the file failed to open after the last rotate, retry
+		if err := s.open(); err != nil {
+			nodeLog.Errorf("audit log %v can not be opened, record dropped: %v", s.path, err)
+			atomic.AddInt64(&s.droppedCnt, 1)
+			return
+		}
+	}
+	if s.size > 0 && s.size+int64(len(d)) > s.maxSize {
+		s.rotate()
+		if s.f == nil {
+			atomic.AddInt64(&s.droppedCnt, 1)
+			return
+		}
+	}
+	n, err := s.f.Write(d)
+	s.size += int64(n)
+	if err != nil {
+		nodeLog.Errorf("failed to write audit log %v: %v", s.path, err)
+	}
+}
+
+func (s *FileAuditSink) rotate() {
+	s.f.Close()
+	s.f = nil
+	backup := fmt.Sprintf("%s.%s", s.path, time.Now().Format("20060102-150405.000000"))
+	if err := s.rename(s.path, backup); err != nil {
+		// keep writing the old file even if it exceeds the max size
+		nodeLog.Errorf("failed to rotate audit log %v, keep writing the old file: %v", s.path, err)
+	} else {
+		backups, _ := filepath.Glob(s.path + ".*")
+		if len(backups) > s.maxBackups {
+			// the time suffix make sure the older backups sorted first
+			sort.Strings(backups)
+			for _, old := range backups[:len(backups)-s.maxBackups] {
+				os.Remove(old)
+			}
+		}
+	}
+	if err := s.open(); err != nil {
+		nodeLog.Errorf("failed to open audit log %v after rotate: %v", s.path, err)
+	}
+}
+
+// Close flush all the buffered records and close the file
+func (s *FileAuditSink) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stopC)
+	})
+	s.wg.Wait()
+	return s.closeErr
+}
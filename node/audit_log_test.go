@@ -0,0 +1,91 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestAuditRecords(t *testing.T, logPath string) []AuditRecord {
+	f, err := os.Open(logPath)
+	assert.Nil(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var records []AuditRecord
+	for scanner.Scan() {
+		var r AuditRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestFileAuditSinkRotate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "audit-test-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	logPath := filepath.Join(tmpDir, "audit", "audit.log")
+	sink, err := NewFileAuditSink(logPath, 512, 2)
+	assert.Nil(t, err)
+
+	cmd := buildCommand([][]byte{[]byte("SET"), []byte("default:test:key1"), []byte("v")})
+	r := newAuditRecord("default-0", cmd, "127.0.0.1:1234", 2, 10)
+	assert.Equal(t, "set", r.Command)
+	assert.Equal(t, "test", r.Table)
+	assert.Equal(t, "key1", r.Key)
+	for i := 0; i < 30; i++ {
+		r.Index = uint64(i)
+		assert.Nil(t, sink.Write(r))
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, sink.Close())
+	backups, _ := filepath.Glob(logPath + ".*")
+	assert.Equal(t, 2, len(backups))
+
+	records := readTestAuditRecords(t, logPath)
+	last := records[len(records)-1]
+	assert.Equal(t, uint64(29), last.Index)
+	assert.Equal(t, uint64(2), last.Term)
+	assert.Equal(t, "127.0.0.1:1234", last.ClientAddr)
+	assert.Equal(t, "default-0", last.Namespace)
+	assert.Equal(t, common.ErrStopped, sink.Write(r))
+	assert.Equal(t, int64(0), sink.DroppedCount())
+}
+
+func TestFileAuditSinkRotateFailed(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "audit-test-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	logPath := filepath.Join(tmpDir, "audit.log")
+	sink, err := NewFileAuditSink(logPath, 512, 2)
+	assert.Nil(t, err)
+	sink.rename = func(string, string) error {
+		return errors.New("rename failed")
+	}
+
+	cmd := buildCommand([][]byte{[]byte("SET"), []byte("default:test:key1"), []byte("v")})
+	r := newAuditRecord("default-0", cmd, "127.0.0.1:1234", 2, 10)
+	for i := 0; i < 30; i++ {
+		r.Index = uint64(i)
+		assert.Nil(t, sink.Write(r))
+	}
+	assert.Nil(t, sink.Close())
+	// all the records should be kept in the old file
+	backups, _ := filepath.Glob(logPath + ".*")
+	assert.Equal(t, 0, len(backups))
+	records := readTestAuditRecords(t, logPath)
+	assert.Equal(t, 30, len(records))
+	for i, rec := range records {
+		assert.Equal(t, uint64(i), rec.Index)
+	}
+	assert.Equal(t, int64(0), sink.DroppedCount())
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	defaultMaxApplyBacklog     = 100000
+	defaultMaxPendingProposals = 20000
+	defaultBackpressureWait    = time.Millisecond * 100
+	backpressureCheckInterval  = time.Millisecond * 5
+)
+
+var ErrWriteBackpressure = errors.New("ERR_BACKPRESSURE: too many writes waiting to be applied, retry later")
+
+// getApplyBacklog return the number of the committed logs waiting to be applied
+func (nd *KVNode) getApplyBacklog() uint64 {
+	published := atomic.LoadUint64(&nd.rn.publishedIndex)
+	applied := atomic.LoadUint64(&nd.appliedIndex)
+	if published > applied {
+		return published - applied
+	}
+	return 0
+}
+
+func (nd *KVNode) isWriteOverloaded() bool {
+	maxBacklog := nd.machineConfig.MaxApplyBacklog
+	if maxBacklog == 0 {
+		maxBacklog = defaultMaxApplyBacklog
+	}
+	maxPending := nd.machineConfig.MaxPendingProposals
+	if maxPending == 0 {
+		maxPending = defaultMaxPendingProposals
+	}
+	if maxBacklog > 0 && nd.getApplyBacklog() > uint64(maxBacklog) {
+		return true
+	}
+	if maxPending > 0 && atomic.LoadInt64(&nd.pendingProposals) > maxPending {
+		return true
+	}
+	return false
+}
+
+// checkWriteBackpressure delay the new write while the apply backlog or the pending proposals exceed the
+// limit, and reject it if still overloaded after the wait, so the memory and latency will not grow unboundedly.
+func (nd *KVNode) checkWriteBackpressure() error {
+	if !nd.isWriteOverloaded() {
+		return nil
+	}
+	wait := time.Duration(nd.machineConfig.BackpressureWaitMs) * time.Millisecond
+	if wait == 0 {
+		wait = defaultBackpressureWait
+	}
+	if wait > 0 {
+		atomic.AddInt64(&nd.backpressureDelayed, 1)
+		ticker := time.NewTicker(backpressureCheckInterval)
+		defer ticker.Stop()
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+	waitLoop:
+		for {
+			select {
+			case <-ticker.C:
+				if !nd.isWriteOverloaded() {
+					return nil
+				}
+			case <-timeout.C:
+				break waitLoop
+			case <-nd.stopChan:
+				return common.ErrStopped
+			}
+		}
+	}
+	atomic.AddInt64(&nd.backpressureRejected, 1)
+	return ErrWriteBackpressure
+}
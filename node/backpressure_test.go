@@ -0,0 +1,48 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBackpressure(t *testing.T) {
+	nd := &KVNode{
+		rn:       &raftNode{},
+		stopChan: make(chan struct{}),
+		machineConfig: &MachineConfig{
+			MaxApplyBacklog:     100,
+			MaxPendingProposals: 10,
+			BackpressureWaitMs:  50,
+		},
+	}
+	assert.Nil(t, nd.checkWriteBackpressure())
+
+	atomic.StoreUint64(&nd.rn.publishedIndex, 200)
+	atomic.StoreUint64(&nd.appliedIndex, 50)
+	assert.Equal(t, uint64(150), nd.getApplyBacklog())
+	start := time.Now()
+	assert.Equal(t, ErrWriteBackpressure, nd.checkWriteBackpressure())
+	assert.True(t, time.Since(start) >= time.Millisecond*50)
+	assert.Equal(t, int64(1), nd.backpressureRejected)
+
+	// the write should pass once the apply catch up while waiting
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		atomic.StoreUint64(&nd.appliedIndex, 150)
+	}()
+	assert.Nil(t, nd.checkWriteBackpressure())
+	assert.Equal(t, int64(2), nd.backpressureDelayed)
+	assert.Equal(t, int64(1), nd.backpressureRejected)
+
+	atomic.StoreInt64(&nd.pendingProposals, 11)
+	nd.machineConfig.BackpressureWaitMs = -1
+	start = time.Now()
+	assert.Equal(t, ErrWriteBackpressure, nd.checkWriteBackpressure())
+	assert.True(t, time.Since(start) < time.Millisecond*50)
+
+	nd.machineConfig.MaxPendingProposals = -1
+	assert.Nil(t, nd.checkWriteBackpressure())
+}
@@ -0,0 +1,254 @@
+package node
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
+)
+
+var (
+	errBackupTargetNotConfigured = errors.New("no backup target configured")
+	errBackupTimeout             = errors.New("wait backup timeout")
+)
+
+type BackupUploadStats struct {
+	LastTerm    uint64    `json:"last_term"`
+	LastIndex   uint64    `json:"last_index"`
+	LastTime    time.Time `json:"last_time"`
+	LastError   string    `json:"last_error"`
+	Uploading   bool      `json:"uploading"`
+	UploadedNum int64     `json:"uploaded_num"`
+}
+
+type backupUploadReq struct {
+	term  uint64
+	index uint64
+	bi    *rockredis.BackupInfo
+}
+
+// backupUploader upload the local checkpoint to the backup target, only the leader will
+// upload to avoid the same data uploaded by all the replicas.
+type backupUploader struct {
+	node        *KVNode
+	driver      common.BackupDriver
+	minInterval time.Duration
+	reqC        chan backupUploadReq
+	// upload the next backup even in the min interval
+	forceNext  int32
+	lastUpload int64
+	statsMutex sync.Mutex
+	stats      BackupUploadStats
+}
+
+func newBackupUploader(node *KVNode, driver common.BackupDriver, minIntervalSec int) *backupUploader {
+	return &backupUploader{
+		node:        node,
+		driver:      driver,
+		minInterval: time.Duration(minIntervalSec) * time.Second,
+		reqC:        make(chan backupUploadReq, 1),
+	}
+}
+
+func (bu *backupUploader) setForceNext() {
+	atomic.StoreInt32(&bu.forceNext, 1)
+}
+
+// called after the local backup began, the upload will be ignored if there is uploading
+func (bu *backupUploader) onBackup(term uint64, index uint64, bi *rockredis.BackupInfo) {
+	if atomic.LoadInt32(&bu.forceNext) == 0 &&
+		time.Since(time.Unix(0, atomic.LoadInt64(&bu.lastUpload))) < bu.minInterval {
+		return
+	}
+	select {
+	case bu.reqC <- backupUploadReq{term: term, index: index, bi: bi}:
+	default:
+	}
+}
+
+func (bu *backupUploader) GetStats() BackupUploadStats {
+	bu.statsMutex.Lock()
+	defer bu.statsMutex.Unlock()
+	return bu.stats
+}
+
+func (bu *backupUploader) run(stop chan struct{}) {
+	for {
+		select {
+		case req := <-bu.reqC:
+			bu.handleUpload(req, stop)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (bu *backupUploader) handleUpload(req backupUploadReq, stop chan struct{}) {
+	rsp, err := req.bi.GetResult()
+	if err != nil {
+		return
+	}
+	if !bu.node.IsLead() {
+		return
+	}
+	atomic.StoreInt32(&bu.forceNext, 0)
+	bu.statsMutex.Lock()
+	bu.stats.Uploading = true
+	bu.statsMutex.Unlock()
+	start := time.Now()
+	err = bu.upload(req, string(rsp), stop)
+	bu.statsMutex.Lock()
+	bu.stats.Uploading = false
+	if err != nil {
+		bu.stats.LastError = err.Error()
+	} else {
+		bu.stats.LastError = ""
+		bu.stats.LastTerm = req.term
+		bu.stats.LastIndex = req.index
+		bu.stats.LastTime = start
+		bu.stats.UploadedNum++
+	}
+	bu.statsMutex.Unlock()
+	if err != nil {
+		bu.node.rn.Infof("upload backup %v-%v failed: %v", req.term, req.index, err)
+		return
+	}
+	atomic.StoreInt64(&bu.lastUpload, start.UnixNano())
+	bu.node.rn.Infof("upload backup %v-%v done, cost: %v", req.term, req.index, time.Since(start))
+	err = bu.driver.PurgeExpired(bu.node.ns)
+	if err != nil {
+		bu.node.rn.Infof("purge expired backup failed: %v", err)
+	}
+}
+
+func (bu *backupUploader) upload(req backupUploadReq, ckDir string, stop chan struct{}) error {
+	return bu.node.uploadBackup(bu.driver, req.term, req.index, ckDir, stop)
+}
+
+func (nd *KVNode) uploadBackup(driver common.BackupDriver, term uint64, index uint64,
+	ckDir string, stop chan struct{}) error {
+	// link the checkpoint files to avoid purged while uploading
+	uploadDir := path.Join(nd.store.GetBackupDir(), "upload", path.Base(ckDir))
+	os.RemoveAll(uploadDir)
+	defer os.RemoveAll(uploadDir)
+	err := os.MkdirAll(uploadDir, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(ckDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		err = os.Link(path.Join(ckDir, f.Name()), path.Join(uploadDir, f.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	encrypted, err := common.IsEncryptedSnapDir(uploadDir)
+	if err != nil {
+		return err
+	}
+	meta := &common.BackupMeta{
+		Namespace: nd.ns,
+		Term:      term,
+		Index:     index,
+		Encrypted: encrypted,
+	}
+	return driver.Upload(meta, uploadDir, stop)
+}
+
+// ForceBackupUpload propose the backup to all the replicas and upload the backup
+// of the leader to the backup target.
+func (nd *KVNode) ForceBackupUpload() error {
+	if nd.backupUploader == nil {
+		return errBackupTargetNotConfigured
+	}
+	nd.backupUploader.setForceNext()
+	return nd.proposeForceBackup()
+}
+
+// BackupAndWait propose the backup to all the replicas and wait until the local backup done,
+// return the term and index of the backup.
+func (nd *KVNode) BackupAndWait(timeout time.Duration) (uint64, uint64, error) {
+	if nd.store == nil {
+		return 0, 0, errors.New("no local backup for learner")
+	}
+	// the backup after the committed index should contain all the data before the request
+	minIndex := nd.GetCommittedIndex()
+	if nd.backupUploader != nil {
+		nd.backupUploader.setForceNext()
+	}
+	err := nd.proposeForceBackup()
+	if err != nil {
+		return 0, 0, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		term, index, err := nd.store.GetLatestBackup()
+		if err == nil && index > minIndex {
+			ok, _ := nd.store.IsLocalBackupOK(term, index)
+			if ok {
+				return term, index, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return 0, 0, errBackupTimeout
+		}
+		select {
+		case <-nd.stopChan:
+			return 0, 0, common.ErrStopped
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
+
+// BackupToTarget backup all the replicas and upload the backup of this leader to the
+// given backup target, the expired backups in the target will be purged after uploaded.
+func (nd *KVNode) BackupToTarget(conf common.BackupTargetConfig, timeout time.Duration) (uint64, uint64, error) {
+	driver, err := common.NewBackupDriver(conf)
+	if err != nil {
+		return 0, 0, err
+	}
+	term, index, err := nd.BackupAndWait(timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	ckDir := path.Join(nd.store.GetBackupDir(), rockredis.GetCheckpointDir(term, index))
+	err = nd.uploadBackup(driver, term, index, ckDir, nd.stopChan)
+	if err != nil {
+		nd.rn.Infof("upload backup %v-%v to target %v failed: %v", term, index, conf.Type, err)
+		return 0, 0, err
+	}
+	nd.rn.Infof("upload backup %v-%v to target %v done, cost: %v", term, index, conf.Type, time.Since(start))
+	err = driver.PurgeExpired(nd.ns)
+	if err != nil {
+		nd.rn.Infof("purge expired backup failed: %v", err)
+	}
+	return term, index, nil
+}
+
+// ListRemoteBackups list the backups uploaded to the backup target
+func (nd *KVNode) ListRemoteBackups() ([]common.BackupMeta, error) {
+	if nd.backupUploader == nil {
+		return nil, errBackupTargetNotConfigured
+	}
+	return nd.backupUploader.driver.List(nd.ns)
+}
+
+func (nd *KVNode) GetBackupUploadStats() (BackupUploadStats, error) {
+	if nd.backupUploader == nil {
+		return BackupUploadStats{}, errBackupTargetNotConfigured
+	}
+	return nd.backupUploader.GetStats(), nil
+}
@@ -0,0 +1,250 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	maxClientSessionNum  = 10000
+	clientSessionTimeout = time.Hour
+)
+
+var errStaleClientRequest = errors.New("the client request is older than the last applied")
+
+// ClientRequestID can be set to the redis connection context by the client
+// before the write command, and the retried write with the same id will be applied only once.
+type ClientRequestID struct {
+	ClientID uint64
+	Seq      uint64
+}
+
+type clientSession struct {
+	lastSeq    uint64
+	lastRsp    interface{}
+	lastErr    error
+	lastIndex  uint64
+	lastActive int64
+}
+
+// ClientSessionState is the client session saved in the snapshot
+type ClientSessionState struct {
+	ClientID   uint64          `json:"client_id"`
+	LastSeq    uint64          `json:"last_seq"`
+	LastIndex  uint64          `json:"last_index"`
+	LastActive int64           `json:"last_active"`
+	LastRsp    *ClientRspValue `json:"last_rsp,omitempty"`
+	LastErr    string          `json:"last_err,omitempty"`
+}
+
+// ClientRspValue keep the type of the cached response across the json encoding
+type ClientRspValue struct {
+	Type  string            `json:"type"`
+	Int   int64             `json:"int,omitempty"`
+	Float float64           `json:"float,omitempty"`
+	Bytes []byte            `json:"bytes,omitempty"`
+	List  []*ClientRspValue `json:"list,omitempty"`
+}
+
+func encodeClientRsp(rsp interface{}) (*ClientRspValue, error) {
+	switch v := rsp.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return &ClientRspValue{Type: "int64", Int: v}, nil
+	case int:
+		return &ClientRspValue{Type: "int", Int: int64(v)}, nil
+	case float64:
+		return &ClientRspValue{Type: "float64", Float: v}, nil
+	case string:
+		return &ClientRspValue{Type: "string", Bytes: []byte(v)}, nil
+	case []byte:
+		return &ClientRspValue{Type: "bytes", Bytes: v}, nil
+	case [][]byte:
+		rv := &ClientRspValue{Type: "bytes_list"}
+		for _, b := range v {
+			rv.List = append(rv.List, &ClientRspValue{Type: "bytes", Bytes: b})
+		}
+		return rv, nil
+	case []interface{}:
+		rv := &ClientRspValue{Type: "list"}
+		for _, e := range v {
+			ev, err := encodeClientRsp(e)
+			if err != nil {
+				return nil, err
+			}
+			rv.List = append(rv.List, ev)
+		}
+		return rv, nil
+	}
+	return nil, fmt.Errorf("unsupported client response type: %T", rsp)
+}
+
+func decodeClientRsp(rv *ClientRspValue) (interface{}, error) {
+	if rv == nil {
+		return nil, nil
+	}
+	switch rv.Type {
+	case "int64":
+		return rv.Int, nil
+	case "int":
+		return int(rv.Int), nil
+	case "float64":
+		return rv.Float, nil
+	case "string":
+		return string(rv.Bytes), nil
+	case "bytes":
+		return rv.Bytes, nil
+	case "bytes_list":
+		l := make([][]byte, 0, len(rv.List))
+		for _, e := range rv.List {
+			var b []byte
+			if e != nil {
+				b = e.Bytes
+			}
+			l = append(l, b)
+		}
+		return l, nil
+	case "list":
+		l := make([]interface{}, 0, len(rv.List))
+		for _, e := range rv.List {
+			ev, err := decodeClientRsp(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, ev)
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("unsupported client response type: %v", rv.Type)
+}
+
+// clientSessionTable is used to dedup the retried client requests (after timeout or
+// leader changed) while applying. Only the result of the last request for each client
+// will be cached, so the client should use increasing sequence and should
+// not retry the older request after a newer one is sent.
+// The sessions are saved in the snapshot, so all the replicas (including the one restored
+// from snapshot) will have the same sessions at the same applied index.
+type clientSessionTable struct {
+	sessions map[uint64]*clientSession
+}
+
+func newClientSessionTable() *clientSessionTable {
+	return &clientSessionTable{
+		sessions: make(map[uint64]*clientSession),
+	}
+}
+
+// CheckApplied return the cached result if the request has been already applied
+func (t *clientSessionTable) CheckApplied(clientID uint64, seq uint64) (interface{}, error, bool) {
+	s, ok := t.sessions[clientID]
+	if !ok {
+		return nil, nil, false
+	}
+	if seq == s.lastSeq {
+		return s.lastRsp, s.lastErr, true
+	}
+	if seq < s.lastSeq {
+		return nil, errStaleClientRequest, true
+	}
+	return nil, nil, false
+}
+
+// Record save the result of the request, the index and ts should be from the raft
+// entry so all the replicas can expire the session in the same way.
+func (t *clientSessionTable) Record(clientID uint64, seq uint64, index uint64, ts int64, rsp interface{}, err error) {
+	s, ok := t.sessions[clientID]
+	if !ok {
+		if len(t.sessions) >= maxClientSessionNum {
+			t.expire(ts)
+		}
+		s = &clientSession{}
+		t.sessions[clientID] = s
+	}
+	s.lastSeq = seq
+	s.lastRsp = rsp
+	s.lastErr = err
+	s.lastIndex = index
+	s.lastActive = ts
+}
+
+// expire remove the timeout sessions, and the least recently applied session
+// (ordered by the last index and then the client id) if the table is still full.
+func (t *clientSessionTable) expire(ts int64) {
+	ids := make([]uint64, 0, len(t.sessions))
+	for id, s := range t.sessions {
+		if ts-s.lastActive > clientSessionTimeout.Nanoseconds() {
+			delete(t.sessions, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(t.sessions) < maxClientSessionNum {
+		return
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		si := t.sessions[ids[i]]
+		sj := t.sessions[ids[j]]
+		if si.lastIndex != sj.lastIndex {
+			return si.lastIndex < sj.lastIndex
+		}
+		return ids[i] < ids[j]
+	})
+	delete(t.sessions, ids[0])
+}
+
+func (t *clientSessionTable) Len() int {
+	return len(t.sessions)
+}
+
+// GetStates return the sessions ordered by the client id for the snapshot,
+// the session with the response can not be saved will be ignored.
+func (t *clientSessionTable) GetStates() []ClientSessionState {
+	states := make([]ClientSessionState, 0, len(t.sessions))
+	for id, s := range t.sessions {
+		rsp, err := encodeClientRsp(s.lastRsp)
+		if err != nil {
+			nodeLog.Infof("client session %v ignored in snapshot: %v", id, err)
+			continue
+		}
+		st := ClientSessionState{
+			ClientID:   id,
+			LastSeq:    s.lastSeq,
+			LastIndex:  s.lastIndex,
+			LastActive: s.lastActive,
+			LastRsp:    rsp,
+		}
+		if s.lastErr != nil {
+			st.LastErr = s.lastErr.Error()
+		}
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ClientID < states[j].ClientID
+	})
+	return states
+}
+
+// RestoreStates replace all the sessions by the states from the snapshot
+func (t *clientSessionTable) RestoreStates(states []ClientSessionState) {
+	t.sessions = make(map[uint64]*clientSession, len(states))
+	for _, st := range states {
+		rsp, err := decodeClientRsp(st.LastRsp)
+		if err != nil {
+			nodeLog.Infof("client session %v ignored while restoring: %v", st.ClientID, err)
+			continue
+		}
+		s := &clientSession{
+			lastSeq:    st.LastSeq,
+			lastRsp:    rsp,
+			lastIndex:  st.LastIndex,
+			lastActive: st.LastActive,
+		}
+		if st.LastErr != "" {
+			s.lastErr = errors.New(st.LastErr)
+		}
+		t.sessions[st.ClientID] = s
+	}
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSessionDedup(t *testing.T) {
+	st := newClientSessionTable()
+	_, _, applied := st.CheckApplied(1, 1)
+	assert.False(t, applied)
+	st.Record(1, 2, 10, 100, int64(3), nil)
+	rsp, err, applied := st.CheckApplied(1, 2)
+	assert.True(t, applied)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), rsp)
+	_, err, applied = st.CheckApplied(1, 1)
+	assert.True(t, applied)
+	assert.Equal(t, errStaleClientRequest, err)
+	_, _, applied = st.CheckApplied(1, 3)
+	assert.False(t, applied)
+}
+
+func TestClientSessionExpireDeterministic(t *testing.T) {
+	ts := time.Now().UnixNano()
+	var tables []*clientSessionTable
+	for n := 0; n < 3; n++ {
+		st := newClientSessionTable()
+		for i := 0; i < maxClientSessionNum; i++ {
+			// the sessions applied in the same raft entry have the same index
+			st.Record(uint64(maxClientSessionNum-i), 1, uint64(i/2+10), ts, nil, nil)
+		}
+		st.Record(uint64(maxClientSessionNum+1), 1, uint64(maxClientSessionNum), ts, nil, nil)
+		assert.Equal(t, maxClientSessionNum, st.Len())
+		tables = append(tables, st)
+	}
+	// the session with the smallest index and then the smallest id is removed on all replicas
+	for _, st := range tables {
+		_, ok := st.sessions[uint64(maxClientSessionNum)]
+		assert.True(t, ok)
+		_, ok = st.sessions[uint64(maxClientSessionNum-1)]
+		assert.False(t, ok)
+		assert.Equal(t, tables[0].GetStates(), st.GetStates())
+	}
+
+	// the timeout sessions are all removed
+	st := tables[0]
+	st.Record(uint64(maxClientSessionNum+2), 1, uint64(maxClientSessionNum+1),
+		ts+clientSessionTimeout.Nanoseconds()+1, nil, nil)
+	assert.Equal(t, 1, st.Len())
+}
+
+func TestClientSessionSnapshot(t *testing.T) {
+	st := newClientSessionTable()
+	st.Record(1, 1, 10, 100, int64(3), nil)
+	st.Record(2, 5, 11, 101, []byte("old"), nil)
+	st.Record(3, 2, 12, 102, "OK", nil)
+	st.Record(4, 7, 13, 103, nil, errors.New("ERR wrong type"))
+	st.Record(5, 1, 14, 104, []interface{}{int64(1), []byte("v"), nil}, nil)
+	st.Record(6, 1, 15, 105, float64(1.5), nil)
+	st.Record(7, 1, 16, 106, [][]byte{[]byte("a"), nil}, nil)
+
+	var si KVSnapInfo
+	si.ClientSessions = st.GetStates()
+	d, err := si.GetData()
+	assert.Nil(t, err)
+	var restoredSi KVSnapInfo
+	assert.Nil(t, json.Unmarshal(d, &restoredSi))
+	restored := newClientSessionTable()
+	restored.Record(100, 1, 1, 1, nil, nil)
+	restored.RestoreStates(restoredSi.ClientSessions)
+	assert.Equal(t, st.Len(), restored.Len())
+	for id, s := range st.sessions {
+		rs, ok := restored.sessions[id]
+		assert.True(t, ok)
+		assert.Equal(t, s.lastSeq, rs.lastSeq)
+		assert.Equal(t, s.lastIndex, rs.lastIndex)
+		assert.Equal(t, s.lastActive, rs.lastActive)
+		assert.Equal(t, s.lastRsp, rs.lastRsp)
+		if s.lastErr == nil {
+			assert.Nil(t, rs.lastErr)
+		} else {
+			assert.Equal(t, s.lastErr.Error(), rs.lastErr.Error())
+		}
+	}
+	_, _, applied := restored.CheckApplied(100, 1)
+	assert.False(t, applied)
+	rsp, err, applied := restored.CheckApplied(2, 5)
+	assert.True(t, applied)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), rsp)
+}
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"errors"
+	"path"
+)
+
+// the cloning state is saved as the remote synced state named by the source partition
+const cloneStatePrefix = "clone:"
+
+var errNoCloneSource = errors.New("the clone source replica not found")
+
+// CloneFromSnapshot replace all the data of the namespace partition with the checkpoint
+// (term-index) of the source partition on the source node. The checkpoint is transferred
+// and restored by all the replicas through the raft log and a snapshot will be made after
+// restored, so the replica added later will get the cloned data from the raft snapshot.
+// It should be called on the leader until the done status returned, each call will move
+// the clone to the next step if the previous step finished.
+func (nd *KVNode) CloneFromSnapshot(srcNS string, srcAddr string, srcHttpPort string,
+	term uint64, index uint64) (string, error) {
+	name := cloneStatePrefix + srcNS
+	ss := SyncedState{SyncedTerm: term, SyncedIndex: index}
+	if old, ok := nd.remoteSyncedStates.GetState(name); ok && old.IsSame(&ss) {
+		return applyStatusMsgs[ApplySnapDone], nil
+	}
+	sas, ok := nd.remoteSyncedStates.GetApplyingSnap(name)
+	if ok && sas.SS.IsSame(&ss) {
+		switch sas.StatusCode {
+		case ApplySnapTransferred:
+			nd.remoteSyncedStates.UpdateApplyingSnapStatus(name, ss, ApplySnapApplying)
+			nd.rn.Infof("begin restore the clone from %v snapshot: %v-%v", srcNS, term, index)
+			err := nd.proposeApplyRemoteSnap(false, name, term, index)
+			return applyStatusMsgs[ApplySnapApplying], err
+		case ApplySnapBegin, ApplySnapTransferring, ApplySnapApplying:
+			return sas.Status, nil
+		}
+	}
+	if nd.clusterInfo == nil {
+		return "", errNoCloneSource
+	}
+	ssiList, err := nd.clusterInfo.GetSnapshotSyncInfo(srcNS)
+	if err != nil {
+		return "", err
+	}
+	for _, ssi := range ssiList {
+		if ssi.RemoteAddr != srcAddr || ssi.HttpAPIPort != srcHttpPort {
+			continue
+		}
+		// all the replicas will transfer from the source, so the local
+		// data dir can not be used even if the source is on the same machine
+		syncAddr := getSnapSyncAddr(*nd.machineConfig, ssi)
+		syncPath := path.Join(ssi.RsyncModule, srcNS)
+		nd.rn.Infof("begin transfer the clone from %v snapshot: %v-%v, %v:%v", srcNS, term, index,
+			syncAddr, syncPath)
+		err = nd.BeginTransferRemoteSnap(name, term, index, syncAddr, syncPath)
+		if err != nil {
+			return "", err
+		}
+		sas, _ = nd.remoteSyncedStates.GetApplyingSnap(name)
+		if sas == nil {
+			return applyStatusMsgs[ApplySnapUnknown], nil
+		}
+		return sas.Status, nil
+	}
+	return "", errNoCloneSource
+}
@@ -2,7 +2,8 @@ package node
 
 import (
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/ZanRedisDB/rockredis"
+	"github.com/absolute8511/ZanRedisDB/engine"
+	"github.com/absolute8511/ZanRedisDB/wal"
 )
 
 type NamespaceConfig struct {
@@ -18,6 +19,18 @@ type NamespaceConfig struct {
 	OptimizedFsync   bool            `json:"optimized_fsync"`
 	RaftGroupConf    RaftGroupConfig `json:"raft_group_conf"`
 	ExpirationPolicy string          `json:"expiration_policy"`
+	// override the rocksdb options of the node for this namespace
+	RocksDBOpts common.RockOptionsOverride `json:"rocksdb_opts"`
+	// the max keys and bytes of the whole namespace, the namespace will be read
+	// only (except deletion) while exceeded, 0 means no limit.
+	QuotaMaxKeys  int64 `json:"quota_max_keys"`
+	QuotaMaxBytes int64 `json:"quota_max_bytes"`
+	// the snapshot will be triggered to truncate the raft logs if the logs since the
+	// last snapshot exceed the size or the age, 0 means only the snap count is used.
+	LogRetentionBytes int64 `json:"log_retention_bytes"`
+	LogRetentionSecs  int64 `json:"log_retention_secs"`
+	// reject all the writes while frozen
+	Frozen bool `json:"frozen"`
 }
 
 func NewNSConfig() *NamespaceConfig {
@@ -38,19 +51,79 @@ type RaftGroupConfig struct {
 
 type MachineConfig struct {
 	// server node id
-	NodeID              uint64                `json:"node_id"`
-	BroadcastAddr       string                `json:"broadcast_addr"`
-	HttpAPIPort         int                   `json:"http_api_port"`
-	LocalRaftAddr       string                `json:"local_raft_addr"`
-	DataRootDir         string                `json:"data_root_dir"`
-	ElectionTick        int                   `json:"election_tick"`
-	TickMs              int                   `json:"tick_ms"`
-	KeepWAL             int                   `json:"keep_wal"`
-	LearnerRole         string                `json:"learner_role"`
-	RemoteSyncCluster   string                `json:"remote_sync_cluster"`
-	StateMachineType    string                `json:"state_machine_type"`
-	RocksDBOpts         rockredis.RockOptions `json:"rocksdb_opts"`
-	RocksDBSharedConfig *rockredis.SharedRockConfig
+	NodeID              uint64             `json:"node_id"`
+	BroadcastAddr       string             `json:"broadcast_addr"`
+	HttpAPIPort         int                `json:"http_api_port"`
+	LocalRaftAddr       string             `json:"local_raft_addr"`
+	DataRootDir         string             `json:"data_root_dir"`
+	WALRootDir          string             `json:"wal_root_dir"`
+	ElectionTick        int                `json:"election_tick"`
+	TickMs              int                `json:"tick_ms"`
+	KeepWAL             int                `json:"keep_wal"`
+	LearnerRole         string             `json:"learner_role"`
+	RemoteSyncCluster   string             `json:"remote_sync_cluster"`
+	StateMachineType    string             `json:"state_machine_type"`
+	ApplyWorkerNum      int                `json:"apply_worker_num"`
+	ActiveActiveSync    bool               `json:"active_active_sync"`
+	KafkaBrokers        string             `json:"kafka_brokers"`
+	KafkaTopicPrefix    string             `json:"kafka_topic_prefix"`
+	SyncerIncludeTables []string           `json:"syncer_include_tables"`
+	SyncerExcludeTables []string           `json:"syncer_exclude_tables"`
+	SyncerExcludeCmds   []string           `json:"syncer_exclude_cmds"`
+	RocksDBOpts         engine.RockOptions `json:"rocksdb_opts"`
+	RocksDBSharedConfig engine.SharedRockConfig
+
+	// rewrite the namespace or table name in remote cluster
+	SyncerNamespaceMapping map[string]string `json:"syncer_namespace_mapping"`
+	SyncerTableMapping     map[string]string `json:"syncer_table_mapping"`
+	// the values for the tables will be redacted while syncing, the key is used for the
+	// hmac of the redacted collection members
+	SyncerRedactTables []string `json:"syncer_redact_tables"`
+	SyncerRedactKey    string   `json:"syncer_redact_key"`
+	// the registered transformers and the go plugin path for transformer
+	SyncerTransformers    []string `json:"syncer_transformers"`
+	SyncerTransformPlugin string   `json:"syncer_transform_plugin"`
+	// do the full sync from backup instead of all the raft logs while the remote cluster is empty
+	SyncerInitFromSnapshot bool `json:"syncer_init_from_snapshot"`
+	// the compression (snappy or zstd) for the raft logs sent to the remote cluster,
+	// only used if the remote cluster supports it.
+	SyncerCompressType string `json:"syncer_compress_type"`
+	// the max bytes per second for sending raft logs to the remote cluster, 0 means no limit
+	SyncerMaxBandwidth int64 `json:"syncer_max_bandwidth"`
+	// the additional destination clusters for the log syncer, each one is synced independently
+	RemoteSyncClusters []string `json:"remote_sync_clusters"`
+	// use the rsync daemon to transfer the snapshot instead of the native http api
+	SnapshotSyncByRsync bool `json:"snapshot_sync_by_rsync"`
+	// encrypt the checkpoint files if set
+	SnapKeyProvider common.SnapKeyProvider
+	// upload the backups to the external storage if the driver is set
+	BackupTarget common.BackupTargetConfig `json:"backup_target"`
+	BackupDriver common.BackupDriver
+	// all the applied writes will be recorded into the audit sink if set
+	AuditSink AuditSink
+	// report the raft entries which can not be decoded or applied while replaying, and
+	// skip the acknowledged entries ("namespace-partition:term-index") instead of failing the partition
+	RaftRepairMode        bool     `json:"raft_repair_mode"`
+	RaftRepairSkipEntries []string `json:"raft_repair_skip_entries"`
+	// the new writes will be delayed for the backpressure wait time and then rejected while the
+	// committed logs waiting to be applied or the pending proposals exceed the limit.
+	// 0 means the default value and negative means no limit (or no wait).
+	MaxApplyBacklog     int64 `json:"max_apply_backlog"`
+	MaxPendingProposals int64 `json:"max_pending_proposals"`
+	BackpressureWaitMs  int   `json:"backpressure_wait_ms"`
+	// the bound of the stale read on the read only replica, the read will be rejected if the
+	// committed logs waiting to be applied or the time since the last message from leader
+	// exceed the limit. 0 means no limit.
+	ReadReplicaMaxLag     uint64 `json:"read_replica_max_lag"`
+	ReadReplicaMaxStaleMs int64  `json:"read_replica_max_stale_ms"`
+	// the compression (snappy or zstd) for the raft log entries not smaller than the min bytes
+	RaftLogCompressType     string `json:"raft_log_compress_type"`
+	RaftLogCompressMinBytes int    `json:"raft_log_compress_min_bytes"`
+	// the fsyncs of the wals of all the partitions will be handled in batches by
+	// one syncer, false means each wal syncs independently.
+	WALBatchSync bool `json:"wal_batch_sync"`
+	// the max keys migrated per second by each partition while expanding the partitions
+	ReshardKeysPerSec int `json:"reshard_keys_per_sec"`
 }
 
 type ReplicaInfo struct {
@@ -78,4 +151,6 @@ type RaftConfig struct {
 	Replicator     int                    `json:"replicator"`
 	OptimizedFsync bool                   `json:"optimized_fsync"`
 	nodeConfig     *MachineConfig
+	// the group syncer shared by the wals on the node, nil if batch sync disabled
+	walSyncer *wal.GroupSyncer
 }
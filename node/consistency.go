@@ -0,0 +1,189 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	defaultReplicaChecksumBuckets = 256
+	replicaChecksumQueryTimeout   = time.Second * 3
+)
+
+var errNoReplicaChecksum = errors.New("no replica checksum for the table")
+
+type TableChecksumRequest struct {
+	Table     string `json:"table"`
+	BucketNum int    `json:"bucket_num"`
+}
+
+// replicaChecksumTable keep the latest checksum result for each table
+type replicaChecksumTable struct {
+	sync.Mutex
+	checksums map[string]*common.ReplicaChecksum
+}
+
+func newReplicaChecksumTable() *replicaChecksumTable {
+	return &replicaChecksumTable{
+		checksums: make(map[string]*common.ReplicaChecksum),
+	}
+}
+
+func (rct *replicaChecksumTable) Get(table string) (common.ReplicaChecksum, bool) {
+	rct.Lock()
+	defer rct.Unlock()
+	rc, ok := rct.checksums[table]
+	if !ok {
+		return common.ReplicaChecksum{}, false
+	}
+	return *rc, true
+}
+
+func (rct *replicaChecksumTable) Set(rc *common.ReplicaChecksum) {
+	rct.Lock()
+	rct.checksums[rc.Table] = rc
+	rct.Unlock()
+}
+
+// the db snapshot is taken while applying the proposal, so all the replicas compute
+// the checksum at the same raft index, the computing is done in background to avoid blocking apply.
+func (kvsm *kvStoreSM) startReplicaChecksum(data []byte, index uint64) error {
+	var req TableChecksumRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		kvsm.Infof("invalid table checksum request: %v", string(data))
+		return err
+	}
+	rc := &common.ReplicaChecksum{
+		ReplicaID: kvsm.ID,
+		Table:     req.Table,
+		Index:     index,
+	}
+	kvsm.checksums.Set(rc)
+	start := time.Now()
+	return kvsm.store.GetTableChecksumAsync(req.Table, req.BucketNum, func(tc *common.TableChecksum, err error) {
+		done := &common.ReplicaChecksum{
+			ReplicaID: rc.ReplicaID,
+			Table:     rc.Table,
+			Index:     rc.Index,
+			Done:      true,
+			Checksum:  tc,
+		}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		kvsm.Infof("table %v checksum at index %v done, cost: %v, err: %v", req.Table, index, time.Since(start), err)
+		kvsm.checksums.Set(done)
+	})
+}
+
+// ProposeTableChecksum make all the replicas compute the table checksum at the same raft
+// index, the index will be returned and the result can be compared by CheckReplicaConsistency.
+func (nd *KVNode) ProposeTableChecksum(table string, bucketNum int) (uint64, error) {
+	if _, ok := nd.sm.(*kvStoreSM); !ok {
+		return 0, errors.New("no data checksum for learner")
+	}
+	if bucketNum <= 0 {
+		bucketNum = defaultReplicaChecksumBuckets
+	}
+	d, _ := json.Marshal(TableChecksumRequest{Table: table, BucketNum: bucketNum})
+	p := &customProposeData{
+		ProposeOp: ProposeOp_TableChecksum,
+		Data:      d,
+	}
+	pd, _ := json.Marshal(p)
+	rsp, err := nd.CustomPropose(pd)
+	if err != nil {
+		return 0, err
+	}
+	index, _ := rsp.(uint64)
+	return index, nil
+}
+
+// GetReplicaChecksum return the latest table checksum computed on the local replica
+func (nd *KVNode) GetReplicaChecksum(table string) (*common.ReplicaChecksum, error) {
+	s, ok := nd.sm.(*kvStoreSM)
+	if !ok {
+		return nil, errors.New("no data checksum for learner")
+	}
+	rc, ok := s.checksums.Get(table)
+	if !ok {
+		return nil, errNoReplicaChecksum
+	}
+	return &rc, nil
+}
+
+// CheckReplicaConsistency compare the table checksums from all the replicas in the raft group
+// with the local one, the replica which has not finished will make the report not done.
+func (nd *KVNode) CheckReplicaConsistency(table string) (*common.ConsistencyReport, error) {
+	local, err := nd.GetReplicaChecksum(table)
+	if err != nil {
+		return nil, err
+	}
+	report := &common.ConsistencyReport{
+		Name:     nd.ns,
+		Table:    table,
+		Index:    local.Index,
+		Replicas: []common.ReplicaChecksum{*local},
+	}
+	if nd.clusterInfo != nil {
+		ssiList, err := nd.clusterInfo.GetSnapshotSyncInfo(nd.ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, ssi := range ssiList {
+			if ssi.ReplicaID == local.ReplicaID {
+				continue
+			}
+			var rc common.ReplicaChecksum
+			uri := "http://" + net.JoinHostPort(ssi.RemoteAddr, ssi.HttpAPIPort) +
+				common.APIReplicaChecksum + "/" + nd.ns + "/" + table
+			_, err := common.APIRequest("GET", uri, nil, replicaChecksumQueryTimeout, &rc)
+			if err != nil {
+				rc = common.ReplicaChecksum{ReplicaID: ssi.ReplicaID, Table: table, Error: err.Error()}
+			}
+			report.Replicas = append(report.Replicas, rc)
+		}
+	}
+	sort.Slice(report.Replicas, func(i, j int) bool {
+		return report.Replicas[i].ReplicaID < report.Replicas[j].ReplicaID
+	})
+	compareReplicaChecksums(report, local)
+	return report, nil
+}
+
+func compareReplicaChecksums(report *common.ConsistencyReport, local *common.ReplicaChecksum) {
+	report.Done = true
+	for _, rc := range report.Replicas {
+		if !rc.Done || rc.Index != local.Index || rc.Error != "" || rc.Checksum == nil {
+			report.Done = false
+			return
+		}
+	}
+	diffs := make(map[int]bool)
+	report.Consistent = true
+	for _, rc := range report.Replicas {
+		if rc.Checksum.RecordNum != local.Checksum.RecordNum ||
+			len(rc.Checksum.Buckets) != len(local.Checksum.Buckets) {
+			report.Consistent = false
+		}
+		for i := 0; i < len(rc.Checksum.Buckets) && i < len(local.Checksum.Buckets); i++ {
+			if rc.Checksum.Buckets[i] != local.Checksum.Buckets[i] {
+				diffs[i] = true
+			}
+		}
+	}
+	for b := range diffs {
+		report.DiffBuckets = append(report.DiffBuckets, b)
+	}
+	sort.Ints(report.DiffBuckets)
+	if len(report.DiffBuckets) > 0 {
+		report.Consistent = false
+	}
+}
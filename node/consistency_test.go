@@ -0,0 +1,44 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareReplicaChecksums(t *testing.T) {
+	newRC := func(id uint64, index uint64, buckets ...uint64) common.ReplicaChecksum {
+		return common.ReplicaChecksum{
+			ReplicaID: id,
+			Table:     "test",
+			Index:     index,
+			Done:      true,
+			Checksum:  &common.TableChecksum{Table: "test", RecordNum: 3, Buckets: buckets},
+		}
+	}
+	local := newRC(1, 10, 1, 2, 3)
+	report := &common.ConsistencyReport{
+		Index:    10,
+		Replicas: []common.ReplicaChecksum{local, newRC(2, 10, 1, 2, 3), newRC(3, 10, 1, 2, 3)},
+	}
+	compareReplicaChecksums(report, &local)
+	assert.True(t, report.Done)
+	assert.True(t, report.Consistent)
+	assert.Equal(t, 0, len(report.DiffBuckets))
+
+	report.Replicas[2] = newRC(3, 10, 1, 5, 4)
+	compareReplicaChecksums(report, &local)
+	assert.True(t, report.Done)
+	assert.False(t, report.Consistent)
+	assert.Equal(t, []int{1, 2}, report.DiffBuckets)
+
+	// the replica still computing or at another index
+	report = &common.ConsistencyReport{
+		Index:    10,
+		Replicas: []common.ReplicaChecksum{local, newRC(2, 9, 1, 2, 3)},
+	}
+	compareReplicaChecksums(report, &local)
+	assert.False(t, report.Done)
+	assert.False(t, report.Consistent)
+}
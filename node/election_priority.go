@@ -0,0 +1,126 @@
+package node
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft"
+)
+
+const (
+	// the replica with this priority will not try election actively and will transfer
+	// the leadership to other replica if elected, used to drain the node for maintenance
+	ElectionPriorityNever   = 0
+	ElectionPriorityDefault = 1
+
+	// the priority is saved in the data dir of the replica, so the draining
+	// replica will not be elected after restart
+	electionPriorityFile = "election_priority"
+)
+
+var errNoReplicaForTransfer = errors.New("no ready replica for transferring leader")
+
+func (nd *KVNode) GetElectionPriority() int32 {
+	return atomic.LoadInt32(&nd.rn.electionPriority)
+}
+
+func (nd *KVNode) SetElectionPriority(p int32) error {
+	if err := saveElectionPriority(nd.rn.config.DataDir, p); err != nil {
+		nd.rn.Infof("save election priority %v failed: %v", p, err)
+		return err
+	}
+	old := atomic.SwapInt32(&nd.rn.electionPriority, p)
+	if old != p {
+		nd.rn.Infof("election priority changed from %v to %v", old, p)
+	}
+	return nil
+}
+
+// loadElectionPriority return the default priority if not saved
+func loadElectionPriority(dataDir string) int32 {
+	d, err := ioutil.ReadFile(path.Join(dataDir, electionPriorityFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			nodeLog.Infof("read election priority in %v failed: %v", dataDir, err)
+		}
+		return ElectionPriorityDefault
+	}
+	p, err := strconv.Atoi(strings.TrimSpace(string(d)))
+	if err != nil || p < 0 {
+		nodeLog.Infof("invalid election priority in %v: %v", dataDir, string(d))
+		return ElectionPriorityDefault
+	}
+	return int32(p)
+}
+
+func saveElectionPriority(dataDir string, p int32) error {
+	if err := os.MkdirAll(dataDir, common.DIR_PERM); err != nil {
+		return err
+	}
+	f := path.Join(dataDir, electionPriorityFile)
+	tmp := f + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(int(p))), common.FILE_PERM); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f)
+}
+
+// TransferLeaderTo transfer the leadership to the replica which should be ready for raft
+func (nn *NamespaceNode) TransferLeaderTo(toRaftID uint64) error {
+	if !nn.Node.IsLead() {
+		return ErrNamespaceNotLeader
+	}
+	for _, m := range nn.Node.GetMembers() {
+		if m.ID != toRaftID {
+			continue
+		}
+		if !nn.Node.IsReplicaRaftReady(toRaftID) {
+			return errNoReplicaForTransfer
+		}
+		return nn.TransferMyLeader(m.NodeID, m.ID)
+	}
+	return errNoReplicaForTransfer
+}
+
+// handOffLeader transfer the leadership to the most updated replica if the
+// local replica is not allowed to be the leader
+func (nn *NamespaceNode) handOffLeader() error {
+	if !nn.Node.IsLead() || nn.Node.GetElectionPriority() != ElectionPriorityNever {
+		return nil
+	}
+	m := pickHandOffReplica(nn.Node.GetMembers(), nn.Node.rn.node.Status().Progress,
+		nn.GetRaftID(), nn.Node.IsReplicaRaftReady)
+	if m == nil {
+		return errNoReplicaForTransfer
+	}
+	nodeLog.Infof("namespace %v hand off leader to %v since election priority is 0", nn.FullName(), m)
+	return nn.TransferMyLeader(m.NodeID, m.ID)
+}
+
+// pickHandOffReplica return the ready replica with the largest matched index, so the
+// new leader can catch up soon and the write will not be blocked for long.
+func pickHandOffReplica(members []*common.MemberInfo, progress map[uint64]raft.Progress,
+	localID uint64, isReady func(uint64) bool) *common.MemberInfo {
+	var picked *common.MemberInfo
+	var maxMatch uint64
+	for _, m := range members {
+		if m.ID == localID || !isReady(m.ID) {
+			continue
+		}
+		pg, ok := progress[m.ID]
+		if !ok {
+			continue
+		}
+		if picked == nil || pg.Match > maxMatch {
+			picked = m
+			maxMatch = pg.Match
+		}
+	}
+	return picked
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElectionPriorityPersist(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "election-priority")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	assert.Equal(t, int32(ElectionPriorityDefault), loadElectionPriority(tmpDir))
+	assert.Nil(t, saveElectionPriority(tmpDir, ElectionPriorityNever))
+	assert.Equal(t, int32(ElectionPriorityNever), loadElectionPriority(tmpDir))
+	assert.Nil(t, saveElectionPriority(tmpDir, 2))
+	assert.Equal(t, int32(2), loadElectionPriority(tmpDir))
+
+	assert.Nil(t, ioutil.WriteFile(path.Join(tmpDir, electionPriorityFile), []byte("invalid"), common.FILE_PERM))
+	assert.Equal(t, int32(ElectionPriorityDefault), loadElectionPriority(tmpDir))
+}
+
+func TestElectionPriorityRestart(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer close(stopC)
+	defer nd.Stop()
+	assert.Equal(t, int32(ElectionPriorityDefault), nd.GetElectionPriority())
+	assert.Nil(t, nd.SetElectionPriority(ElectionPriorityNever))
+	assert.Equal(t, int32(ElectionPriorityNever), nd.GetElectionPriority())
+	// the new raft node for the same data should load the saved priority
+	assert.Equal(t, int32(ElectionPriorityNever), loadElectionPriority(nd.rn.config.DataDir))
+}
+
+func TestPickHandOffReplica(t *testing.T) {
+	members := []*common.MemberInfo{
+		{ID: 1, NodeID: 1},
+		{ID: 2, NodeID: 2},
+		{ID: 3, NodeID: 3},
+		{ID: 4, NodeID: 4},
+	}
+	progress := map[uint64]raft.Progress{
+		1: {Match: 100},
+		2: {Match: 90},
+		3: {Match: 98},
+		4: {Match: 99},
+	}
+	ready := map[uint64]bool{1: true, 2: true, 3: true}
+	isReady := func(id uint64) bool { return ready[id] }
+	// the local and the not ready replica should be ignored
+	m := pickHandOffReplica(members, progress, 1, isReady)
+	assert.NotNil(t, m)
+	assert.Equal(t, uint64(3), m.ID)
+
+	ready[4] = true
+	m = pickHandOffReplica(members, progress, 1, isReady)
+	assert.Equal(t, uint64(4), m.ID)
+
+	m = pickHandOffReplica(members, progress, 1, func(uint64) bool { return false })
+	assert.Nil(t, m)
+}
@@ -0,0 +1,35 @@
+package node
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrNamespaceFrozen = errors.New("ERR_NAMESPACE_FROZEN: the namespace is frozen and read only now")
+
+// SetFrozen freeze or unfreeze the namespace, all the writes (including the writes synced
+// from the remote cluster) are rejected while frozen and the reads are still served.
+func (nn *NamespaceNode) SetFrozen(frozen bool) {
+	nn.Node.setFrozen(frozen)
+}
+
+func (nd *KVNode) setFrozen(frozen bool) {
+	v := int32(0)
+	if frozen {
+		v = 1
+	}
+	if atomic.SwapInt32(&nd.frozen, v) != v {
+		nd.rn.Infof("partition frozen changed to %v", frozen)
+	}
+}
+
+func (nd *KVNode) IsFrozen() bool {
+	return atomic.LoadInt32(&nd.frozen) == 1
+}
+
+func (nd *KVNode) checkFrozen() error {
+	if nd.IsFrozen() {
+		return ErrNamespaceFrozen
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceFrozen(t *testing.T) {
+	nd := &KVNode{rn: &raftNode{}}
+	assert.False(t, nd.IsFrozen())
+	assert.Nil(t, nd.checkFrozen())
+
+	nd.setFrozen(true)
+	assert.True(t, nd.IsFrozen())
+	assert.Equal(t, ErrNamespaceFrozen, nd.checkFrozen())
+	// the writes synced from the remote cluster should be rejected too
+	assert.Equal(t, ErrNamespaceFrozen, nd.ProposeRawAndWait(nil, 1, 1, 0))
+
+	nd.setFrozen(false)
+	assert.Nil(t, nd.checkFrozen())
+}
@@ -0,0 +1,35 @@
+// +build gofuzz
+
+package node
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+)
+
+// the fuzz targets for go-fuzz, build with:
+// go-fuzz-build -func FuzzParseCommand github.com/absolute8511/ZanRedisDB/node
+
+// FuzzParseCommand parse the raft log data as the redis command in the same way as the
+// apply loop, the malformed command should be rejected without panic.
+func FuzzParseCommand(data []byte) int {
+	cmd, err := redcon.Parse(data)
+	if err != nil || len(cmd.Args) < 2 {
+		return 0
+	}
+	if _, _, err := common.ExtractNamesapce(cmd.Args[1]); err != nil {
+		return 0
+	}
+	isParallelApplyCmd(cmd)
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	for _, pos := range getCmdKeyPositions(cmdName, len(cmd.Args)) {
+		if pos >= len(cmd.Args) {
+			panic(fmt.Sprintf("key position %v out of the args: %q", pos, data))
+		}
+	}
+	common.DeepCopyCmd(cmd)
+	return 1
+}
@@ -62,7 +62,7 @@ func (nd *KVNode) geoaddCommand(conn redcon.Conn, cmd redcon.Command) {
 
 		hash, err := geohash.EncodeWGS84(lon, lat)
 		if err != nil {
-			conn.WriteError("Err " + err.Error())
+			conn.WriteError(err.Error())
 			return
 		}
 
@@ -84,11 +84,11 @@ func (nd *KVNode) geoaddCommand(conn redcon.Conn, cmd redcon.Command) {
 		zaddCmd.Args[1] = key
 		sm, ok := nd.sm.(*kvStoreSM)
 		if !ok {
-			conn.WriteError("Err not supported state machine")
+			conn.WriteError("ERR not supported state machine")
 			return
 		}
 		if _, err := sm.localZaddCommand(buildCommand(zaddCmd.Args), -1); err != nil {
-			conn.WriteError("Err " + err.Error())
+			conn.WriteError(err.Error())
 		}
 
 	} else {
@@ -214,11 +214,11 @@ func (nd *KVNode) geoRadiusGeneric(conn redcon.Conn, cmd redcon.Command, stype s
 	case RADIUS_COORDS:
 		baseArgs = 4
 		if x, err = strconv.ParseFloat(string(cmd.Args[2]), 64); err != nil {
-			conn.WriteError("Err value is not a valid float")
+			conn.WriteError(common.ErrRedisNotFloat.Error())
 			return
 		}
 		if y, err = strconv.ParseFloat(string(cmd.Args[3]), 64); err != nil {
-			conn.WriteError("Err value is not a valid float")
+			conn.WriteError(common.ErrRedisNotFloat.Error())
 			return
 		}
 
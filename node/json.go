@@ -42,7 +42,7 @@ func (nd *KVNode) jsonKeyExistsCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) jsonmkGetCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) < 3 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	if len(cmd.Args[1:]) >= common.MAX_BATCH_NUM {
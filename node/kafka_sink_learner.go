@@ -0,0 +1,322 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/pkg/wait"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+	"github.com/absolute8511/redcon"
+)
+
+const (
+	kafkaSinkCheckpointFile     = "kafka_sink_checkpoint"
+	kafkaSinkCheckpointInterval = time.Second
+	kafkaSinkRetryInterval      = time.Second
+)
+
+var errKafkaSinkNoBrokers = errors.New("no kafka brokers configured for kafka sink")
+
+// ChangeEvent is the structured change published to kafka for each applied write command.
+type ChangeEvent struct {
+	Namespace   string   `json:"namespace"`
+	Table       string   `json:"table"`
+	Key         string   `json:"key"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args,omitempty"`
+	Term        uint64   `json:"term"`
+	Index       uint64   `json:"index"`
+	Timestamp   int64    `json:"timestamp"`
+	OrigCluster string   `json:"orig_cluster,omitempty"`
+}
+
+// kafkaSinkSM is a learner which publishes the write commands in raft logs to kafka,
+// the topic is combined by the prefix, namespace and table. The raft log will be applied only after
+// the events are published successfully so we get the at-least-once delivery, and the published
+// term-index is checkpointed to the local file to avoid publishing again after restart.
+type kafkaSinkSM struct {
+	fullNS        string
+	ns            string
+	machineConfig MachineConfig
+	ID            uint64
+	checkpointDir string
+	producer      sarama.SyncProducer
+	publishedCnt  int64
+	syncedState   SyncedState
+	// the last checkpointed state, only accessed in the apply loop
+	checkpoint     SyncedState
+	lastCheckpoint time.Time
+	stopping       int32
+	stopC          chan struct{}
+	w              wait.Wait
+}
+
+func NewKafkaSinkSM(opts *KVOptions, machineConfig MachineConfig, localID uint64, fullNS string,
+	clusterInfo common.IClusterInfo) (*kafkaSinkSM, error) {
+	if machineConfig.KafkaBrokers == "" {
+		return nil, errKafkaSinkNoBrokers
+	}
+	ns, _ := common.GetNamespaceAndPartition(fullNS)
+	if ns == "" {
+		ns = fullNS
+	}
+	sm := &kafkaSinkSM{
+		fullNS:        fullNS,
+		ns:            ns,
+		machineConfig: machineConfig,
+		ID:            localID,
+		checkpointDir: opts.DataDir,
+		stopC:         make(chan struct{}),
+	}
+	conf := sarama.NewConfig()
+	conf.Producer.RequiredAcks = sarama.WaitForAll
+	conf.Producer.Return.Successes = true
+	conf.Producer.Retry.Max = 3
+	producer, err := sarama.NewSyncProducer(strings.Split(machineConfig.KafkaBrokers, ","), conf)
+	if err != nil {
+		return nil, err
+	}
+	sm.producer = producer
+	return sm, nil
+}
+
+func (sm *kafkaSinkSM) Debugf(f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	nodeLog.DebugDepth(1, fmt.Sprintf("%v-%v: %s", sm.fullNS, sm.ID, msg))
+}
+
+func (sm *kafkaSinkSM) Infof(f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	nodeLog.InfoDepth(1, fmt.Sprintf("%v-%v: %s", sm.fullNS, sm.ID, msg))
+}
+
+func (sm *kafkaSinkSM) Errorf(f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	nodeLog.ErrorDepth(1, fmt.Sprintf("%v-%v: %s", sm.fullNS, sm.ID, msg))
+}
+
+func (sm *kafkaSinkSM) Optimize(t string) {
+}
+
+func (sm *kafkaSinkSM) GetStats() common.NamespaceStats {
+	var ns common.NamespaceStats
+	stat := make(map[string]interface{})
+	stat["role"] = common.LearnerRoleKafkaSink
+	stat["published"] = atomic.LoadInt64(&sm.publishedCnt)
+	stat["synced_index"] = atomic.LoadUint64(&sm.syncedState.SyncedIndex)
+	stat["synced_term"] = atomic.LoadUint64(&sm.syncedState.SyncedTerm)
+	stat["synced_timestamp"] = atomic.LoadInt64(&sm.syncedState.Timestamp)
+	ns.InternalStats = stat
+	return ns
+}
+
+func (sm *kafkaSinkSM) CleanData() error {
+	return nil
+}
+
+func (sm *kafkaSinkSM) Destroy() {
+	os.Remove(path.Join(sm.checkpointDir, kafkaSinkCheckpointFile))
+}
+
+func (sm *kafkaSinkSM) CheckExpiredData(buffer common.ExpiredDataBuffer, stop chan struct{}) error {
+	return nil
+}
+
+func (sm *kafkaSinkSM) Start() error {
+	ss, err := sm.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	sm.checkpoint = ss
+	sm.setSyncedState(ss.SyncedTerm, ss.SyncedIndex, ss.Timestamp)
+	sm.Infof("kafka sink started from checkpoint: %v-%v", ss.SyncedTerm, ss.SyncedIndex)
+	return nil
+}
+
+// the raft node will make sure the raft apply is stopped first
+func (sm *kafkaSinkSM) Close() {
+	if !atomic.CompareAndSwapInt32(&sm.stopping, 0, 1) {
+		return
+	}
+	close(sm.stopC)
+	if err := sm.saveCheckpoint(true); err != nil {
+		sm.Errorf("failed to save checkpoint while closing: %v", err)
+	}
+	sm.producer.Close()
+}
+
+func (sm *kafkaSinkSM) setSyncedState(term uint64, index uint64, ts int64) {
+	atomic.StoreUint64(&sm.syncedState.SyncedTerm, term)
+	atomic.StoreUint64(&sm.syncedState.SyncedIndex, index)
+	atomic.StoreInt64(&sm.syncedState.Timestamp, ts)
+}
+
+func (sm *kafkaSinkSM) getSyncedState() SyncedState {
+	var ss SyncedState
+	ss.SyncedTerm = atomic.LoadUint64(&sm.syncedState.SyncedTerm)
+	ss.SyncedIndex = atomic.LoadUint64(&sm.syncedState.SyncedIndex)
+	ss.Timestamp = atomic.LoadInt64(&sm.syncedState.Timestamp)
+	return ss
+}
+
+func (sm *kafkaSinkSM) loadCheckpoint() (SyncedState, error) {
+	var ss SyncedState
+	d, err := ioutil.ReadFile(path.Join(sm.checkpointDir, kafkaSinkCheckpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ss, nil
+		}
+		return ss, err
+	}
+	err = json.Unmarshal(d, &ss)
+	return ss, err
+}
+
+// save the published term-index, if not forced the checkpoint will be saved at most once
+// in the interval, which may cause some duplicate events after restart.
+func (sm *kafkaSinkSM) saveCheckpoint(force bool) error {
+	ss := sm.getSyncedState()
+	if ss.IsSame(&sm.checkpoint) {
+		return nil
+	}
+	if !force && time.Since(sm.lastCheckpoint) < kafkaSinkCheckpointInterval {
+		return nil
+	}
+	d, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(sm.checkpointDir, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	fileName := path.Join(sm.checkpointDir, kafkaSinkCheckpointFile)
+	err = ioutil.WriteFile(fileName+".tmp", d, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(fileName+".tmp", fileName)
+	if err != nil {
+		return err
+	}
+	sm.checkpoint = ss
+	sm.lastCheckpoint = time.Now()
+	return nil
+}
+
+// all the applied logs are published already, so we only need make sure the checkpoint
+// is saved before the raft logs compacted.
+func (sm *kafkaSinkSM) GetSnapshot(term uint64, index uint64) (*KVSnapInfo, error) {
+	var si KVSnapInfo
+	err := sm.saveCheckpoint(true)
+	return &si, err
+}
+
+func (sm *kafkaSinkSM) RestoreFromSnapshot(startup bool, raftSnapshot raftpb.Snapshot, stop chan struct{}) error {
+	ss := sm.getSyncedState()
+	if ss.IsNewer2(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index) {
+		sm.Infof("ignored restore snapshot since already published: %v", raftSnapshot.Metadata.String())
+		return nil
+	}
+	// the raft logs before the snapshot is compacted by leader, we can not publish the changes
+	// in them and the downstream should do the full sync from the snapshot if needed.
+	sm.Errorf("the changes between %v-%v and snapshot %v can not be published", ss.SyncedTerm,
+		ss.SyncedIndex, raftSnapshot.Metadata.String())
+	sm.setSyncedState(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index, 0)
+	return sm.saveCheckpoint(true)
+}
+
+func (sm *kafkaSinkSM) ApplyRaftConfRequest(req raftpb.ConfChange, term uint64, index uint64, stop chan struct{}) error {
+	return nil
+}
+
+func (sm *kafkaSinkSM) topicName(table []byte) string {
+	return sm.machineConfig.KafkaTopicPrefix + sm.ns + "." + string(table)
+}
+
+func (sm *kafkaSinkSM) buildChangeEvents(reqList BatchInternalRaftRequest, term uint64, index uint64) []*sarama.ProducerMessage {
+	msgs := make([]*sarama.ProducerMessage, 0, len(reqList.Reqs))
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(RedisReq) {
+			continue
+		}
+		cmd, err := redcon.Parse(req.Data)
+		if err != nil || len(cmd.Args) < 2 {
+			sm.Infof("ignore invalid redis command in raft log: %v", req.String())
+			continue
+		}
+		table, _, err := common.ExtractTable(cmd.Args[1])
+		if err != nil {
+			sm.Infof("ignore redis command without table: %v", string(cmd.Raw))
+			continue
+		}
+		ts := reqList.Timestamp
+		if ts == 0 {
+			ts = req.Header.Timestamp
+		}
+		ev := ChangeEvent{
+			Namespace:   sm.ns,
+			Table:       string(table),
+			Key:         string(cmd.Args[1]),
+			Command:     strings.ToLower(string(cmd.Args[0])),
+			Term:        term,
+			Index:       index,
+			Timestamp:   ts,
+			OrigCluster: reqList.OrigCluster,
+		}
+		for _, arg := range cmd.Args[2:] {
+			ev.Args = append(ev.Args, string(arg))
+		}
+		d, _ := json.Marshal(ev)
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: sm.topicName(table),
+			// use the key to make sure the changes for the same key in the same partition
+			Key:   sarama.ByteEncoder(cmd.Args[1]),
+			Value: sarama.ByteEncoder(d),
+		})
+	}
+	return msgs
+}
+
+func (sm *kafkaSinkSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalRaftRequest, term uint64, index uint64, stop chan struct{}) (bool, error) {
+	for _, e := range reqList.Reqs {
+		sm.w.Trigger(e.Header.ID, nil)
+	}
+	ss := sm.getSyncedState()
+	if ss.IsNewer2(term, index) {
+		if nodeLog.Level() >= common.LOG_DETAIL {
+			sm.Debugf("ignore already published raft log: %v-%v", term, index)
+		}
+		return false, nil
+	}
+	msgs := sm.buildChangeEvents(reqList, term, index)
+	for len(msgs) > 0 {
+		err := sm.producer.SendMessages(msgs)
+		if err == nil {
+			atomic.AddInt64(&sm.publishedCnt, int64(len(msgs)))
+			break
+		}
+		sm.Infof("failed to publish %v changes at %v-%v: %v", len(msgs), term, index, err)
+		select {
+		case <-stop:
+			return false, common.ErrStopped
+		case <-sm.stopC:
+			return false, common.ErrStopped
+		case <-time.After(kafkaSinkRetryInterval):
+		}
+	}
+	sm.setSyncedState(term, index, reqList.Timestamp)
+	if err := sm.saveCheckpoint(false); err != nil {
+		sm.Infof("failed to save checkpoint at %v-%v: %v", term, index, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,136 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Shopify/sarama/mocks"
+	"github.com/absolute8511/ZanRedisDB/pkg/wait"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKafkaSinkSM(t *testing.T, dir string) (*kafkaSinkSM, *mocks.SyncProducer) {
+	producer := mocks.NewSyncProducer(t, nil)
+	sm := &kafkaSinkSM{
+		fullNS:        "default-0",
+		ns:            "default",
+		machineConfig: MachineConfig{KafkaTopicPrefix: "zankv."},
+		ID:            1,
+		checkpointDir: dir,
+		producer:      producer,
+		stopC:         make(chan struct{}),
+		w:             wait.New(),
+	}
+	assert.Nil(t, sm.Start())
+	return sm, producer
+}
+
+func buildTestBatchReqs(reqs ...*InternalRaftRequest) BatchInternalRaftRequest {
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = reqs
+	reqList.ReqNum = int32(len(reqs))
+	reqList.Timestamp = 100
+	return reqList
+}
+
+func TestKafkaSinkNoBrokers(t *testing.T) {
+	_, err := NewKafkaSinkSM(&KVOptions{}, MachineConfig{}, 1, "default-0", nil)
+	assert.Equal(t, errKafkaSinkNoBrokers, err)
+}
+
+func TestKafkaSinkBuildChangeEvents(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "kafka-sink")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	sm, producer := newTestKafkaSinkSM(t, tmpDir)
+	defer producer.Close()
+
+	reqList := buildTestBatchReqs(buildTestRedisReq(1, "set", "test:k", "v"),
+		buildTestRedisReq(2, "del", "notable"),
+		&InternalRaftRequest{Header: &RequestHeader{ID: 3, DataType: int32(RedisReq)}, Data: []byte("invalid")},
+		&InternalRaftRequest{Header: &RequestHeader{ID: 4, DataType: int32(CustomReq)}})
+	reqList.OrigCluster = "remote"
+	msgs := sm.buildChangeEvents(reqList, 2, 10)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "zankv.default.test", msgs[0].Topic)
+	key, _ := msgs[0].Key.Encode()
+	assert.Equal(t, "test:k", string(key))
+	v, _ := msgs[0].Value.Encode()
+	var ev ChangeEvent
+	assert.Nil(t, json.Unmarshal(v, &ev))
+	assert.Equal(t, ChangeEvent{
+		Namespace:   "default",
+		Table:       "test",
+		Key:         "test:k",
+		Command:     "set",
+		Args:        []string{"v"},
+		Term:        2,
+		Index:       10,
+		Timestamp:   100,
+		OrigCluster: "remote",
+	}, ev)
+}
+
+func TestKafkaSinkApplyAndCheckpoint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "kafka-sink")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	sm, producer := newTestKafkaSinkSM(t, tmpDir)
+
+	reqList := buildTestBatchReqs(buildTestRedisReq(1, "set", "test:k", "v"),
+		buildTestRedisReq(2, "incr", "test:n"))
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndSucceed()
+	stop := make(chan struct{})
+	_, err = sm.ApplyRaftRequest(false, reqList, 2, 10, stop)
+	assert.Nil(t, err)
+	ss := sm.getSyncedState()
+	assert.Equal(t, uint64(2), ss.SyncedTerm)
+	assert.Equal(t, uint64(10), ss.SyncedIndex)
+	assert.Equal(t, int64(2), sm.GetStats().InternalStats["published"])
+
+	// the published logs are ignored without sending again
+	_, err = sm.ApplyRaftRequest(true, reqList, 2, 9, stop)
+	assert.Nil(t, err)
+
+	// retry until published
+	producer.ExpectSendMessageAndFail(errors.New("kafka unavailable"))
+	producer.ExpectSendMessageAndSucceed()
+	reqList = buildTestBatchReqs(buildTestRedisReq(3, "set", "test:k", "v2"))
+	_, err = sm.ApplyRaftRequest(false, reqList, 2, 11, stop)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(11), sm.getSyncedState().SyncedIndex)
+
+	_, err = sm.GetSnapshot(2, 11)
+	assert.Nil(t, err)
+	sm.Close()
+
+	// restart from the checkpoint
+	sm2, _ := newTestKafkaSinkSM(t, tmpDir)
+	assert.Equal(t, uint64(11), sm2.getSyncedState().SyncedIndex)
+	_, err = sm2.ApplyRaftRequest(true, reqList, 2, 11, stop)
+	assert.Nil(t, err)
+
+	// the older snapshot is ignored, and the newer snapshot skip the compacted logs
+	var snap raftpb.Snapshot
+	snap.Metadata.Term = 2
+	snap.Metadata.Index = 5
+	assert.Nil(t, sm2.RestoreFromSnapshot(false, snap, stop))
+	assert.Equal(t, uint64(11), sm2.getSyncedState().SyncedIndex)
+	snap.Metadata.Index = 20
+	assert.Nil(t, sm2.RestoreFromSnapshot(false, snap, stop))
+	assert.Equal(t, uint64(20), sm2.getSyncedState().SyncedIndex)
+	ss, err = sm2.loadCheckpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), ss.SyncedIndex)
+	sm2.Close()
+
+	sm2.Destroy()
+	ss, err = sm2.loadCheckpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), ss.SyncedIndex)
+}
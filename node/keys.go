@@ -20,13 +20,24 @@ func (nd *KVNode) Lookup(key []byte) ([]byte, error) {
 
 func (nd *KVNode) getCommand(conn redcon.Conn, cmd redcon.Command) {
 	val, err := nd.store.LocalLookup(cmd.Args[1])
-	if err != nil || val == nil {
+	if err != nil {
+		conn.WriteError(err.Error())
+	} else if val == nil {
 		conn.WriteNull()
 	} else {
 		conn.WriteBulk(val)
 	}
 }
 
+func (nd *KVNode) typeCommand(conn redcon.Conn, cmd redcon.Command) {
+	t, err := nd.store.KeyType(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteString(t)
+	}
+}
+
 func (nd *KVNode) existsCommand(cmd redcon.Command) (interface{}, error) {
 	val, err := nd.store.KVExists(cmd.Args[1:]...)
 	return val, err
@@ -67,6 +78,17 @@ func (nd *KVNode) setnxCommand(conn redcon.Conn, cmd redcon.Command, v interface
 	}
 }
 
+func (nd *KVNode) getsetCommand(conn redcon.Conn, cmd redcon.Command, v interface{}) {
+	rsp, ok := v.([]byte)
+	if !ok {
+		conn.WriteError(errInvalidResponse.Error())
+	} else if rsp == nil {
+		conn.WriteNull()
+	} else {
+		conn.WriteBulk(rsp)
+	}
+}
+
 func (nd *KVNode) msetCommand(cmd redcon.Command, v interface{}) (interface{}, error) {
 	return nil, nil
 }
@@ -116,6 +138,11 @@ func (kvsm *kvStoreSM) localSetnxCommand(cmd redcon.Command, ts int64) (interfac
 	return v, err
 }
 
+func (kvsm *kvStoreSM) localGetSetCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	v, err := kvsm.store.GetSet(ts, cmd.Args[1], cmd.Args[2])
+	return v, err
+}
+
 func (kvsm *kvStoreSM) localMSetCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	args := cmd.Args[1:]
 	kvlist := make([]common.KVRecord, 0, len(args)/2)
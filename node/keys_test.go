@@ -187,3 +187,99 @@ func TestKVNode_kvCommand(t *testing.T) {
 		assert.Nil(t, c.GetError())
 	}
 }
+
+func TestKVNode_ClientRequestDedup(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+
+	testKey := []byte("test:dedup")
+	incrCmd := buildCommand([][]byte{[]byte("incr"), testKey})
+	rsp, err := nd.ProposeWithClientID(incrCmd.Raw, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rsp)
+	// retry should get the cached result without applying again
+	rsp, err = nd.ProposeWithClientID(incrCmd.Raw, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rsp)
+	// different client should not be affected
+	rsp, err = nd.ProposeWithClientID(incrCmd.Raw, 2, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rsp)
+	rsp, err = nd.ProposeWithClientID(incrCmd.Raw, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), rsp)
+	_, err = nd.ProposeWithClientID(incrCmd.Raw, 1, 1)
+	assert.Equal(t, errStaleClientRequest, err)
+
+	v, err := nd.sm.(*kvStoreSM).store.KVGet(testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(v))
+}
+
+func TestKVNode_ActiveActiveSyncConflict(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	nd.sm.(*kvStoreSM).machineConfig.ActiveActiveSync = true
+
+	testKey := []byte("test:active_active")
+	buildSyncReq := func(ts int64, v string) []byte {
+		var reqList BatchInternalRaftRequest
+		cmd := buildCommand([][]byte{[]byte("set"), testKey, []byte(v)})
+		reqList.Reqs = append(reqList.Reqs, &InternalRaftRequest{
+			Header: &RequestHeader{DataType: int32(RedisReq), Timestamp: ts},
+			Data:   cmd.Raw,
+		})
+		reqList.ReqNum = 1
+		reqList.Timestamp = ts
+		reqList.OrigCluster = "remote-test"
+		buf, err := reqList.Marshal()
+		assert.Nil(t, err)
+		return buf
+	}
+	oldTs := time.Now().UnixNano()
+	setCmd := buildCommand([][]byte{[]byte("set"), testKey, []byte("local")})
+	_, err := nd.Propose(setCmd.Raw)
+	assert.Nil(t, err)
+	// the older write from remote should be ignored
+	err = nd.ProposeRawAndWait(buildSyncReq(oldTs, "remote-old"), 1, 1, oldTs)
+	assert.Nil(t, err)
+	v, err := nd.sm.(*kvStoreSM).store.KVGet(testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "local", string(v))
+
+	newTs := time.Now().UnixNano()
+	err = nd.ProposeRawAndWait(buildSyncReq(newTs, "remote-new"), 1, 2, newTs)
+	assert.Nil(t, err)
+	v, err = nd.sm.(*kvStoreSM).store.KVGet(testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "remote-new", string(v))
+}
+
+func TestKVNode_RecountTableKeys(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+
+	c := &fakeRedisConn{}
+	handler, _, _ := nd.router.GetCmdHandler("set")
+	for i := 0; i < 3; i++ {
+		c.Reset()
+		handler(c, buildCommand([][]byte{[]byte("set"), []byte(fmt.Sprintf("default:test:recount%d", i)), []byte("v")}))
+		assert.Nil(t, c.GetError())
+	}
+	// the recount is applied in the state machine, so the status is ready after the proposal returned
+	err := nd.RecountTableKeys("test")
+	assert.Nil(t, err)
+	st, err := nd.GetRecountStatus()
+	assert.Nil(t, err)
+	assert.Equal(t, "test", st.Table)
+	assert.False(t, st.Running)
+	assert.Equal(t, int64(3), st.OldCount)
+	assert.Equal(t, int64(3), st.NewCount)
+	assert.Equal(t, "", st.Err)
+}
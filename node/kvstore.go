@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
 	"github.com/absolute8511/ZanRedisDB/rockredis"
 )
 
@@ -18,8 +19,10 @@ type KVOptions struct {
 	DataDir          string
 	EngType          string
 	ExpirationPolicy common.ExpirationPolicy
-	RockOpts         rockredis.RockOptions
-	SharedConfig     *rockredis.SharedRockConfig
+	RockOpts         engine.RockOptions
+	SharedConfig     engine.SharedRockConfig
+	SnapKeyProvider  common.SnapKeyProvider
+	IterLimiter      *engine.IteratorLimiter `json:"-"`
 }
 
 func NewKVStore(kvopts *KVOptions) (*KVStore, error) {
@@ -42,6 +45,8 @@ func (s *KVStore) openDB() error {
 		cfg.RockOptions = s.opts.RockOpts
 		cfg.ExpirationPolicy = s.opts.ExpirationPolicy
 		cfg.SharedConfig = s.opts.SharedConfig
+		cfg.SnapKeyProvider = s.opts.SnapKeyProvider
+		cfg.IterLimiter = s.opts.IterLimiter
 		s.RockDB, err = rockredis.OpenRockDB(cfg)
 		if err != nil {
 			nodeLog.Warningf("failed to open rocksdb: %v", err)
@@ -3,13 +3,14 @@ package node
 import (
 	"strconv"
 
+	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/absolute8511/redcon"
 )
 
 func (nd *KVNode) lindexCommand(conn redcon.Conn, cmd redcon.Command) {
 	index, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	val, err := nd.store.LIndex(cmd.Args[1], index)
@@ -23,7 +24,7 @@ func (nd *KVNode) lindexCommand(conn redcon.Conn, cmd redcon.Command) {
 func (nd *KVNode) llenCommand(conn redcon.Conn, cmd redcon.Command) {
 	n, err := nd.store.LLen(cmd.Args[1])
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	conn.WriteInt64(n)
@@ -31,23 +32,23 @@ func (nd *KVNode) llenCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) lrangeCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	start, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	end, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 
 	vlist, err := nd.store.LRange(cmd.Args[1], start, end)
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	conn.WriteArray(len(vlist))
@@ -82,12 +83,12 @@ func (nd *KVNode) lpushCommand(conn redcon.Conn, cmd redcon.Command, v interface
 
 func (nd *KVNode) lsetCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	_, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	_, _, ok := rebuildFirstKeyAndPropose(nd, conn, cmd)
@@ -100,7 +101,7 @@ func (nd *KVNode) lsetCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) ltrimCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	_, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
@@ -0,0 +1,32 @@
+package node
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+// updateWriteQPS compute the write rate by the raft logs applied since the last check
+func (nd *KVNode) updateWriteQPS(now time.Time) {
+	applied := atomic.LoadUint64(&nd.appliedIndex)
+	lastIndex := atomic.SwapUint64(&nd.loadCheckIndex, applied)
+	lastTs := atomic.SwapInt64(&nd.loadCheckTs, now.UnixNano())
+	if lastTs == 0 || applied < lastIndex {
+		// the first check or the data restored from the snapshot
+		return
+	}
+	cost := now.UnixNano() - lastTs
+	if cost < int64(time.Second) {
+		return
+	}
+	atomic.StoreInt64(&nd.writeQPS, int64(applied-lastIndex)*int64(time.Second)/cost)
+}
+
+func (nd *KVNode) GetLoadStats() *common.LoadStats {
+	return &common.LoadStats{
+		DataBytes: atomic.LoadInt64(&nd.usedBytes),
+		Keys:      atomic.LoadInt64(&nd.usedKeys),
+		WriteQPS:  atomic.LoadInt64(&nd.writeQPS),
+	}
+}
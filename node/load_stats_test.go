@@ -0,0 +1,32 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteQPS(t *testing.T) {
+	nd := &KVNode{}
+	now := time.Now()
+	atomic.StoreUint64(&nd.appliedIndex, 100)
+	nd.updateWriteQPS(now)
+	assert.Equal(t, int64(0), nd.GetLoadStats().WriteQPS)
+
+	atomic.StoreUint64(&nd.appliedIndex, 400)
+	nd.updateWriteQPS(now.Add(time.Second * 30))
+	assert.Equal(t, int64(10), nd.GetLoadStats().WriteQPS)
+
+	// the applied index may be reset by the snapshot
+	atomic.StoreUint64(&nd.appliedIndex, 10)
+	nd.updateWriteQPS(now.Add(time.Second * 60))
+	assert.Equal(t, int64(10), nd.GetLoadStats().WriteQPS)
+
+	atomic.StoreInt64(&nd.usedBytes, 1000)
+	atomic.StoreInt64(&nd.usedKeys, 10)
+	ls := nd.GetLoadStats()
+	assert.Equal(t, int64(1000), ls.DataBytes)
+	assert.Equal(t, int64(10), ls.Keys)
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/pkg/fileutil"
+)
+
+// avoid the snapshot too often for the retention since the snapshot may be costly
+const minRetentionSnapInterval = time.Minute
+
+// SetLogRetention set the max size and age (in seconds) of the raft logs since the
+// last snapshot, 0 means no limit.
+func (nn *NamespaceNode) SetLogRetention(maxBytes int64, maxSecs int64) {
+	nn.Node.setLogRetention(maxBytes, maxSecs)
+}
+
+func (nd *KVNode) setLogRetention(maxBytes int64, maxSecs int64) {
+	oldBytes := atomic.SwapInt64(&nd.logRetentionBytes, maxBytes)
+	oldSecs := atomic.SwapInt64(&nd.logRetentionSecs, maxSecs)
+	if oldBytes != maxBytes || oldSecs != maxSecs {
+		nd.rn.Infof("raft log retention changed to %v bytes, %v seconds", maxBytes, maxSecs)
+	}
+}
+
+func (nd *KVNode) resetLogSinceSnapshot() {
+	atomic.StoreInt64(&nd.logBytesSinceSnap, 0)
+	atomic.StoreInt64(&nd.lastSnapshotTs, time.Now().UnixNano())
+}
+
+// exceedLogRetention check whether the logs since the last snapshot exceed the retention
+func (nd *KVNode) exceedLogRetention(now time.Time) bool {
+	sinceSnap := now.UnixNano() - atomic.LoadInt64(&nd.lastSnapshotTs)
+	if sinceSnap < int64(minRetentionSnapInterval) {
+		return false
+	}
+	maxBytes := atomic.LoadInt64(&nd.logRetentionBytes)
+	if maxBytes > 0 && atomic.LoadInt64(&nd.logBytesSinceSnap) > maxBytes {
+		return true
+	}
+	maxSecs := atomic.LoadInt64(&nd.logRetentionSecs)
+	if maxSecs > 0 && sinceSnap > maxSecs*int64(time.Second) {
+		return true
+	}
+	return false
+}
+
+func (nd *KVNode) GetRaftLogStats() *common.RaftLogStats {
+	ls := &common.RaftLogStats{
+		RetentionBytes:     atomic.LoadInt64(&nd.logRetentionBytes),
+		RetentionSecs:      atomic.LoadInt64(&nd.logRetentionSecs),
+		BytesSinceSnapshot: atomic.LoadInt64(&nd.logBytesSinceSnap),
+		LastSnapshotTime:   atomic.LoadInt64(&nd.lastSnapshotTs) / int64(time.Millisecond),
+	}
+	names, err := fileutil.ReadDir(nd.rn.config.WALDir)
+	if err != nil {
+		return ls
+	}
+	for _, name := range names {
+		fi, err := os.Stat(path.Join(nd.rn.config.WALDir, name))
+		if err == nil && fi.Mode().IsRegular() {
+			ls.WALBytes += fi.Size()
+		}
+	}
+	return ls
+}
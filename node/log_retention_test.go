@@ -0,0 +1,35 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaftLogRetention(t *testing.T) {
+	nd := &KVNode{rn: &raftNode{config: &RaftConfig{WALDir: "/not-exist-wal-dir"}}}
+	nd.resetLogSinceSnapshot()
+	now := time.Now()
+	// no retention configured
+	assert.False(t, nd.exceedLogRetention(now.Add(time.Hour)))
+
+	nd.setLogRetention(1000, 0)
+	atomic.AddInt64(&nd.logBytesSinceSnap, 2000)
+	// should not snapshot too often
+	assert.False(t, nd.exceedLogRetention(now))
+	assert.True(t, nd.exceedLogRetention(now.Add(minRetentionSnapInterval*2)))
+
+	nd.resetLogSinceSnapshot()
+	assert.False(t, nd.exceedLogRetention(now.Add(minRetentionSnapInterval*2)))
+	nd.setLogRetention(0, 3600)
+	assert.False(t, nd.exceedLogRetention(now.Add(time.Minute*30)))
+	assert.True(t, nd.exceedLogRetention(now.Add(time.Hour*2)))
+
+	ls := nd.GetRaftLogStats()
+	assert.Equal(t, int64(0), ls.RetentionBytes)
+	assert.Equal(t, int64(3600), ls.RetentionSecs)
+	assert.Equal(t, int64(0), ls.BytesSinceSnapshot)
+	assert.Equal(t, int64(0), ls.WALBytes)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
@@ -38,6 +39,12 @@ type RemoteLogSender struct {
 	connPool          map[string]ccAPIClient
 	zanCluster        *zanredisdb.Cluster
 	remoteClusterAddr string
+	compressType      syncerpb.RaftLogCompressType
+	limiter           *syncBandwidthLimiter
+	sentBytes         int64
+	// the compress types supported by the remote cluster, the logs will be sent
+	// without compression until the remote supported types are known.
+	remoteCompress uint32
 }
 
 func NewRemoteLogSender(localCluster string, fullName string, remoteCluster string) (*RemoteLogSender, error) {
@@ -92,6 +99,18 @@ func (s *RemoteLogSender) Stop() {
 	}
 }
 
+// SetTrafficControl set the compression and the bandwidth limit (bytes per second) for
+// the raft logs sent to remote, should be called before sending.
+func (s *RemoteLogSender) SetTrafficControl(compressType string, maxBandwidth int64) error {
+	t, err := parseSyncerCompressType(compressType)
+	if err != nil {
+		return err
+	}
+	s.compressType = t
+	s.limiter = newSyncBandwidthLimiter(maxBandwidth)
+	return nil
+}
+
 func (s *RemoteLogSender) GetStats() interface{} {
 	return nil
 }
@@ -157,27 +176,46 @@ func (s *RemoteLogSender) getAllAddressesForPart() ([]string, error) {
 	return addrs, nil
 }
 
-func (s *RemoteLogSender) doSendOnce(r []*BatchInternalRaftRequest) error {
-	if s.remoteClusterAddr == "" {
-		nodeLog.Infof("sending log with no remote: %v", r)
-		return nil
-	}
-	c, addr, err := s.getClient()
-	if c == nil {
-		nodeLog.Infof("sending(%v) log failed to get grpc client: %v", addr, err)
-		return errors.New("failed to get grpc client")
-	}
+func (s *RemoteLogSender) buildRaftLogs(r []*BatchInternalRaftRequest) ([]*syncerpb.RaftLogData, int, error) {
 	raftLogs := make([]*syncerpb.RaftLogData, len(r))
+	total := 0
 	for i, e := range r {
 		var rld syncerpb.RaftLogData
 		raftLogs[i] = &rld
 		raftLogs[i].Type = syncerpb.EntryNormalRaw
-		raftLogs[i].Data, _ = e.Marshal()
+		data, err := marshalBatchWithCrc(e, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		// the old version remote can only decode the codec it supported
+		ct := negotiateSyncerCompress(s.compressType, atomic.LoadUint32(&s.remoteCompress))
+		if ct != syncerpb.NoCompress {
+			data, err = compressRaftLogData(ct, data)
+			if err != nil {
+				return nil, 0, err
+			}
+			raftLogs[i].CompressType = ct
+		}
+		raftLogs[i].Data = data
 		raftLogs[i].Term = e.OrigTerm
 		raftLogs[i].Index = e.OrigIndex
 		raftLogs[i].RaftTimestamp = e.Timestamp
 		raftLogs[i].RaftGroupName = s.grpName
 		raftLogs[i].ClusterName = s.localCluster
+		total += len(data)
+	}
+	return raftLogs, total, nil
+}
+
+func (s *RemoteLogSender) doSendOnce(raftLogs []*syncerpb.RaftLogData) error {
+	if s.remoteClusterAddr == "" {
+		nodeLog.Infof("sending log with no remote: %v", raftLogs)
+		return nil
+	}
+	c, addr, err := s.getClient()
+	if c == nil {
+		nodeLog.Infof("sending(%v) log failed to get grpc client: %v", addr, err)
+		return errors.New("failed to get grpc client")
 	}
 
 	in := &syncerpb.RaftReqs{RaftLog: raftLogs}
@@ -384,6 +422,11 @@ func (s *RemoteLogSender) getRemoteSyncedRaftOnce() (SyncedState, error) {
 	state.SyncedTerm = rsp.Term
 	state.SyncedIndex = rsp.Index
 	state.Timestamp = rsp.Timestamp
+	old := atomic.SwapUint32(&s.remoteCompress, rsp.CompressTypes)
+	if old != rsp.CompressTypes && negotiateSyncerCompress(s.compressType, rsp.CompressTypes) != s.compressType {
+		nodeLog.Infof("remote(%v) not support the compress type %v, sending without compression",
+			addr, s.compressType)
+	}
 	nodeLog.Debugf("remote(%v) raft group %v synced : %v", addr, s.grpName, state)
 	return state, nil
 }
@@ -430,14 +473,28 @@ func (s *RemoteLogSender) sendRaftLog(r []*BatchInternalRaftRequest, stop chan s
 		return nil
 	}
 	first := r[0]
-	err := sendRpcAndRetry(func() error {
-		err := s.doSendOnce(r)
+	raftLogs, size, err := s.buildRaftLogs(r)
+	if err != nil {
+		return err
+	}
+	if s.limiter != nil {
+		// wait before sending to avoid the burst traffic saturate the cross-DC network
+		err = s.limiter.wait(size, stop)
+		if err != nil {
+			return err
+		}
+	}
+	err = sendRpcAndRetry(func() error {
+		err := s.doSendOnce(raftLogs)
 		if err != nil {
 			nodeLog.Infof("failed to send raft log : %v, at %v-%v",
 				err.Error(), first.OrigTerm, first.OrigIndex)
 		}
 		return err
 	}, "sendRaftLog", stop)
+	if err == nil {
+		atomic.AddInt64(&s.sentBytes, int64(size))
+	}
 	return err
 }
 
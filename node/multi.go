@@ -13,7 +13,7 @@ func (nd *KVNode) plsetCommand(cmd redcon.Command, rsp interface{}) (interface{}
 
 func (kvsm *kvStoreSM) localPlsetCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	if len(cmd.Args) < 3 || (len(cmd.Args)-1)%2 != 0 {
-		return nil, errors.New("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return nil, errors.New(common.WrongArgsNumError(cmd.Args[0]))
 	}
 
 	var kvpairs []common.KVRecord
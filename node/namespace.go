@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,8 +14,10 @@ import (
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
 	"github.com/absolute8511/ZanRedisDB/rockredis"
 	"github.com/absolute8511/ZanRedisDB/transport/rafthttp"
+	"github.com/absolute8511/ZanRedisDB/wal"
 	"github.com/spaolacci/murmur3"
 	"golang.org/x/net/context"
 )
@@ -146,6 +149,9 @@ func (nn *NamespaceNode) TransferMyLeader(to uint64, toRaftID uint64) error {
 
 type NamespaceMeta struct {
 	PartitionNum int
+	// the new partition number and the state while expanding the partitions online
+	ExpandPartitionNum int
+	ExpandState        string
 }
 
 type NamespaceMgr struct {
@@ -160,6 +166,12 @@ type NamespaceMgr struct {
 	wg            sync.WaitGroup
 	clusterInfo   common.IClusterInfo
 	newLeaderChan chan string
+	// the open iterators limiter shared by the partitions of the namespace
+	iterLimiters map[string]*engine.IteratorLimiter
+	// batch the wal fsyncs of all the partitions
+	walSyncer *wal.GroupSyncer
+	// the alias names of the renamed namespaces, alias -> namespace
+	nsAliases map[string]string
 }
 
 func NewNamespaceMgr(transport *rafthttp.Transport, conf *MachineConfig) *NamespaceMgr {
@@ -170,6 +182,10 @@ func NewNamespaceMgr(transport *rafthttp.Transport, conf *MachineConfig) *Namesp
 		raftTransport: transport,
 		machineConf:   conf,
 		newLeaderChan: make(chan string, 2048),
+		iterLimiters:  make(map[string]*engine.IteratorLimiter),
+	}
+	if conf.WALBatchSync {
+		ns.walSyncer = wal.NewGroupSyncer()
 	}
 	regID, err := ns.LoadMachineRegID()
 	if err != nil {
@@ -231,6 +247,12 @@ func (nsm *NamespaceMgr) Start() {
 		defer nsm.wg.Done()
 		nsm.processRaftTick()
 	}()
+
+	nsm.wg.Add(1)
+	go func() {
+		defer nsm.wg.Done()
+		nsm.processPeriodicTasks()
+	}()
 }
 
 func (nsm *NamespaceMgr) Stop() {
@@ -243,6 +265,9 @@ func (nsm *NamespaceMgr) Stop() {
 		n.Close()
 	}
 	nsm.wg.Wait()
+	if nsm.walSyncer != nil {
+		nsm.walSyncer.Stop()
+	}
 	nodeLog.Infof("namespace manager stopped")
 	if nsm.machineConf.RocksDBSharedConfig != nil {
 		nsm.machineConf.RocksDBSharedConfig.Destroy()
@@ -289,8 +314,10 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 		RockOpts:         nsm.machineConf.RocksDBOpts,
 		ExpirationPolicy: expPolicy,
 		SharedConfig:     nsm.machineConf.RocksDBSharedConfig,
+		SnapKeyProvider:  nsm.machineConf.SnapKeyProvider,
 	}
-	rockredis.FillDefaultOptions(&kvOpts.RockOpts)
+	engine.ApplyOptionsOverride(&kvOpts.RockOpts, conf.RocksDBOpts)
+	engine.FillDefaultOptions(&kvOpts.RockOpts)
 
 	if conf.PartitionNum <= 0 {
 		return nil, errNamespaceConfInvalid
@@ -312,6 +339,15 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	if n, ok := nsm.kvNodes[conf.Name]; ok {
 		return n, ErrNamespaceAlreadyExist
 	}
+	if kvOpts.RockOpts.MaxOpenIterators > 0 {
+		limiter, ok := nsm.iterLimiters[conf.BaseName]
+		if !ok {
+			limiter = engine.NewIteratorLimiter(kvOpts.RockOpts.MaxOpenIterators,
+				time.Duration(kvOpts.RockOpts.IteratorWaitMs)*time.Millisecond)
+			nsm.iterLimiters[conf.BaseName] = limiter
+		}
+		kvOpts.IterLimiter = limiter
+	}
 
 	d, _ := json.MarshalIndent(&conf, "", " ")
 	nodeLog.Infof("namespace load config: %v", string(d))
@@ -330,6 +366,7 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 		Replicator:     conf.Replicator,
 		OptimizedFsync: conf.OptimizedFsync,
 		KeepWAL:        nsm.machineConf.KeepWAL,
+		walSyncer:      nsm.walSyncer,
 	}
 	kv, err := NewKVNode(kvOpts, nsm.machineConf, raftConf, nsm.raftTransport,
 		join, nsm.onNamespaceDeleted(raftConf.GroupID, conf.Name),
@@ -347,6 +384,9 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 		Node: kv,
 		conf: conf,
 	}
+	n.SetQuota(conf.QuotaMaxKeys, conf.QuotaMaxBytes)
+	n.SetLogRetention(conf.LogRetentionBytes, conf.LogRetentionSecs)
+	n.SetFrozen(conf.Frozen)
 
 	nsm.kvNodes[conf.Name] = n
 	nsm.groups[raftConf.GroupID] = conf.Name
@@ -360,6 +400,7 @@ func GetHashedPartitionID(pk []byte, pnum int) int {
 func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKey(nsBaseName string, pk []byte) (*NamespaceNode, error) {
 	nsm.mutex.RLock()
 	defer nsm.mutex.RUnlock()
+	nsBaseName = nsm.resolveAlias(nsBaseName)
 	v, ok := nsm.nsMetas[nsBaseName]
 	if !ok {
 		nodeLog.Infof("namespace %v meta not found", nsBaseName)
@@ -378,8 +419,117 @@ func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKey(nsBaseName string, pk []
 	return n, nil
 }
 
+// resolveAlias return the namespace renamed to the alias name, or the name itself if not an
+// alias, should be called with the lock held.
+func (nsm *NamespaceMgr) resolveAlias(nsBaseName string) string {
+	if _, ok := nsm.nsMetas[nsBaseName]; ok {
+		return nsBaseName
+	}
+	if ns, ok := nsm.nsAliases[nsBaseName]; ok {
+		return ns
+	}
+	return nsBaseName
+}
+
+// SetNamespaceAlias update the alias name of the namespace from the cluster, the commands
+// to the alias name will be routed to the namespace. The empty alias remove the alias.
+func (nsm *NamespaceMgr) SetNamespaceAlias(nsBaseName string, alias string) {
+	nsm.mutex.Lock()
+	defer nsm.mutex.Unlock()
+	if alias != "" && nsm.nsAliases[alias] == nsBaseName {
+		return
+	}
+	for k, v := range nsm.nsAliases {
+		if v == nsBaseName {
+			delete(nsm.nsAliases, k)
+		}
+	}
+	if alias == "" {
+		return
+	}
+	if nsm.nsAliases == nil {
+		nsm.nsAliases = make(map[string]string)
+	}
+	nsm.nsAliases[alias] = nsBaseName
+	nodeLog.Infof("namespace %v alias name changed to %v", nsBaseName, alias)
+}
+
+// SetNamespaceExpansion update the partition number and the expanding state of the namespace
+// from the cluster, the routing will be changed to the new partition number, and the data
+// migration will be started on the local partitions led by this node.
+func (nsm *NamespaceMgr) SetNamespaceExpansion(nsBaseName string, partitionNum int, expandNum int, state string) {
+	if atomic.LoadInt32(&nsm.stopping) == 1 || partitionNum <= 0 {
+		return
+	}
+	nsm.mutex.Lock()
+	meta, ok := nsm.nsMetas[nsBaseName]
+	if !ok {
+		nsm.mutex.Unlock()
+		return
+	}
+	if meta.PartitionNum != partitionNum {
+		nodeLog.Infof("namespace %v partition number changed from %v to %v", nsBaseName, meta.PartitionNum, partitionNum)
+	}
+	meta.PartitionNum = partitionNum
+	meta.ExpandPartitionNum = expandNum
+	meta.ExpandState = state
+	nsm.nsMetas[nsBaseName] = meta
+	nodeList := make([]*NamespaceNode, 0)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if baseName == nsBaseName {
+			nodeList = append(nodeList, n)
+		}
+	}
+	nsm.mutex.Unlock()
+
+	st := &reshardState{
+		partitionNum: partitionNum,
+		expandNum:    expandNum,
+		state:        state,
+	}
+	target := func(pid int) *KVNode {
+		n := nsm.GetNamespaceNode(common.GetNsDesp(nsBaseName, pid))
+		if n == nil {
+			return nil
+		}
+		return n.Node
+	}
+	for _, n := range nodeList {
+		if !n.IsReady() || !n.Node.setReshardState(st) {
+			continue
+		}
+		nsm.wg.Add(1)
+		go func(n *NamespaceNode) {
+			defer nsm.wg.Done()
+			n.Node.runReshard(target, nsm.stopC)
+		}(n)
+	}
+}
+
+// GetReshardStatus return the migration status of the partitions led by this node
+func (nsm *NamespaceMgr) GetReshardStatus(ns string) map[string]common.PartitionReshardStatus {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	status := make(map[string]common.PartitionReshardStatus)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		if !n.IsReady() || !n.Node.IsLead() {
+			continue
+		}
+		status[k] = n.Node.GetReshardStatus()
+	}
+	return status
+}
+
 func (nsm *NamespaceMgr) GetNamespaceNodes(nsBaseName string, leaderOnly bool) (map[string]*NamespaceNode, error) {
 	nsNodes := make(map[string]*NamespaceNode)
+	nsm.mutex.RLock()
+	nsBaseName = nsm.resolveAlias(nsBaseName)
+	nsm.mutex.RUnlock()
 
 	tmp := nsm.GetNamespaces()
 	for k, v := range tmp {
@@ -539,6 +689,280 @@ func (nsm *NamespaceMgr) OptimizeDB(ns string, table string) {
 	}
 }
 
+// compact the table range of all the local partitions in background
+func (nsm *NamespaceMgr) CompactTableRange(ns string, table string, start []byte, end []byte) {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	nsm.wg.Add(1)
+	go func() {
+		defer nsm.wg.Done()
+		for _, n := range nodeList {
+			if atomic.LoadInt32(&nsm.stopping) == 1 {
+				return
+			}
+			if n.IsReady() {
+				n.Node.CompactTableRange(table, start, end)
+			}
+		}
+	}()
+}
+
+func (nsm *NamespaceMgr) GetCompactProgress(ns string) map[string]rockredis.CompactProgress {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	progress := make(map[string]rockredis.CompactProgress)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		if !n.IsReady() {
+			continue
+		}
+		p, err := n.Node.GetCompactProgress()
+		if err != nil {
+			continue
+		}
+		progress[k] = p
+	}
+	return progress
+}
+
+// propose the recount of the table keys for all the partitions led by this node in background
+func (nsm *NamespaceMgr) RecountTableKeys(ns string, table string) {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	nsm.wg.Add(1)
+	go func() {
+		defer nsm.wg.Done()
+		for _, n := range nodeList {
+			if atomic.LoadInt32(&nsm.stopping) == 1 {
+				return
+			}
+			if n.IsReady() && n.Node.IsLead() {
+				n.Node.RecountTableKeys(table)
+			}
+		}
+	}()
+}
+
+func (nsm *NamespaceMgr) GetRecountStatus(ns string) map[string]rockredis.RecountStatus {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	status := make(map[string]rockredis.RecountStatus)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		if !n.IsReady() {
+			continue
+		}
+		st, err := n.Node.GetRecountStatus()
+		if err != nil {
+			continue
+		}
+		status[k] = st
+	}
+	return status
+}
+
+// scan the big keys of the table in all the partitions in background
+func (nsm *NamespaceMgr) ScanBigKeys(ns string, table string, minSize int64, minElements int64) {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	nsm.wg.Add(1)
+	go func() {
+		defer nsm.wg.Done()
+		for _, n := range nodeList {
+			if atomic.LoadInt32(&nsm.stopping) == 1 {
+				return
+			}
+			if n.IsReady() {
+				n.Node.ScanBigKeys(table, minSize, minElements)
+			}
+		}
+	}()
+}
+
+func (nsm *NamespaceMgr) GetBigKeyScanStatus(ns string) map[string]rockredis.BigKeyScanStatus {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	status := make(map[string]rockredis.BigKeyScanStatus)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		if !n.IsReady() {
+			continue
+		}
+		st, err := n.Node.GetBigKeyScanStatus()
+		if err != nil {
+			continue
+		}
+		status[k] = st
+	}
+	return status
+}
+
+// inspect the tables in all the partitions in background
+func (nsm *NamespaceMgr) InspectTables(ns string, table string) {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	nsm.wg.Add(1)
+	go func() {
+		defer nsm.wg.Done()
+		for _, n := range nodeList {
+			if atomic.LoadInt32(&nsm.stopping) == 1 {
+				return
+			}
+			if n.IsReady() {
+				n.Node.InspectTables(table)
+			}
+		}
+	}()
+}
+
+func (nsm *NamespaceMgr) GetTableInspectStatus(ns string) map[string]rockredis.TableInspectStatus {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	status := make(map[string]rockredis.TableInspectStatus)
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		if !n.IsReady() {
+			continue
+		}
+		st, err := n.Node.GetTableInspectStatus()
+		if err != nil {
+			continue
+		}
+		status[k] = st
+	}
+	return status
+}
+
+// GetTableStats return the key count and the disk usage of the tables summed over the
+// partitions led by this node, so the sum of all the nodes is the size of the whole
+// namespace. The tables of all the namespaces will be summed if the namespace is empty.
+func (nsm *NamespaceMgr) GetTableStats(ns string, table string) ([]common.TableStats, error) {
+	nsm.mutex.RLock()
+	if ns != "" {
+		ns = nsm.resolveAlias(ns)
+	}
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	found := false
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != "" && ns != baseName {
+			continue
+		}
+		found = true
+		if !n.IsReady() || !n.Node.IsLead() {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	if ns != "" && !found {
+		return nil, ErrNamespaceNotFound
+	}
+	merged := make(map[string]*common.TableStats)
+	for _, n := range nodeList {
+		tStats, err := n.Node.GetTableStats(table)
+		if err != nil {
+			continue
+		}
+		for _, ts := range tStats {
+			m, ok := merged[ts.Name]
+			if !ok {
+				m = &common.TableStats{Name: ts.Name}
+				merged[ts.Name] = m
+			}
+			m.KeyNum += ts.KeyNum
+			m.ApproximateKeyNum += ts.ApproximateKeyNum
+			m.DiskBytesUsage += ts.DiskBytesUsage
+		}
+	}
+	tStats := make([]common.TableStats, 0, len(merged))
+	for _, m := range merged {
+		tStats = append(tStats, *m)
+	}
+	sort.Slice(tStats, func(i, j int) bool { return tStats[i].Name < tStats[j].Name })
+	return tStats, nil
+}
+
+// GetTables return the sorted table names of all the local partitions of the namespace
+func (nsm *NamespaceMgr) GetTables(ns string) ([]string, error) {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	if len(nodeList) == 0 {
+		return nil, ErrNamespaceNotFound
+	}
+	merged := make(map[string]bool)
+	for _, n := range nodeList {
+		if !n.IsReady() {
+			continue
+		}
+		tables, err := n.Node.GetTables()
+		if err != nil {
+			continue
+		}
+		for _, t := range tables {
+			merged[t] = true
+		}
+	}
+	tables := make([]string, 0, len(merged))
+	for t := range merged {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
 func (nsm *NamespaceMgr) DeleteRange(ns string, dtr DeleteTableRange) error {
 	nsm.mutex.RLock()
 	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
@@ -564,6 +988,182 @@ func (nsm *NamespaceMgr) DeleteRange(ns string, dtr DeleteTableRange) error {
 	return nil
 }
 
+// CheckDeleteRange check the table can be deleted on all the local partitions
+func (nsm *NamespaceMgr) CheckDeleteRange(ns string, table string) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	if len(nodeList) == 0 {
+		return ErrNamespaceNotFound
+	}
+	for _, n := range nodeList {
+		if n.IsReady() {
+			err := n.Node.CheckDeleteRange(table)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) DropTable(ns string, table string) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.DropTable(table)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) SetTableValueCompress(ns string, table string, vc common.ValueCompressSchema) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.SetTableValueCompress(table, vc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) SetTableZsetScoreIndex(ns string, table string, zi common.ZsetScoreIndexSchema) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.SetTableZsetScoreIndex(table, zi)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) AddFullTextIndex(ns string, table string, ft common.FullTextIndexSchema) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.AddFullTextIndex(table, ft)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) DelFullTextIndex(ns string, table string, name string) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.DelFullTextIndex(table, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (nsm *NamespaceMgr) SetDBOptions(ns string, o common.RockOptionsOverride) error {
+	nsm.mutex.RLock()
+	nodeList := make([]*NamespaceNode, 0, len(nsm.kvNodes))
+	for k, n := range nsm.kvNodes {
+		baseName, _ := common.GetNamespaceAndPartition(k)
+		if ns != baseName {
+			continue
+		}
+		nodeList = append(nodeList, n)
+	}
+	nsm.mutex.RUnlock()
+	for _, n := range nodeList {
+		if atomic.LoadInt32(&nsm.stopping) == 1 {
+			return common.ErrStopped
+		}
+		if n.IsReady() {
+			err := n.Node.SetDBOptions(o)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (nsm *NamespaceMgr) onNamespaceDeleted(gid uint64, ns string) func() {
 	return func() {
 		nsm.mutex.Lock()
@@ -578,6 +1178,18 @@ func (nsm *NamespaceMgr) onNamespaceDeleted(gid uint64, ns string) func() {
 	}
 }
 
+func (nsm *NamespaceMgr) getReadyNodes() []*KVNode {
+	nsm.mutex.RLock()
+	defer nsm.mutex.RUnlock()
+	nodes := make([]*KVNode, 0, len(nsm.kvNodes))
+	for _, v := range nsm.kvNodes {
+		if v.IsReady() {
+			nodes = append(nodes, v.Node)
+		}
+	}
+	return nodes
+}
+
 func (nsm *NamespaceMgr) processRaftTick() {
 	ticker := time.NewTicker(time.Duration(nsm.machineConf.TickMs) * time.Millisecond)
 	defer ticker.Stop()
@@ -585,14 +1197,7 @@ func (nsm *NamespaceMgr) processRaftTick() {
 		select {
 		case <-ticker.C:
 			// send tick for all raft group
-			nsm.mutex.RLock()
-			nodes := make([]*KVNode, 0, len(nsm.kvNodes))
-			for _, v := range nsm.kvNodes {
-				if v.IsReady() {
-					nodes = append(nodes, v.Node)
-				}
-			}
-			nsm.mutex.RUnlock()
+			nodes := nsm.getReadyNodes()
 			for _, n := range nodes {
 				n.Tick()
 			}
@@ -603,6 +1208,31 @@ func (nsm *NamespaceMgr) processRaftTick() {
 	}
 }
 
+// processPeriodicTasks run the periodic maintenance for all the raft groups in one
+// goroutine, so we do not need the goroutine and ticker for each raft group.
+func (nsm *NamespaceMgr) processPeriodicTasks() {
+	purgeTicker := time.NewTicker(raftFilePurgeInterval)
+	defer purgeTicker.Stop()
+	quotaTicker := time.NewTicker(quotaCheckInterval)
+	defer quotaTicker.Stop()
+	for {
+		select {
+		case <-purgeTicker.C:
+			for _, n := range nsm.getReadyNodes() {
+				n.rn.purgeFile()
+			}
+		case <-quotaTicker.C:
+			now := time.Now()
+			for _, n := range nsm.getReadyNodes() {
+				n.checkQuotaUsage()
+				n.updateWriteQPS(now)
+			}
+		case <-nsm.stopC:
+			return
+		}
+	}
+}
+
 // TODO:
 func (nsm *NamespaceMgr) SetNamespaceMagicCode(node *NamespaceNode, magic int64) error {
 	return nil
@@ -629,6 +1259,12 @@ func (nsm *NamespaceMgr) checkNamespaceRaftLeader() {
 		}
 		nsm.mutex.RUnlock()
 		for _, v := range leaderNodes {
+			if v.Node.GetElectionPriority() == ElectionPriorityNever {
+				if err := v.handOffLeader(); err != nil {
+					nodeLog.Infof("namespace %v hand off leader failed: %v", v.FullName(), err)
+				}
+				continue
+			}
 			v.Node.ReportMeLeaderToCluster()
 		}
 	}
@@ -645,6 +1281,13 @@ func (nsm *NamespaceMgr) checkNamespaceRaftLeader() {
 				nodeLog.Infof("leader changed namespace not found: %v", ns)
 			} else if v.IsReady() {
 				v.Node.OnRaftLeaderChanged()
+				if v.Node.IsLead() && v.Node.GetElectionPriority() == ElectionPriorityNever {
+					go func() {
+						if err := v.handOffLeader(); err != nil {
+							nodeLog.Infof("namespace %v hand off leader failed: %v", v.FullName(), err)
+						}
+					}()
+				}
 			}
 		case <-nsm.stopC:
 			return
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -23,11 +24,12 @@ import (
 	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
 	"github.com/absolute8511/ZanRedisDB/rockredis"
 	"github.com/absolute8511/ZanRedisDB/transport/rafthttp"
+	"github.com/absolute8511/redcon"
 )
 
 var (
 	errInvalidResponse      = errors.New("Invalid response type")
-	errSyntaxError          = errors.New("syntax error")
+	errSyntaxError          = common.ErrRedisSyntax
 	errUnknownData          = errors.New("unknown request data type")
 	errTooMuchBatchSize     = errors.New("the batch size exceed the limit")
 	errRaftNotReadyForWrite = errors.New("ERR_CLUSTER_CHANGED: the raft is not ready for write")
@@ -48,6 +50,8 @@ const (
 	ProposeOp_RemoteConfChange       int = 4
 	ProposeOp_ApplySkippedRemoteSnap int = 5
 	ProposeOp_DeleteTable            int = 6
+	ProposeOp_TableChecksum          int = 7
+	ProposeOp_TableRecount           int = 8
 )
 
 type DeleteTableRange struct {
@@ -111,10 +115,48 @@ type KVNode struct {
 	wg                 sync.WaitGroup
 	commitC            <-chan applyInfo
 	committedIndex     uint64
+	appliedIndex       uint64
+	lastApplyTs        int64
+	pendingProposals   int64
+	corruptedEntries   int64
+	applyFailed        int32
+	applyFailure       atomic.Value
+	repair             *raftRepairReport
 	clusterInfo        common.IClusterInfo
 	expireHandler      *ExpireHandler
 	expirationPolicy   common.ExpirationPolicy
 	remoteSyncedStates *remoteSyncedStateMgr
+	backupUploader     *backupUploader
+	slowLog            *SlowLog
+	// the writes delayed or rejected by the backpressure
+	backpressureDelayed  int64
+	backpressureRejected int64
+	// the quota and the approximate usage of the partition
+	quota         atomic.Value
+	usedKeys      int64
+	usedBytes     int64
+	quotaExceeded int32
+
+	// compress the large proposals before they enter the raft log
+	entryCompressor *raftEntryCompressor
+	// the raft log retention by size and age, and the logs applied since the last snapshot
+	logRetentionBytes int64
+	logRetentionSecs  int64
+	logBytesSinceSnap int64
+	lastSnapshotTs    int64
+	// the applied index and time of the last load check, used to compute the write rate
+	loadCheckIndex uint64
+	loadCheckTs    int64
+	writeQPS       int64
+	// migrate the keys to the new partitions while expanding the partition number
+	reshard *partitionResharder
+	// reject all the writes while the namespace is frozen
+	frozen int32
+
+	// the sampled key accesses for the OBJECT IDLETIME and FREQ
+	accessStats *AccessStats
+	// the merge writes which can be proposed with the client request id
+	clientReqMergeWrites map[string]clientReqMergeWriteFunc
 }
 
 type KVSnapInfo struct {
@@ -125,6 +167,7 @@ type KVSnapInfo struct {
 	Members            []*common.MemberInfo   `json:"members"`
 	Learners           []*common.MemberInfo   `json:"learners"`
 	RemoteSyncedStates map[string]SyncedState `json:"remote_synced_states"`
+	ClientSessions     []ClientSessionState   `json:"client_sessions"`
 }
 
 func (si *KVSnapInfo) GetData() ([]byte, error) {
@@ -142,9 +185,22 @@ func (si *KVSnapInfo) GetData() ([]byte, error) {
 func NewKVNode(kvopts *KVOptions, machineConfig *MachineConfig, config *RaftConfig,
 	transport *rafthttp.Transport, join bool, deleteCb func(),
 	clusterInfo common.IClusterInfo, newLeaderChan chan string) (*KVNode, error) {
-	config.WALDir = path.Join(config.DataDir, fmt.Sprintf("wal-%d", config.ID))
+	config.WALDir = getWALDir(machineConfig, config)
 	config.SnapDir = path.Join(config.DataDir, fmt.Sprintf("snap-%d", config.ID))
 	config.nodeConfig = machineConfig
+	// the wal may be under the data dir before the separate wal dir configured
+	err := migrateWALDir(path.Join(config.DataDir, fmt.Sprintf("wal-%d", config.ID)), config.WALDir)
+	if err != nil {
+		nodeLog.Errorf("failed to migrate the wal to %v: %v", config.WALDir, err)
+		return nil, err
+	}
+
+	entryCompressor, err := newRaftEntryCompressor(machineConfig.RaftLogCompressType,
+		machineConfig.RaftLogCompressMinBytes)
+	if err != nil {
+		nodeLog.Errorf("invalid raft log compress type %v: %v", machineConfig.RaftLogCompressType, err)
+		return nil, err
+	}
 
 	stopChan := make(chan struct{})
 	w := wait.New()
@@ -165,11 +221,28 @@ func NewKVNode(kvopts *KVOptions, machineConfig *MachineConfig, config *RaftConf
 		machineConfig:      machineConfig,
 		expirationPolicy:   kvopts.ExpirationPolicy,
 		remoteSyncedStates: newRemoteSyncedStateMgr(),
+		slowLog:            NewSlowLog(defaultSlowLogMaxLen),
+		entryCompressor:    entryCompressor,
+		lastSnapshotTs:     time.Now().UnixNano(),
+		accessStats:        NewAccessStats(defaultAccessStatsMaxKeys),
 	}
+	_, pid := common.GetNamespaceAndPartition(config.GroupName)
+	s.reshard = newPartitionResharder(pid)
 	if kvsm, ok := sm.(*kvStoreSM); ok {
 		s.store = kvsm.store
+		kvsm.slowLog = s.slowLog
+		if machineConfig.BackupDriver != nil {
+			s.backupUploader = newBackupUploader(s, machineConfig.BackupDriver,
+				machineConfig.BackupTarget.MinIntervalSec)
+		}
+	}
+	if lssm, ok := sm.(*logSyncerSM); ok {
+		lssm.proposeBackup = s.proposeForceBackup
 	}
 
+	if machineConfig.RaftRepairMode {
+		s.repair = newRaftRepairReport(config.DataDir, config.GroupName, machineConfig.RaftRepairSkipEntries)
+	}
 	s.clusterInfo = clusterInfo
 	s.expireHandler = NewExpireHandler(s)
 
@@ -200,6 +273,7 @@ func (nd *KVNode) Start(standalone bool) error {
 	if err != nil {
 		return err
 	}
+	nd.loadPersistedRemoteSyncedStates()
 	// read commits from raft into KVStore map until error
 	nd.wg.Add(1)
 	go func() {
@@ -211,6 +285,13 @@ func (nd *KVNode) Start(standalone bool) error {
 		defer nd.wg.Done()
 		nd.handleProposeReq()
 	}()
+	if nd.backupUploader != nil {
+		nd.wg.Add(1)
+		go func() {
+			defer nd.wg.Done()
+			nd.backupUploader.run(nd.stopChan)
+		}()
+	}
 
 	nd.expireHandler.Start()
 	return nil
@@ -245,15 +326,21 @@ func (nd *KVNode) OptimizeDB(table string) {
 	if table == "" {
 		// since we can not know whether leader or follower is done on optimize
 		// we backup anyway after optimize
-		p := &customProposeData{
-			ProposeOp:  ProposeOp_Backup,
-			NeedBackup: true,
-		}
-		d, _ := json.Marshal(p)
-		nd.CustomPropose(d)
+		nd.proposeForceBackup()
 	}
 }
 
+// proposeForceBackup make all the replicas do the backup after applied this proposal
+func (nd *KVNode) proposeForceBackup() error {
+	p := &customProposeData{
+		ProposeOp:  ProposeOp_Backup,
+		NeedBackup: true,
+	}
+	d, _ := json.Marshal(p)
+	_, err := nd.CustomPropose(d)
+	return err
+}
+
 func (nd *KVNode) DeleteRange(drange DeleteTableRange) error {
 	if err := drange.CheckValid(); err != nil {
 		return err
@@ -272,6 +359,14 @@ func (nd *KVNode) DeleteRange(drange DeleteTableRange) error {
 	return err
 }
 
+// CheckDeleteRange check the table can be deleted on the local replica before proposing
+func (nd *KVNode) CheckDeleteRange(table string) error {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.CheckDeleteTableRange(table)
+	}
+	return errors.New("no delete range for learner")
+}
+
 func (nd *KVNode) switchForLearnerLeader(isLearnerLeader bool) {
 	logsm, ok := nd.sm.(*logSyncerSM)
 	if ok {
@@ -338,18 +433,258 @@ func (nd *KVNode) GetDBInternalStats() string {
 	return ""
 }
 
+// compact the key range [start, end) of the table in the local replica
+func (nd *KVNode) CompactTableRange(table string, start []byte, end []byte) error {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		nd.rn.Infof("node %v begin compact table %v range: %v-%v", nd.ns, table, start, end)
+		err := s.store.CompactTableKeyRange(table, start, end)
+		nd.rn.Infof("node %v end compact table %v range: %v", nd.ns, table, err)
+		return err
+	}
+	return errors.New("no db compaction for learner")
+}
+
+func (nd *KVNode) GetCompactProgress() (rockredis.CompactProgress, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetCompactProgress(), nil
+	}
+	return rockredis.CompactProgress{}, errors.New("no db compaction for learner")
+}
+
+// propose to count the keys of the table to fix the table counter, all the replicas will
+// count and fix the counter at the same raft index while applying the proposal.
+func (nd *KVNode) RecountTableKeys(table string) error {
+	if _, ok := nd.sm.(*kvStoreSM); !ok {
+		return errors.New("no table counter for learner")
+	}
+	p := &customProposeData{
+		ProposeOp: ProposeOp_TableRecount,
+		Data:      []byte(table),
+	}
+	d, _ := json.Marshal(p)
+	nd.rn.Infof("node %v begin recount table %v", nd.ns, table)
+	_, err := nd.CustomPropose(d)
+	nd.rn.Infof("node %v end recount table %v: %v", nd.ns, table, err)
+	return err
+}
+
+func (nd *KVNode) GetRecountStatus() (rockredis.RecountStatus, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetRecountStatus(), nil
+	}
+	return rockredis.RecountStatus{}, errors.New("no table counter for learner")
+}
+
+// scan the keys of the table in the local replica to find the big keys
+func (nd *KVNode) ScanBigKeys(table string, minSize int64, minElements int64) error {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		nd.rn.Infof("node %v begin big key scan table %v", nd.ns, table)
+		err := s.store.ScanBigKeys(table, minSize, minElements)
+		nd.rn.Infof("node %v end big key scan table %v: %v", nd.ns, table, err)
+		return err
+	}
+	return errors.New("no big key scan for learner")
+}
+
+func (nd *KVNode) GetBigKeyScanStatus() (rockredis.BigKeyScanStatus, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetBigKeyScanStatus(), nil
+	}
+	return rockredis.BigKeyScanStatus{}, errors.New("no big key scan for learner")
+}
+
+// inspect the data distribution of the table (or all the tables) in the local replica
+func (nd *KVNode) InspectTables(table string) error {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		nd.rn.Infof("node %v begin inspect table %v", nd.ns, table)
+		err := s.store.InspectTables(table)
+		nd.rn.Infof("node %v end inspect table %v: %v", nd.ns, table, err)
+		return err
+	}
+	return errors.New("no table inspection for learner")
+}
+
+func (nd *KVNode) GetTableInspectStatus() (rockredis.TableInspectStatus, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetTableInspectStatus(), nil
+	}
+	return rockredis.TableInspectStatus{}, errors.New("no table inspection for learner")
+}
+
+func (nd *KVNode) KeyMemoryUsage(key []byte) (int64, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.KeyMemoryUsage(key)
+	}
+	return 0, errors.New("no memory usage for learner")
+}
+
+// GetTableStats return the key count and the disk usage of the table on the local replica,
+// all the tables will be returned if the table is empty.
+func (nd *KVNode) GetTableStats(table string) ([]common.TableStats, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.GetTableStats(table), nil
+	}
+	return nil, errors.New("no table stats for learner")
+}
+
+// GetTables return the table names on the local replica
+func (nd *KVNode) GetTables() ([]string, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		var tables []string
+		for _, t := range s.store.GetTables() {
+			tables = append(tables, string(t))
+		}
+		return tables, nil
+	}
+	return nil, errors.New("no tables for learner")
+}
+
+// KeyType return the redis type name of the key
+func (nd *KVNode) KeyType(key []byte) (string, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.KeyType(key)
+	}
+	return "", errors.New("no key type for learner")
+}
+
+// KeyEncoding return the redis encoding name of the key, empty if the key not exist
+func (nd *KVNode) KeyEncoding(key []byte) (string, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.KeyEncoding(key)
+	}
+	return "", errors.New("no key encoding for learner")
+}
+
+// KeyIdleTime return the idle time of the key since the last sampled access, false if
+// the key is not tracked
+func (nd *KVNode) KeyIdleTime(key []byte) (time.Duration, bool, error) {
+	return nd.accessStats.IdleTime(key)
+}
+
+// KeyAccessFreq return the logarithmic access frequency counter of the key
+func (nd *KVNode) KeyAccessFreq(key []byte) (int, error) {
+	return nd.accessStats.Freq(key)
+}
+
+// change the rocksdb options of the local replica at runtime
+func (nd *KVNode) SetDBOptions(o common.RockOptionsOverride) error {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		err := s.store.SetDBOptions(o)
+		if err != nil {
+			nd.rn.Infof("node %v set db options %v failed: %v", nd.ns, o, err)
+		}
+		return err
+	}
+	return errors.New("no db options for learner")
+}
+
 func (nd *KVNode) GetStats() common.NamespaceStats {
 	ns := nd.sm.GetStats()
 	ns.ClusterWriteStats = nd.clusterWriteStats.Copy()
+	ns.RemoteSyncedStats = nd.getRemoteSyncedStats()
+	if _, sync := nd.GetLogSyncStatsInSyncLearner(); sync != nil && ns.InternalStats != nil {
+		ns.InternalStats["committed_index"] = sync.CommittedIndex
+		ns.InternalStats["sync_lag"] = sync.Lag
+	}
+	ns.ReplicationStats = nd.GetReplicationStats()
+	ns.Quota = nd.GetQuotaStats()
+	ns.Frozen = nd.IsFrozen()
+	ns.RaftLog = nd.GetRaftLogStats()
+	ns.Load = nd.GetLoadStats()
 	return ns
 }
 
+// GetHealth return the raft leader and apply status of the local replica, the
+// healthy is not decided here since it depends on the caller.
+func (nd *KVNode) GetHealth() common.NamespaceHealth {
+	s := nd.rn.node.Status()
+	h := common.NamespaceHealth{
+		HasLeader:        s.Lead != raft.None,
+		IsLeader:         s.Lead == s.ID,
+		CommitIndex:      s.Commit,
+		AppliedIndex:     atomic.LoadUint64(&nd.appliedIndex),
+		PendingProposals: atomic.LoadInt64(&nd.pendingProposals),
+		CorruptedEntries: atomic.LoadInt64(&nd.corruptedEntries),
+		ApplyBacklog:     nd.getApplyBacklog(),
+		WriteDelayed:     atomic.LoadInt64(&nd.backpressureDelayed),
+		WriteRejected:    atomic.LoadInt64(&nd.backpressureRejected),
+	}
+	if h.CommitIndex > h.AppliedIndex {
+		h.ApplyGap = h.CommitIndex - h.AppliedIndex
+	}
+	if f := nd.getApplyFailure(); f != nil {
+		h.ApplyError = fmt.Sprintf("apply (%v-%v) failed: %v", f.Term, f.Index, f.Reason)
+	}
+	if ts := atomic.LoadInt64(&nd.lastApplyTs); ts > 0 {
+		h.LastApplyTime = ts / int64(time.Millisecond)
+	}
+	return h
+}
+
+// GetReplicationStats return the apply lag of the local replica, and the match index,
+// snapshot status and the last contact time of the followers if this is the leader.
+func (nd *KVNode) GetReplicationStats() *common.ReplicationStats {
+	s := nd.rn.node.Status()
+	rs := &common.ReplicationStats{
+		ReplicaID:    s.ID,
+		LeaderID:     s.Lead,
+		Term:         s.Term,
+		CommitIndex:  s.Commit,
+		AppliedIndex: atomic.LoadUint64(&nd.appliedIndex),
+	}
+	if rs.CommitIndex > rs.AppliedIndex {
+		rs.ApplyLag = rs.CommitIndex - rs.AppliedIndex
+	}
+	if len(s.Progress) == 0 {
+		return rs
+	}
+	nodeIDs := make(map[uint64]uint64)
+	for _, m := range nd.GetMembers() {
+		nodeIDs[m.ID] = m.NodeID
+	}
+	for _, m := range nd.GetLearners() {
+		nodeIDs[m.ID] = m.NodeID
+	}
+	for id, pg := range s.Progress {
+		if id == s.ID {
+			continue
+		}
+		rp := common.ReplicaProgress{
+			ReplicaID:        id,
+			NodeID:           nodeIDs[id],
+			IsLearner:        pg.IsLearner,
+			State:            pg.State.String(),
+			MatchIndex:       pg.Match,
+			RecentActive:     pg.RecentActive,
+			PendingSnapshot:  pg.PendingSnapshot,
+			SnapshotInFlight: pg.State == raft.ProgressStateSnapshot,
+		}
+		if s.Commit > pg.Match {
+			rp.MatchLag = s.Commit - pg.Match
+		}
+		if ts := nd.rn.getPeerContact(id); ts > 0 {
+			rp.LastContact = ts / int64(time.Millisecond)
+		}
+		rs.Followers = append(rs.Followers, rp)
+	}
+	sort.Slice(rs.Followers, func(i, j int) bool {
+		return rs.Followers[i].ReplicaID < rs.Followers[j].ReplicaID
+	})
+	return rs
+}
+
 func (nd *KVNode) destroy() error {
 	// should make sure stopped and wait other stopping finish
 	nd.Stop()
 	<-nd.stopDone
 	nd.sm.Destroy()
 	ts := strconv.Itoa(int(time.Now().UnixNano()))
+	if nd.machineConfig.WALRootDir != "" {
+		walDir := nd.rn.config.WALDir
+		if err := os.Rename(walDir, walDir+"-deleted-"+ts); err != nil && !os.IsNotExist(err) {
+			nd.rn.Infof("failed to rename the wal dir while destroy: %v", err)
+		}
+	}
 	return os.Rename(nd.rn.config.DataDir,
 		nd.rn.config.DataDir+"-deleted-"+ts)
 }
@@ -359,13 +694,53 @@ func (nd *KVNode) CleanData() error {
 }
 
 func (nd *KVNode) GetHandler(cmd string) (common.CommandFunc, bool, bool) {
-	return nd.router.GetCmdHandler(cmd)
+	h, isWrite, ok := nd.router.GetCmdHandler(cmd)
+	if !ok {
+		return h, isWrite, ok
+	}
+	// the TYPE should not change the access time of the key as the redis
+	trackAccess := GetAccessSampleRate() > 0 && cmd != "type"
+	if isWrite {
+		if !trackAccess {
+			// the slow write will be recorded while applying
+			return h, isWrite, ok
+		}
+		return func(conn redcon.Conn, cmd redcon.Command) {
+			nd.accessStats.Record(cmd.Args[1])
+			h(conn, cmd)
+		}, isWrite, ok
+	}
+	return func(conn redcon.Conn, cmd redcon.Command) {
+		if trackAccess {
+			nd.accessStats.Record(cmd.Args[1])
+		}
+		start := time.Now()
+		h(conn, cmd)
+		nd.slowLog.RecordRead(cmd.Args, time.Since(start))
+	}, isWrite, ok
+}
+
+func (nd *KVNode) GetSlowLog() *SlowLog {
+	return nd.slowLog
 }
 
 func (nd *KVNode) GetMergeHandler(cmd string) (common.MergeCommandFunc, bool, bool) {
 	return nd.router.GetMergeCmdHandler(cmd)
 }
 
+// GetMergeHandlerWithClientReq return the merge handler same as GetMergeHandler, but the
+// merge write will be proposed with the client request id set by REQID.
+func (nd *KVNode) GetMergeHandlerWithClientReq(cmd string, creq *ClientRequestID) (common.MergeCommandFunc, bool, bool) {
+	if creq != nil {
+		if f, ok := nd.clientReqMergeWrites[cmd]; ok {
+			return func(c redcon.Command) (interface{}, error) {
+				return f(c, creq)
+			}, true, true
+		}
+	}
+	return nd.GetMergeHandler(cmd)
+}
+
 func (nd *KVNode) handleProposeReq() {
 	var reqList BatchInternalRaftRequest
 	reqList.Reqs = make([]*InternalRaftRequest, 0, 100)
@@ -416,9 +791,12 @@ func (nd *KVNode) handleProposeReq() {
 			}
 			reqList.ReqNum = int32(len(reqList.Reqs))
 			reqList.Timestamp = time.Now().UnixNano()
-			buffer, err := reqList.Marshal()
+			buffer, err := marshalBatchWithCrc(&reqList, nil)
 			// buffer will be reused by raft?
 			// TODO:buffer, err := reqList.MarshalTo()
+			if err == nil {
+				buffer, err = nd.entryCompressor.compress(buffer)
+			}
 			if err != nil {
 				nd.rn.Infof("failed to marshal request: %v", err)
 				for _, r := range reqList.Reqs {
@@ -495,12 +873,24 @@ func (nd *KVNode) IsWriteReady() bool {
 }
 
 func (nd *KVNode) ProposeRawAndWait(buffer []byte, term uint64, index uint64, raftTs int64) error {
+	if nd.IsApplyFailed() {
+		return ErrApplyFailed
+	}
+	// the writes from the remote cluster should be stopped while frozen, and the syncer
+	// will retry after unfrozen
+	if err := nd.checkFrozen(); err != nil {
+		return err
+	}
 	var reqList BatchInternalRaftRequest
 	err := reqList.Unmarshal(buffer)
 	if err != nil {
 		nd.rn.Infof("propose raw failed: %v at (%v-%v)", err.Error(), term, index)
 		return err
 	}
+	if !verifyBatchCrc(&reqList, buffer) {
+		nd.rn.Infof("propose raw failed: crc mismatch at (%v-%v)", term, index)
+		return errRaftEntryCorrupted
+	}
 	if nodeLog.Level() >= common.LOG_DETAIL {
 		nd.rn.Infof("propose raw (%v): %v at (%v-%v)", len(buffer), buffer, term, index)
 	}
@@ -516,21 +906,15 @@ func (nd *KVNode) ProposeRawAndWait(buffer []byte, term uint64, index uint64, ra
 		// re-generate the req id to override the id from log
 		req.Header.ID = nd.rn.reqIDGen.Next()
 	}
-	dataLen := reqList.Size()
-	if dataLen <= len(buffer) {
-		n, err := reqList.MarshalTo(buffer[:dataLen])
-		if err != nil {
-			return err
-		}
-		if n != dataLen {
-			return errors.New("marshal length mismatch")
-		}
-	} else {
-		buffer, err = reqList.Marshal()
-		if err != nil {
-			return err
-		}
+	buffer, err = marshalBatchWithCrc(&reqList, buffer)
+	if err != nil {
+		return err
 	}
+	buffer, err = nd.entryCompressor.compress(buffer)
+	if err != nil {
+		return err
+	}
+	dataLen := len(buffer)
 	start := time.Now()
 	ch := nd.w.Register(reqList.ReqId)
 	ctx, cancel := context.WithTimeout(context.Background(), proposeTimeout)
@@ -577,14 +961,36 @@ func (nd *KVNode) ProposeRawAndWait(buffer []byte, term uint64, index uint64, ra
 }
 
 func (nd *KVNode) queueRequest(req *internalReq) (interface{}, error) {
+	if nd.IsApplyFailed() {
+		return nil, ErrApplyFailed
+	}
 	if !nd.IsWriteReady() {
 		return nil, errRaftNotReadyForWrite
 	}
 	if !nd.rn.HasLead() {
 		return nil, ErrNodeNoLeader
 	}
+	if req.reqData.Header.DataType == int32(RedisReq) {
+		if nd.IsReadReplica() {
+			return nil, ErrReadOnlyReplica
+		}
+		if err := nd.checkFrozen(); err != nil {
+			return nil, err
+		}
+		if err := nd.checkQuota(req.reqData.Data); err != nil {
+			return nil, err
+		}
+		if err := nd.checkWriteBackpressure(); err != nil {
+			return nil, err
+		}
+		if err := nd.reshard.checkWrite(req.reqData.Data); err != nil {
+			return nil, err
+		}
+	}
 	start := time.Now()
 	req.reqData.Header.Timestamp = start.UnixNano()
+	atomic.AddInt64(&nd.pendingProposals, 1)
+	defer atomic.AddInt64(&nd.pendingProposals, -1)
 	ch := nd.w.Register(req.reqData.Header.ID)
 	select {
 	case nd.reqProposeC <- req:
@@ -636,6 +1042,22 @@ func (nd *KVNode) Propose(buf []byte) (interface{}, error) {
 		ID:       nd.rn.reqIDGen.Next(),
 		DataType: int32(RedisReq),
 	}
+	return nd.proposeWithHeader(h, buf)
+}
+
+// ProposeWithClientID propose the write with the client request id, and the retried
+// request with the same client id and sequence will be applied only once.
+func (nd *KVNode) ProposeWithClientID(buf []byte, clientID uint64, seq uint64) (interface{}, error) {
+	h := &RequestHeader{
+		ID:        nd.rn.reqIDGen.Next(),
+		DataType:  int32(RedisReq),
+		ClientId:  clientID,
+		ClientSeq: seq,
+	}
+	return nd.proposeWithHeader(h, buf)
+}
+
+func (nd *KVNode) proposeWithHeader(h *RequestHeader, buf []byte) (interface{}, error) {
 	raftReq := InternalRaftRequest{
 		Header: h,
 		Data:   buf,
@@ -679,6 +1101,81 @@ func (nd *KVNode) ProposeChangeTableSchema(table string, sc *SchemaChange) error
 	return err
 }
 
+// drop the whole table, the data will be purged in background
+func (nd *KVNode) DropTable(table string) error {
+	sc := &SchemaChange{
+		Type:  SchemaChangeDropTable,
+		Table: table,
+	}
+	err := nd.ProposeChangeTableSchema(table, sc)
+	if err != nil {
+		nd.rn.Infof("node %v drop table %v failed: %v", nd.ns, table, err)
+	}
+	return err
+}
+
+func (nd *KVNode) SetTableValueCompress(table string, vc common.ValueCompressSchema) error {
+	if err := vc.CheckValid(); err != nil {
+		return err
+	}
+	d, _ := json.Marshal(vc)
+	sc := &SchemaChange{
+		Type:       SchemaChangeValueCompression,
+		Table:      table,
+		SchemaData: d,
+	}
+	err := nd.ProposeChangeTableSchema(table, sc)
+	if err != nil {
+		nd.rn.Infof("node %v change table %v value compression failed: %v", nd.ns, table, err)
+	}
+	return err
+}
+
+func (nd *KVNode) SetTableZsetScoreIndex(table string, zi common.ZsetScoreIndexSchema) error {
+	d, _ := json.Marshal(zi)
+	sc := &SchemaChange{
+		Type:       SchemaChangeZsetScoreIndex,
+		Table:      table,
+		SchemaData: d,
+	}
+	err := nd.ProposeChangeTableSchema(table, sc)
+	if err != nil {
+		nd.rn.Infof("node %v change table %v zset score index failed: %v", nd.ns, table, err)
+	}
+	return err
+}
+
+func (nd *KVNode) AddFullTextIndex(table string, ft common.FullTextIndexSchema) error {
+	if err := ft.CheckValid(); err != nil {
+		return err
+	}
+	d, _ := json.Marshal(ft)
+	sc := &SchemaChange{
+		Type:       SchemaChangeAddFullTextIndex,
+		Table:      table,
+		SchemaData: d,
+	}
+	err := nd.ProposeChangeTableSchema(table, sc)
+	if err != nil {
+		nd.rn.Infof("node %v add table %v full text index failed: %v", nd.ns, table, err)
+	}
+	return err
+}
+
+func (nd *KVNode) DelFullTextIndex(table string, name string) error {
+	d, _ := json.Marshal(common.FullTextIndexSchema{Name: name})
+	sc := &SchemaChange{
+		Type:       SchemaChangeDeleteFullTextIndex,
+		Table:      table,
+		SchemaData: d,
+	}
+	err := nd.ProposeChangeTableSchema(table, sc)
+	if err != nil {
+		nd.rn.Infof("node %v delete table %v full text index failed: %v", nd.ns, table, err)
+	}
+	return err
+}
+
 func (nd *KVNode) FillMyMemberInfo(m *common.MemberInfo) {
 	m.RaftURLs = append(m.RaftURLs, nd.machineConfig.LocalRaftAddr)
 }
@@ -776,6 +1273,10 @@ func (nd *KVNode) GetCommittedIndex() uint64 {
 	return atomic.LoadUint64(&nd.committedIndex)
 }
 
+func (nd *KVNode) GetAppliedIndex() uint64 {
+	return atomic.LoadUint64(&nd.appliedIndex)
+}
+
 func (nd *KVNode) SetCommittedIndex(ci uint64) {
 	atomic.StoreUint64(&nd.committedIndex, ci)
 }
@@ -858,6 +1359,7 @@ func (nd *KVNode) applySnapshot(np *nodeProgress, applyEvent *applyInfo) error {
 	// the snapshot restore may fail because of the remote snapshot is deleted
 	// and can not rsync from any other nodes.
 	// while starting we can not ignore or delete the snapshot since the wal may be cleaned on other snapshot.
+	common.FaultCrash(common.FaultCrashBeforeSnapInstall, nd.ns)
 	if err := nd.RestoreFromSnapshot(false, applyEvent.snapshot); err != nil {
 		nodeLog.Error(err)
 		go func() {
@@ -875,6 +1377,9 @@ func (nd *KVNode) applySnapshot(np *nodeProgress, applyEvent *applyInfo) error {
 	np.snapi = applyEvent.snapshot.Metadata.Index
 	np.appliedt = applyEvent.snapshot.Metadata.Term
 	np.appliedi = applyEvent.snapshot.Metadata.Index
+	atomic.StoreUint64(&nd.appliedIndex, np.appliedi)
+	nd.resetLogSinceSnapshot()
+	common.FaultCrash(common.FaultCrashAfterSnapInstall, nd.ns)
 	return nil
 }
 
@@ -892,11 +1397,20 @@ func (nd *KVNode) applyEntry(evnt raftpb.Entry, isReplaying bool) bool {
 	if evnt.Data != nil {
 		// try redis command
 		var reqList BatchInternalRaftRequest
-		parseErr := reqList.Unmarshal(evnt.Data)
+		data, parseErr := decodeEntryData(evnt.Data)
+		if parseErr == nil {
+			parseErr = reqList.Unmarshal(data)
+		}
 		if parseErr != nil {
 			nd.rn.Infof("parse request failed: %v, data len %v, entry: %v, raw:%v",
 				parseErr, len(evnt.Data), evnt,
 				evnt.String())
+			nd.quarantineEntry(evnt, &reqList, parseErr)
+			return false
+		}
+		if !verifyBatchCrc(&reqList, data) {
+			nd.quarantineEntry(evnt, &reqList, errRaftEntryCorrupted)
+			return false
 		}
 		if len(reqList.Reqs) != int(reqList.ReqNum) {
 			nd.rn.Infof("request check failed %v, real len:%v",
@@ -924,7 +1438,8 @@ func (nd *KVNode) applyEntry(evnt raftpb.Entry, isReplaying bool) bool {
 			isRemoteSnapTransfer, isRemoteSnapApply = nd.preprocessRemoteSnapApply(reqList)
 		}
 		var retErr error
-		forceBackup, retErr = nd.sm.ApplyRaftRequest(isReplaying, reqList, evnt.Term, evnt.Index, nd.stopChan)
+		forceBackup, retErr = nd.applyRaftRequestSafe(evnt, reqList, isReplaying)
+		nd.reshard.onApplied(&reqList)
 		if reqList.Type == FromClusterSyncer {
 			nd.postprocessRemoteSnapApply(reqList, isRemoteSnapTransfer, isRemoteSnapApply, retErr)
 		}
@@ -943,6 +1458,8 @@ func (nd *KVNode) applyAll(np *nodeProgress, applyEvent *applyInfo) (bool, bool)
 	if lastCommittedIndex > nd.GetCommittedIndex() {
 		nd.SetCommittedIndex(lastCommittedIndex)
 	}
+	common.FaultDelay(common.FaultApplyDelay, nd.ns)
+	common.FaultPause(common.FaultApplyPause, nd.ns, nd.stopChan)
 	snapErr := nd.applySnapshot(np, applyEvent)
 	if applyEvent.applySnapshotResult != nil {
 		select {
@@ -972,12 +1489,31 @@ func (nd *KVNode) applyAll(np *nodeProgress, applyEvent *applyInfo) (bool, bool)
 	var shouldStop bool
 	var confChanged bool
 	forceBackup := false
+	kvsm, _ := nd.sm.(*kvStoreSM)
 	for i := range ents {
 		evnt := ents[i]
+		if nd.IsApplyFailed() {
+			// the later entries can not be applied since the state machine may be
+			// inconsistent, the applied index will stay at the entry before the failed one.
+			// However, the conf change should still be applied to keep the raft membership,
+			// it will be applied again after restart since the applied index is not changed.
+			if evnt.Type == raftpb.EntryConfChange {
+				removeSelf, _, _ := nd.applyConfChangeEntry(evnt, &np.confState)
+				shouldStop = shouldStop || removeSelf
+			}
+			continue
+		}
 		isReplaying := evnt.Index <= nd.rn.lastIndex
+		if kvsm != nil {
+			// let the state machine know how many logs are waiting to adjust the write batch
+			kvsm.batchLimit.SetPending(len(ents) - i - 1 + len(nd.commitC))
+		}
 		switch evnt.Type {
 		case raftpb.EntryNormal:
 			forceBackup = nd.applyEntry(evnt, isReplaying)
+			if nd.IsApplyFailed() {
+				continue
+			}
 		case raftpb.EntryConfChange:
 			removeSelf, changed, _ := nd.applyConfChangeEntry(evnt, &np.confState)
 			confChanged = changed
@@ -985,6 +1521,9 @@ func (nd *KVNode) applyAll(np *nodeProgress, applyEvent *applyInfo) (bool, bool)
 		}
 		np.appliedi = evnt.Index
 		np.appliedt = evnt.Term
+		atomic.StoreUint64(&nd.appliedIndex, np.appliedi)
+		atomic.AddInt64(&nd.logBytesSinceSnap, int64(len(evnt.Data)))
+		atomic.StoreInt64(&nd.lastApplyTs, time.Now().UnixNano())
 		if evnt.Index == nd.rn.lastIndex {
 			nd.rn.Infof("replay finished at index: %v\n", evnt.Index)
 			nd.rn.MarkReplayFinished()
@@ -1069,20 +1608,27 @@ func (nd *KVNode) maybeTriggerSnapshot(np *nodeProgress, confChanged bool, force
 		return
 	}
 
-	if !forceBackup {
-		if !confChanged && np.appliedi-np.snapi <= uint64(nd.rn.config.SnapCount) {
+	catchup := uint64(nd.rn.config.SnapCatchup)
+	if !forceBackup && !confChanged && np.appliedi-np.snapi <= uint64(nd.rn.config.SnapCount) {
+		if !nd.exceedLogRetention(time.Now()) {
 			return
 		}
+		// only keep the logs since the last snapshot to make sure the
+		// logs out of the retention can be truncated.
+		if np.appliedi-np.snapi < catchup {
+			catchup = np.appliedi - np.snapi
+		}
 	}
 
 	nd.rn.Infof("start snapshot [applied index: %d | last snapshot index: %d]", np.appliedi, np.snapi)
-	err := nd.rn.beginSnapshot(np.appliedt, np.appliedi, np.confState)
+	err := nd.rn.beginSnapshot(np.appliedt, np.appliedi, np.confState, catchup)
 	if err != nil {
 		nd.rn.Infof("begin snapshot failed: %v", err)
 		return
 	}
 
 	np.snapi = np.appliedi
+	nd.resetLogSinceSnapshot()
 }
 
 func (nd *KVNode) GetSnapshot(term uint64, index uint64) (Snapshot, error) {
@@ -1093,6 +1639,9 @@ func (nd *KVNode) GetSnapshot(term uint64, index uint64) (Snapshot, error) {
 	si.Members, si.LeaderInfo = nd.rn.GetMembersAndLeader()
 	si.RemoteSyncedStates = nd.remoteSyncedStates.Clone()
 	si.Learners = nd.rn.GetLearners()
+	if nd.backupUploader != nil && si.BackupInfo != nil {
+		nd.backupUploader.onBackup(term, index, si.BackupInfo)
+	}
 	return si, nil
 }
 
@@ -1107,6 +1656,9 @@ func (nd *KVNode) RestoreFromSnapshot(startup bool, raftSnapshot raftpb.Snapshot
 	nd.rn.Infof("should recovery from snapshot here: %v", raftSnapshot.String())
 	err = nd.sm.RestoreFromSnapshot(startup, raftSnapshot, nd.stopChan)
 	nd.remoteSyncedStates.RestoreStates(si.RemoteSyncedStates)
+	if err == nil {
+		nd.loadPersistedRemoteSyncedStates()
+	}
 	return err
 }
 
@@ -1122,6 +1674,31 @@ func (nd *KVNode) CheckLocalBackup(snapData []byte) (bool, error) {
 	return false, nil
 }
 
+// GetTableChecksum return the data checksum of the table in buckets, used to verify
+// the data between clusters
+func (nd *KVNode) GetTableChecksum(table string, bucketNum int) (*common.TableChecksum, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetTableChecksum(table, bucketNum)
+	}
+	return nil, errors.New("no data checksum for learner")
+}
+
+// GetTableBucketKeysChecksum return the checksum of each key in the bucket of the table
+func (nd *KVNode) GetTableBucketKeysChecksum(table string, bucketNum int, bucket int) (map[string]uint64, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetTableBucketKeysChecksum(table, bucketNum, bucket)
+	}
+	return nil, errors.New("no data checksum for learner")
+}
+
+// GetLatestLocalBackup return the term-index of the latest local backup
+func (nd *KVNode) GetLatestLocalBackup() (uint64, uint64, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.GetLatestBackup()
+	}
+	return 0, 0, errors.New("no local backup for learner")
+}
+
 func (nd *KVNode) GetLastLeaderChangedTime() int64 {
 	return nd.rn.getLastLeaderChangedTime()
 }
@@ -6,6 +6,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("del", kvsm.localDelCommand)
 	kvsm.router.RegisterInternal("set", kvsm.localSetCommand)
 	kvsm.router.RegisterInternal("setnx", kvsm.localSetnxCommand)
+	kvsm.router.RegisterInternal("getset", kvsm.localGetSetCommand)
 	kvsm.router.RegisterInternal("mset", kvsm.localMSetCommand)
 	kvsm.router.RegisterInternal("incr", kvsm.localIncrCommand)
 	kvsm.router.RegisterInternal("incrby", kvsm.localIncrByCommand)
@@ -66,15 +67,17 @@ func (kvsm *kvStoreSM) registerHandlers() {
 }
 
 func (nd *KVNode) registerHandler() {
-	if nd.machineConfig.LearnerRole != "" {
+	if nd.machineConfig.LearnerRole != "" && !nd.IsReadReplica() {
 		// other learner role should only sync from raft log, so no need redis API
 		return
 	}
 	// for kv
 	nd.router.Register(false, "get", wrapReadCommandK(nd.getCommand))
 	nd.router.Register(false, "mget", wrapReadCommandKK(nd.mgetCommand))
+	nd.router.Register(false, "type", wrapReadCommandK(nd.typeCommand))
 	nd.router.Register(true, "set", wrapWriteCommandKV(nd, nd.setCommand))
 	nd.router.Register(true, "setnx", wrapWriteCommandKV(nd, nd.setnxCommand))
+	nd.router.Register(true, "getset", wrapWriteCommandKV(nd, nd.getsetCommand))
 	nd.router.Register(true, "incr", wrapWriteCommandK(nd, nd.incrCommand))
 	nd.router.Register(true, "incrby", wrapWriteCommandKV(nd, nd.incrbyCommand))
 	nd.router.Register(true, "pfadd", wrapWriteCommandKAnySubkey(nd, nd.pfaddCommand, 0))
@@ -153,7 +156,7 @@ func (nd *KVNode) registerHandler() {
 	nd.router.Register(false, "sttl", wrapReadCommandK(nd.sttlCommand))
 	nd.router.Register(false, "zttl", wrapReadCommandK(nd.zttlCommand))
 
-	nd.router.Register(true, "setex", wrapWriteCommandKVV(nd, nd.setexCommand))
+	nd.router.Register(true, "setex", wrapWriteCommandKSubkeyV(nd, nd.setexCommand))
 	nd.router.Register(true, "expire", wrapWriteCommandKV(nd, nd.expireCommand))
 	nd.router.Register(true, "hexpire", wrapWriteCommandKV(nd, nd.hashExpireCommand))
 	nd.router.Register(true, "lexpire", wrapWriteCommandKV(nd, nd.listExpireCommand))
@@ -184,11 +187,13 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterMerge("advscan", nd.advanceScanCommand)
 	nd.router.RegisterMerge("fullscan", nd.fullScanCommand)
 	nd.router.RegisterMerge("hidx.from", nd.hindexSearchCommand)
+	nd.router.RegisterMerge("zidx.from", nd.zindexSearchCommand)
+	nd.router.RegisterMerge("ft.search", nd.fullTextSearchCommand)
 
 	nd.router.RegisterMerge("exists", wrapMergeCommandKK(nd.existsCommand))
-	nd.router.RegisterWriteMerge("del", wrapWriteMergeCommandKK(nd, nd.delCommand))
+	nd.registerWriteMerge("del", wrapWriteMergeCommandKK(nd, nd.delCommand))
 	//nd.router.RegisterWriteMerge("mset", nd.msetCommand)
-	nd.router.RegisterWriteMerge("plset", wrapWriteMergeCommandKVKV(nd, nd.plsetCommand))
+	nd.registerWriteMerge("plset", wrapWriteMergeCommandKVKV(nd, nd.plsetCommand))
 
 }
 
@@ -197,6 +202,7 @@ func (kvsm *kvStoreSM) registerConflictHandlers() {
 	kvsm.cRouter.Register("del", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("set", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("setnx", kvsm.checkKVConflict)
+	kvsm.cRouter.Register("getset", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("incr", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("incrby", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("plset", kvsm.checkKVKVConflict)
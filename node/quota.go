@@ -0,0 +1,139 @@
+package node
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+)
+
+const quotaCheckInterval = time.Second * 30
+
+var ErrQuotaExceeded = errors.New("ERR_QUOTA_EXCEEDED: the namespace exceeds the quota and is read only now, only deletion allowed")
+
+// the writes which can free the space are still allowed after the quota exceeded
+var quotaFreeCmds = map[string]bool{
+	"del":              true,
+	"hdel":             true,
+	"hclear":           true,
+	"hmclear":          true,
+	"lpop":             true,
+	"rpop":             true,
+	"ltrim":            true,
+	"lclear":           true,
+	"lmclear":          true,
+	"srem":             true,
+	"spop":             true,
+	"sclear":           true,
+	"smclear":          true,
+	"zrem":             true,
+	"zremrangebyscore": true,
+	"zremrangebyrank":  true,
+	"zremrangebylex":   true,
+	"zclear":           true,
+	"zmclear":          true,
+}
+
+// partitionQuota is the quota of the namespace split evenly to each partition, so
+// the quota can be checked locally by each partition without any coordination.
+type partitionQuota struct {
+	maxKeys  int64
+	maxBytes int64
+}
+
+// SetQuota set the quota of the whole namespace, 0 means no limit
+func (nn *NamespaceNode) SetQuota(maxKeys int64, maxBytes int64) {
+	nn.Node.setQuota(maxKeys, maxBytes, nn.conf.PartitionNum)
+}
+
+func (nd *KVNode) setQuota(maxKeys int64, maxBytes int64, partitionNum int) {
+	if partitionNum <= 0 {
+		partitionNum = 1
+	}
+	q := &partitionQuota{}
+	if maxKeys > 0 {
+		q.maxKeys = (maxKeys + int64(partitionNum) - 1) / int64(partitionNum)
+	}
+	if maxBytes > 0 {
+		q.maxBytes = (maxBytes + int64(partitionNum) - 1) / int64(partitionNum)
+	}
+	old, _ := nd.quota.Load().(*partitionQuota)
+	if old == nil && q.maxKeys == 0 && q.maxBytes == 0 {
+		return
+	}
+	if old != nil && *old == *q {
+		return
+	}
+	nd.rn.Infof("partition quota changed to %v keys, %v bytes", q.maxKeys, q.maxBytes)
+	nd.quota.Store(q)
+	nd.updateQuotaExceeded()
+}
+
+func (nd *KVNode) updateQuotaExceeded() {
+	q, _ := nd.quota.Load().(*partitionQuota)
+	exceeded := false
+	if q != nil {
+		if q.maxKeys > 0 && atomic.LoadInt64(&nd.usedKeys) > q.maxKeys {
+			exceeded = true
+		}
+		if q.maxBytes > 0 && atomic.LoadInt64(&nd.usedBytes) > q.maxBytes {
+			exceeded = true
+		}
+	}
+	if exceeded {
+		if atomic.CompareAndSwapInt32(&nd.quotaExceeded, 0, 1) {
+			nd.rn.Infof("partition exceeds the quota (%v keys, %v bytes), used %v keys, %v bytes",
+				q.maxKeys, q.maxBytes, atomic.LoadInt64(&nd.usedKeys), atomic.LoadInt64(&nd.usedBytes))
+		}
+	} else if atomic.CompareAndSwapInt32(&nd.quotaExceeded, 1, 0) {
+		nd.rn.Infof("partition quota is not exceeded anymore")
+	}
+}
+
+// refreshQuotaUsage update the approximate key count and the data size of the partition
+func (nd *KVNode) refreshQuotaUsage() {
+	kvsm, ok := nd.sm.(*kvStoreSM)
+	if !ok {
+		return
+	}
+	keys, bytes := kvsm.GetUsage()
+	atomic.StoreInt64(&nd.usedKeys, keys)
+	atomic.StoreInt64(&nd.usedBytes, bytes)
+	nd.updateQuotaExceeded()
+}
+
+// checkQuotaUsage is called periodically by the namespace manager for all the partitions,
+// the usage is always refreshed since it is also reported for the balance by the load.
+func (nd *KVNode) checkQuotaUsage() {
+	nd.refreshQuotaUsage()
+}
+
+// checkQuota reject the write except the deletion if the partition exceeds the quota
+func (nd *KVNode) checkQuota(data []byte) error {
+	if atomic.LoadInt32(&nd.quotaExceeded) == 0 {
+		return nil
+	}
+	cmd, err := redcon.Parse(data)
+	if err == nil && len(cmd.Args) > 0 && quotaFreeCmds[strings.ToLower(string(cmd.Args[0]))] {
+		return nil
+	}
+	return ErrQuotaExceeded
+}
+
+// GetQuotaStats return the quota and the approximate usage of the partition
+func (nd *KVNode) GetQuotaStats() *common.QuotaStats {
+	q, _ := nd.quota.Load().(*partitionQuota)
+	if q == nil || (q.maxKeys <= 0 && q.maxBytes <= 0) {
+		return nil
+	}
+	return &common.QuotaStats{
+		MaxKeys:   q.maxKeys,
+		MaxBytes:  q.maxBytes,
+		UsedKeys:  atomic.LoadInt64(&nd.usedKeys),
+		UsedBytes: atomic.LoadInt64(&nd.usedBytes),
+		Exceeded:  atomic.LoadInt32(&nd.quotaExceeded) == 1,
+	}
+}
@@ -0,0 +1,43 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionQuota(t *testing.T) {
+	nd := &KVNode{rn: &raftNode{}}
+	setCmd := buildCommand([][]byte{[]byte("SET"), []byte("test:key1"), []byte("v")})
+	delCmd := buildCommand([][]byte{[]byte("DEL"), []byte("test:key1")})
+
+	nd.setQuota(0, 0, 4)
+	assert.Nil(t, nd.GetQuotaStats())
+	assert.Nil(t, nd.checkQuota(setCmd.Raw))
+
+	nd.setQuota(100, 1000, 4)
+	qs := nd.GetQuotaStats()
+	assert.Equal(t, int64(25), qs.MaxKeys)
+	assert.Equal(t, int64(250), qs.MaxBytes)
+	assert.False(t, qs.Exceeded)
+
+	atomic.StoreInt64(&nd.usedKeys, 26)
+	nd.updateQuotaExceeded()
+	assert.True(t, nd.GetQuotaStats().Exceeded)
+	assert.Equal(t, ErrQuotaExceeded, nd.checkQuota(setCmd.Raw))
+	// deletion should be allowed to free the space
+	assert.Nil(t, nd.checkQuota(delCmd.Raw))
+
+	// increase the quota should make the namespace writable again
+	nd.setQuota(200, 0, 4)
+	assert.False(t, nd.GetQuotaStats().Exceeded)
+	assert.Nil(t, nd.checkQuota(setCmd.Raw))
+
+	atomic.StoreInt64(&nd.usedBytes, 1000)
+	nd.setQuota(200, 2000, 4)
+	assert.True(t, nd.GetQuotaStats().Exceeded)
+	nd.setQuota(0, 0, 4)
+	assert.Nil(t, nd.GetQuotaStats())
+	assert.Nil(t, nd.checkQuota(setCmd.Raw))
+}
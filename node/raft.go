@@ -118,6 +118,18 @@ type raftNode struct {
 	lastLeaderChangedTs int64
 	stopping            int32
 	replayRunning       int32
+	// the last committed index published to the apply loop
+	publishedIndex uint64
+	// the replica with priority 0 will not campaign for leader
+	electionPriority int32
+	// the files can be purged only while the wal is opened
+	purgeMutex   sync.Mutex
+	purgeRunning bool
+	// the last time (unix nano) received the message from other replicas
+	contactMutex sync.Mutex
+	peerContacts map[uint64]int64
+	// the max committed index of the leader received from the append messages
+	leaderCommit uint64
 }
 
 // newRaftNode initiates a raft instance and returns a committed log entry
@@ -141,6 +153,7 @@ func newRaftNode(rconfig *RaftConfig, transport *rafthttp.Transport,
 		config:        rconfig,
 		members:       make(map[uint64]*common.MemberInfo),
 		learnerMems:   make(map[uint64]*common.MemberInfo),
+		peerContacts:  make(map[uint64]int64),
 		join:          join,
 		raftStorage:   raft.NewMemoryStorage(),
 		stopc:         make(chan struct{}),
@@ -151,6 +164,7 @@ func newRaftNode(rconfig *RaftConfig, transport *rafthttp.Transport,
 		readStateC:    make(chan raft.ReadState, 1),
 		newLeaderChan: newLeaderChan,
 	}
+	rc.electionPriority = loadElectionPriority(rc.config.DataDir)
 	snapDir := rc.config.SnapDir
 	if !fileutil.Exist(snapDir) {
 		if err := os.MkdirAll(snapDir, common.DIR_PERM); err != nil {
@@ -180,6 +194,8 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot, readOld bool) (*wal.WAL,
 		w, err := wal.Create(rc.config.WALDir, d, rc.config.OptimizedFsync)
 		if err != nil {
 			nodeLog.Errorf("create wal error (%v)", err)
+		} else if rc.config.walSyncer != nil {
+			w.SetGroupSyncer(rc.config.walSyncer)
 		}
 		return w, d, hardState, nil, err
 	}
@@ -197,6 +213,9 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot, readOld bool) (*wal.WAL,
 			nodeLog.Errorf("error loading wal (%v)", err)
 			return w, nil, hardState, nil, err
 		}
+		if rc.config.walSyncer != nil {
+			w.SetGroupSyncer(rc.config.walSyncer)
+		}
 		if readOld {
 			meta, st, ents, err := w.ReadAll()
 			if err != nil {
@@ -342,6 +361,9 @@ func (rc *raftNode) startRaft(ds DataStorage, standalone bool) error {
 		CheckQuorum:     true,
 		PreVote:         true,
 		Logger:          nodeLog,
+		DisableCampaign: func() bool {
+			return atomic.LoadInt32(&rc.electionPriority) == ElectionPriorityNever
+		},
 		Group: raftpb.Group{NodeId: rc.config.nodeConfig.NodeID,
 			Name: rc.config.GroupName, GroupId: rc.config.GroupID,
 			RaftReplicaId: uint64(rc.config.ID)},
@@ -620,7 +642,7 @@ func (rc *raftNode) handleSendSnapshot(np *nodeProgress) {
 	}
 }
 
-func (rc *raftNode) beginSnapshot(snapTerm uint64, snapi uint64, confState raftpb.ConfState) error {
+func (rc *raftNode) beginSnapshot(snapTerm uint64, snapi uint64, confState raftpb.ConfState, catchup uint64) error {
 	// here we can just begin snapshot, to freeze the state of storage
 	// and we can copy data async below
 	// TODO: do we need the snapshot while we already make our data stable on disk?
@@ -658,8 +680,8 @@ func (rc *raftNode) beginSnapshot(snapTerm uint64, snapi uint64, confState raftp
 		rc.Infof("saved snapshot at index %d", snap.Metadata.Index)
 
 		compactIndex := uint64(1)
-		if snapi > uint64(rc.config.SnapCatchup) {
-			compactIndex = snapi - uint64(rc.config.SnapCatchup)
+		if snapi > catchup {
+			compactIndex = snapi - catchup
 		}
 		if err := rc.raftStorage.Compact(compactIndex); err != nil {
 			if err == raft.ErrCompacted {
@@ -677,6 +699,13 @@ func (rc *raftNode) beginSnapshot(snapTerm uint64, snapi uint64, confState raftp
 // whether all entries could be published.
 func (rc *raftNode) publishEntries(ents []raftpb.Entry, snapshot raftpb.Snapshot, snapResult chan error,
 	raftDone chan struct{}, applyWaitDone chan struct{}) {
+	published := snapshot.Metadata.Index
+	if len(ents) > 0 && ents[len(ents)-1].Index > published {
+		published = ents[len(ents)-1].Index
+	}
+	if published > atomic.LoadUint64(&rc.publishedIndex) {
+		atomic.StoreUint64(&rc.publishedIndex, published)
+	}
 	select {
 	case rc.commitC <- applyInfo{ents: ents, snapshot: snapshot, applySnapshotResult: snapResult,
 		raftDone: raftDone, applyWaitDone: applyWaitDone}:
@@ -686,6 +715,9 @@ func (rc *raftNode) publishEntries(ents []raftpb.Entry, snapshot raftpb.Snapshot
 }
 
 func (rc *raftNode) maybeTryElection() {
+	if atomic.LoadInt32(&rc.electionPriority) == ElectionPriorityNever {
+		return
+	}
 	// to avoid election at the same time, we only allow the smallest node to elect
 	smallest := rc.config.ID
 	for _, v := range rc.config.RaftPeers {
@@ -797,13 +829,14 @@ func (rc *raftNode) applyConfChange(cc raftpb.ConfChange, confState *raftpb.Conf
 }
 
 func (rc *raftNode) serveChannels() {
-	purgeDone := make(chan struct{})
-	raftReadyLoopC := make(chan struct{})
-	go rc.purgeFile(purgeDone, raftReadyLoopC)
+	rc.purgeMutex.Lock()
+	rc.purgeRunning = true
+	rc.purgeMutex.Unlock()
 	defer func() {
 		// wait purge stopped to avoid purge the files after wal closed
-		close(raftReadyLoopC)
-		<-purgeDone
+		rc.purgeMutex.Lock()
+		rc.purgeRunning = false
+		rc.purgeMutex.Unlock()
 		close(rc.commitC)
 		rc.Infof("raft node stopping")
 		// wait all async operation done
@@ -945,6 +978,10 @@ func (rc *raftNode) serveChannels() {
 func (rc *raftNode) processMessages(msgs []raftpb.Message) []raftpb.Message {
 	sentAppResp := false
 	for i := len(msgs) - 1; i >= 0; i-- {
+		if _, ok := common.CheckFault(common.FaultRaftDropMsg, rc.config.GroupName); ok {
+			msgs[i].To = 0
+			continue
+		}
 		if msgs[i].Type == raftpb.MsgAppResp {
 			if sentAppResp {
 				msgs[i].To = 0
@@ -1105,6 +1142,8 @@ func (rc *raftNode) Process(ctx context.Context, m raftpb.Message) error {
 		rc.Infof("dropping message since node is nil: %v", m.String())
 		return nil
 	}
+	rc.updatePeerContact(m.From)
+	rc.updateLeaderCommit(m)
 	err := rc.node.Step(ctx, m)
 	if err != nil {
 		rc.Infof("dropping message since step failed: %v", m.String())
@@ -1112,6 +1151,44 @@ func (rc *raftNode) Process(ctx context.Context, m raftpb.Message) error {
 	return err
 }
 
+func (rc *raftNode) updatePeerContact(id uint64) {
+	now := time.Now().UnixNano()
+	rc.contactMutex.Lock()
+	rc.peerContacts[id] = now
+	rc.contactMutex.Unlock()
+}
+
+// return the unix time in nanoseconds for the last message received from the replica
+func (rc *raftNode) getPeerContact(id uint64) int64 {
+	rc.contactMutex.Lock()
+	defer rc.contactMutex.Unlock()
+	return rc.peerContacts[id]
+}
+
+// the append and heartbeat messages from leader carry the committed index of the leader,
+// the heartbeat carries the smaller one if the follower is not matched.
+func (rc *raftNode) updateLeaderCommit(m raftpb.Message) {
+	if m.Type != raftpb.MsgApp && m.Type != raftpb.MsgHeartbeat {
+		return
+	}
+	for {
+		old := atomic.LoadUint64(&rc.leaderCommit)
+		if m.Commit <= old || atomic.CompareAndSwapUint64(&rc.leaderCommit, old, m.Commit) {
+			return
+		}
+	}
+}
+
+// getLeaderCommit return the committed index of the leader, the local committed
+// index on the follower or learner may be behind the leader while lagging.
+func (rc *raftNode) getLeaderCommit() uint64 {
+	commit := rc.node.Status().Commit
+	if leaderCommit := atomic.LoadUint64(&rc.leaderCommit); leaderCommit > commit {
+		return leaderCommit
+	}
+	return commit
+}
+
 func (rc *raftNode) getLastLeaderChangedTime() int64 {
 	return atomic.LoadInt64(&rc.lastLeaderChangedTs)
 }
@@ -1139,11 +1216,16 @@ func (rc *raftNode) SaveDBFrom(r io.Reader, msg raftpb.Message) (int64, error) {
 	return 0, nil
 }
 
-func (rc *raftNode) purgeFile(done chan struct{}, stopC chan struct{}) {
-	defer func() {
-		rc.Infof("purge exit")
-		close(done)
-	}()
+const raftFilePurgeInterval = time.Minute * 10
+
+// purgeFile remove the old snapshot and wal files, it is called periodically by the
+// namespace manager for all the raft groups to avoid the purge goroutines for each group.
+func (rc *raftNode) purgeFile() {
+	rc.purgeMutex.Lock()
+	defer rc.purgeMutex.Unlock()
+	if !rc.purgeRunning {
+		return
+	}
 	keep := rc.config.KeepWAL
 	if keep == 0 {
 		keep = 20
@@ -1151,16 +1233,11 @@ func (rc *raftNode) purgeFile(done chan struct{}, stopC chan struct{}) {
 	if keep < 10 {
 		keep = 10
 	}
-	var serrc, werrc <-chan error
-	serrc = fileutil.PurgeFile(rc.config.SnapDir, "snap", 10, time.Minute*10, rc.stopc)
-	werrc = fileutil.PurgeFile(rc.config.WALDir, "wal", uint(keep), time.Minute*10, rc.stopc)
-	select {
-	case e := <-werrc:
-		rc.Infof("failed to purge wal file %v", e)
-	case e := <-serrc:
-		rc.Infof("failed to purge snap file %v", e)
-	case <-stopC:
-		return
+	if err := fileutil.PurgeFileOnce(rc.config.SnapDir, "snap", 10); err != nil {
+		rc.Infof("failed to purge snap file %v", err)
+	}
+	if err := fileutil.PurgeFileOnce(rc.config.WALDir, "wal", uint(keep)); err != nil {
+		rc.Infof("failed to purge wal file %v", err)
 	}
 }
 
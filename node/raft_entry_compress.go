@@ -0,0 +1,77 @@
+package node
+
+import (
+	"errors"
+
+	"github.com/absolute8511/ZanRedisDB/syncerpb"
+)
+
+const (
+	// the first byte of the compressed entry data, the marshaled batch request never starts
+	// with 0 since the field number 0 is invalid in protobuf.
+	entryCompressedMagic = 0x00
+	// the magic and the compress type
+	entryCompressHeaderLen = 2
+	// the entry smaller than this will not be compressed
+	defaultRaftLogCompressMinBytes = 4096
+)
+
+var errInvalidCompressedEntry = errors.New("invalid compressed raft entry")
+
+// raftEntryCompressor compress the large proposal payloads before they enter the raft log,
+// so both the wal and the data replicated to the followers are reduced.
+type raftEntryCompressor struct {
+	compressType syncerpb.RaftLogCompressType
+	minBytes     int
+}
+
+func newRaftEntryCompressor(compressType string, minBytes int) (*raftEntryCompressor, error) {
+	t, err := parseSyncerCompressType(compressType)
+	if err != nil {
+		return nil, err
+	}
+	// check the compression is supported (the zstd need the cgo) before any proposal
+	if _, err := compressRaftLogData(t, []byte("check")); err != nil {
+		return nil, err
+	}
+	if minBytes <= 0 {
+		minBytes = defaultRaftLogCompressMinBytes
+	}
+	return &raftEntryCompressor{compressType: t, minBytes: minBytes}, nil
+}
+
+// compress return the data unchanged if the compression is disabled, the data is small or
+// the compressed data is not smaller.
+func (c *raftEntryCompressor) compress(data []byte) ([]byte, error) {
+	if c == nil || c.compressType == syncerpb.NoCompress || len(data) < c.minBytes {
+		return data, nil
+	}
+	compressed, err := compressRaftLogData(c.compressType, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed)+entryCompressHeaderLen >= len(data) {
+		return data, nil
+	}
+	buf := make([]byte, entryCompressHeaderLen+len(compressed))
+	buf[0] = entryCompressedMagic
+	buf[1] = byte(c.compressType)
+	copy(buf[entryCompressHeaderLen:], compressed)
+	return buf, nil
+}
+
+// decodeEntryData return the marshaled batch request of the entry data, the data not
+// compressed (including all the entries proposed by the old version) is returned unchanged.
+func decodeEntryData(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != entryCompressedMagic {
+		return data, nil
+	}
+	if len(data) < entryCompressHeaderLen {
+		return nil, errInvalidCompressedEntry
+	}
+	t := syncerpb.RaftLogCompressType(data[1])
+	if t == syncerpb.NoCompress {
+		return nil, errInvalidCompressedEntry
+	}
+	return DecompressRaftLogData(t, data[entryCompressHeaderLen:])
+}
@@ -0,0 +1,72 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/syncerpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaftEntryCompress(t *testing.T) {
+	_, err := newRaftEntryCompressor("invalid", 0)
+	assert.Equal(t, errUnknownCompressType, err)
+	none, err := newRaftEntryCompressor("", 0)
+	assert.Nil(t, err)
+	c, err := newRaftEntryCompressor("snappy", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultRaftLogCompressMinBytes, c.minBytes)
+
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < 100; i++ {
+		reqList.Reqs = append(reqList.Reqs, &InternalRaftRequest{
+			Header: &RequestHeader{ID: uint64(i + 1), DataType: int32(RedisReq)},
+			Data:   []byte("hmset default:test:key1 field1 value1 field2 value2 field3 value3"),
+		})
+	}
+	reqList.ReqNum = int32(len(reqList.Reqs))
+	reqList.Timestamp = 100
+	data, err := marshalBatchWithCrc(&reqList, nil)
+	assert.Nil(t, err)
+	assert.True(t, len(data) > defaultRaftLogCompressMinBytes)
+
+	// not compressed if disabled
+	raw, err := none.compress(data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, raw)
+
+	compressed, err := c.compress(data)
+	assert.Nil(t, err)
+	assert.True(t, len(compressed) < len(data), "should be compressed: %v, %v", len(compressed), len(data))
+	assert.Equal(t, byte(entryCompressedMagic), compressed[0])
+	assert.Equal(t, byte(syncerpb.SnappyCompress), compressed[1])
+	decoded, err := decodeEntryData(compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, data, decoded)
+	var decodedList BatchInternalRaftRequest
+	assert.Nil(t, decodedList.Unmarshal(decoded))
+	assert.True(t, verifyBatchCrc(&decodedList, decoded))
+	assert.Equal(t, reqList.ReqNum, decodedList.ReqNum)
+
+	// the uncompressed data proposed by the old version is passed unchanged
+	decoded, err = decodeEntryData(data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, decoded)
+
+	// the small or incompressible data is not compressed
+	small := data[:100]
+	raw, err = c.compress(small)
+	assert.Nil(t, err)
+	assert.Equal(t, small, raw)
+	c.minBytes = 1
+	tiny := []byte{1}
+	raw, err = c.compress(tiny)
+	assert.Nil(t, err)
+	assert.Equal(t, tiny, raw)
+
+	_, err = decodeEntryData([]byte{entryCompressedMagic})
+	assert.Equal(t, errInvalidCompressedEntry, err)
+	_, err = decodeEntryData([]byte{entryCompressedMagic, byte(syncerpb.NoCompress), 1})
+	assert.Equal(t, errInvalidCompressedEntry, err)
+	_, err = decodeEntryData(append([]byte{entryCompressedMagic, byte(syncerpb.SnappyCompress)}, data[:10]...))
+	assert.NotNil(t, err)
+}
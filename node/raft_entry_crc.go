@@ -0,0 +1,80 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync/atomic"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+const (
+	// the tag of the data crc field (9 << 3 | fixed32 wire type)
+	dataCrcFieldTag = 0x4d
+	dataCrcFieldLen = 5
+	quarantineDir   = "quarantine"
+)
+
+var (
+	errRaftEntryCorrupted = errors.New("raft entry corrupted")
+	raftEntryCrcTable     = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// marshalBatchWithCrc marshal the batch request and append the crc of the marshaled
+// data as the last field, the buffer will be reused if it is large enough.
+func marshalBatchWithCrc(reqList *BatchInternalRaftRequest, buffer []byte) ([]byte, error) {
+	reqList.DataCrc = 0
+	dataLen := reqList.Size()
+	if dataLen+dataCrcFieldLen > len(buffer) {
+		buffer = make([]byte, dataLen+dataCrcFieldLen)
+	}
+	n, err := reqList.MarshalTo(buffer[:dataLen])
+	if err != nil {
+		return nil, err
+	}
+	if n != dataLen {
+		return nil, errors.New("marshal length mismatch")
+	}
+	reqList.DataCrc = crc32.Checksum(buffer[:dataLen], raftEntryCrcTable)
+	buffer[dataLen] = dataCrcFieldTag
+	encodeFixed32RaftInternal(buffer, dataLen+1, reqList.DataCrc)
+	return buffer[:dataLen+dataCrcFieldLen], nil
+}
+
+// verifyBatchCrc check the crc of the raw data for the unmarshaled batch request,
+// the request proposed by the old version without crc will be ignored.
+func verifyBatchCrc(reqList *BatchInternalRaftRequest, data []byte) bool {
+	if reqList.DataCrc == 0 {
+		return true
+	}
+	if len(data) < dataCrcFieldLen || data[len(data)-dataCrcFieldLen] != dataCrcFieldTag {
+		return false
+	}
+	return crc32.Checksum(data[:len(data)-dataCrcFieldLen], raftEntryCrcTable) == reqList.DataCrc
+}
+
+// quarantineEntry save the corrupted entry to the quarantine dir for later inspection and
+// notify all the waiting proposals, the entry will be skipped without applying.
+func (nd *KVNode) quarantineEntry(evnt raftpb.Entry, reqList *BatchInternalRaftRequest, reason error) {
+	atomic.AddInt64(&nd.corruptedEntries, 1)
+	dir := path.Join(nd.rn.config.DataDir, quarantineDir)
+	fileName := path.Join(dir, fmt.Sprintf("%016x-%016x.entry", evnt.Term, evnt.Index))
+	err := os.MkdirAll(dir, common.DIR_PERM)
+	if err == nil {
+		err = ioutil.WriteFile(fileName, evnt.Data, common.FILE_PERM)
+	}
+	nd.rn.Errorf("raft entry (%v-%v) corrupted: %v, data len %v, skipped and quarantined to %v, save err: %v",
+		evnt.Term, evnt.Index, reason, len(evnt.Data), fileName, err)
+	nd.reportRepairEntry(evnt.Term, evnt.Index, reason.Error(), true)
+	nd.notifyApplyResult(reqList, errRaftEntryCorrupted)
+}
+
+// GetCorruptedEntries return the number of the corrupted raft entries quarantined since started
+func (nd *KVNode) GetCorruptedEntries() int64 {
+	return atomic.LoadInt64(&nd.corruptedEntries)
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaftEntryCrc(t *testing.T) {
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, &InternalRaftRequest{
+		Header: &RequestHeader{ID: 1, DataType: int32(RedisReq)},
+		Data:   []byte("set default:test:key1 value"),
+	})
+	reqList.ReqNum = 1
+	reqList.Timestamp = 100
+	noCrcData, err := reqList.Marshal()
+	assert.Nil(t, err)
+
+	data, err := marshalBatchWithCrc(&reqList, nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, uint32(0), reqList.DataCrc)
+	assert.Equal(t, len(noCrcData)+dataCrcFieldLen, len(data))
+
+	var decoded BatchInternalRaftRequest
+	assert.Nil(t, decoded.Unmarshal(data))
+	assert.Equal(t, reqList.DataCrc, decoded.DataCrc)
+	assert.Equal(t, reqList.Reqs[0].Data, decoded.Reqs[0].Data)
+	assert.True(t, verifyBatchCrc(&decoded, data))
+	// marshal again should get the same data
+	again, err := decoded.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, data, again)
+
+	// reuse the large enough buffer
+	buf := make([]byte, len(data)+10)
+	reused, err := marshalBatchWithCrc(&decoded, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, data, reused)
+	assert.Equal(t, &buf[0], &reused[0])
+
+	// the old data without crc should be passed
+	var old BatchInternalRaftRequest
+	assert.Nil(t, old.Unmarshal(noCrcData))
+	assert.True(t, verifyBatchCrc(&old, noCrcData))
+
+	corrupted := append([]byte(nil), data...)
+	pos := bytes.Index(corrupted, []byte("value"))
+	assert.True(t, pos > 0)
+	corrupted[pos] ^= 0x01
+	var bad BatchInternalRaftRequest
+	assert.Nil(t, bad.Unmarshal(corrupted))
+	assert.False(t, verifyBatchCrc(&bad, corrupted))
+}
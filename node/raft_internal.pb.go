@@ -57,20 +57,35 @@ func (ReqSourceType) EnumDescriptor() ([]byte, []int) { return fileDescriptorRaf
 type SchemaChangeType int32
 
 const (
-	SchemaChangeAddHsetIndex    SchemaChangeType = 0
-	SchemaChangeUpdateHsetIndex SchemaChangeType = 1
-	SchemaChangeDeleteHsetIndex SchemaChangeType = 2
+	SchemaChangeAddHsetIndex        SchemaChangeType = 0
+	SchemaChangeUpdateHsetIndex     SchemaChangeType = 1
+	SchemaChangeDeleteHsetIndex     SchemaChangeType = 2
+	SchemaChangeDropTable           SchemaChangeType = 3
+	SchemaChangeValueCompression    SchemaChangeType = 4
+	SchemaChangeZsetScoreIndex      SchemaChangeType = 5
+	SchemaChangeAddFullTextIndex    SchemaChangeType = 6
+	SchemaChangeDeleteFullTextIndex SchemaChangeType = 7
 )
 
 var SchemaChangeType_name = map[int32]string{
 	0: "SchemaChangeAddHsetIndex",
 	1: "SchemaChangeUpdateHsetIndex",
 	2: "SchemaChangeDeleteHsetIndex",
+	3: "SchemaChangeDropTable",
+	4: "SchemaChangeValueCompression",
+	5: "SchemaChangeZsetScoreIndex",
+	6: "SchemaChangeAddFullTextIndex",
+	7: "SchemaChangeDeleteFullTextIndex",
 }
 var SchemaChangeType_value = map[string]int32{
-	"SchemaChangeAddHsetIndex":    0,
-	"SchemaChangeUpdateHsetIndex": 1,
-	"SchemaChangeDeleteHsetIndex": 2,
+	"SchemaChangeAddHsetIndex":        0,
+	"SchemaChangeUpdateHsetIndex":     1,
+	"SchemaChangeDeleteHsetIndex":     2,
+	"SchemaChangeDropTable":           3,
+	"SchemaChangeValueCompression":    4,
+	"SchemaChangeZsetScoreIndex":      5,
+	"SchemaChangeAddFullTextIndex":    6,
+	"SchemaChangeDeleteFullTextIndex": 7,
 }
 
 func (x SchemaChangeType) String() string {
@@ -82,6 +97,11 @@ type RequestHeader struct {
 	ID        uint64 `protobuf:"varint,1,opt,name=ID,proto3" json:"ID,omitempty"`
 	DataType  int32  `protobuf:"varint,2,opt,name=data_type,json=dataType,proto3" json:"data_type,omitempty"`
 	Timestamp int64  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// used to dedup the retried request from the same client
+	ClientId  uint64 `protobuf:"varint,4,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	ClientSeq uint64 `protobuf:"varint,5,opt,name=client_seq,json=clientSeq,proto3" json:"client_seq,omitempty"`
+	// the address of the client proposing the request, used for the audit log
+	ClientAddr string `protobuf:"bytes,6,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
 }
 
 func (m *RequestHeader) Reset()                    { *m = RequestHeader{} }
@@ -109,6 +129,8 @@ type BatchInternalRaftRequest struct {
 	OrigTerm    uint64 `protobuf:"varint,6,opt,name=orig_term,json=origTerm,proto3" json:"orig_term,omitempty"`
 	OrigIndex   uint64 `protobuf:"varint,7,opt,name=orig_index,json=origIndex,proto3" json:"orig_index,omitempty"`
 	OrigCluster string `protobuf:"bytes,8,opt,name=orig_cluster,json=origCluster,proto3" json:"orig_cluster,omitempty"`
+	// the crc of the marshaled data before this field, should be the last field
+	DataCrc uint32 `protobuf:"fixed32,9,opt,name=data_crc,json=dataCrc,proto3" json:"data_crc,omitempty"`
 }
 
 func (m *BatchInternalRaftRequest) Reset()         { *m = BatchInternalRaftRequest{} }
@@ -167,6 +189,22 @@ func (m *RequestHeader) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintRaftInternal(dAtA, i, uint64(m.Timestamp))
 	}
+	if m.ClientId != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintRaftInternal(dAtA, i, uint64(m.ClientId))
+	}
+	if m.ClientSeq != 0 {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintRaftInternal(dAtA, i, uint64(m.ClientSeq))
+	}
+	if len(m.ClientAddr) > 0 {
+		dAtA[i] = 0x32
+		i++
+		i = encodeVarintRaftInternal(dAtA, i, uint64(len(m.ClientAddr)))
+		i += copy(dAtA[i:], m.ClientAddr)
+	}
 	return i, nil
 }
 
@@ -267,6 +305,11 @@ func (m *BatchInternalRaftRequest) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintRaftInternal(dAtA, i, uint64(len(m.OrigCluster)))
 		i += copy(dAtA[i:], m.OrigCluster)
 	}
+	if m.DataCrc != 0 {
+		dAtA[i] = 0x4d
+		i++
+		i = encodeFixed32RaftInternal(dAtA, i, uint32(m.DataCrc))
+	}
 	return i, nil
 }
 
@@ -305,6 +348,13 @@ func (m *SchemaChange) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func encodeFixed32RaftInternal(dAtA []byte, offset int, v uint32) int {
+	dAtA[offset] = uint8(v)
+	dAtA[offset+1] = uint8(v >> 8)
+	dAtA[offset+2] = uint8(v >> 16)
+	dAtA[offset+3] = uint8(v >> 24)
+	return offset + 4
+}
 func encodeVarintRaftInternal(dAtA []byte, offset int, v uint64) int {
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
@@ -326,6 +376,16 @@ func (m *RequestHeader) Size() (n int) {
 	if m.Timestamp != 0 {
 		n += 1 + sovRaftInternal(uint64(m.Timestamp))
 	}
+	if m.ClientId != 0 {
+		n += 1 + sovRaftInternal(uint64(m.ClientId))
+	}
+	if m.ClientSeq != 0 {
+		n += 1 + sovRaftInternal(uint64(m.ClientSeq))
+	}
+	l = len(m.ClientAddr)
+	if l > 0 {
+		n += 1 + l + sovRaftInternal(uint64(l))
+	}
 	return n
 }
 
@@ -374,6 +434,9 @@ func (m *BatchInternalRaftRequest) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovRaftInternal(uint64(l))
 	}
+	if m.DataCrc != 0 {
+		n += 5
+	}
 	return n
 }
 
@@ -493,6 +556,73 @@ func (m *RequestHeader) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ClientId", wireType)
+			}
+			m.ClientId = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRaftInternal
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ClientId |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ClientSeq", wireType)
+			}
+			m.ClientSeq = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRaftInternal
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ClientSeq |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ClientAddr", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRaftInternal
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRaftInternal
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ClientAddr = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRaftInternal(dAtA[iNdEx:])
@@ -831,6 +961,19 @@ func (m *BatchInternalRaftRequest) Unmarshal(dAtA []byte) error {
 			}
 			m.OrigCluster = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 9:
+			if wireType != 5 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DataCrc", wireType)
+			}
+			m.DataCrc = 0
+			if (iNdEx + 4) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += 4
+			m.DataCrc = uint32(dAtA[iNdEx-4])
+			m.DataCrc |= uint32(dAtA[iNdEx-3]) << 8
+			m.DataCrc |= uint32(dAtA[iNdEx-2]) << 16
+			m.DataCrc |= uint32(dAtA[iNdEx-1]) << 24
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRaftInternal(dAtA[iNdEx:])
@@ -1089,37 +1232,45 @@ var (
 func init() { proto.RegisterFile("raft_internal.proto", fileDescriptorRaftInternal) }
 
 var fileDescriptorRaftInternal = []byte{
-	// 500 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0xcd, 0x6e, 0xda, 0x4c,
-	0x14, 0x65, 0x8c, 0x21, 0x70, 0xe1, 0x43, 0x7c, 0x43, 0xd2, 0x4e, 0x9b, 0xd4, 0x75, 0xd9, 0xd4,
-	0xa2, 0x2a, 0x95, 0xc8, 0x13, 0x24, 0x41, 0x55, 0xbc, 0xa9, 0xaa, 0x81, 0x76, 0xd1, 0x0d, 0x9a,
-	0xe0, 0x1b, 0x40, 0xc2, 0x3f, 0x0c, 0x83, 0x54, 0xde, 0xa4, 0xbb, 0xbe, 0x4e, 0x96, 0x79, 0x84,
-	0x86, 0xbe, 0x48, 0x35, 0xd7, 0x48, 0xb8, 0x51, 0xd4, 0xdd, 0xcc, 0x39, 0x47, 0x73, 0xce, 0x3d,
-	0xd7, 0x86, 0x8e, 0x56, 0xb7, 0x66, 0xb2, 0x48, 0x0c, 0xea, 0x44, 0x2d, 0xfb, 0x99, 0x4e, 0x4d,
-	0xca, 0xdd, 0x24, 0x8d, 0xf0, 0xe5, 0xf1, 0x2c, 0x9d, 0xa5, 0x04, 0x7c, 0xb0, 0xa7, 0x9c, 0xeb,
-	0x7e, 0x83, 0xff, 0x24, 0xae, 0x36, 0xb8, 0x36, 0xd7, 0xa8, 0x22, 0xd4, 0xbc, 0x05, 0x4e, 0x38,
-	0x14, 0xcc, 0x67, 0x81, 0x2b, 0x9d, 0x70, 0xc8, 0x4f, 0xa1, 0x1e, 0x29, 0xa3, 0x26, 0x66, 0x9b,
-	0xa1, 0x70, 0x7c, 0x16, 0x54, 0x64, 0xcd, 0x02, 0xe3, 0x6d, 0x86, 0xfc, 0x0c, 0xea, 0x66, 0x11,
-	0xe3, 0xda, 0xa8, 0x38, 0x13, 0x65, 0x9f, 0x05, 0x65, 0x79, 0x00, 0xba, 0x5f, 0xa1, 0x13, 0xee,
-	0x93, 0x48, 0x75, 0x6b, 0xf6, 0x3e, 0xfc, 0x1d, 0x54, 0xe7, 0xe4, 0x45, 0x2e, 0x8d, 0x41, 0xa7,
-	0x6f, 0xf3, 0xf5, 0xff, 0x8a, 0x21, 0xf7, 0x12, 0xce, 0xc1, 0xb5, 0x6e, 0xe4, 0xdc, 0x94, 0x74,
-	0xee, 0xfe, 0x74, 0x40, 0x5c, 0x2a, 0x33, 0x9d, 0x3f, 0xf5, 0xfa, 0x73, 0x38, 0xd2, 0xb8, 0x9a,
-	0x24, 0x9b, 0x98, 0x9e, 0xaf, 0xc8, 0xaa, 0xc6, 0xd5, 0xa7, 0x4d, 0xcc, 0xdf, 0x83, 0xab, 0x71,
-	0xb5, 0x16, 0x8e, 0x5f, 0x0e, 0x1a, 0x83, 0x17, 0xb9, 0xe9, 0x13, 0x2f, 0x48, 0x92, 0xfd, 0x7b,
-	0x34, 0xfe, 0x16, 0x5c, 0x2a, 0xc4, 0xf5, 0x59, 0xd0, 0x2a, 0x4c, 0x30, 0x4a, 0x37, 0x7a, 0x8a,
-	0xb6, 0x1b, 0x49, 0x02, 0x7e, 0x02, 0xd6, 0x7f, 0xb2, 0x88, 0x44, 0x85, 0x2a, 0xad, 0x68, 0x5c,
-	0x85, 0x91, 0x6d, 0x35, 0xd5, 0x8b, 0xd9, 0xc4, 0xa0, 0x8e, 0x45, 0x95, 0x98, 0x9a, 0x05, 0xc6,
-	0xa8, 0x63, 0xfe, 0x0a, 0x80, 0xc8, 0x45, 0x12, 0xe1, 0x77, 0x71, 0x44, 0x2c, 0xc9, 0x43, 0x0b,
-	0xf0, 0x37, 0xd0, 0x24, 0x7a, 0xba, 0xdc, 0xac, 0x0d, 0x6a, 0x51, 0xf3, 0x59, 0x50, 0x97, 0x0d,
-	0x8b, 0x5d, 0xe5, 0x50, 0x37, 0x83, 0xe6, 0x68, 0x3a, 0xc7, 0x58, 0x5d, 0xcd, 0x55, 0x32, 0x43,
-	0xde, 0x03, 0xd7, 0x66, 0xa2, 0x46, 0x5a, 0x83, 0x67, 0x79, 0xdc, 0xa2, 0x22, 0x4f, 0x4c, 0x3b,
-	0x3d, 0x86, 0xca, 0x58, 0xdd, 0x2c, 0xf3, 0x65, 0xd7, 0x65, 0x7e, 0xe1, 0x1e, 0x40, 0xae, 0x1f,
-	0xda, 0x6d, 0x94, 0x69, 0x1b, 0x05, 0xa4, 0x77, 0x4e, 0xdf, 0xd1, 0x61, 0x7c, 0xde, 0x80, 0xa3,
-	0x8f, 0x3a, 0x8d, 0x2f, 0x3e, 0x87, 0xed, 0x12, 0x3f, 0x81, 0xff, 0xed, 0x65, 0x1f, 0x6f, 0xb4,
-	0x4d, 0xa6, 0xa8, 0xdb, 0xac, 0xa7, 0xa1, 0xfd, 0x38, 0x04, 0x3f, 0x03, 0x51, 0xc4, 0x2e, 0xa2,
-	0xe8, 0x7a, 0x8d, 0x86, 0x26, 0x6f, 0x97, 0xf8, 0x6b, 0x38, 0x2d, 0xb2, 0x5f, 0xb2, 0x48, 0x19,
-	0x3c, 0x08, 0xd8, 0x63, 0xc1, 0x10, 0x97, 0x58, 0x14, 0x38, 0x97, 0xe2, 0xee, 0xc1, 0x2b, 0xdd,
-	0x3f, 0x78, 0xa5, 0xbb, 0x9d, 0xc7, 0xee, 0x77, 0x1e, 0xfb, 0xb5, 0xf3, 0xd8, 0x8f, 0xdf, 0x5e,
-	0xe9, 0xa6, 0x4a, 0x7f, 0xc4, 0xf9, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xdc, 0xf8, 0x37, 0x42,
-	0x44, 0x03, 0x00, 0x00,
+	// 627 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x54, 0xdb, 0x4e, 0xdb, 0x4a,
+	0x14, 0x8d, 0x1d, 0xe7, 0xb6, 0x03, 0x28, 0x67, 0x80, 0x73, 0xcc, 0xe5, 0x18, 0x9f, 0x9c, 0x87,
+	0x46, 0x54, 0xa5, 0x12, 0x7c, 0x41, 0x48, 0x84, 0xf0, 0x4b, 0x55, 0x4d, 0x52, 0x1e, 0xfa, 0x12,
+	0x0d, 0x9e, 0x4d, 0x62, 0xc9, 0xd7, 0xf1, 0x58, 0x82, 0x1f, 0xa9, 0xfa, 0x27, 0x95, 0xfa, 0x05,
+	0x3c, 0xf2, 0x09, 0x85, 0xfe, 0x48, 0x35, 0x63, 0x4b, 0x38, 0x14, 0xa9, 0x2f, 0xd6, 0xcc, 0x5a,
+	0x6b, 0xf6, 0xde, 0x6b, 0xcd, 0xc8, 0xb0, 0x2d, 0xd8, 0x8d, 0x5c, 0x04, 0xb1, 0x44, 0x11, 0xb3,
+	0xf0, 0x24, 0x15, 0x89, 0x4c, 0x88, 0x15, 0x27, 0x1c, 0xf7, 0x77, 0x96, 0xc9, 0x32, 0xd1, 0xc0,
+	0x7b, 0xb5, 0x2a, 0xb9, 0xe1, 0x37, 0x03, 0x36, 0x29, 0x66, 0x05, 0xe6, 0xf2, 0x12, 0x19, 0x47,
+	0x41, 0xb6, 0xc0, 0xf4, 0xa6, 0xb6, 0xe1, 0x1a, 0x23, 0x8b, 0x9a, 0xde, 0x94, 0x1c, 0x40, 0x8f,
+	0x33, 0xc9, 0x16, 0xf2, 0x2e, 0x45, 0xdb, 0x74, 0x8d, 0x51, 0x8b, 0x76, 0x15, 0x30, 0xbf, 0x4b,
+	0x91, 0x1c, 0x42, 0x4f, 0x06, 0x11, 0xe6, 0x92, 0x45, 0xa9, 0xdd, 0x74, 0x8d, 0x51, 0x93, 0x3e,
+	0x03, 0xea, 0xa8, 0x1f, 0x06, 0x18, 0xcb, 0x45, 0xc0, 0x6d, 0x4b, 0x57, 0xec, 0x96, 0x80, 0xc7,
+	0xc9, 0xbf, 0x00, 0x15, 0x99, 0x63, 0x66, 0xb7, 0x34, 0x5b, 0xc9, 0x67, 0x98, 0x91, 0x23, 0xe8,
+	0x57, 0x34, 0xe3, 0x5c, 0xd8, 0x6d, 0xd7, 0x18, 0xf5, 0x68, 0x75, 0x62, 0xcc, 0xb9, 0x18, 0x5e,
+	0xc1, 0xb6, 0x57, 0xf9, 0xa4, 0xec, 0x46, 0x56, 0x26, 0xc8, 0x5b, 0x68, 0xaf, 0xb4, 0x11, 0x6d,
+	0xa1, 0x7f, 0xba, 0x7d, 0xa2, 0xdc, 0x9f, 0xac, 0x79, 0xa4, 0x95, 0x84, 0x10, 0xb0, 0x94, 0x15,
+	0x6d, 0x6b, 0x83, 0xea, 0xf5, 0xf0, 0xbb, 0x09, 0xf6, 0x39, 0x93, 0xfe, 0xea, 0xb5, 0xea, 0xff,
+	0x40, 0x47, 0x60, 0xb6, 0x88, 0x8b, 0x48, 0x97, 0x6f, 0xd1, 0xb6, 0xc0, 0xec, 0x43, 0x11, 0x91,
+	0x77, 0x60, 0x09, 0xcc, 0x72, 0xdb, 0x74, 0x9b, 0xa3, 0xfe, 0xe9, 0x5e, 0xd9, 0xf4, 0x95, 0x0a,
+	0x54, 0xcb, 0xfe, 0x90, 0xdb, 0x1b, 0xb0, 0x74, 0xda, 0x2a, 0xb2, 0xad, 0x9a, 0x83, 0x59, 0x52,
+	0x08, 0x1f, 0x55, 0xf0, 0x54, 0x0b, 0xc8, 0x2e, 0xa8, 0xfe, 0x2a, 0xdd, 0x32, 0xbf, 0x96, 0xc0,
+	0xcc, 0xe3, 0x2a, 0xf7, 0x44, 0x04, 0xcb, 0x85, 0x44, 0x11, 0xe9, 0xe4, 0x2c, 0xda, 0x55, 0xc0,
+	0x1c, 0x45, 0xa4, 0x72, 0xd7, 0x64, 0x10, 0x73, 0xbc, 0xb5, 0x3b, 0x65, 0xee, 0x0a, 0xf1, 0x14,
+	0x40, 0xfe, 0x83, 0x0d, 0x4d, 0xfb, 0x61, 0x91, 0x4b, 0x14, 0x76, 0x57, 0x07, 0xdf, 0x57, 0xd8,
+	0xa4, 0x84, 0xc8, 0x1e, 0xe8, 0x07, 0xb0, 0xf0, 0x85, 0x6f, 0xf7, 0x5c, 0x63, 0xd4, 0xa1, 0x1d,
+	0xb5, 0x9f, 0x08, 0x7f, 0x98, 0xc2, 0xc6, 0xcc, 0x5f, 0x61, 0xc4, 0x26, 0x2b, 0x16, 0x2f, 0x91,
+	0x1c, 0x83, 0xa5, 0xc6, 0xd5, 0x61, 0x6d, 0x9d, 0xfe, 0x5d, 0x3a, 0xa9, 0x2b, 0x4a, 0x33, 0xea,
+	0x4b, 0x76, 0xa0, 0x35, 0x67, 0xd7, 0x61, 0xf9, 0xc8, 0x7a, 0xb4, 0xdc, 0x10, 0x07, 0xa0, 0xd4,
+	0x4f, 0xd5, 0x45, 0x35, 0xf5, 0x45, 0xd5, 0x90, 0xe3, 0x33, 0xd8, 0x5c, 0x4b, 0x86, 0xf4, 0xa1,
+	0x73, 0x21, 0x92, 0x68, 0xfc, 0xd1, 0x1b, 0x34, 0xc8, 0x2e, 0xfc, 0xa5, 0x36, 0xd5, 0xe4, 0xb3,
+	0xbb, 0xd8, 0x47, 0x31, 0x30, 0x8e, 0xbf, 0x98, 0x30, 0x78, 0x39, 0x05, 0x39, 0x04, 0xbb, 0x8e,
+	0x8d, 0x39, 0xbf, 0xcc, 0x51, 0xea, 0x54, 0x06, 0x0d, 0x72, 0x04, 0x07, 0x75, 0xf6, 0x53, 0xca,
+	0x99, 0xc4, 0x67, 0x81, 0xf1, 0x52, 0x30, 0xc5, 0x10, 0xeb, 0x02, 0x93, 0xec, 0xc1, 0xee, 0x9a,
+	0x40, 0x24, 0xa9, 0xb6, 0x38, 0x68, 0x12, 0x17, 0x0e, 0xeb, 0xd4, 0x15, 0x0b, 0x0b, 0x9c, 0x24,
+	0x51, 0x2a, 0x30, 0xcf, 0x83, 0x24, 0x1e, 0x58, 0xc4, 0x81, 0xfd, 0xba, 0xe2, 0x73, 0x8e, 0x72,
+	0xe6, 0x27, 0x02, 0xcb, 0xe2, 0xad, 0x97, 0x15, 0xc6, 0x9c, 0x5f, 0x14, 0x61, 0x38, 0xc7, 0xdb,
+	0xaa, 0x7d, 0x9b, 0xfc, 0x0f, 0x47, 0xbf, 0xcf, 0xb7, 0x2e, 0xea, 0x9c, 0xdb, 0xf7, 0x8f, 0x4e,
+	0xe3, 0xe1, 0xd1, 0x69, 0xdc, 0x3f, 0x39, 0xc6, 0xc3, 0x93, 0x63, 0xfc, 0x78, 0x72, 0x8c, 0xaf,
+	0x3f, 0x9d, 0xc6, 0x75, 0x5b, 0xff, 0x2f, 0xce, 0x7e, 0x0d, 0x00, 0x70, 0x1e, 0x1f, 0xff, 0x62,
+	0x04, 0x00, 0x00,
 }
@@ -0,0 +1,103 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const raftRepairReportFile = "raft_repair_report.json"
+
+// RaftRepairEntry is the raft entry which can not be decoded or applied found in the repair mode
+type RaftRepairEntry struct {
+	Term   uint64 `json:"term"`
+	Index  uint64 `json:"index"`
+	Reason string `json:"reason"`
+	// the key should be added to the repair skip entries to skip this entry while applying
+	AckKey  string `json:"ack_key"`
+	Skipped bool   `json:"skipped"`
+}
+
+// RaftRepairAckKey return the key used to acknowledge skipping the raft entry in the repair mode
+func RaftRepairAckKey(fullNS string, term uint64, index uint64) string {
+	return fmt.Sprintf("%s:%d-%d", fullNS, term, index)
+}
+
+// raftRepairReport record the bad entries while replaying in the repair mode, the
+// report is persisted in the data dir so the operator can check it after restart.
+type raftRepairReport struct {
+	sync.Mutex
+	fullNS  string
+	file    string
+	skips   map[string]bool
+	entries []RaftRepairEntry
+}
+
+func newRaftRepairReport(dataDir string, fullNS string, skipEntries []string) *raftRepairReport {
+	r := &raftRepairReport{
+		fullNS: fullNS,
+		file:   path.Join(dataDir, raftRepairReportFile),
+		skips:  make(map[string]bool),
+	}
+	for _, k := range skipEntries {
+		k = strings.TrimSpace(k)
+		if strings.HasPrefix(k, fullNS+":") {
+			r.skips[k] = true
+		}
+	}
+	return r
+}
+
+func (r *raftRepairReport) isAcked(term uint64, index uint64) bool {
+	return r.skips[RaftRepairAckKey(r.fullNS, term, index)]
+}
+
+func (r *raftRepairReport) add(term uint64, index uint64, reason string, skipped bool) error {
+	r.Lock()
+	defer r.Unlock()
+	r.entries = append(r.entries, RaftRepairEntry{
+		Term:    term,
+		Index:   index,
+		Reason:  reason,
+		AckKey:  RaftRepairAckKey(r.fullNS, term, index),
+		Skipped: skipped,
+	})
+	d, _ := json.MarshalIndent(r.entries, "", " ")
+	if err := os.MkdirAll(path.Dir(r.file), common.DIR_PERM); err != nil {
+		return err
+	}
+	tmp := r.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, d, common.FILE_PERM); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.file)
+}
+
+func (r *raftRepairReport) getEntries() []RaftRepairEntry {
+	r.Lock()
+	defer r.Unlock()
+	return append([]RaftRepairEntry(nil), r.entries...)
+}
+
+// GetRaftRepairReport return the bad entries found in the repair mode, nil if not in repair mode
+func (nd *KVNode) GetRaftRepairReport() []RaftRepairEntry {
+	if nd.repair == nil {
+		return nil
+	}
+	return nd.repair.getEntries()
+}
+
+func (nd *KVNode) reportRepairEntry(term uint64, index uint64, reason string, skipped bool) {
+	if nd.repair == nil {
+		return
+	}
+	err := nd.repair.add(term, index, reason, skipped)
+	nd.rn.Errorf("repair mode found bad entry (%v-%v): %v, skipped: %v, ack key: %v, save report err: %v",
+		term, index, reason, skipped, RaftRepairAckKey(nd.ns, term, index), err)
+}
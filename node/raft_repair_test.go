@@ -0,0 +1,37 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaftRepairReport(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "raft-repair-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	r := newRaftRepairReport(tmpDir, "default-0", []string{"default-0:2-10", " default-1:2-11", "default-0:3-12 "})
+	assert.True(t, r.isAcked(2, 10))
+	assert.True(t, r.isAcked(3, 12))
+	assert.False(t, r.isAcked(2, 11))
+	assert.False(t, r.isAcked(2, 12))
+	assert.Equal(t, "default-0:2-11", RaftRepairAckKey("default-0", 2, 11))
+
+	assert.Nil(t, r.add(2, 10, "panic", true))
+	assert.Nil(t, r.add(2, 11, "raft entry corrupted", false))
+	entries := r.getEntries()
+	assert.Equal(t, 2, len(entries))
+
+	d, err := ioutil.ReadFile(path.Join(tmpDir, raftRepairReportFile))
+	assert.Nil(t, err)
+	var saved []RaftRepairEntry
+	assert.Nil(t, json.Unmarshal(d, &saved))
+	assert.Equal(t, entries, saved)
+	assert.Equal(t, "default-0:2-11", saved[1].AckKey)
+	assert.False(t, saved[1].Skipped)
+}
@@ -0,0 +1,50 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const rdbImportBatch = 100
+
+// ExportTableRDB write the table data in this partition to the rdb as the redis db
+func (nd *KVNode) ExportTableRDB(table string, dbIndex int, w *common.RDBWriter) (int64, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.ExportTableRDB(table, dbIndex, w)
+	}
+	return 0, errors.New("no data export for learner")
+}
+
+// ImportRDBEntry write the key in rdb to the table, the old data of the key will be replaced.
+// The key should belong to this partition.
+func (nd *KVNode) ImportRDBEntry(table string, e *common.RDBEntry) error {
+	ttl := e.GetRemainingTTL(time.Now())
+	if ttl < 0 {
+		return nil
+	}
+	key := make([]byte, 0, len(table)+1+len(e.Key))
+	key = append(key, table...)
+	key = append(key, common.KEYSEP)
+	key = append(key, e.Key...)
+	cmds, err := common.BuildRDBEntryCommands(key, e, ttl, rdbImportBatch)
+	if err != nil {
+		return err
+	}
+	for _, args := range cmds {
+		if _, err := nd.Propose(buildCommand(args).Raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportTable write the keys of the table in this partition to the dump from the cursor,
+// return the next cursor which is nil if done.
+func (nd *KVNode) ExportTable(table string, cursor []byte, count int, w *common.TableDumpWriter) ([]byte, int, error) {
+	if s, ok := nd.sm.(*kvStoreSM); ok {
+		return s.store.ExportTable(table, cursor, count, w)
+	}
+	return nil, 0, errors.New("no data export for learner")
+}
@@ -0,0 +1,41 @@
+package node
+
+import (
+	"errors"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft"
+)
+
+var (
+	ErrReadOnlyReplica    = errors.New("ERR_READ_ONLY_REPLICA: write is not allowed on the read only replica")
+	ErrReadReplicaLagging = errors.New("ERR_REPLICA_LAGGING: the read only replica is lagging behind the leader")
+)
+
+// IsReadReplica return true if the node is the non-voting learner which applies all the
+// data locally and serves the stale reads
+func (nd *KVNode) IsReadReplica() bool {
+	return nd.machineConfig.LearnerRole == common.LearnerRoleReadReplica
+}
+
+// CheckReadReplicaStaleness check whether the read only replica is fresh enough for
+// serving the read, the data may be stale within the configured bound.
+func (nd *KVNode) CheckReadReplicaStaleness() error {
+	maxLag := nd.machineConfig.ReadReplicaMaxLag
+	if maxLag > 0 && nd.getApplyBacklog() > maxLag {
+		return ErrReadReplicaLagging
+	}
+	maxStale := nd.machineConfig.ReadReplicaMaxStaleMs
+	if maxStale > 0 {
+		lead := nd.rn.Lead()
+		if lead == raft.None {
+			return ErrReadReplicaLagging
+		}
+		lastContact := nd.rn.getPeerContact(lead)
+		if time.Now().UnixNano()-lastContact > maxStale*int64(time.Millisecond) {
+			return ErrReadReplicaLagging
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadReplicaStaleness(t *testing.T) {
+	nd := &KVNode{
+		rn: &raftNode{peerContacts: make(map[uint64]int64)},
+		machineConfig: &MachineConfig{
+			LearnerRole: common.LearnerRoleReadReplica,
+		},
+	}
+	assert.True(t, nd.IsReadReplica())
+	// no bound for the stale read
+	assert.Nil(t, nd.CheckReadReplicaStaleness())
+
+	nd.machineConfig.ReadReplicaMaxLag = 100
+	atomic.StoreUint64(&nd.rn.publishedIndex, 200)
+	atomic.StoreUint64(&nd.appliedIndex, 50)
+	assert.Equal(t, ErrReadReplicaLagging, nd.CheckReadReplicaStaleness())
+	atomic.StoreUint64(&nd.appliedIndex, 150)
+	assert.Nil(t, nd.CheckReadReplicaStaleness())
+
+	nd.machineConfig.ReadReplicaMaxStaleMs = 100
+	// no leader known
+	assert.Equal(t, ErrReadReplicaLagging, nd.CheckReadReplicaStaleness())
+	atomic.StoreUint64(&nd.rn.lead, 1)
+	nd.rn.updatePeerContact(1)
+	assert.Nil(t, nd.CheckReadReplicaStaleness())
+	nd.rn.peerContacts[1] = time.Now().Add(-time.Second).UnixNano()
+	assert.Equal(t, ErrReadReplicaLagging, nd.CheckReadReplicaStaleness())
+
+	nd.machineConfig.LearnerRole = common.LearnerRoleLogSyncer
+	assert.False(t, nd.IsReadReplica())
+}
@@ -149,7 +149,7 @@ func (rss *remoteSyncedStateMgr) GetState(name string) (SyncedState, bool) {
 func (rss *remoteSyncedStateMgr) RestoreStates(ss map[string]SyncedState) {
 	rss.Lock()
 	rss.remoteSyncedStates = make(map[string]SyncedState, len(ss))
-	for k, v := range rss.remoteSyncedStates {
+	for k, v := range ss {
 		rss.remoteSyncedStates[k] = v
 	}
 	rss.Unlock()
@@ -214,6 +214,7 @@ func (nd *KVNode) postprocessRemoteSnapApply(reqList BatchInternalRaftRequest,
 	if !isRemoteSnapTransfer {
 		if retErr != errIgnoredRemoteApply {
 			nd.remoteSyncedStates.UpdateState(reqList.OrigCluster, ss)
+			nd.persistRemoteSyncedState(reqList.OrigCluster, ss)
 			if isRemoteSnapApply {
 				nd.remoteSyncedStates.UpdateApplyingSnapStatus(reqList.OrigCluster, ss, ApplySnapDone)
 			}
@@ -232,7 +233,62 @@ func (nd *KVNode) postprocessRemoteSnapApply(reqList BatchInternalRaftRequest,
 }
 
 func (nd *KVNode) SetRemoteClusterSyncedRaft(name string, term uint64, index uint64, ts int64) {
-	nd.remoteSyncedStates.UpdateState(name, SyncedState{SyncedTerm: term, SyncedIndex: index, Timestamp: ts})
+	ss := SyncedState{SyncedTerm: term, SyncedIndex: index, Timestamp: ts}
+	nd.remoteSyncedStates.UpdateState(name, ss)
+	nd.persistRemoteSyncedState(name, ss)
+}
+
+// save the synced state to the store, so we can ignore the older duplicate sync
+// after restart even if the state is newer than the snapshot.
+func (nd *KVNode) persistRemoteSyncedState(name string, ss SyncedState) {
+	kvsm, ok := nd.sm.(*kvStoreSM)
+	if !ok {
+		return
+	}
+	err := kvsm.store.SaveRemoteSyncedState(name, ss.SyncedTerm, ss.SyncedIndex, ss.Timestamp)
+	if err != nil {
+		nd.rn.Infof("failed to save remote cluster %v synced state %v: %v", name, ss, err)
+	}
+}
+
+// load the synced states saved in the store, the newer state will override
+// the state restored from the raft snapshot.
+func (nd *KVNode) loadPersistedRemoteSyncedStates() {
+	kvsm, ok := nd.sm.(*kvStoreSM)
+	if !ok || kvsm.store.RockDB == nil {
+		return
+	}
+	states, err := kvsm.store.GetRemoteSyncedStates()
+	if err != nil {
+		nd.rn.Infof("failed to load remote synced states: %v", err)
+		return
+	}
+	for _, s := range states {
+		ss := SyncedState{SyncedTerm: s.Term, SyncedIndex: s.Index, Timestamp: s.Timestamp}
+		old, ok := nd.remoteSyncedStates.GetState(s.ClusterName)
+		if ok && old.IsNewer(&ss) {
+			continue
+		}
+		nd.rn.Infof("load remote cluster %v synced state: %v, old: %v", s.ClusterName, ss, old)
+		nd.remoteSyncedStates.UpdateState(s.ClusterName, ss)
+	}
+}
+
+func (nd *KVNode) getRemoteSyncedStats() []common.LogSyncStats {
+	states := nd.remoteSyncedStates.Clone()
+	if len(states) == 0 {
+		return nil
+	}
+	stats := make([]common.LogSyncStats, 0, len(states))
+	for name, ss := range states {
+		stats = append(stats, common.LogSyncStats{
+			Name:      name,
+			Term:      ss.SyncedTerm,
+			Index:     ss.SyncedIndex,
+			Timestamp: ss.Timestamp,
+		})
+	}
+	return stats
 }
 func (nd *KVNode) GetRemoteClusterSyncedRaft(name string) (uint64, uint64, int64) {
 	state, _ := nd.remoteSyncedStates.GetState(name)
@@ -246,9 +302,32 @@ func (nd *KVNode) GetLogSyncStatsInSyncLearner() (*common.LogSyncStats, *common.
 	}
 
 	recv, sync := logSyncer.GetLogSyncStats()
+	// the learner may be lagging, so the lag should be computed from the leader committed index
+	fillLogSyncLag(&sync, nd.rn.getLeaderCommit())
 	return &recv, &sync
 }
 
+func fillLogSyncLag(sync *common.LogSyncStats, leaderCommit uint64) {
+	sync.CommittedIndex = leaderCommit
+	sync.Lag = 0
+	if sync.CommittedIndex > sync.Index {
+		sync.Lag = sync.CommittedIndex - sync.Index
+	}
+}
+
+// IsLogSyncerCaughtUp check whether the remote cluster has synced the raft logs
+// up to the index, the current committed index will be used if index is 0.
+func (nd *KVNode) IsLogSyncerCaughtUp(index uint64) (bool, *common.LogSyncStats, error) {
+	_, sync := nd.GetLogSyncStatsInSyncLearner()
+	if sync == nil {
+		return false, nil, errors.New("not a log syncer")
+	}
+	if index == 0 {
+		index = sync.CommittedIndex
+	}
+	return sync.Index >= index, sync, nil
+}
+
 func (nd *KVNode) ApplyRemoteSnapshot(skip bool, name string, term uint64, index uint64) error {
 	// restore the state machine from transferred snap data when transfer success.
 	// we do not need restore other cluster member info here.
@@ -276,6 +355,10 @@ func (nd *KVNode) ApplyRemoteSnapshot(skip bool, name string, term uint64, index
 		// set the snap status to applying and the snap status will be updated if apply done or failed
 		nd.remoteSyncedStates.UpdateApplyingSnapStatus(name, oldS.SS, ApplySnapApplying)
 	}
+	return nd.proposeApplyRemoteSnap(skip, name, term, index)
+}
+
+func (nd *KVNode) proposeApplyRemoteSnap(skip bool, name string, term uint64, index uint64) error {
 	var reqList BatchInternalRaftRequest
 	reqList.OrigCluster = name
 	reqList.ReqNum = 1
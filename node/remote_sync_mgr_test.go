@@ -0,0 +1,34 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestLogSyncLagFromLeaderCommit(t *testing.T) {
+	rc := &raftNode{node: newNodeRecorder(), peerContacts: make(map[uint64]int64)}
+	assert.Equal(t, uint64(0), rc.getLeaderCommit())
+
+	assert.Nil(t, rc.Process(context.Background(), raftpb.Message{Type: raftpb.MsgApp, From: 1, Commit: 100}))
+	assert.Equal(t, uint64(100), rc.getLeaderCommit())
+	// the heartbeat to the lagging learner carry the smaller commit and should be ignored
+	assert.Nil(t, rc.Process(context.Background(), raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, Commit: 50}))
+	assert.Equal(t, uint64(100), rc.getLeaderCommit())
+	assert.Nil(t, rc.Process(context.Background(), raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, Commit: 120}))
+	assert.Equal(t, uint64(120), rc.getLeaderCommit())
+	// the messages not from leader do not carry the leader commit
+	assert.Nil(t, rc.Process(context.Background(), raftpb.Message{Type: raftpb.MsgVote, From: 2, Commit: 200}))
+	assert.Equal(t, uint64(120), rc.getLeaderCommit())
+
+	sync := common.LogSyncStats{Index: 90}
+	fillLogSyncLag(&sync, rc.getLeaderCommit())
+	assert.Equal(t, uint64(120), sync.CommittedIndex)
+	assert.Equal(t, uint64(30), sync.Lag)
+	sync.Index = 130
+	fillLogSyncLag(&sync, rc.getLeaderCommit())
+	assert.Equal(t, uint64(0), sync.Lag)
+}
@@ -0,0 +1,508 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+	"golang.org/x/time/rate"
+)
+
+var ErrKeyMoving = errors.New("ERR_KEY_MOVING: the key is moving to the new partition, retry later")
+
+var (
+	errReshardAborted        = errors.New("the partition reshard is aborted")
+	errReshardTargetNotReady = errors.New("the target partition of the reshard is not ready on this node")
+)
+
+const (
+	defaultReshardKeysPerSec = 1000
+	reshardScanBatch         = 100
+	// the copy is regarded as done while copying if the dirty keys are less than this,
+	// the remaining will be copied after the writes on the moving keys are blocked.
+	reshardCatchupKeys = 100
+	// wait the writes queued before switching to be applied
+	reshardSwitchGrace = proposeTimeout * 2
+)
+
+// the commands to remove the key of each data type
+var reshardClearCmds = map[common.DataType]string{
+	common.KV:   "del",
+	common.HASH: "hclear",
+	common.LIST: "lclear",
+	common.SET:  "sclear",
+	common.ZSET: "zclear",
+}
+
+func isReshardClearCmd(cmdName string) bool {
+	for _, c := range reshardClearCmds {
+		if c == cmdName {
+			return true
+		}
+	}
+	return false
+}
+
+// reshardState is the partition number and the expanding state of the namespace
+type reshardState struct {
+	partitionNum int
+	expandNum    int
+	state        string
+}
+
+func (st *reshardState) isMoving() bool {
+	return st.expandNum > 0 && st.expandNum != st.partitionNum &&
+		(st.state == common.ExpandStateCopying || st.state == common.ExpandStateSwitching)
+}
+
+// isMerging check if the partitions are merging into less partitions, the new partition number
+// is a divisor of the old and all the keys of the partition pid are moved to pid%expandNum.
+func (st *reshardState) isMerging() bool {
+	return st.expandNum > 0 && st.expandNum < st.partitionNum
+}
+
+// isPartitionMovingOut check if any key may be moved out from the partition while moving
+func (st *reshardState) isPartitionMovingOut(pid int) bool {
+	if !st.isMoving() || pid >= st.partitionNum {
+		return false
+	}
+	return !st.isMerging() || pid >= st.expandNum
+}
+
+// isKeyMovingOut check if the key in the partition should be moved to the other partition.
+// The keys in the old partitions are moving to the new partitions while copying and
+// switching, and the keys not belong to the partition are removed while cleaning. While
+// merging, all the keys in the merged partitions are moving since the hashed partition
+// under the less partition number is always less than the merged partition id.
+func (st *reshardState) isKeyMovingOut(pk []byte, pid int) bool {
+	if st.isMoving() {
+		return pid < st.partitionNum && GetHashedPartitionID(pk, st.expandNum) != pid
+	}
+	if st.state == common.ExpandStateCleaning && st.partitionNum > 0 {
+		return GetHashedPartitionID(pk, st.partitionNum) != pid
+	}
+	return false
+}
+
+// partitionResharder migrate the keys of the partition to the new partitions while the partition
+// number of the namespace is expanding online. The migration runs on the raft leader, all the
+// keys are copied first and then the moving keys written while copying are copied again. The
+// whole migration restarts on the new leader if the leader changed, since the written keys
+// are only tracked on the leader.
+type partitionResharder struct {
+	pid      int
+	state    atomic.Value
+	running  int32
+	tracking int32
+	mutex    sync.Mutex
+	dirty    map[string]struct{}
+	status   common.PartitionReshardStatus
+}
+
+func newPartitionResharder(pid int) *partitionResharder {
+	r := &partitionResharder{
+		pid:   pid,
+		dirty: make(map[string]struct{}),
+	}
+	r.state.Store(&reshardState{})
+	return r
+}
+
+func (r *partitionResharder) getState() *reshardState {
+	st, _ := r.state.Load().(*reshardState)
+	return st
+}
+
+// get the moving keys in the write command
+func (r *partitionResharder) getMovingKeys(st *reshardState, data []byte) (string, [][]byte) {
+	cmd, err := redcon.Parse(data)
+	if err != nil || len(cmd.Args) < 2 {
+		return "", nil
+	}
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	var keys [][]byte
+	for _, pos := range getCmdKeyPositions(cmdName, len(cmd.Args)) {
+		if st.isKeyMovingOut(cmd.Args[pos], r.pid) {
+			keys = append(keys, cmd.Args[pos])
+		}
+	}
+	return cmdName, keys
+}
+
+// checkWrite reject the writes on the moving keys while switching, and the writes on the keys
+// not belong to the partition after switched except the deletion.
+func (r *partitionResharder) checkWrite(data []byte) error {
+	st := r.getState()
+	if st.state == "" || st.state == common.ExpandStateCopying {
+		return nil
+	}
+	cmdName, keys := r.getMovingKeys(st, data)
+	if len(keys) == 0 {
+		return nil
+	}
+	if st.state == common.ExpandStateCleaning && isReshardClearCmd(cmdName) {
+		return nil
+	}
+	return ErrKeyMoving
+}
+
+// onApplied record the moving keys written while copying, so they can be copied again
+func (r *partitionResharder) onApplied(reqList *BatchInternalRaftRequest) {
+	if atomic.LoadInt32(&r.tracking) == 0 {
+		return
+	}
+	st := r.getState()
+	var dirty [][]byte
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(RedisReq) {
+			continue
+		}
+		_, keys := r.getMovingKeys(st, req.Data)
+		dirty = append(dirty, keys...)
+	}
+	if len(dirty) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	for _, k := range dirty {
+		r.dirty[string(k)] = struct{}{}
+	}
+	r.mutex.Unlock()
+}
+
+func (r *partitionResharder) begin(st *reshardState) {
+	r.mutex.Lock()
+	r.dirty = make(map[string]struct{})
+	r.status = common.PartitionReshardStatus{Partition: r.pid, State: st.state}
+	r.mutex.Unlock()
+	if st.isMoving() {
+		atomic.StoreInt32(&r.tracking, 1)
+	}
+}
+
+func (r *partitionResharder) end(err error) {
+	atomic.StoreInt32(&r.tracking, 0)
+	r.mutex.Lock()
+	r.dirty = make(map[string]struct{})
+	// the status is only valid while running on the leader
+	r.status.Done = false
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	r.mutex.Unlock()
+	atomic.StoreInt32(&r.running, 0)
+}
+
+func (r *partitionResharder) takeDirty() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	keys := make([]string, 0, len(r.dirty))
+	for k := range r.dirty {
+		keys = append(keys, k)
+	}
+	r.dirty = make(map[string]struct{})
+	return keys
+}
+
+func (r *partitionResharder) updateStatus(f func(s *common.PartitionReshardStatus)) {
+	r.mutex.Lock()
+	f(&r.status)
+	r.mutex.Unlock()
+}
+
+func (r *partitionResharder) getStatus() common.PartitionReshardStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.status
+	s.PendingKeys = len(r.dirty)
+	return s
+}
+
+func splitTableKey(pk []byte) (string, []byte) {
+	pos := bytes.IndexByte(pk, common.KEYSEP)
+	if pos <= 0 {
+		return "", nil
+	}
+	return string(pk[:pos]), pk[pos+1:]
+}
+
+func buildTableKey(table string, key []byte) []byte {
+	pk := make([]byte, 0, len(table)+1+len(key))
+	pk = append(pk, table...)
+	pk = append(pk, common.KEYSEP)
+	return append(pk, key...)
+}
+
+// setReshardState return true if the migration should be started for the state
+func (nd *KVNode) setReshardState(st *reshardState) bool {
+	old := nd.reshard.getState()
+	if *old != *st {
+		nd.rn.Infof("partition expand state changed from %v to %v", *old, *st)
+		nd.reshard.state.Store(st)
+	}
+	if st.state == "" || nd.store == nil || !nd.IsLead() {
+		return false
+	}
+	return atomic.CompareAndSwapInt32(&nd.reshard.running, 0, 1)
+}
+
+// GetReshardStatus return the status of the migration on this partition
+func (nd *KVNode) GetReshardStatus() common.PartitionReshardStatus {
+	return nd.reshard.getStatus()
+}
+
+// runReshard run the migration for the current expanding state until the state changed,
+// the target is used to get the local replica of the new partition.
+func (nd *KVNode) runReshard(target func(pid int) *KVNode, stopC <-chan struct{}) {
+	st := nd.reshard.getState()
+	nd.reshard.begin(st)
+	keysPerSec := nd.machineConfig.ReshardKeysPerSec
+	if keysPerSec <= 0 {
+		keysPerSec = defaultReshardKeysPerSec
+	}
+	limiter := rate.NewLimiter(rate.Limit(keysPerSec), keysPerSec)
+	nd.rn.Infof("begin reshard for state: %v", *st)
+	var err error
+	if st.isMoving() {
+		err = nd.reshardMove(st, target, limiter, stopC)
+	} else if st.state == common.ExpandStateCleaning {
+		err = nd.reshardClean(st, limiter, stopC)
+	}
+	nd.rn.Infof("reshard for state %v stopped: %v, status: %v", *st, err, nd.reshard.getStatus())
+	if err == errReshardAborted {
+		err = nil
+	}
+	nd.reshard.end(err)
+}
+
+// check if the migration can go on, the state can only be changed from copying to switching
+func (nd *KVNode) checkReshardContinue(st *reshardState, stopC <-chan struct{}) error {
+	select {
+	case <-stopC:
+		return errReshardAborted
+	case <-nd.stopChan:
+		return errReshardAborted
+	default:
+	}
+	if !nd.IsLead() {
+		return errReshardAborted
+	}
+	cur := nd.reshard.getState()
+	if cur.partitionNum != st.partitionNum || cur.expandNum != st.expandNum {
+		return errReshardAborted
+	}
+	if cur.state != st.state && !(st.isMoving() && cur.isMoving()) {
+		return errReshardAborted
+	}
+	return nil
+}
+
+func (nd *KVNode) waitReshardThrottle(limiter *rate.Limiter, stopC <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopC:
+		case <-nd.stopChan:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	if err := limiter.Wait(ctx); err != nil {
+		return errReshardAborted
+	}
+	return nil
+}
+
+// wait all the committed logs applied, so the scan can see the writes on the old leader
+func (nd *KVNode) waitReshardApplied(st *reshardState, stopC <-chan struct{}) error {
+	for atomic.LoadUint64(&nd.appliedIndex) < nd.GetCommittedIndex() {
+		if err := nd.checkReshardContinue(st, stopC); err != nil {
+			return err
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return nil
+}
+
+// scanReshardKeys scan all the keys in the partition and call the fn for the keys moving out
+func (nd *KVNode) scanReshardKeys(st *reshardState, stopC <-chan struct{},
+	fn func(table string, e *common.RDBEntry) error) error {
+	for _, t := range nd.store.GetTables() {
+		table := string(t)
+		var cursor []byte
+		for {
+			if err := nd.checkReshardContinue(st, stopC); err != nil {
+				return err
+			}
+			var moving []*common.RDBEntry
+			scanned := 0
+			next, err := nd.store.ScanTableEntries(table, cursor, func(e *common.RDBEntry) (bool, error) {
+				scanned++
+				if st.isKeyMovingOut(buildTableKey(table, e.Key), nd.reshard.pid) {
+					moving = append(moving, e)
+				}
+				return scanned < reshardScanBatch, nil
+			})
+			if err != nil {
+				return err
+			}
+			nd.reshard.updateStatus(func(s *common.PartitionReshardStatus) {
+				s.ScannedKeys += int64(scanned)
+			})
+			for _, e := range moving {
+				if err := fn(table, e); err != nil {
+					return err
+				}
+			}
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil
+}
+
+// copy the key to the new partition, the old data of the key in the new partition is
+// removed first since the key may be deleted or changed to another data type.
+func (nd *KVNode) copyReshardKey(st *reshardState, target func(pid int) *KVNode, pk []byte, replace bool) error {
+	table, key := splitTableKey(pk)
+	if table == "" {
+		return nil
+	}
+	tn := target(GetHashedPartitionID(pk, st.expandNum))
+	if tn == nil {
+		return errReshardTargetNotReady
+	}
+	entries, err := nd.store.GetKeyEntries(table, key)
+	if err != nil {
+		return err
+	}
+	if replace {
+		for _, c := range reshardClearCmds {
+			if _, err := tn.Propose(buildCommand([][]byte{[]byte(c), pk}).Raw); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range entries {
+		if err := tn.ImportRDBEntry(table, e); err != nil {
+			return err
+		}
+	}
+	nd.reshard.updateStatus(func(s *common.PartitionReshardStatus) {
+		s.MovedKeys++
+	})
+	return nil
+}
+
+func (nd *KVNode) reshardMove(st *reshardState, target func(pid int) *KVNode,
+	limiter *rate.Limiter, stopC <-chan struct{}) error {
+	if err := nd.waitReshardApplied(st, stopC); err != nil {
+		return err
+	}
+	// the partition merged into only receives the keys
+	if st.isPartitionMovingOut(nd.reshard.pid) {
+		err := nd.scanReshardKeys(st, stopC, func(table string, e *common.RDBEntry) error {
+			if err := nd.waitReshardThrottle(limiter, stopC); err != nil {
+				return err
+			}
+			// the key may be copied before the migration restarted (leader changed), and
+			// the key may be changed after that, so the old data in the target should be replaced.
+			return nd.copyReshardKey(st, target, buildTableKey(table, e.Key), true)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	nd.rn.Infof("reshard copy all keys done, begin catch up the written keys")
+	// catch up the keys written while copying until the routing switched
+	var switchStart time.Time
+	for {
+		if err := nd.checkReshardContinue(st, stopC); err != nil {
+			return err
+		}
+		cur := nd.reshard.getState()
+		keys := nd.reshard.takeDirty()
+		for _, k := range keys {
+			if err := nd.waitReshardThrottle(limiter, stopC); err != nil {
+				return err
+			}
+			if err := nd.copyReshardKey(cur, target, []byte(k), true); err != nil {
+				return err
+			}
+		}
+		status := nd.reshard.getStatus()
+		done := false
+		if cur.state == common.ExpandStateCopying {
+			done = status.PendingKeys <= reshardCatchupKeys
+		} else {
+			if switchStart.IsZero() {
+				switchStart = time.Now()
+			}
+			// the writes queued before switching may be still applying
+			done = len(keys) == 0 && status.PendingKeys == 0 &&
+				time.Since(switchStart) > reshardSwitchGrace &&
+				atomic.LoadUint64(&nd.appliedIndex) >= nd.GetCommittedIndex()
+		}
+		nd.reshard.updateStatus(func(s *common.PartitionReshardStatus) {
+			s.State = cur.state
+			s.Done = done
+		})
+		if len(keys) == 0 {
+			select {
+			case <-stopC:
+			case <-nd.stopChan:
+			case <-time.After(time.Millisecond * 100):
+			}
+		}
+	}
+}
+
+// reshardClean remove the keys not belong to this partition after the routing switched
+func (nd *KVNode) reshardClean(st *reshardState, limiter *rate.Limiter, stopC <-chan struct{}) error {
+	if err := nd.waitReshardApplied(st, stopC); err != nil {
+		return err
+	}
+	err := nd.scanReshardKeys(st, stopC, func(table string, e *common.RDBEntry) error {
+		c, ok := reshardClearCmds[e.Type]
+		if !ok {
+			return nil
+		}
+		if err := nd.waitReshardThrottle(limiter, stopC); err != nil {
+			return err
+		}
+		_, err := nd.Propose(buildCommand([][]byte{[]byte(c), buildTableKey(table, e.Key)}).Raw)
+		if err != nil {
+			return err
+		}
+		nd.reshard.updateStatus(func(s *common.PartitionReshardStatus) {
+			s.MovedKeys++
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	nd.reshard.updateStatus(func(s *common.PartitionReshardStatus) {
+		s.Done = true
+	})
+	// keep the status until the state changed
+	for {
+		if err := nd.checkReshardContinue(st, stopC); err != nil {
+			return err
+		}
+		select {
+		case <-stopC:
+		case <-nd.stopChan:
+		case <-time.After(time.Second):
+		}
+	}
+}
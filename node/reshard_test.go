@@ -0,0 +1,198 @@
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
+	"github.com/absolute8511/ZanRedisDB/stats"
+	"github.com/absolute8511/ZanRedisDB/transport/rafthttp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func findReshardTestKey(t *testing.T, expandNum int, pid int) []byte {
+	for i := 0; i < 10000; i++ {
+		pk := []byte(fmt.Sprintf("test:key%d", i))
+		if GetHashedPartitionID(pk, expandNum) == pid {
+			return pk
+		}
+	}
+	t.Fatalf("no key found for partition %v", pid)
+	return nil
+}
+
+func TestReshardKeyMovingOut(t *testing.T) {
+	stay := findReshardTestKey(t, 4, 0)
+	moving := findReshardTestKey(t, 4, 2)
+
+	st := &reshardState{partitionNum: 2, expandNum: 4, state: common.ExpandStateCopying}
+	assert.False(t, st.isKeyMovingOut(stay, 0))
+	assert.True(t, st.isKeyMovingOut(moving, 0))
+	// the new partitions have nothing to move
+	assert.False(t, st.isKeyMovingOut(stay, 2))
+
+	st = &reshardState{partitionNum: 4, state: common.ExpandStateCleaning}
+	assert.False(t, st.isKeyMovingOut(stay, 0))
+	assert.True(t, st.isKeyMovingOut(moving, 0))
+	assert.False(t, st.isKeyMovingOut(moving, 2))
+
+	st = &reshardState{partitionNum: 4}
+	assert.False(t, st.isKeyMovingOut(moving, 0))
+
+	// all the keys in the merged partitions are moving
+	stay = findReshardTestKey(t, 4, 1)
+	moving = findReshardTestKey(t, 4, 3)
+	st = &reshardState{partitionNum: 4, expandNum: 2, state: common.ExpandStateSwitching}
+	assert.True(t, st.isMoving())
+	assert.True(t, st.isKeyMovingOut(moving, 3))
+	assert.False(t, st.isKeyMovingOut(stay, 1))
+	assert.True(t, st.isPartitionMovingOut(3))
+	assert.False(t, st.isPartitionMovingOut(1))
+}
+
+func TestReshardCheckWrite(t *testing.T) {
+	stay := findReshardTestKey(t, 4, 0)
+	moving := findReshardTestKey(t, 4, 2)
+	setCmd := func(pk []byte) []byte {
+		return buildCommand([][]byte{[]byte("set"), pk, []byte("v")}).Raw
+	}
+	delCmd := buildCommand([][]byte{[]byte("del"), moving}).Raw
+
+	r := newPartitionResharder(0)
+	assert.Nil(t, r.checkWrite(setCmd(moving)))
+
+	r.state.Store(&reshardState{partitionNum: 2, expandNum: 4, state: common.ExpandStateCopying})
+	assert.Nil(t, r.checkWrite(setCmd(moving)))
+
+	r.state.Store(&reshardState{partitionNum: 2, expandNum: 4, state: common.ExpandStateSwitching})
+	assert.Equal(t, ErrKeyMoving, r.checkWrite(setCmd(moving)))
+	assert.Equal(t, ErrKeyMoving, r.checkWrite(delCmd))
+	assert.Nil(t, r.checkWrite(setCmd(stay)))
+
+	r.state.Store(&reshardState{partitionNum: 4, state: common.ExpandStateCleaning})
+	assert.Equal(t, ErrKeyMoving, r.checkWrite(setCmd(moving)))
+	assert.Nil(t, r.checkWrite(delCmd))
+	assert.Nil(t, r.checkWrite(setCmd(stay)))
+}
+
+// getTestReshardNodes start the two partitions of the namespace on the same node
+func getTestReshardNodes(t *testing.T) (*KVNode, *KVNode, func()) {
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("reshard-test-%d", time.Now().UnixNano()))
+	assert.Nil(t, err)
+	raftAddr := "http://127.0.0.1:12346"
+	ts := &stats.TransportStats{}
+	ts.Initialize()
+	raftTransport := &rafthttp.Transport{
+		DialTimeout: time.Second * 5,
+		ClusterID:   "test",
+		TrStats:     ts,
+		PeersStats:  stats.NewPeersStats(),
+	}
+	mconf := &MachineConfig{
+		BroadcastAddr: "127.0.0.1",
+		LocalRaftAddr: raftAddr,
+		DataRootDir:   tmpDir,
+		TickMs:        100,
+		ElectionTick:  5,
+	}
+	nsMgr := NewNamespaceMgr(raftTransport, mconf)
+	var nodes []*KVNode
+	for pid := 0; pid < 2; pid++ {
+		var replica ReplicaInfo
+		replica.NodeID = 1
+		replica.ReplicaID = 1
+		replica.RaftAddr = raftAddr
+		nsConf := NewNSConfig()
+		nsConf.Name = common.GetNsDesp("default", pid)
+		nsConf.BaseName = "default"
+		nsConf.EngType = rockredis.EngType
+		nsConf.PartitionNum = 2
+		nsConf.Replicator = 1
+		nsConf.RaftGroupConf.GroupID = uint64(2000 + pid)
+		nsConf.RaftGroupConf.SeedNodes = append(nsConf.RaftGroupConf.SeedNodes, replica)
+		nsConf.ExpirationPolicy = "consistency_deletion"
+		n, err := nsMgr.InitNamespaceNode(nsConf, 1, false)
+		if err != nil {
+			t.Fatalf("failed to init namespace: %v", err)
+		}
+		nodes = append(nodes, n.Node)
+	}
+	raftTransport.Raft = nodes[0]
+	raftTransport.Snapshotter = nodes[0]
+	raftTransport.Start()
+	u, err := url.Parse(raftAddr)
+	assert.Nil(t, err)
+	stopC := make(chan struct{})
+	ln, err := common.NewStoppableListener(u.Host, stopC)
+	assert.Nil(t, err)
+	go func() {
+		(&http.Server{Handler: raftTransport.Handler()}).Serve(ln)
+	}()
+	nsMgr.Start()
+	time.Sleep(time.Second * 3)
+	return nodes[0], nodes[1], func() {
+		nsMgr.Stop()
+		close(stopC)
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestReshardMoveReplaceAfterRestart(t *testing.T) {
+	src, dst, cleanup := getTestReshardNodes(t)
+	defer cleanup()
+	moving := findReshardTestKey(t, 2, 1)
+	_, err := src.Propose(buildCommand([][]byte{[]byte("hmset"), moving,
+		[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}).Raw)
+	assert.Nil(t, err)
+	st := &reshardState{partitionNum: 1, expandNum: 2, state: common.ExpandStateCopying}
+	target := func(pid int) *KVNode {
+		if pid == 1 {
+			return dst
+		}
+		return nil
+	}
+	runMove := func() {
+		src.reshard.state.Store(st)
+		src.reshard.begin(st)
+		stopC := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- src.reshardMove(st, target, rate.NewLimiter(rate.Inf, 1), stopC)
+		}()
+		start := time.Now()
+		for !src.GetReshardStatus().Done {
+			if time.Since(start) > time.Second*10 {
+				t.Fatalf("reshard copy timeout: %v", src.GetReshardStatus())
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		close(stopC)
+		assert.Equal(t, errReshardAborted, <-done)
+		src.reshard.end(nil)
+	}
+	runMove()
+	n, err := dst.store.HLen(moving)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the field removed before the migration restarted should be removed from the target
+	_, err = src.Propose(buildCommand([][]byte{[]byte("hdel"), moving, []byte("f2")}).Raw)
+	assert.Nil(t, err)
+	runMove()
+	n, err = dst.store.HLen(moving)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	v, err := dst.store.HGet(moving, []byte("f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v))
+	v, err = dst.store.HGet(moving, []byte("f2"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
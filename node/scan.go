@@ -2,6 +2,7 @@ package node
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,6 +12,15 @@ import (
 )
 
 func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err error) {
+	var dataType string
+	cursor, match, dataType, count, err = parseScanArgsWithType(args)
+	if err == nil && dataType != "" {
+		err = fmt.Errorf("invalid argument type")
+	}
+	return
+}
+
+func parseScanArgsWithType(args [][]byte) (cursor []byte, match string, dataType string, count int, err error) {
 	if len(args) == 0 {
 		return
 	}
@@ -38,6 +48,13 @@ func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err e
 				return
 			}
 
+			i++
+		case "type":
+			if i+1 >= len(args) {
+				err = common.ErrInvalidArgs
+				return
+			}
+			dataType = string(args[i+1])
 			i++
 		default:
 			err = fmt.Errorf("invalid argument %s", args[i])
@@ -49,51 +66,60 @@ func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err e
 	return
 }
 
-// SCAN cursor [MATCH match] [COUNT count]
-// scan only kv type, cursor is table:key
+// convert the type name of the redis TYPE command or the ADVSCAN to the data type
+func parseScanDataType(t string) (common.DataType, error) {
+	switch strings.ToUpper(t) {
+	case "KV", "STRING":
+		return common.KV, nil
+	case "HASH":
+		return common.HASH, nil
+	case "LIST":
+		return common.LIST, nil
+	case "SET":
+		return common.SET, nil
+	case "ZSET":
+		return common.ZSET, nil
+	default:
+		return common.NONE, common.ErrInvalidScanType
+	}
+}
 
-// TODO: for scan we act like the prefix scan, if the prefix changed , we should stop scan
+// SCAN cursor [MATCH match] [COUNT count] [TYPE type]
+// cursor is table:key, the default type is kv and the scan will stop at the end of the table.
+// Like the redis scan, the COUNT is the number of keys examined, so the matched keys
+// may be less than COUNT even if the scan is not finished, and the scan is finished
+// only if the returned cursor is empty.
 func (nd *KVNode) scanCommand(cmd redcon.Command) (interface{}, error) {
 	args := cmd.Args[1:]
-	cursor, match, count, err := parseScanArgs(args)
+	cursor, match, typeName, count, err := parseScanArgsWithType(args)
 
 	if err != nil {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
+	dataType := common.KV
+	if typeName != "" {
+		dataType, err = parseScanDataType(typeName)
+		if err != nil {
+			return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
+		}
+	}
 
-	table, _, err := common.ExtractTable(cursor)
+	_, _, err = common.ExtractTable(cursor)
 	if err != nil {
 		return nil, common.ErrInvalidScanCursor
 	}
 
-	ay, err := nd.store.Scan(common.KV, cursor, count, match)
+	ay, next, err := nd.store.ScanTable(dataType, cursor, count, match)
 	if err != nil {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
-
-	var nextCursor []byte
-	length := len(ay)
-	if length < count || (count == 0 && length == 0) {
-		nextCursor = []byte("")
-	} else {
-		nextCursor = ay[len(ay)-1]
-	}
-
-	if length > 0 {
-		item := ay[length-1]
-		tab, _, err := common.ExtractTable(item)
-		if err == nil && !bytes.Equal(tab, table) {
-
-			nextCursor = []byte("")
-			for idx, v := range ay {
-
-				tab, _, err := common.ExtractTable(v)
-				if err != nil || !bytes.Equal(tab, table) {
-					nextCursor = []byte("")
-					ay = ay[:idx]
-					break
-				}
-			}
+	// the table will be added while decoding the merged cursor, so only the key
+	// without table should be returned as the cursor of the partition
+	nextCursor := []byte("")
+	if next != nil {
+		_, rk, err := common.ExtractTable(next)
+		if err == nil {
+			nextCursor = rk
 		}
 	}
 
@@ -111,20 +137,9 @@ func (nd *KVNode) advanceScanCommand(cmd redcon.Command) (interface{}, error) {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: common.ErrInvalidArgs}, common.ErrInvalidArgs
 	}
 
-	var dataType common.DataType
-	switch strings.ToUpper(string(cmd.Args[2])) {
-	case "KV":
-		dataType = common.KV
-	case "HASH":
-		dataType = common.HASH
-	case "LIST":
-		dataType = common.LIST
-	case "SET":
-		dataType = common.SET
-	case "ZSET":
-		dataType = common.ZSET
-	default:
-		return &common.ScanResult{Keys: nil, NextCursor: nil, Error: common.ErrInvalidScanType}, common.ErrInvalidScanType
+	dataType, err := parseScanDataType(string(cmd.Args[2]))
+	if err != nil {
+		return &common.ScanResult{Keys: nil, NextCursor: nil, Error: err}, err
 	}
 	_, key, err := common.ExtractNamesapce(cmd.Args[1])
 	if err != nil {
@@ -138,127 +153,99 @@ func (nd *KVNode) advanceScanCommand(cmd redcon.Command) (interface{}, error) {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
 
-	table, _, err := common.ExtractTable(cursor)
+	_, _, err = common.ExtractTable(cursor)
 	if err != nil {
 		return nil, common.ErrInvalidScanCursor
 	}
 
-	var ay [][]byte
-
-	ay, err = nd.store.Scan(dataType, cursor, count, match)
-
+	ay, next, err := nd.store.ScanTable(dataType, cursor, count, match)
 	if err != nil {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
 
-	var nextCursor []byte
-
-	length := len(ay)
-	if length < count || (count == 0 && length == 0) {
-		nextCursor = []byte("")
-	} else {
-		item := ay[len(ay)-1]
-		_, rk, err := common.ExtractTable(item)
-		if err != nil {
-			nextCursor = []byte("")
-		} else {
+	nextCursor := []byte("")
+	if next != nil {
+		_, rk, err := common.ExtractTable(next)
+		if err == nil {
 			nextCursor = rk
 		}
 	}
-
-	if length > 0 {
-		item := ay[length-1]
-		tab, _, err := common.ExtractTable(item)
-		if err == nil && !bytes.Equal(tab, table) {
-			nextCursor = []byte("")
-			for idx, v := range ay {
-
-				tab, _, err := common.ExtractTable(v)
-				if err != nil || !bytes.Equal(tab, table) {
-					ay = ay[:idx]
-					break
-				}
-			}
-		}
-	}
 	_, pid := common.GetNamespaceAndPartition(nd.ns)
 	return &common.ScanResult{Keys: ay, NextCursor: nextCursor, PartionId: strconv.Itoa(pid), Error: nil}, nil
 }
 
-// HSCAN key cursor [MATCH match] [COUNT count]
-// key is (table:key)
-func (nd *KVNode) hscanCommand(conn redcon.Conn, cmd redcon.Command) {
-	// the cursor can be nil means scan from start of the hash
+// parse the args of the HSCAN, SSCAN and ZSCAN, the member to resume the scan after
+// will be decoded from the cursor.
+func parseCollectionScanArgs(cmd redcon.Command) (key []byte, member []byte, match string, count int, err error) {
+	// the cursor can be empty means scan from start of the collection
 	if len(cmd.Args) < 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		err = errors.New(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
-	args := cmd.Args[1:]
-	key := args[0]
-	cursor, match, count, err := parseScanArgs(args[1:])
-
+	key = cmd.Args[1]
+	var cursor []byte
+	cursor, match, count, err = parseScanArgs(cmd.Args[2:])
 	if err != nil {
-		conn.WriteError(err.Error())
 		return
 	}
+	member, err = common.DecodeCollectionScanCursor(cursor)
+	return
+}
 
-	var ay []common.KVRecord
+// the next cursor is the resume token of the last examined member, and the empty
+// cursor means the scan is finished.
+func encodeCollectionNextCursor(next []byte) []byte {
+	if next == nil {
+		return []byte("")
+	}
+	return common.EncodeCollectionScanCursor(next)
+}
 
-	ay, err = nd.store.HScan(key, cursor, count, match)
+// HSCAN key cursor [MATCH match] [COUNT count]
+// key is (table:key), the cursor is empty or "0" to start the scan and the next cursor
+// returned should be used to resume. Like the SCAN, the COUNT is the number of the fields
+// examined and the MATCH is filtered in server, so the matched fields may be less than
+// COUNT even if the scan is not finished, and the scan is finished only if the returned
+// cursor is empty. The fields exist during the whole scan will be returned exactly once.
+func (nd *KVNode) hscanCommand(conn redcon.Conn, cmd redcon.Command) {
+	key, cursor, match, count, err := parseCollectionScanArgs(cmd)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
 
-	var nextCursor []byte
-	if len(ay) < count || (count == 0 && len(ay) == 0) {
-		nextCursor = []byte("")
-	} else {
-		nextCursor = ay[len(ay)-1].Key
+	ay, next, err := nd.store.HScan(key, cursor, count, match)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
 	}
 
 	conn.WriteArray(2)
-	conn.WriteBulk(nextCursor)
+	conn.WriteBulk(encodeCollectionNextCursor(next))
 	conn.WriteArray(len(ay) * 2)
 	for _, v := range ay {
 		conn.WriteBulk(v.Key)
 		conn.WriteBulk(v.Value)
 	}
-	return
 }
 
-//SSCAN key cursor [MATCH match] [COUNT count]
-// key is (table:key)
+// SSCAN key cursor [MATCH match] [COUNT count]
+// key is (table:key), the cursor is same as the HSCAN
 func (nd *KVNode) sscanCommand(conn redcon.Conn, cmd redcon.Command) {
-	if len(cmd.Args) < 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-		return
-	}
-	args := cmd.Args[1:]
-	key := args[0]
-
-	cursor, match, count, err := parseScanArgs(args[1:])
-
+	key, cursor, match, count, err := parseCollectionScanArgs(cmd)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
 
-	var ay [][]byte
-	ay, err = nd.store.SScan(key, cursor, count, match)
+	ay, next, err := nd.store.SScan(key, cursor, count, match)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
-	var nextCursor []byte
-	if len(ay) < count || (count == 0 && len(ay) == 0) {
-		nextCursor = []byte("")
-	} else {
-		nextCursor = ay[len(ay)-1]
-	}
 
 	conn.WriteArray(2)
-	conn.WriteBulk(nextCursor)
+	conn.WriteBulk(encodeCollectionNextCursor(next))
 	conn.WriteArray(len(ay))
 	for _, v := range ay {
 		conn.WriteBulk(v)
@@ -266,52 +253,28 @@ func (nd *KVNode) sscanCommand(conn redcon.Conn, cmd redcon.Command) {
 }
 
 // ZSCAN key cursor [MATCH match] [COUNT count]
-// key is (table:key)
+// key is (table:key), the cursor is same as the HSCAN and the members are scanned in
+// the lexicographical order.
 func (nd *KVNode) zscanCommand(conn redcon.Conn, cmd redcon.Command) {
-	if len(cmd.Args) < 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
-		return
-	}
-	args := cmd.Args[1:]
-	key := args[0]
-
-	cursor, match, count, err := parseScanArgs(args[1:])
-
+	key, cursor, match, count, err := parseCollectionScanArgs(cmd)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
 
-	var ay []common.ScorePair
-
-	ay, err = nd.store.ZScan(key, cursor, count, match)
-
+	ay, next, err := nd.store.ZScan(key, cursor, count, match)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
 
-	vv := make([][]byte, 0, len(ay)*2)
-
-	for _, v := range ay {
-		vv = append(vv, v.Member)
-	}
-
-	var nextCursor []byte
-	if len(ay) < count || (count == 0 && len(ay) == 0) {
-		nextCursor = []byte("")
-	} else {
-		nextCursor = ay[len(ay)-1].Member
-	}
-
 	conn.WriteArray(2)
-	conn.WriteBulk(nextCursor)
+	conn.WriteBulk(encodeCollectionNextCursor(next))
 	conn.WriteArray(len(ay) * 2)
 	for _, v := range ay {
 		conn.WriteBulk(v.Member)
 		conn.WriteBulk([]byte(strconv.FormatFloat(v.Score, 'g', -1, 64)))
 	}
-	return
 }
 
 // fullScan cursor type [MATCH match] [COUNT count]
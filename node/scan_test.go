@@ -20,6 +20,7 @@ func TestKVNode_scanCommand(t *testing.T) {
 		{"zscan", buildCommand([][]byte{[]byte("zscan"), testKey, []byte("")})},
 		{"scan", buildCommand([][]byte{[]byte("scan"), testKey})},
 		{"scan", buildCommand([][]byte{[]byte("scan"), testKey, []byte("match"), []byte("test"), []byte("count"), []byte("1")})},
+		{"scan", buildCommand([][]byte{[]byte("scan"), testKey, []byte("match"), []byte("test"), []byte("count"), []byte("1"), []byte("type"), []byte("hash")})},
 		{"advscan", buildCommand([][]byte{[]byte("advscan"), testKey, []byte("kv")})},
 		{"advscan", buildCommand([][]byte{[]byte("advscan"), testKey, []byte("hash")})},
 		{"advscan", buildCommand([][]byte{[]byte("advscan"), testKey, []byte("list")})},
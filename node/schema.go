@@ -34,6 +34,32 @@ func (kvsm *kvStoreSM) handleSchemaUpdate(sc SchemaChange) error {
 			err = kvsm.store.UpdateHsetIndexState(sc.Table, &hindex)
 		}
 		return err
+	case SchemaChangeDropTable:
+		return kvsm.store.DropTable(sc.Table)
+	case SchemaChangeValueCompression:
+		var vc common.ValueCompressSchema
+		err := json.Unmarshal(sc.SchemaData, &vc)
+		if err != nil {
+			return err
+		}
+		return kvsm.store.SetTableValueCompress(sc.Table, &vc)
+	case SchemaChangeZsetScoreIndex:
+		var zi common.ZsetScoreIndexSchema
+		err := json.Unmarshal(sc.SchemaData, &zi)
+		if err != nil {
+			return err
+		}
+		return kvsm.store.SetTableZsetScoreIndex(sc.Table, &zi)
+	case SchemaChangeAddFullTextIndex, SchemaChangeDeleteFullTextIndex:
+		var ft common.FullTextIndexSchema
+		err := json.Unmarshal(sc.SchemaData, &ft)
+		if err != nil {
+			return err
+		}
+		if sc.Type == SchemaChangeAddFullTextIndex {
+			return kvsm.store.AddFullTextIndex(sc.Table, &ft)
+		}
+		return kvsm.store.DelFullTextIndex(sc.Table, ft.Name)
 	default:
 		return errors.New("unknown schema change type")
 	}
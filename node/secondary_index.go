@@ -15,6 +15,16 @@ type HindexSearchResults struct {
 	Rets  []common.HIndexRespWithValues
 }
 
+type ZindexSearchResults struct {
+	Table string
+	Rets  []rockredis.ZIndexResp
+}
+
+type FullTextSearchResults struct {
+	Table string
+	Rets  []rockredis.FTSearchResp
+}
+
 func parseSingleCond(condData []byte, indexCond *rockredis.IndexCondition) ([]byte, error) {
 	condData = bytes.TrimSpace(condData)
 	var field []byte
@@ -50,30 +60,70 @@ func parseSingleCond(condData []byte, indexCond *rockredis.IndexCondition) ([]by
 }
 
 // TODO: handle string index value which may contains ">, =, <, and" words
+// The conditions on different fields are used for the composite index, all the fields
+// except the last one should be equal condition, such as "field1 = 1 and field2 > 2 and field2 < 5".
+// The returned field will be all the fields joined by comma for the composite index.
 func parseIndexQueryWhere(whereData []byte) ([]byte, *rockredis.IndexCondition, error) {
 	whereData = bytes.Trim(whereData, "\"")
-	andConds := bytes.SplitN(whereData, []byte("and"), 2)
-	if len(andConds) != 1 && len(andConds) != 2 {
-		return nil, nil, common.ErrInvalidArgs
-	}
+	andConds := bytes.Split(whereData, []byte("and"))
 	indexCond := &rockredis.IndexCondition{
 		Offset: 0,
 		Limit:  -1,
 	}
-	field, err := parseSingleCond(andConds[0], indexCond)
-	if err != nil {
-		return nil, nil, err
-	}
-	if len(andConds) == 2 {
-		field2, err := parseSingleCond(andConds[1], indexCond)
+	fields := make([][]byte, 0, len(andConds))
+	for _, c := range andConds {
+		var fieldCond rockredis.IndexCondition
+		field, err := parseSingleCond(c, &fieldCond)
 		if err != nil {
 			return nil, nil, err
 		}
-		if !bytes.Equal(field, field2) {
-			return nil, nil, common.ErrInvalidArgs
+		field = bytes.TrimSpace(field)
+		if len(fields) == 0 || !bytes.Equal(fields[len(fields)-1], field) {
+			for _, f := range fields {
+				if bytes.Equal(f, field) {
+					return nil, nil, common.ErrInvalidArgs
+				}
+			}
+			if len(fields) > 0 {
+				// the previous field become the leading field which should be equal
+				if indexCond.StartKey == nil || !indexCond.IncludeStart || !indexCond.IncludeEnd ||
+					!bytes.Equal(indexCond.StartKey, indexCond.EndKey) {
+					return nil, nil, common.ErrInvalidArgs
+				}
+				indexCond.PrefixValues = append(indexCond.PrefixValues, indexCond.StartKey)
+				indexCond.StartKey = nil
+				indexCond.IncludeStart = false
+				indexCond.EndKey = nil
+				indexCond.IncludeEnd = false
+			}
+			fields = append(fields, field)
+		}
+		if fieldCond.StartKey != nil {
+			indexCond.StartKey = fieldCond.StartKey
+			indexCond.IncludeStart = fieldCond.IncludeStart
+		}
+		if fieldCond.EndKey != nil {
+			indexCond.EndKey = fieldCond.EndKey
+			indexCond.IncludeEnd = fieldCond.IncludeEnd
 		}
 	}
-	return field, indexCond, nil
+	return bytes.Join(fields, []byte(",")), indexCond, nil
+}
+
+// parse the ORDER BY {ASC|DESC} and return whether the order is descending
+func parseIndexQueryOrder(args [][]byte) (bool, error) {
+	if len(args) < 3 || strings.ToLower(string(args[0])) != "order" ||
+		strings.ToLower(string(args[1])) != "by" {
+		return false, common.ErrInvalidArgs
+	}
+	switch strings.ToLower(string(args[2])) {
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, common.ErrInvalidArgs
+	}
 }
 
 func parseIndexQueryLimit(args [][]byte) (int, int, error) {
@@ -92,9 +142,9 @@ func parseIndexQueryLimit(args [][]byte) (int, int, error) {
 	return offset, count, nil
 }
 
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [ORDER BY ASC|DESC] [LIMIT offset num] [HGET $ field2]
 // HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] HGETALL $
-// HIDX.FROM {namespace:table} WHERE {WHERE clause} [LIMIT offset num] [ANY HASH REDIS COMMAND]
+// HIDX.FROM {namespace:table} WHERE {WHERE clause} [ORDER BY ASC|DESC] [LIMIT offset num] [ANY HASH REDIS COMMAND]
 // handle (xx and xx) or (xx and xx), get the min and max range and iterator in the possible range,
 // match all the conditions to decide whether the cursor should be returned
 func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
@@ -116,6 +166,14 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 		return nil, err
 	}
 	args := cmd.Args[4:]
+	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("order")) {
+		reverse, err := parseIndexQueryOrder(args)
+		if err != nil {
+			return nil, err
+		}
+		cond.Reverse = reverse
+		args = args[3:]
+	}
 	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("limit")) {
 		offset, count, err := parseIndexQueryLimit(args)
 		if err != nil {
@@ -125,6 +183,15 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 		cond.Limit = count
 		args = args[3:]
 	}
+	// the fields will be returned with the search result, which may be covered by the index
+	if len(args) >= 3 {
+		switch string(args[0]) {
+		case "hget":
+			cond.Fields = args[2:3]
+		case "hmget":
+			cond.Fields = args[2:]
+		}
+	}
 	nd.rn.Debugf("table %v parsing where condition result: %v, field: %v", string(table), cond, string(field))
 	vt, _, pkList, err := nd.store.HsetIndexSearch(table, field, cond, false)
 	if err != nil {
@@ -140,34 +207,16 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 		}
 		cmdName := string(postCmdArgs[0])
 		switch cmdName {
-		case "hget":
-			if len(postCmdArgs) < 3 {
-				return nil, common.ErrInvalidArgs
-			}
-			for _, pk := range pkList {
-				v, err := nd.store.HGet(pk.PKey, postCmdArgs[2])
-				if err != nil {
-					continue
-				}
-				vv := [][]byte{v}
-				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vv}
-				if vt == rockredis.Int64V || vt == rockredis.Int32V {
-					rspV.IndexV = pk.IndexIntValue
-				}
-				rets = append(rets, rspV)
-			}
-		case "hmget":
+		case "hget", "hmget":
 			if len(postCmdArgs) < 3 {
 				return nil, common.ErrInvalidArgs
 			}
 			for _, pk := range pkList {
-				vals, err := nd.store.HMget(pk.PKey, postCmdArgs[2:]...)
-				if err != nil {
-					continue
-				}
-				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vals}
+				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: pk.FieldValues}
 				if vt == rockredis.Int64V || vt == rockredis.Int32V {
 					rspV.IndexV = pk.IndexIntValue
+				} else if vt == rockredis.Float64V {
+					rspV.IndexV = pk.IndexFloatValue
 				}
 				rets = append(rets, rspV)
 			}
@@ -184,6 +233,8 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vv}
 				if vt == rockredis.Int64V || vt == rockredis.Int32V {
 					rspV.IndexV = pk.IndexIntValue
+				} else if vt == rockredis.Float64V {
+					rspV.IndexV = pk.IndexFloatValue
 				}
 				rets = append(rets, rspV)
 			}
@@ -196,9 +247,67 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 			rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue}
 			if vt == rockredis.Int64V || vt == rockredis.Int32V {
 				rspV.IndexV = pk.IndexIntValue
+			} else if vt == rockredis.Float64V {
+				rspV.IndexV = pk.IndexFloatValue
 			}
 			rets = append(rets, rspV)
 		}
 		return &HindexSearchResults{Table: string(table), Rets: rets}, nil
 	}
 }
+
+// ZIDX.FROM ns:table member min max [LIMIT offset num]
+// search all the keys in the table having the zset member with the score in the range
+func (nd *KVNode) zindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 5 {
+		return nil, common.ErrInvalidArgs
+	}
+	_, table, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	min, max, err := getScoreRange(cmd.Args[3], cmd.Args[4])
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	count := -1
+	if len(cmd.Args) > 5 {
+		offset, count, err = parseIndexQueryLimit(cmd.Args[5:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	rets, err := nd.store.ZsetScoreIndexSearch(table, cmd.Args[2], min, max, offset, count)
+	if err != nil {
+		nd.rn.Infof("search zset score index %v, %v error: %v", string(table), string(cmd.Args[2]), err)
+		return nil, err
+	}
+	return &ZindexSearchResults{Table: string(table), Rets: rets}, nil
+}
+
+// FT.SEARCH ns:table index "term1 prefix*" [LIMIT offset num]
+// search the keys matched all the terms in the full text index, ranked by the score
+func (nd *KVNode) fullTextSearchCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 4 {
+		return nil, common.ErrInvalidArgs
+	}
+	_, table, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	count := -1
+	if len(cmd.Args) > 4 {
+		offset, count, err = parseIndexQueryLimit(cmd.Args[4:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	rets, err := nd.store.FullTextIndexSearch(table, string(cmd.Args[2]), string(cmd.Args[3]), offset, count)
+	if err != nil {
+		nd.rn.Infof("full text search %v, %v error: %v", string(table), string(cmd.Args[2]), err)
+		return nil, err
+	}
+	return &FullTextSearchResults{Table: string(table), Rets: rets}, nil
+}
@@ -3,6 +3,7 @@ package node
 import (
 	"strconv"
 
+	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/absolute8511/redcon"
 )
 
@@ -48,7 +49,7 @@ func (nd *KVNode) saddCommand(conn redcon.Conn, cmd redcon.Command, v interface{
 
 func (nd *KVNode) spopCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 2 && len(cmd.Args) != 3 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	hasCount := len(cmd.Args) == 3
@@ -0,0 +1,185 @@
+package node
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	defaultSlowLogMaxLen = 128
+	// the arguments of the command will be truncated in slow log to
+	// avoid using too much memory for the big command
+	maxSlowLogArgNum = 32
+	maxSlowLogArgLen = 128
+)
+
+const defaultSlowLogThreshold = 10 * time.Millisecond
+
+// the commands cost more than the threshold (in microseconds) will be recorded into the slow log,
+// the slow log will be disabled if the threshold is negative.
+var slowLogThresholdUs int64 = int64(defaultSlowLogThreshold / time.Microsecond)
+
+func init() {
+	common.RegisterDynamicConfApplier(common.DynConfSlowLogThresholdUs, func(v string) error {
+		if v == "" {
+			SetSlowLogThreshold(defaultSlowLogThreshold)
+			return nil
+		}
+		us, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		SetSlowLogThreshold(time.Duration(us) * time.Microsecond)
+		return nil
+	})
+}
+
+func SetSlowLogThreshold(d time.Duration) {
+	us := int64(d / time.Microsecond)
+	if d < 0 {
+		us = -1
+	}
+	atomic.StoreInt64(&slowLogThresholdUs, us)
+}
+
+func GetSlowLogThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&slowLogThresholdUs)) * time.Microsecond
+}
+
+func isSlowCommand(cost time.Duration) bool {
+	threshold := atomic.LoadInt64(&slowLogThresholdUs)
+	return threshold >= 0 && int64(cost/time.Microsecond) >= threshold
+}
+
+type SlowLogEntry struct {
+	ID int64 `json:"id"`
+	// unix time in seconds while the command finished
+	Timestamp int64 `json:"timestamp"`
+	// the total cost in microseconds
+	Cost int64 `json:"cost"`
+	// for write command, the total cost is split into the cost from
+	// proposing to applying and the cost of applying to the db
+	ProposeCost int64    `json:"propose_cost"`
+	ApplyCost   int64    `json:"apply_cost"`
+	IsWrite     bool     `json:"is_write"`
+	Args        [][]byte `json:"args"`
+}
+
+// SlowLog keep the recent slow commands in a ring buffer
+type SlowLog struct {
+	sync.Mutex
+	nextID  int64
+	entries []SlowLogEntry
+	// the position for the next entry
+	pos    int
+	maxLen int
+}
+
+func NewSlowLog(maxLen int) *SlowLog {
+	if maxLen <= 0 {
+		maxLen = defaultSlowLogMaxLen
+	}
+	return &SlowLog{
+		entries: make([]SlowLogEntry, 0, maxLen),
+		maxLen:  maxLen,
+	}
+}
+
+func copySlowLogArgs(args [][]byte) [][]byte {
+	n := len(args)
+	if n > maxSlowLogArgNum {
+		n = maxSlowLogArgNum
+	}
+	copied := make([][]byte, 0, n+1)
+	for _, arg := range args[:n] {
+		if len(arg) > maxSlowLogArgLen {
+			v := make([]byte, 0, maxSlowLogArgLen+16)
+			v = append(v, arg[:maxSlowLogArgLen]...)
+			v = append(v, []byte("...(truncated)")...)
+			copied = append(copied, v)
+		} else {
+			copied = append(copied, append([]byte(nil), arg...))
+		}
+	}
+	if n < len(args) {
+		copied = append(copied, []byte("...(more arguments)"))
+	}
+	return copied
+}
+
+// RecordRead record the read command if it is slow
+func (sl *SlowLog) RecordRead(args [][]byte, cost time.Duration) {
+	if sl == nil || !isSlowCommand(cost) {
+		return
+	}
+	sl.add(SlowLogEntry{
+		Cost: int64(cost / time.Microsecond),
+		Args: copySlowLogArgs(args),
+	})
+}
+
+// RecordWrite record the write command if it is slow, the propose cost is the
+// time from the command proposed to the command began to apply.
+func (sl *SlowLog) RecordWrite(args [][]byte, proposeCost time.Duration, applyCost time.Duration) {
+	if proposeCost < 0 {
+		proposeCost = 0
+	}
+	cost := proposeCost + applyCost
+	if sl == nil || !isSlowCommand(cost) {
+		return
+	}
+	sl.add(SlowLogEntry{
+		Cost:        int64(cost / time.Microsecond),
+		ProposeCost: int64(proposeCost / time.Microsecond),
+		ApplyCost:   int64(applyCost / time.Microsecond),
+		IsWrite:     true,
+		Args:        copySlowLogArgs(args),
+	})
+}
+
+func (sl *SlowLog) add(e SlowLogEntry) {
+	e.Timestamp = time.Now().Unix()
+	sl.Lock()
+	e.ID = sl.nextID
+	sl.nextID++
+	if len(sl.entries) < sl.maxLen {
+		sl.entries = append(sl.entries, e)
+	} else {
+		sl.entries[sl.pos] = e
+	}
+	sl.pos = (sl.pos + 1) % sl.maxLen
+	sl.Unlock()
+}
+
+// Get return at most n recent slow entries, the newest first.
+// All entries will be returned if n is negative.
+func (sl *SlowLog) Get(n int) []SlowLogEntry {
+	sl.Lock()
+	defer sl.Unlock()
+	if n < 0 || n > len(sl.entries) {
+		n = len(sl.entries)
+	}
+	rets := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (sl.pos - i + sl.maxLen) % sl.maxLen
+		rets = append(rets, sl.entries[idx])
+	}
+	return rets
+}
+
+func (sl *SlowLog) Len() int {
+	sl.Lock()
+	defer sl.Unlock()
+	return len(sl.entries)
+}
+
+func (sl *SlowLog) Reset() {
+	sl.Lock()
+	sl.entries = sl.entries[:0]
+	sl.pos = 0
+	sl.Unlock()
+}
@@ -0,0 +1,47 @@
+package node
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLogRing(t *testing.T) {
+	old := GetSlowLogThreshold()
+	defer SetSlowLogThreshold(old)
+	SetSlowLogThreshold(time.Millisecond)
+
+	sl := NewSlowLog(3)
+	sl.RecordRead([][]byte{[]byte("get"), []byte("fast")}, time.Microsecond)
+	assert.Equal(t, 0, sl.Len())
+	for i := 0; i < 5; i++ {
+		sl.RecordWrite([][]byte{[]byte("set"), []byte(strconv.Itoa(i))}, time.Millisecond, time.Millisecond)
+	}
+	assert.Equal(t, 3, sl.Len())
+	entries := sl.Get(-1)
+	assert.Equal(t, 3, len(entries))
+	// newest first
+	assert.Equal(t, int64(4), entries[0].ID)
+	assert.Equal(t, "4", string(entries[0].Args[1]))
+	assert.Equal(t, int64(2), entries[2].ID)
+	assert.True(t, entries[0].IsWrite)
+	assert.Equal(t, int64(1000), entries[0].ProposeCost)
+	assert.Equal(t, int64(2000), entries[0].Cost)
+	assert.Equal(t, 1, len(sl.Get(1)))
+
+	bigArg := make([]byte, maxSlowLogArgLen*2)
+	sl.RecordRead([][]byte{[]byte("get"), bigArg}, time.Second)
+	entries = sl.Get(1)
+	assert.False(t, entries[0].IsWrite)
+	assert.True(t, len(entries[0].Args[1]) < len(bigArg))
+
+	sl.Reset()
+	assert.Equal(t, 0, sl.Len())
+	assert.Equal(t, 0, len(sl.Get(10)))
+
+	SetSlowLogThreshold(-1)
+	sl.RecordRead([][]byte{[]byte("get")}, time.Second)
+	assert.Equal(t, 0, sl.Len())
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -20,8 +22,10 @@ import (
 )
 
 const (
-	maxDBBatchCmdNum = 100
-	dbWriteSlow      = time.Millisecond * 200
+	minDBBatchCmdNum     = 10
+	defaultDBBatchCmdNum = 100
+	maxDBBatchCmdNum     = 1000
+	dbWriteSlow          = time.Millisecond * 200
 )
 
 // this error is used while the raft is applying the remote raft logs and notify we should
@@ -45,7 +49,7 @@ type StateMachine interface {
 
 func NewStateMachine(opts *KVOptions, machineConfig MachineConfig, localID uint64,
 	fullNS string, clusterInfo common.IClusterInfo, w wait.Wait) (StateMachine, error) {
-	if machineConfig.LearnerRole == "" {
+	if machineConfig.LearnerRole == "" || machineConfig.LearnerRole == common.LearnerRoleReadReplica {
 		if machineConfig.StateMachineType == "empty_sm" {
 			return &emptySM{w: w}, nil
 		}
@@ -62,6 +66,13 @@ func NewStateMachine(opts *KVOptions, machineConfig MachineConfig, localID uint6
 		}
 		lssm.w = w
 		return lssm, err
+	} else if machineConfig.LearnerRole == common.LearnerRoleKafkaSink {
+		kssm, err := NewKafkaSinkSM(opts, machineConfig, localID, fullNS, clusterInfo)
+		if err != nil {
+			return nil, err
+		}
+		kssm.w = w
+		return kssm, err
 	} else {
 		return nil, errors.New("unknown learner role")
 	}
@@ -113,17 +124,91 @@ func (esm *emptySM) CheckExpiredData(buffer common.ExpiredDataBuffer, stop chan
 }
 
 type kvStoreSM struct {
-	fullName      string
-	store         *KVStore
-	clusterInfo   common.IClusterInfo
-	fullNS        string
-	machineConfig MachineConfig
-	ID            uint64
-	dbWriteStats  common.WriteStats
-	w             wait.Wait
-	router        *common.SMCmdRouter
-	stopping      int32
-	cRouter       *conflictRouter
+	fullName       string
+	store          *KVStore
+	clusterInfo    common.IClusterInfo
+	fullNS         string
+	machineConfig  MachineConfig
+	ID             uint64
+	dbWriteStats   *common.WriteStats
+	w              wait.Wait
+	router         *common.SMCmdRouter
+	stopping       int32
+	cRouter        *conflictRouter
+	applyPool      *applyWorkerPool
+	batchLimit     adaptiveBatchLimit
+	clientSessions *clientSessionTable
+	slowLog        *SlowLog
+	checksums      *replicaChecksumTable
+}
+
+// the max commands in a db write batch, can be changed by the cluster dynamic config
+var dbBatchMaxCmdNum int32 = maxDBBatchCmdNum
+
+func init() {
+	common.RegisterDynamicConfApplier(common.DynConfDBBatchMaxCmdNum, func(v string) error {
+		if v == "" {
+			SetDBBatchMaxCmdNum(maxDBBatchCmdNum)
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		SetDBBatchMaxCmdNum(n)
+		return nil
+	})
+}
+
+// SetDBBatchMaxCmdNum change the max commands in a db write batch, the batch
+// limit will be adjusted under the max.
+func SetDBBatchMaxCmdNum(n int) {
+	if n < minDBBatchCmdNum {
+		n = minDBBatchCmdNum
+	}
+	atomic.StoreInt32(&dbBatchMaxCmdNum, int32(n))
+}
+
+// adaptiveBatchLimit adjust the max number of commands in a db write batch,
+// the batch will grow if the apply queue is piling up and the write latency is low,
+// and will shrink if the write latency is high.
+type adaptiveBatchLimit struct {
+	limit   int32
+	pending int32
+}
+
+func (bl *adaptiveBatchLimit) Get() int {
+	limit := atomic.LoadInt32(&bl.limit)
+	if limit <= 0 {
+		limit = defaultDBBatchCmdNum
+	}
+	if maxLimit := atomic.LoadInt32(&dbBatchMaxCmdNum); limit > maxLimit {
+		return int(maxLimit)
+	}
+	return int(limit)
+}
+
+// SetPending set the number of the raft logs waiting to be applied
+func (bl *adaptiveBatchLimit) SetPending(n int) {
+	atomic.StoreInt32(&bl.pending, int32(n))
+}
+
+func (bl *adaptiveBatchLimit) Update(batchNum int, cost time.Duration) {
+	limit := bl.Get()
+	if cost > dbWriteSlow/2 {
+		limit = limit / 2
+	} else if batchNum >= limit && atomic.LoadInt32(&bl.pending) > 0 {
+		limit = limit * 2
+	} else if atomic.LoadInt32(&bl.pending) == 0 && limit > defaultDBBatchCmdNum {
+		// restore slowly while idle
+		limit = limit - limit/10
+	}
+	if limit < minDBBatchCmdNum {
+		limit = minDBBatchCmdNum
+	} else if limit > int(atomic.LoadInt32(&dbBatchMaxCmdNum)) {
+		limit = int(atomic.LoadInt32(&dbBatchMaxCmdNum))
+	}
+	atomic.StoreInt32(&bl.limit, int32(limit))
 }
 
 func NewKVStoreSM(opts *KVOptions, machineConfig MachineConfig, localID uint64, ns string,
@@ -133,16 +218,22 @@ func NewKVStoreSM(opts *KVOptions, machineConfig MachineConfig, localID uint64,
 		return nil, err
 	}
 	sm := &kvStoreSM{
-		fullNS:        ns,
-		machineConfig: machineConfig,
-		ID:            localID,
-		clusterInfo:   clusterInfo,
-		store:         store,
-		router:        common.NewSMCmdRouter(),
-		cRouter:       NewConflictRouter(),
+		fullNS:         ns,
+		machineConfig:  machineConfig,
+		ID:             localID,
+		clusterInfo:    clusterInfo,
+		store:          store,
+		dbWriteStats:   &common.WriteStats{},
+		router:         common.NewSMCmdRouter(),
+		cRouter:        NewConflictRouter(),
+		clientSessions: newClientSessionTable(),
+		checksums:      newReplicaChecksumTable(),
 	}
 	sm.registerHandlers()
 	sm.registerConflictHandlers()
+	if machineConfig.ApplyWorkerNum > 1 {
+		sm.applyPool = newApplyWorkerPool(sm, machineConfig.ApplyWorkerNum)
+	}
 	return sm, nil
 }
 
@@ -162,6 +253,9 @@ func (kvsm *kvStoreSM) Errorf(f string, args ...interface{}) {
 }
 
 func (kvsm *kvStoreSM) Start() error {
+	if kvsm.applyPool != nil {
+		kvsm.applyPool.Start()
+	}
 	return nil
 }
 
@@ -169,6 +263,9 @@ func (kvsm *kvStoreSM) Close() {
 	if !atomic.CompareAndSwapInt32(&kvsm.stopping, 0, 1) {
 		return
 	}
+	if kvsm.applyPool != nil {
+		kvsm.applyPool.Stop()
+	}
 	kvsm.store.Close()
 }
 
@@ -185,10 +282,28 @@ func (kvsm *kvStoreSM) GetDBInternalStats() string {
 }
 
 func (kvsm *kvStoreSM) GetStats() common.NamespaceStats {
-	tbs := kvsm.store.GetTables()
 	var ns common.NamespaceStats
 	ns.InternalStats = kvsm.store.GetInternalStatus()
 	ns.DBWriteStats = kvsm.dbWriteStats.Copy()
+	ns.TStats = kvsm.GetTableStats("")
+	return ns
+}
+
+// GetTableStats return the key count from the table counter and the disk usage estimated
+// by the db of the table, all the tables will be returned if the table is empty. The
+// approximate key number is used if the table counter is not available.
+func (kvsm *kvStoreSM) GetTableStats(table string) []common.TableStats {
+	tbs := kvsm.store.GetTables()
+	if table != "" {
+		filtered := tbs[:0]
+		for _, t := range tbs {
+			if string(t) == table {
+				filtered = append(filtered, t)
+			}
+		}
+		tbs = filtered
+	}
+	var tStats []common.TableStats
 	diskUsages := kvsm.store.GetBTablesSizes(tbs)
 	for i, t := range tbs {
 		cnt, _ := kvsm.store.GetTableKeyCount(t)
@@ -200,10 +315,24 @@ func (kvsm *kvStoreSM) GetStats() common.NamespaceStats {
 		ts.Name = string(t)
 		ts.KeyNum = cnt
 		ts.DiskBytesUsage = diskUsages[i]
-		ns.TStats = append(ns.TStats, ts)
+		tStats = append(tStats, ts)
 	}
+	return tStats
+}
 
-	return ns
+// GetUsage return the approximate key count and the data size of all the tables
+func (kvsm *kvStoreSM) GetUsage() (int64, int64) {
+	tbs := kvsm.store.GetTables()
+	var keys, bytes int64
+	for i, size := range kvsm.store.GetBTablesSizes(tbs) {
+		cnt, _ := kvsm.store.GetTableKeyCount(tbs[i])
+		if cnt <= 0 {
+			cnt = kvsm.store.GetTableApproximateNumInRange(string(tbs[i]), nil, nil)
+		}
+		keys += cnt
+		bytes += size
+	}
+	return keys, bytes
 }
 
 func (kvsm *kvStoreSM) CleanData() error {
@@ -226,6 +355,8 @@ func (kvsm *kvStoreSM) GetSnapshot(term uint64, index uint64) (*KVSnapInfo, erro
 		return nil, errors.New("failed to begin backup: maybe too much backup running")
 	}
 	si.WaitReady()
+	// the snapshot is got in the apply loop, so the sessions are the same as the data applied
+	si.ClientSessions = kvsm.clientSessions.GetStates()
 	return &si, nil
 }
 
@@ -262,14 +393,23 @@ func prepareSnapshotForStore(store *KVStore, machineConfig MachineConfig,
 	// copy backup data from the remote leader node, and recovery backup from it
 	// if local has some old backup data, we should use rsync to sync the data file
 	// use the rocksdb backup/checkpoint interface to backup data
-	err := common.RunFileSync(syncAddr,
+	// the sst files in the local db may be reused if the local db is restored from the same source before
+	err := common.RunNamedFileSync(fullNS, syncAddr,
 		path.Join(rockredis.GetBackupDir(syncDir),
 			rockredis.GetCheckpointDir(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index)),
-		store.GetBackupDir(), stopChan)
+		store.GetBackupDir(), []string{store.GetDataDir()}, stopChan)
 
 	return err
 }
 
+// the address used to transfer the snapshot files from the remote node
+func getSnapSyncAddr(machineConfig MachineConfig, ssi common.SnapshotSyncInfo) string {
+	if machineConfig.SnapshotSyncByRsync {
+		return ssi.RemoteAddr
+	}
+	return "http://" + net.JoinHostPort(ssi.RemoteAddr, ssi.HttpAPIPort)
+}
+
 func GetValidBackupInfo(machineConfig MachineConfig,
 	clusterInfo common.IClusterInfo, fullNS string,
 	localID uint64, stopChan chan struct{},
@@ -327,7 +467,7 @@ func GetValidBackupInfo(machineConfig MachineConfig,
 				continue
 			}
 			if useRsyncForLocal {
-				syncAddrList = append(syncAddrList, ssi.RemoteAddr)
+				syncAddrList = append(syncAddrList, getSnapSyncAddr(machineConfig, ssi))
 				syncDirList = append(syncDirList, path.Join(ssi.RsyncModule, fullNS))
 			} else {
 				// local node with different directory
@@ -335,8 +475,8 @@ func GetValidBackupInfo(machineConfig MachineConfig,
 				syncDirList = append(syncDirList, path.Join(ssi.DataRoot, fullNS))
 			}
 		} else {
-			// for remote snapshot, we do rsync from remote module
-			syncAddrList = append(syncAddrList, ssi.RemoteAddr)
+			// for remote snapshot, we do transfer from remote module
+			syncAddrList = append(syncAddrList, getSnapSyncAddr(machineConfig, ssi))
 			syncDirList = append(syncDirList, path.Join(ssi.RsyncModule, fullNS))
 		}
 	}
@@ -356,11 +496,15 @@ func (kvsm *kvStoreSM) RestoreFromSnapshot(startup bool, raftSnapshot raftpb.Sna
 	for retry < 3 {
 		err := prepareSnapshotForStore(kvsm.store, kvsm.machineConfig, kvsm.clusterInfo, kvsm.fullNS,
 			kvsm.ID, stop, raftSnapshot, retry)
-		if err != nil {
+		if err == common.ErrSnapTransferCanceled {
+			kvsm.Infof("snapshot transfer canceled")
+			return err
+		} else if err != nil {
 			kvsm.Infof("failed to prepare snapshot: %v", err)
 		} else {
 			err = kvsm.store.Restore(raftSnapshot.Metadata.Term, raftSnapshot.Metadata.Index)
 			if err == nil {
+				kvsm.restoreClientSessions(raftSnapshot)
 				return nil
 			}
 		}
@@ -375,38 +519,63 @@ func (kvsm *kvStoreSM) RestoreFromSnapshot(startup bool, raftSnapshot raftpb.Sna
 	return errors.New("failed to restore from snapshot")
 }
 
+func (kvsm *kvStoreSM) restoreClientSessions(raftSnapshot raftpb.Snapshot) {
+	var si KVSnapInfo
+	err := json.Unmarshal(raftSnapshot.Data, &si)
+	if err != nil {
+		kvsm.Infof("failed to decode the client sessions in snapshot: %v", err)
+		si.ClientSessions = nil
+	}
+	kvsm.clientSessions.RestoreStates(si.ClientSessions)
+}
+
 func (kvsm *kvStoreSM) ApplyRaftConfRequest(req raftpb.ConfChange, term uint64, index uint64, stop chan struct{}) error {
 	return nil
 }
 
-func (kvsm *kvStoreSM) preCheckConflict(cmd redcon.Command, reqTs int64) bool {
+// preCheckConflict check whether the write from the remote cluster is older than the
+// local key by comparing the modify timestamp, and return false for checked if there is
+// no conflict checker for the command.
+func (kvsm *kvStoreSM) preCheckConflict(cmd redcon.Command, reqTs int64) (bool, bool) {
 	cmdName := strings.ToLower(string(cmd.Args[0]))
 	h, ok := kvsm.cRouter.GetHandler(cmdName)
 	if !ok {
-		return true
+		return true, false
 	}
-	return h(cmd, reqTs)
+	return h(cmd, reqTs), true
 }
 
 func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalRaftRequest, term uint64, index uint64, stop chan struct{}) (bool, error) {
 	forceBackup := false
 	start := time.Now()
+	if kvsm.applyPool != nil && kvsm.applyPool.tryApply(isReplaying, reqList, term, index, stop) {
+		cost := time.Since(start)
+		if cost >= time.Second {
+			kvsm.Infof("slow for parallel batch write db: %v, cost %v", len(reqList.Reqs), cost)
+		}
+		if reqList.ReqId > 0 {
+			kvsm.w.Trigger(reqList.ReqId, nil)
+		}
+		return forceBackup, nil
+	}
 	batching := false
 	var batchReqIDList []uint64
 	var batchReqRspList []interface{}
 	var batchStart time.Time
 	dupCheckMap := make(map[string]bool, len(reqList.Reqs))
 	lastBatchCmd := ""
+	batchLimit := kvsm.batchLimit.Get()
 	ts := reqList.Timestamp
 	if reqList.Type == FromClusterSyncer {
 		if nodeLog.Level() >= common.LOG_DETAIL {
 			kvsm.Debugf("recv write from cluster syncer at (%v-%v): %v", term, index, reqList.String())
 		}
-		// TODO: here we need compare the key timestamp in this cluster and the timestamp from raft request to handle
-		// the conflict change between two cluster.
-		//
 	}
 	var retErr error
+	// the propose time is not accurate for the replaying or the syncer from other cluster
+	recordSlow := !isReplaying && reqList.Type != FromClusterSyncer
+	// the replaying logs have been audited before restart
+	audit := !isReplaying && kvsm.machineConfig.AuditSink != nil
 	for reqIndex, req := range reqList.Reqs {
 		reqTs := ts
 		if reqTs == 0 {
@@ -418,23 +587,50 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 		}
 		if req.Header.DataType == int32(RedisReq) {
 			cmd, err := redcon.Parse(req.Data)
+			// the command without the key should never be proposed, and should not panic the apply
+			if err == nil && len(cmd.Args) < 2 {
+				err = common.ErrInvalidCommand
+			}
 			if err != nil {
 				kvsm.w.Trigger(reqID, err)
 			} else {
 				if !isReplaying && reqList.Type == FromClusterSyncer && !IsSyncerOnly() {
 					// syncer only no need check conflict since it will be no write from redis api
-					conflict := kvsm.preCheckConflict(cmd, reqTs)
-					if conflict {
+					conflict, checked := kvsm.preCheckConflict(cmd, reqTs)
+					if kvsm.machineConfig.ActiveActiveSync {
+						// the last write wins in active-active mode, and the write without
+						// conflict checker will always be applied.
+						if checked && conflict {
+							kvsm.Infof("conflict sync ignored since local is newer: %v, %v, %v", string(cmd.Raw), req.String(), reqTs)
+							kvsm.w.Trigger(reqID, nil)
+							continue
+						}
+					} else if conflict {
 						kvsm.Infof("conflict sync: %v, %v, %v", string(cmd.Raw), req.String(), reqTs)
 					}
 				}
+				clientID := req.Header.ClientId
+				if clientID > 0 {
+					if rsp, err, applied := kvsm.clientSessions.CheckApplied(clientID, req.Header.ClientSeq); applied {
+						kvsm.Infof("client request %v-%v already applied: %v", clientID, req.Header.ClientSeq, err)
+						if err != nil {
+							kvsm.w.Trigger(reqID, err)
+						} else {
+							kvsm.w.Trigger(reqID, rsp)
+						}
+						continue
+					}
+				}
 				cmdStart := time.Now()
 				cmdName := strings.ToLower(string(cmd.Args[0]))
 				_, pk, _ := common.ExtractNamesapce(cmd.Args[1])
 				_, ok := dupCheckMap[string(pk)]
 				handled := false
+				// the request from client with id will not be batched since we need
+				// cache the result for dedup
 				if rockredis.IsBatchableWrite(cmdName) &&
-					len(batchReqIDList) < maxDBBatchCmdNum &&
+					len(batchReqIDList) < batchLimit &&
+					clientID == 0 &&
 					!ok {
 					if !batching {
 						err := kvsm.store.BeginBatchWrite()
@@ -468,6 +664,9 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 						batchReqIDList = append(batchReqIDList, reqID)
 						batchReqRspList = append(batchReqRspList, v)
 						kvsm.dbWriteStats.UpdateSizeStats(int64(len(cmd.Raw)))
+						if audit {
+							kvsm.auditWrite(cmd, req, term, index)
+						}
 					}
 					if nodeLog.Level() > common.LOG_DETAIL {
 						kvsm.Infof("batching redis command: %v", cmdName)
@@ -478,7 +677,7 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 				}
 				if batching {
 					batching = false
-					batchReqIDList, batchReqRspList, dupCheckMap = kvsm.processBatching(lastBatchCmd, reqList, batchStart,
+					batchReqIDList, batchReqRspList, dupCheckMap = kvsm.processBatching(lastBatchCmd, reqList, recordSlow, batchStart,
 						batchReqIDList, batchReqRspList, dupCheckMap)
 				}
 				if handled {
@@ -496,13 +695,22 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 						(nodeLog.Level() >= common.LOG_DEBUG && cmdCost > dbWriteSlow/2) {
 						kvsm.Infof("slow write command: %v, cost: %v", string(cmd.Raw), cmdCost)
 					}
+					if recordSlow && reqTs > 0 {
+						kvsm.slowLog.RecordWrite(cmd.Args, cmdStart.Sub(time.Unix(0, reqTs)), cmdCost)
+					}
 
 					kvsm.dbWriteStats.UpdateWriteStats(int64(len(cmd.Raw)), cmdCost.Nanoseconds()/1000)
+					if clientID > 0 {
+						kvsm.clientSessions.Record(clientID, req.Header.ClientSeq, index, reqTs, v, err)
+					}
 					// write the future response or error
 					if err != nil {
 						kvsm.Infof("redis command %v error: %v, cmd: %v", cmdName, err, string(cmd.Raw))
 						kvsm.w.Trigger(reqID, err)
 					} else {
+						if audit {
+							kvsm.auditWrite(cmd, req, term, index)
+						}
 						kvsm.w.Trigger(reqID, v)
 					}
 				}
@@ -510,11 +718,11 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 		} else {
 			if batching {
 				batching = false
-				batchReqIDList, batchReqRspList, dupCheckMap = kvsm.processBatching(lastBatchCmd, reqList, batchStart,
+				batchReqIDList, batchReqRspList, dupCheckMap = kvsm.processBatching(lastBatchCmd, reqList, recordSlow, batchStart,
 					batchReqIDList, batchReqRspList, dupCheckMap)
 			}
 			if req.Header.DataType == int32(CustomReq) {
-				forceBackup, retErr = kvsm.handleCustomRequest(req, reqID)
+				forceBackup, retErr = kvsm.handleCustomRequest(req, reqID, index)
 			} else if req.Header.DataType == int32(SchemaChangeReq) {
 				kvsm.Infof("handle schema change: %v", string(req.Data))
 				var sc SchemaChange
@@ -533,7 +741,7 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 	}
 	// TODO: add test case for this
 	if batching {
-		kvsm.processBatching(lastBatchCmd, reqList, batchStart,
+		kvsm.processBatching(lastBatchCmd, reqList, recordSlow, batchStart,
 			batchReqIDList, batchReqRspList, dupCheckMap)
 	}
 	for _, req := range reqList.Reqs {
@@ -554,7 +762,7 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 	return forceBackup, retErr
 }
 
-func (kvsm *kvStoreSM) handleCustomRequest(req *InternalRaftRequest, reqID uint64) (bool, error) {
+func (kvsm *kvStoreSM) handleCustomRequest(req *InternalRaftRequest, reqID uint64, index uint64) (bool, error) {
 	var p customProposeData
 	var forceBackup bool
 	var retErr error
@@ -577,6 +785,17 @@ func (kvsm *kvStoreSM) handleCustomRequest(req *InternalRaftRequest, reqID uint6
 			err = kvsm.store.DeleteTableRange(dr.Dryrun, dr.Table, dr.StartFrom, dr.EndTo)
 		}
 		kvsm.w.Trigger(reqID, err)
+	} else if p.ProposeOp == ProposeOp_TableChecksum {
+		err = kvsm.startReplicaChecksum(p.Data, index)
+		if err != nil {
+			kvsm.w.Trigger(reqID, err)
+		} else {
+			kvsm.w.Trigger(reqID, index)
+		}
+	} else if p.ProposeOp == ProposeOp_TableRecount {
+		// counted in the apply loop, so the same difference is merged into the counter on all the replicas
+		err = kvsm.store.RecountTableKeys(string(p.Data))
+		kvsm.w.Trigger(reqID, err)
 	} else if p.ProposeOp == ProposeOp_RemoteConfChange {
 		var cc raftpb.ConfChange
 		cc.Unmarshal(p.Data)
@@ -592,10 +811,10 @@ func (kvsm *kvStoreSM) handleCustomRequest(req *InternalRaftRequest, reqID uint6
 		kvsm.w.Trigger(reqID, err)
 		if err == nil {
 			// how to make sure the client is not timeout while transferring
-			err = common.RunFileSync(p.SyncAddr,
+			err = common.RunIncrementalFileSync(p.SyncAddr,
 				path.Join(rockredis.GetBackupDir(p.SyncPath),
 					rockredis.GetCheckpointDir(p.RemoteTerm, p.RemoteIndex)),
-				localPath, nil,
+				localPath, []string{kvsm.store.GetBackupDir(), kvsm.store.GetDataDir()}, nil,
 			)
 			if err != nil {
 				kvsm.Infof("transfer remote snap request: %v to local: %v failed: %v", p, localPath, err)
@@ -663,7 +882,14 @@ func (kvsm *kvStoreSM) handleCustomRequest(req *InternalRaftRequest, reqID uint6
 }
 
 // return if configure changed and whether need force backup
-func (kvsm *kvStoreSM) processBatching(cmdName string, reqList BatchInternalRaftRequest, batchStart time.Time, batchReqIDList []uint64, batchReqRspList []interface{},
+func (kvsm *kvStoreSM) auditWrite(cmd redcon.Command, req *InternalRaftRequest, term uint64, index uint64) {
+	r := newAuditRecord(kvsm.fullNS, cmd, req.Header.ClientAddr, term, index)
+	if err := kvsm.machineConfig.AuditSink.Write(r); err != nil {
+		kvsm.Infof("failed to write audit log for %v at (%v-%v): %v", r.Command, term, index, err)
+	}
+}
+
+func (kvsm *kvStoreSM) processBatching(cmdName string, reqList BatchInternalRaftRequest, recordSlow bool, batchStart time.Time, batchReqIDList []uint64, batchReqRspList []interface{},
 	dupCheckMap map[string]bool) ([]uint64, []interface{}, map[string]bool) {
 
 	err := kvsm.store.CommitBatchWrite()
@@ -684,8 +910,14 @@ func (kvsm *kvStoreSM) processBatching(cmdName string, reqList BatchInternalRaft
 		kvsm.Infof("slow batch write db, command: %v, batch: %v, cost: %v",
 			cmdName, len(batchReqIDList), batchCost)
 	}
+	if recordSlow && reqList.Timestamp > 0 && len(batchReqIDList) > 0 {
+		// the batched commands share the cost, so only the batch will be recorded
+		kvsm.slowLog.RecordWrite([][]byte{[]byte(cmdName), []byte("batched:" + strconv.Itoa(len(batchReqIDList)))},
+			batchStart.Sub(time.Unix(0, reqList.Timestamp)), batchCost)
+	}
 	if len(batchReqIDList) > 0 {
 		kvsm.dbWriteStats.BatchUpdateLatencyStats(batchCost.Nanoseconds()/1000, int64(len(batchReqIDList)))
+		kvsm.batchLimit.Update(len(batchReqIDList), batchCost)
 	}
 	batchReqIDList = batchReqIDList[:0]
 	batchReqRspList = batchReqRspList[:0]
@@ -0,0 +1,113 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/absolute8511/ZanRedisDB/syncerpb"
+	"github.com/golang/snappy"
+	"golang.org/x/time/rate"
+)
+
+var errUnknownCompressType = errors.New("unknown raft log compress type")
+
+func parseSyncerCompressType(t string) (syncerpb.RaftLogCompressType, error) {
+	switch strings.ToLower(t) {
+	case "", "none":
+		return syncerpb.NoCompress, nil
+	case "snappy":
+		return syncerpb.SnappyCompress, nil
+	case "zstd":
+		return syncerpb.ZstdCompress, nil
+	}
+	return syncerpb.NoCompress, errUnknownCompressType
+}
+
+func compressRaftLogData(t syncerpb.RaftLogCompressType, data []byte) ([]byte, error) {
+	switch t {
+	case syncerpb.NoCompress:
+		return data, nil
+	case syncerpb.SnappyCompress:
+		return snappy.Encode(nil, data), nil
+	case syncerpb.ZstdCompress:
+		return zstdCompress(data)
+	}
+	return nil, errUnknownCompressType
+}
+
+// SupportedSyncerCompressTypes return the bit mask (1 << type) of the compress types
+// can be decoded by the local node, the zstd is not supported without cgo.
+func SupportedSyncerCompressTypes() uint32 {
+	var mask uint32
+	for _, t := range []syncerpb.RaftLogCompressType{syncerpb.SnappyCompress, syncerpb.ZstdCompress} {
+		if _, err := compressRaftLogData(t, []byte("check")); err == nil {
+			mask |= 1 << uint32(t)
+		}
+	}
+	return mask
+}
+
+// negotiateSyncerCompress return the compress type used for sending to the remote, the
+// remote cluster with the old version will not return the supported types so the data
+// is sent without compression.
+func negotiateSyncerCompress(t syncerpb.RaftLogCompressType, remoteSupported uint32) syncerpb.RaftLogCompressType {
+	if t == syncerpb.NoCompress || remoteSupported&(1<<uint32(t)) == 0 {
+		return syncerpb.NoCompress
+	}
+	return t
+}
+
+// DecompressRaftLogData decode the raft log data received from the remote cluster syncer
+func DecompressRaftLogData(t syncerpb.RaftLogCompressType, data []byte) ([]byte, error) {
+	switch t {
+	case syncerpb.NoCompress:
+		return data, nil
+	case syncerpb.SnappyCompress:
+		return snappy.Decode(nil, data)
+	case syncerpb.ZstdCompress:
+		return zstdDecompress(data)
+	}
+	return nil, errUnknownCompressType
+}
+
+// syncBandwidthLimiter limit the bytes per second sent to the remote cluster, the sending
+// will be blocked until enough tokens are available.
+type syncBandwidthLimiter struct {
+	limiter *rate.Limiter
+}
+
+// return nil if no limit
+func newSyncBandwidthLimiter(bytesPerSec int64) *syncBandwidthLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &syncBandwidthLimiter{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec)),
+	}
+}
+
+func (l *syncBandwidthLimiter) wait(n int, stop chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	burst := l.limiter.Burst()
+	// the batch may be larger than the burst, so we wait it in pieces
+	for n > 0 {
+		c := n
+		if c > burst {
+			c = burst
+		}
+		if err := l.limiter.WaitN(ctx, c); err != nil {
+			return err
+		}
+		n -= c
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/syncerpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncerCompressNegotiate(t *testing.T) {
+	supported := SupportedSyncerCompressTypes()
+	assert.NotEqual(t, uint32(0), supported&(1<<uint32(syncerpb.SnappyCompress)))
+	assert.Equal(t, uint32(0), supported&(1<<uint32(syncerpb.NoCompress)))
+
+	// the old version remote return no supported types
+	assert.Equal(t, syncerpb.NoCompress, negotiateSyncerCompress(syncerpb.SnappyCompress, 0))
+	assert.Equal(t, syncerpb.NoCompress, negotiateSyncerCompress(syncerpb.NoCompress, supported))
+	assert.Equal(t, syncerpb.SnappyCompress, negotiateSyncerCompress(syncerpb.SnappyCompress, supported))
+	assert.Equal(t, syncerpb.NoCompress, negotiateSyncerCompress(syncerpb.ZstdCompress,
+		1<<uint32(syncerpb.SnappyCompress)))
+
+	rsp := syncerpb.SyncedRaftRsp{Term: 1, Index: 2, Timestamp: 3, CompressTypes: supported}
+	d, err := rsp.Marshal()
+	assert.Nil(t, err)
+	var decoded syncerpb.SyncedRaftRsp
+	assert.Nil(t, decoded.Unmarshal(d))
+	assert.Equal(t, rsp, decoded)
+	// the response from the old version
+	rsp.CompressTypes = 0
+	d, err = rsp.Marshal()
+	assert.Nil(t, err)
+	decoded = syncerpb.SyncedRaftRsp{}
+	assert.Nil(t, decoded.Unmarshal(d))
+	assert.Equal(t, uint32(0), decoded.CompressTypes)
+}
+
+func TestSyncerBuildRaftLogsCompress(t *testing.T) {
+	s, err := NewRemoteLogSender("local", "test-0", "test://")
+	assert.Nil(t, err)
+	assert.Equal(t, errUnknownCompressType, s.SetTrafficControl("invalid", 0))
+	assert.Nil(t, s.SetTrafficControl("snappy", 0))
+
+	var reqList BatchInternalRaftRequest
+	for i := 0; i < 10; i++ {
+		reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(uint64(i+1), "set", "test:key", "value"))
+	}
+	reqList.ReqNum = int32(len(reqList.Reqs))
+	reqList.OrigTerm = 1
+	reqList.OrigIndex = 10
+	origin, err := marshalBatchWithCrc(&reqList, nil)
+	assert.Nil(t, err)
+
+	// not compressed before the remote supported types known
+	raftLogs, size, err := s.buildRaftLogs([]*BatchInternalRaftRequest{&reqList})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(raftLogs))
+	assert.Equal(t, syncerpb.NoCompress, raftLogs[0].CompressType)
+	assert.Equal(t, origin, raftLogs[0].Data)
+	assert.Equal(t, len(origin), size)
+
+	s.remoteCompress = SupportedSyncerCompressTypes()
+	raftLogs, size, err = s.buildRaftLogs([]*BatchInternalRaftRequest{&reqList})
+	assert.Nil(t, err)
+	assert.Equal(t, syncerpb.SnappyCompress, raftLogs[0].CompressType)
+	assert.True(t, size < len(origin))
+	assert.Equal(t, uint64(1), raftLogs[0].Term)
+	assert.Equal(t, uint64(10), raftLogs[0].Index)
+	data, err := DecompressRaftLogData(raftLogs[0].CompressType, raftLogs[0].Data)
+	assert.Nil(t, err)
+	assert.Equal(t, origin, data)
+}
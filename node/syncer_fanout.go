@@ -0,0 +1,422 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+const (
+	syncerDestBufferLen              = 1024
+	syncerDestCheckpointFilePrefix   = "syncer_dest_checkpoint_"
+	syncerDestCheckpointSaveInterval = time.Second * 5
+)
+
+const (
+	destSyncNormal int32 = iota
+	// the buffer is overflowed and the logs are dropped until the backup is proposed
+	destSyncOverflow
+	// the logs after the backup are buffered again, wait the backup transferred to remote
+	destSyncWaitBackup
+)
+
+// syncerDestination is the additional destination cluster for the log syncer. Like the
+// main remote cluster, it has the independent send loop and buffer, so it will never block
+// the raft apply. If it falls behind too much, the buffered logs will be dropped and the
+// destination will be full synced from the backup of other replicas later.
+type syncerDestination struct {
+	sm            *logSyncerSM
+	remoteCluster string
+	lgSender      *RemoteLogSender
+	sendCh        chan *BatchInternalRaftRequest
+	syncedState   SyncedState
+	syncedCnt     int64
+	droppedCnt    int64
+	syncState     int32
+	resyncIndex   uint64
+	// only accessed in the send loop
+	backupProposed time.Time
+	checkpointDir  string
+	// protect the checkpoint saved from both the apply loop and the send loop
+	cpMutex        sync.Mutex
+	checkpoint     syncerDestCheckpoint
+	lastCheckpoint time.Time
+}
+
+// syncerDestCheckpoint is persisted so the destination which need full sync will still be
+// resynced after restart, since the buffered and dropped logs are lost.
+type syncerDestCheckpoint struct {
+	SyncedState
+	SyncState   int32  `json:"sync_state,omitempty"`
+	ResyncIndex uint64 `json:"resync_index,omitempty"`
+}
+
+func (cp *syncerDestCheckpoint) isSame(other *syncerDestCheckpoint) bool {
+	return cp.SyncedState.IsSame(&other.SyncedState) && cp.SyncState == other.SyncState &&
+		cp.ResyncIndex == other.ResyncIndex
+}
+
+func newSyncerDestination(sm *logSyncerSM, checkpointDir string, localCluster string, remoteNS string, remoteCluster string) (*syncerDestination, error) {
+	lgSender, err := NewRemoteLogSender(localCluster, remoteNS, remoteCluster)
+	if err != nil {
+		return nil, err
+	}
+	err = lgSender.SetTrafficControl(sm.machineConfig.SyncerCompressType, sm.machineConfig.SyncerMaxBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	d := &syncerDestination{
+		sm:            sm,
+		remoteCluster: remoteCluster,
+		lgSender:      lgSender,
+		sendCh:        make(chan *BatchInternalRaftRequest, syncerDestBufferLen),
+		checkpointDir: checkpointDir,
+	}
+	cp, err := d.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	d.checkpoint = cp
+	d.setSyncedState(cp.SyncedTerm, cp.SyncedIndex, cp.Timestamp)
+	if cp.SyncState != destSyncNormal {
+		// the logs buffered or dropped before restart are lost, so we need a new backup
+		sm.Infof("syncer destination %v need full sync since restored from checkpoint: %v", remoteCluster, cp)
+		atomic.StoreInt32(&d.syncState, destSyncOverflow)
+	}
+	return d, nil
+}
+
+func (d *syncerDestination) checkpointFile() string {
+	return path.Join(d.checkpointDir, syncerDestCheckpointFilePrefix+url.PathEscape(d.remoteCluster))
+}
+
+func (d *syncerDestination) loadCheckpoint() (syncerDestCheckpoint, error) {
+	var cp syncerDestCheckpoint
+	if d.checkpointDir == "" {
+		return cp, nil
+	}
+	data, err := ioutil.ReadFile(d.checkpointFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return cp, err
+}
+
+func (d *syncerDestination) getCheckpoint() syncerDestCheckpoint {
+	var cp syncerDestCheckpoint
+	cp.SyncedTerm, cp.SyncedIndex, cp.Timestamp = d.getSyncedState()
+	cp.SyncState = atomic.LoadInt32(&d.syncState)
+	cp.ResyncIndex = atomic.LoadUint64(&d.resyncIndex)
+	return cp
+}
+
+// saveCheckpoint save the synced state periodically, the sync state changes should be saved
+// with force.
+func (d *syncerDestination) saveCheckpoint(force bool) error {
+	if d.checkpointDir == "" {
+		return nil
+	}
+	d.cpMutex.Lock()
+	defer d.cpMutex.Unlock()
+	cp := d.getCheckpoint()
+	if cp.isSame(&d.checkpoint) {
+		return nil
+	}
+	if !force && time.Since(d.lastCheckpoint) < syncerDestCheckpointSaveInterval {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(d.checkpointDir, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	fileName := d.checkpointFile()
+	err = ioutil.WriteFile(fileName+".tmp", data, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(fileName+".tmp", fileName)
+	if err != nil {
+		return err
+	}
+	d.checkpoint = cp
+	d.lastCheckpoint = time.Now()
+	return nil
+}
+
+func (d *syncerDestination) mustSaveCheckpoint(force bool) {
+	err := d.saveCheckpoint(force)
+	if err != nil {
+		d.sm.Errorf("failed to save checkpoint for syncer destination %v: %v", d.remoteCluster, err)
+	}
+}
+
+func (d *syncerDestination) removeCheckpoint() {
+	if d.checkpointDir == "" {
+		return
+	}
+	os.Remove(d.checkpointFile())
+}
+
+func (d *syncerDestination) getSyncedState() (uint64, uint64, int64) {
+	return atomic.LoadUint64(&d.syncedState.SyncedTerm),
+		atomic.LoadUint64(&d.syncedState.SyncedIndex),
+		atomic.LoadInt64(&d.syncedState.Timestamp)
+}
+
+func (d *syncerDestination) setSyncedState(term uint64, index uint64, ts int64) {
+	atomic.StoreUint64(&d.syncedState.SyncedTerm, term)
+	atomic.StoreUint64(&d.syncedState.SyncedIndex, index)
+	atomic.StoreInt64(&d.syncedState.Timestamp, ts)
+}
+
+func (d *syncerDestination) GetStats() map[string]interface{} {
+	stat := make(map[string]interface{})
+	term, index, ts := d.getSyncedState()
+	stat["synced"] = atomic.LoadInt64(&d.syncedCnt)
+	stat["dropped"] = atomic.LoadInt64(&d.droppedCnt)
+	stat["sent_bytes"] = atomic.LoadInt64(&d.lgSender.sentBytes)
+	stat["synced_index"] = index
+	stat["synced_term"] = term
+	stat["synced_timestamp"] = ts
+	stat["resyncing"] = atomic.LoadInt32(&d.syncState) != destSyncNormal
+	return stat
+}
+
+// mark the destination need to be full synced from the backup proposed later
+func (d *syncerDestination) markResync() {
+	if atomic.CompareAndSwapInt32(&d.syncState, destSyncNormal, destSyncOverflow) {
+		d.sm.Infof("syncer destination %v need full sync from backup", d.remoteCluster)
+	} else {
+		atomic.StoreInt32(&d.syncState, destSyncOverflow)
+	}
+	d.mustSaveCheckpoint(true)
+}
+
+// should only be called in the raft apply loop, each destination will queue its own copy
+// of the batch so the send loops never share the state.
+func (d *syncerDestination) enqueue(orig *BatchInternalRaftRequest) {
+	cp := *orig
+	reqList := &cp
+	if atomic.LoadInt32(&d.syncState) == destSyncOverflow {
+		if !hasBackupRequest(reqList) {
+			atomic.AddInt64(&d.droppedCnt, 1)
+			return
+		}
+		// all the dropped logs will be contained in the backup after this log
+		atomic.StoreUint64(&d.resyncIndex, reqList.OrigIndex)
+		atomic.StoreInt32(&d.syncState, destSyncWaitBackup)
+		d.mustSaveCheckpoint(true)
+	}
+	select {
+	case d.sendCh <- reqList:
+	default:
+		atomic.AddInt64(&d.droppedCnt, 1)
+		d.markResync()
+	}
+}
+
+func (d *syncerDestination) maybeProposeBackup() {
+	if atomic.LoadInt32(&d.syncState) != destSyncOverflow || d.sm.proposeBackup == nil {
+		return
+	}
+	// the learner not sending will never see the proposed backup in the apply loop
+	if atomic.LoadInt32(&d.sm.ignoreSend) == 1 {
+		return
+	}
+	if time.Since(d.backupProposed) < initSyncProposeBackupInterval {
+		return
+	}
+	d.backupProposed = time.Now()
+	go func() {
+		err := d.sm.proposeBackup()
+		if err != nil {
+			d.sm.Infof("propose backup for syncer destination %v failed: %v", d.remoteCluster, err)
+		}
+	}()
+}
+
+// full sync the backup which contains the logs before resync index to the remote
+func (d *syncerDestination) resyncFromBackup(stop chan struct{}) error {
+	backup, err := d.sm.resyncRemoteFromBackup(d.lgSender, d.remoteCluster, atomic.LoadUint64(&d.resyncIndex), stop)
+	if err != nil {
+		return err
+	}
+	if backup.Index > 0 {
+		d.setSyncedState(backup.Term, backup.Index, 0)
+	}
+	return nil
+}
+
+// resyncRemoteFromBackup find the backup which contains the logs before resync index and
+// full sync it to the remote, the empty backup is returned if ignored in test.
+func (sm *logSyncerSM) resyncRemoteFromBackup(sender *RemoteLogSender, remoteCluster string,
+	resyncIndex uint64, stop chan struct{}) (raftpb.SnapshotMetadata, error) {
+	var backup raftpb.SnapshotMetadata
+	if sm.clusterInfo == nil {
+		sm.Infof("nil cluster info, only for test, ignore full sync for %v", remoteCluster)
+		return backup, nil
+	}
+	for {
+		syncAddr, syncDir, meta, ok := sm.findInitSyncBackup(resyncIndex)
+		if ok {
+			sm.Infof("found backup %v at %v:%v for %v", meta.String(),
+				syncAddr, syncDir, remoteCluster)
+			backup = meta
+			break
+		}
+		select {
+		case <-stop:
+			return backup, common.ErrStopped
+		case <-sm.sendStop:
+			return backup, common.ErrStopped
+		case <-time.After(time.Second):
+		}
+	}
+	err := sm.transferBackupToRemote(sender, backup, stop)
+	if err != nil {
+		return backup, err
+	}
+	sm.Infof("full sync from backup %v to %v done", backup.String(), remoteCluster)
+	return backup, nil
+}
+
+func (d *syncerDestination) handlerRaftLogs(stop chan struct{}) {
+	defer func() {
+		d.lgSender.Stop()
+		d.mustSaveCheckpoint(true)
+		term, index, ts := d.getSyncedState()
+		d.sm.Infof("syncer destination %v send loop exit at synced: %v-%v-%v", d.remoteCluster, term, index, ts)
+	}()
+	state, err := d.lgSender.getRemoteSyncedRaft(stop)
+	if err != nil {
+		d.sm.Errorf("failed to get the synced state from %v: %v", d.remoteCluster, err)
+	} else {
+		d.setSyncedState(state.SyncedTerm, state.SyncedIndex, state.Timestamp)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	raftLogs := make([]*BatchInternalRaftRequest, 0, logSendBufferLen)
+	for {
+		raftLogs = raftLogs[:0]
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.maybeProposeBackup()
+			d.mustSaveCheckpoint(false)
+			continue
+		case req := <-d.sendCh:
+			raftLogs = append(raftLogs, req)
+		}
+	batchLoop:
+		for len(raftLogs) < logSendBufferLen {
+			select {
+			case req := <-d.sendCh:
+				raftLogs = append(raftLogs, req)
+			default:
+				break batchLoop
+			}
+		}
+		switch atomic.LoadInt32(&d.syncState) {
+		case destSyncOverflow:
+			// the backup will contain these logs
+			atomic.AddInt64(&d.droppedCnt, int64(len(raftLogs)))
+			d.maybeProposeBackup()
+			continue
+		case destSyncWaitBackup:
+			resyncIndex := atomic.LoadUint64(&d.resyncIndex)
+			pos := 0
+			for pos < len(raftLogs) && raftLogs[pos].OrigIndex < resyncIndex {
+				pos++
+			}
+			atomic.AddInt64(&d.droppedCnt, int64(pos))
+			raftLogs = raftLogs[pos:]
+			if len(raftLogs) == 0 {
+				continue
+			}
+			err := d.resyncFromBackup(stop)
+			if err != nil {
+				return
+			}
+			// the state may be changed to overflow again while we are waiting the backup
+			if !atomic.CompareAndSwapInt32(&d.syncState, destSyncWaitBackup, destSyncNormal) {
+				continue
+			}
+			d.mustSaveCheckpoint(true)
+			state, err = d.lgSender.getRemoteSyncedRaft(stop)
+			if err != nil {
+				return
+			}
+		}
+		last := raftLogs[len(raftLogs)-1]
+		if !state.IsNewer2(last.OrigTerm, last.OrigIndex) {
+			err = d.lgSender.sendRaftLog(raftLogs, stop)
+			if err != nil {
+				// only failed while stopping since we retry until success
+				return
+			}
+		}
+		atomic.AddInt64(&d.syncedCnt, int64(len(raftLogs)))
+		d.setSyncedState(last.OrigTerm, last.OrigIndex, last.Timestamp)
+		d.mustSaveCheckpoint(false)
+	}
+}
+
+// check the destination after restored from snapshot, since the logs before the snapshot will
+// never be sent, we need full sync if the remote is older than the snapshot
+func (d *syncerDestination) checkAfterRestore(meta raftpb.SnapshotMetadata) {
+	state, err := d.lgSender.getRemoteSyncedRaftOnce()
+	if err == nil && state.IsNewer2(meta.Term, meta.Index) {
+		return
+	}
+	d.sm.Infof("syncer destination %v is older than snapshot %v: %v, %v", d.remoteCluster,
+		meta.String(), state, err)
+	d.markResync()
+}
+
+// transferBackupToRemote notify the remote cluster to transfer the backup from other replicas
+// and wait it applied, it will retry until success or stopped.
+func (sm *logSyncerSM) transferBackupToRemote(sender *RemoteLogSender, backup raftpb.SnapshotMetadata, stop chan struct{}) error {
+	snap := raftpb.Snapshot{Metadata: backup}
+	for {
+		// the backup may be purged, so we find again if failed
+		syncAddr, syncDir, meta, ok := sm.findInitSyncBackup(backup.Index)
+		var err error
+		if !ok || meta.Term != backup.Term || meta.Index != backup.Index {
+			err = errors.New("backup for full sync not found")
+		} else {
+			err = sender.notifyTransferSnap(snap, syncAddr, syncDir)
+			if err == nil {
+				err = sender.waitApplySnapStatus(snap, stop)
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		sm.Infof("full sync from backup %v failed: %v", backup.String(), err)
+		select {
+		case <-stop:
+			return common.ErrStopped
+		case <-sm.sendStop:
+			return common.ErrStopped
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/pkg/wait"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSyncerDestination(t *testing.T, sm *logSyncerSM, dir string) *syncerDestination {
+	d, err := newSyncerDestination(sm, dir, "test", sm.fullNS, "test://")
+	assert.Nil(t, err)
+	return d
+}
+
+func TestSyncerApplyNotBlockedByRemote(t *testing.T) {
+	sm := &logSyncerSM{
+		fullNS:   "test-0",
+		ID:       1,
+		sendCh:   make(chan *BatchInternalRaftRequest, 1),
+		sendStop: make(chan struct{}),
+		w:        wait.New(),
+	}
+	d1 := newTestSyncerDestination(t, sm, "")
+	d2 := newTestSyncerDestination(t, sm, "")
+	d2.sendCh = make(chan *BatchInternalRaftRequest)
+	sm.destinations = append(sm.destinations, d1, d2)
+
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:k", "v"))
+	reqList.Timestamp = time.Now().UnixNano()
+	stop := make(chan struct{})
+	done := make(chan bool, 1)
+	go func() {
+		sm.ApplyRaftRequest(false, reqList, 2, 10, stop)
+		sm.ApplyRaftRequest(false, reqList, 2, 11, stop)
+		done <- true
+	}()
+	// neither the blocked destination nor the full main remote should block the apply
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("apply should not be blocked by any remote")
+	}
+	assert.Equal(t, 2, len(d1.sendCh))
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&d2.syncState))
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&sm.sendSyncState))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&sm.droppedCnt))
+	// the snapshot should not be done before the main remote resynced
+	_, err := sm.GetSnapshot(2, 11)
+	assert.NotNil(t, err)
+
+	q1 := <-d1.sendCh
+	mainReq := <-sm.sendCh
+	assert.Equal(t, uint64(10), q1.OrigIndex)
+	assert.Equal(t, uint64(10), mainReq.OrigIndex)
+	// each remote should have its own copy
+	assert.True(t, q1 != mainReq)
+	q1.OrigIndex = 12
+	assert.Equal(t, uint64(10), mainReq.OrigIndex)
+}
+
+func TestSyncerMainRemoteResync(t *testing.T) {
+	sm := &logSyncerSM{
+		fullNS: "test-0",
+		ID:     1,
+		sendCh: make(chan *BatchInternalRaftRequest, 1),
+	}
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:k", "v"))
+	reqList.OrigIndex = 1
+	sm.enqueue(&reqList)
+	assert.Equal(t, destSyncNormal, atomic.LoadInt32(&sm.sendSyncState))
+	reqList.OrigIndex = 2
+	sm.enqueue(&reqList)
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&sm.sendSyncState))
+	// dropped until the backup request
+	<-sm.sendCh
+	reqList.OrigIndex = 3
+	sm.enqueue(&reqList)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&sm.droppedCnt))
+	assert.Equal(t, 0, len(sm.sendCh))
+
+	data, _ := json.Marshal(&customProposeData{ProposeOp: ProposeOp_Backup, NeedBackup: true})
+	var backupReq BatchInternalRaftRequest
+	backupReq.Reqs = []*InternalRaftRequest{{
+		Header: &RequestHeader{ID: 2, DataType: int32(CustomReq)},
+		Data:   data,
+	}}
+	backupReq.OrigIndex = 4
+	sm.enqueue(&backupReq)
+	assert.Equal(t, destSyncWaitBackup, atomic.LoadInt32(&sm.sendSyncState))
+	assert.Equal(t, uint64(4), atomic.LoadUint64(&sm.resyncIndex))
+	assert.Equal(t, 1, len(sm.sendCh))
+
+	// the logs before the backup are contained in the backup
+	old := reqList
+	old.OrigIndex = 3
+	logs := sm.skipResyncLogs([]*BatchInternalRaftRequest{&old, <-sm.sendCh})
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, uint64(4), logs[0].OrigIndex)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&sm.droppedCnt))
+}
+
+func TestSyncerDestinationOverflow(t *testing.T) {
+	sm := &logSyncerSM{fullNS: "test-0", ID: 1}
+	d := newTestSyncerDestination(t, sm, "")
+	d.sendCh = make(chan *BatchInternalRaftRequest, 1)
+
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:k", "v"))
+	reqList.OrigIndex = 1
+	d.enqueue(&reqList)
+	assert.Equal(t, destSyncNormal, atomic.LoadInt32(&d.syncState))
+	reqList.OrigIndex = 2
+	d.enqueue(&reqList)
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&d.syncState))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&d.droppedCnt))
+	// dropped until the backup request
+	<-d.sendCh
+	reqList.OrigIndex = 3
+	d.enqueue(&reqList)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&d.droppedCnt))
+	assert.Equal(t, 0, len(d.sendCh))
+
+	data, _ := json.Marshal(&customProposeData{ProposeOp: ProposeOp_Backup, NeedBackup: true})
+	var backupReq BatchInternalRaftRequest
+	backupReq.Reqs = []*InternalRaftRequest{{
+		Header: &RequestHeader{ID: 2, DataType: int32(CustomReq)},
+		Data:   data,
+	}}
+	backupReq.OrigIndex = 4
+	d.enqueue(&backupReq)
+	assert.Equal(t, destSyncWaitBackup, atomic.LoadInt32(&d.syncState))
+	assert.Equal(t, uint64(4), atomic.LoadUint64(&d.resyncIndex))
+	assert.Equal(t, 1, len(d.sendCh))
+}
+
+func TestSyncerDestinationCheckpoint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "syncer-dest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	sm := &logSyncerSM{fullNS: "test-0", ID: 1}
+	d := newTestSyncerDestination(t, sm, tmpDir)
+	term, index, _ := d.getSyncedState()
+	assert.Equal(t, uint64(0), term)
+	assert.Equal(t, uint64(0), index)
+
+	d.setSyncedState(2, 10, 100)
+	// not saved too often if not forced
+	d.lastCheckpoint = time.Now()
+	d.mustSaveCheckpoint(false)
+	d2 := newTestSyncerDestination(t, sm, tmpDir)
+	_, index, _ = d2.getSyncedState()
+	assert.Equal(t, uint64(0), index)
+
+	d.mustSaveCheckpoint(true)
+	d2 = newTestSyncerDestination(t, sm, tmpDir)
+	term, index, ts := d2.getSyncedState()
+	assert.Equal(t, uint64(2), term)
+	assert.Equal(t, uint64(10), index)
+	assert.Equal(t, int64(100), ts)
+	assert.Equal(t, destSyncNormal, atomic.LoadInt32(&d2.syncState))
+
+	// the resync state should be saved and restored after restart
+	d.markResync()
+	d2 = newTestSyncerDestination(t, sm, tmpDir)
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&d2.syncState))
+
+	// the buffered logs while waiting the backup are lost after restart, so we need a new backup
+	atomic.StoreUint64(&d.resyncIndex, 12)
+	atomic.StoreInt32(&d.syncState, destSyncWaitBackup)
+	d.mustSaveCheckpoint(true)
+	d2 = newTestSyncerDestination(t, sm, tmpDir)
+	assert.Equal(t, destSyncOverflow, atomic.LoadInt32(&d2.syncState))
+	assert.Equal(t, uint64(12), d2.checkpoint.ResyncIndex)
+
+	atomic.StoreInt32(&d.syncState, destSyncNormal)
+	d.mustSaveCheckpoint(true)
+	d2 = newTestSyncerDestination(t, sm, tmpDir)
+	assert.Equal(t, destSyncNormal, atomic.LoadInt32(&d2.syncState))
+
+	sm.destinations = append(sm.destinations, d)
+	sm.Destroy()
+	_, err = os.Stat(d.checkpointFile())
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"strings"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+)
+
+// logSyncFilter is used to filter the write commands which no need to sync to the remote cluster.
+// If the include tables is not empty, only the tables in it will be synced, and the exclude tables
+// and commands will be filtered. The custom requests will never be filtered since they are
+// needed for the raft state in remote cluster.
+type logSyncFilter struct {
+	includeTables map[string]bool
+	excludeTables map[string]bool
+	excludeCmds   map[string]bool
+}
+
+func toFilterSet(list []string, lower bool) map[string]bool {
+	if len(list) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if lower {
+			v = strings.ToLower(v)
+		}
+		m[v] = true
+	}
+	return m
+}
+
+// return nil if no filter configured
+func newLogSyncFilter(includeTables []string, excludeTables []string, excludeCmds []string) *logSyncFilter {
+	f := &logSyncFilter{
+		includeTables: toFilterSet(includeTables, false),
+		excludeTables: toFilterSet(excludeTables, false),
+		excludeCmds:   toFilterSet(excludeCmds, true),
+	}
+	if len(f.includeTables) == 0 && len(f.excludeTables) == 0 && len(f.excludeCmds) == 0 {
+		return nil
+	}
+	return f
+}
+
+func (f *logSyncFilter) isTableFiltered(key []byte) bool {
+	table, _, err := common.ExtractTable(key)
+	if err != nil {
+		return false
+	}
+	if len(f.includeTables) > 0 && !f.includeTables[string(table)] {
+		return true
+	}
+	return f.excludeTables[string(table)]
+}
+
+// filterReq check all the keys in the request, the multi keys command will be rewritten
+// with only the keys not filtered. Return nil if the whole request is filtered.
+func (f *logSyncFilter) filterReq(req *InternalRaftRequest) *InternalRaftRequest {
+	if req.Header.DataType != int32(RedisReq) {
+		return req
+	}
+	cmd, err := redcon.Parse(req.Data)
+	if err != nil || len(cmd.Args) < 1 {
+		return req
+	}
+	cmdName := strings.ToLower(string(cmd.Args[0]))
+	if f.excludeCmds[cmdName] {
+		return nil
+	}
+	keyPos := getCmdKeyPositions(cmdName, len(cmd.Args))
+	if len(keyPos) == 0 {
+		return req
+	}
+	args := make([][]byte, 0, len(cmd.Args))
+	args = append(args, cmd.Args[0])
+	kept := 0
+	for i, pos := range keyPos {
+		if f.isTableFiltered(cmd.Args[pos]) {
+			continue
+		}
+		// the args until the next key belong to this key
+		end := len(cmd.Args)
+		if i < len(keyPos)-1 {
+			end = keyPos[i+1]
+		}
+		args = append(args, cmd.Args[pos:end]...)
+		kept++
+	}
+	if kept == 0 {
+		return nil
+	}
+	if kept == len(keyPos) {
+		return req
+	}
+	nreq := *req
+	nreq.Data = buildCommand(args).Raw
+	return &nreq
+}
+
+// filterReqs remove the filtered requests from the batch and return the number of filtered
+func (f *logSyncFilter) filterReqs(reqList *BatchInternalRaftRequest) int {
+	// the origin requests may still be used by the caller, so we can not filter in place
+	reqs := make([]*InternalRaftRequest, 0, len(reqList.Reqs))
+	filtered := 0
+	for _, req := range reqList.Reqs {
+		nreq := f.filterReq(req)
+		if nreq == nil {
+			filtered++
+			continue
+		}
+		reqs = append(reqs, nreq)
+	}
+	reqList.Reqs = reqs
+	reqList.ReqNum = int32(len(reqs))
+	return filtered
+}
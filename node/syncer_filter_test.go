@@ -0,0 +1,74 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSyncFilter(t *testing.T) {
+	assert.Nil(t, newLogSyncFilter(nil, []string{" "}, nil))
+
+	f := newLogSyncFilter(nil, []string{"tmp"}, []string{"DEL", " Expire "})
+	assert.NotNil(t, f)
+	assert.NotNil(t, f.filterReq(buildTestRedisReq(1, "set", "test:k", "v")))
+	assert.Nil(t, f.filterReq(buildTestRedisReq(2, "set", "tmp:k", "v")))
+	assert.Nil(t, f.filterReq(buildTestRedisReq(3, "del", "test:k")))
+	assert.Nil(t, f.filterReq(buildTestRedisReq(4, "EXPIRE", "test:k", "10")))
+	// the key without table and the invalid command are not filtered
+	assert.NotNil(t, f.filterReq(buildTestRedisReq(5, "set", "notable", "v")))
+	assert.NotNil(t, f.filterReq(&InternalRaftRequest{
+		Header: &RequestHeader{ID: 6, DataType: int32(RedisReq)},
+		Data:   []byte("invalid"),
+	}))
+	// the custom request is never filtered
+	assert.NotNil(t, f.filterReq(&InternalRaftRequest{
+		Header: &RequestHeader{ID: 7, DataType: int32(CustomReq)},
+	}))
+
+	f = newLogSyncFilter([]string{"test", "test2"}, []string{"test2"}, nil)
+	assert.NotNil(t, f.filterReq(buildTestRedisReq(1, "set", "test:k", "v")))
+	assert.Nil(t, f.filterReq(buildTestRedisReq(2, "set", "test2:k", "v")))
+	assert.Nil(t, f.filterReq(buildTestRedisReq(3, "set", "other:k", "v")))
+
+	// all the keys of the multi keys command should be checked
+	f = newLogSyncFilter(nil, []string{"tmp"}, nil)
+	req := buildTestRedisReq(4, "del", "test:k1", "tmp:k2", "test:k3")
+	nreq := f.filterReq(req)
+	assert.NotNil(t, nreq)
+	assert.Equal(t, uint64(4), nreq.Header.ID)
+	assert.Equal(t, buildTestRedisReq(4, "del", "test:k1", "test:k3").Data, nreq.Data)
+	// the origin request is not changed
+	assert.Equal(t, buildTestRedisReq(4, "del", "test:k1", "tmp:k2", "test:k3").Data, req.Data)
+	nreq = f.filterReq(buildTestRedisReq(5, "mset", "tmp:k1", "v1", "test:k2", "v2"))
+	assert.NotNil(t, nreq)
+	assert.Equal(t, buildTestRedisReq(5, "mset", "test:k2", "v2").Data, nreq.Data)
+	nreq = f.filterReq(buildTestRedisReq(6, "plset", "test:k1", "v1", "tmp:k2", "v2"))
+	assert.NotNil(t, nreq)
+	assert.Equal(t, buildTestRedisReq(6, "plset", "test:k1", "v1").Data, nreq.Data)
+	assert.Nil(t, f.filterReq(buildTestRedisReq(7, "del", "tmp:k1", "tmp:k2")))
+	req = buildTestRedisReq(8, "mset", "test:k1", "v1", "test:k2", "v2")
+	assert.True(t, req == f.filterReq(req))
+}
+
+func TestLogSyncFilterReqs(t *testing.T) {
+	f := newLogSyncFilter([]string{"test"}, nil, nil)
+	origin := []*InternalRaftRequest{
+		buildTestRedisReq(1, "set", "test:k1", "v"),
+		buildTestRedisReq(2, "set", "other:k", "v"),
+		buildTestRedisReq(3, "set", "test:k2", "v"),
+		{Header: &RequestHeader{ID: 4, DataType: int32(CustomReq)}},
+	}
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = origin
+	reqList.ReqNum = int32(len(origin))
+	assert.Equal(t, 1, f.filterReqs(&reqList))
+	assert.Equal(t, int32(3), reqList.ReqNum)
+	assert.Equal(t, 3, len(reqList.Reqs))
+	assert.Equal(t, uint64(1), reqList.Reqs[0].Header.ID)
+	assert.Equal(t, uint64(3), reqList.Reqs[1].Header.ID)
+	assert.Equal(t, uint64(4), reqList.Reqs[2].Header.ID)
+	// the origin requests are not changed
+	assert.Equal(t, 4, len(origin))
+	assert.Equal(t, uint64(2), origin[1].Header.ID)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"path"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -23,6 +25,14 @@ const (
 	logSendBufferLen = 64
 )
 
+const (
+	initSyncUnchecked int32 = iota
+	initSyncWaitBackup
+	initSyncDone
+)
+
+const initSyncProposeBackupInterval = time.Second * 10
+
 var syncerNormalInit = false
 
 func SetSyncerNormalInit() {
@@ -38,6 +48,9 @@ type logSyncerSM struct {
 	machineConfig  MachineConfig
 	ID             uint64
 	syncedCnt      int64
+	filteredCnt    int64
+	filter         *logSyncFilter
+	transform      *logSyncTransform
 	receivedState  SyncedState
 	syncedState    SyncedState
 	lgSender       *RemoteLogSender
@@ -49,6 +62,20 @@ type logSyncerSM struct {
 	// control if we need send the log to remote really
 	ignoreSend int32
 	w          wait.Wait
+	// used to do the full sync from the backup while the remote cluster is empty,
+	// only accessed in the apply loop
+	initSyncState      int32
+	initBackup         raftpb.SnapshotMetadata
+	initBackupProposed time.Time
+	proposeBackup      func() error
+	destinations       []*syncerDestination
+	// the main remote will be full synced from the backup if it falls behind too much,
+	// so the raft apply will never be blocked by the main remote.
+	sendSyncState int32
+	resyncIndex   uint64
+	droppedCnt    int64
+	// only accessed in the apply loop
+	resyncBackupProposed time.Time
 }
 
 func NewLogSyncerSM(opts *KVOptions, machineConfig MachineConfig, localID uint64, fullNS string,
@@ -62,6 +89,8 @@ func NewLogSyncerSM(opts *KVOptions, machineConfig MachineConfig, localID uint64
 		sendCh:         make(chan *BatchInternalRaftRequest, logSendBufferLen),
 		sendStop:       make(chan struct{}),
 		waitSendLogChs: make(chan chan struct{}, 1),
+		filter: newLogSyncFilter(machineConfig.SyncerIncludeTables,
+			machineConfig.SyncerExcludeTables, machineConfig.SyncerExcludeCmds),
 		//dataDir:       path.Join(opts.DataDir, "logsyncer"),
 	}
 
@@ -69,11 +98,34 @@ func NewLogSyncerSM(opts *KVOptions, machineConfig MachineConfig, localID uint64
 	if clusterInfo != nil {
 		localCluster = clusterInfo.GetClusterName()
 	}
-	lgSender, err := NewRemoteLogSender(localCluster, lg.fullNS, lg.machineConfig.RemoteSyncCluster)
+	remoteNS := lg.fullNS
+	ns, pid := common.GetNamespaceAndPartition(fullNS)
+	if newNS, ok := machineConfig.SyncerNamespaceMapping[ns]; ok && newNS != "" {
+		remoteNS = common.GetNsDesp(newNS, pid)
+	}
+	lgSender, err := NewRemoteLogSender(localCluster, remoteNS, lg.machineConfig.RemoteSyncCluster)
+	if err != nil {
+		return nil, err
+	}
+	err = lgSender.SetTrafficControl(machineConfig.SyncerCompressType, machineConfig.SyncerMaxBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	lg.transform, err = newLogSyncTransform(ns, machineConfig)
 	if err != nil {
 		return nil, err
 	}
 	lg.lgSender = lgSender
+	for _, remote := range machineConfig.RemoteSyncClusters {
+		if remote == "" || remote == machineConfig.RemoteSyncCluster {
+			continue
+		}
+		d, err := newSyncerDestination(lg, opts.DataDir, localCluster, remoteNS, remote)
+		if err != nil {
+			return nil, err
+		}
+		lg.destinations = append(lg.destinations, d)
+	}
 	return lg, nil
 }
 
@@ -120,9 +172,20 @@ func (sm *logSyncerSM) GetStats() common.NamespaceStats {
 	stat := make(map[string]interface{})
 	stat["role"] = common.LearnerRoleLogSyncer
 	stat["synced"] = atomic.LoadInt64(&sm.syncedCnt)
+	stat["filtered"] = atomic.LoadInt64(&sm.filteredCnt)
+	stat["dropped"] = atomic.LoadInt64(&sm.droppedCnt)
+	stat["resyncing"] = atomic.LoadInt32(&sm.sendSyncState) != destSyncNormal
+	stat["sent_bytes"] = atomic.LoadInt64(&sm.lgSender.sentBytes)
 	stat["synced_index"] = atomic.LoadUint64(&sm.syncedState.SyncedIndex)
 	stat["synced_term"] = atomic.LoadUint64(&sm.syncedState.SyncedTerm)
 	stat["synced_timestamp"] = atomic.LoadInt64(&sm.syncedState.Timestamp)
+	if len(sm.destinations) > 0 {
+		dests := make(map[string]interface{}, len(sm.destinations))
+		for _, d := range sm.destinations {
+			dests[d.remoteCluster] = d.GetStats()
+		}
+		stat["destinations"] = dests
+	}
 	ns.InternalStats = stat
 	return ns
 }
@@ -132,6 +195,9 @@ func (sm *logSyncerSM) CleanData() error {
 }
 
 func (sm *logSyncerSM) Destroy() {
+	for _, d := range sm.destinations {
+		d.removeCheckpoint()
+	}
 }
 
 func (sm *logSyncerSM) CheckExpiredData(buffer common.ExpiredDataBuffer, stop chan struct{}) error {
@@ -144,6 +210,13 @@ func (sm *logSyncerSM) Start() error {
 		defer sm.wg.Done()
 		sm.handlerRaftLogs()
 	}()
+	for _, d := range sm.destinations {
+		sm.wg.Add(1)
+		go func(d *syncerDestination) {
+			defer sm.wg.Done()
+			d.handlerRaftLogs(sm.sendStop)
+		}(d)
+	}
 	return nil
 }
 
@@ -251,7 +324,23 @@ func (sm *logSyncerSM) handlerRaftLogs() {
 				continue
 			}
 			handled = true
-			if state.IsNewer2(last.OrigTerm, last.OrigIndex) {
+			raftLogs = sm.skipResyncLogs(raftLogs)
+			if len(raftLogs) == 0 {
+				continue
+			}
+			if atomic.LoadInt32(&sm.sendSyncState) == destSyncWaitBackup {
+				err = sm.resyncFromBackup()
+				if err == nil {
+					// the state may be changed to overflow again while we are waiting the backup
+					if !atomic.CompareAndSwapInt32(&sm.sendSyncState, destSyncWaitBackup, destSyncNormal) {
+						continue
+					}
+					state, err = sm.lgSender.getRemoteSyncedRaft(sm.sendStop)
+				}
+			}
+			if err != nil {
+				// retry later
+			} else if state.IsNewer2(last.OrigTerm, last.OrigIndex) {
 				// remote is already replayed this raft log
 			} else {
 				err = sm.lgSender.sendRaftLog(raftLogs, sm.sendStop)
@@ -280,6 +369,76 @@ func (sm *logSyncerSM) handlerRaftLogs() {
 	}
 }
 
+// enqueue the batch to the main remote without blocking the raft apply, the logs will be
+// dropped if the buffer is full and the main remote will be full synced from the backup
+// proposed later. Should only be called in the raft apply loop.
+func (sm *logSyncerSM) enqueue(reqList *BatchInternalRaftRequest) {
+	if atomic.LoadInt32(&sm.sendSyncState) == destSyncOverflow {
+		if !hasBackupRequest(reqList) {
+			atomic.AddInt64(&sm.droppedCnt, 1)
+			sm.maybeProposeResyncBackup()
+			return
+		}
+		// all the dropped logs will be contained in the backup after this log
+		atomic.StoreUint64(&sm.resyncIndex, reqList.OrigIndex)
+		atomic.StoreInt32(&sm.sendSyncState, destSyncWaitBackup)
+	}
+	select {
+	case sm.sendCh <- reqList:
+	default:
+		atomic.AddInt64(&sm.droppedCnt, 1)
+		if atomic.SwapInt32(&sm.sendSyncState, destSyncOverflow) == destSyncNormal {
+			sm.Infof("main remote need full sync from backup since the send buffer is full at %v",
+				reqList.OrigIndex)
+		}
+		sm.maybeProposeResyncBackup()
+	}
+}
+
+func (sm *logSyncerSM) maybeProposeResyncBackup() {
+	if sm.proposeBackup == nil || time.Since(sm.resyncBackupProposed) < initSyncProposeBackupInterval {
+		return
+	}
+	sm.resyncBackupProposed = time.Now()
+	go func() {
+		err := sm.proposeBackup()
+		if err != nil {
+			sm.Infof("propose backup for main remote resync failed: %v", err)
+		}
+	}()
+}
+
+// skipResyncLogs drop the buffered logs which will be contained in the backup for resync
+func (sm *logSyncerSM) skipResyncLogs(raftLogs []*BatchInternalRaftRequest) []*BatchInternalRaftRequest {
+	switch atomic.LoadInt32(&sm.sendSyncState) {
+	case destSyncOverflow:
+		atomic.AddInt64(&sm.droppedCnt, int64(len(raftLogs)))
+		return raftLogs[:0]
+	case destSyncWaitBackup:
+		resyncIndex := atomic.LoadUint64(&sm.resyncIndex)
+		pos := 0
+		for pos < len(raftLogs) && raftLogs[pos].OrigIndex < resyncIndex {
+			pos++
+		}
+		atomic.AddInt64(&sm.droppedCnt, int64(pos))
+		n := copy(raftLogs, raftLogs[pos:])
+		return raftLogs[:n]
+	}
+	return raftLogs
+}
+
+func (sm *logSyncerSM) resyncFromBackup() error {
+	backup, err := sm.resyncRemoteFromBackup(sm.lgSender, sm.machineConfig.RemoteSyncCluster,
+		atomic.LoadUint64(&sm.resyncIndex), sm.sendStop)
+	if err != nil {
+		return err
+	}
+	if backup.Index > 0 {
+		sm.setSyncedState(backup.Term, backup.Index, 0)
+	}
+	return nil
+}
+
 func (sm *logSyncerSM) waitBufferedLogs(timeout time.Duration) error {
 	waitCh := make(chan struct{})
 	sm.Infof("wait buffered send logs")
@@ -309,6 +468,10 @@ func (sm *logSyncerSM) waitBufferedLogs(timeout time.Duration) error {
 // snapshot should wait all buffered commit logs
 func (sm *logSyncerSM) GetSnapshot(term uint64, index uint64) (*KVSnapInfo, error) {
 	var si KVSnapInfo
+	if atomic.LoadInt32(&sm.sendSyncState) != destSyncNormal {
+		// the dropped logs should be replayed after restart if the resync is not done
+		return &si, errors.New("the main remote is waiting full sync from backup")
+	}
 	err := sm.waitBufferedLogs(time.Second * 10)
 	return &si, err
 }
@@ -350,6 +513,9 @@ func (sm *logSyncerSM) RestoreFromSnapshot(startup bool, raftSnapshot raftpb.Sna
 	// greater (term-index) than snapshot, we can just ignore the snapshot restore
 	// since we already synced the data in snapshot.
 	sm.Infof("restore snapshot : %v", raftSnapshot.Metadata.String())
+	for _, d := range sm.destinations {
+		d.checkAfterRestore(raftSnapshot.Metadata)
+	}
 	state, err := sm.lgSender.getRemoteSyncedRaft(stop)
 	if err != nil {
 		return err
@@ -484,10 +650,33 @@ func (sm *logSyncerSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 		}
 		return forceBackup, nil
 	}
+	ignore, err = sm.waitInitFullSync(&reqList, term, index, stop)
+	if err != nil {
+		return forceBackup, err
+	}
+	if ignore {
+		if nodeLog.Level() >= common.LOG_DEBUG {
+			sm.Debugf("ignored since contained in full sync backup, %v-%v:%v", term, index, reqList.String())
+		}
+		return forceBackup, nil
+	}
 
 	if nodeLog.Level() >= common.LOG_DEBUG {
 		sm.Debugf("begin sync, %v-%v:%v", term, index, reqList.String())
 	}
+	if sm.filter != nil {
+		// the filtered batch should still be sent (may be empty) to keep the synced term-index in remote cluster
+		filtered := sm.filter.filterReqs(&reqList)
+		if filtered > 0 {
+			atomic.AddInt64(&sm.filteredCnt, int64(filtered))
+		}
+	}
+	if sm.transform != nil {
+		dropped := sm.transform.transformReqs(&reqList)
+		if dropped > 0 {
+			atomic.AddInt64(&sm.filteredCnt, int64(dropped))
+		}
+	}
 	if reqList.ReqId == 0 {
 		for _, e := range reqList.Reqs {
 			reqList.ReqId = e.Header.ID
@@ -512,13 +701,121 @@ func (sm *logSyncerSM) ApplyRaftRequest(isReplaying bool, reqList BatchInternalR
 			}
 		}
 	}
-	select {
-	case sm.sendCh <- &reqList:
-	case <-stop:
-		return false, nil
-	case <-sm.sendStop:
-		return false, nil
+	// each remote has its own buffer and send loop, so a slow remote will not block the
+	// raft apply or the other remotes.
+	for _, d := range sm.destinations {
+		d.enqueue(&reqList)
 	}
+	sm.enqueue(&reqList)
 
 	return forceBackup, nil
 }
+
+func hasBackupRequest(reqList *BatchInternalRaftRequest) bool {
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(CustomReq) {
+			continue
+		}
+		var p customProposeData
+		err := json.Unmarshal(req.Data, &p)
+		if err == nil && p.ProposeOp == ProposeOp_Backup {
+			return true
+		}
+	}
+	return false
+}
+
+// find the backup from other replicas which contains the raft log at the index
+func (sm *logSyncerSM) findInitSyncBackup(minIndex uint64) (string, string, raftpb.SnapshotMetadata, bool) {
+	var meta raftpb.SnapshotMetadata
+	snapSyncInfoList, err := sm.clusterInfo.GetSnapshotSyncInfo(sm.fullNS)
+	if err != nil {
+		sm.Infof("get snapshot info failed: %v", err)
+		return "", "", meta, false
+	}
+	for _, ssi := range snapSyncInfoList {
+		if ssi.ReplicaID == sm.ID {
+			continue
+		}
+		uri := "http://" + ssi.RemoteAddr + ":" +
+			ssi.HttpAPIPort + common.APILatestBackup + "/" + sm.fullNS
+		var rsp common.LogSyncStats
+		sc, err := common.APIRequest("GET", uri, nil, time.Second*3, &rsp)
+		if err != nil || sc != http.StatusOK {
+			sm.Infof("request %v error: %v, %v", uri, sc, err)
+			continue
+		}
+		if rsp.Index < minIndex {
+			continue
+		}
+		meta.Term = rsp.Term
+		meta.Index = rsp.Index
+		return getSnapSyncAddr(sm.machineConfig, ssi), path.Join(ssi.RsyncModule, sm.fullNS), meta, true
+	}
+	return "", "", meta, false
+}
+
+// waitInitFullSync do the full sync from the backup of other replicas while the remote cluster is empty,
+// so we no need to send all the raft logs from the beginning. We propose a backup to make all
+// the replicas do the backup, and all the raft logs before the backup will be ignored.
+// Return true if the raft log is contained in the backup and should be ignored.
+func (sm *logSyncerSM) waitInitFullSync(reqList *BatchInternalRaftRequest, term uint64, index uint64,
+	stop chan struct{}) (bool, error) {
+	if !sm.machineConfig.SyncerInitFromSnapshot || sm.initSyncState == initSyncDone {
+		return false, nil
+	}
+	if sm.initSyncState == initSyncUnchecked {
+		state, err := sm.lgSender.getRemoteSyncedRaft(stop)
+		if err != nil {
+			return false, err
+		}
+		if state.SyncedTerm != 0 || state.SyncedIndex != 0 || sm.clusterInfo == nil || sm.proposeBackup == nil {
+			sm.initSyncState = initSyncDone
+			return false, nil
+		}
+		sm.Infof("remote cluster is empty at %v-%v, begin full sync from backup", term, index)
+		sm.initSyncState = initSyncWaitBackup
+	}
+	if sm.initBackup.Index == 0 {
+		if !hasBackupRequest(reqList) {
+			if time.Since(sm.initBackupProposed) > initSyncProposeBackupInterval {
+				sm.initBackupProposed = time.Now()
+				go func() {
+					err := sm.proposeBackup()
+					if err != nil {
+						sm.Infof("propose backup for full sync failed: %v", err)
+					}
+				}()
+			}
+			// the logs before the backup proposal will be contained in the backup
+			return true, nil
+		}
+		// the replicas will do the backup after this log applied, wait until the backup is ready
+		for {
+			syncAddr, syncDir, meta, ok := sm.findInitSyncBackup(index)
+			if ok {
+				sm.Infof("found backup %v at %v:%v for full sync", meta.String(), syncAddr, syncDir)
+				sm.initBackup = meta
+				break
+			}
+			select {
+			case <-stop:
+				return true, common.ErrStopped
+			case <-sm.sendStop:
+				return true, common.ErrStopped
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	if index < sm.initBackup.Index {
+		return true, nil
+	}
+	err := sm.transferBackupToRemote(sm.lgSender, sm.initBackup, stop)
+	if err != nil {
+		return true, err
+	}
+	sm.Infof("full sync from backup %v done", sm.initBackup.String())
+	sm.setSyncedState(sm.initBackup.Term, sm.initBackup.Index, 0)
+	sm.initSyncState = initSyncDone
+	return index == sm.initBackup.Index, nil
+}
@@ -0,0 +1,130 @@
+package node
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClusterInfo struct {
+	snapInfos []common.SnapshotSyncInfo
+}
+
+func (ci *testClusterInfo) GetClusterName() string {
+	return "test"
+}
+
+func (ci *testClusterInfo) GetSnapshotSyncInfo(fullNS string) ([]common.SnapshotSyncInfo, error) {
+	return ci.snapInfos, nil
+}
+
+func (ci *testClusterInfo) UpdateMeForNamespaceLeader(fullNS string) (bool, error) {
+	return false, nil
+}
+
+func TestSyncerHasBackupRequest(t *testing.T) {
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:k", "v"))
+	assert.False(t, hasBackupRequest(&reqList))
+	d, _ := json.Marshal(&customProposeData{ProposeOp: ProposeOp_DeleteTable})
+	reqList.Reqs = append(reqList.Reqs, &InternalRaftRequest{
+		Header: &RequestHeader{ID: 2, DataType: int32(CustomReq)},
+		Data:   d,
+	})
+	assert.False(t, hasBackupRequest(&reqList))
+	d, _ = json.Marshal(&customProposeData{ProposeOp: ProposeOp_Backup, NeedBackup: true})
+	reqList.Reqs = append(reqList.Reqs, &InternalRaftRequest{
+		Header: &RequestHeader{ID: 3, DataType: int32(CustomReq)},
+		Data:   d,
+	})
+	assert.True(t, hasBackupRequest(&reqList))
+}
+
+func TestSyncerWaitInitFullSyncBackup(t *testing.T) {
+	var backupIndex uint64 = 5
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != common.APILatestBackup+"/test-0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		d, _ := json.Marshal(common.LogSyncStats{Name: "test-0", Term: 2, Index: atomic.LoadUint64(&backupIndex)})
+		w.Write(d)
+	}))
+	defer ts.Close()
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	assert.Nil(t, err)
+
+	proposed := make(chan bool, 10)
+	sm := &logSyncerSM{
+		fullNS:        "test-0",
+		ID:            1,
+		machineConfig: MachineConfig{SyncerInitFromSnapshot: true},
+		clusterInfo: &testClusterInfo{snapInfos: []common.SnapshotSyncInfo{
+			{ReplicaID: 1, RemoteAddr: "127.0.0.1", HttpAPIPort: "1"},
+			{ReplicaID: 2, RemoteAddr: host, HttpAPIPort: port, RsyncModule: "zankv"},
+		}},
+		sendStop: make(chan struct{}),
+		proposeBackup: func() error {
+			proposed <- true
+			return nil
+		},
+		initSyncState: initSyncWaitBackup,
+	}
+	// the backup older than the log is not used
+	_, _, _, ok := sm.findInitSyncBackup(10)
+	assert.False(t, ok)
+	atomic.StoreUint64(&backupIndex, 12)
+	addr, dir, meta, ok := sm.findInitSyncBackup(10)
+	assert.True(t, ok)
+	assert.Equal(t, host, addr)
+	assert.Equal(t, "zankv/test-0", dir)
+	assert.Equal(t, uint64(2), meta.Term)
+	assert.Equal(t, uint64(12), meta.Index)
+
+	// the logs before the backup proposal are ignored and the backup is proposed
+	stop := make(chan struct{})
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = append(reqList.Reqs, buildTestRedisReq(1, "set", "test:k", "v"))
+	ignore, err := sm.waitInitFullSync(&reqList, 2, 9, stop)
+	assert.Nil(t, err)
+	assert.True(t, ignore)
+	select {
+	case <-proposed:
+	case <-time.After(time.Second):
+		t.Fatal("backup should be proposed")
+	}
+	// the backup should not be proposed again too soon
+	ignore, err = sm.waitInitFullSync(&reqList, 2, 9, stop)
+	assert.Nil(t, err)
+	assert.True(t, ignore)
+	select {
+	case <-proposed:
+		t.Fatal("backup should not be proposed again")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// wait the backup after the backup proposal, and the logs in the backup are ignored
+	d, _ := json.Marshal(&customProposeData{ProposeOp: ProposeOp_Backup, NeedBackup: true})
+	reqList.Reqs = []*InternalRaftRequest{{
+		Header: &RequestHeader{ID: 2, DataType: int32(CustomReq)},
+		Data:   d,
+	}}
+	ignore, err = sm.waitInitFullSync(&reqList, 2, 10, stop)
+	assert.Nil(t, err)
+	assert.True(t, ignore)
+	assert.Equal(t, uint64(12), sm.initBackup.Index)
+	assert.Equal(t, initSyncWaitBackup, sm.initSyncState)
+
+	// the init sync is skipped if not enabled
+	sm.machineConfig.SyncerInitFromSnapshot = false
+	ignore, err = sm.waitInitFullSync(&reqList, 2, 11, stop)
+	assert.Nil(t, err)
+	assert.False(t, ignore)
+}
@@ -0,0 +1,239 @@
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"plugin"
+	"strings"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+)
+
+const (
+	// the exported symbol in the transformer go plugin, should be a LogSyncTransformer
+	transformPluginSymbol = "Transformer"
+	redactedValue         = "REDACTED"
+)
+
+var errInvalidTransformPlugin = errors.New("invalid log sync transformer plugin")
+
+// LogSyncTransformer can rewrite the redis write command in raft log before it is sent to
+// the remote cluster. The args is the command args with the namespace removed from keys,
+// return false to drop the command.
+type LogSyncTransformer interface {
+	Transform(ns string, args [][]byte) ([][]byte, bool)
+}
+
+var transformerMutex sync.Mutex
+var registeredTransformers = make(map[string]LogSyncTransformer)
+
+// RegisterLogSyncTransformer register the transformer which can be enabled by name in the syncer config
+func RegisterLogSyncTransformer(name string, t LogSyncTransformer) {
+	transformerMutex.Lock()
+	registeredTransformers[name] = t
+	transformerMutex.Unlock()
+}
+
+func getLogSyncTransformer(name string) (LogSyncTransformer, bool) {
+	transformerMutex.Lock()
+	t, ok := registeredTransformers[name]
+	transformerMutex.Unlock()
+	return t, ok
+}
+
+func loadTransformPlugin(p string) (LogSyncTransformer, error) {
+	pl, err := plugin.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := pl.Lookup(transformPluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	// the exported variable symbol is a pointer to the variable
+	if t, ok := sym.(*LogSyncTransformer); ok && *t != nil {
+		return *t, nil
+	}
+	if t, ok := sym.(LogSyncTransformer); ok {
+		return t, nil
+	}
+	return nil, errInvalidTransformPlugin
+}
+
+// the positions of all the keys in the write command, only the commands with more
+// than one key need to be listed, other commands use the first arg as the key.
+func getCmdKeyPositions(cmdName string, argNum int) []int {
+	switch cmdName {
+	case "del":
+		pos := make([]int, 0, argNum-1)
+		for i := 1; i < argNum; i++ {
+			pos = append(pos, i)
+		}
+		return pos
+	case "plset", "mset":
+		pos := make([]int, 0, argNum/2)
+		for i := 1; i < argNum; i += 2 {
+			pos = append(pos, i)
+		}
+		return pos
+	}
+	if argNum < 2 {
+		return nil
+	}
+	return []int{1}
+}
+
+// the positions of the values which should be redacted in the write command, all the
+// registered write commands should be listed if they have any value.
+func getCmdValuePositions(cmdName string, argNum int) []int {
+	var start, step int
+	switch cmdName {
+	case "set", "setnx", "getset", "setex", "psetex", "append", "lset":
+		return []int{argNum - 1}
+	case "incrby":
+		return []int{2}
+	case "hincrby", "zincrby", "json.set":
+		return []int{3}
+	case "plset", "mset":
+		start, step = 2, 2
+	case "hset", "hsetnx", "hmset":
+		start, step = 3, 2
+	case "lpush", "rpush", "sadd", "srem", "zrem", "pfadd":
+		start, step = 2, 1
+	case "zadd":
+		start, step = 3, 2
+	case "json.arrappend":
+		start, step = 3, 1
+	default:
+		return nil
+	}
+	pos := make([]int, 0, argNum/step)
+	for i := start; i < argNum; i += step {
+		pos = append(pos, i)
+	}
+	return pos
+}
+
+// the redacted increment should still be a valid number to be applied in the remote cluster,
+// and the members of set, zset and hll are replaced by the hmac of each member, so the distinct
+// members are still distinct in the remote cluster.
+func (t *logSyncTransform) getRedactedValue(cmdName string, v []byte) []byte {
+	switch cmdName {
+	case "incrby", "hincrby":
+		return []byte("0")
+	case "sadd", "srem", "zadd", "zincrby", "zrem", "pfadd":
+		mac := hmac.New(sha256.New, t.redactKey)
+		mac.Write(v)
+		return []byte(hex.EncodeToString(mac.Sum(nil)))
+	}
+	return []byte(redactedValue)
+}
+
+// logSyncTransform is the transform stage for the log syncer, the config rules will be applied
+// first and then the transformers registered or loaded from plugin.
+type logSyncTransform struct {
+	ns           string
+	tableMapping map[string]string
+	redactTables map[string]bool
+	redactKey    []byte
+	transformers []LogSyncTransformer
+}
+
+// return nil if no transform configured
+func newLogSyncTransform(ns string, conf MachineConfig) (*logSyncTransform, error) {
+	t := &logSyncTransform{
+		ns:           ns,
+		tableMapping: conf.SyncerTableMapping,
+		redactTables: toFilterSet(conf.SyncerRedactTables, false),
+		redactKey:    []byte(conf.SyncerRedactKey),
+	}
+	for _, name := range conf.SyncerTransformers {
+		tf, ok := getLogSyncTransformer(name)
+		if !ok {
+			return nil, fmt.Errorf("log sync transformer %v not registered", name)
+		}
+		t.transformers = append(t.transformers, tf)
+	}
+	if conf.SyncerTransformPlugin != "" {
+		tf, err := loadTransformPlugin(conf.SyncerTransformPlugin)
+		if err != nil {
+			return nil, err
+		}
+		t.transformers = append(t.transformers, tf)
+	}
+	if len(t.tableMapping) == 0 && len(t.redactTables) == 0 && len(t.transformers) == 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+func (t *logSyncTransform) transformArgs(args [][]byte) ([][]byte, bool) {
+	cmdName := strings.ToLower(string(args[0]))
+	if len(t.redactTables) > 0 && len(args) > 1 {
+		table, _, err := common.ExtractTable(args[1])
+		if err == nil && t.redactTables[string(table)] {
+			for _, pos := range getCmdValuePositions(cmdName, len(args)) {
+				args[pos] = t.getRedactedValue(cmdName, args[pos])
+			}
+		}
+	}
+	if len(t.tableMapping) > 0 {
+		for _, pos := range getCmdKeyPositions(cmdName, len(args)) {
+			table, rk, err := common.ExtractTable(args[pos])
+			if err != nil {
+				continue
+			}
+			if newTable, ok := t.tableMapping[string(table)]; ok {
+				nk := make([]byte, 0, len(newTable)+1+len(rk))
+				nk = append(nk, newTable...)
+				nk = append(nk, common.KEYSEP)
+				nk = append(nk, rk...)
+				args[pos] = nk
+			}
+		}
+	}
+	for _, tf := range t.transformers {
+		var keep bool
+		args, keep = tf.Transform(t.ns, args)
+		if !keep || len(args) == 0 {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// transformReqs rewrite the redis requests in the batch and return the number of dropped
+func (t *logSyncTransform) transformReqs(reqList *BatchInternalRaftRequest) int {
+	// the origin requests may still be used by the caller, so we need copy the changed
+	reqs := make([]*InternalRaftRequest, 0, len(reqList.Reqs))
+	dropped := 0
+	for _, req := range reqList.Reqs {
+		if req.Header.DataType != int32(RedisReq) {
+			reqs = append(reqs, req)
+			continue
+		}
+		cmd, err := redcon.Parse(req.Data)
+		if err != nil || len(cmd.Args) < 1 {
+			reqs = append(reqs, req)
+			continue
+		}
+		args := make([][]byte, len(cmd.Args))
+		copy(args, cmd.Args)
+		args, keep := t.transformArgs(args)
+		if !keep {
+			dropped++
+			continue
+		}
+		nreq := *req
+		nreq.Data = buildCommand(args).Raw
+		reqs = append(reqs, &nreq)
+	}
+	reqList.Reqs = reqs
+	reqList.ReqNum = int32(len(reqs))
+	return dropped
+}
@@ -0,0 +1,190 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSyncTransformValuePositions(t *testing.T) {
+	// all the write commands with the example args and the redacted positions
+	tests := map[string]struct {
+		args []string
+		pos  []int
+	}{
+		"set":              {[]string{"test:k", "v"}, []int{2}},
+		"setnx":            {[]string{"test:k", "v"}, []int{2}},
+		"getset":           {[]string{"test:k", "v"}, []int{2}},
+		"setex":            {[]string{"test:k", "10", "v"}, []int{3}},
+		"psetex":           {[]string{"test:k", "1000", "v"}, []int{3}},
+		"append":           {[]string{"test:k", "v"}, []int{2}},
+		"mset":             {[]string{"test:k1", "v1", "test:k2", "v2"}, []int{2, 4}},
+		"plset":            {[]string{"test:k1", "v1", "test:k2", "v2"}, []int{2, 4}},
+		"incr":             {[]string{"test:k"}, nil},
+		"incrby":           {[]string{"test:k", "2"}, []int{2}},
+		"del":              {[]string{"test:k1", "test:k2"}, nil},
+		"expire":           {[]string{"test:k", "10"}, nil},
+		"persist":          {[]string{"test:k"}, nil},
+		"pfadd":            {[]string{"test:k", "e1", "e2"}, []int{2, 3}},
+		"pfcount":          {[]string{"test:k"}, nil},
+		"hset":             {[]string{"test:k", "f", "v"}, []int{3}},
+		"hsetnx":           {[]string{"test:k", "f", "v"}, []int{3}},
+		"hmset":            {[]string{"test:k", "f1", "v1", "f2", "v2"}, []int{3, 5}},
+		"hincrby":          {[]string{"test:k", "f", "2"}, []int{3}},
+		"hdel":             {[]string{"test:k", "f"}, nil},
+		"hclear":           {[]string{"test:k"}, nil},
+		"hmclear":          {[]string{"test:k1", "test:k2"}, nil},
+		"hexpire":          {[]string{"test:k", "10"}, nil},
+		"hpersist":         {[]string{"test:k"}, nil},
+		"json.set":         {[]string{"test:k", "a.b", "1"}, []int{3}},
+		"json.del":         {[]string{"test:k", "a.b"}, nil},
+		"json.arrappend":   {[]string{"test:k", "a", "1", "2"}, []int{3, 4}},
+		"json.arrpop":      {[]string{"test:k", "a"}, nil},
+		"lpush":            {[]string{"test:k", "v1", "v2"}, []int{2, 3}},
+		"rpush":            {[]string{"test:k", "v1", "v2"}, []int{2, 3}},
+		"lset":             {[]string{"test:k", "0", "v"}, []int{3}},
+		"lpop":             {[]string{"test:k"}, nil},
+		"rpop":             {[]string{"test:k"}, nil},
+		"ltrim":            {[]string{"test:k", "0", "1"}, nil},
+		"lclear":           {[]string{"test:k"}, nil},
+		"lmclear":          {[]string{"test:k1", "test:k2"}, nil},
+		"lexpire":          {[]string{"test:k", "10"}, nil},
+		"lpersist":         {[]string{"test:k"}, nil},
+		"lfixkey":          {[]string{"test:k"}, nil},
+		"sadd":             {[]string{"test:k", "m1", "m2"}, []int{2, 3}},
+		"srem":             {[]string{"test:k", "m1", "m2"}, []int{2, 3}},
+		"spop":             {[]string{"test:k"}, nil},
+		"sclear":           {[]string{"test:k"}, nil},
+		"smclear":          {[]string{"test:k1", "test:k2"}, nil},
+		"sexpire":          {[]string{"test:k", "10"}, nil},
+		"spersist":         {[]string{"test:k"}, nil},
+		"zadd":             {[]string{"test:k", "1", "m1", "2", "m2"}, []int{3, 5}},
+		"zincrby":          {[]string{"test:k", "1", "m"}, []int{3}},
+		"zrem":             {[]string{"test:k", "m1", "m2"}, []int{2, 3}},
+		"zremrangebylex":   {[]string{"test:k", "[a", "[b"}, nil},
+		"zremrangebyrank":  {[]string{"test:k", "0", "1"}, nil},
+		"zremrangebyscore": {[]string{"test:k", "0", "1"}, nil},
+		"zclear":           {[]string{"test:k"}, nil},
+		"zmclear":          {[]string{"test:k1", "test:k2"}, nil},
+		"zexpire":          {[]string{"test:k", "10"}, nil},
+		"zpersist":         {[]string{"test:k"}, nil},
+		"zfixkey":          {[]string{"test:k"}, nil},
+	}
+	kvsm := &kvStoreSM{router: common.NewSMCmdRouter()}
+	kvsm.registerHandlers()
+	names := kvsm.router.GetInternalCmdNames()
+	assert.NotEqual(t, 0, len(names))
+	for _, name := range names {
+		_, ok := tests[name]
+		assert.True(t, ok, "write command %v should be checked for the values to redact", name)
+	}
+
+	tf, err := newLogSyncTransform("default", MachineConfig{SyncerRedactTables: []string{"test"},
+		SyncerRedactKey: "secret"})
+	assert.Nil(t, err)
+	for name, tt := range tests {
+		args := append([]string{name}, tt.args...)
+		assert.Equal(t, tt.pos, getCmdValuePositions(name, len(args)), name)
+
+		bargs := make([][]byte, 0, len(args))
+		for _, a := range args {
+			bargs = append(bargs, []byte(a))
+		}
+		transformed, keep := tf.transformArgs(bargs)
+		assert.True(t, keep)
+		redacted := make(map[int]bool)
+		for _, p := range tt.pos {
+			redacted[p] = true
+		}
+		for i, a := range transformed {
+			if !redacted[i] {
+				assert.Equal(t, args[i], string(a), name)
+			} else if name == "incrby" || name == "hincrby" {
+				assert.Equal(t, "0", string(a), name)
+			} else if isTestMemberCmd(name) {
+				assert.Equal(t, 64, len(a), name)
+				assert.NotEqual(t, args[i], string(a), name)
+			} else {
+				assert.Equal(t, redactedValue, string(a), name)
+			}
+		}
+	}
+}
+
+func isTestMemberCmd(name string) bool {
+	switch name {
+	case "sadd", "srem", "zadd", "zincrby", "zrem", "pfadd":
+		return true
+	}
+	return false
+}
+
+func TestLogSyncTransformRedactMembers(t *testing.T) {
+	tf, err := newLogSyncTransform("default", MachineConfig{SyncerRedactTables: []string{"test"},
+		SyncerRedactKey: "secret"})
+	assert.Nil(t, err)
+	args, keep := tf.transformArgs([][]byte{[]byte("sadd"), []byte("test:k"), []byte("m1"), []byte("m2"), []byte("m1")})
+	assert.True(t, keep)
+	// the distinct members should be still distinct, and the same member should be the same
+	assert.NotEqual(t, string(args[2]), string(args[3]))
+	assert.Equal(t, string(args[2]), string(args[4]))
+	zargs, keep := tf.transformArgs([][]byte{[]byte("zadd"), []byte("test:k"), []byte("1"), []byte("m1"), []byte("2"), []byte("m2")})
+	assert.True(t, keep)
+	assert.Equal(t, "1", string(zargs[2]))
+	assert.Equal(t, string(args[2]), string(zargs[3]))
+	assert.Equal(t, "2", string(zargs[4]))
+	assert.Equal(t, string(args[3]), string(zargs[5]))
+
+	// the members are hashed with the key
+	tf2, err := newLogSyncTransform("default", MachineConfig{SyncerRedactTables: []string{"test"},
+		SyncerRedactKey: "other"})
+	assert.Nil(t, err)
+	args2, _ := tf2.transformArgs([][]byte{[]byte("sadd"), []byte("test:k"), []byte("m1")})
+	assert.NotEqual(t, string(args[2]), string(args2[2]))
+}
+
+type testTableDropTransformer struct{}
+
+func (testTableDropTransformer) Transform(ns string, args [][]byte) ([][]byte, bool) {
+	if strings.HasPrefix(string(args[1]), "drop:") {
+		return nil, false
+	}
+	return args, true
+}
+
+func TestLogSyncTransformReqs(t *testing.T) {
+	tf, err := newLogSyncTransform("default", MachineConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, tf)
+	_, err = newLogSyncTransform("default", MachineConfig{SyncerTransformers: []string{"test_drop"}})
+	assert.NotNil(t, err)
+
+	RegisterLogSyncTransformer("test_drop", testTableDropTransformer{})
+	tf, err = newLogSyncTransform("default", MachineConfig{
+		SyncerTableMapping: map[string]string{"test": "test_new"},
+		SyncerTransformers: []string{"test_drop"},
+	})
+	assert.Nil(t, err)
+	var reqList BatchInternalRaftRequest
+	reqList.Reqs = []*InternalRaftRequest{
+		buildTestRedisReq(1, "mset", "test:k1", "v1", "other:k2", "v2"),
+		buildTestRedisReq(2, "set", "drop:k", "v"),
+		{Header: &RequestHeader{ID: 3, DataType: int32(CustomReq)}, Data: []byte("custom")},
+	}
+	origin := reqList.Reqs[0].Data
+	reqList.ReqNum = int32(len(reqList.Reqs))
+	assert.Equal(t, 1, tf.transformReqs(&reqList))
+	assert.Equal(t, int32(2), reqList.ReqNum)
+	cmd, err := redcon.Parse(reqList.Reqs[0].Data)
+	assert.Nil(t, err)
+	assert.Equal(t, "test_new:k1", string(cmd.Args[1]))
+	assert.Equal(t, "other:k2", string(cmd.Args[3]))
+	assert.Equal(t, "custom", string(reqList.Reqs[1].Data))
+	// the origin request is not changed
+	cmd, err = redcon.Parse(origin)
+	assert.Nil(t, err)
+	assert.Equal(t, "test:k1", string(cmd.Args[1]))
+}
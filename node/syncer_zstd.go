@@ -0,0 +1,15 @@
+// +build cgo
+
+package node
+
+import (
+	"github.com/DataDog/zstd"
+)
+
+func zstdCompress(data []byte) ([]byte, error) {
+	return zstd.Compress(nil, data)
+}
+
+func zstdDecompress(data []byte) ([]byte, error) {
+	return zstd.Decompress(nil, data)
+}
@@ -16,6 +16,7 @@ import (
 var (
 	expireCmds                [common.ALL - common.NONE][]byte
 	ErrExpiredBatchedBuffFull = errors.New("the expired data batched buffer is full now")
+	errInvalidSetexTime       = errors.New("ERR invalid expire time in 'setex' command")
 )
 
 const (
@@ -80,6 +81,8 @@ func (nd *KVNode) zsetExpireCommand(conn redcon.Conn, cmd redcon.Command, v inte
 func (kvsm *kvStoreSM) localSetexCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	if duration, err := strconv.Atoi(string(cmd.Args[2])); err != nil {
 		return nil, err
+	} else if duration <= 0 {
+		return nil, errInvalidSetexTime
 	} else {
 		return nil, kvsm.store.SetEx(ts, cmd.Args[1], int64(duration), cmd.Args[3])
 	}
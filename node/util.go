@@ -60,6 +60,36 @@ func buildCommand(args [][]byte) redcon.Command {
 	return ncmd
 }
 
+// propose the write from redis connection, the client request id set on
+// the connection will be used only once.
+// The client address will be kept in the raft log for the audit log.
+func (nd *KVNode) proposeFromConn(conn redcon.Conn, buf []byte) (interface{}, error) {
+	h := &RequestHeader{
+		ID:         nd.rn.reqIDGen.Next(),
+		DataType:   int32(RedisReq),
+		ClientAddr: conn.RemoteAddr(),
+	}
+	if creq, ok := conn.Context().(*ClientRequestID); ok && creq != nil {
+		conn.SetContext(nil)
+		h.ClientId = creq.ClientID
+		h.ClientSeq = creq.Seq
+	}
+	return nd.proposeWithHeader(h, buf)
+}
+
+// propose the merge write with the client request id taken from the redis connection
+func (nd *KVNode) proposeWithClientReq(creq *ClientRequestID, buf []byte) (interface{}, error) {
+	h := &RequestHeader{
+		ID:       nd.rn.reqIDGen.Next(),
+		DataType: int32(RedisReq),
+	}
+	if creq != nil {
+		h.ClientId = creq.ClientID
+		h.ClientSeq = creq.Seq
+	}
+	return nd.proposeWithHeader(h, buf)
+}
+
 func rebuildFirstKeyAndPropose(kvn *KVNode, conn redcon.Conn, cmd redcon.Command) (redcon.Command,
 	interface{}, bool) {
 	_, key, err := common.ExtractNamesapce(cmd.Args[1])
@@ -77,7 +107,7 @@ func rebuildFirstKeyAndPropose(kvn *KVNode, conn redcon.Conn, cmd redcon.Command
 	ncmd := buildCommand(cmd.Args)
 	copy(cmd.Raw[0:], ncmd.Raw[:])
 	cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
-	rsp, err := kvn.Propose(cmd.Raw)
+	rsp, err := kvn.proposeFromConn(conn, cmd.Raw)
 	if err != nil {
 		conn.WriteError(err.Error())
 		return cmd, nil, false
@@ -88,7 +118,7 @@ func rebuildFirstKeyAndPropose(kvn *KVNode, conn redcon.Conn, cmd redcon.Command
 func wrapReadCommandK(f common.CommandFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 2 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		_, key, err := common.ExtractNamesapce(cmd.Args[1])
@@ -104,7 +134,7 @@ func wrapReadCommandK(f common.CommandFunc) common.CommandFunc {
 func wrapReadCommandKSubkey(f common.CommandFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 3 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		_, key, err := common.ExtractNamesapce(cmd.Args[1])
@@ -120,7 +150,7 @@ func wrapReadCommandKSubkey(f common.CommandFunc) common.CommandFunc {
 func wrapReadCommandKSubkeySubkey(f common.CommandFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 3 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		_, key, err := common.ExtractNamesapce(cmd.Args[1])
@@ -140,7 +170,7 @@ func wrapReadCommandKAnySubkey(f common.CommandFunc) common.CommandFunc {
 func wrapReadCommandKAnySubkeyN(f common.CommandFunc, minSubLen int) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 2+minSubLen {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		_, key, err := common.ExtractNamesapce(cmd.Args[1])
@@ -156,7 +186,7 @@ func wrapReadCommandKAnySubkeyN(f common.CommandFunc, minSubLen int) common.Comm
 func wrapReadCommandKK(f common.CommandFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 2 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		if len(cmd.Args[1:]) >= common.MAX_BATCH_NUM {
@@ -178,7 +208,7 @@ func wrapReadCommandKK(f common.CommandFunc) common.CommandFunc {
 func wrapWriteCommandK(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 2 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -192,7 +222,7 @@ func wrapWriteCommandK(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc
 func wrapWriteCommandKK(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 2 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		args := cmd.Args[1:]
@@ -217,7 +247,7 @@ func wrapWriteCommandKK(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.Propose(cmd.Raw)
+		rsp, err := kvn.proposeFromConn(conn, cmd.Raw)
 		if err != nil {
 			conn.WriteError(err.Error())
 			return
@@ -230,7 +260,7 @@ func wrapWriteCommandKK(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc
 func wrapWriteCommandKSubkey(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 3 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -244,7 +274,7 @@ func wrapWriteCommandKSubkey(kvn *KVNode, f common.CommandRspFunc) common.Comman
 func wrapWriteCommandKSubkeySubkey(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 3 {
-			conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -258,7 +288,7 @@ func wrapWriteCommandKSubkeySubkey(kvn *KVNode, f common.CommandRspFunc) common.
 func wrapWriteCommandKAnySubkey(kvn *KVNode, f common.CommandRspFunc, minSubKeyLen int) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 2+minSubKeyLen {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -272,7 +302,7 @@ func wrapWriteCommandKAnySubkey(kvn *KVNode, f common.CommandRspFunc, minSubKeyL
 func wrapWriteCommandKV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 3 {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -286,7 +316,7 @@ func wrapWriteCommandKV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc
 func wrapWriteCommandKVV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 3 {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -300,7 +330,7 @@ func wrapWriteCommandKVV(kvn *KVNode, f common.CommandRspFunc) common.CommandFun
 func wrapWriteCommandKVKV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 3 || len(cmd.Args[1:])%2 != 0 {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		if len(cmd.Args[1:])/2 >= common.MAX_BATCH_NUM {
@@ -328,7 +358,7 @@ func wrapWriteCommandKVKV(kvn *KVNode, f common.CommandRspFunc) common.CommandFu
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.Propose(cmd.Raw)
+		rsp, err := kvn.proposeFromConn(conn, cmd.Raw)
 		if err != nil {
 			conn.WriteError(err.Error())
 			return
@@ -340,7 +370,7 @@ func wrapWriteCommandKVKV(kvn *KVNode, f common.CommandRspFunc) common.CommandFu
 func wrapWriteCommandKSubkeyV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) != 4 {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		cmd, rsp, ok := rebuildFirstKeyAndPropose(kvn, conn, cmd)
@@ -354,7 +384,7 @@ func wrapWriteCommandKSubkeyV(kvn *KVNode, f common.CommandRspFunc) common.Comma
 func wrapWriteCommandKSubkeyVSubkeyV(kvn *KVNode, f common.CommandRspFunc) common.CommandFunc {
 	return func(conn redcon.Conn, cmd redcon.Command) {
 		if len(cmd.Args) < 4 || len(cmd.Args[2:])%2 != 0 {
-			conn.WriteError("ERR wrong number arguments for '" + string(cmd.Args[0]) + "' command")
+			conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 			return
 		}
 		if len(cmd.Args[2:])/2 >= common.MAX_BATCH_NUM {
@@ -400,8 +430,21 @@ func wrapMergeCommandKK(f common.MergeCommandFunc) common.MergeCommandFunc {
 	}
 }
 
-func wrapWriteMergeCommandKK(kvn *KVNode, f common.MergeWriteCommandFunc) common.MergeCommandFunc {
-	return func(cmd redcon.Command) (interface{}, error) {
+// the merge write handler which proposes with the client request id if not nil
+type clientReqMergeWriteFunc func(cmd redcon.Command, creq *ClientRequestID) (interface{}, error)
+
+func (nd *KVNode) registerWriteMerge(name string, f clientReqMergeWriteFunc) {
+	if nd.clientReqMergeWrites == nil {
+		nd.clientReqMergeWrites = make(map[string]clientReqMergeWriteFunc)
+	}
+	nd.clientReqMergeWrites[name] = f
+	nd.router.RegisterWriteMerge(name, func(cmd redcon.Command) (interface{}, error) {
+		return f(cmd, nil)
+	})
+}
+
+func wrapWriteMergeCommandKK(kvn *KVNode, f common.MergeWriteCommandFunc) clientReqMergeWriteFunc {
+	return func(cmd redcon.Command, creq *ClientRequestID) (interface{}, error) {
 		if len(cmd.Args) < 2 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", string(cmd.Args[0]))
 		}
@@ -423,7 +466,7 @@ func wrapWriteMergeCommandKK(kvn *KVNode, f common.MergeWriteCommandFunc) common
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.Propose(cmd.Raw)
+		rsp, err := kvn.proposeWithClientReq(creq, cmd.Raw)
 		if err != nil {
 			return nil, err
 		}
@@ -432,10 +475,10 @@ func wrapWriteMergeCommandKK(kvn *KVNode, f common.MergeWriteCommandFunc) common
 	}
 }
 
-func wrapWriteMergeCommandKVKV(kvn *KVNode, f common.MergeWriteCommandFunc) common.MergeCommandFunc {
-	return func(cmd redcon.Command) (interface{}, error) {
+func wrapWriteMergeCommandKVKV(kvn *KVNode, f common.MergeWriteCommandFunc) clientReqMergeWriteFunc {
+	return func(cmd redcon.Command, creq *ClientRequestID) (interface{}, error) {
 		if len(cmd.Args) < 3 || len(cmd.Args[1:])%2 != 0 {
-			return nil, fmt.Errorf("ERR wrong number arguments for '%s' command", string(cmd.Args[0]))
+			return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", string(cmd.Args[0]))
 		}
 		if len(cmd.Args[1:])/2 >= common.MAX_BATCH_NUM {
 			return nil, errTooMuchBatchSize
@@ -458,7 +501,7 @@ func wrapWriteMergeCommandKVKV(kvn *KVNode, f common.MergeWriteCommandFunc) comm
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.Propose(cmd.Raw)
+		rsp, err := kvn.proposeWithClientReq(creq, cmd.Raw)
 		if err != nil {
 			return nil, err
 		}
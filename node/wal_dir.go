@@ -0,0 +1,90 @@
+package node
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/pkg/fileutil"
+)
+
+// getWALDir return the raft wal directory for the replica, the wal can be placed on the
+// low latency disk separated from the data if the wal root dir is configured.
+func getWALDir(machineConfig *MachineConfig, config *RaftConfig) string {
+	walName := fmt.Sprintf("wal-%d", config.ID)
+	if machineConfig.WALRootDir == "" {
+		return path.Join(config.DataDir, walName)
+	}
+	return path.Join(machineConfig.WALRootDir, config.GroupName, walName)
+}
+
+// migrateWALDir move the wal from the old directory (under the data dir before the wal
+// root dir configured) to the new directory, the copy is used if the rename failed
+// across the devices and the old wal is removed only after all copied.
+func migrateWALDir(oldDir string, newDir string) error {
+	if oldDir == newDir || !fileutil.Exist(oldDir) {
+		return nil
+	}
+	if fileutil.Exist(newDir) {
+		names, err := fileutil.ReadDir(newDir)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return fmt.Errorf("both the old wal %v and the new wal %v exist", oldDir, newDir)
+		}
+		os.Remove(newDir)
+	}
+	if err := os.MkdirAll(path.Dir(newDir), common.DIR_PERM); err != nil {
+		return err
+	}
+	nodeLog.Infof("migrating the wal from %v to %v", oldDir, newDir)
+	err := os.Rename(oldDir, newDir)
+	if err == nil {
+		return nil
+	}
+	nodeLog.Infof("rename wal failed: %v, try copy", err)
+	tmpDir := newDir + ".tmp"
+	os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(tmpDir, common.DIR_PERM); err != nil {
+		return err
+	}
+	names, err := fileutil.ReadDir(oldDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = copyWALFile(path.Join(oldDir, name), path.Join(tmpDir, name))
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+	if err := os.Rename(tmpDir, newDir); err != nil {
+		return err
+	}
+	nodeLog.Infof("wal copied from %v to %v", oldDir, newDir)
+	return os.RemoveAll(oldDir)
+}
+
+func copyWALFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
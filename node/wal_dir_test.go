@@ -0,0 +1,45 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/pkg/fileutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateWALDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wal-migrate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	conf := &RaftConfig{ID: 1, GroupName: "test-0", DataDir: path.Join(tmpDir, "data", "test-0")}
+	oldDir := getWALDir(&MachineConfig{}, conf)
+	assert.Equal(t, path.Join(conf.DataDir, "wal-1"), oldDir)
+	newDir := getWALDir(&MachineConfig{WALRootDir: path.Join(tmpDir, "wal")}, conf)
+	assert.Equal(t, path.Join(tmpDir, "wal", "test-0", "wal-1"), newDir)
+
+	// nothing to migrate
+	assert.Nil(t, migrateWALDir(oldDir, newDir))
+	assert.False(t, fileutil.Exist(newDir))
+
+	assert.Nil(t, os.MkdirAll(oldDir, 0755))
+	assert.Nil(t, ioutil.WriteFile(path.Join(oldDir, "0000000000000000-0000000000000000.wal"), []byte("wal"), 0644))
+	assert.Nil(t, migrateWALDir(oldDir, newDir))
+	assert.False(t, fileutil.Exist(oldDir))
+	d, err := ioutil.ReadFile(path.Join(newDir, "0000000000000000-0000000000000000.wal"))
+	assert.Nil(t, err)
+	assert.Equal(t, "wal", string(d))
+
+	// should not overwrite the wal in the new dir
+	assert.Nil(t, os.MkdirAll(oldDir, 0755))
+	assert.Nil(t, ioutil.WriteFile(path.Join(oldDir, "0000000000000001-0000000000000010.wal"), []byte("wal"), 0644))
+	assert.NotNil(t, migrateWALDir(oldDir, newDir))
+
+	assert.Nil(t, copyWALFile(path.Join(newDir, "0000000000000000-0000000000000000.wal"), path.Join(tmpDir, "copied.wal")))
+	d, err = ioutil.ReadFile(path.Join(tmpDir, "copied.wal"))
+	assert.Nil(t, err)
+	assert.Equal(t, "wal", string(d))
+}
@@ -11,7 +11,8 @@ import (
 )
 
 var (
-	errInvalidRange = errors.New("Invalid range string")
+	errInvalidRange    = errors.New("ERR min or max is not a float")
+	errInvalidLexRange = errors.New("ERR min or max not valid string range item")
 )
 
 func getScoreRange(left []byte, right []byte) (float64, float64, error) {
@@ -32,7 +33,7 @@ func getScoreRange(left []byte, right []byte) (float64, float64, error) {
 		}
 		leftRange, err = strconv.ParseFloat(string(rangeD), 64)
 		if err != nil {
-			return leftRange, rightRange, err
+			return leftRange, rightRange, errInvalidRange
 		}
 		if leftRange <= common.MinScore || leftRange >= common.MaxScore {
 			return leftRange, rightRange, errInvalidRange
@@ -52,7 +53,7 @@ func getScoreRange(left []byte, right []byte) (float64, float64, error) {
 		}
 		rightRange, err = strconv.ParseFloat(string(rangeD), 64)
 		if err != nil {
-			return leftRange, rightRange, err
+			return leftRange, rightRange, errInvalidRange
 		}
 		if rightRange <= common.MinScore || rightRange >= common.MaxScore {
 			return leftRange, rightRange, errInvalidRange
@@ -67,7 +68,7 @@ func getScoreRange(left []byte, right []byte) (float64, float64, error) {
 
 func getLexRange(left []byte, right []byte) ([]byte, []byte, uint8, error) {
 	if len(left) == 0 || len(right) == 0 {
-		return nil, nil, 0, errInvalidRange
+		return nil, nil, 0, errInvalidLexRange
 	}
 	var err error
 	rangeType := common.RangeClose
@@ -82,7 +83,7 @@ func getLexRange(left []byte, right []byte) ([]byte, []byte, uint8, error) {
 			isLOpen = false
 			left = left[1:]
 		} else {
-			return left, right, rangeType, errInvalidRange
+			return left, right, rangeType, errInvalidLexRange
 		}
 	}
 	isROpen := false
@@ -96,7 +97,7 @@ func getLexRange(left []byte, right []byte) ([]byte, []byte, uint8, error) {
 			isROpen = false
 			right = right[1:]
 		} else {
-			return left, right, rangeType, errInvalidRange
+			return left, right, rangeType, errInvalidLexRange
 		}
 	}
 	if isLOpen && isROpen {
@@ -120,7 +121,7 @@ func (nd *KVNode) zscoreCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zcountCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	min, max, err := getScoreRange(cmd.Args[2], cmd.Args[3])
@@ -139,7 +140,7 @@ func (nd *KVNode) zcountCommand(conn redcon.Conn, cmd redcon.Command) {
 func (nd *KVNode) zcardCommand(conn redcon.Conn, cmd redcon.Command) {
 	n, err := nd.store.ZCard(cmd.Args[1])
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	conn.WriteInt64(n)
@@ -147,17 +148,17 @@ func (nd *KVNode) zcardCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zlexcountCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	start, stop, rt, err := getLexRange(cmd.Args[2], cmd.Args[3])
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	n, err := nd.store.ZLexCount(cmd.Args[1], start, stop, rt)
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	conn.WriteInt64(n)
@@ -165,17 +166,17 @@ func (nd *KVNode) zlexcountCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zrangeFunc(conn redcon.Conn, cmd redcon.Command, reverse bool) {
 	if len(cmd.Args) != 4 && len(cmd.Args) != 5 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	start, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	end, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	needScore := false
@@ -190,7 +191,7 @@ func (nd *KVNode) zrangeFunc(conn redcon.Conn, cmd redcon.Command, reverse bool)
 
 	vlist, err := nd.store.ZRangeGeneric(cmd.Args[1], int(start), int(end), reverse)
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	if needScore {
@@ -216,34 +217,34 @@ func (nd *KVNode) zrevrangeCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zrangebylexCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 && len(cmd.Args) != 7 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	start, stop, rt, err := getLexRange(cmd.Args[2], cmd.Args[3])
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	offset := 0
 	count := -1
 	if len(cmd.Args) == 7 {
 		if strings.ToLower(string(cmd.Args[4])) != "limit" {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(errSyntaxError.Error())
 			return
 		}
 		if offset, err = strconv.Atoi(string(cmd.Args[5])); err != nil {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(common.ErrRedisNotInteger.Error())
 			return
 		}
 		if count, err = strconv.Atoi(string(cmd.Args[6])); err != nil {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(common.ErrRedisNotInteger.Error())
 			return
 		}
 	}
 
 	vlist, err := nd.store.ZRangeByLex(cmd.Args[1], start, stop, rt, offset, count)
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	conn.WriteArray(len(vlist))
@@ -254,7 +255,7 @@ func (nd *KVNode) zrangebylexCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zrangebyscoreFunc(conn redcon.Conn, cmd redcon.Command, reverse bool) {
 	if len(cmd.Args) < 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	var min float64
@@ -266,7 +267,7 @@ func (nd *KVNode) zrangebyscoreFunc(conn redcon.Conn, cmd redcon.Command, revers
 		min, max, err = getScoreRange(cmd.Args[3], cmd.Args[2])
 	}
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	args := cmd.Args[4:]
@@ -282,26 +283,26 @@ func (nd *KVNode) zrangebyscoreFunc(conn redcon.Conn, cmd redcon.Command, revers
 	count := -1
 	if len(args) > 0 {
 		if len(args) != 3 {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(errSyntaxError.Error())
 			return
 		}
 		if strings.ToLower(string(args[0])) != "limit" {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(errSyntaxError.Error())
 			return
 		}
 		if offset, err = strconv.Atoi(string(args[1])); err != nil {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(common.ErrRedisNotInteger.Error())
 			return
 		}
 		if count, err = strconv.Atoi(string(args[2])); err != nil {
-			conn.WriteError(common.ErrInvalidArgs.Error())
+			conn.WriteError(common.ErrRedisNotInteger.Error())
 			return
 		}
 	}
 
 	vlist, err := nd.store.ZRangeByScoreGeneric(cmd.Args[1], min, max, offset, count, reverse)
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	if needScore {
@@ -328,7 +329,7 @@ func (nd *KVNode) zrevrangebyscoreCommand(conn redcon.Conn, cmd redcon.Command)
 func (nd *KVNode) zrankCommand(conn redcon.Conn, cmd redcon.Command) {
 	v, err := nd.store.ZRank(cmd.Args[1], cmd.Args[2])
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	if v < 0 {
@@ -341,7 +342,7 @@ func (nd *KVNode) zrankCommand(conn redcon.Conn, cmd redcon.Command) {
 func (nd *KVNode) zrevrankCommand(conn redcon.Conn, cmd redcon.Command) {
 	v, err := nd.store.ZRevRank(cmd.Args[1], cmd.Args[2])
 	if err != nil {
-		conn.WriteError("Err: " + err.Error())
+		conn.WriteError(err.Error())
 		return
 	}
 	if v < 0 {
@@ -353,7 +354,7 @@ func (nd *KVNode) zrevrankCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zaddCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) < 4 || len(cmd.Args)%2 != 0 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	_, err := getScorePairs(cmd.Args[2:])
@@ -376,7 +377,7 @@ func (nd *KVNode) zaddCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zincrbyCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	_, err := strconv.ParseFloat(string(cmd.Args[2]), 64)
@@ -408,17 +409,17 @@ func (nd *KVNode) zremCommand(conn redcon.Conn, cmd redcon.Command, v interface{
 
 func (nd *KVNode) zremrangebyrankCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 	_, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 	_, err = strconv.ParseInt(string(cmd.Args[3]), 10, 64)
 	if err != nil {
-		conn.WriteError("Invalid index: " + err.Error())
+		conn.WriteError(common.ErrRedisNotInteger.Error())
 		return
 	}
 
@@ -436,7 +437,7 @@ func (nd *KVNode) zremrangebyrankCommand(conn redcon.Conn, cmd redcon.Command) {
 
 func (nd *KVNode) zremrangebyscoreCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 
@@ -460,7 +461,7 @@ func (nd *KVNode) zremrangebyscoreCommand(conn redcon.Conn, cmd redcon.Command)
 
 func (nd *KVNode) zremrangebylexCommand(conn redcon.Conn, cmd redcon.Command) {
 	if len(cmd.Args) != 4 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
 		return
 	}
 
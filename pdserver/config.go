@@ -17,11 +17,36 @@ type ServerConfig struct {
 	ClusterLeadershipAddresses string   `flag:"cluster-leadership-addresses" cfg:"cluster_leadership_addresses"`
 	AutoBalanceAndMigrate      bool     `flag:"auto-balance-and-migrate"`
 	BalanceInterval            []string `flag:"balance-interval"`
+	BalanceByLoad              bool     `flag:"balance-by-load"`
 
 	LogLevel    int32  `flag:"log-level" cfg:"log_level"`
 	LogDir      string `flag:"log-dir" cfg:"log_dir"`
 	DataDir     string `flag:"data-dir" cfg:"data_dir"`
 	LearnerRole string `flag:"learner-role" cfg:"learner_role"`
+
+	NodeDownThresholdSecs   int64 `flag:"node-down-threshold-secs" cfg:"node_down_threshold_secs"`
+	MigrateGraceSecs        int64 `flag:"migrate-grace-secs" cfg:"migrate_grace_secs"`
+	EmergencyGraceSecs      int64 `flag:"emergency-grace-secs" cfg:"emergency_grace_secs"`
+	MaxRecoveries           int   `flag:"max-recoveries" cfg:"max_recoveries"`
+	FailoverConfirmMaxNodes int   `flag:"failover-confirm-max-nodes" cfg:"failover_confirm_max_nodes"`
+
+	NamespaceExpireGraceSecs int64  `flag:"namespace-expire-grace-secs" cfg:"namespace_expire_grace_secs"`
+	NamespaceExpireHook      string `flag:"namespace-expire-hook" cfg:"namespace_expire_hook"`
+
+	EtcdCertFile   string `flag:"etcd-cert-file" cfg:"etcd_cert_file"`
+	EtcdKeyFile    string `flag:"etcd-key-file" cfg:"etcd_key_file"`
+	EtcdCACertFile string `flag:"etcd-ca-cert-file" cfg:"etcd_ca_cert_file"`
+
+	// run the embedded etcd as the metadata store instead of the external etcd cluster, the
+	// placedrivers in the initial cluster (name=peer_url list) form the raft group of the store.
+	EmbedEtcd               bool   `flag:"embed-etcd" cfg:"embed_etcd"`
+	EmbedEtcdName           string `flag:"embed-etcd-name" cfg:"embed_etcd_name"`
+	EmbedEtcdClientURLs     string `flag:"embed-etcd-client-urls" cfg:"embed_etcd_client_urls"`
+	EmbedEtcdPeerURLs       string `flag:"embed-etcd-peer-urls" cfg:"embed_etcd_peer_urls"`
+	EmbedEtcdInitialCluster string `flag:"embed-etcd-initial-cluster" cfg:"embed_etcd_initial_cluster"`
+	EmbedEtcdJoinExisting   bool   `flag:"embed-etcd-join-existing" cfg:"embed_etcd_join_existing"`
+	// the seconds waiting the embedded etcd ready while starting, default to 60
+	EmbedEtcdStartTimeoutSecs int `flag:"embed-etcd-start-timeout-secs" cfg:"embed_etcd_start_timeout_secs"`
 }
 
 func NewServerConfig() *ServerConfig {
@@ -0,0 +1,97 @@
+package pdserver
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+	"github.com/coreos/etcd/pkg/types"
+)
+
+const (
+	defaultEmbedEtcdClientPort   = "2379"
+	defaultEmbedEtcdPeerPort     = "2380"
+	defaultEmbedEtcdStartTimeout = time.Minute
+)
+
+var (
+	errEmbedEtcdStartTimeout = errors.New("timeout while waiting the embedded etcd ready")
+	errEmbedEtcdStartAborted = errors.New("the placedriver stopped while waiting the embedded etcd ready")
+)
+
+// startEmbedEtcd start the embedded etcd as the metadata store, the placedrivers in the initial
+// cluster form the raft group, and the single node group with this placedriver is used if the
+// initial cluster is not configured. The client urls of the embedded etcd are returned. It waits
+// until the etcd is ready, which needs the quorum of the initial cluster started.
+func startEmbedEtcd(conf *ServerConfig, nodeIP string, stopC <-chan struct{}) (*embed.Etcd, string, error) {
+	cfg := embed.NewConfig()
+	cfg.Name = conf.EmbedEtcdName
+	if cfg.Name == "" {
+		cfg.Name = nodeIP
+	}
+	cfg.Dir = filepath.Join(conf.DataDir, "embed_etcd")
+	clientURLs := conf.EmbedEtcdClientURLs
+	if clientURLs == "" {
+		clientURLs = "http://" + net.JoinHostPort(nodeIP, defaultEmbedEtcdClientPort)
+	}
+	peerURLs := conf.EmbedEtcdPeerURLs
+	if peerURLs == "" {
+		peerURLs = "http://" + net.JoinHostPort(nodeIP, defaultEmbedEtcdPeerPort)
+	}
+	curls, err := types.NewURLs(strings.Split(clientURLs, ","))
+	if err != nil {
+		return nil, "", err
+	}
+	purls, err := types.NewURLs(strings.Split(peerURLs, ","))
+	if err != nil {
+		return nil, "", err
+	}
+	cfg.LCUrls, cfg.ACUrls = curls, curls
+	cfg.LPUrls, cfg.APUrls = purls, purls
+	cfg.InitialCluster = conf.EmbedEtcdInitialCluster
+	if cfg.InitialCluster == "" {
+		cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	}
+	cfg.InitialClusterToken = conf.ClusterID
+	if conf.EmbedEtcdJoinExisting {
+		cfg.ClusterState = embed.ClusterStateFlagExisting
+	}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	timeout := defaultEmbedEtcdStartTimeout
+	if conf.EmbedEtcdStartTimeoutSecs > 0 {
+		timeout = time.Duration(conf.EmbedEtcdStartTimeoutSecs) * time.Second
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(timeout):
+		e.Close()
+		return nil, "", errEmbedEtcdStartTimeout
+	case <-stopC:
+		e.Close()
+		return nil, "", errEmbedEtcdStartAborted
+	}
+	sLog.Infof("embedded etcd %v started, client urls: %v, peer urls: %v, initial cluster: %v",
+		cfg.Name, clientURLs, peerURLs, cfg.InitialCluster)
+	return e, clientURLs, nil
+}
+
+// waitEmbedEtcdFailed wait until the embedded etcd failed or the placedriver stopped, the
+// error is returned if failed.
+func waitEmbedEtcdFailed(errC <-chan error, stopC <-chan struct{}) error {
+	select {
+	case err, ok := <-errC:
+		if !ok {
+			return errors.New("the embedded etcd stopped")
+		}
+		return err
+	case <-stopC:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package pdserver
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func getTestFreeURL(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func newTestEmbedEtcdConf(t *testing.T) *ServerConfig {
+	tmpDir, err := ioutil.TempDir("", "embed-etcd-test")
+	assert.Nil(t, err)
+	conf := NewServerConfig()
+	conf.ClusterID = "test"
+	conf.DataDir = tmpDir
+	conf.EmbedEtcd = true
+	conf.EmbedEtcdName = "pd1"
+	conf.EmbedEtcdClientURLs = getTestFreeURL(t)
+	conf.EmbedEtcdPeerURLs = getTestFreeURL(t)
+	return conf
+}
+
+func TestStartEmbedEtcd(t *testing.T) {
+	conf := newTestEmbedEtcdConf(t)
+	defer os.RemoveAll(conf.DataDir)
+	e, clientURLs, err := startEmbedEtcd(conf, "127.0.0.1", nil)
+	assert.Nil(t, err)
+	defer e.Close()
+	assert.Equal(t, conf.EmbedEtcdClientURLs, clientURLs)
+
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{clientURLs}, DialTimeout: time.Second * 5})
+	assert.Nil(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = c.Put(ctx, "test_key", "test_value")
+	assert.Nil(t, err)
+	rsp, err := c.Get(ctx, "test_key")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rsp.Kvs))
+	assert.Equal(t, "test_value", string(rsp.Kvs[0].Value))
+}
+
+func TestStartEmbedEtcdNoQuorum(t *testing.T) {
+	conf := newTestEmbedEtcdConf(t)
+	defer os.RemoveAll(conf.DataDir)
+	// the other members are never started, so the etcd will never be ready
+	conf.EmbedEtcdInitialCluster = "pd1=" + conf.EmbedEtcdPeerURLs +
+		",pd2=" + getTestFreeURL(t) + ",pd3=" + getTestFreeURL(t)
+	conf.EmbedEtcdStartTimeoutSecs = 1
+	start := time.Now()
+	_, _, err := startEmbedEtcd(conf, "127.0.0.1", nil)
+	assert.Equal(t, errEmbedEtcdStartTimeout, err)
+	assert.True(t, time.Since(start) < defaultEmbedEtcdStartTimeout)
+
+	os.RemoveAll(conf.DataDir)
+	conf.EmbedEtcdStartTimeoutSecs = 0
+	stopC := make(chan struct{})
+	time.AfterFunc(time.Second, func() { close(stopC) })
+	_, _, err = startEmbedEtcd(conf, "127.0.0.1", stopC)
+	assert.Equal(t, errEmbedEtcdStartAborted, err)
+}
+
+func TestWaitEmbedEtcdFailed(t *testing.T) {
+	errC := make(chan error, 1)
+	stopC := make(chan struct{})
+	testErr := errors.New("test etcd error")
+	errC <- testErr
+	assert.Equal(t, testErr, waitEmbedEtcdFailed(errC, stopC))
+
+	close(errC)
+	assert.NotNil(t, waitEmbedEtcdFailed(errC, stopC))
+
+	close(stopC)
+	assert.Nil(t, waitEmbedEtcdFailed(make(chan error), stopC))
+}
@@ -9,8 +9,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/cluster/pdnode_coord"
 	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/julienschmidt/httprouter"
 )
@@ -23,8 +25,16 @@ type nodeInfo struct {
 	GrpcPort         string `json:"grpc_port"`
 	Version          string `json:"version"`
 	DCInfo           string `json:"dc_info"`
+	Zone             string `json:"zone,omitempty"`
+	Rack             string `json:"rack,omitempty"`
+	ID               string `json:"id,omitempty"`
 }
 
+const (
+	maxQueryWaitTime       = time.Minute
+	queryWaitCheckInterval = time.Millisecond * 200
+)
+
 type PartitionNodeInfo struct {
 	Leader   nodeInfo   `json:"leader"`
 	Replicas []nodeInfo `json:"replicas"`
@@ -78,8 +88,13 @@ func (s *Server) initHttpHandler() {
 	// cluster prefix url means only handled by leader of pd
 	router.Handle("GET", "/cluster/stats", common.Decorate(s.doClusterStats, common.V1))
 	router.Handle("POST", "/cluster/balance", common.Decorate(s.doClusterSwitchBalance, log, common.V1))
+	router.Handle("GET", "/cluster/node/loads", common.Decorate(s.doGetNodeLoads, common.V1))
+	router.Handle("GET", "/cluster/leader/exclude", common.Decorate(s.doGetLeaderExcluded, common.V1))
+	router.Handle("POST", "/cluster/leader/exclude", common.Decorate(s.doSetLeaderExcluded, log, common.V1))
 	router.Handle("POST", "/cluster/pd/tombstone", common.Decorate(s.doClusterTombstonePD, log, common.V1))
 	router.Handle("POST", "/cluster/node/remove", common.Decorate(s.doClusterRemoveDataNode, log, common.V1))
+	router.Handle("POST", "/cluster/node/decommission", common.Decorate(s.doDecommissionDataNode, log, common.V1))
+	router.Handle("GET", "/cluster/node/decommission", common.Decorate(s.doGetDecommissionStatus, common.V1))
 	router.Handle("POST", "/cluster/upgrade/begin", common.Decorate(s.doClusterBeginUpgrade, log, common.V1))
 	router.Handle("POST", "/cluster/upgrade/done", common.Decorate(s.doClusterFinishUpgrade, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/create", common.Decorate(s.doCreateNamespace, log, common.V1))
@@ -87,6 +102,42 @@ func (s *Server) initHttpHandler() {
 	router.Handle("POST", "/cluster/schema/index/add", common.Decorate(s.doAddIndexSchema, log, common.V1))
 	router.Handle("DELETE", "/cluster/schema/index/del", common.Decorate(s.doDelIndexSchema, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/meta/update", common.Decorate(s.doUpdateNamespaceMeta, log, common.V1))
+	router.Handle("GET", "/cluster/namespace/replica", common.Decorate(s.doGetNamespaceReplicaStatus, common.V1))
+	router.Handle("POST", "/cluster/namespace/expand", common.Decorate(s.doExpandNamespace, log, common.V1))
+	router.Handle("GET", "/cluster/namespace/expand", common.Decorate(s.doGetNamespaceExpandStatus, common.V1))
+	router.Handle("POST", "/cluster/namespace/merge", common.Decorate(s.doMergeNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/freeze", common.Decorate(s.doFreezeNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/unfreeze", common.Decorate(s.doUnfreezeNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/expire", common.Decorate(s.doSetNamespaceExpire, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/rename", common.Decorate(s.doRenameNamespace, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/clone", common.Decorate(s.doCloneNamespace, log, common.V1))
+	router.Handle("GET", "/cluster/namespace/clone", common.Decorate(s.doGetNamespaceCloneStatus, common.V1))
+	router.Handle("GET", "/cluster/namespace/placement/rules", common.Decorate(s.doGetPlacementRules, common.V1))
+	router.Handle("POST", "/cluster/namespace/placement/rules", common.Decorate(s.doSetPlacementRules, log, common.V1))
+	router.Handle("POST", "/cluster/namespace/placement/rules/dryrun", common.Decorate(s.doDryRunPlacementRules, log, common.V1))
+	router.Handle("POST", "/cluster/partition/leader/transfer", common.Decorate(s.doTransferPartitionLeader, log, common.V1))
+	router.Handle("GET", "/cluster/migrations", common.Decorate(s.doGetMigrations, common.V1))
+	router.Handle("POST", "/cluster/migration/pause", common.Decorate(s.doPauseMigration, log, common.V1))
+	router.Handle("POST", "/cluster/migration/resume", common.Decorate(s.doResumeMigration, log, common.V1))
+	router.Handle("POST", "/cluster/migration/cancel", common.Decorate(s.doCancelMigration, log, common.V1))
+	router.Handle("GET", "/cluster/schedule", common.Decorate(s.doGetSchedulePaused, common.V1))
+	router.Handle("POST", "/cluster/schedule/pause", common.Decorate(s.doPauseSchedule, log, common.V1))
+	router.Handle("POST", "/cluster/schedule/resume", common.Decorate(s.doResumeSchedule, log, common.V1))
+	router.Handle("GET", "/cluster/operators", common.Decorate(s.doGetOperators, common.V1))
+	router.Handle("GET", "/cluster/operators/audit", common.Decorate(s.doGetOperatorAudit, common.V1))
+	router.Handle("POST", "/cluster/operator/cancel", common.Decorate(s.doCancelOperator, log, common.V1))
+	router.Handle("GET", "/cluster/topology", common.Decorate(s.doGetClusterTopology, common.V1))
+	router.Handle("GET", "/cluster/failover/policy", common.Decorate(s.doGetFailoverPolicy, common.V1))
+	router.Handle("POST", "/cluster/failover/policy", common.Decorate(s.doSetFailoverPolicy, log, common.V1))
+	router.Handle("GET", "/cluster/failover/pending", common.Decorate(s.doGetPendingFailovers, common.V1))
+	router.Handle("POST", "/cluster/failover/confirm", common.Decorate(s.doConfirmFailover, log, common.V1))
+	router.Handle("GET", "/cluster/dynamic_conf", common.Decorate(s.doGetDynamicConf, common.V1))
+	router.Handle("POST", "/cluster/dynamic_conf", common.Decorate(s.doSetDynamicConf, log, common.V1))
+	router.Handle("POST", "/cluster/backup", common.Decorate(s.doClusterBackup, log, common.V1))
+	router.Handle("GET", "/cluster/backup/last", common.Decorate(s.doGetLastClusterBackup, common.V1))
+	router.Handle("GET", "/cluster/backup/schedule", common.Decorate(s.doGetBackupSchedules, common.V1))
+	router.Handle("POST", "/cluster/backup/schedule", common.Decorate(s.doSetBackupSchedule, log, common.V1))
+	router.Handle("GET", "/cluster/placement/violations", common.Decorate(s.doCheckPlacement, common.V1))
 	router.Handle("POST", "/stable/nodenum", common.Decorate(s.doSetStableNodeNum, log, common.V1))
 
 	router.Handle("POST", "/loglevel/set", common.Decorate(s.doSetLogLevel, log, common.V1))
@@ -138,6 +189,9 @@ func (s *Server) getDataNodes(w http.ResponseWriter, req *http.Request, ps httpr
 			GrpcPort:         n.RpcPort,
 			DCInfo:           dcInfo,
 		}
+		dn.Zone, _ = n.Tags[cluster.ZoneTag].(string)
+		dn.Rack, _ = n.Tags[cluster.RackTag].(string)
+		dn.ID = n.GetID()
 		nodes = append(nodes, dn)
 	}
 	if len(nodes) == 0 {
@@ -179,6 +233,12 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 	}
 	epoch := reqParams.Get("epoch")
 	disableCache := reqParams.Get("disable_cache")
+	// wait the namespaces changed from the epoch for the long polling watch
+	waitMs, _ := strconv.ParseInt(reqParams.Get("wait_ms"), 10, 64)
+	waitTime := time.Duration(waitMs) * time.Millisecond
+	if waitTime > maxQueryWaitTime {
+		waitTime = maxQueryWaitTime
+	}
 
 	namespaces, curEpoch, err := s.pdCoord.GetAllNamespaces()
 	if err != nil {
@@ -187,7 +247,22 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 		}
 		sLog.Infof("get namespaces error, using cached data %v", curEpoch)
 	}
+	waitEnd := time.Now().Add(waitTime)
+	for epoch == strconv.FormatInt(curEpoch, 10) && time.Now().Before(waitEnd) {
+		select {
+		case <-req.Context().Done():
+			return nil, common.HttpErr{Code: 304, Text: "cluster namespaces unchanged"}
+		case <-time.After(queryWaitCheckInterval):
+		}
+		if newNamespaces, newEpoch, err := s.pdCoord.GetAllNamespaces(); err == nil {
+			namespaces, curEpoch = newNamespaces, newEpoch
+		}
+	}
 	nsPartsInfo, ok := namespaces[ns]
+	if !ok {
+		// the renamed namespace can be queried by the new name
+		nsPartsInfo, ok = namespaces[pdnode_coord.FindNamespaceByAlias(namespaces, ns)]
+	}
 	if !ok {
 		return nil, common.HttpErr{Code: 404, Text: "NAMESPACE not found"}
 	}
@@ -202,6 +277,10 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 	for _, nsInfo := range nsPartsInfo {
 		pnum = nsInfo.PartitionNum
 		engType = nsInfo.EngType
+		// the new partitions are not routable until the expansion switched
+		if nsInfo.Partition >= nsInfo.PartitionNum {
+			continue
+		}
 		var pn PartitionNodeInfo
 		for _, nid := range nsInfo.RaftNodes {
 			n, ok := dns[nid]
@@ -250,11 +329,42 @@ func (s *Server) doClusterStats(w http.ResponseWriter, req *http.Request, ps htt
 		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
 	}
 	stable = s.pdCoord.IsClusterStable()
+	under, over, err := s.pdCoord.GetReplicaStatus("", false)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
 
 	return struct {
 		Stable bool `json:"stable"`
+		// the partitions with the replicas less or more than expected
+		UnderReplicated int `json:"under_replicated"`
+		OverReplicated  int `json:"over_replicated"`
 	}{
-		Stable: stable,
+		Stable:          stable,
+		UnderReplicated: len(under),
+		OverReplicated:  len(over),
+	}, nil
+}
+
+func (s *Server) doGetNamespaceReplicaStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	under, over, err := s.pdCoord.GetReplicaStatus(ns, reqParams.Get("check_ready") != "false")
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"under_replicated": under,
+		"over_replicated":  over,
 	}, nil
 }
 
@@ -277,6 +387,47 @@ func (s *Server) doClusterSwitchBalance(w http.ResponseWriter, req *http.Request
 	} else {
 		s.pdCoord.SwitchAutoBalance(false)
 	}
+	if byLoad := reqParams.Get("by_load"); byLoad != "" {
+		s.pdCoord.SwitchBalanceByLoad(byLoad == "true")
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetNodeLoads(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	loads, err := s.pdCoord.GetNodeLoads()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"balance_by_load": s.pdCoord.IsBalanceByLoad(),
+		"loads":           loads,
+	}, nil
+}
+
+func (s *Server) doGetLeaderExcluded(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return map[string]interface{}{
+		"nodes": s.pdCoord.GetLeaderExcludedNodes(),
+	}, nil
+}
+
+func (s *Server) doSetLeaderExcluded(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		sLog.Infof("request from remote %v should request to leader", req.RemoteAddr)
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	nid := reqParams.Get("node")
+	if nid == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NODE"}
+	}
+	excluded, err := strconv.ParseBool(reqParams.Get("enable"))
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_ENABLE"}
+	}
+	s.pdCoord.SetNodeLeaderExcluded(nid, excluded)
 	return nil, nil
 }
 
@@ -333,6 +484,39 @@ func (s *Server) doClusterRemoveDataNode(w http.ResponseWriter, req *http.Reques
 	return nil, nil
 }
 
+func (s *Server) doDecommissionDataNode(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		sLog.Infof("request from remote %v should request to leader", req.RemoteAddr)
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	nid := reqParams.Get("node")
+	if nid == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NODE"}
+	}
+	err = s.pdCoord.DecommissionNode(nid)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetDecommissionStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	return map[string]interface{}{
+		"decommissions": s.pdCoord.GetNodeDecommissionStatus(reqParams.Get("node")),
+	}, nil
+}
+
 func (s *Server) doClusterBeginUpgrade(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	err := s.pdCoord.SetClusterUpgradeState(true)
 	if err != nil {
@@ -392,6 +576,38 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_EXPIRATION_POLICY"}
 	}
 
+	var rockOpts common.RockOptionsOverride
+	if optsStr := reqParams.Get("rocksdb_opts"); optsStr != "" {
+		err := json.Unmarshal([]byte(optsStr), &rockOpts)
+		if err == nil {
+			err = rockOpts.CheckValid()
+		}
+		if err != nil {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_ROCKSDB_OPTS"}
+		}
+	}
+
+	quotaKeys, quotaBytes, err := parseNamespaceQuota(reqParams.Get("quota_max_keys"),
+		reqParams.Get("quota_max_bytes"), 0)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_QUOTA"}
+	}
+	retentionBytes, retentionSecs, err := parseLogRetention(reqParams.Get("log_retention_bytes"),
+		reqParams.Get("log_retention_secs"), 0)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_LOG_RETENTION"}
+	}
+
+	// the namespace will be deleted after the ttl and the grace period
+	var expireTime int64
+	if ttlStr := reqParams.Get("ttl_secs"); ttlStr != "" {
+		ttl, err := strconv.ParseInt(ttlStr, 10, 64)
+		if err != nil || ttl <= 0 {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_TTL_SECS"}
+		}
+		expireTime = time.Now().Unix() + ttl
+	}
+
 	tagStr := reqParams.Get("tags")
 	var tagList []string
 	if tagStr != "" {
@@ -411,6 +627,12 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 	meta.Replica = replicator
 	meta.EngType = engType
 	meta.ExpirationPolicy = expPolicy
+	meta.RocksDBOpts = rockOpts
+	meta.QuotaMaxKeys = quotaKeys
+	meta.QuotaMaxBytes = quotaBytes
+	meta.LogRetentionBytes = retentionBytes
+	meta.LogRetentionSecs = retentionSecs
+	meta.ExpireTime = expireTime
 	meta.Tags = make(map[string]interface{})
 	for _, tag := range tagList {
 		if strings.TrimSpace(tag) != "" {
@@ -426,6 +648,44 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 	return nil, nil
 }
 
+// parse the quota of namespace, the default value will be used if not given
+func parseNamespaceQuota(keysStr string, bytesStr string, def int64) (int64, int64, error) {
+	maxKeys, maxBytes := def, def
+	var err error
+	if keysStr != "" {
+		maxKeys, err = strconv.ParseInt(keysStr, 10, 64)
+		if err != nil || maxKeys < 0 {
+			return 0, 0, errors.New("invalid quota max keys")
+		}
+	}
+	if bytesStr != "" {
+		maxBytes, err = strconv.ParseInt(bytesStr, 10, 64)
+		if err != nil || maxBytes < 0 {
+			return 0, 0, errors.New("invalid quota max bytes")
+		}
+	}
+	return maxKeys, maxBytes, nil
+}
+
+// parse the raft log retention of namespace, the default value will be used if not given
+func parseLogRetention(bytesStr string, secsStr string, def int64) (int64, int64, error) {
+	maxBytes, maxSecs := def, def
+	var err error
+	if bytesStr != "" {
+		maxBytes, err = strconv.ParseInt(bytesStr, 10, 64)
+		if err != nil || maxBytes < 0 {
+			return 0, 0, errors.New("invalid log retention bytes")
+		}
+	}
+	if secsStr != "" {
+		maxSecs, err = strconv.ParseInt(secsStr, 10, 64)
+		if err != nil || maxSecs < 0 {
+			return 0, 0, errors.New("invalid log retention seconds")
+		}
+	}
+	return maxBytes, maxSecs, nil
+}
+
 func (s *Server) doDeleteNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -593,13 +853,44 @@ func (s *Server) doUpdateNamespaceMeta(w http.ResponseWriter, req *http.Request,
 		}
 	}
 
+	quotaKeysStr := reqParams.Get("quota_max_keys")
+	quotaBytesStr := reqParams.Get("quota_max_bytes")
+	quotaKeys, quotaBytes, err := parseNamespaceQuota(quotaKeysStr, quotaBytesStr, -1)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_QUOTA"}
+	}
+	retentionBytesStr := reqParams.Get("log_retention_bytes")
+	retentionSecsStr := reqParams.Get("log_retention_secs")
+	retentionBytes, retentionSecs, err := parseLogRetention(retentionBytesStr, retentionSecsStr, -1)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_LOG_RETENTION"}
+	}
+
 	if !s.pdCoord.IsMineLeader() {
 		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
 	}
-	err = s.pdCoord.ChangeNamespaceMetaParam(ns, replicator, optimizeFsyncStr, snapCount)
-	if err != nil {
-		sLog.Infof("update namespace meta failed: %v, %v", ns, err)
-		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	quotaChanged := quotaKeysStr != "" || quotaBytesStr != ""
+	retentionChanged := retentionBytesStr != "" || retentionSecsStr != ""
+	if (!quotaChanged && !retentionChanged) || replicatorStr != "" || optimizeFsyncStr != "" || snapStr != "" {
+		err = s.pdCoord.ChangeNamespaceMetaParam(ns, replicator, optimizeFsyncStr, snapCount)
+		if err != nil {
+			sLog.Infof("update namespace meta failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 400, Text: err.Error()}
+		}
+	}
+	if quotaChanged {
+		err = s.pdCoord.ChangeNamespaceQuota(ns, quotaKeys, quotaBytes)
+		if err != nil {
+			sLog.Infof("update namespace quota failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 400, Text: err.Error()}
+		}
+	}
+	if retentionChanged {
+		err = s.pdCoord.ChangeNamespaceLogRetention(ns, retentionBytes, retentionSecs)
+		if err != nil {
+			sLog.Infof("update namespace log retention failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 400, Text: err.Error()}
+		}
 	}
 	return nil, nil
 
@@ -631,28 +922,681 @@ func (s *Server) doRemoveNamespaceLearner(w http.ResponseWriter, req *http.Reque
 	return nil, nil
 }
 
-func (s *Server) doSetStableNodeNum(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+func (s *Server) doTransferPartitionLeader(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
 		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
 	}
 
-	numStr := reqParams.Get("number")
-	if numStr == "" {
-		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NUMBER"}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
 	}
-	num, err := strconv.Atoi(numStr)
+	if !common.IsValidNamespaceName(ns) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	pid, err := strconv.Atoi(reqParams.Get("partition"))
 	if err != nil {
-		return nil, common.HttpErr{Code: 400, Text: "BAD_ARG_STRING"}
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_PARTITION"}
 	}
-	err = s.pdCoord.SetClusterStableNodeNum(num)
+	nid := reqParams.Get("node")
+	if nid == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NODE"}
+	}
+
+	err = s.pdCoord.TransferPartitionLeader(ns, pid, nid)
 	if err != nil {
+		sLog.Infof("namespace %v-%v transfer leader to %v failed: %v", ns, pid, nid, err)
 		return nil, common.HttpErr{Code: 400, Text: err.Error()}
 	}
+	return nil, nil
+}
+
+func getPlacementRulesArgs(req *http.Request) (string, []cluster.PlacementRule, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return "", nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return "", nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return "", nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var rules []cluster.PlacementRule
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &rules)
+		if err != nil {
+			sLog.Infof("placement rules body unmarshal error: %v, %v", ns, err)
+			return "", nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+	}
+	return ns, rules, nil
+}
+
+func (s *Server) doGetPlacementRules(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	rules, err := s.pdCoord.GetPlacementRules(ns)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"rules": rules,
+	}, nil
+}
+
+func (s *Server) doSetPlacementRules(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns, rules, err := getPlacementRulesArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.SetPlacementRules(ns, rules)
+	if err != nil {
+		sLog.Infof("set placement rules failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doDryRunPlacementRules(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns, rules, err := getPlacementRulesArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	plans, err := s.pdCoord.DryRunPlacementRules(ns, rules)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"plans": plans,
+	}, nil
+}
+
+func (s *Server) doGetSchedulePaused(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	paused, nsList := s.pdCoord.GetSchedulePaused()
+	return map[string]interface{}{
+		"paused":            paused,
+		"paused_namespaces": nsList,
+	}, nil
+}
+
+func (s *Server) switchSchedulePaused(req *http.Request, paused bool) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		sLog.Infof("request from remote %v should request to leader", req.RemoteAddr)
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	// pause all the namespaces if no namespace
+	ns := reqParams.Get("namespace")
+	sLog.Infof("schedule of namespace %v paused: %v by %v", ns, paused, req.RemoteAddr)
+	s.pdCoord.PauseSchedule(ns, paused)
+	return nil, nil
+}
+
+func (s *Server) doPauseSchedule(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.switchSchedulePaused(req, true)
+}
+
+func (s *Server) doResumeSchedule(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.switchSchedulePaused(req, false)
+}
+
+func (s *Server) doGetOperators(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	ops, err := s.pdCoord.GetScheduleOperators()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"operators": ops,
+	}, nil
+}
 
+func (s *Server) doGetOperatorAudit(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return map[string]interface{}{
+		"records": s.pdCoord.GetOperatorAuditRecords(),
+	}, nil
+}
+
+func (s *Server) doCancelOperator(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	id, err := strconv.ParseInt(reqParams.Get("id"), 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_ID"}
+	}
+	err = s.pdCoord.CancelScheduleOperator(id)
+	if err == pdnode_coord.ErrOperatorNotFound {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+	} else if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
 	return nil, nil
 }
 
+func (s *Server) doGetMigrations(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	return map[string]interface{}{
+		"migrations": s.pdCoord.GetPartitionMigrations(),
+	}, nil
+}
+
+func getNamespacePartitionArgs(req *http.Request) (string, int, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return "", 0, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return "", 0, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	pid, err := strconv.Atoi(reqParams.Get("partition"))
+	if err != nil {
+		return "", 0, common.HttpErr{Code: 400, Text: "MISSING_ARG_PARTITION"}
+	}
+	return ns, pid, nil
+}
+
+func (s *Server) doPauseMigration(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.setMigrationPaused(req, true)
+}
+
+func (s *Server) doResumeMigration(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.setMigrationPaused(req, false)
+}
+
+func (s *Server) setMigrationPaused(req *http.Request, paused bool) (interface{}, error) {
+	ns, pid, err := getNamespacePartitionArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	err = s.pdCoord.PausePartitionMigration(ns, pid, paused)
+	if err == pdnode_coord.ErrMigrationNotFound {
+		return nil, common.HttpErr{Code: 404, Text: err.Error()}
+	} else if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doCancelMigration(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns, pid, err := getNamespacePartitionArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	err = s.pdCoord.CancelPartitionMigration(ns, pid)
+	if err == pdnode_coord.ErrMigrationNotFound {
+		return nil, common.HttpErr{Code: 404, Text: err.Error()}
+	} else if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doSetStableNodeNum(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+
+	numStr := reqParams.Get("number")
+	if numStr == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NUMBER"}
+	}
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "BAD_ARG_STRING"}
+	}
+	err = s.pdCoord.SetClusterStableNodeNum(num)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+
+	return nil, nil
+}
+
+// return the full topology of the cluster for the dashboard
+func (s *Server) doGetClusterTopology(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		sLog.Debugf("request from remote %v should request to leader", req.RemoteAddr)
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	topo, err := s.pdCoord.GetClusterTopology()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return topo, nil
+}
+
+func (s *Server) doClusterBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		sLog.Infof("request from remote %v should request to leader", req.RemoteAddr)
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	var namespaces []string
+	if nsStr := reqParams.Get("namespace"); nsStr != "" {
+		namespaces = strings.Split(nsStr, ",")
+	}
+	timeout := 0
+	if tstr := reqParams.Get("timeout_sec"); tstr != "" {
+		timeout, err = strconv.Atoi(tstr)
+		if err != nil {
+			return nil, common.HttpErr{Code: 400, Text: "BAD_ARG_TIMEOUT"}
+		}
+	}
+	manifest, err := s.pdCoord.BackupCluster(namespaces, time.Duration(timeout)*time.Second)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return manifest, nil
+}
+
+func (s *Server) doGetLastClusterBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	manifest := s.pdCoord.GetLastBackupManifest()
+	if manifest == nil {
+		return nil, common.HttpErr{Code: 404, Text: "NO_CLUSTER_BACKUP"}
+	}
+	return manifest, nil
+}
+
+func (s *Server) doCheckPlacement(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	violations, err := s.pdCoord.CheckPlacementConstraints()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"violations": violations,
+	}, nil
+}
+
+func (s *Server) doExpandNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	pnumStr := reqParams.Get("partition_num")
+	if pnumStr == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_PARTITION_NUM"}
+	}
+	pnum, err := GetValidPartitionNum(pnumStr)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_PARTITION_NUM"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.ExpandNamespacePartitions(ns, pnum)
+	if err != nil {
+		sLog.Infof("expand namespace %v to %v partitions failed: %v", ns, pnum, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doMergeNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	pnumStr := reqParams.Get("partition_num")
+	if pnumStr == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_PARTITION_NUM"}
+	}
+	pnum, err := GetValidPartitionNum(pnumStr)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_PARTITION_NUM"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.MergeNamespacePartitions(ns, pnum)
+	if err != nil {
+		sLog.Infof("merge namespace %v to %v partitions failed: %v", ns, pnum, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doFreezeNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.changeNamespaceFrozen(req, true)
+}
+
+func (s *Server) doUnfreezeNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.changeNamespaceFrozen(req, false)
+}
+
+func (s *Server) changeNamespaceFrozen(req *http.Request, frozen bool) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.FreezeNamespace(ns, frozen)
+	if err != nil {
+		sLog.Infof("change namespace %v frozen to %v failed: %v", ns, frozen, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+// change the ttl of the namespace from now, 0 means the namespace will never be expired
+func (s *Server) doSetNamespaceExpire(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	ttl, err := strconv.ParseInt(reqParams.Get("ttl_secs"), 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_TTL_SECS"}
+	}
+	var expireTime time.Time
+	if ttl > 0 {
+		expireTime = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.SetNamespaceExpireTime(ns, expireTime)
+	if err != nil {
+		sLog.Infof("set namespace %v expire time failed: %v", ns, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"expire_time": expireTime,
+	}, nil
+}
+
+func (s *Server) doRenameNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	// the empty new name remove the name changed before
+	newName := reqParams.Get("new_name")
+	if newName != "" && !common.IsValidNamespaceName(newName) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_NEW_NAME"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.RenameNamespace(ns, newName)
+	if err != nil {
+		sLog.Infof("rename namespace %v to %v failed: %v", ns, newName, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doCloneNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	target := reqParams.Get("target")
+	if target == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_TARGET"}
+	}
+	if !common.IsValidNamespaceName(target) {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_TARGET"}
+	}
+	// the target is placed on the nodes with the tags, the same as the source if not given
+	var tags map[string]interface{}
+	if tagStr := reqParams.Get("tags"); tagStr != "" {
+		tags = make(map[string]interface{})
+		for _, tag := range strings.Split(tagStr, ",") {
+			if strings.TrimSpace(tag) != "" {
+				tags[strings.TrimSpace(tag)] = true
+			}
+		}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.CloneNamespace(ns, target, tags)
+	if err != nil {
+		sLog.Infof("clone namespace %v to %v failed: %v", ns, target, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetNamespaceCloneStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	return s.pdCoord.GetNamespaceCloneStatus(reqParams.Get("target")), nil
+}
+
+func (s *Server) doGetFailoverPolicy(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.pdCoord.GetFailoverPolicy(), nil
+}
+
+// the policy fields not in the body will not be changed
+func (s *Server) doSetFailoverPolicy(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	fp := s.pdCoord.GetFailoverPolicy()
+	err = json.Unmarshal(data, &fp)
+	if err != nil {
+		sLog.Infof("failover policy body unmarshal error: %v", err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	err = s.pdCoord.SetFailoverPolicy(fp)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return fp, nil
+}
+
+func (s *Server) doGetPendingFailovers(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	return map[string]interface{}{
+		"pendings": s.pdCoord.GetPendingFailovers(),
+	}, nil
+}
+
+func (s *Server) doConfirmFailover(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	// confirm all the partitions of the namespace if not given
+	pid := -1
+	if pidStr := reqParams.Get("partition"); pidStr != "" {
+		pid, err = strconv.Atoi(pidStr)
+		if err != nil || pid < 0 {
+			return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_PARTITION"}
+		}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.ConfirmFailover(ns, pid)
+	if err == pdnode_coord.ErrFailoverNotPending {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+	} else if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetDynamicConf(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	conf, err := s.pdCoord.GetClusterDynamicConf()
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"conf": conf,
+		"keys": common.GetDynamicConfKeys(),
+	}, nil
+}
+
+// set the dynamic config for all the data nodes, the empty value remove the config
+func (s *Server) doSetDynamicConf(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	key := reqParams.Get("key")
+	if key == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_KEY"}
+	}
+	value := reqParams.Get("value")
+	if err := common.ValidateDynamicConf(key, value); err != nil {
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.SetClusterDynamicConf(key, value)
+	if err != nil {
+		sLog.Infof("set dynamic config %v=%v failed: %v", key, value, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetBackupSchedules(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	schedules, err := s.pdCoord.GetBackupSchedules(reqParams.Get("namespace"))
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return map[string]interface{}{
+		"schedules": schedules,
+	}, nil
+}
+
+// set the backup schedule of the namespace by the json body, the schedule will be removed if the body is empty
+func (s *Server) doSetBackupSchedule(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var schedule *cluster.BackupSchedule
+	if len(data) > 0 {
+		schedule = &cluster.BackupSchedule{}
+		err = json.Unmarshal(data, schedule)
+		if err != nil {
+			sLog.Infof("backup schedule body unmarshal error: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	err = s.pdCoord.SetBackupSchedule(ns, schedule)
+	if err != nil {
+		sLog.Infof("set backup schedule failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 400, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doGetNamespaceExpandStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	st, err := s.pdCoord.GetNamespaceExpandStatus(ns)
+	if err == cluster.ErrKeyNotFound {
+		return nil, common.HttpErr{Code: 404, Text: "NAMESPACE not found"}
+	} else if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return st, nil
+}
+
 func (s *Server) doSetLogLevel(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 	"github.com/absolute8511/ZanRedisDB/cluster"
 	"github.com/absolute8511/ZanRedisDB/cluster/pdnode_coord"
 	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/coreos/etcd/embed"
 )
 
 var sLog = common.NewLevelLogger(common.LOG_INFO, common.NewDefaultLogger("pdserver"))
@@ -26,11 +27,14 @@ func SLogger() *common.LevelLogger {
 type Server struct {
 	conf             *ServerConfig
 	stopC            chan struct{}
+	stopOnce         sync.Once
 	wg               sync.WaitGroup
 	router           http.Handler
 	pdCoord          *pdnode_coord.PDCoordinator
 	dataMutex        sync.Mutex
 	tombstonePDNodes map[string]bool
+	// the metadata store embedded in the placedriver, nil if the external etcd is used
+	embedEtcd *embed.Etcd
 }
 
 func NewServer(conf *ServerConfig) *Server {
@@ -71,6 +75,14 @@ func NewServer(conf *ServerConfig) *Server {
 	clusterOpts := &cluster.Options{}
 	clusterOpts.DataDir = conf.DataDir
 	clusterOpts.AutoBalanceAndMigrate = conf.AutoBalanceAndMigrate
+	clusterOpts.BalanceByLoad = conf.BalanceByLoad
+	clusterOpts.NodeDownThresholdSecs = conf.NodeDownThresholdSecs
+	clusterOpts.MigrateGraceSecs = conf.MigrateGraceSecs
+	clusterOpts.EmergencyGraceSecs = conf.EmergencyGraceSecs
+	clusterOpts.MaxRecoveries = conf.MaxRecoveries
+	clusterOpts.FailoverConfirmMaxNodes = conf.FailoverConfirmMaxNodes
+	clusterOpts.NamespaceExpireGraceSecs = conf.NamespaceExpireGraceSecs
+	clusterOpts.NamespaceExpireHook = conf.NamespaceExpireHook
 	if len(conf.BalanceInterval) == 2 {
 		clusterOpts.BalanceStart, err = strconv.Atoi(conf.BalanceInterval[0])
 		if err != nil {
@@ -90,17 +102,57 @@ func NewServer(conf *ServerConfig) *Server {
 		tombstonePDNodes: make(map[string]bool),
 	}
 
-	r := cluster.NewPDEtcdRegister(conf.ClusterLeadershipAddresses)
+	if conf.EmbedEtcd {
+		e, clientURLs, err := startEmbedEtcd(conf, myNode.NodeIP, s.stopC)
+		if err != nil {
+			sLog.Fatalf("failed to start the embedded etcd: %v", err)
+		}
+		s.embedEtcd = e
+		if conf.ClusterLeadershipAddresses == "" {
+			conf.ClusterLeadershipAddresses = clientURLs
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			err := waitEmbedEtcdFailed(e.Err(), s.stopC)
+			if err == nil {
+				return
+			}
+			// the metadata store is not available, the placedriver should be restarted
+			sLog.Errorf("embedded etcd error: %v, stopping the placedriver", err)
+			go func() {
+				s.Stop()
+				sLog.Fatalf("the placedriver stopped since the embedded etcd failed: %v", err)
+			}()
+		}()
+	}
+
+	r, err := cluster.NewPDEtcdRegister(conf.ClusterLeadershipAddresses, &cluster.EtcdTLSConfig{
+		CertFile:   conf.EtcdCertFile,
+		KeyFile:    conf.EtcdKeyFile,
+		CACertFile: conf.EtcdCACertFile,
+	})
+	if err != nil {
+		sLog.Fatalf("failed to init etcd register: %v", err)
+	}
+	if err := r.CheckMetaMigrated(conf.ClusterID); err != nil {
+		sLog.Fatalf("failed to check the meta data in etcd: %v", err)
+	}
 	s.pdCoord.SetRegister(r)
 
 	return s
 }
 
 func (s *Server) Stop() {
-	close(s.stopC)
-	s.pdCoord.Stop()
-	s.wg.Wait()
-	sLog.Infof("server stopped")
+	s.stopOnce.Do(func() {
+		close(s.stopC)
+		s.pdCoord.Stop()
+		s.wg.Wait()
+		if s.embedEtcd != nil {
+			s.embedEtcd.Close()
+		}
+		sLog.Infof("server stopped")
+	})
 }
 
 func (s *Server) Start() {
@@ -0,0 +1,14 @@
+// +build !windows
+
+package fileutil
+
+import "syscall"
+
+// DiskUsage return the total and the available bytes of the file system the dir is on.
+func DiskUsage(dir string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,10 @@
+// +build windows
+
+package fileutil
+
+import "errors"
+
+// DiskUsage return the total and the available bytes of the file system the dir is on.
+func DiskUsage(dir string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk usage is not supported on windows")
+}
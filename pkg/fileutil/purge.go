@@ -26,45 +26,58 @@ func PurgeFile(dirname string, suffix string, max uint, interval time.Duration,
 	return purgeFile(dirname, suffix, max, interval, stop, nil)
 }
 
+// PurgeFileOnce remove the oldest files with the suffix in the directory until the
+// number of files is not more than max, the locked files will be kept.
+func PurgeFileOnce(dirname string, suffix string, max uint) error {
+	_, err := purgeFileOnce(dirname, suffix, max)
+	return err
+}
+
+func purgeFileOnce(dirname string, suffix string, max uint) ([]string, error) {
+	fnames, err := ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	newfnames := make([]string, 0)
+	for _, fname := range fnames {
+		if strings.HasSuffix(fname, suffix) {
+			newfnames = append(newfnames, fname)
+		}
+	}
+	sort.Strings(newfnames)
+	fnames = newfnames
+	for len(newfnames) > int(max) {
+		f := filepath.Join(dirname, newfnames[0])
+		l, err := TryLockFile(f, os.O_WRONLY, PrivateFileMode)
+		if err != nil {
+			break
+		}
+		if err = os.Remove(f); err != nil {
+			return nil, err
+		}
+		if err = l.Close(); err != nil {
+			plog.Errorf("error unlocking %s when purging file (%v)", l.Name(), err)
+			return nil, err
+		}
+		plog.Infof("purged file %s successfully", f)
+		newfnames = newfnames[1:]
+	}
+	return fnames[:len(fnames)-len(newfnames)], nil
+}
+
 // purgeFile is the internal implementation for PurgeFile which can post purged files to purgec if non-nil.
 func purgeFile(dirname string, suffix string, max uint, interval time.Duration, stop <-chan struct{}, purgec chan<- string) <-chan error {
 	errC := make(chan error, 1)
 	go func() {
 		for {
-			fnames, err := ReadDir(dirname)
+			purged, err := purgeFileOnce(dirname, suffix, max)
 			if err != nil {
 				errC <- err
 				return
 			}
-			newfnames := make([]string, 0)
-			for _, fname := range fnames {
-				if strings.HasSuffix(fname, suffix) {
-					newfnames = append(newfnames, fname)
-				}
-			}
-			sort.Strings(newfnames)
-			fnames = newfnames
-			for len(newfnames) > int(max) {
-				f := filepath.Join(dirname, newfnames[0])
-				l, err := TryLockFile(f, os.O_WRONLY, PrivateFileMode)
-				if err != nil {
-					break
-				}
-				if err = os.Remove(f); err != nil {
-					errC <- err
-					return
-				}
-				if err = l.Close(); err != nil {
-					plog.Errorf("error unlocking %s when purging file (%v)", l.Name(), err)
-					errC <- err
-					return
-				}
-				plog.Infof("purged file %s successfully", f)
-				newfnames = newfnames[1:]
-			}
 			if purgec != nil {
-				for i := 0; i < len(fnames)-len(newfnames); i++ {
-					purgec <- fnames[i]
+				for _, f := range purged {
+					purgec <- f
 				}
 			}
 			select {
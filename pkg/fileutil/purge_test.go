@@ -175,3 +175,37 @@ func TestPurgeFileHoldingLockFile(t *testing.T) {
 
 	close(stop)
 }
+
+func TestPurgeFileOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purgefileonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 5; i++ {
+		f, ferr := os.Create(filepath.Join(dir, fmt.Sprintf("%d.test", i)))
+		if ferr != nil {
+			t.Fatal(ferr)
+		}
+		f.Close()
+	}
+	// the files with other suffix should be ignored
+	f, err := os.Create(filepath.Join(dir, "0.other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err = PurgeFileOnce(dir, "test", 2); err != nil {
+		t.Fatal(err)
+	}
+	fnames, rerr := ReadDir(dir)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	wnames := []string{"0.other", "3.test", "4.test"}
+	if !reflect.DeepEqual(fnames, wnames) {
+		t.Errorf("filenames = %v, want %v", fnames, wnames)
+	}
+}
@@ -191,6 +191,12 @@ type Config struct {
 	// logical clock from assigning the timestamp and then forwarding the data
 	// to the leader.
 	DisableProposalForwarding bool
+
+	// DisableCampaign is checked when the election timeout elapsed, the node will not
+	// start a campaign if it returns true. The node can still vote for others and can
+	// still be elected by the leader transfer. It is used to keep the node from being the
+	// leader while draining it.
+	DisableCampaign func() bool
 }
 
 func (c *Config) validate() error {
@@ -292,6 +298,7 @@ type raft struct {
 	// when raft changes its state to follower or candidate.
 	randomizedElectionTimeout int
 	disableProposalForwarding bool
+	disableCampaign           func() bool
 
 	tick func()
 	step stepFunc
@@ -353,6 +360,7 @@ func newRaft(c *Config) *raft {
 		preVote:                   c.PreVote,
 		readOnly:                  newReadOnly(c.ReadOnlyOption),
 		disableProposalForwarding: c.DisableProposalForwarding,
+		disableCampaign:           c.DisableCampaign,
 	}
 	for _, p := range peers {
 		r.prs[p.RaftReplicaId] = &Progress{Next: 1, ins: newInflights(r.maxInflight), group: p}
@@ -665,6 +673,9 @@ func (r *raft) tickElection() {
 
 	if r.promotable() && r.pastElectionTimeout() {
 		r.electionElapsed = 0
+		if r.disableCampaign != nil && r.disableCampaign() {
+			return
+		}
 		r.Step(pb.Message{From: r.id, FromGroup: r.group, Type: pb.MsgHup})
 	}
 }
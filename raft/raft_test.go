@@ -378,6 +378,46 @@ func TestLearnerElectionTimeout(t *testing.T) {
 	}
 }
 
+// TestDisableCampaignElectionTimeout verifies that the node should not start
+// election when the campaign is disabled, but it can still vote for others.
+func TestDisableCampaignElectionTimeout(t *testing.T) {
+	disabled := true
+	cfg := newTestConfig(1, []uint64{1, 2}, 10, 1, NewMemoryStorage())
+	cfg.DisableCampaign = func() bool { return disabled }
+	n1 := newRaft(cfg)
+	n2 := newTestRaft(2, []uint64{1, 2}, 10, 1, NewMemoryStorage())
+
+	n1.becomeFollower(1, None)
+	n2.becomeFollower(1, None)
+
+	setRandomizedElectionTimeout(n1, n1.electionTimeout)
+	for i := 0; i < n1.electionTimeout; i++ {
+		n1.tick()
+	}
+	if n1.state != StateFollower {
+		t.Errorf("peer 1 state: %s, want %s", n1.state, StateFollower)
+	}
+
+	nt := newNetwork(n1, n2)
+	nt.send(pb.Message{From: 2, To: 2, Type: pb.MsgHup})
+	if n2.state != StateLeader {
+		t.Errorf("peer 2 state: %s, want %s", n2.state, StateLeader)
+	}
+	if n1.state != StateFollower {
+		t.Errorf("peer 1 state: %s, want %s", n1.state, StateFollower)
+	}
+
+	disabled = false
+	n1.becomeFollower(n1.Term, None)
+	setRandomizedElectionTimeout(n1, n1.electionTimeout)
+	for i := 0; i < n1.electionTimeout; i++ {
+		n1.tick()
+	}
+	if n1.state == StateFollower {
+		t.Errorf("peer 1 state: %s, should start election", n1.state)
+	}
+}
+
 // TestLearnerPromotion verifies that the leaner should not election until
 // it is promoted to a normal peer.
 func TestLearnerPromotion(t *testing.T) {
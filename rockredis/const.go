@@ -19,6 +19,10 @@ const (
 	NoneType byte = 0
 	// 0~10 reserved for system usage
 
+	// the synced raft term-index from the remote cluster, which is used
+	// to ignore the duplicate sync after restart.
+	remoteSyncedStateType byte = 1
+
 	// table count, stats, index, schema, and etc.
 	TableMetaType      byte = 10
 	TableIndexMetaType byte = 11
@@ -90,6 +94,8 @@ var (
 	errDBClosed         = errors.New("the db is closed")
 	errNotMatch         = errors.New("not match")
 	errUnsuportType     = errors.New("unsupport type")
+	errCompactRunning   = errors.New("the compaction is already running")
+	errRecountRunning   = errors.New("the recount is already running")
 )
 
 const (
@@ -0,0 +1,150 @@
+// +build gofuzz
+
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// the fuzz targets for go-fuzz, build with:
+// go-fuzz-build -func FuzzDecodeKey github.com/absolute8511/ZanRedisDB/rockredis
+
+// FuzzDecodeKey check all the key decoders return the error instead of panic for the
+// malformed keys
+func FuzzDecodeKey(data []byte) int {
+	decoded := 0
+	check := func(err error) {
+		if err == nil {
+			decoded++
+		}
+	}
+	_, err := decodeKVKey(data)
+	check(err)
+	_, err = hDecodeSizeKey(data)
+	check(err)
+	_, _, _, err = hDecodeHashKey(data)
+	check(err)
+	_, err = lDecodeMetaKey(data)
+	check(err)
+	_, _, _, err = lDecodeListKey(data)
+	check(err)
+	_, err = sDecodeSizeKey(data)
+	check(err)
+	_, _, _, err = sDecodeSetKey(data)
+	check(err)
+	_, err = zDecodeSizeKey(data)
+	check(err)
+	_, _, _, err = zDecodeSetKey(data)
+	check(err)
+	_, _, _, _, err = zDecodeScoreKey(data)
+	check(err)
+	_, _, err = decodeJSONKey(data)
+	check(err)
+	_, _, err = expDecodeMetaKey(data)
+	check(err)
+	_, _, _, err = expDecodeTimeKey(data)
+	check(err)
+	_, err = decodeTableMetaKey(data)
+	check(err)
+	_, _, err = decodeTableIndexMetaKey(data)
+	check(err)
+	_, _, _, _, err = decodeHsetIndexNumberKey(data)
+	check(err)
+	_, _, _, _, err = decodeHsetIndexStringKey(data)
+	check(err)
+	_, _, _, _, err = decodeHsetIndexFloatKey(data)
+	check(err)
+	_, _, err = decodeZsetIndexKey([]byte("test"), data)
+	check(err)
+	_, _, err = decodeFullTextIndexKey([]byte("test"), []byte("index"), data)
+	check(err)
+	_, err = Decode(data, 3)
+	check(err)
+	if decoded > 0 {
+		return 1
+	}
+	return 0
+}
+
+// split the input to the table, the key and the field
+func splitFuzzInput(data []byte) ([]byte, []byte, []byte, bool) {
+	if len(data) < 2 {
+		return nil, nil, nil, false
+	}
+	tableLen := int(data[0])%(MaxTableNameLen-1) + 1
+	keyLen := int(data[1])
+	data = data[2:]
+	if len(data) < tableLen+keyLen {
+		return nil, nil, nil, false
+	}
+	return data[:tableLen], data[tableLen : tableLen+keyLen], data[tableLen+keyLen:], true
+}
+
+func checkDecoded(name string, expected [][]byte, decoded [][]byte, err error) {
+	if err != nil {
+		panic(fmt.Sprintf("decode %v key failed: %v, %v", name, expected, err))
+	}
+	for i := range expected {
+		if !bytes.Equal(expected[i], decoded[i]) {
+			panic(fmt.Sprintf("decode %v key mismatch: %v, %v", name, expected, decoded))
+		}
+	}
+}
+
+// FuzzKeyCodec check the encoded keys can be decoded to the same table, key and field
+func FuzzKeyCodec(data []byte) int {
+	table, key, field, ok := splitFuzzInput(data)
+	if !ok {
+		return 0
+	}
+	expected := [][]byte{table, key, field}
+
+	t, k, f, err := hDecodeHashKey(hEncodeHashKey(table, key, field))
+	checkDecoded("hash", expected, [][]byte{t, k, f}, err)
+	t, k, f, err = sDecodeSetKey(sEncodeSetKey(table, key, field))
+	checkDecoded("set", expected, [][]byte{t, k, f}, err)
+	t, k, f, err = zDecodeSetKey(zEncodeSetKey(table, key, field))
+	checkDecoded("zset", expected, [][]byte{t, k, f}, err)
+
+	var score float64
+	if len(field) >= 8 {
+		score = float64(int64(binary.BigEndian.Uint64(field)))
+	}
+	t, k, f, s, err := zDecodeScoreKey(zEncodeScoreKey(false, false, table, key, field, score))
+	checkDecoded("zset score", expected, [][]byte{t, k, f}, err)
+	if s != score {
+		panic(fmt.Sprintf("decode zset score mismatch: %v, %v", score, s))
+	}
+
+	seq := int64(len(field))
+	t, k, decodedSeq, err := lDecodeListKey(lEncodeListKey(table, key, seq))
+	checkDecoded("list", expected[:2], [][]byte{t, k}, err)
+	if decodedSeq != seq {
+		panic(fmt.Sprintf("decode list seq mismatch: %v, %v", seq, decodedSeq))
+	}
+
+	jk, err := encodeJSONKey(table, key)
+	if err != nil {
+		panic(err)
+	}
+	t, k, err = decodeJSONKey(jk)
+	checkDecoded("json", expected[:2], [][]byte{t, k}, err)
+
+	rk := packRedisKey(table, key)
+	dt, k, when, err := expDecodeTimeKey(expEncodeTimeKey(HashType, rk, seq))
+	checkDecoded("expire time", [][]byte{rk}, [][]byte{k}, err)
+	if dt != HashType || when != seq {
+		panic(fmt.Sprintf("decode expire time key mismatch: %v, %v", dt, when))
+	}
+
+	// the table name of the kv is split by the first separator
+	if bytes.IndexByte(table, tableStartSep) == -1 {
+		k, err = decodeKVKey(encodeKVKey(rk))
+		checkDecoded("kv", [][]byte{rk}, [][]byte{k}, err)
+		t, k, err = extractTableFromRedisKey(k)
+		checkDecoded("kv table", expected[:2], [][]byte{t, k}, err)
+	}
+	return 1
+}
@@ -3,10 +3,10 @@ package rockredis
 import (
 	"bytes"
 	"errors"
+	"strings"
 	"sync"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
 )
 
 var (
@@ -27,6 +27,7 @@ type JSONIndex struct {
 type TableIndexContainer struct {
 	sync.RWMutex
 	// field -> index name, to convert "secondaryindex.select * from table where field = xxx" to scan(/hindex/table/indexname/xxx)
+	// the composite index use all the fields separated by comma as the key
 	hsetIndexes map[string]*HsetIndex
 	jsonIndexes map[string]*JSONIndex
 }
@@ -49,6 +50,31 @@ func (tic *TableIndexContainer) GetHIndexNoLock(field string) *HsetIndex {
 	return index
 }
 
+// get the composite indexes which contain any of the fields, all the composite indexes
+// will be returned if fields is nil
+func (tic *TableIndexContainer) getCompositeIndexesNoLock(fields [][]byte) []*HsetIndex {
+	var indexes []*HsetIndex
+	for _, index := range tic.hsetIndexes {
+		if !index.isComposite() || index.State == InitIndex {
+			continue
+		}
+		if fields == nil {
+			indexes = append(indexes, index)
+			continue
+		}
+	check:
+		for _, f := range index.indexFields() {
+			for _, changed := range fields {
+				if bytes.Equal(f, changed) {
+					indexes = append(indexes, index)
+					break check
+				}
+			}
+		}
+	}
+	return indexes
+}
+
 func (tic *TableIndexContainer) marshalHsetIndexes() ([]byte, error) {
 	var indexList HsetIndexList
 	for _, v := range tic.hsetIndexes {
@@ -68,7 +94,7 @@ func (tic *TableIndexContainer) unmarshalHsetIndexes(table []byte, data []byte)
 		var hi HsetIndex
 		hi.HsetIndexInfo = v
 		hi.Table = table
-		tic.hsetIndexes[string(v.IndexField)] = &hi
+		tic.hsetIndexes[hi.indexKey()] = &hi
 	}
 	dbLog.Infof("load hash index: %v", indexList.String())
 	return nil
@@ -86,6 +112,23 @@ func (tic *TableIndexContainer) GetJSONIndexNoLock(path string) *JSONIndex {
 	return index
 }
 
+func (self *HsetIndex) toSchema() *common.HsetIndexSchema {
+	schema := &common.HsetIndexSchema{
+		Name:       string(self.Name),
+		IndexField: string(self.IndexField),
+		PrefixLen:  self.PrefixLen,
+		Unique:     self.Unique,
+		ValueType:  common.IndexPropertyDType(self.ValueType),
+		State:      common.IndexState(self.State),
+	}
+	for i, f := range self.CompositeFields {
+		schema.CompositeFields = append(schema.CompositeFields, string(f))
+		schema.CompositeValueTypes = append(schema.CompositeValueTypes,
+			common.IndexPropertyDType(self.fieldValueType(i+1)))
+	}
+	return schema
+}
+
 type IndexMgr struct {
 	sync.RWMutex
 	tableIndexes   map[string]*TableIndexContainer
@@ -113,14 +156,7 @@ func (im *IndexMgr) GetAllIndexSchemaInfo(db *RockDB) (map[string]*common.IndexS
 		var schema common.IndexSchema
 		t.RLock()
 		for _, v := range t.hsetIndexes {
-			schema.HsetIndexes = append(schema.HsetIndexes, &common.HsetIndexSchema{
-				Name:       string(v.Name),
-				IndexField: string(v.IndexField),
-				PrefixLen:  v.PrefixLen,
-				Unique:     v.Unique,
-				ValueType:  common.IndexPropertyDType(v.ValueType),
-				State:      common.IndexState(v.State),
-			})
+			schema.HsetIndexes = append(schema.HsetIndexes, v.toSchema())
 		}
 		//for _, v := range t.jsonIndexes {
 		//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
@@ -146,14 +182,7 @@ func (im *IndexMgr) GetIndexSchemaInfo(db *RockDB, table string) (*common.IndexS
 	}
 	t.RLock()
 	for _, v := range t.hsetIndexes {
-		schema.HsetIndexes = append(schema.HsetIndexes, &common.HsetIndexSchema{
-			Name:       string(v.Name),
-			IndexField: string(v.IndexField),
-			PrefixLen:  v.PrefixLen,
-			Unique:     v.Unique,
-			ValueType:  common.IndexPropertyDType(v.ValueType),
-			State:      common.IndexState(v.State),
-		})
+		schema.HsetIndexes = append(schema.HsetIndexes, v.toSchema())
 	}
 	//for _, v := range t.jsonIndexes {
 	//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
@@ -236,22 +265,23 @@ func (im *IndexMgr) AddHsetIndex(db *RockDB, hindex *HsetIndex) error {
 	im.Unlock()
 	indexes.Lock()
 	defer indexes.Unlock()
-	_, ok = indexes.hsetIndexes[string(hindex.IndexField)]
+	indexKey := hindex.indexKey()
+	_, ok = indexes.hsetIndexes[indexKey]
 	if ok {
 		return ErrIndexExist
 	}
 	hindex.State = InitIndex
-	indexes.hsetIndexes[string(hindex.IndexField)] = hindex
+	indexes.hsetIndexes[indexKey] = hindex
 	d, err := indexes.marshalHsetIndexes()
 	if err != nil {
-		indexes.hsetIndexes[string(hindex.IndexField)] = nil
-		delete(indexes.hsetIndexes, string(hindex.IndexField))
+		indexes.hsetIndexes[indexKey] = nil
+		delete(indexes.hsetIndexes, indexKey)
 		return err
 	}
 	err = db.SetTableHsetIndexValue(hindex.Table, d)
 	if err != nil {
-		indexes.hsetIndexes[string(hindex.IndexField)] = nil
-		delete(indexes.hsetIndexes, string(hindex.IndexField))
+		indexes.hsetIndexes[indexKey] = nil
+		delete(indexes.hsetIndexes, indexKey)
 		return err
 	}
 	dbLog.Infof("table %v add hash index %v", string(hindex.Table), hindex.String())
@@ -300,7 +330,7 @@ func (im *IndexMgr) UpdateHsetIndexState(db *RockDB, table string, field string,
 			if err != nil {
 				dbLog.Infof("failed to clean index: %v", err)
 			} else {
-				im.deleteHsetIndex(db, string(index.Table), string(index.IndexField))
+				im.deleteHsetIndex(db, string(index.Table), index.indexKey())
 			}
 		}()
 	} else if index.State == BuildingIndex {
@@ -346,6 +376,14 @@ func (im *IndexMgr) deleteHsetIndex(db *RockDB, table string, field string) erro
 	return nil
 }
 
+// remove all the indexes of the dropped table, the index meta and data
+// should be deleted by the caller.
+func (im *IndexMgr) dropTableIndexes(table string) {
+	im.Lock()
+	delete(im.tableIndexes, table)
+	im.Unlock()
+}
+
 func (im *IndexMgr) GetTableIndexes(table string) *TableIndexContainer {
 	im.RLock()
 	indexes, ok := im.tableIndexes[table]
@@ -356,6 +394,22 @@ func (im *IndexMgr) GetTableIndexes(table string) *TableIndexContainer {
 	return indexes
 }
 
+// HasUniqueHsetIndex return whether the table has any unique hash index
+func (im *IndexMgr) HasUniqueHsetIndex(table string) bool {
+	indexes := im.GetTableIndexes(table)
+	if indexes == nil {
+		return false
+	}
+	indexes.RLock()
+	defer indexes.RUnlock()
+	for _, hindex := range indexes.hsetIndexes {
+		if hindex.isUnique() {
+			return true
+		}
+	}
+	return false
+}
+
 func (im *IndexMgr) GetHsetIndex(table string, field string) (*HsetIndex, error) {
 	im.RLock()
 	indexes, ok := im.tableIndexes[table]
@@ -375,6 +429,39 @@ func (im *IndexMgr) GetHsetIndex(table string, field string) (*HsetIndex, error)
 	return index, nil
 }
 
+// find the index for searching, the composite index can be used if the fields
+// are the leading fields of it.
+func (im *IndexMgr) findHsetIndex(table string, fields string) (*HsetIndex, error) {
+	im.RLock()
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return nil, ErrIndexTableNotExist
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	index, ok := indexes.hsetIndexes[fields]
+	if ok {
+		return index, nil
+	}
+	prefix := fields + compositeFieldSep
+	for k, v := range indexes.hsetIndexes {
+		if !v.isComposite() || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		// prefer the index with less fields
+		if index == nil || len(k) < len(index.indexKey()) ||
+			(len(k) == len(index.indexKey()) && bytes.Compare(v.Name, index.Name) < 0) {
+			index = v
+		}
+	}
+	if index == nil {
+		return nil, ErrIndexNotExist
+	}
+	return index, nil
+}
+
 func (im *IndexMgr) buildIndexes(db *RockDB, stopChan chan struct{}) {
 	for {
 		select {
@@ -403,9 +490,20 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 		}
 		dbLog.Infof("begin rebuild index for table %v", table)
 		fields := make([][]byte, 0)
+		singleIndexes := make([]*HsetIndex, 0, len(tmpHsetIndexes))
+		compositeIndexes := make([]*HsetIndex, 0)
+		hasUnique := false
 		for _, hindex := range tmpHsetIndexes {
-			fields = append(fields, hindex.IndexField)
-			dbLog.Infof("begin rebuild index for field: %s", string(hindex.IndexField))
+			if hindex.isComposite() {
+				compositeIndexes = append(compositeIndexes, hindex)
+			} else {
+				fields = append(fields, hindex.IndexField)
+				singleIndexes = append(singleIndexes, hindex)
+			}
+			if hindex.isUnique() {
+				hasUnique = true
+			}
+			dbLog.Infof("begin rebuild index for field: %s", hindex.indexKey())
 		}
 
 		buildWg.Add(1)
@@ -437,7 +535,7 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 						dbLog.Infof("rebuild index for table %v error %v", buildTable, err)
 						return true, err
 					}
-					wb := gorocksdb.NewWriteBatch()
+					wb := db.eng.NewWriteBatch()
 					defer wb.Destroy()
 					for _, pk := range pkList {
 						if !bytes.HasPrefix(pk, origPrefix) {
@@ -446,17 +544,38 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 							cursor = nil
 							break
 						}
-						values, err := db.HMget(pk, fields...)
-						if err != nil {
-							dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
-							return true, err
+						if len(fields) > 0 {
+							values, err := db.HMget(pk, fields...)
+							if err != nil {
+								dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
+								return true, err
+							}
+							for i := range fields {
+								err = singleIndexes[i].UpdateRec(db, nil, values[i], pk, wb)
+								if err != nil {
+									dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
+									return true, err
+								}
+							}
 						}
-						for i := range fields {
-							err = tmpHsetIndexes[i].UpdateRec(nil, values[i], pk, wb)
+						for _, hindex := range compositeIndexes {
+							values, err := db.HMget(pk, hindex.indexFields()...)
 							if err != nil {
 								dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
 								return true, err
 							}
+							err = hindex.UpdateCompositeRec(nil, values, pk, wb)
+							if err != nil {
+								dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
+								return true, err
+							}
+						}
+						if hasUnique {
+							// the unique check need read the index written by the previous keys
+							if err = db.eng.Write(wb); err != nil {
+								return true, err
+							}
+							wb.Clear()
 						}
 						cursor = pk
 						indexPKCnt++
@@ -464,7 +583,7 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 					if len(pkList) < buildIndexBlock {
 						cursor = nil
 					}
-					db.eng.Write(db.defaultWriteOpts, wb)
+					db.eng.Write(wb)
 					if len(cursor) == 0 {
 						return true, nil
 					} else {
@@ -476,8 +595,8 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 				if done {
 					dbLog.Infof("finish rebuild index for table %v, total: %v", string(buildTable), indexPKCnt)
 					t.Lock()
-					for _, f := range fields {
-						hindex, ok := t.hsetIndexes[string(f)]
+					for _, index := range tmpHsetIndexes {
+						hindex, ok := t.hsetIndexes[index.indexKey()]
 						if ok {
 							if err != nil {
 								hindex.State = InitIndex
@@ -34,20 +34,23 @@ const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 type IndexPropertyDType int32
 
 const (
-	Int64V  IndexPropertyDType = 0
-	Int32V  IndexPropertyDType = 1
-	StringV IndexPropertyDType = 2
+	Int64V   IndexPropertyDType = 0
+	Int32V   IndexPropertyDType = 1
+	StringV  IndexPropertyDType = 2
+	Float64V IndexPropertyDType = 3
 )
 
 var IndexPropertyDType_name = map[int32]string{
 	0: "Int64V",
 	1: "Int32V",
 	2: "StringV",
+	3: "Float64V",
 }
 var IndexPropertyDType_value = map[string]int32{
-	"Int64V":  0,
-	"Int32V":  1,
-	"StringV": 2,
+	"Int64V":   0,
+	"Int32V":   1,
+	"StringV":  2,
+	"Float64V": 3,
 }
 
 func (x IndexPropertyDType) String() string {
@@ -92,6 +95,9 @@ type HsetIndexInfo struct {
 	Unique     int32              `protobuf:"varint,4,opt,name=unique,proto3" json:"unique,omitempty"`
 	ValueType  IndexPropertyDType `protobuf:"varint,5,opt,name=value_type,json=valueType,proto3,enum=rockredis.IndexPropertyDType" json:"value_type,omitempty"`
 	State      IndexState         `protobuf:"varint,6,opt,name=state,proto3,enum=rockredis.IndexState" json:"state,omitempty"`
+	// the following fields of the composite index, the index_field is the leading field
+	CompositeFields     [][]byte             `protobuf:"bytes,7,rep,name=composite_fields,json=compositeFields" json:"composite_fields,omitempty"`
+	CompositeValueTypes []IndexPropertyDType `protobuf:"varint,8,rep,packed,name=composite_value_types,json=compositeValueTypes,enum=rockredis.IndexPropertyDType" json:"composite_value_types,omitempty"`
 }
 
 func (m *HsetIndexInfo) Reset()                    { *m = HsetIndexInfo{} }
@@ -161,6 +167,31 @@ func (m *HsetIndexInfo) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintIndexTypes(dAtA, i, uint64(m.State))
 	}
+	if len(m.CompositeFields) > 0 {
+		for _, b := range m.CompositeFields {
+			dAtA[i] = 0x3a
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(len(b)))
+			i += copy(dAtA[i:], b)
+		}
+	}
+	if len(m.CompositeValueTypes) > 0 {
+		dAtA2 := make([]byte, len(m.CompositeValueTypes)*10)
+		var j1 int
+		for _, num := range m.CompositeValueTypes {
+			for num >= 1<<7 {
+				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j1++
+			}
+			dAtA2[j1] = uint8(num)
+			j1++
+		}
+		dAtA[i] = 0x42
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(j1))
+		i += copy(dAtA[i:], dAtA2[:j1])
+	}
 	return i, nil
 }
 
@@ -226,6 +257,19 @@ func (m *HsetIndexInfo) Size() (n int) {
 	if m.State != 0 {
 		n += 1 + sovIndexTypes(uint64(m.State))
 	}
+	if len(m.CompositeFields) > 0 {
+		for _, b := range m.CompositeFields {
+			l = len(b)
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	if len(m.CompositeValueTypes) > 0 {
+		l = 0
+		for _, e := range m.CompositeValueTypes {
+			l += sovIndexTypes(uint64(e))
+		}
+		n += 1 + sovIndexTypes(uint64(l)) + l
+	}
 	return n
 }
 
@@ -421,6 +465,97 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CompositeFields", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.CompositeFields = append(m.CompositeFields, make([]byte, postIndex-iNdEx))
+			copy(m.CompositeFields[len(m.CompositeFields)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 8:
+			if wireType == 0 {
+				var v IndexPropertyDType
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIndexTypes
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= (IndexPropertyDType(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.CompositeValueTypes = append(m.CompositeValueTypes, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIndexTypes
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= (int(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthIndexTypes
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				for iNdEx < postIndex {
+					var v IndexPropertyDType
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowIndexTypes
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= (IndexPropertyDType(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.CompositeValueTypes = append(m.CompositeValueTypes, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field CompositeValueTypes", wireType)
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIndexTypes(dAtA[iNdEx:])
@@ -631,30 +766,33 @@ var (
 func init() { proto.RegisterFile("index_types.proto", fileDescriptorIndexTypes) }
 
 var fileDescriptorIndexTypes = []byte{
-	// 393 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x91, 0xdf, 0x8a, 0xd3, 0x40,
-	0x14, 0xc6, 0x33, 0xfd, 0x27, 0x3d, 0x69, 0x4b, 0xf6, 0xa0, 0x32, 0x08, 0x9b, 0x0d, 0x7b, 0x15,
-	0x56, 0xa8, 0xd0, 0x15, 0x41, 0xf0, 0xc6, 0x52, 0xc4, 0xc0, 0x5e, 0x48, 0x56, 0x7a, 0x5b, 0xa2,
-	0x39, 0xcd, 0x0e, 0xc6, 0x99, 0x98, 0x99, 0xc8, 0xe6, 0x4d, 0x7c, 0xa4, 0x5e, 0xee, 0x13, 0x88,
-	0x5b, 0xc1, 0xe7, 0x90, 0xcc, 0xac, 0x5a, 0xf5, 0xee, 0x3b, 0xbf, 0x73, 0xbe, 0xc3, 0x77, 0x66,
-	0xe0, 0x48, 0xc8, 0x9c, 0xae, 0x37, 0xa6, 0xad, 0x48, 0xcf, 0xab, 0x5a, 0x19, 0x85, 0xe3, 0x5a,
-	0xbd, 0xff, 0x50, 0x53, 0x2e, 0xf4, 0xa3, 0xfb, 0x85, 0x2a, 0x94, 0xa5, 0x4f, 0x3a, 0xe5, 0x06,
-	0x4e, 0x7f, 0x30, 0x98, 0xbe, 0xd6, 0x64, 0x92, 0xce, 0x9a, 0xc8, 0xad, 0x42, 0x84, 0x81, 0xcc,
-	0x3e, 0x12, 0x67, 0x11, 0x8b, 0x27, 0xa9, 0xd5, 0x78, 0x02, 0xbe, 0xdb, 0xbd, 0x15, 0x54, 0xe6,
-	0xbc, 0x67, 0x5b, 0x60, 0xd1, 0xab, 0x8e, 0xe0, 0x31, 0x40, 0x55, 0xd3, 0x56, 0x5c, 0x6f, 0x4a,
-	0x92, 0xbc, 0x1f, 0xb1, 0x78, 0x98, 0x8e, 0x1d, 0xb9, 0x20, 0x89, 0x0f, 0x61, 0xd4, 0x48, 0xf1,
-	0xa9, 0x21, 0x3e, 0xb0, 0xad, 0xbb, 0x0a, 0x5f, 0x00, 0x7c, 0xce, 0xca, 0x86, 0x6c, 0x66, 0x3e,
-	0x8c, 0x58, 0x3c, 0x5b, 0x1c, 0xcf, 0x7f, 0x67, 0x9e, 0xdb, 0x54, 0x6f, 0x6a, 0x55, 0x51, 0x6d,
-	0xda, 0xd5, 0xdb, 0xb6, 0xa2, 0x74, 0x6c, 0x0d, 0x9d, 0xc4, 0xc7, 0x30, 0xd4, 0x26, 0x33, 0xc4,
-	0x47, 0xd6, 0xf8, 0xe0, 0x5f, 0xe3, 0x65, 0xd7, 0x4c, 0xdd, 0xcc, 0x69, 0x7a, 0x70, 0xe7, 0x85,
-	0xd0, 0x06, 0x5f, 0xc2, 0xe4, 0x4a, 0x93, 0xd9, 0xd8, 0x2b, 0x48, 0x73, 0x16, 0xf5, 0x63, 0x7f,
-	0xc1, 0x0f, 0x96, 0xfc, 0xf5, 0x2e, 0xcb, 0xc1, 0xee, 0xeb, 0x89, 0x97, 0xfa, 0x57, 0xbf, 0x20,
-	0xe9, 0xb3, 0xe7, 0x80, 0xff, 0x27, 0x44, 0x80, 0x51, 0x22, 0xcd, 0xb3, 0xa7, 0xeb, 0xc0, 0xbb,
-	0xd3, 0xe7, 0x8b, 0x75, 0xc0, 0xd0, 0x87, 0x7b, 0x97, 0xa6, 0x16, 0xb2, 0x58, 0x07, 0xbd, 0xb3,
-	0x1c, 0xe0, 0x4f, 0x46, 0x9c, 0xc2, 0x38, 0x91, 0xc2, 0xed, 0x0d, 0x3c, 0x3c, 0x82, 0xe9, 0xb2,
-	0x11, 0x65, 0x2e, 0x64, 0xe1, 0x10, 0x43, 0x84, 0x99, 0x45, 0x2b, 0x25, 0xc9, 0xb1, 0x1e, 0xce,
-	0x00, 0x52, 0xca, 0xf2, 0xd6, 0xd5, 0x7d, 0x0c, 0x60, 0xb2, 0xa2, 0x92, 0x0c, 0xe5, 0x8e, 0x0c,
-	0x96, 0x7c, 0x77, 0x1b, 0x7a, 0x37, 0xb7, 0xa1, 0xb7, 0xdb, 0x87, 0xec, 0x66, 0x1f, 0xb2, 0x6f,
-	0xfb, 0x90, 0x7d, 0xf9, 0x1e, 0x7a, 0xef, 0x46, 0xf6, 0xfb, 0xcf, 0x7f, 0x06, 0x00, 0x00, 0xff,
-	0xff, 0x0b, 0x2d, 0x74, 0xe7, 0x34, 0x02, 0x00, 0x00,
+	// 447 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0x4f, 0x6f, 0xd3, 0x4c,
+	0x10, 0xc6, 0xbd, 0x71, 0x92, 0x36, 0x93, 0x3f, 0xaf, 0x3b, 0x2f, 0x45, 0x2b, 0xa4, 0xba, 0x56,
+	0x4f, 0xa6, 0x48, 0x41, 0x4a, 0x11, 0x27, 0x2e, 0x44, 0x51, 0x21, 0x52, 0x0f, 0xe0, 0xa2, 0x5c,
+	0x23, 0x53, 0x4f, 0xd2, 0x15, 0xee, 0xae, 0xf1, 0x6e, 0x50, 0xf3, 0x4d, 0xf8, 0x48, 0x39, 0xf6,
+	0x13, 0x20, 0x1a, 0xf8, 0x20, 0xc8, 0xbb, 0x6d, 0x52, 0xe0, 0xc0, 0x6d, 0xf6, 0x37, 0xcf, 0xb3,
+	0xfb, 0xcc, 0xd8, 0xb0, 0x27, 0x64, 0x46, 0xd7, 0x53, 0xb3, 0x2c, 0x48, 0xf7, 0x8b, 0x52, 0x19,
+	0x85, 0xad, 0x52, 0x5d, 0x7c, 0x2a, 0x29, 0x13, 0xfa, 0xc9, 0xa3, 0xb9, 0x9a, 0x2b, 0x4b, 0x9f,
+	0x57, 0x95, 0x13, 0x1c, 0xfd, 0xac, 0x41, 0xf7, 0xad, 0x26, 0x33, 0xae, 0xac, 0x63, 0x39, 0x53,
+	0x88, 0x50, 0x97, 0xe9, 0x15, 0x71, 0x16, 0xb1, 0xb8, 0x93, 0xd8, 0x1a, 0x0f, 0xa1, 0xed, 0xee,
+	0x9e, 0x09, 0xca, 0x33, 0x5e, 0xb3, 0x2d, 0xb0, 0xe8, 0xb4, 0x22, 0x78, 0x00, 0x50, 0x94, 0x34,
+	0x13, 0xd7, 0xd3, 0x9c, 0x24, 0xf7, 0x23, 0x16, 0x37, 0x92, 0x96, 0x23, 0x67, 0x24, 0xf1, 0x31,
+	0x34, 0x17, 0x52, 0x7c, 0x5e, 0x10, 0xaf, 0xdb, 0xd6, 0xdd, 0x09, 0x5f, 0x01, 0x7c, 0x49, 0xf3,
+	0x05, 0xd9, 0xcc, 0xbc, 0x11, 0xb1, 0xb8, 0x37, 0x38, 0xe8, 0x6f, 0x32, 0xf7, 0x6d, 0xaa, 0x77,
+	0xa5, 0x2a, 0xa8, 0x34, 0xcb, 0xd1, 0x87, 0x65, 0x41, 0x49, 0xcb, 0x1a, 0xaa, 0x12, 0x9f, 0x41,
+	0x43, 0x9b, 0xd4, 0x10, 0x6f, 0x5a, 0xe3, 0xfe, 0x9f, 0xc6, 0xf3, 0xaa, 0x99, 0x38, 0x0d, 0x3e,
+	0x85, 0xe0, 0x42, 0x5d, 0x15, 0x4a, 0x0b, 0x43, 0x6e, 0x0c, 0xcd, 0x77, 0x22, 0x3f, 0xee, 0x24,
+	0xff, 0x6d, 0xb8, 0x9d, 0x45, 0xe3, 0x7b, 0xd8, 0xdf, 0x4a, 0xb7, 0xf9, 0x34, 0xdf, 0x8d, 0xfc,
+	0x7f, 0x07, 0xfc, 0x7f, 0xe3, 0x9d, 0xdc, 0x27, 0xd5, 0x47, 0xc9, 0x83, 0x2d, 0x9f, 0x09, 0x6d,
+	0xf0, 0x35, 0x74, 0x2e, 0x35, 0x99, 0xa9, 0xdd, 0x21, 0x69, 0xce, 0x22, 0x3f, 0x6e, 0x0f, 0xf8,
+	0x83, 0xab, 0x7f, 0xfb, 0x2a, 0xc3, 0xfa, 0xea, 0xdb, 0xa1, 0x97, 0xb4, 0x2f, 0xef, 0x21, 0xe9,
+	0xe3, 0x37, 0x80, 0x7f, 0x3f, 0x8f, 0x00, 0xcd, 0xb1, 0x34, 0x2f, 0x5f, 0x4c, 0x02, 0xef, 0xae,
+	0x3e, 0x19, 0x4c, 0x02, 0x86, 0x6d, 0xd8, 0x39, 0x37, 0xa5, 0x90, 0xf3, 0x49, 0x50, 0xc3, 0x0e,
+	0xec, 0x9e, 0xe6, 0x2a, 0xb5, 0x32, 0xff, 0x38, 0x03, 0xd8, 0xee, 0x0b, 0xbb, 0xd0, 0x1a, 0x4b,
+	0xe1, 0x5e, 0x09, 0x3c, 0xdc, 0x83, 0xee, 0x70, 0x21, 0xf2, 0x4c, 0xc8, 0xb9, 0x43, 0x0c, 0x11,
+	0x7a, 0x16, 0x8d, 0x94, 0x24, 0xc7, 0x6a, 0xd8, 0x03, 0x48, 0x28, 0xcd, 0x96, 0xee, 0xec, 0x63,
+	0x00, 0x9d, 0x11, 0xe5, 0x64, 0x28, 0x73, 0xa4, 0x3e, 0xe4, 0xab, 0xdb, 0xd0, 0xbb, 0xb9, 0x0d,
+	0xbd, 0xd5, 0x3a, 0x64, 0x37, 0xeb, 0x90, 0x7d, 0x5f, 0x87, 0xec, 0xeb, 0x8f, 0xd0, 0xfb, 0xd8,
+	0xb4, 0xbf, 0xe2, 0xc9, 0xaf, 0x01, 0x00, 0x10, 0x12, 0xba, 0x92, 0xc0, 0x02, 0x00, 0x00,
 }
@@ -4,7 +4,7 @@ import (
 	"bytes"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 type Iterator interface {
@@ -35,77 +35,48 @@ type Limit struct {
 }
 
 type DBIterator struct {
-	*gorocksdb.Iterator
-	snap         *gorocksdb.Snapshot
-	ro           *gorocksdb.ReadOptions
-	db           *gorocksdb.DB
-	upperBound   *gorocksdb.IterBound
-	lowerBound   *gorocksdb.IterBound
+	engine.Iterator
 	removeTsType byte
 }
 
 // low_bound is inclusive
 // upper bound is exclusive
-func NewDBIterator(db *gorocksdb.DB, withSnap bool, prefixSame bool, lowbound []byte, upbound []byte, ignoreDel bool) (*DBIterator, error) {
-	db.RLock()
-	dbit := &DBIterator{
-		db: db,
-	}
-	readOpts := gorocksdb.NewDefaultReadOptions()
-	readOpts.SetFillCache(false)
-	readOpts.SetVerifyChecksums(false)
-	if prefixSame {
-		readOpts.SetPrefixSameAsStart(true)
-	}
-	if lowbound != nil {
-		dbit.lowerBound = gorocksdb.NewIterBound(lowbound)
-		readOpts.SetIterLowerBound(dbit.lowerBound)
-	}
-	if upbound != nil {
-		dbit.upperBound = gorocksdb.NewIterBound(upbound)
-		readOpts.SetIterUpperBound(dbit.upperBound)
-	}
-	if ignoreDel {
-		// may iterator some deleted keys still not compacted.
-		readOpts.SetIgnoreRangeDeletions(true)
-	}
-	dbit.ro = readOpts
-	var err error
-	if withSnap {
-		dbit.snap, err = db.NewSnapshot()
-		if err != nil {
-			dbit.Close()
-			return nil, err
-		}
-		readOpts.SetSnapshot(dbit.snap)
-	}
-	dbit.Iterator, err = db.NewIterator(readOpts)
+func NewDBIterator(db engine.KVEngine, withSnap bool, prefixSame bool, lowbound []byte, upbound []byte, ignoreDel bool) (*DBIterator, error) {
+	return NewDBIteratorWithOpts(db, engine.IteratorOpts{
+		LowerBound: lowbound,
+		UpperBound: upbound,
+		WithSnap:   withSnap,
+		PrefixSame: prefixSame,
+		IgnoreDel:  ignoreDel,
+	})
+}
+
+func NewDBIteratorWithOpts(db engine.KVEngine, opts engine.IteratorOpts) (*DBIterator, error) {
+	it, err := db.NewIterator(opts)
 	if err != nil {
-		dbit.Close()
 		return nil, err
 	}
-	return dbit, nil
+	return &DBIterator{Iterator: it}, nil
 }
 
-func (it *DBIterator) RefKey() []byte {
-	return it.Iterator.Key().Data()
+func (it *DBIterator) RefValue() []byte {
+	return it.removeTs(it.Iterator.RefValue())
 }
 
-func (it *DBIterator) Key() []byte {
-	return it.Iterator.Key().Bytes()
+func (it *DBIterator) Value() []byte {
+	return it.removeTs(it.Iterator.Value())
 }
 
-func (it *DBIterator) RefValue() []byte {
-	v := it.Iterator.Value().Data()
-	if (it.removeTsType == KVType || it.removeTsType == HashType) && len(v) >= tsLen {
-		v = v[:len(v)-tsLen]
+func (it *DBIterator) removeTs(v []byte) []byte {
+	if it.removeTsType == KVType {
+		dv, err := decodeKVValue(v)
+		if err != nil {
+			dbLog.Infof("decode kv value failed: %v", err)
+			return v[:len(v)-tsLen]
+		}
+		return dv
 	}
-	return v
-}
-
-func (it *DBIterator) Value() []byte {
-	v := it.Iterator.Value().Bytes()
-	if (it.removeTsType == KVType || it.removeTsType == HashType) && len(v) >= tsLen {
+	if it.removeTsType == HashType && len(v) >= tsLen {
 		v = v[:len(v)-tsLen]
 	}
 	return v
@@ -115,95 +86,32 @@ func (it *DBIterator) NoTimestamp(vt byte) {
 	it.removeTsType = vt
 }
 
-func (it *DBIterator) Close() {
-	if it.Iterator != nil {
-		it.Iterator.Close()
-	}
-	if it.ro != nil {
-		it.ro.Destroy()
-	}
-	if it.snap != nil {
-		it.snap.Release()
-	}
-	if it.upperBound != nil {
-		it.upperBound.Destroy()
-	}
-	if it.lowerBound != nil {
-		it.lowerBound.Destroy()
-	}
-	it.db.RUnlock()
-}
-
 // note: all the iterator use the prefix iterator flag. Which means it may skip the keys for different table
 // prefix.
-func NewDBRangeLimitIterator(db *gorocksdb.DB, min []byte, max []byte, rtype uint8,
+func NewDBRangeLimitIterator(db engine.KVEngine, min []byte, max []byte, rtype uint8,
 	offset int, count int, reverse bool) (*RangeLimitedIterator, error) {
-	upperBound := max
-	lowerBound := min
-	if rtype&common.RangeROpen <= 0 && upperBound != nil {
-		// range right not open, we need inclusive the max,
-		// however upperBound is exclusive
-		upperBound = append(upperBound, 0)
-	}
-
-	//dbLog.Infof("iterator %v : %v", lowerBound, upperBound)
-	dbit, err := NewDBIterator(db, false, true, lowerBound, upperBound, false)
-	if err != nil {
-		return nil, err
-	}
-	if !reverse {
-		return NewRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
-			&Limit{Offset: offset, Count: count}), nil
-	} else {
-		return NewRevRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
-			&Limit{Offset: offset, Count: count}), nil
-	}
+	return NewDBRangeLimitIteratorWithOpts(db, engine.IteratorOpts{}, min, max, rtype, offset, count, reverse)
 }
 
-func NewSnapshotDBRangeLimitIterator(db *gorocksdb.DB, min []byte, max []byte, rtype uint8,
+func NewSnapshotDBRangeLimitIterator(db engine.KVEngine, min []byte, max []byte, rtype uint8,
 	offset int, count int, reverse bool) (*RangeLimitedIterator, error) {
-	upperBound := max
-	lowerBound := min
-	if rtype&common.RangeROpen <= 0 && upperBound != nil {
-		// range right not open, we need inclusive the max,
-		// however upperBound is exclusive
-		upperBound = append(upperBound, 0)
-	}
-	dbit, err := NewDBIterator(db, true, true, lowerBound, upperBound, false)
-	if err != nil {
-		return nil, err
-	}
-	if !reverse {
-		return NewRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
-			&Limit{Offset: offset, Count: count}), nil
-	} else {
-		return NewRevRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
-			&Limit{Offset: offset, Count: count}), nil
-	}
+	return NewDBRangeLimitIteratorWithOpts(db, engine.IteratorOpts{WithSnap: true}, min, max, rtype, offset, count, reverse)
 }
 
-func NewDBRangeIterator(db *gorocksdb.DB, min []byte, max []byte, rtype uint8,
+func NewDBRangeIterator(db engine.KVEngine, min []byte, max []byte, rtype uint8,
 	reverse bool) (*RangeLimitedIterator, error) {
-	upperBound := max
-	lowerBound := min
-	if rtype&common.RangeROpen <= 0 && upperBound != nil {
-		// range right not open, we need inclusive the max,
-		// however upperBound is exclusive
-		upperBound = append(upperBound, 0)
-	}
-	dbit, err := NewDBIterator(db, false, true, lowerBound, upperBound, false)
-	if err != nil {
-		return nil, err
-	}
-	if !reverse {
-		return NewRangeIterator(dbit, &Range{Min: min, Max: max, Type: rtype}), nil
-	} else {
-		return NewRevRangeIterator(dbit, &Range{Min: min, Max: max, Type: rtype}), nil
-	}
+	return NewDBRangeLimitIteratorWithOpts(db, engine.IteratorOpts{}, min, max, rtype, 0, -1, reverse)
 }
 
-func NewSnapshotDBRangeIterator(db *gorocksdb.DB, min []byte, max []byte, rtype uint8,
+func NewSnapshotDBRangeIterator(db engine.KVEngine, min []byte, max []byte, rtype uint8,
 	reverse bool) (*RangeLimitedIterator, error) {
+	return NewDBRangeLimitIteratorWithOpts(db, engine.IteratorOpts{WithSnap: true}, min, max, rtype, 0, -1, reverse)
+}
+
+// NewDBRangeLimitIteratorWithOpts create the range iterator with the iterator options (such as the snapshot
+// and the cache hints), the bounds of the options will be set by the range.
+func NewDBRangeLimitIteratorWithOpts(db engine.KVEngine, opts engine.IteratorOpts, min []byte, max []byte, rtype uint8,
+	offset int, count int, reverse bool) (*RangeLimitedIterator, error) {
 	upperBound := max
 	lowerBound := min
 	if rtype&common.RangeROpen <= 0 && upperBound != nil {
@@ -211,14 +119,21 @@ func NewSnapshotDBRangeIterator(db *gorocksdb.DB, min []byte, max []byte, rtype
 		// however upperBound is exclusive
 		upperBound = append(upperBound, 0)
 	}
-	dbit, err := NewDBIterator(db, true, true, lowerBound, upperBound, false)
+
+	//dbLog.Infof("iterator %v : %v", lowerBound, upperBound)
+	opts.LowerBound = lowerBound
+	opts.UpperBound = upperBound
+	opts.PrefixSame = true
+	dbit, err := NewDBIteratorWithOpts(db, opts)
 	if err != nil {
 		return nil, err
 	}
 	if !reverse {
-		return NewRangeIterator(dbit, &Range{Min: min, Max: max, Type: rtype}), nil
+		return NewRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
+			&Limit{Offset: offset, Count: count}), nil
 	} else {
-		return NewRevRangeIterator(dbit, &Range{Min: min, Max: max, Type: rtype}), nil
+		return NewRevRangeLimitIterator(dbit, &Range{Min: min, Max: max, Type: rtype},
+			&Limit{Offset: offset, Count: count}), nil
 	}
 }
 
@@ -0,0 +1,91 @@
+package rockredis
+
+import (
+	"strconv"
+)
+
+// the type names and the encodings returned are same as the redis, so the tools
+// depending on the TYPE and OBJECT ENCODING commands can work.
+const (
+	TypeNameNone   = "none"
+	TypeNameString = "string"
+	TypeNameHash   = "hash"
+	TypeNameList   = "list"
+	TypeNameSet    = "set"
+	TypeNameZSet   = "zset"
+	// same as the RedisJSON module
+	TypeNameJSON = "ReJSON-RL"
+)
+
+// the max length of the embedded string in redis
+const embStrMaxLen = 44
+
+type keyTypeChecker struct {
+	name   string
+	exists func(key []byte) (int64, error)
+}
+
+func (db *RockDB) keyTypeCheckers() []keyTypeChecker {
+	return []keyTypeChecker{
+		{TypeNameString, func(key []byte) (int64, error) { return db.KVExists(key) }},
+		{TypeNameHash, db.HKeyExists},
+		{TypeNameList, db.LKeyExists},
+		{TypeNameSet, db.SKeyExists},
+		{TypeNameZSet, db.ZKeyExists},
+		{TypeNameJSON, db.JKeyExists},
+	}
+}
+
+// KeyType return the type name of the key, since each data type has its own key space,
+// the same key may exist in more than one type and the first one will be returned in
+// the order of string, hash, list, set, zset and json.
+func (db *RockDB) KeyType(key []byte) (string, error) {
+	for _, c := range db.keyTypeCheckers() {
+		n, err := c.exists(key)
+		if err != nil {
+			return "", err
+		}
+		if n > 0 {
+			return c.name, nil
+		}
+	}
+	return TypeNameNone, nil
+}
+
+// KeyEncoding return the redis encoding name of the key for the OBJECT ENCODING,
+// the empty string will be returned if the key not exist.
+func (db *RockDB) KeyEncoding(key []byte) (string, error) {
+	t, err := db.KeyType(key)
+	if err != nil {
+		return "", err
+	}
+	switch t {
+	case TypeNameString:
+		v, err := db.KVGet(key)
+		if err != nil {
+			return "", err
+		}
+		return stringEncoding(v), nil
+	case TypeNameHash, TypeNameSet:
+		return "hashtable", nil
+	case TypeNameList:
+		return "quicklist", nil
+	case TypeNameZSet:
+		return "skiplist", nil
+	case TypeNameJSON:
+		return "raw", nil
+	}
+	return "", nil
+}
+
+func stringEncoding(v []byte) string {
+	if len(v) <= 20 {
+		if _, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return "int"
+		}
+	}
+	if len(v) <= embStrMaxLen {
+		return "embstr"
+	}
+	return "raw"
+}
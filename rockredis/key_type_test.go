@@ -0,0 +1,64 @@
+package rockredis
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+func TestKeyTypeAndEncoding(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	kvInt := []byte("test:type_kv_int")
+	kvStr := []byte("test:type_kv_str")
+	kvRaw := []byte("test:type_kv_raw")
+	hkey := []byte("test:type_hash")
+	lkey := []byte("test:type_list")
+	skey := []byte("test:type_set")
+	zkey := []byte("test:type_zset")
+	jkey := []byte("test:type_json")
+	db.KVSet(0, kvInt, []byte("12345"))
+	db.KVSet(0, kvStr, []byte("hello"))
+	db.KVSet(0, kvRaw, []byte(strings.Repeat("a", embStrMaxLen+1)))
+	db.HSet(0, false, hkey, []byte("f"), []byte("v"))
+	db.LPush(0, lkey, []byte("v"))
+	db.SAdd(0, skey, []byte("v"))
+	db.ZAdd(0, zkey, common.ScorePair{Score: 1, Member: []byte("v")})
+	db.JSet(0, jkey, []byte("a"), []byte(`"v"`))
+
+	cases := []struct {
+		key      []byte
+		typeName string
+		encoding string
+	}{
+		{kvInt, TypeNameString, "int"},
+		{kvStr, TypeNameString, "embstr"},
+		{kvRaw, TypeNameString, "raw"},
+		{hkey, TypeNameHash, "hashtable"},
+		{lkey, TypeNameList, "quicklist"},
+		{skey, TypeNameSet, "hashtable"},
+		{zkey, TypeNameZSet, "skiplist"},
+		{jkey, TypeNameJSON, "raw"},
+		{[]byte("test:type_none"), TypeNameNone, ""},
+	}
+	for _, c := range cases {
+		tn, err := db.KeyType(c.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tn != c.typeName {
+			t.Errorf("key %s type should be %v, actual %v", c.key, c.typeName, tn)
+		}
+		enc, err := db.KeyEncoding(c.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc != c.encoding {
+			t.Errorf("key %s encoding should be %v, actual %v", c.key, c.encoding, enc)
+		}
+	}
+}
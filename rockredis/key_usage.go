@@ -0,0 +1,405 @@
+package rockredis
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/tidwall/gjson"
+)
+
+var errBigKeyScanRunning = errors.New("the big key scan is already running")
+
+// only the biggest keys will be kept in the scan result
+const maxBigKeyReported = 100
+
+// BigKeyInfo is the key which is over the size or elements threshold
+type BigKeyInfo struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Elements int64  `json:"elements"`
+}
+
+// BigKeyScanStatus is the status of the last big key scan for the table
+type BigKeyScanStatus struct {
+	Table        string       `json:"table"`
+	MinSize      int64        `json:"min_size"`
+	MinElements  int64        `json:"min_elements"`
+	Running      bool         `json:"running"`
+	StartTime    int64        `json:"start_time"`
+	EndTime      int64        `json:"end_time"`
+	ScannedKeys  int64        `json:"scanned_keys"`
+	BigKeys      []BigKeyInfo `json:"big_keys"`
+	TotalBigKeys int64        `json:"total_big_keys"`
+	Err          string       `json:"err,omitempty"`
+}
+
+// the size of ttl meta key, the value and the time key
+func (db *RockDB) ttlUsage(dataType byte, key []byte) int64 {
+	ttl, err := db.ttl(dataType, key)
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	return int64(len(expEncodeMetaKey(dataType, key)) + 8 + len(expEncodeTimeKey(dataType, key, 0)))
+}
+
+// the size of the data in range, and the element number
+func (db *RockDB) rangeUsage(start []byte, stop []byte, rtype uint8, onItem func(k []byte, v []byte)) (int64, int64, error) {
+	it, err := NewDBRangeIterator(db.eng, start, stop, rtype, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer it.Close()
+	var size, cnt int64
+	for ; it.Valid(); it.Next() {
+		size += int64(len(it.RefKey()) + len(it.RefValue()))
+		cnt++
+		if onItem != nil {
+			onItem(it.RefKey(), it.RefValue())
+		}
+	}
+	return size, cnt, nil
+}
+
+func (db *RockDB) fullTextUsage(table []byte, name string, pk []byte, text []byte) int64 {
+	var size int64
+	for term := range tokenizeFullText(text) {
+		size += int64(len(encodeFullTextIndexKey(table, []byte(name), []byte(term), pk)) + 8)
+	}
+	return size
+}
+
+func (db *RockDB) hashUsage(key []byte) (int64, int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	sk := hEncodeSizeKey(key)
+	meta, err := db.eng.GetBytes(sk)
+	if err != nil || meta == nil {
+		return 0, 0, err
+	}
+	var indexSize int64
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	ftIndexes := db.getFullTextIndexes(table)
+	onItem := func(k []byte, v []byte) {
+		if tableIndexes == nil && len(ftIndexes) == 0 {
+			return
+		}
+		_, _, field, err := hDecodeHashKey(k)
+		if err != nil {
+			return
+		}
+		if len(v) >= tsLen {
+			v = v[:len(v)-tsLen]
+		}
+		if tableIndexes != nil {
+			tableIndexes.RLock()
+			if hindex := tableIndexes.GetHIndexNoLock(string(field)); hindex != nil {
+				if ik, err := hindex.encodeValueKey(v, key); err == nil {
+					indexSize += int64(len(ik))
+					if hindex.isUnique() {
+						indexSize += int64(len(key))
+					}
+				}
+			}
+			tableIndexes.RUnlock()
+		}
+		for _, index := range ftIndexes {
+			if index.HsetField == string(field) {
+				indexSize += db.fullTextUsage(table, index.Name, key, v)
+			}
+		}
+	}
+	size, cnt, err := db.rangeUsage(hEncodeStartKey(table, rk), hEncodeStopKey(table, rk), common.RangeROpen, onItem)
+	if err != nil {
+		return 0, 0, err
+	}
+	size += int64(len(sk)+len(meta)) + indexSize + db.ttlUsage(HashType, key)
+	return size, cnt, nil
+}
+
+func (db *RockDB) listUsage(key []byte) (int64, int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	mk := lEncodeMetaKey(key)
+	meta, err := db.eng.GetBytes(mk)
+	if err != nil || meta == nil {
+		return 0, 0, err
+	}
+	headSeq, tailSeq, _, _, err := db.lGetMeta(mk)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, cnt, err := db.rangeUsage(lEncodeListKey(table, rk, headSeq), lEncodeListKey(table, rk, tailSeq),
+		common.RangeClose, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	size += int64(len(mk)+len(meta)) + db.ttlUsage(ListType, key)
+	return size, cnt, nil
+}
+
+func (db *RockDB) setUsage(key []byte) (int64, int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	sk := sEncodeSizeKey(key)
+	meta, err := db.eng.GetBytes(sk)
+	if err != nil || meta == nil {
+		return 0, 0, err
+	}
+	size, cnt, err := db.rangeUsage(sEncodeStartKey(table, rk), sEncodeStopKey(table, rk), common.RangeROpen, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	size += int64(len(sk)+len(meta)) + db.ttlUsage(SetType, key)
+	return size, cnt, nil
+}
+
+func (db *RockDB) zsetUsage(key []byte) (int64, int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	sk := zEncodeSizeKey(key)
+	meta, err := db.eng.GetBytes(sk)
+	if err != nil || meta == nil {
+		return 0, 0, err
+	}
+	var indexSize int64
+	indexed := db.isZsetScoreIndexed(table)
+	onItem := func(k []byte, v []byte) {
+		if !indexed {
+			return
+		}
+		_, _, member, err := zDecodeSetKey(k)
+		if err != nil {
+			return
+		}
+		score, err := Float64(v, nil)
+		if err != nil {
+			return
+		}
+		if ik, err := encodeZsetIndexKey(table, member, score, key); err == nil {
+			indexSize += int64(len(ik))
+		}
+	}
+	size, cnt, err := db.rangeUsage(zEncodeStartSetKey(table, rk), zEncodeStopSetKey(table, rk), common.RangeROpen, onItem)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the score keys
+	scoreSize, _, err := db.rangeUsage(zEncodeStartKey(table, rk), zEncodeStopKey(table, rk), common.RangeROpen, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	size += scoreSize + int64(len(sk)+len(meta)) + indexSize + db.ttlUsage(ZSetType, key)
+	return size, cnt, nil
+}
+
+func (db *RockDB) kvUsage(key []byte) (int64, int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, 0, err
+	}
+	ek := encodeKVKey(key)
+	v, err := db.eng.GetBytes(ek)
+	if err != nil || v == nil {
+		return 0, 0, err
+	}
+	return int64(len(ek)+len(v)) + db.ttlUsage(KVType, key), 1, nil
+}
+
+func (db *RockDB) jsonUsage(key []byte) (int64, int64, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	ek, v, exist, err := db.getOldJSON(table, rk)
+	if err != nil || !exist {
+		return 0, 0, err
+	}
+	size := int64(len(ek) + len(v) + tsLen)
+	for _, index := range db.getFullTextIndexes(table) {
+		if index.JSONPath == "" {
+			continue
+		}
+		if jv := gjson.GetBytes(v, convertJSONPath([]byte(index.JSONPath))); jv.Exists() {
+			size += db.fullTextUsage(table, index.Name, key, []byte(jv.String()))
+		}
+	}
+	return size, 1, nil
+}
+
+func (db *RockDB) keyUsage(dataType byte, key []byte) (int64, int64, error) {
+	switch dataType {
+	case KVType:
+		return db.kvUsage(key)
+	case HashType:
+		return db.hashUsage(key)
+	case ListType:
+		return db.listUsage(key)
+	case SetType:
+		return db.setUsage(key)
+	case ZSetType:
+		return db.zsetUsage(key)
+	case JSONType:
+		return db.jsonUsage(key)
+	}
+	return 0, 0, errDataType
+}
+
+// KeyMemoryUsage estimate the encoded size of the key stored in db, including all the
+// fields or members, the ttl and the index entries. Since the same key can exist in
+// different data types, the size of all the data types will be added.
+func (db *RockDB) KeyMemoryUsage(key []byte) (int64, error) {
+	var total int64
+	for _, dt := range []byte{KVType, HashType, ListType, SetType, ZSetType, JSONType} {
+		size, _, err := db.keyUsage(dt, key)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+type bigKeyList []BigKeyInfo
+
+func (l bigKeyList) Len() int           { return len(l) }
+func (l bigKeyList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l bigKeyList) Less(i, j int) bool { return l[i].Size > l[j].Size }
+
+// ScanBigKeys scan all the keys in the table and report the keys which the estimated size
+// is over the min size or the elements are over the min elements, the threshold will be
+// ignored if it is not positive.
+func (db *RockDB) ScanBigKeys(table string, minSize int64, minElements int64) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	db.bigKeyMutex.Lock()
+	if db.bigKeyStatus.Running {
+		db.bigKeyMutex.Unlock()
+		return errBigKeyScanRunning
+	}
+	db.bigKeyStatus = BigKeyScanStatus{
+		Table:       table,
+		MinSize:     minSize,
+		MinElements: minElements,
+		Running:     true,
+		StartTime:   time.Now().Unix(),
+	}
+	db.bigKeyMutex.Unlock()
+
+	err := db.scanBigKeys([]byte(table), minSize, minElements)
+	db.bigKeyMutex.Lock()
+	db.bigKeyStatus.Running = false
+	db.bigKeyStatus.EndTime = time.Now().Unix()
+	if err != nil {
+		db.bigKeyStatus.Err = err.Error()
+	}
+	db.bigKeyMutex.Unlock()
+	if err != nil {
+		dbLog.Infof("table %v big key scan failed: %v", table, err)
+		return err
+	}
+	dbLog.Infof("table %v big key scan done", table)
+	return nil
+}
+
+func (db *RockDB) scanBigKeys(table []byte, minSize int64, minElements int64) error {
+	metaTypes := []struct {
+		metaType byte
+		dataType byte
+		decode   func([]byte) ([]byte, error)
+	}{
+		{KVType, KVType, decodeKVKey},
+		{HSizeType, HashType, hDecodeSizeKey},
+		{LMetaType, ListType, lDecodeMetaKey},
+		{SSizeType, SetType, sDecodeSizeKey},
+		{ZSizeType, ZSetType, zDecodeSizeKey},
+	}
+	for _, mt := range metaTypes {
+		minMetaKey, maxMetaKey, err := getTableMetaRange(mt.metaType, table, nil, nil)
+		if err != nil {
+			return err
+		}
+		err = db.scanBigKeysInRange(minMetaKey, maxMetaKey, mt.dataType, mt.decode, minSize, minElements)
+		if err != nil {
+			return err
+		}
+	}
+	jStart, err := encodeJSONStartKey(table)
+	if err != nil {
+		return err
+	}
+	decodeJSON := func(ek []byte) ([]byte, error) {
+		t, rk, err := decodeJSONKey(ek)
+		if err != nil {
+			return nil, err
+		}
+		return packRedisKey(t, rk), nil
+	}
+	return db.scanBigKeysInRange(jStart, encodeJSONStopKey(table, nil), JSONType, decodeJSON, minSize, minElements)
+}
+
+func (db *RockDB) scanBigKeysInRange(start []byte, stop []byte, dataType byte,
+	decode func([]byte) ([]byte, error), minSize int64, minElements int64) error {
+	it, err := NewDBIterator(db.eng, true, false, start, stop, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	var scanned int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key, err := decode(it.Key())
+		if err != nil {
+			continue
+		}
+		size, elems, err := db.keyUsage(dataType, key)
+		if err != nil {
+			return err
+		}
+		scanned++
+		isBig := (minSize > 0 && size >= minSize) || (minElements > 0 && elems >= minElements)
+		db.bigKeyMutex.Lock()
+		db.bigKeyStatus.ScannedKeys++
+		if isBig {
+			db.bigKeyStatus.TotalBigKeys++
+			db.bigKeyStatus.BigKeys = append(db.bigKeyStatus.BigKeys, BigKeyInfo{
+				Key:      string(key),
+				Type:     TypeName[dataType],
+				Size:     size,
+				Elements: elems,
+			})
+			if len(db.bigKeyStatus.BigKeys) > maxBigKeyReported {
+				sort.Sort(bigKeyList(db.bigKeyStatus.BigKeys))
+				db.bigKeyStatus.BigKeys = db.bigKeyStatus.BigKeys[:maxBigKeyReported]
+			}
+		}
+		db.bigKeyMutex.Unlock()
+		if scanned%1000 == 0 {
+			select {
+			case <-db.quit:
+				return common.ErrStopped
+			default:
+			}
+		}
+	}
+	return it.Err()
+}
+
+func (db *RockDB) GetBigKeyScanStatus() BigKeyScanStatus {
+	db.bigKeyMutex.Lock()
+	defer db.bigKeyMutex.Unlock()
+	st := db.bigKeyStatus
+	st.BigKeys = make([]BigKeyInfo, len(db.bigKeyStatus.BigKeys))
+	copy(st.BigKeys, db.bigKeyStatus.BigKeys)
+	sort.Sort(bigKeyList(st.BigKeys))
+	return st
+}
@@ -0,0 +1,108 @@
+package rockredis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/engine"
+)
+
+const (
+	// the deleted ranges will be compacted to clean the range tombstones and the deleted data
+	compactDeletedRangeInterval = time.Second * 30
+	maxPendingDeletedRanges     = 1000
+)
+
+// deletedRangeCleaner collect the ranges deleted by the range deletion and compact
+// them in background, so the reads will not be slowed down by the range tombstones.
+type deletedRangeCleaner struct {
+	sync.Mutex
+	ranges []engine.CRange
+}
+
+func newDeletedRangeCleaner() *deletedRangeCleaner {
+	return &deletedRangeCleaner{
+		ranges: make([]engine.CRange, 0, 16),
+	}
+}
+
+func (c *deletedRangeCleaner) add(start []byte, end []byte) {
+	c.Lock()
+	defer c.Unlock()
+	// too many pending ranges, leave them to the auto compaction
+	if len(c.ranges) >= maxPendingDeletedRanges {
+		return
+	}
+	c.ranges = append(c.ranges, engine.CRange{
+		Start: copyRangeKey(start),
+		Limit: copyRangeKey(end),
+	})
+}
+
+// keep the nil key since the nil range means the whole db
+func copyRangeKey(k []byte) []byte {
+	if k == nil {
+		return nil
+	}
+	return append([]byte{}, k...)
+}
+
+func (c *deletedRangeCleaner) takeAll() []engine.CRange {
+	c.Lock()
+	defer c.Unlock()
+	rgs := c.ranges
+	c.ranges = make([]engine.CRange, 0, 16)
+	return rgs
+}
+
+func (c *deletedRangeCleaner) pendingNum() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.ranges)
+}
+
+// delete the range [start, end) in the write batch and the range will be compacted later
+func (db *RockDB) deleteRange(wb engine.WriteBatch, start []byte, end []byte) {
+	wb.DeleteRange(start, end)
+	if db.rangeCleaner != nil {
+		db.rangeCleaner.add(start, end)
+	}
+}
+
+func (db *RockDB) compactDeletedRanges() {
+	if !db.inCompactionWindow() {
+		return
+	}
+	rgs := db.rangeCleaner.takeAll()
+	if len(rgs) == 0 {
+		return
+	}
+	start := time.Now()
+	for _, rg := range rgs {
+		db.eng.RLock()
+		if db.eng.IsOpened() {
+			db.eng.CompactRange(rg)
+		}
+		db.eng.RUnlock()
+		select {
+		case <-db.quit:
+			return
+		default:
+		}
+	}
+	dbLog.Infof("compact %v deleted ranges cost: %v", len(rgs), time.Since(start))
+}
+
+func (db *RockDB) compactDeletedRangesLoop() {
+	ticker := time.NewTicker(compactDeletedRangeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.compactDeletedRanges()
+			db.purgeDroppedTables()
+		case <-db.quit:
+			return
+		}
+	}
+}
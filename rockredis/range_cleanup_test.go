@@ -0,0 +1,101 @@
+package rockredis
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClearBigHashWithRangeDelete(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:bighash")
+	fvs := make([]common.KVRecord, 0, RangeDeleteNum*2)
+	for i := 0; i < RangeDeleteNum*2; i++ {
+		fvs = append(fvs, common.KVRecord{
+			Key:   []byte("field" + strconv.Itoa(i)),
+			Value: []byte("value" + strconv.Itoa(i)),
+		})
+	}
+	err := db.HMset(time.Now().UnixNano(), key, fvs...)
+	assert.Nil(t, err)
+	n, err := db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(fvs)), n)
+
+	_, err = db.HClear(key)
+	assert.Nil(t, err)
+	assert.True(t, db.rangeCleaner.pendingNum() > 0)
+	n, err = db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	db.compactDeletedRanges()
+	assert.Equal(t, 0, db.rangeCleaner.pendingNum())
+	v, err := db.HGet(key, []byte("field1"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestCompactDeferredOutOfWindow(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	now := time.Now()
+	start := now.Add(time.Hour * 2)
+	end := now.Add(time.Hour * 3)
+	wl, err := engine.ParseCompactionWindows([]string{
+		start.Format("15:04") + "-" + end.Format("15:04"),
+	})
+	assert.Nil(t, err)
+	db.compactWindows = wl
+	assert.False(t, db.inCompactionWindow())
+
+	db.CompactRange()
+	assert.Equal(t, 1, db.rangeCleaner.pendingNum())
+	db.CompactTableRange("test")
+	pending := db.rangeCleaner.pendingNum()
+	assert.True(t, pending > 1)
+	// should be kept until in the window
+	db.compactDeletedRanges()
+	assert.Equal(t, pending, db.rangeCleaner.pendingNum())
+
+	db.compactWindows = nil
+	db.compactDeletedRanges()
+	assert.Equal(t, 0, db.rangeCleaner.pendingNum())
+}
+
+func TestCompactTableKeyRange(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		err := db.KVSet(0, []byte("test:key"+strconv.Itoa(i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+	err := db.CompactTableKeyRange("test", []byte("key1"), []byte("key5"))
+	assert.Nil(t, err)
+	p := db.GetCompactProgress()
+	assert.Equal(t, "test", p.Table)
+	assert.Equal(t, "key1", p.StartKey)
+	assert.Equal(t, "key5", p.EndKey)
+	assert.False(t, p.Running)
+	assert.False(t, p.Deferred)
+	assert.True(t, p.TotalRanges > 0)
+	assert.Equal(t, p.TotalRanges, p.DoneRanges)
+	v, err := db.KVGet([]byte("test:key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), v)
+
+	err = db.CompactTableKeyRange("", nil, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,149 @@
+package rockredis
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var rdbExportTypes = []byte{KVType, HashType, ListType, SetType, ZSetType}
+
+func rdbDataType(dt byte) common.DataType {
+	switch dt {
+	case KVType:
+		return common.KV
+	case HashType:
+		return common.HASH
+	case ListType:
+		return common.LIST
+	case SetType:
+		return common.SET
+	case ZSetType:
+		return common.ZSET
+	}
+	return common.NONE
+}
+
+// decode the data key to the key without table and the sub key (field or member)
+func decodeRDBDataKey(dt byte, ek []byte) ([]byte, []byte, error) {
+	switch dt {
+	case KVType:
+		rk, err := decodeDataKey(dt, ek)
+		return rk, nil, err
+	case HashType:
+		_, rk, f, err := hDecodeHashKey(ek)
+		return rk, f, err
+	case ListType:
+		_, rk, _, err := lDecodeListKey(ek)
+		return rk, nil, err
+	case SetType:
+		_, rk, m, err := sDecodeSetKey(ek)
+		return rk, m, err
+	case ZSetType:
+		_, rk, m, err := zDecodeSetKey(ek)
+		return rk, m, err
+	}
+	return nil, nil, errDataType
+}
+
+// ExportTableRDB write all the data of the table to the rdb as the redis db, the key in the
+// rdb has no table prefix. The data is read from the db snapshot of each data type.
+func (db *RockDB) ExportTableRDB(table string, dbIndex int, w *common.RDBWriter) (int64, error) {
+	var cnt int64
+	for _, dt := range rdbExportTypes {
+		n, err := db.exportTableTypeRDB(dt, table, dbIndex, w)
+		cnt += n
+		if err != nil {
+			return cnt, err
+		}
+	}
+	return cnt, nil
+}
+
+func (db *RockDB) exportTableTypeRDB(dt byte, table string, dbIndex int, w *common.RDBWriter) (int64, error) {
+	var cnt int64
+	_, err := db.scanTableTypeEntries(dt, table, nil, func(e *common.RDBEntry) (bool, error) {
+		e.DB = dbIndex
+		cnt++
+		return true, w.WriteEntry(e)
+	})
+	return cnt, err
+}
+
+// scan the keys of the data type in the table from the start key with all the values
+// and the ttl, the key in the entry is the key without table. The scan will be stopped
+// if the callback return false, and the next key to scan will be returned (nil if done).
+func (db *RockDB) scanTableTypeEntries(dt byte, table string, start []byte,
+	fn func(e *common.RDBEntry) (bool, error)) ([]byte, error) {
+	rgs, err := getTableDataRange(dt, []byte(table), start, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the zset score data is the same as the zset member data, so we only scan the first range
+	it, err := NewSnapshotDBRangeIterator(db.eng, rgs[0].Start, rgs[0].Limit, common.RangeROpen, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	it.NoTimestamp(dt)
+
+	var cur *common.RDBEntry
+	flush := func() (bool, error) {
+		if cur == nil {
+			return true, nil
+		}
+		e := cur
+		cur = nil
+		ttl, err := db.ttl(dt, packRedisKey([]byte(table), e.Key))
+		if err != nil {
+			return false, err
+		}
+		if ttl == 0 {
+			// expired but not deleted yet
+			return true, nil
+		}
+		if ttl > 0 {
+			e.ExpireAt = time.Now().Add(time.Duration(ttl)*time.Second).UnixNano() / int64(time.Millisecond)
+		}
+		return fn(e)
+	}
+	for ; it.Valid(); it.Next() {
+		rk, sub, err := decodeRDBDataKey(dt, it.RefKey())
+		if err != nil {
+			dbLog.Infof("decode data key %v failed while scanning table %v: %v", it.RefKey(), table, err)
+			continue
+		}
+		if cur == nil || !bytes.Equal(cur.Key, rk) {
+			goOn, err := flush()
+			if err != nil {
+				return nil, err
+			}
+			if !goOn {
+				return append([]byte(nil), rk...), nil
+			}
+			cur = &common.RDBEntry{
+				Key:  append([]byte(nil), rk...),
+				Type: rdbDataType(dt),
+			}
+		}
+		switch dt {
+		case KVType:
+			cur.Value = it.Value()
+		case HashType:
+			cur.Fields = append(cur.Fields, common.KVRecord{Key: append([]byte(nil), sub...), Value: it.Value()})
+		case ListType:
+			cur.Values = append(cur.Values, it.Value())
+		case SetType:
+			cur.Values = append(cur.Values, append([]byte(nil), sub...))
+		case ZSetType:
+			score, err := Float64(it.RefValue(), nil)
+			if err != nil {
+				return nil, err
+			}
+			cur.Members = append(cur.Members, common.ScorePair{Score: score, Member: append([]byte(nil), sub...)})
+		}
+	}
+	_, err = flush()
+	return nil, err
+}
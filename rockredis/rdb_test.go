@@ -0,0 +1,82 @@
+package rockredis
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+func TestExportTableRDB(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	db.KVSet(0, []byte("test:kv1"), []byte("v1"))
+	db.SetEx(0, []byte("test:kv2"), 100, []byte("v2"))
+	db.KVSet(0, []byte("other:kv1"), []byte("other"))
+	db.HMset(0, []byte("test:hash"), common.KVRecord{Key: []byte("f1"), Value: []byte("v1")},
+		common.KVRecord{Key: []byte("f2"), Value: []byte("v2")})
+	db.RPush(0, []byte("test:list"), []byte("e1"), []byte("e2"), []byte("e1"))
+	db.SAdd(0, []byte("test:set"), []byte("m1"), []byte("m2"))
+	db.ZAdd(0, []byte("test:zset"), common.ScorePair{Score: 2, Member: []byte("m2")},
+		common.ScorePair{Score: 1.5, Member: []byte("m1")})
+
+	var buf bytes.Buffer
+	w, err := common.NewRDBWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnt, err := db.ExportTableRDB("test", 2, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 6 {
+		t.Errorf("exported key number mismatch: %v", cnt)
+	}
+	r, err := common.NewRDBReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*common.RDBEntry)
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.DB != 2 {
+			t.Errorf("db mismatch: %v", e.DB)
+		}
+		entries[string(e.Key)] = e
+	}
+	if len(entries) != 6 {
+		t.Fatalf("entries mismatch: %v", entries)
+	}
+	if e := entries["kv1"]; string(e.Value) != "v1" || e.ExpireAt != 0 {
+		t.Errorf("kv mismatch: %v", e)
+	}
+	if e := entries["kv2"]; string(e.Value) != "v2" || e.ExpireAt == 0 {
+		t.Errorf("kv with ttl mismatch: %v", e)
+	}
+	if e := entries["hash"]; e.Type != common.HASH || len(e.Fields) != 2 || string(e.Fields[1].Value) != "v2" {
+		t.Errorf("hash mismatch: %v", e)
+	}
+	if e := entries["list"]; e.Type != common.LIST || len(e.Values) != 3 || string(e.Values[1]) != "e2" {
+		t.Errorf("list mismatch: %v", e)
+	}
+	if e := entries["set"]; e.Type != common.SET || len(e.Values) != 2 {
+		t.Errorf("set mismatch: %v", e)
+	}
+	if e := entries["zset"]; e.Type != common.ZSET || len(e.Members) != 2 ||
+		string(e.Members[0].Member) != "m1" || e.Members[0].Score != 1.5 {
+		t.Errorf("zset mismatch: %v", e)
+	}
+}
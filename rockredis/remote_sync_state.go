@@ -0,0 +1,95 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var errRemoteSyncedStateKey = errors.New("invalid remote synced state key")
+var errRemoteSyncedStateValue = errors.New("invalid remote synced state value")
+
+type RemoteSyncedState struct {
+	ClusterName string
+	Term        uint64
+	Index       uint64
+	Timestamp   int64
+}
+
+func encodeRemoteSyncedStateKey(cluster []byte) []byte {
+	key := make([]byte, 1+len(metaPrefix)+len(cluster))
+	pos := 0
+	key[pos] = remoteSyncedStateType
+	pos++
+	copy(key[pos:], metaPrefix)
+	pos += len(metaPrefix)
+	copy(key[pos:], cluster)
+	return key
+}
+
+func decodeRemoteSyncedStateKey(key []byte) ([]byte, error) {
+	pos := 0
+	if len(key) < pos+1+len(metaPrefix) || key[pos] != remoteSyncedStateType {
+		return nil, errRemoteSyncedStateKey
+	}
+	pos++
+	pos += len(metaPrefix)
+	return key[pos:], nil
+}
+
+func encodeRemoteSyncedStateValue(term uint64, index uint64, ts int64) []byte {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint64(v[0:], term)
+	binary.BigEndian.PutUint64(v[8:], index)
+	binary.BigEndian.PutUint64(v[16:], uint64(ts))
+	return v
+}
+
+func decodeRemoteSyncedStateValue(v []byte) (uint64, uint64, int64, error) {
+	if len(v) < 24 {
+		return 0, 0, 0, errRemoteSyncedStateValue
+	}
+	term := binary.BigEndian.Uint64(v[0:])
+	index := binary.BigEndian.Uint64(v[8:])
+	ts := int64(binary.BigEndian.Uint64(v[16:]))
+	return term, index, ts, nil
+}
+
+// SaveRemoteSyncedState save the last applied raft term-index from the remote cluster
+func (db *RockDB) SaveRemoteSyncedState(cluster string, term uint64, index uint64, ts int64) error {
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(encodeRemoteSyncedStateKey([]byte(cluster)), encodeRemoteSyncedStateValue(term, index, ts))
+	return db.eng.Write(wb)
+}
+
+func (db *RockDB) GetRemoteSyncedStates() ([]RemoteSyncedState, error) {
+	s := encodeRemoteSyncedStateKey(nil)
+	e := encodeRemoteSyncedStateKey(nil)
+	e[len(e)-1] = e[len(e)-1] + 1
+	it, err := NewDBRangeIterator(db.eng, s, e, common.RangeOpen, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var states []RemoteSyncedState
+	for ; it.Valid(); it.Next() {
+		cluster, err := decodeRemoteSyncedStateKey(it.Key())
+		if err != nil {
+			continue
+		}
+		term, index, ts, err := decodeRemoteSyncedStateValue(it.Value())
+		if err != nil {
+			dbLog.Infof("remote synced state for cluster %v invalid: %v", string(cluster), err)
+			continue
+		}
+		states = append(states, RemoteSyncedState{
+			ClusterName: string(cluster),
+			Term:        term,
+			Index:       index,
+			Timestamp:   ts,
+		})
+	}
+	return states, nil
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"hash"
 	"io"
-	"math"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,8 +18,7 @@ import (
 	"github.com/spaolacci/murmur3"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
-	"github.com/shirou/gopsutil/mem"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 const (
@@ -32,11 +30,13 @@ var dbLog = common.NewLevelLogger(common.LOG_INFO, common.NewDefaultLogger("db")
 
 func SetLogLevel(level int32) {
 	dbLog.SetLevel(level)
+	engine.SetLogLevel(level)
 }
 
 func SetLogger(level int32, logger common.Logger) {
 	dbLog.SetLevel(level)
 	dbLog.Logger = logger
+	engine.SetLogger(level, logger)
 }
 
 func GetCheckpointDir(term uint64, index uint64) string {
@@ -45,170 +45,41 @@ func GetCheckpointDir(term uint64, index uint64) string {
 
 var batchableCmds map[string]bool
 
-type RockOptions struct {
-	VerifyReadChecksum             bool   `json:"verify_read_checksum"`
-	BlockSize                      int    `json:"block_size"`
-	BlockCache                     int64  `json:"block_cache"`
-	CacheIndexAndFilterBlocks      bool   `json:"cache_index_and_filter_blocks"`
-	WriteBufferSize                int    `json:"write_buffer_size"`
-	MaxWriteBufferNumber           int    `json:"max_write_buffer_number"`
-	MinWriteBufferNumberToMerge    int    `json:"min_write_buffer_number_to_merge"`
-	Level0FileNumCompactionTrigger int    `json:"level0_file_num_compaction_trigger"`
-	MaxBytesForLevelBase           uint64 `json:"max_bytes_for_level_base"`
-	TargetFileSizeBase             uint64 `json:"target_file_size_base"`
-	MaxBackgroundFlushes           int    `json:"max_background_flushes"`
-	MaxBackgroundCompactions       int    `json:"max_background_compactions"`
-	MinLevelToCompress             int    `json:"min_level_to_compress"`
-	MaxMainifestFileSize           uint64 `json:"max_mainifest_file_size"`
-	RateBytesPerSec                int64  `json:"rate_bytes_per_sec"`
-	BackgroundHighThread           int    `json:"background_high_thread,omitempty"`
-	BackgroundLowThread            int    `json:"background_low_thread,omitempty"`
-	AdjustThreadPool               bool   `json:"adjust_thread_pool,omitempty"`
-	UseSharedCache                 bool   `json:"use_shared_cache,omitempty"`
-	UseSharedRateLimiter           bool   `json:"use_shared_rate_limiter,omitempty"`
-	DisableWAL                     bool   `json:"disable_wal,omitempty"`
-	DisableMergeCounter            bool   `json:"disable_merge_counter,omitempty"`
-}
-
-func FillDefaultOptions(opts *RockOptions) {
-	// use large block to reduce index block size for hdd
-	// if using ssd, should use the default value
-	if opts.BlockSize <= 0 {
-		// for hdd use 64KB and above
-		// for ssd use 32KB and below
-		opts.BlockSize = 1024 * 32
-	}
-	// should about 20% less than host RAM
-	// http://smalldatum.blogspot.com/2016/09/tuning-rocksdb-block-cache.html
-	if opts.BlockCache <= 0 {
-		v, err := mem.VirtualMemory()
-		if err != nil {
-			opts.BlockCache = 1024 * 1024 * 128
-		} else {
-			opts.BlockCache = int64(v.Total / 100)
-			if opts.UseSharedCache {
-				opts.BlockCache *= 10
-			} else {
-				if opts.BlockCache < 1024*1024*64 {
-					opts.BlockCache = 1024 * 1024 * 64
-				} else if opts.BlockCache > 1024*1024*1024*8 {
-					opts.BlockCache = 1024 * 1024 * 1024 * 8
-				}
-			}
-		}
-	}
-	// keep level0_file_num_compaction_trigger * write_buffer_size * min_write_buffer_number_tomerge = max_bytes_for_level_base to minimize write amplification
-	if opts.WriteBufferSize <= 0 {
-		opts.WriteBufferSize = 1024 * 1024 * 64
-	}
-	if opts.MaxWriteBufferNumber <= 0 {
-		opts.MaxWriteBufferNumber = 6
-	}
-	if opts.MinWriteBufferNumberToMerge <= 0 {
-		opts.MinWriteBufferNumberToMerge = 2
-	}
-	if opts.Level0FileNumCompactionTrigger <= 0 {
-		opts.Level0FileNumCompactionTrigger = 2
-	}
-	if opts.MaxBytesForLevelBase <= 0 {
-		opts.MaxBytesForLevelBase = 1024 * 1024 * 256
-	}
-	if opts.TargetFileSizeBase <= 0 {
-		opts.TargetFileSizeBase = 1024 * 1024 * 64
-	}
-	if opts.MaxBackgroundFlushes <= 0 {
-		opts.MaxBackgroundFlushes = 2
-	}
-	if opts.MaxBackgroundCompactions <= 0 {
-		opts.MaxBackgroundCompactions = 4
-	}
-	if opts.MinLevelToCompress <= 0 {
-		opts.MinLevelToCompress = 3
-	}
-	if opts.MaxMainifestFileSize <= 0 {
-		opts.MaxMainifestFileSize = 1024 * 1024 * 32
-	}
-	if opts.AdjustThreadPool {
-		if opts.BackgroundHighThread <= 0 {
-			opts.BackgroundHighThread = 2
-		}
-		if opts.BackgroundLowThread <= 0 {
-			opts.BackgroundLowThread = 4
-		}
-	}
-}
-
-type SharedRockConfig struct {
-	SharedCache       *gorocksdb.Cache
-	SharedEnv         *gorocksdb.Env
-	SharedRateLimiter *gorocksdb.RateLimiter
-}
 type RockConfig struct {
 	DataDir            string
 	EnableTableCounter bool
 	// this will ignore all update and non-exist delete
 	EstimateTableCounter bool
 	ExpirationPolicy     common.ExpirationPolicy
-	DefaultReadOpts      *gorocksdb.ReadOptions
-	DefaultWriteOpts     *gorocksdb.WriteOptions
-	SharedConfig         *SharedRockConfig
-	RockOptions
+	SharedConfig         engine.SharedRockConfig
+	// the checkpoint files will be encrypted if the key provider is set
+	SnapKeyProvider common.SnapKeyProvider
+	// limit the open iterators of the db, nil means no limit
+	IterLimiter *engine.IteratorLimiter
+	engine.RockOptions
+}
+
+// the data types in the separate column families, the kv and other meta data
+// will be in the default column family.
+var dataColumnFamilies = []engine.ColumnFamilyOpts{
+	{Name: "hash", KeyTypes: []byte{HashType, HSizeType}, PrefixLen: 3},
+	{Name: "list", KeyTypes: []byte{ListType, LMetaType}, PrefixLen: 3},
+	{Name: "set", KeyTypes: []byte{SetType, SSizeType}, PrefixLen: 3},
+	{Name: "zset", KeyTypes: []byte{ZSetType, ZSizeType, ZScoreType}, PrefixLen: 3},
+	{Name: "index", KeyTypes: []byte{IndexDataType, FullTextIndexDataType}, PrefixLen: 3},
+	// the expire time data is written and deleted in the time order
+	{Name: "ttl", KeyTypes: []byte{ExpTimeType, ExpMetaType}, UniversalCompaction: true},
 }
 
 func NewRockConfig() *RockConfig {
 	c := &RockConfig{
-		DefaultReadOpts:      gorocksdb.NewDefaultReadOptions(),
-		DefaultWriteOpts:     gorocksdb.NewDefaultWriteOptions(),
 		EnableTableCounter:   true,
 		EstimateTableCounter: false,
 	}
-	c.DefaultReadOpts.SetVerifyChecksums(false)
-	FillDefaultOptions(&c.RockOptions)
+	engine.FillDefaultOptions(&c.RockOptions)
 	return c
 }
 
-func NewSharedRockConfig(opt RockOptions) *SharedRockConfig {
-	rc := &SharedRockConfig{}
-	if opt.UseSharedCache {
-		if opt.BlockCache <= 0 {
-			v, err := mem.VirtualMemory()
-			if err != nil {
-				opt.BlockCache = 1024 * 1024 * 128 * 10
-			} else {
-				opt.BlockCache = int64(v.Total / 10)
-			}
-		}
-		rc.SharedCache = gorocksdb.NewLRUCache(opt.BlockCache)
-	}
-	if opt.AdjustThreadPool {
-		rc.SharedEnv = gorocksdb.NewDefaultEnv()
-		if opt.BackgroundHighThread <= 0 {
-			opt.BackgroundHighThread = 3
-		}
-		if opt.BackgroundLowThread <= 0 {
-			opt.BackgroundLowThread = 6
-		}
-		rc.SharedEnv.SetBackgroundThreads(opt.BackgroundLowThread)
-		rc.SharedEnv.SetHighPriorityBackgroundThreads(opt.BackgroundHighThread)
-	}
-	if opt.UseSharedRateLimiter && opt.RateBytesPerSec > 0 {
-		rc.SharedRateLimiter = gorocksdb.NewGenericRateLimiter(opt.RateBytesPerSec, 100*1000, 10)
-	}
-	return rc
-}
-
-func (src *SharedRockConfig) Destroy() {
-	if src.SharedCache != nil {
-		src.SharedCache.Destroy()
-	}
-	if src.SharedEnv != nil {
-		src.SharedEnv.Destroy()
-	}
-	if src.SharedRateLimiter != nil {
-		src.SharedRateLimiter.Destroy()
-	}
-}
-
 type CheckpointSortNames []string
 
 func (self CheckpointSortNames) Len() int {
@@ -240,16 +111,40 @@ func (self CheckpointSortNames) Less(i, j int) bool {
 	return lterm < rterm
 }
 
+// parse the term-index from the checkpoint dir name, return false if the name is not a
+// checkpoint (such as the staging or temporary dirs)
+func parseCheckpointName(name string) (uint64, uint64, bool) {
+	split := strings.SplitN(path.Base(name), "-", 2)
+	if len(split) != 2 {
+		return 0, 0, false
+	}
+	t, err := strconv.ParseUint(split[0], 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	i, err := strconv.ParseUint(split[1], 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t, i, true
+}
+
 func purgeOldCheckpoint(keepNum int, checkpointDir string) {
 	defer func() {
 		if e := recover(); e != nil {
 			dbLog.Infof("purge old checkpoint failed: %v", e)
 		}
 	}()
-	checkpointList, err := filepath.Glob(path.Join(checkpointDir, "*-*"))
+	matchList, err := filepath.Glob(path.Join(checkpointDir, "*-*"))
 	if err != nil {
 		return
 	}
+	checkpointList := make([]string, 0, len(matchList))
+	for _, name := range matchList {
+		if _, _, ok := parseCheckpointName(name); ok {
+			checkpointList = append(checkpointList, name)
+		}
+	}
 	if len(checkpointList) > keepNum {
 		sortedNameList := CheckpointSortNames(checkpointList)
 		sort.Sort(sortedNameList)
@@ -263,13 +158,8 @@ func purgeOldCheckpoint(keepNum int, checkpointDir string) {
 type RockDB struct {
 	expiration
 	cfg               *RockConfig
-	eng               *gorocksdb.DB
-	dbOpts            *gorocksdb.Options
-	defaultWriteOpts  *gorocksdb.WriteOptions
-	defaultReadOpts   *gorocksdb.ReadOptions
-	wb                *gorocksdb.WriteBatch
-	lruCache          *gorocksdb.Cache
-	rl                *gorocksdb.RateLimiter
+	eng               engine.KVEngine
+	wb                engine.WriteBatch
 	quit              chan struct{}
 	wg                sync.WaitGroup
 	backupC           chan *BackupInfo
@@ -280,6 +170,34 @@ type RockDB struct {
 	hasher64          hash.Hash64
 	hllCache          *hllCache
 	stopping          int32
+	rangeCleaner      *deletedRangeCleaner
+	// the table counter updates will be merged while batching and
+	// written into the batch only once while committing.
+	batchTableCounters map[string]int64
+	droppedMutex       sync.RWMutex
+	// the dropped tables waiting to be purged in background
+	droppedTables map[string]int64
+	// the heavy compaction will only run in the windows
+	compactWindows  []engine.CompactionWindow
+	compactMutex    sync.Mutex
+	compactProgress CompactProgress
+	compressMutex   sync.RWMutex
+	// the tables with value compression enabled
+	valueCompress map[string]tableValueCompress
+	recountMutex  sync.Mutex
+	recountStatus RecountStatus
+	bigKeyMutex   sync.Mutex
+	bigKeyStatus  BigKeyScanStatus
+	// the tables with zset score index enabled
+	zsetIndexMutex   sync.RWMutex
+	zsetScoreIndexes map[string]struct{}
+	// the full text indexes of the tables
+	ftIndexMutex sync.RWMutex
+	ftIndexes    map[string][]common.FullTextIndexSchema
+
+	// the status of the last data inspection of the tables
+	inspectMutex  sync.Mutex
+	inspectStatus TableInspectStatus
 }
 
 func OpenRockDB(cfg *RockConfig) (*RockDB, error) {
@@ -287,102 +205,41 @@ func OpenRockDB(cfg *RockConfig) (*RockDB, error) {
 		return nil, errors.New("config error")
 	}
 
-	if cfg.DisableWAL {
-		cfg.DefaultWriteOpts.DisableWAL(true)
+	compactWindows, err := engine.ParseCompactionWindows(cfg.CompactionWindows)
+	if err != nil {
+		return nil, err
 	}
 	os.MkdirAll(cfg.DataDir, common.DIR_PERM)
-	// options need be adjust due to using hdd or sdd, please reference
-	// https://github.com/facebook/rocksdb/wiki/RocksDB-Tuning-Guide
-	bbto := gorocksdb.NewDefaultBlockBasedTableOptions()
-	// use large block to reduce index block size for hdd
-	// if using ssd, should use the default value
-	bbto.SetBlockSize(cfg.BlockSize)
-	// should about 20% less than host RAM
-	// http://smalldatum.blogspot.com/2016/09/tuning-rocksdb-block-cache.html
-	var lru *gorocksdb.Cache
-	if cfg.RockOptions.UseSharedCache {
-		if cfg.SharedConfig == nil || cfg.SharedConfig.SharedCache == nil {
-			return nil, errors.New("missing shared cache instance")
-		}
-		bbto.SetBlockCache(cfg.SharedConfig.SharedCache)
-		dbLog.Infof("use shared cache: %v", cfg.SharedConfig.SharedCache)
-	} else {
-		lru = gorocksdb.NewLRUCache(cfg.BlockCache)
-		bbto.SetBlockCache(lru)
-	}
-	// cache index and filter blocks can save some memory,
-	// if not cache, the index and filter will be pre-loaded in memory
-	bbto.SetCacheIndexAndFilterBlocks(cfg.CacheIndexAndFilterBlocks)
-	// /* filter should not block_based, use sst based to reduce cpu */
-	filter := gorocksdb.NewBloomFilter(10, false)
-	bbto.SetFilterPolicy(filter)
-	opts := gorocksdb.NewDefaultOptions()
-	// optimize filter for hit, use less memory since last level will has no bloom filter
-	// opts.OptimizeFilterForHits(true)
-	opts.SetBlockBasedTableFactory(bbto)
-	if cfg.RockOptions.AdjustThreadPool {
-		if cfg.SharedConfig == nil || cfg.SharedConfig.SharedEnv == nil {
-			return nil, errors.New("missing shared env instance")
-		}
-		opts.SetEnv(cfg.SharedConfig.SharedEnv)
-		dbLog.Infof("use shared env: %v", cfg.SharedConfig.SharedEnv)
+	if cfg.DisableMergeCounter {
+		cfg.EnableTableCounter = false
 	}
-
-	var rl *gorocksdb.RateLimiter
-	if cfg.RateBytesPerSec > 0 {
-		if cfg.UseSharedRateLimiter {
-			if cfg.SharedConfig == nil {
-				return nil, errors.New("missing shared instance")
-			}
-			opts.SetRateLimiter(cfg.SharedConfig.SharedRateLimiter)
-			dbLog.Infof("use shared rate limiter: %v", cfg.SharedConfig.SharedRateLimiter)
-		} else {
-			rl = gorocksdb.NewGenericRateLimiter(cfg.RateBytesPerSec, 100*1000, 10)
-			opts.SetRateLimiter(rl)
-		}
+	engCfg := &engine.RockEngConfig{
+		DataDir:            GetDataDirFromBase(cfg.DataDir),
+		EnableTableCounter: cfg.EnableTableCounter,
+		SharedConfig:       cfg.SharedConfig,
+		ColumnFamilies:     dataColumnFamilies,
+		IterLimiter:        cfg.IterLimiter,
+		RockOptions:        cfg.RockOptions,
 	}
-
-	opts.SetCreateIfMissing(true)
-	opts.SetMaxOpenFiles(-1)
-	// keep level0_file_num_compaction_trigger * write_buffer_size * min_write_buffer_number_tomerge = max_bytes_for_level_base to minimize write amplification
-	opts.SetWriteBufferSize(cfg.WriteBufferSize)
-	opts.SetMaxWriteBufferNumber(cfg.MaxWriteBufferNumber)
-	opts.SetMinWriteBufferNumberToMerge(cfg.MinWriteBufferNumberToMerge)
-	opts.SetLevel0FileNumCompactionTrigger(cfg.Level0FileNumCompactionTrigger)
-	opts.SetMaxBytesForLevelBase(cfg.MaxBytesForLevelBase)
-	opts.SetTargetFileSizeBase(cfg.TargetFileSizeBase)
-	opts.SetMaxBackgroundFlushes(cfg.MaxBackgroundFlushes)
-	opts.SetMaxBackgroundCompactions(cfg.MaxBackgroundCompactions)
-	opts.SetMinLevelToCompress(cfg.MinLevelToCompress)
-	// we use table, so we use prefix seek feature
-	opts.SetPrefixExtractor(gorocksdb.NewFixedPrefixTransform(3))
-	opts.SetMemtablePrefixBloomSizeRatio(0.1)
-	opts.EnableStatistics()
-	opts.SetMaxLogFileSize(1024 * 1024 * 32)
-	opts.SetLogFileTimeToRoll(3600 * 24 * 3)
-	opts.SetMaxManifestFileSize(cfg.MaxMainifestFileSize)
-	opts.SetMaxSuccessiveMerges(1000)
-	// https://github.com/facebook/mysql-5.6/wiki/my.cnf-tuning
-	// rate limiter need to reduce the compaction io
-	if !cfg.DisableMergeCounter {
-		if cfg.EnableTableCounter {
-			opts.SetUint64AddMergeOperator()
-		}
-	} else {
-		cfg.EnableTableCounter = false
+	eng, err := engine.NewKVEng(engCfg)
+	if err != nil {
+		return nil, err
 	}
 
 	db := &RockDB{
-		cfg:              cfg,
-		dbOpts:           opts,
-		lruCache:         lru,
-		rl:               rl,
-		defaultReadOpts:  cfg.DefaultReadOpts,
-		defaultWriteOpts: cfg.DefaultWriteOpts,
-		wb:               gorocksdb.NewWriteBatch(),
-		backupC:          make(chan *BackupInfo),
-		quit:             make(chan struct{}),
-		hasher64:         murmur3.New64(),
+		cfg:            cfg,
+		eng:            eng,
+		wb:             eng.NewWriteBatch(),
+		backupC:        make(chan *BackupInfo),
+		quit:           make(chan struct{}),
+		hasher64:       murmur3.New64(),
+		rangeCleaner:   newDeletedRangeCleaner(),
+		droppedTables:  make(map[string]int64),
+		compactWindows: compactWindows,
+		valueCompress:  make(map[string]tableValueCompress),
+
+		zsetScoreIndexes: make(map[string]struct{}),
+		ftIndexes:        make(map[string][]common.FullTextIndexSchema),
 	}
 
 	switch cfg.ExpirationPolicy {
@@ -398,19 +255,25 @@ func OpenRockDB(cfg *RockConfig) (*RockDB, error) {
 		return nil, errors.New("unsupported ExpirationPolicy")
 	}
 
-	err := db.reOpenEng()
+	recoverRestoreDir(db.GetDataDir())
+	err = db.reOpenEng()
 	if err != nil {
 		return nil, err
 	}
 
 	os.MkdirAll(db.GetBackupDir(), common.DIR_PERM)
-	dbLog.Infof("rocksdb opened: %v", db.GetDataDir())
+	dbLog.Infof("db engine %v opened: %v", cfg.EngineType, db.GetDataDir())
 
 	db.wg.Add(1)
 	go func() {
 		defer db.wg.Done()
 		db.backupLoop()
 	}()
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		db.compactDeletedRangesLoop()
+	}()
 
 	return db, nil
 }
@@ -450,7 +313,7 @@ func (r *RockDB) reOpenEng() error {
 	}
 	r.hllCache = hcache
 
-	r.eng, err = gorocksdb.OpenDb(r.dbOpts, r.GetDataDir())
+	err = r.eng.OpenEng()
 	r.indexMgr = NewIndexMgr()
 	if err != nil {
 		return err
@@ -458,7 +321,35 @@ func (r *RockDB) reOpenEng() error {
 	err = r.indexMgr.LoadIndexes(r)
 	if err != nil {
 		dbLog.Infof("rocksdb %v load index failed: %v", r.GetDataDir(), err)
-		r.eng.Close()
+		r.eng.CloseEng()
+		return err
+	}
+	err = r.loadDroppedTables()
+	if err != nil {
+		dbLog.Infof("rocksdb %v load dropped tables failed: %v", r.GetDataDir(), err)
+		r.indexMgr.Close()
+		r.eng.CloseEng()
+		return err
+	}
+	err = r.loadTableValueCompress()
+	if err != nil {
+		dbLog.Infof("rocksdb %v load value compression failed: %v", r.GetDataDir(), err)
+		r.indexMgr.Close()
+		r.eng.CloseEng()
+		return err
+	}
+	err = r.loadZsetScoreIndexes()
+	if err != nil {
+		dbLog.Infof("rocksdb %v load zset score index failed: %v", r.GetDataDir(), err)
+		r.indexMgr.Close()
+		r.eng.CloseEng()
+		return err
+	}
+	err = r.loadFullTextIndexes()
+	if err != nil {
+		dbLog.Infof("rocksdb %v load full text index failed: %v", r.GetDataDir(), err)
+		r.indexMgr.Close()
+		r.eng.CloseEng()
 		return err
 	}
 
@@ -468,7 +359,7 @@ func (r *RockDB) reOpenEng() error {
 	return nil
 }
 
-func (r *RockDB) getDBEng() *gorocksdb.DB {
+func (r *RockDB) getDBEng() engine.KVEngine {
 	e := r.eng
 	return e
 }
@@ -478,32 +369,136 @@ func (r *RockDB) getIndexer() *IndexMgr {
 	return e
 }
 
+func (r *RockDB) inCompactionWindow() bool {
+	return engine.IsInCompactionWindows(r.compactWindows, time.Now())
+}
+
+// the compaction will be deferred to the compaction window if not in the window now
 func (r *RockDB) CompactRange() {
-	var rg gorocksdb.Range
+	var rg engine.CRange
+	if !r.inCompactionWindow() {
+		dbLog.Infof("not in the compaction window, the compaction is deferred")
+		r.rangeCleaner.add(rg.Start, rg.Limit)
+		return
+	}
 	r.eng.CompactRange(rg)
 }
 
 // [start, end)
 func (r *RockDB) CompactTableRange(table string) {
+	if !r.inCompactionWindow() {
+		dbLog.Infof("not in the compaction window, the compaction of table %v is deferred", table)
+		for _, rg := range getTableCompactRanges(table, nil, nil) {
+			r.rangeCleaner.add(rg.Start, rg.Limit)
+		}
+		return
+	}
+	r.compactTableRange(table)
+}
+
+// CompactProgress is the progress of the manual compaction for the key range of the table
+type CompactProgress struct {
+	Table       string `json:"table"`
+	StartKey    string `json:"start_key"`
+	EndKey      string `json:"end_key"`
+	TotalRanges int    `json:"total_ranges"`
+	DoneRanges  int    `json:"done_ranges"`
+	// not in the compaction window, will be compacted later in background
+	Deferred  bool  `json:"deferred"`
+	Running   bool  `json:"running"`
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+// CompactTableKeyRange compact the key range [start, end) of the table, the nil start or end
+// means from the begin or to the end of the table.
+func (r *RockDB) CompactTableKeyRange(table string, start []byte, end []byte) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	rgs := getTableCompactRanges(table, start, end)
+	r.compactMutex.Lock()
+	if r.compactProgress.Running {
+		r.compactMutex.Unlock()
+		return errCompactRunning
+	}
+	r.compactProgress = CompactProgress{
+		Table:       table,
+		StartKey:    string(start),
+		EndKey:      string(end),
+		TotalRanges: len(rgs),
+		StartTime:   time.Now().Unix(),
+	}
+	if !r.inCompactionWindow() {
+		r.compactProgress.Deferred = true
+		r.compactProgress.EndTime = r.compactProgress.StartTime
+		r.compactMutex.Unlock()
+		dbLog.Infof("not in the compaction window, the compaction of table %v range is deferred", table)
+		for _, rg := range rgs {
+			r.rangeCleaner.add(rg.Start, rg.Limit)
+		}
+		return nil
+	}
+	r.compactProgress.Running = true
+	r.compactMutex.Unlock()
+
+	defer func() {
+		r.compactMutex.Lock()
+		r.compactProgress.Running = false
+		r.compactProgress.EndTime = time.Now().Unix()
+		r.compactMutex.Unlock()
+	}()
+	for _, rg := range rgs {
+		select {
+		case <-r.quit:
+			return common.ErrStopped
+		default:
+		}
+		r.eng.RLock()
+		if !r.eng.IsOpened() {
+			r.eng.RUnlock()
+			return errDBClosed
+		}
+		r.eng.CompactRange(rg)
+		r.eng.RUnlock()
+		r.compactMutex.Lock()
+		r.compactProgress.DoneRanges++
+		r.compactMutex.Unlock()
+	}
+	dbLog.Infof("table %v range compacted: %v-%v", table, start, end)
+	return nil
+}
+
+func (r *RockDB) GetCompactProgress() CompactProgress {
+	r.compactMutex.Lock()
+	defer r.compactMutex.Unlock()
+	return r.compactProgress
+}
+
+func getTableCompactRanges(table string, start []byte, end []byte) []engine.CRange {
 	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
 	dtsMeta := []byte{KVType, HSizeType, LMetaType, SSizeType, ZSizeType}
+	rgList := make([]engine.CRange, 0, len(dts)*2)
 	for i, dt := range dts {
-		rgs, err := getTableDataRange(dt, []byte(table), nil, nil)
+		rgs, err := getTableDataRange(dt, []byte(table), start, end)
 		if err != nil {
 			dbLog.Infof("failed to build dt %v data range: %v", dt, err)
 			continue
 		}
-		// compact data range
-		dbLog.Infof("compacting dt %v data range: %v", dt, rgs)
-		for _, rg := range rgs {
-			r.eng.CompactRange(rg)
+		rgList = append(rgList, rgs...)
+		minKey, maxKey, err := getTableMetaRange(dtsMeta[i], []byte(table), start, end)
+		if err != nil {
+			dbLog.Infof("failed to build dt %v meta range: %v", dt, err)
+			continue
 		}
-		// compact meta range
-		minKey, maxKey, err := getTableMetaRange(dtsMeta[i], []byte(table), nil, nil)
-		var rg gorocksdb.Range
-		rg.Start = minKey
-		rg.Limit = maxKey
-		dbLog.Infof("compacting dt %v meta range: %v, %v", dt, minKey, maxKey)
+		rgList = append(rgList, engine.CRange{Start: minKey, Limit: maxKey})
+	}
+	return rgList
+}
+
+func (r *RockDB) compactTableRange(table string) {
+	for _, rg := range getTableCompactRanges(table, nil, nil) {
+		dbLog.Infof("compacting table %v range: %v, %v", table, rg.Start, rg.Limit)
 		r.eng.CompactRange(rg)
 	}
 }
@@ -514,7 +509,7 @@ func (r *RockDB) closeEng() {
 			r.hllCache.Flush()
 			r.indexMgr.Close()
 			r.expiration.Stop()
-			r.eng.Close()
+			r.eng.CloseEng()
 			dbLog.Infof("rocksdb engine closed: %v", r.GetDataDir())
 		}
 	}
@@ -531,36 +526,18 @@ func (r *RockDB) Close() {
 		r.expiration.Destroy()
 		r.expiration = nil
 	}
-	if r.defaultReadOpts != nil {
-		r.defaultReadOpts.Destroy()
-		r.defaultReadOpts = nil
-	}
-	if r.defaultWriteOpts != nil {
-		r.defaultWriteOpts.Destroy()
-	}
 	if r.wb != nil {
 		r.wb.Destroy()
 	}
-	if r.dbOpts != nil {
-		r.dbOpts.Destroy()
-		r.dbOpts = nil
-	}
-	if r.lruCache != nil {
-		r.lruCache.Destroy()
-		r.lruCache = nil
-	}
-	if r.rl != nil {
-		r.rl.Destroy()
-		r.rl = nil
-	}
+	r.eng.CloseAll()
 	dbLog.Infof("rocksdb %v closed", r.cfg.DataDir)
 }
 
 func (r *RockDB) GetStatistics() string {
-	return r.dbOpts.GetStatistics()
+	return r.eng.GetStatistics()
 }
 
-func getTableDataRange(dt byte, table []byte, start, end []byte) ([]gorocksdb.Range, error) {
+func getTableDataRange(dt byte, table []byte, start, end []byte) ([]engine.CRange, error) {
 	minKey, err := encodeFullScanMinKey(dt, table, start, nil)
 	if err != nil {
 		dbLog.Infof("failed to build dt %v range: %v", dt, err)
@@ -576,8 +553,8 @@ func getTableDataRange(dt byte, table []byte, start, end []byte) ([]gorocksdb.Ra
 		dbLog.Infof("failed to build dt %v range: %v", dt, err)
 		return nil, err
 	}
-	rgs := make([]gorocksdb.Range, 0, 2)
-	rgs = append(rgs, gorocksdb.Range{Start: minKey, Limit: maxKey})
+	rgs := make([]engine.CRange, 0, 2)
+	rgs = append(rgs, engine.CRange{Start: minKey, Limit: maxKey})
 	if dt == ZSetType {
 		// zset has key-score-member data except the key-member data
 		zminKey := zEncodeStartKey(table, start)
@@ -587,7 +564,7 @@ func getTableDataRange(dt byte, table []byte, start, end []byte) ([]gorocksdb.Ra
 		} else {
 			zmaxKey = zEncodeStopKey(table, end)
 		}
-		rgs = append(rgs, gorocksdb.Range{Start: zminKey, Limit: zmaxKey})
+		rgs = append(rgs, engine.CRange{Start: zminKey, Limit: zmaxKey})
 	}
 	dbLog.Debugf("table dt %v data range: %v", dt, rgs)
 	return rgs, nil
@@ -615,17 +592,25 @@ func getTableMetaRange(dt byte, table []byte, start, end []byte) ([]byte, []byte
 	return minMetaKey, maxMetaKey, nil
 }
 
-// [start, end)
-func (r *RockDB) DeleteTableRange(dryrun bool, table string, start []byte, end []byte) error {
+var ErrDeleteTableWithIndex = errors.New("drop table with any index is not supported currently")
+
+// CheckDeleteTableRange check whether the data of the table can be deleted by range
+func (r *RockDB) CheckDeleteTableRange(table string) error {
 	// TODO: need handle index and meta data, since index need scan if we delete part
 	// range of table, we can only allow delete whole table if it has index.
-	// fixme: how to handle the table key number counter, scan to count the deleted number is too slow
+	if r.indexMgr.GetTableIndexes(table) != nil {
+		return ErrDeleteTableWithIndex
+	}
+	return nil
+}
 
-	tidx := r.indexMgr.GetTableIndexes(table)
-	if tidx != nil {
-		return errors.New("drop table with any index is not supported currently")
+// [start, end)
+func (r *RockDB) DeleteTableRange(dryrun bool, table string, start []byte, end []byte) error {
+	// fixme: how to handle the table key number counter, scan to count the deleted number is too slow
+	if err := r.CheckDeleteTableRange(table); err != nil {
+		return err
 	}
-	wb := gorocksdb.NewWriteBatch()
+	wb := r.eng.NewWriteBatch()
 	defer wb.Destroy()
 	// kv, hash, set, list, zset
 	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
@@ -650,9 +635,9 @@ func (r *RockDB) DeleteTableRange(dryrun bool, table string, start []byte, end [
 			continue
 		}
 		for _, rg := range rgs {
-			wb.DeleteRange(rg.Start, rg.Limit)
+			r.deleteRange(wb, rg.Start, rg.Limit)
 		}
-		wb.DeleteRange(minMetaKey, maxMetaKey)
+		r.deleteRange(wb, minMetaKey, maxMetaKey)
 		if start == nil && end == nil {
 			// delete table counter
 			r.DelTableKeyCount([]byte(table), wb)
@@ -661,7 +646,7 @@ func (r *RockDB) DeleteTableRange(dryrun bool, table string, start []byte, end [
 	if dryrun {
 		return nil
 	}
-	err := r.eng.Write(r.defaultWriteOpts, wb)
+	err := r.eng.Write(wb)
 	if err != nil {
 		dbLog.Infof("failed to delete table %v range: %v", table, err)
 	}
@@ -692,9 +677,12 @@ func (r *RockDB) GetTablesSizes(tables []string) []int64 {
 
 // [start, end)
 func (r *RockDB) GetTableSizeInRange(table string, start []byte, end []byte) int64 {
+	if r.IsTableDropped(table) {
+		return 0
+	}
 	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
 	dtsMeta := []byte{KVType, HSizeType, LMetaType, SSizeType, ZSizeType}
-	rgs := make([]gorocksdb.Range, 0, len(dts))
+	rgs := make([]engine.CRange, 0, len(dts))
 	for i, dt := range dts {
 		// data range
 		drgs, err := getTableDataRange(dt, []byte(table), start, end)
@@ -709,7 +697,7 @@ func (r *RockDB) GetTableSizeInRange(table string, start []byte, end []byte) int
 			dbLog.Infof("failed to build dt %v meta range: %v", dt, err)
 			continue
 		}
-		var rgMeta gorocksdb.Range
+		var rgMeta engine.CRange
 		rgMeta.Start = minMetaKey
 		rgMeta.Limit = maxMetaKey
 		rgs = append(rgs, rgMeta)
@@ -725,6 +713,9 @@ func (r *RockDB) GetTableSizeInRange(table string, start []byte, end []byte) int
 
 // [start, end)
 func (r *RockDB) GetTableApproximateNumInRange(table string, start []byte, end []byte) int64 {
+	if r.IsTableDropped(table) {
+		return 0
+	}
 	numStr := r.eng.GetProperty("rocksdb.estimate-num-keys")
 	num, err := strconv.Atoi(numStr)
 	if err != nil {
@@ -737,7 +728,7 @@ func (r *RockDB) GetTableApproximateNumInRange(table string, start []byte, end [
 	}
 	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
 	dtsMeta := []byte{KVType, HSizeType, LMetaType, SSizeType, ZSizeType}
-	rgs := make([]gorocksdb.Range, 0, len(dts))
+	rgs := make([]engine.CRange, 0, len(dts))
 	for i, dt := range dts {
 		// meta range
 		minMetaKey, maxMetaKey, err := getTableMetaRange(dtsMeta[i], []byte(table), start, end)
@@ -745,12 +736,12 @@ func (r *RockDB) GetTableApproximateNumInRange(table string, start []byte, end [
 			dbLog.Infof("failed to build dt %v meta range: %v", dt, err)
 			continue
 		}
-		var rgMeta gorocksdb.Range
+		var rgMeta engine.CRange
 		rgMeta.Start = minMetaKey
 		rgMeta.Limit = maxMetaKey
 		rgs = append(rgs, rgMeta)
 	}
-	filteredRgs := make([]gorocksdb.Range, 0, len(dts))
+	filteredRgs := make([]engine.CRange, 0, len(dts))
 	sList := r.eng.GetApproximateSizes(rgs, true)
 	for i, s := range sList {
 		if s > 0 {
@@ -767,25 +758,18 @@ func (r *RockDB) GetTableApproximateNumInRange(table string, start []byte, end [
 }
 
 func (r *RockDB) GetInternalStatus() map[string]interface{} {
-	status := make(map[string]interface{})
-	bbt := r.dbOpts.GetBlockBasedTableFactory()
-	if bbt != nil {
-		bc := bbt.GetBlockCache()
-		if bc != nil {
-			status["block-cache-usage"] = bc.GetUsage()
-			status["block-cache-pinned-usage"] = bc.GetPinnedUsage()
-		}
-	}
-
-	memStr := r.eng.GetProperty("rocksdb.estimate-table-readers-mem")
-	status["estimate-table-readers-mem"] = memStr
-	memStr = r.eng.GetProperty("rocksdb.cur-size-all-mem-tables")
-	status["cur-size-all-mem-tables"] = memStr
-	memStr = r.eng.GetProperty("rocksdb.cur-size-active-mem-table")
-	status["cur-size-active-mem-tables"] = memStr
+	status := r.eng.GetInternalStatus()
+	status["pending-compact-deleted-ranges"] = r.rangeCleaner.pendingNum()
+	status["pending-purge-dropped-tables"] = len(r.GetDroppedTables())
+	status["in-compaction-window"] = r.inCompactionWindow()
 	return status
 }
 
+// change the rocksdb options at runtime
+func (r *RockDB) SetDBOptions(o common.RockOptionsOverride) error {
+	return r.eng.SetOptions(o)
+}
+
 func (r *RockDB) GetInternalPropertyStatus(p string) string {
 	return r.eng.GetProperty(p)
 }
@@ -836,36 +820,35 @@ func (r *RockDB) backupLoop() {
 				defer close(rsp.done)
 				dbLog.Infof("begin backup to:%v \n", rsp.backupDir)
 				start := time.Now()
-				ck, err := gorocksdb.NewCheckpoint(r.eng)
-				if err != nil {
-					dbLog.Infof("init checkpoint failed: %v", err)
-					rsp.err = err
-					return
-				}
-
 				r.checkpointDirLock.Lock()
-				_, err = os.Stat(rsp.backupDir)
+				_, err := os.Stat(rsp.backupDir)
 				if !os.IsNotExist(err) {
 					dbLog.Infof("checkpoint exist: %v, remove it", rsp.backupDir)
 					os.RemoveAll(rsp.backupDir)
 				}
 				rsp.rsp = []byte(rsp.backupDir)
-				r.eng.RLock()
-				if r.eng.IsOpened() {
-					time.AfterFunc(time.Millisecond*10, func() {
-						close(rsp.started)
-					})
-					err = ck.Save(rsp.backupDir, math.MaxUint64)
-				} else {
-					err = errors.New("db engine closed")
-				}
-				r.eng.RUnlock()
-				r.checkpointDirLock.Unlock()
+				err = r.eng.SaveCheckpoint(rsp.backupDir, func() {
+					close(rsp.started)
+				})
 				if err != nil {
+					r.checkpointDirLock.Unlock()
 					dbLog.Infof("save checkpoint failed: %v", err)
 					rsp.err = err
 					return
 				}
+				// the lock should be held until encrypted, so the plain checkpoint will
+				// never be seen by the snapshot transfer or the restore
+				if r.cfg.SnapKeyProvider != nil {
+					err = common.EncryptSnapDir(r.cfg.SnapKeyProvider, rsp.backupDir)
+					if err != nil {
+						os.RemoveAll(rsp.backupDir)
+						r.checkpointDirLock.Unlock()
+						dbLog.Infof("encrypt checkpoint failed: %v", err)
+						rsp.err = err
+						return
+					}
+				}
+				r.checkpointDirLock.Unlock()
 				cost := time.Now().Sub(start)
 				dbLog.Infof("backup done (cost %v), check point to: %v\n", cost.String(), rsp.backupDir)
 				// purge some old checkpoint
@@ -905,17 +888,50 @@ func (r *RockDB) IsLocalBackupOK(term uint64, index uint64) (bool, error) {
 	defer dbLog.Infof("check local checkpoint : %v done", fullPath)
 	r.checkpointDirLock.Lock()
 	defer r.checkpointDirLock.Unlock()
-	ro := *r.dbOpts
-	ro.SetCreateIfMissing(false)
-	db, err := gorocksdb.OpenDbForReadOnly(&ro, fullPath, false)
+	encrypted, err := common.IsEncryptedSnapDir(fullPath)
+	if err != nil {
+		return false, err
+	}
+	if encrypted {
+		// the encrypted checkpoint can not be opened, so we verify the authenticated data instead,
+		// and it will be opened after decrypted while restoring.
+		err = common.VerifySnapDir(r.cfg.SnapKeyProvider, fullPath)
+		if err != nil {
+			dbLog.Infof("checkpoint verify failed: %v", err)
+			return false, err
+		}
+		return true, nil
+	}
+	err = r.eng.CheckDBEngForRead(fullPath)
 	if err != nil {
 		dbLog.Infof("checkpoint open failed: %v", err)
 		return false, err
 	}
-	db.Close()
 	return true, nil
 }
 
+// GetLatestBackup return the term-index of the latest local backup, return 0 if no backup
+func (r *RockDB) GetLatestBackup() (uint64, uint64, error) {
+	r.checkpointDirLock.Lock()
+	checkpointList, err := filepath.Glob(path.Join(r.GetBackupDir(), "*-*"))
+	r.checkpointDirLock.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+	var term, index uint64
+	for _, name := range checkpointList {
+		t, i, ok := parseCheckpointName(name)
+		if !ok {
+			continue
+		}
+		if t > term || (t == term && i > index) {
+			term = t
+			index = i
+		}
+	}
+	return term, index, nil
+}
+
 func copyFile(src, dst string, override bool) error {
 	sfi, err := os.Stat(src)
 	if err != nil {
@@ -956,82 +972,169 @@ func copyFile(src, dst string, override bool) error {
 	return out.Close()
 }
 
-func (r *RockDB) Restore(term uint64, index uint64) error {
-	// write meta (snap term and index) and check the meta data in the backup
-	backupDir := r.GetBackupDir()
-	hasBackup, _ := r.IsLocalBackupOK(term, index)
-	if !hasBackup {
-		return errors.New("no backup for restore")
-	}
+const (
+	restoreStagingSuffix = ".restore"
+	restoreOldSuffix     = ".old"
+)
 
-	checkpointDir := GetCheckpointDir(term, index)
-	start := time.Now()
-	dbLog.Infof("begin restore from checkpoint: %v\n", checkpointDir)
-	r.closeEng()
-	select {
-	case <-r.quit:
-		return errors.New("db is quiting")
-	default:
+// prepare the restore data in the staging dir, the sst files in current db which are the same as
+// the checkpoint will be linked to avoid copying, other files will be copied from the checkpoint.
+func (r *RockDB) prepareRestoreStaging(ckDir string, stagingDir string) error {
+	err := os.RemoveAll(stagingDir)
+	if err != nil {
+		return err
 	}
-	// 1. remove all files in current db except sst files
-	// 2. get the list of sst in checkpoint
-	// 3. remove all the sst files not in the checkpoint list
-	// 4. copy all files from checkpoint to current db and do not override sst
-	matchName := path.Join(r.GetDataDir(), "*")
-	nameList, err := filepath.Glob(matchName)
+	err = os.MkdirAll(stagingDir, common.DIR_PERM)
 	if err != nil {
-		dbLog.Infof("list files failed:  %v\n", err)
 		return err
 	}
-	ckNameList, err := filepath.Glob(path.Join(backupDir, checkpointDir, "*"))
+	ckNameList, err := filepath.Glob(path.Join(ckDir, "*"))
 	if err != nil {
 		dbLog.Infof("list checkpoint files failed:  %v\n", err)
 		return err
 	}
-	ckSstNameMap := make(map[string]string)
 	for _, fn := range ckNameList {
-		if strings.HasSuffix(fn, ".sst") {
-			ckSstNameMap[path.Base(fn)] = fn
-		}
-	}
-
-	for _, fn := range nameList {
 		shortName := path.Base(fn)
 		if strings.HasPrefix(shortName, "LOG") {
+			dbLog.Infof("ignore copy LOG file: %v", fn)
 			continue
 		}
+		dst := path.Join(stagingDir, shortName)
+		encrypted, err := common.IsEncryptedSnapFile(fn)
+		if err != nil {
+			return err
+		}
 		if strings.HasSuffix(shortName, ".sst") {
-			if fullName, ok := ckSstNameMap[shortName]; ok {
-				stat1, err1 := os.Stat(fullName)
-				stat2, err2 := os.Stat(fn)
-				if err1 == nil && err2 == nil {
-					if stat1.Size() == stat2.Size() {
-						dbLog.Infof("keeping sst file: %v", fn)
-						continue
-					} else {
-						dbLog.Infof("no keeping sst file %v for mismatch size: %v, %v", fn, stat1, stat2)
-					}
-				} else {
-					dbLog.Infof("no keeping sst file %v for err: %v, %v", fn, err1, err2)
+			// the sst file is immutable, so it is safe to share it by hard link
+			src := fn
+			cur := path.Join(r.GetDataDir(), shortName)
+			ckSize, err1 := getRestoreFileSize(fn, encrypted)
+			stat2, err2 := os.Stat(cur)
+			if err1 == nil && err2 == nil && ckSize == stat2.Size() {
+				dbLog.Infof("keeping sst file: %v", cur)
+				src = cur
+			}
+			if src != fn || !encrypted {
+				if err := os.Link(src, dst); err == nil {
+					continue
 				}
 			}
 		}
-		dbLog.Infof("removing: %v", fn)
-		os.RemoveAll(fn)
-	}
-	for _, fn := range ckNameList {
-		if strings.HasPrefix(path.Base(fn), "LOG") {
-			dbLog.Infof("ignore copy LOG file: %v", fn)
+		if encrypted {
+			err = common.DecryptSnapFile(r.cfg.SnapKeyProvider, fn, dst)
+			if err != nil {
+				dbLog.Infof("decrypt %v to %v failed: %v", fn, dst, err)
+				return err
+			}
+			dbLog.Infof("decrypt %v to %v done", fn, dst)
 			continue
 		}
-		dst := path.Join(r.GetDataDir(), path.Base(fn))
-		err := copyFile(fn, dst, false)
+		err = copyFile(fn, dst, true)
 		if err != nil {
 			dbLog.Infof("copy %v to %v failed: %v", fn, dst, err)
 			return err
-		} else {
-			dbLog.Infof("copy %v to %v done", fn, dst)
 		}
+		dbLog.Infof("copy %v to %v done", fn, dst)
+	}
+	// make sure the staging data can be opened before replacing the current db
+	err = r.eng.CheckDBEngForRead(stagingDir)
+	if err != nil {
+		dbLog.Infof("open the restore staging %v failed: %v", stagingDir, err)
+		return err
+	}
+	return nil
+}
+
+func getRestoreFileSize(fn string, encrypted bool) (int64, error) {
+	if encrypted {
+		return common.GetSnapFilePlainSize(fn)
+	}
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// swap the staging dir to the data dir by rename, if we crashed while swapping,
+// recoverRestoreDir will recover the data dir at the next startup.
+func swapRestoreDir(dataDir string, stagingDir string) error {
+	oldDir := dataDir + restoreOldSuffix
+	err := os.RemoveAll(oldDir)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(dataDir, oldDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Rename(stagingDir, dataDir)
+	if err != nil {
+		if rerr := os.Rename(oldDir, dataDir); rerr != nil {
+			dbLog.Errorf("rollback the data dir %v failed: %v", dataDir, rerr)
+		}
+		return err
+	}
+	os.RemoveAll(oldDir)
+	return nil
+}
+
+// recover the data dir if the process crashed while restoring
+func recoverRestoreDir(dataDir string) {
+	oldDir := dataDir + restoreOldSuffix
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		if _, err := os.Stat(oldDir); err == nil {
+			// crashed before the staging dir moved in, the staging may be incomplete
+			// so we use the old data and the raft will restore again if needed.
+			dbLog.Infof("recover the data dir from %v", oldDir)
+			if err := os.Rename(oldDir, dataDir); err != nil {
+				dbLog.Errorf("recover the data dir %v failed: %v", dataDir, err)
+			}
+		}
+	}
+	os.RemoveAll(oldDir)
+	os.RemoveAll(dataDir + restoreStagingSuffix)
+}
+
+// Restore the db from the local checkpoint. The restore data will be prepared and verified
+// in the staging dir at first, and the current db will be replaced only after that, so a failed or
+// interrupted restore will not leave the db half overwritten.
+func (r *RockDB) Restore(term uint64, index uint64) error {
+	// write meta (snap term and index) and check the meta data in the backup
+	backupDir := r.GetBackupDir()
+	hasBackup, _ := r.IsLocalBackupOK(term, index)
+	if !hasBackup {
+		return errors.New("no backup for restore")
+	}
+
+	checkpointDir := GetCheckpointDir(term, index)
+	start := time.Now()
+	dbLog.Infof("begin restore from checkpoint: %v\n", checkpointDir)
+	stagingDir := r.GetDataDir() + restoreStagingSuffix
+	r.checkpointDirLock.Lock()
+	err := r.prepareRestoreStaging(path.Join(backupDir, checkpointDir), stagingDir)
+	r.checkpointDirLock.Unlock()
+	if err != nil {
+		dbLog.Infof("prepare restore staging failed:  %v\n", err)
+		os.RemoveAll(stagingDir)
+		return err
+	}
+	r.closeEng()
+	select {
+	case <-r.quit:
+		os.RemoveAll(stagingDir)
+		return errors.New("db is quiting")
+	default:
+	}
+	err = swapRestoreDir(r.GetDataDir(), stagingDir)
+	if err != nil {
+		dbLog.Infof("replace the data dir with restore staging failed:  %v\n", err)
+		os.RemoveAll(stagingDir)
+		// reopen the old db so that we can retry the restore later
+		if rerr := r.reOpenEng(); rerr != nil {
+			dbLog.Infof("reopen the db failed:  %v\n", rerr)
+		}
+		return err
 	}
 
 	err = r.reOpenEng()
@@ -1052,6 +1155,12 @@ func (r *RockDB) GetIndexSchema(table string) (*common.IndexSchema, error) {
 	return r.indexMgr.GetIndexSchemaInfo(r, table)
 }
 
+// HasUniqueHsetIndex return whether the table has any unique hash index, the writes to
+// the table depend on the other keys with the same index value.
+func (r *RockDB) HasUniqueHsetIndex(table string) bool {
+	return r.indexMgr.HasUniqueHsetIndex(table)
+}
+
 func (r *RockDB) GetAllIndexSchema() (map[string]*common.IndexSchema, error) {
 	return r.indexMgr.GetAllIndexSchemaInfo(r)
 }
@@ -1065,6 +1174,13 @@ func (r *RockDB) AddHsetIndex(table string, hindex *common.HsetIndexSchema) erro
 		ValueType:  IndexPropertyDType(hindex.ValueType),
 		State:      IndexState(hindex.State),
 	}
+	for i, f := range hindex.CompositeFields {
+		indexInfo.CompositeFields = append(indexInfo.CompositeFields, []byte(f))
+		if i < len(hindex.CompositeValueTypes) {
+			indexInfo.CompositeValueTypes = append(indexInfo.CompositeValueTypes,
+				IndexPropertyDType(hindex.CompositeValueTypes[i]))
+		}
+	}
 	index := &HsetIndex{
 		Table:         []byte(table),
 		HsetIndexInfo: indexInfo,
@@ -1073,12 +1189,20 @@ func (r *RockDB) AddHsetIndex(table string, hindex *common.HsetIndexSchema) erro
 }
 
 func (r *RockDB) UpdateHsetIndexState(table string, hindex *common.HsetIndexSchema) error {
-	return r.indexMgr.UpdateHsetIndexState(r, table, hindex.IndexField, IndexState(hindex.State))
+	compositeFields := make([][]byte, 0, len(hindex.CompositeFields))
+	for _, f := range hindex.CompositeFields {
+		compositeFields = append(compositeFields, []byte(f))
+	}
+	return r.indexMgr.UpdateHsetIndexState(r, table, hsetIndexKey([]byte(hindex.IndexField), compositeFields),
+		IndexState(hindex.State))
 }
 
 func (r *RockDB) BeginBatchWrite() error {
 	if atomic.CompareAndSwapInt32(&r.isBatching, 0, 1) {
 		r.wb.Clear()
+		if r.batchTableCounters == nil {
+			r.batchTableCounters = make(map[string]int64)
+		}
 		return nil
 	}
 	return errors.New("another batching is waiting")
@@ -1095,11 +1219,12 @@ func (r *RockDB) MaybeCommitBatch() error {
 	if atomic.LoadInt32(&r.isBatching) == 1 {
 		return nil
 	}
-	return r.eng.Write(r.defaultWriteOpts, r.wb)
+	return r.eng.Write(r.wb)
 }
 
 func (r *RockDB) CommitBatchWrite() error {
-	err := r.eng.Write(r.defaultWriteOpts, r.wb)
+	r.flushBatchTableCounters()
+	err := r.eng.Write(r.wb)
 	if err != nil {
 		dbLog.Infof("commit write error: %v", err)
 	}
@@ -1107,28 +1232,86 @@ func (r *RockDB) CommitBatchWrite() error {
 	return err
 }
 
+// AbortBatchWrite discard all the writes in the batch, and the batching is stopped
+func (r *RockDB) AbortBatchWrite() {
+	r.wb.Clear()
+	for table := range r.batchTableCounters {
+		delete(r.batchTableCounters, table)
+	}
+	atomic.StoreInt32(&r.isBatching, 0)
+}
+
+// NewWriteBatchView return a view of the db which shares the engine and all the
+// other states, but has its own write batch. It can be used to apply the batchable writes
+// for different keys concurrently. The view should be destroyed after used and should
+// not be used across the engine reopen (restore from backup).
+func (r *RockDB) NewWriteBatchView() *RockDB {
+	view := &RockDB{
+		expiration:   r.expiration,
+		cfg:          r.cfg,
+		eng:          r.eng,
+		wb:           r.eng.NewWriteBatch(),
+		quit:         r.quit,
+		engOpened:    atomic.LoadInt32(&r.engOpened),
+		indexMgr:     r.indexMgr,
+		hasher64:     murmur3.New64(),
+		hllCache:     r.hllCache,
+		rangeCleaner: r.rangeCleaner,
+	}
+	// the table states are copied under the lock of parent, since the view is only used
+	// while applying a batch and the states will not be changed by the batchable writes.
+	r.droppedMutex.RLock()
+	view.droppedTables = make(map[string]int64, len(r.droppedTables))
+	for t, ts := range r.droppedTables {
+		view.droppedTables[t] = ts
+	}
+	r.droppedMutex.RUnlock()
+	r.compressMutex.RLock()
+	view.valueCompress = make(map[string]tableValueCompress, len(r.valueCompress))
+	for t, c := range r.valueCompress {
+		view.valueCompress[t] = c
+	}
+	r.compressMutex.RUnlock()
+	r.zsetIndexMutex.RLock()
+	view.zsetScoreIndexes = make(map[string]struct{}, len(r.zsetScoreIndexes))
+	for t := range r.zsetScoreIndexes {
+		view.zsetScoreIndexes[t] = struct{}{}
+	}
+	r.zsetIndexMutex.RUnlock()
+	// the index list of the table is never modified in place, so it can be shared
+	r.ftIndexMutex.RLock()
+	view.ftIndexes = make(map[string][]common.FullTextIndexSchema, len(r.ftIndexes))
+	for t, indexes := range r.ftIndexes {
+		view.ftIndexes[t] = indexes
+	}
+	r.ftIndexMutex.RUnlock()
+	return view
+}
+
+// DestroyWriteBatchView only release the write batch owned by the view,
+// all the shared states will be released by the origin db.
+func (r *RockDB) DestroyWriteBatchView() {
+	if r.wb != nil {
+		r.wb.Destroy()
+		r.wb = nil
+	}
+}
+
 func IsBatchableWrite(cmd string) bool {
 	_, ok := batchableCmds[cmd]
 	return ok
 }
 
 func SetPerfLevel(level int) {
-	if level <= 0 || level > 4 {
-		DisablePerfLevel()
-		return
-	}
-	gorocksdb.SetPerfLevel(gorocksdb.PerfLevel(level))
+	engine.SetPerfLevel(level)
 }
 
 func IsPerfEnabledLevel(lv int) bool {
-	if lv <= 0 || lv > 4 {
-		return false
-	}
-	return lv != gorocksdb.PerfDisable
+	return engine.IsPerfEnabledLevel(lv)
 }
 
 func DisablePerfLevel() {
-	gorocksdb.SetPerfLevel(gorocksdb.PerfDisable)
+	engine.DisablePerfLevel()
 }
 
 func init() {
@@ -1139,4 +1322,9 @@ func init() {
 	batchableCmds["setex"] = true
 	batchableCmds["del"] = true
 	batchableCmds["hmset"] = true
+
+	// the error replies should be same as the redis
+	common.RegisterRedisErrorReply(errIntNumber, common.ErrRedisNotInteger.Error())
+	common.RegisterRedisErrorReply(errFloat64Number, common.ErrRedisNotFloat.Error())
+	common.RegisterRedisErrorReply(errListIndex, "ERR index out of range")
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"testing"
@@ -56,6 +57,31 @@ func TestDB(t *testing.T) {
 	defer db.Close()
 }
 
+func TestRockDBRemoteSyncedState(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	states, err := db.GetRemoteSyncedStates()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(states))
+	err = db.KVSet(0, []byte("test:key"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.SaveRemoteSyncedState("cluster1", 1, 10, 100)
+	assert.Nil(t, err)
+	err = db.SaveRemoteSyncedState("cluster2", 2, 20, 200)
+	assert.Nil(t, err)
+	err = db.SaveRemoteSyncedState("cluster1", 1, 11, 101)
+	assert.Nil(t, err)
+	states, err = db.GetRemoteSyncedStates()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(states))
+	assert.Equal(t, RemoteSyncedState{ClusterName: "cluster1", Term: 1, Index: 11, Timestamp: 101}, states[0])
+	assert.Equal(t, RemoteSyncedState{ClusterName: "cluster2", Term: 2, Index: 20, Timestamp: 200}, states[1])
+	// should not be seen as table
+	assert.Equal(t, 1, len(db.GetTables()))
+}
+
 func TestRockDB(t *testing.T) {
 	db := getTestDB(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -634,3 +660,575 @@ func TestRockDBScanTableForZSet(t *testing.T) {
 	diskUsage = db.GetTableSizeInRange("test2", nil, nil)
 	t.Logf("test2 key number: %v, usage: %v", keyNum, diskUsage)
 }
+
+func TestRockDBRestoreFromCheckpoint(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:restore_key1")
+	key2 := []byte("test:restore_key2")
+	err := db.KVSet(0, key1, []byte("v1"))
+	assert.Nil(t, err)
+	bi := db.Backup(1, 1)
+	assert.NotNil(t, bi)
+	_, err = bi.GetResult()
+	assert.Nil(t, err)
+	err = db.KVSet(0, key2, []byte("v2"))
+	assert.Nil(t, err)
+
+	err = db.Restore(1, 1)
+	assert.Nil(t, err)
+	v, err := db.KVGet(key1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	v, err = db.KVGet(key2)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	_, err = os.Stat(db.GetDataDir() + restoreStagingSuffix)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(db.GetDataDir() + restoreOldSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	// restore from the missing checkpoint should keep the current data
+	err = db.Restore(1, 2)
+	assert.NotNil(t, err)
+	v, err = db.KVGet(key1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+}
+
+func TestRockDBGetLatestBackup(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	term, index, err := db.GetLatestBackup()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), term)
+	assert.Equal(t, uint64(0), index)
+
+	bi := db.Backup(1, 10)
+	assert.NotNil(t, bi)
+	_, err = bi.GetResult()
+	assert.Nil(t, err)
+	bi = db.Backup(2, 5)
+	assert.NotNil(t, bi)
+	_, err = bi.GetResult()
+	assert.Nil(t, err)
+	// the invalid dir should be ignored
+	err = os.MkdirAll(path.Join(db.GetBackupDir(), "invalid-dir"), common.DIR_PERM)
+	assert.Nil(t, err)
+
+	term, index, err = db.GetLatestBackup()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), term)
+	assert.Equal(t, uint64(5), index)
+}
+
+func TestPurgeOldCheckpointSkipStaging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-purge")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	names := []string{"1-a", "1-b", "2-1", "2-2.staging", "invalid-dir"}
+	for _, name := range names {
+		err = os.MkdirAll(path.Join(dir, name), common.DIR_PERM)
+		assert.Nil(t, err)
+	}
+	purgeOldCheckpoint(2, dir)
+	for _, name := range names {
+		_, err := os.Stat(path.Join(dir, name))
+		if name == "1-a" {
+			assert.True(t, os.IsNotExist(err), name)
+		} else {
+			assert.Nil(t, err, name)
+		}
+	}
+}
+
+func TestRockDBRecoverInterruptedRestore(t *testing.T) {
+	db := getTestDB(t)
+	dataDir := db.cfg.DataDir
+	defer os.RemoveAll(dataDir)
+	key := []byte("test:restore_key")
+	err := db.KVSet(0, key, []byte("v1"))
+	assert.Nil(t, err)
+	rocksDir := db.GetDataDir()
+	db.Close()
+
+	// crashed after the data dir moved away but before the staging moved in
+	err = os.Rename(rocksDir, rocksDir+restoreOldSuffix)
+	assert.Nil(t, err)
+	err = os.MkdirAll(rocksDir+restoreStagingSuffix, common.DIR_PERM)
+	assert.Nil(t, err)
+
+	db = getTestDBWithDir(t, dataDir)
+	defer db.Close()
+	v, err := db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	_, err = os.Stat(rocksDir + restoreStagingSuffix)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(rocksDir + restoreOldSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRockDBDropTable(t *testing.T) {
+	db := getTestDB(t)
+	dataDir := db.cfg.DataDir
+	defer os.RemoveAll(dataDir)
+
+	err := db.KVSet(0, []byte("test:k1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:h1"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = db.SAdd(0, []byte("test:s1"), []byte("m1"), []byte("m2"))
+	assert.Nil(t, err)
+	err = db.KVSet(0, []byte("test2:k1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test2:h1"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	cnt, err := db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), cnt)
+	_, err = db.HExpire([]byte("test:h1"), 100)
+	assert.Nil(t, err)
+	_, err = db.SExpire([]byte("test:s1"), 100)
+	assert.Nil(t, err)
+	_, err = db.HExpire([]byte("test2:h1"), 100)
+	assert.Nil(t, err)
+
+	view := db.NewWriteBatchView()
+	assert.False(t, view.IsTableDropped("test"))
+	view.DestroyWriteBatchView()
+	err = db.DropTable("test")
+	assert.Nil(t, err)
+	assert.True(t, db.IsTableDropped("test"))
+	assert.False(t, db.IsTableDropped("test2"))
+	view = db.NewWriteBatchView()
+	assert.True(t, view.IsTableDropped("test"))
+	assert.False(t, view.IsTableDropped("test2"))
+	view.DestroyWriteBatchView()
+	// the expire of the dropped keys should be deleted
+	ttl, err := db.HashTtl([]byte("test:h1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	ttl, err = db.SetTtl([]byte("test:s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	ttl, err = db.HashTtl([]byte("test2:h1"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	it, err := NewDBRangeIterator(db.eng, []byte{ExpTimeType}, []byte{ExpTimeType + 1}, common.RangeROpen, false)
+	assert.Nil(t, err)
+	timeKeys := 0
+	for ; it.Valid(); it.Next() {
+		timeKeys++
+	}
+	it.Close()
+	assert.Equal(t, 1, timeKeys)
+	assert.Equal(t, int64(0), db.GetTableSizeInRange("test", nil, nil))
+	assert.Equal(t, int64(0), db.GetTableApproximateNumInRange("test", nil, nil))
+	cnt, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+	v, err := db.KVGet([]byte("test:k1"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = db.HGet([]byte("test:h1"), []byte("f1"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	n, err := db.SCard([]byte("test:s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	v, err = db.KVGet([]byte("test2:k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+
+	// the dropped mark should be kept after reopen
+	db.Close()
+	db = getTestDBWithDir(t, dataDir)
+	defer db.Close()
+	assert.Equal(t, []string{"test"}, db.GetDroppedTables())
+
+	db.purgeDroppedTables()
+	assert.False(t, db.IsTableDropped("test"))
+	assert.Equal(t, 0, len(db.GetDroppedTables()))
+	// the table can be used again after dropped
+	err = db.KVSet(0, []byte("test:k1"), []byte("v2"))
+	assert.Nil(t, err)
+	v, err = db.KVGet([]byte("test:k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), v)
+
+	// the stale expire should be cleared while the key is created
+	for _, dt := range []byte{HashType, SetType, ZSetType} {
+		err = db.expire(dt, []byte("test:stale"), 100)
+		assert.Nil(t, err)
+	}
+	_, err = db.HSet(0, false, []byte("test:stale"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = db.SAdd(0, []byte("test:stale"), []byte("m1"))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, []byte("test:stale"), common.ScorePair{Score: 1, Member: []byte("m1")})
+	assert.Nil(t, err)
+	ttl, err = db.HashTtl([]byte("test:stale"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	ttl, err = db.SetTtl([]byte("test:stale"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+	ttl, err = db.ZSetTtl([]byte("test:stale"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+}
+
+func TestRockDBRecountTableKeys(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err := db.KVSet(0, []byte("test:k"+strconv.Itoa(i)), []byte("v1"))
+		assert.Nil(t, err)
+	}
+	_, err := db.HSet(0, false, []byte("test:h1"), []byte("f1"), []byte("v1"))
+	assert.Nil(t, err)
+	_, err = db.SAdd(0, []byte("test:s1"), []byte("m1"), []byte("m2"))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, []byte("test:z1"), common.ScorePair{Score: 1, Member: []byte("m1")})
+	assert.Nil(t, err)
+	_, err = db.RPush(0, []byte("test:l1"), []byte("e1"))
+	assert.Nil(t, err)
+	err = db.KVSet(0, []byte("test2:k1"), []byte("v1"))
+	assert.Nil(t, err)
+	cnt, err := db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(14), cnt)
+
+	// make the counter drift
+	wb := db.eng.NewWriteBatch()
+	db.IncrTableKeyCount([]byte("test"), 5, wb)
+	err = db.eng.Write(wb)
+	wb.Destroy()
+	assert.Nil(t, err)
+	cnt, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(19), cnt)
+
+	err = db.RecountTableKeys("test")
+	assert.Nil(t, err)
+	cnt, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(14), cnt)
+	st := db.GetRecountStatus()
+	assert.Equal(t, "test", st.Table)
+	assert.Equal(t, int64(19), st.OldCount)
+	assert.Equal(t, int64(14), st.NewCount)
+	assert.False(t, st.Running)
+	cnt, err = db.GetTableKeyCount([]byte("test2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+}
+
+func TestRockDBScanTableWithCursor(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		err := db.KVSet(0, []byte(fmt.Sprintf("test:scan_cursor_%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+		err = db.KVSet(0, []byte(fmt.Sprintf("test2:scan_cursor_%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+		_, err = db.HSet(0, false, []byte(fmt.Sprintf("test:scan_hash_%02d", i)), []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+	// the count is the number of examined keys, and the match may filter all of them
+	keys, next, err := db.ScanTable(common.KV, []byte("test:"), 5, "test:scan_cursor_1*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Equal(t, "test:scan_cursor_04", string(next))
+
+	matched := 0
+	cursor := []byte("test:")
+	for {
+		keys, next, err = db.ScanTable(common.KV, cursor, 3, "test:scan_cursor_1?")
+		assert.Nil(t, err)
+		matched += len(keys)
+		if len(next) == 0 {
+			break
+		}
+		// add and remove keys while scanning should not break the termination
+		err = db.KVSet(0, append(next, 'x'), []byte("v"))
+		assert.Nil(t, err)
+		cursor = next
+	}
+	assert.Equal(t, 10, matched)
+
+	// the scan should stop at the end of the table
+	keys, next, err = db.ScanTable(common.HASH, []byte("test:"), 100, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(keys))
+	assert.Nil(t, next)
+	for _, k := range keys {
+		assert.True(t, strings.HasPrefix(string(k), "test:scan_hash_"))
+	}
+}
+
+func TestRockDBScanTableBoundary(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err := db.KVSet(0, []byte(fmt.Sprintf("test:scan_bound_%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+		err = db.KVSet(0, []byte(fmt.Sprintf("test2:scan_bound_%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+	// the cursor is kept if exactly count keys are examined at the end of the table,
+	// and the next scan returns nothing without crossing into the next table.
+	keys, next, err := db.ScanTable(common.KV, []byte("test:"), 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(keys))
+	assert.Equal(t, "test:scan_bound_09", string(next))
+	keys, next, err = db.ScanTable(common.KV, next, 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Nil(t, next)
+
+	// the cursor is empty if less than count keys are examined
+	keys, next, err = db.ScanTable(common.KV, []byte("test:"), 11, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(keys))
+	assert.Nil(t, next)
+	for _, k := range keys {
+		assert.True(t, strings.HasPrefix(string(k), "test:scan_bound_"))
+	}
+
+	// the last chunk filtered by the match still ends the scan at the table boundary
+	keys, next, err = db.ScanTable(common.KV, []byte("test:scan_bound_05"), 5, "test:nomatch*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Nil(t, next)
+}
+
+func TestRockDBCollectionScanWithCursor(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	hkey := []byte("test:scan_cursor_hash")
+	skey := []byte("test:scan_cursor_set")
+	zkey := []byte("test:scan_cursor_zset")
+	// the empty member should be scanned too
+	_, err := db.HSet(0, false, hkey, []byte(""), []byte("v"))
+	assert.Nil(t, err)
+	_, err = db.SAdd(0, skey, []byte(""))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, zkey, common.ScorePair{Score: 0, Member: []byte("")})
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		m := []byte(fmt.Sprintf("m%02d", i))
+		_, err = db.HSet(0, false, hkey, m, m)
+		assert.Nil(t, err)
+		_, err = db.SAdd(0, skey, m)
+		assert.Nil(t, err)
+		_, err = db.ZAdd(0, zkey, common.ScorePair{Score: float64(i), Member: m})
+		assert.Nil(t, err)
+	}
+
+	// the count is the number of examined members, and the match may filter all of them
+	fvs, next, err := db.HScan(hkey, nil, 5, "m1*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(fvs))
+	assert.Equal(t, "m03", string(next))
+
+	scanned := make(map[string]int)
+	var cursor []byte
+	for {
+		fvs, next, err = db.HScan(hkey, cursor, 3, "")
+		assert.Nil(t, err)
+		assert.True(t, len(fvs) <= 3)
+		for _, fv := range fvs {
+			scanned[string(fv.Key)]++
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	// each field should be returned exactly once without the overlap between the chunks
+	assert.Equal(t, 21, len(scanned))
+	for f, n := range scanned {
+		assert.Equal(t, 1, n, "field %v scanned more than once", f)
+	}
+
+	matched := 0
+	cursor = nil
+	for {
+		ms, next, err := db.SScan(skey, cursor, 4, "m1?")
+		assert.Nil(t, err)
+		matched += len(ms)
+		if next == nil {
+			break
+		}
+		// add and remove members while scanning should not break the termination
+		_, err = db.SAdd(0, skey, append(next, 'x'))
+		assert.Nil(t, err)
+		cursor = next
+	}
+	assert.Equal(t, 10, matched)
+
+	sps, next, err := db.ZScan(zkey, []byte("m18"), 10, "")
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+	assert.Equal(t, 1, len(sps))
+	assert.Equal(t, "m19", string(sps[0].Member))
+	assert.Equal(t, float64(19), sps[0].Score)
+	sps, next, err = db.ZScan(zkey, nil, 100, "")
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+	assert.Equal(t, 21, len(sps))
+	assert.Equal(t, "", string(sps[0].Member))
+}
+
+func TestRockDBKeyMemoryUsageAndBigKeys(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	kvKey := []byte("test:kvkey")
+	err := db.KVSet(0, kvKey, []byte("hello world"))
+	assert.Nil(t, err)
+	kvSize, err := db.KeyMemoryUsage(kvKey)
+	assert.Nil(t, err)
+	assert.True(t, kvSize >= int64(len(kvKey)+len("hello world")))
+
+	_, err = db.Expire(kvKey, 100)
+	assert.Nil(t, err)
+	kvTTLSize, err := db.KeyMemoryUsage(kvKey)
+	assert.Nil(t, err)
+	assert.True(t, kvTTLSize > kvSize)
+
+	hKey := []byte("test:hkey")
+	fvs := make([]common.KVRecord, 0, 100)
+	for i := 0; i < 100; i++ {
+		fvs = append(fvs, common.KVRecord{Key: []byte("field" + strconv.Itoa(i)), Value: []byte("value")})
+	}
+	err = db.HMset(0, hKey, fvs...)
+	assert.Nil(t, err)
+	hSize, err := db.KeyMemoryUsage(hKey)
+	assert.Nil(t, err)
+	assert.True(t, hSize >= int64(100*len("field0value")))
+
+	// the same key in different types should be all counted
+	_, err = db.SAdd(0, hKey, []byte("m1"))
+	assert.Nil(t, err)
+	totalSize, err := db.KeyMemoryUsage(hKey)
+	assert.Nil(t, err)
+	assert.True(t, totalSize > hSize)
+
+	zKey := []byte("test:zkey")
+	_, err = db.ZAdd(0, zKey, common.ScorePair{Score: 1, Member: []byte("m1")}, common.ScorePair{Score: 2, Member: []byte("m2")})
+	assert.Nil(t, err)
+	zSize, err := db.KeyMemoryUsage(zKey)
+	assert.Nil(t, err)
+	assert.True(t, zSize > 0)
+
+	noSize, err := db.KeyMemoryUsage([]byte("test:nokey"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), noSize)
+
+	err = db.ScanBigKeys("test", 0, 50)
+	assert.Nil(t, err)
+	st := db.GetBigKeyScanStatus()
+	assert.False(t, st.Running)
+	assert.Equal(t, "", st.Err)
+	assert.Equal(t, int64(4), st.ScannedKeys)
+	assert.Equal(t, int64(1), st.TotalBigKeys)
+	assert.Equal(t, 1, len(st.BigKeys))
+	assert.Equal(t, string(hKey), st.BigKeys[0].Key)
+	assert.Equal(t, "hash", st.BigKeys[0].Type)
+	assert.Equal(t, int64(100), st.BigKeys[0].Elements)
+
+	err = db.ScanBigKeys("test", kvTTLSize, 0)
+	assert.Nil(t, err)
+	st = db.GetBigKeyScanStatus()
+	assert.True(t, st.TotalBigKeys >= 2)
+	// ordered by the size
+	assert.Equal(t, string(hKey), st.BigKeys[0].Key)
+}
+
+func TestRockDBInspectTables(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		err := db.KVSet(0, []byte("test:kv"+strconv.Itoa(i)), []byte("value"))
+		assert.Nil(t, err)
+	}
+	_, err := db.Expire([]byte("test:kv0"), 100)
+	assert.Nil(t, err)
+	fvs := make([]common.KVRecord, 0, 20)
+	for i := 0; i < 20; i++ {
+		fvs = append(fvs, common.KVRecord{Key: []byte("field" + strconv.Itoa(i)), Value: []byte("value")})
+	}
+	err = db.HMset(0, []byte("test:hkey"), fvs...)
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, []byte("test:zkey"), common.ScorePair{Score: 1, Member: []byte("m1")})
+	assert.Nil(t, err)
+	err = db.KVSet(0, []byte("test2:kv"), []byte("value"))
+	assert.Nil(t, err)
+
+	err = db.InspectTables("test")
+	assert.Nil(t, err)
+	st := db.GetTableInspectStatus()
+	assert.False(t, st.Running)
+	assert.Equal(t, "", st.Err)
+	assert.Equal(t, int64(12), st.ScannedKeys)
+	assert.Equal(t, 1, len(st.Tables))
+	ts := st.Tables["test"]
+	assert.NotNil(t, ts)
+	assert.Equal(t, int64(12), ts.TotalKeys)
+	assert.Equal(t, int64(10), ts.Keys["kv"])
+	assert.Equal(t, int64(1), ts.Keys["hash"])
+	assert.Equal(t, int64(1), ts.Keys["zset"])
+	assert.Equal(t, int64(12), ts.KeySize.Total)
+	// only the collections have the elements
+	assert.Equal(t, int64(2), ts.Elements.Total)
+	assert.Equal(t, int64(20), ts.Elements.Max)
+	assert.Equal(t, int64(1), ts.TTL.Total)
+	assert.True(t, ts.TTL.Max <= 100)
+}
+
+func TestDecodeMalformedKeys(t *testing.T) {
+	table := []byte("test")
+	key := []byte("key")
+	// the table without the separator
+	_, _, err := decodeDataTablePrefixFromBuf([]byte{HashType, 0, 0}, HashType)
+	assert.NotNil(t, err)
+	// the key without the separator and the member
+	hk := hEncodeHashKey(table, key, []byte("f"))
+	_, _, _, err = hDecodeHashKey(hk[:len(hk)-2])
+	assert.NotNil(t, err)
+	sk := sEncodeSetKey(table, key, []byte("m"))
+	_, _, _, err = sDecodeSetKey(sk[:len(sk)-2])
+	assert.NotNil(t, err)
+	zk := zEncodeSetKey(table, key, []byte("m"))
+	_, _, _, err = zDecodeSetKey(zk[:len(zk)-2])
+	assert.NotNil(t, err)
+	// the json key without the redis key
+	buf := make([]byte, getDataTablePrefixBufLen(JSONType, table))
+	pos := encodeDataTablePrefixToBuf(buf, JSONType, table)
+	jk, err := EncodeMemCmpKey(buf[:pos], jSep)
+	assert.Nil(t, err)
+	_, _, err = decodeJSONKey(jk)
+	assert.NotNil(t, err)
+
+	_, hk2, _, err := hDecodeHashKey(hk)
+	assert.Nil(t, err)
+	assert.Equal(t, key, hk2)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
 	"github.com/gobwas/glob"
 )
 
@@ -80,7 +81,16 @@ func buildMatchRegexp(match string) (glob.Glob, error) {
 
 func (db *RockDB) buildScanIterator(minKey []byte, maxKey []byte) (*RangeLimitedIterator, error) {
 	tp := common.RangeOpen
-	return NewDBRangeIterator(db.eng, minKey, maxKey, tp, false)
+	return NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(true), minKey, maxKey, tp, 0, -1, false)
+}
+
+// the iterator options for the large scan, the cache hints avoid evicting the hot data by the scan
+func (db *RockDB) scanIteratorOpts(withSnap bool) engine.IteratorOpts {
+	return engine.IteratorOpts{
+		WithSnap:      withSnap,
+		FillCache:     db.cfg.ScanFillCache,
+		ReadaheadSize: db.cfg.ScanReadaheadSize,
+	}
 }
 
 func buildScanKeyRange(storeDataType byte, key []byte) (minKey []byte, maxKey []byte, err error) {
@@ -206,6 +216,57 @@ func (db *RockDB) scanGenericUseBuffer(storeDataType byte, key []byte, count int
 
 }
 
+// ScanTable scan the keys in the table from the cursor (table:key), at most count keys will be
+// examined and the matched keys will be returned with the next cursor like the redis scan.
+// The next cursor is empty only if less than count keys are examined which means all the keys
+// in the table have been examined, so the keys exist during the whole scan will always be
+// returned and the scan always terminates even if the keys are added or removed while scanning.
+func (db *RockDB) ScanTable(dataType common.DataType, cursor []byte, count int, match string) ([][]byte, []byte, error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, nil, err
+	}
+	minKey, err := encodeScanMinKey(storeDataType, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxKey, err := encodeScanKeyTableEnd(storeDataType, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	count = checkScanCount(count)
+
+	it, err := db.buildScanIterator(minKey, maxKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+
+	keys := make([][]byte, 0, count)
+	next := cursor
+	examined := 0
+	for ; it.Valid() && examined < count; it.Next() {
+		examined++
+		k, err := decodeScanKey(storeDataType, it.Key())
+		if err != nil {
+			continue
+		}
+		next = k
+		if r != nil && !r.Match(string(k)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if examined < count {
+		return keys, nil, nil
+	}
+	return keys, next, nil
+}
+
 func (db *RockDB) scanGeneric(storeDataType byte, key []byte, count int,
 	match string) ([][]byte, error) {
 
@@ -259,9 +320,10 @@ func encodeSpecificDataScanKey(storeDataType byte, key []byte, cursor []byte) ([
 	}
 }
 
+// build the iterator of the members after the cursor member, all the members will be
+// iterated if the cursor is nil.
 func (db *RockDB) buildSpecificDataScanIterator(storeDataType byte,
-	key []byte, cursor []byte,
-	count int) (*RangeLimitedIterator, error) {
+	key []byte, cursor []byte) (*RangeLimitedIterator, error) {
 
 	if err := checkKeySize(key); err != nil {
 		return nil, err
@@ -271,115 +333,113 @@ func (db *RockDB) buildSpecificDataScanIterator(storeDataType byte,
 	if err != nil {
 		return nil, err
 	}
-
-	it, err := db.buildScanIterator(minKey, maxKey)
-
-	if err != nil {
-		return nil, err
+	// the empty member has the same encoded key as the start of the range, so the
+	// start should be included while scanning from the beginning.
+	tp := common.RangeOpen
+	if cursor == nil {
+		tp = common.RangeROpen
 	}
-	return it, nil
+	return NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(true), minKey, maxKey, tp, 0, -1, false)
 }
 
-func (db *RockDB) hScanGeneric(key []byte, cursor []byte, count int, match string) ([]common.KVRecord, error) {
+// scanCollectionGeneric examine at most count members after the cursor member of the hash,
+// set or zset, and the matched members will be passed to fn. Like the ScanTable, the last
+// examined member is returned as the next cursor and the nil next cursor means all the
+// members have been examined, so the matched members may be less than count even if the
+// scan is not finished.
+func (db *RockDB) scanCollectionGeneric(storeDataType byte, key []byte, cursor []byte, count int, match string,
+	decode func(ek []byte) ([]byte, error), fn func(member []byte, value []byte) error) ([]byte, error) {
 	count = checkScanCount(count)
 	r, err := buildMatchRegexp(match)
 	if err != nil {
 		return nil, err
 	}
-
-	v := make([]common.KVRecord, 0, count)
-
-	it, err := db.buildSpecificDataScanIterator(HashType, key, cursor, count)
+	it, err := db.buildSpecificDataScanIterator(storeDataType, key, cursor)
 	if err != nil {
 		return nil, err
 	}
-	it.NoTimestamp(HashType)
+	if storeDataType == HashType {
+		it.NoTimestamp(HashType)
+	}
 	defer it.Close()
 
-	for i := 0; it.Valid() && i < count; it.Next() {
-		_, _, f, err := hDecodeHashKey(it.Key())
+	var next []byte
+	examined := 0
+	for ; it.Valid() && examined < count; it.Next() {
+		m, err := decode(it.Key())
 		if err != nil {
 			return nil, err
-		} else if r != nil && !r.Match(string(f)) {
+		}
+		examined++
+		next = m
+		if r != nil && !r.Match(string(m)) {
 			continue
 		}
-		v = append(v, common.KVRecord{Key: f, Value: it.Value()})
-		i++
-	}
-	return v, nil
-}
-
-func (db *RockDB) HScan(key []byte, cursor []byte, count int, match string) ([]common.KVRecord, error) {
-	return db.hScanGeneric(key, cursor, count, match)
-}
-
-func (db *RockDB) sScanGeneric(key []byte, cursor []byte, count int, match string) ([][]byte, error) {
-	count = checkScanCount(count)
-	r, err := buildMatchRegexp(match)
-	if err != nil {
-		return nil, err
-	}
-	v := make([][]byte, 0, count)
-
-	it, err := db.buildSpecificDataScanIterator(SetType, key, cursor, count)
-	if err != nil {
-		return nil, err
-	}
-	defer it.Close()
-
-	for i := 0; it.Valid() && i < count; it.Next() {
-		_, _, m, err := sDecodeSetKey(it.Key())
-		if err != nil {
+		if err := fn(m, it.Value()); err != nil {
 			return nil, err
-		} else if r != nil && !r.Match(string(m)) {
-			continue
 		}
-
-		v = append(v, m)
-		i++
 	}
-	return v, nil
-}
-
-func (db *RockDB) SScan(key []byte, cursor []byte, count int, match string) ([][]byte, error) {
-	return db.sScanGeneric(key, cursor, count, match)
+	if examined < count {
+		return nil, nil
+	}
+	return next, nil
 }
 
-func (db *RockDB) zScanGeneric(key []byte, cursor []byte, count int, match string) ([]common.ScorePair, error) {
-	count = checkScanCount(count)
-
-	r, err := buildMatchRegexp(match)
+// HScan return the fields after the cursor field and the next cursor, see scanCollectionGeneric.
+func (db *RockDB) HScan(key []byte, cursor []byte, count int, match string) ([]common.KVRecord, []byte, error) {
+	var v []common.KVRecord
+	next, err := db.scanCollectionGeneric(HashType, key, cursor, count, match,
+		func(ek []byte) ([]byte, error) {
+			_, _, f, err := hDecodeHashKey(ek)
+			return f, err
+		},
+		func(f []byte, value []byte) error {
+			v = append(v, common.KVRecord{Key: f, Value: value})
+			return nil
+		})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return v, next, nil
+}
 
-	v := make([]common.ScorePair, 0, count)
-
-	it, err := db.buildSpecificDataScanIterator(ZSetType, key, cursor, count)
+// SScan return the members after the cursor member and the next cursor, see scanCollectionGeneric.
+func (db *RockDB) SScan(key []byte, cursor []byte, count int, match string) ([][]byte, []byte, error) {
+	var v [][]byte
+	next, err := db.scanCollectionGeneric(SetType, key, cursor, count, match,
+		func(ek []byte) ([]byte, error) {
+			_, _, m, err := sDecodeSetKey(ek)
+			return m, err
+		},
+		func(m []byte, value []byte) error {
+			v = append(v, m)
+			return nil
+		})
 	if err != nil {
-		return nil, err
-	}
-	defer it.Close()
-
-	for i := 0; it.Valid() && i < count; it.Next() {
-		_, _, m, err := zDecodeSetKey(it.Key())
-		if err != nil {
-			return nil, err
-		} else if r != nil && !r.Match(string(m)) {
-			continue
-		}
-
-		score, err := Float64(it.Value(), nil)
-		if err != nil {
-			return nil, err
-		}
-
-		v = append(v, common.ScorePair{Score: score, Member: m})
-		i++
+		return nil, nil, err
 	}
-	return v, nil
+	return v, next, nil
 }
 
-func (db *RockDB) ZScan(key []byte, cursor []byte, count int, match string) ([]common.ScorePair, error) {
-	return db.zScanGeneric(key, cursor, count, match)
+// ZScan return the members with the scores after the cursor member and the next cursor,
+// the members are in the lexicographical order, see scanCollectionGeneric.
+func (db *RockDB) ZScan(key []byte, cursor []byte, count int, match string) ([]common.ScorePair, []byte, error) {
+	var v []common.ScorePair
+	next, err := db.scanCollectionGeneric(ZSetType, key, cursor, count, match,
+		func(ek []byte) ([]byte, error) {
+			_, _, m, err := zDecodeSetKey(ek)
+			return m, err
+		},
+		func(m []byte, value []byte) error {
+			score, err := Float64(value, nil)
+			if err != nil {
+				return err
+			}
+			v = append(v, common.ScorePair{Score: score, Member: m})
+			return nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, next, nil
 }
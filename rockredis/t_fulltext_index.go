@@ -0,0 +1,546 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+	"github.com/tidwall/gjson"
+)
+
+// The full text index is an inverted index for the text in the hash field or json path,
+// the posting key is [table prefix][index name:term 0 pk] with the term frequency as value.
+// Since the term only has the letters and digits, the prefix of the term can be searched
+// by the range of the posting keys.
+
+var (
+	ErrFullTextIndexExist     = errors.New("full text index already exist")
+	ErrFullTextQueryInvalid   = errors.New("invalid full text query")
+	ErrFullTextTooManyMatches = errors.New("too many matches for the full text query term")
+	errFullTextIndexKey       = errors.New("invalid full text index key")
+)
+
+var ftIndexPrefix = []byte("ftidx" + string(metaSep))
+
+const (
+	ftTermSep = byte(0)
+	// the long term will be ignored while indexing
+	MaxFullTextTermLen = 64
+	// the max matched documents for each term in the query
+	MaxFullTextTermMatches = 10000
+)
+
+type FTSearchResp struct {
+	PKey  []byte
+	Score float64
+}
+
+// split the text into the lower case terms with the term frequency, the text is split by the
+// non letter and digit characters, and each han character will be a single term since there
+// is no space between the words.
+func tokenizeFullText(text []byte) map[string]int {
+	terms := make(map[string]int)
+	var term bytes.Buffer
+	addTerm := func() {
+		if term.Len() > 0 && term.Len() <= MaxFullTextTermLen {
+			terms[term.String()]++
+		}
+		term.Reset()
+	}
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		if unicode.Is(unicode.Han, r) {
+			addTerm()
+			term.WriteRune(r)
+			addTerm()
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			term.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		addTerm()
+	}
+	addTerm()
+	return terms
+}
+
+func encodeFullTextIndexMetaKey(table []byte, name []byte) []byte {
+	tk := make([]byte, 0, 1+len(ftIndexPrefix)+len(table)+1+len(name))
+	tk = append(tk, TableMetaType)
+	tk = append(tk, ftIndexPrefix...)
+	tk = append(tk, table...)
+	tk = append(tk, metaSep)
+	tk = append(tk, name...)
+	return tk
+}
+
+func decodeFullTextIndexMetaKey(tk []byte) ([]byte, []byte, error) {
+	pos := 0
+	if len(tk) < pos+1+len(ftIndexPrefix) || tk[pos] != TableMetaType {
+		return nil, nil, errTableMetaKey
+	}
+	pos++
+	pos += len(ftIndexPrefix)
+	index := bytes.IndexByte(tk[pos:], metaSep)
+	if index == -1 {
+		return nil, nil, errTableMetaKey
+	}
+	return tk[pos : pos+index], tk[pos+index+1:], nil
+}
+
+func encodeFullTextIndexTableStartKey(table []byte) []byte {
+	tmpkey := make([]byte, 1+2+len(table)+1)
+	pos := 0
+	tmpkey[pos] = FullTextIndexDataType
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
+	pos += 2
+	copy(tmpkey[pos:], table)
+	pos += len(table)
+	tmpkey[pos] = tableIndexMetaStartSep
+	return tmpkey
+}
+
+func encodeFullTextIndexTableStopKey(table []byte) []byte {
+	k := encodeFullTextIndexTableStartKey(table)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
+func encodeFullTextIndexStartKey(table []byte, name []byte) []byte {
+	k := encodeFullTextIndexTableStartKey(table)
+	k = append(k, name...)
+	k = append(k, metaSep)
+	return k
+}
+
+func encodeFullTextIndexStopKey(table []byte, name []byte) []byte {
+	k := encodeFullTextIndexStartKey(table, name)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
+func encodeFullTextIndexKey(table []byte, name []byte, term []byte, pk []byte) []byte {
+	k := encodeFullTextIndexStartKey(table, name)
+	k = append(k, term...)
+	k = append(k, ftTermSep)
+	k = append(k, pk...)
+	return k
+}
+
+func decodeFullTextIndexKey(table []byte, name []byte, rawKey []byte) ([]byte, []byte, error) {
+	headerLen := 1 + 2 + len(table) + 1 + len(name) + 1
+	if len(rawKey) <= headerLen {
+		return nil, nil, errFullTextIndexKey
+	}
+	index := bytes.IndexByte(rawKey[headerLen:], ftTermSep)
+	if index == -1 {
+		return nil, nil, errFullTextIndexKey
+	}
+	return rawKey[headerLen : headerLen+index], rawKey[headerLen+index+1:], nil
+}
+
+func (db *RockDB) getFullTextIndexes(table []byte) []common.FullTextIndexSchema {
+	db.ftIndexMutex.RLock()
+	indexes := db.ftIndexes[string(table)]
+	db.ftIndexMutex.RUnlock()
+	return indexes
+}
+
+// update the postings of the document from the old text to the new text, the
+// old or new text should be nil if the document is created or removed.
+func (db *RockDB) updateFullTextPostings(table []byte, name []byte, pk []byte,
+	oldText []byte, newText []byte, wb engine.WriteBatch) {
+	var oldTerms map[string]int
+	if oldText != nil {
+		oldTerms = tokenizeFullText(oldText)
+	}
+	var newTerms map[string]int
+	if newText != nil {
+		newTerms = tokenizeFullText(newText)
+	}
+	for term := range oldTerms {
+		if _, ok := newTerms[term]; !ok {
+			wb.Delete(encodeFullTextIndexKey(table, name, []byte(term), pk))
+		}
+	}
+	for term, tf := range newTerms {
+		if oldTerms[term] == tf {
+			continue
+		}
+		wb.Put(encodeFullTextIndexKey(table, name, []byte(term), pk), PutInt64(int64(tf)))
+	}
+}
+
+// update the full text indexes on the hash field, the value should be nil if the field is deleted
+func (db *RockDB) hsetFullTextIndexUpdate(key []byte, field []byte, oldV []byte, newV []byte, wb engine.WriteBatch) error {
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	for _, index := range db.getFullTextIndexes(table) {
+		if index.HsetField != string(field) {
+			continue
+		}
+		db.updateFullTextPostings(table, []byte(index.Name), key, oldV, newV, wb)
+	}
+	return nil
+}
+
+// remove the full text indexes on all the hash fields of the key
+func (db *RockDB) hsetFullTextIndexRemoveAll(key []byte, wb engine.WriteBatch) error {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	for _, index := range db.getFullTextIndexes(table) {
+		if index.HsetField == "" {
+			continue
+		}
+		oldV, err := db.eng.GetBytesNoLock(hEncodeHashKey(table, rk, []byte(index.HsetField)))
+		if err != nil {
+			return err
+		}
+		if len(oldV) >= tsLen {
+			oldV = oldV[:len(oldV)-tsLen]
+		}
+		if oldV != nil {
+			db.updateFullTextPostings(table, []byte(index.Name), key, oldV, nil, wb)
+		}
+	}
+	return nil
+}
+
+// update the full text indexes on the json path, the json should be nil if the key is deleted
+func (db *RockDB) jsonFullTextIndexUpdate(key []byte, oldJSON []byte, newJSON []byte, wb engine.WriteBatch) error {
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	for _, index := range db.getFullTextIndexes(table) {
+		if index.JSONPath == "" {
+			continue
+		}
+		path := convertJSONPath([]byte(index.JSONPath))
+		var oldText, newText []byte
+		if oldJSON != nil {
+			if v := gjson.GetBytes(oldJSON, path); v.Exists() {
+				oldText = []byte(v.String())
+			}
+		}
+		if newJSON != nil {
+			if v := gjson.GetBytes(newJSON, path); v.Exists() {
+				newText = []byte(v.String())
+			}
+		}
+		db.updateFullTextPostings(table, []byte(index.Name), key, oldText, newText, wb)
+	}
+	return nil
+}
+
+// build the full text index for the existing hash or json data in the table
+func (db *RockDB) buildFullTextIndex(table []byte, index *common.FullTextIndexSchema) error {
+	var start, stop []byte
+	var err error
+	if index.HsetField != "" {
+		rgs, err := getTableDataRange(HashType, table, nil, nil)
+		if err != nil {
+			return err
+		}
+		start, stop = rgs[0].Start, rgs[0].Limit
+	} else {
+		start, err = encodeJSONStartKey(table)
+		if err != nil {
+			return err
+		}
+		stop = encodeJSONStopKey(table, nil)
+	}
+	it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	cnt := 0
+	path := convertJSONPath([]byte(index.JSONPath))
+	for ; it.Valid(); it.Next() {
+		v := it.Value()
+		if len(v) >= tsLen {
+			v = v[:len(v)-tsLen]
+		}
+		var rk []byte
+		if index.HsetField != "" {
+			_, k, field, err := hDecodeHashKey(it.Key())
+			if err != nil || string(field) != index.HsetField {
+				continue
+			}
+			rk = k
+		} else {
+			_, k, err := decodeJSONKey(it.Key())
+			if err != nil {
+				continue
+			}
+			jv := gjson.GetBytes(v, path)
+			if !jv.Exists() {
+				continue
+			}
+			rk = k
+			v = []byte(jv.String())
+		}
+		db.updateFullTextPostings(table, []byte(index.Name), packRedisKey(table, rk), nil, v, wb)
+		cnt++
+		if cnt%zsetIndexBuildBatch == 0 {
+			if err := db.eng.Write(wb); err != nil {
+				return err
+			}
+			wb.Clear()
+		}
+	}
+	dbLog.Infof("table %v full text index %v built for %v documents", string(table), index.Name, cnt)
+	return db.eng.Write(wb)
+}
+
+// AddFullTextIndex add the full text index to the table, the existing data will be indexed.
+func (db *RockDB) AddFullTextIndex(table string, index *common.FullTextIndexSchema) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	if err := index.CheckValid(); err != nil {
+		return err
+	}
+	for _, old := range db.getFullTextIndexes([]byte(table)) {
+		if old.Name == index.Name {
+			return ErrFullTextIndexExist
+		}
+	}
+	if err := db.buildFullTextIndex([]byte(table), index); err != nil {
+		return err
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	d, _ := json.Marshal(index)
+	wb.Put(encodeFullTextIndexMetaKey([]byte(table), []byte(index.Name)), d)
+	err := db.eng.Write(wb)
+	if err != nil {
+		return err
+	}
+	db.ftIndexMutex.Lock()
+	indexes := make([]common.FullTextIndexSchema, 0, len(db.ftIndexes[table])+1)
+	indexes = append(indexes, db.ftIndexes[table]...)
+	db.ftIndexes[table] = append(indexes, *index)
+	db.ftIndexMutex.Unlock()
+	dbLog.Infof("table %v full text index added: %v", table, index)
+	return nil
+}
+
+// DelFullTextIndex remove the full text index and all the postings of the index.
+func (db *RockDB) DelFullTextIndex(table string, name string) error {
+	found := false
+	for _, old := range db.getFullTextIndexes([]byte(table)) {
+		if old.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrIndexNotExist
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.DeleteRange(encodeFullTextIndexStartKey([]byte(table), []byte(name)),
+		encodeFullTextIndexStopKey([]byte(table), []byte(name)))
+	wb.Delete(encodeFullTextIndexMetaKey([]byte(table), []byte(name)))
+	err := db.eng.Write(wb)
+	if err != nil {
+		return err
+	}
+	db.ftIndexMutex.Lock()
+	indexes := make([]common.FullTextIndexSchema, 0, len(db.ftIndexes[table]))
+	for _, old := range db.ftIndexes[table] {
+		if old.Name != name {
+			indexes = append(indexes, old)
+		}
+	}
+	if len(indexes) == 0 {
+		delete(db.ftIndexes, table)
+	} else {
+		db.ftIndexes[table] = indexes
+	}
+	db.ftIndexMutex.Unlock()
+	dbLog.Infof("table %v full text index removed: %v", table, name)
+	return nil
+}
+
+func (db *RockDB) GetFullTextIndexes(table string) []common.FullTextIndexSchema {
+	return db.getFullTextIndexes([]byte(table))
+}
+
+func (db *RockDB) loadFullTextIndexes() error {
+	s := append([]byte{TableMetaType}, ftIndexPrefix...)
+	e := append([]byte{TableMetaType}, ftIndexPrefix...)
+	e[len(e)-1] = e[len(e)-1] + 1
+	it, err := NewDBRangeIterator(db.eng, s, e, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	tables := make(map[string][]common.FullTextIndexSchema)
+	for ; it.Valid(); it.Next() {
+		table, _, err := decodeFullTextIndexMetaKey(it.Key())
+		if err != nil {
+			continue
+		}
+		var index common.FullTextIndexSchema
+		err = json.Unmarshal(it.Value(), &index)
+		if err != nil {
+			dbLog.Infof("invalid full text index %v: %v", string(it.Key()), err)
+			continue
+		}
+		tables[string(table)] = append(tables[string(table)], index)
+	}
+	db.ftIndexMutex.Lock()
+	db.ftIndexes = tables
+	db.ftIndexMutex.Unlock()
+	return nil
+}
+
+type ftQueryTerm struct {
+	term   string
+	prefix bool
+}
+
+// the query is the terms separated by the space, and the term ending with * is a prefix query.
+func parseFullTextQuery(query string) ([]ftQueryTerm, error) {
+	terms := make([]ftQueryTerm, 0)
+	for _, word := range strings.Fields(query) {
+		if strings.HasSuffix(word, "*") {
+			prefix := strings.ToLower(strings.TrimSuffix(word, "*"))
+			if prefix == "" || len(tokenizeFullText([]byte(prefix))) != 1 {
+				return nil, ErrFullTextQueryInvalid
+			}
+			terms = append(terms, ftQueryTerm{term: prefix, prefix: true})
+			continue
+		}
+		for t := range tokenizeFullText([]byte(word)) {
+			terms = append(terms, ftQueryTerm{term: t})
+		}
+	}
+	if len(terms) == 0 {
+		return nil, ErrFullTextQueryInvalid
+	}
+	return terms, nil
+}
+
+// return the documents matched with the term frequency
+func (db *RockDB) searchFullTextTerm(table []byte, name []byte, qt ftQueryTerm) (map[string]int64, error) {
+	start := encodeFullTextIndexStartKey(table, name)
+	start = append(start, qt.term...)
+	stop := make([]byte, len(start))
+	copy(stop, start)
+	if qt.prefix {
+		// the term is valid utf8 so 0xff will never be in the term
+		stop = append(stop, 0xff)
+	} else {
+		start = append(start, ftTermSep)
+		stop = append(stop, ftTermSep+1)
+	}
+	it, err := NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(false), start, stop,
+		common.RangeROpen, 0, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	docs := make(map[string]int64)
+	for ; it.Valid(); it.Next() {
+		_, pk, err := decodeFullTextIndexKey(table, name, it.Key())
+		if err != nil {
+			continue
+		}
+		tf, err := Int64(it.Value(), nil)
+		if err != nil {
+			continue
+		}
+		if _, ok := docs[string(pk)]; !ok && len(docs) >= MaxFullTextTermMatches {
+			return nil, ErrFullTextTooManyMatches
+		}
+		docs[string(pk)] += tf
+	}
+	return docs, nil
+}
+
+// FullTextIndexSearch return the keys matched all the terms in the query, the results are
+// ranked by the tf-idf score of the terms, the idf is approximated by the matched documents.
+func (db *RockDB) FullTextIndexSearch(table []byte, name string, query string,
+	offset int, count int) ([]FTSearchResp, error) {
+	found := false
+	for _, index := range db.getFullTextIndexes(table) {
+		if index.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrIndexNotExist
+	}
+	terms, err := parseFullTextQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	termDocs := make([]map[string]int64, 0, len(terms))
+	allDocs := make(map[string]struct{})
+	for _, qt := range terms {
+		docs, err := db.searchFullTextTerm(table, []byte(name), qt)
+		if err != nil {
+			return nil, err
+		}
+		for pk := range docs {
+			allDocs[pk] = struct{}{}
+		}
+		termDocs = append(termDocs, docs)
+	}
+	total := float64(len(allDocs))
+	scores := make(map[string]float64)
+	for pk := range termDocs[0] {
+		scores[pk] = 0
+	}
+	for _, docs := range termDocs {
+		idf := math.Log(1 + total/float64(len(docs)+1))
+		for pk, score := range scores {
+			tf, ok := docs[pk]
+			if !ok {
+				delete(scores, pk)
+				continue
+			}
+			scores[pk] = score + float64(tf)*idf
+		}
+	}
+	rets := make([]FTSearchResp, 0, len(scores))
+	for pk, score := range scores {
+		rets = append(rets, FTSearchResp{PKey: []byte(pk), Score: score})
+	}
+	sort.Slice(rets, func(i, j int) bool {
+		if rets[i].Score == rets[j].Score {
+			return bytes.Compare(rets[i].PKey, rets[j].PKey) < 0
+		}
+		return rets[i].Score > rets[j].Score
+	})
+	if offset >= len(rets) {
+		return nil, nil
+	}
+	rets = rets[offset:]
+	if count >= 0 && count < len(rets) {
+		rets = rets[:count]
+	}
+	return rets, nil
+}
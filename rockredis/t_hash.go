@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 var (
@@ -97,7 +97,7 @@ func hDecodeHashKey(ek []byte) ([]byte, []byte, []byte, error) {
 	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
 	pos += 2
 
-	if keyLen+pos > len(ek) {
+	if keyLen+pos >= len(ek) {
 		return nil, nil, nil, errHashKey
 	}
 
@@ -125,7 +125,7 @@ func hEncodeStopKey(table []byte, key []byte) []byte {
 
 // return if we create the new field or override it
 func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, value []byte,
-	wb *gorocksdb.WriteBatch, hindex *HsetIndex) (int64, error) {
+	wb engine.WriteBatch, hindex *HsetIndex) (int64, error) {
 	table, rk, err := extractTableFromRedisKey(hkey)
 
 	if err != nil {
@@ -140,7 +140,7 @@ func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, v
 	tsBuf := PutInt64(ts)
 	value = append(value, tsBuf...)
 	var oldV []byte
-	if oldV, _ = db.eng.GetBytesNoLock(db.defaultReadOpts, ek); oldV != nil {
+	if oldV, _ = db.eng.GetBytesNoLock(ek); oldV != nil {
 		created = 0
 		if checkNX || bytes.Equal(oldV, value) {
 			return created, nil
@@ -150,19 +150,24 @@ func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, v
 			return 0, err
 		} else if n == 1 {
 			db.IncrTableKeyCount(table, 1, wb)
+			db.clearStaleExpire(HashType, hkey, wb)
 		}
 	}
 	wb.Put(ek, value)
 
+	if len(oldV) >= tsLen {
+		oldV = oldV[:len(oldV)-tsLen]
+	}
 	if hindex != nil {
-		if len(oldV) >= tsLen {
-			oldV = oldV[:len(oldV)-tsLen]
-		}
-		err = hindex.UpdateRec(oldV, value[:len(value)-tsLen], hkey, wb)
+		err = hindex.UpdateRec(db, oldV, value[:len(value)-tsLen], hkey, wb)
 		if err != nil {
 			return created, err
 		}
 	}
+	err = db.hsetFullTextIndexUpdate(hkey, field, oldV, value[:len(value)-tsLen], wb)
+	if err != nil {
+		return created, err
+	}
 
 	return created, nil
 }
@@ -172,16 +177,16 @@ func (db *RockDB) HLen(hkey []byte) (int64, error) {
 		return 0, err
 	}
 	sizeKey := hEncodeSizeKey(hkey)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sizeKey)
+	v, err := db.eng.GetBytes(sizeKey)
 	return Int64(v, err)
 }
 
-func (db *RockDB) hIncrSize(hkey []byte, delta int64, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) hIncrSize(hkey []byte, delta int64, wb engine.WriteBatch) (int64, error) {
 	sk := hEncodeSizeKey(hkey)
 
 	var err error
 	var size int64
-	if size, err = Int64(db.eng.GetBytesNoLock(db.defaultReadOpts, sk)); err != nil {
+	if size, err = Int64(db.eng.GetBytesNoLock(sk)); err != nil {
 		return 0, err
 	} else {
 		size += delta
@@ -219,9 +224,15 @@ func (db *RockDB) HSet(ts int64, checkNX bool, key []byte, field []byte, value [
 	if err != nil {
 		return 0, err
 	}
+	if !checkNX || created == 1 {
+		err = db.hsetCompositeIndexUpdate(tableIndexes, key, [][]byte{field}, [][]byte{value}, db.wb)
+		if err != nil {
+			return 0, err
+		}
+	}
 	c1 := time.Since(s)
 
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	c2 := time.Since(s)
 	if c2 > time.Second/3 {
 		dbLog.Infof("key %v slow write cost: %v, %v", string(key), c1, c2)
@@ -261,7 +272,7 @@ func (db *RockDB) HMset(ts int64, key []byte, args ...common.KVRecord) error {
 		ek := hEncodeHashKey(table, rk, args[i].Key)
 
 		var oldV []byte
-		if oldV, err = db.eng.GetBytesNoLock(db.defaultReadOpts, ek); err != nil {
+		if oldV, err = db.eng.GetBytesNoLock(ek); err != nil {
 			return err
 		} else if oldV == nil {
 			num++
@@ -271,27 +282,44 @@ func (db *RockDB) HMset(ts int64, key []byte, args ...common.KVRecord) error {
 		value = append(value, tsBuf...)
 		db.wb.Put(ek, value)
 
+		if len(oldV) >= tsLen {
+			oldV = oldV[:len(oldV)-tsLen]
+		}
 		if tableIndexes != nil {
 			if hindex := tableIndexes.GetHIndexNoLock(string(args[i].Key)); hindex != nil {
-				if len(oldV) >= tsLen {
-					oldV = oldV[:len(oldV)-tsLen]
-				}
-				err = hindex.UpdateRec(oldV, value[:len(value)-tsLen], key, db.wb)
+				err = hindex.UpdateRec(db, oldV, value[:len(value)-tsLen], key, db.wb)
 				if err != nil {
 					return err
 				}
 			}
 		}
+		err = db.hsetFullTextIndexUpdate(key, args[i].Key, oldV, value[:len(value)-tsLen], db.wb)
+		if err != nil {
+			return err
+		}
+	}
+	if tableIndexes != nil {
+		fields := make([][]byte, 0, len(args))
+		values := make([][]byte, 0, len(args))
+		for _, arg := range args {
+			fields = append(fields, arg.Key)
+			values = append(values, arg.Value)
+		}
+		err = db.hsetCompositeIndexUpdate(tableIndexes, key, fields, values, db.wb)
+		if err != nil {
+			return err
+		}
 	}
 	c2 := time.Since(s)
 	if newNum, err := db.hIncrSize(key, num, db.wb); err != nil {
 		return err
 	} else if newNum > 0 && newNum == num {
 		db.IncrTableKeyCount(table, 1, db.wb)
+		db.clearStaleExpire(HashType, key, db.wb)
 	}
 	c3 := time.Since(s)
 
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	c4 := time.Since(s)
 	if c4 > time.Second/3 {
 		dbLog.Infof("key %v slow write cost: %v, %v, %v, %v", string(key), c1, c2, c3, c4)
@@ -309,7 +337,7 @@ func (db *RockDB) HGetVer(key []byte, field []byte) (int64, error) {
 		return 0, err
 	}
 	var ts uint64
-	v, err := db.eng.GetBytes(db.defaultReadOpts, dbKey)
+	v, err := db.eng.GetBytes(dbKey)
 	if len(v) >= tsLen {
 		ts, err = Uint64(v[len(v)-tsLen:], err)
 	}
@@ -325,7 +353,7 @@ func (db *RockDB) HGet(key []byte, field []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	v, err := db.eng.GetBytes(db.defaultReadOpts, dbKey)
+	v, err := db.eng.GetBytes(dbKey)
 	if len(v) >= tsLen {
 		v = v[:len(v)-tsLen]
 	}
@@ -337,7 +365,7 @@ func (db *RockDB) HKeyExists(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := hEncodeSizeKey(key)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sk)
+	v, err := db.eng.GetBytes(sk)
 	if v != nil && err == nil {
 		return 1, nil
 	}
@@ -348,15 +376,61 @@ func (db *RockDB) HMget(key []byte, args ...[]byte) ([][]byte, error) {
 	if len(args) >= MAX_BATCH_NUM {
 		return nil, errTooMuchBatchSize
 	}
-	var err error
-	r := make([][]byte, len(args))
-	for i := 0; i < len(args); i++ {
-		r[i], err = db.HGet(key, args[i])
-		if err != nil {
-			return nil, err
+	vals, errs := db.HMgetKeys([][]byte{key}, args...)
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	return vals[0], nil
+}
+
+// HMgetKeys get the fields of all the keys by one multi get, the error of each key will
+// be returned in the errors.
+func (db *RockDB) HMgetKeys(keys [][]byte, fields ...[]byte) ([][][]byte, []error) {
+	rets := make([][][]byte, len(keys))
+	keyErrs := make([]error, len(keys))
+	dbKeys := make([][]byte, 0, len(keys)*len(fields))
+	for i, key := range keys {
+		for _, field := range fields {
+			if err := checkHashKFSize(key, field); err != nil {
+				keyErrs[i] = err
+				break
+			}
+			dbKey, err := convertRedisKeyToDBHKey(key, field)
+			if err != nil {
+				keyErrs[i] = err
+				break
+			}
+			dbKeys = append(dbKeys, dbKey)
+		}
+		if keyErrs[i] != nil {
+			// keep the position for the fields of the key
+			dbKeys = dbKeys[:i*len(fields)]
+			for range fields {
+				dbKeys = append(dbKeys, nil)
+			}
+		}
+	}
+	errs := make([]error, len(dbKeys))
+	db.eng.MultiGetBytes(dbKeys, dbKeys, errs)
+	for i := range keys {
+		if keyErrs[i] != nil {
+			continue
+		}
+		vals := dbKeys[i*len(fields) : (i+1)*len(fields)]
+		for j, v := range vals {
+			if errs[i*len(fields)+j] != nil {
+				keyErrs[i] = errs[i*len(fields)+j]
+				break
+			}
+			if len(v) >= tsLen {
+				vals[j] = v[:len(v)-tsLen]
+			}
+		}
+		if keyErrs[i] == nil {
+			rets[i] = vals
 		}
 	}
-	return r, nil
+	return rets, keyErrs
 }
 
 func (db *RockDB) HDel(key []byte, args ...[]byte) (int64, error) {
@@ -390,21 +464,32 @@ func (db *RockDB) HDel(key []byte, args ...[]byte) (int64, error) {
 		}
 
 		ek = hEncodeHashKey(table, rk, args[i])
-		oldV, err = db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+		oldV, err = db.eng.GetBytesNoLock(ek)
 		if oldV == nil {
 			continue
 		} else {
 			num++
 			wb.Delete(ek)
 
+			if len(oldV) >= tsLen {
+				oldV = oldV[:len(oldV)-tsLen]
+			}
 			if tableIndexes != nil {
 				if hindex := tableIndexes.GetHIndexNoLock(string(args[i])); hindex != nil {
-					if len(oldV) >= tsLen {
-						oldV = oldV[:len(oldV)-tsLen]
-					}
-					hindex.RemoveRec(oldV, key, wb)
+					hindex.RemoveRec(db, oldV, key, wb)
 				}
 			}
+			err = db.hsetFullTextIndexUpdate(key, args[i], oldV, nil, wb)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if tableIndexes != nil && num > 0 {
+		err = db.hsetCompositeIndexUpdate(tableIndexes, key, args, make([][]byte, len(args)), wb)
+		if err != nil {
+			return 0, err
 		}
 	}
 
@@ -415,11 +500,11 @@ func (db *RockDB) HDel(key []byte, args ...[]byte) (int64, error) {
 		db.delExpire(HashType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return num, err
 }
 
-func (db *RockDB) hDeleteAll(hkey []byte, wb *gorocksdb.WriteBatch, tableIndexes *TableIndexContainer) error {
+func (db *RockDB) hDeleteAll(hkey []byte, wb engine.WriteBatch, tableIndexes *TableIndexContainer) error {
 	sk := hEncodeSizeKey(hkey)
 	table, rk, err := extractTableFromRedisKey(hkey)
 	if err != nil {
@@ -431,6 +516,10 @@ func (db *RockDB) hDeleteAll(hkey []byte, wb *gorocksdb.WriteBatch, tableIndexes
 	if err != nil {
 		return err
 	}
+	err = db.hsetFullTextIndexRemoveAll(hkey, wb)
+	if err != nil {
+		return err
+	}
 
 	if tableIndexes != nil || hlen <= RangeDeleteNum {
 		it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
@@ -451,13 +540,19 @@ func (db *RockDB) hDeleteAll(hkey []byte, wb *gorocksdb.WriteBatch, tableIndexes
 					if len(oldV) >= tsLen {
 						oldV = oldV[:len(oldV)-tsLen]
 					}
-					hindex.RemoveRec(oldV, hkey, wb)
+					hindex.RemoveRec(db, oldV, hkey, wb)
 				}
 			}
 		}
 	}
+	if tableIndexes != nil {
+		err = db.hsetCompositeIndexUpdate(tableIndexes, hkey, nil, nil, wb)
+		if err != nil {
+			return err
+		}
+	}
 	if hlen > RangeDeleteNum {
-		wb.DeleteRange(start, stop)
+		db.deleteRange(wb, start, stop)
 	}
 	wb.Delete(sk)
 	return nil
@@ -494,11 +589,11 @@ func (db *RockDB) HClear(hkey []byte) (int64, error) {
 		db.delExpire(HashType, hkey, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return hlen, err
 }
 
-func (db *RockDB) hClearWithBatch(hkey []byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) hClearWithBatch(hkey []byte, wb engine.WriteBatch) error {
 	if err := checkKeySize(hkey); err != nil {
 		return err
 	}
@@ -562,7 +657,7 @@ func (db *RockDB) HIncrBy(ts int64, key []byte, field []byte, delta int64) (int6
 	wb.Clear()
 
 	var n int64
-	oldV, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+	oldV, err := db.eng.GetBytesNoLock(ek)
 	if len(oldV) >= tsLen {
 		oldV = oldV[:len(oldV)-tsLen]
 	}
@@ -572,15 +667,58 @@ func (db *RockDB) HIncrBy(ts int64, key []byte, field []byte, delta int64) (int6
 
 	n += delta
 
-	_, err = db.hSetField(ts, false, key, field, FormatInt64ToSlice(n), wb, hindex)
+	nv := FormatInt64ToSlice(n)
+	_, err = db.hSetField(ts, false, key, field, nv, wb, hindex)
+	if err != nil {
+		return 0, err
+	}
+	err = db.hsetCompositeIndexUpdate(tableIndexes, key, [][]byte{field}, [][]byte{nv}, wb)
 	if err != nil {
 		return 0, err
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return n, err
 }
 
+// read the hash fields from the snapshot, so the length and the fields will be consistent
+// even if the hash is changed while reading.
+func (db *RockDB) hGetAllFromSnapshot(table []byte, rk []byte, withField bool, withValue bool) ([]common.KVRecordRet, error) {
+	start := hEncodeStartKey(table, rk)
+	stop := hEncodeStopKey(table, rk)
+	it, err := NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(true), start, stop, common.RangeROpen, 0, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	it.NoTimestamp(HashType)
+
+	recs := make([]common.KVRecordRet, 0, 16)
+	for ; it.Valid(); it.Next() {
+		if len(recs) >= MAX_BATCH_NUM {
+			return nil, errTooMuchBatchSize
+		}
+		var rec common.KVRecordRet
+		if withField {
+			_, _, rec.Rec.Key, rec.Err = hDecodeHashKey(it.Key())
+		}
+		if withValue {
+			rec.Rec.Value = it.Value()
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func recordsToChan(recs []common.KVRecordRet) chan common.KVRecordRet {
+	valCh := make(chan common.KVRecordRet, len(recs))
+	for _, rec := range recs {
+		valCh <- rec
+	}
+	close(valCh)
+	return valCh
+}
+
 func (db *RockDB) HGetAll(key []byte) (int64, chan common.KVRecordRet, error) {
 	if err := checkKeySize(key); err != nil {
 		return 0, nil, err
@@ -599,38 +737,11 @@ func (db *RockDB) HGetAll(key []byte) (int64, chan common.KVRecordRet, error) {
 		return length, nil, errTooMuchBatchSize
 	}
 
-	start := hEncodeStartKey(table, rk)
-	stop := hEncodeStopKey(table, rk)
-	it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
+	recs, err := db.hGetAllFromSnapshot(table, rk, true, true)
 	if err != nil {
 		return 0, nil, err
 	}
-	it.NoTimestamp(HashType)
-
-	valCh := make(chan common.KVRecordRet, 16)
-	doScan := func() {
-		defer it.Close()
-		defer close(valCh)
-		for ; it.Valid(); it.Next() {
-			_, _, f, err := hDecodeHashKey(it.Key())
-			v := it.Value()
-			select {
-			case valCh <- common.KVRecordRet{
-				Rec: common.KVRecord{Key: f, Value: v},
-				Err: err,
-			}:
-			case <-db.quit:
-				break
-			}
-		}
-	}
-	if length < int64(len(valCh)) {
-		doScan()
-	} else {
-		go doScan()
-	}
-
-	return length, valCh, nil
+	return int64(len(recs)), recordsToChan(recs), nil
 }
 
 func (db *RockDB) HKeys(key []byte) (int64, chan common.KVRecordRet, error) {
@@ -646,31 +757,11 @@ func (db *RockDB) HKeys(key []byte) (int64, chan common.KVRecordRet, error) {
 	if length >= MAX_BATCH_NUM {
 		return length, nil, errTooMuchBatchSize
 	}
-	start := hEncodeStartKey(table, rk)
-	stop := hEncodeStopKey(table, rk)
-	it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
+	recs, err := db.hGetAllFromSnapshot(table, rk, true, false)
 	if err != nil {
 		return 0, nil, err
 	}
-
-	valCh := make(chan common.KVRecordRet, 16)
-	doScan := func() {
-		defer it.Close()
-		defer close(valCh)
-		for ; it.Valid(); it.Next() {
-			_, _, f, err := hDecodeHashKey(it.Key())
-			valCh <- common.KVRecordRet{
-				Rec: common.KVRecord{Key: f, Value: nil},
-				Err: err,
-			}
-		}
-	}
-	if length < int64(len(valCh)) {
-		doScan()
-	} else {
-		go doScan()
-	}
-	return length, valCh, nil
+	return int64(len(recs)), recordsToChan(recs), nil
 }
 
 func (db *RockDB) HValues(key []byte) (int64, chan common.KVRecordRet, error) {
@@ -691,27 +782,11 @@ func (db *RockDB) HValues(key []byte) (int64, chan common.KVRecordRet, error) {
 		return length, nil, errTooMuchBatchSize
 	}
 
-	start := hEncodeStartKey(table, rk)
-	stop := hEncodeStopKey(table, rk)
-	it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
+	recs, err := db.hGetAllFromSnapshot(table, rk, false, true)
 	if err != nil {
 		return 0, nil, err
 	}
-	it.NoTimestamp(HashType)
-	valCh := make(chan common.KVRecordRet, 16)
-	go func() {
-		defer it.Close()
-		defer close(valCh)
-		for ; it.Valid(); it.Next() {
-			va := it.Value()
-			valCh <- common.KVRecordRet{
-				Rec: common.KVRecord{Key: nil, Value: va},
-				Err: nil,
-			}
-		}
-	}()
-
-	return length, valCh, nil
+	return int64(len(recs)), recordsToChan(recs), nil
 }
 
 func (db *RockDB) HExpire(key []byte, duration int64) (int64, error) {
@@ -739,7 +814,7 @@ func (db *RockDB) HPersist(key []byte) (int64, error) {
 	if err := db.delExpire(HashType, key, db.wb); err != nil {
 		return 0, err
 	} else {
-		if err2 := db.eng.Write(db.defaultWriteOpts, db.wb); err2 != nil {
+		if err2 := db.eng.Write(db.wb); err2 != nil {
 			return 0, err2
 		} else {
 			return 1, nil
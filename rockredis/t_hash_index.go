@@ -1,16 +1,20 @@
 package rockredis
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
 	"strconv"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 const (
 	hindexStartSep byte = ':'
+	// the separator of the fields in the composite index key of the index container
+	compositeFieldSep = ","
 )
 
 var (
@@ -20,6 +24,8 @@ var (
 	ErrIndexDeleted        = errors.New("index is deleted")
 	ErrIndexValueNotNumber = errors.New("invalid value for number")
 	ErrIndexValueType      = errors.New("invalid index value type")
+	ErrIndexUniqueConflict = errors.New("the value of the unique index already exists")
+	ErrIndexInvalidToken   = errors.New("invalid index continue token")
 	errHsetIndexKey        = errors.New("invalid hset index key")
 	emptyValue             = []byte("")
 )
@@ -85,6 +91,31 @@ func encodeHsetIndexStringKey(table []byte, indexName []byte,
 	return tmpkey, err
 }
 
+func encodeHsetIndexFloatKey(table []byte, indexName []byte,
+	indexValue float64, pk []byte, stopKey bool) ([]byte, error) {
+	sep := int32(hindexStartSep)
+	if stopKey {
+		sep = int32(hindexStartSep + 1)
+	}
+	return EncodeMemCmpKey(encodeHsetIndexStartKey(table, indexName), indexValue, sep, pk)
+}
+
+// parse the float index value, NaN is not allowed since it can not be ordered
+// and the negative zero is the same as zero.
+func parseIndexFloat(value []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) {
+		return 0, ErrIndexValueNotNumber
+	}
+	if f == 0 {
+		f = 0
+	}
+	return f, nil
+}
+
 func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, error) {
 	pos := 0
 	if len(rawKey) < pos+2+2+1+2+1 {
@@ -121,6 +152,9 @@ func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, err
 	if err != nil {
 		return table, indexName, 0, nil, err
 	}
+	if len(rets) != 3 {
+		return table, indexName, 0, nil, errHsetIndexKey
+	}
 	iv, ok := rets[0].(int64)
 	if !ok {
 		return table, indexName, 0, nil, ErrIndexValueType
@@ -174,6 +208,9 @@ func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, er
 	if err != nil {
 		return table, indexName, nil, nil, err
 	}
+	if len(rets) != 3 {
+		return table, indexName, nil, nil, errHsetIndexKey
+	}
 	indexValue, ok := rets[0].([]byte)
 	if !ok {
 		return table, indexName, nil, nil, ErrIndexValueType
@@ -189,6 +226,47 @@ func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, er
 	return table, indexName, indexValue, pk, nil
 }
 
+func decodeHsetIndexFloatKey(rawKey []byte) ([]byte, []byte, float64, []byte, error) {
+	pos := 0
+	if len(rawKey) < pos+2+2+1+2+1 {
+		return nil, nil, 0, nil, errHsetIndexKey
+	}
+	if rawKey[0] != IndexDataType || rawKey[1] != hsetIndexDataType {
+		return nil, nil, 0, nil, errHsetIndexKey
+	}
+	pos += 2
+	tableLen := int(binary.BigEndian.Uint16(rawKey[pos:]))
+	pos += 2
+	if len(rawKey) < tableLen+pos+1+2 {
+		return nil, nil, 0, nil, errHsetIndexKey
+	}
+	table := rawKey[pos : pos+tableLen]
+	pos += tableLen + 1
+	indexNameLen := int(binary.BigEndian.Uint16(rawKey[pos:]))
+	pos += 2
+	if len(rawKey) < indexNameLen+pos+1+2 {
+		return nil, nil, 0, nil, errHsetIndexKey
+	}
+	indexName := rawKey[pos : pos+indexNameLen]
+	pos += indexNameLen + 1
+	rets, err := Decode(rawKey[pos:], 3)
+	if err != nil {
+		return table, indexName, 0, nil, err
+	}
+	if len(rets) != 3 {
+		return table, indexName, 0, nil, errHsetIndexKey
+	}
+	fv, ok := rets[0].(float64)
+	if !ok {
+		return table, indexName, 0, nil, ErrIndexValueType
+	}
+	pk, ok := rets[2].([]byte)
+	if !ok && rets[2] != nil {
+		return table, indexName, 0, nil, ErrIndexValueType
+	}
+	return table, indexName, fv, pk, nil
+}
+
 func encodeHsetIndexStartKey(table []byte, indexName []byte) []byte {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
@@ -217,6 +295,29 @@ func encodeHsetIndexStopKey(table []byte, indexName []byte) []byte {
 	return k
 }
 
+// the range of all the hset index data in the table
+func encodeHsetIndexTableStartKey(table []byte) []byte {
+	tmpkey := make([]byte, 2+2+len(table)+1)
+	pos := 0
+	tmpkey[pos] = IndexDataType
+	pos++
+	tmpkey[pos] = hsetIndexDataType
+	pos++
+
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
+	pos += 2
+	copy(tmpkey[pos:], table)
+	pos += len(table)
+	tmpkey[pos] = hindexStartSep
+	return tmpkey
+}
+
+func encodeHsetIndexTableStopKey(table []byte) []byte {
+	k := encodeHsetIndexTableStartKey(table)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
 func encodeHsetIndexNumberStartKey(table []byte, indexName []byte, indexValue int64) ([]byte, error) {
 	return encodeHsetIndexNumberKey(table, indexName, indexValue, nil, false)
 }
@@ -241,43 +342,7 @@ func encodeHsetIndexStringStopKey(table []byte, indexName []byte, indexValue []b
 	return k, nil
 }
 
-func hsetIndexAddNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, pkvalue []byte, wb *gorocksdb.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
-	if err != nil {
-		return err
-	}
-	wb.Put(dbkey, pkvalue)
-	return nil
-}
-
-func hsetIndexRemoveNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, wb *gorocksdb.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
-	if err != nil {
-		return err
-	}
-	wb.Delete(dbkey)
-	return nil
-}
-
-func hsetIndexAddStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, pkvalue []byte, wb *gorocksdb.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
-	if err != nil {
-		return err
-	}
-	wb.Put(dbkey, pkvalue)
-	return nil
-}
-
-func hsetIndexRemoveStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, wb *gorocksdb.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
-	if err != nil {
-		return err
-	}
-	wb.Delete(dbkey)
-	return nil
-}
-
-func (db *RockDB) hsetIndexAddFieldRecs(pk []byte, fieldList [][]byte, valueList [][]byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) hsetIndexAddFieldRecs(pk []byte, fieldList [][]byte, valueList [][]byte, wb engine.WriteBatch) error {
 	table, _, _ := extractTableFromRedisKey(pk)
 	if len(table) == 0 {
 		return errTableName
@@ -291,7 +356,7 @@ func (db *RockDB) hsetIndexAddFieldRecs(pk []byte, fieldList [][]byte, valueList
 			continue
 		}
 
-		err = hindex.UpdateRec(nil, valueList[i], pk, wb)
+		err = hindex.UpdateRec(db, nil, valueList[i], pk, wb)
 		if err != nil {
 			return err
 		}
@@ -299,7 +364,7 @@ func (db *RockDB) hsetIndexAddFieldRecs(pk []byte, fieldList [][]byte, valueList
 	return nil
 }
 
-func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueList [][]byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueList [][]byte, wb engine.WriteBatch) error {
 	table, _, _ := extractTableFromRedisKey(pk)
 	if len(table) == 0 {
 		return errTableName
@@ -317,7 +382,7 @@ func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueL
 		if err != nil {
 			continue
 		}
-		err = hindex.UpdateRec(oldvalues[i], valueList[i], pk, wb)
+		err = hindex.UpdateRec(db, oldvalues[i], valueList[i], pk, wb)
 		if err != nil {
 			return err
 		}
@@ -325,7 +390,7 @@ func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueL
 	return nil
 }
 
-func (db *RockDB) hsetIndexAddRec(pk []byte, field []byte, value []byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) hsetIndexAddRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
 	table, _, _ := extractTableFromRedisKey(pk)
 	if len(table) == 0 {
 		return errTableName
@@ -336,10 +401,10 @@ func (db *RockDB) hsetIndexAddRec(pk []byte, field []byte, value []byte, wb *gor
 		return err
 	}
 
-	return hindex.UpdateRec(nil, value, pk, wb)
+	return hindex.UpdateRec(db, nil, value, pk, wb)
 }
 
-func (db *RockDB) hsetIndexUpdateRec(pk []byte, field []byte, value []byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) hsetIndexUpdateRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
 	table, _, _ := extractTableFromRedisKey(pk)
 	if len(table) == 0 {
 		return errTableName
@@ -355,10 +420,10 @@ func (db *RockDB) hsetIndexUpdateRec(pk []byte, field []byte, value []byte, wb *
 		return err
 	}
 
-	return hindex.UpdateRec(oldvalue, value, pk, wb)
+	return hindex.UpdateRec(db, oldvalue, value, pk, wb)
 }
 
-func (self *RockDB) hsetIndexRemoveRec(pk []byte, field []byte, value []byte, wb *gorocksdb.WriteBatch) error {
+func (self *RockDB) hsetIndexRemoveRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
 	table, _, _ := extractTableFromRedisKey(pk)
 	if len(table) == 0 {
 		return errTableName
@@ -368,27 +433,153 @@ func (self *RockDB) hsetIndexRemoveRec(pk []byte, field []byte, value []byte, wb
 	if err != nil {
 		return err
 	}
-	hindex.RemoveRec(value, pk, wb)
+	hindex.RemoveRec(self, value, pk, wb)
 	return nil
 }
 
-// search return the hash keys for matching field value
+// read the current values of the fields in the hash, the values in the write batch are not visible.
+func (db *RockDB) hGetFieldsNoLock(pk []byte, fields [][]byte) ([][]byte, error) {
+	table, rk, err := extractTableFromRedisKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(fields))
+	for i, field := range fields {
+		v, err := db.eng.GetBytesNoLock(hEncodeHashKey(table, rk, field))
+		if err != nil {
+			return nil, err
+		}
+		if len(v) >= tsLen {
+			v = v[:len(v)-tsLen]
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// update the composite indexes which contain any of the changed fields, the nil value
+// means the field is deleted. If fields is nil, all the fields of the hash are deleted.
+func (db *RockDB) hsetCompositeIndexUpdate(tableIndexes *TableIndexContainer, pk []byte,
+	fields [][]byte, values [][]byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, hindex := range tableIndexes.getCompositeIndexesNoLock(fields) {
+		indexFields := hindex.indexFields()
+		oldValues, err := db.hGetFieldsNoLock(pk, indexFields)
+		if err != nil {
+			return err
+		}
+		newValues := make([][]byte, len(indexFields))
+		if fields != nil {
+			copy(newValues, oldValues)
+			for i, f := range indexFields {
+				for j, changed := range fields {
+					if bytes.Equal(f, changed) {
+						newValues[i] = values[j]
+					}
+				}
+			}
+		}
+		err = hindex.UpdateCompositeRec(oldValues, newValues, pk, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// search return the hash keys for matching field value, the field can be
+// the leading fields of the composite index separated by comma.
 func (db *RockDB) HsetIndexSearch(table []byte, field []byte, cond *IndexCondition, countOnly bool) (IndexPropertyDType, int64, []HIndexResp, error) {
-	hindex, err := db.getIndexer().GetHsetIndex(string(table), string(field))
+	vt, n, ret, _, err := db.hsetIndexSearch(table, field, cond, countOnly)
+	return vt, n, ret, err
+}
+
+// HsetIndexSearchPage search the hash keys for one page limited by the condition, the returned
+// token should be set to the condition to get the next page, and nil token means no more keys.
+// The token is opaque to the caller and only valid for the same index.
+func (db *RockDB) HsetIndexSearchPage(table []byte, field []byte, cond *IndexCondition) (IndexPropertyDType, []HIndexResp, []byte, error) {
+	vt, _, ret, token, err := db.hsetIndexSearch(table, field, cond, false)
+	return vt, ret, token, err
+}
+
+func (db *RockDB) hsetIndexSearch(table []byte, field []byte, cond *IndexCondition, countOnly bool) (IndexPropertyDType, int64, []HIndexResp, []byte, error) {
+	hindex, err := db.getIndexer().findHsetIndex(string(table), string(field))
 	if err != nil {
-		return 0, 0, nil, err
+		return 0, 0, nil, nil, err
 	}
 	if hindex.State == DeletedIndex {
-		return hindex.ValueType, 0, nil, ErrIndexDeleted
+		return hindex.ValueType, 0, nil, nil, ErrIndexDeleted
 	}
 
 	n, ret, err := hindex.SearchRec(db, cond, countOnly)
-	return hindex.ValueType, n, ret, err
+	if err != nil {
+		return hindex.ValueType, n, ret, nil, err
+	}
+	var token []byte
+	// the full page means there may be more keys after the last one
+	if cond.Limit > 0 && len(ret) == cond.Limit {
+		token = ret[len(ret)-1].indexKey
+	}
+	if !countOnly && len(cond.Fields) > 0 {
+		ret = db.hsetIndexFillFields(hindex, cond.Fields, ret)
+	}
+	return hindex.ValueType, n, ret, token, nil
+}
+
+// fill the field values for the matched keys, the keys failed to read will be ignored.
+// If all the fields are covered by the index, the values will be returned from the
+// index directly, otherwise all the values will be read in one batch.
+func (db *RockDB) hsetIndexFillFields(hindex *HsetIndex, fields [][]byte, pkList []HIndexResp) []HIndexResp {
+	if len(pkList) == 0 {
+		return pkList
+	}
+	covered := true
+	positions := make([]int, len(fields))
+	for i, f := range fields {
+		positions[i] = hindex.coveredFieldPos(f)
+		if positions[i] < 0 {
+			covered = false
+			break
+		}
+	}
+	if covered {
+		for i := range pkList {
+			vals := make([][]byte, len(fields))
+			for j, pos := range positions {
+				if hindex.isComposite() {
+					vals[j], _ = pkList[i].CompositeValues[pos].([]byte)
+				} else {
+					vals[j] = pkList[i].IndexValue
+				}
+			}
+			pkList[i].FieldValues = vals
+		}
+		return pkList
+	}
+	pks := make([][]byte, 0, len(pkList))
+	for _, pk := range pkList {
+		pks = append(pks, pk.PKey)
+	}
+	valsList, errs := db.HMgetKeys(pks, fields...)
+	rets := pkList[:0]
+	for i := range pkList {
+		if errs[i] != nil {
+			continue
+		}
+		pkList[i].FieldValues = valsList[i]
+		rets = append(rets, pkList[i])
+	}
+	return rets
 }
 
 // TODO: handle IN, LIKE, NOT equal condition in future
 // handle index condition combine (AND, OR)
 type IndexCondition struct {
+	// the equal values of the leading fields for the composite index, and the
+	// range will be applied to the next field
+	PrefixValues [][]byte
 	StartKey     []byte
 	IncludeStart bool
 	EndKey       []byte
@@ -396,12 +587,26 @@ type IndexCondition struct {
 	Offset       int
 	PKOffset     []byte
 	Limit        int
+	// the hash fields returned with the matched keys
+	Fields [][]byte
+	// the token returned by the previous page, the search will continue after
+	// the last key of the previous page and the offset will be ignored
+	ContinueToken []byte
+	// return the keys in the descending order of the index value
+	Reverse bool
 }
 
 type HIndexResp struct {
-	PKey          []byte
-	IndexValue    []byte
-	IndexIntValue int64
+	PKey            []byte
+	IndexValue      []byte
+	IndexIntValue   int64
+	IndexFloatValue float64
+	// all the field values in the composite index
+	CompositeValues []interface{}
+	// the values of the fields in the condition
+	FieldValues [][]byte
+	// the raw index key used as the continue token
+	indexKey []byte
 }
 
 type HsetIndex struct {
@@ -410,6 +615,9 @@ type HsetIndex struct {
 }
 
 func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	if self.isComposite() {
+		return self.searchCompositeRec(db, cond, countOnly)
+	}
 	var n int64
 	pkList := make([]HIndexResp, 0, 32)
 	var min []byte
@@ -448,6 +656,30 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 				return n, nil, err
 			}
 		}
+	} else if self.ValueType == Float64V {
+		// the start key of the value is less than all the keys with the value while
+		// the stop key is greater than them.
+		rt = common.RangeROpen
+		if cond.StartKey != nil {
+			sf, err := parseIndexFloat(cond.StartKey)
+			if err != nil {
+				return n, nil, err
+			}
+			min, err = encodeHsetIndexFloatKey(self.Table, self.Name, sf, nil, !cond.IncludeStart)
+			if err != nil {
+				return n, nil, err
+			}
+		}
+		if cond.EndKey != nil {
+			ef, err := parseIndexFloat(cond.EndKey)
+			if err != nil {
+				return n, nil, err
+			}
+			max, err = encodeHsetIndexFloatKey(self.Table, self.Name, ef, nil, cond.IncludeEnd)
+			if err != nil {
+				return n, nil, err
+			}
+		}
 	} else if self.ValueType == StringV {
 		isLOpen := cond.StartKey != nil && !cond.IncludeStart
 		isROpen := cond.EndKey != nil && !cond.IncludeEnd
@@ -489,7 +721,11 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 	if dbLog.Level() >= common.LOG_DEBUG {
 		dbLog.Debugf("begin search index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name), string(self.IndexField), min, max)
 	}
-	it, err := NewDBRangeLimitIterator(db.eng, min, max, rt, cond.Offset, cond.Limit, false)
+	min, max, rt, offset, err := self.applyContinueToken(cond, min, max, rt)
+	if err != nil {
+		return n, nil, err
+	}
+	it, err := NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(false), min, max, rt, offset, cond.Limit, cond.Reverse)
 	if err != nil {
 		return n, nil, err
 	}
@@ -502,79 +738,391 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		var pk []byte
 		var iv []byte
 		var nv int64
+		var fv float64
+		rawKey := it.Key()
 		if self.ValueType == Int64V || self.ValueType == Int32V {
-			_, _, nv, pk, err = decodeHsetIndexNumberKey(it.Key())
+			_, _, nv, pk, err = decodeHsetIndexNumberKey(rawKey)
+		} else if self.ValueType == Float64V {
+			_, _, fv, pk, err = decodeHsetIndexFloatKey(rawKey)
 		} else if self.ValueType == StringV {
-			_, _, iv, pk, err = decodeHsetIndexStringKey(it.Key())
+			_, _, iv, pk, err = decodeHsetIndexStringKey(rawKey)
 		} else {
 			continue
 		}
 		if err != nil {
 			continue
 		}
-		if self.Unique == 1 {
+		if self.isUnique() {
 			pk = it.Value()
 		}
 		if dbLog.Level() > common.LOG_DETAIL {
-			dbLog.Debugf("matched index: %v, %v, %v", it.Key(), string(pk), string(iv))
+			dbLog.Debugf("matched index: %v, %v, %v", rawKey, string(pk), string(iv))
 		}
-		pkList = append(pkList, HIndexResp{PKey: pk, IndexValue: iv, IndexIntValue: nv})
+		pkList = append(pkList, HIndexResp{PKey: pk, IndexValue: iv, IndexIntValue: nv, IndexFloatValue: fv,
+			indexKey: rawKey})
 	}
 	return n, pkList, nil
 }
 
-func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb *gorocksdb.WriteBatch) error {
+func (self *HsetIndex) searchCompositeRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	var n int64
+	fieldNum := len(self.CompositeFields) + 1
+	if len(cond.PrefixValues) >= fieldNum {
+		return n, nil, common.ErrInvalidArgs
+	}
+	header := encodeHsetIndexStartKey(self.Table, self.Name)
+	prefixArgs := make([]interface{}, 0, len(cond.PrefixValues))
+	for i, v := range cond.PrefixValues {
+		ev, err := self.encodeFieldValue(i, v)
+		if err != nil {
+			return n, nil, err
+		}
+		prefixArgs = append(prefixArgs, ev)
+	}
+	base, err := EncodeMemCmpKey(header, prefixArgs...)
+	if err != nil {
+		return n, nil, err
+	}
+	// the maxFlag is larger than any flag of the following fields, so appending it
+	// to the key will be greater than all the keys with the same leading values.
+	min := base
+	max := append(append([]byte(nil), base...), maxFlag)
+	rangeField := len(cond.PrefixValues)
+	vt := self.fieldValueType(rangeField)
+	if vt == Int64V || vt == Int32V {
+		if cond.StartKey != nil {
+			sn, err := strconv.ParseInt(string(cond.StartKey), 10, 64)
+			if err != nil {
+				return n, nil, err
+			}
+			if !cond.IncludeStart {
+				sn++
+			}
+			if min, err = EncodeMemCmpKey(append([]byte(nil), base...), sn); err != nil {
+				return n, nil, err
+			}
+		}
+		if cond.EndKey != nil {
+			en, err := strconv.ParseInt(string(cond.EndKey), 10, 64)
+			if err != nil {
+				return n, nil, err
+			}
+			if !cond.IncludeEnd {
+				en--
+			}
+			if max, err = EncodeMemCmpKey(append([]byte(nil), base...), en); err != nil {
+				return n, nil, err
+			}
+			max = append(max, maxFlag)
+		}
+	} else if vt == StringV || vt == Float64V {
+		if cond.StartKey != nil {
+			var sv interface{} = cond.StartKey
+			if vt == Float64V {
+				if sv, err = parseIndexFloat(cond.StartKey); err != nil {
+					return n, nil, err
+				}
+			}
+			if min, err = EncodeMemCmpKey(append([]byte(nil), base...), sv); err != nil {
+				return n, nil, err
+			}
+			if !cond.IncludeStart {
+				min = append(min, maxFlag)
+			}
+		}
+		if cond.EndKey != nil {
+			var ev interface{} = cond.EndKey
+			if vt == Float64V {
+				if ev, err = parseIndexFloat(cond.EndKey); err != nil {
+					return n, nil, err
+				}
+			}
+			if max, err = EncodeMemCmpKey(append([]byte(nil), base...), ev); err != nil {
+				return n, nil, err
+			}
+			if cond.IncludeEnd {
+				max = append(max, maxFlag)
+			}
+		}
+	} else {
+		return n, nil, ErrIndexValueType
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("begin search composite index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name),
+			self.indexKey(), min, max)
+	}
+	pkList := make([]HIndexResp, 0, 32)
+	min, max, rt, offset, err := self.applyContinueToken(cond, min, max, common.RangeROpen)
+	if err != nil {
+		return n, nil, err
+	}
+	it, err := NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(false), min, max, rt, offset, cond.Limit, cond.Reverse)
+	if err != nil {
+		return n, nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		n++
+		if countOnly {
+			continue
+		}
+		rawKey := it.Key()
+		values, pk, err := self.decodeCompositeKey(rawKey, len(header))
+		if err != nil {
+			continue
+		}
+		resp := HIndexResp{PKey: pk, CompositeValues: values, indexKey: rawKey}
+		switch realV := values[0].(type) {
+		case int64:
+			resp.IndexIntValue = realV
+		case float64:
+			resp.IndexFloatValue = realV
+		case []byte:
+			resp.IndexValue = realV
+		}
+		pkList = append(pkList, resp)
+	}
+	return n, pkList, nil
+}
+
+// the search will start after the continue token, and the offset is ignored since the
+// keys before the token are skipped already. For the reverse search, the token will
+// be the exclusive end of the range.
+func (self *HsetIndex) applyContinueToken(cond *IndexCondition, min []byte, max []byte, rt uint8) ([]byte, []byte, uint8, int, error) {
+	if cond.ContinueToken == nil {
+		return min, max, rt, cond.Offset, nil
+	}
+	if !bytes.HasPrefix(cond.ContinueToken, encodeHsetIndexStartKey(self.Table, self.Name)) ||
+		bytes.Compare(cond.ContinueToken, min) < 0 || bytes.Compare(cond.ContinueToken, max) > 0 {
+		return nil, nil, 0, 0, ErrIndexInvalidToken
+	}
+	if cond.Reverse {
+		return min, cond.ContinueToken, rt | common.RangeROpen, 0, nil
+	}
+	return cond.ContinueToken, max, rt | common.RangeLOpen, 0, nil
+}
+
+func (self *HsetIndex) isComposite() bool {
+	return len(self.CompositeFields) > 0
+}
+
+// the key of the index in the table index container
+func (self *HsetIndex) indexKey() string {
+	return hsetIndexKey(self.IndexField, self.CompositeFields)
+}
+
+func hsetIndexKey(field []byte, compositeFields [][]byte) string {
+	if len(compositeFields) == 0 {
+		return string(field)
+	}
+	fields := make([][]byte, 0, len(compositeFields)+1)
+	fields = append(fields, field)
+	fields = append(fields, compositeFields...)
+	return string(bytes.Join(fields, []byte(compositeFieldSep)))
+}
+
+// all the fields in the index, the leading field is the first
+func (self *HsetIndex) indexFields() [][]byte {
+	fields := make([][]byte, 0, len(self.CompositeFields)+1)
+	fields = append(fields, self.IndexField)
+	return append(fields, self.CompositeFields...)
+}
+
+// the position of the field in the index if the field value can be returned from
+// the index key without change, only the string value not truncated can be covered.
+func (self *HsetIndex) coveredFieldPos(field []byte) int {
+	for i, f := range self.indexFields() {
+		if !bytes.Equal(f, field) {
+			continue
+		}
+		if self.fieldValueType(i) != StringV || (i == 0 && self.PrefixLen > 0) {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+func (self *HsetIndex) fieldValueType(pos int) IndexPropertyDType {
+	if pos == 0 {
+		return self.ValueType
+	}
+	if pos-1 >= len(self.CompositeValueTypes) {
+		// the value type is missing, which is invalid for any index value
+		return IndexPropertyDType(-1)
+	}
+	return self.CompositeValueTypes[pos-1]
+}
+
+func (self *HsetIndex) encodeFieldValue(pos int, value []byte) (interface{}, error) {
+	vt := self.fieldValueType(pos)
+	if vt == Int64V || vt == Int32V {
+		return strconv.ParseInt(string(value), 10, 64)
+	} else if vt == Float64V {
+		return parseIndexFloat(value)
+	} else if vt == StringV {
+		if pos == 0 && self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
+			value = value[:self.PrefixLen]
+		}
+		return value, nil
+	}
+	return nil, ErrIndexValueType
+}
+
+// the composite index key is the memcmp encoded field values in order followed by the pk,
+// nil will be returned if any field value is empty, since the record can not be indexed.
+func (self *HsetIndex) encodeCompositeKey(values [][]byte, pk []byte) ([]byte, error) {
+	args := make([]interface{}, 0, len(values)+2)
+	for i, v := range values {
+		if len(v) == 0 {
+			return nil, nil
+		}
+		ev, err := self.encodeFieldValue(i, v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, ev)
+	}
+	args = append(args, int32(hindexStartSep), pk)
+	return EncodeMemCmpKey(encodeHsetIndexStartKey(self.Table, self.Name), args...)
+}
+
+func (self *HsetIndex) decodeCompositeKey(rawKey []byte, headerLen int) ([]interface{}, []byte, error) {
+	if len(rawKey) <= headerLen {
+		return nil, nil, errHsetIndexKey
+	}
+	fieldNum := len(self.CompositeFields) + 1
+	rets, err := Decode(rawKey[headerLen:], fieldNum+2)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rets) != fieldNum+2 {
+		return nil, nil, errHsetIndexKey
+	}
+	pk, ok := rets[fieldNum+1].([]byte)
+	if !ok {
+		return nil, nil, ErrIndexValueType
+	}
+	return rets[:fieldNum], pk, nil
+}
+
+// update the composite index from the old field values to the new field values,
+// the values should be in the order of the index fields.
+func (self *HsetIndex) UpdateCompositeRec(oldValues [][]byte, newValues [][]byte, pk []byte, wb engine.WriteBatch) error {
 	if self.State == DeletedIndex {
 		return nil
 	}
-	pkkey := pk
-	pkvalue := emptyValue
-	if self.Unique == 1 {
-		pkkey = nil
-		pkvalue = pk
+	var oldKey []byte
+	if oldValues != nil {
+		// the invalid old value can not be indexed before, so we can ignore the error
+		oldKey, _ = self.encodeCompositeKey(oldValues, pk)
 	}
-	if oldvalue != nil {
-		self.RemoveRec(oldvalue, pkkey, wb)
+	newKey, err := self.encodeCompositeKey(newValues, pk)
+	if err != nil {
+		return err
 	}
-	if len(value) == 0 {
+	if bytes.Equal(oldKey, newKey) {
 		return nil
 	}
+	if oldKey != nil {
+		wb.Delete(oldKey)
+	}
+	if newKey != nil {
+		wb.Put(newKey, emptyValue)
+	}
+	return nil
+}
+
+func (self *HsetIndex) isUnique() bool {
+	return self.Unique != common.IndexNotUnique
+}
+
+// the db key for the index value, the pk is stored as the value instead of in the key
+// for the unique index. nil will be returned if the value type is not supported.
+func (self *HsetIndex) encodeValueKey(value []byte, pk []byte) ([]byte, error) {
+	if self.isUnique() {
+		pk = nil
+	}
 	if self.ValueType == Int64V || self.ValueType == Int32V {
 		n, err := strconv.ParseInt(string(value), 10, 64)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		return encodeHsetIndexNumberKey(self.Table, self.Name, n, pk, false)
+	} else if self.ValueType == Float64V {
+		f, err := parseIndexFloat(value)
+		if err != nil {
+			return nil, err
 		}
-		hsetIndexAddNumberRec(self.Table, self.Name, n, pkkey, pkvalue, wb)
+		return encodeHsetIndexFloatKey(self.Table, self.Name, f, pk, false)
 	} else if self.ValueType == StringV {
 		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
 			value = value[:self.PrefixLen]
 		}
-		hsetIndexAddStringRec(self.Table, self.Name, value, pkkey, pkvalue, wb)
+		return encodeHsetIndexStringKey(self.Table, self.Name, value, pk, false)
+	}
+	return nil, nil
+}
+
+// get the pk which owns the value in the unique index
+func (self *HsetIndex) getUniqueOwner(db *RockDB, dbkey []byte) ([]byte, error) {
+	return db.eng.GetBytesNoLock(dbkey)
+}
+
+func (self *HsetIndex) UpdateRec(db *RockDB, oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex {
+		return nil
+	}
+	if len(value) == 0 {
+		self.RemoveRec(db, oldvalue, pk, wb)
+		return nil
+	}
+	dbkey, err := self.encodeValueKey(value, pk)
+	if err != nil {
+		return err
+	}
+	if dbkey == nil {
+		return nil
+	}
+	pkvalue := emptyValue
+	if self.isUnique() {
+		owner, err := self.getUniqueOwner(db, dbkey)
+		if err != nil {
+			return err
+		}
+		if owner != nil && !bytes.Equal(owner, pk) {
+			if self.Unique == common.IndexUniqueReject {
+				return ErrIndexUniqueConflict
+			}
+			dbLog.Debugf("unique index %v-%v value %v is overwritten by %v, old: %v", string(self.Table),
+				string(self.Name), string(value), string(pk), string(owner))
+		}
+		pkvalue = pk
 	}
+	self.RemoveRec(db, oldvalue, pk, wb)
+	wb.Put(dbkey, pkvalue)
 	return nil
 }
 
-func (self *HsetIndex) RemoveRec(value []byte, pk []byte, wb *gorocksdb.WriteBatch) {
+func (self *HsetIndex) RemoveRec(db *RockDB, value []byte, pk []byte, wb engine.WriteBatch) {
 	if value == nil {
 		return
 	}
-	if self.Unique == 1 {
-		pk = nil
+	dbkey, err := self.encodeValueKey(value, pk)
+	if err != nil || dbkey == nil {
+		return
 	}
-	if self.ValueType == Int64V || self.ValueType == Int32V {
-		n, err := strconv.ParseInt(string(value), 10, 64)
+	if self.isUnique() {
+		// the value may be taken over by another pk, which should not be removed
+		owner, err := self.getUniqueOwner(db, dbkey)
 		if err != nil {
 			return
 		}
-
-		hsetIndexRemoveNumberRec(self.Table, self.Name, n, pk, wb)
-	} else if self.ValueType == StringV {
-		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
-			value = value[:self.PrefixLen]
+		if owner != nil && !bytes.Equal(owner, pk) {
+			return
 		}
-
-		hsetIndexRemoveStringRec(self.Table, self.Name, value, pk, wb)
 	}
+	wb.Delete(dbkey)
 }
 
 func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
@@ -583,12 +1131,12 @@ func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
 
 	dbLog.Infof("begin clean index: %v-%v-%v", string(self.Table), string(self.Name), string(self.IndexField))
 
-	wb := gorocksdb.NewWriteBatch()
+	wb := db.eng.NewWriteBatch()
 	defer wb.Destroy()
-	wb.DeleteRange(min, max)
+	db.deleteRange(wb, min, max)
 	wb.Delete(max)
 
-	err := db.eng.Write(db.defaultWriteOpts, wb)
+	err := db.eng.Write(wb)
 	if err != nil {
 		dbLog.Infof("clean index %v, %v error: %v", string(self.Table), string(self.Name), err)
 	} else {
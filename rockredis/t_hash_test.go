@@ -449,7 +449,7 @@ func TestHashIndexStringV(t *testing.T) {
 		err = db.hsetIndexAddRec(pk, hindex.IndexField, inputFVList[i], db.wb)
 		assert.Nil(t, err)
 	}
-	db.eng.Write(db.defaultWriteOpts, db.wb)
+	db.eng.Write(db.wb)
 	condAll := &IndexCondition{
 		StartKey:     nil,
 		IncludeStart: false,
@@ -584,7 +584,7 @@ func TestHashIndexStringV(t *testing.T) {
 
 	db.wb.Clear()
 	db.hsetIndexRemoveRec(inputPKList[0], hindex.IndexField, inputFVList[0], db.wb)
-	db.eng.Write(db.defaultWriteOpts, db.wb)
+	db.eng.Write(db.wb)
 	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, int(cnt))
@@ -624,6 +624,163 @@ func TestHashIndexStringVMultiEqual(t *testing.T) {
 }
 
 func TestHashIndexStringVUnique(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_unique_field")
+	hindex.Unique = common.IndexUniqueReject
+	hindex.ValueType = StringV
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	pk1 := []byte("test:key1")
+	pk2 := []byte("test:key2")
+	condEqual := &IndexCondition{
+		StartKey:     []byte("fv1"),
+		IncludeStart: true,
+		EndKey:       []byte("fv1"),
+		IncludeEnd:   true,
+		Offset:       0,
+		Limit:        -1,
+	}
+	_, err = db.HSet(0, false, pk1, hindex.IndexField, []byte("fv1"))
+	assert.Nil(t, err)
+	// set the same value again for the same key should be allowed
+	_, err = db.HSet(0, false, pk1, hindex.IndexField, []byte("fv1"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, pk2, hindex.IndexField, []byte("fv1"))
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	err = db.HMset(0, pk2, common.KVRecord{Key: hindex.IndexField, Value: []byte("fv1")})
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	// the rejected write should not change the hash data
+	v, err := db.HGet(pk2, hindex.IndexField)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	_, cnt, pkList, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+	assert.Equal(t, pk1, pkList[0].PKey)
+
+	// the value can be used by others after changed
+	_, err = db.HSet(0, false, pk1, hindex.IndexField, []byte("fv2"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, pk2, hindex.IndexField, []byte("fv1"))
+	assert.Nil(t, err)
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+	assert.Equal(t, pk2, pkList[0].PKey)
+
+	// overwrite mode will take over the value, and the old key should not remove the index of the new key
+	hindex2, err := db.indexMgr.GetHsetIndex(string(hindex.Table), string(hindex.IndexField))
+	assert.Nil(t, err)
+	hindex2.Unique = common.IndexUniqueOverwrite
+	_, err = db.HSet(0, false, pk1, hindex.IndexField, []byte("fv1"))
+	assert.Nil(t, err)
+	_, err = db.HDel(pk2, hindex.IndexField)
+	assert.Nil(t, err)
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+	assert.Equal(t, pk1, pkList[0].PKey)
+
+	_, err = db.HClear(pk1)
+	assert.Nil(t, err)
+	_, cnt, _, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, int(cnt))
+}
+
+func TestHashIndexComposite(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index_city_age")
+	hindex.IndexField = []byte("city")
+	hindex.ValueType = StringV
+	hindex.CompositeFields = [][]byte{[]byte("age")}
+	hindex.CompositeValueTypes = []IndexPropertyDType{Int64V}
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), "city,age", ReadyIndex)
+	assert.Nil(t, err)
+
+	pk1 := []byte("test:key1")
+	pk2 := []byte("test:key2")
+	pk3 := []byte("test:key3")
+	err = db.HMset(0, pk1, common.KVRecord{Key: []byte("city"), Value: []byte("hz")},
+		common.KVRecord{Key: []byte("age"), Value: []byte("20")})
+	assert.Nil(t, err)
+	err = db.HMset(0, pk2, common.KVRecord{Key: []byte("city"), Value: []byte("hz")},
+		common.KVRecord{Key: []byte("age"), Value: []byte("30")})
+	assert.Nil(t, err)
+	err = db.HMset(0, pk3, common.KVRecord{Key: []byte("city"), Value: []byte("sh")},
+		common.KVRecord{Key: []byte("age"), Value: []byte("25")})
+	assert.Nil(t, err)
+
+	condPrefix := &IndexCondition{
+		StartKey:     []byte("hz"),
+		IncludeStart: true,
+		EndKey:       []byte("hz"),
+		IncludeEnd:   true,
+		Offset:       0,
+		Limit:        -1,
+	}
+	// search by the leading field only
+	_, cnt, pkList, err := db.HsetIndexSearch(hindex.Table, []byte("city"), condPrefix, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+	assert.Equal(t, pk1, pkList[0].PKey)
+	assert.Equal(t, pk2, pkList[1].PKey)
+	assert.Equal(t, []byte("hz"), pkList[0].IndexValue)
+	assert.Equal(t, int64(20), pkList[0].CompositeValues[1])
+
+	condRange := &IndexCondition{
+		PrefixValues: [][]byte{[]byte("hz")},
+		StartKey:     []byte("20"),
+		IncludeStart: false,
+		EndKey:       []byte("30"),
+		IncludeEnd:   true,
+		Offset:       0,
+		Limit:        -1,
+	}
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, []byte("city,age"), condRange, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+	assert.Equal(t, pk2, pkList[0].PKey)
+
+	// change the non-leading field should update the index
+	_, err = db.HSet(0, false, pk1, []byte("age"), []byte("28"))
+	assert.Nil(t, err)
+	_, cnt, _, err = db.HsetIndexSearch(hindex.Table, []byte("city,age"), condRange, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+
+	// the record with missing field will not be indexed
+	_, err = db.HDel(pk2, []byte("age"))
+	assert.Nil(t, err)
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, []byte("city,age"), condRange, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, int(cnt))
+	assert.Equal(t, pk1, pkList[0].PKey)
+
+	_, err = db.HClear(pk1)
+	assert.Nil(t, err)
+	_, cnt, _, err = db.HsetIndexSearch(hindex.Table, []byte("city"), condPrefix, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, int(cnt))
 }
 
 func TestHashIndexInt64V(t *testing.T) {
@@ -656,7 +813,7 @@ func TestHashIndexInt64V(t *testing.T) {
 	for i, pk := range inputPKList {
 		db.hsetIndexAddRec(pk, hindex.IndexField, inputFVList[i], db.wb)
 	}
-	db.eng.Write(db.defaultWriteOpts, db.wb)
+	db.eng.Write(db.wb)
 	condAll := &IndexCondition{
 		StartKey:     nil,
 		IncludeStart: false,
@@ -783,7 +940,7 @@ func TestHashIndexInt64V(t *testing.T) {
 
 	db.wb.Clear()
 	db.hsetIndexRemoveRec(inputPKList[0], hindex.IndexField, inputFVList[0], db.wb)
-	db.eng.Write(db.defaultWriteOpts, db.wb)
+	db.eng.Write(db.wb)
 	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condEqual, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, int(cnt))
@@ -816,6 +973,189 @@ func TestHashIndexInt64V(t *testing.T) {
 	}
 }
 
+func TestHashIndexFloat64V(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_float64field")
+	hindex.Unique = 0
+	hindex.ValueType = Float64V
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+
+	inputFVList := [][]byte{[]byte("-10.5"), []byte("-1"), []byte("0"), []byte("0.25"),
+		[]byte("1e3"), []byte("1000.5")}
+	inputPKList := make([][]byte, 0, len(inputFVList))
+	db.wb.Clear()
+	for i, fv := range inputFVList {
+		pk := []byte("test:key" + strconv.Itoa(i))
+		inputPKList = append(inputPKList, pk)
+		err = db.hsetIndexAddRec(pk, hindex.IndexField, fv, db.wb)
+		assert.Nil(t, err)
+	}
+	db.eng.Write(db.wb)
+	err = db.hsetIndexAddRec([]byte("test:keynan"), hindex.IndexField, []byte("NaN"), db.wb)
+	assert.Equal(t, ErrIndexValueNotNumber, err)
+
+	condAll := &IndexCondition{
+		Offset: 0,
+		Limit:  -1,
+	}
+	_, cnt, pkList, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField, condAll, false)
+	assert.Nil(t, err)
+	assert.Equal(t, len(inputPKList), int(cnt))
+	for i, pk := range pkList {
+		assert.Equal(t, inputPKList[i], pk.PKey)
+		fv, _ := strconv.ParseFloat(string(inputFVList[i]), 64)
+		assert.Equal(t, fv, pk.IndexFloatValue)
+	}
+
+	condRange := &IndexCondition{
+		StartKey:     []byte("-1"),
+		IncludeStart: false,
+		EndKey:       []byte("1000"),
+		IncludeEnd:   true,
+		Offset:       0,
+		Limit:        -1,
+	}
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condRange, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, int(cnt))
+	assert.Equal(t, inputPKList[2], pkList[0].PKey)
+	assert.Equal(t, inputPKList[4], pkList[2].PKey)
+
+	condRange.IncludeStart = true
+	condRange.IncludeEnd = false
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, condRange, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, int(cnt))
+	assert.Equal(t, inputPKList[1], pkList[0].PKey)
+	assert.Equal(t, inputPKList[3], pkList[2].PKey)
+}
+
+func TestHashIndexSearchWithFields(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_stringfield")
+	hindex.ValueType = StringV
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	pk1 := []byte("test:key1")
+	pk2 := []byte("test:key2")
+	err = db.HMset(0, pk1, common.KVRecord{Key: hindex.IndexField, Value: []byte("fv1")},
+		common.KVRecord{Key: []byte("other"), Value: []byte("ov1")})
+	assert.Nil(t, err)
+	err = db.HMset(0, pk2, common.KVRecord{Key: hindex.IndexField, Value: []byte("fv2")})
+	assert.Nil(t, err)
+
+	cond := &IndexCondition{
+		Offset: 0,
+		Limit:  -1,
+		Fields: [][]byte{hindex.IndexField},
+	}
+	// covered by the index
+	_, cnt, pkList, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField, cond, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+	assert.Equal(t, [][]byte{[]byte("fv1")}, pkList[0].FieldValues)
+	assert.Equal(t, [][]byte{[]byte("fv2")}, pkList[1].FieldValues)
+
+	cond.Fields = [][]byte{[]byte("other"), hindex.IndexField}
+	_, cnt, pkList, err = db.HsetIndexSearch(hindex.Table, hindex.IndexField, cond, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(cnt))
+	assert.Equal(t, [][]byte{[]byte("ov1"), []byte("fv1")}, pkList[0].FieldValues)
+	assert.Equal(t, [][]byte{nil, []byte("fv2")}, pkList[1].FieldValues)
+}
+
+func TestHashIndexSearchPage(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_int64field")
+	hindex.ValueType = Int64V
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+
+	pkCnt := 10
+	inputPKList := make([][]byte, 0, pkCnt)
+	db.wb.Clear()
+	for i := 0; i < pkCnt; i++ {
+		pk := []byte("test:key" + strconv.Itoa(i))
+		inputPKList = append(inputPKList, pk)
+		// the same value for two keys to make sure the page can split the same value
+		err = db.hsetIndexAddRec(pk, hindex.IndexField, []byte(strconv.Itoa(i/2)), db.wb)
+		assert.Nil(t, err)
+	}
+	db.eng.Write(db.wb)
+
+	cond := &IndexCondition{
+		StartKey:     []byte("0"),
+		IncludeStart: true,
+		Offset:       0,
+		Limit:        3,
+	}
+	var allPKs [][]byte
+	pages := 0
+	for {
+		_, pkList, token, err := db.HsetIndexSearchPage(hindex.Table, hindex.IndexField, cond)
+		assert.Nil(t, err)
+		pages++
+		for _, pk := range pkList {
+			allPKs = append(allPKs, pk.PKey)
+		}
+		if token == nil {
+			break
+		}
+		cond.ContinueToken = token
+	}
+	assert.Equal(t, 4, pages)
+	assert.Equal(t, inputPKList, allPKs)
+
+	// the reverse search should return the keys in the descending order
+	cond.Reverse = true
+	cond.ContinueToken = nil
+	var revPKs [][]byte
+	for {
+		_, pkList, token, err := db.HsetIndexSearchPage(hindex.Table, hindex.IndexField, cond)
+		assert.Nil(t, err)
+		for _, pk := range pkList {
+			revPKs = append(revPKs, pk.PKey)
+		}
+		if token == nil {
+			break
+		}
+		cond.ContinueToken = token
+	}
+	assert.Equal(t, len(inputPKList), len(revPKs))
+	for i, pk := range revPKs {
+		assert.Equal(t, inputPKList[len(inputPKList)-1-i], pk)
+	}
+
+	cond.ContinueToken = []byte("invalid")
+	_, _, _, err = db.HsetIndexSearchPage(hindex.Table, hindex.IndexField, cond)
+	assert.Equal(t, ErrIndexInvalidToken, err)
+}
+
 func TestHashUpdateWithIndex(t *testing.T) {
 	db := getTestDB(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -978,3 +1318,142 @@ func TestHashUpdateWithIndex(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, len(inputPKList)-2, int(cnt))
 }
+
+func TestHashMgetKeys(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	keys := [][]byte{[]byte("test:hmget_keys1"), []byte("test:hmget_keys2"), []byte("test:hmget_keys3")}
+	for i, key := range keys[:2] {
+		_, err := db.HSet(0, false, key, []byte("f1"), []byte("v1"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+		_, err = db.HSet(0, false, key, []byte("f2"), []byte("v2"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	vals, err := db.HMget(keys[0], []byte("f2"), []byte("f3"), []byte("f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v20"), nil, []byte("v10")}, vals)
+
+	valsList, errs := db.HMgetKeys(append(keys, []byte("invalidkey")), []byte("f1"), []byte("f2"))
+	assert.Equal(t, 4, len(valsList))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, [][]byte{[]byte("v1" + strconv.Itoa(i)), []byte("v2" + strconv.Itoa(i))}, valsList[i])
+	}
+	assert.Nil(t, errs[2])
+	assert.Equal(t, [][]byte{nil, nil}, valsList[2])
+	assert.NotNil(t, errs[3])
+	assert.Nil(t, valsList[3])
+}
+
+func TestHashGetAllSnapshot(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:hgetall_snapshot")
+	for i := 0; i < 100; i++ {
+		_, err := db.HSet(0, false, key, []byte("f"+strconv.Itoa(i)), []byte("v"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	n, valCh, err := db.HGetAll(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), n)
+	kn, keyCh, err := db.HKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), kn)
+	// the changes after the read should not be seen
+	_, err = db.HSet(0, false, key, []byte("f100"), []byte("v100"))
+	assert.Nil(t, err)
+	_, err = db.HDel(key, []byte("f0"))
+	assert.Nil(t, err)
+
+	cnt := 0
+	for v := range valCh {
+		assert.Nil(t, v.Err)
+		assert.NotEqual(t, "f100", string(v.Rec.Key))
+		cnt++
+	}
+	assert.Equal(t, int(n), cnt)
+	cnt = 0
+	for v := range keyCh {
+		assert.Nil(t, v.Rec.Value)
+		cnt++
+	}
+	assert.Equal(t, int(kn), cnt)
+}
+
+func TestHashFullTextIndex(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := []byte("test")
+	key1 := []byte("test:ft_key1")
+	key2 := []byte("test:ft_key2")
+	key3 := []byte("test:ft_key3")
+	// the existing data should be indexed while adding the index
+	_, err := db.HSet(0, false, key1, []byte("title"), []byte("Hello World, hello everyone"))
+	assert.Nil(t, err)
+	err = db.AddFullTextIndex(string(table), &common.FullTextIndexSchema{Name: "ft_title", HsetField: "title"})
+	assert.Nil(t, err)
+	err = db.AddFullTextIndex(string(table), &common.FullTextIndexSchema{Name: "ft_title", HsetField: "title"})
+	assert.Equal(t, ErrFullTextIndexExist, err)
+
+	err = db.HMset(0, key2, common.KVRecord{Key: []byte("title"), Value: []byte("world peace")},
+		common.KVRecord{Key: []byte("other"), Value: []byte("hello")})
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, key3, []byte("title"), []byte("helloworld 世界"))
+	assert.Nil(t, err)
+
+	rets, err := db.FullTextIndexSearch(table, "ft_title", "hello", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key1, rets[0].PKey)
+
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "world", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+
+	// the document with more matched terms ranks higher
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "hello*", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, key1, rets[0].PKey)
+	assert.Equal(t, key3, rets[1].PKey)
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "hello*", 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key3, rets[0].PKey)
+
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "WORLD peace", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key2, rets[0].PKey)
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "世界", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key3, rets[0].PKey)
+
+	// update and delete should change the postings
+	_, err = db.HSet(0, false, key1, []byte("title"), []byte("goodbye"))
+	assert.Nil(t, err)
+	_, err = db.HDel(key2, []byte("title"))
+	assert.Nil(t, err)
+	_, err = db.HClear(key3)
+	assert.Nil(t, err)
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "world", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rets))
+	rets, err = db.FullTextIndexSearch(table, "ft_title", "goodbye", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+
+	_, err = db.FullTextIndexSearch(table, "ft_title", " * ", 0, -1)
+	assert.Equal(t, ErrFullTextQueryInvalid, err)
+	err = db.DelFullTextIndex(string(table), "ft_title")
+	assert.Nil(t, err)
+	_, err = db.FullTextIndexSearch(table, "ft_title", "goodbye", 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+}
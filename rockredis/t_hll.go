@@ -7,7 +7,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/absolute8511/gorocksdb"
 	hll "github.com/absolute8511/hyperloglog"
 	//hll "github.com/axiomhq/hyperloglog"
 	"github.com/hashicorp/golang-lru"
@@ -90,11 +89,11 @@ func (c *hllCache) onEvicted(rawKey interface{}, value interface{}) {
 	if item.deleting {
 		return
 	}
-	wb := gorocksdb.NewWriteBatch()
+	wb := c.db.eng.NewWriteBatch()
 	defer wb.Destroy()
 	cachedKey := []byte(rawKey.(string))
 	table, key, err := convertRedisKeyToDBKVKey(cachedKey)
-	oldV, _ := c.db.eng.GetBytesNoLock(c.db.defaultReadOpts, key)
+	oldV, _ := c.db.eng.GetBytesNoLock(key)
 	hllp := item.hllp
 	newV, err := hllp.GobEncode()
 	if err != nil {
@@ -120,7 +119,7 @@ func (c *hllCache) onEvicted(rawKey interface{}, value interface{}) {
 	tsBuf := PutInt64(item.ts)
 	oldV = append(oldV, tsBuf...)
 	wb.Put(key, oldV)
-	c.db.eng.Write(c.db.defaultWriteOpts, wb)
+	c.db.eng.Write(wb)
 	item.flushed = true
 }
 
@@ -198,7 +197,7 @@ func (db *RockDB) PFCount(ts int64, keys ...[]byte) (int64, error) {
 			keyList[i] = kk
 		}
 	}
-	db.eng.MultiGetBytes(db.defaultReadOpts, keyList, keyList, errs)
+	db.eng.MultiGetBytes(keyList, keyList, errs)
 	for i, v := range keyList {
 		if errs[i] == nil && len(v) >= tsLen {
 			keyList[i] = keyList[i][:len(v)-tsLen]
@@ -302,7 +301,7 @@ func (db *RockDB) PFAdd(ts int64, rawKey []byte, elems ...[]byte) (int64, error)
 	var hllp *hll.HyperLogLogPlus
 	if !ok {
 		hllp, _ = hll.NewPlus(hllPrecision)
-		oldV, _ := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+		oldV, _ := db.eng.GetBytesNoLock(key)
 		if oldV != nil {
 			if len(oldV) < 8+1+tsLen {
 				return 0, errInvalidHLLData
@@ -14,6 +14,7 @@ var (
 	jSep                = byte(':')
 	errJSONPathNotArray = errors.New("json path is not array")
 	errInvalidJSONValue = errors.New("invalid json value")
+	errJSONKey          = errors.New("invalid json key")
 )
 
 func checkJSONValueSize(value []byte) error {
@@ -55,6 +56,9 @@ func decodeJSONKey(ek []byte) ([]byte, []byte, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(rets) != 2 {
+		return nil, nil, errJSONKey
+	}
 	rk, _ := rets[1].([]byte)
 	return table, rk, nil
 }
@@ -85,7 +89,7 @@ func (db *RockDB) getOldJSON(table []byte, rk []byte) ([]byte, []byte, bool, err
 	if err != nil {
 		return nil, nil, false, err
 	}
-	oldV, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+	oldV, err := db.eng.GetBytesNoLock(ek)
 	if err != nil {
 		return ek, nil, false, err
 	}
@@ -121,6 +125,7 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 	if err != nil {
 		return 0, err
 	}
+	origV := oldV
 
 	db.wb.Clear()
 	oldV, err = db.jSetPath(oldV, convertJSONPath(path), value)
@@ -137,13 +142,17 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 	}
 	// TODO: update index for path
 	_ = index
+	err = db.jsonFullTextIndexUpdate(key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	if isExist {
 		return 0, err
 	}
@@ -171,6 +180,7 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if err != nil {
 		return err
 	}
+	origV := oldV
 
 	db.wb.Clear()
 
@@ -193,13 +203,17 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if !gjson.Valid(string(oldV)) {
 		return errInvalidJSONValue
 	}
+	err = db.jsonFullTextIndexUpdate(key, origV, oldV, db.wb)
+	if err != nil {
+		return err
+	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	return err
 }
 
@@ -282,6 +296,10 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 		// delete whole json
 		db.wb.Delete(ek)
 		db.IncrTableKeyCount(table, -1, db.wb)
+		err = db.jsonFullTextIndexUpdate(key, oldV, nil, db.wb)
+		if err != nil {
+			return 0, err
+		}
 	} else {
 		newV, err := sjson.DeleteBytes(oldV, jpath)
 		if err != nil {
@@ -290,12 +308,16 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 		if bytes.Equal(newV, oldV) {
 			return 0, nil
 		}
+		err = db.jsonFullTextIndexUpdate(key, oldV, newV, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		oldV = newV
 		tsBuf := PutInt64(ts)
 		oldV = append(oldV, tsBuf...)
 		db.wb.Put(ek, oldV)
 	}
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	return 1, err
 }
 
@@ -305,7 +327,7 @@ func (db *RockDB) JKeyExists(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk, _ := encodeJSONKey(table, rk)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sk)
+	v, err := db.eng.GetBytes(sk)
 	if v != nil && err == nil {
 		return 1, nil
 	}
@@ -326,6 +348,7 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if err != nil {
 		return 0, err
 	}
+	origV := oldV
 	jpath := convertJSONPath(path)
 	oldPath := gjson.GetBytes(oldV, jpath)
 	if jpath == "" {
@@ -355,13 +378,17 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if !gjson.Valid(string(oldV)) {
 		return 0, errInvalidJSONValue
 	}
+	err = db.jsonFullTextIndexUpdate(key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	return int64(arrySize), err
 }
 
@@ -406,15 +433,20 @@ func (db *RockDB) JArrayPop(ts int64, key []byte, path []byte) (string, error) {
 		jpath += ".-1"
 	}
 	poped := oldJSON.Array()[arrySize-1].String()
+	origV := oldV
 	oldV, err = sjson.DeleteBytes(oldV, jpath)
 	if err != nil {
 		return "", err
 	}
 	db.wb.Clear()
+	err = db.jsonFullTextIndexUpdate(key, origV, oldV, db.wb)
+	if err != nil {
+		return "", err
+	}
 	tsBuf := PutInt64(ts)
 	oldV = append(oldV, tsBuf...)
 	db.wb.Put(ek, oldV)
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	return poped, err
 }
 
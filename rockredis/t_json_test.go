@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
@@ -369,3 +370,35 @@ func TestDBJSONKeyArrayOp(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), n)
 }
+
+func TestJSONFullTextIndex(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := []byte("test")
+	key := []byte("test:ft_json")
+	err := db.AddFullTextIndex(string(table), &common.FullTextIndexSchema{Name: "ft_desc", JSONPath: "info.desc"})
+	assert.Nil(t, err)
+	_, err = db.JSet(0, key, []byte("info"), []byte(`{"desc": "a quick brown fox"}`))
+	assert.Nil(t, err)
+	rets, err := db.FullTextIndexSearch(table, "ft_desc", "quick fox", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key, rets[0].PKey)
+
+	_, err = db.JSet(0, key, []byte("info.desc"), []byte(`"a lazy dog"`))
+	assert.Nil(t, err)
+	rets, err = db.FullTextIndexSearch(table, "ft_desc", "fox", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rets))
+	rets, err = db.FullTextIndexSearch(table, "ft_desc", "la*", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+
+	_, err = db.JDel(0, key, nil)
+	assert.Nil(t, err)
+	rets, err = db.FullTextIndexSearch(table, "ft_desc", "dog", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rets))
+}
@@ -2,10 +2,9 @@ package rockredis
 
 import (
 	"errors"
-	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 const (
@@ -67,7 +66,7 @@ func (db *RockDB) incr(ts int64, key []byte, delta int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	v, err := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+	v, err := db.eng.GetBytesNoLock(key)
 	created := false
 	n := int64(0)
 	if v == nil {
@@ -76,7 +75,11 @@ func (db *RockDB) incr(ts int64, key []byte, delta int64) (int64, error) {
 		if len(v) < tsLen {
 			return 0, errIntNumber
 		}
-		n, err = StrInt64(v[:len(v)-tsLen], err)
+		v, err = decodeKVValue(v)
+		if err != nil {
+			return 0, err
+		}
+		n, err = StrInt64(v, err)
 		if err != nil {
 			return 0, err
 		}
@@ -91,7 +94,7 @@ func (db *RockDB) incr(ts int64, key []byte, delta int64) (int64, error) {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	return n, err
 }
 
@@ -107,7 +110,7 @@ func (db *RockDB) KVDel(key []byte) (int64, error) {
 	delCnt := int64(1)
 	if db.cfg.EnableTableCounter {
 		if !db.cfg.EstimateTableCounter {
-			v, _ := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+			v, _ := db.eng.GetBytesNoLock(key)
 			if v != nil {
 				db.IncrTableKeyCount(table, -1, db.wb)
 			} else {
@@ -128,14 +131,14 @@ func (db *RockDB) KVDel(key []byte) (int64, error) {
 	return delCnt, nil
 }
 
-func (db *RockDB) KVDelWithBatch(key []byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) KVDelWithBatch(key []byte, wb engine.WriteBatch) error {
 	table, key, err := convertRedisKeyToDBKVKey(key)
 	if err != nil {
 		return err
 	}
 	if db.cfg.EnableTableCounter {
 		if !db.cfg.EstimateTableCounter {
-			v, _ := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+			v, _ := db.eng.GetBytesNoLock(key)
 			if v != nil {
 				db.IncrTableKeyCount(table, -1, wb)
 			}
@@ -191,7 +194,7 @@ func (db *RockDB) KVExists(keys ...[]byte) (int64, error) {
 		}
 	}
 	cnt := int64(0)
-	db.eng.MultiGetBytes(db.defaultReadOpts, keyList, keyList, errs)
+	db.eng.MultiGetBytes(keyList, keyList, errs)
 	for i, v := range keyList {
 		if errs[i] == nil && v != nil {
 			cnt++
@@ -206,10 +209,11 @@ func (db *RockDB) KVGetVer(key []byte) (int64, error) {
 		return 0, err
 	}
 	var ts uint64
-	v, err := db.eng.GetBytes(db.defaultReadOpts, key)
+	v, err := db.eng.GetBytes(key)
 	if len(v) >= tsLen {
 		ts, err = Uint64(v[len(v)-tsLen:], err)
 	}
+	ts &^= valueCompressedFlag
 	return int64(ts), err
 }
 
@@ -219,11 +223,11 @@ func (db *RockDB) KVGet(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	v, err := db.eng.GetBytes(db.defaultReadOpts, key)
-	if len(v) >= tsLen {
-		v = v[:len(v)-tsLen]
+	v, err := db.eng.GetBytes(key)
+	if err != nil {
+		return nil, err
 	}
-	return v, err
+	return decodeKVValue(v)
 }
 
 func (db *RockDB) Incr(ts int64, key []byte) (int64, error) {
@@ -246,11 +250,11 @@ func (db *RockDB) MGet(keys ...[]byte) ([][]byte, []error) {
 			keyList[i] = kk
 		}
 	}
-	db.eng.MultiGetBytes(db.defaultReadOpts, keyList, keyList, errs)
+	db.eng.MultiGetBytes(keyList, keyList, errs)
 	//log.Printf("mget: %v", keyList)
 	for i, v := range keyList {
-		if errs[i] == nil && len(v) >= tsLen {
-			keyList[i] = keyList[i][:len(v)-tsLen]
+		if errs[i] == nil {
+			keyList[i], errs[i] = decodeKVValue(v)
 		}
 	}
 	return keyList, errs
@@ -272,7 +276,6 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 	tableCnt := make(map[string]int)
 	var table []byte
 
-	tsBuf := PutInt64(ts)
 	for i := 0; i < len(args); i++ {
 		table, key, err = convertRedisKeyToDBKVKey(args[i].Key)
 		if err != nil {
@@ -285,7 +288,7 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 		if db.cfg.EnableTableCounter {
 			var v []byte
 			if !db.cfg.EstimateTableCounter {
-				v, _ = db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+				v, _ = db.eng.GetBytesNoLock(key)
 			}
 			if v == nil {
 				n := tableCnt[string(table)]
@@ -293,7 +296,7 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 				tableCnt[string(table)] = n
 			}
 		}
-		value = append(value, tsBuf...)
+		value = db.encodeKVValue(table, value, ts)
 		db.wb.Put(key, value)
 		//the expire meta data related to the key should be cleared as the key-value has been reset
 		db.delExpire(KVType, args[i].Key, db.wb)
@@ -317,14 +320,13 @@ func (db *RockDB) KVSet(ts int64, rawKey []byte, value []byte) error {
 	if db.cfg.EnableTableCounter {
 		var v []byte
 		if !db.cfg.EstimateTableCounter {
-			v, _ = db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+			v, _ = db.eng.GetBytesNoLock(key)
 		}
 		if v == nil {
 			db.IncrTableKeyCount(table, 1, db.wb)
 		}
 	}
-	tsBuf := PutInt64(ts)
-	value = append(value, tsBuf...)
+	value = db.encodeKVValue(table, value, ts)
 	db.wb.Put(key, value)
 
 	//db.delExpire(KVType, rawKey, db.wb)
@@ -344,17 +346,16 @@ func (db *RockDB) SetEx(ts int64, rawKey []byte, duration int64, value []byte) e
 	if db.cfg.EnableTableCounter {
 		var v []byte
 		if !db.cfg.EstimateTableCounter {
-			v, _ = db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+			v, _ = db.eng.GetBytesNoLock(key)
 		}
 		if v == nil {
 			db.IncrTableKeyCount(table, 1, db.wb)
 		}
 	}
-	tsBuf := PutInt64(ts)
-	value = append(value, tsBuf...)
+	value = db.encodeKVValue(table, value, ts)
 	db.wb.Put(key, value)
 
-	if err := db.rawExpireAt(KVType, rawKey, duration+time.Now().Unix(), db.wb); err != nil {
+	if err := db.rawExpireAt(KVType, rawKey, duration+common.ClockNow().Unix(), db.wb); err != nil {
 		return err
 	}
 
@@ -375,20 +376,49 @@ func (db *RockDB) SetNX(ts int64, key []byte, value []byte) (int64, error) {
 	var v []byte
 	var n int64 = 1
 
-	if v, err = db.eng.GetBytesNoLock(db.defaultReadOpts, key); err != nil {
+	if v, err = db.eng.GetBytesNoLock(key); err != nil {
 		return 0, err
 	} else if v != nil {
 		n = 0
 	} else {
 		db.wb.Clear()
 		db.IncrTableKeyCount(table, 1, db.wb)
-		value = append(value, PutInt64(ts)...)
+		value = db.encodeKVValue(table, value, ts)
 		db.wb.Put(key, value)
-		err = db.eng.Write(db.defaultWriteOpts, db.wb)
+		err = db.eng.Write(db.wb)
 	}
 	return n, err
 }
 
+// GetSet set the key to the new value and return the old value, nil is returned if the
+// key not exist.
+func (db *RockDB) GetSet(ts int64, rawKey []byte, value []byte) ([]byte, error) {
+	table, key, err := convertRedisKeyToDBKVKey(rawKey)
+	if err != nil {
+		return nil, err
+	} else if err = checkValueSize(value); err != nil {
+		return nil, err
+	}
+	oldV, err := db.eng.GetBytesNoLock(key)
+	if err != nil {
+		return nil, err
+	}
+	if oldV != nil {
+		oldV, err = decodeKVValue(oldV)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db.wb.Clear()
+	if oldV == nil {
+		db.IncrTableKeyCount(table, 1, db.wb)
+	}
+	value = db.encodeKVValue(table, value, ts)
+	db.wb.Put(key, value)
+	err = db.eng.Write(db.wb)
+	return oldV, err
+}
+
 func (db *RockDB) SetRange(ts int64, key []byte, offset int, value []byte) (int64, error) {
 	if len(value) == 0 {
 		return 0, nil
@@ -401,7 +431,7 @@ func (db *RockDB) SetRange(ts int64, key []byte, offset int, value []byte) (int6
 		return 0, errValueSize
 	}
 
-	oldValue, err := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+	oldValue, err := db.eng.GetBytesNoLock(key)
 	if err != nil {
 		return 0, err
 	}
@@ -411,7 +441,10 @@ func (db *RockDB) SetRange(ts int64, key []byte, offset int, value []byte) (int6
 	} else if len(oldValue) < tsLen {
 		return 0, errInvalidDBValue
 	} else {
-		oldValue = oldValue[:len(oldValue)-tsLen]
+		oldValue, err = decodeKVValue(oldValue)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	extra := offset + len(value) - len(oldValue)
@@ -419,15 +452,16 @@ func (db *RockDB) SetRange(ts int64, key []byte, offset int, value []byte) (int6
 		oldValue = append(oldValue, make([]byte, extra)...)
 	}
 	copy(oldValue[offset:], value)
-	oldValue = append(oldValue, PutInt64(ts)...)
+	n := len(oldValue)
+	oldValue = db.encodeKVValue(table, oldValue, ts)
 	db.wb.Put(key, oldValue)
 
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 
 	if err != nil {
 		return 0, err
 	}
-	return int64(len(oldValue) - tsLen), nil
+	return int64(n), nil
 }
 
 func getRange(start int, end int, valLen int) (int, int) {
@@ -489,33 +523,39 @@ func (db *RockDB) Append(ts int64, key []byte, value []byte) (int64, error) {
 		return 0, err
 	}
 
-	oldValue, err := db.eng.GetBytesNoLock(db.defaultReadOpts, key)
+	oldValue, err := db.eng.GetBytesNoLock(key)
 	if err != nil {
 		return 0, err
 	}
 
+	if oldValue != nil {
+		if len(oldValue) < tsLen {
+			return 0, errInvalidDBValue
+		}
+		oldValue, err = decodeKVValue(oldValue)
+		if err != nil {
+			return 0, err
+		}
+	}
 	if len(oldValue)+len(value) > MaxValueSize {
 		return 0, errValueSize
 	}
 	db.wb.Clear()
 	if oldValue == nil {
 		db.IncrTableKeyCount(table, 1, db.wb)
-	} else if len(oldValue) < tsLen {
-		return 0, errInvalidDBValue
-	} else {
-		oldValue = oldValue[:len(oldValue)-tsLen]
 	}
 
 	oldValue = append(oldValue, value...)
-	oldValue = append(oldValue, PutInt64(ts)...)
+	n := len(oldValue)
+	oldValue = db.encodeKVValue(table, oldValue, ts)
 
 	db.wb.Put(key, oldValue)
-	err = db.eng.Write(db.defaultWriteOpts, db.wb)
+	err = db.eng.Write(db.wb)
 	if err != nil {
 		return 0, err
 	}
 
-	return int64(len(oldValue) - tsLen), nil
+	return int64(n), nil
 }
 
 func (db *RockDB) Expire(key []byte, duration int64) (int64, error) {
@@ -543,7 +583,7 @@ func (db *RockDB) Persist(key []byte) (int64, error) {
 	if err := db.delExpire(KVType, key, db.wb); err != nil {
 		return 0, err
 	} else {
-		if err2 := db.eng.Write(db.defaultWriteOpts, db.wb); err2 != nil {
+		if err2 := db.eng.Write(db.wb); err2 != nil {
 			return 0, err2
 		} else {
 			return 1, nil
@@ -2,6 +2,7 @@ package rockredis
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"testing"
 
@@ -188,6 +189,39 @@ func TestDBKV(t *testing.T) {
 
 }
 
+func TestDBKVGetSet(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_kv_getset")
+	old, err := db.GetSet(0, key, []byte("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != nil {
+		t.Errorf("old value should be nil: %v", old)
+	}
+	old, err = db.GetSet(0, key, []byte("v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "v1" {
+		t.Errorf("old value mismatch: %v", string(old))
+	}
+	if v, err := db.KVGet(key); err != nil {
+		t.Error(err)
+	} else if string(v) != "v2" {
+		t.Error(string(v))
+	}
+	num, err := db.GetTableKeyCount([]byte("test"))
+	if err != nil {
+		t.Error(err)
+	} else if num != 1 {
+		t.Errorf("table count not as expected: %v", num)
+	}
+}
+
 func TestDBKVWithNoTable(t *testing.T) {
 	db := getTestDBNoTableCounter(t)
 	defer os.RemoveAll(db.cfg.DataDir)
@@ -240,3 +274,152 @@ func TestDBKVWithNoTable(t *testing.T) {
 		t.Error("should get no value")
 	}
 }
+
+func TestDBKVBatchTableCounter(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	err := db.BeginBatchWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("test:testdb_kv_batch_%v", i))
+		if err := db.KVSet(0, key, []byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the table counter should not be written before the batch committed
+	if num, err := db.GetTableKeyCount([]byte("test")); err != nil {
+		t.Error(err)
+	} else if num != 0 {
+		t.Errorf("table count not as expected: %v", num)
+	}
+	if len(db.batchTableCounters) != 1 {
+		t.Errorf("table counter should be merged in batch: %v", db.batchTableCounters)
+	}
+	err = db.CommitBatchWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num, err := db.GetTableKeyCount([]byte("test")); err != nil {
+		t.Error(err)
+	} else if num != 10 {
+		t.Errorf("table count not as expected: %v", num)
+	}
+	if len(db.batchTableCounters) != 0 {
+		t.Errorf("table counter should be cleared after batch: %v", db.batchTableCounters)
+	}
+}
+
+func TestKVValueCompress(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_kv_compress_a")
+	key2 := []byte("test:testdb_kv_compress_b")
+	bigV := bytes.Repeat([]byte("compress"), 1024)
+	// written before the compression enabled
+	if err := db.KVSet(1, key1, bigV); err != nil {
+		t.Fatal(err)
+	}
+	err := db.SetTableValueCompress("test", &common.ValueCompressSchema{Compression: "zstd", MinValueSize: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.KVSet(2, key2, bigV); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := db.eng.GetBytes(encodeKVKey(key2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) >= len(bigV) {
+		t.Fatalf("value should be compressed: %v", len(raw))
+	}
+	if v, err := db.KVGet(key2); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(v, bigV) {
+		t.Fatal("compressed value mismatch")
+	}
+	// the write batch view should compress the value as the origin db
+	key3 := []byte("test:testdb_kv_compress_c")
+	view := db.NewWriteBatchView()
+	if err := view.KVSet(2, key3, bigV); err != nil {
+		t.Fatal(err)
+	}
+	view.DestroyWriteBatchView()
+	if raw, err := db.eng.GetBytes(encodeKVKey(key3)); err != nil {
+		t.Fatal(err)
+	} else if len(raw) >= len(bigV) {
+		t.Fatalf("value should be compressed in view: %v", len(raw))
+	}
+	if v, err := db.KVGet(key3); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(v, bigV) {
+		t.Fatal("compressed value mismatch")
+	}
+	if ts, err := db.KVGetVer(key2); err != nil {
+		t.Fatal(err)
+	} else if ts != 2 {
+		t.Fatal(ts)
+	}
+	vs, errs := db.MGet(key1, key2)
+	for i, v := range vs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !bytes.Equal(v, bigV) {
+			t.Fatalf("mget value %v mismatch", i)
+		}
+	}
+	if n, err := db.Append(3, key2, []byte("tail")); err != nil {
+		t.Fatal(err)
+	} else if n != int64(len(bigV)+4) {
+		t.Fatal(n)
+	}
+	if v, err := db.GetRange(key2, -4, -1); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "tail" {
+		t.Fatal(string(v))
+	}
+	// small value should not be compressed
+	if err := db.KVSet(4, key1, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := db.eng.GetBytes(encodeKVKey(key1)); err != nil {
+		t.Fatal(err)
+	} else if string(raw[:len(raw)-tsLen]) != "small" {
+		t.Fatal(string(raw))
+	}
+
+	// the compression should be loaded while reopen
+	db.valueCompress = make(map[string]tableValueCompress)
+	if err := db.loadTableValueCompress(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.getValueCompress([]byte("test")); !ok {
+		t.Fatal("value compression should be loaded")
+	}
+	if s, err := db.GetTableValueCompress("test"); err != nil {
+		t.Fatal(err)
+	} else if s == nil || s.Compression != "zstd" || s.MinValueSize != 128 {
+		t.Fatal(s)
+	}
+
+	// disable the compression, the compressed values should still be readable
+	err = db.SetTableValueCompress("test", &common.ValueCompressSchema{Compression: "no"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.KVGet(key2); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(v, append(bigV, []byte("tail")...)) {
+		t.Fatal("compressed value mismatch after disabled")
+	}
+	if s, err := db.GetTableValueCompress("test"); err != nil || s != nil {
+		t.Fatal(s, err)
+	}
+}
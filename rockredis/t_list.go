@@ -5,7 +5,7 @@ import (
 	"errors"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 // TODO: we can use ring buffer to allow the list pop and push many times
@@ -26,6 +26,7 @@ var errLMetaKey = errors.New("invalid lmeta key")
 var errListKey = errors.New("invalid list key")
 var errListSeq = errors.New("invalid list sequence, overflow")
 var errListIndex = errors.New("invalid list index")
+var errListNoSuchKey = errors.New("ERR no such key")
 
 func lEncodeMetaKey(key []byte) []byte {
 	buf := make([]byte, len(key)+1+len(metaPrefix))
@@ -181,7 +182,7 @@ func (db *RockDB) fixListKey(ts int64, key []byte) {
 		}
 	}
 	dbLog.Infof("list %v fixed to %v, %v, cnt: %v", string(key), fixedHead, fixedTail, cnt)
-	db.eng.Write(db.defaultWriteOpts, db.wb)
+	db.eng.Write(db.wb)
 }
 
 func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (int64, error) {
@@ -233,7 +234,7 @@ func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (i
 	}
 	for i := 0; i < pushCnt; i++ {
 		ek := lEncodeListKey(table, rk, seq+int64(i)*delta)
-		v, _ := db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+		v, _ := db.eng.GetBytesNoLock(ek)
 		if v != nil {
 			dbLog.Warningf("list %v should not override the old value: %v, meta: %v, %v,%v", string(key),
 				v, seq, headSeq, tailSeq)
@@ -262,7 +263,7 @@ func (db *RockDB) lpush(ts int64, key []byte, whereSeq int64, args ...[]byte) (i
 		db.fixListKey(ts, key)
 		return 0, err
 	}
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return int64(size) + int64(pushCnt), err
 }
 
@@ -302,7 +303,7 @@ func (db *RockDB) lpop(ts int64, key []byte, whereSeq int64) ([]byte, error) {
 	}
 
 	itemKey := lEncodeListKey(table, rk, seq)
-	value, err = db.eng.GetBytesNoLock(db.defaultReadOpts, itemKey)
+	value, err = db.eng.GetBytesNoLock(itemKey)
 	// nil value means not exist
 	// empty value should be ""
 	// since we pop should success if size is not zero, we need fix this
@@ -334,7 +335,7 @@ func (db *RockDB) lpop(ts int64, key []byte, whereSeq int64) ([]byte, error) {
 		//delete the expire data related to the list key
 		db.delExpire(ListType, key, wb)
 	}
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return value, err
 }
 
@@ -381,7 +382,7 @@ func (db *RockDB) ltrim2(ts int64, key []byte, startP, stopP int64) error {
 
 	if start > 0 {
 		if start > RangeDeleteNum {
-			wb.DeleteRange(lEncodeListKey(table, rk, headSeq), lEncodeListKey(table, rk, headSeq+start))
+			db.deleteRange(wb, lEncodeListKey(table, rk, headSeq), lEncodeListKey(table, rk, headSeq+start))
 		} else {
 			for i := int64(0); i < start; i++ {
 				wb.Delete(lEncodeListKey(table, rk, headSeq+i))
@@ -390,7 +391,7 @@ func (db *RockDB) ltrim2(ts int64, key []byte, startP, stopP int64) error {
 	}
 	if stop < int64(llen-1) {
 		if llen-stop > RangeDeleteNum {
-			wb.DeleteRange(lEncodeListKey(table, rk, headSeq+int64(stop+1)),
+			db.deleteRange(wb, lEncodeListKey(table, rk, headSeq+int64(stop+1)),
 				lEncodeListKey(table, rk, headSeq+llen))
 		} else {
 			for i := int64(stop + 1); i < llen; i++ {
@@ -410,7 +411,7 @@ func (db *RockDB) ltrim2(ts int64, key []byte, startP, stopP int64) error {
 		db.delExpire(ListType, key, wb)
 	}
 
-	return db.eng.Write(db.defaultWriteOpts, wb)
+	return db.eng.Write(wb)
 }
 
 func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64, error) {
@@ -460,7 +461,7 @@ func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64,
 	if trimEndSeq-trimStartSeq > RangeDeleteNum {
 		itemStartKey := lEncodeListKey(table, rk, trimStartSeq)
 		itemEndKey := lEncodeListKey(table, rk, trimEndSeq)
-		wb.DeleteRange(itemStartKey, itemEndKey)
+		db.deleteRange(wb, itemStartKey, itemEndKey)
 		wb.Delete(itemEndKey)
 	} else {
 		for trimSeq := trimStartSeq; trimSeq <= trimEndSeq; trimSeq++ {
@@ -481,13 +482,13 @@ func (db *RockDB) ltrim(ts int64, key []byte, trimSize, whereSeq int64) (int64,
 		db.delExpire(ListType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return trimEndSeq - trimStartSeq + 1, err
 }
 
 //	ps : here just focus on deleting the list data,
 //		 any other likes expire is ignore.
-func (db *RockDB) lDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
+func (db *RockDB) lDelete(key []byte, wb engine.WriteBatch) int64 {
 	table, rk, _ := extractTableFromRedisKey(key)
 	if len(table) == 0 {
 		return 0
@@ -509,7 +510,7 @@ func (db *RockDB) lDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
 	stopKey := lEncodeListKey(table, rk, tailSeq)
 
 	if size > RangeDeleteNum {
-		wb.DeleteRange(startKey, stopKey)
+		db.deleteRange(wb, startKey, stopKey)
 	} else {
 		rit, err := NewDBRangeIterator(db.eng, startKey, stopKey, common.RangeClose, false)
 		if err != nil {
@@ -533,7 +534,7 @@ func (db *RockDB) lDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
 
 func (db *RockDB) lGetMeta(ek []byte) (headSeq int64, tailSeq int64, size int64, ts int64, err error) {
 	var v []byte
-	v, err = db.eng.GetBytes(db.defaultReadOpts, ek)
+	v, err = db.eng.GetBytes(ek)
 	if err != nil {
 		return
 	} else if v == nil {
@@ -552,7 +553,7 @@ func (db *RockDB) lGetMeta(ek []byte) (headSeq int64, tailSeq int64, size int64,
 	return
 }
 
-func (db *RockDB) lSetMeta(ek []byte, headSeq int64, tailSeq int64, ts int64, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) lSetMeta(ek []byte, headSeq int64, tailSeq int64, ts int64, wb engine.WriteBatch) (int64, error) {
 	size := tailSeq - headSeq + 1
 	if size < 0 {
 		//	todo : log error + panic
@@ -597,7 +598,7 @@ func (db *RockDB) LIndex(key []byte, index int64) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return db.eng.GetBytes(db.defaultReadOpts, sk)
+	return db.eng.GetBytes(sk)
 }
 
 func (db *RockDB) LVer(key []byte) (int64, error) {
@@ -663,7 +664,7 @@ func (db *RockDB) LSet(ts int64, key []byte, index int64, value []byte) error {
 		return err
 	}
 	if size == 0 {
-		return errListIndex
+		return errListNoSuchKey
 	}
 	db.wb.Clear()
 	wb := db.wb
@@ -682,7 +683,7 @@ func (db *RockDB) LSet(ts int64, key []byte, index int64, value []byte) error {
 	}
 	db.lSetMeta(metaKey, headSeq, tailSeq, ts, wb)
 	wb.Put(sk, value)
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return err
 }
 
@@ -736,7 +737,7 @@ func (db *RockDB) LRange(key []byte, start int64, stop int64) ([][]byte, error)
 	if err != nil {
 		return nil, err
 	}
-	rit, err := NewDBRangeLimitIterator(db.eng, startKey, stopKey, common.RangeClose, 0, int(limit), false)
+	rit, err := NewSnapshotDBRangeLimitIterator(db.eng, startKey, stopKey, common.RangeClose, 0, int(limit), false)
 	if err != nil {
 		return nil, err
 	}
@@ -772,7 +773,7 @@ func (db *RockDB) LClear(key []byte) (int64, error) {
 		//delete the expire data related to the list key
 		db.delExpire(ListType, key, db.wb)
 	}
-	err := db.eng.Write(db.defaultWriteOpts, db.wb)
+	err := db.eng.Write(db.wb)
 	return num, err
 }
 
@@ -789,7 +790,7 @@ func (db *RockDB) LMclear(keys ...[]byte) (int64, error) {
 		db.lDelete(key, db.wb)
 		db.delExpire(ListType, key, db.wb)
 	}
-	err := db.eng.Write(db.defaultWriteOpts, db.wb)
+	err := db.eng.Write(db.wb)
 	if err != nil {
 		// TODO: log here , the list maybe corrupt
 	}
@@ -797,7 +798,7 @@ func (db *RockDB) LMclear(keys ...[]byte) (int64, error) {
 	return int64(len(keys)), err
 }
 
-func (db *RockDB) lMclearWithBatch(wb *gorocksdb.WriteBatch, keys ...[]byte) error {
+func (db *RockDB) lMclearWithBatch(wb engine.WriteBatch, keys ...[]byte) error {
 	if len(keys) >= MAX_BATCH_NUM {
 		return errTooMuchBatchSize
 	}
@@ -817,7 +818,7 @@ func (db *RockDB) LKeyExists(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := lEncodeMetaKey(key)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sk)
+	v, err := db.eng.GetBytes(sk)
 	if v != nil && err == nil {
 		return 1, nil
 	}
@@ -849,7 +850,7 @@ func (db *RockDB) LPersist(key []byte) (int64, error) {
 	if err := db.delExpire(ListType, key, db.wb); err != nil {
 		return 0, err
 	} else {
-		if err2 := db.eng.Write(db.defaultWriteOpts, db.wb); err2 != nil {
+		if err2 := db.eng.Write(db.wb); err2 != nil {
 			return 0, err2
 		} else {
 			return 1, nil
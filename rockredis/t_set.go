@@ -5,7 +5,7 @@ import (
 	"errors"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 var (
@@ -96,7 +96,7 @@ func sDecodeSetKey(ek []byte) ([]byte, []byte, []byte, error) {
 	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
 	pos += 2
 
-	if keyLen+pos > len(ek) {
+	if keyLen+pos >= len(ek) {
 		return table, nil, nil, errSetKey
 	}
 
@@ -124,7 +124,7 @@ func sEncodeStopKey(table []byte, key []byte) []byte {
 	return k
 }
 
-func (db *RockDB) sDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
+func (db *RockDB) sDelete(key []byte, wb engine.WriteBatch) int64 {
 	table, rk, err := extractTableFromRedisKey(key)
 	if len(table) == 0 {
 		return 0
@@ -139,7 +139,7 @@ func (db *RockDB) sDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
 		return 0
 	}
 	if num > RangeDeleteNum {
-		wb.DeleteRange(start, stop)
+		db.deleteRange(wb, start, stop)
 	} else {
 		it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
 		if err != nil {
@@ -160,11 +160,11 @@ func (db *RockDB) sDelete(key []byte, wb *gorocksdb.WriteBatch) int64 {
 }
 
 // size key include set size and set modify timestamp
-func (db *RockDB) sIncrSize(ts int64, key []byte, delta int64, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) sIncrSize(ts int64, key []byte, delta int64, wb engine.WriteBatch) (int64, error) {
 	sk := sEncodeSizeKey(key)
 
 	var size int64
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -196,7 +196,7 @@ func (db *RockDB) sGetSize(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := sEncodeSizeKey(key)
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -214,7 +214,7 @@ func (db *RockDB) sGetVer(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := sEncodeSizeKey(key)
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -227,7 +227,7 @@ func (db *RockDB) sGetVer(key []byte) (int64, error) {
 	return Int64(meta[8:16], err)
 }
 
-func (db *RockDB) sSetItem(ts int64, key []byte, member []byte, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) sSetItem(ts int64, key []byte, member []byte, wb engine.WriteBatch) (int64, error) {
 	table, _, err := extractTableFromRedisKey(key)
 	if err != nil {
 		return 0, err
@@ -239,13 +239,14 @@ func (db *RockDB) sSetItem(ts int64, key []byte, member []byte, wb *gorocksdb.Wr
 	}
 
 	var n int64 = 1
-	if v, _ := db.eng.GetBytesNoLock(db.defaultReadOpts, ek); v != nil {
+	if v, _ := db.eng.GetBytesNoLock(ek); v != nil {
 		n = 0
 	} else {
 		if newNum, err := db.sIncrSize(ts, key, 1, wb); err != nil {
 			return 0, err
 		} else if newNum == 1 {
 			db.IncrTableKeyCount(table, 1, wb)
+			db.clearStaleExpire(SetType, key, wb)
 		}
 	}
 
@@ -275,7 +276,7 @@ func (db *RockDB) SAdd(ts int64, key []byte, args ...[]byte) (int64, error) {
 		ek = sEncodeSetKey(table, rk, args[i])
 
 		// TODO: how to tell not found and nil value (member value is also nil)
-		if v, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek); err != nil {
+		if v, err := db.eng.GetBytesNoLock(ek); err != nil {
 			return 0, err
 		} else if v == nil {
 			num++
@@ -287,9 +288,10 @@ func (db *RockDB) SAdd(ts int64, key []byte, args ...[]byte) (int64, error) {
 		return 0, err
 	} else if newNum > 0 && newNum == num {
 		db.IncrTableKeyCount(table, 1, wb)
+		db.clearStaleExpire(SetType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return num, err
 
 }
@@ -307,7 +309,7 @@ func (db *RockDB) SKeyExists(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := sEncodeSizeKey(key)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sk)
+	v, err := db.eng.GetBytes(sk)
 	if v != nil && err == nil {
 		return 1, nil
 	}
@@ -321,7 +323,7 @@ func (db *RockDB) SIsMember(key []byte, member []byte) (int64, error) {
 	}
 
 	var n int64 = 1
-	if v, err := db.eng.GetBytes(db.defaultReadOpts, ek); err != nil {
+	if v, err := db.eng.GetBytes(ek); err != nil {
 		return 0, err
 	} else if v == nil {
 		n = 0
@@ -351,7 +353,7 @@ func (db *RockDB) sMembersN(key []byte, num int) ([][]byte, error) {
 
 	v := make([][]byte, 0, num)
 
-	it, err := NewDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
+	it, err := NewSnapshotDBRangeIterator(db.eng, start, stop, common.RangeROpen, false)
 	if err != nil {
 		return nil, err
 	}
@@ -399,7 +401,7 @@ func (db *RockDB) SRem(ts int64, key []byte, args ...[]byte) (int64, error) {
 		}
 
 		ek = sEncodeSetKey(table, rk, args[i])
-		v, err = db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+		v, err = db.eng.GetBytesNoLock(ek)
 		if v == nil {
 			continue
 		} else {
@@ -415,7 +417,7 @@ func (db *RockDB) SRem(ts int64, key []byte, args ...[]byte) (int64, error) {
 		db.delExpire(SetType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return num, err
 }
 
@@ -427,7 +429,7 @@ func (db *RockDB) SClear(key []byte) (int64, error) {
 	wb := db.wb
 	wb.Clear()
 	num := db.sDelete(key, wb)
-	err := db.eng.Write(db.defaultWriteOpts, wb)
+	err := db.eng.Write(wb)
 	return num, err
 }
 
@@ -435,7 +437,7 @@ func (db *RockDB) SMclear(keys ...[]byte) (int64, error) {
 	if len(keys) >= MAX_BATCH_NUM {
 		return 0, errTooMuchBatchSize
 	}
-	wb := gorocksdb.NewWriteBatch()
+	wb := db.eng.NewWriteBatch()
 	defer wb.Destroy()
 	for _, key := range keys {
 		if err := checkKeySize(key); err != nil {
@@ -444,11 +446,11 @@ func (db *RockDB) SMclear(keys ...[]byte) (int64, error) {
 		db.sDelete(key, wb)
 	}
 
-	err := db.eng.Write(db.defaultWriteOpts, wb)
+	err := db.eng.Write(wb)
 	return int64(len(keys)), err
 }
 
-func (db *RockDB) sMclearWithBatch(wb *gorocksdb.WriteBatch, keys ...[]byte) error {
+func (db *RockDB) sMclearWithBatch(wb engine.WriteBatch, keys ...[]byte) error {
 	if len(keys) >= MAX_BATCH_NUM {
 		return errTooMuchBatchSize
 	}
@@ -486,7 +488,7 @@ func (db *RockDB) SPersist(key []byte) (int64, error) {
 	if err := db.delExpire(SetType, key, db.wb); err != nil {
 		return 0, err
 	} else {
-		if err2 := db.eng.Write(db.defaultWriteOpts, db.wb); err2 != nil {
+		if err2 := db.eng.Write(db.wb); err2 != nil {
 			return 0, err2
 		} else {
 			return 1, nil
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"sync/atomic"
+	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 // Note: since different data structure has different prefix,
@@ -35,6 +37,7 @@ const (
 	jsonIndexMeta     byte = 2
 	hsetIndexDataType byte = 1
 	jsonIndexDataType byte = 2
+	zsetIndexDataType byte = 3
 )
 
 // only KV data type need a table name as prefix to allow scan by table
@@ -133,7 +136,8 @@ func decodeDataTablePrefixFromBuf(buf []byte, dataType byte) ([]byte, int, error
 
 	tableLen := int(binary.BigEndian.Uint16(buf[pos:]))
 	pos += 2
-	if tableLen+pos > len(buf) {
+	// the table should be followed by the separator
+	if tableLen+pos >= len(buf) {
 		return nil, 0, errTableDataKeyPrefix
 	}
 	table := buf[pos : pos+tableLen]
@@ -184,7 +188,7 @@ func (db *RockDB) GetTables() [][]byte {
 	return ch
 }
 
-func (db *RockDB) DelTableKeyCount(table []byte, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) DelTableKeyCount(table []byte, wb engine.WriteBatch) error {
 	if !db.cfg.EnableTableCounter {
 		return nil
 	}
@@ -193,20 +197,35 @@ func (db *RockDB) DelTableKeyCount(table []byte, wb *gorocksdb.WriteBatch) error
 	return nil
 }
 
-func (db *RockDB) IncrTableKeyCount(table []byte, delta int64, wb *gorocksdb.WriteBatch) error {
+func (db *RockDB) IncrTableKeyCount(table []byte, delta int64, wb engine.WriteBatch) error {
 	if !db.cfg.EnableTableCounter {
 		return nil
 	}
+	if wb == db.wb && atomic.LoadInt32(&db.isBatching) == 1 {
+		db.batchTableCounters[string(table)] += delta
+		return nil
+	}
 	tm := encodeTableMetaKey(table)
 	wb.Merge(tm, PutRocksdbUint64(uint64(delta)))
 	return nil
 }
 
+// write the merged table counter updates into the batch
+func (db *RockDB) flushBatchTableCounters() {
+	for t, delta := range db.batchTableCounters {
+		if delta != 0 {
+			tm := encodeTableMetaKey([]byte(t))
+			db.wb.Merge(tm, PutRocksdbUint64(uint64(delta)))
+		}
+		delete(db.batchTableCounters, t)
+	}
+}
+
 func (db *RockDB) GetTableKeyCount(table []byte) (int64, error) {
 	tm := encodeTableMetaKey(table)
 	var err error
 	var size uint64
-	if size, err = GetRocksdbUint64(db.eng.GetBytes(db.defaultReadOpts, tm)); err != nil {
+	if size, err = GetRocksdbUint64(db.eng.GetBytes(tm)); err != nil {
 	}
 	return int64(size), err
 }
@@ -270,15 +289,247 @@ func (db *RockDB) GetHsetIndexTables() [][]byte {
 
 func (db *RockDB) GetTableHsetIndexValue(table []byte) ([]byte, error) {
 	key := encodeTableIndexMetaKey(table, hsetIndexMeta)
-	return db.eng.GetBytes(db.defaultReadOpts, key)
+	return db.eng.GetBytes(key)
 }
 
 func (db *RockDB) SetTableHsetIndexValue(table []byte, value []byte) error {
 	// this may not run in raft loop
 	// so we should use new db write batch here
 	key := encodeTableIndexMetaKey(table, hsetIndexMeta)
-	wb := gorocksdb.NewWriteBatch()
+	wb := db.eng.NewWriteBatch()
 	defer wb.Destroy()
 	wb.Put(key, value)
-	return db.eng.Write(db.defaultWriteOpts, wb)
+	return db.eng.Write(wb)
+}
+
+var droppedTablePrefix = []byte("dropped" + string(metaSep))
+
+func encodeDroppedTableKey(table []byte) []byte {
+	tk := make([]byte, 1+len(droppedTablePrefix)+len(table))
+	pos := 0
+	tk[pos] = TableMetaType
+	pos++
+	copy(tk[pos:], droppedTablePrefix)
+	pos += len(droppedTablePrefix)
+	copy(tk[pos:], table)
+	return tk
+}
+
+func decodeDroppedTableKey(tk []byte) ([]byte, error) {
+	pos := 0
+	if len(tk) < pos+1+len(droppedTablePrefix) || tk[pos] != TableMetaType {
+		return nil, errTableMetaKey
+	}
+	pos++
+	pos += len(droppedTablePrefix)
+	return tk[pos:], nil
+}
+
+// DropTable delete all the data, counter and indexes of the table using the range deletion,
+// and mark the table as dropped so the table will be hidden from the stats until the
+// deleted data is purged by the compaction in background.
+func (db *RockDB) DropTable(table string) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
+	dtsMeta := []byte{KVType, HSizeType, LMetaType, SSizeType, ZSizeType}
+	for i, dt := range dts {
+		rgs, err := getTableDataRange(dt, []byte(table), nil, nil)
+		if err != nil {
+			return err
+		}
+		for _, rg := range rgs {
+			wb.DeleteRange(rg.Start, rg.Limit)
+		}
+		minMetaKey, maxMetaKey, err := getTableMetaRange(dtsMeta[i], []byte(table), nil, nil)
+		if err != nil {
+			return err
+		}
+		wb.DeleteRange(minMetaKey, maxMetaKey)
+	}
+	wb.DeleteRange(encodeHsetIndexTableStartKey([]byte(table)), encodeHsetIndexTableStopKey([]byte(table)))
+	wb.Delete(encodeTableIndexMetaKey([]byte(table), hsetIndexMeta))
+	wb.Delete(encodeValueCompressKey([]byte(table)))
+	wb.DeleteRange(encodeZsetIndexTableStartKey([]byte(table)), encodeZsetIndexTableStopKey([]byte(table)))
+	wb.Delete(encodeZsetIndexMetaKey([]byte(table)))
+	wb.DeleteRange(encodeFullTextIndexTableStartKey([]byte(table)), encodeFullTextIndexTableStopKey([]byte(table)))
+	for _, index := range db.getFullTextIndexes([]byte(table)) {
+		wb.Delete(encodeFullTextIndexMetaKey([]byte(table), []byte(index.Name)))
+	}
+	// the table counter should be deleted even if the counter is disabled now
+	wb.Delete(encodeTableMetaKey([]byte(table)))
+	// the expire of the old keys should not delete the new keys written after dropped
+	err := db.delTableExpire([]byte(table), wb)
+	if err != nil {
+		return err
+	}
+	ts := time.Now().UnixNano()
+	wb.Put(encodeDroppedTableKey([]byte(table)), PutInt64(ts))
+	err = db.eng.Write(wb)
+	if err != nil {
+		dbLog.Infof("failed to drop table %v: %v", table, err)
+		return err
+	}
+	if db.indexMgr != nil {
+		db.indexMgr.dropTableIndexes(table)
+	}
+	db.compressMutex.Lock()
+	delete(db.valueCompress, table)
+	db.compressMutex.Unlock()
+	db.zsetIndexMutex.Lock()
+	delete(db.zsetScoreIndexes, table)
+	db.zsetIndexMutex.Unlock()
+	db.ftIndexMutex.Lock()
+	delete(db.ftIndexes, table)
+	db.ftIndexMutex.Unlock()
+	db.droppedMutex.Lock()
+	db.droppedTables[table] = ts
+	db.droppedMutex.Unlock()
+	dbLog.Infof("table %v dropped", table)
+	return nil
+}
+
+// delTableExpire delete the expire meta and time keys of all the keys in the table. The time
+// keys are found by the meta keys of the table, except the local deletion which has only the
+// time keys, so all the time keys are scanned.
+func (db *RockDB) delTableExpire(table []byte, wb engine.WriteBatch) error {
+	prefix := make([]byte, 0, len(table)+1)
+	prefix = append(prefix, table...)
+	prefix = append(prefix, tableStartSep)
+	if db.cfg.ExpirationPolicy == common.LocalDeletion {
+		it, err := NewDBRangeIterator(db.eng, []byte{ExpTimeType}, []byte{ExpTimeType + 1},
+			common.RangeROpen, false)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			_, key, _, err := expDecodeTimeKey(it.Key())
+			if err != nil || !bytes.HasPrefix(key, prefix) {
+				continue
+			}
+			wb.Delete(it.Key())
+		}
+		return nil
+	}
+	for _, dt := range []byte{KVType, HashType, ListType, SetType, ZSetType} {
+		minKey := expEncodeMetaKey(dt, prefix)
+		maxKey := expEncodeMetaKey(dt, prefix)
+		maxKey[len(maxKey)-1]++
+		it, err := NewDBRangeIterator(db.eng, minKey, maxKey, common.RangeROpen, false)
+		if err != nil {
+			return err
+		}
+		for ; it.Valid(); it.Next() {
+			_, key, err := expDecodeMetaKey(it.Key())
+			if err != nil {
+				continue
+			}
+			when, err := Int64(it.Value(), nil)
+			if err != nil || when == 0 {
+				continue
+			}
+			wb.Delete(expEncodeTimeKey(dt, key, when))
+		}
+		it.Close()
+		wb.DeleteRange(minKey, maxKey)
+	}
+	return nil
+}
+
+func (db *RockDB) IsTableDropped(table string) bool {
+	db.droppedMutex.RLock()
+	_, ok := db.droppedTables[table]
+	db.droppedMutex.RUnlock()
+	return ok
+}
+
+// GetDroppedTables return the dropped tables which are not purged yet
+func (db *RockDB) GetDroppedTables() []string {
+	db.droppedMutex.RLock()
+	defer db.droppedMutex.RUnlock()
+	tables := make([]string, 0, len(db.droppedTables))
+	for t := range db.droppedTables {
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+func (db *RockDB) loadDroppedTables() error {
+	s := encodeDroppedTableKey(nil)
+	e := encodeDroppedTableKey(nil)
+	e[len(e)-1] = e[len(e)-1] + 1
+	it, err := NewDBRangeIterator(db.eng, s, e, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	tables := make(map[string]int64)
+	for ; it.Valid(); it.Next() {
+		table, err := decodeDroppedTableKey(it.Key())
+		if err != nil {
+			continue
+		}
+		ts, _ := Int64(it.Value(), nil)
+		tables[string(table)] = ts
+	}
+	db.droppedMutex.Lock()
+	db.droppedTables = tables
+	db.droppedMutex.Unlock()
+	if len(tables) > 0 {
+		dbLog.Infof("dropped tables waiting purge: %v", tables)
+	}
+	return nil
+}
+
+// purge the data of the dropped tables by compaction, and remove the dropped mark
+// after the purge is done.
+func (db *RockDB) purgeDroppedTables() {
+	if !db.inCompactionWindow() {
+		return
+	}
+	db.droppedMutex.RLock()
+	tables := make(map[string]int64, len(db.droppedTables))
+	for t, ts := range db.droppedTables {
+		tables[t] = ts
+	}
+	db.droppedMutex.RUnlock()
+	for table, ts := range tables {
+		select {
+		case <-db.quit:
+			return
+		default:
+		}
+		start := time.Now()
+		db.eng.RLock()
+		if !db.eng.IsOpened() {
+			db.eng.RUnlock()
+			return
+		}
+		db.compactTableRange(table)
+		db.eng.CompactRange(engine.CRange{
+			Start: encodeHsetIndexTableStartKey([]byte(table)),
+			Limit: encodeHsetIndexTableStopKey([]byte(table)),
+		})
+		db.eng.RUnlock()
+
+		db.droppedMutex.Lock()
+		// the table may be dropped again while purging
+		if db.droppedTables[table] == ts {
+			wb := db.eng.NewWriteBatch()
+			wb.Delete(encodeDroppedTableKey([]byte(table)))
+			err := db.eng.Write(wb)
+			wb.Destroy()
+			if err != nil {
+				dbLog.Infof("failed to remove the dropped table %v mark: %v", table, err)
+			} else {
+				delete(db.droppedTables, table)
+			}
+		}
+		db.droppedMutex.Unlock()
+		dbLog.Infof("dropped table %v purged, cost: %v", table, time.Since(start))
+	}
 }
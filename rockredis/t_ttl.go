@@ -8,7 +8,7 @@ import (
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 var (
@@ -97,10 +97,10 @@ type expiredMetaBuffer interface {
 }
 
 type expiration interface {
-	rawExpireAt(byte, []byte, int64, *gorocksdb.WriteBatch) error
+	rawExpireAt(byte, []byte, int64, engine.WriteBatch) error
 	expireAt(byte, []byte, int64) error
 	ttl(byte, []byte) (int64, error)
-	delExpire(byte, []byte, *gorocksdb.WriteBatch) error
+	delExpire(byte, []byte, engine.WriteBatch) error
 	check(common.ExpiredDataBuffer, chan struct{}) error
 	Start()
 	Stop()
@@ -108,7 +108,16 @@ type expiration interface {
 }
 
 func (db *RockDB) expire(dataType byte, key []byte, duration int64) error {
-	return db.expiration.expireAt(dataType, key, time.Now().Unix()+duration)
+	return db.expiration.expireAt(dataType, key, common.ClockNow().Unix()+duration)
+}
+
+// clearStaleExpire should be called while the collection key is created, since the expire
+// meta of the deleted key may be left by the range deletion of the table.
+func (db *RockDB) clearStaleExpire(dataType byte, key []byte, wb engine.WriteBatch) {
+	err := db.delExpire(dataType, key, wb)
+	if err != nil {
+		dbLog.Infof("failed to clear the expire of the new key %v: %v", string(key), err)
+	}
 }
 
 func (db *RockDB) KVTtl(key []byte) (t int64, err error) {
@@ -145,7 +154,7 @@ type TTLChecker struct {
 func newTTLChecker(db *RockDB) *TTLChecker {
 	c := &TTLChecker{
 		db: db,
-		nc: time.Now().Unix(),
+		nc: common.ClockNow().Unix(),
 	}
 	return c
 }
@@ -170,7 +179,7 @@ func (c *TTLChecker) check(expiredBuf expiredMetaBuffer, stop chan struct{}) (er
 		}
 	}()
 
-	now := time.Now().Unix()
+	now := common.ClockNow().Unix()
 
 	c.Lock()
 	nc := c.nc
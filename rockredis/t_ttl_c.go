@@ -1,10 +1,8 @@
 package rockredis
 
 import (
-	"time"
-
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 type consistencyExpiration struct {
@@ -26,7 +24,7 @@ func (exp *consistencyExpiration) expireAt(dataType byte, key []byte, when int64
 	wb := exp.db.wb
 	wb.Clear()
 
-	if t, err := Int64(exp.db.eng.GetBytes(exp.db.defaultReadOpts, mk)); err != nil {
+	if t, err := Int64(exp.db.eng.GetBytes(mk)); err != nil {
 		return err
 	} else if t != 0 {
 		wb.Delete(expEncodeTimeKey(dataType, key, t))
@@ -37,7 +35,7 @@ func (exp *consistencyExpiration) expireAt(dataType byte, key []byte, when int64
 	wb.Put(tk, mk)
 	wb.Put(mk, PutInt64(when))
 
-	if err := exp.db.eng.Write(exp.db.defaultWriteOpts, wb); err != nil {
+	if err := exp.db.eng.Write(wb); err != nil {
 		return err
 	} else {
 		exp.setNextCheckTime(when, false)
@@ -45,10 +43,10 @@ func (exp *consistencyExpiration) expireAt(dataType byte, key []byte, when int64
 	}
 }
 
-func (exp *consistencyExpiration) rawExpireAt(dataType byte, key []byte, when int64, wb *gorocksdb.WriteBatch) error {
+func (exp *consistencyExpiration) rawExpireAt(dataType byte, key []byte, when int64, wb engine.WriteBatch) error {
 	mk := expEncodeMetaKey(dataType, key)
 
-	if t, err := Int64(exp.db.eng.GetBytes(exp.db.defaultReadOpts, mk)); err != nil {
+	if t, err := Int64(exp.db.eng.GetBytes(mk)); err != nil {
 		return err
 	} else if t != 0 {
 		wb.Delete(expEncodeTimeKey(dataType, key, t))
@@ -66,11 +64,11 @@ func (exp *consistencyExpiration) rawExpireAt(dataType byte, key []byte, when in
 func (exp *consistencyExpiration) ttl(dataType byte, key []byte) (int64, error) {
 	mk := expEncodeMetaKey(dataType, key)
 
-	t, err := Int64(exp.db.eng.GetBytes(exp.db.defaultReadOpts, mk))
+	t, err := Int64(exp.db.eng.GetBytes(mk))
 	if err != nil || t == 0 {
 		t = -1
 	} else {
-		t -= time.Now().Unix()
+		t -= common.ClockNow().Unix()
 		if t <= 0 {
 			t = -1
 		}
@@ -89,10 +87,10 @@ func (exp *consistencyExpiration) Destroy() {
 func (exp *consistencyExpiration) Stop() {
 }
 
-func (exp *consistencyExpiration) delExpire(dataType byte, key []byte, wb *gorocksdb.WriteBatch) error {
+func (exp *consistencyExpiration) delExpire(dataType byte, key []byte, wb engine.WriteBatch) error {
 	mk := expEncodeMetaKey(dataType, key)
 
-	if t, err := Int64(exp.db.eng.GetBytes(exp.db.defaultReadOpts, mk)); err != nil {
+	if t, err := Int64(exp.db.eng.GetBytes(mk)); err != nil {
 		return err
 	} else if t == 0 {
 		return nil
@@ -9,7 +9,7 @@ import (
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 func TestKVTTL_C(t *testing.T) {
@@ -315,7 +315,7 @@ func TestZSetTTL_C(t *testing.T) {
 
 type TExpiredDataBuffer struct {
 	db           *RockDB
-	wb           *gorocksdb.WriteBatch
+	wb           engine.WriteBatch
 	kTypeMap     map[string]byte
 	expiredCount int
 	t            *testing.T
@@ -330,7 +330,7 @@ func (buff *TExpiredDataBuffer) Write(dt common.DataType, key []byte) error {
 	} else {
 		buff.wb.Clear()
 		buff.db.delExpire(kt, key, buff.wb)
-		buff.db.eng.Write(buff.db.defaultWriteOpts, buff.wb)
+		buff.db.eng.Write(buff.wb)
 		delete(buff.kTypeMap, string(key))
 	}
 	return nil
@@ -361,7 +361,7 @@ func TestConsistencyTTLChecker(t *testing.T) {
 	buffer := &TExpiredDataBuffer{
 		t:        t,
 		db:       db,
-		wb:       gorocksdb.NewWriteBatch(),
+		wb:       db.eng.NewWriteBatch(),
 		kTypeMap: kTypeMap,
 	}
 
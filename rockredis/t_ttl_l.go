@@ -2,15 +2,47 @@ package rockredis
 
 import (
 	"errors"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
-var localExpCheckInterval = 300
+const defaultLocalExpCheckInterval = 300
+
+// the interval in seconds to check the expired keys, can be changed by the cluster dynamic config
+var localExpCheckInterval int64 = defaultLocalExpCheckInterval
+
+func init() {
+	common.RegisterDynamicConfApplier(common.DynConfLocalExpireCheckSecs, func(v string) error {
+		if v == "" {
+			SetLocalExpireCheckInterval(defaultLocalExpCheckInterval)
+			return nil
+		}
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		SetLocalExpireCheckInterval(secs)
+		return nil
+	})
+}
+
+// SetLocalExpireCheckInterval change the interval to check the expired keys for the local
+// deletion policy, it will be used after the current waiting check.
+func SetLocalExpireCheckInterval(secs int64) {
+	if secs <= 0 {
+		secs = defaultLocalExpCheckInterval
+	}
+	atomic.StoreInt64(&localExpCheckInterval, secs)
+}
+
+func getLocalExpCheckInterval() time.Duration {
+	return time.Second * time.Duration(atomic.LoadInt64(&localExpCheckInterval))
+}
 
 const (
 	localBatchedBufSize = 16 * 1024
@@ -51,7 +83,7 @@ func (exp *localExpiration) expireAt(dataType byte, key []byte, when int64) erro
 
 	wb.Put(tk, mk)
 
-	if err := exp.db.eng.Write(exp.db.defaultWriteOpts, wb); err != nil {
+	if err := exp.db.eng.Write(wb); err != nil {
 		return err
 	} else {
 		exp.setNextCheckTime(when, false)
@@ -59,7 +91,7 @@ func (exp *localExpiration) expireAt(dataType byte, key []byte, when int64) erro
 	}
 }
 
-func (exp *localExpiration) rawExpireAt(dataType byte, key []byte, when int64, wb *gorocksdb.WriteBatch) error {
+func (exp *localExpiration) rawExpireAt(dataType byte, key []byte, when int64, wb engine.WriteBatch) error {
 	tk := expEncodeTimeKey(dataType, key, when)
 	mk := expEncodeMetaKey(dataType, key)
 	wb.Put(tk, mk)
@@ -70,7 +102,7 @@ func (exp *localExpiration) ttl(byte, []byte) (int64, error) {
 	return -1, nil
 }
 
-func (exp *localExpiration) delExpire(byte, []byte, *gorocksdb.WriteBatch) error {
+func (exp *localExpiration) delExpire(byte, []byte, engine.WriteBatch) error {
 	return nil
 }
 
@@ -93,7 +125,7 @@ func (exp *localExpiration) applyExpiration(stop chan struct{}) {
 	dbLog.Infof("start to apply-expiration using Local-Deletion policy")
 	defer dbLog.Infof("apply-expiration using Local-Deletion policy exit")
 
-	t := time.NewTicker(time.Second * time.Duration(localExpCheckInterval))
+	t := time.NewTimer(getLocalExpCheckInterval())
 	defer t.Stop()
 
 	checker := exp.TTLChecker
@@ -118,6 +150,7 @@ func (exp *localExpiration) applyExpiration(stop chan struct{}) {
 				}
 				break
 			}
+			t.Reset(getLocalExpCheckInterval())
 		case <-stop:
 			return
 		}
@@ -225,7 +258,7 @@ func (exp *localExpiration) Destroy() {
 	}
 }
 
-func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch) func(keys [][]byte) error {
+func createLocalDelFunc(dt common.DataType, db *RockDB, wb engine.WriteBatch) func(keys [][]byte) error {
 	switch dt {
 	case common.KV:
 		return func(keys [][]byte) error {
@@ -233,7 +266,7 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 			for _, k := range keys {
 				db.KVDelWithBatch(k, wb)
 			}
-			err := db.eng.Write(db.defaultWriteOpts, wb)
+			err := db.eng.Write(wb)
 			if err != nil {
 				return err
 			}
@@ -250,7 +283,7 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 					return err
 				}
 			}
-			return db.eng.Write(db.defaultWriteOpts, wb)
+			return db.eng.Write(wb)
 		}
 	case common.LIST:
 		return func(keys [][]byte) error {
@@ -258,7 +291,7 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 			if err := db.lMclearWithBatch(wb, keys...); err != nil {
 				return err
 			}
-			return db.eng.Write(db.defaultWriteOpts, wb)
+			return db.eng.Write(wb)
 		}
 	case common.SET:
 		return func(keys [][]byte) error {
@@ -266,7 +299,7 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 			if err := db.sMclearWithBatch(wb, keys...); err != nil {
 				return err
 			}
-			return db.eng.Write(db.defaultWriteOpts, wb)
+			return db.eng.Write(wb)
 		}
 	case common.ZSET:
 		return func(keys [][]byte) error {
@@ -274,7 +307,7 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 			if err := db.zMclearWithBatch(wb, keys...); err != nil {
 				return err
 			}
-			return db.eng.Write(db.defaultWriteOpts, wb)
+			return db.eng.Write(wb)
 		}
 	default:
 		return nil
@@ -284,14 +317,14 @@ func createLocalDelFunc(dt common.DataType, db *RockDB, wb *gorocksdb.WriteBatch
 type localBatch struct {
 	keys       [][]byte
 	dt         common.DataType
-	wb         *gorocksdb.WriteBatch
+	wb         engine.WriteBatch
 	localDelFn func([][]byte) error
 }
 
 func newLocalBatch(db *RockDB, dt common.DataType) *localBatch {
 	batch := &localBatch{
 		dt:   dt,
-		wb:   gorocksdb.NewWriteBatch(),
+		wb:   db.eng.NewWriteBatch(),
 		keys: make([][]byte, 0, localBatchedMaxKeysNum),
 	}
 	batch.localDelFn = createLocalDelFunc(dt, db, batch.wb)
@@ -6,7 +6,7 @@ import (
 	"errors"
 
 	"github.com/absolute8511/ZanRedisDB/common"
-	"github.com/absolute8511/gorocksdb"
+	"github.com/absolute8511/ZanRedisDB/engine"
 )
 
 const (
@@ -116,11 +116,11 @@ func zDecodeSetKey(ek []byte) ([]byte, []byte, []byte, error) {
 	}
 
 	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	if keyLen+pos > len(ek) {
+	pos += 2
+	if keyLen+pos >= len(ek) {
 		return table, nil, nil, errZSetKey
 	}
 
-	pos += 2
 	key := ek[pos : pos+keyLen]
 
 	if ek[pos+keyLen] != zsetMemSep {
@@ -222,7 +222,7 @@ func zDecodeScoreKey(ek []byte) (table []byte, key []byte, member []byte, score
 	return
 }
 
-func (db *RockDB) zSetItem(key []byte, score float64, member []byte, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) zSetItem(key []byte, score float64, member []byte, wb engine.WriteBatch) (int64, error) {
 	// if score <= MinScore || score >= MaxScore {
 	// 	return 0, errScoreOverflow
 	// }
@@ -232,7 +232,8 @@ func (db *RockDB) zSetItem(key []byte, score float64, member []byte, wb *gorocks
 		return 0, err
 	}
 
-	if v, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek); err != nil {
+	var oldScore *float64
+	if v, err := db.eng.GetBytesNoLock(ek); err != nil {
 		return 0, err
 	} else if v != nil {
 		exists = 1
@@ -244,10 +245,14 @@ func (db *RockDB) zSetItem(key []byte, score float64, member []byte, wb *gorocks
 				return 0, err
 			}
 			wb.Delete(sk)
+			oldScore = &s
 		}
 	}
 
 	wb.Put(ek, PutFloat64(score))
+	if err := db.zsetScoreIndexUpdate(key, member, oldScore, score, wb); err != nil {
+		return 0, err
+	}
 
 	sk, err := convertRedisKeyToDBZScoreKey(key, member, score)
 	if err != nil {
@@ -258,12 +263,12 @@ func (db *RockDB) zSetItem(key []byte, score float64, member []byte, wb *gorocks
 }
 
 func (db *RockDB) zDelItem(key []byte, member []byte,
-	wb *gorocksdb.WriteBatch) (int64, error) {
+	wb engine.WriteBatch) (int64, error) {
 	ek, err := convertRedisKeyToDBZSetKey(key, member)
 	if err != nil {
 		return 0, err
 	}
-	if v, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek); err != nil {
+	if v, err := db.eng.GetBytesNoLock(ek); err != nil {
 		return 0, err
 	} else if v == nil {
 		//not exists
@@ -279,6 +284,9 @@ func (db *RockDB) zDelItem(key []byte, member []byte,
 				return 0, err
 			}
 			wb.Delete(sk)
+			if err := db.zsetScoreIndexRemove(key, member, s, wb); err != nil {
+				return 0, err
+			}
 		}
 	}
 	wb.Delete(ek)
@@ -320,9 +328,10 @@ func (db *RockDB) ZAdd(ts int64, key []byte, args ...common.ScorePair) (int64, e
 		return 0, err
 	} else if newNum > 0 && newNum == num {
 		db.IncrTableKeyCount(table, 1, wb)
+		db.clearStaleExpire(ZSetType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return num, err
 }
 
@@ -341,7 +350,7 @@ func (db *RockDB) ZFixKey(ts int64, key []byte) error {
 		dbLog.Infof("unmatched length : %v, %v, detail: %v", n, len(elems), elems)
 		db.wb.Clear()
 		db.zSetSize(ts, key, int64(len(elems)), db.wb)
-		err = db.eng.Write(db.defaultWriteOpts, db.wb)
+		err = db.eng.Write(db.wb)
 		if err != nil {
 			return err
 		}
@@ -350,11 +359,11 @@ func (db *RockDB) ZFixKey(ts int64, key []byte) error {
 }
 
 // note: we should not batch incrsize, because we read the old and put the new.
-func (db *RockDB) zIncrSize(ts int64, key []byte, delta int64, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) zIncrSize(ts int64, key []byte, delta int64, wb engine.WriteBatch) (int64, error) {
 	sk := zEncodeSizeKey(key)
 
 	var size int64
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -382,7 +391,7 @@ func (db *RockDB) zIncrSize(ts int64, key []byte, delta int64, wb *gorocksdb.Wri
 
 func (db *RockDB) zGetSize(key []byte) (int64, error) {
 	sk := zEncodeSizeKey(key)
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -397,7 +406,7 @@ func (db *RockDB) zGetSize(key []byte) (int64, error) {
 
 func (db *RockDB) zGetVer(key []byte) (int64, error) {
 	sk := zEncodeSizeKey(key)
-	meta, err := db.eng.GetBytesNoLock(db.defaultReadOpts, sk)
+	meta, err := db.eng.GetBytesNoLock(sk)
 	if err != nil {
 		return 0, err
 	}
@@ -410,7 +419,7 @@ func (db *RockDB) zGetVer(key []byte) (int64, error) {
 	return Int64(meta[8:16], err)
 }
 
-func (db *RockDB) zSetSize(ts int64, key []byte, newSize int64, wb *gorocksdb.WriteBatch) {
+func (db *RockDB) zSetSize(ts int64, key []byte, newSize int64, wb engine.WriteBatch) {
 	sk := zEncodeSizeKey(key)
 	if newSize <= 0 {
 		wb.Delete(sk)
@@ -444,7 +453,7 @@ func (db *RockDB) ZScore(key []byte, member []byte) (float64, error) {
 	if err != nil {
 		return score, err
 	}
-	if v, err := db.eng.GetBytes(db.defaultReadOpts, k); err != nil {
+	if v, err := db.eng.GetBytes(k); err != nil {
 		return score, err
 	} else if v == nil {
 		return score, errScoreMiss
@@ -490,7 +499,7 @@ func (db *RockDB) ZRem(ts int64, key []byte, members ...[]byte) (int64, error) {
 		db.delExpire(ZSetType, key, wb)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return num, err
 }
 
@@ -510,7 +519,8 @@ func (db *RockDB) ZIncrBy(ts int64, key []byte, delta float64, member []byte) (f
 	ek := zEncodeSetKey(table, rk, member)
 
 	var oldScore float64
-	v, err := db.eng.GetBytesNoLock(db.defaultReadOpts, ek)
+	var oldScorePtr *float64
+	v, err := db.eng.GetBytesNoLock(ek)
 	if err != nil {
 		return score, err
 	} else if v == nil {
@@ -519,14 +529,19 @@ func (db *RockDB) ZIncrBy(ts int64, key []byte, delta float64, member []byte) (f
 			return score, err
 		} else if newNum == 1 {
 			db.IncrTableKeyCount(table, 1, wb)
+			db.clearStaleExpire(ZSetType, key, wb)
 		}
 	} else {
 		if oldScore, err = Float64(v, err); err != nil {
 			return score, err
 		}
+		oldScorePtr = &oldScore
 	}
 
 	score = oldScore + delta
+	if err := db.zsetScoreIndexUpdate(key, member, oldScorePtr, score, wb); err != nil {
+		return score, err
+	}
 
 	sk := zEncodeScoreKey(false, false, table, rk, member, score)
 	wb.Put(sk, []byte{})
@@ -538,7 +553,7 @@ func (db *RockDB) ZIncrBy(ts int64, key []byte, delta float64, member []byte) (f
 		wb.Delete(oldSk)
 	}
 
-	err = db.eng.Write(db.defaultWriteOpts, wb)
+	err = db.eng.Write(wb)
 	return score, err
 }
 
@@ -552,7 +567,7 @@ func (db *RockDB) ZCount(key []byte, min float64, max float64) (int64, error) {
 	}
 	minKey := zEncodeStartScoreKey(table, rk, min)
 	maxKey := zEncodeStopScoreKey(table, rk, max)
-	it, err := NewDBRangeIterator(db.eng, minKey, maxKey, common.RangeClose, false)
+	it, err := NewSnapshotDBRangeIterator(db.eng, minKey, maxKey, common.RangeClose, false)
 	if err != nil {
 		return 0, err
 	}
@@ -577,7 +592,7 @@ func (db *RockDB) zrank(key []byte, member []byte, reverse bool) (int64, error)
 	}
 	k := zEncodeSetKey(table, rk, member)
 
-	v, _ := db.eng.GetBytes(db.defaultReadOpts, k)
+	v, _ := db.eng.GetBytes(k)
 	if v == nil {
 		return -1, nil
 	} else {
@@ -588,13 +603,13 @@ func (db *RockDB) zrank(key []byte, member []byte, reverse bool) (int64, error)
 			var rit *RangeLimitedIterator
 			if !reverse {
 				minKey := zEncodeStartKey(table, rk)
-				rit, err = NewDBRangeIterator(db.eng, minKey, sk, common.RangeClose, reverse)
+				rit, err = NewSnapshotDBRangeIterator(db.eng, minKey, sk, common.RangeClose, reverse)
 				if err != nil {
 					return 0, err
 				}
 			} else {
 				maxKey := zEncodeStopKey(table, rk)
-				rit, err = NewDBRangeIterator(db.eng, sk, maxKey, common.RangeClose, reverse)
+				rit, err = NewSnapshotDBRangeIterator(db.eng, sk, maxKey, common.RangeClose, reverse)
 				if err != nil {
 					return 0, err
 				}
@@ -622,7 +637,7 @@ func (db *RockDB) zrank(key []byte, member []byte, reverse bool) (int64, error)
 	return -1, nil
 }
 
-func (db *RockDB) zRemAll(ts int64, key []byte, wb *gorocksdb.WriteBatch) (int64, error) {
+func (db *RockDB) zRemAll(ts int64, key []byte, wb engine.WriteBatch) (int64, error) {
 	num, err := db.ZCard(key)
 	if err != nil {
 		return 0, err
@@ -634,13 +649,15 @@ func (db *RockDB) zRemAll(ts int64, key []byte, wb *gorocksdb.WriteBatch) (int64
 
 	minKey := zEncodeStartKey(table, rk)
 	maxKey := zEncodeStopKey(table, rk)
-	if num > RangeDeleteNum {
+	// the score index need to be removed for each member, so we can not
+	// use the range delete if the table is indexed.
+	if num > RangeDeleteNum && !db.isZsetScoreIndexed(table) {
 		sk := zEncodeSizeKey(key)
-		wb.DeleteRange(minKey, maxKey)
+		db.deleteRange(wb, minKey, maxKey)
 
 		minSetKey := zEncodeStartSetKey(table, rk)
 		maxSetKey := zEncodeStopSetKey(table, rk)
-		wb.DeleteRange(minSetKey, maxSetKey)
+		db.deleteRange(wb, minSetKey, maxSetKey)
 		if num > 0 {
 			db.IncrTableKeyCount(table, -1, wb)
 			db.delExpire(ZSetType, key, wb)
@@ -654,7 +671,7 @@ func (db *RockDB) zRemAll(ts int64, key []byte, wb *gorocksdb.WriteBatch) (int64
 }
 
 func (db *RockDB) zRemRangeBytes(ts int64, key []byte, minKey []byte, maxKey []byte, offset int,
-	count int, wb *gorocksdb.WriteBatch) (int64, error) {
+	count int, wb engine.WriteBatch) (int64, error) {
 	if len(key) > MaxKeySize {
 		return 0, errKeySize
 	}
@@ -704,7 +721,7 @@ func (db *RockDB) zRemRangeBytes(ts int64, key []byte, minKey []byte, maxKey []b
 }
 
 func (db *RockDB) zRemRange(ts int64, key []byte, min float64, max float64, offset int,
-	count int, wb *gorocksdb.WriteBatch) (int64, error) {
+	count int, wb engine.WriteBatch) (int64, error) {
 
 	table, rk, err := extractTableFromRedisKey(key)
 	if err != nil {
@@ -748,9 +765,9 @@ func (db *RockDB) zRangeBytes(key []byte, minKey []byte, maxKey []byte, offset i
 	//if reverse and offset is 0, count < 0, we may use forward iterator then reverse
 	//because store iterator prev is slower than next
 	if !reverse || (offset == 0 && count < 0) {
-		it, err = NewDBRangeLimitIterator(db.eng, minKey, maxKey, common.RangeClose, offset, count, false)
+		it, err = NewSnapshotDBRangeLimitIterator(db.eng, minKey, maxKey, common.RangeClose, offset, count, false)
 	} else {
-		it, err = NewDBRangeLimitIterator(db.eng, minKey, maxKey, common.RangeClose, offset, count, true)
+		it, err = NewSnapshotDBRangeLimitIterator(db.eng, minKey, maxKey, common.RangeClose, offset, count, true)
 	}
 	if err != nil {
 		return nil, err
@@ -836,7 +853,7 @@ func (db *RockDB) ZClear(key []byte) (int64, error) {
 
 	rmCnt, err := db.zRemAll(0, key, db.wb)
 	if err == nil {
-		err = db.eng.Write(db.defaultWriteOpts, db.wb)
+		err = db.eng.Write(db.wb)
 	}
 	return rmCnt, err
 }
@@ -853,7 +870,7 @@ func (db *RockDB) ZMclear(keys ...[]byte) (int64, error) {
 		if _, err := db.zRemAll(0, key, db.wb); err != nil {
 			return deleted, err
 		}
-		err := db.eng.Write(db.defaultWriteOpts, db.wb)
+		err := db.eng.Write(db.wb)
 		if err != nil {
 			return deleted, err
 		}
@@ -863,7 +880,7 @@ func (db *RockDB) ZMclear(keys ...[]byte) (int64, error) {
 	return int64(len(keys)), nil
 }
 
-func (db *RockDB) zMclearWithBatch(wb *gorocksdb.WriteBatch, keys ...[]byte) error {
+func (db *RockDB) zMclearWithBatch(wb engine.WriteBatch, keys ...[]byte) error {
 	if len(keys) > MAX_BATCH_NUM {
 		return errTooMuchBatchSize
 	}
@@ -908,7 +925,7 @@ func (db *RockDB) ZRemRangeByRank(ts int64, key []byte, start int, stop int) (in
 	maxKey := zEncodeStopKey(table, rk)
 	rmCnt, err = db.zRemRangeBytes(ts, key, minKey, maxKey, offset, count, db.wb)
 	if err == nil {
-		err = db.eng.Write(db.defaultWriteOpts, db.wb)
+		err = db.eng.Write(db.wb)
 	}
 	return rmCnt, err
 }
@@ -919,7 +936,7 @@ func (db *RockDB) ZRemRangeByScore(ts int64, key []byte, min float64, max float6
 
 	rmCnt, err := db.zRemRange(ts, key, min, max, 0, -1, db.wb)
 	if err == nil {
-		err = db.eng.Write(db.defaultWriteOpts, db.wb)
+		err = db.eng.Write(db.wb)
 	}
 
 	return rmCnt, err
@@ -1010,7 +1027,7 @@ func (db *RockDB) ZRangeByLex(key []byte, min []byte, max []byte, rangeType uint
 			return nil, errTooMuchBatchSize
 		}
 	}
-	it, err := NewDBRangeLimitIterator(db.eng, min, max, rangeType, offset, count, false)
+	it, err := NewSnapshotDBRangeLimitIterator(db.eng, min, max, rangeType, offset, count, false)
 	if err != nil {
 		return nil, err
 	}
@@ -1046,7 +1063,7 @@ func (db *RockDB) ZRemRangeByLex(ts int64, key []byte, min []byte, max []byte, r
 		if err != nil {
 			return 0, err
 		}
-		if err := db.eng.Write(db.defaultWriteOpts, wb); err != nil {
+		if err := db.eng.Write(wb); err != nil {
 			return 0, err
 		}
 		return cnt, nil
@@ -1094,7 +1111,7 @@ func (db *RockDB) ZRemRangeByLex(ts int64, key []byte, min []byte, max []byte, r
 		db.delExpire(ZSetType, key, wb)
 	}
 
-	if err := db.eng.Write(db.defaultWriteOpts, wb); err != nil {
+	if err := db.eng.Write(wb); err != nil {
 		return 0, err
 	}
 
@@ -1118,7 +1135,7 @@ func (db *RockDB) ZLexCount(key []byte, min []byte, max []byte, rangeType uint8)
 		max = zEncodeSetKey(table, rk, max)
 	}
 
-	it, err := NewDBRangeIterator(db.eng, min, max, rangeType, false)
+	it, err := NewSnapshotDBRangeIterator(db.eng, min, max, rangeType, false)
 	if err != nil {
 		return 0, err
 	}
@@ -1135,7 +1152,7 @@ func (db *RockDB) ZKeyExists(key []byte) (int64, error) {
 		return 0, err
 	}
 	sk := zEncodeSizeKey(key)
-	v, err := db.eng.GetBytes(db.defaultReadOpts, sk)
+	v, err := db.eng.GetBytes(sk)
 	if v != nil && err == nil {
 		return 1, nil
 	}
@@ -1167,7 +1184,7 @@ func (db *RockDB) ZPersist(key []byte) (int64, error) {
 	if err := db.delExpire(ZSetType, key, db.wb); err != nil {
 		return 0, err
 	} else {
-		if err2 := db.eng.Write(db.defaultWriteOpts, db.wb); err2 != nil {
+		if err2 := db.eng.Write(db.wb); err2 != nil {
 			return 0, err2
 		} else {
 			return 1, nil
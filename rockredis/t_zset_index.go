@@ -0,0 +1,272 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+)
+
+// The table level zset score index, the index key is
+// [table prefix][member, score, pk] so all the keys in the table having the member
+// can be searched by the score range.
+
+var errZsetIndexKey = errors.New("invalid zset score index key")
+
+var zsetIndexPrefix = []byte("zscoreidx" + string(metaSep))
+
+// rebuild the index for the existing data in batch
+const zsetIndexBuildBatch = 1000
+
+type ZIndexResp struct {
+	PKey  []byte
+	Score float64
+}
+
+func encodeZsetIndexMetaKey(table []byte) []byte {
+	tk := make([]byte, 1+len(zsetIndexPrefix)+len(table))
+	pos := 0
+	tk[pos] = TableMetaType
+	pos++
+	copy(tk[pos:], zsetIndexPrefix)
+	pos += len(zsetIndexPrefix)
+	copy(tk[pos:], table)
+	return tk
+}
+
+func decodeZsetIndexMetaKey(tk []byte) ([]byte, error) {
+	pos := 0
+	if len(tk) < pos+1+len(zsetIndexPrefix) || tk[pos] != TableMetaType {
+		return nil, errTableMetaKey
+	}
+	pos++
+	pos += len(zsetIndexPrefix)
+	return tk[pos:], nil
+}
+
+func encodeZsetIndexTableStartKey(table []byte) []byte {
+	tmpkey := make([]byte, 2+2+len(table)+1)
+	pos := 0
+	tmpkey[pos] = IndexDataType
+	pos++
+	tmpkey[pos] = zsetIndexDataType
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
+	pos += 2
+	copy(tmpkey[pos:], table)
+	pos += len(table)
+	tmpkey[pos] = tableIndexMetaStartSep
+	return tmpkey
+}
+
+func encodeZsetIndexTableStopKey(table []byte) []byte {
+	k := encodeZsetIndexTableStartKey(table)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
+func encodeZsetIndexKey(table []byte, member []byte, score float64, pk []byte) ([]byte, error) {
+	return EncodeMemCmpKey(encodeZsetIndexTableStartKey(table), member, score, pk)
+}
+
+func decodeZsetIndexKey(table []byte, rawKey []byte) (float64, []byte, error) {
+	headerLen := 2 + 2 + len(table) + 1
+	if len(rawKey) <= headerLen {
+		return 0, nil, errZsetIndexKey
+	}
+	rets, err := Decode(rawKey[headerLen:], 3)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rets) != 3 {
+		return 0, nil, errZsetIndexKey
+	}
+	score, ok := rets[1].(float64)
+	if !ok {
+		return 0, nil, errZsetIndexKey
+	}
+	pk, ok := rets[2].([]byte)
+	if !ok {
+		return 0, nil, errZsetIndexKey
+	}
+	return score, pk, nil
+}
+
+func (db *RockDB) isZsetScoreIndexed(table []byte) bool {
+	db.zsetIndexMutex.RLock()
+	_, ok := db.zsetScoreIndexes[string(table)]
+	db.zsetIndexMutex.RUnlock()
+	return ok
+}
+
+// update the score index of the member, the old score should be nil if the member is new
+func (db *RockDB) zsetScoreIndexUpdate(key []byte, member []byte, oldScore *float64, score float64, wb engine.WriteBatch) error {
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil || !db.isZsetScoreIndexed(table) {
+		return err
+	}
+	if oldScore != nil {
+		if *oldScore == score {
+			return nil
+		}
+		ik, err := encodeZsetIndexKey(table, member, *oldScore, key)
+		if err != nil {
+			return err
+		}
+		wb.Delete(ik)
+	}
+	ik, err := encodeZsetIndexKey(table, member, score, key)
+	if err != nil {
+		return err
+	}
+	wb.Put(ik, emptyValue)
+	return nil
+}
+
+func (db *RockDB) zsetScoreIndexRemove(key []byte, member []byte, score float64, wb engine.WriteBatch) error {
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil || !db.isZsetScoreIndexed(table) {
+		return err
+	}
+	ik, err := encodeZsetIndexKey(table, member, score, key)
+	if err != nil {
+		return err
+	}
+	wb.Delete(ik)
+	return nil
+}
+
+// build the index for all the zset data in the table
+func (db *RockDB) buildZsetScoreIndex(table []byte) error {
+	rgs, err := getTableDataRange(ZSetType, table, nil, nil)
+	if err != nil {
+		return err
+	}
+	it, err := NewDBRangeIterator(db.eng, rgs[0].Start, rgs[0].Limit, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	cnt := 0
+	for ; it.Valid(); it.Next() {
+		_, rk, member, err := zDecodeSetKey(it.Key())
+		if err != nil {
+			continue
+		}
+		score, err := Float64(it.Value(), nil)
+		if err != nil {
+			continue
+		}
+		ik, err := encodeZsetIndexKey(table, member, score, packRedisKey(table, rk))
+		if err != nil {
+			return err
+		}
+		wb.Put(ik, emptyValue)
+		cnt++
+		if cnt%zsetIndexBuildBatch == 0 {
+			if err := db.eng.Write(wb); err != nil {
+				return err
+			}
+			wb.Clear()
+		}
+	}
+	dbLog.Infof("table %v zset score index built for %v members", string(table), cnt)
+	return db.eng.Write(wb)
+}
+
+// SetTableZsetScoreIndex enable or disable the zset score index of the table, the
+// existing zset data will be indexed while enabling.
+func (db *RockDB) SetTableZsetScoreIndex(table string, s *common.ZsetScoreIndexSchema) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	enabled := db.isZsetScoreIndexed([]byte(table))
+	if enabled == s.Enable {
+		return nil
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	if s.Enable {
+		if err := db.buildZsetScoreIndex([]byte(table)); err != nil {
+			return err
+		}
+		d, _ := json.Marshal(s)
+		wb.Put(encodeZsetIndexMetaKey([]byte(table)), d)
+	} else {
+		wb.DeleteRange(encodeZsetIndexTableStartKey([]byte(table)), encodeZsetIndexTableStopKey([]byte(table)))
+		wb.Delete(encodeZsetIndexMetaKey([]byte(table)))
+	}
+	err := db.eng.Write(wb)
+	if err != nil {
+		return err
+	}
+	db.zsetIndexMutex.Lock()
+	if s.Enable {
+		db.zsetScoreIndexes[table] = struct{}{}
+	} else {
+		delete(db.zsetScoreIndexes, table)
+	}
+	db.zsetIndexMutex.Unlock()
+	dbLog.Infof("table %v zset score index changed to: %v", table, s)
+	return nil
+}
+
+func (db *RockDB) loadZsetScoreIndexes() error {
+	s := encodeZsetIndexMetaKey(nil)
+	e := encodeZsetIndexMetaKey(nil)
+	e[len(e)-1] = e[len(e)-1] + 1
+	it, err := NewDBRangeIterator(db.eng, s, e, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	tables := make(map[string]struct{})
+	for ; it.Valid(); it.Next() {
+		table, err := decodeZsetIndexMetaKey(it.Key())
+		if err != nil {
+			continue
+		}
+		tables[string(table)] = struct{}{}
+	}
+	db.zsetIndexMutex.Lock()
+	db.zsetScoreIndexes = tables
+	db.zsetIndexMutex.Unlock()
+	return nil
+}
+
+// ZsetScoreIndexSearch return the keys in the table having the member with the score
+// in the range [min, max], the results are ordered by the score.
+func (db *RockDB) ZsetScoreIndexSearch(table []byte, member []byte, min float64, max float64,
+	offset int, count int) ([]ZIndexResp, error) {
+	if !db.isZsetScoreIndexed(table) {
+		return nil, ErrIndexNotExist
+	}
+	minKey, err := EncodeMemCmpKey(encodeZsetIndexTableStartKey(table), member, min)
+	if err != nil {
+		return nil, err
+	}
+	maxKey, err := EncodeMemCmpKey(encodeZsetIndexTableStartKey(table), member, max)
+	if err != nil {
+		return nil, err
+	}
+	maxKey = append(maxKey, maxFlag)
+	it, err := NewDBRangeLimitIteratorWithOpts(db.eng, db.scanIteratorOpts(false), minKey, maxKey,
+		common.RangeROpen, offset, count, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	rets := make([]ZIndexResp, 0, 32)
+	for ; it.Valid(); it.Next() {
+		score, pk, err := decodeZsetIndexKey(table, it.Key())
+		if err != nil {
+			continue
+		}
+		rets = append(rets, ZIndexResp{PKey: pk, Score: score})
+	}
+	return rets, nil
+}
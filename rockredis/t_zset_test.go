@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/absolute8511/ZanRedisDB/common"
@@ -407,3 +408,100 @@ func TestZKeyExists(t *testing.T) {
 		t.Fatal("invalid value ", n)
 	}
 }
+
+func TestZSetScoreIndex(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	table := []byte("test")
+	key1 := []byte("test:zscore_index_1")
+	key2 := []byte("test:zscore_index_2")
+	key3 := []byte("test:zscore_index_3")
+	// the existing data should be indexed while enabling
+	_, err := db.ZAdd(0, key1, pair("a", 1), pair("b", 10))
+	assert.Nil(t, err)
+	_, err = db.ZsetScoreIndexSearch(table, []byte("a"), 0, 10, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+
+	err = db.SetTableZsetScoreIndex(string(table), &common.ZsetScoreIndexSchema{Enable: true})
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, key2, pair("a", 5), pair("b", 3))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, key3, pair("a", 20))
+	assert.Nil(t, err)
+
+	rets, err := db.ZsetScoreIndexSearch(table, []byte("a"), 0, 10, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, key1, rets[0].PKey)
+	assert.Equal(t, float64(1), rets[0].Score)
+	assert.Equal(t, key2, rets[1].PKey)
+	assert.Equal(t, float64(5), rets[1].Score)
+
+	rets, err = db.ZsetScoreIndexSearch(table, []byte("a"), 0, 10, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key2, rets[0].PKey)
+
+	// update the score should move the index
+	_, err = db.ZIncrBy(0, key1, 100, []byte("a"))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(0, key3, pair("a", 2))
+	assert.Nil(t, err)
+	rets, err = db.ZsetScoreIndexSearch(table, []byte("a"), 0, 10, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, key3, rets[0].PKey)
+	assert.Equal(t, key2, rets[1].PKey)
+
+	_, err = db.ZRem(0, key3, []byte("a"))
+	assert.Nil(t, err)
+	_, err = db.ZClear(key2)
+	assert.Nil(t, err)
+	rets, err = db.ZsetScoreIndexSearch(table, []byte("a"), common.MinScore, common.MaxScore, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key1, rets[0].PKey)
+	assert.Equal(t, float64(101), rets[0].Score)
+	rets, err = db.ZsetScoreIndexSearch(table, []byte("b"), common.MinScore, common.MaxScore, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, key1, rets[0].PKey)
+
+	err = db.SetTableZsetScoreIndex(string(table), &common.ZsetScoreIndexSchema{Enable: false})
+	assert.Nil(t, err)
+	_, err = db.ZsetScoreIndexSearch(table, []byte("a"), common.MinScore, common.MaxScore, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+}
+
+func TestZSetScoreIndexParallelView(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	table := []byte("test")
+	err := db.SetTableZsetScoreIndex(string(table), &common.ZsetScoreIndexSchema{Enable: true})
+	assert.Nil(t, err)
+
+	// the write batch views used by the parallel apply should update the index
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			view := db.NewWriteBatchView()
+			defer view.DestroyWriteBatchView()
+			for j := 0; j < 10; j++ {
+				key := []byte(fmt.Sprintf("test:zscore_view_%d_%d", i, j))
+				_, err := view.ZAdd(0, key, pair("a", float64(i*10+j)))
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	rets, err := db.ZsetScoreIndexSearch(table, []byte("a"), common.MinScore, common.MaxScore, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 40, len(rets))
+	for i, ret := range rets {
+		assert.Equal(t, float64(i), ret.Score)
+	}
+}
@@ -0,0 +1,92 @@
+package rockredis
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var errTableDumpCursor = errors.New("invalid table dump cursor")
+
+// ExportTable write at most count keys of the table to the dump from the cursor, the cursor is
+// the data type with the next key to export (empty to start from the beginning). The next
+// cursor will be returned which is nil if all the keys in the table are exported.
+func (db *RockDB) ExportTable(table string, cursor []byte, count int, w *common.TableDumpWriter) ([]byte, int, error) {
+	if count <= 0 {
+		count = 1
+	}
+	cnt := 0
+	next, err := db.ScanTableEntries(table, cursor, func(e *common.RDBEntry) (bool, error) {
+		if err := w.WriteEntry(e); err != nil {
+			return false, err
+		}
+		cnt++
+		return cnt < count, nil
+	})
+	if err != nil {
+		return nil, cnt, err
+	}
+	return next, cnt, nil
+}
+
+// ScanTableEntries scan the keys of the table with all the values from the cursor as the
+// ExportTable. The scan will be stopped if the callback return false, and the next cursor
+// will be returned which is nil if all the keys in the table are scanned.
+func (db *RockDB) ScanTableEntries(table string, cursor []byte, fn func(e *common.RDBEntry) (bool, error)) ([]byte, error) {
+	idx := 0
+	var start []byte
+	if len(cursor) > 0 {
+		idx = -1
+		for i, dt := range rdbExportTypes {
+			if dt == cursor[0] {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, errTableDumpCursor
+		}
+		start = cursor[1:]
+	}
+	stopped := false
+	for ; idx < len(rdbExportTypes); idx++ {
+		dt := rdbExportTypes[idx]
+		if stopped {
+			return []byte{dt}, nil
+		}
+		next, err := db.scanTableTypeEntries(dt, table, start, func(e *common.RDBEntry) (bool, error) {
+			goOn, err := fn(e)
+			if !goOn {
+				stopped = true
+			}
+			return goOn, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if next != nil {
+			return append([]byte{dt}, next...), nil
+		}
+		start = nil
+	}
+	return nil, nil
+}
+
+// GetKeyEntries return the entries of the key in the table for all the data types, the
+// key is the key without table. Empty will be returned if the key is not found.
+func (db *RockDB) GetKeyEntries(table string, key []byte) ([]*common.RDBEntry, error) {
+	var entries []*common.RDBEntry
+	for _, dt := range rdbExportTypes {
+		_, err := db.scanTableTypeEntries(dt, table, key, func(e *common.RDBEntry) (bool, error) {
+			if bytes.Equal(e.Key, key) {
+				entries = append(entries, e)
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+package rockredis
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+func TestExportTablePages(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	db.KVSet(0, []byte("test:kv1"), []byte("v1"))
+	db.KVSet(0, []byte("test:kv2"), []byte("v2"))
+	db.KVSet(0, []byte("other:kv1"), []byte("other"))
+	db.HMset(0, []byte("test:hash"), common.KVRecord{Key: []byte("f1"), Value: []byte("v1")})
+	db.RPush(0, []byte("test:list"), []byte("e1"), []byte("e2"))
+	db.SAdd(0, []byte("test:set"), []byte("m1"))
+	db.ZAdd(0, []byte("test:zset"), common.ScorePair{Score: 1, Member: []byte("m1")})
+
+	var buf bytes.Buffer
+	w, err := common.NewTableDumpWriter(&buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor []byte
+	total := 0
+	pages := 0
+	for {
+		next, cnt, err := db.ExportTable("test", cursor, 2, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cnt > 2 {
+			t.Errorf("exported more than the page size: %v", cnt)
+		}
+		total += cnt
+		pages++
+		if next == nil {
+			break
+		}
+		w.WriteCheckpoint(next)
+		cursor = next
+	}
+	w.Close(int64(total))
+	if total != 6 || pages != 3 {
+		t.Errorf("exported mismatch: %v, %v", total, pages)
+	}
+
+	r, err := common.NewTableDumpReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]common.DataType)
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := keys[string(e.Key)]; ok {
+			t.Errorf("key exported twice: %s", e.Key)
+		}
+		keys[string(e.Key)] = e.Type
+	}
+	if len(keys) != 6 || keys["list"] != common.LIST || keys["kv2"] != common.KV {
+		t.Errorf("keys mismatch: %v", keys)
+	}
+
+	if _, _, err := db.ExportTable("test", []byte{255}, 2, w); err != errTableDumpCursor {
+		t.Errorf("should be invalid cursor: %v", err)
+	}
+}
+
+func TestGetKeyEntries(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	db.KVSet(0, []byte("test:k1"), []byte("v1"))
+	db.HMset(0, []byte("test:k1"), common.KVRecord{Key: []byte("f1"), Value: []byte("v1")},
+		common.KVRecord{Key: []byte("f2"), Value: []byte("v2")})
+	db.KVSet(0, []byte("test:k2"), []byte("v2"))
+
+	entries, err := db.GetKeyEntries("test", []byte("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != common.KV || entries[1].Type != common.HASH {
+		t.Fatalf("entries mismatch: %v", entries)
+	}
+	if len(entries[1].Fields) != 2 {
+		t.Errorf("hash fields mismatch: %v", entries[1].Fields)
+	}
+	entries, err = db.GetKeyEntries("test", []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("should not found: %v", entries)
+	}
+}
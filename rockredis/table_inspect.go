@@ -0,0 +1,228 @@
+package rockredis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var errInspectRunning = errors.New("the table inspection is already running")
+
+// TableInspectStatus is the status of the last data inspection of the tables
+type TableInspectStatus struct {
+	Running     bool                                 `json:"running"`
+	StartTime   int64                                `json:"start_time"`
+	EndTime     int64                                `json:"end_time"`
+	ScannedKeys int64                                `json:"scanned_keys"`
+	Tables      map[string]*common.TableInspectStats `json:"tables"`
+	Err         string                               `json:"err,omitempty"`
+}
+
+// InspectTables scan the keys of the table (or all the tables if empty) and report the key
+// counts, the size and ttl distribution and the index sizes of each table.
+func (db *RockDB) InspectTables(table string) error {
+	var tables [][]byte
+	if table != "" {
+		if err := checkTableName([]byte(table)); err != nil {
+			return err
+		}
+		tables = append(tables, []byte(table))
+	} else {
+		tables = db.GetTables()
+	}
+	db.inspectMutex.Lock()
+	if db.inspectStatus.Running {
+		db.inspectMutex.Unlock()
+		return errInspectRunning
+	}
+	db.inspectStatus = TableInspectStatus{
+		Running:   true,
+		StartTime: time.Now().Unix(),
+		Tables:    make(map[string]*common.TableInspectStats, len(tables)),
+	}
+	db.inspectMutex.Unlock()
+
+	var err error
+	for _, t := range tables {
+		if err = db.inspectTable(t); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = db.inspectTTL()
+	}
+	db.inspectMutex.Lock()
+	db.inspectStatus.Running = false
+	db.inspectStatus.EndTime = time.Now().Unix()
+	if err != nil {
+		db.inspectStatus.Err = err.Error()
+	}
+	db.inspectMutex.Unlock()
+	if err != nil {
+		dbLog.Infof("table inspection failed: %v", err)
+		return err
+	}
+	dbLog.Infof("table inspection done for %v tables", len(tables))
+	return nil
+}
+
+func (db *RockDB) inspectTable(table []byte) error {
+	st := common.NewTableInspectStats(string(table))
+	db.inspectMutex.Lock()
+	db.inspectStatus.Tables[string(table)] = st
+	db.inspectMutex.Unlock()
+
+	metaTypes := []struct {
+		metaType byte
+		dataType byte
+		decode   func([]byte) ([]byte, error)
+	}{
+		{KVType, KVType, decodeKVKey},
+		{HSizeType, HashType, hDecodeSizeKey},
+		{LMetaType, ListType, lDecodeMetaKey},
+		{SSizeType, SetType, sDecodeSizeKey},
+		{ZSizeType, ZSetType, zDecodeSizeKey},
+	}
+	for _, mt := range metaTypes {
+		minMetaKey, maxMetaKey, err := getTableMetaRange(mt.metaType, table, nil, nil)
+		if err != nil {
+			return err
+		}
+		err = db.inspectKeysInRange(st, minMetaKey, maxMetaKey, mt.dataType, mt.decode)
+		if err != nil {
+			return err
+		}
+	}
+	jStart, err := encodeJSONStartKey(table)
+	if err != nil {
+		return err
+	}
+	decodeJSON := func(ek []byte) ([]byte, error) {
+		t, rk, err := decodeJSONKey(ek)
+		if err != nil {
+			return nil, err
+		}
+		return packRedisKey(t, rk), nil
+	}
+	err = db.inspectKeysInRange(st, jStart, encodeJSONStopKey(table, nil), JSONType, decodeJSON)
+	if err != nil {
+		return err
+	}
+
+	indexRanges := []struct {
+		name  string
+		start []byte
+		stop  []byte
+	}{
+		{"hash_index", encodeHsetIndexTableStartKey(table), encodeHsetIndexTableStopKey(table)},
+		{"zset_score_index", encodeZsetIndexTableStartKey(table), encodeZsetIndexTableStopKey(table)},
+		{"fulltext_index", encodeFullTextIndexTableStartKey(table), encodeFullTextIndexTableStopKey(table)},
+	}
+	for _, ir := range indexRanges {
+		size, cnt, err := db.rangeUsage(ir.start, ir.stop, common.RangeROpen, nil)
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			continue
+		}
+		db.inspectMutex.Lock()
+		st.IndexSize[ir.name] = size
+		st.IndexKeys[ir.name] = cnt
+		db.inspectMutex.Unlock()
+	}
+	return nil
+}
+
+func (db *RockDB) inspectKeysInRange(st *common.TableInspectStats, start []byte, stop []byte, dataType byte,
+	decode func([]byte) ([]byte, error)) error {
+	it, err := NewDBIterator(db.eng, true, false, start, stop, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	var scanned int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key, err := decode(it.Key())
+		if err != nil {
+			continue
+		}
+		size, elems, err := db.keyUsage(dataType, key)
+		if err != nil {
+			return err
+		}
+		scanned++
+		db.inspectMutex.Lock()
+		db.inspectStatus.ScannedKeys++
+		st.Keys[TypeName[dataType]]++
+		st.TotalKeys++
+		st.KeySize.Add(size)
+		if dataType != KVType && dataType != JSONType {
+			st.Elements.Add(elems)
+		}
+		db.inspectMutex.Unlock()
+		if scanned%1000 == 0 {
+			select {
+			case <-db.quit:
+				return common.ErrStopped
+			default:
+			}
+		}
+	}
+	return it.Err()
+}
+
+// the ttl of all the keys are stored in the expire time keys, so all the tables can be
+// counted in one scan.
+func (db *RockDB) inspectTTL() error {
+	it, err := NewDBRangeIterator(db.eng, []byte{ExpTimeType}, []byte{ExpTimeType + 1}, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	now := time.Now().Unix()
+	var scanned int64
+	for ; it.Valid(); it.Next() {
+		_, key, when, err := expDecodeTimeKey(it.RefKey())
+		if err != nil {
+			continue
+		}
+		table, _, err := extractTableFromRedisKey(key)
+		if err != nil {
+			continue
+		}
+		ttl := when - now
+		if ttl < 0 {
+			ttl = 0
+		}
+		db.inspectMutex.Lock()
+		if st, ok := db.inspectStatus.Tables[string(table)]; ok {
+			st.TTL.Add(ttl)
+		}
+		db.inspectMutex.Unlock()
+		scanned++
+		if scanned%1000 == 0 {
+			select {
+			case <-db.quit:
+				return common.ErrStopped
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// GetTableInspectStatus return the copy of the last inspection status
+func (db *RockDB) GetTableInspectStatus() TableInspectStatus {
+	db.inspectMutex.Lock()
+	defer db.inspectMutex.Unlock()
+	st := db.inspectStatus
+	st.Tables = make(map[string]*common.TableInspectStats, len(db.inspectStatus.Tables))
+	for name, ts := range db.inspectStatus.Tables {
+		cp := common.NewTableInspectStats(name)
+		cp.Merge(ts)
+		st.Tables[name] = cp
+	}
+	return st
+}
@@ -0,0 +1,138 @@
+package rockredis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+)
+
+var errTableCounterDisabled = errors.New("the table counter is disabled")
+
+// RecountStatus is the status of the last recount for the table key counter
+type RecountStatus struct {
+	Table     string `json:"table"`
+	OldCount  int64  `json:"old_count"`
+	NewCount  int64  `json:"new_count"`
+	Running   bool   `json:"running"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Err       string `json:"err,omitempty"`
+}
+
+// the key ranges of the table which should be counted in the table counter,
+// the collections are counted by the meta keys.
+func getTableCounterRanges(table []byte) ([]engine.CRange, error) {
+	dtsMeta := []byte{KVType, HSizeType, LMetaType, SSizeType, ZSizeType}
+	rgs := make([]engine.CRange, 0, len(dtsMeta)+1)
+	for _, dt := range dtsMeta {
+		minMetaKey, maxMetaKey, err := getTableMetaRange(dt, table, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		rgs = append(rgs, engine.CRange{Start: minMetaKey, Limit: maxMetaKey})
+	}
+	jStart, err := encodeJSONStartKey(table)
+	if err != nil {
+		return nil, err
+	}
+	rgs = append(rgs, engine.CRange{Start: jStart, Limit: encodeJSONStopKey(table, nil)})
+	return rgs, nil
+}
+
+// RecountTableKeys count all the keys of the table and fix the table counter.
+// The difference between the counted keys and the counter is merged into the counter.
+// It should be called in the raft apply loop, so no write is applied while counting and all
+// the replicas will merge the same difference at the same raft index.
+func (db *RockDB) RecountTableKeys(table string) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	if !db.cfg.EnableTableCounter {
+		return errTableCounterDisabled
+	}
+	rgs, err := getTableCounterRanges([]byte(table))
+	if err != nil {
+		return err
+	}
+	db.recountMutex.Lock()
+	if db.recountStatus.Running {
+		db.recountMutex.Unlock()
+		return errRecountRunning
+	}
+	db.recountStatus = RecountStatus{
+		Table:     table,
+		Running:   true,
+		StartTime: time.Now().Unix(),
+	}
+	db.recountMutex.Unlock()
+
+	oldCnt, newCnt, err := db.recountTableKeys([]byte(table), rgs)
+	db.recountMutex.Lock()
+	db.recountStatus.Running = false
+	db.recountStatus.EndTime = time.Now().Unix()
+	db.recountStatus.OldCount = oldCnt
+	db.recountStatus.NewCount = newCnt
+	if err != nil {
+		db.recountStatus.Err = err.Error()
+	}
+	db.recountMutex.Unlock()
+	if err != nil {
+		dbLog.Infof("table %v recount failed: %v", table, err)
+		return err
+	}
+	dbLog.Infof("table %v recount done, counter changed from %v to %v", table, oldCnt, newCnt)
+	return nil
+}
+
+func (db *RockDB) recountTableKeys(table []byte, rgs []engine.CRange) (int64, int64, error) {
+	tm := encodeTableMetaKey(table)
+	oldCnt, err := GetRocksdbUint64(db.eng.GetBytes(tm))
+	if err != nil {
+		return 0, 0, err
+	}
+	var cnt int64
+	for _, rg := range rgs {
+		n, err := db.countKeysInRange(rg)
+		cnt += n
+		if err != nil {
+			return int64(oldCnt), cnt, err
+		}
+	}
+	delta := cnt - int64(oldCnt)
+	if delta == 0 {
+		return int64(oldCnt), cnt, nil
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Merge(tm, PutRocksdbUint64(uint64(delta)))
+	err = db.eng.Write(wb)
+	return int64(oldCnt), cnt, err
+}
+
+func (db *RockDB) countKeysInRange(rg engine.CRange) (int64, error) {
+	it, err := NewDBIterator(db.eng, true, false, rg.Start, rg.Limit, false)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var cnt int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		cnt++
+		if cnt%10000 == 0 {
+			select {
+			case <-db.quit:
+				return cnt, common.ErrStopped
+			default:
+			}
+		}
+	}
+	return cnt, it.Err()
+}
+
+func (db *RockDB) GetRecountStatus() RecountStatus {
+	db.recountMutex.Lock()
+	defer db.recountMutex.Unlock()
+	return db.recountStatus
+}
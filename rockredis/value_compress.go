@@ -0,0 +1,208 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+const (
+	valueCompressNone byte = 0
+	valueCompressZstd byte = 1
+)
+
+// the values smaller than this will not be compressed if the min size is not configured
+const defaultValueCompressMinSize = 1024
+
+// The highest bit of the timestamp in the kv value marks the value is compressed, and the
+// compressed value is [compress type][compressed data][timestamp with flag].
+// Since the timestamp is always positive, the old values written without
+// compression can be read as before.
+const valueCompressedFlag = uint64(1) << 63
+
+var errUnknownValueCompress = errors.New("unknown value compression")
+
+var valueCompressPrefix = []byte("vcompress" + string(metaSep))
+
+type tableValueCompress struct {
+	compressType byte
+	minSize      int
+}
+
+func encodeValueCompressKey(table []byte) []byte {
+	tk := make([]byte, 1+len(valueCompressPrefix)+len(table))
+	pos := 0
+	tk[pos] = TableMetaType
+	pos++
+	copy(tk[pos:], valueCompressPrefix)
+	pos += len(valueCompressPrefix)
+	copy(tk[pos:], table)
+	return tk
+}
+
+func decodeValueCompressKey(tk []byte) ([]byte, error) {
+	pos := 0
+	if len(tk) < pos+1+len(valueCompressPrefix) || tk[pos] != TableMetaType {
+		return nil, errTableMetaKey
+	}
+	pos++
+	pos += len(valueCompressPrefix)
+	return tk[pos:], nil
+}
+
+func parseValueCompress(s *common.ValueCompressSchema) (tableValueCompress, error) {
+	var c tableValueCompress
+	switch s.Compression {
+	case "no":
+		c.compressType = valueCompressNone
+	case "zstd":
+		c.compressType = valueCompressZstd
+	default:
+		return c, errUnknownValueCompress
+	}
+	c.minSize = s.MinValueSize
+	if c.minSize == 0 {
+		c.minSize = defaultValueCompressMinSize
+	}
+	return c, nil
+}
+
+// SetTableValueCompress change the value compression of the table, only the values written
+// after the change will be affected.
+func (db *RockDB) SetTableValueCompress(table string, s *common.ValueCompressSchema) error {
+	if err := checkTableName([]byte(table)); err != nil {
+		return err
+	}
+	if err := s.CheckValid(); err != nil {
+		return err
+	}
+	c, err := parseValueCompress(s)
+	if err != nil {
+		return err
+	}
+	wb := db.eng.NewWriteBatch()
+	defer wb.Destroy()
+	if c.compressType == valueCompressNone {
+		wb.Delete(encodeValueCompressKey([]byte(table)))
+	} else {
+		d, _ := json.Marshal(s)
+		wb.Put(encodeValueCompressKey([]byte(table)), d)
+	}
+	err = db.eng.Write(wb)
+	if err != nil {
+		return err
+	}
+	db.compressMutex.Lock()
+	if c.compressType == valueCompressNone {
+		delete(db.valueCompress, table)
+	} else {
+		db.valueCompress[table] = c
+	}
+	db.compressMutex.Unlock()
+	dbLog.Infof("table %v value compression changed to: %v", table, s)
+	return nil
+}
+
+// GetTableValueCompress return the value compression of the table, nil if not compressed
+func (db *RockDB) GetTableValueCompress(table string) (*common.ValueCompressSchema, error) {
+	v, err := db.eng.GetBytes(encodeValueCompressKey([]byte(table)))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	var s common.ValueCompressSchema
+	err = json.Unmarshal(v, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (db *RockDB) loadTableValueCompress() error {
+	s := encodeValueCompressKey(nil)
+	e := encodeValueCompressKey(nil)
+	e[len(e)-1] = e[len(e)-1] + 1
+	it, err := NewDBRangeIterator(db.eng, s, e, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	tables := make(map[string]tableValueCompress)
+	for ; it.Valid(); it.Next() {
+		table, err := decodeValueCompressKey(it.Key())
+		if err != nil {
+			continue
+		}
+		var s common.ValueCompressSchema
+		err = json.Unmarshal(it.Value(), &s)
+		if err != nil {
+			dbLog.Infof("table %v value compression invalid: %v", string(table), err)
+			continue
+		}
+		c, err := parseValueCompress(&s)
+		if err != nil {
+			dbLog.Infof("table %v value compression invalid: %v", string(table), err)
+			continue
+		}
+		tables[string(table)] = c
+	}
+	db.compressMutex.Lock()
+	db.valueCompress = tables
+	db.compressMutex.Unlock()
+	return nil
+}
+
+func (db *RockDB) getValueCompress(table []byte) (tableValueCompress, bool) {
+	db.compressMutex.RLock()
+	c, ok := db.valueCompress[string(table)]
+	db.compressMutex.RUnlock()
+	return c, ok
+}
+
+// encode the kv value with the timestamp, the value will be compressed if the
+// table value compression is enabled and the value is large enough.
+func (db *RockDB) encodeKVValue(table []byte, value []byte, ts int64) []byte {
+	c, ok := db.getValueCompress(table)
+	if ok && c.compressType != valueCompressNone && len(value) >= c.minSize {
+		var cv []byte
+		var err error
+		switch c.compressType {
+		case valueCompressZstd:
+			cv, err = zstdCompress(value)
+		default:
+			err = errUnknownValueCompress
+		}
+		if err != nil {
+			dbLog.Debugf("value compress failed: %v", err)
+		} else if len(cv)+1 < len(value) {
+			buf := make([]byte, 0, 1+len(cv)+tsLen)
+			buf = append(buf, c.compressType)
+			buf = append(buf, cv...)
+			return append(buf, PutInt64(int64(uint64(ts)|valueCompressedFlag))...)
+		}
+	}
+	return append(value, PutInt64(ts)...)
+}
+
+// decode the kv value stored in db, the timestamp will be removed and the
+// compressed value will be decompressed.
+func decodeKVValue(v []byte) ([]byte, error) {
+	if len(v) < tsLen {
+		return v, nil
+	}
+	ts := binary.BigEndian.Uint64(v[len(v)-tsLen:])
+	v = v[:len(v)-tsLen]
+	if ts&valueCompressedFlag == 0 {
+		return v, nil
+	}
+	if len(v) < 1 {
+		return nil, errInvalidDBValue
+	}
+	switch v[0] {
+	case valueCompressZstd:
+		return zstdDecompress(v[1:])
+	default:
+		return nil, errUnknownValueCompress
+	}
+}
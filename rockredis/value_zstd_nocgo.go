@@ -0,0 +1,18 @@
+// +build !cgo
+
+package rockredis
+
+import (
+	"errors"
+)
+
+// the zstd library need the cgo
+var errZstdNotSupported = errors.New("zstd compress is not supported without cgo")
+
+func zstdCompress(data []byte) ([]byte, error) {
+	return nil, errZstdNotSupported
+}
+
+func zstdDecompress(data []byte) ([]byte, error) {
+	return nil, errZstdNotSupported
+}
@@ -0,0 +1,164 @@
+package rockredis
+
+import (
+	"errors"
+	"hash/fnv"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+)
+
+var errInvalidBucketNum = errors.New("invalid checksum bucket number")
+
+// check whether the db is closing after walked this number of records
+const checksumQuitCheckInterval = 1024
+
+// the data key and the record checksum, the checksum of the record is the hash of the
+// raw key and value (timestamp removed), so it is the same if two clusters have the same data.
+type checksumWalkFunc func(key []byte, sum uint64)
+
+func getChecksumBucket(key []byte, bucketNum int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(bucketNum))
+}
+
+func decodeDataKey(dt byte, ek []byte) ([]byte, error) {
+	switch dt {
+	case KVType:
+		k, err := decodeKVKey(ek)
+		if err != nil {
+			return nil, err
+		}
+		_, rk, err := common.ExtractTable(k)
+		return rk, err
+	case HashType:
+		_, rk, _, err := hDecodeHashKey(ek)
+		return rk, err
+	case ListType:
+		_, rk, _, err := lDecodeListKey(ek)
+		return rk, err
+	case SetType:
+		_, rk, _, err := sDecodeSetKey(ek)
+		return rk, err
+	case ZSetType:
+		_, rk, _, err := zDecodeSetKey(ek)
+		return rk, err
+	}
+	return nil, errDataType
+}
+
+// all the data types of the table will be walked on the same snapshot
+func (db *RockDB) walkTableData(snap engine.Snapshot, table string, fn checksumWalkFunc) error {
+	dts := []byte{KVType, HashType, ListType, SetType, ZSetType}
+	for _, dt := range dts {
+		rgs, err := getTableDataRange(dt, []byte(table), nil, nil)
+		if err != nil {
+			return err
+		}
+		// the zset score data is the same as the zset member data, so we only check the first range
+		it, err := NewDBRangeLimitIteratorWithOpts(db.eng, engine.IteratorOpts{Snapshot: snap},
+			rgs[0].Start, rgs[0].Limit, common.RangeROpen, 0, -1, false)
+		if err != nil {
+			return err
+		}
+		for cnt := 0; it.Valid(); it.Next() {
+			cnt++
+			if cnt%checksumQuitCheckInterval == 0 {
+				select {
+				case <-db.quit:
+					it.Close()
+					return common.ErrStopped
+				default:
+				}
+			}
+			ek := it.RefKey()
+			rk, err := decodeDataKey(dt, ek)
+			if err != nil {
+				dbLog.Infof("decode data key %v failed while walking table %v: %v", ek, table, err)
+				continue
+			}
+			v := it.RefValue()
+			if (dt == KVType || dt == HashType) && len(v) >= tsLen {
+				v = v[:len(v)-tsLen]
+			}
+			h := fnv.New64a()
+			h.Write([]byte{dt})
+			h.Write(ek)
+			h.Write(v)
+			fn(rk, h.Sum64())
+		}
+		it.Close()
+	}
+	return nil
+}
+
+// GetTableChecksum compute the checksum of each bucket in the table, the checksum in bucket is
+// xor of all the records, so it is independent on the order of the records.
+func (db *RockDB) GetTableChecksum(table string, bucketNum int) (*common.TableChecksum, error) {
+	if bucketNum <= 0 {
+		return nil, errInvalidBucketNum
+	}
+	snap, err := db.eng.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	return db.computeTableChecksum(snap, table, bucketNum)
+}
+
+// GetTableChecksumAsync take the snapshot of the db immediately and compute the table checksum
+// on the snapshot in background, so the checksum is at the raft index applied while calling.
+// The done will be called with the result after finished.
+func (db *RockDB) GetTableChecksumAsync(table string, bucketNum int, done func(*common.TableChecksum, error)) error {
+	if bucketNum <= 0 {
+		return errInvalidBucketNum
+	}
+	snap, err := db.eng.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer snap.Release()
+		done(db.computeTableChecksum(snap, table, bucketNum))
+	}()
+	return nil
+}
+
+func (db *RockDB) computeTableChecksum(snap engine.Snapshot, table string, bucketNum int) (*common.TableChecksum, error) {
+	tc := &common.TableChecksum{
+		Table:   table,
+		Buckets: make([]uint64, bucketNum),
+	}
+	err := db.walkTableData(snap, table, func(key []byte, sum uint64) {
+		tc.RecordNum++
+		tc.Buckets[getChecksumBucket(key, bucketNum)] ^= sum
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// GetTableBucketKeysChecksum return the checksum of each key in the bucket of the table
+func (db *RockDB) GetTableBucketKeysChecksum(table string, bucketNum int, bucket int) (map[string]uint64, error) {
+	if bucketNum <= 0 || bucket < 0 || bucket >= bucketNum {
+		return nil, errInvalidBucketNum
+	}
+	snap, err := db.eng.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	keys := make(map[string]uint64)
+	err = db.walkTableData(snap, table, func(key []byte, sum uint64) {
+		if getChecksumBucket(key, bucketNum) != bucket {
+			return
+		}
+		keys[string(key)] ^= sum
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,115 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+func TestTableChecksum(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	db2 := getTestDB(t)
+	defer os.RemoveAll(db2.cfg.DataDir)
+	defer db2.Close()
+
+	for i, d := range []*RockDB{db, db2} {
+		// the timestamp should not be included in checksum
+		ts := time.Now().UnixNano() + int64(i)
+		if err := d.KVSet(ts, []byte("test:checksum_kv"), []byte("v1")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.HSet(ts, false, []byte("test:checksum_hash"), []byte("f1"), []byte("v1")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.SAdd(ts, []byte("test:checksum_set"), []byte("m1"), []byte("m2")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tc1, err := db.GetTableChecksum("test", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc2, err := db2.GetTableChecksum("test", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc1.RecordNum != 4 || tc1.RecordNum != tc2.RecordNum {
+		t.Fatalf("record num not as expected: %v, %v", tc1.RecordNum, tc2.RecordNum)
+	}
+	for i := range tc1.Buckets {
+		if tc1.Buckets[i] != tc2.Buckets[i] {
+			t.Fatalf("bucket %v checksum mismatch: %v, %v", i, tc1.Buckets[i], tc2.Buckets[i])
+		}
+	}
+
+	if _, err := db2.HSet(0, false, []byte("test:checksum_hash"), []byte("f1"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	tc2, err = db2.GetTableChecksum("test", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := getChecksumBucket([]byte("checksum_hash"), 16)
+	for i := range tc1.Buckets {
+		if i == bucket && tc1.Buckets[i] == tc2.Buckets[i] {
+			t.Fatalf("bucket %v checksum should mismatch", i)
+		} else if i != bucket && tc1.Buckets[i] != tc2.Buckets[i] {
+			t.Fatalf("bucket %v checksum mismatch: %v, %v", i, tc1.Buckets[i], tc2.Buckets[i])
+		}
+	}
+	keys1, err := db.GetTableBucketKeysChecksum("test", 16, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys2, err := db2.GetTableBucketKeysChecksum("test", 16, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys1["checksum_hash"] == keys2["checksum_hash"] {
+		t.Errorf("key checksum should mismatch: %v, %v", keys1, keys2)
+	}
+	if len(keys1) != len(keys2) {
+		t.Errorf("keys in bucket mismatch: %v, %v", keys1, keys2)
+	}
+}
+
+func TestTableChecksumAsync(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	if err := db.KVSet(0, []byte("test:checksum_kv"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := db.GetTableChecksum("test", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *common.TableChecksum, 1)
+	err = db.GetTableChecksumAsync("test", 16, func(tc *common.TableChecksum, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		done <- tc
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the write after the async checksum started should not be included
+	if err := db.KVSet(0, []byte("test:checksum_kv2"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	tc := <-done
+	if tc == nil || tc.RecordNum != expected.RecordNum {
+		t.Fatalf("async checksum mismatch: %v, %v", tc, expected)
+	}
+	for i := range tc.Buckets {
+		if tc.Buckets[i] != expected.Buckets[i] {
+			t.Fatalf("bucket %v checksum mismatch: %v, %v", i, tc.Buckets[i], expected.Buckets[i])
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
-	"github.com/absolute8511/ZanRedisDB/rockredis"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/engine"
+	"github.com/absolute8511/ZanRedisDB/node"
 )
 
 type ServerConfig struct {
@@ -16,6 +18,7 @@ type ServerConfig struct {
 	GrpcAPIPort          int               `json:"grpc_api_port"`
 	ProfilePort          int               `json:"profile_port"`
 	DataDir              string            `json:"data_dir"`
+	WALDir               string            `json:"wal_dir"`
 	DataRsyncModule      string            `json:"data_rsync_module"`
 	LocalRaftAddr        string            `json:"local_raft_addr"`
 	Tags                 map[string]string `json:"tags"`
@@ -24,11 +27,105 @@ type ServerConfig struct {
 	LearnerRole          string            `json:"learner_role"`
 	RemoteSyncCluster    string            `json:"remote_sync_cluster"`
 	StateMachineType     string            `json:"state_machine_type"`
+	// the number of workers to apply the raft logs concurrently for different keys,
+	// 0 means apply serially
+	ApplyWorkerNum int `json:"apply_worker_num"`
+	// enable the active-active sync between two clusters, the write from the remote
+	// cluster will be ignored if the key is modified by a newer write in local cluster
+	ActiveActiveSync bool `json:"active_active_sync"`
+	// the kafka brokers (separated by comma) used by the kafka sink learner role
+	KafkaBrokers     string `json:"kafka_brokers"`
+	KafkaTopicPrefix string `json:"kafka_topic_prefix"`
+	// only sync the writes in the include tables (empty means all the tables) and
+	// ignore the writes in exclude tables or commands to the remote cluster
+	SyncerIncludeTables []string `json:"syncer_include_tables"`
+	SyncerExcludeTables []string `json:"syncer_exclude_tables"`
+	SyncerExcludeCmds   []string `json:"syncer_exclude_cmds"`
+	// rewrite the namespace or table names and redact the values for the tables while syncing,
+	// the transformers registered by name or loaded from go plugin will be applied after the rules.
+	SyncerNamespaceMapping map[string]string `json:"syncer_namespace_mapping"`
+	SyncerTableMapping     map[string]string `json:"syncer_table_mapping"`
+	SyncerRedactTables     []string          `json:"syncer_redact_tables"`
+	SyncerRedactKey        string            `json:"syncer_redact_key"`
+	SyncerTransformers     []string          `json:"syncer_transformers"`
+	SyncerTransformPlugin  string            `json:"syncer_transform_plugin"`
+	// transfer the backup first and then sync the raft logs after the backup if
+	// the remote cluster is empty
+	SyncerInitFromSnapshot bool `json:"syncer_init_from_snapshot"`
+	// snappy or zstd, compress the raft logs to reduce the cross-DC traffic. The logs are
+	// sent without compression if the remote cluster is the old version not supported it.
+	SyncerCompressType string `json:"syncer_compress_type"`
+	// limit the bytes per second sent by the log syncer for each partition, 0 for no limit
+	SyncerMaxBandwidth int64 `json:"syncer_max_bandwidth"`
+	// more remote clusters to sync besides the remote_sync_cluster, a slow one
+	// will not block the others and will be full synced from backup if fall behind too much
+	RemoteSyncClusters []string `json:"remote_sync_clusters"`
+	// transfer the snapshot by the rsync daemon instead of the native http api, only needed
+	// while upgrading from the old version which has no native snapshot api
+	SnapshotSyncByRsync bool `json:"snapshot_sync_by_rsync"`
+	// the max concurrent snapshot files sent from this node to the recovering replicas
+	SnapshotMaxOutgoing int `json:"snapshot_max_outgoing"`
+	// the max bytes per second for all the snapshot files sent from this node, 0 for no limit
+	SnapshotMaxBandwidth int64 `json:"snapshot_max_bandwidth"`
+	// the max bytes per second for all the snapshot files received by this node, 0 for the default 25MB
+	SnapshotMaxRecvBandwidth int64 `json:"snapshot_max_recv_bandwidth"`
+	// the key file for encrypting the checkpoint files at rest and in transit, each line
+	// is "id:hex-key" and the last one is used for the new checkpoints. All the replicas
+	// (and the remote clusters applying the snapshot) should have the same keys.
+	SnapshotEncryptKeyFile string `json:"snapshot_encrypt_key_file"`
+	// upload the backups of the leader to the external storage (local dir or s3 compatible)
+	BackupTarget common.BackupTargetConfig `json:"backup_target"`
+	// record all the applied writes into the audit log file, the file will be rotated
+	// while the size exceeds the max size (default 100MB) and the recent backups are kept.
+	AuditLogFile       string `json:"audit_log_file"`
+	AuditLogMaxSizeMB  int64  `json:"audit_log_max_size_mb"`
+	AuditLogMaxBackups int    `json:"audit_log_max_backups"`
+	// the external audit sink used instead of the audit log file
+	AuditSink node.AuditSink `json:"-"`
+	// replay the raft logs in the repair mode, the entries which can not be decoded or applied
+	// will be reported in raft_repair_report.json under the partition data dir. The reported
+	// entry will be skipped if its ack key is added to the skip entries by the operator.
+	RaftRepairMode        bool     `json:"raft_repair_mode"`
+	RaftRepairSkipEntries []string `json:"raft_repair_skip_entries"`
+	// the write backpressure for each partition, the new write will wait for at most
+	// backpressure_wait_ms and then be rejected if the committed logs waiting to be applied
+	// exceed max_apply_backlog or the pending proposals exceed max_pending_proposals.
+	// 0 means the default value and negative means no limit.
+	MaxApplyBacklog     int64 `json:"max_apply_backlog"`
+	MaxPendingProposals int64 `json:"max_pending_proposals"`
+	BackpressureWaitMs  int   `json:"backpressure_wait_ms"`
+	// the initial token bucket limits for the writes to the namespaces or tables on this
+	// node, can be changed by the http api /ratelimit/write while running.
+	WriteRateLimits []WriteRateLimit `json:"write_rate_limits"`
+	// the bound of the stale read while running as the read only replica (learner_role is role_read_replica),
+	// the read will be rejected if the committed logs waiting to be applied exceed read_replica_max_lag or
+	// no message received from leader in read_replica_max_stale_ms. 0 means no limit.
+	ReadReplicaMaxLag     uint64 `json:"read_replica_max_lag"`
+	ReadReplicaMaxStaleMs int64  `json:"read_replica_max_stale_ms"`
+	// compress the raft log entries not smaller than raft_log_compress_min_bytes (default 4096)
+	// by snappy or zstd before they enter the wal and replicated to the followers. All the
+	// replicas should be upgraded before enabled since the old version can not decode them.
+	RaftLogCompressType     string `json:"raft_log_compress_type"`
+	RaftLogCompressMinBytes int    `json:"raft_log_compress_min_bytes"`
+	// the max bytes of the raft append messages queued for each peer, the appends to the
+	// slow peer will be dropped above this and retried by raft later.
+	// 0 means the default 256MB and negative means no limit.
+	RaftMaxPeerPendingBytes int64 `json:"raft_max_peer_pending_bytes"`
+	// handle the wal fsyncs of all the partitions in batches by one syncer on the node,
+	// the duplicated fsyncs on the same wal file will be merged.
+	WALBatchSync bool `json:"wal_batch_sync"`
+	// the max keys migrated per second by each partition while expanding the partition
+	// number of the namespace online, 0 means the default 1000.
+	ReshardKeysPerSec int `json:"reshard_keys_per_sec"`
+	// the tls files to access the etcd cluster, the tls is disabled if empty
+	EtcdCertFile   string `json:"etcd_cert_file"`
+	EtcdKeyFile    string `json:"etcd_key_file"`
+	EtcdCACertFile string `json:"etcd_ca_cert_file"`
 
 	ElectionTick int `json:"election_tick"`
 	TickMs       int `json:"tick_ms"`
 	// default rocksdb options, can be override by namespace config
-	RocksDBOpts rockredis.RockOptions `json:"rocksdb_opts"`
+	RocksDBOpts engine.RockOptions    `json:"rocksdb_opts"`
 	Namespaces  []NamespaceNodeConfig `json:"namespaces"`
 	MaxScanJob  int32                 `json:"max_scan_job"`
 }
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/node"
+	"github.com/absolute8511/redcon"
+)
+
+// the confirm token should be used to flush in this duration after issued
+const flushConfirmTimeout = time.Minute
+
+var errFlushConfirmInvalid = errors.New("ERR invalid or expired flush confirm token")
+
+type flushConfirm struct {
+	target string
+	expire time.Time
+}
+
+// flushConfirmTokens is the safety interlock for the flush commands, the data will be
+// flushed only if the token issued for the same flush target is confirmed in time, so
+// a mistyped or replayed command can not drop the data directly. The token can be
+// used only once.
+type flushConfirmTokens struct {
+	sync.Mutex
+	tokens map[string]flushConfirm
+}
+
+func (ft *flushConfirmTokens) issue(target string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	ft.Lock()
+	defer ft.Unlock()
+	for t, fc := range ft.tokens {
+		if now.After(fc.expire) {
+			delete(ft.tokens, t)
+		}
+	}
+	if ft.tokens == nil {
+		ft.tokens = make(map[string]flushConfirm)
+	}
+	ft.tokens[token] = flushConfirm{target: target, expire: now.Add(flushConfirmTimeout)}
+	return token, nil
+}
+
+func (ft *flushConfirmTokens) confirm(token string, target string) bool {
+	ft.Lock()
+	defer ft.Unlock()
+	fc, ok := ft.tokens[token]
+	if !ok || fc.target != target {
+		return false
+	}
+	delete(ft.tokens, token)
+	return !time.Now().After(fc.expire)
+}
+
+// FLUSHTABLE namespace table [token]
+// FLUSHNS namespace [token]
+// without the token, a confirm token will be returned and nothing is flushed, the same
+// command with the token should be sent again in one minute to flush the data. The delete
+// is proposed through raft for each partition of the namespace on this node, so all
+// the replicas of the partition are cleared together. The tables with the secondary index
+// can not be flushed.
+func (s *Server) doFlushCommand(conn redcon.Conn, cmd redcon.Command, flushNamespace bool) {
+	argNum := 3
+	if flushNamespace {
+		argNum = 2
+	}
+	if len(cmd.Args) != argNum && len(cmd.Args) != argNum+1 {
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
+		return
+	}
+	if node.IsSyncerOnly() {
+		conn.WriteError("The cluster is only allowing syncer write : ERR handle command " + string(cmd.Args[0]))
+		return
+	}
+	ns := string(cmd.Args[1])
+	tables, err := s.nsMgr.GetTables(ns)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	target := "flushns:" + ns
+	if !flushNamespace {
+		target = "flushtable:" + ns + ":" + string(cmd.Args[2])
+		tables = []string{string(cmd.Args[2])}
+	}
+	// all the tables should be validated before flushing any of them, so the namespace will
+	// not be flushed partially.
+	for _, t := range tables {
+		if err := s.nsMgr.CheckDeleteRange(ns, t); err != nil {
+			conn.WriteError("ERR the table " + t + " can not be flushed: " + err.Error())
+			return
+		}
+	}
+	if len(cmd.Args) == argNum {
+		token, err := s.flushTokens.issue(target)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteBulkString(token)
+		return
+	}
+	if !s.flushTokens.confirm(string(cmd.Args[argNum]), target) {
+		conn.WriteError(errFlushConfirmInvalid.Error())
+		return
+	}
+	for _, t := range tables {
+		sLog.Infof("flushing the table %v of namespace %v", t, ns)
+		err := s.nsMgr.DeleteRange(ns, node.DeleteTableRange{Table: t, DeleteAll: true})
+		if err != nil {
+			sLog.Infof("flush table %v of namespace %v failed: %v", t, ns, err)
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	conn.WriteString("OK")
+}
@@ -10,6 +10,7 @@ import (
 	context "golang.org/x/net/context"
 
 	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/node"
 	"github.com/absolute8511/ZanRedisDB/syncerpb"
 	"google.golang.org/grpc"
 )
@@ -41,6 +42,7 @@ func (s *Server) GetSyncedRaft(ctx context.Context, req *syncerpb.SyncedRaftReq)
 	rsp.Term = term
 	rsp.Index = index
 	rsp.Timestamp = ts
+	rsp.CompressTypes = node.SupportedSyncerCompressTypes()
 	return &rsp, nil
 }
 
@@ -71,7 +73,14 @@ func (s *Server) ApplyRaftReqs(ctx context.Context, reqs *syncerpb.RaftReqs) (*s
 		logStart := r.RaftTimestamp
 		syncNetLatency := receivedTs.UnixNano() - logStart
 		syncClusterNetStats.UpdateLatencyStats(syncNetLatency / time.Microsecond.Nanoseconds())
-		err := kv.Node.ProposeRawAndWait(r.Data, r.Term, r.Index, r.RaftTimestamp)
+		data, err := node.DecompressRaftLogData(r.CompressType, r.Data)
+		if err != nil {
+			sLog.Infof("decompress raft log failed: %v, err: %v", r.String(), err.Error())
+			rpcErr.ErrCode = http.StatusBadRequest
+			rpcErr.ErrMsg = err.Error()
+			return &rpcErr, nil
+		}
+		err = kv.Node.ProposeRawAndWait(data, r.Term, r.Index, r.RaftTimestamp)
 		if err != nil {
 			sLog.Infof("propose failed: %v, err: %v", r.String(), err.Error())
 			rpcErr.ErrCode = http.StatusInternalServerError
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
@@ -24,6 +26,17 @@ import (
 
 var allowStaleRead int32
 
+const (
+	defaultChecksumBucketNum = 256
+	defaultBackupWaitTimeout = time.Minute * 10
+	defaultTableExportCount  = 1000
+	// the default threshold to report the big keys
+	defaultBigKeyMinSize     = 1024 * 1024
+	defaultBigKeyMinElements = 10000
+	// the replica will be unhealthy if the committed logs waiting to apply exceed this
+	defaultHealthMaxApplyGap = 5000
+)
+
 type RaftStatus struct {
 	LeaderInfo *common.MemberInfo
 	Members    []*common.MemberInfo
@@ -67,6 +80,109 @@ func (s *Server) doOptimizeAll(w http.ResponseWriter, req *http.Request, ps http
 	return nil, nil
 }
 
+// compact the key range of the table in background, the start and end are
+// the keys in the table without the table prefix.
+func (s *Server) doCompactTableRange(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	var start, end []byte
+	if v := reqParams.Get("start"); v != "" {
+		start = []byte(v)
+	}
+	if v := reqParams.Get("end"); v != "" {
+		end = []byte(v)
+	}
+	s.CompactTableRange(ns, table, start, end)
+	return nil, nil
+}
+
+func (s *Server) getCompactProgress(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	return s.GetCompactProgress(ns), nil
+}
+
+func (s *Server) doRecountTableKeys(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	sLog.Infof("got recount table keys: %v-%v from remote: %v", ns, table, req.RemoteAddr)
+	s.RecountTableKeys(ns, table)
+	return nil, nil
+}
+
+func (s *Server) getRecountStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	return s.GetRecountStatus(ns), nil
+}
+
+func (s *Server) getReshardStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	return s.GetReshardStatus(ns), nil
+}
+
+func (s *Server) doScanBigKeys(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	minSize := int64(defaultBigKeyMinSize)
+	if v := reqParams.Get("min_size"); v != "" {
+		minSize, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_MIN_SIZE"}
+		}
+	}
+	minElements := int64(defaultBigKeyMinElements)
+	if v := reqParams.Get("min_elements"); v != "" {
+		minElements, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_MIN_ELEMENTS"}
+		}
+	}
+	sLog.Infof("got big key scan: %v-%v, %v, %v from remote: %v", ns, table, minSize, minElements, req.RemoteAddr)
+	s.ScanBigKeys(ns, table, minSize, minElements)
+	return nil, nil
+}
+
+func (s *Server) getBigKeyScanStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	return s.GetBigKeyScanStatus(ns), nil
+}
+
+func (s *Server) doInspectTables(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	table := reqParams.Get("table")
+	sLog.Infof("got table inspection: %v-%v from remote: %v", ns, table, req.RemoteAddr)
+	s.InspectTables(ns, table)
+	return nil, nil
+}
+
+func (s *Server) getTableInspectStatus(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	return s.GetTableInspectStatus(ns), nil
+}
+
 func (s *Server) doDeleteRange(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	table := ps.ByName("table")
@@ -96,6 +212,209 @@ func (s *Server) doDeleteRange(w http.ResponseWriter, req *http.Request, ps http
 	return nil, nil
 }
 
+func (s *Server) doDropTable(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	sLog.Infof("got drop table: %v-%v from remote: %v", ns, table, req.RemoteAddr)
+	err := s.DropTable(ns, table)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doSetTableValueCompress(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	vc := common.ValueCompressSchema{
+		Compression: reqParams.Get("compression"),
+	}
+	if minSize := reqParams.Get("min_value_size"); minSize != "" {
+		vc.MinValueSize, err = strconv.Atoi(minSize)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid min_value_size"}
+		}
+	}
+	if err := vc.CheckValid(); err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Infof("got table value compression: %v-%v, %v from remote: %v", ns, table, vc, req.RemoteAddr)
+	err = s.SetTableValueCompress(ns, table, vc)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doSetTableZsetScoreIndex(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	var zi common.ZsetScoreIndexSchema
+	zi.Enable, err = strconv.ParseBool(reqParams.Get("enable"))
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid enable param"}
+	}
+	sLog.Infof("got table zset score index: %v-%v, %v from remote: %v", ns, table, zi, req.RemoteAddr)
+	err = s.SetTableZsetScoreIndex(ns, table, zi)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doAddFullTextIndex(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	ft := common.FullTextIndexSchema{
+		Name:      reqParams.Get("name"),
+		HsetField: reqParams.Get("hset_field"),
+		JSONPath:  reqParams.Get("json_path"),
+	}
+	if err := ft.CheckValid(); err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Infof("got table full text index: %v-%v, %v from remote: %v", ns, table, ft, req.RemoteAddr)
+	err = s.AddFullTextIndex(ns, table, ft)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doDelFullTextIndex(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "index name should not be empty"}
+	}
+	sLog.Infof("delete table full text index: %v-%v, %v from remote: %v", ns, table, name, req.RemoteAddr)
+	err := s.DelFullTextIndex(ns, table, name)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+// export the table to the rdb file, the table data will be in the db 0 if no db specified
+func (s *Server) doExportRDB(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	dbIndex := 0
+	if dbStr := req.URL.Query().Get("db"); dbStr != "" {
+		var err error
+		dbIndex, err = strconv.Atoi(dbStr)
+		if err != nil || dbIndex < 0 {
+			http.Error(w, "invalid db", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := s.nsMgr.GetNamespaceNodes(ns, false); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.rdb", ns, table))
+	cnt, err := s.ExportRDB(ns, table, dbIndex, w)
+	if err != nil {
+		// the header has been sent, the client should check the rdb checksum
+		sLog.Infof("export table %v:%v to rdb failed: %v", ns, table, err)
+		return
+	}
+	sLog.Infof("export table %v:%v to rdb done, keys: %v", ns, table, cnt)
+}
+
+// export one page of the table in the partition as the table dump, the dump is ended
+// with the checkpoint of the next cursor (if not done) and the end record.
+func (s *Server) doExportTable(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	q := req.URL.Query()
+	pid, err := strconv.Atoi(q.Get("partition"))
+	if err != nil || pid < 0 {
+		http.Error(w, "invalid partition", http.StatusBadRequest)
+		return
+	}
+	cursor, err := hex.DecodeString(q.Get("cursor"))
+	if err != nil {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	count := defaultTableExportCount
+	if countStr := q.Get("count"); countStr != "" {
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			http.Error(w, "invalid count", http.StatusBadRequest)
+			return
+		}
+	}
+	nsNode := s.nsMgr.GetNamespaceNode(common.GetNsDesp(ns, pid))
+	if nsNode == nil {
+		http.Error(w, "namespace partition not found", http.StatusNotFound)
+		return
+	}
+	if !nsNode.Node.IsLead() {
+		http.Error(w, cluster.ErrFailedOnNotLeader, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	tw, err := common.NewTableDumpWriter(w, table)
+	if err != nil {
+		return
+	}
+	next, cnt, err := nsNode.Node.ExportTable(table, cursor, count, tw)
+	if err == nil && next != nil {
+		err = tw.WriteCheckpoint(next)
+	}
+	if err == nil {
+		err = tw.Close(int64(cnt))
+	}
+	if err != nil {
+		// the header has been sent, the client will get the incomplete dump
+		sLog.Infof("export table %v:%v in partition %v failed: %v", ns, table, pid, err)
+	}
+}
+
+func (s *Server) doImportRDB(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	dbTables, err := common.ParseRDBTableMapping(req.URL.Query().Get("db_tables"))
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	stats, err := s.ImportRDB(ns, req.Body, dbTables)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return stats, nil
+}
+
 func (s *Server) doForceNewCluster(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
@@ -183,100 +502,459 @@ func (s *Server) doAddNode(w http.ResponseWriter, req *http.Request, ps httprout
 	return nil, nil
 }
 
-func (s *Server) doAddLearner(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
-	data, err := ioutil.ReadAll(req.Body)
-	if err != nil {
-		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
-	}
-	sLog.Infof("got add learner node request: %v from remote: %v", string(data), req.RemoteAddr)
-
-	var m common.MemberInfo
-	err = json.Unmarshal(data, &m)
-	if err != nil {
-		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
-	}
+func (s *Server) doAddLearner(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Infof("got add learner node request: %v from remote: %v", string(data), req.RemoteAddr)
+
+	var m common.MemberInfo
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+
+	nsNode := s.GetNamespaceFromFullName(m.GroupName)
+	if nsNode == nil || !nsNode.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: node.ErrNamespacePartitionNotFound.Error()}
+	}
+	err = nsNode.Node.ProposeAddLearner(m)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) getLeader(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	l := v.Node.GetLeadMember()
+	if l == nil {
+		return nil, common.HttpErr{Code: http.StatusSeeOther, Text: "no leader found"}
+	}
+	return l, nil
+}
+
+func (s *Server) getMembers(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	return v.Node.GetMembers(), nil
+}
+
+func (s *Server) getIndexes(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		sLog.Infof("failed to get namespace node - %s", ns)
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	table := ps.ByName("table")
+	return v.Node.GetIndexSchema(table)
+}
+
+func (s *Server) checkNodeAllReady(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ok := s.nsMgr.IsAllRecoveryDone()
+	if !ok {
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "not ready for all"}
+	}
+	return nil, nil
+}
+
+func (s *Server) doLeaveCluster(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if s.dataCoord == nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "not in cluster mode"}
+	}
+	err := s.dataCoord.LeaveCluster()
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) isNsNodeFullReady(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		sLog.Infof("failed to get namespace node - %s", ns)
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	ok := v.IsNsNodeFullReady(true)
+	if !ok {
+		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "raft node is not synced yet"}
+	}
+	return nil, nil
+}
+
+func (s *Server) checkNodeBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	meta, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	ok, err := v.Node.CheckLocalBackup(meta)
+	if err != nil || !ok {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no backup found"}
+	}
+	return nil, nil
+}
+
+func (s *Server) getLatestBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	term, index, err := v.Node.GetLatestLocalBackup()
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	if term == 0 && index == 0 {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no backup found"}
+	}
+	return common.LogSyncStats{Name: ns, Term: term, Index: index}, nil
+}
+
+// the checksum of table data in the namespace partition, if the bucket is given, the checksum
+// of each key in the bucket will be returned.
+func (s *Server) getTableChecksum(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	bucketNum := defaultChecksumBucketNum
+	if str := reqParams.Get("buckets"); str != "" {
+		bucketNum, err = strconv.Atoi(str)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_BUCKETS"}
+		}
+	}
+	if str := reqParams.Get("bucket"); str != "" {
+		bucket, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_BUCKET"}
+		}
+		keys, err := v.Node.GetTableBucketKeysChecksum(table, bucketNum, bucket)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		return keys, nil
+	}
+	tc, err := v.Node.GetTableChecksum(table, bucketNum)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	tc.Name = ns
+	return tc, nil
+}
+
+// make all the replicas of the partitions led by this node compute the table checksum at the same
+// raft index, the result can be compared by the get api after all the replicas finished.
+func (s *Server) doConsistencyCheck(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	if ns == "" || table == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace and table should not be empty"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	bucketNum := defaultChecksumBucketNum
+	if str := reqParams.Get("buckets"); str != "" {
+		bucketNum, err = strconv.Atoi(str)
+		if err != nil || bucketNum <= 0 {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_BUCKETS"}
+		}
+	}
+	sLog.Infof("got consistency check for table: %v-%v from remote: %v", ns, table, req.RemoteAddr)
+	indexes, err := s.StartConsistencyCheck(ns, table, bucketNum)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return indexes, nil
+}
+
+func (s *Server) getConsistencyReports(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	reports, err := s.GetConsistencyReports(ns, table)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+	}
+	return reports, nil
+}
+
+// the checksum computed by the local replica, used by the leader to compare the replicas
+func (s *Server) getReplicaChecksum(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	table := ps.ByName("table")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	rc, err := v.Node.GetReplicaChecksum(table)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+	}
+	return rc, nil
+}
+
+func (s *Server) getSnapFilePath(req *http.Request) (string, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return "", common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	module := s.conf.DataRsyncModule
+	if module == "" {
+		module = defaultRsyncModule
+	}
+	p, err := common.GetSnapFilePath(s.conf.DataDir, module, reqParams.Get("path"))
+	if err != nil {
+		return "", common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return p, nil
+}
+
+func (s *Server) getSnapFileList(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	p, err := s.getSnapFilePath(req)
+	if err != nil {
+		return nil, err
+	}
+	files, err := common.GetSnapFileList(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.HttpErr{Code: http.StatusNotFound, Text: err.Error()}
+		}
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return files, nil
+}
+
+// serve the snapshot file with range supported, so the transfer can be resumed
+func (s *Server) getSnapFile(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	p, err := s.getSnapFilePath(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fi, err := os.Stat(p)
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+	if !s.snapSendLimiter.TryAcquire() {
+		http.Error(w, "too many snapshot transfers", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.snapSendLimiter.Release()
+	http.ServeFile(s.snapSendLimiter.NewWriter(req.Context(), w), req, p)
+}
+
+func (s *Server) getSnapTransferStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return map[string]interface{}{
+		"incoming":       common.GetSnapTransferStats(),
+		"outgoing_files": s.snapSendLimiter.Sending(),
+		"send_bandwidth": s.snapSendLimiter.Bandwidth(),
+		"recv_bandwidth": common.GetSnapRecvBandwidth(),
+	}, nil
+}
+
+// change the bandwidth limit of the snapshot transfers, 0 for no limit
+func (s *Server) doSetSnapTransferBandwidth(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	sendStr := reqParams.Get("send")
+	recvStr := reqParams.Get("recv")
+	if sendStr == "" && recvStr == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_BANDWIDTH"}
+	}
+	var send, recv int64
+	if sendStr != "" {
+		send, err = strconv.ParseInt(sendStr, 10, 64)
+		if err != nil || send < 0 {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_ARG_SEND"}
+		}
+	}
+	if recvStr != "" {
+		recv, err = strconv.ParseInt(recvStr, 10, 64)
+		if err != nil || recv < 0 {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_ARG_RECV"}
+		}
+	}
+	if sendStr != "" {
+		s.snapSendLimiter.SetBandwidth(send)
+	}
+	if recvStr != "" {
+		common.SetSnapRecvBandwidth(recv)
+	}
+	sLog.Infof("snapshot transfer bandwidth changed, send: %v, recv: %v", sendStr, recvStr)
+	return nil, nil
+}
+
+func (s *Server) doPauseSnapTransfer(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	common.SetSnapTransferPaused(ps.ByName("namespace"), true)
+	return nil, nil
+}
+
+func (s *Server) doResumeSnapTransfer(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	common.SetSnapTransferPaused(ps.ByName("namespace"), false)
+	return nil, nil
+}
 
-	nsNode := s.GetNamespaceFromFullName(m.GroupName)
-	if nsNode == nil || !nsNode.IsReady() {
-		return nil, common.HttpErr{Code: http.StatusNotFound, Text: node.ErrNamespacePartitionNotFound.Error()}
-	}
-	err = nsNode.Node.ProposeAddLearner(m)
-	if err != nil {
-		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+// cancel the running snapshot transfer, the partition will be stopped since the snapshot can not be restored
+func (s *Server) doCancelSnapTransfer(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !common.CancelSnapTransfer(ps.ByName("namespace")) {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no snapshot transfer running"}
 	}
 	return nil, nil
 }
 
-func (s *Server) getLeader(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+// backup the namespace partition and wait done, used by the cluster backup
+func (s *Server) doBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
 	if v == nil || !v.IsReady() {
 		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
 	}
-	l := v.Node.GetLeadMember()
-	if l == nil {
-		return nil, common.HttpErr{Code: http.StatusSeeOther, Text: "no leader found"}
+	if !v.Node.IsLead() {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "not leader"}
 	}
-	return l, nil
+	timeout := defaultBackupWaitTimeout
+	if str := req.URL.Query().Get("timeout_sec"); str != "" {
+		sec, err := strconv.Atoi(str)
+		if err != nil || sec <= 0 {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid timeout"}
+		}
+		timeout = time.Duration(sec) * time.Second
+	}
+	term, index, err := v.Node.BackupAndWait(timeout)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return common.PartitionBackupPoint{Name: ns, Term: term, Index: index}, nil
 }
 
-func (s *Server) getMembers(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+// backup the namespace partition and upload to the target in the body, used by the scheduled backup
+func (s *Server) doBackupToTarget(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
 	if v == nil || !v.IsReady() {
 		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
 	}
-	return v.Node.GetMembers(), nil
+	if !v.Node.IsLead() {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "not leader"}
+	}
+	timeout := defaultBackupWaitTimeout
+	if str := req.URL.Query().Get("timeout_sec"); str != "" {
+		sec, err := strconv.Atoi(str)
+		if err != nil || sec <= 0 {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid timeout"}
+		}
+		timeout = time.Duration(sec) * time.Second
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var target common.BackupTargetConfig
+	err = json.Unmarshal(data, &target)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	term, index, err := v.Node.BackupToTarget(target, timeout)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return common.PartitionBackupPoint{Name: ns, Term: term, Index: index}, nil
 }
 
-func (s *Server) getIndexes(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+// clone the data from the checkpoint of the source namespace partition on the source node,
+// should be called on the leader until done
+func (s *Server) doCloneNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
 	if v == nil || !v.IsReady() {
-		sLog.Infof("failed to get namespace node - %s", ns)
 		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
 	}
-	table := ps.ByName("table")
-	return v.Node.GetIndexSchema(table)
-}
-
-func (s *Server) checkNodeAllReady(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
-	ok := s.nsMgr.IsAllRecoveryDone()
-	if !ok {
-		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "not ready for all"}
+	if !v.Node.IsLead() {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "not leader"}
 	}
-	return nil, nil
+	reqParams := req.URL.Query()
+	source := reqParams.Get("source")
+	srcNode := reqParams.Get("node")
+	if source == "" || srcNode == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "missing clone source"}
+	}
+	term, err := strconv.ParseUint(reqParams.Get("term"), 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid term"}
+	}
+	index, err := strconv.ParseUint(reqParams.Get("index"), 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid index"}
+	}
+	ip, _, _, httpPort := cluster.ExtractNodeInfoFromID(srcNode)
+	status, err := v.Node.CloneFromSnapshot(source, ip, httpPort, term, index)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return map[string]string{"status": status}, nil
 }
 
-func (s *Server) isNsNodeFullReady(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+// upload the backup of the namespace partition to the backup target, should be called on the leader
+func (s *Server) doBackupUpload(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
 	if v == nil || !v.IsReady() {
-		sLog.Infof("failed to get namespace node - %s", ns)
 		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
 	}
-	ok := v.IsNsNodeFullReady(true)
-	if !ok {
-		return nil, common.HttpErr{Code: http.StatusNotAcceptable, Text: "raft node is not synced yet"}
+	if !v.Node.IsLead() {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "not leader"}
+	}
+	err := v.Node.ForceBackupUpload()
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
 	}
 	return nil, nil
 }
 
-func (s *Server) checkNodeBackup(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+func (s *Server) getRemoteBackups(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ns := ps.ByName("namespace")
 	v := s.GetNamespaceFromFullName(ns)
 	if v == nil || !v.IsReady() {
 		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
 	}
-	meta, err := ioutil.ReadAll(req.Body)
+	stats, err := v.Node.GetBackupUploadStats()
 	if err != nil {
 		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
 	}
-	ok, err := v.Node.CheckLocalBackup(meta)
-	if err != nil || !ok {
-		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no backup found"}
+	backups, err := v.Node.ListRemoteBackups()
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
 	}
-	return nil, nil
+	return map[string]interface{}{
+		"upload_stats": stats,
+		"backups":      backups,
+	}, nil
 }
 
 func (s *Server) pingHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
@@ -337,6 +1015,58 @@ func (s *Server) doSetCostLevel(w http.ResponseWriter, req *http.Request, ps htt
 	return nil, nil
 }
 
+func (s *Server) doSetSlowLogThreshold(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	usStr := reqParams.Get("threshold_us")
+	if usStr == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_THRESHOLD_US"}
+	}
+	us, err := strconv.ParseInt(usStr, 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_THRESHOLD_STRING"}
+	}
+	node.SetSlowLogThreshold(time.Duration(us) * time.Microsecond)
+	return nil, nil
+}
+
+// the status code will be 503 if any partition of the namespace is unhealthy,
+// so the load balancer can remove the lagging node from the read pool.
+func (s *Server) doNamespaceHealth(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "INVALID_REQUEST", http.StatusBadRequest)
+		return
+	}
+	maxGap := uint64(defaultHealthMaxApplyGap)
+	if gapStr := reqParams.Get("max_apply_gap"); gapStr != "" {
+		maxGap, err = strconv.ParseUint(gapStr, 10, 64)
+		if err != nil {
+			http.Error(w, "BAD_MAX_APPLY_GAP", http.StatusBadRequest)
+			return
+		}
+	}
+	ns := reqParams.Get("namespace")
+	healthList, err := s.GetNamespaceHealth(ns, maxGap)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	code := http.StatusOK
+	for _, h := range healthList {
+		if !h.Healthy {
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+	d, _ := json.Marshal(healthList)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(d)
+}
+
 func (s *Server) doSetStaleRead(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -444,6 +1174,87 @@ func (s *Server) doRaftStats(w http.ResponseWriter, req *http.Request, ps httpro
 	return rstat, nil
 }
 
+func (s *Server) doRaftRepairReport(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		sLog.Infof("failed to parse request params - %s", err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	nsList := s.nsMgr.GetNamespaces()
+	reports := make(map[string][]node.RaftRepairEntry)
+	for name, nsNode := range nsList {
+		if !strings.HasPrefix(name, ns) {
+			continue
+		}
+		entries := nsNode.Node.GetRaftRepairReport()
+		if len(entries) > 0 {
+			reports[name] = entries
+		}
+	}
+	return reports, nil
+}
+
+func (s *Server) doTransferLeader(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	toID, err := strconv.ParseUint(reqParams.Get("to_replica"), 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_TO_REPLICA"}
+	}
+	sLog.Infof("got transfer leader request for %v to replica %v from remote: %v", ns, toID, req.RemoteAddr)
+	err = v.TransferLeaderTo(toID)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) getElectionPriority(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	return struct {
+		Priority int32 `json:"priority"`
+	}{v.Node.GetElectionPriority()}, nil
+}
+
+// doSetElectionPriority set the election priority for all the replicas matching the namespace
+// prefix on this node, set the priority to 0 will move all the leaders away to drain the node.
+func (s *Server) doSetElectionPriority(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	p, err := strconv.Atoi(reqParams.Get("priority"))
+	if err != nil || p < 0 {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_PRIORITY"}
+	}
+	ns := reqParams.Get("namespace")
+	changed := make([]string, 0)
+	for name, nsNode := range s.nsMgr.GetNamespaces() {
+		if !strings.HasPrefix(name, ns) {
+			continue
+		}
+		if err := nsNode.Node.SetElectionPriority(int32(p)); err != nil {
+			sLog.Infof("set election priority for %v failed: %v", name, err)
+			return changed, common.HttpErr{Code: http.StatusInternalServerError, Text: err.Error()}
+		}
+		changed = append(changed, name)
+	}
+	sLog.Infof("election priority changed to %v for %v from remote: %v", p, changed, req.RemoteAddr)
+	return changed, nil
+}
+
 func (s *Server) doStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -499,6 +1310,34 @@ func (s *Server) doLogSyncStats(w http.ResponseWriter, req *http.Request, ps htt
 	}{netStat, totalStat, logSyncedStats}, nil
 }
 
+func (s *Server) doLogSyncCaughtUp(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		sLog.Infof("failed to parse request params - %s", err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	var index uint64
+	if indexStr := reqParams.Get("index"); indexStr != "" {
+		index, err = strconv.ParseUint(indexStr, 10, 64)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "invalid index"}
+		}
+	}
+	caughtUp, stats, err := v.Node.IsLogSyncerCaughtUp(index)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return struct {
+		CaughtUp  bool                `json:"caught_up"`
+		LogSynced common.LogSyncStats `json:"log_synced"`
+	}{caughtUp, *stats}, nil
+}
+
 func (s *Server) doDBStats(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -531,6 +1370,151 @@ func (s *Server) doDBPerf(w http.ResponseWriter, req *http.Request, ps httproute
 	return nil, nil
 }
 
+// change the rocksdb options of all the local partitions of the namespace at runtime
+func (s *Server) doSetDBOptions(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	if ns == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "namespace should not be empty"}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var o common.RockOptionsOverride
+	err = json.Unmarshal(data, &o)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	if err := o.CheckValid(); err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Infof("got set db options: %v for %v from remote: %v", string(data), ns, req.RemoteAddr)
+	err = s.SetDBOptions(ns, o)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+// the cluster dynamic config applied on this node
+func (s *Server) doGetDynamicConf(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return common.GetAppliedDynamicConf(), nil
+}
+
+func (s *Server) doGetWriteRateLimits(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return s.writeLimiter.GetLimits(), nil
+}
+
+// set the write rate limit for the namespace or the table, the limit will be removed if the rate is 0
+func (s *Server) doSetWriteRateLimit(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	l := WriteRateLimit{
+		Namespace: reqParams.Get("namespace"),
+		Table:     reqParams.Get("table"),
+	}
+	if l.Namespace == "" {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	l.Rate, err = strconv.ParseFloat(reqParams.Get("rate"), 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_RATE_STRING"}
+	}
+	if burstStr := reqParams.Get("burst"); burstStr != "" {
+		l.Burst, err = strconv.Atoi(burstStr)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_BURST_STRING"}
+		}
+	}
+	sLog.Infof("set write rate limit: %v from remote: %v", l, req.RemoteAddr)
+	s.writeLimiter.SetLimit(l)
+	return nil, nil
+}
+
+func (s *Server) doGetFaults(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !common.FaultInjectEnabled {
+		return nil, common.HttpErr{Code: http.StatusNotImplemented, Text: common.ErrFaultInjectDisabled.Error()}
+	}
+	return common.GetFaults(), nil
+}
+
+// enable the fault point for the chaos testing, only for the binary built with the faultinject tag
+func (s *Server) doSetFault(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !common.FaultInjectEnabled {
+		return nil, common.HttpErr{Code: http.StatusNotImplemented, Text: common.ErrFaultInjectDisabled.Error()}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	name := reqParams.Get("name")
+	fc := common.FaultConf{
+		Namespace: reqParams.Get("namespace"),
+	}
+	fc.Probability, err = strconv.ParseFloat(reqParams.Get("probability"), 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_PROBABILITY_STRING"}
+	}
+	if v := reqParams.Get("delay_ms"); v != "" {
+		fc.DelayMs, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_DELAY_STRING"}
+		}
+	}
+	if v := reqParams.Get("count"); v != "" {
+		fc.Count, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_COUNT_STRING"}
+		}
+	}
+	if err := common.SetFault(name, fc); err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Warningf("fault %v enabled: %v from remote: %v", name, fc, req.RemoteAddr)
+	return nil, nil
+}
+
+// disable the fault point, or all the fault points if the name is empty
+func (s *Server) doRemoveFault(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	if !common.FaultInjectEnabled {
+		return nil, common.HttpErr{Code: http.StatusNotImplemented, Text: common.ErrFaultInjectDisabled.Error()}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	name := reqParams.Get("name")
+	common.RemoveFault(name)
+	sLog.Infof("fault %v removed from remote: %v", name, req.RemoteAddr)
+	return nil, nil
+}
+
+// move the clock used by the ttl for the chaos testing, the offset_ms can be negative
+func (s *Server) doSetClockOffset(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	offset, err := strconv.ParseInt(reqParams.Get("offset_ms"), 10, 64)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_OFFSET_STRING"}
+	}
+	if err := common.SetClockOffset(time.Duration(offset) * time.Millisecond); err != nil {
+		return nil, common.HttpErr{Code: http.StatusNotImplemented, Text: err.Error()}
+	}
+	sLog.Warningf("clock offset set to %vms from remote: %v", offset, req.RemoteAddr)
+	return nil, nil
+}
+
+func (s *Server) doGetClockOffset(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return map[string]interface{}{
+		"offset_ms": int64(common.GetClockOffset() / time.Millisecond),
+		"now":       common.ClockNow().UnixNano(),
+	}, nil
+}
+
 func (s *Server) initHttpHandler() {
 	log := common.HttpLog(sLog, common.LOG_INFO)
 	debugLog := common.HttpLog(sLog, common.LOG_DEBUG)
@@ -540,31 +1524,82 @@ func (s *Server) initHttpHandler() {
 	router.Handle("GET", common.APIGetIndexes+"/:namespace/:table", common.Decorate(s.getIndexes, common.V1))
 	router.Handle("GET", common.APIGetIndexes+"/:namespace", common.Decorate(s.getIndexes, common.V1))
 	router.Handle("GET", common.APICheckBackup+"/:namespace", common.Decorate(s.checkNodeBackup, log, common.V1))
+	router.Handle("GET", common.APILatestBackup+"/:namespace", common.Decorate(s.getLatestBackup, common.V1))
+	router.Handle("POST", common.APIDoBackup+"/:namespace", common.Decorate(s.doBackup, log, common.V1))
+	router.Handle("POST", common.APIBackupToTarget+"/:namespace", common.Decorate(s.doBackupToTarget, log, common.V1))
+	router.Handle("POST", common.APICloneNamespace+"/:namespace", common.Decorate(s.doCloneNamespace, log, common.V1))
+	router.Handle("POST", common.APIBackupUpload+"/:namespace", common.Decorate(s.doBackupUpload, log, common.V1))
+	router.Handle("GET", common.APIRemoteBackups+"/:namespace", common.Decorate(s.getRemoteBackups, common.V1))
+	router.Handle("GET", common.APITableChecksum+"/:namespace/:table", common.Decorate(s.getTableChecksum, common.V1))
+	router.Handle("GET", common.APIReplicaChecksum+"/:namespace/:table", common.Decorate(s.getReplicaChecksum, common.V1))
+	router.Handle("POST", "/kv/consistency/:namespace/:table", common.Decorate(s.doConsistencyCheck, log, common.V1))
+	router.Handle("GET", "/kv/consistency/:namespace/:table", common.Decorate(s.getConsistencyReports, common.V1))
+	router.Handle("GET", common.APISnapFileList, common.Decorate(s.getSnapFileList, log, common.V1))
+	router.GET(common.APISnapFile, s.getSnapFile)
+	router.Handle("GET", common.APISnapTransfer+"/stats", common.Decorate(s.getSnapTransferStats, common.V1))
+	router.Handle("POST", common.APISnapTransfer+"/bandwidth", common.Decorate(s.doSetSnapTransferBandwidth, log, common.V1))
+	router.Handle("POST", common.APISnapTransfer+"/pause/:namespace", common.Decorate(s.doPauseSnapTransfer, log, common.V1))
+	router.Handle("POST", common.APISnapTransfer+"/resume/:namespace", common.Decorate(s.doResumeSnapTransfer, log, common.V1))
+	router.Handle("POST", common.APISnapTransfer+"/cancel/:namespace", common.Decorate(s.doCancelSnapTransfer, log, common.V1))
 	router.Handle("GET", common.APIIsRaftSynced+"/:namespace", common.Decorate(s.isNsNodeFullReady, common.V1))
+	router.Handle("GET", common.APIElectionPriority+"/:namespace", common.Decorate(s.getElectionPriority, common.V1))
+	router.Handle("POST", common.APIElectionPriority, common.Decorate(s.doSetElectionPriority, log, common.V1))
+	router.Handle("POST", "/raft/leader/transfer/:namespace", common.Decorate(s.doTransferLeader, log, common.V1))
 	router.Handle("GET", "/kv/get/:namespace", common.Decorate(s.getKey, common.PlainText))
 	router.Handle("POST", "/kv/optimize/:namespace/:table", common.Decorate(s.doOptimize, log, common.V1))
 	router.Handle("POST", "/kv/optimize", common.Decorate(s.doOptimizeAll, log, common.V1))
+	router.Handle("POST", "/kv/compact/:namespace/:table", common.Decorate(s.doCompactTableRange, log, common.V1))
+	router.Handle("GET", "/kv/compact/:namespace", common.Decorate(s.getCompactProgress, common.V1))
+	router.Handle("POST", "/kv/recount/:namespace/:table", common.Decorate(s.doRecountTableKeys, log, common.V1))
+	router.Handle("GET", "/kv/recount/:namespace", common.Decorate(s.getRecountStatus, common.V1))
+	router.Handle("POST", "/kv/bigkey/:namespace/:table", common.Decorate(s.doScanBigKeys, log, common.V1))
+	router.Handle("GET", "/kv/bigkey/:namespace", common.Decorate(s.getBigKeyScanStatus, common.V1))
+	router.Handle("POST", "/kv/inspect/:namespace", common.Decorate(s.doInspectTables, log, common.V1))
+	router.Handle("GET", "/kv/inspect/:namespace", common.Decorate(s.getTableInspectStatus, common.V1))
+	router.Handle("GET", common.APIReshardStatus+"/:namespace", common.Decorate(s.getReshardStatus, common.V1))
 	router.Handle("POST", "/cluster/raft/forcenew/:namespace", common.Decorate(s.doForceNewCluster, log, common.V1))
 	router.Handle("POST", "/cluster/raft/forceclean/:namespace", common.Decorate(s.doForceCleanRaftNode, log, common.V1))
 	router.Handle("POST", common.APIAddNode, common.Decorate(s.doAddNode, log, common.V1))
 	router.Handle("POST", common.APIAddLearnerNode, common.Decorate(s.doAddLearner, log, common.V1))
 	router.Handle("POST", common.APIRemoveNode, common.Decorate(s.doRemoveNode, log, common.V1))
 	router.Handle("GET", common.APINodeAllReady, common.Decorate(s.checkNodeAllReady, common.V1))
+	router.Handle("POST", common.APILeaveCluster, common.Decorate(s.doLeaveCluster, log, common.V1))
 	router.Handle("POST", "/kv/delrange/:namespace/:table", common.Decorate(s.doDeleteRange, log, common.V1))
+	router.Handle("POST", "/kv/droptable/:namespace/:table", common.Decorate(s.doDropTable, log, common.V1))
+	router.Handle("POST", "/kv/compress/:namespace/:table", common.Decorate(s.doSetTableValueCompress, log, common.V1))
+	router.Handle("POST", "/kv/zset_score_index/:namespace/:table", common.Decorate(s.doSetTableZsetScoreIndex, log, common.V1))
+	router.Handle("POST", "/kv/fulltext_index/:namespace/:table", common.Decorate(s.doAddFullTextIndex, log, common.V1))
+	router.Handle("DELETE", "/kv/fulltext_index/:namespace/:table", common.Decorate(s.doDelFullTextIndex, log, common.V1))
+	router.GET("/kv/rdb/export/:namespace/:table", s.doExportRDB)
+	router.GET(common.APITableExport+"/:namespace/:table", s.doExportTable)
+	router.Handle("POST", "/kv/rdb/import/:namespace", common.Decorate(s.doImportRDB, log, common.V1))
 
 	router.Handle("GET", "/ping", common.Decorate(s.pingHandler, common.PlainText))
 	router.Handle("POST", "/loglevel/set", common.Decorate(s.doSetLogLevel, log, common.V1))
 	router.Handle("POST", "/costlevel/set", common.Decorate(s.doSetCostLevel, log, common.V1))
+	router.Handle("POST", "/slowlog/threshold", common.Decorate(s.doSetSlowLogThreshold, log, common.V1))
 	router.Handle("POST", "/staleread", common.Decorate(s.doSetStaleRead, log, common.V1))
 	router.Handle("POST", "/synceronly", common.Decorate(s.doSetSyncerOnly, log, common.V1))
 	router.Handle("GET", "/info", common.Decorate(s.doInfo, common.V1))
 	router.Handle("POST", "/syncer/setindex/:clustername", common.Decorate(s.doSetSyncerIndex, log, common.V1))
 
 	router.Handle("GET", "/stats", common.Decorate(s.doStats, common.V1))
+	router.GET("/namespace/health", s.doNamespaceHealth)
 	router.Handle("GET", "/logsync/stats", common.Decorate(s.doLogSyncStats, common.V1))
+	router.Handle("GET", "/logsync/caughtup/:namespace", common.Decorate(s.doLogSyncCaughtUp, common.V1))
 	router.Handle("GET", "/db/stats", common.Decorate(s.doDBStats, common.V1))
 	router.Handle("GET", "/db/perf", common.Decorate(s.doDBPerf, log, common.V1))
+	router.Handle("POST", "/db/options/:namespace", common.Decorate(s.doSetDBOptions, log, common.V1))
+	router.Handle("GET", "/ratelimit/write", common.Decorate(s.doGetWriteRateLimits, common.V1))
+	router.Handle("POST", "/ratelimit/write", common.Decorate(s.doSetWriteRateLimit, log, common.V1))
+	router.Handle("GET", "/dynamic_conf", common.Decorate(s.doGetDynamicConf, common.V1))
+	router.Handle("GET", "/faults", common.Decorate(s.doGetFaults, common.V1))
+	router.Handle("POST", "/faults", common.Decorate(s.doSetFault, log, common.V1))
+	router.Handle("DELETE", "/faults", common.Decorate(s.doRemoveFault, log, common.V1))
+	router.Handle("GET", "/faults/clock", common.Decorate(s.doGetClockOffset, common.V1))
+	router.Handle("POST", "/faults/clock", common.Decorate(s.doSetClockOffset, log, common.V1))
 	router.Handle("GET", "/raft/stats", common.Decorate(s.doRaftStats, debugLog, common.V1))
+	router.Handle("GET", "/raft/repair/report", common.Decorate(s.doRaftRepairReport, common.V1))
 
 	s.router = router
 }
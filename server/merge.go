@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/absolute8511/ZanRedisDB/common"
@@ -61,6 +60,10 @@ func (s *Server) doMergeCommand(conn redcon.Conn, cmd redcon.Command) {
 		}
 	} else if common.IsMergeIndexSearchCommand(cmdName) {
 		s.doMergeIndexSearch(conn, cmd)
+	} else if common.IsMergeZsetIndexSearchCommand(cmdName) {
+		s.doMergeZsetIndexSearch(conn, cmd)
+	} else if common.IsMergeFullTextSearchCommand(cmdName) {
+		s.doMergeFullTextSearch(conn, cmd)
 	} else if common.IsMergeKeysCommand(cmdName) {
 		// current we only handle the command which keys may across multi partitions and the
 		// response is all the same. So if the response order is need for keys, we can not handle
@@ -72,7 +75,7 @@ func (s *Server) doMergeCommand(conn redcon.Conn, cmd redcon.Command) {
 }
 
 func (s *Server) getHandlersForKeys(cmdName string,
-	origArgs [][]byte) ([]common.MergeCommandFunc, []redcon.Command, bool, error) {
+	origArgs [][]byte, creq *node.ClientRequestID) ([]common.MergeCommandFunc, []redcon.Command, bool, error) {
 	cmdArgMap := make(map[string][][]byte)
 	handlerMap := make(map[string]common.MergeCommandFunc)
 	var namespace string
@@ -109,12 +112,15 @@ func (s *Server) getHandlersForKeys(cmdName string,
 			sLog.Infof("failed to get the namespace %s node for pk key:%v, rawkey: %v", ns, string(realKey), string(arg))
 			return nil, nil, hasWrite, err
 		}
-		f, isWrite, ok := nsNode.Node.GetMergeHandler(cmdName)
+		f, isWrite, ok := nsNode.Node.GetMergeHandlerWithClientReq(cmdName, creq)
 		if !ok {
 			return nil, nil, hasWrite, errInvalidCommand
 		}
 		if isWrite {
 			hasWrite = true
+			if !s.writeLimiter.Allow(ns, realKey) {
+				return nil, nil, hasWrite, errWriteThrottled
+			}
 		} else {
 			hasRead = true
 		}
@@ -122,10 +128,8 @@ func (s *Server) getHandlersForKeys(cmdName string,
 			// never happen
 			return nil, nil, false, errInvalidCommand
 		}
-		if !isWrite && !nsNode.Node.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) {
-			// read only to leader to avoid stale read
-			// TODO: also read command can request the raft read index if not leader
-			return nil, nil, hasWrite, node.ErrNamespaceNotLeader
+		if err := checkNodeServable(nsNode, isWrite); err != nil {
+			return nil, nil, hasWrite, err
 		}
 		handlerMap[nsNode.FullName()] = f
 		cmdArgs, ok := cmdArgMap[nsNode.FullName()]
@@ -156,12 +160,15 @@ func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon
 		return
 	}
 
-	cmds, results, err := s.dispatchAndWaitMergeCmd(cmd)
+	// the merge write to each partition will be deduped by the client request id
+	creq, _ := conn.Context().(*node.ClientRequestID)
+	handlers, cmds, concurrent, err := s.getHandlersForKeys(cmdName, cmd.Args[1:], creq)
 	if err != nil {
 		sLog.Infof("merge command %v error:%v", string(cmd.Raw), err.Error())
 		conn.WriteError(err.Error())
 		return
 	}
+	results := dispatchHandlersAndWait(string(cmd.Args[0]), handlers, cmds, concurrent)
 	if sLog.Level() >= common.LOG_DETAIL {
 		sLog.Debugf("merge command return %v", results)
 	}
@@ -179,7 +186,7 @@ func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon
 		for i, ret := range results {
 			if err, ok := ret.(error); ok {
 				for ci := 1; ci < len(cmds[i].Args); ci += 2 {
-					conn.WriteError("ERR :" + err.Error())
+					conn.WriteError(err.Error())
 				}
 			} else {
 				for ci := 1; ci < len(cmds[i].Args); ci += 2 {
@@ -232,7 +239,7 @@ func (s *Server) GetMergeHandlers(cmd redcon.Command) ([]common.MergeCommandFunc
 			return nil, nil, false, err
 		}
 	} else if common.IsMergeKeysCommand(cmdName) {
-		return s.getHandlersForKeys(cmdName, cmd.Args[1:])
+		return s.getHandlersForKeys(cmdName, cmd.Args[1:], nil)
 	} else {
 		cmds = make(map[string]redcon.Command)
 		for k := range nodes {
@@ -248,10 +255,8 @@ func (s *Server) GetMergeHandlers(cmd redcon.Command) ([]common.MergeCommandFunc
 		newCmd := cmds[k]
 		h, isWrite, ok := v.Node.GetMergeHandler(cmdName)
 		if ok {
-			if !isWrite && !v.Node.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) {
-				// read only to leader to avoid stale read
-				// TODO: also read command can request the raft read index if not leader
-				return nil, nil, needConcurrent, node.ErrNamespaceNotLeader
+			if err := checkNodeServable(v, isWrite); err != nil {
+				return nil, nil, needConcurrent, err
 			}
 			handlers = append(handlers, h)
 			commands = append(commands, newCmd)
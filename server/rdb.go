@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+type RDBImportStats struct {
+	Imported int64 `json:"imported"`
+	// the keys in the redis db without the table mapping
+	Skipped int64 `json:"skipped"`
+	Expired int64 `json:"expired"`
+}
+
+// ExportRDB write the table data of all the local partitions of the namespace to the rdb,
+// the complete data can be exported only if all the partitions are on this node.
+func (s *Server) ExportRDB(ns string, table string, dbIndex int, w io.Writer) (int64, error) {
+	nodes, err := s.nsMgr.GetNamespaceNodes(ns, false)
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rw, err := common.NewRDBWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, name := range names {
+		cnt, err := nodes[name].Node.ExportTableRDB(table, dbIndex, rw)
+		total += cnt
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, rw.Close()
+}
+
+// ImportRDB write the keys in the rdb to the tables of the namespace, the partition of
+// the key should be on this node.
+func (s *Server) ImportRDB(ns string, r io.Reader, dbTables map[int]string) (RDBImportStats, error) {
+	var stats RDBImportStats
+	rr, err := common.NewRDBReader(r)
+	if err != nil {
+		return stats, err
+	}
+	for {
+		e, err := rr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		table, ok := dbTables[e.DB]
+		if !ok {
+			stats.Skipped++
+			continue
+		}
+		if e.GetRemainingTTL(time.Now()) < 0 {
+			stats.Expired++
+			continue
+		}
+		pk := make([]byte, 0, len(table)+1+len(e.Key))
+		pk = append(pk, table...)
+		pk = append(pk, common.KEYSEP)
+		pk = append(pk, e.Key...)
+		n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(ns, pk)
+		if err != nil {
+			return stats, err
+		}
+		if err := n.Node.ImportRDBEntry(table, e); err != nil {
+			return stats, err
+		}
+		stats.Imported++
+	}
+	sLog.Infof("import rdb to namespace %v done: %v", ns, stats)
+	return stats, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/absolute8511/ZanRedisDB/node"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
 	"github.com/absolute8511/redcon"
 )
 
@@ -17,7 +18,18 @@ var (
 	costStatsLevel    int32
 )
 
+// redisConn normalize the error replies to be compatible with the redis, so the
+// clients depending on the error prefix (such as ERR and WRONGTYPE) can work unmodified.
+type redisConn struct {
+	redcon.Conn
+}
+
+func (c redisConn) WriteError(msg string) {
+	c.Conn.WriteError(common.RedisErrorString(msg))
+}
+
 func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
+	conn = redisConn{conn}
 	defer func() {
 		if e := recover(); e != nil {
 			buf := make([]byte, 4096)
@@ -34,6 +46,11 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 		return
 	}
 	cmdName := qcmdlower(cmd.Args[0])
+	if cmdName != "reqid" {
+		// the client request id set by REQID is only used for the next command, even
+		// if the command is not a write or failed before proposing
+		defer conn.SetContext(nil)
+	}
 	switch cmdName {
 	case "detach":
 		hconn := conn.Detach()
@@ -51,6 +68,41 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 	case "quit":
 		conn.WriteString("OK")
 		conn.Close()
+	case "reqid":
+		// set the client request id for the next write command on this connection,
+		// the retried write with the same id will be applied only once.
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR wrong number of arguments for 'reqid' command")
+			return
+		}
+		clientID, err := strconv.ParseUint(string(cmd.Args[1]), 10, 64)
+		if err != nil || clientID == 0 {
+			conn.WriteError("ERR invalid client id")
+			return
+		}
+		seq, err := strconv.ParseUint(string(cmd.Args[2]), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR invalid request sequence")
+			return
+		}
+		conn.SetContext(&node.ClientRequestID{ClientID: clientID, Seq: seq})
+		conn.WriteString("OK")
+	case "slowlog":
+		s.doSlowLogCommand(conn, cmd)
+	case "memory":
+		s.doMemoryCommand(conn, cmd)
+	case "appliedindex":
+		s.doAppliedIndexCommand(conn, cmd)
+	case "object":
+		s.doObjectCommand(conn, cmd)
+	case "dbsize":
+		s.doDBSizeCommand(conn, cmd)
+	case "tablesize":
+		s.doTableSizeCommand(conn, cmd)
+	case "flushtable":
+		s.doFlushCommand(conn, cmd, false)
+	case "flushns":
+		s.doFlushCommand(conn, cmd, true)
 	case "info":
 		s := s.GetStats(false)
 		d, _ := json.MarshalIndent(s, "", " ")
@@ -97,6 +149,215 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+// MEMORY USAGE key
+// return the estimated encoded size of the key in db
+func (s *Server) doMemoryCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 2 {
+		conn.WriteError("ERR wrong number of arguments for 'memory' command")
+		return
+	}
+	subCmd := qcmdlower(cmd.Args[1])
+	if subCmd != "usage" {
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try MEMORY USAGE")
+		return
+	}
+	if len(cmd.Args) < 3 {
+		conn.WriteError("ERR wrong number of arguments for 'memory usage' command")
+		return
+	}
+	namespace, pk, err := common.ExtractNamesapce(cmd.Args[2])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(namespace, pk)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if err := checkNodeServable(n, false); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	size, err := n.Node.KeyMemoryUsage(pk)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if size == 0 {
+		conn.WriteNull()
+		return
+	}
+	conn.WriteInt64(size)
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> key. Subcommands:",
+	"ENCODING <key> -- Return the kind of internal representation used in order to store the value associated with a key.",
+	"FREQ <key> -- Return the logarithmic access frequency counter of the sampled accesses, the access tracking should be enabled.",
+	"IDLETIME <key> -- Return the idle time in seconds since the last sampled access, the access tracking should be enabled, nil if the key is not tracked.",
+	"REFCOUNT <key> -- Return the number of references of the value associated with the specified key, always 1.",
+}
+
+// OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key
+// the idle time and the frequency are only available while the access tracking is enabled
+// by the access_sample_rate dynamic config
+func (s *Server) doObjectCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 2 {
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
+		return
+	}
+	subCmd := qcmdlower(cmd.Args[1])
+	switch subCmd {
+	case "help":
+		conn.WriteArray(len(objectHelp))
+		for _, line := range objectHelp {
+			conn.WriteString(line)
+		}
+		return
+	case "encoding", "idletime", "freq", "refcount":
+	default:
+		conn.WriteError("ERR unknown subcommand '" + string(cmd.Args[1]) + "'. Try OBJECT HELP.")
+		return
+	}
+	if len(cmd.Args) != 3 {
+		conn.WriteError(common.WrongArgsNumError([]byte("object|" + subCmd)))
+		return
+	}
+	namespace, pk, err := common.ExtractNamesapce(cmd.Args[2])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(namespace, pk)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if err := checkNodeServable(n, false); err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	t, err := n.Node.KeyType(pk)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if t == rockredis.TypeNameNone {
+		conn.WriteNull()
+		return
+	}
+	switch subCmd {
+	case "encoding":
+		enc, err := n.Node.KeyEncoding(pk)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteBulkString(enc)
+	case "idletime":
+		idle, tracked, err := n.Node.KeyIdleTime(pk)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		// the idle time is unknown if the accesses of the key are not sampled
+		if !tracked {
+			conn.WriteNull()
+			return
+		}
+		conn.WriteInt64(int64(idle / time.Second))
+	case "freq":
+		freq, err := n.Node.KeyAccessFreq(pk)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+		conn.WriteInt(freq)
+	case "refcount":
+		conn.WriteInt(1)
+	}
+}
+
+// DBSIZE [namespace]
+// return the key count of the namespace (or all the namespaces) from the partitions led by
+// this node, the size of the whole namespace is the sum of all the nodes.
+func (s *Server) doDBSizeCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) > 2 {
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
+		return
+	}
+	ns := ""
+	if len(cmd.Args) == 2 {
+		ns = string(cmd.Args[1])
+	}
+	tStats, err := s.nsMgr.GetTableStats(ns, "")
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	total := int64(0)
+	for _, ts := range tStats {
+		total += ts.KeyNum
+	}
+	conn.WriteInt64(total)
+}
+
+// TABLESIZE namespace [table]
+// return the key count and the approximate disk bytes of each table from the partitions led
+// by this node, as the array of [table, keys, bytes].
+func (s *Server) doTableSizeCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 3 {
+		conn.WriteError(common.WrongArgsNumError(cmd.Args[0]))
+		return
+	}
+	table := ""
+	if len(cmd.Args) == 3 {
+		table = string(cmd.Args[2])
+	}
+	tStats, err := s.nsMgr.GetTableStats(string(cmd.Args[1]), table)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(tStats))
+	for _, ts := range tStats {
+		conn.WriteArray(3)
+		conn.WriteBulkString(ts.Name)
+		conn.WriteInt64(ts.KeyNum)
+		conn.WriteInt64(ts.DiskBytesUsage)
+	}
+}
+
+// APPLIEDINDEX key
+// return the applied index, the committed index and whether the node is the leader of the
+// partition of the key, the applied index after the write can be used to order the operations
+// while checking the history.
+func (s *Server) doAppliedIndexCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) != 2 {
+		conn.WriteError("ERR wrong number of arguments for 'appliedindex' command")
+		return
+	}
+	namespace, pk, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	n, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(namespace, pk)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	isLeader := int64(0)
+	if n.Node.IsLead() {
+		isLeader = 1
+	}
+	conn.WriteArray(3)
+	conn.WriteInt64(int64(n.Node.GetAppliedIndex()))
+	conn.WriteInt64(int64(n.Node.GetCommittedIndex()))
+	conn.WriteInt64(isLeader)
+}
+
 func (s *Server) serveRedisAPI(port int, stopC <-chan struct{}) {
 	redisS := redcon.NewServer(
 		":"+strconv.Itoa(port),
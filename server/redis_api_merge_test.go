@@ -365,6 +365,51 @@ func TestKVMergeScanCrossTable(t *testing.T) {
 	}
 }
 
+func TestKVMergeScanAllPartitions(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	for i := 0; i < 20; i++ {
+		if _, err := c.Do("set", "default:testscanallpart:"+fmt.Sprintf("%d", i), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, localOnly := range []bool{false, true} {
+		keys := make(map[string]bool)
+		cursor := "default:testscanallpart:"
+		for loop := 0; loop < 100; loop++ {
+			args := []interface{}{cursor, "COUNT", 3}
+			if localOnly {
+				args = append(args, scanLocalOnlyFlag)
+			}
+			ay, err := goredis.Values(c.Do("SCAN", args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ay) != 2 {
+				t.Fatal(len(ay))
+			}
+			a, err := goredis.Strings(ay[1], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range a {
+				keys[k] = true
+			}
+			next := string(ay[0].([]byte))
+			if next == "" {
+				break
+			}
+			cursor = "default:testscanallpart:" + next
+		}
+		assert.Equal(t, 20, len(keys))
+		for i := 0; i < 20; i++ {
+			assert.True(t, keys[fmt.Sprintf("%d", i)])
+		}
+	}
+}
+
 func TestStrHindexMergeSearch(t *testing.T) {
 	c := getMergeTestConn(t)
 	defer c.Close()
@@ -1,12 +1,14 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"path"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -548,6 +550,236 @@ func TestKVErrorParams(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestKVGetSetAndErrorReply(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:kv_getset"
+	key2 := "default:test:kv_reply_err"
+	_, err := goredis.String(c.Do("getset", key1, "v1"))
+	assert.Equal(t, goredis.ErrNil, err)
+	v, err := goredis.String(c.Do("getset", key1, "v2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", v)
+	v, err = goredis.String(c.Do("get", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", v)
+
+	_, err = c.Do("getset", key1)
+	assert.Equal(t, "ERR wrong number of arguments for 'getset' command", err.Error())
+	_, err = c.Do("incr", key1)
+	assert.Equal(t, "ERR value is not an integer or out of range", err.Error())
+	_, err = c.Do("incrby", key2, "nan")
+	assert.Equal(t, "ERR value is not an integer or out of range", err.Error())
+	_, err = c.Do("setex", key2, 0, "v")
+	assert.Equal(t, "ERR invalid expire time in 'setex' command", err.Error())
+	_, err = c.Do("setex", key2, 10)
+	assert.Equal(t, "ERR wrong number of arguments for 'setex' command", err.Error())
+	_, err = c.Do("zrangebyscore", key2, "a", 4)
+	assert.Equal(t, "ERR min or max is not a float", err.Error())
+	_, err = c.Do("zrangebylex", key2, "a", "+")
+	assert.Equal(t, "ERR min or max not valid string range item", err.Error())
+}
+
+func TestKVTypeAndObject(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	keys := map[string]string{
+		"string": "default:test:type_kv",
+		"hash":   "default:test:type_hash",
+		"list":   "default:test:type_list",
+		"set":    "default:test:type_set",
+		"zset":   "default:test:type_zset",
+	}
+	c.Do("set", keys["string"], "123")
+	c.Do("hset", keys["hash"], "f", "v")
+	c.Do("lpush", keys["list"], "v")
+	c.Do("sadd", keys["set"], "v")
+	c.Do("zadd", keys["zset"], 1, "v")
+	for tn, key := range keys {
+		v, err := goredis.String(c.Do("type", key))
+		assert.Nil(t, err)
+		assert.Equal(t, tn, v)
+	}
+	v, err := goredis.String(c.Do("type", "default:test:type_none"))
+	assert.Nil(t, err)
+	assert.Equal(t, "none", v)
+
+	v, err = goredis.String(c.Do("object", "encoding", keys["string"]))
+	assert.Nil(t, err)
+	assert.Equal(t, "int", v)
+	v, err = goredis.String(c.Do("object", "encoding", keys["zset"]))
+	assert.Nil(t, err)
+	assert.Equal(t, "skiplist", v)
+	_, err = goredis.String(c.Do("object", "encoding", "default:test:type_none"))
+	assert.Equal(t, goredis.ErrNil, err)
+	_, err = c.Do("object", "idletime", keys["string"])
+	assert.NotNil(t, err)
+	_, err = c.Do("object", "unknown", keys["string"])
+	assert.NotNil(t, err)
+
+	node.SetAccessSampleRate(100)
+	defer node.SetAccessSampleRate(0)
+	c.Do("get", keys["string"])
+	n, err := goredis.Int(c.Do("object", "idletime", keys["string"]))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("object", "freq", keys["string"]))
+	assert.Nil(t, err)
+	assert.True(t, n > 0, "freq should be positive: %v", n)
+	// the key not accessed since the tracking enabled
+	_, err = goredis.Int(c.Do("object", "idletime", keys["hash"]))
+	assert.Equal(t, goredis.ErrNil, err)
+}
+
+func TestDBSizeAndTableSize(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		c.Do("set", "default:tsize_test:k"+strconv.Itoa(i), "v")
+	}
+	c.Do("hset", "default:tsize_test:hkey", "f", "v")
+	n, err := goredis.Int64(c.Do("dbsize", "default"))
+	assert.Nil(t, err)
+	assert.True(t, n >= 11, "dbsize should include all the keys: %v", n)
+	total, err := goredis.Int64(c.Do("dbsize"))
+	assert.Nil(t, err)
+	assert.True(t, total >= n, "dbsize of all namespaces should be larger: %v, %v", total, n)
+
+	rsp, err := goredis.MultiBulk(c.Do("tablesize", "default", "tsize_test"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rsp))
+	ts := rsp[0].([]interface{})
+	assert.Equal(t, "tsize_test", string(ts[0].([]byte)))
+	assert.Equal(t, int64(11), ts[1].(int64))
+
+	rsp, err = goredis.MultiBulk(c.Do("tablesize", "default"))
+	assert.Nil(t, err)
+	assert.True(t, len(rsp) >= 1, "tables should be returned: %v", rsp)
+	_, err = c.Do("dbsize", "not_exist_ns")
+	assert.NotNil(t, err)
+	_, err = c.Do("tablesize")
+	assert.NotNil(t, err)
+}
+
+func TestFlushTableAndNamespace(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		c.Do("set", "default:flush_test:k"+strconv.Itoa(i), "v")
+		c.Do("set", "default:flush_test2:k"+strconv.Itoa(i), "v")
+	}
+	c.Do("hset", "default:flush_test:hkey", "f", "v")
+	// nothing flushed without the confirm token
+	token, err := goredis.String(c.Do("flushtable", "default", "flush_test"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", token)
+	v, err := goredis.String(c.Do("get", "default:flush_test:k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+	// the token can not be used for the other table
+	_, err = c.Do("flushtable", "default", "flush_test2", token)
+	assert.NotNil(t, err)
+
+	rsp, err := goredis.String(c.Do("flushtable", "default", "flush_test", token))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", rsp)
+	n, err := goredis.Int(c.Do("exists", "default:flush_test:k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("hexists", "default:flush_test:hkey", "f"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("exists", "default:flush_test2:k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	// the token can be used only once
+	_, err = c.Do("flushtable", "default", "flush_test", token)
+	assert.NotNil(t, err)
+
+	// the default namespace is shared by the other tests, only the interlock is checked
+	token, err = goredis.String(c.Do("flushns", "default"))
+	assert.Nil(t, err)
+	_, err = c.Do("flushns", "default", "invalid_token")
+	assert.NotNil(t, err)
+	_, err = c.Do("flushtable", "default", "flush_test2", token)
+	assert.NotNil(t, err)
+	n, err = goredis.Int(c.Do("exists", "default:flush_test2:k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = c.Do("flushns", "not_exist_ns")
+	assert.NotNil(t, err)
+	_, err = c.Do("flushtable", "default")
+	assert.NotNil(t, err)
+
+	// the table with the secondary index can not be flushed, and the namespace should
+	// be validated before flushing any table
+	table := "flush_index_test"
+	sc := &node.SchemaChange{
+		Type:  node.SchemaChangeAddHsetIndex,
+		Table: table,
+	}
+	sc.SchemaData, _ = json.Marshal(&common.HsetIndexSchema{
+		Name:       "flush_hindex_test",
+		IndexField: "f",
+		ValueType:  common.StringV,
+		State:      common.InitIndex,
+	})
+	nsNode := kvs.GetNamespaceFromFullName("default-0")
+	assert.Nil(t, nsNode.Node.ProposeChangeTableSchema(table, sc))
+	time.Sleep(time.Second)
+	c.Do("hset", "default:"+table+":hkey", "f", "v")
+	_, err = c.Do("flushtable", "default", table)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), table), err.Error())
+	_, err = c.Do("flushns", "default")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), table), err.Error())
+	n, err = goredis.Int(c.Do("exists", "default:flush_test2:k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("hexists", "default:"+table+":hkey", "f"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestClientRequestIDMergeWrite(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:reqid_merge1"
+	key2 := "default:test:reqid_merge2"
+	c.Do("set", key1, "v")
+	c.Do("set", key2, "v")
+	rsp, err := goredis.String(c.Do("reqid", 100, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, OK, rsp)
+	n, err := goredis.Int(c.Do("del", key1, key2))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	c.Do("set", key1, "v")
+	// the retried merge write should not be applied again
+	c.Do("reqid", 100, 1)
+	c.Do("del", key1, key2)
+	n, err = goredis.Int(c.Do("exists", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// the request id is cleared by the next command even if it is not a write
+	c.Do("reqid", 100, 2)
+	c.Do("get", key1)
+	c.Do("set", key2, "v1")
+	c.Do("reqid", 100, 2)
+	c.Do("set", key2, "v2")
+	v, err := goredis.String(c.Do("get", key2))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", v)
+}
+
 func TestPFOp(t *testing.T) {
 	if testing.Verbose() {
 		rockredis.SetLogger(int32(common.LOG_DETAIL), newTestLogger(t))
@@ -2529,6 +2761,61 @@ func TestZSetScan(t *testing.T) {
 	}
 }
 
+func TestCollectionScanWithCursor(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	hkey := "default:testscan:scan_cursor_hash"
+	zkey := "default:testscan:scan_cursor_zset"
+	for i := 0; i < 10; i++ {
+		c.Do("HSET", hkey, fmt.Sprintf("f%d", i), i)
+		c.Do("ZADD", zkey, i, fmt.Sprintf("m%d", i))
+	}
+	c.Do("HSET", hkey, "other", "v")
+
+	// the cursor 0 is same as the empty cursor to start the scan
+	fields := make(map[string]int)
+	cursor := "0"
+	chunks := 0
+	for {
+		ay, err := goredis.Values(c.Do("HSCAN", hkey, cursor, "MATCH", "f*", "COUNT", 3))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(ay))
+		fvs, err := goredis.Strings(ay[1], nil)
+		assert.Nil(t, err)
+		assert.True(t, len(fvs) <= 6, "the examined fields should not exceed the count: %v", fvs)
+		for i := 0; i < len(fvs); i += 2 {
+			assert.NotEqual(t, "other", fvs[i])
+			fields[fvs[i]]++
+		}
+		chunks++
+		cursor = string(ay[0].([]byte))
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, 10, len(fields))
+	for f, n := range fields {
+		assert.Equal(t, 1, n, "field %v returned more than once", f)
+	}
+	assert.Equal(t, 4, chunks)
+
+	ay, err := goredis.Values(c.Do("ZSCAN", zkey, "", "COUNT", 5))
+	assert.Nil(t, err)
+	checkScanValues(t, ay[1], "m0", 0, "m1", 1, "m2", 2, "m3", 3, "m4", 4)
+	ay, err = goredis.Values(c.Do("ZSCAN", zkey, ay[0], "COUNT", 5))
+	assert.Nil(t, err)
+	checkScanValues(t, ay[1], "m5", 5, "m6", 6, "m7", 7, "m8", 8, "m9", 9)
+	ay, err = goredis.Values(c.Do("ZSCAN", zkey, ay[0], "COUNT", 5))
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(ay[0].([]byte)))
+	assert.Equal(t, 0, len(ay[1].([]interface{})))
+
+	// the raw member is not a valid cursor
+	_, err = c.Do("SSCAN", "default:test:scan_set", "a")
+	assert.NotNil(t, err)
+}
+
 func TestJSON(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
@@ -2823,3 +3110,25 @@ func TestJSONErrorParams(t *testing.T) {
 		t.Fatalf("invalid err of %v", err)
 	}
 }
+
+func TestNamespaceHealth(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	_, err := goredis.String(c.Do("set", "default:test:health_key", "1"))
+	assert.Nil(t, err)
+	healthList, err := kvs.GetNamespaceHealth("default", defaultHealthMaxApplyGap)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(healthList))
+	h := healthList[0]
+	assert.Equal(t, "default-0", h.Name)
+	assert.True(t, h.Healthy)
+	assert.True(t, h.HasLeader)
+	assert.True(t, h.IsLeader)
+	assert.True(t, h.AppliedIndex > 0)
+	assert.True(t, h.LastApplyTime > 0)
+	assert.Equal(t, int64(0), h.PendingProposals)
+
+	_, err = kvs.GetNamespaceHealth("health_not_exist", defaultHealthMaxApplyGap)
+	assert.NotNil(t, err)
+}
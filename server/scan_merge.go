@@ -75,11 +75,18 @@ func (s *Server) doScanCommon(cmd redcon.Command) ([]interface{}, []byte, error)
 		handlers, cmds, _, err := s.GetMergeHandlers(cmd)
 		if err == nil {
 			length := len(handlers)
+			// the count is the number of keys examined, so each partition
+			// should examine at least one key to make progress
 			everyCount := count / length
+			if everyCount <= 0 {
+				everyCount = 1
+			}
 			results = make([]interface{}, length)
 			for i, h := range handlers {
 				wg.Add(1)
-				cmds[i].Args[countIndex] = []byte(strconv.Itoa(everyCount))
+				if countIndex > 0 {
+					cmds[i].Args[countIndex] = []byte(strconv.Itoa(everyCount))
+				}
 				go func(index int, handle common.MergeCommandFunc) {
 					defer wg.Done()
 					var err error
@@ -213,8 +220,35 @@ func (s *Server) doMergeFullScan(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+// scan all the partitions of the namespace, the partitions led by the remote nodes
+// will be forwarded to the remote and all the cursors will be merged into one.
 func (s *Server) doMergeScan(conn redcon.Conn, cmd redcon.Command) {
-	results, table, err := s.doScanCommon(cmd)
+	cmd, localOnly := stripScanLocalOnly(cmd)
+	var remoteJobs []*remoteScanJob
+	scanLocal := true
+	if !localOnly {
+		var err error
+		cmd, remoteJobs, scanLocal, err = s.splitRemoteScan(cmd)
+		if err != nil {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+	}
+	var wg sync.WaitGroup
+	for _, job := range remoteJobs {
+		wg.Add(1)
+		go func(job *remoteScanJob) {
+			defer wg.Done()
+			s.doRemoteScan(string(cmd.Args[0]), job)
+		}(job)
+	}
+	var results []interface{}
+	var table []byte
+	var err error
+	if scanLocal {
+		results, table, err = s.doScanCommon(cmd)
+	}
+	wg.Wait()
 	if err != nil {
 		conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
 		return
@@ -254,15 +288,31 @@ func (s *Server) doMergeScan(conn redcon.Conn, cmd redcon.Command) {
 		}
 	}
 
+	remoteCnt := 0
+	for _, job := range remoteJobs {
+		if job.err != nil {
+			conn.WriteError(job.err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		nextCursorBytes = append(nextCursorBytes, job.nextCursor...)
+		remoteCnt += len(job.keys)
+	}
+
 	nextCursor := base64.StdEncoding.EncodeToString(nextCursorBytes)
 	conn.WriteArray(2)
 	conn.WriteBulkString(nextCursor)
 
-	conn.WriteArray(len(result))
+	conn.WriteArray(len(result) + remoteCnt)
 	tabLen := len(table)
 	for _, v := range result {
 		conn.WriteBulk(v.([]byte)[tabLen+1:])
 	}
+	// the keys from remote have no table prefix
+	for _, job := range remoteJobs {
+		for _, k := range job.keys {
+			conn.WriteBulk(k)
+		}
+	}
 
 }
 
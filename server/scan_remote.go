@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/redcon"
+	"github.com/siddontang/goredis"
+)
+
+// while scanning the namespace, the partitions led by other nodes will be
+// forwarded to the remote leader with this flag appended, so the remote server
+// will only scan the partitions on itself without forwarding again.
+const scanLocalOnlyFlag = "__localonly"
+
+const remoteScanMaxIdleConns = 4
+
+var errRemoteScanResp = errors.New("invalid scan response from remote")
+
+type remoteScanClients struct {
+	sync.Mutex
+	clients map[string]*goredis.Client
+}
+
+func newRemoteScanClients() *remoteScanClients {
+	return &remoteScanClients{
+		clients: make(map[string]*goredis.Client),
+	}
+}
+
+func (rsc *remoteScanClients) Get(addr string) (*goredis.PoolConn, error) {
+	rsc.Lock()
+	c, ok := rsc.clients[addr]
+	if !ok {
+		c = goredis.NewClient(addr, "")
+		c.SetMaxIdleConns(remoteScanMaxIdleConns)
+		rsc.clients[addr] = c
+	}
+	rsc.Unlock()
+	return c.Get()
+}
+
+func (rsc *remoteScanClients) Close() {
+	rsc.Lock()
+	for addr, c := range rsc.clients {
+		c.Close()
+		delete(rsc.clients, addr)
+	}
+	rsc.Unlock()
+}
+
+type remoteScanJob struct {
+	addr string
+	args []interface{}
+	keys [][]byte
+	// the decoded cursor for the partitions scanned by remote
+	nextCursor []byte
+	err        error
+}
+
+func stripScanLocalOnly(cmd redcon.Command) (redcon.Command, bool) {
+	last := len(cmd.Args) - 1
+	if last >= 2 && strings.ToLower(string(cmd.Args[last])) == scanLocalOnlyFlag {
+		cmd.Args = cmd.Args[:last]
+		return cmd, true
+	}
+	return cmd, false
+}
+
+func appendScanCursor(cursors []byte, pid int, cursor []byte) []byte {
+	cursors = append(cursors, []byte(strconv.Itoa(pid))...)
+	cursors = append(cursors, common.SCAN_NODE_SEP...)
+	cursors = append(cursors, []byte(base64.StdEncoding.EncodeToString(cursor))...)
+	cursors = append(cursors, common.SCAN_CURSOR_SEP...)
+	return cursors
+}
+
+// split the namespace scan by the partition leaders, the partitions led by the remote nodes
+// will be scanned by the remote jobs and the returned command is used to scan the local partitions.
+// The returned bool will be false if no local partition need to be scanned.
+func (s *Server) splitRemoteScan(cmd redcon.Command) (redcon.Command, []*remoteScanJob, bool, error) {
+	if s.dataCoord == nil || len(cmd.Args) < 2 {
+		return cmd, nil, true, nil
+	}
+	namespace, rk, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return cmd, nil, false, err
+	}
+	leaders, err := s.dataCoord.GetNamespaceLeaderRedisAddrs(namespace)
+	if err != nil {
+		return cmd, nil, false, err
+	}
+	hasRemote := false
+	for _, addr := range leaders {
+		if addr != "" {
+			hasRemote = true
+			break
+		}
+	}
+	if !hasRemote {
+		return cmd, nil, true, nil
+	}
+	table, _, err := common.ExtractTable(rk)
+	if err != nil {
+		return cmd, nil, false, err
+	}
+	nsMap, err := s.decodeScanCursor(rk, namespace)
+	if err != nil {
+		return cmd, nil, false, err
+	}
+
+	var localCursors []byte
+	localParts := 0
+	remoteTotal := 0
+	remoteCursors := make(map[string][]byte)
+	remoteParts := make(map[string]int)
+	for pid, addr := range leaders {
+		var cursor []byte
+		if len(nsMap) > 0 {
+			c, ok := nsMap[common.GetNsDesp(namespace, pid)]
+			if !ok {
+				// this partition is already finished
+				continue
+			}
+			// the cursor in map is table:cursor
+			cursor = []byte(c[len(table)+1:])
+		}
+		if addr == "" {
+			localCursors = appendScanCursor(localCursors, pid, cursor)
+			localParts++
+		} else {
+			remoteCursors[addr] = appendScanCursor(remoteCursors[addr], pid, cursor)
+			remoteParts[addr]++
+			remoteTotal++
+		}
+	}
+
+	count := 0
+	countIndex := 0
+	for i := 2; i < len(cmd.Args); i++ {
+		if strings.ToLower(string(cmd.Args[i])) == "count" {
+			if i+1 >= len(cmd.Args) {
+				return cmd, nil, false, common.ErrInvalidArgs
+			}
+			countIndex = i + 1
+			count, err = strconv.Atoi(string(cmd.Args[i+1]))
+			if err != nil {
+				return cmd, nil, false, err
+			}
+			break
+		}
+	}
+	everyCount := 0
+	if total := localParts + remoteTotal; countIndex > 0 && total > 0 {
+		// each partition should examine at least one key to make progress
+		everyCount = count / total
+		if everyCount <= 0 {
+			everyCount = 1
+		}
+	}
+
+	jobs := make([]*remoteScanJob, 0, len(remoteCursors))
+	for addr, cursors := range remoteCursors {
+		job := &remoteScanJob{addr: addr}
+		job.args = make([]interface{}, 0, len(cmd.Args))
+		job.args = append(job.args, namespace+":"+string(table)+":"+base64.StdEncoding.EncodeToString(cursors))
+		for i := 2; i < len(cmd.Args); i++ {
+			if i == countIndex {
+				job.args = append(job.args, strconv.Itoa(everyCount*remoteParts[addr]))
+			} else {
+				job.args = append(job.args, cmd.Args[i])
+			}
+		}
+		job.args = append(job.args, scanLocalOnlyFlag)
+		jobs = append(jobs, job)
+	}
+
+	if localParts == 0 {
+		return cmd, jobs, false, nil
+	}
+	// use the explicit cursor for local partitions to avoid scanning the partition
+	// which is changing the leader to the remote node.
+	localCmd := common.DeepCopyCmd(cmd)
+	localCmd.Args[1] = []byte(namespace + ":" + string(table) + ":" + base64.StdEncoding.EncodeToString(localCursors))
+	if countIndex > 0 {
+		localCmd.Args[countIndex] = []byte(strconv.Itoa(everyCount * localParts))
+	}
+	return localCmd, jobs, true, nil
+}
+
+func (s *Server) doRemoteScan(cmdName string, job *remoteScanJob) {
+	conn, err := s.remoteScanClients.Get(job.addr)
+	if err != nil {
+		job.err = err
+		return
+	}
+	defer conn.Close()
+	rsp, err := goredis.Values(conn.Do(cmdName, job.args...))
+	if err != nil {
+		job.err = err
+		return
+	}
+	if len(rsp) != 2 {
+		job.err = errRemoteScanResp
+		return
+	}
+	cursor, err := goredis.String(rsp[0], nil)
+	if err != nil {
+		job.err = err
+		return
+	}
+	job.nextCursor, err = base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		job.err = errRemoteScanResp
+		return
+	}
+	keys, err := goredis.Values(rsp[1], nil)
+	if err != nil {
+		job.err = err
+		return
+	}
+	job.keys = make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		v, ok := k.([]byte)
+		if !ok {
+			job.err = errRemoteScanResp
+			return
+		}
+		job.keys = append(job.keys, v)
+	}
+}
@@ -2,10 +2,12 @@ package server
 
 import (
 	"bytes"
+	"sort"
 	"strconv"
 
 	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/absolute8511/ZanRedisDB/node"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
 	"github.com/absolute8511/redcon"
 )
 
@@ -13,23 +15,21 @@ func isValidPostSearchCmd(cmd string) bool {
 	return cmd == "hget" || cmd == "hmget" || cmd == "hgetall"
 }
 
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [ORDER BY ASC|DESC] [LIMIT offset num] [HGET $ field2]
 func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
-	var postCmd string
-	if len(cmd.Args) >= 5 {
-		postCmd = string(cmd.Args[4])
-		if !isValidPostSearchCmd(postCmd) {
-			conn.WriteError(common.ErrInvalidArgs.Error())
-			return
-		}
-	}
-
 	sLog.Debugf("secondary index query cmd: %v, %v", string(cmd.Raw), len(cmd.Args))
 	if len(cmd.Args) < 4 {
 		conn.WriteError(common.ErrInvalidArgs.Error())
 		return
 	}
 	args := cmd.Args[4:]
+	ordered := false
+	reverse := false
+	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("order")) {
+		ordered = true
+		reverse = bytes.Equal(bytes.ToLower(args[2]), []byte("desc"))
+		args = args[3:]
+	}
 	origOffset := 0
 	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("limit")) {
 		offset, err := strconv.Atoi(string(args[1]))
@@ -39,8 +39,17 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 		}
 		origOffset = offset
 		args[1] = []byte("0")
+		args = args[3:]
 	}
 	_ = origOffset
+	var postCmd string
+	if len(args) > 0 {
+		postCmd = string(args[0])
+		if !isValidPostSearchCmd(postCmd) {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+	}
 
 	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
 	if err != nil {
@@ -71,6 +80,23 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 		}
 		hsetResults = append(hsetResults, realRes.Rets...)
 	}
+	if ordered {
+		// merge the ordered results from all the partitions
+		sorted := make(common.SearchResultHeap, 0, len(hsetResults))
+		for i := range hsetResults {
+			sorted = append(sorted, &hsetResults[i])
+		}
+		if reverse {
+			sort.Sort(sort.Reverse(sorted))
+		} else {
+			sort.Sort(sorted)
+		}
+		merged := make([]common.HIndexRespWithValues, 0, len(sorted))
+		for _, v := range sorted {
+			merged = append(merged, *v)
+		}
+		hsetResults = merged
+	}
 	if postCmd != "" {
 		conn.WriteArray(len(hsetResults) * 3)
 	} else {
@@ -91,6 +117,8 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 			conn.WriteInt64(realV)
 		case int32:
 			conn.WriteInt64(int64(realV))
+		case float64:
+			conn.WriteBulkString(strconv.FormatFloat(realV, 'g', -1, 64))
 		default:
 			conn.WriteError("Invalid response type for index value")
 		}
@@ -111,3 +139,121 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 		}
 	}
 }
+
+// ZIDX.FROM ns:table member min max [LIMIT offset num]
+// the results from all the partitions will be sorted by the score
+func (s *Server) doMergeZsetIndexSearch(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 5 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	zsetResults := make([]rockredis.ZIndexResp, 0)
+	var table string
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.ZindexSearchResults)
+		if !ok {
+			sLog.Infof("invalid response for search : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError("Invalid response type : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		table = realRes.Table
+		zsetResults = append(zsetResults, realRes.Rets...)
+	}
+	sort.SliceStable(zsetResults, func(i, j int) bool {
+		if zsetResults[i].Score == zsetResults[j].Score {
+			return bytes.Compare(zsetResults[i].PKey, zsetResults[j].PKey) < 0
+		}
+		return zsetResults[i].Score < zsetResults[j].Score
+	})
+	conn.WriteArray(len(zsetResults) * 2)
+	for _, res := range zsetResults {
+		if len(res.PKey) > len(table) && string(res.PKey[:len(table)]) == table {
+			conn.WriteBulk(res.PKey[len(table)+1:])
+		} else {
+			conn.WriteBulk(res.PKey)
+		}
+		conn.WriteBulkString(strconv.FormatFloat(res.Score, 'g', -1, 64))
+	}
+}
+
+// FT.SEARCH ns:table index "term1 prefix*" [LIMIT offset num]
+// each partition returns the top offset+num results, and the merged results will be
+// ranked by the score again before applying the limit.
+func (s *Server) doMergeFullTextSearch(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 4 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	offset := 0
+	count := -1
+	if len(cmd.Args) >= 7 && bytes.Equal(bytes.ToLower(cmd.Args[4]), []byte("limit")) {
+		var err error
+		offset, err = strconv.Atoi(string(cmd.Args[5]))
+		if err != nil || offset < 0 {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		count, err = strconv.Atoi(string(cmd.Args[6]))
+		if err != nil {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		cmd.Args[5] = []byte("0")
+		if count >= 0 {
+			cmd.Args[6] = []byte(strconv.Itoa(offset + count))
+		}
+	}
+	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	ftResults := make([]rockredis.FTSearchResp, 0)
+	var table string
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.FullTextSearchResults)
+		if !ok {
+			sLog.Infof("invalid response for search : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError("Invalid response type : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		table = realRes.Table
+		ftResults = append(ftResults, realRes.Rets...)
+	}
+	sort.SliceStable(ftResults, func(i, j int) bool {
+		if ftResults[i].Score == ftResults[j].Score {
+			return bytes.Compare(ftResults[i].PKey, ftResults[j].PKey) < 0
+		}
+		return ftResults[i].Score > ftResults[j].Score
+	})
+	if offset >= len(ftResults) {
+		ftResults = nil
+	} else {
+		ftResults = ftResults[offset:]
+		if count >= 0 && count < len(ftResults) {
+			ftResults = ftResults[:count]
+		}
+	}
+	conn.WriteArray(len(ftResults) * 2)
+	for _, res := range ftResults {
+		if len(res.PKey) > len(table) && string(res.PKey[:len(table)]) == table {
+			conn.WriteBulk(res.PKey[len(table)+1:])
+		} else {
+			conn.WriteBulk(res.PKey)
+		}
+		conn.WriteBulkString(strconv.FormatFloat(res.Score, 'g', -1, 64))
+	}
+}
@@ -6,21 +6,24 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/absolute8511/ZanRedisDB/rockredis"
+	"github.com/absolute8511/ZanRedisDB/engine"
 
 	"github.com/absolute8511/ZanRedisDB/cluster"
 	"github.com/absolute8511/ZanRedisDB/cluster/datanode_coord"
 	"github.com/absolute8511/ZanRedisDB/common"
 	"github.com/absolute8511/ZanRedisDB/node"
+	"github.com/absolute8511/ZanRedisDB/pkg/fileutil"
 	"github.com/absolute8511/ZanRedisDB/pkg/types"
 	"github.com/absolute8511/ZanRedisDB/raft"
 	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+	"github.com/absolute8511/ZanRedisDB/rockredis"
 	"github.com/absolute8511/ZanRedisDB/stats"
 	"github.com/absolute8511/ZanRedisDB/transport/rafthttp"
 	"github.com/absolute8511/redcon"
@@ -31,6 +34,8 @@ var (
 	errRaftGroupNotReady = errors.New("raft group not ready")
 )
 
+const defaultRsyncModule = "zanredisdb"
+
 var sLog = common.NewLevelLogger(common.LOG_INFO, common.NewDefaultLogger("server"))
 
 func SetLogger(level int32, logger common.Logger) {
@@ -54,6 +59,15 @@ type Server struct {
 	startTime     time.Time
 	maxScanJob    int32
 	scanStats     common.ScanStats
+	// limit the outgoing snapshot transfers
+	snapSendLimiter *common.SnapSendLimiter
+	// the redis clients to the leaders of remote partitions while scanning
+	remoteScanClients *remoteScanClients
+	auditSink         node.AuditSink
+	writeLimiter      *writeRateLimiter
+
+	// the confirm tokens of the FLUSHTABLE and FLUSHNS commands
+	flushTokens flushConfirmTokens
 }
 
 func NewServer(conf ServerConfig) *Server {
@@ -75,6 +89,9 @@ func NewServer(conf ServerConfig) *Server {
 	}
 
 	if conf.SyncerWriteOnly {
+		if conf.ActiveActiveSync {
+			sLog.Fatalf("syncer write only can not be used with active-active sync")
+		}
 		node.SetSyncerOnly(true)
 	}
 	if conf.LearnerRole != "" && conf.SyncerNormalInit {
@@ -91,7 +108,7 @@ func NewServer(conf ServerConfig) *Server {
 		Version:     common.VerBinary,
 		Tags:        make(map[string]interface{}),
 		DataRoot:    conf.DataDir,
-		RsyncModule: "zanredisdb",
+		RsyncModule: defaultRsyncModule,
 		LearnerRole: conf.LearnerRole,
 	}
 	if conf.DataRsyncModule != "" {
@@ -124,6 +141,11 @@ func NewServer(conf ServerConfig) *Server {
 		startTime:  time.Now(),
 		maxScanJob: conf.MaxScanJob,
 	}
+	s.remoteScanClients = newRemoteScanClients()
+	s.snapSendLimiter = common.NewSnapSendLimiter(conf.SnapshotMaxOutgoing, conf.SnapshotMaxBandwidth)
+	if conf.SnapshotMaxRecvBandwidth > 0 {
+		common.SetSnapRecvBandwidth(conf.SnapshotMaxRecvBandwidth)
+	}
 
 	ts := &stats.TransportStats{}
 	ts.Initialize()
@@ -135,28 +157,99 @@ func NewServer(conf ServerConfig) *Server {
 		TrStats:     ts,
 		PeersStats:  stats.NewPeersStats(),
 		ErrorC:      nil,
+
+		MaxPeerPendingBytes: conf.RaftMaxPeerPendingBytes,
 	}
 	mconf := &node.MachineConfig{
-		BroadcastAddr:     conf.BroadcastAddr,
-		HttpAPIPort:       conf.HttpAPIPort,
-		LocalRaftAddr:     conf.LocalRaftAddr,
-		DataRootDir:       conf.DataDir,
-		TickMs:            conf.TickMs,
-		ElectionTick:      conf.ElectionTick,
-		LearnerRole:       conf.LearnerRole,
-		RemoteSyncCluster: conf.RemoteSyncCluster,
-		StateMachineType:  conf.StateMachineType,
-		RocksDBOpts:       conf.RocksDBOpts,
-	}
-	if mconf.RocksDBOpts.UseSharedCache || mconf.RocksDBOpts.AdjustThreadPool || mconf.RocksDBOpts.UseSharedRateLimiter {
-		sc := rockredis.NewSharedRockConfig(conf.RocksDBOpts)
+		BroadcastAddr:          conf.BroadcastAddr,
+		HttpAPIPort:            conf.HttpAPIPort,
+		LocalRaftAddr:          conf.LocalRaftAddr,
+		DataRootDir:            conf.DataDir,
+		WALRootDir:             conf.WALDir,
+		TickMs:                 conf.TickMs,
+		ElectionTick:           conf.ElectionTick,
+		LearnerRole:            conf.LearnerRole,
+		RemoteSyncCluster:      conf.RemoteSyncCluster,
+		StateMachineType:       conf.StateMachineType,
+		ApplyWorkerNum:         conf.ApplyWorkerNum,
+		ActiveActiveSync:       conf.ActiveActiveSync,
+		KafkaBrokers:           conf.KafkaBrokers,
+		KafkaTopicPrefix:       conf.KafkaTopicPrefix,
+		SyncerIncludeTables:    conf.SyncerIncludeTables,
+		SyncerExcludeTables:    conf.SyncerExcludeTables,
+		SyncerExcludeCmds:      conf.SyncerExcludeCmds,
+		SyncerNamespaceMapping: conf.SyncerNamespaceMapping,
+		SyncerTableMapping:     conf.SyncerTableMapping,
+		SyncerRedactTables:     conf.SyncerRedactTables,
+		SyncerRedactKey:        conf.SyncerRedactKey,
+		SyncerTransformers:     conf.SyncerTransformers,
+		SyncerTransformPlugin:  conf.SyncerTransformPlugin,
+		SyncerInitFromSnapshot: conf.SyncerInitFromSnapshot,
+		SyncerCompressType:     conf.SyncerCompressType,
+		SyncerMaxBandwidth:     conf.SyncerMaxBandwidth,
+		RemoteSyncClusters:     conf.RemoteSyncClusters,
+		SnapshotSyncByRsync:    conf.SnapshotSyncByRsync,
+		RocksDBOpts:            conf.RocksDBOpts,
+		RaftRepairMode:         conf.RaftRepairMode,
+		RaftRepairSkipEntries:  conf.RaftRepairSkipEntries,
+		MaxApplyBacklog:        conf.MaxApplyBacklog,
+		MaxPendingProposals:    conf.MaxPendingProposals,
+		BackpressureWaitMs:     conf.BackpressureWaitMs,
+		ReadReplicaMaxLag:      conf.ReadReplicaMaxLag,
+		ReadReplicaMaxStaleMs:  conf.ReadReplicaMaxStaleMs,
+
+		RaftLogCompressType:     conf.RaftLogCompressType,
+		RaftLogCompressMinBytes: conf.RaftLogCompressMinBytes,
+		WALBatchSync:            conf.WALBatchSync,
+		ReshardKeysPerSec:       conf.ReshardKeysPerSec,
+	}
+	if mconf.RocksDBOpts.UseSharedCache || mconf.RocksDBOpts.AdjustThreadPool ||
+		mconf.RocksDBOpts.UseSharedRateLimiter || mconf.RocksDBOpts.MemoryBudget > 0 {
+		sc := engine.NewSharedRockConfig(conf.RocksDBOpts)
 		mconf.RocksDBSharedConfig = sc
 	}
+	if conf.SnapshotEncryptKeyFile != "" {
+		kp, err := common.NewFileSnapKeyProvider(conf.SnapshotEncryptKeyFile)
+		if err != nil {
+			sLog.Fatalf("failed to load the snapshot encryption keys: %v", err)
+		}
+		mconf.SnapKeyProvider = kp
+	}
+	if conf.BackupTarget.Type != "" {
+		driver, err := common.NewBackupDriver(conf.BackupTarget)
+		if err != nil {
+			sLog.Fatalf("failed to init the backup target: %v", err)
+		}
+		mconf.BackupTarget = conf.BackupTarget
+		mconf.BackupDriver = driver
+	}
+	if conf.AuditSink != nil {
+		mconf.AuditSink = conf.AuditSink
+	} else if conf.AuditLogFile != "" {
+		sink, err := node.NewFileAuditSink(conf.AuditLogFile, conf.AuditLogMaxSizeMB*1024*1024, conf.AuditLogMaxBackups)
+		if err != nil {
+			sLog.Fatalf("failed to init the audit log: %v", err)
+		}
+		mconf.AuditSink = sink
+	}
+	s.auditSink = mconf.AuditSink
+	s.writeLimiter = newWriteRateLimiter(conf.WriteRateLimits)
+	common.RegisterDynamicConfApplier(common.DynConfWriteRateLimits, s.writeLimiter.applyDynamicConf)
 	s.nsMgr = node.NewNamespaceMgr(s.raftTransport, mconf)
 	myNode.RegID = mconf.NodeID
 
 	if conf.EtcdClusterAddresses != "" {
-		r := cluster.NewDNEtcdRegister(conf.EtcdClusterAddresses)
+		r, err := cluster.NewDNEtcdRegister(conf.EtcdClusterAddresses, &cluster.EtcdTLSConfig{
+			CertFile:   conf.EtcdCertFile,
+			KeyFile:    conf.EtcdKeyFile,
+			CACertFile: conf.EtcdCACertFile,
+		})
+		if err != nil {
+			sLog.Fatalf("failed to init etcd register: %v", err)
+		}
+		if err := r.CheckMetaMigrated(conf.ClusterID); err != nil {
+			sLog.Fatalf("failed to check the meta data in etcd: %v", err)
+		}
 		s.dataCoord = datanode_coord.NewDataCoordinator(conf.ClusterID, myNode, s.nsMgr)
 		if err := s.dataCoord.SetRegister(r); err != nil {
 			sLog.Fatalf("failed to init register for coordinator: %v", err)
@@ -185,7 +278,11 @@ func (s *Server) Stop() {
 	}
 	close(s.stopC)
 	s.raftTransport.Stop()
+	s.remoteScanClients.Close()
 	s.wg.Wait()
+	if s.auditSink != nil {
+		s.auditSink.Close()
+	}
 	sLog.Infof("server stopped")
 }
 
@@ -212,9 +309,55 @@ func (s *Server) GetStats(leaderOnly bool) common.ServerStats {
 	var ss common.ServerStats
 	ss.NSStats = s.nsMgr.GetStats(leaderOnly)
 	ss.ScanStats = s.scanStats.Copy()
+	if total, free, err := fileutil.DiskUsage(s.conf.DataDir); err == nil {
+		ss.Disk = &common.DiskStats{TotalBytes: total, FreeBytes: free}
+	}
 	return ss
 }
 
+// GetNamespaceHealth return the health of all the partitions on this node for the namespace
+// (all namespaces if empty), the partition is unhealthy if no leader or lagging too much.
+func (s *Server) GetNamespaceHealth(ns string, maxApplyGap uint64) ([]common.NamespaceHealth, error) {
+	var nodes map[string]*node.NamespaceNode
+	if ns != "" {
+		var err error
+		nodes, err = s.nsMgr.GetNamespaceNodes(ns, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		nodes = s.nsMgr.GetNamespaces()
+	}
+	healthList := make([]common.NamespaceHealth, 0, len(nodes))
+	for name, n := range nodes {
+		if !n.IsReady() {
+			healthList = append(healthList, common.NamespaceHealth{Name: name, Reason: "not ready"})
+			continue
+		}
+		h := n.Node.GetHealth()
+		h.Name = name
+		h.Healthy = true
+		if h.ApplyError != "" {
+			h.Healthy = false
+			h.Reason = "apply failed"
+		} else if h.CorruptedEntries > 0 {
+			h.Healthy = false
+			h.Reason = "corrupted raft entries"
+		} else if !h.HasLeader {
+			h.Healthy = false
+			h.Reason = "no leader"
+		} else if h.ApplyGap > maxApplyGap {
+			h.Healthy = false
+			h.Reason = "apply lagging"
+		}
+		healthList = append(healthList, h)
+	}
+	sort.Slice(healthList, func(i, j int) bool {
+		return healthList[i].Name < healthList[j].Name
+	})
+	return healthList, nil
+}
+
 func (s *Server) GetDBStats(leaderOnly bool) map[string]string {
 	return s.nsMgr.GetDBStats(leaderOnly)
 }
@@ -223,10 +366,107 @@ func (s *Server) OptimizeDB(ns string, table string) {
 	s.nsMgr.OptimizeDB(ns, table)
 }
 
+func (s *Server) CompactTableRange(ns string, table string, start []byte, end []byte) {
+	s.nsMgr.CompactTableRange(ns, table, start, end)
+}
+
+func (s *Server) GetCompactProgress(ns string) map[string]rockredis.CompactProgress {
+	return s.nsMgr.GetCompactProgress(ns)
+}
+
+func (s *Server) RecountTableKeys(ns string, table string) {
+	s.nsMgr.RecountTableKeys(ns, table)
+}
+
+func (s *Server) GetRecountStatus(ns string) map[string]rockredis.RecountStatus {
+	return s.nsMgr.GetRecountStatus(ns)
+}
+
+func (s *Server) GetReshardStatus(ns string) map[string]common.PartitionReshardStatus {
+	return s.nsMgr.GetReshardStatus(ns)
+}
+
+func (s *Server) ScanBigKeys(ns string, table string, minSize int64, minElements int64) {
+	s.nsMgr.ScanBigKeys(ns, table, minSize, minElements)
+}
+
+func (s *Server) GetBigKeyScanStatus(ns string) map[string]rockredis.BigKeyScanStatus {
+	return s.nsMgr.GetBigKeyScanStatus(ns)
+}
+
+func (s *Server) InspectTables(ns string, table string) {
+	s.nsMgr.InspectTables(ns, table)
+}
+
+func (s *Server) GetTableInspectStatus(ns string) map[string]rockredis.TableInspectStatus {
+	return s.nsMgr.GetTableInspectStatus(ns)
+}
+
+// StartConsistencyCheck propose the table checksum to all the partitions led by this node,
+// the raft index of the checksum for each partition will be returned.
+func (s *Server) StartConsistencyCheck(ns string, table string, bucketNum int) (map[string]uint64, error) {
+	nodes, err := s.nsMgr.GetNamespaceNodes(ns, true)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string]uint64, len(nodes))
+	for name, n := range nodes {
+		index, err := n.Node.ProposeTableChecksum(table, bucketNum)
+		if err != nil {
+			return nil, err
+		}
+		indexes[name] = index
+	}
+	return indexes, nil
+}
+
+// GetConsistencyReports compare the table checksums of the replicas for all the
+// partitions led by this node.
+func (s *Server) GetConsistencyReports(ns string, table string) (map[string]*common.ConsistencyReport, error) {
+	nodes, err := s.nsMgr.GetNamespaceNodes(ns, true)
+	if err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*common.ConsistencyReport, len(nodes))
+	for name, n := range nodes {
+		r, err := n.Node.CheckReplicaConsistency(table)
+		if err != nil {
+			sLog.Infof("check replica consistency for %v-%v failed: %v", name, table, err)
+			continue
+		}
+		reports[name] = r
+	}
+	return reports, nil
+}
+
 func (s *Server) DeleteRange(ns string, dtr node.DeleteTableRange) error {
 	return s.nsMgr.DeleteRange(ns, dtr)
 }
 
+func (s *Server) DropTable(ns string, table string) error {
+	return s.nsMgr.DropTable(ns, table)
+}
+
+func (s *Server) SetTableValueCompress(ns string, table string, vc common.ValueCompressSchema) error {
+	return s.nsMgr.SetTableValueCompress(ns, table, vc)
+}
+
+func (s *Server) SetTableZsetScoreIndex(ns string, table string, zi common.ZsetScoreIndexSchema) error {
+	return s.nsMgr.SetTableZsetScoreIndex(ns, table, zi)
+}
+
+func (s *Server) AddFullTextIndex(ns string, table string, ft common.FullTextIndexSchema) error {
+	return s.nsMgr.AddFullTextIndex(ns, table, ft)
+}
+
+func (s *Server) DelFullTextIndex(ns string, table string, name string) error {
+	return s.nsMgr.DelFullTextIndex(ns, table, name)
+}
+
+func (s *Server) SetDBOptions(ns string, o common.RockOptionsOverride) error {
+	return s.nsMgr.SetDBOptions(ns, o)
+}
+
 func (s *Server) InitKVNamespace(id uint64, conf *node.NamespaceConfig, join bool) (*node.NamespaceNode, error) {
 	return s.nsMgr.InitNamespaceNode(conf, id, join)
 }
@@ -297,14 +537,35 @@ func (s *Server) GetHandler(cmdName string, cmd redcon.Command) (bool, common.Co
 	if !ok {
 		return isWrite, nil, cmd, common.ErrInvalidCommand
 	}
-	if !isWrite && !n.Node.IsLead() && (atomic.LoadInt32(&allowStaleRead) == 0) {
-		// read only to leader to avoid stale read
-		// TODO: also read command can request the raft read index if not leader
-		return isWrite, nil, cmd, node.ErrNamespaceNotLeader
+	if err := checkNodeServable(n, isWrite); err != nil {
+		return isWrite, nil, cmd, err
+	}
+	if isWrite && !s.writeLimiter.Allow(namespace, pk) {
+		return isWrite, nil, cmd, errWriteThrottled
 	}
 	return isWrite, h, cmd, nil
 }
 
+// checkNodeServable check whether the command can be handled by the local replica, the read
+// is only served by the leader unless the stale read is allowed or it is the read only replica.
+func checkNodeServable(n *node.NamespaceNode, isWrite bool) error {
+	if isWrite {
+		if n.Node.IsReadReplica() {
+			return node.ErrReadOnlyReplica
+		}
+		return nil
+	}
+	if n.Node.IsLead() || atomic.LoadInt32(&allowStaleRead) == 1 {
+		return nil
+	}
+	if n.Node.IsReadReplica() {
+		return n.Node.CheckReadReplicaStaleness()
+	}
+	// read only to leader to avoid stale read
+	// TODO: also read command can request the raft read index if not leader
+	return node.ErrNamespaceNotLeader
+}
+
 func (s *Server) serveRaft(stopCh <-chan struct{}) {
 	url, err := url.Parse(s.conf.LocalRaftAddr)
 	if err != nil {
@@ -386,6 +386,19 @@ func TestStartClusterWithLogSyncer(t *testing.T) {
 	pr := raftStats.Progress[m.ID]
 	assert.Equal(t, true, pr.IsLearner)
 
+	replStats := leaderNode.Node.GetReplicationStats()
+	assert.True(t, replStats.AppliedIndex >= leaderci)
+	// two followers and one learner
+	assert.Equal(t, 3, len(replStats.Followers))
+	for _, f := range replStats.Followers {
+		assert.True(t, f.LastContact > 0)
+		assert.False(t, f.SnapshotInFlight)
+		if f.ReplicaID == m.ID {
+			assert.True(t, f.IsLearner)
+			assert.Equal(t, leaderci, f.MatchIndex)
+		}
+	}
+
 	learnerNode.Close()
 	time.Sleep(time.Second)
 	learnerNode = learnerServers[0].GetNamespaceFromFullName("default-0")
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/ZanRedisDB/node"
+	"github.com/absolute8511/redcon"
+)
+
+const defaultSlowLogGetNum = 10
+
+type nsSlowLogEntry struct {
+	node.SlowLogEntry
+	Namespace string
+}
+
+type nsSlowLogEntryList []nsSlowLogEntry
+
+func (l nsSlowLogEntryList) Len() int      { return len(l) }
+func (l nsSlowLogEntryList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l nsSlowLogEntryList) Less(i, j int) bool {
+	if l[i].Timestamp == l[j].Timestamp {
+		return l[i].Cost > l[j].Cost
+	}
+	return l[i].Timestamp > l[j].Timestamp
+}
+
+func (s *Server) getSlowLogNodes(namespace string) map[string]*node.NamespaceNode {
+	if namespace != "" {
+		nodes, err := s.nsMgr.GetNamespaceNodes(namespace, false)
+		if err != nil {
+			return nil
+		}
+		return nodes
+	}
+	return s.nsMgr.GetNamespaces()
+}
+
+// SLOWLOG GET [namespace] [count]
+// SLOWLOG LEN [namespace]
+// SLOWLOG RESET [namespace]
+// all the namespaces on this server will be used if the namespace is not given.
+func (s *Server) doSlowLogCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 2 {
+		conn.WriteError("ERR wrong number of arguments for 'slowlog' command")
+		return
+	}
+	subCmd := strings.ToLower(string(cmd.Args[1]))
+	args := cmd.Args[2:]
+	namespace := ""
+	if len(args) > 0 {
+		// the count can be given without the namespace
+		if _, err := strconv.Atoi(string(args[0])); err != nil || subCmd != "get" {
+			namespace = string(args[0])
+			args = args[1:]
+		}
+	}
+	nodes := s.getSlowLogNodes(namespace)
+	switch subCmd {
+	case "len":
+		total := 0
+		for _, n := range nodes {
+			total += n.Node.GetSlowLog().Len()
+		}
+		conn.WriteInt(total)
+	case "reset":
+		for _, n := range nodes {
+			n.Node.GetSlowLog().Reset()
+		}
+		conn.WriteString("OK")
+	case "get":
+		cnt := defaultSlowLogGetNum
+		if len(args) > 0 {
+			var err error
+			cnt, err = strconv.Atoi(string(args[0]))
+			if err != nil {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+		}
+		var entries nsSlowLogEntryList
+		for name, n := range nodes {
+			for _, e := range n.Node.GetSlowLog().Get(cnt) {
+				entries = append(entries, nsSlowLogEntry{SlowLogEntry: e, Namespace: name})
+			}
+		}
+		sort.Sort(entries)
+		if cnt >= 0 && len(entries) > cnt {
+			entries = entries[:cnt]
+		}
+		conn.WriteArray(len(entries))
+		for _, e := range entries {
+			conn.WriteArray(7)
+			conn.WriteInt64(e.ID)
+			conn.WriteInt64(e.Timestamp)
+			conn.WriteInt64(e.Cost)
+			conn.WriteArray(len(e.Args))
+			for _, arg := range e.Args {
+				conn.WriteBulk(arg)
+			}
+			conn.WriteBulkString(e.Namespace)
+			conn.WriteInt64(e.ProposeCost)
+			conn.WriteInt64(e.ApplyCost)
+		}
+	default:
+		conn.WriteError("ERR unknown subcommand '" + subCmd + "'. Try SLOWLOG GET, LEN, RESET")
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"golang.org/x/time/rate"
+)
+
+// the client should backoff and retry while receiving this error
+var errWriteThrottled = errors.New("ERR_THROTTLED: write rate limit exceeded, retry later")
+
+// WriteRateLimit is the token bucket limit for the writes to the namespace or the table
+// on this node, the namespace limit will be used if the table is empty.
+type WriteRateLimit struct {
+	Namespace string  `json:"namespace"`
+	Table     string  `json:"table,omitempty"`
+	Rate      float64 `json:"rate"`
+	Burst     int     `json:"burst"`
+}
+
+func (wl WriteRateLimit) limitKey() string {
+	if wl.Table == "" {
+		return wl.Namespace
+	}
+	return wl.Namespace + ":" + wl.Table
+}
+
+type rateLimitEntry struct {
+	conf    WriteRateLimit
+	limiter *rate.Limiter
+}
+
+// writeRateLimiter limit the writes for each namespace and table, the write
+// will be rejected if any of the namespace limit and the table limit exceeded.
+type writeRateLimiter struct {
+	sync.RWMutex
+	limits map[string]*rateLimitEntry
+	// the limits configured on this node and the limits set by the cluster dynamic config
+	initLimits  map[string]WriteRateLimit
+	dynamicKeys map[string]bool
+}
+
+func newWriteRateLimiter(limits []WriteRateLimit) *writeRateLimiter {
+	wl := &writeRateLimiter{
+		limits:     make(map[string]*rateLimitEntry),
+		initLimits: make(map[string]WriteRateLimit),
+	}
+	for _, l := range limits {
+		wl.SetLimit(l)
+		wl.initLimits[l.limitKey()] = l
+	}
+	return wl
+}
+
+// SetLimit update the limit while running, the limit will be removed if the rate is not positive.
+func (wl *writeRateLimiter) SetLimit(l WriteRateLimit) {
+	key := l.limitKey()
+	wl.Lock()
+	defer wl.Unlock()
+	if l.Rate <= 0 {
+		delete(wl.limits, key)
+		return
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(l.Rate)
+		if l.Burst < 1 {
+			l.Burst = 1
+		}
+	}
+	if e, ok := wl.limits[key]; ok {
+		e.limiter.SetLimit(rate.Limit(l.Rate))
+		e.limiter.SetBurst(l.Burst)
+		e.conf = l
+		return
+	}
+	wl.limits[key] = &rateLimitEntry{
+		conf:    l,
+		limiter: rate.NewLimiter(rate.Limit(l.Rate), l.Burst),
+	}
+}
+
+// SetDynamicLimits replace the limits set by the cluster dynamic config, the limit removed
+// from the dynamic config will be restored to the one configured on this node.
+func (wl *writeRateLimiter) SetDynamicLimits(limits []WriteRateLimit) {
+	newKeys := make(map[string]bool, len(limits))
+	for _, l := range limits {
+		wl.SetLimit(l)
+		newKeys[l.limitKey()] = true
+	}
+	wl.Lock()
+	oldKeys := wl.dynamicKeys
+	wl.dynamicKeys = newKeys
+	wl.Unlock()
+	for key := range oldKeys {
+		if newKeys[key] {
+			continue
+		}
+		if l, ok := wl.initLimits[key]; ok {
+			wl.SetLimit(l)
+		} else {
+			wl.Lock()
+			delete(wl.limits, key)
+			wl.Unlock()
+		}
+	}
+}
+
+func (wl *writeRateLimiter) applyDynamicConf(value string) error {
+	var limits []WriteRateLimit
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &limits); err != nil {
+			return err
+		}
+	}
+	wl.SetDynamicLimits(limits)
+	return nil
+}
+
+func (wl *writeRateLimiter) GetLimits() []WriteRateLimit {
+	wl.RLock()
+	limits := make([]WriteRateLimit, 0, len(wl.limits))
+	for _, e := range wl.limits {
+		limits = append(limits, e.conf)
+	}
+	wl.RUnlock()
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].limitKey() < limits[j].limitKey()
+	})
+	return limits
+}
+
+// Allow check the limits for the write to the primary key (table:key) of the namespace
+func (wl *writeRateLimiter) Allow(ns string, pk []byte) bool {
+	wl.RLock()
+	defer wl.RUnlock()
+	if len(wl.limits) == 0 {
+		return true
+	}
+	if e, ok := wl.limits[ns]; ok && !e.limiter.Allow() {
+		return false
+	}
+	table, _, err := common.ExtractTable(pk)
+	if err != nil {
+		return true
+	}
+	if e, ok := wl.limits[ns+":"+string(table)]; ok && !e.limiter.Allow() {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRateLimiter(t *testing.T) {
+	wl := newWriteRateLimiter([]WriteRateLimit{
+		{Namespace: "default", Table: "hot", Rate: 1, Burst: 2},
+	})
+	assert.True(t, wl.Allow("default", []byte("hot:k1")))
+	assert.True(t, wl.Allow("default", []byte("hot:k2")))
+	assert.False(t, wl.Allow("default", []byte("hot:k3")))
+	// the other tables and namespaces should not be limited
+	for i := 0; i < 10; i++ {
+		assert.True(t, wl.Allow("default", []byte("cold:k1")))
+		assert.True(t, wl.Allow("other", []byte("hot:k1")))
+	}
+
+	wl.SetLimit(WriteRateLimit{Namespace: "other", Rate: 1, Burst: 1})
+	assert.True(t, wl.Allow("other", []byte("cold:k1")))
+	assert.False(t, wl.Allow("other", []byte("hot:k1")))
+	limits := wl.GetLimits()
+	assert.Equal(t, 2, len(limits))
+	assert.Equal(t, "default", limits[0].Namespace)
+	assert.Equal(t, "hot", limits[0].Table)
+	assert.Equal(t, "other", limits[1].Namespace)
+
+	// update the existing limit and remove the limit
+	wl.SetLimit(WriteRateLimit{Namespace: "default", Table: "hot", Rate: 1000, Burst: 1000})
+	assert.True(t, wl.Allow("default", []byte("hot:k3")))
+	wl.SetLimit(WriteRateLimit{Namespace: "other", Rate: 0})
+	assert.True(t, wl.Allow("other", []byte("hot:k1")))
+	assert.Equal(t, 1, len(wl.GetLimits()))
+}
+
+func TestWriteRateLimiterDynamicConf(t *testing.T) {
+	wl := newWriteRateLimiter([]WriteRateLimit{
+		{Namespace: "default", Rate: 100, Burst: 100},
+	})
+	err := wl.applyDynamicConf(`[{"namespace":"default","rate":1,"burst":1},{"namespace":"other","rate":1,"burst":1}]`)
+	assert.Nil(t, err)
+	limits := wl.GetLimits()
+	assert.Equal(t, 2, len(limits))
+	assert.Equal(t, float64(1), limits[0].Rate)
+	assert.NotNil(t, wl.applyDynamicConf("invalid"))
+
+	// the node config should be restored after the dynamic config removed
+	err = wl.applyDynamicConf("")
+	assert.Nil(t, err)
+	limits = wl.GetLimits()
+	assert.Equal(t, 1, len(limits))
+	assert.Equal(t, "default", limits[0].Namespace)
+	assert.Equal(t, float64(100), limits[0].Rate)
+}
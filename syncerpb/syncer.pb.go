@@ -122,6 +122,30 @@ func (x RaftApplySnapType) String() string {
 }
 func (RaftApplySnapType) EnumDescriptor() ([]byte, []int) { return fileDescriptorSyncer, []int{2} }
 
+type RaftLogCompressType int32
+
+const (
+	NoCompress     RaftLogCompressType = 0
+	SnappyCompress RaftLogCompressType = 1
+	ZstdCompress   RaftLogCompressType = 2
+)
+
+var RaftLogCompressType_name = map[int32]string{
+	0: "NoCompress",
+	1: "SnappyCompress",
+	2: "ZstdCompress",
+}
+var RaftLogCompressType_value = map[string]int32{
+	"NoCompress":     0,
+	"SnappyCompress": 1,
+	"ZstdCompress":   2,
+}
+
+func (x RaftLogCompressType) String() string {
+	return proto.EnumName(RaftLogCompressType_name, int32(x))
+}
+func (RaftLogCompressType) EnumDescriptor() ([]byte, []int) { return fileDescriptorSyncer, []int{3} }
+
 type RpcErr struct {
 	ErrType int32  `protobuf:"varint,1,opt,name=err_type,json=errType,proto3" json:"err_type,omitempty"`
 	ErrCode int32  `protobuf:"varint,2,opt,name=err_code,json=errCode,proto3" json:"err_code,omitempty"`
@@ -141,11 +165,12 @@ type RaftLogData struct {
 	// raft group for different partition has different name, so
 	// we can make sure (term-index) is increased in same raft group.
 	// (term-index) will be checked while replaying in remote cluster
-	RaftGroupName string `protobuf:"bytes,3,opt,name=raft_group_name,json=raftGroupName,proto3" json:"raft_group_name,omitempty"`
-	Term          uint64 `protobuf:"varint,4,opt,name=term,proto3" json:"term,omitempty"`
-	Index         uint64 `protobuf:"varint,5,opt,name=index,proto3" json:"index,omitempty"`
-	RaftTimestamp int64  `protobuf:"varint,6,opt,name=raft_timestamp,json=raftTimestamp,proto3" json:"raft_timestamp,omitempty"`
-	Data          []byte `protobuf:"bytes,15,opt,name=data,proto3" json:"data,omitempty"`
+	RaftGroupName string              `protobuf:"bytes,3,opt,name=raft_group_name,json=raftGroupName,proto3" json:"raft_group_name,omitempty"`
+	Term          uint64              `protobuf:"varint,4,opt,name=term,proto3" json:"term,omitempty"`
+	Index         uint64              `protobuf:"varint,5,opt,name=index,proto3" json:"index,omitempty"`
+	RaftTimestamp int64               `protobuf:"varint,6,opt,name=raft_timestamp,json=raftTimestamp,proto3" json:"raft_timestamp,omitempty"`
+	Data          []byte              `protobuf:"bytes,15,opt,name=data,proto3" json:"data,omitempty"`
+	CompressType  RaftLogCompressType `protobuf:"varint,7,opt,name=compress_type,json=compressType,proto3,enum=syncerpb.RaftLogCompressType" json:"compress_type,omitempty"`
 }
 
 func (m *RaftLogData) Reset()                    { *m = RaftLogData{} }
@@ -226,6 +251,8 @@ type SyncedRaftRsp struct {
 	Term      uint64 `protobuf:"varint,1,opt,name=term,proto3" json:"term,omitempty"`
 	Index     uint64 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
 	Timestamp int64  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// the bit mask (1 << type) of the compress types supported by the receiver
+	CompressTypes uint32 `protobuf:"varint,4,opt,name=compress_types,json=compressTypes,proto3" json:"compress_types,omitempty"`
 }
 
 func (m *SyncedRaftRsp) Reset()                    { *m = SyncedRaftRsp{} }
@@ -245,6 +272,7 @@ func init() {
 	proto.RegisterEnum("syncerpb.RaftLogType", RaftLogType_name, RaftLogType_value)
 	proto.RegisterEnum("syncerpb.RaftApplySnapStatus", RaftApplySnapStatus_name, RaftApplySnapStatus_value)
 	proto.RegisterEnum("syncerpb.RaftApplySnapType", RaftApplySnapType_name, RaftApplySnapType_value)
+	proto.RegisterEnum("syncerpb.RaftLogCompressType", RaftLogCompressType_name, RaftLogCompressType_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -532,6 +560,11 @@ func (m *RaftLogData) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintSyncer(dAtA, i, uint64(m.RaftTimestamp))
 	}
+	if m.CompressType != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintSyncer(dAtA, i, uint64(m.CompressType))
+	}
 	if len(m.Data) > 0 {
 		dAtA[i] = 0x7a
 		i++
@@ -773,6 +806,11 @@ func (m *SyncedRaftRsp) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintSyncer(dAtA, i, uint64(m.Timestamp))
 	}
+	if m.CompressTypes != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintSyncer(dAtA, i, uint64(m.CompressTypes))
+	}
 	return i, nil
 }
 
@@ -824,6 +862,9 @@ func (m *RaftLogData) Size() (n int) {
 	if m.RaftTimestamp != 0 {
 		n += 1 + sovSyncer(uint64(m.RaftTimestamp))
 	}
+	if m.CompressType != 0 {
+		n += 1 + sovSyncer(uint64(m.CompressType))
+	}
 	l = len(m.Data)
 	if l > 0 {
 		n += 1 + l + sovSyncer(uint64(l))
@@ -943,6 +984,9 @@ func (m *SyncedRaftRsp) Size() (n int) {
 	if m.Timestamp != 0 {
 		n += 1 + sovSyncer(uint64(m.Timestamp))
 	}
+	if m.CompressTypes != 0 {
+		n += 1 + sovSyncer(uint64(m.CompressTypes))
+	}
 	return n
 }
 
@@ -1239,6 +1283,25 @@ func (m *RaftLogData) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CompressType", wireType)
+			}
+			m.CompressType = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSyncer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CompressType |= (RaftLogCompressType(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		case 15:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
@@ -2102,6 +2165,25 @@ func (m *SyncedRaftRsp) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CompressTypes", wireType)
+			}
+			m.CompressTypes = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSyncer
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CompressTypes |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSyncer(dAtA[iNdEx:])
@@ -2231,54 +2313,57 @@ var (
 func init() { proto.RegisterFile("syncer.proto", fileDescriptorSyncer) }
 
 var fileDescriptorSyncer = []byte{
-	// 776 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x55, 0xcd, 0x6e, 0x2b, 0x35,
-	0x14, 0x1e, 0xe7, 0x3f, 0x27, 0x7f, 0x83, 0x29, 0xed, 0x90, 0xd2, 0x28, 0x8c, 0x04, 0x0a, 0x5d,
-	0xb4, 0xa8, 0x80, 0x10, 0x12, 0x9b, 0x90, 0x96, 0x0a, 0x41, 0x4b, 0x35, 0x29, 0x54, 0xea, 0x26,
-	0x72, 0x33, 0xce, 0x74, 0xd4, 0x64, 0xec, 0xda, 0x8e, 0x4a, 0x5e, 0x01, 0x89, 0x3d, 0x2f, 0xc1,
-	0x96, 0x67, 0xe8, 0xb2, 0x8f, 0x70, 0xdb, 0xbb, 0xb9, 0x0f, 0x70, 0x1f, 0xe0, 0xca, 0x9e, 0x64,
-	0x92, 0xa8, 0xe9, 0xfd, 0x59, 0x5d, 0xdd, 0x9d, 0xcf, 0x77, 0xbe, 0xf9, 0x8e, 0xcf, 0xe7, 0x63,
-	0x0f, 0x94, 0xe5, 0x24, 0xea, 0x53, 0xb1, 0xc3, 0x05, 0x53, 0x0c, 0x17, 0xe2, 0x88, 0x5f, 0xd4,
-	0xd7, 0x02, 0x16, 0x30, 0x03, 0xee, 0xea, 0x55, 0x9c, 0x77, 0xcf, 0x20, 0xe7, 0xf1, 0xfe, 0x81,
-	0x10, 0xf8, 0x53, 0x28, 0x50, 0x21, 0x7a, 0x6a, 0xc2, 0xa9, 0x83, 0x9a, 0xa8, 0x95, 0xf5, 0xf2,
-	0x54, 0x88, 0xd3, 0x09, 0xa7, 0xb3, 0x54, 0x9f, 0xf9, 0xd4, 0x49, 0x25, 0xa9, 0x0e, 0xf3, 0x29,
-	0xde, 0x00, 0xbd, 0xec, 0x8d, 0x64, 0xe0, 0xa4, 0x9b, 0xa8, 0x55, 0xf4, 0x72, 0x54, 0x88, 0x23,
-	0x19, 0xb8, 0x2f, 0x10, 0x94, 0x3c, 0x32, 0x50, 0xbf, 0xb1, 0x60, 0x9f, 0x28, 0x82, 0xbf, 0x82,
-	0x4c, 0x22, 0x5d, 0xdd, 0xfb, 0x64, 0x67, 0xb6, 0xaf, 0x9d, 0x29, 0x49, 0x17, 0xf2, 0x0c, 0x05,
-	0x7f, 0x0e, 0xe5, 0xfe, 0x70, 0x2c, 0x15, 0x15, 0xbd, 0x88, 0x8c, 0xe2, 0x92, 0x45, 0xaf, 0x34,
-	0xc5, 0x8e, 0xc9, 0x88, 0xe2, 0x2f, 0xa1, 0x26, 0xc8, 0x40, 0xf5, 0x02, 0xc1, 0xc6, 0x3c, 0x66,
-	0xc5, 0xe5, 0x2b, 0x1a, 0x3e, 0xd4, 0xa8, 0xe1, 0x61, 0xc8, 0x28, 0x2a, 0x46, 0x4e, 0xa6, 0x89,
-	0x5a, 0x19, 0xcf, 0xac, 0xf1, 0x1a, 0x64, 0xc3, 0xc8, 0xa7, 0x7f, 0x39, 0x59, 0x03, 0xc6, 0x01,
-	0xfe, 0x02, 0xaa, 0x46, 0x51, 0x85, 0x23, 0x2a, 0x15, 0x19, 0x71, 0x27, 0xd7, 0x44, 0xad, 0x74,
-	0x2c, 0x78, 0x3a, 0x03, 0xb5, 0xa0, 0x4f, 0x14, 0x71, 0x6a, 0x4d, 0xd4, 0x2a, 0x7b, 0x66, 0xed,
-	0xfe, 0x08, 0x05, 0xdd, 0x84, 0x47, 0xaf, 0x25, 0xfe, 0x1a, 0x0a, 0x46, 0x66, 0xc8, 0x02, 0x07,
-	0x35, 0xd3, 0xad, 0xd2, 0x8a, 0x56, 0xb5, 0x1f, 0x5e, 0x5e, 0xc4, 0x81, 0xfb, 0x5f, 0x0a, 0x6c,
-	0x9d, 0x68, 0x73, 0x3e, 0x9c, 0x74, 0x23, 0xc2, 0x3d, 0x7a, 0x8d, 0x77, 0x97, 0xdc, 0xda, 0x5c,
-	0x96, 0x48, 0x98, 0x1f, 0x88, 0x67, 0x9b, 0x50, 0xd4, 0xfb, 0xef, 0x11, 0xdf, 0x17, 0x4e, 0xde,
-	0x94, 0x34, 0x63, 0xd9, 0xf6, 0x7d, 0x91, 0x24, 0x39, 0x51, 0x97, 0x4e, 0x61, 0x9e, 0x3c, 0x21,
-	0xea, 0x32, 0x71, 0xbb, 0xb8, 0xe0, 0xf6, 0x3f, 0x08, 0xd6, 0x97, 0x5c, 0xe8, 0x2a, 0xa2, 0xc6,
-	0x52, 0xbb, 0xf6, 0x3e, 0x4c, 0x70, 0xff, 0x7e, 0x62, 0x3f, 0x92, 0xe3, 0xef, 0x20, 0x27, 0x4d,
-	0x30, 0x3d, 0xc7, 0xad, 0x27, 0xce, 0x71, 0xfa, 0xc5, 0x94, 0x8c, 0xeb, 0x50, 0xe0, 0x82, 0x05,
-	0x82, 0x4a, 0x69, 0x5a, 0xc8, 0x78, 0x49, 0x8c, 0xb7, 0x00, 0x62, 0xd6, 0xc2, 0x95, 0x2b, 0xc6,
-	0x88, 0xbe, 0x75, 0xe7, 0x50, 0xe9, 0xea, 0x12, 0xfe, 0x74, 0x20, 0x1f, 0x59, 0x82, 0xde, 0xca,
-	0x92, 0xd4, 0x0a, 0x4b, 0xdc, 0xb3, 0x25, 0x6d, 0xc9, 0x13, 0x8f, 0xd0, 0x2a, 0x8f, 0x52, 0x8b,
-	0x83, 0xf2, 0x19, 0x14, 0xe7, 0x33, 0x92, 0x36, 0x33, 0x32, 0x07, 0xb6, 0x7f, 0x48, 0x5e, 0x0a,
-	0xf3, 0xda, 0x60, 0xa8, 0x1e, 0x44, 0x4a, 0x4c, 0x8e, 0x99, 0x18, 0x91, 0xa1, 0x47, 0x6e, 0x6c,
-	0x0b, 0xaf, 0x03, 0x36, 0x98, 0x76, 0x4b, 0x5e, 0x32, 0xe5, 0x91, 0x9b, 0x5f, 0xff, 0xb4, 0xd1,
-	0xf6, 0xff, 0x08, 0x3e, 0x5e, 0x61, 0x25, 0xb6, 0xa1, 0x6c, 0xa0, 0x3f, 0xa2, 0xab, 0x88, 0xdd,
-	0x44, 0xb6, 0x85, 0x1d, 0x58, 0x33, 0xc8, 0x19, 0x09, 0x55, 0x18, 0x05, 0xa7, 0x82, 0x44, 0x72,
-	0x40, 0x85, 0x8d, 0x92, 0xcc, 0x0c, 0xea, 0x8e, 0xfb, 0x7d, 0x2a, 0xa5, 0x9d, 0x4a, 0x54, 0xa6,
-	0xdf, 0xd8, 0xe9, 0x04, 0x99, 0x71, 0x32, 0xb8, 0x06, 0x25, 0x83, 0xfc, 0x4c, 0xc2, 0x21, 0xf5,
-	0xed, 0x6c, 0x42, 0x39, 0x0a, 0xa5, 0xd4, 0x1f, 0xe5, 0x74, 0x43, 0x06, 0xf9, 0x7d, 0xac, 0xd8,
-	0xc0, 0x27, 0x8a, 0xda, 0xf9, 0xed, 0x6f, 0xe1, 0xa3, 0x47, 0x57, 0x19, 0x57, 0x01, 0xe2, 0xa6,
-	0x35, 0x62, 0x5b, 0x5a, 0xbb, 0x7b, 0x15, 0x72, 0x4e, 0x7d, 0x03, 0xa0, 0xbd, 0x97, 0x29, 0xa8,
-	0x75, 0x04, 0x93, 0xb2, 0x13, 0x9f, 0x5f, 0xfb, 0xe4, 0x17, 0xfc, 0x3d, 0x54, 0x8c, 0x4a, 0xf2,
-	0x04, 0xe1, 0xe5, 0x29, 0xd3, 0x58, 0xdd, 0x5e, 0xc0, 0xcc, 0x73, 0xef, 0x5a, 0xb8, 0x03, 0x95,
-	0x43, 0xaa, 0xe6, 0x47, 0x8a, 0x37, 0xe6, 0xa4, 0xa5, 0x21, 0xaa, 0xaf, 0x4e, 0x48, 0xee, 0x5a,
-	0x78, 0x1f, 0xf0, 0x31, 0x53, 0xe1, 0x60, 0xee, 0x5e, 0x44, 0x38, 0xae, 0x3f, 0x31, 0xe8, 0x5a,
-	0x6c, 0xd5, 0x56, 0xda, 0x50, 0x8b, 0x55, 0x12, 0xe6, 0x3b, 0x4b, 0x9c, 0x03, 0x3e, 0xa4, 0x8f,
-	0xe6, 0xa0, 0xf9, 0xfa, 0x1b, 0x47, 0xaf, 0xeb, 0x6f, 0x60, 0xe8, 0x26, 0x7f, 0x72, 0x6e, 0xef,
-	0x1b, 0xd6, 0xdd, 0x7d, 0xc3, 0xba, 0x7d, 0x68, 0xa0, 0xbb, 0x87, 0x06, 0x7a, 0xf6, 0xd0, 0x40,
-	0xff, 0x3e, 0x6f, 0x58, 0x17, 0x39, 0xf3, 0x17, 0xfd, 0xe6, 0x55, 0x00, 0x00, 0x00, 0xff, 0xff,
-	0xd1, 0x15, 0x01, 0x7f, 0x75, 0x07, 0x00, 0x00,
+	// 825 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x55, 0xdd, 0x6e, 0x1b, 0x45,
+	0x14, 0xde, 0x59, 0x3b, 0x8e, 0x7d, 0x62, 0xc7, 0xcb, 0x34, 0xb4, 0x8b, 0x4b, 0x2d, 0xb3, 0x12,
+	0xc8, 0xe4, 0x22, 0x45, 0x05, 0x84, 0x90, 0xb8, 0x71, 0xdd, 0x12, 0xa1, 0xd2, 0x50, 0xad, 0x03,
+	0x91, 0x72, 0x63, 0x4d, 0x77, 0xc7, 0x9b, 0x55, 0xbd, 0x3b, 0x93, 0x99, 0xb1, 0x82, 0x5f, 0x01,
+	0x89, 0x7b, 0x1e, 0x02, 0x6e, 0x79, 0x86, 0x5e, 0xf6, 0x11, 0x68, 0x78, 0x05, 0x1e, 0x00, 0xcd,
+	0xac, 0x3d, 0xb6, 0xf1, 0x86, 0x9f, 0x2b, 0xd4, 0xbb, 0x39, 0xdf, 0xf9, 0xe6, 0xcc, 0x39, 0xdf,
+	0x7e, 0x33, 0x0b, 0x4d, 0x39, 0xcf, 0x23, 0x2a, 0x8e, 0xb8, 0x60, 0x8a, 0xe1, 0x7a, 0x11, 0xf1,
+	0xe7, 0x9d, 0x83, 0x84, 0x25, 0xcc, 0x80, 0xf7, 0xf5, 0xaa, 0xc8, 0x07, 0x67, 0x50, 0x0b, 0x79,
+	0xf4, 0x58, 0x08, 0xfc, 0x0e, 0xd4, 0xa9, 0x10, 0x63, 0x35, 0xe7, 0xd4, 0x47, 0x3d, 0xd4, 0xdf,
+	0x09, 0x77, 0xa9, 0x10, 0xa7, 0x73, 0x4e, 0x97, 0xa9, 0x88, 0xc5, 0xd4, 0x77, 0x6d, 0x6a, 0xc8,
+	0x62, 0x8a, 0xef, 0x80, 0x5e, 0x8e, 0x33, 0x99, 0xf8, 0x95, 0x1e, 0xea, 0x37, 0xc2, 0x1a, 0x15,
+	0xe2, 0xa9, 0x4c, 0x82, 0x9f, 0x5d, 0xd8, 0x0b, 0xc9, 0x44, 0x7d, 0xcd, 0x92, 0x47, 0x44, 0x11,
+	0xfc, 0x21, 0x54, 0x6d, 0xe9, 0xfd, 0x07, 0x6f, 0x1f, 0x2d, 0xfb, 0x3a, 0x5a, 0x90, 0xf4, 0x41,
+	0xa1, 0xa1, 0xe0, 0xf7, 0xa0, 0x19, 0x4d, 0x67, 0x52, 0x51, 0x31, 0xce, 0x49, 0x56, 0x1c, 0xd9,
+	0x08, 0xf7, 0x16, 0xd8, 0x09, 0xc9, 0x28, 0xfe, 0x00, 0xda, 0x82, 0x4c, 0xd4, 0x38, 0x11, 0x6c,
+	0xc6, 0x0b, 0x56, 0x71, 0x7c, 0x4b, 0xc3, 0xc7, 0x1a, 0x35, 0x3c, 0x0c, 0x55, 0x45, 0x45, 0xe6,
+	0x57, 0x7b, 0xa8, 0x5f, 0x0d, 0xcd, 0x1a, 0x1f, 0xc0, 0x4e, 0x9a, 0xc7, 0xf4, 0x7b, 0x7f, 0xc7,
+	0x80, 0x45, 0x80, 0xdf, 0x87, 0x7d, 0x53, 0x51, 0xa5, 0x19, 0x95, 0x8a, 0x64, 0xdc, 0xaf, 0xf5,
+	0x50, 0xbf, 0x52, 0x14, 0x3c, 0x5d, 0x82, 0xba, 0x60, 0x4c, 0x14, 0xf1, 0xdb, 0x3d, 0xd4, 0x6f,
+	0x86, 0x66, 0x8d, 0x1f, 0x42, 0x2b, 0x62, 0x19, 0x17, 0x54, 0xca, 0x42, 0xbe, 0x5d, 0x33, 0xe3,
+	0xbd, 0xad, 0x19, 0x87, 0x0b, 0x96, 0x99, 0xb5, 0x19, 0xad, 0x45, 0xc1, 0x17, 0x50, 0xd7, 0xa4,
+	0x90, 0x5e, 0x4a, 0xfc, 0x11, 0xd4, 0x4d, 0x2b, 0x53, 0x96, 0xf8, 0xa8, 0x57, 0xe9, 0xef, 0x95,
+	0xc8, 0xa5, 0x35, 0x0d, 0x77, 0x45, 0x11, 0x04, 0xbf, 0xb8, 0xe0, 0xe9, 0xc4, 0x80, 0xf3, 0xe9,
+	0x7c, 0x94, 0x13, 0x1e, 0xd2, 0x4b, 0x7c, 0x7f, 0x43, 0xf1, 0xbb, 0x9b, 0x25, 0x2c, 0xf3, 0x0d,
+	0xd1, 0xfd, 0x2e, 0x34, 0x74, 0xff, 0x63, 0x12, 0xc7, 0xc2, 0xe8, 0xdb, 0x08, 0x8d, 0xb5, 0x07,
+	0x71, 0x2c, 0x6c, 0x92, 0x13, 0x75, 0xe1, 0xd7, 0x57, 0xc9, 0x67, 0x44, 0x5d, 0xd8, 0x2f, 0xd6,
+	0x58, 0x7d, 0xb1, 0xe0, 0x47, 0x04, 0xb7, 0x37, 0x54, 0x18, 0x29, 0xa2, 0x66, 0x52, 0xab, 0xf6,
+	0x7f, 0x88, 0x10, 0xfc, 0x70, 0x43, 0x3f, 0x92, 0xe3, 0x4f, 0xa1, 0x26, 0x4d, 0xe0, 0xa3, 0x32,
+	0x57, 0xfd, 0x75, 0xc7, 0x82, 0x8c, 0x3b, 0x50, 0xe7, 0x82, 0x25, 0xda, 0x5f, 0x66, 0x84, 0x6a,
+	0x68, 0x63, 0x7c, 0x0f, 0xa0, 0x60, 0xad, 0x5d, 0xdb, 0x46, 0x81, 0xe8, 0x9b, 0x7b, 0x0e, 0xad,
+	0x91, 0x3e, 0x22, 0x5e, 0x18, 0x72, 0x4b, 0x12, 0xf4, 0xaf, 0x24, 0x71, 0x4b, 0x24, 0x09, 0xce,
+	0x36, 0x6a, 0x4b, 0x6e, 0x35, 0x42, 0x65, 0x1a, 0xb9, 0xeb, 0x46, 0x79, 0x17, 0x1a, 0x2b, 0x8f,
+	0x54, 0x8c, 0x47, 0x56, 0xc0, 0xe1, 0xe7, 0xf6, 0xb5, 0x31, 0x2f, 0x16, 0x86, 0xfd, 0xc7, 0xb9,
+	0x12, 0xf3, 0x13, 0x26, 0x32, 0x32, 0x0d, 0xc9, 0x95, 0xe7, 0xe0, 0xdb, 0x80, 0x0d, 0xa6, 0xd5,
+	0x92, 0x17, 0x4c, 0x85, 0xe4, 0xea, 0xc9, 0x77, 0x1e, 0x3a, 0xfc, 0x15, 0xc1, 0xad, 0x12, 0x29,
+	0xb1, 0x07, 0x4d, 0x03, 0x7d, 0x9b, 0xbf, 0xc8, 0xd9, 0x55, 0xee, 0x39, 0xd8, 0x87, 0x03, 0x83,
+	0x9c, 0x91, 0x54, 0xa5, 0x79, 0x72, 0x2a, 0x48, 0x2e, 0x27, 0x54, 0x78, 0xc8, 0x66, 0x96, 0xd0,
+	0x68, 0x16, 0x45, 0x54, 0x4a, 0xcf, 0xb5, 0x55, 0x16, 0x7b, 0xbc, 0x8a, 0x45, 0x96, 0x9c, 0x2a,
+	0x6e, 0xc3, 0x9e, 0x41, 0xbe, 0x24, 0xe9, 0x94, 0xc6, 0xde, 0x8e, 0xa5, 0x3c, 0x4d, 0xa5, 0xd4,
+	0x9b, 0x6a, 0x7a, 0x20, 0x83, 0x7c, 0x33, 0x53, 0x6c, 0x12, 0x13, 0x45, 0xbd, 0xdd, 0xc3, 0x4f,
+	0xe0, 0xad, 0xad, 0xab, 0x8c, 0xf7, 0x01, 0x8a, 0xa1, 0x35, 0xe2, 0x39, 0xba, 0xf6, 0xe8, 0x45,
+	0xca, 0x39, 0x8d, 0x0d, 0x80, 0x0e, 0x9f, 0xc0, 0xad, 0x92, 0xe7, 0xa8, 0xd8, 0xb7, 0x44, 0x3c,
+	0x47, 0x1f, 0xa8, 0x37, 0xf0, 0xb9, 0xc5, 0x90, 0x6e, 0xeb, 0x5c, 0xaa, 0xd8, 0x22, 0xee, 0x83,
+	0x3f, 0x5c, 0x68, 0x0f, 0x05, 0x93, 0x72, 0x58, 0x98, 0x61, 0xf0, 0xec, 0x2b, 0xfc, 0x19, 0xb4,
+	0x4c, 0x4b, 0xf6, 0x3d, 0xc3, 0x9b, 0x96, 0xd5, 0x58, 0xc7, 0x5b, 0xc3, 0xcc, 0xff, 0x27, 0x70,
+	0xf0, 0x10, 0x5a, 0xc7, 0x54, 0xad, 0xfc, 0x81, 0xef, 0xac, 0x48, 0x1b, 0x8e, 0xec, 0x94, 0x27,
+	0x24, 0x0f, 0x1c, 0xfc, 0x08, 0xf0, 0x09, 0x53, 0xe9, 0x64, 0xf5, 0x29, 0x72, 0xc2, 0x71, 0xe7,
+	0x86, 0x5b, 0xa3, 0x8b, 0x95, 0xb5, 0x32, 0x80, 0x76, 0x51, 0xc5, 0x32, 0xff, 0x73, 0x89, 0x73,
+	0xc0, 0xc7, 0x74, 0xcb, 0x54, 0xbd, 0xbf, 0xbf, 0xbe, 0xf4, 0xb2, 0xf3, 0x0f, 0x0c, 0x3d, 0xe4,
+	0x43, 0xff, 0xe5, 0xeb, 0xae, 0xf3, 0xea, 0x75, 0xd7, 0x79, 0x79, 0xdd, 0x45, 0xaf, 0xae, 0xbb,
+	0xe8, 0xb7, 0xeb, 0x2e, 0xfa, 0xe9, 0xf7, 0xae, 0xf3, 0xbc, 0x66, 0x7e, 0xeb, 0x1f, 0xff, 0x39,
+	0x00, 0x90, 0x2b, 0x18, 0x30, 0x06, 0x08, 0x00, 0x00,
 }
@@ -0,0 +1,70 @@
+package linearizability
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// History record the operations of all the clients, the time is the monotonic time since
+// the history is created.
+type History struct {
+	sync.Mutex
+	start time.Time
+	ops   []porcupine.Operation
+	// the failed reads are not recorded
+	failedReads int64
+	unknownOps  int64
+}
+
+func NewHistory() *History {
+	return &History{start: time.Now()}
+}
+
+func (h *History) now() int64 {
+	return time.Since(h.start).Nanoseconds()
+}
+
+// Record add the finished operation, the write without the reply may take effect at any
+// time after the call, so it never returns.
+func (h *History) Record(clientID int, in kvInput, out kvOutput, call int64, err error) {
+	ret := h.now()
+	h.Lock()
+	defer h.Unlock()
+	if err != nil {
+		if in.Op == opGet {
+			h.failedReads++
+			return
+		}
+		h.unknownOps++
+		out = kvOutput{Unknown: true}
+		ret = math.MaxInt64
+	}
+	h.ops = append(h.ops, porcupine.Operation{
+		ClientId: clientID,
+		Input:    in,
+		Call:     call,
+		Output:   out,
+		Return:   ret,
+	})
+}
+
+func (h *History) Operations() []porcupine.Operation {
+	h.Lock()
+	defer h.Unlock()
+	ops := make([]porcupine.Operation, len(h.ops))
+	copy(ops, h.ops)
+	return ops
+}
+
+// Check return whether the history is linearizable, the result is unknown if the check
+// is timeout. The visualization of the history will be written to the file if not empty.
+func (h *History) Check(timeout time.Duration, visualFile string) (porcupine.CheckResult, error) {
+	res, info := porcupine.CheckOperationsVerbose(kvModel, h.Operations(), timeout)
+	if visualFile == "" {
+		return res, nil
+	}
+	return res, porcupine.VisualizePath(kvModel, info, visualFile)
+}
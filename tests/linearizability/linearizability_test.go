@@ -0,0 +1,111 @@
+package linearizability
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/anishathalye/porcupine"
+)
+
+func op(client int, call int64, ret int64, in kvInput, out kvOutput) porcupine.Operation {
+	return porcupine.Operation{ClientId: client, Input: in, Call: call, Output: out, Return: ret}
+}
+
+func TestKVModel(t *testing.T) {
+	ok := []porcupine.Operation{
+		op(0, 0, 10, kvInput{Op: opSet, Key: "a", Value: "1"}, kvOutput{}),
+		op(1, 5, 15, kvInput{Op: opGet, Key: "a"}, kvOutput{Value: "1", Exists: true}),
+		op(2, 0, 3, kvInput{Op: opGet, Key: "a"}, kvOutput{}),
+		op(0, 20, 30, kvInput{Op: opSetNX, Key: "a", Value: "2"}, kvOutput{N: 0}),
+		op(1, 20, 30, kvInput{Op: opSetNX, Key: "b", Value: "2"}, kvOutput{N: 1}),
+		op(0, 40, 50, kvInput{Op: opIncr, Key: "c"}, kvOutput{N: 1}),
+		op(1, 40, 50, kvInput{Op: opIncr, Key: "c"}, kvOutput{N: 2}),
+		// the unknown incr may be applied after any operation
+		op(2, 40, math.MaxInt64, kvInput{Op: opIncr, Key: "c"}, kvOutput{Unknown: true}),
+		op(0, 60, 70, kvInput{Op: opGet, Key: "c"}, kvOutput{Value: "2", Exists: true}),
+		op(0, 80, 90, kvInput{Op: opGet, Key: "c"}, kvOutput{Value: "3", Exists: true}),
+	}
+	if !porcupine.CheckOperations(kvModel, ok) {
+		t.Errorf("the history should be linearizable")
+	}
+
+	staleRead := []porcupine.Operation{
+		op(0, 0, 10, kvInput{Op: opSet, Key: "a", Value: "1"}, kvOutput{}),
+		op(0, 20, 30, kvInput{Op: opSet, Key: "a", Value: "2"}, kvOutput{}),
+		op(1, 40, 50, kvInput{Op: opGet, Key: "a"}, kvOutput{Value: "1", Exists: true}),
+	}
+	if porcupine.CheckOperations(kvModel, staleRead) {
+		t.Errorf("the stale read should not be linearizable")
+	}
+
+	lostIncr := []porcupine.Operation{
+		op(0, 0, 10, kvInput{Op: opIncr, Key: "c"}, kvOutput{N: 1}),
+		op(1, 20, 30, kvInput{Op: opIncr, Key: "c"}, kvOutput{N: 1}),
+	}
+	if porcupine.CheckOperations(kvModel, lostIncr) {
+		t.Errorf("the lost incr should not be linearizable")
+	}
+
+	doubleSetNX := []porcupine.Operation{
+		op(0, 0, 10, kvInput{Op: opSetNX, Key: "a", Value: "1"}, kvOutput{N: 1}),
+		op(1, 5, 15, kvInput{Op: opSetNX, Key: "a", Value: "2"}, kvOutput{N: 1}),
+	}
+	if porcupine.CheckOperations(kvModel, doubleSetNX) {
+		t.Errorf("the setnx succeeded twice should not be linearizable")
+	}
+}
+
+// run against the real cluster, the environments:
+// ZANKV_LIN_PD: the comma separated placedriver http addresses
+// ZANKV_LIN_NS: the namespace, default "default"
+// ZANKV_LIN_NODES: the comma separated http addresses of the data nodes built with the
+// faultinject tag, the faults will be injected on them if set
+// ZANKV_LIN_DURATION: the duration of the workload, default 1m
+func TestLinearizabilityCluster(t *testing.T) {
+	pd := os.Getenv("ZANKV_LIN_PD")
+	if pd == "" {
+		t.Skip("ZANKV_LIN_PD is not set")
+	}
+	conf := Config{
+		PDAddrs:         strings.Split(pd, ","),
+		Namespace:       os.Getenv("ZANKV_LIN_NS"),
+		Table:           "lin",
+		Clients:         8,
+		Keys:            16,
+		Duration:        time.Minute,
+		NemesisInterval: time.Second * 5,
+	}
+	if conf.Namespace == "" {
+		conf.Namespace = "default"
+	}
+	if d, err := time.ParseDuration(os.Getenv("ZANKV_LIN_DURATION")); err == nil {
+		conf.Duration = d
+	}
+	if nodes := os.Getenv("ZANKV_LIN_NODES"); nodes != "" {
+		nodeList := strings.Split(nodes, ",")
+		conf.Nemeses = []Nemesis{
+			&FaultNemesis{Nodes: nodeList, Fault: common.FaultRaftDropMsg, Conf: common.FaultConf{Probability: 0.5}},
+			&FaultNemesis{Nodes: nodeList, Fault: common.FaultApplyPause, Conf: common.FaultConf{Probability: 1}},
+			&FaultNemesis{Nodes: nodeList, Fault: common.FaultApplyDelay, Conf: common.FaultConf{Probability: 0.5, DelayMs: 100}},
+		}
+	}
+	h, err := Run(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	visual := os.Getenv("ZANKV_LIN_VISUAL")
+	res, err := h.Check(time.Minute*5, visual)
+	if err != nil {
+		t.Errorf("write the visualization failed: %v", err)
+	}
+	switch res {
+	case porcupine.Illegal:
+		t.Errorf("the history is not linearizable, see the visualization in %v", visual)
+	case porcupine.Unknown:
+		t.Logf("the check is timeout")
+	}
+}
@@ -0,0 +1,151 @@
+// Package linearizability run the concurrent workload against the real cluster while injecting
+// the failures, and check the recorded history is linearizable using porcupine.
+package linearizability
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type opType int
+
+const (
+	opGet opType = iota
+	opSet
+	// the compare-and-set on the absent key
+	opSetNX
+	opIncr
+)
+
+func (t opType) String() string {
+	switch t {
+	case opGet:
+		return "get"
+	case opSet:
+		return "set"
+	case opSetNX:
+		return "setnx"
+	case opIncr:
+		return "incr"
+	}
+	return "unknown"
+}
+
+type kvInput struct {
+	Op    opType
+	Key   string
+	Value string
+}
+
+type kvOutput struct {
+	Value  string
+	Exists bool
+	// the reply of the setnx (1 if set) and the incr (the new value)
+	N int64
+	// the write failed without the reply, it may or may not be applied
+	Unknown bool
+}
+
+type kvState struct {
+	Value  string
+	Exists bool
+}
+
+// the value of the absent key is 0 for the incr
+func (s kvState) intValue() (int64, bool) {
+	if !s.Exists {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(s.Value, 10, 64)
+	return n, err == nil
+}
+
+func stepKV(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+	st := state.(kvState)
+	in := input.(kvInput)
+	out := output.(kvOutput)
+	switch in.Op {
+	case opGet:
+		if out.Exists != st.Exists {
+			return false, st
+		}
+		return !out.Exists || out.Value == st.Value, st
+	case opSet:
+		return true, kvState{Value: in.Value, Exists: true}
+	case opSetNX:
+		if st.Exists {
+			return out.Unknown || out.N == 0, st
+		}
+		return out.Unknown || out.N == 1, kvState{Value: in.Value, Exists: true}
+	case opIncr:
+		n, ok := st.intValue()
+		if !ok {
+			return false, st
+		}
+		n++
+		return out.Unknown || out.N == n, kvState{Value: strconv.FormatInt(n, 10), Exists: true}
+	}
+	return false, st
+}
+
+// partition the history by the key, since the operations on the different keys are independent
+func partitionByKey(history []porcupine.Operation) [][]porcupine.Operation {
+	byKey := make(map[string][]porcupine.Operation)
+	for _, op := range history {
+		key := op.Input.(kvInput).Key
+		byKey[key] = append(byKey[key], op)
+	}
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make([][]porcupine.Operation, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, byKey[k])
+	}
+	return ret
+}
+
+// kvModel is the model of the single key register with the get, set, setnx and incr
+var kvModel = porcupine.Model{
+	Partition: partitionByKey,
+	Init: func() interface{} {
+		return kvState{}
+	},
+	Step: stepKV,
+	Equal: func(state1, state2 interface{}) bool {
+		return state1.(kvState) == state2.(kvState)
+	},
+	DescribeOperation: func(input interface{}, output interface{}) string {
+		in := input.(kvInput)
+		out := output.(kvOutput)
+		var ret string
+		switch {
+		case out.Unknown:
+			ret = "unknown"
+		case in.Op == opGet && !out.Exists:
+			ret = "nil"
+		case in.Op == opGet:
+			ret = out.Value
+		case in.Op == opSet:
+			ret = "OK"
+		default:
+			ret = strconv.FormatInt(out.N, 10)
+		}
+		if in.Op == opSet || in.Op == opSetNX {
+			return fmt.Sprintf("%v(%v, %v) -> %v", in.Op, in.Key, in.Value, ret)
+		}
+		return fmt.Sprintf("%v(%v) -> %v", in.Op, in.Key, ret)
+	},
+	DescribeState: func(state interface{}) string {
+		st := state.(kvState)
+		if !st.Exists {
+			return "nil"
+		}
+		return st.Value
+	},
+}
@@ -0,0 +1,82 @@
+package linearizability
+
+import (
+	"math/rand"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+// Nemesis inject the failure into the cluster while running the workload
+type Nemesis interface {
+	Name() string
+	Inject() error
+	Recover() error
+}
+
+// FaultNemesis enable the fault point on one of the data nodes, the nodes should be built
+// with the faultinject tag.
+type FaultNemesis struct {
+	// the http addresses of the data nodes
+	Nodes []string
+	Fault string
+	Conf  common.FaultConf
+
+	injected string
+}
+
+func (fn *FaultNemesis) Name() string {
+	return "fault-" + fn.Fault
+}
+
+func (fn *FaultNemesis) Inject() error {
+	fn.injected = fn.Nodes[rand.Intn(len(fn.Nodes))]
+	params := url.Values{}
+	params.Set("name", fn.Fault)
+	params.Set("probability", strconv.FormatFloat(fn.Conf.Probability, 'f', -1, 64))
+	params.Set("namespace", fn.Conf.Namespace)
+	if fn.Conf.DelayMs > 0 {
+		params.Set("delay_ms", strconv.FormatInt(fn.Conf.DelayMs, 10))
+	}
+	if fn.Conf.Count > 0 {
+		params.Set("count", strconv.FormatInt(fn.Conf.Count, 10))
+	}
+	_, err := common.APIRequest("POST", "http://"+fn.injected+"/faults?"+params.Encode(), nil, time.Second*5, nil)
+	return err
+}
+
+func (fn *FaultNemesis) Recover() error {
+	if fn.injected == "" {
+		return nil
+	}
+	params := url.Values{}
+	params.Set("name", fn.Fault)
+	_, err := common.APIRequest("DELETE", "http://"+fn.injected+"/faults?"+params.Encode(), nil, time.Second*5, nil)
+	return err
+}
+
+// CommandNemesis run the shell commands to inject and recover the failure, such as
+// killing and restarting the data node.
+type CommandNemesis struct {
+	Desc       string
+	InjectCmd  string
+	RecoverCmd string
+}
+
+func (cn *CommandNemesis) Name() string {
+	return cn.Desc
+}
+
+func (cn *CommandNemesis) Inject() error {
+	return exec.Command("sh", "-c", cn.InjectCmd).Run()
+}
+
+func (cn *CommandNemesis) Recover() error {
+	if cn.RecoverCmd == "" {
+		return nil
+	}
+	return exec.Command("sh", "-c", cn.RecoverCmd).Run()
+}
@@ -0,0 +1,176 @@
+package linearizability
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/absolute8511/ZanRedisDB/client"
+	"github.com/siddontang/goredis"
+)
+
+// Config is the workload config for the check
+type Config struct {
+	PDAddrs   []string
+	Namespace string
+	Table     string
+	// the number of the concurrent clients
+	Clients int
+	// the number of the keys for the register and the counter
+	Keys     int
+	Duration time.Duration
+	// the interval to inject and recover the failure
+	NemesisInterval time.Duration
+	Nemeses         []Nemesis
+}
+
+// Run run the workload and return the history of all the clients, the keys are prefixed
+// by the start time so that the history of each run starts from the empty state.
+func Run(conf Config) (*History, error) {
+	if conf.Clients <= 0 || conf.Keys <= 0 {
+		return nil, errors.New("the clients and the keys should be positive")
+	}
+	clients := make([]*client.Client, 0, conf.Clients)
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for i := 0; i < conf.Clients; i++ {
+		c, err := client.NewClient(client.Config{
+			PDAddrs:      conf.PDAddrs,
+			Namespace:    conf.Namespace,
+			DisableRetry: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+
+	h := NewHistory()
+	prefix := "lin-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-"
+	deadline := time.Now().Add(conf.Duration)
+	stopC := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(id int, c *client.Client) {
+			defer wg.Done()
+			w := &worker{id: id, c: c, conf: conf, prefix: prefix, r: rand.New(rand.NewSource(int64(id)))}
+			for time.Now().Before(deadline) {
+				w.doRandomOp(h)
+			}
+		}(i, c)
+	}
+	if len(conf.Nemeses) > 0 && conf.NemesisInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runNemeses(conf, stopC)
+		}()
+	}
+	time.Sleep(time.Until(deadline))
+	close(stopC)
+	wg.Wait()
+	h.Lock()
+	log.Printf("history recorded %v operations, %v unknown writes, %v failed reads",
+		len(h.ops), h.unknownOps, h.failedReads)
+	h.Unlock()
+	return h, nil
+}
+
+func runNemeses(conf Config, stopC chan struct{}) {
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-time.After(conf.NemesisInterval):
+		}
+		n := conf.Nemeses[rand.Intn(len(conf.Nemeses))]
+		log.Printf("inject %v", n.Name())
+		if err := n.Inject(); err != nil {
+			log.Printf("inject %v failed: %v", n.Name(), err)
+		}
+		select {
+		case <-stopC:
+		case <-time.After(conf.NemesisInterval):
+		}
+		log.Printf("recover %v", n.Name())
+		if err := n.Recover(); err != nil {
+			log.Printf("recover %v failed: %v", n.Name(), err)
+		}
+	}
+}
+
+type worker struct {
+	id     int
+	c      *client.Client
+	conf   Config
+	prefix string
+	r      *rand.Rand
+	seq    int64
+}
+
+// the register keys are used by the get, set and setnx, and the counter keys are used by
+// the get and incr, so the incr never fails for the non-integer value.
+func (w *worker) doRandomOp(h *History) {
+	idx := strconv.Itoa(w.r.Intn(w.conf.Keys))
+	var in kvInput
+	p := w.r.Intn(100)
+	switch {
+	case p < 20:
+		in = kvInput{Op: opGet, Key: w.prefix + "reg-" + idx}
+	case p < 40:
+		in = kvInput{Op: opGet, Key: w.prefix + "cnt-" + idx}
+	case p < 60:
+		w.seq++
+		in = kvInput{Op: opSet, Key: w.prefix + "reg-" + idx, Value: fmt.Sprintf("%v-%v", w.id, w.seq)}
+	case p < 70:
+		w.seq++
+		in = kvInput{Op: opSetNX, Key: w.prefix + "reg-" + idx, Value: fmt.Sprintf("%v-%v", w.id, w.seq)}
+	default:
+		in = kvInput{Op: opIncr, Key: w.prefix + "cnt-" + idx}
+	}
+	call := h.now()
+	out, err := w.do(in)
+	h.Record(w.id, in, out, call, err)
+}
+
+func (w *worker) do(in kvInput) (kvOutput, error) {
+	var out kvOutput
+	switch in.Op {
+	case opGet:
+		v, err := goredis.Bytes(w.c.Do("get", w.conf.Table, in.Key))
+		if err == goredis.ErrNil {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out.Value = string(v)
+		out.Exists = true
+	case opSet:
+		_, err := goredis.String(w.c.Do("set", w.conf.Table, in.Key, in.Value))
+		if err != nil {
+			return out, err
+		}
+	case opSetNX:
+		n, err := goredis.Int64(w.c.Do("setnx", w.conf.Table, in.Key, in.Value))
+		if err != nil {
+			return out, err
+		}
+		out.N = n
+	case opIncr:
+		n, err := goredis.Int64(w.c.Do("incr", w.conf.Table, in.Key))
+		if err != nil {
+			return out, err
+		}
+		out.N = n
+	}
+	return out, nil
+}
@@ -62,6 +62,24 @@ var (
 	},
 		[]string{"To"},
 	)
+
+	pendingSendBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_pending_send_bytes",
+		Help:      "The bytes of append messages waiting to be sent to peers.",
+	},
+		[]string{"To"},
+	)
+
+	droppedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "network",
+		Name:      "peer_dropped_messages_total",
+		Help:      "The total number of messages dropped before sent to peers.",
+	},
+		[]string{"To", "Type"},
+	)
 )
 
 func init() {
@@ -70,4 +88,6 @@ func init() {
 	prometheus.MustRegister(sentFailures)
 	prometheus.MustRegister(recvFailures)
 	prometheus.MustRegister(rtts)
+	prometheus.MustRegister(pendingSendBytes)
+	prometheus.MustRegister(droppedMessages)
 }
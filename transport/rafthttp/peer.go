@@ -112,6 +112,9 @@ type peer struct {
 	recvc chan raftpb.Message
 	propc chan raftpb.Message
 
+	// limit the bytes of the append messages waiting to be sent
+	budget *sendBudget
+
 	mu     sync.Mutex
 	paused bool
 
@@ -127,6 +130,7 @@ func startPeer(transport *Transport, urls types.URLs, peerID types.ID, ps *stats
 	picker := newURLPicker(urls)
 	errorc := transport.ErrorC
 	r := transport.Raft
+	budget := newSendBudget(peerID, transport.MaxPeerPendingBytes)
 	pipeline := &pipeline{
 		peerID:    peerID,
 		tr:        transport,
@@ -135,6 +139,7 @@ func startPeer(transport *Transport, urls types.URLs, peerID types.ID, ps *stats
 		peerStats: ps,
 		raft:      r,
 		errorc:    errorc,
+		budget:    budget,
 	}
 	pipeline.start()
 
@@ -143,13 +148,14 @@ func startPeer(transport *Transport, urls types.URLs, peerID types.ID, ps *stats
 		r:              r,
 		status:         status,
 		picker:         picker,
-		msgAppV2Writer: startStreamWriter(peerID, status, ps, r),
-		writer:         startStreamWriter(peerID, status, ps, r),
+		msgAppV2Writer: startStreamWriter(peerID, status, ps, r, budget),
+		writer:         startStreamWriter(peerID, status, ps, r, budget),
 		pipeline:       pipeline,
 		snapSender:     newSnapshotSender(transport, picker, peerID, status),
 		recvc:          make(chan raftpb.Message, recvBufSize),
 		propc:          make(chan raftpb.Message, maxPendingProposals),
 		stopc:          make(chan struct{}),
+		budget:         budget,
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -217,9 +223,20 @@ func (p *peer) send(m raftpb.Message) {
 	}
 
 	writec, name := p.pick(m)
+	if !p.budget.acquire(m) {
+		// the slow peer should catch up later by the normal probe
+		p.r.ReportUnreachable(m.To, m.ToGroup)
+		droppedMessages.WithLabelValues(p.id.String(), msgTypeLabel(m)).Inc()
+		if p.status.isActive() {
+			plog.MergeWarningf("dropped internal raft message to %s since the pending bytes %v exceed the limit", p.id, p.budget.pendingBytes())
+		}
+		return
+	}
 	select {
 	case writec <- m:
 	default:
+		p.budget.release(m)
+		droppedMessages.WithLabelValues(p.id.String(), msgTypeLabel(m)).Inc()
 		p.r.ReportUnreachable(m.To, m.ToGroup)
 		if isMsgSnap(m) {
 			p.r.ReportSnapshot(m.To, m.ToGroup, raft.SnapshotFailure)
@@ -50,6 +50,8 @@ type pipeline struct {
 	errorc chan error
 	// deprecate when we depercate v2 API
 	peerStats *stats.PeerStats
+	// the budget of the peer, nil for the remote
+	budget *sendBudget
 
 	msgc chan raftpb.Message
 	// wait for the handling routines
@@ -79,6 +81,7 @@ func (p *pipeline) handle() {
 	for {
 		select {
 		case m := <-p.msgc:
+			p.budget.release(m)
 			start := time.Now()
 			err := p.post(pbutil.MustMarshal(&m))
 			end := time.Now()
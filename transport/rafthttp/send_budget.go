@@ -0,0 +1,80 @@
+package rafthttp
+
+import (
+	"sync/atomic"
+
+	"github.com/absolute8511/ZanRedisDB/pkg/types"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+// DefaultMaxPeerPendingBytes is the default memory limit for the append messages
+// waiting to be sent to one peer.
+const DefaultMaxPeerPendingBytes = 256 * 1024 * 1024
+
+// sendBudget bound the memory used by the append messages waiting in the outbound
+// queues of the peer, so the backlog of a dead or slow peer can not consume all
+// the memory. The heartbeats, votes and responses are small and sent in the
+// separate stream, they are never limited so the raft groups can keep the leader.
+type sendBudget struct {
+	peerID  types.ID
+	max     int64
+	pending int64
+}
+
+// the budget will be nil if max is negative, which means no limit
+func newSendBudget(peerID types.ID, max int64) *sendBudget {
+	if max < 0 {
+		return nil
+	}
+	if max == 0 {
+		max = DefaultMaxPeerPendingBytes
+	}
+	return &sendBudget{peerID: peerID, max: max}
+}
+
+func isBudgeted(m raftpb.Message) bool { return m.Type == raftpb.MsgApp }
+
+// acquire return false if the message should be dropped since the pending messages
+// exceed the limit, the message is always allowed if nothing pending.
+func (b *sendBudget) acquire(m raftpb.Message) bool {
+	if b == nil || !isBudgeted(m) {
+		return true
+	}
+	size := int64(m.Size())
+	pending := atomic.AddInt64(&b.pending, size)
+	if pending > b.max && pending != size {
+		atomic.AddInt64(&b.pending, -size)
+		return false
+	}
+	pendingSendBytes.WithLabelValues(b.peerID.String()).Set(float64(pending))
+	return true
+}
+
+// release should be called while the acquired message is sent or dropped
+func (b *sendBudget) release(m raftpb.Message) {
+	if b == nil || !isBudgeted(m) {
+		return
+	}
+	pending := atomic.AddInt64(&b.pending, -int64(m.Size()))
+	pendingSendBytes.WithLabelValues(b.peerID.String()).Set(float64(pending))
+}
+
+func (b *sendBudget) pendingBytes() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.pending)
+}
+
+func msgTypeLabel(m raftpb.Message) string {
+	switch {
+	case isMsgSnap(m):
+		return "snapshot"
+	case isMsgApp(m):
+		return "append"
+	case m.Type == raftpb.MsgHeartbeat || m.Type == raftpb.MsgHeartbeatResp:
+		return "heartbeat"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,47 @@
+package rafthttp
+
+import (
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/pkg/types"
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+func TestSendBudget(t *testing.T) {
+	if b := newSendBudget(types.ID(1), -1); b != nil {
+		t.Fatalf("budget should be nil for negative limit")
+	}
+	if b := newSendBudget(types.ID(1), 0); b.max != DefaultMaxPeerPendingBytes {
+		t.Fatalf("max = %v, want %v", b.max, DefaultMaxPeerPendingBytes)
+	}
+	app := raftpb.Message{Type: raftpb.MsgApp, Entries: []raftpb.Entry{{Data: make([]byte, 100)}}}
+	hb := raftpb.Message{Type: raftpb.MsgHeartbeat}
+	b := newSendBudget(types.ID(1), int64(app.Size())+10)
+	// the first message is always allowed even larger than the limit
+	if !b.acquire(app) {
+		t.Fatalf("first append should be allowed")
+	}
+	if b.acquire(app) {
+		t.Fatalf("append should be dropped above the limit")
+	}
+	if !b.acquire(hb) {
+		t.Fatalf("heartbeat should never be limited")
+	}
+	if b.pendingBytes() != int64(app.Size()) {
+		t.Fatalf("pending = %v, want %v", b.pendingBytes(), app.Size())
+	}
+	b.release(hb)
+	b.release(app)
+	if b.pendingBytes() != 0 {
+		t.Fatalf("pending = %v, want 0", b.pendingBytes())
+	}
+	if !b.acquire(app) {
+		t.Fatalf("append should be allowed after released")
+	}
+
+	var nb *sendBudget
+	if !nb.acquire(app) {
+		t.Fatalf("nil budget should not limit")
+	}
+	nb.release(app)
+}
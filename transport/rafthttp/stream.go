@@ -107,6 +107,7 @@ type streamWriter struct {
 	status *peerStatus
 	ps     *stats.PeerStats
 	r      Raft
+	budget *sendBudget
 
 	mu      sync.Mutex // guard field working and closer
 	closer  io.Closer
@@ -120,12 +121,13 @@ type streamWriter struct {
 
 // startStreamWriter creates a streamWrite and starts a long running go-routine that accepts
 // messages and writes to the attached outgoing connection.
-func startStreamWriter(id types.ID, status *peerStatus, ps *stats.PeerStats, r Raft) *streamWriter {
+func startStreamWriter(id types.ID, status *peerStatus, ps *stats.PeerStats, r Raft, budget *sendBudget) *streamWriter {
 	w := &streamWriter{
 		peerID: id,
 		status: status,
 		ps:     ps,
 		r:      r,
+		budget: budget,
 		msgc:   make(chan raftpb.Message, streamBufSize),
 		connc:  make(chan *outgoingConn),
 		stopc:  make(chan struct{}),
@@ -171,6 +173,7 @@ func (cw *streamWriter) run() {
 			heartbeatc, msgc = nil, nil
 
 		case m := <-msgc:
+			cw.budget.release(m)
 			err := enc.encode(&m)
 			if err == nil {
 				unflushed += m.Size()
@@ -249,6 +252,10 @@ func (cw *streamWriter) closeUnlocked() bool {
 	if len(cw.msgc) > 0 {
 		cw.r.ReportUnreachable(0, raftpb.Group{NodeId: uint64(cw.peerID)})
 	}
+	// the queued messages will be discarded, give back the budget
+	for len(cw.msgc) > 0 {
+		cw.budget.release(<-cw.msgc)
+	}
 	cw.msgc = make(chan raftpb.Message, streamBufSize)
 	cw.working = false
 	return true
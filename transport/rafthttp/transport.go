@@ -118,6 +118,9 @@ type Transport struct {
 	// When an error is received from ErrorC, user should stop raft state
 	// machine and thus stop the Transport.
 	ErrorC chan error
+	// MaxPeerPendingBytes limits the bytes of the append messages waiting to be
+	// sent to each peer, 0 means DefaultMaxPeerPendingBytes and negative means no limit.
+	MaxPeerPendingBytes int64
 
 	streamRt   http.RoundTripper // roundTripper used by streams
 	pipelineRt http.RoundTripper // roundTripper used by pipelines
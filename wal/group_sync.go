@@ -0,0 +1,101 @@
+package wal
+
+import (
+	"os"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/pkg/fileutil"
+)
+
+const defaultMaxSyncBatch = 256
+
+type syncReq struct {
+	f    *os.File
+	errc chan error
+}
+
+// GroupSyncer handles the fsync requests of the wals on the same node in batches. The
+// requests queued while the previous batch is flushing are handled in the next batch
+// without any extra delay, the duplicated requests on the same file are merged into
+// one fsync and the different files are synced concurrently. Each wal file still
+// needs its own fsync.
+type GroupSyncer struct {
+	maxBatch int
+	reqc     chan *syncReq
+	stopOnce sync.Once
+	stopc    chan struct{}
+	done     chan struct{}
+}
+
+func NewGroupSyncer() *GroupSyncer {
+	g := &GroupSyncer{
+		maxBatch: defaultMaxSyncBatch,
+		reqc:     make(chan *syncReq, defaultMaxSyncBatch),
+		stopc:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go g.run()
+	return g
+}
+
+// Stop the group syncer, the later syncs will be done directly by the caller.
+func (g *GroupSyncer) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stopc)
+	})
+	<-g.done
+}
+
+// sync will wait until the file synced in the next batch
+func (g *GroupSyncer) sync(f *os.File) error {
+	req := &syncReq{f: f, errc: make(chan error, 1)}
+	select {
+	case g.reqc <- req:
+	case <-g.stopc:
+		return fileutil.Fdatasync(f)
+	}
+	return <-req.errc
+}
+
+func (g *GroupSyncer) run() {
+	defer close(g.done)
+	for {
+		var batch []*syncReq
+		select {
+		case req := <-g.reqc:
+			batch = append(batch, req)
+		case <-g.stopc:
+			return
+		}
+	collect:
+		for len(batch) < g.maxBatch {
+			select {
+			case req := <-g.reqc:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+		g.flush(batch)
+	}
+}
+
+func (g *GroupSyncer) flush(batch []*syncReq) {
+	files := make(map[*os.File][]*syncReq, len(batch))
+	for _, req := range batch {
+		files[req.f] = append(files[req.f], req)
+	}
+	syncBatchSizes.Observe(float64(len(files)))
+	var wg sync.WaitGroup
+	for f, reqs := range files {
+		wg.Add(1)
+		go func(f *os.File, reqs []*syncReq) {
+			defer wg.Done()
+			err := fileutil.Fdatasync(f)
+			for _, req := range reqs {
+				req.errc <- err
+			}
+		}(f, reqs)
+	}
+	wg.Wait()
+}
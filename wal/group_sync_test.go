@@ -0,0 +1,63 @@
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/absolute8511/ZanRedisDB/raft/raftpb"
+)
+
+func TestGroupSyncerSave(t *testing.T) {
+	gs := NewGroupSyncer()
+	defer gs.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		p, err := ioutil.TempDir(os.TempDir(), "waltest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(p)
+		w, err := Create(filepath.Join(p, "wal"), nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetGroupSyncer(gs)
+		wg.Add(1)
+		go func(w *WAL) {
+			defer wg.Done()
+			defer w.Close()
+			for j := 1; j <= 10; j++ {
+				st := raftpb.HardState{Term: 1, Commit: uint64(j)}
+				ents := []raftpb.Entry{{Index: uint64(j), Term: 1, Data: []byte("data")}}
+				if err := w.Save(st, ents); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestGroupSyncerStopped(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "walsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	gs := NewGroupSyncer()
+	if err := gs.sync(f); err != nil {
+		t.Fatal(err)
+	}
+	gs.Stop()
+	// sync directly after stopped
+	if err := gs.sync(f); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -24,8 +24,17 @@ var (
 		Help:      "The latency distributions of fsync called by wal.",
 		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
 	})
+
+	syncBatchSizes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "etcd",
+		Subsystem: "disk",
+		Name:      "wal_batch_fsync_files",
+		Help:      "The number of wal files synced concurrently in one batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 9),
+	})
 )
 
 func init() {
 	prometheus.MustRegister(syncDurations)
+	prometheus.MustRegister(syncBatchSizes)
 }
@@ -87,6 +87,8 @@ type WAL struct {
 	locks          []*fileutil.LockedFile // the locked files the WAL holds (the name is increasing)
 	fp             *filePipeline
 	optimizedFsync bool
+	// share the fsync with the other wals if set
+	syncer *GroupSyncer
 }
 
 // Create creates a WAL ready for appending records. The given metadata is
@@ -286,6 +288,13 @@ func openAtIndex(dirpath string, snap walpb.Snapshot, write bool, optimizedFsync
 	return w, nil
 }
 
+// SetGroupSyncer make the fsync of the wal handled in batches with the other wals by the group syncer
+func (w *WAL) SetGroupSyncer(gs *GroupSyncer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syncer = gs
+}
+
 func (w *WAL) ChangeFsyncFlag(optimizeFsync bool) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -495,7 +504,12 @@ func (w *WAL) sync(fsync bool) error {
 		return nil
 	}
 	start := time.Now()
-	err := fileutil.Fdatasync(w.tail().File)
+	var err error
+	if w.syncer != nil {
+		err = w.syncer.sync(w.tail().File)
+	} else {
+		err = fileutil.Fdatasync(w.tail().File)
+	}
 
 	duration := time.Since(start)
 	if duration > warnSyncDuration {